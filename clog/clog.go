@@ -0,0 +1,257 @@
+// Package clog logs the messages of the modules of the node with structured fields, as text by glog
+// or as JSON, at verbosity levels that are set per module and can be changed at runtime
+package clog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Keys of the fields that are logged with the messages about streams, orchestrators and payments
+const (
+	ManifestID   = "manifestID"
+	Orchestrator = "orchestrator"
+	Sender       = "sender"
+	Recipient    = "recipient"
+	SeqNo        = "seqNo"
+	Nonce        = "nonce"
+)
+
+// Formats of the logs of the node
+const (
+	// Messages are logged by glog, with their fields appended as key=value pairs
+	FormatText = "text"
+	// Messages are logged to stderr as JSON objects, one per line
+	FormatJSON = "json"
+)
+
+var config = struct {
+	mu      sync.RWMutex
+	format  string
+	levels  map[string]int
+	modules map[string]bool
+	out     io.Writer
+}{
+	format:  FormatText,
+	levels:  make(map[string]int),
+	modules: make(map[string]bool),
+	out:     os.Stderr,
+}
+
+// SetFormat sets the format of the logs of the node
+func SetFormat(format string) error {
+	if format != FormatText && format != FormatJSON {
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	config.mu.Lock()
+	defer config.mu.Unlock()
+	config.format = format
+	return nil
+}
+
+// SetLevel sets the verbosity of the messages that a module logs. The verbosity of a module is
+// the -v flag of glog if it is not set, or if it's set to a negative level
+func SetLevel(module string, level int) {
+	config.mu.Lock()
+	defer config.mu.Unlock()
+	if level < 0 {
+		delete(config.levels, module)
+		return
+	}
+	config.levels[module] = level
+}
+
+// SetLevels sets the verbosity of modules from a comma-separated list of module=level pairs
+func SetLevels(levels string) error {
+	parsed := make(map[string]int)
+	for _, entry := range strings.Split(levels, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("invalid log level %q", entry)
+		}
+		level, err := strconv.Atoi(kv[1])
+		if err != nil {
+			return fmt.Errorf("invalid log level %q", entry)
+		}
+		parsed[kv[0]] = level
+	}
+	for module, level := range parsed {
+		SetLevel(module, level)
+	}
+	return nil
+}
+
+// Levels returns the verbosity of the modules whose verbosity is set
+func Levels() map[string]int {
+	config.mu.RLock()
+	defer config.mu.RUnlock()
+	levels := make(map[string]int, len(config.levels))
+	for module, level := range config.levels {
+		levels[module] = level
+	}
+	return levels
+}
+
+// Modules returns the modules that loggers were created for, sorted by name
+func Modules() []string {
+	config.mu.RLock()
+	defer config.mu.RUnlock()
+	modules := make([]string, 0, len(config.modules))
+	for module := range config.modules {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	return modules
+}
+
+// Status is the log format and the verbosity of the modules of the node
+type Status struct {
+	Format  string         `json:"format"`
+	Modules []string       `json:"modules"`
+	Levels  map[string]int `json:"levels"`
+}
+
+// GetStatus returns the log format and the verbosity of the modules whose verbosity is set
+func GetStatus() *Status {
+	config.mu.RLock()
+	format := config.format
+	config.mu.RUnlock()
+	return &Status{Format: format, Modules: Modules(), Levels: Levels()}
+}
+
+// Logger logs the messages of a module with the fields that were added to it
+type Logger struct {
+	module string
+	fields []interface{}
+}
+
+// New returns the logger of a module
+func New(module string) *Logger {
+	config.mu.Lock()
+	defer config.mu.Unlock()
+	config.modules[module] = true
+	return &Logger{module: module}
+}
+
+// With returns a logger that logs the fields of l and the key/value pairs of keyvals
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	if len(keyvals)%2 != 0 {
+		keyvals = append(keyvals, "")
+	}
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyvals...)
+	return &Logger{module: l.module, fields: fields}
+}
+
+// Verbose logs the messages of a module if their verbosity is enabled for the module
+type Verbose struct {
+	l  *Logger
+	on bool
+}
+
+// V returns a Verbose that logs if the verbosity of the module is at least level
+func (l *Logger) V(level glog.Level) Verbose {
+	config.mu.RLock()
+	moduleLevel, ok := config.levels[l.module]
+	config.mu.RUnlock()
+	if ok {
+		return Verbose{l: l, on: int(level) <= moduleLevel}
+	}
+	return Verbose{l: l, on: bool(glog.V(level))}
+}
+
+// Infof logs a message if the verbosity is enabled
+func (v Verbose) Infof(format string, args ...interface{}) {
+	if v.on {
+		v.l.output(glog.InfoDepth, "info", fmt.Sprintf(format, args...))
+	}
+}
+
+// Infof logs an informational message
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.output(glog.InfoDepth, "info", fmt.Sprintf(format, args...))
+}
+
+// Warningf logs a warning
+func (l *Logger) Warningf(format string, args ...interface{}) {
+	l.output(glog.WarningDepth, "warning", fmt.Sprintf(format, args...))
+}
+
+// Errorf logs an error
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.output(glog.ErrorDepth, "error", fmt.Sprintf(format, args...))
+}
+
+// output logs a message at a severity. Text logs are written by the glog function of the severity
+func (l *Logger) output(glogDepth func(int, ...interface{}), severity, msg string) {
+	config.mu.RLock()
+	format, out := config.format, config.out
+	config.mu.RUnlock()
+
+	if format != FormatJSON {
+		var b strings.Builder
+		b.WriteString(msg)
+		for i := 0; i+1 < len(l.fields); i += 2 {
+			fmt.Fprintf(&b, " %v=%v", l.fields[i], l.fields[i+1])
+		}
+		glogDepth(2, b.String())
+		return
+	}
+
+	var b bytes.Buffer
+	b.WriteString(`{"time":`)
+	writeJSON(&b, time.Now().UTC().Format(time.RFC3339Nano))
+	b.WriteString(`,"level":`)
+	writeJSON(&b, severity)
+	b.WriteString(`,"module":`)
+	writeJSON(&b, l.module)
+	if _, file, line, ok := runtime.Caller(2); ok {
+		b.WriteString(`,"caller":`)
+		writeJSON(&b, fmt.Sprintf("%v:%v", filepath.Base(file), line))
+	}
+	for i := 0; i+1 < len(l.fields); i += 2 {
+		b.WriteByte(',')
+		writeJSON(&b, fmt.Sprint(l.fields[i]))
+		b.WriteByte(':')
+		writeJSON(&b, l.fields[i+1])
+	}
+	b.WriteString(`,"msg":`)
+	writeJSON(&b, msg)
+	b.WriteString("}\n")
+	out.Write(b.Bytes())
+}
+
+// writeJSON writes a value as JSON. Values that are not numbers or booleans are written as strings
+func writeJSON(b *bytes.Buffer, v interface{}) {
+	switch x := v.(type) {
+	case string, bool, int, int32, int64, uint, uint32, uint64, float64, nil:
+	case error:
+		v = x.Error()
+	case fmt.Stringer:
+		v = x.String()
+	default:
+		v = fmt.Sprint(x)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	b.Write(data)
+}
@@ -0,0 +1,96 @@
+package clog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetLevels(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { config.levels = make(map[string]int) }()
+
+	assert.Nil(SetLevels("server=6, pm=4,,"))
+	assert.Equal(map[string]int{"server": 6, "pm": 4}, Levels())
+
+	// Invalid entries don't change the levels
+	assert.Error(SetLevels("core=5,pm"))
+	assert.Error(SetLevels("core=five"))
+	assert.Error(SetLevels("=5"))
+	assert.Equal(map[string]int{"server": 6, "pm": 4}, Levels())
+
+	// A negative level resets the module to the glog verbosity
+	SetLevel("pm", -1)
+	assert.Equal(map[string]int{"server": 6}, Levels())
+}
+
+func TestV(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { config.levels = make(map[string]int) }()
+
+	l := New("test")
+	SetLevel("test", 5)
+	assert.True(l.V(4).on)
+	assert.True(l.V(5).on)
+	assert.False(l.V(6).on)
+
+	// Loggers with fields use the level of their module
+	assert.True(l.With(ManifestID, "mid").V(5).on)
+
+	// The glog verbosity is used if the module level is not set
+	SetLevel("test", -1)
+	assert.False(l.V(5).on)
+}
+
+func TestJSONOutput(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	var out bytes.Buffer
+	config.out = &out
+	require.Nil(SetFormat(FormatJSON))
+	defer func() {
+		SetFormat(FormatText)
+		config.levels = make(map[string]int)
+	}()
+
+	l := New("test").With(ManifestID, "mid", SeqNo, 3)
+	l.With(Orchestrator, "https://127.0.0.1:8935").Errorf("error with segment: %v", errors.New("boom"))
+
+	var entry map[string]interface{}
+	require.Nil(json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal("error", entry["level"])
+	assert.Equal("test", entry["module"])
+	assert.Equal("mid", entry[ManifestID])
+	assert.Equal(float64(3), entry[SeqNo])
+	assert.Equal("https://127.0.0.1:8935", entry[Orchestrator])
+	assert.Equal("error with segment: boom", entry["msg"])
+	assert.Contains(entry["caller"], "clog_test.go:")
+
+	// Messages are not logged above the level of the module
+	out.Reset()
+	SetLevel("test", 4)
+	l.V(5).Infof("not logged")
+	assert.Empty(out.String())
+	l.V(4).Infof("logged %v", errors.New("err"))
+	require.Nil(json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal("info", entry["level"])
+	assert.Equal("logged err", entry["msg"])
+
+	assert.Error(SetFormat("xml"))
+}
+
+func TestGetStatus(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { config.levels = make(map[string]int) }()
+
+	New("status")
+	SetLevel("status", 6)
+	status := GetStatus()
+	assert.Equal(FormatText, status.Format)
+	assert.Contains(status.Modules, "status")
+	assert.Equal(6, status.Levels["status"])
+}
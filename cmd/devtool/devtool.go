@@ -160,7 +160,7 @@ func ethSetup(ethAcctAddr, keystoreDir string, isBroadcaster bool) {
 	glog.Infof("Using controller address %s", ethController)
 
 	client, err := eth.NewClient(ethcommon.HexToAddress(ethAcctAddr), keystoreDir, backend,
-		ethcommon.HexToAddress(ethController), ethTxTimeout)
+		ethcommon.HexToAddress(ethController), ethTxTimeout, nil)
 	if err != nil {
 		glog.Errorf("Failed to create client: %v", err)
 		return
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/livepeer/go-livepeer/eth"
+	"github.com/livepeer/go-livepeer/pm"
+)
+
+// redemption is a winning ticket that was redeemed with the stub ticket broker
+type redemption struct {
+	sender    ethcommon.Address
+	recipient ethcommon.Address
+	faceValue *big.Int
+	// Amount paid out of the deposit and the reserve of the sender
+	paid *big.Int
+}
+
+// stubChain stands in for the Livepeer protocol contracts. It keeps the ledger of the deposits and
+// reserves of senders and of the winning tickets redeemed by recipients, and implements the
+// rounds manager, sender manager and gas price monitor that the PM components of the nodes need
+type stubChain struct {
+	mu       sync.Mutex
+	round    *big.Int
+	poolSize *big.Int
+	gasPrice *big.Int
+
+	deposits map[ethcommon.Address]*big.Int
+	reserves map[ethcommon.Address]*big.Int
+	// Amount claimed from the reserve of a sender by each recipient
+	claimed map[ethcommon.Address]map[ethcommon.Address]*big.Int
+	// Amount paid to each recipient
+	earnings map[ethcommon.Address]*big.Int
+
+	redeemed    map[ethcommon.Hash]bool
+	redemptions []*redemption
+	// Redemptions that the broker rejected
+	rejected []error
+}
+
+func newStubChain(gasPrice *big.Int) *stubChain {
+	return &stubChain{
+		round:    big.NewInt(1),
+		poolSize: big.NewInt(1),
+		gasPrice: gasPrice,
+		deposits: make(map[ethcommon.Address]*big.Int),
+		reserves: make(map[ethcommon.Address]*big.Int),
+		claimed:  make(map[ethcommon.Address]map[ethcommon.Address]*big.Int),
+		earnings: make(map[ethcommon.Address]*big.Int),
+		redeemed: make(map[ethcommon.Hash]bool),
+	}
+}
+
+// fund funds the deposit and the reserve of a sender
+func (c *stubChain) fund(sender ethcommon.Address, deposit, reserve *big.Int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.deposits[sender] = new(big.Int).Set(deposit)
+	c.reserves[sender] = new(big.Int).Set(reserve)
+}
+
+// redeem pays out a winning ticket from the deposit of its sender and, if the deposit is
+// insufficient, from the share of the reserve of the sender that the recipient can claim
+func (c *stubChain) redeem(ticket *pm.Ticket, sig []byte, recipientRand *big.Int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.validateRedemption(ticket, sig, recipientRand)
+	if err != nil {
+		c.rejected = append(c.rejected, err)
+		return err
+	}
+	c.redeemed[ticket.Hash()] = true
+
+	paid := new(big.Int)
+	deposit := c.balanceOf(c.deposits, ticket.Sender)
+	if deposit.Cmp(ticket.FaceValue) >= 0 {
+		deposit.Sub(deposit, ticket.FaceValue)
+		paid.Set(ticket.FaceValue)
+	} else {
+		paid.Set(deposit)
+		deposit.SetInt64(0)
+
+		claimable := c.claimableReserve(ticket.Sender, ticket.Recipient)
+		owed := new(big.Int).Sub(ticket.FaceValue, paid)
+		if owed.Cmp(claimable) > 0 {
+			owed = claimable
+		}
+		reserve := c.balanceOf(c.reserves, ticket.Sender)
+		reserve.Sub(reserve, owed)
+		claimed := c.claimedBy(ticket.Sender, ticket.Recipient)
+		claimed.Add(claimed, owed)
+		paid.Add(paid, owed)
+	}
+	earnings := c.balanceOf(c.earnings, ticket.Recipient)
+	earnings.Add(earnings, paid)
+
+	c.redemptions = append(c.redemptions, &redemption{
+		sender:    ticket.Sender,
+		recipient: ticket.Recipient,
+		faceValue: ticket.FaceValue,
+		paid:      paid,
+	})
+	return nil
+}
+
+func (c *stubChain) validateRedemption(ticket *pm.Ticket, sig []byte, recipientRand *big.Int) error {
+	if c.redeemed[ticket.Hash()] {
+		return fmt.Errorf("ticket with senderNonce=%v was already redeemed", ticket.SenderNonce)
+	}
+	if !pm.VerifySig(ticket.Sender, ticket.Hash().Bytes(), sig) {
+		return fmt.Errorf("invalid signature for ticket with senderNonce=%v", ticket.SenderNonce)
+	}
+	randHash := crypto.Keccak256Hash(ethcommon.LeftPadBytes(recipientRand.Bytes(), 32))
+	if randHash != ticket.RecipientRandHash {
+		return fmt.Errorf("recipientRand does not match the recipientRandHash of ticket with senderNonce=%v", ticket.SenderNonce)
+	}
+	return nil
+}
+
+// claimableReserve returns the share of the reserve of a sender that a recipient can still claim.
+// Caller should hold the lock
+func (c *stubChain) claimableReserve(sender, recipient ethcommon.Address) *big.Int {
+	alloc := new(big.Int).Div(c.balanceOf(c.reserves, sender), c.poolSize)
+	alloc.Sub(alloc, c.claimedBy(sender, recipient))
+	if alloc.Sign() < 0 {
+		return new(big.Int)
+	}
+	return alloc
+}
+
+// Caller should hold the lock
+func (c *stubChain) balanceOf(balances map[ethcommon.Address]*big.Int, addr ethcommon.Address) *big.Int {
+	if _, ok := balances[addr]; !ok {
+		balances[addr] = new(big.Int)
+	}
+	return balances[addr]
+}
+
+// Caller should hold the lock
+func (c *stubChain) claimedBy(sender, recipient ethcommon.Address) *big.Int {
+	if _, ok := c.claimed[sender]; !ok {
+		c.claimed[sender] = make(map[ethcommon.Address]*big.Int)
+	}
+	return c.balanceOf(c.claimed[sender], recipient)
+}
+
+// LastInitializedRound implements pm.RoundsManager
+func (c *stubChain) LastInitializedRound() *big.Int {
+	return c.round
+}
+
+// LastInitializedBlockHash implements pm.RoundsManager
+func (c *stubChain) LastInitializedBlockHash() [32]byte {
+	return [32]byte{}
+}
+
+// GetTranscoderPoolSize implements pm.RoundsManager
+func (c *stubChain) GetTranscoderPoolSize() *big.Int {
+	return c.poolSize
+}
+
+// GetSenderInfo implements pm.SenderManager
+func (c *stubChain) GetSenderInfo(addr ethcommon.Address) (*pm.SenderInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return &pm.SenderInfo{
+		Deposit:       new(big.Int).Set(c.balanceOf(c.deposits, addr)),
+		WithdrawBlock: big.NewInt(0),
+		Reserve:       new(big.Int).Set(c.balanceOf(c.reserves, addr)),
+		ReserveState:  pm.NotFrozen,
+		ThawRound:     big.NewInt(0),
+	}, nil
+}
+
+// ClaimedReserve implements pm.SenderManager
+func (c *stubChain) ClaimedReserve(reserveHolder ethcommon.Address, claimant ethcommon.Address) (*big.Int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return new(big.Int).Set(c.claimedBy(reserveHolder, claimant)), nil
+}
+
+// Clear implements pm.SenderManager. The stub chain has no cache to clear
+func (c *stubChain) Clear(addr ethcommon.Address) {}
+
+// GasPrice implements pm.GasPriceMonitor
+func (c *stubChain) GasPrice() *big.Int {
+	return c.gasPrice
+}
+
+// chainClient is the ETH client of a node of the harness. It signs with the key of the node and
+// sends the sender and ticket broker calls of the node to the stub chain
+type chainClient struct {
+	*eth.StubClient
+	chain   *stubChain
+	key     *ecdsa.PrivateKey
+	account accounts.Account
+}
+
+func newChainClient(chain *stubChain) (*chainClient, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	return &chainClient{
+		StubClient: &eth.StubClient{},
+		chain:      chain,
+		key:        key,
+		account:    accounts.Account{Address: crypto.PubkeyToAddress(key.PublicKey)},
+	}, nil
+}
+
+func (c *chainClient) Account() accounts.Account {
+	return c.account
+}
+
+// Sign signs a message the way the accounts of ETH clients do, so that the signatures can be
+// verified with pm.VerifySig
+func (c *chainClient) Sign(msg []byte) ([]byte, error) {
+	personalMsg := fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", 32, msg)
+	return crypto.Sign(crypto.Keccak256([]byte(personalMsg)), c.key)
+}
+
+func (c *chainClient) GetSenderInfo(addr ethcommon.Address) (*pm.SenderInfo, error) {
+	return c.chain.GetSenderInfo(addr)
+}
+
+func (c *chainClient) ClaimedReserve(reserveHolder ethcommon.Address, claimant ethcommon.Address) (*big.Int, error) {
+	return c.chain.ClaimedReserve(reserveHolder, claimant)
+}
+
+func (c *chainClient) RedeemWinningTicket(ticket *pm.Ticket, sig []byte, recipientRand *big.Int) (*types.Transaction, error) {
+	if err := c.chain.redeem(ticket, sig, recipientRand); err != nil {
+		return nil, err
+	}
+	return types.NewTransaction(0, ethcommon.Address{}, big.NewInt(0), 0, big.NewInt(0), nil), nil
+}
+
+func (c *chainClient) CheckTx(tx *types.Transaction) error {
+	return nil
+}
@@ -0,0 +1,360 @@
+// e2e runs a broadcaster, an orchestrator and a remote transcoder in a single process against a stub
+// chain, pushes synthetic streams to the broadcaster and checks the playlists of the streams, the
+// tickets that the orchestrator received and the ledger of the stub chain. It exits with a non-zero
+// status if any check fails
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/server"
+	"github.com/livepeer/m3u8"
+)
+
+type config struct {
+	datadir            string
+	streams            int
+	segments           int
+	segmentDuration    time.Duration
+	segmentFile        string
+	transcodingOptions string
+	transcode          bool
+	transcoderCapacity int
+	orchSecret         string
+	pricePerPixel      int64
+	ticketEV           *big.Int
+	ticketFaceValue    *big.Int
+	deposit            *big.Int
+	reserve            *big.Int
+	timeout            time.Duration
+}
+
+func main() {
+	flag.Set("logtostderr", "true")
+	datadir := flag.String("datadir", "", "Data directory of the nodes. A temporary directory that is removed on exit if empty")
+	streams := flag.Int("streams", 2, "Number of streams pushed to the broadcaster at the same time")
+	segments := flag.Int("segments", 4, "Number of segments pushed for every stream")
+	segmentDuration := flag.Duration("segmentDuration", 2*time.Second, "Duration of the pushed segments")
+	segmentFile := flag.String("segment", "", "MPEG-TS file pushed as every segment. Synthetic segments are pushed if empty")
+	transcodingOptions := flag.String("transcodingOptions", "P240p30fps16x9,P360p30fps16x9", "Transcoding options of the broadcaster")
+	transcode := flag.Bool("transcode", false, "Transcode with ffmpeg instead of copying the source segment to every rendition. Requires -segment")
+	transcoderCapacity := flag.Int("transcoderCapacity", 10, "Number of segments the remote transcoder transcodes at the same time")
+	pricePerPixel := flag.Int64("pricePerPixel", 1, "Price of the orchestrator in wei per pixel")
+	ticketEV := flag.String("ticketEV", "1000000000", "Expected value of the tickets of the orchestrator in wei")
+	ticketFaceValue := flag.String("ticketFaceValue", "", "Face value of the tickets of the orchestrator in wei. Every ticket wins if empty")
+	deposit := flag.String("deposit", "1000000000000000000", "Deposit of the broadcaster in wei")
+	reserve := flag.String("reserve", "1000000000000000000", "Reserve of the broadcaster in wei")
+	timeout := flag.Duration("timeout", 2*time.Minute, "Time the harness waits for the streams to be transcoded and the tickets to be redeemed")
+	flag.Parse()
+
+	cfg := &config{
+		datadir:            *datadir,
+		streams:            *streams,
+		segments:           *segments,
+		segmentDuration:    *segmentDuration,
+		segmentFile:        *segmentFile,
+		transcodingOptions: *transcodingOptions,
+		transcode:          *transcode,
+		transcoderCapacity: *transcoderCapacity,
+		orchSecret:         "e2e-" + common.RandName(),
+		pricePerPixel:      *pricePerPixel,
+		timeout:            *timeout,
+	}
+	var err error
+	if cfg.ticketEV, err = parseWei("-ticketEV", *ticketEV); err != nil {
+		glog.Fatal(err)
+	}
+	cfg.ticketFaceValue = cfg.ticketEV
+	if *ticketFaceValue != "" {
+		if cfg.ticketFaceValue, err = parseWei("-ticketFaceValue", *ticketFaceValue); err != nil {
+			glog.Fatal(err)
+		}
+	}
+	if cfg.deposit, err = parseWei("-deposit", *deposit); err != nil {
+		glog.Fatal(err)
+	}
+	if cfg.reserve, err = parseWei("-reserve", *reserve); err != nil {
+		glog.Fatal(err)
+	}
+	if cfg.streams <= 0 || cfg.segments <= 0 {
+		glog.Fatal("-streams and -segments must be greater than 0")
+	}
+	if cfg.segmentDuration < time.Second {
+		glog.Fatal("-segmentDuration must be at least 1s")
+	}
+	if cfg.transcode && cfg.segmentFile == "" {
+		glog.Fatal("-transcode requires -segment")
+	}
+	if cfg.datadir == "" {
+		if cfg.datadir, err = ioutil.TempDir("", "livepeer-e2e"); err != nil {
+			glog.Fatal(err)
+		}
+		defer os.RemoveAll(cfg.datadir)
+	}
+
+	failures, err := run(cfg)
+	if err != nil {
+		glog.Error("Error running the harness: ", err)
+		os.Exit(2)
+	}
+	if len(failures) > 0 {
+		for _, f := range failures {
+			fmt.Println("FAIL:", f)
+		}
+		os.Exit(1)
+	}
+	fmt.Println("PASS")
+}
+
+// run starts the nodes, pushes the streams and returns the checks that failed
+func run(cfg *config) ([]string, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chain := newStubChain(cfg.ticketFaceValue)
+	orch, err := startOrchestrator(ctx, cfg, chain)
+	if err != nil {
+		return nil, fmt.Errorf("error starting orchestrator: %v", err)
+	}
+	defer orch.stop()
+	if err := startTranscoder(cfg, orch); err != nil {
+		return nil, fmt.Errorf("error starting transcoder: %v", err)
+	}
+	bcast, err := startBroadcaster(ctx, cfg, chain, orch)
+	if err != nil {
+		return nil, fmt.Errorf("error starting broadcaster: %v", err)
+	}
+	defer bcast.stop()
+
+	var source []byte
+	if cfg.segmentFile != "" {
+		if source, err = ioutil.ReadFile(cfg.segmentFile); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		mu       sync.Mutex
+		failures []string
+		wg       sync.WaitGroup
+	)
+	fail := func(format string, args ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		failures = append(failures, fmt.Sprintf(format, args...))
+	}
+	deadline := time.Now().Add(cfg.timeout)
+	httpc := &http.Client{Timeout: cfg.timeout}
+
+	manifestIDs := make([]string, cfg.streams)
+	for i := range manifestIDs {
+		manifestIDs[i] = "e2e" + common.RandName()
+		wg.Add(1)
+		go func(mid string) {
+			defer wg.Done()
+			for seq := 0; seq < cfg.segments; seq++ {
+				data := source
+				if data == nil {
+					data = syntheticSegment(mid, seq)
+				}
+				if err := pushSegment(httpc, bcast.httpAddr, mid, seq, data, cfg.segmentDuration); err != nil {
+					fail("stream %v: error pushing segment %v: %v", mid, seq, err)
+					return
+				}
+			}
+		}(manifestIDs[i])
+	}
+	wg.Wait()
+
+	for _, mid := range manifestIDs {
+		for _, err := range checkPlaylists(httpc, bcast.httpAddr, mid, cfg.segments) {
+			fail("stream %v: %v", mid, err)
+		}
+	}
+
+	for _, err := range checkPayments(cfg, chain, orch, bcast, manifestIDs, deadline) {
+		fail("%v", err)
+	}
+	return failures, nil
+}
+
+// pushSegment pushes a segment of a stream to the broadcaster over HTTP and waits for it to be transcoded
+func pushSegment(httpc *http.Client, addr, mid string, seq int, data []byte, duration time.Duration) error {
+	req, err := http.NewRequest("PUT", fmt.Sprintf("http://%v/live/%v/%d.ts", addr, mid, seq), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Duration", fmt.Sprintf("%d", duration/time.Millisecond))
+	resp, err := httpc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v: %v", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// checkPlaylists checks that the master playlist of a stream has a rendition for every profile of
+// the broadcaster and that the playlist of every rendition has every segment of the stream
+func checkPlaylists(httpc *http.Client, addr, mid string, segments int) []error {
+	masterURL := &url.URL{Scheme: "http", Host: addr, Path: "/stream/" + mid + ".m3u8"}
+	pl, err := fetchPlaylist(httpc, masterURL)
+	if err != nil {
+		return []error{fmt.Errorf("error fetching master playlist: %v", err)}
+	}
+	master, ok := pl.(*m3u8.MasterPlaylist)
+	if !ok {
+		return []error{fmt.Errorf("%v is not a master playlist", masterURL)}
+	}
+
+	var errs []error
+	for _, p := range server.BroadcastJobVideoProfiles {
+		var variant *m3u8.Variant
+		for _, v := range master.Variants {
+			if v != nil && strings.Contains(v.URI, p.Name) {
+				variant = v
+			}
+		}
+		if variant == nil {
+			errs = append(errs, fmt.Errorf("master playlist has no rendition for profile %v", p.Name))
+			continue
+		}
+		mediaURL, err := masterURL.Parse(variant.URI)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		pl, err := fetchPlaylist(httpc, mediaURL)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error fetching playlist of profile %v: %v", p.Name, err))
+			continue
+		}
+		media, ok := pl.(*m3u8.MediaPlaylist)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%v is not a media playlist", mediaURL))
+			continue
+		}
+		if n := int(media.Count()); n != segments {
+			errs = append(errs, fmt.Errorf("playlist of profile %v has %v segments, expected %v", p.Name, n, segments))
+		}
+	}
+	return errs
+}
+
+func fetchPlaylist(httpc *http.Client, u *url.URL) (m3u8.Playlist, error) {
+	resp, err := httpc.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v: %v", u, resp.Status)
+	}
+	pl, _, err := m3u8.DecodeFrom(resp.Body, true)
+	return pl, err
+}
+
+// checkPayments checks that the orchestrator accepted every ticket of the broadcaster, that the
+// credit of every stream covers its fees, and that every winning ticket was redeemed and paid out
+// of the funds of the broadcaster on the stub chain
+func checkPayments(cfg *config, chain *stubChain, orch *orchestratorNode, bcast *broadcasterNode, manifestIDs []string, deadline time.Time) []error {
+	var errs []error
+
+	orch.recipient.mu.Lock()
+	received, won, rejected := orch.recipient.received, orch.recipient.won, orch.recipient.rejected
+	orch.recipient.mu.Unlock()
+	if received == 0 {
+		errs = append(errs, fmt.Errorf("orchestrator received no tickets"))
+	}
+	if rejected > 0 {
+		errs = append(errs, fmt.Errorf("orchestrator rejected %v tickets", rejected))
+	}
+	for _, mid := range manifestIDs {
+		balance := orch.node.Balances.Balance(core.ManifestID(mid))
+		if balance == nil {
+			errs = append(errs, fmt.Errorf("stream %v: orchestrator has no credit balance", mid))
+		} else if balance.Sign() < 0 {
+			errs = append(errs, fmt.Errorf("stream %v: orchestrator has a credit balance of %v wei", mid, balance.FloatString(0)))
+		}
+	}
+
+	// Winning tickets are redeemed in the background
+	for {
+		chain.mu.Lock()
+		redeemed := len(chain.redemptions) + len(chain.rejected)
+		chain.mu.Unlock()
+		if redeemed >= won || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+	for _, err := range chain.rejected {
+		errs = append(errs, fmt.Errorf("ticket broker rejected a redemption: %v", err))
+	}
+	if len(chain.redemptions) != won {
+		errs = append(errs, fmt.Errorf("%v winning tickets were redeemed, expected %v", len(chain.redemptions), won))
+	}
+
+	sender, recipient := bcast.client.Account().Address, orch.client.Account().Address
+	paid := new(big.Int)
+	for _, r := range chain.redemptions {
+		if r.sender != sender || r.recipient != recipient {
+			errs = append(errs, fmt.Errorf("ticket from %v to %v redeemed, expected from %v to %v", r.sender.Hex(), r.recipient.Hex(), sender.Hex(), recipient.Hex()))
+		}
+		paid.Add(paid, r.paid)
+	}
+	if earned := chain.balanceOf(chain.earnings, recipient); earned.Cmp(paid) != 0 {
+		errs = append(errs, fmt.Errorf("orchestrator earned %v wei, expected %v", earned, paid))
+	}
+	spent := new(big.Int).Add(cfg.deposit, cfg.reserve)
+	spent.Sub(spent, chain.balanceOf(chain.deposits, sender))
+	spent.Sub(spent, chain.balanceOf(chain.reserves, sender))
+	if spent.Cmp(paid) != 0 {
+		errs = append(errs, fmt.Errorf("broadcaster spent %v wei, expected %v", spent, paid))
+	}
+
+	glog.Infof("Payments: received=%v won=%v redeemed=%v paid=%v broadcaster=%v orchestrator=%v",
+		received, won, len(chain.redemptions), paid, sender.Hex(), recipient.Hex())
+	return errs
+}
+
+// syntheticSegment returns MPEG-TS packets with a random payload that is unique to the segment
+func syntheticSegment(mid string, seq int) []byte {
+	const packetSize = 188
+	data := make([]byte, 200*packetSize)
+	rand.Read(data)
+	for i := 0; i < len(data); i += packetSize {
+		data[i] = 0x47
+	}
+	copy(data[1:], fmt.Sprintf("%v/%d", mid, seq))
+	return data
+}
+
+func parseWei(flagName, s string) (*big.Int, error) {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok || v.Sign() <= 0 {
+		return nil, fmt.Errorf("%v must be an integer greater than 0, but %v provided", flagName, s)
+	}
+	return v, nil
+}
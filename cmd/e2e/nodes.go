@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/discovery"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/pm"
+	"github.com/livepeer/go-livepeer/server"
+	"github.com/livepeer/lpms/ffmpeg"
+)
+
+// How long to wait for a node to start listening or for the transcoder to register
+const startTimeout = 10 * time.Second
+
+// newNode creates a node with its own data directory and database
+func newNode(dir string, nodeType core.NodeType) (*core.LivepeerNode, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	dbh, err := common.InitDB(filepath.Join(dir, "lp.sqlite3"))
+	if err != nil {
+		return nil, err
+	}
+	n, err := core.NewLivepeerNode(nil, dir, dbh)
+	if err != nil {
+		dbh.Close()
+		return nil, err
+	}
+	n.NodeType = nodeType
+	return n, nil
+}
+
+// orchestratorNode is an orchestrator that transcodes with remote transcoders and receives
+// tickets from the stub chain
+type orchestratorNode struct {
+	node      *core.LivepeerNode
+	client    *chainClient
+	recipient *countingRecipient
+	uri       *url.URL
+	stop      func()
+}
+
+func startOrchestrator(ctx context.Context, cfg *config, chain *stubChain) (*orchestratorNode, error) {
+	n, err := newNode(filepath.Join(cfg.datadir, "orchestrator"), core.OrchestratorNode)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newChainClient(chain)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := freeAddr()
+	if err != nil {
+		return nil, err
+	}
+	uri, err := url.ParseRequestURI("https://" + addr)
+	if err != nil {
+		return nil, err
+	}
+
+	n.Eth = client
+	n.OrchSecret = cfg.orchSecret
+	n.TranscoderManager = core.NewRemoteTranscoderManager()
+	n.Transcoder = n.TranscoderManager
+	n.SetServiceURI(uri)
+	n.SetBasePrice(big.NewRat(cfg.pricePerPixel, 1))
+	n.Balances = core.NewBalances(time.Hour)
+
+	em := core.NewErrorMonitor(3, make(chan struct{}))
+	n.ErrorMonitor = em
+	sm := pm.NewSenderMonitor(client.Account().Address, client, chain, chain, time.Minute, 3600, em)
+	sm.Start()
+	recipient, err := pm.NewRecipient(
+		client.Account().Address,
+		client,
+		pm.NewValidator(&pm.DefaultSigVerifier{}, chain),
+		n.Database,
+		chain,
+		sm,
+		em,
+		pm.TicketParamsConfig{
+			EV: cfg.ticketEV,
+			// The face value of tickets is the tx cost of a redemption, which is the gas price
+			RedeemGas:        1,
+			TxCostMultiplier: 1,
+		},
+	)
+	if err != nil {
+		sm.Stop()
+		return nil, err
+	}
+	counting := &countingRecipient{Recipient: recipient}
+	n.Recipient = counting
+	n.Recipient.Start()
+
+	// Segments and renditions of every node of the harness are kept in the memory of the process
+	// and are served by the orchestrator
+	drivers.NodeStorage = drivers.NewMemoryDriver(n.GetServiceURI())
+
+	s := server.NewLivepeerServer("", n)
+	msCtx, cancel := context.WithCancel(ctx)
+	go s.StartMediaServer(msCtx, cfg.transcodingOptions, "")
+	go server.StartTranscodeServer(core.NewOrchestrator(n), addr, s.HTTPMux, n.WorkDir, true)
+	stop := func() {
+		cancel()
+		n.Recipient.Stop()
+		sm.Stop()
+		n.Database.Close()
+	}
+	if err := waitForListener(addr); err != nil {
+		stop()
+		return nil, err
+	}
+	glog.Infof("Started orchestrator address=%v uri=%v", client.Account().Address.Hex(), uri)
+	return &orchestratorNode{node: n, client: client, recipient: counting, uri: uri, stop: stop}, nil
+}
+
+// countingRecipient counts the tickets that the orchestrator receives from broadcasters
+type countingRecipient struct {
+	pm.Recipient
+
+	mu       sync.Mutex
+	received int
+	won      int
+	// Tickets that were rejected with an error that is not acceptable
+	rejected int
+}
+
+func (r *countingRecipient) ReceiveTicket(ticket *pm.Ticket, sig []byte, seed *big.Int) (string, bool, error) {
+	sessionID, won, err := r.Recipient.ReceiveTicket(ticket, sig, seed)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.received++
+	if won {
+		r.won++
+	}
+	if pmErr, ok := err.(core.AcceptableError); err != nil && !(ok && pmErr.Acceptable()) {
+		r.rejected++
+	}
+	return sessionID, won, err
+}
+
+func startTranscoder(cfg *config, orch *orchestratorNode) error {
+	n, err := newNode(filepath.Join(cfg.datadir, "transcoder"), core.TranscoderNode)
+	if err != nil {
+		return err
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return err
+	}
+	n.OrchSecret = cfg.orchSecret
+	n.TranscoderIdentity = core.NewTranscoderIdentity(key)
+	if cfg.transcode {
+		n.Transcoder = core.NewLocalTranscoder(n.WorkDir)
+	} else {
+		n.Transcoder = newStubTranscoder(cfg.segmentDuration)
+	}
+
+	go server.RunTranscoder(n, orch.uri.Host, cfg.transcoderCapacity)
+
+	deadline := time.Now().Add(startTimeout)
+	for orch.node.TranscoderManager.RegisteredTranscodersCount() == 0 {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("transcoder did not register with the orchestrator within %v", startTimeout)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	glog.Infof("Started transcoder address=%v", n.TranscoderIdentity.Address().Hex())
+	return nil
+}
+
+// stubTranscoder transcodes segments without ffmpeg. Every rendition is a copy of the source
+// segment that is reported with the pixels of the profile for the duration of the segment
+type stubTranscoder struct {
+	duration time.Duration
+	client   *http.Client
+}
+
+func newStubTranscoder(duration time.Duration) *stubTranscoder {
+	return &stubTranscoder{
+		duration: duration,
+		client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+			Timeout:   startTimeout,
+		},
+	}
+}
+
+func (t *stubTranscoder) Transcode(fname string, profiles []ffmpeg.VideoProfile, encoders common.ProfileEncoders) (*core.TranscodeData, error) {
+	data, err := t.fetch(fname)
+	if err != nil {
+		return nil, err
+	}
+	res := &core.TranscodeData{}
+	for _, p := range profiles {
+		w, h, err := ffmpeg.VideoProfileResolution(p)
+		if err != nil {
+			return nil, err
+		}
+		fps := int64(p.Framerate)
+		if fps == 0 {
+			fps = 30
+		}
+		pixels := int64(w) * int64(h) * fps * int64(t.duration/time.Second)
+		res.Segments = append(res.Segments, &core.TranscodedSegmentData{Data: data, Pixels: pixels})
+		res.Pixels += pixels
+	}
+	return res, nil
+}
+
+// fetch reads a segment from the orchestrator or from a local file
+func (t *stubTranscoder) fetch(fname string) ([]byte, error) {
+	u, err := url.Parse(fname)
+	if err != nil || u.Scheme == "" {
+		return ioutil.ReadFile(fname)
+	}
+	resp, err := t.client.Get(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching segment %v: %v", fname, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// broadcasterNode is a broadcaster that pays the orchestrator with tickets funded on the stub chain
+type broadcasterNode struct {
+	node     *core.LivepeerNode
+	client   *chainClient
+	httpAddr string
+	stop     func()
+}
+
+func startBroadcaster(ctx context.Context, cfg *config, chain *stubChain, orch *orchestratorNode) (*broadcasterNode, error) {
+	n, err := newNode(filepath.Join(cfg.datadir, "broadcaster"), core.BroadcasterNode)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newChainClient(chain)
+	if err != nil {
+		return nil, err
+	}
+	httpAddr, err := freeAddr()
+	if err != nil {
+		return nil, err
+	}
+	rtmpAddr, err := freeAddr()
+	if err != nil {
+		return nil, err
+	}
+
+	chain.fund(client.Account().Address, cfg.deposit, cfg.reserve)
+	n.Eth = client
+	maxEV := new(big.Rat).Mul(new(big.Rat).SetInt(cfg.ticketEV), big.NewRat(1000, 1))
+	n.Sender = pm.NewSender(client, chain, chain, maxEV, 1, n.Database)
+	n.Balances = core.NewBalances(time.Hour)
+	n.OrchestratorPool = discovery.NewOrchestratorPool(n, []*url.URL{orch.uri})
+	// The renditions of synthetic segments can't be decoded to count their pixels
+	server.BroadcastPixelsVerification = cfg.segmentFile != ""
+
+	s := server.NewLivepeerServer(rtmpAddr, n)
+	msCtx, cancel := context.WithCancel(ctx)
+	go s.StartMediaServer(msCtx, cfg.transcodingOptions, httpAddr)
+	stop := func() {
+		cancel()
+		n.Database.Close()
+	}
+	if err := waitForListener(httpAddr); err != nil {
+		stop()
+		return nil, err
+	}
+	glog.Infof("Started broadcaster address=%v http=%v", client.Account().Address.Hex(), httpAddr)
+	return &broadcasterNode{node: n, client: client, httpAddr: httpAddr, stop: stop}, nil
+}
+
+// freeAddr returns a local address with a port that is not in use
+func freeAddr() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	return l.Addr().String(), nil
+}
+
+func waitForListener(addr string) error {
+	deadline := time.Now().Add(startTimeout)
+	for {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("nothing listening on %v after %v: %v", addr, startTimeout, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// Flags that are not read from config files, as they control how the config file is loaded
+var configFileFlags = map[string]bool{
+	"config":            true,
+	"dumpconfig":        true,
+	"dumpconfigSecrets": true,
+}
+
+// Flags whose values are printed as maskedConfigValue by -dumpconfig unless -dumpconfigSecrets is set
+var secretFlags = map[string]bool{
+	"ethPassword":              true,
+	"orchSecret":               true,
+	"cliAdminTokens":           true,
+	"cliReadTokens":            true,
+	"s3creds":                  true,
+	"storageEncryptionKey":     true,
+	"dbBackupPassword":         true,
+	"redeemerSecret":           true,
+	"streamEventWebhookSecret": true,
+	"telemetryRedactionKey":    true,
+	"bundlePassword":           true,
+}
+
+const maskedConfigValue = "<redacted>"
+
+// loadConfigFile sets the flags of fs to the values of a YAML or TOML config file whose keys are
+// the names of the flags. The flags that were set on the command line are not overridden by the
+// file. References to environment variables in the file, e.g. ${ETH_PASSWORD} or
+// ${ETH_PASSWORD:-default}, are replaced by their values before it is parsed
+func loadConfigFile(fs *flag.FlagSet, path string) error {
+	values, err := readConfigFile(fs, path)
+	if err != nil {
+		return err
+	}
+	explicit := setFlags(fs)
+	for _, key := range sortedKeys(values) {
+		if explicit[key] {
+			continue
+		}
+		if err := fs.Set(key, values[key]); err != nil {
+			return fmt.Errorf("invalid config file %v: %v: %v", path, key, err)
+		}
+	}
+	return nil
+}
+
+// readConfigFile returns the values of the flags of fs in a config file by the names of the flags
+func readConfigFile(fs *flag.FlagSet, path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := parseConfig(path, os.Expand(string(data), expandEnv))
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %v: %v", path, err)
+	}
+
+	// Validate all the keys before the values, so that errors are reported in a stable order
+	keys := make([]string, 0, len(parsed))
+	for key := range parsed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if fs.Lookup(key) == nil || configFileFlags[key] {
+			return nil, fmt.Errorf("invalid config file %v: unknown flag %q", path, key)
+		}
+	}
+	values := make(map[string]string)
+	for _, key := range keys {
+		if values[key], err = configValue(parsed[key]); err != nil {
+			return nil, fmt.Errorf("invalid config file %v: %v: %v", path, key, err)
+		}
+	}
+	return values, nil
+}
+
+// setFlags returns the names of the flags of fs that have been set
+func setFlags(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func parseConfig(path, data string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		if err := yaml.UnmarshalStrict([]byte(data), &values); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		if _, err := toml.Decode(data, &values); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected .yaml, .yml, .json or .toml", filepath.Ext(path))
+	}
+	return values, nil
+}
+
+// configValue returns the flag value of a value of a config file. Lists are joined with commas,
+// as the flags that take multiple values are comma separated
+func configValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string, bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := configValue(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value of type %T", v)
+	}
+}
+
+// expandEnv returns the value of the environment variable name, or the default of
+// name in the format VAR:-default if the variable is not set or empty
+func expandEnv(name string) string {
+	def := ""
+	if i := strings.Index(name, ":-"); i >= 0 {
+		name, def = name[:i], name[i+2:]
+	}
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// Flags that are not exported in bundles, as their values are specific to the machine of the node
+var bundleExcludedFlags = []string{"datadir", "ethKeystorePath", "importBundle", "bundlePassword", "restoreDBBackup"}
+
+// dumpConfig writes the effective values of the flags of fs, except the excluded ones, to w as a
+// YAML config file that can be loaded with -config. The values of the secret flags that are set
+// are masked unless secrets is true
+func dumpConfig(fs *flag.FlagSet, w io.Writer, secrets bool, exclude ...string) error {
+	excluded := make(map[string]bool)
+	for _, name := range exclude {
+		excluded[name] = true
+	}
+	var config yaml.MapSlice
+	fs.VisitAll(func(f *flag.Flag) {
+		if configFileFlags[f.Name] || excluded[f.Name] {
+			return
+		}
+		var value interface{} = f.Value.String()
+		if secretFlags[f.Name] && !secrets && value != "" {
+			value = maskedConfigValue
+		} else if getter, ok := f.Value.(flag.Getter); ok {
+			switch v := getter.Get().(type) {
+			case bool, int, int64, uint, uint64, float64:
+				value = v
+			case time.Duration:
+				value = v.String()
+			}
+		}
+		config = append(config, yaml.MapItem{Key: f.Name, Value: value})
+	})
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
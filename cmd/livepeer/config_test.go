@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newConfigTestFlags() (*flag.FlagSet, *string, *int, *bool, *time.Duration) {
+	fs := flag.NewFlagSet("livepeer", flag.ContinueOnError)
+	fs.String("config", "", "")
+	network := fs.String("network", "offchain", "")
+	maxSessions := fs.Int("maxSessions", 10, "")
+	orchestrator := fs.Bool("orchestrator", false, "")
+	orchListRefresh := fs.Duration("orchListRefresh", time.Minute, "")
+	return fs, network, maxSessions, orchestrator, orchListRefresh
+}
+
+func writeConfigFile(t *testing.T, dir, name, data string) string {
+	path := filepath.Join(dir, name)
+	require.Nil(t, ioutil.WriteFile(path, []byte(data), 0644))
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	dir, err := ioutil.TempDir("", "config")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	os.Setenv("LP_TEST_NETWORK", "rinkeby")
+	defer os.Unsetenv("LP_TEST_NETWORK")
+
+	yamlPath := writeConfigFile(t, dir, "livepeer.yaml", "network: ${LP_TEST_NETWORK}\nmaxSessions: 20\norchestrator: true\norchListRefresh: 30s\n")
+	fs, network, maxSessions, orchestrator, orchListRefresh := newConfigTestFlags()
+	require.Nil(fs.Parse([]string{"-config", yamlPath}))
+	require.Nil(loadConfigFile(fs, yamlPath))
+	assert.Equal("rinkeby", *network)
+	assert.Equal(20, *maxSessions)
+	assert.True(*orchestrator)
+	assert.Equal(30*time.Second, *orchListRefresh)
+
+	// Flags set on the command line override the file
+	tomlPath := writeConfigFile(t, dir, "livepeer.toml", "network = \"${LP_TEST_UNSET:-mainnet}\"\nmaxSessions = 20\n")
+	fs, network, maxSessions, _, _ = newConfigTestFlags()
+	require.Nil(fs.Parse([]string{"-maxSessions", "5"}))
+	require.Nil(loadConfigFile(fs, tomlPath))
+	assert.Equal("mainnet", *network)
+	assert.Equal(5, *maxSessions)
+
+	errPaths := map[string]string{
+		writeConfigFile(t, dir, "unknown.yaml", "maxSession: 20\n"):     `unknown flag "maxSession"`,
+		writeConfigFile(t, dir, "type.yaml", "maxSessions: many\n"):     `maxSessions: parse error`,
+		writeConfigFile(t, dir, "nested.yaml", "network:\n  name: x\n"): `network: unsupported value`,
+		writeConfigFile(t, dir, "config.yaml", "config: other.yaml\n"):  `unknown flag "config"`,
+		writeConfigFile(t, dir, "livepeer.ini", "maxSessions=20\n"):     `unknown format ".ini"`,
+		writeConfigFile(t, dir, "invalid.toml", "maxSessions = \n"):     `invalid config file`,
+		filepath.Join(dir, "missing.yaml"):                              `no such file`,
+	}
+	for path, msg := range errPaths {
+		fs, _, _, _, _ = newConfigTestFlags()
+		err := loadConfigFile(fs, path)
+		require.NotNil(err, path)
+		assert.Contains(err.Error(), msg)
+	}
+}
+
+func TestDumpConfig(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	dir, err := ioutil.TempDir("", "config")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	fs, _, _, _, _ := newConfigTestFlags()
+	require.Nil(fs.Parse([]string{"-maxSessions", "5", "-orchestrator"}))
+	var buf bytes.Buffer
+	require.Nil(dumpConfig(fs, &buf, false))
+	assert.Equal("maxSessions: 5\nnetwork: offchain\norchListRefresh: 1m0s\norchestrator: true\n", buf.String())
+
+	// The dumped configuration can be loaded
+	path := writeConfigFile(t, dir, "livepeer.yaml", buf.String())
+	fs, network, maxSessions, orchestrator, orchListRefresh := newConfigTestFlags()
+	require.Nil(loadConfigFile(fs, path))
+	assert.Equal("offchain", *network)
+	assert.Equal(5, *maxSessions)
+	assert.True(*orchestrator)
+	assert.Equal(time.Minute, *orchListRefresh)
+}
+
+func TestDumpConfig_Secrets(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs := flag.NewFlagSet("livepeer", flag.ContinueOnError)
+	fs.String("ethPassword", "", "")
+	fs.String("orchSecret", "", "")
+	fs.String("network", "offchain", "")
+	require.Nil(fs.Parse([]string{"-ethPassword", "hunter2"}))
+
+	// Secrets that are set are masked unless requested
+	var buf bytes.Buffer
+	require.Nil(dumpConfig(fs, &buf, false))
+	assert.Equal("ethPassword: <redacted>\nnetwork: offchain\norchSecret: \"\"\n", buf.String())
+	assert.NotContains(buf.String(), "hunter2")
+
+	buf.Reset()
+	require.Nil(dumpConfig(fs, &buf, true))
+	assert.Equal("ethPassword: hunter2\nnetwork: offchain\norchSecret: \"\"\n", buf.String())
+}
@@ -4,12 +4,15 @@ Livepeer is a peer-to-peer global video live streaming network.  The Golp projec
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
 	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"math/big"
+	gonet "net"
 	"net/http"
 	"net/url"
 	"os"
@@ -19,6 +22,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/ethereum/go-ethereum/rpc"
@@ -26,18 +30,22 @@ import (
 	"github.com/livepeer/go-livepeer/server"
 
 	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/clog"
 	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/core"
 	"github.com/livepeer/go-livepeer/discovery"
 	"github.com/livepeer/go-livepeer/drivers"
 	"github.com/livepeer/go-livepeer/eth"
 	"github.com/livepeer/go-livepeer/eth/blockwatch"
+	"github.com/livepeer/go-livepeer/eth/contracts"
 	"github.com/livepeer/go-livepeer/eth/eventservices"
 	"github.com/livepeer/go-livepeer/eth/watchers"
 
 	lpmon "github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/go-livepeer/net"
 )
 
 var (
@@ -47,6 +55,9 @@ var (
 	// The timeout for ETH RPC calls
 	ethRPCTimeout = 20 * time.Second
 
+	// The interval at which the health of the ETH RPC endpoints is checked, if there are several
+	ethRPCHealthCheckInterval = 10 * time.Second
+
 	// The interval at which the block watcher polls for new blocks
 	blockWatcherPollingInterval = 1 * time.Second
 	// The maximum block sfor the block watcher to retain
@@ -61,6 +72,10 @@ var (
 	txCostMultiplier = 100
 	// The interval at which to poll for gas price updates
 	gpmPollingInterval = 1 * time.Minute
+	// The interval at which the transaction queue checks for mined and stuck transactions
+	txQueuePollingInterval = 15 * time.Second
+	// The interval at which the exchanges that are older than -protocolArchiveWindow are deleted
+	protocolArchivePruneInterval = 1 * time.Hour
 	// The interval at which to clean up cached max float values for PM senders and balances per stream
 	cleanupInterval = 1 * time.Minute
 	// The time to live for cached max float values for PM senders (else they will be cleaned up) in seconds
@@ -78,6 +93,14 @@ func main() {
 	// incorrectly add their own flags (specifically, due to the 'testing'
 	// package being linked)
 	flag.Set("logtostderr", "true")
+	// Pulled streams are segmented in a child process so that they can be stopped
+	if len(os.Args) > 1 && os.Args[1] == server.PullSegmenterCommand {
+		if err := server.RunPullSegmenter(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 	usr, err := user.Current()
 	if err != nil {
 		glog.Fatalf("Cannot find current user: %v", err)
@@ -89,8 +112,20 @@ func main() {
 	// Network & Addresses:
 	network := flag.String("network", "offchain", "Network to connect to")
 	rtmpAddr := flag.String("rtmpAddr", "127.0.0.1:"+RtmpPort, "Address to bind for RTMP commands")
+	rtmpsAddr := flag.String("rtmpsAddr", "", "Broadcaster only. Address to bind for RTMP ingest over TLS. Requires -rtmpsCert and -rtmpsKey")
+	rtmpsCert := flag.String("rtmpsCert", "", "TLS certificate file (PEM) for RTMPS ingest")
+	rtmpsKey := flag.String("rtmpsKey", "", "TLS private key file (PEM) for RTMPS ingest")
+	udpIngest := flag.String("udpIngest", "", "Broadcaster only. Comma separated list of MPEG-TS feeds to ingest over UDP, e.g. udp://0.0.0.0:5000/movie1?video=0x100&audio=0x101. Use rtp:// or rist:// for feeds in RTP packets")
 	cliAddr := flag.String("cliAddr", "127.0.0.1:"+CliPort, "Address to bind for  CLI commands")
+	cliAdminTokens := flag.String("cliAdminTokens", "", "Comma separated list of tokens that grant access to every CLI endpoint. Tokens are sent as bearer tokens or as basic auth passwords. The CLI endpoints are not authenticated if no tokens are set")
+	cliReadTokens := flag.String("cliReadTokens", "", "Comma separated list of tokens that grant read-only access to the CLI endpoints that don't change the node")
+	cliTLSCert := flag.String("cliTLSCert", "", "TLS certificate file (PEM) that the CLI endpoints are served over HTTPS with. Requires -cliTLSKey")
+	cliTLSKey := flag.String("cliTLSKey", "", "TLS private key file (PEM) of -cliTLSCert")
+	cliLegacyResponses := flag.Bool("cliLegacyResponses", false, "Respond to CLI requests with the plain text bodies of previous versions instead of JSON")
 	httpAddr := flag.String("httpAddr", "", "Address to bind for HTTP commands")
+	segmentHTTPLimits := flag.String("segmentHTTPLimits", "", "Comma separated list of key=value limits of the requests that upload segments, overriding the defaults. Keys are readTimeout, writeTimeout, idleTimeout, maxHeaderBytes and maxBodyBytes, e.g. readTimeout=10s,maxBodyBytes=67108864")
+	managementHTTPLimits := flag.String("managementHTTPLimits", "", "Limits of the requests of the CLI endpoints and the other management endpoints, in the format of -segmentHTTPLimits")
+	playlistHTTPLimits := flag.String("playlistHTTPLimits", "", "Limits of the requests that play streams, in the format of -segmentHTTPLimits")
 	serviceAddr := flag.String("serviceAddr", "", "Orchestrator only. Overrides the on-chain serviceURI that broadcasters can use to contact this node; may be an IP or hostname.")
 	orchAddr := flag.String("orchAddr", "", "Orchestrator to connect to as a standalone transcoder")
 
@@ -99,8 +134,41 @@ func main() {
 	transcoder := flag.Bool("transcoder", false, "Set to true to be a transcoder")
 	broadcaster := flag.Bool("broadcaster", false, "Set to true to be a broadcaster")
 	orchSecret := flag.String("orchSecret", "", "Shared secret with the orchestrator as a standalone transcoder")
-	transcodingOptions := flag.String("transcodingOptions", "P240p30fps16x9,P360p30fps16x9", "Transcoding options for broadcast job")
+	transcoderSoftDeadline := flag.Duration("transcoderSoftDeadline", 0, "How long a segment can take on a standalone transcoder before the orchestrator also assigns it to another transcoder and uses the results that arrive first. Disabled if not set")
+	transcoderGracePeriod := flag.Duration("transcoderGracePeriod", 0, "How long the orchestrator holds a segment waiting for a standalone transcoder to become available, e.g. while transcoders reconnect, before failing it. Segments fail right away if not set")
+	orchCertPin := flag.String("orchCertPin", "", "SHA-256 fingerprint (hex) of the public key of the orchestrator's certificate that a standalone transcoder requires. The orchestrator logs its fingerprint on startup")
+	orchCertPins := flag.String("orchCertPins", "", "Broadcaster only. Comma-separated list of the certificate fingerprints that orchestrators are required to present, as host:port=fingerprint, in the format of -orchCertPin")
+	orchCertTOFU := flag.Bool("orchCertTofu", false, "Broadcaster only. Pin the certificate of each orchestrator that is not in -orchCertPins on the first connection to it, and reject the connections to it with other certificates until the pin is reset with the /resetOrchCertPin CLI endpoint")
+	transcoderEncryption := flag.Bool("transcoderEncryption", false, "Encrypt the segments exchanged between an orchestrator and its standalone transcoders with keys derived from -orchSecret. Must be set on both")
+	minTranscoderVersion := flag.String("minTranscoderVersion", "", "Minimum version (e.g. 0.5.1) of standalone transcoders that are allowed to register to the orchestrator")
+	transcodingOptions := flag.String("transcodingOptions", "P240p30fps16x9,P360p30fps16x9", "Transcoding options for broadcast job, or path to a JSON file with custom transcoding profiles")
+	segmentDurationTolerance := flag.Duration("segmentDurationTolerance", 0, "The maximum difference between the duration of a transcoded segment and its source segment before the orchestrator that returned it is dropped. Disabled if not set")
+	conditionSegments := flag.Bool("conditionSegments", false, "Re-cut RTMP ingest segments on closed GOP boundaries before sending them to orchestrators. Delays each segment until the next one is ingested")
+	adaptiveLadder := flag.String("adaptiveLadder", "", "Bounds 'min,max[,minPixels]' of the factor that the bitrates of the transcoding profiles are scaled by to match the complexity of each segment (e.g. 0.5,1.5). If minPixels is set, the resolutions of the profiles are also scaled down for low complexity segments, but not below that fraction of their pixels (e.g. 0.5,1.5,0.5). Disabled if not set")
+	healthGossipPeers := flag.String("healthGossipPeers", "", "Broadcaster only. Comma-separated list of the HTTP URIs of cooperating broadcasters (e.g. http://b2.example.com:8935) to exchange orchestrator health observations with. Disabled if not set")
+	healthGossipTrusted := flag.String("healthGossipTrusted", "", "Comma-separated list of the addresses of the broadcasters whose orchestrator health observations are accepted. A broadcaster's address is its ETH account, or the gossip address that it logs on startup when off-chain")
+	healthGossipInterval := flag.Duration("healthGossipInterval", 5*time.Second, "How often orchestrator health observations are sent to -healthGossipPeers")
+	healthMaxFailures := flag.Int("healthMaxFailures", 3, "Number of segments failed by an orchestrator within -healthWindow, as observed by this broadcaster and its -healthGossipPeers, after which it is no longer used")
+	healthMaxLatency := flag.Duration("healthMaxLatency", 0, "Average latency of the segments of an orchestrator within -healthWindow above which it is no longer used. Disabled if not set")
+	healthWindow := flag.Duration("healthWindow", 5*time.Minute, "Period of time over which orchestrator health observations are kept")
+	segmentVerifiers := flag.String("segmentVerifiers", "", "Broadcaster only. Comma-separated list of the verifiers that transcoded segments must pass: pixelhash, optionally with the maximum distance out of 64 bits between the frame hashes of the source and a rendition (e.g. pixelhash:10), transcode to compare renditions with renditions transcoded locally, optionally with the maximum distance between their frame hashes (e.g. transcode:8), and http:<url> of an external verifier. Segments are not verified if not set")
+	verificationSampleRate := flag.Float64("verificationSampleRate", 0.05, "Share of the segments of trusted orchestrators that are checked with -segmentVerifiers. Segments of orchestrators whose segments failed the verification are checked more often")
+	verificationMaxFailures := flag.Int("verificationMaxFailures", 3, "Number of segments of an orchestrator that fail -segmentVerifiers after which it is suspended")
+	verificationSuspension := flag.Duration("verificationSuspension", 10*time.Minute, "How long an orchestrator whose segments fail -segmentVerifiers is suspended for")
+	streamQuotas := flag.String("streamQuotas", "", "Broadcaster only. Path to a JSON file with the quotas of the API keys that streams must be created with, passed as the apiKey query parameter of the stream URL or API request. The quotas are managed with the /setQuota and /removeQuota endpoints of the CLI server and saved to the file. Quotas are not enforced if not set")
+	orchReputation := flag.Bool("orchReputation", false, "Broadcaster only. Set to true to keep statistics of the segments sent to each orchestrator in the node DB and select orchestrators with a probability weighted by the reputation score computed from them")
+	orchReputationTargetLatency := flag.Duration("orchReputationTargetLatency", 2*time.Second, "90th percentile latency of the segments of an orchestrator above which its reputation score is lowered with -orchReputation. Not scored if 0")
+	orchAllowlist := flag.String("orchAllowlist", "", "Broadcaster only. Comma-separated list of the ETH addresses or service URI patterns (e.g. https://*.example.com:*) of the only orchestrators that segments are sent to. Added to the allowlist kept in the node DB, which is managed with the /addOrchestratorListEntry and /removeOrchestratorListEntry endpoints of the CLI server")
+	orchDenylist := flag.String("orchDenylist", "", "Broadcaster only. Comma-separated list of the ETH addresses or service URI patterns of the orchestrators that segments are never sent to. Added to the denylist kept in the node DB")
+	segmentTraceSize := flag.Int("segmentTraceSize", 0, "Broadcaster only. Number of the most recent segments whose timings, orchestrators, payments and errors are kept and served by /segmentTrace?manifest=<manifestID>. Not kept if 0")
 	maxSessions := flag.Int("maxSessions", 10, "Maximum number of concurrent transcoding sessions for Orchestrator, maximum number or RTMP streams for Broadcaster, or maximum capacity for transcoder")
+	autoSessions := flag.Bool("autoSessions", false, "Set to true to adjust the number of concurrent transcoding sessions of an Orchestrator to its measured transcoding throughput, between -minSessions and -maxSessions")
+	minSessions := flag.Int("minSessions", 1, "Minimum number of concurrent transcoding sessions for Orchestrator with -autoSessions")
+	sessionsBenchmark := flag.String("sessionsBenchmark", "", "Path to a sample MPEG-TS segment that is transcoded at startup to measure the transcoding throughput for -autoSessions and -pixelCapacity. If not set, throughput is only measured while transcoding")
+	pixelCapacity := flag.Bool("pixelCapacity", false, "Set to true for an Orchestrator to only admit streams whose transcoding ladders fit the remaining pixels per second that it can transcode")
+	pixelsPerSec := flag.Float64("pixelsPerSec", 0, "Pixels per second that an Orchestrator can transcode with -pixelCapacity. If not set, it is measured from -sessionsBenchmark and while transcoding")
+	loadShedding := flag.Bool("loadShedding", false, "Set to true for an overloaded Orchestrator to drain the streams that pay the lowest price and fees, and ask their Broadcasters to move them to other Orchestrators")
+	loadSheddingGrace := flag.Duration("loadSheddingGrace", core.DefaultLoadSheddingGrace, "Time during which the segments of a stream drained with -loadShedding are still transcoded while its Broadcaster moves it to another Orchestrator")
 	currentManifest := flag.Bool("currentManifest", false, "Expose the currently active ManifestID as \"/stream/current.m3u8\"")
 	nvidia := flag.String("nvidia", "", "Comma-separated list of Nvidia GPU device IDs to use for transcoding")
 
@@ -108,43 +176,157 @@ func main() {
 	ethAcctAddr := flag.String("ethAcctAddr", "", "Existing Eth account address")
 	ethPassword := flag.String("ethPassword", "", "Password for existing Eth account address")
 	ethKeystorePath := flag.String("ethKeystorePath", "", "Path for the Eth Key")
-	ethUrl := flag.String("ethUrl", "", "geth/parity rpc or websocket url")
+	ethUrl := flag.String("ethUrl", "", "geth/parity rpc or websocket url. A comma-separated list of http(s) urls, in order of preference, fails over between them")
+	ethReadUrl := flag.String("ethReadUrl", "", "Comma-separated list of geth/parity http(s) rpc urls that read calls are sent to before -ethUrl. Transactions are only submitted to -ethUrl")
 	ethController := flag.String("ethController", "", "Protocol smart contract address")
 	gasLimit := flag.Int("gasLimit", 0, "Gas limit for ETH transactions")
 	gasPrice := flag.Int("gasPrice", 0, "Gas price for ETH transactions")
+	gasPriceSource := flag.String("gasPriceSource", "", "Source of the gas price of ETH transactions. One of 'node' (the suggestions of the ETH node, the default), 'fixed' (the gas price of -gasPrice, the default if it is set) or the http(s) URL of a gas price oracle")
+	maxFeePerGas := flag.String("maxFeePerGas", "", "The maximum fee per gas (in wei) of ETH transactions on chains with EIP-1559")
+	maxPriorityFeePerGas := flag.String("maxPriorityFeePerGas", "", "The priority fee per gas (in wei) of ETH transactions on chains with EIP-1559, instead of the one suggested by -gasPriceSource")
+	blockConfirmations := flag.Int("blockConfirmations", 0, "The number of blocks mined on top of a block before the node acts on its events. Events of blocks that are removed by a re-org after they were acted on are reverted")
+	txStuckBlocks := flag.Int("txStuckBlocks", 20, "The number of blocks after which pending ETH transactions are resubmitted with bumped fees. Transactions are never resubmitted if set to 0")
 	initializeRound := flag.Bool("initializeRound", false, "Set to true if running as a transcoder and the node should automatically initialize new rounds")
+	initializeRoundMaxGasPrice := flag.String("initializeRoundMaxGasPrice", "", "The maximum gas price (in wei) at which the node initializes rounds with -initializeRound. If not set, rounds are initialized at any gas price")
+	rewardAlertWindow := flag.Int64("rewardAlertWindow", 0, "Orchestrator only. The number of blocks before the end of a round from which an alert is raised, as a log, a metric and a post to -rewardAlertWebhookUrl, if reward was not called in the round yet. No alert is raised if set to 0")
+	rewardAlertWebhookURL := flag.String("rewardAlertWebhookUrl", "", "URL that is posted the alerts raised with -rewardAlertWindow")
+	initializeRoundMaxDelay := flag.Duration("initializeRoundMaxDelay", 30*time.Second, "The maximum random delay before the node initializes a round with -initializeRound once it is selected to, so that orchestrators don't race to initialize the same round")
 	ticketEV := flag.String("ticketEV", "1000000000", "The expected value for PM tickets")
+	// Orchestrator ticket batch limits
+	maxTicketsPerPayment := flag.Int("maxTicketsPerPayment", 0, "The maximum number of PM tickets accepted with a single payment. If not set, there is no limit")
+	maxBatchFaceValue := flag.String("maxBatchFaceValue", "", "The maximum total face value (in wei) of PM tickets accepted with a single payment. If not set, there is no limit")
+	// Orchestrator ticket redemption scheduling
+	redemptionPolicy := flag.String("redemptionPolicy", "immediate", "When to redeem winning tickets. One of 'immediate', 'roundBoundary' (redeem the tickets of a round together after the next round is initialized) or 'gasWindow' (redeem tickets when the gas price is at or below -redemptionMaxGasPrice). Deferred tickets are always redeemed before they expire")
+	redemptionMaxGasPrice := flag.String("redemptionMaxGasPrice", "", "The maximum gas price (in wei) at which winning tickets are redeemed under the 'gasWindow' redemption policy")
+	ticketValidityPeriod := flag.Int64("ticketValidityPeriod", pm.DefaultTicketValidityPeriod, "The number of rounds, starting with its creation round, in which a ticket can be redeemed. Must match the TicketBroker contract")
+	ticketRedemptionBuffer := flag.Int64("ticketRedemptionBuffer", 0, "Orchestrator only. The number of rounds before the end of its -ticketValidityPeriod by which a deferred winning ticket is redeemed. Advertised to broadcasters, which can require a minimum buffer with -ticketExpirationBuffer")
+	ticketExpirationBuffer := flag.Int64("ticketExpirationBuffer", 0, "Broadcaster only. The minimum -ticketRedemptionBuffer of orchestrators. Orchestrators that advertise a lower buffer or another -ticketValidityPeriod are not used")
+	// Orchestrator frontends sharing one ETH account
+	redeemer := flag.Bool("redeemer", false, "Orchestrator only. Serve the ticket state shared by the frontends of this node's ETH account and redeem the winning tickets that they forward. Requires -redeemerSecret")
+	redeemerAddr := flag.String("redeemerAddr", "", "Orchestrator only. Run as a frontend of the redeemer at this address (host:port), sharing its ETH account: tickets are checked against the redeemer's state and winning tickets are forwarded to it. Requires -redeemerSecret")
+	redeemerSecret := flag.String("redeemerSecret", "", "Shared secret between the redeemer and the orchestrator frontends")
+	frontends := flag.String("frontends", "", "Orchestrator only. Comma-separated list of the URIs of the frontends of this orchestrator in other regions (e.g. https://eu.orch.example.com:8935) that broadcasters submit segments to when they are nearer than -serviceAddr")
+	region := flag.String("region", "", "Region tag of the node, e.g. us-east. Orchestrators advertise it to broadcasters, and broadcasters prefer orchestrators with the same tag with -preferSameRegion")
+	latencySelection := flag.Bool("latencySelection", false, "Broadcaster only. Set to true to ping the orchestrators that respond during discovery and select the ones with the lowest round trip time and price instead of the first ones to respond")
+	selectionStrategy := flag.String("selectionStrategy", "", "Broadcaster only. How the orchestrator of each segment is selected among the sessions of a stream: random, cheapest, latency (lowest average segment latency), stake (weighted by delegated stake), roundrobin or webhook (-selectionWebhookUrl). If not set, the orchestrator that most recently transcoded a segment is selected")
+	selectionWebhookURL := flag.String("selectionWebhookUrl", "", "URL of the webhook that ranks the orchestrators with -selectionStrategy=webhook")
+	selectionScorerURL := flag.String("selectionScorerUrl", "", "Broadcaster only. URL of the webhook that scores the candidate orchestrators of each stream. Orchestrators that it doesn't score are not used, and those with the highest scores are used first")
+	orchDiversity := flag.Int("orchDiversity", 0, "Broadcaster only. Minimum number of distinct orchestrators that the segments of each stream, or of each namespace with -orchDiversityScope=namespace, are sent to within -orchDiversityWindow. Disabled if 0")
+	orchDiversityScope := flag.String("orchDiversityScope", "stream", "Segments spread over -orchDiversity orchestrators: stream (the segments of each stream) or namespace (the segments of the concurrent streams of each namespace)")
+	orchDiversityWindow := flag.Duration("orchDiversityWindow", 10*time.Minute, "Window within which the segments are spread over -orchDiversity orchestrators")
+	abTestSelection := flag.String("abTestSelection", "", "Broadcaster only. Comma-separated pair of the -selectionStrategy values of the arms A and B of an A/B test, e.g. latency,cheapest. Streams are split between the arms by their manifest ID and the latency, cost per minute and failures of their segments are served by /abTestReport. Either value may be empty to use -selectionStrategy")
+	abTestOrchestratorsA := flag.String("abTestOrchestratorsA", "", "Comma-separated list of the service URI patterns (e.g. https://*.example.com:*) of the only orchestrators used by the streams of the arm A of the A/B test. Starts the A/B test if set")
+	abTestOrchestratorsB := flag.String("abTestOrchestratorsB", "", "Comma-separated list of the service URI patterns of the only orchestrators used by the streams of the arm B of the A/B test. Starts the A/B test if set")
+	abTestSplit := flag.Float64("abTestSplit", 0.5, "Share of the streams assigned to the arm A of the A/B test")
+	abTestMode := flag.String("abTestMode", "streams", "How segments are split between the arms of the A/B test: streams sends all the segments of a stream to its arm, segments alternates the consecutive segments of every stream between the arms, duplicates also sends a sample of the segments of a stream to the other arm")
+	abTestDuplicateRate := flag.Float64("abTestDuplicateRate", 0.1, "Share of the segments duplicated to the other arm of the A/B test with -abTestMode duplicates")
+	preferSameRegion := flag.Bool("preferSameRegion", false, "Broadcaster only. Set to true to select orchestrators with the same -region tag before the others during discovery")
+	orchInfoTTL := flag.Duration("orchInfoTTL", 30*time.Second, "Orchestrator only. How long broadcasters may reuse the info of this orchestrator, including its price and ticket params, instead of requesting it again when they start streams. Not reused if 0")
 	// Broadcaster max acceptable ticket EV
 	maxTicketEV := flag.String("maxTicketEV", "10000000000", "The maximum acceptable expected value for PM tickets")
 	// Broadcaster deposit multiplier to determine max acceptable ticket faceValue
 	depositMultiplier := flag.Int("depositMultiplier", 1000, "The deposit multiplier used to determine max acceptable faceValue for PM tickets")
+	// Broadcaster ticket spend tracking
+	maxStreamTicketEV := flag.String("maxStreamTicketEV", "", "The maximum cumulative EV (in wei) of the PM tickets issued for a single stream. If not set, there is no limit")
+	ticketSpendDeviation := flag.Float64("ticketSpendDeviation", pm.DefaultSpendDeviationThreshold, "The factor by which the spend realized by an orchestrator's winning tickets can exceed or fall short of the EV of the tickets sent to it before an alert is logged. Set to 0 to disable alerts")
+
+	// Orchestrator credit balances
+	balanceTTL := flag.Duration("balanceTTL", cleanupInterval, "The time after its last update that a stream's credit balance is cleaned up")
+	balanceCleanupPolicy := flag.String("balanceCleanupPolicy", "discard", "What to do with the remaining balance of a stream on cleanup. One of 'discard' or 'carryDebt' (charge a negative balance against the sender's next stream)")
+	creditExpiry := flag.Duration("creditExpiry", 0, "The time after its last update that the unused credit of a stream expires. Must be less than -balanceTTL. If not set, credit does not expire before cleanup")
+	creditExpiryPolicy := flag.String("creditExpiryPolicy", "retain", "What to do with the unused credit of a stream after -creditExpiry. One of 'retain' or 'reclaim' (reclaim the credit and notify the sender)")
+	creditReclaimWebhookURL := flag.String("creditReclaimWebhookUrl", "", "URL that is notified whenever the unused credit of a stream is reclaimed")
 
 	// Orchestrator base pricing info
 	pricePerUnit := flag.Int("pricePerUnit", 0, "The price per 'pixelsPerUnit' amount pixels")
 	// Broadcaster max acceptable price
+	paymentPipelineDepth := flag.Int("paymentPipelineDepth", 0, "The number of segments that a broadcaster pays for ahead of submitting them so that segments can be submitted without tickets. If not set, payments are sent with each segment")
 	maxPricePerUnit := flag.Int("maxPricePerUnit", 0, "The maximum transcoding price (in wei) per 'pixelsPerUnit' a broadcaster is willing to accept. If not set explicitly, broadcaster is willing to accept ANY price")
 	// Unit of pixels for both O's basePriceInfo and B's MaxBroadcastPrice
 	pixelsPerUnit := flag.Int("pixelsPerUnit", 1, "Amount of pixels per unit. Set to '> 1' to have smaller price granularity than 1 wei / pixel")
 
+	// Protocol validation
+	strictProtocol := flag.Bool("strictProtocol", false, "Orchestrator only. Reject the requests that miss protocol fields which are optional for compatibility with older nodes: payments without the expected price, the ticket params, the ticket creation round and block hash or the ticket signatures, segments without their hash, and transcoders that register without their version and capabilities")
+	firstSegmentFastPath := flag.Bool("firstSegmentFastPath", false, "Broadcasters send the first segment of a stream to orchestrators before requesting their info, and pay for it with the next segment. Orchestrators transcode these segments before they are paid for and return their info with them")
+
 	// Metrics & logging:
 	monitor := flag.Bool("monitor", false, "Set to true to send performance metrics")
 	version := flag.Bool("version", false, "Print out the version")
+	configFile := flag.String("config", "", "YAML (.yaml, .yml) or TOML (.toml) file of the values of the flags, keyed by the names of the flags. Flags set on the command line override the file. ${VAR} and ${VAR:-default} are replaced by environment variables. Reloadable settings, e.g. prices, webhooks, log levels and orchestrator lists, are applied again on SIGHUP")
+	dumpConfigFlag := flag.Bool("dumpconfig", false, "Print the effective configuration as a YAML config file and exit. Secrets, e.g. -ethPassword, are masked")
+	dumpConfigSecrets := flag.Bool("dumpconfigSecrets", false, "Print the values of the secrets with -dumpconfig instead of masking them")
+	importBundle := flag.String("importBundle", "", "Import the database, keystore and configuration of a node from a bundle downloaded from the /exportBundle CLI endpoint into -datadir, and exit. The data directory must not have a database yet")
+	bundlePassword := flag.String("bundlePassword", "", "Password that the bundle of -importBundle was encrypted with")
 	verbosity := flag.String("v", "", "Log verbosity.  {4|5|6}")
+	logFormat := flag.String("logFormat", clog.FormatText, "Format of the logs of the server, pm and core modules. {text|json}")
+	logLevels := flag.String("logLevels", "", "Comma-separated list of module=level pairs that set the log verbosity of modules, e.g. server=6,pm=4. Modules are server, pm and core. Modules not listed log at -v. Adjustable at runtime with the /logLevels CLI endpoint")
+	telemetryRedaction := flag.String("telemetryRedaction", "", "Redact ETH addresses and manifest IDs in logs, metrics and webhooks. {hash|truncate}")
+	telemetryRedactionKey := flag.String("telemetryRedactionKey", "", "Key that identifiers are hashed with when -telemetryRedaction=hash, to keep hashes stable across restarts. Random if not set")
+	traceSampleRate := flag.Float64("traceSampleRate", 0, "Share of the segments that are traced from ingest to the transcoded results, e.g. 0.01. Orchestrators also trace the segments whose trace was sampled by the broadcaster. The trace context is sent to orchestrators in the W3C traceparent header. Not traced if 0")
+	traceSpans := flag.Int("traceSpans", 1000, "Number of the most recent spans of traced segments that are kept and served by /traceSpans?traceID=<traceID>")
+	metricsBackends := flag.String("metricsBackends", lpmon.BackendPrometheus, "Comma-separated list of the backends that the metrics of -monitor are sent to. One or more of prometheus (pulled from /metrics), statsd (pushed to -statsdAddr) and otlp (pushed to -otlpEndpoint)")
+	statsdAddr := flag.String("statsdAddr", "", "Address of the StatsD server that metrics are pushed to with -metricsBackends statsd, e.g. 127.0.0.1:8125")
+	otlpEndpoint := flag.String("otlpEndpoint", "", "URL of the OTLP/HTTP metrics endpoint of the OpenTelemetry collector that metrics are pushed to with -metricsBackends otlp, e.g. http://127.0.0.1:4318/v1/metrics")
+	metricsPushInterval := flag.Duration("metricsPushInterval", lpmon.DefaultMetricsPushInterval, "How often metrics are pushed to the statsd and otlp -metricsBackends")
+	metricsEnabled := flag.String("metricsEnabled", "", "Comma-separated list of the names of the only metrics that are exported at /metrics with -monitor, or of patterns of their names, e.g. segment_*,tickets_sent. All metrics are exported if not set")
+	metricsDisabled := flag.String("metricsDisabled", "", "Comma-separated list of the names of metrics that are not exported at /metrics with -monitor, or of patterns of their names, e.g. ticket_*")
+	metricsDropLabels := flag.String("metricsDropLabels", "", "Comma-separated list of the labels that are removed from all metrics. One or more of sender, recipient, manifestID and transcoder")
+	metricsMaxLabelValues := flag.Int("metricsMaxLabelValues", 0, "Maximum number of values of each of the sender, recipient, manifestID and transcoder labels of metrics. Only the values recorded the most are kept and the others are aggregated as 'other'. Not limited if 0")
+	metricsLabelAllowlist := flag.String("metricsLabelAllowlist", "", "Comma-separated list of label=value pairs, e.g. sender=0xabc...,manifestID=movie, that are always kept in metrics regardless of -metricsMaxLabelValues")
 
 	// Storage:
 	datadir := flag.String("datadir", "", "data directory")
+	preflightChecks := flag.Bool("preflight", true, "Check the configuration of the node before it starts: free ports, object storage credentials, ETH RPC chain, keystore and service address. The node exits with the failed checks and how to fix them")
 	s3bucket := flag.String("s3bucket", "", "S3 region/bucket (e.g. eu-central-1/testbucket)")
 	s3creds := flag.String("s3creds", "", "S3 credentials (in form ACCESSKEYID/ACCESSKEY)")
 	gsBucket := flag.String("gsbucket", "", "Google storage bucket")
 	gsKey := flag.String("gskey", "", "Google Storage private key file name (in json format)")
+	record := flag.String("record", "", "Broadcaster only. Record streams to -s3bucket or -gsbucket and write VOD playlists in the given formats (comma separated list of hls, dash) when they end")
+	recordRetention := flag.Duration("recordRetention", 0, "How long recordings are kept after their stream ended before they are deleted. Only supported with -s3bucket. Recordings are kept if not set")
+	dbBackupInterval := flag.Duration("dbBackupInterval", 0, "How often a backup of the database is saved to -s3bucket, encrypted with -dbBackupPassword. Only supported with -s3bucket, not with -gsbucket. The database is not backed up if not set")
+	dbBackupRetention := flag.Duration("dbBackupRetention", 7*24*time.Hour, "How long database backups are kept before they are deleted. The most recent backup is always kept. Backups are kept forever if 0")
+	dbBackupPassword := flag.String("dbBackupPassword", "", "Password that database backups are encrypted with")
+	protocolArchiveWindow := flag.Duration("protocolArchiveWindow", 0, "How long the signed messages of the segments exchanged with other nodes are archived for, with the source segments and renditions saved to -s3bucket. Exchanges are not archived if not set")
+	restoreDBBackup := flag.String("restoreDBBackup", "", "Restore the database of -datadir from a backup of -s3bucket, decrypted with -dbBackupPassword, and exit. The name of the backup, or latest for the most recent backup. The existing database is kept with a .bak-<timestamp> suffix")
+	storageEncryptionKey := flag.String("storageEncryptionKey", "", "Broadcaster only. Hex encoded 32 byte master key. Encrypts the data saved to -s3bucket or -gsbucket with a data key per stream that is wrapped by the master key. The data is served decrypted by the node")
+	thumbnailInterval := flag.Duration("thumbnailInterval", 0, "Broadcaster only. How often a thumbnail is extracted from each stream and saved next to its segments. The latest thumbnail is served at /thumbnail/<manifestID>.<format>. Disabled if not set")
+	thumbnailFormat := flag.String("thumbnailFormat", server.ThumbnailFormatJPEG, "Image format of the thumbnails. One of 'jpg' or 'webp'")
+	thumbnailRendition := flag.String("thumbnailRendition", server.ThumbnailRendition, "Name of the rendition that thumbnails are extracted from, e.g. 'source' or 'P240p30fps16x9'")
+	thumbnailResolution := flag.String("thumbnailResolution", server.ThumbnailResolution, "Resolution of the thumbnails")
+	reconnectGracePeriod := flag.Duration("reconnectGracePeriod", 0, "Broadcaster only. How long the stream of a publisher whose RTMP connection dropped is kept, so that the publisher can reconnect with the same stream key and resume it. Streams end right away if not set")
 
 	// API
 	authWebhookURL := flag.String("authWebhookUrl", "", "RTMP authentication webhook URL")
+	streamEventWebhookURL := flag.String("streamEventWebhookUrl", "", "Broadcaster only. URL that is posted the events of streams: streamStarted, streamEnded, transcodeError and orchestratorSwitched")
+	streamEventWebhookSecret := flag.String("streamEventWebhookSecret", "", "Secret that the events posted to -streamEventWebhookUrl are signed with, as the hex encoded HMAC-SHA256 of the body in the Livepeer-Signature header. Events are not signed if not set")
 	orchWebhookURL := flag.String("orchWebhookUrl", "", "Orchestrator discovery callback URL")
+	orchAddrList := flag.String("orchAddrList", "", "Broadcaster only. File or http(s) URL of a list of orchestrators, one per line in the format of -orchAddr, that is reloaded every -orchListRefresh. Only the orchestrators that answered the latest probe are used")
+	orchListRefresh := flag.Duration("orchListRefresh", time.Minute, "How often -orchAddrList is reloaded and its orchestrators are probed")
+	orchHealthCheck := flag.Duration("orchHealthCheck", 0, "Broadcaster only. How often the orchestrators of -orchAddr or -orchAddrList are pinged to check their health. Only the orchestrators that answered the latest ping are selected. Not checked if 0")
+	orchSRV := flag.String("orchSrv", "", "DNS name whose SRV records list the orchestrators to discover (e.g. _livepeer._tcp.example.com). Used with -discoverySources")
+	discoverySources := flag.String("discoverySources", "", "Broadcaster only. Comma-separated list of the orchestrator discovery sources to combine, each optionally with its priority, e.g. chain:1,webhook:1,srv:2,static:3. Sources are chain (on-chain registry), static (-orchAddr), webhook (-orchWebhookUrl) and srv (-orchSrv). Orchestrators of lower priority values are used first. If not set, only the first configured of -orchWebhookUrl, -orchAddr and the on-chain registry is used")
+	discoveryQuorum := flag.Int("discoveryQuorum", 1, "Number of the -discoverySources of the same priority that must list an orchestrator for it to be used. Lowered to the number of sources that returned orchestrators")
+	warmCaches := flag.Bool("warmCaches", false, "Prime caches when the node starts to cut the latency of the first streams after a restart. Broadcasters request the info of the discovered orchestrators and start PM sessions with the orchestrators that they used the most, orchestrators fetch the reserves of the senders of the winning tickets of the last day")
+	discoveryCacheRefresh := flag.Duration("discoveryCacheRefresh", 0, "Broadcaster only. How often the info of all the discovered orchestrators is requested in the background, so that sessions are created from the cached infos instead of requesting them when streams start. Infos are requested when streams start if not set")
+	healthMaxBlockAge := flag.Duration("healthMaxBlockAge", server.HealthMaxBlockAge, "Age of the last block seen by the node above which /readyz reports the node as not ready")
+	manifestIDNamespace := flag.String("manifestIDNamespace", "", "Namespace of the ManifestIDs of streams that are not assigned one by the auth webhook")
 
 	flag.Parse()
+	explicitFlags := setFlags(flag.CommandLine)
+	if *configFile != "" {
+		if err := loadConfigFile(flag.CommandLine, *configFile); err != nil {
+			glog.Fatalf("Error loading -config: %v", err)
+		}
+	}
 	vFlag.Value.Set(*verbosity)
 
+	if *dumpConfigFlag {
+		if err := dumpConfig(flag.CommandLine, os.Stdout, *dumpConfigSecrets); err != nil {
+			glog.Fatalf("Error printing the configuration: %v", err)
+		}
+		return
+	}
+
 	if *version {
 		fmt.Println("Livepeer Node Version: " + core.LivepeerVersion)
 		fmt.Printf("Golang runtime version: %s %s\n", runtime.Compiler, runtime.Version())
@@ -153,6 +335,36 @@ func main() {
 		return
 	}
 
+	server.HealthMaxBlockAge = *healthMaxBlockAge
+	if err := clog.SetFormat(*logFormat); err != nil {
+		glog.Fatalf("Invalid -logFormat: %v", err)
+	}
+	if err := clog.SetLevels(*logLevels); err != nil {
+		glog.Fatalf("Invalid -logLevels: %v", err)
+	}
+	if err := lpmon.SetRedaction(*telemetryRedaction, *telemetryRedactionKey); err != nil {
+		glog.Fatalf("Invalid -telemetryRedaction: %v", err)
+	}
+	if err := lpmon.SetLabelLimits(*metricsDropLabels, *metricsLabelAllowlist, *metricsMaxLabelValues); err != nil {
+		glog.Fatalf("Invalid metrics label limits: %v", err)
+	}
+	if *traceSampleRate > 0 {
+		if err := lpmon.InitTracing(*traceSampleRate, *traceSpans); err != nil {
+			glog.Fatalf("Invalid -traceSampleRate or -traceSpans: %v", err)
+		}
+	}
+	if err := lpmon.SetMetricsBackends(lpmon.MetricsBackendConfig{
+		Backends:     *metricsBackends,
+		StatsDAddr:   *statsdAddr,
+		OTLPEndpoint: *otlpEndpoint,
+		PushInterval: *metricsPushInterval,
+	}); err != nil {
+		glog.Fatalf("Invalid metrics backends: %v", err)
+	}
+	if err := lpmon.SetMetricsFilter(*metricsEnabled, *metricsDisabled); err != nil {
+		glog.Fatalf("Invalid -metricsEnabled or -metricsDisabled: %v", err)
+	}
+
 	if *maxSessions <= 0 {
 		glog.Fatal("-maxSessions must be greater than zero")
 		return
@@ -221,6 +433,79 @@ func main() {
 		}
 	}
 
+	if *importBundle != "" {
+		f, err := os.Open(*importBundle)
+		if err != nil {
+			glog.Fatalf("Error opening -importBundle: %v", err)
+		}
+		expected := common.BundleManifest{Network: *network, EthController: *ethController, EthAcctAddr: *ethAcctAddr}
+		m, err := common.ImportBundle(f, *bundlePassword, expected, *datadir, keystoreDirectory(*datadir, *ethKeystorePath))
+		f.Close()
+		if err != nil {
+			glog.Fatalf("Error importing bundle: %v", err)
+		}
+		glog.Infof("Imported the bundle of the node of account=%v exported at %v with version %v into %v. Start the node with -config %v",
+			m.EthAcctAddr, m.CreatedAt, m.NodeVersion, *datadir, filepath.Join(*datadir, "config.yaml"))
+		return
+	}
+
+	if *restoreDBBackup != "" {
+		if *s3bucket == "" || *s3creds == "" {
+			glog.Fatal("-restoreDBBackup requires -s3bucket and -s3creds")
+		}
+		br := strings.Split(*s3bucket, "/")
+		cr := strings.Split(*s3creds, "/")
+		storage := drivers.NewS3Driver(br[0], br[1], cr[0], cr[1]).(server.DBBackupStorage)
+		name, err := server.RestoreDBBackup(storage, *dbBackupPassword, *restoreDBBackup, *datadir+"/lp.sqlite3")
+		if err != nil {
+			glog.Fatalf("Error restoring DB backup: %v", err)
+		}
+		glog.Infof("Restored the DB of %v from backup %v", *datadir, name)
+		return
+	}
+
+	if *preflightChecks {
+		cfg := preflightConfig{
+			network:       *network,
+			ethURL:        *ethUrl,
+			ethReadURL:    *ethReadUrl,
+			ethController: *ethController,
+			ethAcctAddr:   *ethAcctAddr,
+			ethPassword:   *ethPassword,
+			keystoreDir:   keystoreDirectory(*datadir, *ethKeystorePath),
+			s3Bucket:      *s3bucket,
+			s3Creds:       *s3creds,
+			gsBucket:      *gsBucket,
+			gsKey:         *gsKey,
+			listenAddrs:   make(map[string]string),
+		}
+		// Standalone transcoders don't listen
+		if !*transcoder || *orchestrator || *broadcaster {
+			cfg.listenAddrs["-cliAddr"] = defaultAddr(*cliAddr, "127.0.0.1", CliPort)
+		}
+		if *broadcaster {
+			cfg.listenAddrs["-rtmpAddr"] = defaultAddr(*rtmpAddr, "127.0.0.1", RtmpPort)
+			cfg.listenAddrs["-httpAddr"] = defaultAddr(*httpAddr, "127.0.0.1", RpcPort)
+			if *rtmpsAddr != "" {
+				cfg.listenAddrs["-rtmpsAddr"] = *rtmpsAddr
+			}
+		} else if *orchestrator {
+			cfg.serviceAddr = *serviceAddr
+			// Without -httpAddr and -serviceAddr, the port is only known once the service URI is read on-chain
+			if *httpAddr != "" {
+				cfg.listenAddrs["-httpAddr"] = defaultAddr(*httpAddr, "", RpcPort)
+			} else if _, port, err := gonet.SplitHostPort(*serviceAddr); err == nil {
+				cfg.listenAddrs["-httpAddr"] = ":" + port
+			}
+		}
+		if failures := preflight(cfg); len(failures) > 0 {
+			for _, f := range failures {
+				glog.Errorf("Preflight check failed: %v", f)
+			}
+			glog.Fatalf("%v preflight checks failed. Fix them and restart the node, or skip the checks with -preflight=false", len(failures))
+		}
+	}
+
 	//Set up DB
 	dbh, err := common.InitDB(*datadir + "/lp.sqlite3")
 	if err != nil {
@@ -234,6 +519,10 @@ func main() {
 		glog.Errorf("Error creating livepeer node: %v", err)
 	}
 
+	// Run idle check routine for active stream sessions
+	go n.Sessions.StartIdleCheck()
+	defer n.Sessions.StopIdleCheck()
+
 	if *orchSecret != "" {
 		n.OrchSecret = *orchSecret
 	}
@@ -251,9 +540,47 @@ func main() {
 		if !*transcoder {
 			n.TranscoderManager = core.NewRemoteTranscoderManager()
 			n.Transcoder = n.TranscoderManager
+			if *minTranscoderVersion != "" {
+				v, err := core.ParseVersion(*minTranscoderVersion)
+				if err != nil {
+					glog.Fatal("Error parsing -minTranscoderVersion ", err)
+				}
+				n.TranscoderManager.SetMinVersion(&v)
+			}
+			if *transcoderSoftDeadline < 0 || *transcoderSoftDeadline >= core.RemoteTranscoderTimeout {
+				glog.Fatalf("-transcoderSoftDeadline must be between 0 and %v", core.RemoteTranscoderTimeout)
+			}
+			core.RemoteTranscoderSoftDeadline = *transcoderSoftDeadline
+			if *transcoderGracePeriod < 0 {
+				glog.Fatal("-transcoderGracePeriod must not be negative")
+			}
+			core.RemoteTranscoderGracePeriod = *transcoderGracePeriod
+			core.RemoteTranscoderEncryption = *transcoderEncryption
+		}
+		if *frontends != "" {
+			for _, f := range strings.Split(*frontends, ",") {
+				u, err := url.ParseRequestURI(strings.TrimSpace(f))
+				if err != nil || u.Host == "" {
+					glog.Fatalf("Invalid -frontends URI %v", f)
+				}
+				server.OrchestratorFrontends = append(server.OrchestratorFrontends, u.String())
+			}
+		}
+		if *orchInfoTTL < 0 {
+			glog.Fatal("-orchInfoTTL must not be negative")
 		}
+		server.OrchestratorInfoTTL = *orchInfoTTL
+		server.OrchestratorRegion = *region
 	} else if *transcoder {
 		n.NodeType = core.TranscoderNode
+		core.RemoteTranscoderEncryption = *transcoderEncryption
+		if *orchCertPin != "" {
+			pin, err := server.ParseCertPin(*orchCertPin)
+			if err != nil {
+				glog.Fatal("Error parsing -orchCertPin ", err)
+			}
+			server.OrchestratorCertPin = pin
+		}
 	} else if *broadcaster {
 		n.NodeType = core.BroadcasterNode
 	} else {
@@ -282,6 +609,12 @@ func main() {
 		if n.OrchSecret == "" {
 			glog.Fatal("Missing -orchSecret")
 		}
+		// Results are signed with a key that is kept in the data directory
+		n.TranscoderIdentity, err = core.LoadTranscoderIdentity(filepath.Join(*datadir, "transcoder.key"))
+		if err != nil {
+			glog.Fatal("Error loading transcoder identity: ", err)
+		}
+		glog.Infof("Transcoder identity address=%v", n.TranscoderIdentity.Address().Hex())
 		if len(orchURLs) > 0 {
 			server.RunTranscoder(n, orchURLs[0].Host, *maxSessions)
 		} else {
@@ -291,15 +624,12 @@ func main() {
 	}
 
 	watcherErr := make(chan error)
+	var ticketRedeemer *server.Redeemer
+	var keystoreDir string
 	if *network == "offchain" {
 		glog.Infof("***Livepeer is in off-chain mode***")
 	} else {
-		var keystoreDir string
-		if _, err := os.Stat(*ethKeystorePath); !os.IsNotExist(err) {
-			keystoreDir, _ = filepath.Split(*ethKeystorePath)
-		} else {
-			keystoreDir = filepath.Join(*datadir, "keystore")
-		}
+		keystoreDir = keystoreDirectory(*datadir, *ethKeystorePath)
 
 		if keystoreDir == "" {
 			glog.Errorf("Cannot find keystore directory")
@@ -313,15 +643,23 @@ func main() {
 		}
 
 		//Set up eth client
-		backend, err := ethclient.Dial(*ethUrl)
+		ethRPCCtx, cancelEthRPC := context.WithCancel(context.Background())
+		defer cancelEthRPC()
+		rpcClient, err := dialEthRPC(ethRPCCtx, *ethUrl, *ethReadUrl)
 		if err != nil {
 			glog.Errorf("Failed to connect to Ethereum client: %v", err)
 			return
 		}
+		backend := ethclient.NewClient(rpcClient)
 
-		client, err := eth.NewClient(ethcommon.HexToAddress(*ethAcctAddr), keystoreDir, backend, ethcommon.HexToAddress(*ethController), EthTxTimeout)
+		// Refuse to use the data of a node of another chain, e.g. after a bundle was imported
+		chainID, err := backend.NetworkID(context.Background())
 		if err != nil {
-			glog.Errorf("Failed to create client: %v", err)
+			glog.Errorf("Failed to get the chain ID: %v", err)
+			return
+		}
+		if err := dbh.CheckChainID(chainID); err != nil {
+			glog.Errorf("Error checking the chain ID: %v", err)
 			return
 		}
 
@@ -329,6 +667,43 @@ func main() {
 		if *gasPrice > 0 {
 			bigGasPrice = big.NewInt(int64(*gasPrice))
 		}
+		if *gasPriceSource == "" && bigGasPrice != nil {
+			*gasPriceSource = eth.GasPriceSourceFixed
+		}
+		if bigGasPrice != nil && *gasPriceSource != eth.GasPriceSourceFixed {
+			glog.Errorf("-gasPrice can only be used with -gasPriceSource=%v", eth.GasPriceSourceFixed)
+			return
+		}
+		var bigMaxFeePerGas, bigMaxPriorityFeePerGas *big.Int
+		for _, fee := range []struct {
+			name  string
+			value string
+			fee   **big.Int
+		}{
+			{"maxFeePerGas", *maxFeePerGas, &bigMaxFeePerGas},
+			{"maxPriorityFeePerGas", *maxPriorityFeePerGas, &bigMaxPriorityFeePerGas},
+		} {
+			if fee.value == "" {
+				continue
+			}
+			v, ok := new(big.Int).SetString(fee.value, 10)
+			if !ok || v.Sign() < 0 {
+				glog.Errorf("-%v must be a valid integer greater than or equal to 0, but %v provided", fee.name, fee.value)
+				return
+			}
+			*fee.fee = v
+		}
+		gasPricer, err := eth.NewGasPricer(*gasPriceSource, rpcClient, bigGasPrice, bigMaxFeePerGas, bigMaxPriorityFeePerGas)
+		if err != nil {
+			glog.Errorf("Error setting -gasPriceSource: %v", err)
+			return
+		}
+
+		client, err := eth.NewClient(ethcommon.HexToAddress(*ethAcctAddr), keystoreDir, backend, ethcommon.HexToAddress(*ethController), EthTxTimeout, gasPricer)
+		if err != nil {
+			glog.Errorf("Failed to create client: %v", err)
+			return
+		}
 
 		err = client.Setup(*ethPassword, uint64(*gasLimit), bigGasPrice)
 		if err != nil {
@@ -338,14 +713,23 @@ func main() {
 
 		n.Eth = client
 
+		if *txStuckBlocks < 0 {
+			glog.Errorf("-txStuckBlocks must not be negative, but %v provided", *txStuckBlocks)
+			return
+		}
+		txQueueCtx, cancelTxQueue := context.WithCancel(context.Background())
+		defer cancelTxQueue()
+		go client.TxQueue().Watch(txQueueCtx, txQueuePollingInterval, uint64(*txStuckBlocks))
+
 		addrMap := n.Eth.ContractAddresses()
 
-		// Initialize block watcher that will emit logs used by event watchers
-		blockWatcherClient, err := blockwatch.NewRPCClient(*ethUrl, ethRPCTimeout)
-		if err != nil {
-			glog.Errorf("Failed to setup blockwatch client: %v", err)
+		if *blockConfirmations < 0 || *blockConfirmations >= blockWatcherRetentionLimit {
+			glog.Errorf("-blockConfirmations must be between 0 and %v, but %v provided", blockWatcherRetentionLimit-1, *blockConfirmations)
 			return
 		}
+
+		// Initialize block watcher that will emit logs used by event watchers
+		blockWatcherClient := blockwatch.NewRPCClientWithRPC(rpcClient, ethRPCTimeout)
 		topics := watchers.FilterTopics()
 		blockWatcherCfg := blockwatch.Config{
 			Store:               n.Database,
@@ -355,6 +739,7 @@ func main() {
 			WithLogs:            true,
 			Topics:              topics,
 			Client:              blockWatcherClient,
+			Confirmations:       *blockConfirmations,
 		}
 		// Wait until all event watchers have been initialized before starting the block watcher
 		blockWatcher := blockwatch.New(blockWatcherCfg)
@@ -391,6 +776,15 @@ func main() {
 		go senderWatcher.Watch()
 		defer senderWatcher.Stop()
 
+		protocolEvents, err := watchers.NewProtocolEventBus(addrMap["BondingManager"], addrMap["RoundsManager"], addrMap["TicketBroker"], blockWatcher)
+		if err != nil {
+			glog.Errorf("Failed to setup protocol event bus: %v", err)
+			return
+		}
+		go protocolEvents.Watch()
+		defer protocolEvents.Stop()
+		server.ProtocolEvents = protocolEvents
+
 		blockWatchCtx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
@@ -418,7 +812,31 @@ func main() {
 			watcherErr <- err
 		}()
 
-		n.Balances = core.NewBalances(cleanupInterval)
+		if *balanceTTL <= 0 {
+			glog.Errorf("-balanceTTL must be greater than 0, but %v provided. Restart the node with a valid value for -balanceTTL", *balanceTTL)
+			return
+		}
+		policy, err := core.ParseBalanceCleanupPolicy(*balanceCleanupPolicy)
+		if err != nil {
+			glog.Errorf("Invalid -balanceCleanupPolicy: %v", err)
+			return
+		}
+		n.Balances = core.NewBalancesWithPolicy(*balanceTTL, policy)
+
+		expiryPolicy, err := core.ParseCreditExpiryPolicy(*creditExpiryPolicy)
+		if err != nil {
+			glog.Errorf("Invalid -creditExpiryPolicy: %v", err)
+			return
+		}
+		if expiryPolicy == core.ReclaimCredit && (*creditExpiry <= 0 || *creditExpiry >= *balanceTTL) {
+			glog.Errorf("-creditExpiry must be greater than 0 and less than -balanceTTL=%v, but %v provided. Restart the node with a valid value for -creditExpiry", *balanceTTL, *creditExpiry)
+			return
+		}
+		n.Balances.SetCreditExpiry(*creditExpiry, expiryPolicy)
+		if server.CreditReclaimWebhookURL, err = getWebhookURL("credit reclaim", *creditReclaimWebhookURL); err != nil {
+			glog.Errorf("Error setting credit reclaim webhook URL: %v", err)
+			return
+		}
 
 		if *orchestrator {
 
@@ -453,11 +871,26 @@ func main() {
 				return
 			}
 
+			if *maxTicketsPerPayment < 0 {
+				glog.Errorf("-maxTicketsPerPayment must not be negative, but %v provided. Restart the node with a different valid value for -maxTicketsPerPayment", *maxTicketsPerPayment)
+				return
+			}
+
+			var batchFaceValue *big.Int
+			if *maxBatchFaceValue != "" {
+				batchFaceValue, _ = new(big.Int).SetString(*maxBatchFaceValue, 10)
+				if batchFaceValue == nil || batchFaceValue.Sign() <= 0 {
+					glog.Errorf("-maxBatchFaceValue must be a valid integer greater than 0, but %v provided. Restart the node with a different valid value for -maxBatchFaceValue", *maxBatchFaceValue)
+					return
+				}
+			}
+			n.SetTicketBatchLimits(*maxTicketsPerPayment, batchFaceValue)
+
 			sigVerifier := &pm.DefaultSigVerifier{}
 			// TODO: Initialize Validator with an implementation
 			// of RoundsManager that reads from a cache
 			validator := pm.NewValidator(sigVerifier, roundsWatcher)
-			gpm := eth.NewGasPriceMonitor(backend, gpmPollingInterval)
+			gpm := eth.NewGasPriceMonitor(gasPricer, gpmPollingInterval)
 			// Start gas price monitor
 			gasPriceUpdate, err := gpm.Start(context.Background())
 			if err != nil {
@@ -470,30 +903,107 @@ func main() {
 			n.ErrorMonitor = em
 			go em.StartGasPriceUpdateLoop()
 
-			sm := pm.NewSenderMonitor(n.Eth.Account().Address, n.Eth, senderWatcher, roundsWatcher, cleanupInterval, smTTL, n.ErrorMonitor)
+			if *redeemer || *redeemerAddr != "" {
+				if *redeemer && *redeemerAddr != "" {
+					glog.Error("-redeemer and -redeemerAddr can't be used together")
+					return
+				}
+				if *redeemerSecret == "" {
+					glog.Error("Missing -redeemerSecret")
+					return
+				}
+			}
+			// Frontends forward their winning tickets to the redeemer, which monitors the senders
+			// of every frontend
+			var redeemerClient *server.RedeemerClient
+			var sm pm.SenderMonitor
+			if *redeemerAddr != "" {
+				uri, err := url.ParseRequestURI("https://" + *redeemerAddr)
+				if err != nil {
+					glog.Errorf("Invalid -redeemerAddr: %v", err)
+					return
+				}
+				redeemerClient = server.NewRedeemerClient(uri, *redeemerSecret)
+				sm = pm.NewForwardingSenderMonitor(redeemerClient)
+			} else {
+				sm = pm.NewSenderMonitor(n.Eth.Account().Address, n.Eth, senderWatcher, roundsWatcher, cleanupInterval, smTTL, n.ErrorMonitor)
+			}
 			// Start sender monitor
 			sm.Start()
 			defer sm.Stop()
+			if *warmCaches {
+				go warmSenderReserves(n.Database, sm, warmSendersWindow)
+			}
 
 			cfg := pm.TicketParamsConfig{
 				EV:               ev,
 				RedeemGas:        redeemGas,
 				TxCostMultiplier: txCostMultiplier,
 			}
-			n.Recipient, err = pm.NewRecipient(
-				n.Eth.Account().Address,
-				n.Eth,
-				validator,
-				n.Database,
-				gpm,
-				sm,
-				n.ErrorMonitor,
-				cfg,
-			)
+			if *redeemer || *redeemerAddr != "" {
+				// The redeemer and its frontends accept each other's tickets so they need the same secret
+				secret, err := sharedRecipientSecret(n.Eth, *redeemerSecret)
+				if err != nil {
+					glog.Errorf("Error setting up PM recipient secret: %v", err)
+					return
+				}
+				if redeemerClient != nil {
+					n.Recipient = pm.NewRecipientWithState(n.Eth.Account().Address, n.Eth, validator, n.Database, gpm, sm, n.ErrorMonitor, secret, cfg, redeemerClient)
+					n.Recipient = pm.NewForwardingRecipient(n.Recipient, redeemerClient)
+					glog.Infof("Forwarding winning tickets to redeemer at %v", *redeemerAddr)
+				} else {
+					n.Recipient = pm.NewRecipientWithState(n.Eth.Account().Address, n.Eth, validator, n.Database, gpm, sm, n.ErrorMonitor, secret, cfg, n.Database)
+				}
+			} else {
+				n.Recipient, err = pm.NewRecipient(
+					n.Eth.Account().Address,
+					n.Eth,
+					validator,
+					n.Database,
+					gpm,
+					sm,
+					n.ErrorMonitor,
+					cfg,
+				)
+				if err != nil {
+					glog.Errorf("Error setting up PM recipient: %v", err)
+					return
+				}
+			}
+
+			redeemPolicy, err := pm.ParseRedemptionPolicy(*redemptionPolicy)
 			if err != nil {
-				glog.Errorf("Error setting up PM recipient: %v", err)
+				glog.Errorf("Invalid -redemptionPolicy: %v", err)
+				return
+			}
+			expiration := pm.TicketExpirationPolicy{ValidityPeriod: *ticketValidityPeriod, RedemptionBuffer: *ticketRedemptionBuffer}
+			if err := expiration.Validate(); err != nil {
+				glog.Errorf("Invalid ticket expiration: %v", err)
 				return
 			}
+			server.OrchestratorTicketExpiration = &expiration
+			scheduleCfg := pm.RedemptionScheduleConfig{
+				Policy:           redeemPolicy,
+				ValidityPeriod:   *ticketValidityPeriod,
+				RedemptionBuffer: *ticketRedemptionBuffer,
+				PollInterval:     pm.DefaultRedemptionPollInterval,
+			}
+			if *redemptionMaxGasPrice != "" {
+				scheduleCfg.MaxGasPrice, _ = new(big.Int).SetString(*redemptionMaxGasPrice, 10)
+			}
+			if err := scheduleCfg.Validate(); err != nil {
+				glog.Errorf("Invalid ticket redemption schedule: %v", err)
+				return
+			}
+			if redeemPolicy != pm.RedeemImmediately && *redeemerAddr != "" {
+				glog.Infof("Ignoring -redemptionPolicy since winning tickets are redeemed by the redeemer")
+			} else if redeemPolicy != pm.RedeemImmediately {
+				glog.Infof("Scheduling ticket redemptions with policy=%v", redeemPolicy)
+				n.Recipient = pm.NewSchedulingRecipient(n.Recipient, roundsWatcher, gpm, scheduleCfg)
+			}
+			if *redeemer {
+				ticketRedeemer = server.NewRedeemer(n.Recipient, n.Database, sm, *redeemerSecret)
+			}
 
 			n.Recipient.Start()
 			defer n.Recipient.Stop()
@@ -502,16 +1012,39 @@ func main() {
 			go n.Balances.StartCleanup()
 			// Stop the cleanup routine on program exit
 			defer n.Balances.StopCleanup()
+			// Notify the credit reclaim webhook, if any, until the cleanup routine is stopped
+			go server.StartCreditReclaimNotifier(n.Balances)
 
 			// Create round iniitializer to automatically initialize new rounds
 			if *initializeRound {
-				initializer := eth.NewRoundInitializer(n.Eth, n.Database, roundsWatcher, roundInitPollingInterval)
+				initCfg := eth.RoundInitializerConfig{GasPrices: gpm, MaxDelay: *initializeRoundMaxDelay}
+				if *initializeRoundMaxGasPrice != "" {
+					initCfg.MaxGasPrice, _ = new(big.Int).SetString(*initializeRoundMaxGasPrice, 10)
+					if initCfg.MaxGasPrice == nil || initCfg.MaxGasPrice.Sign() <= 0 {
+						glog.Errorf("-initializeRoundMaxGasPrice must be a valid integer greater than 0, but %v provided. Restart the node with a different valid value for -initializeRoundMaxGasPrice", *initializeRoundMaxGasPrice)
+						return
+					}
+				}
+				if *initializeRoundMaxDelay < 0 {
+					glog.Errorf("-initializeRoundMaxDelay must not be negative, but %v provided. Restart the node with a different valid value for -initializeRoundMaxDelay", *initializeRoundMaxDelay)
+					return
+				}
+				initializer := eth.NewRoundInitializer(n.Eth, n.Database, roundsWatcher, roundInitPollingInterval, initCfg)
 				go initializer.Start()
 				defer initializer.Stop()
 			}
 
 			// Create reward service to claim/distribute inflationary rewards every round
-			rs := eventservices.NewRewardService(n.Eth)
+			if *rewardAlertWindow < 0 {
+				glog.Errorf("-rewardAlertWindow must not be negative, but %v provided. Restart the node with a different valid value for -rewardAlertWindow", *rewardAlertWindow)
+				return
+			}
+			rewardCfg := eventservices.RewardServiceConfig{BlockNums: n.Database, AlertWindow: *rewardAlertWindow}
+			if rewardCfg.AlertWebhookURL, err = getWebhookURL("reward alert", *rewardAlertWebhookURL); err != nil {
+				glog.Errorf("Error setting reward alert webhook URL: %v", err)
+				return
+			}
+			rs := eventservices.NewRewardService(n.Eth, protocolEvents, rewardCfg)
 			rs.Start(context.Background())
 			defer rs.Stop()
 		}
@@ -530,7 +1063,31 @@ func main() {
 				panic(fmt.Errorf("-depositMultiplier must be greater than 0, but %v provided. Restart the node with a valid value for -depositMultiplier", *depositMultiplier))
 			}
 
-			n.Sender = pm.NewSender(n.Eth, roundsWatcher, senderWatcher, ev, *depositMultiplier)
+			n.Sender = pm.NewSender(n.Eth, roundsWatcher, senderWatcher, ev, *depositMultiplier, n.Database)
+
+			expiration := pm.TicketExpirationPolicy{ValidityPeriod: *ticketValidityPeriod, RedemptionBuffer: *ticketExpirationBuffer}
+			if err := expiration.Validate(); err != nil {
+				panic(fmt.Errorf("-ticketExpirationBuffer must be less than -ticketValidityPeriod: %v. Restart the node with valid values", err))
+			}
+			server.BroadcastTicketExpiration = &expiration
+
+			spendCfg := pm.SpendTrackerConfig{
+				DeviationThreshold: *ticketSpendDeviation,
+				MinExpectedWins:    pm.DefaultMinExpectedWins,
+			}
+			if *maxStreamTicketEV != "" {
+				maxEV, ok := new(big.Rat).SetString(*maxStreamTicketEV)
+				if !ok || maxEV.Sign() <= 0 {
+					panic(fmt.Errorf("-maxStreamTicketEV must be a rational number greater than 0, but %v provided. Restart the node with a valid value for -maxStreamTicketEV", *maxStreamTicketEV))
+				}
+				spendCfg.MaxStreamEV = maxEV
+			}
+			if *ticketSpendDeviation < 0 || (*ticketSpendDeviation > 0 && *ticketSpendDeviation < 1) {
+				panic(fmt.Errorf("-ticketSpendDeviation must be 0 or at least 1, but %v provided. Restart the node with a valid value for -ticketSpendDeviation", *ticketSpendDeviation))
+			}
+			server.BroadcastSpendTracker = pm.NewSpendTracker(spendCfg)
+			server.BroadcastSpendReporter = server.NewSpendReporter(dbh)
+			go watchTicketRedemptions(protocolEvents, n.Eth.Account().Address, server.BroadcastSpendTracker, server.BroadcastSpendReporter)
 
 			if *pixelsPerUnit <= 0 {
 				// Can't divide by 0
@@ -542,6 +1099,11 @@ func main() {
 				glog.Infof("Maximum transcoding price per pixel is not greater than 0: %v, broadcaster is currently set to accept ANY price.\n", *maxPricePerUnit)
 				glog.Infoln("To update the broadcaster's maximum acceptable transcoding price per pixel, use the CLI or restart the broadcaster with the appropriate 'maxPricePerUnit' and 'pixelsPerUnit' values")
 			}
+
+			if *paymentPipelineDepth < 0 {
+				panic(fmt.Errorf("-paymentPipelineDepth must not be negative, but %v provided. Restart the node with a valid value for -paymentPipelineDepth", *paymentPipelineDepth))
+			}
+			server.BroadcastCfg.SetPaymentPipelineDepth(*paymentPipelineDepth)
 		}
 	}
 
@@ -575,28 +1137,179 @@ func main() {
 	}
 
 	core.MaxSessions = *maxSessions
+	if *autoSessions && n.NodeType == core.OrchestratorNode {
+		tuner, err := core.NewCapacityTuner(*minSessions, *maxSessions)
+		if err != nil {
+			glog.Fatal("Error setting up -autoSessions ", err)
+		}
+		if *sessionsBenchmark != "" {
+			if _, isRemote := n.Transcoder.(*core.RemoteTranscoderManager); isRemote {
+				glog.Warning("Skipping -sessionsBenchmark because remote transcoders are not connected yet")
+			} else if err := tuner.Benchmark(n.Transcoder, *sessionsBenchmark, server.BroadcastJobVideoProfiles); err != nil {
+				glog.Fatal("Error benchmarking transcoding throughput ", err)
+			}
+		}
+		n.CapacityTuner = tuner
+	}
+	if *pixelCapacity && n.NodeType == core.OrchestratorNode {
+		capacity, err := core.NewPixelCapacity(*pixelsPerSec)
+		if err != nil {
+			glog.Fatal("Error setting up -pixelCapacity ", err)
+		}
+		if *sessionsBenchmark != "" && *pixelsPerSec == 0 {
+			if _, isRemote := n.Transcoder.(*core.RemoteTranscoderManager); isRemote {
+				glog.Warning("Skipping -sessionsBenchmark because remote transcoders are not connected yet")
+			} else if err := capacity.Benchmark(n.Transcoder, *sessionsBenchmark, server.BroadcastJobVideoProfiles, *minSessions); err != nil {
+				glog.Fatal("Error benchmarking transcoding throughput ", err)
+			}
+		}
+		n.PixelCapacity = capacity
+	}
+	if *loadShedding && n.NodeType == core.OrchestratorNode {
+		n.LoadShedder = core.NewLoadShedder(*loadSheddingGrace)
+	}
 	if lpmon.Enabled {
-		lpmon.MaxSessions(core.MaxSessions)
+		lpmon.MaxSessions(n.MaxSessions())
 	}
 
+	var rtmpsCertificate tls.Certificate
+	var udpIngests []*server.UDPIngest
+	var healthGossip *server.HealthGossip
 	if n.NodeType == core.BroadcasterNode {
 		// default lpms listener for broadcaster; same as default rpc port
 		// TODO provide an option to disable this?
 		*rtmpAddr = defaultAddr(*rtmpAddr, "127.0.0.1", RtmpPort)
 		*httpAddr = defaultAddr(*httpAddr, "127.0.0.1", RpcPort)
+		if *rtmpsAddr != "" {
+			if *rtmpsCert == "" || *rtmpsKey == "" {
+				glog.Fatal("-rtmpsAddr requires -rtmpsCert and -rtmpsKey")
+			}
+			if rtmpsCertificate, err = tls.LoadX509KeyPair(*rtmpsCert, *rtmpsKey); err != nil {
+				glog.Fatal("Error loading RTMPS certificate ", err)
+			}
+		}
+		if *orchCertPins != "" || *orchCertTOFU {
+			var pins []string
+			if *orchCertPins != "" {
+				pins = strings.Split(*orchCertPins, ",")
+			}
+			if server.OrchCertPins, err = server.NewOrchCertPinStore(pins, *orchCertTOFU, n.Database); err != nil {
+				glog.Fatal("Error parsing -orchCertPins ", err)
+			}
+		}
+		if *udpIngest != "" {
+			for _, spec := range strings.Split(*udpIngest, ",") {
+				cfg, err := server.ParseUDPIngest(strings.TrimSpace(spec))
+				if err != nil {
+					glog.Fatal("Error parsing -udpIngest ", err)
+				}
+				udpIngests = append(udpIngests, cfg)
+			}
+		}
 
 		// Set up orchestrator discovery
-		if *orchWebhookURL != "" {
+		var orchList net.OrchestratorPool
+		if *orchHealthCheck < 0 {
+			glog.Fatal("-orchHealthCheck must not be negative")
+		}
+		if *orchAddrList != "" {
+			if len(orchURLs) > 0 {
+				glog.Fatal("-orchAddr and -orchAddrList can't be used together")
+			}
+			if *orchListRefresh <= 0 {
+				glog.Fatal("-orchListRefresh must be positive")
+			}
+			pool := discovery.NewStaticPool(n, *orchAddrList)
+			go pool.StartRefreshing(*orchListRefresh)
+			if *orchHealthCheck > 0 {
+				go pool.StartHealthChecks(*orchHealthCheck)
+			}
+			defer pool.StopRefreshing()
+			orchList = pool
+		} else if *orchHealthCheck > 0 && len(orchURLs) > 0 {
+			pool := discovery.NewHealthCheckedPool(n, orchURLs)
+			go pool.StartHealthChecks(*orchHealthCheck)
+			defer pool.StopRefreshing()
+			orchList = pool
+		}
+		if *preferSameRegion && *region == "" {
+			glog.Fatal("-preferSameRegion requires -region")
+		}
+		discovery.Region = *region
+		discovery.PreferSameRegion = *preferSameRegion
+		discovery.LatencySelection = *latencySelection
+		if *discoverySources != "" {
+			sources, err := discovery.ParseDiscoverySources(*discoverySources)
+			if err != nil {
+				glog.Fatal("Error parsing -discoverySources ", err)
+			}
+			if *discoveryQuorum < 1 {
+				glog.Fatal("-discoveryQuorum must be positive")
+			}
+			for _, src := range sources {
+				switch src.Name {
+				case discovery.SourceChain:
+					if *network == "offchain" {
+						glog.Fatal("The chain discovery source requires an on-chain network")
+					}
+					src.Source = discovery.NewDBOrchestratorPoolCache(n)
+				case discovery.SourceStatic:
+					if orchList != nil {
+						src.Source = orchList
+						break
+					}
+					if len(orchURLs) == 0 {
+						glog.Fatal("The static discovery source requires -orchAddr or -orchAddrList")
+					}
+					src.Source = discovery.NewOrchestratorPool(n, orchURLs)
+				case discovery.SourceWebhook:
+					whurl, err := getOrchWebhook(*orchWebhookURL)
+					if err != nil || whurl == nil {
+						glog.Fatal("The webhook discovery source requires a valid -orchWebhookUrl ", err)
+					}
+					src.Source = discovery.NewWebhookPool(n, whurl)
+				case discovery.SourceSRV:
+					if *orchSRV == "" {
+						glog.Fatal("The srv discovery source requires -orchSrv")
+					}
+					src.Source = discovery.NewSRVSource(*orchSRV)
+				}
+			}
+			n.OrchestratorPool = discovery.NewLayeredPool(n, sources, *discoveryQuorum)
+		} else if *orchWebhookURL != "" {
 			whurl, err := getOrchWebhook(*orchWebhookURL)
 			if err != nil {
 				glog.Fatal("Error setting orch webhook URL ", err)
 			}
 			n.OrchestratorPool = discovery.NewWebhookPool(n, whurl)
+		} else if orchList != nil {
+			n.OrchestratorPool = orchList
 		} else if len(orchURLs) > 0 {
 			n.OrchestratorPool = discovery.NewOrchestratorPool(n, orchURLs)
 		} else if *network != "offchain" {
 			n.OrchestratorPool = discovery.NewDBOrchestratorPoolCache(n)
 		}
+		if *discoveryCacheRefresh < 0 {
+			glog.Fatal("-discoveryCacheRefresh must not be negative")
+		}
+		if (*discoveryCacheRefresh > 0 || *warmCaches) && n.OrchestratorPool != nil {
+			pool := discovery.NewCachedPool(n, n.OrchestratorPool)
+			go func() {
+				if *warmCaches {
+					// Primed infos are kept fresh by the refreshes if there are any
+					maxAge := warmDiscoveryTTL
+					if *discoveryCacheRefresh > 0 {
+						maxAge = 0
+					}
+					warmBroadcaster(n, pool, maxAge)
+				}
+				if *discoveryCacheRefresh > 0 {
+					pool.StartRefreshing(*discoveryCacheRefresh)
+				}
+			}()
+			defer pool.StopRefreshing()
+			n.OrchestratorPool = pool
+		}
 		if n.OrchestratorPool == nil {
 			// Not a fatal error; may continue operating in segment-only mode
 			glog.Error("No orchestrator specified; transcoding will not happen")
@@ -605,6 +1318,150 @@ func main() {
 		if server.AuthWebhookURL, err = getAuthWebhookURL(*authWebhookURL); err != nil {
 			glog.Fatal("Error setting auth webhook URL ", err)
 		}
+		eventURL, err := getWebhookURL("stream event", *streamEventWebhookURL)
+		if err != nil {
+			glog.Fatal("Error setting stream event webhook URL ", err)
+		}
+		if eventURL != "" {
+			server.StreamEvents = server.NewStreamEventDispatcher(eventURL, *streamEventWebhookSecret)
+			go server.StreamEvents.StartDispatching()
+			defer server.StreamEvents.StopDispatching()
+		}
+		server.LiveStats = server.NewLiveStatsHub()
+		if *segmentVerifiers != "" {
+			if *verificationMaxFailures < 1 || *verificationSuspension <= 0 {
+				glog.Fatal("-verificationMaxFailures and -verificationSuspension must be positive")
+			}
+			if *verificationSampleRate <= 0 || *verificationSampleRate > 1 {
+				glog.Fatal("-verificationSampleRate must be between 0 and 1")
+			}
+			verifier, err := server.ParseSegmentVerifiers(*segmentVerifiers, n.WorkDir)
+			if err != nil {
+				glog.Fatal("Error parsing -segmentVerifiers ", err)
+			}
+			server.BroadcastVerification = server.NewSegmentVerification(verifier, *verificationSampleRate, *verificationMaxFailures, *verificationSuspension)
+		}
+		server.SelectionWebhookURL = *selectionWebhookURL
+		if *selectionStrategy != "" {
+			if err := server.SetSelectionStrategy(*selectionStrategy, n); err != nil {
+				glog.Fatal("Error setting -selectionStrategy ", err)
+			}
+			glog.Infof("Selecting orchestrators with the %s strategy", *selectionStrategy)
+		}
+		if *selectionScorerURL != "" {
+			if server.BroadcastScorer, err = server.NewWebhookScorer(*selectionScorerURL); err != nil {
+				glog.Fatal("Error setting -selectionScorerUrl ", err)
+			}
+			glog.Infof("Scoring orchestrators with the webhook url=%s", *selectionScorerURL)
+		}
+		if *orchDiversity > 0 {
+			if server.BroadcastDiversity, err = server.NewOrchDiversity(*orchDiversity, server.DiversityScope(*orchDiversityScope), *orchDiversityWindow); err != nil {
+				glog.Fatal("Error setting -orchDiversity ", err)
+			}
+			glog.Infof("Spreading the segments of each %s over at least %d orchestrators every %v", *orchDiversityScope, *orchDiversity, *orchDiversityWindow)
+		}
+		if *abTestSelection != "" || *abTestOrchestratorsA != "" || *abTestOrchestratorsB != "" {
+			if server.BroadcastABTest, err = server.ParseABTest(*abTestSelection, *abTestOrchestratorsA, *abTestOrchestratorsB, *abTestSplit, *abTestMode, *abTestDuplicateRate, n, *selectionWebhookURL); err != nil {
+				glog.Fatal("Error setting up the A/B test ", err)
+			}
+			if server.BroadcastABTest.Mode() == server.ABTestSegments {
+				glog.Infof("Running an A/B test of the orchestrator selection alternating the segments of the streams between the arms")
+			} else {
+				glog.Infof("Running an A/B test of the orchestrator selection with %v%% of the streams in arm A mode=%v", *abTestSplit*100, *abTestMode)
+			}
+		}
+		if *adaptiveLadder != "" {
+			if server.BroadcastAdaptiveLadder, err = core.ParseAdaptiveLadderConfig(*adaptiveLadder); err != nil {
+				glog.Fatal("Error parsing -adaptiveLadder ", err)
+			}
+		}
+		if *segmentDurationTolerance < 0 {
+			glog.Fatal("-segmentDurationTolerance must not be negative")
+		}
+		server.BroadcastCfg.SetSegmentDurationTolerance(*segmentDurationTolerance)
+		server.BroadcastCfg.SetConditionSegments(*conditionSegments)
+		if *manifestIDNamespace != "" {
+			if err := core.ValidateNamespace(*manifestIDNamespace); err != nil {
+				glog.Fatal("Error setting -manifestIDNamespace ", err)
+			}
+			server.BroadcastManifestIDNamespace = *manifestIDNamespace
+		}
+		if *healthGossipPeers != "" {
+			if *healthMaxFailures < 1 || *healthMaxLatency < 0 || *healthWindow <= 0 || *healthGossipInterval <= 0 {
+				glog.Fatal("-healthMaxFailures, -healthMaxLatency, -healthWindow and -healthGossipInterval must be positive")
+			}
+			var peers []*url.URL
+			for _, p := range strings.Split(*healthGossipPeers, ",") {
+				uri, err := url.ParseRequestURI(strings.TrimSpace(p))
+				if err != nil || (uri.Scheme != "http" && uri.Scheme != "https") {
+					glog.Fatalf("Invalid -healthGossipPeers URI %v", p)
+				}
+				peers = append(peers, uri)
+			}
+			var trusted []ethcommon.Address
+			if *healthGossipTrusted != "" {
+				for _, addr := range strings.Split(*healthGossipTrusted, ",") {
+					addr = strings.TrimSpace(addr)
+					if !ethcommon.IsHexAddress(addr) {
+						glog.Fatalf("Invalid -healthGossipTrusted address %v", addr)
+					}
+					trusted = append(trusted, ethcommon.HexToAddress(addr))
+				}
+			}
+			// Reports are signed with the ETH account, or with a key kept in the data directory off-chain
+			var signer server.HealthSigner
+			var sender ethcommon.Address
+			if n.Eth != nil {
+				signer, sender = n.Eth, n.Eth.Account().Address
+			} else {
+				id, err := core.LoadTranscoderIdentity(filepath.Join(*datadir, "gossip.key"))
+				if err != nil {
+					glog.Fatal("Error loading health gossip key ", err)
+				}
+				signer, sender = id, id.Address()
+			}
+			glog.Infof("Gossiping orchestrator health with peers=%v address=%v", *healthGossipPeers, sender.Hex())
+			n.OrchHealth = core.NewOrchestratorHealth(*healthMaxFailures, *healthMaxLatency, *healthWindow)
+			healthGossip = server.NewHealthGossip(n.OrchHealth, signer, sender, peers, trusted)
+		}
+		if *streamQuotas != "" {
+			quotas, err := server.LoadQuotas(*streamQuotas)
+			if err != nil {
+				glog.Fatal("Error loading -streamQuotas ", err)
+			}
+			glog.Infof("Enforcing stream quotas of %d API keys", len(quotas))
+			server.BroadcastQuotas = core.NewStreamQuotas(quotas)
+			server.BroadcastQuotasFile = *streamQuotas
+		}
+		if *segmentTraceSize < 0 {
+			glog.Fatal("-segmentTraceSize must not be negative")
+		}
+		if *segmentTraceSize > 0 {
+			server.SegmentTraces = server.NewSegmentTraceBuffer(*segmentTraceSize)
+		}
+		if *orchReputation {
+			if *orchReputationTargetLatency < 0 {
+				glog.Fatal("-orchReputationTargetLatency must not be negative")
+			}
+			if n.OrchReputation, err = core.NewOrchestratorReputation(n.Database, *orchReputationTargetLatency); err != nil {
+				glog.Fatal("Error loading orchestrator reputation ", err)
+			}
+			go n.OrchReputation.StartFlushing(time.Minute)
+			defer n.OrchReputation.StopFlushing()
+		}
+		if n.OrchLists, err = core.NewOrchestratorLists(n.Database); err != nil {
+			glog.Fatal("Error loading orchestrator lists ", err)
+		}
+		for list, patterns := range map[string]string{core.OrchAllowlist: *orchAllowlist, core.OrchDenylist: *orchDenylist} {
+			if patterns == "" {
+				continue
+			}
+			for _, p := range strings.Split(patterns, ",") {
+				if err := n.OrchLists.Add(list, strings.TrimSpace(p)); err != nil {
+					glog.Fatalf("Error adding %v to the orchestrator %vlist: %v", p, list, err)
+				}
+			}
+		}
 	} else if n.NodeType == core.OrchestratorNode {
 		suri, err := getServiceURI(n, *serviceAddr)
 		if err != nil {
@@ -620,11 +1477,152 @@ func main() {
 		}
 	}
 	*cliAddr = defaultAddr(*cliAddr, "127.0.0.1", CliPort)
+	if *cliAdminTokens != "" || *cliReadTokens != "" {
+		server.CliAuth, err = server.NewCliAuthenticator(strings.Split(*cliAdminTokens, ","), strings.Split(*cliReadTokens, ","))
+		if err != nil {
+			glog.Fatal("Error setting up CLI authentication: ", err)
+		}
+	} else if host, _, err := gonet.SplitHostPort(*cliAddr); err == nil && !isLoopback(host) {
+		glog.Warningf("The CLI endpoints on %v are not authenticated, set -cliAdminTokens to protect them", *cliAddr)
+	}
+	if (*cliTLSCert == "") != (*cliTLSKey == "") {
+		glog.Fatal("-cliTLSCert and -cliTLSKey must be set together")
+	}
+	server.CliTLSCert, server.CliTLSKey = *cliTLSCert, *cliTLSKey
+	server.LegacyCliResponses = *cliLegacyResponses
+	for _, limits := range []struct {
+		flag   string
+		value  string
+		limits *server.HTTPLimits
+	}{
+		{"-segmentHTTPLimits", *segmentHTTPLimits, &server.SegmentHTTPLimits},
+		{"-managementHTTPLimits", *managementHTTPLimits, &server.ManagementHTTPLimits},
+		{"-playlistHTTPLimits", *playlistHTTPLimits, &server.PlaylistHTTPLimits},
+	} {
+		if *limits.limits, err = server.ParseHTTPLimits(limits.value, *limits.limits); err != nil {
+			glog.Fatalf("Invalid %v: %v", limits.flag, err)
+		}
+	}
 
 	if drivers.NodeStorage == nil {
 		// base URI will be empty for broadcasters; that's OK
 		drivers.NodeStorage = drivers.NewMemoryDriver(n.GetServiceURI())
 	}
+	if _, ok := drivers.NodeStorage.(*drivers.MemoryOS); core.RemoteTranscoderEncryption && !ok {
+		// Encrypted segments are served to transcoders from the orchestrator's memory
+		glog.Fatal("-transcoderEncryption can not be used with -s3bucket or -gsbucket")
+	}
+	if *record != "" {
+		if n.NodeType != core.BroadcasterNode {
+			glog.Fatal("-record is only supported by broadcasters")
+		}
+		if _, ok := drivers.NodeStorage.(*drivers.MemoryOS); ok {
+			glog.Fatal("-record requires -s3bucket or -gsbucket")
+		}
+		formats, err := core.ParseRecordingFormats(*record)
+		if err != nil {
+			glog.Fatal("Error parsing -record ", err)
+		}
+		server.RecordingFormats = formats
+	}
+	if *recordRetention > 0 {
+		if *record == "" || *gsBucket != "" {
+			glog.Fatal("-recordRetention requires -record and -s3bucket")
+		}
+		pruner, ok := drivers.NodeStorage.(drivers.OSPruner)
+		if !ok {
+			glog.Fatal("-recordRetention is not supported by the storage")
+		}
+		retention := server.NewRecordingRetention(pruner, *recordRetention)
+		// Check for expired recordings a few times per retention period
+		interval := *recordRetention / 4
+		if interval < time.Minute {
+			interval = time.Minute
+		}
+		go retention.StartPruning(interval)
+		defer retention.StopPruning()
+	}
+	if *dbBackupInterval > 0 {
+		if *s3bucket == "" || *gsBucket != "" {
+			glog.Fatal("-dbBackupInterval requires -s3bucket and can not be used with -gsbucket")
+		}
+		backup, err := server.NewDBBackup(dbh, drivers.NodeStorage, *dbBackupPassword, *dbBackupRetention)
+		if err != nil {
+			glog.Fatalf("Error setting up DB backups: %v", err)
+		}
+		go backup.StartBackups(*dbBackupInterval)
+		defer backup.StopBackups()
+	}
+	if *protocolArchiveWindow > 0 {
+		if *s3bucket == "" {
+			glog.Fatal("-protocolArchiveWindow requires -s3bucket")
+		}
+		archive, err := server.NewProtocolArchive(dbh, drivers.NodeStorage, *protocolArchiveWindow)
+		if err != nil {
+			glog.Fatalf("Error setting up the protocol archive: %v", err)
+		}
+		server.Archive = archive
+		go archive.StartPruning(protocolArchivePruneInterval)
+		defer archive.StopPruning()
+		glog.Infof("Archiving the exchanges with other nodes for %v", *protocolArchiveWindow)
+	}
+	if *storageEncryptionKey != "" {
+		if n.NodeType != core.BroadcasterNode {
+			glog.Fatal("-storageEncryptionKey is only supported by broadcasters")
+		}
+		if _, ok := drivers.NodeStorage.(*drivers.MemoryOS); ok {
+			glog.Fatal("-storageEncryptionKey requires -s3bucket or -gsbucket")
+		}
+		masterKey, err := drivers.ParseMasterKey(*storageEncryptionKey)
+		if err != nil {
+			glog.Fatal("Error parsing -storageEncryptionKey ", err)
+		}
+		keys, err := drivers.NewMasterKeyWrapper(masterKey)
+		if err != nil {
+			glog.Fatal("Error creating storage encryption keys ", err)
+		}
+		// Pruning recordings goes directly to the underlying storage
+		drivers.NodeStorage = drivers.NewEncryptedDriver(drivers.NodeStorage, keys, nil)
+		glog.Info("Encrypting data saved to storage")
+	}
+	if *thumbnailInterval > 0 {
+		format, err := server.ParseThumbnailFormat(*thumbnailFormat)
+		if err != nil {
+			glog.Fatal("Error parsing -thumbnailFormat ", err)
+		}
+		var w, h int
+		if n, _ := fmt.Sscanf(*thumbnailResolution, "%dx%d", &w, &h); n != 2 || w <= 0 || h <= 0 {
+			glog.Fatal("Invalid -thumbnailResolution ", *thumbnailResolution)
+		}
+		server.ThumbnailInterval = *thumbnailInterval
+		server.ThumbnailFormat = format
+		server.ThumbnailRendition = *thumbnailRendition
+		server.ThumbnailResolution = *thumbnailResolution
+	}
+	if *reconnectGracePeriod < 0 {
+		glog.Fatal("-reconnectGracePeriod must not be negative")
+	}
+	server.ReconnectGracePeriod = *reconnectGracePeriod
+	server.StrictProtocol = *strictProtocol
+	server.FirstSegmentFastPath = *firstSegmentFastPath
+
+	// Settings adjusted with the CLI webserver before a restart take precedence over the flags
+	if err := server.LoadRuntimeConfig(n); err != nil {
+		glog.Fatal("Error restoring the configuration set at runtime ", err)
+	}
+
+	// The effective configuration is exported with the database and keystore by /exportBundle. The
+	// secrets are kept so that the imported node runs like this one, and bundles are encrypted
+	var bundleConfig bytes.Buffer
+	if err := dumpConfig(flag.CommandLine, &bundleConfig, true, bundleExcludedFlags...); err != nil {
+		glog.Fatal("Error dumping the configuration ", err)
+	}
+	server.NodeBundleSource = &server.BundleSource{
+		Network:       *network,
+		EthController: *ethController,
+		KeystoreDir:   keystoreDir,
+		Config:        bundleConfig.Bytes(),
+	}
 
 	//Create Livepeer Node
 
@@ -646,6 +1644,12 @@ func main() {
 		s.ExposeCurrentManifest = *currentManifest
 	}
 
+	if healthGossip != nil {
+		healthGossip.RegisterHandlers(s.HTTPMux)
+		go healthGossip.StartGossip(*healthGossipInterval)
+		defer healthGossip.StopGossip()
+	}
+
 	go func() {
 		s.StartCliWebserver(*cliAddr)
 		close(wc)
@@ -653,6 +1657,16 @@ func main() {
 	go func() {
 		ec <- s.StartMediaServer(msCtx, *transcodingOptions, *httpAddr)
 	}()
+	if n.NodeType == core.BroadcasterNode && *rtmpsAddr != "" {
+		go func() {
+			ec <- server.ServeRTMPS(msCtx, *rtmpsAddr, *rtmpAddr, rtmpsCertificate)
+		}()
+	}
+	for _, cfg := range udpIngests {
+		go func(cfg *server.UDPIngest) {
+			ec <- s.ServeUDPIngest(msCtx, cfg)
+		}(cfg)
+	}
 
 	go func() {
 		if core.OrchestratorNode != n.NodeType {
@@ -661,6 +1675,10 @@ func main() {
 
 		orch := core.NewOrchestrator(s.LivepeerNode)
 
+		if ticketRedeemer != nil {
+			ticketRedeemer.RegisterHandlers(s.HTTPMux)
+		}
+
 		go func() {
 			server.StartTranscodeServer(orch, *httpAddr, s.HTTPMux, n.WorkDir, n.TranscoderManager != nil)
 			tc <- struct{}{}
@@ -683,10 +1701,37 @@ func main() {
 	case core.BroadcasterNode:
 		glog.Infof("***Livepeer Running in Broadcaster Mode***")
 		glog.Infof("Video Ingest Endpoint - rtmp://%v", *rtmpAddr)
+		if *rtmpsAddr != "" {
+			glog.Infof("Video Ingest Endpoint - rtmps://%v", *rtmpsAddr)
+		}
+		for _, cfg := range udpIngests {
+			glog.Infof("Video Ingest Endpoint - udp://%v", cfg.Addr)
+		}
 	case core.TranscoderNode:
 		glog.Infof("**Liveepeer Running in Transcoder Mode***")
 	}
 
+	// Apply the reloadable settings of the config file again on SIGHUP
+	if *configFile != "" {
+		reloader, err := newConfigReloader(flag.CommandLine, *configFile, explicitFlags)
+		if err != nil {
+			glog.Fatal("Error reading -config ", err)
+		}
+		registerReloadableSettings(reloader, n, vFlag)
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				glog.Infof("Reloading the config file %v", *configFile)
+				changed, err := reloader.reload()
+				if err != nil {
+					glog.Errorf("Error reloading the config file: %v", err)
+				}
+				glog.Infof("Reloaded the config file, changed settings: %v", strings.Join(changed, ", "))
+			}
+		}()
+	}
+
 	c := make(chan os.Signal)
 	signal.Notify(c, os.Interrupt)
 	select {
@@ -711,6 +1756,33 @@ func main() {
 	}
 }
 
+// splitURLs returns the URLs of a comma-separated list
+func splitURLs(list string) []string {
+	var urls []string
+	for _, u := range strings.Split(list, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// dialEthRPC connects to the ETH RPC endpoints of -ethUrl and -ethReadUrl. A single endpoint is
+// dialed directly, while the requests to several endpoints fail over between them, and their
+// health is checked until the context is done
+func dialEthRPC(ctx context.Context, ethURL, ethReadURL string) (*rpc.Client, error) {
+	urls, readURLs := splitURLs(ethURL), splitURLs(ethReadURL)
+	if len(urls) == 1 && len(readURLs) == 0 {
+		return rpc.Dial(urls[0])
+	}
+	endpoints, err := eth.NewRPCEndpoints(urls, readURLs, ethRPCTimeout)
+	if err != nil {
+		return nil, err
+	}
+	go endpoints.Watch(ctx, ethRPCHealthCheckInterval)
+	return endpoints.Dial()
+}
+
 func getOrchWebhook(u string) (*url.URL, error) {
 	if u == "" {
 		return nil, nil
@@ -727,6 +1799,10 @@ func getOrchWebhook(u string) (*url.URL, error) {
 }
 
 func getAuthWebhookURL(u string) (string, error) {
+	return getWebhookURL("auth", u)
+}
+
+func getWebhookURL(name, u string) (string, error) {
 	if u == "" {
 		return "", nil
 	}
@@ -737,10 +1813,36 @@ func getAuthWebhookURL(u string) (string, error) {
 	if p.Scheme != "http" && p.Scheme != "https" {
 		return "", errors.New("Webhook URL should be HTTP or HTTPS")
 	}
-	glog.Infof("Using auth webhook url %s", u)
+	glog.Infof("Using %s webhook url %s", name, u)
 	return u, nil
 }
 
+// watchTicketRedemptions records the winning tickets of sender that are redeemed on-chain with tracker
+func watchTicketRedemptions(events watchers.ProtocolEventSubscriber, sender ethcommon.Address, tracker *pm.SpendTracker, reporter *server.SpendReporter) {
+	sink := make(chan *watchers.ProtocolEvent, 10)
+	sub := events.Subscribe(sink)
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case ev := <-sink:
+			transfer, ok := ev.Event.(*contracts.TicketBrokerWinningTicketTransfer)
+			if !ok || transfer.Sender != sender {
+				continue
+			}
+			if ev.Removed {
+				tracker.TicketRedemptionReverted(transfer.Recipient, transfer.Amount)
+				reporter.TicketRedemptionReverted(transfer.Recipient, transfer.Amount)
+			} else {
+				tracker.TicketRedeemed(transfer.Recipient, transfer.Amount)
+				reporter.TicketRedeemed(transfer.Recipient, transfer.Amount)
+			}
+		case <-sub.Err():
+			return
+		}
+	}
+}
+
 // ServiceURI checking steps:
 // If passed in via -serviceAddr: return that
 // Else: get inferred address.
@@ -807,6 +1909,20 @@ func setupOrchestrator(ctx context.Context, n *core.LivepeerNode, initializeRoun
 	return nil
 }
 
+// sharedRecipientSecret derives the PM recipient secret from a signature of the ETH account and from
+// the redeemer secret, so that the redeemer and the frontends of the account have the same secret.
+// The recipient secret is rotated by changing the redeemer secret of every node, in which case the
+// tickets sent with the ticket params of the previous secret are no longer accepted
+func sharedRecipientSecret(client eth.LivepeerEthClient, redeemerSecret string) ([32]byte, error) {
+	var secret [32]byte
+	sig, err := client.Sign([]byte("Livepeer PM recipient secret"))
+	if err != nil {
+		return secret, err
+	}
+	copy(secret[:], crypto.Keccak256(sig, []byte(redeemerSecret)))
+	return secret, nil
+}
+
 func defaultAddr(addr, defaultHost, defaultPort string) string {
 	if addr == "" {
 		return defaultHost + ":" + defaultPort
@@ -820,3 +1936,21 @@ func defaultAddr(addr, defaultHost, defaultPort string) string {
 	}
 	return addr
 }
+
+// keystoreDirectory returns the directory of the keystore of the ETH account of the node
+func keystoreDirectory(datadir, ethKeystorePath string) string {
+	if _, err := os.Stat(ethKeystorePath); !os.IsNotExist(err) {
+		dir, _ := filepath.Split(ethKeystorePath)
+		return dir
+	}
+	return filepath.Join(datadir, "keystore")
+}
+
+// isLoopback returns true if host is a loopback address or localhost
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := gonet.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	gonet "net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/eth"
+)
+
+// preflightTimeout bounds each of the preflight checks that reach a remote service
+var preflightTimeout = 10 * time.Second
+
+// networkChainIDs are the chain IDs of the networks that -network has defaults for
+var networkChainIDs = map[string]int64{
+	"mainnet": 1,
+	"rinkeby": 4,
+}
+
+// preflightConfig is the configuration of the node that is checked before it starts
+type preflightConfig struct {
+	network       string
+	ethURL        string
+	ethReadURL    string
+	ethController string
+	ethAcctAddr   string
+	ethPassword   string
+	keystoreDir   string
+
+	s3Bucket string
+	s3Creds  string
+	gsBucket string
+	gsKey    string
+
+	// Service address of an orchestrator, if set with -serviceAddr
+	serviceAddr string
+	// Addresses that the node listens on, by the flag that sets them
+	listenAddrs map[string]string
+}
+
+// preflightFailure is a check of the configuration that failed, with how to fix it
+type preflightFailure struct {
+	check string
+	err   error
+	fix   string
+}
+
+func (f *preflightFailure) Error() string {
+	return fmt.Sprintf("%v: %v. %v", f.check, f.err, f.fix)
+}
+
+// preflight checks the whole configuration of the node before it starts, so that a misconfigured
+// node fails before it starts partially. It returns every failed check, and logs the checks that
+// can't tell a misconfiguration apart from the network of the node as warnings
+func preflight(cfg preflightConfig) []error {
+	var failures []error
+	fail := func(f *preflightFailure) {
+		if f != nil {
+			failures = append(failures, f)
+		}
+	}
+
+	for flag, addr := range cfg.listenAddrs {
+		fail(checkPortFree(flag, addr))
+	}
+	fail(checkStorage(cfg))
+	if cfg.network != "offchain" {
+		fail(checkEthRPC(cfg))
+		fail(checkKeystore(cfg))
+	}
+	if cfg.serviceAddr != "" {
+		fail(checkServiceAddr(cfg.serviceAddr, cfg.listenAddrs["-httpAddr"]))
+	}
+	return failures
+}
+
+// checkPortFree fails if the address that a flag sets can't be listened on
+func checkPortFree(flag, addr string) *preflightFailure {
+	l, err := gonet.Listen("tcp", addr)
+	if err != nil {
+		return &preflightFailure{
+			check: "listen on " + flag,
+			err:   err,
+			fix:   fmt.Sprintf("Stop the process that uses %v or set %v to a free address", addr, flag),
+		}
+	}
+	l.Close()
+	return nil
+}
+
+// checkStorage fails if the object storage flags are incomplete or if their credentials can't
+// save data to the bucket
+func checkStorage(cfg preflightConfig) *preflightFailure {
+	var (
+		storage drivers.OSDriver
+		flag    string
+	)
+	switch {
+	case cfg.s3Bucket != "" || cfg.s3Creds != "":
+		flag = "-s3bucket"
+		br, cr := strings.Split(cfg.s3Bucket, "/"), strings.Split(cfg.s3Creds, "/")
+		if len(br) != 2 || br[0] == "" || br[1] == "" {
+			return &preflightFailure{check: "object storage", err: fmt.Errorf("invalid -s3bucket %q", cfg.s3Bucket), fix: "Set -s3bucket as region/bucket, e.g. eu-central-1/testbucket"}
+		}
+		if len(cr) != 2 || cr[0] == "" || cr[1] == "" {
+			return &preflightFailure{check: "object storage", err: errors.New("invalid -s3creds"), fix: "Set -s3creds as ACCESSKEYID/ACCESSKEY"}
+		}
+		storage = drivers.NewS3Driver(br[0], br[1], cr[0], cr[1])
+	case cfg.gsBucket != "" || cfg.gsKey != "":
+		flag = "-gsbucket"
+		if cfg.gsBucket == "" || cfg.gsKey == "" {
+			return &preflightFailure{check: "object storage", err: errors.New("incomplete Google Storage flags"), fix: "Set both -gsbucket and -gskey"}
+		}
+		var err error
+		if storage, err = drivers.NewGoogleDriver(cfg.gsBucket, cfg.gsKey); err != nil {
+			return &preflightFailure{check: "object storage", err: err, fix: "Set -gskey to the JSON key file of a service account of the project of -gsbucket"}
+		}
+	default:
+		return nil
+	}
+
+	name := fmt.Sprintf("preflight-%d", time.Now().UnixNano())
+	sess := storage.NewSession("preflight")
+	uri, err := sess.SaveData(name, []byte("livepeer preflight check"))
+	if err != nil {
+		return &preflightFailure{
+			check: "object storage",
+			err:   fmt.Errorf("saving a test object failed: %v", err),
+			fix:   fmt.Sprintf("Check that the credentials of %v are valid and allowed to write to the bucket", flag),
+		}
+	}
+	// Only the S3 driver deletes data
+	if pruner, ok := drivers.StoragePruner(storage); ok && flag == "-s3bucket" {
+		if err := pruner.DeleteData([]string{"preflight/" + name}); err != nil {
+			glog.Warningf("Could not delete the preflight test object %v: %v", uri, err)
+		}
+	}
+	return nil
+}
+
+// checkEthRPC fails if an ETH RPC endpoint can't be reached or if it is on another chain than
+// the network of the node
+func checkEthRPC(cfg preflightConfig) *preflightFailure {
+	if len(splitURLs(cfg.ethURL)) == 0 {
+		return &preflightFailure{check: "ETH RPC", err: errors.New("no -ethUrl"), fix: "Set -ethUrl to the RPC endpoint of an ETH node of the network"}
+	}
+	if cfg.ethController == "" {
+		return &preflightFailure{check: "ETH RPC", err: errors.New("no -ethController"), fix: fmt.Sprintf("Set -ethController to the address of the Controller contract of the %v network", cfg.network)}
+	}
+	urls, readURLs := splitURLs(cfg.ethURL), splitURLs(cfg.ethReadURL)
+	if len(urls) > 1 || len(readURLs) > 0 {
+		if _, err := eth.NewRPCEndpoints(urls, readURLs, preflightTimeout); err != nil {
+			return &preflightFailure{check: "ETH RPC", err: err, fix: "Use http(s):// URLs of ETH nodes for several endpoints in -ethUrl and for -ethReadUrl"}
+		}
+	}
+	for _, u := range urls {
+		if f := checkEthEndpoint(cfg.network, "-ethUrl", u); f != nil {
+			return f
+		}
+	}
+	for _, u := range readURLs {
+		if f := checkEthEndpoint(cfg.network, "-ethReadUrl", u); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+// checkEthEndpoint fails if the ETH RPC endpoint of flag can't be reached or if it is on another
+// chain than network
+func checkEthEndpoint(network, flag, ethURL string) *preflightFailure {
+	ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+	defer cancel()
+	client, err := ethclient.DialContext(ctx, ethURL)
+	if err != nil {
+		return &preflightFailure{check: "ETH RPC", err: err, fix: fmt.Sprintf("Check that %v is a valid http(s):// or ws(s):// URL of an ETH node", flag)}
+	}
+	defer client.Close()
+	chainID, err := client.NetworkID(ctx)
+	if err != nil {
+		return &preflightFailure{check: "ETH RPC", err: err, fix: fmt.Sprintf("Check that the ETH node of %v is up and reachable from this host, and that its API key is valid", flag)}
+	}
+	if expected, ok := networkChainIDs[network]; ok && chainID.Int64() != expected {
+		return &preflightFailure{
+			check: "ETH RPC",
+			err:   fmt.Errorf("%v is on chain %v but the %v network is on chain %v", flag, chainID, network, expected),
+			fix:   fmt.Sprintf("Set %v to an ETH node of %v or set -network to the network of the ETH node", flag, network),
+		}
+	}
+	return nil
+}
+
+// checkKeystore fails if the ETH account of the node is not in the keystore or if -ethPassword
+// doesn't unlock it. Without -ethPassword, the node asks for the passphrase when it starts. A
+// new account is created if the keystore is empty
+func checkKeystore(cfg preflightConfig) *preflightFailure {
+	if cfg.keystoreDir == "" {
+		return &preflightFailure{check: "ETH keystore", err: errors.New("no keystore directory"), fix: "Set -ethKeystorePath to the keystore directory or key file of the ETH account"}
+	}
+	if _, err := os.Stat(cfg.keystoreDir); os.IsNotExist(err) {
+		return nil
+	}
+	ks := keystore.NewKeyStore(cfg.keystoreDir, keystore.StandardScryptN, keystore.StandardScryptP)
+	accounts := ks.Accounts()
+	if len(accounts) == 0 {
+		return nil
+	}
+	acct := accounts[0]
+	if cfg.ethAcctAddr != "" {
+		addr := ethcommon.HexToAddress(cfg.ethAcctAddr)
+		found := false
+		for _, a := range accounts {
+			if a.Address == addr {
+				acct, found = a, true
+				break
+			}
+		}
+		if !found {
+			return &preflightFailure{
+				check: "ETH keystore",
+				err:   fmt.Errorf("account %v is not in %v", addr.Hex(), cfg.keystoreDir),
+				fix:   "Set -ethAcctAddr to an account of the keystore or -ethKeystorePath to the keystore of the account",
+			}
+		}
+	}
+	if cfg.ethPassword == "" {
+		return nil
+	}
+	keyJSON, err := ioutil.ReadFile(acct.URL.Path)
+	if err == nil {
+		_, err = keystore.DecryptKey(keyJSON, cfg.ethPassword)
+	}
+	if err != nil {
+		return &preflightFailure{
+			check: "ETH keystore",
+			err:   fmt.Errorf("cannot unlock account %v: %v", acct.Address.Hex(), err),
+			fix:   "Set -ethPassword to the passphrase of the account",
+		}
+	}
+	return nil
+}
+
+// checkServiceAddr fails if the host of the service address of an orchestrator doesn't resolve.
+// It also warns if the service address doesn't reach httpAddr, which may be due to NAT
+func checkServiceAddr(serviceAddr, httpAddr string) *preflightFailure {
+	uri, err := url.ParseRequestURI("https://" + serviceAddr)
+	if err != nil || uri.Hostname() == "" {
+		return &preflightFailure{check: "service address", err: fmt.Errorf("invalid -serviceAddr %q", serviceAddr), fix: "Set -serviceAddr to the host:port that broadcasters reach the orchestrator at"}
+	}
+	resolver := &gonet.Resolver{}
+	ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+	defer cancel()
+	if _, err := resolver.LookupHost(ctx, uri.Hostname()); err != nil {
+		return &preflightFailure{
+			check: "service address",
+			err:   fmt.Errorf("cannot resolve the host of -serviceAddr: %v", err),
+			fix:   "Set -serviceAddr to a public IP or a hostname with a DNS record",
+		}
+	}
+	if httpAddr == "" {
+		return nil
+	}
+
+	l, err := gonet.Listen("tcp", httpAddr)
+	if err != nil {
+		// The port is reported by checkPortFree
+		return nil
+	}
+	defer l.Close()
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+	port := uri.Port()
+	if port == "" {
+		port = RpcPort
+	}
+	conn, err := gonet.DialTimeout("tcp", gonet.JoinHostPort(uri.Hostname(), port), preflightTimeout)
+	if err != nil {
+		glog.Warningf("The service address %v doesn't reach -httpAddr %v from this host: %v. Check that the port is forwarded and open in the firewall if broadcasters can't reach the orchestrator", serviceAddr, httpAddr, err)
+		return nil
+	}
+	conn.Close()
+	return nil
+}
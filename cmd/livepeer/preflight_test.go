@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	gonet "net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreflight_Ports(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l, err := gonet.Listen("tcp", "127.0.0.1:0")
+	require.Nil(err)
+	defer l.Close()
+
+	assert.Nil(checkPortFree("-cliAddr", "127.0.0.1:0"))
+	f := checkPortFree("-cliAddr", l.Addr().String())
+	require.NotNil(f)
+	assert.Contains(f.Error(), "listen on -cliAddr")
+	assert.Contains(f.Error(), "set -cliAddr to a free address")
+
+	failures := preflight(preflightConfig{network: "offchain", listenAddrs: map[string]string{"-httpAddr": l.Addr().String(), "-cliAddr": "127.0.0.1:0"}})
+	assert.Len(failures, 1)
+}
+
+func TestPreflight_Storage(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(checkStorage(preflightConfig{}))
+
+	f := checkStorage(preflightConfig{s3Bucket: "testbucket", s3Creds: "foo/bar"})
+	assert.Contains(f.Error(), `invalid -s3bucket "testbucket"`)
+	f = checkStorage(preflightConfig{s3Bucket: "eu-central-1/testbucket", s3Creds: "foo"})
+	assert.Contains(f.Error(), "invalid -s3creds")
+	// Secrets are not logged
+	assert.NotContains(f.Error(), "foo")
+	f = checkStorage(preflightConfig{s3Creds: "foo/bar"})
+	assert.Contains(f.Error(), "invalid -s3bucket")
+
+	f = checkStorage(preflightConfig{gsBucket: "testbucket"})
+	assert.Contains(f.Error(), "Set both -gsbucket and -gskey")
+	f = checkStorage(preflightConfig{gsBucket: "testbucket", gsKey: "/no/such/key.json"})
+	assert.Contains(f.Error(), "Set -gskey to the JSON key file")
+}
+
+// ethRPCServer answers the net_version calls of checkEthRPC with chainID
+func ethRPCServer(chainID int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Method != "net_version" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":"%d"}`, req.ID, chainID)
+	}))
+}
+
+func TestPreflight_EthRPC(t *testing.T) {
+	assert := assert.New(t)
+
+	rinkeby := ethRPCServer(4)
+	defer rinkeby.Close()
+
+	cfg := preflightConfig{network: "rinkeby", ethURL: rinkeby.URL, ethController: "0x37dC71366Ec655093b9930bc816E16e6b587F968"}
+	assert.Nil(checkEthRPC(cfg))
+
+	cfg.network = "mainnet"
+	f := checkEthRPC(cfg)
+	assert.Contains(f.Error(), "-ethUrl is on chain 4 but the mainnet network is on chain 1")
+
+	// The chain of networks without defaults is not known
+	cfg.network = "devenv"
+	assert.Nil(checkEthRPC(cfg))
+
+	cfg.ethController = ""
+	f = checkEthRPC(cfg)
+	assert.Contains(f.Error(), "no -ethController")
+	cfg.ethURL = ""
+	f = checkEthRPC(cfg)
+	assert.Contains(f.Error(), "no -ethUrl")
+
+	down := ethRPCServer(4)
+	down.Close()
+	f = checkEthRPC(preflightConfig{network: "rinkeby", ethURL: down.URL, ethController: "0x37dC71366Ec655093b9930bc816E16e6b587F968"})
+	assert.Contains(f.Error(), "Check that the ETH node of -ethUrl is up")
+
+	// Every endpoint is checked
+	mainnet := ethRPCServer(1)
+	defer mainnet.Close()
+	cfg = preflightConfig{network: "rinkeby", ethURL: rinkeby.URL + "," + rinkeby.URL, ethReadURL: mainnet.URL, ethController: "0x37dC71366Ec655093b9930bc816E16e6b587F968"}
+	f = checkEthRPC(cfg)
+	assert.Contains(f.Error(), "-ethReadUrl is on chain 1 but the rinkeby network is on chain 4")
+	cfg.ethReadURL = rinkeby.URL
+	assert.Nil(checkEthRPC(cfg))
+	cfg.ethURL = rinkeby.URL + ",wss://localhost:8546"
+	f = checkEthRPC(cfg)
+	assert.Contains(f.Error(), "Use http(s):// URLs of ETH nodes")
+}
+
+func TestPreflight_Keystore(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "livepeer-preflight-test")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// Accounts are created in new and empty keystores
+	assert.Nil(checkKeystore(preflightConfig{keystoreDir: dir + "/keystore"}))
+	assert.Nil(checkKeystore(preflightConfig{keystoreDir: dir}))
+
+	ks := keystore.NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	acct, err := ks.NewAccount("foo")
+	require.Nil(err)
+
+	assert.Nil(checkKeystore(preflightConfig{keystoreDir: dir}))
+	assert.Nil(checkKeystore(preflightConfig{keystoreDir: dir, ethAcctAddr: acct.Address.Hex(), ethPassword: "foo"}))
+
+	other := ethcommon.HexToAddress("0x0000000000000000000000000000000000000001")
+	f := checkKeystore(preflightConfig{keystoreDir: dir, ethAcctAddr: other.Hex()})
+	assert.Contains(f.Error(), fmt.Sprintf("account %v is not in %v", other.Hex(), dir))
+
+	f = checkKeystore(preflightConfig{keystoreDir: dir, ethPassword: "bar"})
+	assert.Contains(f.Error(), "cannot unlock account "+acct.Address.Hex())
+	assert.Contains(f.Error(), "Set -ethPassword")
+}
+
+func TestPreflight_ServiceAddr(t *testing.T) {
+	assert := assert.New(t)
+
+	f := checkServiceAddr("hi\b\bbye", "")
+	assert.Contains(f.Error(), "invalid -serviceAddr")
+	f = checkServiceAddr("foo.invalid:8935", "")
+	assert.Contains(f.Error(), "cannot resolve the host of -serviceAddr")
+
+	// Service addresses that don't reach the node are only warned about
+	assert.Nil(checkServiceAddr("127.0.0.1:8935", "127.0.0.1:0"))
+	assert.Nil(checkServiceAddr("127.0.0.1:8935", ""))
+}
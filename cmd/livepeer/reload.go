@@ -0,0 +1,282 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+
+	"github.com/livepeer/go-livepeer/clog"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/server"
+)
+
+// reloadableSetting is a group of flags whose values are applied together when the config file is
+// reloaded
+type reloadableSetting struct {
+	flags []string
+	// Set if the values of the flags are not logged
+	secret bool
+	// Applies the values of the flags, given their values before the reload
+	apply func(old map[string]string) error
+}
+
+// configReloader applies the changes of the reloadable settings of the config file of the node
+// when it is reloaded. The other settings require a restart
+type configReloader struct {
+	fs   *flag.FlagSet
+	path string
+	// Flags set on the command line, which override the config file
+	explicit map[string]bool
+	// Values of the config file when the node started
+	loaded   map[string]string
+	settings []reloadableSetting
+}
+
+// newConfigReloader creates a configReloader of the config file that the flags of fs were loaded
+// from. explicit are the flags that were set on the command line
+func newConfigReloader(fs *flag.FlagSet, path string, explicit map[string]bool) (*configReloader, error) {
+	loaded, err := readConfigFile(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	return &configReloader{fs: fs, path: path, explicit: explicit, loaded: loaded}, nil
+}
+
+// register adds a reloadable setting
+func (c *configReloader) register(setting reloadableSetting) {
+	c.settings = append(c.settings, setting)
+}
+
+// reload re-reads the config file and applies the settings whose values changed. A reloadable
+// flag that is no longer in the file is reset to its default. Settings that fail to apply keep
+// their previous values. It returns the names of the flags that changed
+func (c *configReloader) reload() ([]string, error) {
+	values, err := readConfigFile(c.fs, c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	reloadable := make(map[string]bool)
+	var changed, errs []string
+	for _, setting := range c.settings {
+		old := make(map[string]string)
+		var changedFlags []string
+		var err error
+		for _, name := range setting.flags {
+			reloadable[name] = true
+			f := c.fs.Lookup(name)
+			if f == nil || c.explicit[name] {
+				continue
+			}
+			value, ok := values[name]
+			if !ok {
+				value = f.DefValue
+			}
+			old[name] = f.Value.String()
+			if value == old[name] || err != nil {
+				continue
+			}
+			if err = c.fs.Set(name, value); err != nil {
+				// Flags may be reset when their value fails to parse
+				c.fs.Set(name, old[name])
+				err = fmt.Errorf("%v: %v", name, err)
+				continue
+			}
+			changedFlags = append(changedFlags, name)
+		}
+		if err == nil && len(changedFlags) > 0 {
+			err = setting.apply(old)
+		}
+		if err != nil {
+			// Keep the previous values of the setting
+			for _, name := range changedFlags {
+				c.fs.Set(name, old[name])
+			}
+			errs = append(errs, err.Error())
+			continue
+		}
+		for _, name := range changedFlags {
+			if setting.secret {
+				glog.Infof("Reloaded setting %v", name)
+			} else {
+				glog.Infof("Reloaded setting %v old=%q new=%q", name, old[name], c.fs.Lookup(name).Value.String())
+			}
+		}
+		changed = append(changed, changedFlags...)
+	}
+
+	for _, name := range sortedKeys(values) {
+		if reloadable[name] || c.explicit[name] {
+			continue
+		}
+		if loaded, ok := c.loaded[name]; !ok || loaded != values[name] {
+			glog.Warningf("Changed setting %v is applied when the node restarts", name)
+		}
+	}
+	for _, name := range sortedKeys(c.loaded) {
+		if _, ok := values[name]; !ok && !reloadable[name] && !c.explicit[name] {
+			glog.Warningf("Removed setting %v is applied when the node restarts", name)
+		}
+	}
+	sort.Strings(changed)
+	if len(errs) > 0 {
+		return changed, fmt.Errorf("invalid config file %v: %v", c.path, strings.Join(errs, "; "))
+	}
+	return changed, nil
+}
+
+func (c *configReloader) value(name string) string {
+	return c.fs.Lookup(name).Value.String()
+}
+
+// intValue returns the value of an int flag
+func (c *configReloader) intValue(name string) int64 {
+	v, _ := strconv.ParseInt(c.value(name), 10, 64)
+	return v
+}
+
+// registerReloadableSettings registers the settings of the node that can change while it is
+// running: its log levels, its prices, its webhooks and its orchestrator lists
+func registerReloadableSettings(c *configReloader, n *core.LivepeerNode, vFlag *flag.Flag) {
+	c.register(reloadableSetting{
+		flags: []string{"v", "logLevels"},
+		apply: func(old map[string]string) error {
+			if err := clog.SetLevels(c.value("logLevels")); err != nil {
+				return err
+			}
+			current := logLevelModules(c.value("logLevels"))
+			for module := range logLevelModules(old["logLevels"]) {
+				if !current[module] {
+					clog.SetLevel(module, -1)
+				}
+			}
+			return vFlag.Value.Set(c.value("v"))
+		},
+	})
+
+	switch n.NodeType {
+	case core.BroadcasterNode:
+		c.register(reloadableSetting{
+			flags: []string{"maxPricePerUnit", "pixelsPerUnit"},
+			apply: func(old map[string]string) error {
+				maxPricePerUnit := c.intValue("maxPricePerUnit")
+				pixelsPerUnit := c.intValue("pixelsPerUnit")
+				if pixelsPerUnit <= 0 {
+					return fmt.Errorf("pixels per unit must be greater than 0, provided %d", pixelsPerUnit)
+				}
+				if maxPricePerUnit > 0 {
+					server.BroadcastCfg.SetMaxPrice(big.NewRat(maxPricePerUnit, pixelsPerUnit))
+				} else {
+					server.BroadcastCfg.SetMaxPrice(nil)
+				}
+				return nil
+			},
+		})
+		c.register(reloadableSetting{
+			flags: []string{"authWebhookUrl"},
+			apply: func(old map[string]string) error {
+				u, err := getAuthWebhookURL(c.value("authWebhookUrl"))
+				if err == nil {
+					server.AuthWebhookURL = u
+				}
+				return err
+			},
+		})
+		c.register(reloadableSetting{
+			flags:  []string{"streamEventWebhookUrl", "streamEventWebhookSecret"},
+			secret: true,
+			apply: func(old map[string]string) error {
+				if server.StreamEvents == nil || c.value("streamEventWebhookUrl") == "" {
+					return errors.New("enabling or disabling stream events requires a restart")
+				}
+				u, err := getWebhookURL("stream event", c.value("streamEventWebhookUrl"))
+				if err == nil {
+					server.StreamEvents.SetWebhook(u, c.value("streamEventWebhookSecret"))
+				}
+				return err
+			},
+		})
+		c.register(reloadableSetting{
+			flags: []string{"selectionWebhookUrl"},
+			apply: func(old map[string]string) error {
+				server.SelectionWebhookURL = c.value("selectionWebhookUrl")
+				// The webhook strategy is recreated with the new URL
+				if strategy := server.SelectionStrategy(); strategy != "" {
+					return server.SetSelectionStrategy(strategy, n)
+				}
+				return nil
+			},
+		})
+		if n.OrchLists != nil {
+			for _, l := range []struct{ flag, list string }{{"orchAllowlist", core.OrchAllowlist}, {"orchDenylist", core.OrchDenylist}} {
+				l := l
+				c.register(reloadableSetting{
+					flags: []string{l.flag},
+					apply: func(old map[string]string) error {
+						return reloadOrchList(n.OrchLists, l.list, old[l.flag], c.value(l.flag))
+					},
+				})
+			}
+		}
+	case core.OrchestratorNode:
+		c.register(reloadableSetting{
+			flags: []string{"pricePerUnit", "pixelsPerUnit"},
+			apply: func(old map[string]string) error {
+				pricePerUnit := c.intValue("pricePerUnit")
+				pixelsPerUnit := c.intValue("pixelsPerUnit")
+				if pixelsPerUnit <= 0 || pricePerUnit <= 0 {
+					return fmt.Errorf("price per unit and pixels per unit must be greater than 0, provided %d and %d", pricePerUnit, pixelsPerUnit)
+				}
+				n.SetBasePrice(big.NewRat(pricePerUnit, pixelsPerUnit))
+				return nil
+			},
+		})
+	}
+}
+
+// logLevelModules returns the modules of a list of module=level pairs
+func logLevelModules(levels string) map[string]bool {
+	modules := make(map[string]bool)
+	for _, entry := range strings.Split(levels, ",") {
+		if kv := strings.SplitN(strings.TrimSpace(entry), "=", 2); kv[0] != "" {
+			modules[kv[0]] = true
+		}
+	}
+	return modules
+}
+
+// reloadOrchList adds the patterns of an orchestrator list flag that were added to the config file
+// to the list kept in the DB, and removes the patterns that were removed from the file
+func reloadOrchList(lists *core.OrchestratorLists, list, oldPatterns, newPatterns string) error {
+	patterns := func(s string) map[string]bool {
+		set := make(map[string]bool)
+		for _, p := range strings.Split(s, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				set[p] = true
+			}
+		}
+		return set
+	}
+	old, current := patterns(oldPatterns), patterns(newPatterns)
+	for p := range current {
+		if !old[p] {
+			if err := lists.Add(list, p); err != nil {
+				return err
+			}
+		}
+	}
+	for p := range old {
+		if !current[p] {
+			if _, err := lists.Remove(list, p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
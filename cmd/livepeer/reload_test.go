@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+)
+
+func TestConfigReloader(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	dir, err := ioutil.TempDir("", "config")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "livepeer.yaml", "network: rinkeby\nmaxSessions: 20\n")
+	fs, network, maxSessions, orchestrator, _ := newConfigTestFlags()
+	require.Nil(fs.Parse([]string{"-config", path, "-orchestrator"}))
+	explicit := setFlags(fs)
+	require.Nil(loadConfigFile(fs, path))
+	reloader, err := newConfigReloader(fs, path, explicit)
+	require.Nil(err)
+
+	var applied []map[string]string
+	var applyErr error
+	reloader.register(reloadableSetting{
+		flags: []string{"maxSessions", "orchestrator"},
+		apply: func(old map[string]string) error {
+			applied = append(applied, old)
+			return applyErr
+		},
+	})
+
+	// Unchanged settings are not applied
+	changed, err := reloader.reload()
+	require.Nil(err)
+	assert.Empty(changed)
+	assert.Empty(applied)
+
+	// Changes of settings that are not reloadable are not applied, and flags set on the command
+	// line are not overridden
+	writeConfigFile(t, dir, "livepeer.yaml", "network: mainnet\nmaxSessions: 30\norchestrator: false\n")
+	changed, err = reloader.reload()
+	require.Nil(err)
+	assert.Equal([]string{"maxSessions"}, changed)
+	assert.Equal([]map[string]string{{"maxSessions": "20"}}, applied)
+	assert.Equal(30, *maxSessions)
+	assert.Equal("rinkeby", *network)
+	assert.True(*orchestrator)
+
+	// Settings that fail to apply keep their previous values
+	applyErr = errors.New("not applied")
+	writeConfigFile(t, dir, "livepeer.yaml", "network: rinkeby\nmaxSessions: 40\n")
+	_, err = reloader.reload()
+	assert.Contains(err.Error(), "not applied")
+	assert.Equal(30, *maxSessions)
+
+	writeConfigFile(t, dir, "livepeer.yaml", "maxSessions: many\n")
+	_, err = reloader.reload()
+	assert.Contains(err.Error(), "maxSessions: parse error")
+	assert.Equal(30, *maxSessions)
+
+	// Settings removed from the file are reset to their defaults
+	applyErr = nil
+	writeConfigFile(t, dir, "livepeer.yaml", "network: rinkeby\n")
+	changed, err = reloader.reload()
+	require.Nil(err)
+	assert.Equal([]string{"maxSessions"}, changed)
+	assert.Equal(10, *maxSessions)
+
+	writeConfigFile(t, dir, "livepeer.yaml", "maxSessions: [\n")
+	_, err = reloader.reload()
+	assert.Contains(err.Error(), "invalid config file")
+}
+
+func TestReloadOrchList(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	dir, err := ioutil.TempDir("", "orchlists")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	dbh, err := common.InitDB(filepath.Join(dir, "lp.sqlite3"))
+	require.Nil(err)
+	defer dbh.Close()
+	lists, err := core.NewOrchestratorLists(dbh)
+	require.Nil(err)
+
+	a, b := "https://a.example.com:8935", "https://b.example.com:8935"
+	require.Nil(reloadOrchList(lists, core.OrchAllowlist, "", a))
+	assert.Equal([]string{a}, lists.Lists()[core.OrchAllowlist])
+	require.Nil(reloadOrchList(lists, core.OrchAllowlist, a, " "+b+" "))
+	assert.Equal([]string{b}, lists.Lists()[core.OrchAllowlist])
+	assert.Error(reloadOrchList(lists, core.OrchAllowlist, b, b+",https://[.example.com"))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"math/big"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/go-livepeer/server"
+)
+
+// warmDiscoveryTTL is how long the orchestrator infos that are primed when the node starts are
+// used if they are not refreshed with -discoveryCacheRefresh
+var warmDiscoveryTTL = time.Minute
+
+// warmPMSessionOrchs is the number of most used orchestrators that PM sessions are started with
+const warmPMSessionOrchs = 10
+
+// warmSendersWindow is how recently senders must have sent a winning ticket for their reserves to
+// be fetched when the node starts
+const warmSendersWindow = 24 * time.Hour
+
+// primedPool is a pool of orchestrators whose infos can be requested ahead of the streams
+type primedPool interface {
+	net.OrchestratorPool
+	Prime(maxAge time.Duration)
+}
+
+// warmBroadcaster requests the infos of the orchestrators of pool, which are used for maxAge, and
+// starts PM sessions with the orchestrators that the broadcaster used the most
+func warmBroadcaster(n *core.LivepeerNode, pool primedPool, maxAge time.Duration) {
+	start := time.Now()
+	pool.Prime(maxAge)
+	infos, err := pool.GetOrchestrators(pool.Size())
+	if err != nil {
+		glog.Errorf("Error warming orchestrator infos: %v", err)
+		return
+	}
+	sessions := server.WarmPMSessions(n, infos, warmPMSessionOrchs)
+	glog.Infof("Warmed caches orchestrators=%d pmSessions=%d took=%v", len(infos), sessions, time.Since(start))
+}
+
+type ticketSenderStore interface {
+	TicketSenders(since int64) ([]ethcommon.Address, error)
+}
+
+type reserveCache interface {
+	MaxFloat(addr ethcommon.Address) (*big.Int, error)
+}
+
+// warmSenderReserves fetches the reserves of the senders that sent winning tickets to the
+// orchestrator within window, so that their first tickets after a restart don't wait for them.
+// Returns the number of senders whose reserves were fetched
+func warmSenderReserves(db ticketSenderStore, sm reserveCache, window time.Duration) int {
+	start := time.Now()
+	senders, err := db.TicketSenders(start.Add(-window).Unix())
+	if err != nil {
+		glog.Errorf("Error warming sender reserves: %v", err)
+		return 0
+	}
+	warmed := 0
+	for _, sender := range senders {
+		if _, err := sm.MaxFloat(sender); err != nil {
+			glog.Warningf("Error fetching reserve sender=%v: %v", monitor.RedactAddress(sender), err)
+			continue
+		}
+		warmed++
+	}
+	glog.Infof("Warmed sender reserves senders=%d took=%v", warmed, time.Since(start))
+	return warmed
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+type stubPrimedPool struct {
+	infos  []*net.OrchestratorInfo
+	maxAge time.Duration
+	primed bool
+}
+
+func (p *stubPrimedPool) GetURLs() []*url.URL { return nil }
+func (p *stubPrimedPool) Size() int           { return len(p.infos) }
+func (p *stubPrimedPool) GetOrchestrators(n int) ([]*net.OrchestratorInfo, error) {
+	return p.infos, nil
+}
+func (p *stubPrimedPool) Prime(maxAge time.Duration) {
+	p.primed, p.maxAge = true, maxAge
+}
+
+func TestWarmBroadcaster(t *testing.T) {
+	assert := assert.New(t)
+
+	pool := &stubPrimedPool{infos: []*net.OrchestratorInfo{{Transcoder: "o1"}}}
+	// Offchain broadcasters only prime the infos
+	warmBroadcaster(&core.LivepeerNode{}, pool, time.Minute)
+	assert.True(pool.primed)
+	assert.Equal(time.Minute, pool.maxAge)
+}
+
+type stubTicketSenderStore struct {
+	senders []ethcommon.Address
+	since   int64
+	err     error
+}
+
+func (s *stubTicketSenderStore) TicketSenders(since int64) ([]ethcommon.Address, error) {
+	s.since = since
+	return s.senders, s.err
+}
+
+type stubReserveCache struct {
+	fetched []ethcommon.Address
+	err     map[ethcommon.Address]error
+}
+
+func (c *stubReserveCache) MaxFloat(addr ethcommon.Address) (*big.Int, error) {
+	c.fetched = append(c.fetched, addr)
+	return big.NewInt(0), c.err[addr]
+}
+
+func TestWarmSenderReserves(t *testing.T) {
+	assert := assert.New(t)
+
+	foo := ethcommon.HexToAddress("0x0000000000000000000000000000000000000001")
+	bar := ethcommon.HexToAddress("0x0000000000000000000000000000000000000002")
+	db := &stubTicketSenderStore{senders: []ethcommon.Address{foo, bar}}
+	sm := &stubReserveCache{err: map[ethcommon.Address]error{bar: errors.New("unreachable")}}
+
+	assert.Equal(1, warmSenderReserves(db, sm, time.Hour))
+	assert.Equal([]ethcommon.Address{foo, bar}, sm.fetched)
+	assert.InDelta(time.Now().Add(-time.Hour).Unix(), db.since, 1)
+
+	db.err = errors.New("db error")
+	assert.Zero(warmSenderReserves(db, sm, time.Hour))
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"bufio"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"net/http"
 	"os"
@@ -29,6 +32,18 @@ func main() {
 			Usage: "host for the Livepeer node",
 			Value: "localhost",
 		},
+		cli.StringFlag{
+			Name:  "token",
+			Usage: "token that authenticates to the node, if it requires one",
+		},
+		cli.BoolFlag{
+			Name:  "tls",
+			Usage: "connect to the node over HTTPS",
+		},
+		cli.StringFlag{
+			Name:  "cacert",
+			Usage: "CA certificate file (PEM) that the certificate of the node is verified with over HTTPS, e.g. the node's own self-signed certificate",
+		},
 		cli.IntFlag{
 			Name:  "loglevel",
 			Value: 4,
@@ -44,9 +59,20 @@ func main() {
 		log.Root().SetHandler(log.LvlFilterHandler(log.Lvl(c.Int("loglevel")), log.StreamHandler(os.Stdout, log.TerminalFormat(true))))
 		rand.Seed(time.Now().UnixNano())
 
+		scheme := "http"
+		if c.Bool("tls") {
+			scheme = "https"
+		}
+		transport, err := newNodeTransport(c.String("token"), c.String("cacert"))
+		if err != nil {
+			return err
+		}
+		http.DefaultClient.Transport = transport
+
 		// Start the wizard and relinquish control
 		w := &wizard{
-			endpoint: fmt.Sprintf("http://%v:%v/status", c.String("host"), c.String("http")),
+			endpoint: fmt.Sprintf("%v://%v:%v/status", scheme, c.String("host"), c.String("http")),
+			scheme:   scheme,
 			httpPort: c.String("http"),
 			host:     c.String("host"),
 			in:       bufio.NewReader(os.Stdin),
@@ -64,6 +90,7 @@ func main() {
 
 type wizard struct {
 	endpoint     string // Local livepeer node
+	scheme       string
 	httpPort     string
 	host         string
 	orchestrator bool
@@ -128,7 +155,7 @@ func (w *wizard) run() {
 	// Make sure there is a local node running
 	_, err := http.Get(w.endpoint)
 	if err != nil {
-		log.Error(fmt.Sprintf("Cannot find local node. Is your node running on http:%v?", w.httpPort))
+		log.Error(fmt.Sprintf("Cannot find local node. Is your node running on %v:%v?", w.scheme, w.httpPort))
 		return
 	}
 
@@ -170,7 +197,39 @@ var RinkebyNetworkId = "4"
 var DevenvNetworkId = "54321"
 
 func (w *wizard) checkNet() {
-	nID := httpGet(fmt.Sprintf("http://%v:%v/EthNetworkID", w.host, w.httpPort))
+	nID := httpGetValue(fmt.Sprintf("%v://%v:%v/EthNetworkID", w.scheme, w.host, w.httpPort), "networkID")
 	w.testnet = nID == RinkebyNetworkId || nID == DevenvNetworkId
 	w.offchain = nID == "offchain"
 }
+
+// nodeTransport authenticates the requests to the node with a token
+type nodeTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+// newNodeTransport creates a transport of the requests to the node that sends token, if set, and
+// verifies the node's certificate with the CA certificate of caFile, if set
+func newNodeTransport(token, caFile string) (http.RoundTripper, error) {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %v", caFile)
+		}
+		base.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return &nodeTransport{token: token, base: base}, nil
+}
+
+func (t *nodeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.token != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+	return t.base.RoundTrip(req)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -242,6 +243,25 @@ func httpGet(url string) string {
 
 }
 
+// httpGetValue gets the value of name from the JSON object of the response to url. The plain
+// text body is returned as is for the nodes that don't respond with JSON
+func httpGetValue(url, name string) string {
+	body := httpGet(url)
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &values); err != nil {
+		return body
+	}
+	raw, ok := values[name]
+	if !ok {
+		return ""
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		return str
+	}
+	return string(raw)
+}
+
 func httpPostWithParams(url string, val url.Values) string {
 	body := bytes.NewBufferString(val.Encode())
 
@@ -61,7 +61,7 @@ func (w *wizard) registeredOrchestratorStats() map[int]common.Address {
 }
 
 func (w *wizard) getRegisteredOrchestrators() ([]lpTypes.Transcoder, error) {
-	resp, err := http.Get(fmt.Sprintf("http://%v:%v/registeredOrchestrators", w.host, w.httpPort))
+	resp, err := http.Get(fmt.Sprintf("%v://%v:%v/registeredOrchestrators", w.scheme, w.host, w.httpPort))
 	if err != nil {
 		return nil, err
 	}
@@ -120,9 +120,9 @@ func (w *wizard) unbondingLockStats(withdrawable bool) map[int64]bool {
 func (w *wizard) getUnbondingLocks(withdrawable bool) ([]lpcommon.DBUnbondingLock, error) {
 	var url string
 	if withdrawable {
-		url = fmt.Sprintf("http://%v:%v/unbondingLocks?withdrawable=true", w.host, w.httpPort)
+		url = fmt.Sprintf("%v://%v:%v/unbondingLocks?withdrawable=true", w.scheme, w.host, w.httpPort)
 	} else {
-		url = fmt.Sprintf("http://%v:%v/unbondingLocks", w.host, w.httpPort)
+		url = fmt.Sprintf("%v://%v:%v/unbondingLocks", w.scheme, w.host, w.httpPort)
 	}
 	resp, err := http.Get(url)
 	if err != nil {
@@ -184,7 +184,7 @@ func (w *wizard) bond() {
 		"toAddr": {fmt.Sprintf("%v", tAddr.Hex())},
 	}
 
-	httpPostWithParams(fmt.Sprintf("http://%v:%v/bond", w.host, w.httpPort), val)
+	httpPostWithParams(fmt.Sprintf("%v://%v:%v/bond", w.scheme, w.host, w.httpPort), val)
 }
 
 func (w *wizard) rebond() {
@@ -244,7 +244,7 @@ func (w *wizard) rebond() {
 		val["toAddr"] = []string{fmt.Sprintf("%v", toAddr.Hex())}
 	}
 
-	httpPostWithParams(fmt.Sprintf("http://%v:%v/rebond", w.host, w.httpPort), val)
+	httpPostWithParams(fmt.Sprintf("%v://%v:%v/rebond", w.scheme, w.host, w.httpPort), val)
 }
 
 func (w *wizard) unbond() {
@@ -292,7 +292,7 @@ func (w *wizard) unbond() {
 		"amount": {fmt.Sprintf("%v", amount.String())},
 	}
 
-	httpPostWithParams(fmt.Sprintf("http://%v:%v/unbond", w.host, w.httpPort), val)
+	httpPostWithParams(fmt.Sprintf("%v://%v:%v/unbond", w.scheme, w.host, w.httpPort), val)
 }
 
 func (w *wizard) withdrawStake() {
@@ -329,11 +329,11 @@ func (w *wizard) withdrawStake() {
 		"unbondingLockId": {fmt.Sprintf("%v", strconv.FormatInt(unbondingLockID, 10))},
 	}
 
-	httpPostWithParams(fmt.Sprintf("http://%v:%v/withdrawStake", w.host, w.httpPort), val)
+	httpPostWithParams(fmt.Sprintf("%v://%v:%v/withdrawStake", w.scheme, w.host, w.httpPort), val)
 }
 
 func (w *wizard) withdrawFees() {
-	httpPost(fmt.Sprintf("http://%v:%v/withdrawFees", w.host, w.httpPort))
+	httpPost(fmt.Sprintf("%v://%v:%v/withdrawFees", w.scheme, w.host, w.httpPort))
 }
 
 func (w *wizard) claimRewardsAndFees() {
@@ -354,5 +354,5 @@ func (w *wizard) claimRewardsAndFees() {
 		"endRound": {fmt.Sprintf("%v", endRound.String())},
 	}
 
-	httpPostWithParams(fmt.Sprintf("http://%v:%v/claimEarnings", w.host, w.httpPort), val)
+	httpPostWithParams(fmt.Sprintf("%v://%v:%v/claimEarnings", w.scheme, w.host, w.httpPort), val)
 }
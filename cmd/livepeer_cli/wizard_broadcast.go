@@ -16,7 +16,7 @@ import (
 )
 
 func (w *wizard) allTranscodingOptions() map[int]string {
-	resp, err := http.Get(fmt.Sprintf("http://%v:%v/getAvailableTranscodingOptions", w.host, w.httpPort))
+	resp, err := http.Get(fmt.Sprintf("%v://%v:%v/getAvailableTranscodingOptions", w.scheme, w.host, w.httpPort))
 	if err != nil {
 		glog.Errorf("Error getting all transcoding options: %v", err)
 		return nil
@@ -80,7 +80,7 @@ func (w *wizard) setBroadcastConfig() {
 		"transcodingOptions": {fmt.Sprintf("%v", transOpts)},
 	}
 
-	httpPostWithParams(fmt.Sprintf("http://%v:%v/setBroadcastConfig", w.host, w.httpPort), val)
+	httpPostWithParams(fmt.Sprintf("%v://%v:%v/setBroadcastConfig", w.scheme, w.host, w.httpPort), val)
 }
 
 func (w *wizard) idListToVideoProfileList(idList string, opts map[int]string) (string, error) {
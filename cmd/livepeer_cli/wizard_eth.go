@@ -14,5 +14,5 @@ func (w *wizard) setGasPrice() {
 		"amount": {fmt.Sprintf("%v", amount.String())},
 	}
 
-	httpPostWithParams(fmt.Sprintf("http://%v:%v/setGasPrice", w.host, w.httpPort), val)
+	httpPostWithParams(fmt.Sprintf("%v://%v:%v/setGasPrice", w.scheme, w.host, w.httpPort), val)
 }
@@ -5,9 +5,9 @@ import (
 )
 
 func (w *wizard) currentRound() string {
-	return httpGet(fmt.Sprintf("http://%v:%v/currentRound", w.host, w.httpPort))
+	return httpGetValue(fmt.Sprintf("%v://%v:%v/currentRound", w.scheme, w.host, w.httpPort), "round")
 }
 
 func (w *wizard) initializeRound() {
-	httpPost(fmt.Sprintf("http://%v:%v/initializeRound", w.host, w.httpPort))
+	httpPost(fmt.Sprintf("%v://%v:%v/initializeRound", w.scheme, w.host, w.httpPort))
 }
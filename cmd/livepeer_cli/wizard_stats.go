@@ -265,7 +265,7 @@ func (w *wizard) delegatorStats() {
 }
 
 func (w *wizard) getProtocolParameters() (lpTypes.ProtocolParameters, error) {
-	resp, err := http.Get(fmt.Sprintf("http://%v:%v/protocolParameters", w.host, w.httpPort))
+	resp, err := http.Get(fmt.Sprintf("%v://%v:%v/protocolParameters", w.scheme, w.host, w.httpPort))
 	if err != nil {
 		return lpTypes.ProtocolParameters{}, err
 	}
@@ -287,7 +287,7 @@ func (w *wizard) getProtocolParameters() (lpTypes.ProtocolParameters, error) {
 }
 
 func (w *wizard) getContractAddresses() (map[string]common.Address, error) {
-	resp, err := http.Get(fmt.Sprintf("http://%v:%v/contractAddresses", w.host, w.httpPort))
+	resp, err := http.Get(fmt.Sprintf("%v://%v:%v/contractAddresses", w.scheme, w.host, w.httpPort))
 	if err != nil {
 		return nil, err
 	}
@@ -308,7 +308,7 @@ func (w *wizard) getContractAddresses() (map[string]common.Address, error) {
 }
 
 func (w *wizard) getEthAddr() string {
-	addr := httpGet(fmt.Sprintf("http://%v:%v/ethAddr", w.host, w.httpPort))
+	addr := httpGetValue(fmt.Sprintf("%v://%v:%v/ethAddr", w.scheme, w.host, w.httpPort), "address")
 	if addr == "" {
 		addr = "Unknown"
 	}
@@ -316,7 +316,7 @@ func (w *wizard) getEthAddr() string {
 }
 
 func (w *wizard) getTokenBalance() string {
-	b := httpGet(fmt.Sprintf("http://%v:%v/tokenBalance", w.host, w.httpPort))
+	b := httpGetValue(fmt.Sprintf("%v://%v:%v/tokenBalance", w.scheme, w.host, w.httpPort), "balance")
 	if b == "" {
 		b = "Unknown"
 	}
@@ -324,7 +324,7 @@ func (w *wizard) getTokenBalance() string {
 }
 
 func (w *wizard) getEthBalance() string {
-	e := httpGet(fmt.Sprintf("http://%v:%v/ethBalance", w.host, w.httpPort))
+	e := httpGetValue(fmt.Sprintf("%v://%v:%v/ethBalance", w.scheme, w.host, w.httpPort), "balance")
 	if e == "" {
 		e = "Unknown"
 	}
@@ -332,7 +332,7 @@ func (w *wizard) getEthBalance() string {
 }
 
 func (w *wizard) getBroadcastConfig() (*big.Rat, string) {
-	resp, err := http.Get(fmt.Sprintf("http://%v:%v/getBroadcastConfig", w.host, w.httpPort))
+	resp, err := http.Get(fmt.Sprintf("%v://%v:%v/getBroadcastConfig", w.scheme, w.host, w.httpPort))
 	if err != nil {
 		glog.Errorf("Error getting broadcast config: %v", err)
 		return nil, ""
@@ -359,7 +359,7 @@ func (w *wizard) getBroadcastConfig() (*big.Rat, string) {
 }
 
 func (w *wizard) getOrchestratorInfo() (*lpTypes.Transcoder, *big.Rat, error) {
-	resp, err := http.Get(fmt.Sprintf("http://%v:%v/orchestratorInfo", w.host, w.httpPort))
+	resp, err := http.Get(fmt.Sprintf("%v://%v:%v/orchestratorInfo", w.scheme, w.host, w.httpPort))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -384,7 +384,7 @@ func (w *wizard) getOrchestratorInfo() (*lpTypes.Transcoder, *big.Rat, error) {
 }
 
 func (w *wizard) getDelegatorInfo() (lpTypes.Delegator, error) {
-	resp, err := http.Get(fmt.Sprintf("http://%v:%v/delegatorInfo", w.host, w.httpPort))
+	resp, err := http.Get(fmt.Sprintf("%v://%v:%v/delegatorInfo", w.scheme, w.host, w.httpPort))
 	if err != nil {
 		return lpTypes.Delegator{}, err
 	}
@@ -406,7 +406,7 @@ func (w *wizard) getDelegatorInfo() (lpTypes.Delegator, error) {
 }
 
 func (w *wizard) getGasPrice() string {
-	g := httpGet(fmt.Sprintf("http://%v:%v/gasPrice", w.host, w.httpPort))
+	g := httpGetValue(fmt.Sprintf("%v://%v:%v/gasPrice", w.scheme, w.host, w.httpPort), "gasPrice")
 	if g == "" {
 		g = "Unknown"
 	} else if g == "0" {
@@ -416,7 +416,7 @@ func (w *wizard) getGasPrice() string {
 }
 
 func (w *wizard) currentBlock() (*big.Int, error) {
-	resp, err := http.Get(fmt.Sprintf("http://%v:%v/currentBlock", w.host, w.httpPort))
+	resp, err := http.Get(fmt.Sprintf("%v://%v:%v/currentBlock", w.scheme, w.host, w.httpPort))
 	if err != nil {
 		return nil, err
 	}
@@ -432,5 +432,12 @@ func (w *wizard) currentBlock() (*big.Int, error) {
 		return nil, err
 	}
 
-	return new(big.Int).SetBytes(body), nil
+	var blk struct {
+		BlockNumber *big.Int `json:"blockNumber"`
+	}
+	if err := json.Unmarshal(body, &blk); err != nil || blk.BlockNumber == nil {
+		// Nodes with legacy CLI responses send the bytes of the block number
+		return new(big.Int).SetBytes(body), nil
+	}
+	return blk.BlockNumber, nil
 }
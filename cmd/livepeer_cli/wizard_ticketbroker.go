@@ -71,7 +71,7 @@ func (w *wizard) deposit() {
 		"depositAmount": {eth.ToBaseUnit(big.NewFloat(depositAmount)).String()},
 		"reserveAmount": {eth.ToBaseUnit(big.NewFloat(reserveAmount)).String()},
 	}
-	fmt.Println(httpPostWithParams(fmt.Sprintf("http://%v:%v/fundDepositAndReserve", w.host, w.httpPort), form))
+	fmt.Println(httpPostWithParams(fmt.Sprintf("%v://%v:%v/fundDepositAndReserve", w.scheme, w.host, w.httpPort), form))
 
 	return
 }
@@ -126,7 +126,7 @@ func (w *wizard) unlock() {
 		return
 	}
 
-	fmt.Println(httpPost(fmt.Sprintf("http://%v:%v/unlock", w.host, w.httpPort)))
+	fmt.Println(httpPost(fmt.Sprintf("%v://%v:%v/unlock", w.scheme, w.host, w.httpPort)))
 }
 
 func (w *wizard) cancelUnlock() {
@@ -160,7 +160,7 @@ func (w *wizard) cancelUnlock() {
 		return
 	}
 
-	fmt.Println(httpPost(fmt.Sprintf("http://%v:%v/cancelUnlock", w.host, w.httpPort)))
+	fmt.Println(httpPost(fmt.Sprintf("%v://%v:%v/cancelUnlock", w.scheme, w.host, w.httpPort)))
 }
 
 func (w *wizard) withdraw() {
@@ -207,12 +207,12 @@ func (w *wizard) withdraw() {
 		return
 	}
 
-	fmt.Println(httpPost(fmt.Sprintf("http://%v:%v/withdraw", w.host, w.httpPort)))
+	fmt.Println(httpPost(fmt.Sprintf("%v://%v:%v/withdraw", w.scheme, w.host, w.httpPort)))
 }
 
 func (w *wizard) senderInfo() (info pm.SenderInfo, err error) {
 	var resp *http.Response
-	resp, err = http.Get(fmt.Sprintf("http://%v:%v/senderInfo", w.host, w.httpPort))
+	resp, err = http.Get(fmt.Sprintf("%v://%v:%v/senderInfo", w.scheme, w.host, w.httpPort))
 	if err != nil {
 		return
 	}
@@ -244,7 +244,7 @@ func (w *wizard) ticketBrokerParams() (params struct {
 	UnlockPeriod *big.Int
 }, err error) {
 	var resp *http.Response
-	resp, err = http.Get(fmt.Sprintf("http://%v:%v/ticketBrokerParams", w.host, w.httpPort))
+	resp, err = http.Get(fmt.Sprintf("%v://%v:%v/ticketBrokerParams", w.scheme, w.host, w.httpPort))
 	if err != nil {
 		return
 	}
@@ -19,9 +19,9 @@ func (w *wizard) transferTokens() {
 		"amount": {fmt.Sprintf("%v", amount.String())},
 	}
 
-	httpPostWithParams(fmt.Sprintf("http://%v:%v/transferTokens", w.host, w.httpPort), val)
+	httpPostWithParams(fmt.Sprintf("%v://%v:%v/transferTokens", w.scheme, w.host, w.httpPort), val)
 }
 
 func (w *wizard) requestTokens() {
-	httpPost(fmt.Sprintf("http://%v:%v/requestTokens", w.host, w.httpPort))
+	httpPost(fmt.Sprintf("%v://%v:%v/requestTokens", w.scheme, w.host, w.httpPort))
 }
@@ -14,7 +14,7 @@ import (
 const defaultRPCPort = "8935"
 
 func (w *wizard) isOrchestrator() bool {
-	isT := httpGet(fmt.Sprintf("http://%v:%v/IsOrchestrator", w.host, w.httpPort))
+	isT := httpGetValue(fmt.Sprintf("%v://%v:%v/IsOrchestrator", w.scheme, w.host, w.httpPort), "orchestrator")
 	return isT == "true"
 }
 
@@ -139,7 +139,7 @@ func (w *wizard) activateOrchestrator() {
 		}
 	}
 
-	httpPostWithParams(fmt.Sprintf("http://%v:%v/activateOrchestrator", w.host, w.httpPort), val)
+	httpPostWithParams(fmt.Sprintf("%v://%v:%v/activateOrchestrator", w.scheme, w.host, w.httpPort), val)
 	// TODO we should confirm if the transaction was actually sent
 	fmt.Println("\nTransaction sent. Once confirmed, please restart your node.")
 }
@@ -149,7 +149,7 @@ func (w *wizard) setOrchestratorConfig() {
 
 	val := w.getOrchestratorConfigFormValues()
 
-	httpPostWithParams(fmt.Sprintf("http://%v:%v/setOrchestratorConfig", w.host, w.httpPort), val)
+	httpPostWithParams(fmt.Sprintf("%v://%v:%v/setOrchestratorConfig", w.scheme, w.host, w.httpPort), val)
 	// TODO we should confirm if the transaction was actually sent
 	fmt.Println("\nTransaction sent. Once confirmed, please restart your node if the ServiceURI has been reset")
 }
@@ -183,5 +183,5 @@ func (w *wizard) callReward() {
 	}
 
 	fmt.Printf("Calling reward for round %v\n", c)
-	httpGet(fmt.Sprintf("http://%v:%v/reward", w.host, w.httpPort))
+	httpGet(fmt.Sprintf("%v://%v:%v/reward", w.scheme, w.host, w.httpPort))
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,14 +11,22 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/golang/glog"
+
 	"github.com/livepeer/go-livepeer/core"
 )
 
 type authWebhookReq struct {
-	Url string `json:"url"`
+	Event      string `json:"event"`
+	Url        string `json:"url"`
+	ManifestID string `json:"manifestID"`
+	StreamKey  string `json:"streamKey"`
 }
 
 func main() {
+	flag.Set("logtostderr", "true")
+	flag.Parse()
+
 	http.HandleFunc("/auth", func(w http.ResponseWriter, r *http.Request) {
 		decoder := json.NewDecoder(r.Body)
 		var req authWebhookReq
@@ -27,6 +36,10 @@ func main() {
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
+		if req.Event == "streamEnded" {
+			glog.Infof("Stream ended with manifestID: %v", req.ManifestID)
+			return
+		}
 
 		var mid core.ManifestID
 		u, err := url.Parse(req.Url)
@@ -40,7 +53,7 @@ func main() {
 			fmt.Printf("Detected \"fizz\" as manifestID. Crazy! Renaming to \"buzz\".\n")
 		}
 		fmt.Printf("Stream started with manifestID: %v\n", mid)
-		w.Write([]byte(fmt.Sprintf("{\"ManifestID\":\"%v\"}", mid)))
+		w.Write([]byte(fmt.Sprintf("{\"ManifestID\":\"%v\"}", string(mid))))
 	})
 
 	fmt.Println("Listening on localhost:8000/auth\nTry something crazy - stream with \"fizz\" as the manifestID.")
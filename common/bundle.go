@@ -0,0 +1,281 @@
+package common
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+)
+
+// BundleVersion is the version of the format of the bundles created by ExportBundle
+const BundleVersion = 1
+
+// Header of the bundles, followed by the version of their format
+const bundleMagic = "LPBUNDLE"
+
+// Names of the files of bundles
+const (
+	bundleManifestFile = "manifest.json"
+	bundleConfigFile   = "config.yaml"
+	bundleDBFile       = "lp.sqlite3"
+	bundleKeystoreDir  = "keystore"
+)
+
+var ErrBundlePassword = errors.New("wrong bundle password or corrupted bundle")
+
+// BundleManifest describes the node that a bundle was exported from, so that the node that imports
+// it can check that it is set up for the same network and account
+type BundleManifest struct {
+	Version       int       `json:"version"`
+	NodeVersion   string    `json:"nodeVersion"`
+	CreatedAt     time.Time `json:"createdAt"`
+	Network       string    `json:"network"`
+	ChainID       string    `json:"chainID,omitempty"`
+	EthController string    `json:"ethController,omitempty"`
+	EthAcctAddr   string    `json:"ethAcctAddr,omitempty"`
+}
+
+// ExportBundle writes a bundle of the database, the keystore and the config file of a node to w,
+// encrypted with a key derived from password. The ID of the chain of the node is read from db
+func ExportBundle(w io.Writer, password string, m BundleManifest, db *DB, keystoreDir string, config []byte) error {
+	if password == "" {
+		return errors.New("bundle password required")
+	}
+	chainID, err := db.ChainID()
+	if err != nil {
+		return err
+	}
+	m.Version = BundleVersion
+	m.CreatedAt = time.Now().UTC()
+	m.ChainID = chainID
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpDir, err := ioutil.TempDir("", "lpbundle")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	dbFile := filepath.Join(tmpDir, bundleDBFile)
+	if err := db.Backup(dbFile); err != nil {
+		return err
+	}
+	dbData, err := ioutil.ReadFile(dbFile)
+	if err != nil {
+		return err
+	}
+
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	add := func(name string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: m.CreatedAt}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	if err := add(bundleManifestFile, manifest); err != nil {
+		return err
+	}
+	if err := add(bundleConfigFile, config); err != nil {
+		return err
+	}
+	if err := add(bundleDBFile, dbData); err != nil {
+		return err
+	}
+	if keystoreDir != "" {
+		files, err := ioutil.ReadDir(keystoreDir)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, f := range files {
+			if !f.Mode().IsRegular() {
+				continue
+			}
+			data, err := ioutil.ReadFile(filepath.Join(keystoreDir, f.Name()))
+			if err != nil {
+				return err
+			}
+			if err := add(bundleKeystoreDir+"/"+f.Name(), data); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	sealed, err := SealWithPassword(append([]byte(bundleMagic), BundleVersion), password, archive.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(sealed)
+	return err
+}
+
+// ImportBundle decrypts a bundle created by ExportBundle and writes its database and config file
+// to datadir and its keystore to keystoreDir. The network, the controller and the account of
+// expected must match the bundle if they are set, and the node must not have a database or
+// the keys of the bundle yet, so that the node's data is not overwritten
+func ImportBundle(r io.Reader, password string, expected BundleManifest, datadir, keystoreDir string) (*BundleManifest, error) {
+	files, err := readBundle(r, password)
+	if err != nil {
+		return nil, err
+	}
+	var m BundleManifest
+	if err := json.Unmarshal(files[bundleManifestFile], &m); err != nil {
+		return nil, fmt.Errorf("invalid bundle manifest: %v", err)
+	}
+	if m.Version != BundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %v", m.Version)
+	}
+	if expected.Network != "" && m.Network != expected.Network {
+		return nil, fmt.Errorf("bundle of a node of network %v can't be imported on network %v", m.Network, expected.Network)
+	}
+	if expected.EthController != "" && m.EthController != "" &&
+		ethcommon.HexToAddress(expected.EthController) != ethcommon.HexToAddress(m.EthController) {
+		return nil, fmt.Errorf("bundle of a node of controller %v can't be imported with controller %v", m.EthController, expected.EthController)
+	}
+	if expected.EthAcctAddr != "" && m.EthAcctAddr != "" &&
+		ethcommon.HexToAddress(expected.EthAcctAddr) != ethcommon.HexToAddress(m.EthAcctAddr) {
+		return nil, fmt.Errorf("bundle of account %v can't be imported for account %v", m.EthAcctAddr, expected.EthAcctAddr)
+	}
+
+	// The keystore must have the key of the account of the node
+	keys := make(map[string][]byte)
+	foundAcct := m.EthAcctAddr == ""
+	for name, data := range files {
+		if !strings.HasPrefix(name, bundleKeystoreDir+"/") {
+			continue
+		}
+		name = strings.TrimPrefix(name, bundleKeystoreDir+"/")
+		if name == "" || strings.ContainsAny(name, `/\`) || name == ".." {
+			return nil, fmt.Errorf("invalid keystore file %q in bundle", name)
+		}
+		keys[name] = data
+		var key struct {
+			Address string `json:"address"`
+		}
+		if json.Unmarshal(data, &key) == nil && key.Address != "" &&
+			ethcommon.HexToAddress(key.Address) == ethcommon.HexToAddress(m.EthAcctAddr) {
+			foundAcct = true
+		}
+	}
+	if !foundAcct {
+		return nil, fmt.Errorf("bundle has no key of account %v", m.EthAcctAddr)
+	}
+
+	dbFile := filepath.Join(datadir, bundleDBFile)
+	configFile := filepath.Join(datadir, bundleConfigFile)
+	targets := []string{dbFile, configFile}
+	for name := range keys {
+		targets = append(targets, filepath.Join(keystoreDir, name))
+	}
+	for _, target := range targets {
+		if _, err := os.Stat(target); !os.IsNotExist(err) {
+			return nil, fmt.Errorf("%v already exists, bundles can only be imported on fresh nodes", target)
+		}
+	}
+
+	// The database must be of the chain of the manifest
+	if err := os.MkdirAll(datadir, 0755); err != nil {
+		return nil, err
+	}
+	tmpDBFile := dbFile + ".import"
+	if err := ioutil.WriteFile(tmpDBFile, files[bundleDBFile], 0600); err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmpDBFile)
+	db, err := InitDB(tmpDBFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle database: %v", err)
+	}
+	chainID, err := db.ChainID()
+	db.Close()
+	if err != nil {
+		return nil, err
+	}
+	if chainID != m.ChainID {
+		return nil, fmt.Errorf("bundle database belongs to chain %q, not chain %q of its manifest", chainID, m.ChainID)
+	}
+
+	if len(keys) > 0 {
+		if err := os.MkdirAll(keystoreDir, 0700); err != nil {
+			return nil, err
+		}
+	}
+	for name, data := range keys {
+		if err := ioutil.WriteFile(filepath.Join(keystoreDir, name), data, 0600); err != nil {
+			return nil, err
+		}
+	}
+	if err := ioutil.WriteFile(configFile, files[bundleConfigFile], 0600); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpDBFile, dbFile); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// readBundle decrypts a bundle and returns its files by name
+func readBundle(r io.Reader, password string) (map[string][]byte, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) <= len(bundleMagic) || string(data[:len(bundleMagic)]) != bundleMagic {
+		return nil, errors.New("not a node bundle")
+	}
+	if v := int(data[len(bundleMagic)]); v != BundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %v", v)
+	}
+	archive, err := OpenWithPassword(data[:len(bundleMagic)+1], password, data)
+	if err == ErrSealPassword {
+		return nil, ErrBundlePassword
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	files := make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if files[hdr.Name], err = ioutil.ReadAll(tr); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range []string{bundleManifestFile, bundleConfigFile, bundleDBFile} {
+		if _, ok := files[name]; !ok {
+			return nil, fmt.Errorf("bundle has no %v", name)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,89 @@
+package common
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundle_ExportImport(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	dir, err := ioutil.TempDir("", t.Name())
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// The exporting node
+	srcDir := filepath.Join(dir, "src")
+	srcKeystore := filepath.Join(srcDir, "keystore")
+	require.Nil(os.MkdirAll(srcKeystore, 0700))
+	acct := "0x0000000000000000000000000000000000000abc"
+	key := []byte(`{"address":"0000000000000000000000000000000000000abc","crypto":{}}`)
+	require.Nil(ioutil.WriteFile(filepath.Join(srcKeystore, "UTC--abc"), key, 0600))
+	db, err := InitDB(filepath.Join(srcDir, "lp.sqlite3"))
+	require.Nil(err)
+	defer db.Close()
+	require.Nil(db.CheckChainID(big.NewInt(4)))
+	require.Nil(db.StoreKV("runtime.maxSessions", "20"))
+
+	m := BundleManifest{NodeVersion: "0.5.0", Network: "rinkeby", EthController: "0x37dc71366ec655093b9930bc816e16e6b587f968", EthAcctAddr: acct}
+	config := []byte("network: rinkeby\n")
+	var bundle bytes.Buffer
+	assert.EqualError(ExportBundle(&bundle, "", m, db, srcKeystore, config), "bundle password required")
+	require.Nil(ExportBundle(&bundle, "secret", m, db, srcKeystore, config))
+	assert.NotContains(bundle.String(), "runtime.maxSessions")
+
+	importBundle := func(password string, expected BundleManifest, datadir string) (*BundleManifest, error) {
+		return ImportBundle(bytes.NewReader(bundle.Bytes()), password, expected, datadir, filepath.Join(datadir, "keystore"))
+	}
+	dstDir := filepath.Join(dir, "dst")
+
+	_, err = importBundle("wrong", BundleManifest{}, dstDir)
+	assert.Equal(ErrBundlePassword, err)
+	_, err = importBundle("secret", BundleManifest{Network: "mainnet"}, dstDir)
+	assert.Contains(err.Error(), "can't be imported on network mainnet")
+	_, err = importBundle("secret", BundleManifest{Network: "rinkeby", EthController: "0xf96d54e490317c557a967abfa5d6e33006be69b3"}, dstDir)
+	assert.Contains(err.Error(), "can't be imported with controller")
+	_, err = importBundle("secret", BundleManifest{EthAcctAddr: "0x0000000000000000000000000000000000000def"}, dstDir)
+	assert.Contains(err.Error(), "can't be imported for account")
+
+	imported, err := importBundle("secret", BundleManifest{Network: "rinkeby", EthAcctAddr: acct}, dstDir)
+	require.Nil(err)
+	assert.Equal(BundleVersion, imported.Version)
+	assert.Equal("4", imported.ChainID)
+	assert.Equal(acct, imported.EthAcctAddr)
+	data, err := ioutil.ReadFile(filepath.Join(dstDir, "keystore", "UTC--abc"))
+	require.Nil(err)
+	assert.Equal(key, data)
+	data, err = ioutil.ReadFile(filepath.Join(dstDir, "config.yaml"))
+	require.Nil(err)
+	assert.Equal(config, data)
+	dstDB, err := InitDB(filepath.Join(dstDir, "lp.sqlite3"))
+	require.Nil(err)
+	defer dstDB.Close()
+	maxSessions, err := dstDB.KV("runtime.maxSessions")
+	require.Nil(err)
+	assert.Equal("20", maxSessions)
+	assert.Contains(dstDB.CheckChainID(big.NewInt(1)).Error(), "belongs to a node of chain 4")
+	assert.Nil(dstDB.CheckChainID(big.NewInt(4)))
+
+	// The data of a node is not overwritten
+	_, err = importBundle("secret", BundleManifest{}, dstDir)
+	assert.Contains(err.Error(), "bundles can only be imported on fresh nodes")
+
+	// The key of the account must be in the bundle
+	m.EthAcctAddr = "0x0000000000000000000000000000000000000def"
+	bundle.Reset()
+	require.Nil(ExportBundle(&bundle, "secret", m, db, srcKeystore, config))
+	_, err = importBundle("secret", BundleManifest{}, filepath.Join(dir, "other"))
+	assert.Contains(err.Error(), "bundle has no key of account")
+
+	_, err = ImportBundle(bytes.NewReader([]byte("not a bundle")), "secret", BundleManifest{}, dstDir, dstDir)
+	assert.EqualError(err, "not a node bundle")
+}
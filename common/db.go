@@ -14,6 +14,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/golang/glog"
 	"github.com/livepeer/go-livepeer/eth/blockwatch"
+	"github.com/livepeer/go-livepeer/monitor"
 	"github.com/livepeer/go-livepeer/pm"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/pkg/errors"
@@ -26,12 +27,43 @@ type DB struct {
 	selectOrchs                      *sql.Stmt
 	updateOrch                       *sql.Stmt
 	updateKV                         *sql.Stmt
+	storeKV                          *sql.Stmt
+	selectKV                         *sql.Stmt
 	insertUnbondingLock              *sql.Stmt
 	deleteUnbondingLock              *sql.Stmt
 	useUnbondingLock                 *sql.Stmt
 	unbondingLocks                   *sql.Stmt
 	withdrawableUnbondingLocks       *sql.Stmt
 	insertWinningTicket              *sql.Stmt
+	selectTicketSenders              *sql.Stmt
+	storeSenderNonce                 *sql.Stmt
+	selectSenderNonce                *sql.Stmt
+	updateRecipientNonce             *sql.Stmt
+	selectRecipientNonce             *sql.Stmt
+	deleteRecipientNonce             *sql.Stmt
+	insertInvalidRecipientRand       *sql.Stmt
+	selectInvalidRecipientRand       *sql.Stmt
+	storeSenderSession               *sql.Stmt
+	selectSenderSession              *sql.Stmt
+	storeBroadcastPMSession          *sql.Stmt
+	selectBroadcastPMSession         *sql.Stmt
+	storeOrchStats                   *sql.Stmt
+	selectOrchStats                  *sql.Stmt
+	insertOrchListEntry              *sql.Stmt
+	deleteOrchListEntry              *sql.Stmt
+	selectOrchListEntries            *sql.Stmt
+	insertBroadcastPayment           *sql.Stmt
+	selectBroadcastPayments          *sql.Stmt
+	insertTicketRedemption           *sql.Stmt
+	selectTicketRedemptions          *sql.Stmt
+	deleteTicketRedemption           *sql.Stmt
+	insertProtocolExchange           *sql.Stmt
+	selectProtocolExchange           *sql.Stmt
+	selectProtocolExchanges          *sql.Stmt
+	deleteProtocolExchanges          *sql.Stmt
+	selectExchangeManifestIDs        *sql.Stmt
+	selectManifestExchanges          *sql.Stmt
+	deleteManifestExchanges          *sql.Stmt
 	insertMiniHeader                 *sql.Stmt
 	findLatestMiniHeader             *sql.Stmt
 	findAllMiniHeadersSortedByNumber *sql.Stmt
@@ -44,6 +76,73 @@ type DBOrch struct {
 	PricePerPixel int64
 }
 
+// DBOrchStats are the statistics of the segments that a broadcaster sent to an orchestrator
+type DBOrchStats struct {
+	Orchestrator         string
+	Segments             int64
+	Failures             int64
+	VerificationFailures int64
+	// Latencies of the most recent segments in milliseconds
+	LatenciesMs []int64
+	// Prices of the orchestrator, oldest first, recorded whenever they changed
+	Prices []DBOrchPrice
+}
+
+// DBOrchPrice is a price per pixel advertised by an orchestrator and the time it was first seen at
+type DBOrchPrice struct {
+	PricePerPixel string `json:"pricePerPixel"`
+	Time          int64  `json:"time"`
+}
+
+// DBBroadcastPayment is a batch of tickets that a broadcaster sent to an orchestrator for a segment of a stream
+type DBBroadcastPayment struct {
+	ManifestID string
+	Recipient  ethcommon.Address
+	Tickets    int64
+	// Expected value of the tickets in wei
+	EV *big.Rat
+	// Price per pixel of the orchestrator in wei
+	PricePerPixel *big.Rat
+	// Unix time of the payment
+	Time int64
+}
+
+// DBTicketRedemption is a winning ticket of a broadcaster that an orchestrator redeemed
+type DBTicketRedemption struct {
+	Recipient ethcommon.Address
+	// Face value of the ticket in wei
+	Amount *big.Int
+	// Unix time of the redemption
+	Time int64
+}
+
+// DBProtocolExchange is a segment that a broadcaster and an orchestrator exchanged, with the signed
+// messages of the exchange as they were sent
+type DBProtocolExchange struct {
+	ID int64
+	// Role of the node in the exchange, broadcaster or orchestrator
+	Role       string
+	ManifestID string
+	SeqNo      int64
+	Sender     ethcommon.Address
+	Recipient  ethcommon.Address
+	// Segment credentials and payment headers of the segment
+	SegData string
+	Payment string
+	// Encoded TranscodeResult returned by the orchestrator
+	Result []byte
+	// Names of the source segment and of the renditions in the storage of the archive
+	Payloads []string
+	// Unix time of the exchange
+	Time int64
+}
+
+// DBOrchListEntry is a pattern of the allowlist or denylist that broadcasters filter orchestrators with
+type DBOrchListEntry struct {
+	List    string
+	Pattern string
+}
+
 type DBUnbondingLock struct {
 	ID            int64
 	Delegator     ethcommon.Address
@@ -102,6 +201,98 @@ var schema = `
 
 	CREATE INDEX IF NOT EXISTS idx_winningtickets_sessionid ON winningTickets(sessionID);
 
+	CREATE TABLE IF NOT EXISTS senderNonces (
+		sessionID STRING PRIMARY KEY,
+		senderNonce INTEGER,
+		updatedAt STRING DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS recipientNonces (
+		recipientRand STRING PRIMARY KEY,
+		senderNonce INTEGER,
+		updatedAt STRING DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS invalidRecipientRands (
+		recipientRand STRING PRIMARY KEY,
+		createdAt STRING DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS senderSessions (
+		sessionID STRING PRIMARY KEY,
+		recipient STRING,
+		faceValue BLOB,
+		winProb BLOB,
+		recipientRandHash STRING,
+		seed BLOB,
+		creationRound int64,
+		creationRoundBlockHash STRING,
+		senderNonce INTEGER,
+		ticketsSent INTEGER,
+		evSent TEXT,
+		updatedAt STRING DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS broadcastPMSessions (
+		manifestID STRING,
+		orchestrator STRING,
+		sessionID STRING,
+		updatedAt STRING DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(manifestID, orchestrator)
+	);
+
+	CREATE TABLE IF NOT EXISTS orchestratorStats (
+		orchestrator STRING PRIMARY KEY,
+		segments INTEGER,
+		failures INTEGER,
+		verificationFailures INTEGER,
+		latencies STRING,
+		prices STRING,
+		updatedAt STRING DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS orchestratorLists (
+		list STRING,
+		pattern STRING,
+		createdAt STRING DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(list, pattern)
+	);
+
+	CREATE TABLE IF NOT EXISTS broadcastPayments (
+		manifestID STRING,
+		recipient STRING,
+		tickets INTEGER,
+		ev STRING,
+		pricePerPixel STRING,
+		createdAt INTEGER
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_broadcastpayments_createdat ON broadcastPayments(createdAt);
+
+	CREATE TABLE IF NOT EXISTS ticketRedemptions (
+		recipient STRING,
+		amount STRING,
+		createdAt INTEGER
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_ticketredemptions_createdat ON ticketRedemptions(createdAt);
+
+	CREATE TABLE IF NOT EXISTS protocolExchanges (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		role STRING,
+		manifestID STRING,
+		seqNo INTEGER,
+		sender STRING,
+		recipient STRING,
+		segData STRING,
+		payment STRING,
+		result BLOB,
+		payloads STRING,
+		createdAt INTEGER
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_protocolexchanges_createdat ON protocolExchanges(createdAt);
+
 	CREATE TABLE IF NOT EXISTS blockheaders (
 		number int64,
 		parent STRING,
@@ -177,6 +368,20 @@ func InitDB(dbPath string) (*DB, error) {
 		return nil, err
 	}
 	d.updateKV = stmt
+	stmt, err = db.Prepare("INSERT OR REPLACE INTO kv(key, value, updatedAt) VALUES(?, ?, datetime())")
+	if err != nil {
+		glog.Error("Unable to prepare storeKV stmt ", err)
+		d.Close()
+		return nil, err
+	}
+	d.storeKV = stmt
+	stmt, err = db.Prepare("SELECT value FROM kv WHERE key = ?")
+	if err != nil {
+		glog.Error("Unable to prepare selectKV stmt ", err)
+		d.Close()
+		return nil, err
+	}
+	d.selectKV = stmt
 
 	// Unbonding locks prepared statements
 	stmt, err = db.Prepare("INSERT INTO unbondingLocks(id, delegator, amount, withdrawRound) VALUES(?, ?, ?, ?)")
@@ -223,6 +428,224 @@ func InitDB(dbPath string) (*DB, error) {
 		return nil, err
 	}
 	d.insertWinningTicket = stmt
+	stmt, err = db.Prepare("SELECT DISTINCT sender FROM winningTickets WHERE createdAt >= datetime(?, 'unixepoch')")
+	if err != nil {
+		glog.Error("Unable to prepare selectTicketSenders ", err)
+		d.Close()
+		return nil, err
+	}
+	d.selectTicketSenders = stmt
+
+	// Sender nonces prepared statements
+	stmt, err = db.Prepare("INSERT OR REPLACE INTO senderNonces(sessionID, senderNonce, updatedAt) VALUES(?1, MAX(?2, IFNULL((SELECT senderNonce FROM senderNonces WHERE sessionID = ?1), 0)), datetime())")
+	if err != nil {
+		glog.Error("Unable to prepare storeSenderNonce ", err)
+		d.Close()
+		return nil, err
+	}
+	d.storeSenderNonce = stmt
+	stmt, err = db.Prepare("SELECT senderNonce FROM senderNonces WHERE sessionID = ?")
+	if err != nil {
+		glog.Error("Unable to prepare selectSenderNonce ", err)
+		d.Close()
+		return nil, err
+	}
+	d.selectSenderNonce = stmt
+
+	// Recipient state prepared statements
+	// The senderNonce is only replaced if it is higher than the one already stored
+	stmt, err = db.Prepare("INSERT OR REPLACE INTO recipientNonces(recipientRand, senderNonce, updatedAt) SELECT ?1, ?2, datetime() WHERE ?2 > IFNULL((SELECT senderNonce FROM recipientNonces WHERE recipientRand = ?1), -1)")
+	if err != nil {
+		glog.Error("Unable to prepare updateRecipientNonce ", err)
+		d.Close()
+		return nil, err
+	}
+	d.updateRecipientNonce = stmt
+	stmt, err = db.Prepare("SELECT senderNonce FROM recipientNonces WHERE recipientRand = ?")
+	if err != nil {
+		glog.Error("Unable to prepare selectRecipientNonce ", err)
+		d.Close()
+		return nil, err
+	}
+	d.selectRecipientNonce = stmt
+	stmt, err = db.Prepare("DELETE FROM recipientNonces WHERE recipientRand = ?")
+	if err != nil {
+		glog.Error("Unable to prepare deleteRecipientNonce ", err)
+		d.Close()
+		return nil, err
+	}
+	d.deleteRecipientNonce = stmt
+	stmt, err = db.Prepare("INSERT OR IGNORE INTO invalidRecipientRands(recipientRand) VALUES(?)")
+	if err != nil {
+		glog.Error("Unable to prepare insertInvalidRecipientRand ", err)
+		d.Close()
+		return nil, err
+	}
+	d.insertInvalidRecipientRand = stmt
+	stmt, err = db.Prepare("SELECT COUNT(*) FROM invalidRecipientRands WHERE recipientRand = ?")
+	if err != nil {
+		glog.Error("Unable to prepare selectInvalidRecipientRand ", err)
+		d.Close()
+		return nil, err
+	}
+	d.selectInvalidRecipientRand = stmt
+
+	// Sender sessions prepared statements
+	stmt, err = db.Prepare("INSERT OR REPLACE INTO senderSessions(sessionID, recipient, faceValue, winProb, recipientRandHash, seed, creationRound, creationRoundBlockHash, senderNonce, ticketsSent, evSent, updatedAt) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, datetime())")
+	if err != nil {
+		glog.Error("Unable to prepare storeSenderSession ", err)
+		d.Close()
+		return nil, err
+	}
+	d.storeSenderSession = stmt
+	stmt, err = db.Prepare("SELECT recipient, faceValue, winProb, recipientRandHash, seed, creationRound, creationRoundBlockHash, senderNonce, ticketsSent, evSent FROM senderSessions WHERE sessionID = ?")
+	if err != nil {
+		glog.Error("Unable to prepare selectSenderSession ", err)
+		d.Close()
+		return nil, err
+	}
+	d.selectSenderSession = stmt
+	stmt, err = db.Prepare("INSERT OR REPLACE INTO broadcastPMSessions(manifestID, orchestrator, sessionID, updatedAt) VALUES(?, ?, ?, datetime())")
+	if err != nil {
+		glog.Error("Unable to prepare storeBroadcastPMSession ", err)
+		d.Close()
+		return nil, err
+	}
+	d.storeBroadcastPMSession = stmt
+	stmt, err = db.Prepare("SELECT sessionID FROM broadcastPMSessions WHERE manifestID = ? AND orchestrator = ?")
+	if err != nil {
+		glog.Error("Unable to prepare selectBroadcastPMSession ", err)
+		d.Close()
+		return nil, err
+	}
+	d.selectBroadcastPMSession = stmt
+
+	// Orchestrator stats prepared statements
+	stmt, err = db.Prepare("INSERT OR REPLACE INTO orchestratorStats(orchestrator, segments, failures, verificationFailures, latencies, prices, updatedAt) VALUES(?, ?, ?, ?, ?, ?, datetime())")
+	if err != nil {
+		glog.Error("Unable to prepare storeOrchStats ", err)
+		d.Close()
+		return nil, err
+	}
+	d.storeOrchStats = stmt
+	stmt, err = db.Prepare("SELECT orchestrator, segments, failures, verificationFailures, latencies, prices FROM orchestratorStats")
+	if err != nil {
+		glog.Error("Unable to prepare selectOrchStats ", err)
+		d.Close()
+		return nil, err
+	}
+	d.selectOrchStats = stmt
+
+	// Orchestrator lists prepared statements
+	stmt, err = db.Prepare("INSERT OR IGNORE INTO orchestratorLists(list, pattern) VALUES(?, ?)")
+	if err != nil {
+		glog.Error("Unable to prepare insertOrchListEntry ", err)
+		d.Close()
+		return nil, err
+	}
+	d.insertOrchListEntry = stmt
+	stmt, err = db.Prepare("DELETE FROM orchestratorLists WHERE list = ? AND pattern = ?")
+	if err != nil {
+		glog.Error("Unable to prepare deleteOrchListEntry ", err)
+		d.Close()
+		return nil, err
+	}
+	d.deleteOrchListEntry = stmt
+	stmt, err = db.Prepare("SELECT list, pattern FROM orchestratorLists ORDER BY createdAt, pattern")
+	if err != nil {
+		glog.Error("Unable to prepare selectOrchListEntries ", err)
+		d.Close()
+		return nil, err
+	}
+	d.selectOrchListEntries = stmt
+
+	// Spend report prepared statements
+	stmt, err = db.Prepare("INSERT INTO broadcastPayments(manifestID, recipient, tickets, ev, pricePerPixel, createdAt) VALUES(?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		glog.Error("Unable to prepare insertBroadcastPayment ", err)
+		d.Close()
+		return nil, err
+	}
+	d.insertBroadcastPayment = stmt
+	stmt, err = db.Prepare("SELECT manifestID, recipient, tickets, ev, pricePerPixel, createdAt FROM broadcastPayments WHERE createdAt >= ? AND createdAt <= ? ORDER BY createdAt")
+	if err != nil {
+		glog.Error("Unable to prepare selectBroadcastPayments ", err)
+		d.Close()
+		return nil, err
+	}
+	d.selectBroadcastPayments = stmt
+	stmt, err = db.Prepare("INSERT INTO ticketRedemptions(recipient, amount, createdAt) VALUES(?, ?, ?)")
+	if err != nil {
+		glog.Error("Unable to prepare insertTicketRedemption ", err)
+		d.Close()
+		return nil, err
+	}
+	d.insertTicketRedemption = stmt
+	stmt, err = db.Prepare("SELECT recipient, amount, createdAt FROM ticketRedemptions WHERE createdAt >= ? AND createdAt <= ? ORDER BY createdAt")
+	if err != nil {
+		glog.Error("Unable to prepare selectTicketRedemptions ", err)
+		d.Close()
+		return nil, err
+	}
+	d.selectTicketRedemptions = stmt
+	stmt, err = db.Prepare("DELETE FROM ticketRedemptions WHERE rowid = (SELECT rowid FROM ticketRedemptions WHERE recipient = ? AND amount = ? ORDER BY createdAt DESC LIMIT 1)")
+	if err != nil {
+		glog.Error("Unable to prepare deleteTicketRedemption ", err)
+		d.Close()
+		return nil, err
+	}
+	d.deleteTicketRedemption = stmt
+
+	// Protocol archive prepared statements
+	stmt, err = db.Prepare("INSERT INTO protocolExchanges(role, manifestID, seqNo, sender, recipient, segData, payment, result, payloads, createdAt) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		glog.Error("Unable to prepare insertProtocolExchange ", err)
+		d.Close()
+		return nil, err
+	}
+	d.insertProtocolExchange = stmt
+	stmt, err = db.Prepare("SELECT id, role, manifestID, seqNo, sender, recipient, segData, payment, result, payloads, createdAt FROM protocolExchanges WHERE id = ?")
+	if err != nil {
+		glog.Error("Unable to prepare selectProtocolExchange ", err)
+		d.Close()
+		return nil, err
+	}
+	d.selectProtocolExchange = stmt
+	stmt, err = db.Prepare("SELECT id, role, manifestID, seqNo, sender, recipient, segData, payment, result, payloads, createdAt FROM protocolExchanges WHERE createdAt >= ? AND createdAt <= ? ORDER BY createdAt, id")
+	if err != nil {
+		glog.Error("Unable to prepare selectProtocolExchanges ", err)
+		d.Close()
+		return nil, err
+	}
+	d.selectProtocolExchanges = stmt
+	stmt, err = db.Prepare("DELETE FROM protocolExchanges WHERE createdAt < ?")
+	if err != nil {
+		glog.Error("Unable to prepare deleteProtocolExchanges ", err)
+		d.Close()
+		return nil, err
+	}
+	d.deleteProtocolExchanges = stmt
+	stmt, err = db.Prepare("SELECT DISTINCT manifestID FROM protocolExchanges ORDER BY manifestID")
+	if err != nil {
+		glog.Error("Unable to prepare selectExchangeManifestIDs ", err)
+		d.Close()
+		return nil, err
+	}
+	d.selectExchangeManifestIDs = stmt
+	stmt, err = db.Prepare("SELECT id, role, manifestID, seqNo, sender, recipient, segData, payment, result, payloads, createdAt FROM protocolExchanges WHERE manifestID = ? ORDER BY createdAt, id")
+	if err != nil {
+		glog.Error("Unable to prepare selectManifestExchanges ", err)
+		d.Close()
+		return nil, err
+	}
+	d.selectManifestExchanges = stmt
+	stmt, err = db.Prepare("DELETE FROM protocolExchanges WHERE manifestID = ?")
+	if err != nil {
+		glog.Error("Unable to prepare deleteManifestExchanges ", err)
+		d.Close()
+		return nil, err
+	}
+	d.deleteManifestExchanges = stmt
 
 	// Insert block header
 	stmt, err = db.Prepare("INSERT INTO blockheaders(number, parent, hash, logs) VALUES(?, ?, ?, ?)")
@@ -264,6 +687,20 @@ func InitDB(dbPath string) (*DB, error) {
 	return &d, nil
 }
 
+// Ping checks that the database can be queried
+func (db *DB) Ping() error {
+	var one int
+	return db.dbh.QueryRow("SELECT 1").Scan(&one)
+}
+
+// Backup writes a consistent copy of the database to a new file, while the database may be in use
+func (db *DB) Backup(path string) error {
+	if _, err := db.dbh.Exec("VACUUM INTO ?", path); err != nil {
+		return errors.Wrapf(err, "failed backing up the database to: %v", path)
+	}
+	return nil
+}
+
 func (db *DB) Close() {
 	glog.V(DEBUG).Info("Closing DB")
 	if db.updateOrch != nil {
@@ -275,6 +712,12 @@ func (db *DB) Close() {
 	if db.updateKV != nil {
 		db.updateKV.Close()
 	}
+	if db.storeKV != nil {
+		db.storeKV.Close()
+	}
+	if db.selectKV != nil {
+		db.selectKV.Close()
+	}
 	if db.insertUnbondingLock != nil {
 		db.insertUnbondingLock.Close()
 	}
@@ -293,6 +736,93 @@ func (db *DB) Close() {
 	if db.insertWinningTicket != nil {
 		db.insertWinningTicket.Close()
 	}
+	if db.selectTicketSenders != nil {
+		db.selectTicketSenders.Close()
+	}
+	if db.storeSenderNonce != nil {
+		db.storeSenderNonce.Close()
+	}
+	if db.selectSenderNonce != nil {
+		db.selectSenderNonce.Close()
+	}
+	if db.updateRecipientNonce != nil {
+		db.updateRecipientNonce.Close()
+	}
+	if db.selectRecipientNonce != nil {
+		db.selectRecipientNonce.Close()
+	}
+	if db.deleteRecipientNonce != nil {
+		db.deleteRecipientNonce.Close()
+	}
+	if db.insertInvalidRecipientRand != nil {
+		db.insertInvalidRecipientRand.Close()
+	}
+	if db.selectInvalidRecipientRand != nil {
+		db.selectInvalidRecipientRand.Close()
+	}
+	if db.storeSenderSession != nil {
+		db.storeSenderSession.Close()
+	}
+	if db.selectSenderSession != nil {
+		db.selectSenderSession.Close()
+	}
+	if db.storeBroadcastPMSession != nil {
+		db.storeBroadcastPMSession.Close()
+	}
+	if db.selectBroadcastPMSession != nil {
+		db.selectBroadcastPMSession.Close()
+	}
+	if db.storeOrchStats != nil {
+		db.storeOrchStats.Close()
+	}
+	if db.selectOrchStats != nil {
+		db.selectOrchStats.Close()
+	}
+	if db.insertOrchListEntry != nil {
+		db.insertOrchListEntry.Close()
+	}
+	if db.deleteOrchListEntry != nil {
+		db.deleteOrchListEntry.Close()
+	}
+	if db.selectOrchListEntries != nil {
+		db.selectOrchListEntries.Close()
+	}
+	if db.insertBroadcastPayment != nil {
+		db.insertBroadcastPayment.Close()
+	}
+	if db.selectBroadcastPayments != nil {
+		db.selectBroadcastPayments.Close()
+	}
+	if db.insertTicketRedemption != nil {
+		db.insertTicketRedemption.Close()
+	}
+	if db.selectTicketRedemptions != nil {
+		db.selectTicketRedemptions.Close()
+	}
+	if db.deleteTicketRedemption != nil {
+		db.deleteTicketRedemption.Close()
+	}
+	if db.insertProtocolExchange != nil {
+		db.insertProtocolExchange.Close()
+	}
+	if db.selectProtocolExchange != nil {
+		db.selectProtocolExchange.Close()
+	}
+	if db.selectProtocolExchanges != nil {
+		db.selectProtocolExchanges.Close()
+	}
+	if db.deleteProtocolExchanges != nil {
+		db.deleteProtocolExchanges.Close()
+	}
+	if db.selectExchangeManifestIDs != nil {
+		db.selectExchangeManifestIDs.Close()
+	}
+	if db.selectManifestExchanges != nil {
+		db.selectManifestExchanges.Close()
+	}
+	if db.deleteManifestExchanges != nil {
+		db.deleteManifestExchanges.Close()
+	}
 	if db.insertMiniHeader != nil {
 		db.insertMiniHeader.Close()
 	}
@@ -364,10 +894,10 @@ func (db *DB) SelectOrchs(filter *DBOrchFilter) ([]*DBOrch, error) {
 }
 
 func (db *DB) InsertUnbondingLock(id *big.Int, delegator ethcommon.Address, amount, withdrawRound *big.Int) error {
-	glog.V(DEBUG).Infof("db: Inserting unbonding lock %v for delegator %v", id, delegator.Hex())
+	glog.V(DEBUG).Infof("db: Inserting unbonding lock %v for delegator %v", id, monitor.RedactAddress(delegator))
 	_, err := db.insertUnbondingLock.Exec(id.Int64(), delegator.Hex(), amount.String(), withdrawRound.Int64())
 	if err != nil {
-		glog.Errorf("db: Error inserting unbonding lock %v for delegator %v: %v", id, delegator.Hex(), err)
+		glog.Errorf("db: Error inserting unbonding lock %v for delegator %v: %v", id, monitor.RedactAddress(delegator), err)
 		return err
 	}
 	return nil
@@ -376,10 +906,10 @@ func (db *DB) InsertUnbondingLock(id *big.Int, delegator ethcommon.Address, amou
 // DeleteUnbondingLock deletes an unbonding lock from the DB with the given ID and delegator address.
 // This method will return nil for non-existent unbonding locks
 func (db *DB) DeleteUnbondingLock(id *big.Int, delegator ethcommon.Address) error {
-	glog.V(DEBUG).Infof("db: Deleting unbonding lock %v for delegator %v", id, delegator.Hex())
+	glog.V(DEBUG).Infof("db: Deleting unbonding lock %v for delegator %v", id, monitor.RedactAddress(delegator))
 	_, err := db.deleteUnbondingLock.Exec(id.Int64(), delegator.Hex())
 	if err != nil {
-		glog.Errorf("db: Error deleting unbonding lock %v for delegator %v: %v", id, delegator.Hex(), err)
+		glog.Errorf("db: Error deleting unbonding lock %v for delegator %v: %v", id, monitor.RedactAddress(delegator), err)
 		return err
 	}
 	return nil
@@ -388,7 +918,7 @@ func (db *DB) DeleteUnbondingLock(id *big.Int, delegator ethcommon.Address) erro
 // UseUnbondingLock sets an unbonding lock in the DB as used by setting the lock's used block.
 // If usedBlock is nil this method will set the lock's used block to NULL
 func (db *DB) UseUnbondingLock(id *big.Int, delegator ethcommon.Address, usedBlock *big.Int) error {
-	glog.V(DEBUG).Infof("db: Using unbonding lock %v for delegator %v", id, delegator.Hex())
+	glog.V(DEBUG).Infof("db: Using unbonding lock %v for delegator %v", id, monitor.RedactAddress(delegator))
 
 	var err error
 	if usedBlock == nil {
@@ -397,7 +927,7 @@ func (db *DB) UseUnbondingLock(id *big.Int, delegator ethcommon.Address, usedBlo
 		_, err = db.useUnbondingLock.Exec(usedBlock.Int64(), id.Int64(), delegator.Hex())
 	}
 	if err != nil {
-		glog.Errorf("db: Error using unbonding lock %v for delegator %v: %v", id, delegator.Hex(), err)
+		glog.Errorf("db: Error using unbonding lock %v for delegator %v: %v", id, monitor.RedactAddress(delegator), err)
 		return err
 	}
 	return nil
@@ -479,7 +1009,7 @@ func (db *DB) StoreWinningTicket(sessionID string, ticket *pm.Ticket, sig []byte
 	if recipientRand == nil {
 		return errors.New("cannot store nil recipientRand")
 	}
-	glog.V(DEBUG).Infof("db: Inserting winning ticket from %v, recipientRand %d, senderNonce %d", ticket.Sender.Hex(), recipientRand, ticket.SenderNonce)
+	glog.V(DEBUG).Infof("db: Inserting winning ticket from %v, recipientRand %d, senderNonce %d", monitor.RedactAddress(ticket.Sender), recipientRand, ticket.SenderNonce)
 
 	_, err := db.insertWinningTicket.Exec(ticket.Sender.Hex(), ticket.Recipient.Hex(), ticket.FaceValue.Bytes(), ticket.WinProb.Bytes(), ticket.SenderNonce, recipientRand.Bytes(), ticket.RecipientRandHash.Hex(), sig, sessionID)
 
@@ -489,6 +1019,25 @@ func (db *DB) StoreWinningTicket(sessionID string, ticket *pm.Ticket, sig []byte
 	return nil
 }
 
+// TicketSenders returns the senders of the winning tickets that were received from the unix time since
+func (db *DB) TicketSenders(since int64) ([]ethcommon.Address, error) {
+	rows, err := db.selectTicketSenders.Query(since)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed loading ticket senders")
+	}
+	defer rows.Close()
+
+	var senders []ethcommon.Address
+	for rows.Next() {
+		var sender string
+		if err := rows.Scan(&sender); err != nil {
+			return nil, errors.Wrap(err, "failed loading ticket senders")
+		}
+		senders = append(senders, ethcommon.HexToAddress(sender))
+	}
+	return senders, rows.Err()
+}
+
 func (db *DB) LoadWinningTickets(sessionIDs []string) (tickets []*pm.Ticket, sigs [][]byte, recipientRands []*big.Int, err error) {
 	rows, err := db.dbh.Query(buildWinningTicketsQuery(sessionIDs))
 	defer rows.Close()
@@ -527,6 +1076,521 @@ func (db *DB) LoadWinningTickets(sessionIDs []string) (tickets []*pm.Ticket, sig
 	return
 }
 
+// StoreSenderNonce persists the highest senderNonce used for a PM session.
+// A senderNonce lower than the one already stored for the session is ignored
+func (db *DB) StoreSenderNonce(sessionID string, senderNonce uint32) error {
+	glog.V(DEBUG).Infof("db: Storing senderNonce %v for session %v", senderNonce, sessionID)
+	_, err := db.storeSenderNonce.Exec(sessionID, senderNonce)
+	if err != nil {
+		return errors.Wrapf(err, "failed storing senderNonce for sessionID: %v", sessionID)
+	}
+	return nil
+}
+
+// LoadSenderNonce returns the highest senderNonce used for a PM session or 0 if there is none
+func (db *DB) LoadSenderNonce(sessionID string) (uint32, error) {
+	var senderNonce uint32
+	err := db.selectSenderNonce.QueryRow(sessionID).Scan(&senderNonce)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed loading senderNonce for sessionID: %v", sessionID)
+	}
+	return senderNonce, nil
+}
+
+// UpdateRecipientNonce stores senderNonce as the highest senderNonce received for a recipientRand.
+// If it isn't higher than the one already stored, false is returned with the stored senderNonce
+func (db *DB) UpdateRecipientNonce(recipientRand *big.Int, senderNonce uint32) (bool, uint32, error) {
+	res, err := db.updateRecipientNonce.Exec(recipientRand.String(), senderNonce)
+	if err != nil {
+		return false, 0, errors.Wrapf(err, "failed updating senderNonce for recipientRand: %v", recipientRand)
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		return true, senderNonce, nil
+	}
+
+	var highest uint32
+	if err := db.selectRecipientNonce.QueryRow(recipientRand.String()).Scan(&highest); err != nil {
+		return false, 0, errors.Wrapf(err, "failed loading senderNonce for recipientRand: %v", recipientRand)
+	}
+	return false, highest, nil
+}
+
+// ClearRecipientNonce removes the senderNonce stored for a recipientRand
+func (db *DB) ClearRecipientNonce(recipientRand *big.Int) error {
+	if _, err := db.deleteRecipientNonce.Exec(recipientRand.String()); err != nil {
+		return errors.Wrapf(err, "failed clearing senderNonce for recipientRand: %v", recipientRand)
+	}
+	return nil
+}
+
+// InvalidateRecipientRand stores a recipientRand as revealed
+func (db *DB) InvalidateRecipientRand(recipientRand *big.Int) error {
+	glog.V(DEBUG).Infof("db: Invalidating recipientRand %v", recipientRand)
+	if _, err := db.insertInvalidRecipientRand.Exec(recipientRand.String()); err != nil {
+		return errors.Wrapf(err, "failed invalidating recipientRand: %v", recipientRand)
+	}
+	return nil
+}
+
+// IsValidRecipientRand returns whether a recipientRand has not been stored as revealed
+func (db *DB) IsValidRecipientRand(recipientRand *big.Int) (bool, error) {
+	var count int
+	if err := db.selectInvalidRecipientRand.QueryRow(recipientRand.String()).Scan(&count); err != nil {
+		return false, errors.Wrapf(err, "failed loading recipientRand: %v", recipientRand)
+	}
+	return count == 0, nil
+}
+
+// StoreSenderSession persists the state of a PM session
+func (db *DB) StoreSenderSession(sessionID string, state *pm.SenderSessionState) error {
+	if state == nil {
+		return errors.New("cannot store nil session state")
+	}
+
+	var (
+		creationRound          int64
+		creationRoundBlockHash string
+		evSent                 = "0"
+	)
+	if state.ExpirationParams != nil {
+		creationRound = state.ExpirationParams.CreationRound
+		creationRoundBlockHash = state.ExpirationParams.CreationRoundBlockHash.Hex()
+	}
+	if state.EVSent != nil {
+		evSent = state.EVSent.RatString()
+	}
+
+	params := state.TicketParams
+	_, err := db.storeSenderSession.Exec(
+		sessionID,
+		params.Recipient.Hex(),
+		bigIntBytes(params.FaceValue),
+		bigIntBytes(params.WinProb),
+		params.RecipientRandHash.Hex(),
+		bigIntBytes(params.Seed),
+		creationRound,
+		creationRoundBlockHash,
+		state.SenderNonce,
+		state.TicketsSent,
+		evSent,
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed storing state for sessionID: %v", sessionID)
+	}
+	return nil
+}
+
+// LoadSenderSession returns the persisted state of a PM session or nil if there is none
+func (db *DB) LoadSenderSession(sessionID string) (*pm.SenderSessionState, error) {
+	var (
+		recipient, recipientRandHash, creationRoundBlockHash, evSent string
+		faceValue, winProb, seed                                     []byte
+		creationRound, ticketsSent                                   int64
+		senderNonce                                                  uint32
+	)
+	err := db.selectSenderSession.QueryRow(sessionID).Scan(&recipient, &faceValue, &winProb, &recipientRandHash, &seed, &creationRound, &creationRoundBlockHash, &senderNonce, &ticketsSent, &evSent)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed loading state for sessionID: %v", sessionID)
+	}
+
+	ev, ok := new(big.Rat).SetString(evSent)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert evSent %v to big rat for sessionID: %v", evSent, sessionID)
+	}
+
+	state := &pm.SenderSessionState{
+		TicketParams: pm.TicketParams{
+			Recipient:         ethcommon.HexToAddress(recipient),
+			FaceValue:         new(big.Int).SetBytes(faceValue),
+			WinProb:           new(big.Int).SetBytes(winProb),
+			RecipientRandHash: ethcommon.HexToHash(recipientRandHash),
+			Seed:              new(big.Int).SetBytes(seed),
+		},
+		SenderNonce: senderNonce,
+		TicketsSent: ticketsSent,
+		EVSent:      ev,
+	}
+	if creationRoundBlockHash != "" {
+		state.ExpirationParams = &pm.TicketExpirationParams{
+			CreationRound:          creationRound,
+			CreationRoundBlockHash: ethcommon.HexToHash(creationRoundBlockHash),
+		}
+	}
+	return state, nil
+}
+
+// StoreKV stores the value of a key of the kv table
+func (db *DB) StoreKV(key, value string) error {
+	_, err := db.storeKV.Exec(key, value)
+	if err != nil {
+		return errors.Wrapf(err, "failed storing key: %v", key)
+	}
+	return nil
+}
+
+// KV returns the value of a key of the kv table or an empty string if the key is not set
+func (db *DB) KV(key string) (string, error) {
+	var value string
+	err := db.selectKV.QueryRow(key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "failed loading key: %v", key)
+	}
+	return value, nil
+}
+
+// Key of the kv table of the ID of the chain that the node of the database is connected to
+const chainIDKey = "chainID"
+
+// CheckChainID stores the ID of the chain that the node is connected to, or returns an error if the
+// database belongs to a node of another chain, e.g. after it was imported on a node of another network
+func (db *DB) CheckChainID(chainID *big.Int) error {
+	stored, err := db.KV(chainIDKey)
+	if err != nil {
+		return err
+	}
+	if stored == "" {
+		return db.StoreKV(chainIDKey, chainID.String())
+	}
+	if stored != chainID.String() {
+		return fmt.Errorf("database belongs to a node of chain %v, not %v", stored, chainID)
+	}
+	return nil
+}
+
+// ChainID returns the ID of the chain stored by CheckChainID or an empty string if the node
+// has not connected to a chain
+func (db *DB) ChainID() (string, error) {
+	return db.KV(chainIDKey)
+}
+
+// StoreBroadcastPMSession records the PM session used by a broadcaster to pay an orchestrator for a stream
+func (db *DB) StoreBroadcastPMSession(manifestID, orchestrator, sessionID string) error {
+	_, err := db.storeBroadcastPMSession.Exec(manifestID, orchestrator, sessionID)
+	if err != nil {
+		return errors.Wrapf(err, "failed storing PM session for manifestID: %v orchestrator: %v", manifestID, orchestrator)
+	}
+	return nil
+}
+
+// BroadcastPMSession returns the PM session last used by a broadcaster to pay an orchestrator
+// for a stream or an empty string if there is none
+func (db *DB) BroadcastPMSession(manifestID, orchestrator string) (string, error) {
+	var sessionID string
+	err := db.selectBroadcastPMSession.QueryRow(manifestID, orchestrator).Scan(&sessionID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "failed loading PM session for manifestID: %v orchestrator: %v", manifestID, orchestrator)
+	}
+	return sessionID, nil
+}
+
+// StoreOrchestratorStats persists the statistics of an orchestrator
+func (db *DB) StoreOrchestratorStats(stats *DBOrchStats) error {
+	if stats == nil {
+		return errors.New("cannot store nil orchestrator stats")
+	}
+	latencies, err := json.Marshal(stats.LatenciesMs)
+	if err != nil {
+		return err
+	}
+	prices, err := json.Marshal(stats.Prices)
+	if err != nil {
+		return err
+	}
+	_, err = db.storeOrchStats.Exec(stats.Orchestrator, stats.Segments, stats.Failures, stats.VerificationFailures, string(latencies), string(prices))
+	if err != nil {
+		return errors.Wrapf(err, "failed storing stats for orchestrator: %v", stats.Orchestrator)
+	}
+	return nil
+}
+
+// OrchestratorStats returns the persisted statistics of every orchestrator
+func (db *DB) OrchestratorStats() ([]*DBOrchStats, error) {
+	rows, err := db.selectOrchStats.Query()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed loading orchestrator stats")
+	}
+	defer rows.Close()
+
+	var all []*DBOrchStats
+	for rows.Next() {
+		var (
+			stats             DBOrchStats
+			latencies, prices string
+		)
+		if err := rows.Scan(&stats.Orchestrator, &stats.Segments, &stats.Failures, &stats.VerificationFailures, &latencies, &prices); err != nil {
+			return nil, errors.Wrap(err, "failed loading orchestrator stats")
+		}
+		if err := json.Unmarshal([]byte(latencies), &stats.LatenciesMs); err != nil {
+			return nil, errors.Wrapf(err, "failed decoding latencies for orchestrator: %v", stats.Orchestrator)
+		}
+		if err := json.Unmarshal([]byte(prices), &stats.Prices); err != nil {
+			return nil, errors.Wrapf(err, "failed decoding prices for orchestrator: %v", stats.Orchestrator)
+		}
+		all = append(all, &stats)
+	}
+	return all, rows.Err()
+}
+
+// InsertOrchestratorListEntry adds a pattern to an orchestrator list. Patterns already in the list are ignored
+func (db *DB) InsertOrchestratorListEntry(entry DBOrchListEntry) error {
+	if _, err := db.insertOrchListEntry.Exec(entry.List, entry.Pattern); err != nil {
+		return errors.Wrapf(err, "failed inserting orchestrator list entry list=%v pattern=%v", entry.List, entry.Pattern)
+	}
+	return nil
+}
+
+// DeleteOrchestratorListEntry removes a pattern from an orchestrator list and returns whether it was in the list
+func (db *DB) DeleteOrchestratorListEntry(entry DBOrchListEntry) (bool, error) {
+	res, err := db.deleteOrchListEntry.Exec(entry.List, entry.Pattern)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed deleting orchestrator list entry list=%v pattern=%v", entry.List, entry.Pattern)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// OrchestratorListEntries returns the patterns of all the orchestrator lists in the order they were added
+func (db *DB) OrchestratorListEntries() ([]DBOrchListEntry, error) {
+	rows, err := db.selectOrchListEntries.Query()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed loading orchestrator lists")
+	}
+	defer rows.Close()
+
+	var entries []DBOrchListEntry
+	for rows.Next() {
+		var entry DBOrchListEntry
+		if err := rows.Scan(&entry.List, &entry.Pattern); err != nil {
+			return nil, errors.Wrap(err, "failed loading orchestrator lists")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// InsertBroadcastPayment persists a batch of tickets that the broadcaster sent
+func (db *DB) InsertBroadcastPayment(payment *DBBroadcastPayment) error {
+	if payment == nil || payment.EV == nil || payment.PricePerPixel == nil {
+		return errors.New("cannot insert incomplete broadcast payment")
+	}
+	_, err := db.insertBroadcastPayment.Exec(payment.ManifestID, payment.Recipient.Hex(), payment.Tickets, payment.EV.RatString(), payment.PricePerPixel.RatString(), payment.Time)
+	if err != nil {
+		return errors.Wrapf(err, "failed inserting broadcast payment manifestID=%v recipient=%v", payment.ManifestID, payment.Recipient.Hex())
+	}
+	return nil
+}
+
+// BroadcastPayments returns the payments that the broadcaster sent from the unix time since to the
+// unix time until included, oldest first
+func (db *DB) BroadcastPayments(since, until int64) ([]*DBBroadcastPayment, error) {
+	rows, err := db.selectBroadcastPayments.Query(since, until)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed loading broadcast payments")
+	}
+	defer rows.Close()
+
+	var payments []*DBBroadcastPayment
+	for rows.Next() {
+		var (
+			payment                      DBBroadcastPayment
+			recipient, ev, pricePerPixel string
+			ok                           bool
+		)
+		if err := rows.Scan(&payment.ManifestID, &recipient, &payment.Tickets, &ev, &pricePerPixel, &payment.Time); err != nil {
+			return nil, errors.Wrap(err, "failed loading broadcast payments")
+		}
+		payment.Recipient = ethcommon.HexToAddress(recipient)
+		if payment.EV, ok = new(big.Rat).SetString(ev); !ok {
+			return nil, fmt.Errorf("invalid EV of broadcast payment: %v", ev)
+		}
+		if payment.PricePerPixel, ok = new(big.Rat).SetString(pricePerPixel); !ok {
+			return nil, fmt.Errorf("invalid price per pixel of broadcast payment: %v", pricePerPixel)
+		}
+		payments = append(payments, &payment)
+	}
+	return payments, rows.Err()
+}
+
+// InsertProtocolExchange persists a segment exchanged with another node and returns its ID
+func (db *DB) InsertProtocolExchange(ex *DBProtocolExchange) (int64, error) {
+	if ex == nil {
+		return 0, errors.New("cannot insert nil protocol exchange")
+	}
+	payloads, err := json.Marshal(ex.Payloads)
+	if err != nil {
+		return 0, err
+	}
+	res, err := db.insertProtocolExchange.Exec(ex.Role, ex.ManifestID, ex.SeqNo, ex.Sender.Hex(), ex.Recipient.Hex(), ex.SegData, ex.Payment, ex.Result, string(payloads), ex.Time)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed inserting protocol exchange manifestID=%v seqNo=%v", ex.ManifestID, ex.SeqNo)
+	}
+	return res.LastInsertId()
+}
+
+// ProtocolExchange returns the exchange of an ID, or nil if there is none
+func (db *DB) ProtocolExchange(id int64) (*DBProtocolExchange, error) {
+	rows, err := db.selectProtocolExchange.Query(id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed loading protocol exchange id=%v", id)
+	}
+	exs, err := scanProtocolExchanges(rows)
+	if err != nil || len(exs) == 0 {
+		return nil, err
+	}
+	return exs[0], nil
+}
+
+// ProtocolExchanges returns the exchanges from the unix time since to the unix time until included,
+// oldest first
+func (db *DB) ProtocolExchanges(since, until int64) ([]*DBProtocolExchange, error) {
+	rows, err := db.selectProtocolExchanges.Query(since, until)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed loading protocol exchanges")
+	}
+	return scanProtocolExchanges(rows)
+}
+
+// DeleteProtocolExchanges deletes the exchanges before the unix time before
+func (db *DB) DeleteProtocolExchanges(before int64) error {
+	if _, err := db.deleteProtocolExchanges.Exec(before); err != nil {
+		return errors.Wrap(err, "failed deleting protocol exchanges")
+	}
+	return nil
+}
+
+// ProtocolExchangeManifestIDs returns the manifest IDs of the streams that have exchanges
+func (db *DB) ProtocolExchangeManifestIDs() ([]string, error) {
+	rows, err := db.selectExchangeManifestIDs.Query()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed loading manifest IDs of protocol exchanges")
+	}
+	defer rows.Close()
+
+	var mids []string
+	for rows.Next() {
+		var mid string
+		if err := rows.Scan(&mid); err != nil {
+			return nil, errors.Wrap(err, "failed loading manifest IDs of protocol exchanges")
+		}
+		mids = append(mids, mid)
+	}
+	return mids, rows.Err()
+}
+
+// ManifestProtocolExchanges returns the exchanges of the stream of a manifest ID, oldest first
+func (db *DB) ManifestProtocolExchanges(manifestID string) ([]*DBProtocolExchange, error) {
+	rows, err := db.selectManifestExchanges.Query(manifestID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed loading protocol exchanges manifestID=%v", manifestID)
+	}
+	return scanProtocolExchanges(rows)
+}
+
+// DeleteManifestProtocolExchanges deletes the exchanges of the stream of a manifest ID
+func (db *DB) DeleteManifestProtocolExchanges(manifestID string) error {
+	if _, err := db.deleteManifestExchanges.Exec(manifestID); err != nil {
+		return errors.Wrapf(err, "failed deleting protocol exchanges manifestID=%v", manifestID)
+	}
+	return nil
+}
+
+func scanProtocolExchanges(rows *sql.Rows) ([]*DBProtocolExchange, error) {
+	defer rows.Close()
+
+	var exs []*DBProtocolExchange
+	for rows.Next() {
+		var (
+			ex                          DBProtocolExchange
+			sender, recipient, payloads string
+		)
+		if err := rows.Scan(&ex.ID, &ex.Role, &ex.ManifestID, &ex.SeqNo, &sender, &recipient, &ex.SegData, &ex.Payment, &ex.Result, &payloads, &ex.Time); err != nil {
+			return nil, errors.Wrap(err, "failed loading protocol exchanges")
+		}
+		ex.Sender = ethcommon.HexToAddress(sender)
+		ex.Recipient = ethcommon.HexToAddress(recipient)
+		if err := json.Unmarshal([]byte(payloads), &ex.Payloads); err != nil {
+			return nil, errors.Wrapf(err, "failed decoding payloads of protocol exchange id=%v", ex.ID)
+		}
+		exs = append(exs, &ex)
+	}
+	return exs, rows.Err()
+}
+
+// InsertTicketRedemption persists a winning ticket of the broadcaster that was redeemed
+func (db *DB) InsertTicketRedemption(redemption *DBTicketRedemption) error {
+	if redemption == nil || redemption.Amount == nil {
+		return errors.New("cannot insert incomplete ticket redemption")
+	}
+	_, err := db.insertTicketRedemption.Exec(redemption.Recipient.Hex(), redemption.Amount.String(), redemption.Time)
+	if err != nil {
+		return errors.Wrapf(err, "failed inserting ticket redemption recipient=%v", redemption.Recipient.Hex())
+	}
+	return nil
+}
+
+// TicketRedemptions returns the winning tickets of the broadcaster that were redeemed from the unix
+// time since to the unix time until included, oldest first
+func (db *DB) TicketRedemptions(since, until int64) ([]*DBTicketRedemption, error) {
+	rows, err := db.selectTicketRedemptions.Query(since, until)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed loading ticket redemptions")
+	}
+	defer rows.Close()
+
+	var redemptions []*DBTicketRedemption
+	for rows.Next() {
+		var (
+			redemption        DBTicketRedemption
+			recipient, amount string
+			ok                bool
+		)
+		if err := rows.Scan(&recipient, &amount, &redemption.Time); err != nil {
+			return nil, errors.Wrap(err, "failed loading ticket redemptions")
+		}
+		redemption.Recipient = ethcommon.HexToAddress(recipient)
+		if redemption.Amount, ok = new(big.Int).SetString(amount, 10); !ok {
+			return nil, fmt.Errorf("invalid amount of ticket redemption: %v", amount)
+		}
+		redemptions = append(redemptions, &redemption)
+	}
+	return redemptions, rows.Err()
+}
+
+// DeleteTicketRedemption deletes the last winning ticket with a face value of amount that the
+// recipient redeemed, when its redemption is reverted by a re-org
+func (db *DB) DeleteTicketRedemption(recipient ethcommon.Address, amount *big.Int) error {
+	if amount == nil {
+		return errors.New("cannot delete ticket redemption without amount")
+	}
+	_, err := db.deleteTicketRedemption.Exec(recipient.Hex(), amount.String())
+	if err != nil {
+		return errors.Wrapf(err, "failed deleting ticket redemption recipient=%v", recipient.Hex())
+	}
+	return nil
+}
+
+func bigIntBytes(x *big.Int) []byte {
+	if x == nil {
+		return []byte{}
+	}
+	return x.Bytes()
+}
+
 // We are building a query string instead of using a prepared statement because prepared statements don't
 // support IN queries. We want to use IN for the performance benefit, rather than running len(sessionIDs)
 // queries.
@@ -640,6 +1704,31 @@ func (db *DB) DeleteMiniHeader(hash ethcommon.Hash) error {
 	return nil
 }
 
+// Key of the kv table of the number of the last block confirmed by the block watcher
+const confirmedBlockKey = "confirmedBlock"
+
+// FindConfirmedBlockNumber returns the number of the last block whose events the block watcher
+// emitted after it was confirmed, or nil if no block was confirmed yet
+func (db *DB) FindConfirmedBlockNumber() (*big.Int, error) {
+	value, err := db.KV(confirmedBlockKey)
+	if err != nil || value == "" {
+		return nil, err
+	}
+	number, ok := new(big.Int).SetString(value, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid confirmed block number: %v", value)
+	}
+	return number, nil
+}
+
+// UpdateConfirmedBlockNumber stores the number of the last block confirmed by the block watcher
+func (db *DB) UpdateConfirmedBlockNumber(number *big.Int) error {
+	if number == nil {
+		return errors.New("no block number found")
+	}
+	return db.StoreKV(confirmedBlockKey, number.String())
+}
+
 func encodeLogsJSON(logs []types.Log) ([]byte, error) {
 	logsEnc, err := json.Marshal(logs)
 	if err != nil {
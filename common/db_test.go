@@ -7,6 +7,7 @@ import (
 	"math/big"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	ethcommon "github.com/ethereum/go-ethereum/common"
@@ -580,6 +581,445 @@ func TestLoadWinningTicket_GivenStoredTicket_LoadsItCorrectly(t *testing.T) {
 	assert.Equal(recipientRand, actualRecipientRand)
 }
 
+func TestStoreLoadSenderNonce(t *testing.T) {
+	dbh, dbraw, err := TempDB(t)
+	defer dbh.Close()
+	defer dbraw.Close()
+	require := require.New(t)
+	require.Nil(err)
+	assert := assert.New(t)
+
+	// Nonexistent session returns 0
+	nonce, err := dbh.LoadSenderNonce("foo")
+	assert.Nil(err)
+	assert.Equal(uint32(0), nonce)
+
+	err = dbh.StoreSenderNonce("foo", 5)
+	require.Nil(err)
+	nonce, err = dbh.LoadSenderNonce("foo")
+	assert.Nil(err)
+	assert.Equal(uint32(5), nonce)
+
+	// Lower senderNonce is ignored
+	err = dbh.StoreSenderNonce("foo", 3)
+	require.Nil(err)
+	nonce, err = dbh.LoadSenderNonce("foo")
+	assert.Nil(err)
+	assert.Equal(uint32(5), nonce)
+
+	// Higher senderNonce is stored
+	err = dbh.StoreSenderNonce("foo", math.MaxUint32)
+	require.Nil(err)
+	nonce, err = dbh.LoadSenderNonce("foo")
+	assert.Nil(err)
+	assert.Equal(uint32(math.MaxUint32), nonce)
+
+	// Sessions are independent
+	nonce, err = dbh.LoadSenderNonce("bar")
+	assert.Nil(err)
+	assert.Equal(uint32(0), nonce)
+}
+
+func TestRecipientState(t *testing.T) {
+	dbh, dbraw, err := TempDB(t)
+	defer dbh.Close()
+	defer dbraw.Close()
+	require := require.New(t)
+	require.Nil(err)
+	assert := assert.New(t)
+
+	// The DB can be shared by recipients
+	var _ pm.RecipientStateStore = dbh
+
+	rand := big.NewInt(1234)
+	ok, nonce, err := dbh.UpdateRecipientNonce(rand, 0)
+	assert.Nil(err)
+	assert.True(ok)
+	assert.Equal(uint32(0), nonce)
+
+	ok, nonce, err = dbh.UpdateRecipientNonce(rand, 5)
+	assert.Nil(err)
+	assert.True(ok)
+	assert.Equal(uint32(5), nonce)
+
+	// Lower or equal senderNonces are rejected
+	for _, n := range []uint32{5, 3} {
+		ok, nonce, err = dbh.UpdateRecipientNonce(rand, n)
+		assert.Nil(err)
+		assert.False(ok)
+		assert.Equal(uint32(5), nonce)
+	}
+
+	// Higher senderNonce is stored
+	ok, nonce, err = dbh.UpdateRecipientNonce(rand, math.MaxUint32)
+	assert.Nil(err)
+	assert.True(ok)
+	assert.Equal(uint32(math.MaxUint32), nonce)
+
+	// recipientRands are independent
+	ok, _, err = dbh.UpdateRecipientNonce(big.NewInt(5678), 1)
+	assert.Nil(err)
+	assert.True(ok)
+
+	require.Nil(dbh.ClearRecipientNonce(rand))
+	ok, _, err = dbh.UpdateRecipientNonce(rand, 1)
+	assert.Nil(err)
+	assert.True(ok)
+
+	valid, err := dbh.IsValidRecipientRand(rand)
+	assert.Nil(err)
+	assert.True(valid)
+	require.Nil(dbh.InvalidateRecipientRand(rand))
+	// Invalidating twice is not an error
+	require.Nil(dbh.InvalidateRecipientRand(rand))
+	valid, err = dbh.IsValidRecipientRand(rand)
+	assert.Nil(err)
+	assert.False(valid)
+	valid, err = dbh.IsValidRecipientRand(big.NewInt(5678))
+	assert.Nil(err)
+	assert.True(valid)
+}
+
+func TestStoreLoadSenderSession(t *testing.T) {
+	dbh, dbraw, err := TempDB(t)
+	defer dbh.Close()
+	defer dbraw.Close()
+	require := require.New(t)
+	require.Nil(err)
+	assert := assert.New(t)
+
+	// Nonexistent session returns nil
+	state, err := dbh.LoadSenderSession("foo")
+	assert.Nil(err)
+	assert.Nil(state)
+
+	err = dbh.StoreSenderSession("foo", nil)
+	assert.EqualError(err, "cannot store nil session state")
+
+	// Session without tickets
+	expected := &pm.SenderSessionState{
+		TicketParams: pm.TicketParams{
+			Recipient:         pm.RandAddress(),
+			FaceValue:         big.NewInt(1234),
+			WinProb:           big.NewInt(5678),
+			RecipientRandHash: pm.RandHash(),
+			Seed:              big.NewInt(9999),
+		},
+		EVSent: big.NewRat(0, 1),
+	}
+	err = dbh.StoreSenderSession("foo", expected)
+	require.Nil(err)
+	state, err = dbh.LoadSenderSession("foo")
+	require.Nil(err)
+	assert.Equal(expected.TicketParams, state.TicketParams)
+	assert.Nil(state.ExpirationParams)
+	assert.Zero(expected.EVSent.Cmp(state.EVSent))
+
+	// Session with tickets
+	expected.ExpirationParams = &pm.TicketExpirationParams{
+		CreationRound:          5,
+		CreationRoundBlockHash: pm.RandHash(),
+	}
+	expected.SenderNonce = 10
+	expected.TicketsSent = 10
+	expected.EVSent = big.NewRat(7, 3)
+	err = dbh.StoreSenderSession("foo", expected)
+	require.Nil(err)
+	state, err = dbh.LoadSenderSession("foo")
+	require.Nil(err)
+	assert.Equal(expected.ExpirationParams, state.ExpirationParams)
+	assert.Equal(uint32(10), state.SenderNonce)
+	assert.Equal(int64(10), state.TicketsSent)
+	assert.Zero(expected.EVSent.Cmp(state.EVSent))
+}
+
+func TestStoreBroadcastPMSession(t *testing.T) {
+	dbh, dbraw, err := TempDB(t)
+	defer dbh.Close()
+	defer dbraw.Close()
+	require := require.New(t)
+	require.Nil(err)
+	assert := assert.New(t)
+
+	sessionID, err := dbh.BroadcastPMSession("mid", "orch")
+	assert.Nil(err)
+	assert.Equal("", sessionID)
+
+	require.Nil(dbh.StoreBroadcastPMSession("mid", "orch", "foo"))
+	sessionID, err = dbh.BroadcastPMSession("mid", "orch")
+	assert.Nil(err)
+	assert.Equal("foo", sessionID)
+
+	// Sessions are replaced
+	require.Nil(dbh.StoreBroadcastPMSession("mid", "orch", "bar"))
+	sessionID, err = dbh.BroadcastPMSession("mid", "orch")
+	assert.Nil(err)
+	assert.Equal("bar", sessionID)
+
+	// Sessions are specific to a stream and orchestrator
+	sessionID, err = dbh.BroadcastPMSession("mid", "other orch")
+	assert.Nil(err)
+	assert.Equal("", sessionID)
+}
+
+func TestStoreKV(t *testing.T) {
+	dbh, dbraw, err := TempDB(t)
+	defer dbh.Close()
+	defer dbraw.Close()
+	require := require.New(t)
+	require.Nil(err)
+	assert := assert.New(t)
+
+	value, err := dbh.KV("foo")
+	assert.Nil(err)
+	assert.Equal("", value)
+
+	require.Nil(dbh.StoreKV("foo", "bar"))
+	value, err = dbh.KV("foo")
+	assert.Nil(err)
+	assert.Equal("bar", value)
+
+	// Values are replaced
+	require.Nil(dbh.StoreKV("foo", "baz"))
+	value, err = dbh.KV("foo")
+	assert.Nil(err)
+	assert.Equal("baz", value)
+
+	// The DB version is not affected
+	value, err = dbh.KV("dbVersion")
+	assert.Nil(err)
+	assert.NotEqual("", value)
+}
+
+func TestStoreOrchestratorStats(t *testing.T) {
+	dbh, dbraw, err := TempDB(t)
+	defer dbh.Close()
+	defer dbraw.Close()
+	require := require.New(t)
+	require.Nil(err)
+	assert := assert.New(t)
+
+	stats, err := dbh.OrchestratorStats()
+	assert.Nil(err)
+	assert.Empty(stats)
+
+	assert.NotNil(dbh.StoreOrchestratorStats(nil))
+
+	foo := &DBOrchStats{
+		Orchestrator:         "https://foo.com:8935",
+		Segments:             10,
+		Failures:             2,
+		VerificationFailures: 1,
+		LatenciesMs:          []int64{100, 200, 300},
+		Prices:               []DBOrchPrice{{PricePerPixel: "1/2", Time: 100}, {PricePerPixel: "1", Time: 200}},
+	}
+	bar := &DBOrchStats{Orchestrator: "https://bar.com:8935", Failures: 1}
+	require.Nil(dbh.StoreOrchestratorStats(foo))
+	require.Nil(dbh.StoreOrchestratorStats(bar))
+
+	stats, err = dbh.OrchestratorStats()
+	require.Nil(err)
+	require.Len(stats, 2)
+	assert.ElementsMatch([]*DBOrchStats{foo, bar}, stats)
+
+	// Stats are replaced
+	foo.Segments++
+	foo.LatenciesMs = append(foo.LatenciesMs, 400)
+	require.Nil(dbh.StoreOrchestratorStats(foo))
+	stats, err = dbh.OrchestratorStats()
+	require.Nil(err)
+	assert.ElementsMatch([]*DBOrchStats{foo, bar}, stats)
+}
+
+func TestOrchestratorListEntries(t *testing.T) {
+	dbh, dbraw, err := TempDB(t)
+	defer dbh.Close()
+	defer dbraw.Close()
+	require := require.New(t)
+	require.Nil(err)
+	assert := assert.New(t)
+
+	entries, err := dbh.OrchestratorListEntries()
+	assert.Nil(err)
+	assert.Empty(entries)
+
+	deny := DBOrchListEntry{List: "deny", Pattern: "https://*.bad.com:*"}
+	allow := DBOrchListEntry{List: "allow", Pattern: "0x0000000000000000000000000000000000000001"}
+	require.Nil(dbh.InsertOrchestratorListEntry(deny))
+	require.Nil(dbh.InsertOrchestratorListEntry(allow))
+	// Duplicate patterns are ignored
+	require.Nil(dbh.InsertOrchestratorListEntry(deny))
+	// The same pattern can be in both lists
+	require.Nil(dbh.InsertOrchestratorListEntry(DBOrchListEntry{List: "allow", Pattern: deny.Pattern}))
+
+	entries, err = dbh.OrchestratorListEntries()
+	require.Nil(err)
+	assert.ElementsMatch([]DBOrchListEntry{deny, allow, {List: "allow", Pattern: deny.Pattern}}, entries)
+
+	removed, err := dbh.DeleteOrchestratorListEntry(deny)
+	require.Nil(err)
+	assert.True(removed)
+	removed, err = dbh.DeleteOrchestratorListEntry(deny)
+	require.Nil(err)
+	assert.False(removed)
+
+	entries, err = dbh.OrchestratorListEntries()
+	require.Nil(err)
+	assert.ElementsMatch([]DBOrchListEntry{allow, {List: "allow", Pattern: deny.Pattern}}, entries)
+}
+
+func TestBroadcastPayments(t *testing.T) {
+	dbh, dbraw, err := TempDB(t)
+	defer dbh.Close()
+	defer dbraw.Close()
+	require := require.New(t)
+	require.Nil(err)
+	assert := assert.New(t)
+
+	payments, err := dbh.BroadcastPayments(0, 1000)
+	assert.Nil(err)
+	assert.Empty(payments)
+
+	assert.NotNil(dbh.InsertBroadcastPayment(nil))
+	assert.NotNil(dbh.InsertBroadcastPayment(&DBBroadcastPayment{ManifestID: "foo"}))
+
+	foo := &DBBroadcastPayment{
+		ManifestID:    "foo",
+		Recipient:     ethcommon.HexToAddress("0x0000000000000000000000000000000000000001"),
+		Tickets:       2,
+		EV:            big.NewRat(5, 2),
+		PricePerPixel: big.NewRat(1, 3),
+		Time:          100,
+	}
+	bar := &DBBroadcastPayment{
+		ManifestID:    "bar",
+		Recipient:     ethcommon.HexToAddress("0x0000000000000000000000000000000000000002"),
+		Tickets:       1,
+		EV:            big.NewRat(1, 1),
+		PricePerPixel: big.NewRat(1, 1),
+		Time:          200,
+	}
+	require.Nil(dbh.InsertBroadcastPayment(bar))
+	require.Nil(dbh.InsertBroadcastPayment(foo))
+
+	payments, err = dbh.BroadcastPayments(0, 1000)
+	require.Nil(err)
+	assert.Equal([]*DBBroadcastPayment{foo, bar}, payments)
+
+	// The window includes its start and its end
+	payments, err = dbh.BroadcastPayments(100, 199)
+	require.Nil(err)
+	assert.Equal([]*DBBroadcastPayment{foo}, payments)
+}
+
+func TestProtocolExchanges(t *testing.T) {
+	dbh, dbraw, err := TempDB(t)
+	defer dbh.Close()
+	defer dbraw.Close()
+	require := require.New(t)
+	require.Nil(err)
+	assert := assert.New(t)
+
+	exs, err := dbh.ProtocolExchanges(0, 1000)
+	assert.Nil(err)
+	assert.Empty(exs)
+	_, err = dbh.InsertProtocolExchange(nil)
+	assert.NotNil(err)
+	ex, err := dbh.ProtocolExchange(1)
+	assert.Nil(err)
+	assert.Nil(ex)
+
+	foo := &DBProtocolExchange{
+		Role:       "broadcaster",
+		ManifestID: "foo",
+		SeqNo:      1,
+		Sender:     ethcommon.HexToAddress("0x0000000000000000000000000000000000000001"),
+		Recipient:  ethcommon.HexToAddress("0x0000000000000000000000000000000000000002"),
+		SegData:    "segData",
+		Payment:    "payment",
+		Result:     []byte("result"),
+		Payloads:   []string{"archive/foo/1.ts"},
+		Time:       100,
+	}
+	bar := &DBProtocolExchange{Role: "orchestrator", ManifestID: "bar", SeqNo: 2, Result: []byte{}, Payloads: []string{}, Time: 200}
+	foo.ID, err = dbh.InsertProtocolExchange(foo)
+	require.Nil(err)
+	bar.ID, err = dbh.InsertProtocolExchange(bar)
+	require.Nil(err)
+	assert.NotEqual(foo.ID, bar.ID)
+
+	ex, err = dbh.ProtocolExchange(foo.ID)
+	require.Nil(err)
+	assert.Equal(foo, ex)
+
+	exs, err = dbh.ProtocolExchanges(0, 1000)
+	require.Nil(err)
+	assert.Equal([]*DBProtocolExchange{foo, bar}, exs)
+	exs, err = dbh.ProtocolExchanges(150, 200)
+	require.Nil(err)
+	assert.Equal([]*DBProtocolExchange{bar}, exs)
+
+	mids, err := dbh.ProtocolExchangeManifestIDs()
+	require.Nil(err)
+	assert.Equal([]string{"bar", "foo"}, mids)
+	exs, err = dbh.ManifestProtocolExchanges("foo")
+	require.Nil(err)
+	assert.Equal([]*DBProtocolExchange{foo}, exs)
+
+	// Exchanges are deleted before the time only
+	require.Nil(dbh.DeleteProtocolExchanges(200))
+	exs, err = dbh.ProtocolExchanges(0, 1000)
+	require.Nil(err)
+	assert.Equal([]*DBProtocolExchange{bar}, exs)
+
+	// The exchanges of a stream are deleted
+	require.Nil(dbh.DeleteManifestProtocolExchanges("bar"))
+	exs, err = dbh.ProtocolExchanges(0, 1000)
+	require.Nil(err)
+	assert.Empty(exs)
+	mids, err = dbh.ProtocolExchangeManifestIDs()
+	require.Nil(err)
+	assert.Empty(mids)
+}
+
+func TestTicketRedemptions(t *testing.T) {
+	dbh, dbraw, err := TempDB(t)
+	defer dbh.Close()
+	defer dbraw.Close()
+	require := require.New(t)
+	require.Nil(err)
+	assert := assert.New(t)
+
+	redemptions, err := dbh.TicketRedemptions(0, 1000)
+	assert.Nil(err)
+	assert.Empty(redemptions)
+
+	assert.NotNil(dbh.InsertTicketRedemption(nil))
+
+	foo := &DBTicketRedemption{Recipient: ethcommon.HexToAddress("0x0000000000000000000000000000000000000001"), Amount: big.NewInt(1000), Time: 100}
+	bar := &DBTicketRedemption{Recipient: ethcommon.HexToAddress("0x0000000000000000000000000000000000000002"), Amount: big.NewInt(2000), Time: 200}
+	require.Nil(dbh.InsertTicketRedemption(foo))
+	require.Nil(dbh.InsertTicketRedemption(bar))
+
+	redemptions, err = dbh.TicketRedemptions(0, 1000)
+	require.Nil(err)
+	assert.Equal([]*DBTicketRedemption{foo, bar}, redemptions)
+
+	redemptions, err = dbh.TicketRedemptions(150, 1000)
+	require.Nil(err)
+	assert.Equal([]*DBTicketRedemption{bar}, redemptions)
+
+	// The last redemption of the recipient with the amount is deleted
+	baz := &DBTicketRedemption{Recipient: foo.Recipient, Amount: big.NewInt(1000), Time: 300}
+	require.Nil(dbh.InsertTicketRedemption(baz))
+	require.Nil(dbh.DeleteTicketRedemption(foo.Recipient, big.NewInt(1000)))
+	require.Nil(dbh.DeleteTicketRedemption(bar.Recipient, big.NewInt(1)))
+	redemptions, err = dbh.TicketRedemptions(0, 1000)
+	require.Nil(err)
+	assert.Equal([]*DBTicketRedemption{foo, bar}, redemptions)
+	assert.NotNil(dbh.DeleteTicketRedemption(foo.Recipient, nil))
+}
+
 func TestLoadWinningTicket_GivenStoredTicketsFromDifferentSessions_OnlyLoadsFromSpecificSessionID(t *testing.T) {
 	dbh, dbraw, err := TempDB(t)
 	defer dbh.Close()
@@ -682,6 +1122,36 @@ func TestLoadWinningTickets_GivenTwoSessionsWithTickets_ReturnsAllTickets(t *tes
 	assert.Equal(recipientRand1, recipientRands[1])
 }
 
+func TestTicketSenders(t *testing.T) {
+	dbh, dbraw, err := TempDB(t)
+	defer dbh.Close()
+	defer dbraw.Close()
+	assert := assert.New(t)
+	require := require.New(t)
+	require.Nil(err)
+
+	senders, err := dbh.TicketSenders(0)
+	require.Nil(err)
+	assert.Empty(senders)
+
+	_, ticket0, sig0, recipientRand0 := defaultWinningTicket(t)
+	require.Nil(dbh.StoreWinningTicket("foo", ticket0, sig0, recipientRand0))
+	require.Nil(dbh.StoreWinningTicket("bar", ticket0, sig0, recipientRand0))
+	_, ticket1, sig1, recipientRand1 := defaultWinningTicket(t)
+	require.Nil(dbh.StoreWinningTicket("baz", ticket1, sig1, recipientRand1))
+	// Tickets received before the window are ignored
+	_, err = dbraw.Exec("UPDATE winningTickets SET createdAt = datetime('now', '-2 days') WHERE sessionID = 'baz'")
+	require.Nil(err)
+
+	senders, err = dbh.TicketSenders(time.Now().Add(-24 * time.Hour).Unix())
+	require.Nil(err)
+	assert.Equal([]ethcommon.Address{ticket0.Sender}, senders)
+
+	senders, err = dbh.TicketSenders(time.Now().Add(-72 * time.Hour).Unix())
+	require.Nil(err)
+	assert.ElementsMatch([]ethcommon.Address{ticket0.Sender, ticket1.Sender}, senders)
+}
+
 func TestInsertMiniHeader_ReturnsFindLatestMiniHeader(t *testing.T) {
 	dbh, dbraw, err := TempDB(t)
 	defer dbh.Close()
@@ -806,6 +1276,27 @@ func TestDeleteMiniHeader(t *testing.T) {
 	assert.Equal(headers[0].Hash, h1.Hash)
 }
 
+func TestConfirmedBlockNumber(t *testing.T) {
+	dbh, dbraw, err := TempDB(t)
+	defer dbh.Close()
+	defer dbraw.Close()
+	assert := assert.New(t)
+	require := require.New(t)
+	require.Nil(err)
+
+	number, err := dbh.FindConfirmedBlockNumber()
+	assert.Nil(err)
+	assert.Nil(number)
+
+	require.Nil(dbh.UpdateConfirmedBlockNumber(big.NewInt(100)))
+	require.Nil(dbh.UpdateConfirmedBlockNumber(big.NewInt(101)))
+	number, err = dbh.FindConfirmedBlockNumber()
+	assert.Nil(err)
+	assert.Equal(big.NewInt(101), number)
+
+	assert.EqualError(dbh.UpdateConfirmedBlockNumber(nil), "no block number found")
+}
+
 func defaultWinningTicket(t *testing.T) (sessionID string, ticket *pm.Ticket, sig []byte, recipientRand *big.Int) {
 	sessionID = "foo bar"
 	ticket = &pm.Ticket{
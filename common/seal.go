@@ -0,0 +1,84 @@
+package common
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Parameters of the scrypt key derivation of the keys that data is sealed with
+var (
+	sealScryptN = 1 << 15
+	sealScryptR = 8
+	sealScryptP = 1
+)
+
+const (
+	sealSaltSize = 32
+	sealKeySize  = 32
+)
+
+// ErrSealPassword is returned when sealed data can't be opened with a password
+var ErrSealPassword = errors.New("wrong password or corrupted data")
+
+var errNotSealed = errors.New("data not sealed with the expected header")
+
+// SealWithPassword encrypts data with a key derived from password. The sealed data starts with
+// header, which is authenticated, so that the kind of the data can be checked before opening it
+func SealWithPassword(header []byte, password string, data []byte) ([]byte, error) {
+	if password == "" {
+		return nil, errors.New("password required")
+	}
+	salt := make([]byte, sealSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := sealCipher(password, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := make([]byte, 0, len(header)+len(salt)+len(nonce)+len(data)+aead.Overhead())
+	sealed = append(append(append(sealed, header...), salt...), nonce...)
+	return aead.Seal(sealed, nonce, data, header), nil
+}
+
+// OpenWithPassword decrypts data sealed by SealWithPassword with the same header and password
+func OpenWithPassword(header []byte, password string, sealed []byte) ([]byte, error) {
+	if len(sealed) < len(header)+sealSaltSize || !bytes.Equal(sealed[:len(header)], header) {
+		return nil, errNotSealed
+	}
+	salt := sealed[len(header) : len(header)+sealSaltSize]
+	aead, err := sealCipher(password, salt)
+	if err != nil {
+		return nil, err
+	}
+	rest := sealed[len(header)+sealSaltSize:]
+	if len(rest) < aead.NonceSize() {
+		return nil, ErrSealPassword
+	}
+	data, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], header)
+	if err != nil {
+		return nil, ErrSealPassword
+	}
+	return data, nil
+}
+
+func sealCipher(password string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(password), salt, sealScryptN, sealScryptR, sealScryptP, sealKeySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
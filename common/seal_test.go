@@ -0,0 +1,36 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealWithPassword(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	header := []byte("HEADER")
+	sealed, err := SealWithPassword(header, "secret", []byte("data"))
+	require.Nil(err)
+	assert.Equal(header, sealed[:len(header)])
+	assert.NotContains(string(sealed), "data")
+
+	data, err := OpenWithPassword(header, "secret", sealed)
+	require.Nil(err)
+	assert.Equal("data", string(data))
+
+	_, err = OpenWithPassword(header, "wrong", sealed)
+	assert.Equal(ErrSealPassword, err)
+	_, err = OpenWithPassword([]byte("OTHER!"), "secret", sealed)
+	assert.Equal(errNotSealed, err)
+
+	// The header is authenticated
+	tampered := append([]byte("HEADEX"), sealed[len(header):]...)
+	_, err = OpenWithPassword([]byte("HEADEX"), "secret", tampered)
+	assert.Equal(ErrSealPassword, err)
+
+	_, err = SealWithPassword(header, "", []byte("data"))
+	assert.EqualError(err, "password required")
+}
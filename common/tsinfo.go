@@ -0,0 +1,471 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+)
+
+const tsPacketSize = 188
+const tsSyncByte = 0x47
+
+// Clock rate of MPEG-TS presentation timestamps
+const tsClockRate = 90000
+
+// Presentation timestamps are 33 bit values that wrap around
+const ptsRollover = int64(1) << 33
+
+// Maximum number of bytes of the first video frame that are scanned for the type of the frame
+const maxFirstFrameScan = 8192
+
+// MPEG-TS stream types of video codecs
+const (
+	streamTypeMPEG1 = 0x01
+	streamTypeMPEG2 = 0x02
+	streamTypeMPEG4 = 0x10
+	streamTypeH264  = 0x1b
+	streamTypeH265  = 0x24
+)
+
+// MPEG-TS stream types of audio codecs. Opus is carried as private data with a registration descriptor
+const (
+	streamTypeMPEG1Audio = 0x03
+	streamTypeMPEG2Audio = 0x04
+	streamTypeAAC        = 0x0f
+	streamTypeAACLATM    = 0x11
+	streamTypeAC3        = 0x81
+	streamTypePrivate    = 0x06
+)
+
+// ErrNoIDR is returned when an MPEG-TS segment has no IDR frame to split it at
+var ErrNoIDR = errors.New("no IDR frame in MPEG-TS segment")
+
+// TSInfo describes the video track of an MPEG-TS segment
+type TSInfo struct {
+	// Duration of the video track in seconds, including the display time of its last frame
+	Duration float64
+	// Frames is the number of video frames in the segment
+	Frames int
+	// StartsWithIDR is whether the first video frame can be decoded without any
+	// preceding frames, i.e. whether the segment starts on a closed GOP boundary
+	StartsWithIDR bool
+}
+
+// InspectTS parses an MPEG-TS segment and returns information about its video track.
+// Frames are ordered by their presentation timestamps so the duration is accurate
+// even if the frames are reordered (e.g. because the segment contains B-frames)
+func InspectTS(data []byte) (*TSInfo, error) {
+	if len(data) == 0 || len(data)%tsPacketSize != 0 {
+		return nil, fmt.Errorf("invalid MPEG-TS segment size %v", len(data))
+	}
+
+	pmtPID, videoPID := -1, -1
+	var streamType byte
+	var pts []int64
+	var firstFrame []byte
+	firstFrameDone := false
+	randomAccess := false
+
+	for off := 0; off < len(data); off += tsPacketSize {
+		pid, start, rai, payload, err := parseTSPacket(data, off)
+		if err != nil {
+			return nil, err
+		}
+		if payload == nil {
+			continue
+		}
+
+		switch {
+		case pid == 0 && start && pmtPID < 0:
+			pmtPID = parsePAT(payload)
+		case pid == pmtPID && start && videoPID < 0:
+			videoPID, streamType = parsePMT(payload)
+		case pid == videoPID && start:
+			p, es, ok := parsePES(payload)
+			if !ok {
+				continue
+			}
+			pts = append(pts, p)
+			if len(pts) == 1 {
+				randomAccess = rai
+				firstFrame = append(firstFrame, es...)
+			} else {
+				firstFrameDone = true
+			}
+		case pid == videoPID && !firstFrameDone && len(pts) == 1 && len(firstFrame) < maxFirstFrameScan:
+			firstFrame = append(firstFrame, payload...)
+		}
+	}
+
+	if videoPID < 0 {
+		return nil, fmt.Errorf("no video track in MPEG-TS segment")
+	}
+	if len(pts) == 0 {
+		return nil, fmt.Errorf("no video frames in MPEG-TS segment")
+	}
+
+	return &TSInfo{
+		Frames:        len(pts),
+		Duration:      ptsDuration(pts),
+		StartsWithIDR: isIDRFrame(streamType, firstFrame, randomAccess),
+	}, nil
+}
+
+// TSAudioDuration returns the duration in seconds of the audio track of an MPEG-TS segment,
+// including the duration of its last PES packet
+func TSAudioDuration(data []byte) (float64, error) {
+	if len(data) == 0 || len(data)%tsPacketSize != 0 {
+		return 0, fmt.Errorf("invalid MPEG-TS segment size %v", len(data))
+	}
+
+	pmtPID, audioPID := -1, -1
+	var pts []int64
+	for off := 0; off < len(data); off += tsPacketSize {
+		pid, start, _, payload, err := parseTSPacket(data, off)
+		if err != nil {
+			return 0, err
+		}
+		if payload == nil || !start {
+			continue
+		}
+
+		switch {
+		case pid == 0 && pmtPID < 0:
+			pmtPID = parsePAT(payload)
+		case pid == pmtPID && audioPID < 0:
+			audioPID = parsePMTAudio(payload)
+		case pid == audioPID:
+			if p, _, ok := parsePES(payload); ok {
+				pts = append(pts, p)
+			}
+		}
+	}
+
+	if audioPID < 0 {
+		return 0, fmt.Errorf("no audio track in MPEG-TS segment")
+	}
+	if len(pts) == 0 {
+		return 0, fmt.Errorf("no audio frames in MPEG-TS segment")
+	}
+	return ptsDuration(pts), nil
+}
+
+// SplitTSAtIDR splits an MPEG-TS segment before its first IDR frame, so that the frames that precede
+// it can be moved to the end of the previous segment of the stream. Packets of the other streams
+// (e.g. audio) stay with the PES packet that they belong to, and the PAT and PMT are repeated at the
+// start of the tail so that it can be decoded on its own. head is nil if the segment starts with an
+// IDR frame. Returns ErrNoIDR if the segment has no IDR frame
+func SplitTSAtIDR(data []byte) (head, tail []byte, err error) {
+	if len(data) == 0 || len(data)%tsPacketSize != 0 {
+		return nil, nil, fmt.Errorf("invalid MPEG-TS segment size %v", len(data))
+	}
+
+	pmtPID, videoPID := -1, -1
+	var streamType byte
+	var pat, pmt []byte
+	firstFrameOff, frameOff, split := -1, -1, -1
+	var frame []byte
+	frameRAI := false
+
+	for off := 0; off < len(data) && split < 0; off += tsPacketSize {
+		pid, start, rai, payload, err := parseTSPacket(data, off)
+		if err != nil {
+			return nil, nil, err
+		}
+		if payload == nil {
+			continue
+		}
+
+		switch {
+		case pid == 0 && start:
+			pat = data[off : off+tsPacketSize]
+			if pmtPID < 0 {
+				pmtPID = parsePAT(payload)
+			}
+		case pid == pmtPID && start:
+			pmt = data[off : off+tsPacketSize]
+			if videoPID < 0 {
+				videoPID, streamType = parsePMT(payload)
+			}
+		case pid == videoPID && start:
+			_, es, ok := parsePES(payload)
+			if !ok {
+				continue
+			}
+			// A frame is classified once all of its packets, up to the scan limit, were read
+			if frameOff >= 0 && isIDRFrame(streamType, frame, frameRAI) {
+				split = frameOff
+				continue
+			}
+			if firstFrameOff < 0 {
+				firstFrameOff = off
+			}
+			frameOff, frame, frameRAI = off, append([]byte(nil), es...), rai
+		case pid == videoPID && frameOff >= 0 && len(frame) < maxFirstFrameScan:
+			frame = append(frame, payload...)
+		}
+	}
+	if split < 0 && frameOff >= 0 && isIDRFrame(streamType, frame, frameRAI) {
+		split = frameOff
+	}
+
+	if videoPID < 0 {
+		return nil, nil, fmt.Errorf("no video track in MPEG-TS segment")
+	}
+	if split < 0 {
+		return nil, nil, ErrNoIDR
+	}
+	if split == firstFrameOff {
+		return nil, data, nil
+	}
+
+	// Packets that follow the split but continue a PES packet that started before it are kept in the head
+	tail = append(append([]byte(nil), pat...), pmt...)
+	open := map[int]bool{}
+	for off := 0; off < len(data); off += tsPacketSize {
+		pkt := data[off : off+tsPacketSize]
+		pid, start, _, _, err := parseTSPacket(data, off)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case off < split:
+			head = append(head, pkt...)
+			if pid != 0 && pid != pmtPID && pid != videoPID && start {
+				open[pid] = true
+			}
+		case pid != 0 && pid != pmtPID && pid != videoPID && !start && open[pid]:
+			head = append(head, pkt...)
+		default:
+			if start {
+				open[pid] = false
+			}
+			tail = append(tail, pkt...)
+		}
+	}
+	return head, tail, nil
+}
+
+// parseTSPacket parses the header of the MPEG-TS packet at an offset. payload is nil if the packet has no payload
+func parseTSPacket(data []byte, off int) (pid int, start bool, rai bool, payload []byte, err error) {
+	pkt := data[off : off+tsPacketSize]
+	if pkt[0] != tsSyncByte {
+		return 0, false, false, nil, fmt.Errorf("invalid MPEG-TS sync byte at offset %v", off)
+	}
+	start = pkt[1]&0x40 != 0
+	pid = int(pkt[1]&0x1f)<<8 | int(pkt[2])
+	adaptation := pkt[3]&0x20 != 0
+	hasPayload := pkt[3]&0x10 != 0
+
+	payload = pkt[4:]
+	if adaptation {
+		afLen := int(pkt[4])
+		if 5+afLen > tsPacketSize {
+			return 0, false, false, nil, fmt.Errorf("invalid MPEG-TS adaptation field at offset %v", off)
+		}
+		rai = afLen > 0 && pkt[5]&0x40 != 0
+		payload = pkt[5+afLen:]
+	}
+	if !hasPayload {
+		payload = nil
+	}
+	return pid, start, rai, payload, nil
+}
+
+// isIDRFrame returns whether a frame can be decoded without any preceding frames. The random access
+// indicator of its first packet is used for codecs whose slices are not inspected
+func isIDRFrame(streamType byte, frame []byte, randomAccess bool) bool {
+	switch streamType {
+	case streamTypeH264:
+		return startsWithIDR(frame, h264IDR)
+	case streamTypeH265:
+		return startsWithIDR(frame, h265IDR)
+	}
+	return randomAccess
+}
+
+// ptsDuration returns the duration in seconds of frames with the given presentation timestamps
+func ptsDuration(pts []int64) float64 {
+	min, max := pts[0], pts[0]
+	for _, p := range pts {
+		if p < min {
+			min = p
+		}
+		if p > max {
+			max = p
+		}
+	}
+	// Timestamps that wrapped around are smaller than the timestamps before the rollover
+	if max-min > ptsRollover/2 {
+		min, max = ptsRollover, 0
+		for _, p := range pts {
+			if p < ptsRollover/2 {
+				p += ptsRollover
+			}
+			if p < min {
+				min = p
+			}
+			if p > max {
+				max = p
+			}
+		}
+	}
+	if len(pts) == 1 {
+		return 0
+	}
+	span := float64(max - min)
+	// Account for the display time of the last frame using the average frame duration
+	frameDuration := span / float64(len(pts)-1)
+	return (span + frameDuration) / tsClockRate
+}
+
+// parsePAT returns the PID of the PMT of the first program in a PAT
+func parsePAT(payload []byte) int {
+	section, ok := psiSection(payload)
+	if !ok {
+		return -1
+	}
+	for i := 8; i+4 <= len(section); i += 4 {
+		program := int(section[i])<<8 | int(section[i+1])
+		if program != 0 {
+			return int(section[i+2]&0x1f)<<8 | int(section[i+3])
+		}
+	}
+	return -1
+}
+
+// parsePMT returns the PID and stream type of the first video stream in a PMT
+func parsePMT(payload []byte) (int, byte) {
+	section, ok := psiSection(payload)
+	if !ok || len(section) < 12 {
+		return -1, 0
+	}
+	infoLen := int(section[10]&0x0f)<<8 | int(section[11])
+	for i := 12 + infoLen; i+5 <= len(section); {
+		streamType := section[i]
+		pid := int(section[i+1]&0x1f)<<8 | int(section[i+2])
+		esInfoLen := int(section[i+3]&0x0f)<<8 | int(section[i+4])
+		switch streamType {
+		case streamTypeMPEG1, streamTypeMPEG2, streamTypeMPEG4, streamTypeH264, streamTypeH265:
+			return pid, streamType
+		}
+		i += 5 + esInfoLen
+	}
+	return -1, 0
+}
+
+// parsePMTAudio returns the PID of the first audio stream in a PMT
+func parsePMTAudio(payload []byte) int {
+	section, ok := psiSection(payload)
+	if !ok || len(section) < 12 {
+		return -1
+	}
+	infoLen := int(section[10]&0x0f)<<8 | int(section[11])
+	for i := 12 + infoLen; i+5 <= len(section); {
+		streamType := section[i]
+		pid := int(section[i+1]&0x1f)<<8 | int(section[i+2])
+		esInfoLen := int(section[i+3]&0x0f)<<8 | int(section[i+4])
+		if i+5+esInfoLen > len(section) {
+			return -1
+		}
+		switch streamType {
+		case streamTypeMPEG1Audio, streamTypeMPEG2Audio, streamTypeAAC, streamTypeAACLATM, streamTypeAC3:
+			return pid
+		case streamTypePrivate:
+			if hasRegistration(section[i+5:i+5+esInfoLen], "Opus") {
+				return pid
+			}
+		}
+		i += 5 + esInfoLen
+	}
+	return -1
+}
+
+// hasRegistration returns whether descriptors include a registration descriptor with a format identifier
+func hasRegistration(descriptors []byte, format string) bool {
+	for i := 0; i+2 <= len(descriptors); {
+		tag, length := descriptors[i], int(descriptors[i+1])
+		if i+2+length > len(descriptors) {
+			return false
+		}
+		if tag == 0x05 && length >= 4 && string(descriptors[i+2:i+6]) == format {
+			return true
+		}
+		i += 2 + length
+	}
+	return false
+}
+
+// psiSection returns a PSI section without its CRC
+func psiSection(payload []byte) ([]byte, bool) {
+	if len(payload) == 0 {
+		return nil, false
+	}
+	start := 1 + int(payload[0])
+	if start+3 > len(payload) {
+		return nil, false
+	}
+	section := payload[start:]
+	length := int(section[1]&0x0f)<<8 | int(section[2])
+	end := 3 + length - 4
+	if length < 9 || end > len(section) {
+		return nil, false
+	}
+	return section[:end], true
+}
+
+// parsePES returns the presentation timestamp and the elementary stream data of a PES packet
+func parsePES(payload []byte) (int64, []byte, bool) {
+	if len(payload) < 14 || payload[0] != 0 || payload[1] != 0 || payload[2] != 1 {
+		return 0, nil, false
+	}
+	if payload[7]&0x80 == 0 {
+		return 0, nil, false
+	}
+	b := payload[9:14]
+	pts := int64(b[0]>>1&0x07)<<30 | int64(b[1])<<22 | int64(b[2]>>1)<<15 | int64(b[3])<<7 | int64(b[4]>>1)
+	esStart := 9 + int(payload[8])
+	if esStart > len(payload) {
+		return 0, nil, false
+	}
+	return pts, payload[esStart:], true
+}
+
+// nalType classifies the first slice of a frame as IDR (true) or not (false). ok is false for other NAL units
+type nalType func(header byte) (idr bool, ok bool)
+
+func h264IDR(header byte) (bool, bool) {
+	switch header & 0x1f {
+	case 5:
+		return true, true
+	case 1, 2, 3, 4:
+		return false, true
+	}
+	return false, false
+}
+
+func h265IDR(header byte) (bool, bool) {
+	t := (header >> 1) & 0x3f
+	switch {
+	case t == 19 || t == 20:
+		// IDR_W_RADL and IDR_N_LP
+		return true, true
+	case t <= 21:
+		// Other VCL NAL units, including CRA pictures which start open GOPs
+		return false, true
+	}
+	return false, false
+}
+
+// startsWithIDR returns whether the first slice of an Annex B frame belongs to an IDR frame
+func startsWithIDR(frame []byte, classify nalType) bool {
+	for i := 0; i+3 < len(frame); i++ {
+		if frame[i] != 0 || frame[i+1] != 0 || frame[i+2] != 1 {
+			continue
+		}
+		if idr, ok := classify(frame[i+3]); ok {
+			return idr
+		}
+		i += 2
+	}
+	return false
+}
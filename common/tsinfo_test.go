@@ -0,0 +1,215 @@
+package common
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectTS(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	data, err := ioutil.ReadFile("../core/test.ts")
+	require.Nil(err)
+	info, err := InspectTS(data)
+	require.Nil(err)
+	// 217 frames at 25 fps
+	assert.Equal(217, info.Frames)
+	assert.InDelta(8.68, info.Duration, 0.01)
+	assert.True(info.StartsWithIDR)
+
+	data, err = ioutil.ReadFile("../core/test2.ts")
+	require.Nil(err)
+	info, err = InspectTS(data)
+	require.Nil(err)
+	// 480 frames at 60 fps
+	assert.Equal(480, info.Frames)
+	assert.InDelta(8.0, info.Duration, 0.01)
+	assert.True(info.StartsWithIDR)
+}
+
+func TestInspectTS_Invalid(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := InspectTS(nil)
+	assert.EqualError(err, "invalid MPEG-TS segment size 0")
+
+	_, err = InspectTS(make([]byte, 100))
+	assert.EqualError(err, "invalid MPEG-TS segment size 100")
+
+	_, err = InspectTS(make([]byte, tsPacketSize))
+	assert.EqualError(err, "invalid MPEG-TS sync byte at offset 0")
+
+	// Only null packets
+	pkt := make([]byte, tsPacketSize)
+	pkt[0], pkt[1], pkt[2], pkt[3] = tsSyncByte, 0x1f, 0xff, 0x10
+	_, err = InspectTS(pkt)
+	assert.EqualError(err, "no video track in MPEG-TS segment")
+}
+
+func TestTSAudioDuration(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// 3 AAC frames of 1024 samples at 48kHz
+	data := concatPackets(testPAT(), testPMT(),
+		testTSPacket(0x100, true, testPES(0xe0, 0, []byte{0, 0, 1, 0x65})),
+		testTSPacket(0x101, true, testPES(0xc0, 90000, []byte{0xff, 0xf1})),
+		testTSPacket(0x101, true, testPES(0xc0, 91920, []byte{0xff, 0xf1})),
+		testTSPacket(0x101, true, testPES(0xc0, 93840, []byte{0xff, 0xf1})))
+	d, err := TSAudioDuration(data)
+	require.Nil(err)
+	assert.InDelta(0.064, d, 0.0001)
+
+	// Opus is identified by its registration descriptor
+	opusPMT := testTSPacket(0x1000, true, []byte{0, 0x02, 0xb0, 0x18, 0, 1, 0xc1, 0, 0, 0xe1, 0x01, 0xf0, 0x00,
+		streamTypePrivate, 0xe1, 0x01, 0xf0, 0x06, 0x05, 0x04, 'O', 'p', 'u', 's',
+		0, 0, 0, 0})
+	data = concatPackets(testPAT(), opusPMT,
+		testTSPacket(0x101, true, testPES(0xbd, 0, []byte{0x7f, 0xe0})),
+		testTSPacket(0x101, true, testPES(0xbd, 1800, []byte{0x7f, 0xe0})))
+	d, err = TSAudioDuration(data)
+	require.Nil(err)
+	assert.InDelta(0.04, d, 0.0001)
+
+	data, err = ioutil.ReadFile("../core/test.ts")
+	require.Nil(err)
+	d, err = TSAudioDuration(data)
+	require.Nil(err)
+	assert.InDelta(8.68, d, 0.1)
+
+	// Only video
+	videoPMT := testTSPacket(0x1000, true, []byte{0, 0x02, 0xb0, 0x12, 0, 1, 0xc1, 0, 0, 0xe1, 0x00, 0xf0, 0x00,
+		streamTypeH264, 0xe1, 0x00, 0xf0, 0x00,
+		0, 0, 0, 0})
+	_, err = TSAudioDuration(concatPackets(testPAT(), videoPMT))
+	assert.EqualError(err, "no audio track in MPEG-TS segment")
+	_, err = TSAudioDuration(nil)
+	assert.EqualError(err, "invalid MPEG-TS segment size 0")
+}
+
+func TestPTSDuration(t *testing.T) {
+	assert := assert.New(t)
+
+	// 3 frames at 30 fps
+	assert.InDelta(0.1, ptsDuration([]int64{0, 3000, 6000}), 0.0001)
+	// Frames are reordered with B-frames
+	assert.InDelta(0.1, ptsDuration([]int64{3000, 9000, 6000}), 0.0001)
+	// Timestamps wrap around
+	assert.InDelta(0.1, ptsDuration([]int64{ptsRollover - 3000, 0, 3000}), 0.0001)
+	// The duration of a single frame is unknown
+	assert.Equal(0.0, ptsDuration([]int64{3000}))
+}
+
+func TestStartsWithIDR(t *testing.T) {
+	assert := assert.New(t)
+
+	// AUD, SPS, IDR slice
+	assert.True(startsWithIDR([]byte{0, 0, 0, 1, 0x09, 0xf0, 0, 0, 1, 0x67, 0x42, 0, 0, 1, 0x65, 0x88}, h264IDR))
+	// AUD, non-IDR slice
+	assert.False(startsWithIDR([]byte{0, 0, 0, 1, 0x09, 0xf0, 0, 0, 1, 0x41, 0x9a}, h264IDR))
+	// No slices
+	assert.False(startsWithIDR([]byte{0, 0, 1, 0x09, 0xf0}, h264IDR))
+
+	// HEVC IDR_W_RADL
+	assert.True(startsWithIDR([]byte{0, 0, 1, 0x40, 0x01, 0, 0, 1, 0x26, 0x01}, h265IDR))
+	// HEVC CRA starts an open GOP
+	assert.False(startsWithIDR([]byte{0, 0, 1, 0x2a, 0x01}, h265IDR))
+}
+
+func TestSplitTSAtIDR(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	pat, pmt := testPAT(), testPMT()
+	p0 := testTSPacket(0x100, true, testPES(0xe0, 0, []byte{0, 0, 0, 1, 0x09, 0xf0, 0, 0, 1, 0x41, 0x9a}))
+	a1 := testTSPacket(0x101, true, testPES(0xc0, 0, []byte{0xff, 0xf1}))
+	idr := testTSPacket(0x100, true, testPES(0xe0, 3000, []byte{0, 0, 0, 1, 0x09, 0xf0, 0, 0, 1, 0x65, 0x88}))
+	a2 := testTSPacket(0x101, false, []byte{0xff})
+	p6 := testTSPacket(0x100, true, testPES(0xe0, 6000, []byte{0, 0, 0, 1, 0x09, 0xf0, 0, 0, 1, 0x41, 0x9a}))
+	a3 := testTSPacket(0x101, true, testPES(0xc0, 6000, []byte{0xff, 0xf1}))
+	data := concatPackets(pat, pmt, p0, a1, idr, a2, p6, a3)
+
+	// The audio packet that continues the PES packet started before the IDR frame stays in the head
+	head, tail, err := SplitTSAtIDR(data)
+	require.Nil(err)
+	assert.Equal(concatPackets(pat, pmt, p0, a1, a2), head)
+	assert.Equal(concatPackets(pat, pmt, idr, p6, a3), tail)
+
+	info, err := InspectTS(tail)
+	require.Nil(err)
+	assert.True(info.StartsWithIDR)
+	assert.Equal(2, info.Frames)
+
+	// Segments that start with an IDR frame are not split
+	head, tail, err = SplitTSAtIDR(concatPackets(pat, pmt, a1, idr, p6))
+	require.Nil(err)
+	assert.Nil(head)
+	assert.Equal(concatPackets(pat, pmt, a1, idr, p6), tail)
+
+	data, err = ioutil.ReadFile("../core/test.ts")
+	require.Nil(err)
+	head, tail, err = SplitTSAtIDR(data)
+	require.Nil(err)
+	assert.Nil(head)
+	assert.Equal(data, tail)
+
+	_, _, err = SplitTSAtIDR(concatPackets(pat, pmt, p0, a1, p6))
+	assert.Equal(ErrNoIDR, err)
+
+	_, _, err = SplitTSAtIDR(concatPackets(pat, pmt, p0, make([]byte, tsPacketSize)))
+	assert.EqualError(err, "invalid MPEG-TS sync byte at offset 564")
+
+	_, _, err = SplitTSAtIDR(nil)
+	assert.EqualError(err, "invalid MPEG-TS segment size 0")
+}
+
+// testTSPacket builds an MPEG-TS packet whose payload is padded with an adaptation field
+func testTSPacket(pid int, start bool, payload []byte) []byte {
+	pkt := make([]byte, tsPacketSize)
+	pkt[0], pkt[1], pkt[2], pkt[3] = tsSyncByte, byte(pid>>8&0x1f), byte(pid), 0x10
+	if start {
+		pkt[1] |= 0x40
+	}
+	pad := tsPacketSize - 4 - len(payload)
+	if pad > 0 {
+		pkt[3] |= 0x20
+		pkt[4] = byte(pad - 1)
+		for i := 6; i < 4+pad; i++ {
+			pkt[i] = 0xff
+		}
+	}
+	copy(pkt[4+pad:], payload)
+	return pkt
+}
+
+// testPES builds a PES packet with a presentation timestamp
+func testPES(streamID byte, pts int64, es []byte) []byte {
+	pes := []byte{0, 0, 1, streamID, 0, 0, 0x80, 0x80, 5,
+		byte(0x21 | pts>>29&0x0e), byte(pts >> 22), byte(pts>>14&0xfe | 1), byte(pts >> 7), byte(pts<<1&0xfe | 1)}
+	return append(pes, es...)
+}
+
+// testPAT builds a PAT packet with a program whose PMT has PID 0x1000
+func testPAT() []byte {
+	return testTSPacket(0, true, []byte{0, 0x00, 0xb0, 0x0d, 0, 1, 0xc1, 0, 0, 0, 1, 0xf0, 0x00, 0, 0, 0, 0})
+}
+
+// testPMT builds a PMT packet with an AAC stream with PID 0x101 and an H.264 stream with PID 0x100
+func testPMT() []byte {
+	return testTSPacket(0x1000, true, []byte{0, 0x02, 0xb0, 0x17, 0, 1, 0xc1, 0, 0, 0xe1, 0x00, 0xf0, 0x00,
+		0x0f, 0xe1, 0x01, 0xf0, 0x00,
+		streamTypeH264, 0xe1, 0x00, 0xf0, 0x00,
+		0, 0, 0, 0})
+}
+
+func concatPackets(pkts ...[]byte) []byte {
+	var data []byte
+	for _, pkt := range pkts {
+		data = append(data, pkt...)
+	}
+	return data
+}
@@ -3,17 +3,20 @@ package common
 import (
 	"context"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"math/big"
 	"math/rand"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/net"
 	ffmpeg "github.com/livepeer/lpms/ffmpeg"
 	"google.golang.org/grpc/peer"
 )
@@ -26,6 +29,18 @@ var (
 	ErrProfile     = fmt.Errorf("failed to parse profile")
 )
 
+// Upper bounds of the parameters of custom profiles, which can be requested by
+// untrusted broadcasters
+const (
+	MaxProfileDimension = 4096
+	MaxProfileFPS       = 120
+	MaxAudioBitrate     = 512000
+)
+
+// Profile names are used in the paths of segments, so they are restricted to
+// characters that cannot traverse or escape the stream's prefix
+var profileNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
 func init() {
 	rand.Seed(time.Now().UnixNano())
 }
@@ -128,6 +143,390 @@ func BytesToVideoProfile(txData []byte) ([]ffmpeg.VideoProfile, error) {
 	return profiles, nil
 }
 
+// JSONProfile is the JSON definition of a custom transcoding profile
+type JSONProfile struct {
+	Name    string `json:"name"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Bitrate int    `json:"bitrate"`
+	FPS     uint   `json:"fps"`
+	GOP     string `json:"gop"`
+	Codec   string `json:"codec"`
+	Profile string `json:"profile"`
+	Level   string `json:"level"`
+}
+
+// Output codecs of custom profiles. Profiles with an audio codec are audio-only renditions
+const (
+	CodecH264 = "H264"
+	CodecH265 = "H265"
+	CodecVP9  = "VP9"
+	CodecAAC  = "AAC"
+	CodecOpus = "OPUS"
+)
+
+// codecEncoders are the encoders of the output codecs other than H.264. H.264 is encoded with
+// the encoder of the acceleration of the transcoder
+var codecEncoders = map[string]string{
+	CodecH265: "libx265",
+	CodecVP9:  "libvpx-vp9",
+	CodecAAC:  "aac",
+	CodecOpus: "libopus",
+}
+
+// CodecEncoder returns the name of the FFmpeg encoder of an output codec other than H.264
+func CodecEncoder(codec string) string {
+	return codecEncoders[codec]
+}
+
+// IsAudioCodec returns whether profiles with an output codec are audio-only renditions
+func IsAudioCodec(codec string) bool {
+	return codec == CodecAAC || codec == CodecOpus
+}
+
+// AudioOnlyProfile returns whether a profile is an audio-only rendition. Audio-only
+// profiles are the only ones without a resolution
+func AudioOnlyProfile(profile ffmpeg.VideoProfile) bool {
+	return profile.Resolution == ""
+}
+
+// EncoderOptions are the encoder settings of a custom profile that ffmpeg.VideoProfile does not hold
+type EncoderOptions struct {
+	// Output codec other than H.264, e.g. "H265". H.264 if empty
+	Codec string
+	// Interval between keyframes in seconds, or "intra" to only encode keyframes.
+	// The encoder's default if empty
+	GOP string
+	// Encoder profile and level, e.g. "high" and "4.1". The encoder's defaults if empty
+	Profile string
+	Level   string
+}
+
+// normalize canonicalizes the fields of a profile that are not case sensitive
+func (jp *JSONProfile) normalize() {
+	jp.Profile = strings.ToLower(jp.Profile)
+	switch codec := strings.ToUpper(jp.Codec); codec {
+	case CodecH264:
+		// H.264 is the default
+		jp.Codec = ""
+	case "HEVC":
+		jp.Codec = CodecH265
+	default:
+		jp.Codec = codec
+	}
+}
+
+// resolution returns the resolution of a profile. Audio-only profiles have none
+func (jp JSONProfile) resolution() string {
+	if IsAudioCodec(jp.Codec) {
+		return ""
+	}
+	return fmt.Sprintf("%dx%d", jp.Width, jp.Height)
+}
+
+func (jp JSONProfile) encoderOptions() EncoderOptions {
+	return EncoderOptions{Codec: jp.Codec, GOP: jp.GOP, Profile: jp.Profile, Level: jp.Level}
+}
+
+// ProfileEncoders maps the names of profiles to their encoder options. Profiles without
+// an entry are encoded into H.264 with the defaults of the encoder
+type ProfileEncoders map[string]EncoderOptions
+
+// Codecs returns the output codecs other than H.264 of the profiles, in order
+func (e ProfileEncoders) Codecs() []string {
+	seen := make(map[string]bool)
+	var codecs []string
+	for _, o := range e {
+		if o.Codec != "" && !seen[o.Codec] {
+			seen[o.Codec] = true
+			codecs = append(codecs, o.Codec)
+		}
+	}
+	sort.Strings(codecs)
+	return codecs
+}
+
+// SegmentExtension returns the extension of the segments of a profile. VP9 is output as
+// fragmented MP4 since MPEG-TS cannot carry it
+func (e ProfileEncoders) SegmentExtension(profile string) string {
+	if e[profile].Codec == CodecVP9 {
+		return ".mp4"
+	}
+	return ".ts"
+}
+
+// H.264 encoder profiles and levels that custom profiles can request
+var (
+	h264Profiles = map[string]bool{"baseline": true, "main": true, "high": true}
+	h264Levels   = map[string]bool{
+		"1": true, "1b": true, "1.1": true, "1.2": true, "1.3": true,
+		"2": true, "2.1": true, "2.2": true,
+		"3": true, "3.1": true, "3.2": true,
+		"4": true, "4.1": true, "4.2": true,
+		"5": true, "5.1": true, "5.2": true,
+		"6": true, "6.1": true, "6.2": true,
+	}
+)
+
+// Longest interval between keyframes in seconds that custom profiles can request
+const maxProfileGOP = 60
+
+// VideoEncoderOpts returns the options of the video encoder of a profile with the given framerate
+func (o EncoderOptions) VideoEncoderOpts(framerate uint) map[string]string {
+	opts := make(map[string]string)
+	if o.GOP == "intra" {
+		opts["g"] = "1"
+	} else if gop, err := strconv.ParseFloat(o.GOP, 64); err == nil {
+		frames := int(gop*float64(framerate) + 0.5)
+		if frames < 1 {
+			frames = 1
+		}
+		opts["g"] = strconv.Itoa(frames)
+	}
+	if o.Profile != "" {
+		opts["profile"] = o.Profile
+	}
+	if o.Level != "" {
+		opts["level"] = o.Level
+	}
+	if len(opts) == 0 {
+		return nil
+	}
+	return opts
+}
+
+func validateEncoderOptions(o EncoderOptions, name string) error {
+	if o.Codec != "" && CodecEncoder(o.Codec) == "" {
+		return fmt.Errorf("unsupported codec %v for profile %v", o.Codec, name)
+	}
+	if IsAudioCodec(o.Codec) && o.GOP != "" {
+		return fmt.Errorf("gop is not supported by audio-only profile %v", name)
+	}
+	if o.GOP != "" && o.GOP != "intra" {
+		gop, err := strconv.ParseFloat(o.GOP, 64)
+		if err != nil || !(gop > 0 && gop <= maxProfileGOP) {
+			return fmt.Errorf("invalid gop %v for profile %v", o.GOP, name)
+		}
+	}
+	// Encoder profiles and levels are only defined for H.264
+	if o.Codec != "" && (o.Profile != "" || o.Level != "") {
+		return fmt.Errorf("encoder profile and level are only supported with H264 for profile %v", name)
+	}
+	if o.Profile != "" && !h264Profiles[o.Profile] {
+		return fmt.Errorf("invalid encoder profile %v for profile %v", o.Profile, name)
+	}
+	if o.Level != "" && !h264Levels[o.Level] {
+		return fmt.Errorf("invalid encoder level %v for profile %v", o.Level, name)
+	}
+	return nil
+}
+
+// ParseProfiles parses a JSON list of custom transcoding profiles
+func ParseProfiles(data []byte) ([]ffmpeg.VideoProfile, ProfileEncoders, error) {
+	var jsonProfiles []JSONProfile
+	if err := json.Unmarshal(data, &jsonProfiles); err != nil {
+		return nil, nil, fmt.Errorf("unable to parse profiles: %v", err)
+	}
+	return JSONProfilesToFFmpegProfiles(jsonProfiles)
+}
+
+// JSONProfilesToFFmpegProfiles validates and converts custom transcoding profiles. The encoder
+// options of the profiles that set any are returned separately
+func JSONProfilesToFFmpegProfiles(jsonProfiles []JSONProfile) ([]ffmpeg.VideoProfile, ProfileEncoders, error) {
+	if len(jsonProfiles) == 0 {
+		return nil, nil, fmt.Errorf("no profiles defined")
+	}
+
+	names := make(map[string]bool)
+	profiles := make([]ffmpeg.VideoProfile, 0, len(jsonProfiles))
+	var encoders ProfileEncoders
+	for _, jp := range jsonProfiles {
+		jp.normalize()
+		if err := validateJSONProfile(jp); err != nil {
+			return nil, nil, err
+		}
+		if names[jp.Name] {
+			return nil, nil, fmt.Errorf("duplicate profile name %v", jp.Name)
+		}
+		names[jp.Name] = true
+
+		profiles = append(profiles, ffmpeg.VideoProfile{
+			Name:       jp.Name,
+			Bitrate:    formatBitrate(jp.Bitrate),
+			Framerate:  jp.FPS,
+			Resolution: jp.resolution(),
+		})
+		if opts := jp.encoderOptions(); opts != (EncoderOptions{}) {
+			if encoders == nil {
+				encoders = make(ProfileEncoders)
+			}
+			encoders[jp.Name] = opts
+		}
+	}
+
+	return profiles, encoders, nil
+}
+
+func validateJSONProfile(jp JSONProfile) error {
+	if jp.Name == "" {
+		return fmt.Errorf("profile name is required")
+	}
+	// The source rendition is named "source"
+	if jp.Name == "source" || !profileNameRegex.MatchString(jp.Name) {
+		return fmt.Errorf("invalid profile name %v", jp.Name)
+	}
+	if IsAudioCodec(jp.Codec) {
+		// Audio-only renditions keep the sample rate of the source and have no video parameters
+		if jp.Width != 0 || jp.Height != 0 || jp.FPS != 0 {
+			return fmt.Errorf("audio-only profile %v cannot set a resolution or fps", jp.Name)
+		}
+		if jp.Bitrate <= 0 || jp.Bitrate > MaxAudioBitrate {
+			return fmt.Errorf("invalid bitrate %v for profile %v", jp.Bitrate, jp.Name)
+		}
+		return validateEncoderOptions(jp.encoderOptions(), jp.Name)
+	}
+	if jp.Width <= 0 || jp.Height <= 0 || jp.Width > MaxProfileDimension || jp.Height > MaxProfileDimension {
+		return fmt.Errorf("invalid resolution %vx%v for profile %v", jp.Width, jp.Height, jp.Name)
+	}
+	// The transcoder has no way to keep the frame rate of the source, so it must be set
+	if jp.FPS == 0 || jp.FPS > MaxProfileFPS {
+		return fmt.Errorf("invalid fps %v for profile %v", jp.FPS, jp.Name)
+	}
+	if jp.Bitrate <= 0 {
+		return fmt.Errorf("invalid bitrate %v for profile %v", jp.Bitrate, jp.Name)
+	}
+	return validateEncoderOptions(jp.encoderOptions(), jp.Name)
+}
+
+// formatBitrate formats a bitrate in bits per second the way the builtin presets do
+func formatBitrate(bitrate int) string {
+	if bitrate%1000 == 0 {
+		return fmt.Sprintf("%dk", bitrate/1000)
+	}
+	return strconv.Itoa(bitrate)
+}
+
+// ParseBitrate parses a profile bitrate such as "3000k" into bits per second
+func ParseBitrate(bitrate string) (int, error) {
+	if strings.HasSuffix(bitrate, "k") || strings.HasSuffix(bitrate, "K") {
+		kbps, err := strconv.Atoi(bitrate[:len(bitrate)-1])
+		return kbps * 1000, err
+	}
+	return strconv.Atoi(bitrate)
+}
+
+func parseResolution(resolution string) (int, int, error) {
+	var w, h int
+	if _, err := fmt.Sscanf(resolution, "%dx%d", &w, &h); err != nil {
+		return 0, 0, fmt.Errorf("invalid resolution %v", resolution)
+	}
+	return w, h, nil
+}
+
+// IsPresetProfile returns whether a profile is one of the builtin presets
+func IsPresetProfile(profile ffmpeg.VideoProfile) bool {
+	preset, ok := ffmpeg.VideoProfileLookup[profile.Name]
+	return ok && preset == profile
+}
+
+// NeedsFullProfiles returns whether the full definitions of profiles have to be sent because
+// they cannot be identified by the name hash of a preset
+func NeedsFullProfiles(profiles []ffmpeg.VideoProfile, encoders ProfileEncoders) bool {
+	for _, p := range profiles {
+		if _, ok := encoders[p.Name]; ok || !IsPresetProfile(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// FFmpegProfilesToNetProfiles converts profiles and their encoder options to their wire definitions
+func FFmpegProfilesToNetProfiles(profiles []ffmpeg.VideoProfile, encoders ProfileEncoders) ([]*net.VideoProfile, error) {
+	netProfiles := make([]*net.VideoProfile, 0, len(profiles))
+	for _, p := range profiles {
+		var w, h int
+		if !AudioOnlyProfile(p) {
+			var err error
+			if w, h, err = parseResolution(p.Resolution); err != nil {
+				return nil, err
+			}
+		}
+		bitrate, err := ParseBitrate(p.Bitrate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bitrate %v", p.Bitrate)
+		}
+		opts := encoders[p.Name]
+		netProfiles = append(netProfiles, &net.VideoProfile{
+			Name:    p.Name,
+			Width:   int32(w),
+			Height:  int32(h),
+			Bitrate: int32(bitrate),
+			Fps:     uint32(p.Framerate),
+			Gop:     opts.GOP,
+			Profile: opts.Profile,
+			Level:   opts.Level,
+			Codec:   opts.Codec,
+		})
+	}
+	return netProfiles, nil
+}
+
+// NetProfilesToFFmpegProfiles converts and validates wire definitions of profiles and their encoder options
+func NetProfilesToFFmpegProfiles(netProfiles []*net.VideoProfile) ([]ffmpeg.VideoProfile, ProfileEncoders, error) {
+	profiles := make([]ffmpeg.VideoProfile, 0, len(netProfiles))
+	var encoders ProfileEncoders
+	for _, np := range netProfiles {
+		jp := JSONProfile{
+			Name:    np.Name,
+			Width:   int(np.Width),
+			Height:  int(np.Height),
+			Bitrate: int(np.Bitrate),
+			FPS:     uint(np.Fps),
+			GOP:     np.Gop,
+			Profile: np.Profile,
+			Level:   np.Level,
+			Codec:   np.Codec,
+		}
+		jp.normalize()
+		if err := validateJSONProfile(jp); err != nil {
+			glog.Errorf("Invalid video profile: %v", err)
+			return nil, nil, ErrProfile
+		}
+
+		// Preserve the definitions of builtin presets so that they are recognized as such
+		profile := ffmpeg.VideoProfile{
+			Name:       jp.Name,
+			Bitrate:    formatBitrate(jp.Bitrate),
+			Framerate:  jp.FPS,
+			Resolution: jp.resolution(),
+		}
+		if preset, ok := ffmpeg.VideoProfileLookup[profile.Name]; ok && presetMatches(preset, profile) {
+			profile = preset
+		}
+		profiles = append(profiles, profile)
+		if opts := jp.encoderOptions(); opts != (EncoderOptions{}) {
+			if encoders == nil {
+				encoders = make(ProfileEncoders)
+			}
+			encoders[jp.Name] = opts
+		}
+	}
+	return profiles, encoders, nil
+}
+
+// presetMatches returns whether a profile has the same output parameters as a preset
+func presetMatches(preset, profile ffmpeg.VideoProfile) bool {
+	presetBitrate, err := ParseBitrate(preset.Bitrate)
+	if err != nil {
+		return false
+	}
+	bitrate, err := ParseBitrate(profile.Bitrate)
+	if err != nil {
+		return false
+	}
+	return preset.Resolution == profile.Resolution && preset.Framerate == profile.Framerate && presetBitrate == bitrate
+}
+
 func ProfilesToTranscodeOpts(profiles []ffmpeg.VideoProfile) []byte {
 	//Sort profiles first
 	sort.Sort(ffmpeg.ByName(profiles))
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/livepeer/go-livepeer/net"
 	"github.com/livepeer/lpms/ffmpeg"
 	"github.com/stretchr/testify/assert"
 )
@@ -93,3 +94,173 @@ func TestPriceToFixed(t *testing.T) {
 	assert.Nil(err)
 	assert.Zero(fp)
 }
+
+func TestParseProfiles(t *testing.T) {
+	assert := assert.New(t)
+
+	profiles, encoders, err := ParseProfiles([]byte(`[
+		{"name": "custom720", "width": 1280, "height": 720, "bitrate": 3000000, "fps": 60, "codec": "H264", "gop": "2", "profile": "High", "level": "4.1"},
+		{"name": "custom180", "width": 320, "height": 180, "bitrate": 250500, "fps": 15},
+		{"name": "hevc480", "width": 854, "height": 480, "bitrate": 1000000, "fps": 30, "codec": "hevc"},
+		{"name": "vp9360", "width": 640, "height": 360, "bitrate": 600000, "fps": 30, "codec": "VP9", "gop": "2"},
+		{"name": "audio64", "bitrate": 64000, "codec": "aac"},
+		{"name": "opus96", "bitrate": 96000, "codec": "Opus"}
+	]`))
+	assert.Nil(err)
+	assert.Equal([]ffmpeg.VideoProfile{
+		{Name: "custom720", Bitrate: "3000k", Framerate: 60, Resolution: "1280x720"},
+		{Name: "custom180", Bitrate: "250500", Framerate: 15, Resolution: "320x180"},
+		{Name: "hevc480", Bitrate: "1000k", Framerate: 30, Resolution: "854x480"},
+		{Name: "vp9360", Bitrate: "600k", Framerate: 30, Resolution: "640x360"},
+		{Name: "audio64", Bitrate: "64k"},
+		{Name: "opus96", Bitrate: "96k"},
+	}, profiles)
+	assert.False(AudioOnlyProfile(profiles[0]))
+	assert.True(AudioOnlyProfile(profiles[4]))
+	// Only the profiles that set encoder options have an entry, and H.264 is left implicit
+	assert.Equal(ProfileEncoders{
+		"custom720": {GOP: "2", Profile: "high", Level: "4.1"},
+		"hevc480":   {Codec: CodecH265},
+		"vp9360":    {Codec: CodecVP9, GOP: "2"},
+		"audio64":   {Codec: CodecAAC},
+		"opus96":    {Codec: CodecOpus},
+	}, encoders)
+	assert.Equal([]string{CodecAAC, CodecH265, CodecOpus, CodecVP9}, encoders.Codecs())
+	assert.Equal(".ts", encoders.SegmentExtension("audio64"))
+	assert.Equal(".ts", encoders.SegmentExtension("custom720"))
+	assert.Equal(".ts", encoders.SegmentExtension("hevc480"))
+	assert.Equal(".mp4", encoders.SegmentExtension("vp9360"))
+	assert.Equal(".ts", encoders.SegmentExtension("custom180"))
+	assert.Empty(ProfileEncoders(nil).Codecs())
+
+	invalid := []struct {
+		json string
+		err  string
+	}{
+		{`foo`, "unable to parse profiles"},
+		{`[]`, "no profiles defined"},
+		{`[{"width": 1280, "height": 720, "bitrate": 1000}]`, "profile name is required"},
+		{`[{"name": "source", "width": 1280, "height": 720, "bitrate": 1000}]`, "invalid profile name source"},
+		{`[{"name": "a/b", "width": 1280, "height": 720, "bitrate": 1000}]`, "invalid profile name a/b"},
+		{`[{"name": "..", "width": 1280, "height": 720, "bitrate": 1000}]`, "invalid profile name .."},
+		{`[{"name": ".", "width": 1280, "height": 720, "bitrate": 1000}]`, "invalid profile name ."},
+		{`[{"name": "a b", "width": 1280, "height": 720, "bitrate": 1000}]`, "invalid profile name a b"},
+		{`[{"name": "foo", "width": 0, "height": 720, "bitrate": 1000}]`, "invalid resolution 0x720 for profile foo"},
+		{`[{"name": "foo", "width": 16384, "height": 16384, "bitrate": 1000}]`, "invalid resolution 16384x16384 for profile foo"},
+		{`[{"name": "foo", "width": 1280, "height": 720, "bitrate": 1000, "fps": 1000}]`, "invalid fps 1000 for profile foo"},
+		{`[{"name": "foo", "width": 1280, "height": 720, "bitrate": 1000}]`, "invalid fps 0 for profile foo"},
+		{`[{"name": "foo", "width": 1280, "height": 720, "fps": 30}]`, "invalid bitrate 0 for profile foo"},
+		{`[{"name": "foo", "width": 1280, "height": 720, "bitrate": 1000, "fps": 30, "codec": "AV1"}]`, "unsupported codec AV1 for profile foo"},
+		{`[{"name": "foo", "width": 1280, "height": 720, "bitrate": 1000, "fps": 30, "codec": "H265", "profile": "main"}]`, "encoder profile and level are only supported with H264 for profile foo"},
+		{`[{"name": "foo", "width": 1280, "height": 720, "bitrate": 64000, "codec": "AAC"}]`, "audio-only profile foo cannot set a resolution or fps"},
+		{`[{"name": "foo", "bitrate": 64000, "fps": 30, "codec": "AAC"}]`, "audio-only profile foo cannot set a resolution or fps"},
+		{`[{"name": "foo", "codec": "AAC"}]`, "invalid bitrate 0 for profile foo"},
+		{`[{"name": "foo", "bitrate": 1000000, "codec": "OPUS"}]`, "invalid bitrate 1000000 for profile foo"},
+		{`[{"name": "foo", "bitrate": 64000, "codec": "AAC", "gop": "2"}]`, "gop is not supported by audio-only profile foo"},
+		{`[{"name": "foo", "bitrate": 64000, "codec": "AAC", "profile": "high"}]`, "encoder profile and level are only supported with H264 for profile foo"},
+		{`[{"name": "foo", "width": 1280, "height": 720, "bitrate": 1000, "fps": 30, "gop": "2s"}]`, "invalid gop 2s for profile foo"},
+		{`[{"name": "foo", "width": 1280, "height": 720, "bitrate": 1000, "fps": 30, "gop": "0"}]`, "invalid gop 0 for profile foo"},
+		{`[{"name": "foo", "width": 1280, "height": 720, "bitrate": 1000, "fps": 30, "gop": "61"}]`, "invalid gop 61 for profile foo"},
+		{`[{"name": "foo", "width": 1280, "height": 720, "bitrate": 1000, "fps": 30, "profile": "high10"}]`, "invalid encoder profile high10 for profile foo"},
+		{`[{"name": "foo", "width": 1280, "height": 720, "bitrate": 1000, "fps": 30, "level": "7"}]`, "invalid encoder level 7 for profile foo"},
+		{`[{"name": "foo", "width": 1280, "height": 720, "bitrate": 1000, "fps": 30}, {"name": "foo", "width": 320, "height": 180, "bitrate": 1000, "fps": 30}]`, "duplicate profile name foo"},
+	}
+	for _, tc := range invalid {
+		_, _, err := ParseProfiles([]byte(tc.json))
+		if assert.Error(err, tc.json) {
+			assert.Contains(err.Error(), tc.err)
+		}
+	}
+}
+
+func TestNetProfiles(t *testing.T) {
+	assert := assert.New(t)
+
+	custom := ffmpeg.VideoProfile{Name: "custom", Bitrate: "1500k", Framerate: 24, Resolution: "854x480"}
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9, custom}
+
+	assert.True(IsPresetProfile(ffmpeg.P240p30fps16x9))
+	assert.False(IsPresetProfile(custom))
+	// A profile that reuses the name of a preset with different parameters is not a preset
+	assert.False(IsPresetProfile(ffmpeg.VideoProfile{Name: ffmpeg.P240p30fps16x9.Name, Bitrate: "1k", Resolution: "1x1"}))
+
+	assert.False(NeedsFullProfiles([]ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9}, nil))
+	assert.True(NeedsFullProfiles(profiles, nil))
+	// Presets with encoder options are sent in full
+	encoders := ProfileEncoders{ffmpeg.P240p30fps16x9.Name: {GOP: "intra"}}
+	assert.True(NeedsFullProfiles([]ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9}, encoders))
+
+	netProfiles, err := FFmpegProfilesToNetProfiles(profiles, encoders)
+	assert.Nil(err)
+	assert.Len(netProfiles, 2)
+	assert.Equal("intra", netProfiles[0].Gop)
+	assert.Empty(netProfiles[0].Codec)
+	assert.Equal("custom", netProfiles[1].Name)
+	assert.Equal(int32(854), netProfiles[1].Width)
+	assert.Equal(int32(480), netProfiles[1].Height)
+	assert.Equal(int32(1500000), netProfiles[1].Bitrate)
+	assert.Equal(uint32(24), netProfiles[1].Fps)
+	assert.Empty(netProfiles[1].Gop)
+
+	// Presets are restored so that they are recognized as presets
+	res, resEncoders, err := NetProfilesToFFmpegProfiles(netProfiles)
+	assert.Nil(err)
+	assert.Equal(profiles, res)
+	assert.Equal(encoders, resEncoders)
+
+	_, err = FFmpegProfilesToNetProfiles([]ffmpeg.VideoProfile{{Name: "foo", Bitrate: "1k", Resolution: "bar"}}, nil)
+	assert.EqualError(err, "invalid resolution bar")
+
+	netProfiles[1].Width = 0
+	_, _, err = NetProfilesToFFmpegProfiles(netProfiles)
+	assert.Equal(ErrProfile, err)
+
+	// Names that would escape the prefix of the stream in segment paths are rejected
+	netProfiles[1].Width = 854
+	netProfiles[1].Name = ".."
+	_, _, err = NetProfilesToFFmpegProfiles(netProfiles)
+	assert.Equal(ErrProfile, err)
+
+	netProfiles[1].Name = "custom"
+	netProfiles[1].Level = "foo"
+	_, _, err = NetProfilesToFFmpegProfiles(netProfiles)
+	assert.Equal(ErrProfile, err)
+
+	// Output codecs are carried
+	netProfiles[1].Level = ""
+	netProfiles[1].Codec = CodecVP9
+	_, resEncoders, err = NetProfilesToFFmpegProfiles(netProfiles)
+	assert.Nil(err)
+	assert.Equal(EncoderOptions{Codec: CodecVP9}, resEncoders["custom"])
+
+	netProfiles[1].Codec = "AV1"
+	_, _, err = NetProfilesToFFmpegProfiles(netProfiles)
+	assert.Equal(ErrProfile, err)
+
+	// Audio-only profiles have no resolution
+	audio := ffmpeg.VideoProfile{Name: "audio", Bitrate: "64k"}
+	audioEncoders := ProfileEncoders{"audio": {Codec: CodecAAC}}
+	netProfiles, err = FFmpegProfilesToNetProfiles([]ffmpeg.VideoProfile{audio}, audioEncoders)
+	assert.Nil(err)
+	assert.Equal(&net.VideoProfile{Name: "audio", Bitrate: 64000, Codec: CodecAAC}, netProfiles[0])
+	res, resEncoders, err = NetProfilesToFFmpegProfiles(netProfiles)
+	assert.Nil(err)
+	assert.Equal([]ffmpeg.VideoProfile{audio}, res)
+	assert.Equal(audioEncoders, resEncoders)
+
+	netProfiles[0].Codec = ""
+	_, _, err = NetProfilesToFFmpegProfiles(netProfiles)
+	assert.Equal(ErrProfile, err)
+}
+
+func TestVideoEncoderOpts(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(EncoderOptions{}.VideoEncoderOpts(30))
+	assert.Equal(map[string]string{"g": "1"}, EncoderOptions{GOP: "intra"}.VideoEncoderOpts(30))
+	// The GOP is converted from seconds to frames at the frame rate of the profile
+	assert.Equal(map[string]string{"g": "60"}, EncoderOptions{GOP: "2"}.VideoEncoderOpts(30))
+	assert.Equal(map[string]string{"g": "12"}, EncoderOptions{GOP: "0.5"}.VideoEncoderOpts(24))
+	assert.Equal(map[string]string{"g": "1"}, EncoderOptions{GOP: "0.01"}.VideoEncoderOpts(24))
+	assert.Equal(map[string]string{"profile": "main", "level": "3.1"}, EncoderOptions{Profile: "main", Level: "3.1"}.VideoEncoderOpts(30))
+}
@@ -1,11 +1,114 @@
 package core
 
 import (
+	"fmt"
 	"math/big"
 	"sync"
 	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/monitor"
+)
+
+// BalanceCleanupPolicy determines what happens to the remaining amount of a balance when it is cleaned up
+type BalanceCleanupPolicy int
+
+const (
+	// DiscardBalance drops any remaining amount when a balance is cleaned up
+	DiscardBalance BalanceCleanupPolicy = iota
+	// CarryDebt moves a negative remaining amount to the debt ledger of the balance's sender
+	// so that it is charged against the next stream of the same sender
+	CarryDebt
+)
+
+// String returns the name of a BalanceCleanupPolicy
+func (p BalanceCleanupPolicy) String() string {
+	switch p {
+	case DiscardBalance:
+		return "discard"
+	case CarryDebt:
+		return "carryDebt"
+	}
+	return "unknown"
+}
+
+// ParseBalanceCleanupPolicy returns the BalanceCleanupPolicy for a name
+func ParseBalanceCleanupPolicy(name string) (BalanceCleanupPolicy, error) {
+	switch name {
+	case "discard":
+		return DiscardBalance, nil
+	case "carryDebt":
+		return CarryDebt, nil
+	}
+	return DiscardBalance, fmt.Errorf("unknown balance cleanup policy %v", name)
+}
+
+// BalanceCleanupEvent is emitted when a balance with a non-zero amount is cleaned up
+type BalanceCleanupEvent struct {
+	ManifestID ManifestID
+	Sender     ethcommon.Address
+	Amount     *big.Rat
+	Policy     BalanceCleanupPolicy
+}
+
+// CreditExpiryPolicy determines what happens to the unused credit of a stream that is no longer updated
+type CreditExpiryPolicy int
+
+const (
+	// RetainCredit keeps unused credit until the balance is cleaned up
+	RetainCredit CreditExpiryPolicy = iota
+	// ReclaimCredit reclaims the unused credit of a balance that has not been updated
+	// within the credit expiry and notifies the sender of the reclaimed amount
+	ReclaimCredit
 )
 
+// String returns the name of a CreditExpiryPolicy
+func (p CreditExpiryPolicy) String() string {
+	switch p {
+	case RetainCredit:
+		return "retain"
+	case ReclaimCredit:
+		return "reclaim"
+	}
+	return "unknown"
+}
+
+// ParseCreditExpiryPolicy returns the CreditExpiryPolicy for a name
+func ParseCreditExpiryPolicy(name string) (CreditExpiryPolicy, error) {
+	switch name {
+	case "retain":
+		return RetainCredit, nil
+	case "reclaim":
+		return ReclaimCredit, nil
+	}
+	return RetainCredit, fmt.Errorf("unknown credit expiry policy %v", name)
+}
+
+const (
+	// CreditExpired is the reason recorded for credit that is reclaimed after the credit expiry
+	CreditExpired = "expired"
+	// CreditCleanedUp is the reason recorded for credit that is discarded when a balance is cleaned up
+	CreditCleanedUp = "cleanup"
+	// CreditRestored is the reason recorded for reclaimed credit that is returned to a resumed
+	// stream. The amount of its entries is negative
+	CreditRestored = "restored"
+)
+
+// Maximum number of entries kept in the credit ledger. The oldest entries are dropped first
+const maxCreditLedgerEntries = 1000
+
+// CreditLedgerEntry records an amount of unused credit that was reclaimed from a stream
+type CreditLedgerEntry struct {
+	ManifestID ManifestID
+	Sender     ethcommon.Address
+	Amount     *big.Rat
+	Reason     string
+	Time       time.Time
+}
+
 // Balance holds the credit balance for a broadcast session
 type Balance struct {
 	manifestID ManifestID
@@ -52,31 +155,194 @@ func (b *Balance) StageUpdate(minCredit, ev *big.Rat) (int, *big.Rat, *big.Rat)
 
 // Clear zeros the balance
 func (b *Balance) Clear() {
+	b.balances.mtx.Lock()
+	defer b.balances.mtx.Unlock()
 	delete(b.balances.balances, b.manifestID)
 }
 
 // Balances holds credit balances on a per-stream basis
 type Balances struct {
 	balances map[ManifestID]*balance
-	mtx      sync.RWMutex
-	ttl      time.Duration
-	quit     chan struct{}
+	// debts holds the debt carried forward for senders under the CarryDebt policy
+	debts  map[ethcommon.Address]*big.Rat
+	mtx    sync.RWMutex
+	ttl    time.Duration
+	policy BalanceCleanupPolicy
+	quit   chan struct{}
+
+	creditExpiry time.Duration
+	expiryPolicy CreditExpiryPolicy
+	// ledger records the credit reclaimed from streams, oldest first
+	ledger []*CreditLedgerEntry
+
+	cleanupFeed  event.Feed
+	reclaimFeed  event.Feed
+	cleanupScope event.SubscriptionScope
 }
 
 type balance struct {
-	lastUpdate time.Time // Unix time since last update
-	amount     *big.Rat  // Balance represented as a big.Rat
+	lastUpdate time.Time         // Unix time since last update
+	amount     *big.Rat          // Balance represented as a big.Rat
+	sender     ethcommon.Address // Sender funding the balance, if known
+	reclaimed  *big.Rat          // Reclaimed credit that the sender has not been notified of yet
 }
 
-// NewBalances creates a Balances instance with the given ttl
+// NewBalances creates a Balances instance with the given ttl that discards balances on cleanup
 func NewBalances(ttl time.Duration) *Balances {
+	return NewBalancesWithPolicy(ttl, DiscardBalance)
+}
+
+// NewBalancesWithPolicy creates a Balances instance with the given ttl and cleanup policy
+func NewBalancesWithPolicy(ttl time.Duration, policy BalanceCleanupPolicy) *Balances {
 	return &Balances{
 		balances: make(map[ManifestID]*balance),
+		debts:    make(map[ethcommon.Address]*big.Rat),
 		ttl:      ttl,
+		policy:   policy,
 		quit:     make(chan struct{}),
 	}
 }
 
+// SetSender associates a sender with the balance for a ManifestID. If the CarryDebt policy
+// is in use, any debt carried forward for the sender is charged against the balance
+func (b *Balances) SetSender(id ManifestID, sender ethcommon.Address) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.balances[id] == nil {
+		b.balances[id] = &balance{amount: big.NewRat(0, 1), lastUpdate: time.Now()}
+	}
+	if b.balances[id].sender == sender {
+		return
+	}
+	b.balances[id].sender = sender
+
+	if debt, ok := b.debts[sender]; ok {
+		b.balances[id].amount.Sub(b.balances[id].amount, debt)
+		delete(b.debts, sender)
+		glog.V(common.DEBUG).Infof("Charged carried debt manifestID=%v sender=%v debt=%v", id, monitor.RedactAddress(sender), debt.FloatString(2))
+	}
+}
+
+// OpenUnpaid creates the balance of a stream funded by sender before it is paid for, so that its first
+// segment can be transcoded on credit. Fails if the stream has a balance already, if the sender carries
+// debt forward or if maxOwing streams of the sender already have a negative balance
+func (b *Balances) OpenUnpaid(id ManifestID, sender ethcommon.Address, maxOwing int) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.balances[id] != nil {
+		return fmt.Errorf("the stream already has a balance")
+	}
+	if debt, ok := b.debts[sender]; ok && debt.Sign() > 0 {
+		return fmt.Errorf("the sender carries a debt of %v", debt.FloatString(2))
+	}
+	owing := 0
+	for _, bal := range b.balances {
+		if bal.sender == sender && bal.amount.Sign() < 0 {
+			owing++
+		}
+	}
+	if owing >= maxOwing {
+		return fmt.Errorf("the sender owes the fees of %d streams", owing)
+	}
+	b.balances[id] = &balance{amount: big.NewRat(0, 1), lastUpdate: time.Now(), sender: sender}
+	return nil
+}
+
+// SetCreditExpiry sets the policy for credit that is not used within expiry of the last update of a balance.
+// It should be called before the cleanup loop is started
+func (b *Balances) SetCreditExpiry(expiry time.Duration, policy CreditExpiryPolicy) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.creditExpiry = expiry
+	b.expiryPolicy = policy
+}
+
+// TakeReclaimed returns the credit reclaimed from the balance for a ManifestID since the last call
+// so that the sender can be notified of it. Returns nil if no credit was reclaimed
+func (b *Balances) TakeReclaimed(id ManifestID) *big.Rat {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.balances[id] == nil || b.balances[id].reclaimed == nil {
+		return nil
+	}
+	reclaimed := b.balances[id].reclaimed
+	b.balances[id].reclaimed = nil
+	return reclaimed
+}
+
+// RestoreReclaimed returns the credit reclaimed from the balance for a ManifestID, that the sender
+// has not been notified of yet, to the balance. Returns the restored credit or nil if none
+func (b *Balances) RestoreReclaimed(id ManifestID) *big.Rat {
+	b.mtx.Lock()
+	bal := b.balances[id]
+	if bal == nil || bal.reclaimed == nil {
+		b.mtx.Unlock()
+		return nil
+	}
+	restored := bal.reclaimed
+	bal.reclaimed = nil
+	bal.amount.Add(bal.amount, restored)
+	bal.lastUpdate = time.Now()
+	entry := b.record(id, &balance{amount: new(big.Rat).Neg(restored), sender: bal.sender}, CreditRestored)
+	b.mtx.Unlock()
+
+	b.reclaimFeed.Send(entry)
+	return restored
+}
+
+// Ledger returns the entries of the credit ledger, oldest first
+func (b *Balances) Ledger() []CreditLedgerEntry {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	entries := make([]CreditLedgerEntry, len(b.ledger))
+	for i, e := range b.ledger {
+		entries[i] = *e
+		entries[i].Amount = new(big.Rat).Set(e.Amount)
+	}
+	return entries
+}
+
+// PurgeLedger removes the entries of the streams matched by match from the credit ledger
+// and returns the number of entries removed
+func (b *Balances) PurgeLedger(match func(ManifestID) bool) int {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	ledger := b.ledger[:0]
+	for _, e := range b.ledger {
+		if !match(e.ManifestID) {
+			ledger = append(ledger, e)
+		}
+	}
+	purged := len(b.ledger) - len(ledger)
+	for i := len(ledger); i < len(b.ledger); i++ {
+		b.ledger[i] = nil
+	}
+	b.ledger = ledger
+	return purged
+}
+
+// SubscribeReclaim registers a subscription for the entries recorded in the credit ledger.
+// The entries are sent in the background so the cleanup loop is not blocked by slow subscribers
+func (b *Balances) SubscribeReclaim(sink chan<- *CreditLedgerEntry) event.Subscription {
+	return b.cleanupScope.Track(b.reclaimFeed.Subscribe(sink))
+}
+
+// Debt returns the debt carried forward for a sender
+func (b *Balances) Debt(sender ethcommon.Address) *big.Rat {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	if debt, ok := b.debts[sender]; ok {
+		return new(big.Rat).Set(debt)
+	}
+	return big.NewRat(0, 1)
+}
+
+// SubscribeCleanup registers a subscription for events emitted when balances with a non-zero amount are cleaned up.
+// The events are sent in the background so the cleanup loop is not blocked by slow subscribers
+func (b *Balances) SubscribeCleanup(sink chan<- *BalanceCleanupEvent) event.Subscription {
+	return b.cleanupScope.Track(b.cleanupFeed.Subscribe(sink))
+}
+
 // Credit adds an an amount to the balance for a ManifestID
 func (b *Balances) Credit(id ManifestID, amount *big.Rat) {
 	b.mtx.Lock()
@@ -123,22 +389,119 @@ func (b *Balances) Balance(id ManifestID) *big.Rat {
 	return b.balances[id].amount
 }
 
+// record adds an entry to the credit ledger. The caller must hold the lock
+func (b *Balances) record(id ManifestID, balance *balance, reason string) *CreditLedgerEntry {
+	entry := &CreditLedgerEntry{
+		ManifestID: id,
+		Sender:     balance.sender,
+		Amount:     new(big.Rat).Set(balance.amount),
+		Reason:     reason,
+		Time:       time.Now(),
+	}
+	b.ledger = append(b.ledger, entry)
+	if len(b.ledger) > maxCreditLedgerEntries {
+		b.ledger = b.ledger[len(b.ledger)-maxCreditLedgerEntries:]
+	}
+	return entry
+}
+
+// reclaimExpired reclaims the unused credit of balances that have not been updated within the credit expiry.
+// The balances are kept with a zero amount until they are cleaned up so that their senders can be notified
+func (b *Balances) reclaimExpired() {
+	var entries []*CreditLedgerEntry
+
+	b.mtx.Lock()
+	if b.expiryPolicy == ReclaimCredit {
+		for id, balance := range b.balances {
+			if balance.amount.Sign() <= 0 || time.Since(balance.lastUpdate) <= b.creditExpiry {
+				continue
+			}
+			entries = append(entries, b.record(id, balance, CreditExpired))
+			if balance.reclaimed == nil {
+				balance.reclaimed = big.NewRat(0, 1)
+			}
+			balance.reclaimed.Add(balance.reclaimed, balance.amount)
+			balance.amount = big.NewRat(0, 1)
+		}
+	}
+	b.mtx.Unlock()
+
+	if len(entries) == 0 {
+		return
+	}
+	go func() {
+		for _, e := range entries {
+			glog.V(common.DEBUG).Infof("Reclaimed expired credit manifestID=%v sender=%v amount=%v", e.ManifestID, monitor.RedactAddress(e.Sender), e.Amount.FloatString(2))
+			b.reclaimFeed.Send(e)
+		}
+	}()
+}
+
 func (b *Balances) cleanup() {
+	var events []*BalanceCleanupEvent
+	var entries []*CreditLedgerEntry
+
+	b.mtx.Lock()
 	for id, balance := range b.balances {
-		b.mtx.Lock()
-		if int64(time.Since(balance.lastUpdate)) > int64(b.ttl) {
-			delete(b.balances, id)
+		if time.Since(balance.lastUpdate) <= b.ttl {
+			continue
 		}
-		b.mtx.Unlock()
+		delete(b.balances, id)
+
+		if balance.amount.Sign() == 0 {
+			continue
+		}
+
+		// Unused credit is never carried forward so it is reclaimed
+		if balance.amount.Sign() > 0 {
+			entries = append(entries, b.record(id, balance, CreditCleanedUp))
+		}
+
+		emptySender := balance.sender == (ethcommon.Address{})
+		if b.policy == CarryDebt && balance.amount.Sign() < 0 && !emptySender {
+			debt := new(big.Rat).Neg(balance.amount)
+			if existing, ok := b.debts[balance.sender]; ok {
+				debt.Add(debt, existing)
+			}
+			b.debts[balance.sender] = debt
+		}
+
+		events = append(events, &BalanceCleanupEvent{
+			ManifestID: id,
+			Sender:     balance.sender,
+			Amount:     balance.amount,
+			Policy:     b.policy,
+		})
+	}
+	b.mtx.Unlock()
+
+	if len(events) == 0 {
+		return
 	}
+	// Feed.Send blocks until every subscriber has received the event, so a slow
+	// subscriber must not hold up the cleanup loop
+	go func() {
+		for _, e := range events {
+			glog.V(common.DEBUG).Infof("Cleaned up balance manifestID=%v sender=%v amount=%v policy=%v", e.ManifestID, monitor.RedactAddress(e.Sender), e.Amount.FloatString(2), e.Policy)
+			b.cleanupFeed.Send(e)
+		}
+		for _, e := range entries {
+			b.reclaimFeed.Send(e)
+		}
+	}()
 }
 
 // StartCleanup is a state flushing method to clean up the balances mapping
 func (b *Balances) StartCleanup() {
-	ticker := time.NewTicker(b.ttl)
+	interval := b.ttl
+	if b.expiryPolicy == ReclaimCredit && b.creditExpiry > 0 && b.creditExpiry < interval {
+		interval = b.creditExpiry
+	}
+	ticker := time.NewTicker(interval)
 	for {
 		select {
 		case <-ticker.C:
+			b.reclaimExpired()
 			b.cleanup()
 		case <-b.quit:
 			return
@@ -149,4 +512,5 @@ func (b *Balances) StartCleanup() {
 // StopCleanup stops the cleanup loop for Balances
 func (b *Balances) StopCleanup() {
 	close(b.quit)
+	b.cleanupScope.Close()
 }
@@ -1,11 +1,14 @@
 package core
 
 import (
+	"fmt"
 	"math/big"
 	"testing"
 	"time"
 
+	ethcommon "github.com/ethereum/go-ethereum/common"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestBalance_Credit(t *testing.T) {
@@ -200,3 +203,276 @@ func TestBalancesCleanup(t *testing.T) {
 	// Now balance for mid1 should be cleaned as well
 	assert.Nil(b.Balance(mid1))
 }
+
+func TestParseBalanceCleanupPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	policy, err := ParseBalanceCleanupPolicy("discard")
+	assert.Nil(err)
+	assert.Equal(DiscardBalance, policy)
+
+	policy, err = ParseBalanceCleanupPolicy("carryDebt")
+	assert.Nil(err)
+	assert.Equal(CarryDebt, policy)
+
+	_, err = ParseBalanceCleanupPolicy("foo")
+	assert.EqualError(err, "unknown balance cleanup policy foo")
+}
+
+func TestBalancesCleanup_DiscardPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	b := NewBalances(0)
+	sender := ethcommon.HexToAddress("foo")
+	mid := ManifestID("some manifest id")
+
+	// Cleanup does not wait for subscribers to receive the events
+	events := make(chan *BalanceCleanupEvent)
+	sub := b.SubscribeCleanup(events)
+	defer sub.Unsubscribe()
+
+	b.Debit(mid, big.NewRat(5, 1))
+	b.SetSender(mid, sender)
+	b.cleanup()
+
+	assert.Nil(b.Balance(mid))
+	assert.Zero(big.NewRat(0, 1).Cmp(b.Debt(sender)))
+
+	e := <-events
+	assert.Equal(mid, e.ManifestID)
+	assert.Equal(sender, e.Sender)
+	assert.Zero(big.NewRat(-5, 1).Cmp(e.Amount))
+	assert.Equal(DiscardBalance, e.Policy)
+}
+
+func TestBalancesCleanup_CarryDebtPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	b := NewBalancesWithPolicy(0, CarryDebt)
+	sender := ethcommon.HexToAddress("foo")
+	mid1 := ManifestID("First MID")
+	mid2 := ManifestID("Second MID")
+
+	events := make(chan *BalanceCleanupEvent, 2)
+	sub := b.SubscribeCleanup(events)
+	defer sub.Unsubscribe()
+
+	// Negative balances are carried forward
+	b.Debit(mid1, big.NewRat(5, 1))
+	b.SetSender(mid1, sender)
+	b.cleanup()
+	assert.Nil(b.Balance(mid1))
+	assert.Zero(big.NewRat(5, 1).Cmp(b.Debt(sender)))
+	e := <-events
+	assert.Equal(CarryDebt, e.Policy)
+
+	// Zero balances do not emit events
+	b.Credit(mid2, big.NewRat(0, 1))
+	b.cleanup()
+	assert.Len(events, 0)
+
+	// Positive balances are not carried forward
+	b.Credit(mid2, big.NewRat(2, 1))
+	b.SetSender(mid2, sender)
+	// Debt is charged against the new stream of the sender
+	assert.Zero(big.NewRat(-3, 1).Cmp(b.Balance(mid2)))
+	assert.Zero(big.NewRat(0, 1).Cmp(b.Debt(sender)))
+
+	b.Credit(mid2, big.NewRat(4, 1))
+	b.cleanup()
+	assert.Zero(big.NewRat(0, 1).Cmp(b.Debt(sender)))
+	e = <-events
+	assert.Zero(big.NewRat(1, 1).Cmp(e.Amount))
+
+	// Balances without a sender are discarded
+	b.Debit(mid1, big.NewRat(1, 1))
+	b.cleanup()
+	assert.Zero(big.NewRat(0, 1).Cmp(b.Debt(ethcommon.Address{})))
+}
+
+func TestParseCreditExpiryPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	policy, err := ParseCreditExpiryPolicy("retain")
+	assert.Nil(err)
+	assert.Equal(RetainCredit, policy)
+
+	policy, err = ParseCreditExpiryPolicy("reclaim")
+	assert.Nil(err)
+	assert.Equal(ReclaimCredit, policy)
+
+	_, err = ParseCreditExpiryPolicy("foo")
+	assert.EqualError(err, "unknown credit expiry policy foo")
+}
+
+func TestBalancesReclaimExpired(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := NewBalances(time.Hour)
+	sender := ethcommon.HexToAddress("foo")
+	mid1 := ManifestID("First MID")
+	mid2 := ManifestID("Second MID")
+
+	entries := make(chan *CreditLedgerEntry, 2)
+	sub := b.SubscribeReclaim(entries)
+	defer sub.Unsubscribe()
+
+	b.Credit(mid1, big.NewRat(5, 1))
+	b.SetSender(mid1, sender)
+	b.Debit(mid2, big.NewRat(1, 1))
+
+	// Credit is retained by default
+	b.SetCreditExpiry(0, RetainCredit)
+	b.reclaimExpired()
+	assert.Zero(big.NewRat(5, 1).Cmp(b.Balance(mid1)))
+	assert.Nil(b.TakeReclaimed(mid1))
+	assert.Len(b.Ledger(), 0)
+
+	// Unused credit is reclaimed after it expires
+	b.SetCreditExpiry(0, ReclaimCredit)
+	b.reclaimExpired()
+	assert.Zero(big.NewRat(0, 1).Cmp(b.Balance(mid1)))
+
+	e := <-entries
+	assert.Equal(mid1, e.ManifestID)
+	assert.Equal(sender, e.Sender)
+	assert.Zero(big.NewRat(5, 1).Cmp(e.Amount))
+	assert.Equal(CreditExpired, e.Reason)
+
+	// Negative balances are not reclaimed
+	assert.Zero(big.NewRat(-1, 1).Cmp(b.Balance(mid2)))
+	assert.Nil(b.TakeReclaimed(mid2))
+
+	// The sender is notified of the reclaimed credit once
+	assert.Zero(big.NewRat(5, 1).Cmp(b.TakeReclaimed(mid1)))
+	assert.Nil(b.TakeReclaimed(mid1))
+
+	// Unused credit is not reclaimed before it expires
+	b.SetCreditExpiry(time.Hour, ReclaimCredit)
+	b.Credit(mid1, big.NewRat(3, 1))
+	b.reclaimExpired()
+	assert.Zero(big.NewRat(3, 1).Cmp(b.Balance(mid1)))
+
+	ledger := b.Ledger()
+	require.Len(ledger, 1)
+	assert.Equal(mid1, ledger[0].ManifestID)
+	assert.Zero(big.NewRat(5, 1).Cmp(ledger[0].Amount))
+	// The ledger cannot be modified through the returned entries
+	ledger[0].Amount.SetInt64(0)
+	assert.Zero(big.NewRat(5, 1).Cmp(b.Ledger()[0].Amount))
+}
+
+func TestBalancesCleanup_RecordsDiscardedCredit(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := NewBalancesWithPolicy(0, CarryDebt)
+	mid1 := ManifestID("First MID")
+	mid2 := ManifestID("Second MID")
+
+	b.Credit(mid1, big.NewRat(2, 1))
+	b.Debit(mid2, big.NewRat(3, 1))
+	b.cleanup()
+
+	// Only the unused credit is recorded
+	ledger := b.Ledger()
+	require.Len(ledger, 1)
+	assert.Equal(mid1, ledger[0].ManifestID)
+	assert.Zero(big.NewRat(2, 1).Cmp(ledger[0].Amount))
+	assert.Equal(CreditCleanedUp, ledger[0].Reason)
+}
+
+func TestBalancesLedger_DropsOldestEntries(t *testing.T) {
+	assert := assert.New(t)
+
+	b := NewBalances(0)
+	for i := 0; i < maxCreditLedgerEntries+1; i++ {
+		b.Credit(ManifestID(fmt.Sprintf("%d", i)), big.NewRat(1, 1))
+		b.cleanup()
+	}
+
+	ledger := b.Ledger()
+	assert.Len(ledger, maxCreditLedgerEntries)
+	assert.Equal(ManifestID("1"), ledger[0].ManifestID)
+}
+
+func TestBalancesRestoreReclaimed(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := NewBalances(time.Hour)
+	sender := ethcommon.HexToAddress("foo")
+	mid := ManifestID("some MID")
+
+	entries := make(chan *CreditLedgerEntry, 2)
+	sub := b.SubscribeReclaim(entries)
+	defer sub.Unsubscribe()
+
+	// Nothing to restore
+	assert.Nil(b.RestoreReclaimed(mid))
+
+	b.Credit(mid, big.NewRat(5, 1))
+	b.SetSender(mid, sender)
+	b.SetCreditExpiry(0, ReclaimCredit)
+	b.reclaimExpired()
+	<-entries
+	assert.Zero(big.NewRat(0, 1).Cmp(b.Balance(mid)))
+
+	// Reclaimed credit is returned to the balance
+	restored := b.RestoreReclaimed(mid)
+	require.NotNil(restored)
+	assert.Zero(big.NewRat(5, 1).Cmp(restored))
+	assert.Zero(big.NewRat(5, 1).Cmp(b.Balance(mid)))
+	assert.Nil(b.TakeReclaimed(mid))
+	assert.Nil(b.RestoreReclaimed(mid))
+
+	e := <-entries
+	assert.Equal(mid, e.ManifestID)
+	assert.Equal(sender, e.Sender)
+	assert.Zero(big.NewRat(-5, 1).Cmp(e.Amount))
+	assert.Equal(CreditRestored, e.Reason)
+	assert.Len(b.Ledger(), 2)
+}
+
+func TestBalancesPurgeLedger(t *testing.T) {
+	assert := assert.New(t)
+
+	b := NewBalances(time.Hour)
+	for _, mid := range []ManifestID{"a_1", "a_2", "b_1", "a_1"} {
+		b.record(mid, &balance{amount: big.NewRat(1, 1)}, CreditExpired)
+	}
+
+	assert.Equal(2, b.PurgeLedger(func(mid ManifestID) bool { return mid == "a_1" }))
+	ledger := b.Ledger()
+	assert.Len(ledger, 2)
+	assert.Equal(ManifestID("a_2"), ledger[0].ManifestID)
+	assert.Equal(ManifestID("b_1"), ledger[1].ManifestID)
+
+	assert.Equal(1, b.PurgeLedger(func(mid ManifestID) bool { return mid.Namespace() == "a" }))
+	assert.Zero(b.PurgeLedger(func(mid ManifestID) bool { return mid == "c_1" }))
+	assert.Len(b.Ledger(), 1)
+}
+
+func TestBalancesOpenUnpaid(t *testing.T) {
+	assert := assert.New(t)
+
+	b := NewBalances(time.Hour)
+	sender := ethcommon.HexToAddress("0x01")
+	assert.Nil(b.OpenUnpaid("foo", sender, 2))
+	assert.Zero(b.Balance("foo").Sign())
+	assert.EqualError(b.OpenUnpaid("foo", sender, 2), "the stream already has a balance")
+
+	// Streams that owe the fees of their first segment count against the sender
+	b.Debit("foo", big.NewRat(10, 1))
+	assert.Nil(b.OpenUnpaid("bar", sender, 2))
+	b.Debit("bar", big.NewRat(10, 1))
+	assert.EqualError(b.OpenUnpaid("baz", sender, 2), "the sender owes the fees of 2 streams")
+	assert.Nil(b.OpenUnpaid("baz", ethcommon.HexToAddress("0x02"), 2))
+	b.Credit("foo", big.NewRat(20, 1))
+	assert.Nil(b.OpenUnpaid("baz2", sender, 2))
+
+	// Senders that carry debt forward are not trusted
+	b.debts[sender] = big.NewRat(5, 1)
+	assert.EqualError(b.OpenUnpaid("qux", sender, 2), "the sender carries a debt of 5.00")
+}
@@ -0,0 +1,175 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/livepeer/go-livepeer/common"
+	ffmpeg "github.com/livepeer/lpms/ffmpeg"
+)
+
+// Weight of the latest segment in the moving average of a stream's source bitrate
+const complexitySmoothing = 0.2
+
+var ErrAdaptiveLadderConfig = errors.New("ErrAdaptiveLadderConfig")
+
+// AdaptiveLadderConfig describes the operator defined bounds within which
+// the bitrate ladder of a stream is adjusted to the complexity of its content
+type AdaptiveLadderConfig struct {
+	// Lowest factor that the bitrates of the ladder are scaled by
+	MinScale float64 `json:"minScale"`
+	// Highest factor that the bitrates of the ladder are scaled by
+	MaxScale float64 `json:"maxScale"`
+	// Lowest factor that the pixel counts of the ladder are scaled by for segments that
+	// are less complex than the stream average. Resolutions are never scaled up and are
+	// not changed if 0
+	MinPixelScale float64 `json:"minPixelScale,omitempty"`
+}
+
+// ParseAdaptiveLadderConfig parses bitrate scale bounds in the form "min,max" (e.g. "0.5,1.5"),
+// optionally followed by the min pixel scale (e.g. "0.5,1.5,0.5")
+func ParseAdaptiveLadderConfig(bounds string) (*AdaptiveLadderConfig, error) {
+	parts := strings.Split(bounds, ",")
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil, fmt.Errorf("%v: expected min,max[,minPixels] but got %v", ErrAdaptiveLadderConfig, bounds)
+	}
+	min, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return nil, fmt.Errorf("%v: invalid min scale %v", ErrAdaptiveLadderConfig, parts[0])
+	}
+	max, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return nil, fmt.Errorf("%v: invalid max scale %v", ErrAdaptiveLadderConfig, parts[1])
+	}
+	cfg := &AdaptiveLadderConfig{MinScale: min, MaxScale: max}
+	if len(parts) == 3 {
+		if cfg.MinPixelScale, err = strconv.ParseFloat(strings.TrimSpace(parts[2]), 64); err != nil {
+			return nil, fmt.Errorf("%v: invalid min pixel scale %v", ErrAdaptiveLadderConfig, parts[2])
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks that the bounds are positive and ordered, and that the min pixel scale is within (0, 1] if set
+func (cfg *AdaptiveLadderConfig) Validate() error {
+	if cfg.MinScale <= 0 || cfg.MaxScale <= 0 {
+		return fmt.Errorf("%v: scale bounds must be greater than 0", ErrAdaptiveLadderConfig)
+	}
+	if cfg.MinScale > cfg.MaxScale {
+		return fmt.Errorf("%v: min scale %v is greater than max scale %v", ErrAdaptiveLadderConfig, cfg.MinScale, cfg.MaxScale)
+	}
+	if cfg.MinPixelScale < 0 || cfg.MinPixelScale > 1 {
+		return fmt.Errorf("%v: min pixel scale %v must be between 0 and 1", ErrAdaptiveLadderConfig, cfg.MinPixelScale)
+	}
+	return nil
+}
+
+// AdaptiveLadder estimates the complexity of a stream's source segments
+// and adjusts the bitrate ladder of each segment accordingly
+type AdaptiveLadder struct {
+	cfg AdaptiveLadderConfig
+
+	mu sync.Mutex
+	// Moving average of the source bitrate in bits per second
+	avgBitrate float64
+}
+
+// NewAdaptiveLadder creates an AdaptiveLadder for a single stream
+func NewAdaptiveLadder(cfg AdaptiveLadderConfig) *AdaptiveLadder {
+	return &AdaptiveLadder{cfg: cfg}
+}
+
+// EstimateComplexity estimates the complexity of a source segment relative to the
+// preceding segments of the stream. The source encoder spends more bits on complex
+// scenes so a segment with a higher bitrate than the stream average is considered
+// more complex. Returns 1 for the first segment or if the segment cannot be analyzed
+func (l *AdaptiveLadder) EstimateComplexity(data []byte, duration float64) float64 {
+	if len(data) == 0 || duration <= 0 {
+		return 1
+	}
+	bitrate := float64(len(data)*8) / duration
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.avgBitrate == 0 {
+		l.avgBitrate = bitrate
+		return 1
+	}
+	complexity := bitrate / l.avgBitrate
+	l.avgBitrate = complexitySmoothing*bitrate + (1-complexitySmoothing)*l.avgBitrate
+	return complexity
+}
+
+// Scale returns the factor that the bitrates of the ladder are scaled by for a complexity
+func (l *AdaptiveLadder) Scale(complexity float64) float64 {
+	return math.Max(l.cfg.MinScale, math.Min(l.cfg.MaxScale, complexity))
+}
+
+// PixelScale returns the factor that the pixel counts of the ladder are scaled by for a complexity.
+// Returns 1 if the resolutions are not adjusted or the segment is at least as complex as the stream average
+func (l *AdaptiveLadder) PixelScale(complexity float64) float64 {
+	if l.cfg.MinPixelScale <= 0 {
+		return 1
+	}
+	return math.Max(l.cfg.MinPixelScale, math.Min(1, complexity))
+}
+
+// Adjust returns a copy of the profiles with their bitrates scaled for a complexity, and
+// their resolutions scaled down for a complexity below 1 if a min pixel scale is set.
+// Bitrates and resolutions that cannot be parsed, and audio-only profiles, are left unchanged
+func (l *AdaptiveLadder) Adjust(profiles []ffmpeg.VideoProfile, complexity float64) []ffmpeg.VideoProfile {
+	scale := l.Scale(complexity)
+	pixelScale := l.PixelScale(complexity)
+	adjusted := make([]ffmpeg.VideoProfile, len(profiles))
+	for i, p := range profiles {
+		adjusted[i] = p
+		if common.AudioOnlyProfile(p) {
+			continue
+		}
+		if pixelScale < 1 {
+			adjusted[i].Resolution = scaleResolution(p.Resolution, pixelScale)
+		}
+		bitrate, err := common.ParseBitrate(p.Bitrate)
+		if err != nil || bitrate <= 0 {
+			continue
+		}
+		// Round to kbps so that the adjusted bitrate is preserved on the wire
+		kbps := int(math.Round(float64(bitrate) * scale / 1000))
+		if kbps < 1 {
+			kbps = 1
+		}
+		adjusted[i].Bitrate = fmt.Sprintf("%dk", kbps)
+	}
+	return adjusted
+}
+
+// scaleResolution scales the pixel count of a WxH resolution while keeping its aspect ratio.
+// Dimensions are rounded down to even numbers as required by the encoders
+func scaleResolution(resolution string, pixelScale float64) string {
+	res := strings.Split(resolution, "x")
+	if len(res) != 2 {
+		return resolution
+	}
+	w, errW := strconv.Atoi(res[0])
+	h, errH := strconv.Atoi(res[1])
+	if errW != nil || errH != nil || w <= 0 || h <= 0 {
+		return resolution
+	}
+	dimScale := math.Sqrt(pixelScale)
+	even := func(d int) int {
+		d = int(float64(d)*dimScale) &^ 1
+		if d < 2 {
+			d = 2
+		}
+		return d
+	}
+	return fmt.Sprintf("%dx%d", even(w), even(h))
+}
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"testing"
+
+	ffmpeg "github.com/livepeer/lpms/ffmpeg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAdaptiveLadderConfig(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	cfg, err := ParseAdaptiveLadderConfig("0.5, 1.5")
+	require.Nil(err)
+	assert.Equal(&AdaptiveLadderConfig{MinScale: 0.5, MaxScale: 1.5}, cfg)
+
+	cfg, err = ParseAdaptiveLadderConfig("1,1")
+	require.Nil(err)
+	assert.Equal(&AdaptiveLadderConfig{MinScale: 1, MaxScale: 1}, cfg)
+
+	cfg, err = ParseAdaptiveLadderConfig("0.5,1.5,0.25")
+	require.Nil(err)
+	assert.Equal(&AdaptiveLadderConfig{MinScale: 0.5, MaxScale: 1.5, MinPixelScale: 0.25}, cfg)
+
+	for _, bounds := range []string{"", "0.5", "0.5,1.5,2", "0.5,1.5,-1", "0.5,1.5,c", "0.5,1.5,0.5,1", "a,1", "1,b", "0,1", "-1,1", "1.5,0.5"} {
+		_, err := ParseAdaptiveLadderConfig(bounds)
+		assert.Error(err, bounds)
+	}
+}
+
+func TestAdaptiveLadder_EstimateComplexity(t *testing.T) {
+	assert := assert.New(t)
+	l := NewAdaptiveLadder(AdaptiveLadderConfig{MinScale: 0.5, MaxScale: 1.5})
+
+	// Segments that cannot be analyzed do not affect the average
+	assert.Equal(1.0, l.EstimateComplexity(nil, 2))
+	assert.Equal(1.0, l.EstimateComplexity(make([]byte, 100), 0))
+
+	// First segment sets the baseline
+	assert.Equal(1.0, l.EstimateComplexity(make([]byte, 1000), 2))
+	// Same bitrate
+	assert.Equal(1.0, l.EstimateComplexity(make([]byte, 500), 1))
+	// Double the bitrate
+	assert.Equal(2.0, l.EstimateComplexity(make([]byte, 1000), 1))
+	// The average moves towards the latest segments
+	// avg = 0.2 * 8000 + 0.8 * 4000 = 4800
+	assert.Equal(0.5, l.EstimateComplexity(make([]byte, 300), 1))
+}
+
+func TestAdaptiveLadder_Adjust(t *testing.T) {
+	assert := assert.New(t)
+	l := NewAdaptiveLadder(AdaptiveLadderConfig{MinScale: 0.5, MaxScale: 1.5})
+
+	// Scale is bounded
+	assert.Equal(0.5, l.Scale(0.1))
+	assert.Equal(0.8, l.Scale(0.8))
+	assert.Equal(1.5, l.Scale(3))
+
+	profiles := []ffmpeg.VideoProfile{
+		ffmpeg.VideoProfile{Name: "a", Bitrate: "1000k", Resolution: "640x360"},
+		ffmpeg.VideoProfile{Name: "b", Bitrate: "2500", Resolution: "1280x720"},
+		ffmpeg.VideoProfile{Name: "c", Bitrate: "invalid", Resolution: "1920x1080"},
+		ffmpeg.VideoProfile{Name: "audio", Bitrate: "64k"},
+	}
+
+	adjusted := l.Adjust(profiles, 0.8)
+	assert.Equal("800k", adjusted[0].Bitrate)
+	assert.Equal("640x360", adjusted[0].Resolution)
+	// Rounded to kbps
+	assert.Equal("2k", adjusted[1].Bitrate)
+	// Unparseable bitrates are left unchanged
+	assert.Equal("invalid", adjusted[2].Bitrate)
+	// Audio-only profiles are left unchanged
+	assert.Equal(profiles[3], adjusted[3])
+
+	// Bounded by the max scale
+	adjusted = l.Adjust(profiles, 3)
+	assert.Equal("1500k", adjusted[0].Bitrate)
+
+	// The input profiles are not modified
+	assert.Equal("1000k", profiles[0].Bitrate)
+}
+
+func TestAdaptiveLadder_Adjust_Resolution(t *testing.T) {
+	assert := assert.New(t)
+	l := NewAdaptiveLadder(AdaptiveLadderConfig{MinScale: 0.5, MaxScale: 1.5, MinPixelScale: 0.0625})
+
+	// Pixel scale is bounded and never above 1
+	assert.Equal(0.0625, l.PixelScale(0.01))
+	assert.Equal(0.64, l.PixelScale(0.64))
+	assert.Equal(1.0, l.PixelScale(3))
+
+	profiles := []ffmpeg.VideoProfile{
+		ffmpeg.VideoProfile{Name: "a", Bitrate: "1000k", Resolution: "1280x720"},
+		ffmpeg.VideoProfile{Name: "b", Bitrate: "1000k", Resolution: "1000x562"},
+		ffmpeg.VideoProfile{Name: "c", Bitrate: "1000k", Resolution: "invalid"},
+	}
+
+	// Dimensions are scaled by the square root of the pixel scale and rounded down to even numbers
+	adjusted := l.Adjust(profiles, 0.25)
+	assert.Equal("640x360", adjusted[0].Resolution)
+	assert.Equal("500k", adjusted[0].Bitrate)
+	assert.Equal("500x280", adjusted[1].Resolution)
+	// Unparseable resolutions are left unchanged
+	assert.Equal("invalid", adjusted[2].Resolution)
+
+	// Bounded by the min pixel scale
+	adjusted = l.Adjust(profiles, 0.01)
+	assert.Equal("320x180", adjusted[0].Resolution)
+
+	// Resolutions are not scaled up for complex segments
+	adjusted = l.Adjust(profiles, 3)
+	assert.Equal("1280x720", adjusted[0].Resolution)
+	assert.Equal("1500k", adjusted[0].Bitrate)
+
+	// Resolutions are not changed without a min pixel scale
+	l = NewAdaptiveLadder(AdaptiveLadderConfig{MinScale: 0.5, MaxScale: 1.5})
+	adjusted = l.Adjust(profiles, 0.1)
+	assert.Equal("1280x720", adjusted[0].Resolution)
+
+	// The input profiles are not modified
+	assert.Equal("1280x720", profiles[0].Resolution)
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/common"
+	lpmon "github.com/livepeer/go-livepeer/monitor"
+	ffmpeg "github.com/livepeer/lpms/ffmpeg"
+)
+
+// Weight of the latest measurement in the moving average of the transcoding throughput
+const throughputSmoothing = 0.2
+
+var ErrCapacityTunerConfig = errors.New("ErrCapacityTunerConfig")
+
+// CapacityTuner adjusts the number of sessions that a node accepts to its measured
+// transcoding throughput, within operator defined bounds
+type CapacityTuner struct {
+	// Lowest number of sessions that are accepted
+	floor int
+	// Highest number of sessions that are accepted
+	ceiling int
+
+	mu sync.RWMutex
+	// Moving average of the number of streams that can be transcoded in real time
+	throughput float64
+	measured   bool
+	capacity   int
+}
+
+// NewCapacityTuner creates a CapacityTuner that accepts floor sessions until the throughput is measured
+func NewCapacityTuner(floor, ceiling int) (*CapacityTuner, error) {
+	if floor <= 0 {
+		return nil, fmt.Errorf("%v: min sessions must be greater than 0", ErrCapacityTunerConfig)
+	}
+	if floor > ceiling {
+		return nil, fmt.Errorf("%v: min sessions %v is greater than max sessions %v", ErrCapacityTunerConfig, floor, ceiling)
+	}
+	return &CapacityTuner{
+		floor:    floor,
+		ceiling:  ceiling,
+		capacity: floor,
+	}, nil
+}
+
+// Capacity returns the number of sessions that are currently accepted
+func (t *CapacityTuner) Capacity() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.capacity
+}
+
+// Throughput returns the measured number of streams that can be transcoded in real time. 0 if not measured yet
+func (t *CapacityTuner) Throughput() float64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.throughput
+}
+
+// Record measures the throughput from a segment of the given duration in seconds that took took to transcode
+// while sessions streams were transcoded concurrently
+func (t *CapacityTuner) Record(sessions int, duration float64, took time.Duration) {
+	if sessions <= 0 || duration <= 0 || took <= 0 {
+		return
+	}
+	// Each of the concurrent streams receives duration seconds of content every took
+	sample := float64(sessions) * duration / took.Seconds()
+
+	t.mu.Lock()
+	if t.measured {
+		t.throughput = throughputSmoothing*sample + (1-throughputSmoothing)*t.throughput
+	} else {
+		t.throughput = sample
+		t.measured = true
+	}
+	capacity := t.clamp(int(math.Floor(t.throughput)))
+	changed := capacity != t.capacity
+	t.capacity = capacity
+	throughput := t.throughput
+	t.mu.Unlock()
+
+	if changed {
+		glog.Infof("Adjusted max sessions to measured throughput maxSessions=%v throughput=%.2f", capacity, throughput)
+		if lpmon.Enabled {
+			lpmon.MaxSessions(capacity)
+		}
+	}
+}
+
+// Benchmark measures the throughput by transcoding a sample segment into the given profiles
+// with as many concurrent transcodes as the lowest number of accepted sessions
+func (t *CapacityTuner) Benchmark(transcoder Transcoder, fname string, profiles []ffmpeg.VideoProfile) error {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return err
+	}
+	info, err := common.InspectTS(data)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, t.floor)
+	start := time.Now()
+	for i := 0; i < t.floor; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := transcoder.Transcode(fname, profiles, nil); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	took := time.Since(start)
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+
+	glog.Infof("Benchmarked transcoding sessions=%v duration=%.3fs took=%v", t.floor, info.Duration, took)
+	t.Record(t.floor, info.Duration, took)
+	return nil
+}
+
+func (t *CapacityTuner) clamp(capacity int) int {
+	if capacity < t.floor {
+		return t.floor
+	}
+	if capacity > t.ceiling {
+		return t.ceiling
+	}
+	return capacity
+}
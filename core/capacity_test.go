@@ -0,0 +1,115 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCapacityTuner(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewCapacityTuner(0, 10)
+	assert.EqualError(err, "ErrCapacityTunerConfig: min sessions must be greater than 0")
+
+	_, err = NewCapacityTuner(11, 10)
+	assert.EqualError(err, "ErrCapacityTunerConfig: min sessions 11 is greater than max sessions 10")
+
+	tuner, err := NewCapacityTuner(2, 10)
+	assert.Nil(err)
+	// The floor is accepted until the throughput is measured
+	assert.Equal(2, tuner.Capacity())
+	assert.Zero(tuner.Throughput())
+}
+
+func TestCapacityTuner_Record(t *testing.T) {
+	assert := assert.New(t)
+
+	tuner, err := NewCapacityTuner(2, 10)
+	require.Nil(t, err)
+
+	// Invalid measurements are ignored
+	tuner.Record(0, 2, time.Second)
+	tuner.Record(1, 0, time.Second)
+	tuner.Record(1, 2, 0)
+	assert.Zero(tuner.Throughput())
+
+	// The first measurement sets the throughput
+	// 2 streams transcoding 2s segments in 1s can grow to 4 streams
+	tuner.Record(2, 2, time.Second)
+	assert.Equal(4.0, tuner.Throughput())
+	assert.Equal(4, tuner.Capacity())
+
+	// Later measurements are smoothed
+	tuner.Record(4, 2, 500*time.Millisecond)
+	assert.InDelta(0.2*16+0.8*4, tuner.Throughput(), 0.0001)
+	assert.Equal(6, tuner.Capacity())
+
+	// Capacity is clamped to the ceiling
+	for i := 0; i < 20; i++ {
+		tuner.Record(4, 2, 100*time.Millisecond)
+	}
+	assert.Equal(10, tuner.Capacity())
+
+	// Capacity is clamped to the floor
+	for i := 0; i < 50; i++ {
+		tuner.Record(1, 2, 4*time.Second)
+	}
+	assert.Equal(2, tuner.Capacity())
+}
+
+func TestCapacityTuner_Benchmark(t *testing.T) {
+	assert := assert.New(t)
+
+	tuner, err := NewCapacityTuner(1, 100)
+	require.Nil(t, err)
+
+	// Missing sample segment
+	tcoder := &StubTranscoder{}
+	assert.NotNil(tuner.Benchmark(tcoder, "dne.ts", videoProfiles))
+	assert.Equal(0, tcoder.SegCount)
+
+	// Transcode error
+	tcoder.FailTranscode = true
+	assert.Equal(ErrTranscode, tuner.Benchmark(tcoder, "test.ts", videoProfiles))
+	assert.Zero(tuner.Throughput())
+
+	// The stub transcodes the ~8.7s sample segment much faster than real time
+	tcoder.FailTranscode = false
+	assert.Nil(tuner.Benchmark(tcoder, "test.ts", videoProfiles))
+	assert.Equal(1, tcoder.SegCount)
+	assert.True(tuner.Throughput() > 1)
+	assert.Equal(100, tuner.Capacity())
+}
+
+func TestMaxSessions_CapacityTuner(t *testing.T) {
+	assert := assert.New(t)
+
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	n, _ := NewLivepeerNode(nil, "", nil)
+	o := NewOrchestrator(n)
+	md := StubSegTranscodingMetadata()
+
+	// MaxSessions is used without a tuner
+	assert.Equal(MaxSessions, n.MaxSessions())
+
+	tuner, err := NewCapacityTuner(1, 10)
+	require.Nil(t, err)
+	n.CapacityTuner = tuner
+	assert.Equal(1, n.MaxSessions())
+
+	_, err = n.getSegmentChan(md)
+	assert.Nil(err)
+
+	// Existing sessions pass while new sessions are rejected at capacity
+	assert.Nil(o.CheckCapacity(md.ManifestID, nil))
+	assert.Equal(ErrOrchCap, o.CheckCapacity(ManifestID("foo"), nil))
+
+	// New sessions are accepted once the measured throughput increases
+	tuner.Record(1, 2, time.Second)
+	assert.Equal(2, n.MaxSessions())
+	assert.Nil(o.CheckCapacity(ManifestID("foo"), nil))
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
 	"testing"
 	"time"
@@ -13,6 +14,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/drivers"
 	"github.com/livepeer/go-livepeer/eth"
 	"github.com/livepeer/lpms/ffmpeg"
@@ -95,7 +97,7 @@ func TestTranscodeSeg(t *testing.T) {
 	assert.Nil(res.Err)
 	assert.Nil(res.Sig)
 	// sanity check results
-	resBytes, _ := n.Transcoder.Transcode("", profiles)
+	resBytes, _ := n.Transcoder.Transcode("", profiles, nil)
 	for i, trData := range res.TranscodeData.Segments {
 		assert.Equal(resBytes.Segments[i].Data, trData.Data)
 	}
@@ -114,6 +116,46 @@ func TestTranscodeSeg(t *testing.T) {
 	assert.Equal(resHash, res.Sig)
 }
 
+// dataTranscoder returns preset transcoded segments
+type dataTranscoder struct {
+	segments []*TranscodedSegmentData
+}
+
+func (t *dataTranscoder) Transcode(fname string, profiles []ffmpeg.VideoProfile, encoders common.ProfileEncoders) (*TranscodeData, error) {
+	return &TranscodeData{Segments: t.segments}, nil
+}
+
+func TestTranscodeSeg_AudioOnly(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	tmp, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(tmp)
+
+	data, err := ioutil.ReadFile("test.ts")
+	require.Nil(err)
+	duration, err := common.TSAudioDuration(data)
+	require.Nil(err)
+
+	audio := ffmpeg.VideoProfile{Name: "audio", Bitrate: "64k"}
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, audio}
+	tr := &dataTranscoder{segments: []*TranscodedSegmentData{{Data: data, Pixels: 1000}, {Data: data}}}
+	n, _ := NewLivepeerNode(nil, tmp, nil)
+	n.Transcoder = tr
+	conf := transcodeConfig{LocalOS: (drivers.NewMemoryDriver(nil)).NewSession("")}
+	md := &SegTranscodingMetadata{Profiles: profiles, Encoders: common.ProfileEncoders{"audio": {Codec: common.CodecAAC}}}
+
+	// Audio-only renditions are charged for their duration
+	res := n.transcodeSeg(conf, StubSegment(), md)
+	require.Nil(res.Err)
+	assert.Equal(int64(1000), res.TranscodeData.Segments[0].Pixels)
+	assert.Equal(int64(math.Round(duration*float64(AudioPixelsPerSecond))), res.TranscodeData.Segments[1].Pixels)
+
+	// Audio-only renditions without an audio track fail
+	tr.segments[1] = &TranscodedSegmentData{Data: make([]byte, 188)}
+	res = n.transcodeSeg(conf, StubSegment(), md)
+	assert.EqualError(res.Err, "invalid MPEG-TS sync byte at offset 0")
+}
+
 func TestTranscodeLoop_GivenNoSegmentsPastTimeout_CleansSegmentChan(t *testing.T) {
 	//Set up the node
 	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
@@ -0,0 +1,16 @@
+package core
+
+// #cgo pkg-config: libavcodec
+// #include <stdlib.h>
+// #include <libavcodec/avcodec.h>
+import "C"
+import "unsafe"
+
+// encoderAvailable returns whether FFmpeg was built with an encoder. Replaced in tests
+var encoderAvailable = ffmpegHasEncoder
+
+func ffmpegHasEncoder(name string) bool {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	return C.avcodec_find_encoder_by_name(cname) != nil
+}
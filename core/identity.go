@@ -0,0 +1,70 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/golang/glog"
+)
+
+// TranscoderIdentity is the key that a standalone transcoder signs its results with.
+// The orchestrator verifies the results against the address that the transcoder registered
+type TranscoderIdentity struct {
+	key *ecdsa.PrivateKey
+}
+
+// NewTranscoderIdentity creates an identity from an existing key
+func NewTranscoderIdentity(key *ecdsa.PrivateKey) *TranscoderIdentity {
+	return &TranscoderIdentity{key: key}
+}
+
+// LoadTranscoderIdentity reads the identity key from file, creating it if it doesn't exist
+// so that the transcoder keeps the same identity across restarts
+func LoadTranscoderIdentity(file string) (*TranscoderIdentity, error) {
+	if _, err := os.Stat(file); err == nil {
+		key, err := crypto.LoadECDSA(file)
+		if err != nil {
+			return nil, fmt.Errorf("error loading transcoder identity from %v: %v", file, err)
+		}
+		return NewTranscoderIdentity(key), nil
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := crypto.SaveECDSA(file, key); err != nil {
+		return nil, fmt.Errorf("error saving transcoder identity to %v: %v", file, err)
+	}
+	id := NewTranscoderIdentity(key)
+	glog.Infof("Created transcoder identity address=%v file=%v", id.Address().Hex(), file)
+	return id, nil
+}
+
+// Address returns the ETH address of the identity
+func (id *TranscoderIdentity) Address() ethcommon.Address {
+	return crypto.PubkeyToAddress(id.key.PublicKey)
+}
+
+// Sign signs msg in the same format as ETH accounts so that it can be verified with pm.VerifySig
+func (id *TranscoderIdentity) Sign(msg []byte) ([]byte, error) {
+	personalMsg := fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", 32, msg)
+	return crypto.Sign(crypto.Keccak256([]byte(personalMsg)), id.key)
+}
+
+// TranscodeResultsHash returns the hash of the results of a remote transcoding task that is signed
+// by the transcoder. It covers the task ID, so that results can't be replayed for other tasks, and
+// the hash of every transcoded segment in order
+func TranscodeResultsHash(taskID int64, td *TranscodeData) []byte {
+	hashes := make([][]byte, 0, len(td.Segments)+1)
+	tid := make([]byte, 8)
+	binary.BigEndian.PutUint64(tid, uint64(taskID))
+	hashes = append(hashes, tid)
+	for _, seg := range td.Segments {
+		hashes = append(hashes, crypto.Keccak256(seg.Data))
+	}
+	return crypto.Keccak256(hashes...)
+}
@@ -0,0 +1,58 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/livepeer/go-livepeer/pm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadTranscoderIdentity(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", t.Name())
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "transcoder.key")
+
+	// The identity is created once and kept across restarts
+	id, err := LoadTranscoderIdentity(file)
+	require.Nil(err)
+	_, err = os.Stat(file)
+	assert.Nil(err)
+	id2, err := LoadTranscoderIdentity(file)
+	require.Nil(err)
+	assert.Equal(id.Address(), id2.Address())
+
+	require.Nil(ioutil.WriteFile(file, []byte("notakey"), 0600))
+	_, err = LoadTranscoderIdentity(file)
+	assert.NotNil(err)
+}
+
+func TestTranscoderIdentity_Sign(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", t.Name())
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	id, err := LoadTranscoderIdentity(filepath.Join(dir, "transcoder.key"))
+	require.Nil(err)
+
+	td := &TranscodeData{Segments: []*TranscodedSegmentData{{Data: []byte("seg1")}, {Data: []byte("seg2")}}}
+	hash := TranscodeResultsHash(1, td)
+	sig, err := id.Sign(hash)
+	require.Nil(err)
+	assert.True(pm.VerifySig(id.Address(), hash, sig))
+
+	// The hash covers the task and every segment in order
+	assert.NotEqual(hash, TranscodeResultsHash(2, td))
+	reordered := &TranscodeData{Segments: []*TranscodedSegmentData{td.Segments[1], td.Segments[0]}}
+	assert.NotEqual(hash, TranscodeResultsHash(1, reordered))
+	assert.False(pm.VerifySig(id.Address(), TranscodeResultsHash(1, reordered), sig))
+}
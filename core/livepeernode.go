@@ -52,6 +52,7 @@ type LivepeerNode struct {
 	WorkDir  string
 	NodeType NodeType
 	Database *common.DB
+	Sessions *SessionRegistry
 
 	// Transcoder public fields
 	SegmentChans      map[ManifestID]SegmentChan
@@ -62,9 +63,30 @@ type LivepeerNode struct {
 	TranscoderManager *RemoteTranscoderManager
 	Balances          *Balances
 	ErrorMonitor      *errorMonitor
+	// CapacityTuner adjusts the number of accepted sessions to the measured
+	// transcoding throughput. MaxSessions are accepted if nil
+	CapacityTuner *CapacityTuner
+	// PixelCapacity admits streams whose ladders fit the pixels per second that
+	// the node can transcode. Streams are only limited by MaxSessions if nil
+	PixelCapacity *PixelCapacity
+	// LoadShedder drains the lowest value streams when the node is overloaded.
+	// Every stream is kept if nil
+	LoadShedder *LoadShedder
+	// TranscoderIdentity signs the results of a standalone transcoder. The
+	// orchestrator verifies them against the address that it registered
+	TranscoderIdentity *TranscoderIdentity
 
 	// Broadcaster public fields
 	Sender pm.Sender
+	// OrchHealth keeps the health observations of orchestrators shared with other
+	// broadcasters. Orchestrators are not checked for their health if nil
+	OrchHealth *OrchestratorHealth
+	// OrchReputation scores orchestrators with the statistics of their segments that are kept
+	// in the DB. Orchestrators are not weighted by their reputation if nil
+	OrchReputation *OrchestratorReputation
+	// OrchLists filter the orchestrators that segments are sent to with an allowlist and a
+	// denylist kept in the DB. Orchestrators are not filtered if nil
+	OrchLists *OrchestratorLists
 
 	// Thread safety for config fields
 	mu sync.RWMutex
@@ -72,6 +94,14 @@ type LivepeerNode struct {
 	priceInfo    *big.Rat
 	serviceURI   url.URL
 	segmentMutex *sync.RWMutex
+	// Streams that can be resumed. Protected by segmentMutex
+	streamStates map[ManifestID]*streamState
+	// Number of one-shot jobs being transcoded. Protected by segmentMutex
+	oneShotJobs int
+
+	// Ticket batch limits advertised to and enforced on broadcasters
+	maxTicketsPerPayment int
+	maxBatchFaceValue    *big.Int
 }
 
 //NewLivepeerNode creates a new Livepeer Node. Eth can be nil.
@@ -81,8 +111,10 @@ func NewLivepeerNode(e eth.LivepeerEthClient, wd string, dbh *common.DB) (*Livep
 		Eth:          e,
 		WorkDir:      wd,
 		Database:     dbh,
+		Sessions:     NewSessionRegistry(DefaultSessionIdleTimeout),
 		SegmentChans: make(map[ManifestID]SegmentChan),
 		segmentMutex: &sync.RWMutex{},
+		streamStates: make(map[ManifestID]*streamState),
 	}, nil
 }
 
@@ -98,6 +130,14 @@ func (n *LivepeerNode) SetServiceURI(newUrl *url.URL) {
 	n.serviceURI = *newUrl
 }
 
+// MaxSessions returns the number of sessions that the node currently accepts
+func (n *LivepeerNode) MaxSessions() int {
+	if n.CapacityTuner != nil {
+		return n.CapacityTuner.Capacity()
+	}
+	return MaxSessions
+}
+
 // SetBasePrice sets the base price for an orchestrator on the node
 func (n *LivepeerNode) SetBasePrice(price *big.Rat) {
 	n.mu.Lock()
@@ -111,3 +151,20 @@ func (n *LivepeerNode) GetBasePrice() *big.Rat {
 	defer n.mu.RUnlock()
 	return n.priceInfo
 }
+
+// SetTicketBatchLimits sets the maximum number of tickets and the maximum total face value
+// that an orchestrator accepts with a single payment. A zero value or nil means there is no limit
+func (n *LivepeerNode) SetTicketBatchLimits(maxTickets int, maxFaceValue *big.Int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.maxTicketsPerPayment = maxTickets
+	n.maxBatchFaceValue = maxFaceValue
+}
+
+// GetTicketBatchLimits gets the maximum number of tickets and the maximum total face value
+// that an orchestrator accepts with a single payment
+func (n *LivepeerNode) GetTicketBatchLimits() (int, *big.Int) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.maxTicketsPerPayment, n.maxBatchFaceValue
+}
@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/drivers"
 	"github.com/livepeer/lpms/ffmpeg"
 	"github.com/stretchr/testify/assert"
@@ -21,7 +22,7 @@ type StubTranscoder struct {
 	FailTranscode bool
 }
 
-func (t *StubTranscoder) Transcode(fname string, profiles []ffmpeg.VideoProfile) (*TranscodeData, error) {
+func (t *StubTranscoder) Transcode(fname string, profiles []ffmpeg.VideoProfile, encoders common.ProfileEncoders) (*TranscodeData, error) {
 	if t.FailTranscode {
 		return nil, ErrTranscode
 	}
@@ -0,0 +1,221 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Number of segments at the end of a Low-Latency HLS playlist that keep advertising their parts
+const llhlsPartSegments = 3
+
+var ErrLLHLSPlaylist = errors.New("ErrLLHLSPlaylist")
+
+// LLHLSPart is a partial segment of a Low-Latency HLS playlist
+type LLHLSPart struct {
+	URI      string
+	Duration float64
+	// Independent is true if the part starts with an IDR frame
+	Independent bool
+}
+
+type llhlsSegment struct {
+	seqNo    uint64
+	uri      string
+	duration float64
+	parts    []*LLHLSPart
+	complete bool
+}
+
+// LLHLSPlaylist is a live media playlist that advertises the partial segments of its most recent
+// segments and supports blocking playlist reloads, as described by the Low-Latency HLS extension
+type LLHLSPlaylist struct {
+	winSize uint
+
+	mu       sync.Mutex
+	segments []*llhlsSegment
+	// Highest duration of the segments and parts that were inserted
+	maxDuration     float64
+	maxPartDuration float64
+	// Closed and replaced whenever the playlist changes
+	updated chan struct{}
+}
+
+// NewLLHLSPlaylist creates a playlist that holds up to winSize complete segments
+func NewLLHLSPlaylist(winSize uint) *LLHLSPlaylist {
+	return &LLHLSPlaylist{
+		winSize: winSize,
+		updated: make(chan struct{}),
+	}
+}
+
+// InsertPart appends a part to the segment with the given sequence number
+func (p *LLHLSPlaylist) InsertPart(seqNo uint64, part *LLHLSPart) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	seg, err := p.getOrCreate(seqNo)
+	if err != nil {
+		return err
+	}
+	if seg.complete {
+		return fmt.Errorf("%v: segment seqNo=%d is already complete", ErrLLHLSPlaylist, seqNo)
+	}
+	seg.parts = append(seg.parts, part)
+	p.maxPartDuration = math.Max(p.maxPartDuration, part.Duration)
+	p.notify()
+	return nil
+}
+
+// InsertSegment completes the segment with the given sequence number
+func (p *LLHLSPlaylist) InsertSegment(seqNo uint64, uri string, duration float64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	seg, err := p.getOrCreate(seqNo)
+	if err != nil {
+		return err
+	}
+	if seg.complete {
+		return fmt.Errorf("%v: segment seqNo=%d is already complete", ErrLLHLSPlaylist, seqNo)
+	}
+	seg.uri = uri
+	seg.duration = duration
+	seg.complete = true
+	p.maxDuration = math.Max(p.maxDuration, duration)
+
+	// Slide the window over the complete segments
+	complete := 0
+	for _, s := range p.segments {
+		if s.complete {
+			complete++
+		}
+	}
+	for complete > int(p.winSize) && len(p.segments) > 0 {
+		if p.segments[0].complete {
+			complete--
+		}
+		p.segments = p.segments[1:]
+	}
+	p.notify()
+	return nil
+}
+
+// TargetDuration returns the EXT-X-TARGETDURATION of the playlist
+func (p *LLHLSPlaylist) TargetDuration() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return uint64(math.Ceil(p.maxDuration))
+}
+
+// Wait blocks until the playlist contains the segment msn or, if part is not negative, the part
+// with that index within the segment. An error is returned if the context is done first
+func (p *LLHLSPlaylist) Wait(ctx context.Context, msn uint64, part int) error {
+	for {
+		p.mu.Lock()
+		ok := p.contains(msn, part)
+		updated := p.updated
+		p.mu.Unlock()
+		if ok {
+			return nil
+		}
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// NextMSN returns the sequence number of the segment following the last segment that
+// is complete or has parts
+func (p *LLHLSPlaylist) NextMSN() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.segments) == 0 {
+		return 0
+	}
+	return p.segments[len(p.segments)-1].seqNo + 1
+}
+
+// Encode renders the playlist
+func (p *LLHLSPlaylist) Encode() *bytes.Buffer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("#EXTM3U\n#EXT-X-VERSION:6\n")
+	buf.WriteString("#EXT-X-TARGETDURATION:" + strconv.FormatUint(uint64(math.Ceil(p.maxDuration)), 10) + "\n")
+	if p.maxPartDuration > 0 {
+		buf.WriteString("#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=" + formatHLSDuration(3*p.maxPartDuration) + "\n")
+		buf.WriteString("#EXT-X-PART-INF:PART-TARGET=" + formatHLSDuration(p.maxPartDuration) + "\n")
+	} else {
+		buf.WriteString("#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES\n")
+	}
+	var firstSeqNo uint64
+	if len(p.segments) > 0 {
+		firstSeqNo = p.segments[0].seqNo
+	}
+	buf.WriteString("#EXT-X-MEDIA-SEQUENCE:" + strconv.FormatUint(firstSeqNo, 10) + "\n")
+
+	for i, seg := range p.segments {
+		if i >= len(p.segments)-llhlsPartSegments-1 {
+			for _, part := range seg.parts {
+				buf.WriteString(`#EXT-X-PART:DURATION=` + formatHLSDuration(part.Duration) + `,URI="` + part.URI + `"`)
+				if part.Independent {
+					buf.WriteString(",INDEPENDENT=YES")
+				}
+				buf.WriteString("\n")
+			}
+		}
+		if seg.complete {
+			buf.WriteString("#EXTINF:" + formatHLSDuration(seg.duration) + ",\n")
+			buf.WriteString(seg.uri + "\n")
+		}
+	}
+	return buf
+}
+
+// Caller of this function should hold the mu lock
+func (p *LLHLSPlaylist) getOrCreate(seqNo uint64) (*llhlsSegment, error) {
+	i := sort.Search(len(p.segments), func(i int) bool { return p.segments[i].seqNo >= seqNo })
+	if i < len(p.segments) && p.segments[i].seqNo == seqNo {
+		return p.segments[i], nil
+	}
+	if i == 0 && len(p.segments) > 0 && p.segments[0].complete && uint(len(p.segments)) >= p.winSize {
+		return nil, fmt.Errorf("%v: segment seqNo=%d is older than the playlist window", ErrLLHLSPlaylist, seqNo)
+	}
+	seg := &llhlsSegment{seqNo: seqNo}
+	p.segments = append(p.segments, nil)
+	copy(p.segments[i+1:], p.segments[i:])
+	p.segments[i] = seg
+	return seg, nil
+}
+
+// Caller of this function should hold the mu lock
+func (p *LLHLSPlaylist) contains(msn uint64, part int) bool {
+	for _, seg := range p.segments {
+		if seg.seqNo > msn {
+			return true
+		}
+		if seg.seqNo == msn {
+			return seg.complete || (part >= 0 && part < len(seg.parts))
+		}
+	}
+	return false
+}
+
+// Caller of this function should hold the mu lock
+func (p *LLHLSPlaylist) notify() {
+	close(p.updated)
+	p.updated = make(chan struct{})
+}
+
+func formatHLSDuration(d float64) string {
+	return strconv.FormatFloat(d, 'f', 3, 64)
+}
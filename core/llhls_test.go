@@ -0,0 +1,109 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLLHLSPlaylist_Encode(t *testing.T) {
+	assert := assert.New(t)
+
+	pl := NewLLHLSPlaylist(2)
+	assert.Equal("#EXTM3U\n#EXT-X-VERSION:6\n#EXT-X-TARGETDURATION:0\n#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES\n#EXT-X-MEDIA-SEQUENCE:0\n", pl.Encode().String())
+
+	// Without parts
+	assert.Nil(pl.InsertSegment(1, "/stream/mid/P240p/1.ts", 2.002))
+	assert.Equal("#EXTM3U\n#EXT-X-VERSION:6\n#EXT-X-TARGETDURATION:3\n#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES\n#EXT-X-MEDIA-SEQUENCE:1\n"+
+		"#EXTINF:2.002,\n/stream/mid/P240p/1.ts\n", pl.Encode().String())
+
+	// Parts of an incomplete segment are advertised after the complete segments
+	assert.Nil(pl.InsertPart(2, &LLHLSPart{URI: "2.0.ts", Duration: 0.5, Independent: true}))
+	assert.Nil(pl.InsertPart(2, &LLHLSPart{URI: "2.1.ts", Duration: 0.5}))
+	assert.Equal("#EXTM3U\n#EXT-X-VERSION:6\n#EXT-X-TARGETDURATION:3\n"+
+		"#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=1.500\n#EXT-X-PART-INF:PART-TARGET=0.500\n#EXT-X-MEDIA-SEQUENCE:1\n"+
+		"#EXTINF:2.002,\n/stream/mid/P240p/1.ts\n"+
+		"#EXT-X-PART:DURATION=0.500,URI=\"2.0.ts\",INDEPENDENT=YES\n#EXT-X-PART:DURATION=0.500,URI=\"2.1.ts\"\n", pl.Encode().String())
+
+	// Completing the segment keeps its parts
+	assert.Nil(pl.InsertSegment(2, "2.ts", 1.0))
+	assert.Equal("#EXTM3U\n#EXT-X-VERSION:6\n#EXT-X-TARGETDURATION:3\n"+
+		"#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=1.500\n#EXT-X-PART-INF:PART-TARGET=0.500\n#EXT-X-MEDIA-SEQUENCE:1\n"+
+		"#EXTINF:2.002,\n/stream/mid/P240p/1.ts\n"+
+		"#EXT-X-PART:DURATION=0.500,URI=\"2.0.ts\",INDEPENDENT=YES\n#EXT-X-PART:DURATION=0.500,URI=\"2.1.ts\"\n"+
+		"#EXTINF:1.000,\n2.ts\n", pl.Encode().String())
+
+	// Complete segments can't be changed
+	assert.EqualError(pl.InsertSegment(2, "2.ts", 1.0), "ErrLLHLSPlaylist: segment seqNo=2 is already complete")
+	assert.EqualError(pl.InsertPart(2, &LLHLSPart{URI: "2.2.ts", Duration: 0.5}), "ErrLLHLSPlaylist: segment seqNo=2 is already complete")
+
+	// The window slides over complete segments
+	assert.Nil(pl.InsertSegment(3, "3.ts", 1.0))
+	assert.Equal(uint64(4), pl.NextMSN())
+	assert.Contains(pl.Encode().String(), "#EXT-X-MEDIA-SEQUENCE:2\n")
+	assert.NotContains(pl.Encode().String(), "/stream/mid/P240p/1.ts")
+	assert.EqualError(pl.InsertSegment(1, "1.ts", 1.0), "ErrLLHLSPlaylist: segment seqNo=1 is older than the playlist window")
+}
+
+func TestLLHLSPlaylist_PartsWindow(t *testing.T) {
+	assert := assert.New(t)
+
+	pl := NewLLHLSPlaylist(10)
+	for i := uint64(0); i < 6; i++ {
+		assert.Nil(pl.InsertPart(i, &LLHLSPart{URI: "part.ts", Duration: 0.5}))
+		assert.Nil(pl.InsertSegment(i, "seg.ts", 1.0))
+	}
+	// Only the parts of the most recent segments are advertised
+	assert.Nil(pl.InsertPart(6, &LLHLSPart{URI: "part.ts", Duration: 0.5}))
+	assert.Equal(llhlsPartSegments+1, strings.Count(pl.Encode().String(), "#EXT-X-PART:"))
+	assert.Equal(6, strings.Count(pl.Encode().String(), "#EXTINF:"))
+}
+
+func TestLLHLSPlaylist_Wait(t *testing.T) {
+	assert := assert.New(t)
+
+	pl := NewLLHLSPlaylist(6)
+	assert.Nil(pl.InsertSegment(5, "5.ts", 1.0))
+
+	// Segments that are in the playlist or were removed from it don't block
+	ctx := context.Background()
+	assert.Nil(pl.Wait(ctx, 5, -1))
+	assert.Nil(pl.Wait(ctx, 3, -1))
+	assert.Nil(pl.Wait(ctx, 5, 2))
+
+	// Times out waiting for a future segment
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(context.DeadlineExceeded, pl.Wait(tctx, 6, -1))
+
+	// Unblocks when the part appears
+	errs := make(chan error)
+	go func() { errs <- pl.Wait(ctx, 6, 1) }()
+	assert.Nil(pl.InsertPart(6, &LLHLSPart{URI: "6.0.ts", Duration: 0.5}))
+	select {
+	case <-errs:
+		t.Error("Unblocked before the part was inserted")
+	case <-time.After(10 * time.Millisecond):
+	}
+	assert.Nil(pl.InsertPart(6, &LLHLSPart{URI: "6.1.ts", Duration: 0.5}))
+	select {
+	case err := <-errs:
+		assert.Nil(err)
+	case <-time.After(time.Second):
+		t.Error("Did not unblock after the part was inserted")
+	}
+
+	// Unblocks when the segment is complete
+	go func() { errs <- pl.Wait(ctx, 7, -1) }()
+	assert.Nil(pl.InsertPart(7, &LLHLSPart{URI: "7.0.ts", Duration: 0.5}))
+	assert.Nil(pl.InsertSegment(7, "7.ts", 1.0))
+	select {
+	case err := <-errs:
+		assert.Nil(err)
+	case <-time.After(time.Second):
+		t.Error("Did not unblock after the segment was inserted")
+	}
+}
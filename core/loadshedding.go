@@ -0,0 +1,158 @@
+package core
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// ErrOrchDraining is returned for the segments of a stream that was drained to relieve an
+// overload once its grace period is over
+var ErrOrchDraining = errors.New("OrchestratorDraining")
+
+// DefaultLoadSheddingGrace is how long the segments of a drained stream are still transcoded
+// while its broadcaster moves it to another orchestrator
+var DefaultLoadSheddingGrace = 10 * time.Second
+
+// LoadShedder drains the lowest value streams of an overloaded node instead of degrading every
+// stream. Streams that pay the lowest price per pixel are drained first and, among streams of
+// the same price, the streams that paid the lowest fees. The broadcasters of drained streams
+// are asked to move them to other orchestrators
+type LoadShedder struct {
+	grace time.Duration
+
+	mu       sync.Mutex
+	values   map[ManifestID]*streamValue
+	draining map[ManifestID]time.Time
+}
+
+type streamValue struct {
+	// Price per pixel of the latest segment
+	price *big.Rat
+	// Fees paid for all the segments
+	fees *big.Rat
+}
+
+// NewLoadShedder creates a LoadShedder that transcodes the segments of a drained stream for
+// grace before rejecting them
+func NewLoadShedder(grace time.Duration) *LoadShedder {
+	return &LoadShedder{
+		grace:    grace,
+		values:   make(map[ManifestID]*streamValue),
+		draining: make(map[ManifestID]time.Time),
+	}
+}
+
+// RecordFees adds the fees paid for a segment of a stream at a price per pixel
+func (s *LoadShedder) RecordFees(mid ManifestID, price, fees *big.Rat) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.values[mid]
+	if !ok {
+		v = &streamValue{price: new(big.Rat), fees: new(big.Rat)}
+		s.values[mid] = v
+	}
+	v.price.Set(price)
+	v.fees.Add(v.fees, fees)
+}
+
+// Draining returns true if a stream was drained and its broadcaster should move it to another
+// orchestrator
+func (s *LoadShedder) Draining(mid ManifestID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.draining[mid]
+	return ok
+}
+
+// Drained returns true if the grace period of a drained stream is over, so that its segments
+// are rejected
+func (s *LoadShedder) Drained(mid ManifestID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	start, ok := s.draining[mid]
+	return ok && time.Since(start) > s.grace
+}
+
+// Drain starts draining a stream
+func (s *LoadShedder) Drain(mid ManifestID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.draining[mid]; !ok {
+		s.draining[mid] = time.Now()
+	}
+}
+
+// Forget drops the state of a stream that ended
+func (s *LoadShedder) Forget(mid ManifestID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, mid)
+	delete(s.draining, mid)
+}
+
+// LowestValue returns the streams that are not draining, lowest value first
+func (s *LoadShedder) LowestValue(mids []ManifestID) []ManifestID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	zero := &streamValue{price: new(big.Rat), fees: new(big.Rat)}
+	value := func(mid ManifestID) *streamValue {
+		if v, ok := s.values[mid]; ok {
+			return v
+		}
+		return zero
+	}
+
+	var active []ManifestID
+	for _, mid := range mids {
+		if _, ok := s.draining[mid]; !ok {
+			active = append(active, mid)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool {
+		vi, vj := value(active[i]), value(active[j])
+		if c := vi.price.Cmp(vj.price); c != 0 {
+			return c < 0
+		}
+		if c := vi.fees.Cmp(vj.fees); c != 0 {
+			return c < 0
+		}
+		return active[i] < active[j]
+	})
+	return active
+}
+
+// shedLoad drains the lowest value streams until the node is not overloaded anymore. The node
+// is overloaded when it transcodes more streams than MaxSessions, or more pixels per second
+// than its pixel budget
+func (n *LivepeerNode) shedLoad() {
+	if n.LoadShedder == nil {
+		return
+	}
+	n.segmentMutex.RLock()
+	mids := make([]ManifestID, 0, len(n.SegmentChans))
+	for mid := range n.SegmentChans {
+		mids = append(mids, mid)
+	}
+	n.segmentMutex.RUnlock()
+
+	active := n.LoadShedder.LowestValue(mids)
+	excess := len(active) - n.MaxSessions()
+	for _, mid := range active {
+		pixelExcess := n.PixelCapacity != nil && n.PixelCapacity.Measured() && n.PixelCapacity.Load() > n.PixelCapacity.Budget()
+		if excess <= 0 && !pixelExcess {
+			return
+		}
+		glog.Infof("Draining stream to relieve overload manifestID=%s sessions=%d maxSessions=%d", mid, len(active), n.MaxSessions())
+		n.LoadShedder.Drain(mid)
+		// Drained streams leave, so their pixels don't count against the budget anymore
+		if n.PixelCapacity != nil {
+			n.PixelCapacity.Release(mid)
+		}
+		excess--
+	}
+}
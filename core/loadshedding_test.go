@@ -0,0 +1,126 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+	ffmpeg "github.com/livepeer/lpms/ffmpeg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadShedder_LowestValue(t *testing.T) {
+	assert := assert.New(t)
+
+	s := NewLoadShedder(time.Minute)
+	mids := []ManifestID{"premium", "cheap", "cheapLowFees", "unpaid"}
+	s.RecordFees("premium", big.NewRat(3, 1), big.NewRat(1, 1))
+	s.RecordFees("cheap", big.NewRat(1, 1), big.NewRat(5, 1))
+	s.RecordFees("cheapLowFees", big.NewRat(1, 1), big.NewRat(2, 1))
+
+	// Streams of the lowest price are drained first, then the streams that paid the lowest fees
+	assert.Equal([]ManifestID{"unpaid", "cheapLowFees", "cheap", "premium"}, s.LowestValue(mids))
+
+	// Fees add up while the price is the price of the latest segment
+	s.RecordFees("cheapLowFees", big.NewRat(1, 1), big.NewRat(4, 1))
+	s.RecordFees("unpaid", big.NewRat(2, 1), big.NewRat(1, 1))
+	assert.Equal([]ManifestID{"cheap", "cheapLowFees", "unpaid", "premium"}, s.LowestValue(mids))
+
+	// Draining streams are not drained again
+	s.Drain("cheap")
+	assert.True(s.Draining("cheap"))
+	assert.False(s.Draining("premium"))
+	assert.Equal([]ManifestID{"cheapLowFees", "unpaid", "premium"}, s.LowestValue(mids))
+
+	// Ended streams are forgotten
+	s.Forget("cheap")
+	s.Forget("premium")
+	assert.False(s.Draining("cheap"))
+	assert.Equal([]ManifestID{"premium", "cheapLowFees", "unpaid"}, s.LowestValue([]ManifestID{"cheapLowFees", "premium", "unpaid"}))
+}
+
+func TestLoadShedder_Drained(t *testing.T) {
+	assert := assert.New(t)
+
+	s := NewLoadShedder(time.Minute)
+	s.Drain("foo")
+	assert.True(s.Draining("foo"))
+	assert.False(s.Drained("foo"))
+	assert.False(s.Drained("bar"))
+
+	// Segments are rejected once the grace period is over
+	s = NewLoadShedder(0)
+	s.Drain("foo")
+	time.Sleep(time.Millisecond)
+	assert.True(s.Drained("foo"))
+}
+
+func TestShedLoad(t *testing.T) {
+	assert := assert.New(t)
+
+	defer func(max int) { MaxSessions = max }(MaxSessions)
+	MaxSessions = 10
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	n, _ := NewLivepeerNode(nil, "", nil)
+	o := NewOrchestrator(n)
+	n.LoadShedder = NewLoadShedder(time.Minute)
+
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P360p30fps16x9}
+	for i, mid := range []ManifestID{"a", "b", "c"} {
+		_, err := n.getSegmentChan(&SegTranscodingMetadata{ManifestID: mid, Profiles: profiles})
+		require.Nil(t, err)
+		n.LoadShedder.RecordFees(mid, big.NewRat(int64(3-i), 1), big.NewRat(1, 1))
+	}
+
+	// Nothing is drained without overload
+	n.shedLoad()
+	assert.Empty(n.LoadShedder.draining)
+
+	// The lowest value streams are drained until the node is not overloaded
+	MaxSessions = 1
+	n.shedLoad()
+	assert.True(o.Draining("c"))
+	assert.True(o.Draining("b"))
+	assert.False(o.Draining("a"))
+
+	// Drained streams are still transcoded during the grace period
+	assert.Nil(o.CheckCapacity("c", profiles))
+	n.LoadShedder.grace = 0
+	time.Sleep(time.Millisecond)
+	assert.Equal(ErrOrchDraining, o.CheckCapacity("c", profiles))
+	assert.Nil(o.CheckCapacity("a", profiles))
+
+	// Streams are drained when they exceed the pixel budget
+	MaxSessions = 10
+	rate, _ := ProfilesPixelRate(profiles)
+	capacity, err := NewPixelCapacity(rate)
+	require.Nil(t, err)
+	n.PixelCapacity = capacity
+	n.PixelCapacity.Reserve("a", profiles)
+	n.PixelCapacity.Reserve("b", profiles)
+	n.LoadShedder.Forget("b")
+	n.shedLoad()
+	assert.True(o.Draining("b"))
+	assert.False(o.Draining("a"))
+	assert.Equal(rate, n.PixelCapacity.Load())
+}
+
+func TestDebitFees_RecordsStreamValue(t *testing.T) {
+	assert := assert.New(t)
+
+	n, _ := NewLivepeerNode(nil, "", nil)
+	n.Balances = NewBalances(5 * time.Second)
+	n.LoadShedder = NewLoadShedder(time.Minute)
+	o := NewOrchestrator(n)
+
+	o.DebitFees("foo", &net.PriceInfo{PricePerUnit: 2, PixelsPerUnit: 1}, 10)
+	o.DebitFees("bar", &net.PriceInfo{PricePerUnit: 1, PixelsPerUnit: 1}, 100)
+	o.DebitFees("foo", &net.PriceInfo{PricePerUnit: 2, PixelsPerUnit: 1}, 10)
+
+	assert.Equal(big.NewRat(40, 1), n.LoadShedder.values["foo"].fees)
+	assert.Equal(big.NewRat(2, 1), n.LoadShedder.values["foo"].price)
+	assert.Equal([]ManifestID{"bar", "foo"}, n.LoadShedder.LowestValue([]ManifestID{"foo", "bar"}))
+}
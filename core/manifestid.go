@@ -0,0 +1,124 @@
+package core
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ManifestIDNamespaceSeparator separates the namespace of a ManifestID from the ID within the namespace
+const ManifestIDNamespaceSeparator = "_"
+
+// Number of bytes of the hash of an external key that are used in a deterministic ManifestID
+const deterministicManifestIDBytes = 8
+
+// Number of random ManifestIDs that are generated before giving up on finding one that is not in use
+const maxManifestIDAttempts = 10
+
+var ErrManifestIDNamespace = errors.New("ErrManifestIDNamespace")
+var ErrManifestIDCollision = errors.New("ErrManifestIDCollision")
+
+var namespaceRegex = regexp.MustCompile(`^[a-zA-Z0-9-]{1,64}$`)
+
+// ValidateNamespace checks that a namespace only contains alphanumeric characters and dashes
+// so that it cannot be confused with the rest of a ManifestID
+func ValidateNamespace(namespace string) error {
+	if !namespaceRegex.MatchString(namespace) {
+		return fmt.Errorf("%v: invalid namespace %q", ErrManifestIDNamespace, namespace)
+	}
+	return nil
+}
+
+// NamespacedManifestID prefixes id with a namespace. id is returned unchanged if the namespace
+// is empty or if id is already in the namespace
+func NamespacedManifestID(namespace, id string) ManifestID {
+	if namespace == "" || strings.HasPrefix(id, namespace+ManifestIDNamespaceSeparator) {
+		return ManifestID(id)
+	}
+	return ManifestID(namespace + ManifestIDNamespaceSeparator + id)
+}
+
+// DeterministicManifestID derives a ManifestID in a namespace from an external key, such as the
+// stream key of a tenant, so that the same key is always mapped to the same manifest
+func DeterministicManifestID(namespace, key string) ManifestID {
+	hash := crypto.Keccak256([]byte(namespace), []byte{0}, []byte(key))
+	return NamespacedManifestID(namespace, hex.EncodeToString(hash[:deterministicManifestIDBytes]))
+}
+
+// Namespace returns the namespace of a ManifestID or an empty string if it is not namespaced
+func (mid ManifestID) Namespace() string {
+	parts := strings.SplitN(string(mid), ManifestIDNamespaceSeparator, 2)
+	if len(parts) != 2 || parts[1] == "" || ValidateNamespace(parts[0]) != nil {
+		return ""
+	}
+	return parts[0]
+}
+
+// ManifestIDRegistry tracks the ManifestIDs that are in use along with the external keys
+// they were derived from so that collisions can be detected
+type ManifestIDRegistry struct {
+	mu  sync.Mutex
+	ids map[ManifestID]string
+}
+
+// NewManifestIDRegistry creates an empty ManifestIDRegistry
+func NewManifestIDRegistry() *ManifestIDRegistry {
+	return &ManifestIDRegistry{ids: make(map[ManifestID]string)}
+}
+
+// Reserve marks a ManifestID as in use for an external key, which may be empty.
+// An error is returned if the ManifestID is already in use
+func (r *ManifestIDRegistry) Reserve(mid ManifestID, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.ids[mid]; ok {
+		if existing != key {
+			return fmt.Errorf("%v: manifestID=%v is in use by a different key", ErrManifestIDCollision, mid)
+		}
+		return fmt.Errorf("%v: manifestID=%v is already in use", ErrManifestIDCollision, mid)
+	}
+	r.ids[mid] = key
+	return nil
+}
+
+// Release marks a ManifestID as no longer in use
+func (r *ManifestIDRegistry) Release(mid ManifestID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.ids, mid)
+}
+
+// Generate returns a random ManifestID in a namespace that is not in use. The namespace may be empty
+func (r *ManifestIDRegistry) Generate(namespace string) (ManifestID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := 0; i < maxManifestIDAttempts; i++ {
+		mid := NamespacedManifestID(namespace, string(RandomManifestID()))
+		if _, ok := r.ids[mid]; !ok {
+			return mid, nil
+		}
+	}
+	return "", fmt.Errorf("%v: unable to generate an unused manifestID in namespace %q", ErrManifestIDCollision, namespace)
+}
+
+// InNamespace returns the ManifestIDs in use in a namespace
+func (r *ManifestIDRegistry) InNamespace(namespace string) []ManifestID {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var mids []ManifestID
+	for mid := range r.ids {
+		if mid.Namespace() == namespace {
+			mids = append(mids, mid)
+		}
+	}
+	return mids
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateNamespace(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(ValidateNamespace("tenant-1"))
+	assert.Nil(ValidateNamespace(strings.Repeat("a", 64)))
+
+	assert.EqualError(ValidateNamespace(""), `ErrManifestIDNamespace: invalid namespace ""`)
+	assert.NotNil(ValidateNamespace(strings.Repeat("a", 65)))
+	assert.NotNil(ValidateNamespace("a_b"))
+	assert.NotNil(ValidateNamespace("a/b"))
+}
+
+func TestNamespacedManifestID(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(ManifestID("abc"), NamespacedManifestID("", "abc"))
+	assert.Equal(ManifestID("ns_abc"), NamespacedManifestID("ns", "abc"))
+	// IDs that are already in the namespace are not prefixed again
+	assert.Equal(ManifestID("ns_abc"), NamespacedManifestID("ns", "ns_abc"))
+	assert.Equal(ManifestID("ns_other_abc"), NamespacedManifestID("ns", "other_abc"))
+
+	assert.Equal("ns", ManifestID("ns_abc").Namespace())
+	assert.Equal("ns", ManifestID("ns_other_abc").Namespace())
+	assert.Equal("", ManifestID("abc").Namespace())
+	assert.Equal("", ManifestID("ns_").Namespace())
+	assert.Equal("", ManifestID("_abc").Namespace())
+}
+
+func TestDeterministicManifestID(t *testing.T) {
+	assert := assert.New(t)
+
+	mid := DeterministicManifestID("ns", "key")
+	assert.Equal("ns", mid.Namespace())
+	assert.Len(string(mid), len("ns_")+2*deterministicManifestIDBytes)
+
+	// The same key is always mapped to the same ID
+	assert.Equal(mid, DeterministicManifestID("ns", "key"))
+	assert.NotEqual(mid, DeterministicManifestID("ns", "key2"))
+	assert.NotEqual(mid, DeterministicManifestID("ns2", "key"))
+
+	// The separator between the namespace and the key prevents ambiguities
+	assert.NotEqual(DeterministicManifestID("", "ab"), DeterministicManifestID("", "a\x00b"))
+
+	assert.Equal("", DeterministicManifestID("", "key").Namespace())
+}
+
+func TestManifestIDRegistry(t *testing.T) {
+	assert := assert.New(t)
+
+	r := NewManifestIDRegistry()
+	mid := DeterministicManifestID("ns", "key")
+	assert.Nil(r.Reserve(mid, "key"))
+
+	// The same ID can not be reserved twice
+	err := r.Reserve(mid, "key")
+	assert.EqualError(err, "ErrManifestIDCollision: manifestID="+string(mid)+" is already in use")
+	err = r.Reserve(mid, "other")
+	assert.EqualError(err, "ErrManifestIDCollision: manifestID="+string(mid)+" is in use by a different key")
+
+	// Released IDs can be reserved again
+	r.Release(mid)
+	assert.Nil(r.Reserve(mid, "other"))
+
+	assert.Nil(r.Reserve(ManifestID("ns_abc"), ""))
+	assert.Nil(r.Reserve(ManifestID("ns2_abc"), ""))
+	assert.Nil(r.Reserve(ManifestID("abc"), ""))
+	assert.ElementsMatch([]ManifestID{mid, "ns_abc"}, r.InNamespace("ns"))
+	assert.ElementsMatch([]ManifestID{"ns2_abc"}, r.InNamespace("ns2"))
+	assert.ElementsMatch([]ManifestID{"abc"}, r.InNamespace(""))
+	assert.Empty(r.InNamespace("ns3"))
+}
+
+func TestManifestIDRegistry_Generate(t *testing.T) {
+	assert := assert.New(t)
+
+	ids := []string{"abc", "abc", "def"}
+	oldRandFunc := common.RandomIDGenerator
+	common.RandomIDGenerator = func(length uint) string {
+		id := ids[0]
+		if len(ids) > 1 {
+			ids = ids[1:]
+		}
+		return id
+	}
+	defer func() { common.RandomIDGenerator = oldRandFunc }()
+
+	r := NewManifestIDRegistry()
+	mid, err := r.Generate("ns")
+	assert.Nil(err)
+	assert.Equal(ManifestID("ns_abc"), mid)
+	assert.Nil(r.Reserve(mid, ""))
+
+	// IDs that are in use are skipped
+	mid, err = r.Generate("ns")
+	assert.Nil(err)
+	assert.Equal(ManifestID("ns_def"), mid)
+	assert.Nil(r.Reserve(mid, ""))
+
+	// Gives up when every generated ID is in use
+	_, err = r.Generate("ns")
+	assert.EqualError(err, `ErrManifestIDCollision: unable to generate an unused manifestID in namespace "ns"`)
+}
+
+func TestManifestIDString(t *testing.T) {
+	assert := assert.New(t)
+	defer monitor.SetRedaction(monitor.RedactionNone, "")
+
+	mid := ManifestID("ns_abcdef01")
+	assert.Equal("ns_abcdef01", fmt.Sprintf("%v", mid))
+	assert.Nil(monitor.SetRedaction(monitor.RedactionTruncate, ""))
+	assert.Equal("ns_a...ef01", fmt.Sprintf("%v", mid))
+	// Stream IDs are not redacted, as they are used in paths and URLs
+	assert.Equal("ns_abcdef01/P240p30fps16x9", MakeStreamIDFromString(string(mid), "P240p30fps16x9").String())
+}
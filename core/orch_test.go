@@ -14,10 +14,12 @@ import (
 	"github.com/golang/glog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
 	"github.com/livepeer/go-livepeer/pm"
 
 	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/drivers"
 	"github.com/livepeer/lpms/ffmpeg"
@@ -71,7 +73,7 @@ func TestServeTranscoder(t *testing.T) {
 	strm := &StubTranscoderServer{}
 
 	// test that a transcoder was created
-	go n.serveTranscoder(strm, 5)
+	go n.serveTranscoder(strm, 5, "", nil, ethcommon.Address{})
 	time.Sleep(1 * time.Second)
 
 	tc, ok := n.TranscoderManager.liveTranscoders[strm]
@@ -100,15 +102,37 @@ func TestRemoteTranscoder(t *testing.T) {
 
 	// happy path
 	tc, strm := initTranscoder()
-	res, err := tc.Transcode("", nil)
+	res, err := tc.Transcode("", nil, nil)
 	if err != nil || string(res.Segments[0].Data) != "asdf" {
 		t.Error("Error transcoding ", err)
 	}
 
+	// presets are identified by name, custom profiles are sent in full
+	if len(strm.Notified.FullProfiles) != 0 {
+		t.Error("Unexpected full profiles ", strm.Notified.FullProfiles)
+	}
+	tc, strm = initTranscoder()
+	_, err = tc.Transcode("", []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}, nil)
+	if err != nil || len(strm.Notified.FullProfiles) != 0 {
+		t.Error("Unexpected full profiles ", err, strm.Notified.FullProfiles)
+	}
+	adjusted := ffmpeg.P144p30fps16x9
+	adjusted.Bitrate = "300k"
+	tc, strm = initTranscoder()
+	_, err = tc.Transcode("", []ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9, adjusted}, nil)
+	if err != nil || len(strm.Notified.FullProfiles) != 2 {
+		t.Fatal("Missing full profiles ", err, strm.Notified.FullProfiles)
+	}
+	for _, p := range strm.Notified.FullProfiles {
+		if p.Name == adjusted.Name && p.Bitrate != 300000 {
+			t.Error("Unexpected full profile ", p)
+		}
+	}
+
 	// error on remote while transcoding
 	tc, strm = initTranscoder()
 	strm.TranscodeError = fmt.Errorf("TranscodeError")
-	res, err = tc.Transcode("", nil)
+	res, err = tc.Transcode("", nil, nil)
 	if err != strm.TranscodeError {
 		t.Error("Unexpected error ", err, res)
 	}
@@ -117,7 +141,7 @@ func TestRemoteTranscoder(t *testing.T) {
 	tc, strm = initTranscoder()
 
 	strm.SendError = fmt.Errorf("SendError")
-	_, err = tc.Transcode("", nil)
+	_, err = tc.Transcode("", nil, nil)
 	if _, fatal := err.(RemoteTranscoderFatalError); !fatal ||
 		err.Error() != strm.SendError.Error() {
 		t.Error("Unexpected error ", err, fatal)
@@ -128,13 +152,58 @@ func TestRemoteTranscoder(t *testing.T) {
 	strm.WithholdResults = true
 	m.taskCount = 1001
 	RemoteTranscoderTimeout = 1 * time.Millisecond
-	_, err = tc.Transcode("fileName", nil)
+	_, err = tc.Transcode("fileName", nil, nil)
 	if err.Error() != "Remote transcoder took too long" {
 		t.Error("Unexpected error: ", err)
 	}
 	RemoteTranscoderTimeout = 8 * time.Second
 }
 
+func TestRemoteTranscoder_Signature(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	key, err := crypto.GenerateKey()
+	require.Nil(err)
+	id := NewTranscoderIdentity(key)
+	m := NewRemoteTranscoderManager()
+	initTranscoder := func() (*RemoteTranscoder, *StubTranscoderServer) {
+		strm := &StubTranscoderServer{manager: m, Identity: id}
+		tc := NewRemoteTranscoder(m, strm, 5)
+		tc.identity = id.Address()
+		return tc, strm
+	}
+
+	// Results signed by the registered identity are accepted
+	tc, _ := initTranscoder()
+	res, err := tc.Transcode("", nil, nil)
+	require.Nil(err)
+	assert.Equal("asdf", string(res.Segments[0].Data))
+
+	// Results signed by another identity are rejected
+	tc, strm := initTranscoder()
+	key, err = crypto.GenerateKey()
+	require.Nil(err)
+	strm.Identity = NewTranscoderIdentity(key)
+	_, err = tc.Transcode("", nil, nil)
+	_, fatal := err.(RemoteTranscoderFatalError)
+	assert.True(fatal)
+	assert.Contains(err.Error(), ErrTranscoderSig.Error())
+
+	// Unsigned results are rejected
+	tc, strm = initTranscoder()
+	strm.Identity = nil
+	_, err = tc.Transcode("", nil, nil)
+	assert.Contains(err.Error(), ErrTranscoderSig.Error())
+
+	// Errors aren't signed
+	tc, strm = initTranscoder()
+	strm.Identity = nil
+	strm.TranscodeError = fmt.Errorf("TranscodeError")
+	_, err = tc.Transcode("", nil, nil)
+	assert.Equal(strm.TranscodeError, err)
+}
+
 func newWg(delta int) *sync.WaitGroup {
 	var wg sync.WaitGroup
 	wg.Add(delta)
@@ -166,7 +235,7 @@ func TestManageTranscoders(t *testing.T) {
 
 	// test that transcoder is added to liveTranscoders and remoteTranscoders
 	wg1 := newWg(1)
-	go func() { m.Manage(strm, 5); wg1.Done() }()
+	go func() { m.Manage(strm, 5, "", nil, ethcommon.Address{}); wg1.Done() }()
 	time.Sleep(1 * time.Millisecond) // allow the manager to activate
 
 	assert.NotNil(m.liveTranscoders[strm])
@@ -180,7 +249,7 @@ func TestManageTranscoders(t *testing.T) {
 
 	// test that additional transcoder is added to liveTranscoders and remoteTranscoders
 	wg2 := newWg(1)
-	go func() { m.Manage(strm2, 4); wg2.Done() }()
+	go func() { m.Manage(strm2, 4, "", nil, ethcommon.Address{}); wg2.Done() }()
 	time.Sleep(1 * time.Millisecond) // allow the manager to activate
 
 	assert.NotNil(m.liveTranscoders[strm])
@@ -207,6 +276,184 @@ func TestManageTranscoders(t *testing.T) {
 	assert.Equal(0, m.RegisteredTranscodersCount())
 }
 
+func TestManageTranscoders_Version(t *testing.T) {
+	assert := assert.New(t)
+	m := NewRemoteTranscoderManager()
+	strm := &StubTranscoderServer{}
+	strm2 := &StubTranscoderServer{}
+	strm3 := &StubTranscoderServer{}
+
+	// Any version is accepted without a minimum version
+	assert.Nil(m.checkVersion("undefined"))
+
+	m.SetMinVersion(&Version{Major: 0, Minor: 5, Patch: 1})
+	err := m.Manage(strm, 5, "0.5.0-abcdef12", nil, ethcommon.Address{})
+	assert.EqualError(err, "ErrTranscoderVersion: version 0.5.0 is below the minimum version 0.5.1")
+	err = m.Manage(strm, 5, "undefined", nil, ethcommon.Address{})
+	assert.EqualError(err, `ErrTranscoderVersion: unknown version "undefined" is not allowed, the minimum version is 0.5.1`)
+	assert.Equal(0, m.RegisteredTranscodersCount())
+
+	// Version and capabilities are recorded
+	wg1 := newWg(1)
+	go func() {
+		assert.Nil(m.Manage(strm, 5, "0.5.1-abcdef12", []string{CapabilityH264}, ethcommon.Address{}))
+		wg1.Done()
+	}()
+	time.Sleep(1 * time.Millisecond) // allow the manager to activate
+	ti := m.RegisteredTranscodersInfo()
+	assert.Len(ti, 1)
+	assert.Equal("0.5.1-abcdef12", ti[0].Version)
+	assert.Equal([]string{CapabilityH264}, ti[0].Capabilities)
+
+	// Compatible versions do not drift
+	wg2 := newWg(1)
+	go func() { m.Manage(strm2, 5, "0.5.3", nil, ethcommon.Address{}); wg2.Done() }()
+	time.Sleep(1 * time.Millisecond)
+	m.RTmutex.Lock()
+	assert.Empty(m.incompatibleTranscoders(m.liveTranscoders[strm2]))
+	m.RTmutex.Unlock()
+
+	// Incompatible versions drift
+	wg3 := newWg(1)
+	go func() { m.Manage(strm3, 5, "0.6.0", nil, ethcommon.Address{}); wg3.Done() }()
+	time.Sleep(1 * time.Millisecond)
+	m.RTmutex.Lock()
+	incompatible := m.incompatibleTranscoders(m.liveTranscoders[strm3])
+	assert.Len(incompatible, 2)
+	assert.ElementsMatch([]*RemoteTranscoder{m.liveTranscoders[strm], m.liveTranscoders[strm2]}, incompatible)
+	assert.Equal([]*RemoteTranscoder{m.liveTranscoders[strm3]}, m.incompatibleTranscoders(m.liveTranscoders[strm]))
+	m.RTmutex.Unlock()
+
+	for i, s := range []*StubTranscoderServer{strm, strm2, strm3} {
+		m.RTmutex.Lock()
+		tc := m.liveTranscoders[s]
+		m.RTmutex.Unlock()
+		tc.eof <- struct{}{}
+		assert.True(wgWait([]*sync.WaitGroup{wg1, wg2, wg3}[i]))
+	}
+	assert.Equal(0, m.RegisteredTranscodersCount())
+}
+
+func TestTranscoderManager_WorkStealing(t *testing.T) {
+	assert := assert.New(t)
+	m := NewRemoteTranscoderManager()
+	slow := &StubTranscoderServer{manager: m, WithholdResults: true}
+	fast := &StubTranscoderServer{manager: m}
+
+	oldTimeout, oldDeadline := RemoteTranscoderTimeout, RemoteTranscoderSoftDeadline
+	defer func() { RemoteTranscoderTimeout, RemoteTranscoderSoftDeadline = oldTimeout, oldDeadline }()
+	RemoteTranscoderTimeout = 200 * time.Millisecond
+	RemoteTranscoderSoftDeadline = 20 * time.Millisecond
+
+	wgSlow := newWg(1)
+	go func() { m.Manage(slow, 5, "", nil, ethcommon.Address{}); wgSlow.Done() }()
+	time.Sleep(1 * time.Millisecond)
+
+	// Without another transcoder, the segment is not stolen
+	_, err := m.Transcode("", nil, nil)
+	assert.Equal(RemoteTranscoderFatalError{ErrRemoteTranscoderTimeout}, err)
+	assert.True(wgWait(wgSlow))
+
+	slow = &StubTranscoderServer{manager: m, WithholdResults: true}
+	wgSlow.Add(1)
+	go func() { m.Manage(slow, 5, "", nil, ethcommon.Address{}); wgSlow.Done() }()
+	time.Sleep(1 * time.Millisecond)
+
+	// The segment is assigned to the slow transcoder, then stolen by the fast one after the soft deadline
+	type result struct {
+		res *TranscodeData
+		err error
+	}
+	results := make(chan result)
+	start := time.Now()
+	go func() {
+		res, err := m.Transcode("", nil, nil)
+		results <- result{res, err}
+	}()
+	time.Sleep(1 * time.Millisecond)
+	wgFast := newWg(1)
+	go func() { m.Manage(fast, 5, "", nil, ethcommon.Address{}); wgFast.Done() }()
+
+	r := <-results
+	assert.Nil(r.err)
+	assert.Equal("asdf", string(r.res.Segments[0].Data))
+	assert.True(time.Since(start) >= RemoteTranscoderSoftDeadline)
+	assert.True(time.Since(start) < RemoteTranscoderTimeout)
+	m.RTmutex.Lock()
+	assert.Equal(0, m.liveTranscoders[fast].load)
+	m.RTmutex.Unlock()
+
+	// The slow transcoder is removed once it times out
+	assert.True(wgWait(wgSlow))
+	assert.Equal(1, m.RegisteredTranscodersCount())
+
+	// Segments that finish before the soft deadline are not stolen
+	res, err := m.Transcode("", nil, nil)
+	assert.Nil(err)
+	assert.Equal("asdf", string(res.Segments[0].Data))
+
+	m.RTmutex.Lock()
+	m.liveTranscoders[fast].eof <- struct{}{}
+	m.RTmutex.Unlock()
+	assert.True(wgWait(wgFast))
+}
+
+func TestTranscoderManager_GracePeriod(t *testing.T) {
+	assert := assert.New(t)
+	m := NewRemoteTranscoderManager()
+
+	oldGracePeriod := RemoteTranscoderGracePeriod
+	defer func() { RemoteTranscoderGracePeriod = oldGracePeriod }()
+	RemoteTranscoderGracePeriod = 50 * time.Millisecond
+
+	// Fails after the grace period without transcoders
+	start := time.Now()
+	_, err := m.Transcode("", nil, nil)
+	assert.EqualError(err, "No transcoders available")
+	assert.True(time.Since(start) >= RemoteTranscoderGracePeriod)
+
+	// Waits for a transcoder to register
+	type result struct {
+		res *TranscodeData
+		err error
+	}
+	results := make(chan result)
+	transcode := func() {
+		res, err := m.Transcode("", nil, nil)
+		results <- result{res, err}
+	}
+	go transcode()
+	time.Sleep(10 * time.Millisecond)
+	strm := &StubTranscoderServer{manager: m}
+	wg := newWg(1)
+	go func() { m.Manage(strm, 1, "", nil, ethcommon.Address{}); wg.Done() }()
+	r := <-results
+	assert.Nil(r.err)
+	assert.Equal("asdf", string(r.res.Segments[0].Data))
+
+	// Waits for a transcoder to have capacity
+	tc := m.selectTranscoder(nil)
+	assert.NotNil(tc)
+	go transcode()
+	time.Sleep(10 * time.Millisecond)
+	m.completeTranscoders(tc)
+	r = <-results
+	assert.Nil(r.err)
+
+	// Segments fail right away without a grace period
+	RemoteTranscoderGracePeriod = 0
+	m.selectTranscoder(nil)
+	start = time.Now()
+	_, err = m.Transcode("", nil, nil)
+	assert.EqualError(err, "No transcoders available")
+	assert.True(time.Since(start) < 10*time.Millisecond)
+
+	m.RTmutex.Lock()
+	m.liveTranscoders[strm].eof <- struct{}{}
+	m.RTmutex.Unlock()
+	assert.True(wgWait(wg))
+}
+
 func TestSelectTranscoder(t *testing.T) {
 	m := NewRemoteTranscoderManager()
 	strm := &StubTranscoderServer{manager: m, WithholdResults: false}
@@ -219,9 +466,9 @@ func TestSelectTranscoder(t *testing.T) {
 
 	// register transcoders, which adds transcoder to liveTranscoders and remoteTranscoders
 	wg := newWg(1)
-	go func() { m.Manage(strm, 2) }()
+	go func() { m.Manage(strm, 2, "", nil, ethcommon.Address{}) }()
 	time.Sleep(1 * time.Millisecond) // allow time for first stream to register
-	go func() { m.Manage(strm2, 1); wg.Done() }()
+	go func() { m.Manage(strm2, 1, "", nil, ethcommon.Address{}); wg.Done() }()
 	time.Sleep(1 * time.Millisecond) // allow time for second stream to register
 
 	assert.NotNil(m.liveTranscoders[strm])
@@ -231,23 +478,23 @@ func TestSelectTranscoder(t *testing.T) {
 	// assert transcoder is returned from selectTranscoder
 	t1 := m.liveTranscoders[strm]
 	t2 := m.liveTranscoders[strm2]
-	currentTranscoder := m.selectTranscoder()
+	currentTranscoder := m.selectTranscoder(nil)
 	assert.Equal(t2, currentTranscoder)
 	assert.Equal(1, t2.load)
 	assert.NotNil(m.liveTranscoders[strm])
 	assert.Len(m.remoteTranscoders, 2)
 
 	// assert transcoder with less load selected
-	currentTranscoder2 := m.selectTranscoder()
+	currentTranscoder2 := m.selectTranscoder(nil)
 	assert.Equal(t1, currentTranscoder2)
 	assert.Equal(1, t1.load)
 
-	currentTranscoder3 := m.selectTranscoder()
+	currentTranscoder3 := m.selectTranscoder(nil)
 	assert.Equal(t1, currentTranscoder3)
 	assert.Equal(2, t1.load)
 
 	// assert no transcoder returned if all at they capacity
-	noTrans := m.selectTranscoder()
+	noTrans := m.selectTranscoder(nil)
 	assert.Nil(noTrans)
 
 	m.completeTranscoders(t1)
@@ -261,14 +508,14 @@ func TestSelectTranscoder(t *testing.T) {
 	assert.NotNil(m.liveTranscoders[strm])
 
 	// assert t1 is selected and t2 drained
-	currentTranscoder = m.selectTranscoder()
+	currentTranscoder = m.selectTranscoder(nil)
 	assert.Equal(t1, currentTranscoder)
 	assert.Equal(1, t1.load)
 	assert.NotNil(m.liveTranscoders[strm])
 	assert.Len(m.remoteTranscoders, 2)
 
 	// assert transcoder gets added back to remoteTranscoders if no transcoding error
-	_, err := m.Transcode("", nil)
+	_, err := m.Transcode("", nil, nil)
 	assert.Nil(err)
 	assert.Len(m.remoteTranscoders, 2)
 	assert.Equal(1, t1.load)
@@ -276,6 +523,31 @@ func TestSelectTranscoder(t *testing.T) {
 	assert.Equal(0, t1.load)
 }
 
+func TestSelectTranscoder_Capabilities(t *testing.T) {
+	assert := assert.New(t)
+	m := NewRemoteTranscoderManager()
+	strm := &StubTranscoderServer{manager: m}
+	strm2 := &StubTranscoderServer{manager: m}
+
+	go func() { m.Manage(strm, 1, "", []string{CapabilityH264}, ethcommon.Address{}) }()
+	time.Sleep(1 * time.Millisecond)
+	go func() { m.Manage(strm2, 2, "", []string{CapabilityH264, CapabilityVP9}, ethcommon.Address{}) }()
+	time.Sleep(1 * time.Millisecond)
+
+	// The pool advertises the capabilities of any of its transcoders
+	assert.Equal([]string{CapabilityH264, CapabilityVP9}, m.Capabilities())
+
+	// Only the transcoder with the capability is selected, although the other one is less loaded
+	t2 := m.liveTranscoders[strm2]
+	assert.Equal(t2, m.selectTranscoder([]string{CapabilityVP9}))
+	assert.Equal(t2, m.selectTranscoder([]string{CapabilityVP9}))
+	assert.Nil(m.selectTranscoder([]string{CapabilityVP9}))
+	assert.Nil(m.selectTranscoder([]string{CapabilityH265}))
+
+	// Segments without requirements still use the other transcoder
+	assert.Equal(m.liveTranscoders[strm], m.selectTranscoder(nil))
+}
+
 func TestTranscoderManagerTranscoding(t *testing.T) {
 	m := NewRemoteTranscoderManager()
 	s := &StubTranscoderServer{manager: m}
@@ -286,12 +558,12 @@ func TestTranscoderManagerTranscoding(t *testing.T) {
 	assert.Empty(m.remoteTranscoders)
 
 	// Attempt to transcode when no transcoders in the set
-	_, err := m.Transcode("", nil)
+	_, err := m.Transcode("", nil, nil)
 	assert.NotNil(err)
 	assert.Equal(err.Error(), "No transcoders available")
 
 	wg := newWg(1)
-	go func() { m.Manage(s, 5); wg.Done() }()
+	go func() { m.Manage(s, 5, "", nil, ethcommon.Address{}); wg.Done() }()
 	time.Sleep(1 * time.Millisecond)
 
 	assert.Len(m.remoteTranscoders, 1) // sanity
@@ -299,14 +571,14 @@ func TestTranscoderManagerTranscoding(t *testing.T) {
 	assert.NotNil(m.liveTranscoders[s])
 
 	// happy path
-	res, err := m.Transcode("", nil)
+	res, err := m.Transcode("", nil, nil)
 	assert.Nil(err)
 	assert.Len(res.Segments, 1)
 	assert.Equal(string(res.Segments[0].Data), "asdf")
 
 	// non-fatal error should not remove from list
 	s.TranscodeError = fmt.Errorf("TranscodeError")
-	_, err = m.Transcode("", nil)
+	_, err = m.Transcode("", nil, nil)
 	assert.Equal(s.TranscodeError, err)
 	assert.Len(m.remoteTranscoders, 1)           // sanity
 	assert.Equal(0, m.remoteTranscoders[0].load) // sanity
@@ -316,11 +588,11 @@ func TestTranscoderManagerTranscoding(t *testing.T) {
 
 	// fatal error should retry and remove from list
 	s.SendError = fmt.Errorf("SendError")
-	_, err = m.Transcode("", nil)
+	_, err = m.Transcode("", nil, nil)
 	assert.True(wgWait(wg)) // should disconnect manager
 	assert.NotNil(err)
 	assert.Equal(err.Error(), "No transcoders available")
-	_, err = m.Transcode("", nil) // need second try to remove from remoteTranscoders
+	_, err = m.Transcode("", nil, nil) // need second try to remove from remoteTranscoders
 	assert.NotNil(err)
 	assert.Equal(err.Error(), "No transcoders available")
 	assert.Len(m.liveTranscoders, 0)
@@ -329,14 +601,14 @@ func TestTranscoderManagerTranscoding(t *testing.T) {
 
 	// fatal error should not retry
 	wg.Add(1)
-	go func() { m.Manage(s, 5); wg.Done() }()
+	go func() { m.Manage(s, 5, "", nil, ethcommon.Address{}); wg.Done() }()
 	time.Sleep(1 * time.Millisecond)
 
 	assert.Len(m.remoteTranscoders, 1) // sanity check
 	assert.Len(m.liveTranscoders, 1)
 	s.WithholdResults = true
 	RemoteTranscoderTimeout = 1 * time.Millisecond
-	_, err = m.Transcode("", nil)
+	_, err = m.Transcode("", nil, nil)
 	_, fatal := err.(RemoteTranscoderFatalError)
 	wg.Wait()
 	assert.True(fatal)
@@ -420,11 +692,16 @@ type StubTranscoderServer struct {
 	SendError       error
 	TranscodeError  error
 	WithholdResults bool
+	// The last segment that the transcoder was notified of
+	Notified *net.NotifySegment
+	// Signs the results if set
+	Identity *TranscoderIdentity
 
 	common.StubServerStream
 }
 
 func (s *StubTranscoderServer) Send(n *net.NotifySegment) error {
+	s.Notified = n
 	res := RemoteTranscoderResult{
 		TranscodeData: &TranscodeData{
 			Segments: []*TranscodedSegmentData{
@@ -433,6 +710,9 @@ func (s *StubTranscoderServer) Send(n *net.NotifySegment) error {
 		},
 		Err: s.TranscodeError,
 	}
+	if s.Identity != nil {
+		res.Sig, _ = s.Identity.Sign(TranscodeResultsHash(n.TaskId, res.TranscodeData))
+	}
 	if !s.WithholdResults {
 		s.manager.transcoderResults(n.TaskId, &res)
 	}
@@ -512,18 +792,18 @@ func TestOrchCheckCapacity(t *testing.T) {
 	assert := assert.New(t)
 
 	// happy case
-	assert.Nil(o.CheckCapacity(md.ManifestID))
+	assert.Nil(o.CheckCapacity(md.ManifestID, nil))
 
 	// capped case
 	MaxSessions = 0
-	assert.Equal(ErrOrchCap, o.CheckCapacity(md.ManifestID))
+	assert.Equal(ErrOrchCap, o.CheckCapacity(md.ManifestID, nil))
 
 	// ensure existing segment chans pass while cap is active
 	MaxSessions = cap
 	_, err := n.getSegmentChan(md) // store md into segment chans
 	assert.Nil(err)
 	MaxSessions = 0
-	assert.Nil(o.CheckCapacity(md.ManifestID))
+	assert.Nil(o.CheckCapacity(md.ManifestID, nil))
 }
 
 func TestProcessPayment_GivenRecipientError_ReturnsNil(t *testing.T) {
@@ -807,10 +1087,140 @@ func TestProcessPayment_GivenReceiveTicketError_ReturnsError(t *testing.T) {
 	assert.EqualError(err, "error receiving tickets with payment")
 	acceptableErr, ok := err.(AcceptableError)
 	assert.True(ok)
-	assert.False(acceptableErr.Acceptable())
+	// The payment is acceptable because one of the tickets was credited
+	assert.True(acceptableErr.Acceptable())
 	recipient.AssertNumberOfCalls(t, "RedeemWinningTicket", 2)
 }
 
+func TestProcessPayment_PartiallyAcceptedPayment_ReturnsPaymentResult(t *testing.T) {
+	n, _ := NewLivepeerNode(nil, "", nil)
+	n.Balances = NewBalances(5 * time.Second)
+	recipient := new(pm.MockRecipient)
+	n.Recipient = recipient
+	orch := NewOrchestrator(n)
+	orch.node.SetBasePrice(big.NewRat(0, 1))
+	orch.node.ErrorMonitor = NewErrorMonitor(0, make(chan struct{}))
+	manifestID := ManifestID("some manifest")
+	unacceptableError := pm.NewMockReceiveError(errors.New("Unacceptable ReceiveTicket error"), false)
+
+	recipient.On("TxCostMultiplier", mock.Anything).Return(big.NewRat(1, 1), nil)
+	recipient.On("ReceiveTicket", mock.Anything, mock.Anything, mock.Anything).Return("", false, nil).Once()
+	recipient.On("ReceiveTicket", mock.Anything, mock.Anything, mock.Anything).Return("", false, unacceptableError).Once()
+	recipient.On("ReceiveTicket", mock.Anything, mock.Anything, mock.Anything).Return("", false, nil).Once()
+	recipient.On("ReceiveTicket", mock.Anything, mock.Anything, mock.Anything).Return("", false, unacceptableError).Once()
+
+	var senderParams []*net.TicketSenderParams
+	for i := 0; i < 4; i++ {
+		senderParams = append(
+			senderParams,
+			&net.TicketSenderParams{SenderNonce: uint32(i), Sig: pm.RandBytes(123)},
+		)
+	}
+
+	// faceValue = 100
+	// winProb = 50%
+	maxWinProb := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+	ticket := &pm.Ticket{
+		FaceValue: big.NewInt(100),
+		WinProb:   maxWinProb.Div(maxWinProb, big.NewInt(2)),
+	}
+	payment := defaultPaymentWithTickets(t, senderParams)
+	payment.TicketParams.FaceValue = ticket.FaceValue.Bytes()
+	payment.TicketParams.WinProb = ticket.WinProb.Bytes()
+
+	err := orch.ProcessPayment(*payment, manifestID)
+
+	assert := assert.New(t)
+	require := require.New(t)
+	paymentErr, ok := err.(*PaymentError)
+	require.True(ok)
+	assert.True(paymentErr.Acceptable())
+	assert.EqualError(paymentErr, "error receiving tickets with payment")
+
+	expEV := new(big.Rat).Mul(ticket.EV(), big.NewRat(2, 1))
+	result := paymentErr.Result
+	assert.Equal([]uint32{0, 2}, result.AcceptedNonces)
+	assert.Equal([]uint32{1, 3}, result.RejectedNonces)
+	assert.Equal(expEV.RatString(), result.Credit)
+	assert.Equal(expEV.RatString(), result.Shortfall)
+
+	// Only the accepted tickets are credited
+	assert.Zero(orch.node.Balances.Balance(manifestID).Cmp(expEV))
+}
+
+func TestProcessPayment_ExceedsTicketBatchLimit_RejectsExcessTickets(t *testing.T) {
+	n, _ := NewLivepeerNode(nil, "", nil)
+	n.Balances = NewBalances(5 * time.Second)
+	recipient := new(pm.MockRecipient)
+	n.Recipient = recipient
+	orch := NewOrchestrator(n)
+	orch.node.SetBasePrice(big.NewRat(0, 1))
+	orch.node.SetTicketBatchLimits(0, big.NewInt(250))
+	manifestID := ManifestID("some manifest")
+
+	recipient.On("TxCostMultiplier", mock.Anything).Return(big.NewRat(1, 1), nil)
+	recipient.On("ReceiveTicket", mock.Anything, mock.Anything, mock.Anything).Return("", false, nil)
+
+	var senderParams []*net.TicketSenderParams
+	for i := 0; i < 4; i++ {
+		senderParams = append(
+			senderParams,
+			&net.TicketSenderParams{SenderNonce: uint32(i), Sig: pm.RandBytes(123)},
+		)
+	}
+
+	// faceValue = 100
+	// winProb = 50%
+	maxWinProb := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+	ticket := &pm.Ticket{
+		FaceValue: big.NewInt(100),
+		WinProb:   maxWinProb.Div(maxWinProb, big.NewInt(2)),
+	}
+	payment := defaultPaymentWithTickets(t, senderParams)
+	payment.TicketParams.FaceValue = ticket.FaceValue.Bytes()
+	payment.TicketParams.WinProb = ticket.WinProb.Bytes()
+
+	err := orch.ProcessPayment(*payment, manifestID)
+
+	assert := assert.New(t)
+	require := require.New(t)
+	paymentErr, ok := err.(*PaymentError)
+	require.True(ok)
+	assert.True(paymentErr.Acceptable())
+	assert.EqualError(paymentErr, "payment exceeds max batch size of 2 tickets")
+
+	// Only the tickets within the limit are received and credited
+	recipient.AssertNumberOfCalls(t, "ReceiveTicket", 2)
+	expEV := new(big.Rat).Mul(ticket.EV(), big.NewRat(2, 1))
+	result := paymentErr.Result
+	assert.Equal([]uint32{0, 1}, result.AcceptedNonces)
+	assert.Equal([]uint32{2, 3}, result.RejectedNonces)
+	assert.Equal(expEV.RatString(), result.Shortfall)
+	assert.Zero(orch.node.Balances.Balance(manifestID).Cmp(expEV))
+
+	// A payment within the limit is accepted
+	orch.node.SetTicketBatchLimits(4, nil)
+	assert.Nil(orch.ProcessPayment(*payment, manifestID))
+}
+
+func TestMaxTicketsPerBatch(t *testing.T) {
+	assert := assert.New(t)
+
+	// No limits
+	assert.Equal(0, MaxTicketsPerBatch(0, nil, big.NewInt(100)))
+	// Only max tickets
+	assert.Equal(3, MaxTicketsPerBatch(3, nil, big.NewInt(100)))
+	// Only max face value
+	assert.Equal(2, MaxTicketsPerBatch(0, big.NewInt(299), big.NewInt(100)))
+	// The lower of the two limits applies
+	assert.Equal(2, MaxTicketsPerBatch(3, big.NewInt(200), big.NewInt(100)))
+	assert.Equal(3, MaxTicketsPerBatch(3, big.NewInt(1000), big.NewInt(100)))
+	// A batch always fits at least one ticket
+	assert.Equal(1, MaxTicketsPerBatch(0, big.NewInt(50), big.NewInt(100)))
+	// Unknown face value
+	assert.Equal(3, MaxTicketsPerBatch(3, big.NewInt(50), nil))
+}
+
 // Check that an Acceptable error increases the credit
 func TestProcessPayment_AcceptablePaymentError_IncreasesCreditBalance(t *testing.T) {
 	n, _ := NewLivepeerNode(nil, "", nil)
@@ -1393,6 +1803,30 @@ func TestDebitFees_OffChain_Returns(t *testing.T) {
 	assert.NotPanics(t, func() { orch.DebitFees(manifestID, price, pixels) })
 }
 
+func TestReclaimedCredit(t *testing.T) {
+	assert := assert.New(t)
+	manifestID := ManifestID("some manifest")
+
+	n, _ := NewLivepeerNode(nil, "", nil)
+
+	// Node != nil Balances == nil
+	orch := NewOrchestrator(n)
+	assert.Nil(orch.ReclaimedCredit(manifestID))
+
+	n.Balances = NewBalances(5 * time.Second)
+	n.Balances.SetCreditExpiry(0, ReclaimCredit)
+	n.Balances.Credit(manifestID, big.NewRat(5, 1))
+	assert.Nil(orch.ReclaimedCredit(manifestID))
+
+	n.Balances.reclaimExpired()
+	assert.Zero(big.NewRat(5, 1).Cmp(orch.ReclaimedCredit(manifestID)))
+	assert.Nil(orch.ReclaimedCredit(manifestID))
+
+	// Node == nil
+	orch.node = nil
+	assert.Nil(orch.ReclaimedCredit(manifestID))
+}
+
 func defaultPayment(t *testing.T) net.Payment {
 	ticketSenderParams := &net.TicketSenderParams{
 		SenderNonce: 456,
@@ -5,11 +5,13 @@ import (
 	ogErrors "errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"math/big"
 	"net/url"
 	"os"
 	"path"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,7 +19,9 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/golang/glog"
 	"github.com/pkg/errors"
+	"go.opencensus.io/trace"
 
+	"github.com/livepeer/go-livepeer/clog"
 	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/drivers"
 	"github.com/livepeer/go-livepeer/monitor"
@@ -31,6 +35,8 @@ import (
 
 var transcodeLoopTimeout = 1 * time.Minute
 
+var logger = clog.New("core")
+
 // Transcoder / orchestrator RPC interface implementation
 type orchestrator struct {
 	address ethcommon.Address
@@ -71,30 +77,57 @@ func (orch *orchestrator) TranscoderSecret() string {
 	return orch.node.OrchSecret
 }
 
-func (orch *orchestrator) CheckCapacity(mid ManifestID) error {
+// CheckCapacity returns ErrOrchCap if the node can't admit a stream transcoded into profiles
+func (orch *orchestrator) CheckCapacity(mid ManifestID, profiles []ffmpeg.VideoProfile) error {
+	if orch.node.LoadShedder != nil && orch.node.LoadShedder.Drained(mid) {
+		return ErrOrchDraining
+	}
 	orch.node.segmentMutex.RLock()
 	defer orch.node.segmentMutex.RUnlock()
 	if _, ok := orch.node.SegmentChans[mid]; ok {
 		return nil
 	}
-	if len(orch.node.SegmentChans) >= MaxSessions {
-		return ErrOrchCap
-	}
-	return nil
+	return orch.node.admitStream(mid, profiles)
+}
+
+// Capabilities returns the capabilities of the node's transcoder, e.g. the output codecs it supports
+func (orch *orchestrator) Capabilities() []string {
+	return TranscoderCapabilities(orch.node.Transcoder)
+}
+
+// Draining returns true if a stream was drained to relieve an overload, so that its broadcaster
+// should move it to another orchestrator
+func (orch *orchestrator) Draining(mid ManifestID) bool {
+	return orch.node.LoadShedder != nil && orch.node.LoadShedder.Draining(mid)
 }
 
 func (orch *orchestrator) TranscodeSeg(md *SegTranscodingMetadata, seg *stream.HLSSegment) (*TranscodeResult, error) {
 	return orch.node.sendToTranscodeLoop(md, seg)
 }
 
-func (orch *orchestrator) ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int) {
-	orch.node.serveTranscoder(stream, capacity)
+// TranscodeOneShot transcodes a segment that doesn't belong to a stream. No transcode loop or session
+// is started for it, but the job holds a session slot of the node while it is transcoded
+func (orch *orchestrator) TranscodeOneShot(md *SegTranscodingMetadata, seg *stream.HLSSegment) (*TranscodeResult, error) {
+	return orch.node.transcodeOneShot(md, seg)
+}
+
+func (orch *orchestrator) ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int, version string, capabilities []string, identity ethcommon.Address) error {
+	return orch.node.serveTranscoder(stream, capacity, version, capabilities, identity)
 }
 
 func (orch *orchestrator) TranscoderResults(tcID int64, res *RemoteTranscoderResult) {
 	orch.node.TranscoderManager.transcoderResults(tcID, res)
 }
 
+// PaymentError is a payment related error returned when some of the tickets in a payment
+// are rejected. The result describes which tickets were credited so that the sender can
+// replace the rejected tickets
+type PaymentError struct {
+	AcceptableError
+
+	Result *net.PaymentResult
+}
+
 func (orch *orchestrator) ProcessPayment(payment net.Payment, manifestID ManifestID) error {
 	if orch.node == nil || orch.node.Recipient == nil {
 		return nil
@@ -109,6 +142,7 @@ func (orch *orchestrator) ProcessPayment(payment net.Payment, manifestID Manifes
 	}
 
 	sender := ethcommon.BytesToAddress(payment.Sender)
+	log := logger.With(clog.ManifestID, manifestID, clog.Sender, sender.Hex())
 
 	var (
 		didPriceErr            bool
@@ -143,15 +177,21 @@ func (orch *orchestrator) ProcessPayment(payment net.Payment, manifestID Manifes
 	}
 
 	ticketExpirationParams := &pm.TicketExpirationParams{
-		CreationRound:          payment.ExpirationParams.CreationRound,
-		CreationRoundBlockHash: ethcommon.BytesToHash(payment.ExpirationParams.CreationRoundBlockHash),
+		CreationRound:          payment.GetExpirationParams().GetCreationRound(),
+		CreationRoundBlockHash: ethcommon.BytesToHash(payment.GetExpirationParams().GetCreationRoundBlockHash()),
 	}
 
 	totalEV := big.NewRat(0, 1)
 	totalTickets := 0
 	totalWinningTickets := 0
+	shortfall := big.NewRat(0, 1)
+	result := &net.PaymentResult{}
 
-	for _, tsp := range payment.TicketSenderParams {
+	limitTickets, limitFaceValue := orch.TicketBatchLimits()
+	maxTickets := MaxTicketsPerBatch(limitTickets, limitFaceValue, ticketParams.FaceValue)
+	exceededBatchLimit := false
+
+	for i, tsp := range payment.TicketSenderParams {
 
 		ticket := pm.NewTicket(
 			ticketParams,
@@ -160,7 +200,15 @@ func (orch *orchestrator) ProcessPayment(payment net.Payment, manifestID Manifes
 			tsp.SenderNonce,
 		)
 
-		glog.V(common.DEBUG).Infof("Receiving ticket manifestID=%v faceValue=%v winProb=%v ev=%v", manifestID, ticket.FaceValue, ticket.WinProbRat().FloatString(10), ticket.EV().FloatString(2))
+		// Only reject the tickets beyond the batch limit so that the rest of the payment is still credited
+		if maxTickets > 0 && i >= maxTickets {
+			exceededBatchLimit = true
+			shortfall.Add(shortfall, ticket.EV())
+			result.RejectedNonces = append(result.RejectedNonces, tsp.SenderNonce)
+			continue
+		}
+
+		log.V(common.DEBUG).Infof("Receiving ticket faceValue=%v winProb=%v ev=%v", ticket.FaceValue, ticket.WinProbRat().FloatString(10), ticket.EV().FloatString(2))
 
 		_, won, err := orch.node.Recipient.ReceiveTicket(
 			ticket,
@@ -169,7 +217,7 @@ func (orch *orchestrator) ProcessPayment(payment net.Payment, manifestID Manifes
 		)
 		pmErr, ok := err.(AcceptableError)
 		if err != nil {
-			glog.Errorf("Error receiving ticket manifestID=%v recipientRandHash=%x senderNonce=%v: %v", manifestID, ticket.RecipientRandHash, ticket.SenderNonce, err)
+			log.Errorf("Error receiving ticket recipientRandHash=%x senderNonce=%v: %v", ticket.RecipientRandHash, ticket.SenderNonce, err)
 
 			if monitor.Enabled {
 				monitor.PaymentRecvError(sender.String(), string(manifestID), err.Error(), ok && pmErr.Acceptable())
@@ -184,23 +232,31 @@ func (orch *orchestrator) ProcessPayment(payment net.Payment, manifestID Manifes
 			orch.node.Balances.Credit(manifestID, ev)
 			totalEV.Add(totalEV, ev)
 			totalTickets++
+			result.AcceptedNonces = append(result.AcceptedNonces, tsp.SenderNonce)
 		} else {
 			unacceptableReceiveErr = true
+			shortfall.Add(shortfall, ticket.EV())
+			result.RejectedNonces = append(result.RejectedNonces, tsp.SenderNonce)
 		}
 
 		if won {
-			glog.V(common.DEBUG).Infof("Received winning ticket manifestID=%v recipientRandHash=%x senderNonce=%v", manifestID, ticket.RecipientRandHash, ticket.SenderNonce)
+			log.V(common.DEBUG).Infof("Received winning ticket recipientRandHash=%x senderNonce=%v", ticket.RecipientRandHash, ticket.SenderNonce)
 
 			totalWinningTickets++
 
 			go func(ticket *pm.Ticket, sig []byte, seed *big.Int) {
 				if err := orch.node.Recipient.RedeemWinningTicket(ticket, sig, seed); err != nil {
-					glog.Errorf("error redeeming ticket manifestID=%v recipientRandHash=%x senderNonce=%v: %v", manifestID, ticket.RecipientRandHash, ticket.SenderNonce, err)
+					log.Errorf("error redeeming ticket recipientRandHash=%x senderNonce=%v: %v", ticket.RecipientRandHash, ticket.SenderNonce, err)
 				}
 			}(ticket, tsp.Sig, seed)
 		}
 	}
 
+	if totalTickets > 0 {
+		// Associate the sender with the balance so that any debt carried forward is charged against it
+		orch.node.Balances.SetSender(manifestID, sender)
+	}
+
 	if monitor.Enabled {
 		senderStr := sender.String()
 		mid := string(manifestID)
@@ -210,21 +266,75 @@ func (orch *orchestrator) ProcessPayment(payment net.Payment, manifestID Manifes
 		monitor.WinningTicketsRecv(senderStr, totalWinningTickets)
 	}
 
+	var paymentErr AcceptableError
 	if didPriceErr {
-		return newAcceptableError(
+		paymentErr = newAcceptableError(
 			fmt.Errorf("expected price did not match orchestrator price"),
 			acceptablePrice,
 		)
-	}
-
-	if didReceiveErr {
-		return newAcceptableError(
+	} else if didReceiveErr {
+		// The payment is still acceptable if some of its tickets were credited
+		paymentErr = newAcceptableError(
 			fmt.Errorf("error receiving tickets with payment"),
-			!unacceptableReceiveErr,
+			!unacceptableReceiveErr || totalTickets > 0,
+		)
+	} else if exceededBatchLimit {
+		log.Errorf("Payment exceeds ticket batch limit tickets=%v maxTickets=%v", len(payment.TicketSenderParams), maxTickets)
+
+		paymentErr = newAcceptableError(
+			fmt.Errorf("payment exceeds max batch size of %v tickets", maxTickets),
+			totalTickets > 0,
 		)
 	}
 
-	return nil
+	if paymentErr == nil {
+		return nil
+	}
+
+	if len(result.RejectedNonces) > 0 {
+		log.Errorf("Rejected tickets with payment accepted=%v rejected=%v shortfall=%v", len(result.AcceptedNonces), len(result.RejectedNonces), shortfall.FloatString(2))
+
+		result.Credit = totalEV.RatString()
+		result.Shortfall = shortfall.RatString()
+
+		return &PaymentError{
+			AcceptableError: paymentErr,
+			Result:          result,
+		}
+	}
+
+	return paymentErr
+}
+
+// TicketBatchLimits returns the maximum number of tickets and the maximum total face value
+// accepted with a single payment
+func (orch *orchestrator) TicketBatchLimits() (int, *big.Int) {
+	if orch.node == nil {
+		return 0, nil
+	}
+	return orch.node.GetTicketBatchLimits()
+}
+
+// MaxTicketsPerBatch returns the number of tickets with the given face value that fit within
+// the batch limits. A batch always fits at least one ticket. 0 means there is no limit
+func MaxTicketsPerBatch(maxTickets int, maxFaceValue *big.Int, faceValue *big.Int) int {
+	if maxFaceValue == nil || maxFaceValue.Sign() <= 0 || faceValue == nil || faceValue.Sign() <= 0 {
+		return maxTickets
+	}
+
+	byFaceValue := new(big.Int).Div(maxFaceValue, faceValue)
+	if !byFaceValue.IsInt64() || byFaceValue.Int64() > math.MaxInt32 {
+		return maxTickets
+	}
+
+	n := int(byFaceValue.Int64())
+	if n < 1 {
+		n = 1
+	}
+	if maxTickets > 0 && maxTickets < n {
+		return maxTickets
+	}
+	return n
 }
 
 func (orch *orchestrator) TicketParams(sender ethcommon.Address) (*net.TicketParams, error) {
@@ -288,7 +398,47 @@ func (orch *orchestrator) DebitFees(manifestID ManifestID, price *net.PriceInfo,
 		return
 	}
 	priceRat := big.NewRat(price.GetPricePerUnit(), price.GetPixelsPerUnit())
-	orch.node.Balances.Debit(manifestID, priceRat.Mul(priceRat, big.NewRat(pixels, 1)))
+	fees := new(big.Rat).Mul(priceRat, big.NewRat(pixels, 1))
+	orch.node.Balances.Debit(manifestID, fees)
+	if orch.node.LoadShedder != nil {
+		orch.node.LoadShedder.RecordFees(manifestID, priceRat, fees)
+	}
+}
+
+// AudioPixelsPerSecond is the pixel count that a second of an audio-only rendition is charged as,
+// so that audio is priced by duration at the price per pixel. It is the pixel rate of the 144p30 preset
+var AudioPixelsPerSecond int64 = 256 * 144 * 30
+
+// audioPixels returns the pixel count that an audio-only rendition is charged as for its duration
+func audioPixels(data []byte) (int64, error) {
+	duration, err := common.TSAudioDuration(data)
+	if err != nil {
+		return 0, err
+	}
+	return int64(math.Round(duration * float64(AudioPixelsPerSecond))), nil
+}
+
+// ReclaimedCredit returns the unused credit for a ManifestID that was reclaimed after it expired
+// and that the sender has not been notified of yet. Returns nil if no credit was reclaimed
+func (orch *orchestrator) ReclaimedCredit(manifestID ManifestID) *big.Rat {
+	if orch.node == nil || orch.node.Balances == nil {
+		return nil
+	}
+	return orch.node.Balances.TakeReclaimed(manifestID)
+}
+
+// MaxUnpaidStreams is the number of streams of a sender that can owe the fees of their first segment,
+// transcoded before they were paid for
+var MaxUnpaidStreams = 2
+
+// AcceptFirstSegment checks whether the first segment of a stream can be transcoded before it is paid
+// for, the fees being paid with the next segment. The balance of the stream is opened on success so
+// that the next segments are not accepted without a payment
+func (orch *orchestrator) AcceptFirstSegment(sender ethcommon.Address, manifestID ManifestID) error {
+	if orch.node == nil || orch.node.Recipient == nil || orch.node.Balances == nil {
+		return nil
+	}
+	return orch.node.Balances.OpenUnpaid(manifestID, sender, MaxUnpaidStreams)
 }
 
 // Acceptable price checks whether the payment sender's expected price sent with a payment is acceptable
@@ -358,6 +508,8 @@ type SegChanData struct {
 type RemoteTranscoderResult struct {
 	TranscodeData *TranscodeData
 	Err           error
+	// Signature of the transcoder over TranscodeResultsHash
+	Sig []byte
 }
 
 type SegmentChan chan *SegChanData
@@ -404,19 +556,54 @@ func (rtm *RemoteTranscoderManager) removeTaskChan(taskID int64) {
 func (n *LivepeerNode) getSegmentChan(md *SegTranscodingMetadata) (SegmentChan, error) {
 	// concurrency concerns here? what if a chan is added mid-call?
 	n.segmentMutex.Lock()
-	defer n.segmentMutex.Unlock()
 	if sc, ok := n.SegmentChans[md.ManifestID]; ok {
+		n.segmentMutex.Unlock()
 		return sc, nil
 	}
-	if len(n.SegmentChans) >= MaxSessions {
-		return nil, ErrOrchCap
+	if err := n.admitStream(md.ManifestID, md.Profiles); err != nil {
+		n.segmentMutex.Unlock()
+		return nil, err
+	}
+	sc, err := n.startSegmentChan(md)
+	n.segmentMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// The start hooks run synchronously, so they are invoked without holding segmentMutex
+	n.Sessions.Start(md.ManifestID, SessionSourceBroadcaster, md.Profiles)
+	return sc, nil
+}
+
+// admitStream returns ErrOrchCap if a new stream transcoded into profiles exceeds the number of
+// sessions of the node, or the remaining pixel budget once it is known. One-shot jobs hold a session
+// while they are transcoded. Must be called with segmentMutex held
+func (n *LivepeerNode) admitStream(mid ManifestID, profiles []ffmpeg.VideoProfile) error {
+	var err error
+	if len(n.SegmentChans)+n.oneShotJobs >= n.MaxSessions() {
+		err = ErrOrchCap
+	} else if n.PixelCapacity != nil && n.PixelCapacity.Measured() {
+		err = n.PixelCapacity.Admits(mid, profiles)
+	}
+	if err == ErrOrchCap && lpmon.Enabled {
+		lpmon.SessionRejected()
 	}
+	return err
+}
+
+// startSegmentChan starts the transcode loop of a stream. Must be called with segmentMutex held.
+// The caller starts the session of the stream once segmentMutex is released
+func (n *LivepeerNode) startSegmentChan(md *SegTranscodingMetadata) (SegmentChan, error) {
 	sc := make(SegmentChan, 1)
 	glog.V(common.DEBUG).Info("Creating new segment chan for manifest ", md.ManifestID)
 	if err := n.transcodeSegmentLoop(md, sc); err != nil {
 		return nil, err
 	}
 	n.SegmentChans[md.ManifestID] = sc
+	n.trackStream(md.ManifestID)
+	if n.PixelCapacity != nil {
+		n.PixelCapacity.Reserve(md.ManifestID, md.Profiles)
+	}
 	if lpmon.Enabled {
 		lpmon.CurrentSessions(len(n.SegmentChans))
 	}
@@ -424,7 +611,7 @@ func (n *LivepeerNode) getSegmentChan(md *SegTranscodingMetadata) (SegmentChan,
 }
 
 func (n *LivepeerNode) sendToTranscodeLoop(md *SegTranscodingMetadata, seg *stream.HLSSegment) (*TranscodeResult, error) {
-	glog.V(common.DEBUG).Infof("Starting to transcode segment manifest=%s seqNo=%d", string(md.ManifestID), md.Seq)
+	glog.V(common.DEBUG).Infof("Starting to transcode segment manifest=%s seqNo=%d", md.ManifestID, md.Seq)
 	ch, err := n.getSegmentChan(md)
 	if err != nil {
 		glog.Error("Could not find segment chan ", err)
@@ -443,6 +630,33 @@ func (n *LivepeerNode) sendToTranscodeLoop(md *SegTranscodingMetadata, seg *stre
 	return res, res.Err
 }
 
+func (n *LivepeerNode) transcodeOneShot(md *SegTranscodingMetadata, seg *stream.HLSSegment) (*TranscodeResult, error) {
+	if drivers.NodeStorage == nil {
+		return nil, fmt.Errorf("Missing local storage")
+	}
+
+	n.segmentMutex.Lock()
+	if err := n.admitStream(md.ManifestID, md.Profiles); err != nil {
+		n.segmentMutex.Unlock()
+		return nil, err
+	}
+	n.oneShotJobs++
+	n.segmentMutex.Unlock()
+	defer func() {
+		n.segmentMutex.Lock()
+		n.oneShotJobs--
+		n.segmentMutex.Unlock()
+	}()
+
+	// Remote transcoders fetch the segment from the local storage, which is only kept for the job
+	los := drivers.NodeStorage.NewSession(string(md.ManifestID))
+	defer los.EndSession()
+
+	glog.V(common.DEBUG).Infof("Starting to transcode one-shot job manifestID=%s", md.ManifestID)
+	res := n.transcodeSeg(transcodeConfig{OS: los, LocalOS: los}, seg, md)
+	return res, res.Err
+}
+
 func (n *LivepeerNode) transcodeSeg(config transcodeConfig, seg *stream.HLSSegment, md *SegTranscodingMetadata) *TranscodeResult {
 	var fnamep *string
 	terr := func(err error) *TranscodeResult {
@@ -484,41 +698,57 @@ func (n *LivepeerNode) transcodeSeg(config transcodeConfig, seg *stream.HLSSegme
 	// Small optimization: serve from disk for local transcoding
 	if isLocal {
 		url = fname
-	} else if drivers.IsOwnExternal(seg.Name) {
+	} else if drivers.IsOwnExternal(seg.Name) && !RemoteTranscoderEncryption {
 		// We're using a remote TC and segment is already in our own OS
 		// Incurs an additional download for topologies with T on local network!
 		url = seg.Name
 	} else {
-		// Need to store segment in our local OS
+		// Need to store segment in our local OS. Encrypted segments are always served
+		// from the local OS since the remote TC fetches them from us
 		var err error
 		name := fmt.Sprintf("%d.ts", seg.SeqNo)
 		url, err = config.LocalOS.SaveData(name, seg.Data)
 		if err != nil {
 			return terr(err)
 		}
-		seg.Name = url
+		if !drivers.IsOwnExternal(seg.Name) {
+			seg.Name = url
+		}
 	}
 
 	//Do the transcoding
 	start := time.Now()
-	tData, err := transcoder.Transcode(url, md.Profiles)
+	_, span := monitor.StartSpan(md.TraceContext, "transcode")
+	span.AddAttributes(trace.BoolAttribute("remote", !isLocal))
+	tData, err := transcoder.Transcode(url, md.Profiles, md.Encoders)
+	monitor.EndSpan(span, err)
 	if err != nil {
-		glog.Errorf("Error transcoding manifest=%s segNo=%d segName=%s - %v", string(md.ManifestID), seg.SeqNo, seg.Name, err)
+		glog.Errorf("Error transcoding manifest=%s segNo=%d segName=%s - %v", md.ManifestID, seg.SeqNo, seg.Name, err)
 		return terr(err)
 	}
 
 	tSegments := tData.Segments
 	if len(tSegments) != len(md.Profiles) {
 		glog.Errorf("Did not receive the correct number of transcoded segments; got %v expected %v manifest=%s seqNo=%d", len(tSegments),
-			len(md.Profiles), string(md.ManifestID), seg.SeqNo)
+			len(md.Profiles), md.ManifestID, seg.SeqNo)
 		return terr(fmt.Errorf("MismatchedSegments"))
 	}
 
 	took := time.Since(start)
-	glog.V(common.DEBUG).Infof("Transcoding of segment manifestID=%s seqNo=%d took=%v", string(md.ManifestID), seg.SeqNo, took)
+	glog.V(common.DEBUG).Infof("Transcoding of segment manifestID=%s seqNo=%d took=%v", md.ManifestID, seg.SeqNo, took)
 	if isLocal && monitor.Enabled {
 		monitor.SegmentTranscoded(0, seg.SeqNo, took, common.ProfilesNames(md.Profiles))
 	}
+	if n.CapacityTuner != nil {
+		n.segmentMutex.RLock()
+		sessions := len(n.SegmentChans)
+		n.segmentMutex.RUnlock()
+		n.CapacityTuner.Record(sessions, seg.Duration, took)
+	}
+	if n.PixelCapacity != nil {
+		n.PixelCapacity.Record(seg.Duration, took)
+	}
+	n.shedLoad()
 
 	// Prepare the result object
 	var tr TranscodeResult
@@ -527,11 +757,20 @@ func (n *LivepeerNode) transcodeSeg(config transcodeConfig, seg *stream.HLSSegme
 	for i := range md.Profiles {
 		if tSegments[i].Data == nil || len(tSegments[i].Data) < 25 {
 			glog.Errorf("Cannot find transcoded segment for manifest=%s seqNo=%d dataLength=%d",
-				string(md.ManifestID), seg.SeqNo, len(tSegments[i].Data))
+				md.ManifestID, seg.SeqNo, len(tSegments[i].Data))
 			return terr(fmt.Errorf("ZeroSegments"))
 		}
 		glog.V(common.DEBUG).Infof("Transcoded segment manifest=%s seqNo=%d profile=%s len=%d",
-			string(md.ManifestID), seg.SeqNo, md.Profiles[i].Name, len(tSegments[i].Data))
+			md.ManifestID, seg.SeqNo, md.Profiles[i].Name, len(tSegments[i].Data))
+		// Audio-only renditions have no pixels and are charged for their duration instead
+		if common.AudioOnlyProfile(md.Profiles[i]) {
+			pixels, err := audioPixels(tSegments[i].Data)
+			if err != nil {
+				glog.Errorf("Cannot measure audio-only rendition manifest=%s seqNo=%d profile=%s: %v", md.ManifestID, seg.SeqNo, md.Profiles[i].Name, err)
+				return terr(err)
+			}
+			tSegments[i].Pixels = pixels
+		}
 		hash := crypto.Keccak256(tSegments[i].Data)
 		segHashes[i] = hash
 	}
@@ -583,16 +822,29 @@ func (n *LivepeerNode) transcodeSegmentLoop(md *SegTranscodingMetadata, segChan
 				los.EndSession()
 				glog.V(common.DEBUG).Info("Segment loop timed out; closing ", md.ManifestID)
 				n.segmentMutex.Lock()
-				if _, ok := n.SegmentChans[md.ManifestID]; ok {
+				_, ok := n.SegmentChans[md.ManifestID]
+				if ok {
 					close(n.SegmentChans[md.ManifestID])
 					delete(n.SegmentChans, md.ManifestID)
+					n.untrackStream(md.ManifestID)
+					if n.PixelCapacity != nil {
+						n.PixelCapacity.Release(md.ManifestID)
+					}
+					if n.LoadShedder != nil {
+						n.LoadShedder.Forget(md.ManifestID)
+					}
 					if lpmon.Enabled {
 						lpmon.CurrentSessions(len(n.SegmentChans))
 					}
 				}
 				n.segmentMutex.Unlock()
+				if ok {
+					n.Sessions.Stop(md.ManifestID)
+				}
 				return
 			case chanData := <-segChan:
+				n.Sessions.Touch(md.ManifestID)
+				n.recordSeq(md.ManifestID, chanData.md.Seq)
 				chanData.res <- n.transcodeSeg(config, chanData.seg, chanData.md)
 			}
 			cancel()
@@ -601,10 +853,13 @@ func (n *LivepeerNode) transcodeSegmentLoop(md *SegTranscodingMetadata, segChan
 	return nil
 }
 
-func (n *LivepeerNode) serveTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int) {
+func (n *LivepeerNode) serveTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int, version string, capabilities []string, identity ethcommon.Address) error {
 	from := common.GetConnectionAddr(stream.Context())
-	n.TranscoderManager.Manage(stream, capacity)
+	if err := n.TranscoderManager.Manage(stream, capacity, version, capabilities, identity); err != nil {
+		return err
+	}
 	glog.V(common.DEBUG).Infof("Closing transcoder=%s channel", from)
+	return nil
 }
 
 func (rtm *RemoteTranscoderManager) transcoderResults(tcID int64, res *RemoteTranscoderResult) {
@@ -616,12 +871,16 @@ func (rtm *RemoteTranscoderManager) transcoderResults(tcID int64, res *RemoteTra
 }
 
 type RemoteTranscoder struct {
-	manager  *RemoteTranscoderManager
-	stream   net.Transcoder_RegisterTranscoderServer
-	eof      chan struct{}
-	addr     string
-	capacity int
-	load     int
+	manager      *RemoteTranscoderManager
+	stream       net.Transcoder_RegisterTranscoderServer
+	eof          chan struct{}
+	addr         string
+	capacity     int
+	load         int
+	version      string
+	capabilities []string
+	// Address that the results of the transcoder are signed with. Results are not verified if empty
+	identity ethcommon.Address
 }
 
 // RemoteTranscoderFatalError wraps error to indicate that error is fatal
@@ -636,7 +895,20 @@ func NewRemoteTranscoderFatalError(err error) error {
 }
 
 var RemoteTranscoderTimeout = 8 * time.Second
+
+// RemoteTranscoderSoftDeadline is how long a segment can take on a remote transcoder before it is
+// also assigned to another remote transcoder, using the results that arrive first. Disabled if 0
+var RemoteTranscoderSoftDeadline time.Duration
+
+// RemoteTranscoderGracePeriod is how long a segment waits for a remote transcoder to become available,
+// e.g. while transcoders reconnect, before it fails. Segments fail right away if 0
+var RemoteTranscoderGracePeriod time.Duration
+
+// RemoteTranscoderEncryption is true if the segments exchanged between an orchestrator and its remote
+// transcoders are encrypted with keys derived from the shared secret. Both ends must agree on it
+var RemoteTranscoderEncryption bool
 var ErrRemoteTranscoderTimeout = errors.New("Remote transcoder took too long")
+var ErrTranscoderSig = errors.New("ErrTranscoderSig")
 
 func (rt *RemoteTranscoder) done() {
 	// select so we don't block indefinitely if there's no listener
@@ -647,10 +919,14 @@ func (rt *RemoteTranscoder) done() {
 }
 
 // Transcode do actual transcoding by sending work to remote transcoder and waiting for the result
-func (rt *RemoteTranscoder) Transcode(fname string, profiles []ffmpeg.VideoProfile) (*TranscodeData, error) {
+func (rt *RemoteTranscoder) Transcode(fname string, profiles []ffmpeg.VideoProfile, encoders common.ProfileEncoders) (*TranscodeData, error) {
 	taskID, taskChan := rt.manager.addTaskChan()
 	defer rt.manager.removeTaskChan(taskID)
-	signalEOF := func(err error) (*TranscodeData, error) {
+	start := time.Now()
+	signalEOF := func(errCode monitor.SegmentTranscodeError, err error) (*TranscodeData, error) {
+		if monitor.Enabled {
+			monitor.TranscoderSegment(rt.addr, time.Since(start), errCode)
+		}
 		rt.done()
 		glog.Errorf("Fatal error with remote transcoder=%s taskId=%d fname=%s err=%v", rt.addr, taskID, fname, err)
 		return nil, RemoteTranscoderFatalError{err}
@@ -660,18 +936,43 @@ func (rt *RemoteTranscoder) Transcode(fname string, profiles []ffmpeg.VideoProfi
 		TaskId:   taskID,
 		Profiles: common.ProfilesToTranscodeOpts(profiles),
 	}
+	// Custom profiles, including presets with adjusted bitrates or encoder options, cannot be
+	// identified by name so send their full definitions
+	if common.NeedsFullProfiles(profiles, encoders) {
+		fullProfiles, err := common.FFmpegProfilesToNetProfiles(profiles, encoders)
+		if err != nil {
+			glog.Errorf("Unable to serialize profiles for remote transcoder=%s taskId=%d err=%v", rt.addr, taskID, err)
+			return nil, err
+		}
+		msg.FullProfiles = fullProfiles
+	}
 	err := rt.stream.Send(msg)
 	if err != nil {
-		return signalEOF(err)
+		return signalEOF(monitor.SegmentTranscodeErrorSend, err)
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), RemoteTranscoderTimeout)
 	defer cancel()
 	select {
 	case <-ctx.Done():
-		return signalEOF(ErrRemoteTranscoderTimeout)
+		return signalEOF(monitor.SegmentTranscodeErrorTimeout, ErrRemoteTranscoderTimeout)
 	case chanData := <-taskChan:
+		// Results are not forwarded unless they are signed by the registered identity of the transcoder
+		if chanData.Err == nil && (rt.identity != ethcommon.Address{}) {
+			if !pm.VerifySig(rt.identity, TranscodeResultsHash(taskID, chanData.TranscodeData), chanData.Sig) {
+				return signalEOF(monitor.SegmentTranscodeErrorSignature,
+					fmt.Errorf("%v: invalid signature of results from identity=%v", ErrTranscoderSig, rt.identity.Hex()))
+			}
+			glog.V(common.DEBUG).Infof("Verified results from remote transcoder=%s identity=%s taskId=%d", rt.addr, rt.identity.Hex(), taskID)
+		}
 		glog.Infof("Successfully received results from remote transcoder=%s segments=%d taskId=%d fname=%s err=%v",
 			rt.addr, len(chanData.TranscodeData.Segments), taskID, fname, chanData.Err)
+		if monitor.Enabled {
+			var errCode monitor.SegmentTranscodeError
+			if chanData.Err != nil {
+				errCode = monitor.SegmentTranscodeErrorTranscode
+			}
+			monitor.TranscoderSegment(rt.addr, time.Since(start), errCode)
+		}
 		return chanData.TranscodeData, chanData.Err
 	}
 }
@@ -690,6 +991,7 @@ func NewRemoteTranscoderManager() *RemoteTranscoderManager {
 		remoteTranscoders: []*RemoteTranscoder{},
 		liveTranscoders:   map[net.Transcoder_RegisterTranscoderServer]*RemoteTranscoder{},
 		RTmutex:           &sync.Mutex{},
+		available:         make(chan struct{}),
 
 		taskMutex: &sync.RWMutex{},
 		taskChans: make(map[int64]TranscoderChan),
@@ -713,12 +1015,66 @@ type RemoteTranscoderManager struct {
 	liveTranscoders   map[net.Transcoder_RegisterTranscoderServer]*RemoteTranscoder
 	RTmutex           *sync.Mutex
 
+	// Lowest version of transcoders that are allowed to register. Any version is allowed if nil.
+	// Protected by RTmutex
+	minVersion *Version
+	// Closed and replaced when a transcoder registers or completes a segment. Protected by RTmutex
+	available chan struct{}
+
 	// For tracking tasks assigned to remote transcoders
 	taskMutex *sync.RWMutex
 	taskChans map[int64]TranscoderChan
 	taskCount int64
 }
 
+// SetMinVersion sets the lowest version of transcoders that are allowed to register
+func (rtm *RemoteTranscoderManager) SetMinVersion(v *Version) {
+	rtm.RTmutex.Lock()
+	defer rtm.RTmutex.Unlock()
+	rtm.minVersion = v
+}
+
+func (rtm *RemoteTranscoderManager) checkVersion(version string) error {
+	rtm.RTmutex.Lock()
+	min := rtm.minVersion
+	rtm.RTmutex.Unlock()
+	if min == nil {
+		return nil
+	}
+
+	v, err := ParseVersion(version)
+	if err != nil {
+		return fmt.Errorf("%v: unknown version %q is not allowed, the minimum version is %v", ErrTranscoderVersion, version, min)
+	}
+	if v.Less(*min) {
+		return fmt.Errorf("%v: version %v is below the minimum version %v", ErrTranscoderVersion, v, min)
+	}
+	return nil
+}
+
+// Returns the live transcoders with a version that is incompatible with the version of t.
+// Transcoders without a valid version are not compared. Caller of this function should hold RTmutex lock
+func (rtm *RemoteTranscoderManager) incompatibleTranscoders(t *RemoteTranscoder) []*RemoteTranscoder {
+	v, err := ParseVersion(t.version)
+	if err != nil {
+		return nil
+	}
+	var res []*RemoteTranscoder
+	for _, other := range rtm.liveTranscoders {
+		if other == t {
+			continue
+		}
+		ov, err := ParseVersion(other.version)
+		if err != nil {
+			continue
+		}
+		if !v.Compatible(ov) {
+			res = append(res, other)
+		}
+	}
+	return res
+}
+
 // RegisteredTranscodersCount returns number of registered transcoders
 func (rtm *RemoteTranscoderManager) RegisteredTranscodersCount() int {
 	rtm.RTmutex.Lock()
@@ -731,16 +1087,36 @@ func (rtm *RemoteTranscoderManager) RegisteredTranscodersInfo() []net.RemoteTran
 	rtm.RTmutex.Lock()
 	res := make([]net.RemoteTranscoderInfo, 0, len(rtm.liveTranscoders))
 	for _, transcoder := range rtm.liveTranscoders {
-		res = append(res, net.RemoteTranscoderInfo{Address: transcoder.addr, Capacity: transcoder.capacity})
+		var identity string
+		if (transcoder.identity != ethcommon.Address{}) {
+			identity = transcoder.identity.Hex()
+		}
+		res = append(res, net.RemoteTranscoderInfo{
+			Address:      transcoder.addr,
+			Identity:     identity,
+			Capacity:     transcoder.capacity,
+			Version:      transcoder.version,
+			Capabilities: transcoder.capabilities,
+		})
 	}
 	rtm.RTmutex.Unlock()
 	return res
 }
 
-// Manage adds transcoder to list of live transcoders. Doesn't return untill transcoder disconnects
-func (rtm *RemoteTranscoderManager) Manage(stream net.Transcoder_RegisterTranscoderServer, capacity int) {
+// Manage adds transcoder to list of live transcoders. Doesn't return untill transcoder disconnects.
+// Returns an error right away if the version of the transcoder is below the minimum version.
+// The results of the transcoder must be signed by identity unless it is empty
+func (rtm *RemoteTranscoderManager) Manage(stream net.Transcoder_RegisterTranscoderServer, capacity int, version string, capabilities []string, identity ethcommon.Address) error {
 	from := common.GetConnectionAddr(stream.Context())
+	if err := rtm.checkVersion(version); err != nil {
+		glog.Errorf("Rejecting transcoder=%s err=%v", from, err)
+		return err
+	}
+	glog.Infof("Registering transcoder=%s version=%s capabilities=%v identity=%s", from, version, capabilities, identity.Hex())
 	transcoder := NewRemoteTranscoder(rtm, stream, capacity)
+	transcoder.version = version
+	transcoder.capabilities = capabilities
+	transcoder.identity = identity
 	go func() {
 		ctx := stream.Context()
 		<-ctx.Done()
@@ -753,13 +1129,26 @@ func (rtm *RemoteTranscoderManager) Manage(stream net.Transcoder_RegisterTransco
 	rtm.liveTranscoders[transcoder.stream] = transcoder
 	rtm.remoteTranscoders = append(rtm.remoteTranscoders, transcoder)
 	sort.Sort(byLoadFactor(rtm.remoteTranscoders))
+	rtm.notifyAvailable()
+	incompatible := rtm.incompatibleTranscoders(transcoder)
 	var totalLoad, totalCapacity, liveTranscodersNum int
 	if monitor.Enabled {
 		totalLoad, totalCapacity, liveTranscodersNum = rtm.totalLoadAndCapacity()
 	}
 	rtm.RTmutex.Unlock()
+	if len(incompatible) > 0 {
+		others := make([]string, 0, len(incompatible))
+		for _, t := range incompatible {
+			others = append(others, fmt.Sprintf("%s(%s)", t.addr, t.version))
+		}
+		glog.Warningf("Transcoder version drift: transcoder=%s version=%s is incompatible with transcoders=%v", from, version, strings.Join(others, ","))
+	}
 	if monitor.Enabled {
 		monitor.SetTranscodersNumberAndLoad(totalLoad, totalCapacity, liveTranscodersNum)
+		monitor.TranscoderRegistered(from)
+		if len(incompatible) > 0 {
+			monitor.TranscoderVersionDrift(from)
+		}
 	}
 
 	<-transcoder.eof
@@ -773,27 +1162,57 @@ func (rtm *RemoteTranscoderManager) Manage(stream net.Transcoder_RegisterTransco
 	rtm.RTmutex.Unlock()
 	if monitor.Enabled {
 		monitor.SetTranscodersNumberAndLoad(totalLoad, totalCapacity, liveTranscodersNum)
+		monitor.TranscoderDisconnected(from)
 	}
+	return nil
 }
 
-func (rtm *RemoteTranscoderManager) selectTranscoder() *RemoteTranscoder {
+// Capabilities returns the capabilities that any of the live transcoders has
+func (rtm *RemoteTranscoderManager) Capabilities() []string {
 	rtm.RTmutex.Lock()
 	defer rtm.RTmutex.Unlock()
-
-	checkTranscoders := func(rtm *RemoteTranscoderManager) bool {
-		return len(rtm.remoteTranscoders) > 0
+	var caps []string
+	for _, t := range rtm.liveTranscoders {
+		for _, c := range t.capabilities {
+			if !HasCapabilities(caps, []string{c}) {
+				caps = append(caps, c)
+			}
+		}
 	}
+	sort.Strings(caps)
+	return caps
+}
+
+// selectTranscoder selects the least loaded transcoder that has the required capabilities
+func (rtm *RemoteTranscoderManager) selectTranscoder(required []string) *RemoteTranscoder {
+	return rtm.selectTranscoderExcept(nil, required)
+}
+
+// selectTranscoderExcept selects the least loaded transcoder other than exclude that has the required capabilities
+func (rtm *RemoteTranscoderManager) selectTranscoderExcept(exclude *RemoteTranscoder, required []string) *RemoteTranscoder {
+	rtm.RTmutex.Lock()
+	defer rtm.RTmutex.Unlock()
 
-	for checkTranscoders(rtm) {
+	for len(rtm.remoteTranscoders) > 0 {
 		last := len(rtm.remoteTranscoders) - 1
-		currentTranscoder := rtm.remoteTranscoders[last]
-		if _, ok := rtm.liveTranscoders[currentTranscoder.stream]; !ok {
-			// transcoder does not exist in table; remove and retry
-			rtm.remoteTranscoders = rtm.remoteTranscoders[:last]
+		if _, ok := rtm.liveTranscoders[rtm.remoteTranscoders[last].stream]; ok {
+			break
+		}
+		// transcoder does not exist in table; remove and retry
+		rtm.remoteTranscoders = rtm.remoteTranscoders[:last]
+	}
+
+	// The queue is sorted by load factor so the last eligible transcoder is the least loaded one
+	for i := len(rtm.remoteTranscoders) - 1; i >= 0; i-- {
+		currentTranscoder := rtm.remoteTranscoders[i]
+		if _, ok := rtm.liveTranscoders[currentTranscoder.stream]; !ok || currentTranscoder == exclude {
+			continue
+		}
+		if !HasCapabilities(currentTranscoder.capabilities, required) {
 			continue
 		}
 		if currentTranscoder.load == currentTranscoder.capacity {
-			// Head of queue is at capacity, so the rest must be too. Exit early
+			// The least loaded eligible transcoder is at capacity, so the rest must be too. Exit early
 			return nil
 		}
 		currentTranscoder.load++
@@ -814,6 +1233,38 @@ func (rtm *RemoteTranscoderManager) completeTranscoders(trans *RemoteTranscoder)
 	}
 	t.load--
 	sort.Sort(byLoadFactor(rtm.remoteTranscoders))
+	rtm.notifyAvailable()
+}
+
+// Caller of this function should hold RTmutex lock
+func (rtm *RemoteTranscoderManager) notifyAvailable() {
+	close(rtm.available)
+	rtm.available = make(chan struct{})
+}
+
+// waitForTranscoder selects a transcoder with the required capabilities, waiting up to
+// RemoteTranscoderGracePeriod for one to register or to complete a segment if none is available
+func (rtm *RemoteTranscoderManager) waitForTranscoder(required []string) *RemoteTranscoder {
+	if t := rtm.selectTranscoder(required); t != nil || RemoteTranscoderGracePeriod <= 0 {
+		return t
+	}
+
+	glog.V(common.DEBUG).Infof("No transcoders available, waiting up to %v", RemoteTranscoderGracePeriod)
+	timer := time.NewTimer(RemoteTranscoderGracePeriod)
+	defer timer.Stop()
+	for {
+		rtm.RTmutex.Lock()
+		available := rtm.available
+		rtm.RTmutex.Unlock()
+		if t := rtm.selectTranscoder(required); t != nil {
+			return t
+		}
+		select {
+		case <-available:
+		case <-timer.C:
+			return nil
+		}
+	}
 }
 
 // Caller of this function should hold RTmutex lock
@@ -826,13 +1277,75 @@ func (rtm *RemoteTranscoderManager) totalLoadAndCapacity() (int, int, int) {
 	return load, capacity, len(rtm.liveTranscoders)
 }
 
+type remoteTranscodeResult struct {
+	transcoder *RemoteTranscoder
+	res        *TranscodeData
+	err        error
+}
+
 // Transcode does actual transcoding using remote transcoder from the pool
-func (rtm *RemoteTranscoderManager) Transcode(fname string, profiles []ffmpeg.VideoProfile) (*TranscodeData, error) {
-	currentTranscoder := rtm.selectTranscoder()
+func (rtm *RemoteTranscoderManager) Transcode(fname string, profiles []ffmpeg.VideoProfile, encoders common.ProfileEncoders) (*TranscodeData, error) {
+	required := RequiredCapabilities(encoders)
+	currentTranscoder := rtm.waitForTranscoder(required)
 	if currentTranscoder == nil {
 		return nil, errors.New("No transcoders available")
 	}
-	res, err := currentTranscoder.Transcode(fname, profiles)
+
+	results := make(chan remoteTranscodeResult, 2)
+	transcode := func(t *RemoteTranscoder) {
+		res, err := t.Transcode(fname, profiles, encoders)
+		results <- remoteTranscodeResult{transcoder: t, res: res, err: err}
+	}
+	go transcode(currentTranscoder)
+	pending := 1
+
+	var softDeadline <-chan time.Time
+	if RemoteTranscoderSoftDeadline > 0 {
+		timer := time.NewTimer(RemoteTranscoderSoftDeadline)
+		defer timer.Stop()
+		softDeadline = timer.C
+	}
+
+	var result remoteTranscodeResult
+	for {
+		select {
+		case <-softDeadline:
+			softDeadline = nil
+			// Speculatively assign the segment to a second transcoder
+			stealer := rtm.selectTranscoderExcept(currentTranscoder, required)
+			if stealer == nil {
+				continue
+			}
+			glog.Infof("Segment exceeded soft deadline on transcoder=%s, also assigning to transcoder=%s fname=%s", currentTranscoder.addr, stealer.addr, fname)
+			if monitor.Enabled {
+				monitor.TranscoderSegmentStolen(currentTranscoder.addr)
+			}
+			go transcode(stealer)
+			pending++
+			continue
+		case result = <-results:
+			pending--
+		}
+		// Wait for the other transcoder if this one failed
+		if _, fatal := result.err.(RemoteTranscoderFatalError); fatal && pending > 0 {
+			continue
+		}
+		break
+	}
+	if pending > 0 {
+		// Release the transcoder that lost the race once it is done
+		go func() {
+			loser := <-results
+			if _, fatal := loser.err.(RemoteTranscoderFatalError); !fatal {
+				rtm.completeTranscoders(loser.transcoder)
+			}
+		}()
+	}
+	if result.transcoder != currentTranscoder && monitor.Enabled {
+		monitor.TranscoderStealWon(result.transcoder.addr)
+	}
+
+	res, err := result.res, result.err
 	_, fatal := err.(RemoteTranscoderFatalError)
 	if fatal {
 		// Don't retry if we've timed out; broadcaster likely to have moved on
@@ -840,8 +1353,11 @@ func (rtm *RemoteTranscoderManager) Transcode(fname string, profiles []ffmpeg.Vi
 		if err.(RemoteTranscoderFatalError).error == ErrRemoteTranscoderTimeout {
 			return res, err
 		}
-		return rtm.Transcode(fname, profiles)
+		if monitor.Enabled {
+			monitor.TranscoderRetried(result.transcoder.addr)
+		}
+		return rtm.Transcode(fname, profiles, encoders)
 	}
-	rtm.completeTranscoders(currentTranscoder)
+	rtm.completeTranscoders(result.transcoder)
 	return res, err
 }
@@ -0,0 +1,149 @@
+package core
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var errHealthObservation = errors.New("invalid health observation")
+
+// HealthObservation summarizes the segments that were sent to an orchestrator by a broadcaster
+// over a period of time
+type HealthObservation struct {
+	// Orchestrator is the transcoder URI of the orchestrator
+	Orchestrator string `json:"orchestrator"`
+	// Failures is the number of segments that failed on the orchestrator
+	Failures int `json:"failures"`
+	// Segments is the number of segments that the orchestrator transcoded
+	Segments int `json:"segments"`
+	// LatencyMs is the average latency of the transcoded segments in milliseconds
+	LatencyMs int64 `json:"latencyMs"`
+}
+
+func (o *HealthObservation) add(other *HealthObservation) {
+	if segments := o.Segments + other.Segments; segments > 0 {
+		o.LatencyMs = (o.LatencyMs*int64(o.Segments) + other.LatencyMs*int64(other.Segments)) / int64(segments)
+	}
+	o.Failures += other.Failures
+	o.Segments += other.Segments
+}
+
+type healthSample struct {
+	at  time.Time
+	obs HealthObservation
+}
+
+// OrchestratorHealth keeps the health observations of orchestrators that were made by this
+// node or gossiped by cooperating broadcasters within a window of time. An orchestrator is
+// unhealthy once too many segments failed on it, or once its average latency is too high,
+// within the window
+type OrchestratorHealth struct {
+	mu          sync.Mutex
+	maxFailures int
+	maxLatency  time.Duration
+	window      time.Duration
+	samples     map[string][]healthSample
+	// Observations of this node that were not taken for gossip yet
+	pending map[string]*HealthObservation
+}
+
+// NewOrchestratorHealth creates an OrchestratorHealth that considers orchestrators unhealthy after
+// maxFailures failed segments or an average latency above maxLatency within window. The latency
+// is not checked if maxLatency is 0
+func NewOrchestratorHealth(maxFailures int, maxLatency, window time.Duration) *OrchestratorHealth {
+	return &OrchestratorHealth{
+		maxFailures: maxFailures,
+		maxLatency:  maxLatency,
+		window:      window,
+		samples:     make(map[string][]healthSample),
+		pending:     make(map[string]*HealthObservation),
+	}
+}
+
+// Failure records a segment that failed on the orchestrator at uri
+func (h *OrchestratorHealth) Failure(uri string) {
+	h.observeLocal(HealthObservation{Orchestrator: uri, Failures: 1})
+}
+
+// Success records a segment that the orchestrator at uri transcoded with the given latency
+func (h *OrchestratorHealth) Success(uri string, latency time.Duration) {
+	h.observeLocal(HealthObservation{Orchestrator: uri, Segments: 1, LatencyMs: int64(latency / time.Millisecond)})
+}
+
+func (h *OrchestratorHealth) observeLocal(obs HealthObservation) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.observe(obs, time.Now())
+	pending, ok := h.pending[obs.Orchestrator]
+	if !ok {
+		pending = &HealthObservation{Orchestrator: obs.Orchestrator}
+		h.pending[obs.Orchestrator] = pending
+	}
+	pending.add(&obs)
+}
+
+// Merge records the observations that were gossiped by another broadcaster
+func (h *OrchestratorHealth) Merge(observations []HealthObservation) error {
+	for _, obs := range observations {
+		if obs.Orchestrator == "" || obs.Failures < 0 || obs.Segments < 0 || obs.LatencyMs < 0 {
+			return errHealthObservation
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	for _, obs := range observations {
+		h.observe(obs, now)
+	}
+	return nil
+}
+
+func (h *OrchestratorHealth) observe(obs HealthObservation, now time.Time) {
+	h.samples[obs.Orchestrator] = append(h.prune(obs.Orchestrator, now), healthSample{at: now, obs: obs})
+}
+
+// prune drops the samples of the orchestrator at uri that are outside of the window
+func (h *OrchestratorHealth) prune(uri string, now time.Time) []healthSample {
+	samples := h.samples[uri]
+	i := 0
+	for i < len(samples) && now.Sub(samples[i].at) > h.window {
+		i++
+	}
+	samples = samples[i:]
+	if len(samples) == 0 {
+		delete(h.samples, uri)
+	}
+	return samples
+}
+
+// Unhealthy returns whether the orchestrator at uri should not be sent segments
+func (h *OrchestratorHealth) Unhealthy(uri string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	total := HealthObservation{Orchestrator: uri}
+	for _, s := range h.prune(uri, time.Now()) {
+		total.add(&s.obs)
+	}
+	if total.Failures >= h.maxFailures {
+		return true
+	}
+	return h.maxLatency > 0 && total.Segments > 0 && time.Duration(total.LatencyMs)*time.Millisecond > h.maxLatency
+}
+
+// TakeObservations returns the observations of this node since the previous call
+func (h *OrchestratorHealth) TakeObservations() []HealthObservation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	observations := make([]HealthObservation, 0, len(h.pending))
+	for _, obs := range h.pending {
+		observations = append(observations, *obs)
+	}
+	h.pending = make(map[string]*HealthObservation)
+	return observations
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrchestratorHealth_Failures(t *testing.T) {
+	assert := assert.New(t)
+	h := NewOrchestratorHealth(3, 0, time.Minute)
+
+	h.Failure("o1")
+	h.Failure("o1")
+	assert.False(h.Unhealthy("o1"))
+	assert.False(h.Unhealthy("o2"))
+
+	// Failures reported by other broadcasters add up with the local ones
+	assert.Nil(h.Merge([]HealthObservation{{Orchestrator: "o1", Failures: 1}, {Orchestrator: "o2", Segments: 5}}))
+	assert.True(h.Unhealthy("o1"))
+	assert.False(h.Unhealthy("o2"))
+
+	// Only the local observations are taken for gossip
+	assert.Equal([]HealthObservation{{Orchestrator: "o1", Failures: 2}}, h.TakeObservations())
+	assert.Empty(h.TakeObservations())
+
+	assert.Equal(errHealthObservation, h.Merge([]HealthObservation{{Failures: 1}}))
+	assert.Equal(errHealthObservation, h.Merge([]HealthObservation{{Orchestrator: "o2", Failures: -1}}))
+}
+
+func TestOrchestratorHealth_Latency(t *testing.T) {
+	assert := assert.New(t)
+	h := NewOrchestratorHealth(3, time.Second, time.Minute)
+
+	h.Success("o1", 500*time.Millisecond)
+	h.Success("o1", 1500*time.Millisecond)
+	assert.Equal([]HealthObservation{{Orchestrator: "o1", Segments: 2, LatencyMs: 1000}}, h.TakeObservations())
+	assert.False(h.Unhealthy("o1"))
+
+	// The average latency is weighted by the number of segments of every observation
+	assert.Nil(h.Merge([]HealthObservation{{Orchestrator: "o1", Segments: 2, LatencyMs: 1300}}))
+	assert.True(h.Unhealthy("o1"))
+
+	// Latency is not checked without a maximum
+	h = NewOrchestratorHealth(3, 0, time.Minute)
+	h.Success("o1", time.Hour)
+	assert.False(h.Unhealthy("o1"))
+}
+
+func TestOrchestratorHealth_Window(t *testing.T) {
+	assert := assert.New(t)
+	h := NewOrchestratorHealth(1, 0, 50*time.Millisecond)
+
+	h.Failure("o1")
+	assert.True(h.Unhealthy("o1"))
+
+	time.Sleep(100 * time.Millisecond)
+	assert.False(h.Unhealthy("o1"))
+	assert.Empty(h.samples)
+}
@@ -0,0 +1,154 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/golang/glog"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+// Names of the orchestrator lists
+const (
+	OrchAllowlist = "allow"
+	OrchDenylist  = "deny"
+)
+
+// OrchestratorLists filter the orchestrators that a broadcaster sends segments to with an
+// allowlist and a denylist of patterns, which are kept in the node DB. A pattern is either the
+// ETH address that an orchestrator receives tickets with, or a pattern of its service URI in the
+// syntax of path.Match, e.g. https://*.example.com:*. Orchestrators that match the denylist are
+// never used and, if the allowlist is not empty, only orchestrators that match it are used
+type OrchestratorLists struct {
+	db *common.DB
+
+	mu    sync.RWMutex
+	lists map[string][]string
+}
+
+// NewOrchestratorLists loads the orchestrator lists from the DB
+func NewOrchestratorLists(db *common.DB) (*OrchestratorLists, error) {
+	entries, err := db.OrchestratorListEntries()
+	if err != nil {
+		return nil, err
+	}
+	l := &OrchestratorLists{db: db, lists: make(map[string][]string)}
+	for _, e := range entries {
+		l.lists[e.List] = append(l.lists[e.List], e.Pattern)
+	}
+	return l, nil
+}
+
+// Add adds a pattern to a list and stores it in the DB
+func (l *OrchestratorLists) Add(list, pattern string) error {
+	pattern, err := orchListPattern(list, pattern)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, p := range l.lists[list] {
+		if p == pattern {
+			return nil
+		}
+	}
+	if err := l.db.InsertOrchestratorListEntry(common.DBOrchListEntry{List: list, Pattern: pattern}); err != nil {
+		return err
+	}
+	l.lists[list] = append(l.lists[list], pattern)
+	glog.Infof("Added orchestrator to %slist pattern=%s", list, pattern)
+	return nil
+}
+
+// Remove removes a pattern from a list and the DB, and returns whether it was in the list
+func (l *OrchestratorLists) Remove(list, pattern string) (bool, error) {
+	pattern, err := orchListPattern(list, pattern)
+	if err != nil {
+		return false, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	removed, err := l.db.DeleteOrchestratorListEntry(common.DBOrchListEntry{List: list, Pattern: pattern})
+	if err != nil {
+		return false, err
+	}
+	patterns := l.lists[list]
+	for i, p := range patterns {
+		if p == pattern {
+			l.lists[list] = append(patterns[:i:i], patterns[i+1:]...)
+			removed = true
+			break
+		}
+	}
+	if removed {
+		glog.Infof("Removed orchestrator from %slist pattern=%s", list, pattern)
+	}
+	return removed, nil
+}
+
+// Lists returns the patterns of the allowlist and the denylist
+func (l *OrchestratorLists) Lists() map[string][]string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return map[string][]string{
+		OrchAllowlist: append([]string{}, l.lists[OrchAllowlist]...),
+		OrchDenylist:  append([]string{}, l.lists[OrchDenylist]...),
+	}
+}
+
+// Allowed returns whether segments can be sent to the orchestrator
+func (l *OrchestratorLists) Allowed(info *net.OrchestratorInfo) bool {
+	var addr *ethcommon.Address
+	if info.TicketParams != nil {
+		a := ethcommon.BytesToAddress(info.TicketParams.Recipient)
+		addr = &a
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if orchListMatch(l.lists[OrchDenylist], info.Transcoder, addr) {
+		return false
+	}
+	allow := l.lists[OrchAllowlist]
+	return len(allow) == 0 || orchListMatch(allow, info.Transcoder, addr)
+}
+
+func orchListMatch(patterns []string, uri string, addr *ethcommon.Address) bool {
+	for _, p := range patterns {
+		if ethcommon.IsHexAddress(p) {
+			if addr != nil && ethcommon.HexToAddress(p) == *addr {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(p, uri); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// orchListPattern validates a pattern of a list. Addresses are returned with their checksum
+// so that they are only stored once
+func orchListPattern(list, pattern string) (string, error) {
+	if list != OrchAllowlist && list != OrchDenylist {
+		return "", fmt.Errorf("unknown orchestrator list %v", list)
+	}
+	if pattern == "" {
+		return "", errors.New("missing orchestrator pattern")
+	}
+	if ethcommon.IsHexAddress(pattern) {
+		return ethcommon.HexToAddress(pattern).Hex(), nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return "", fmt.Errorf("invalid orchestrator pattern %v", pattern)
+	}
+	return pattern, nil
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+func TestOrchestratorLists(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	db, dbraw, err := common.TempDB(t)
+	require.Nil(err)
+	defer db.Close()
+	defer dbraw.Close()
+
+	l, err := NewOrchestratorLists(db)
+	require.Nil(err)
+
+	addr := ethcommon.Address{1}
+	orch := func(uri string, recipient *ethcommon.Address) *net.OrchestratorInfo {
+		info := &net.OrchestratorInfo{Transcoder: uri}
+		if recipient != nil {
+			info.TicketParams = &net.TicketParams{Recipient: recipient.Bytes()}
+		}
+		return info
+	}
+
+	// Every orchestrator is allowed by empty lists
+	assert.True(l.Allowed(orch("https://o1.example.com:8935", nil)))
+
+	assert.EqualError(l.Add("foo", "bar"), "unknown orchestrator list foo")
+	assert.EqualError(l.Add(OrchDenylist, ""), "missing orchestrator pattern")
+	assert.EqualError(l.Add(OrchDenylist, "https://[o1"), "invalid orchestrator pattern https://[o1")
+
+	require.Nil(l.Add(OrchDenylist, "https://*.bad.com:*"))
+	require.Nil(l.Add(OrchDenylist, strings.ToLower(addr.Hex())))
+	// Addresses are stored with their checksum, so they are only added once
+	require.Nil(l.Add(OrchDenylist, addr.Hex()))
+	assert.Equal([]string{"https://*.bad.com:*", addr.Hex()}, l.Lists()[OrchDenylist])
+	assert.Empty(l.Lists()[OrchAllowlist])
+
+	assert.False(l.Allowed(orch("https://o1.bad.com:8935", nil)))
+	assert.False(l.Allowed(orch("https://o1.example.com:8935", &addr)))
+	assert.True(l.Allowed(orch("https://o1.example.com:8935", &ethcommon.Address{2})))
+	assert.True(l.Allowed(orch("https://o1.example.com:8935", nil)))
+
+	// Only orchestrators that match the allowlist are allowed once it is not empty
+	require.Nil(l.Add(OrchAllowlist, "https://*.example.com:8935"))
+	assert.True(l.Allowed(orch("https://o1.example.com:8935", nil)))
+	assert.False(l.Allowed(orch("https://o1.example.com:9000", nil)))
+	// The denylist takes precedence
+	assert.False(l.Allowed(orch("https://o1.example.com:8935", &addr)))
+
+	removed, err := l.Remove(OrchDenylist, addr.Hex())
+	require.Nil(err)
+	assert.True(removed)
+	removed, err = l.Remove(OrchDenylist, addr.Hex())
+	require.Nil(err)
+	assert.False(removed)
+	assert.True(l.Allowed(orch("https://o1.example.com:8935", &addr)))
+
+	// The lists are loaded from the DB
+	l, err = NewOrchestratorLists(db)
+	require.Nil(err)
+	assert.Equal(map[string][]string{
+		OrchAllowlist: {"https://*.example.com:8935"},
+		OrchDenylist:  {"https://*.bad.com:*"},
+	}, l.Lists())
+}
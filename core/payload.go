@@ -0,0 +1,64 @@
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// Context of the keys derived for payload encryption so that they can't be confused with other uses of the shared secret
+const payloadKeyContext = "livepeer-transcoder-payload:"
+
+var ErrPayload = errors.New("ErrPayload")
+
+// PayloadKey derives the key that encrypts the segments exchanged between an orchestrator
+// and a transcoder. The key ID is chosen by the transcoder when it registers so that each
+// orchestrator-transcoder pair uses a different key
+func PayloadKey(secret, keyID string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payloadKeyContext + keyID))
+	return mac.Sum(nil)
+}
+
+// EncryptPayload seals data with AES-256-GCM. The random nonce is prepended to the result.
+// The additional data, such as a task ID, is authenticated but not encrypted
+func EncryptPayload(key, data, additionalData []byte) ([]byte, error) {
+	aead, err := newPayloadAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, additionalData), nil
+}
+
+// DecryptPayload opens data that was sealed by EncryptPayload with the same key and additional data
+func DecryptPayload(key, data, additionalData []byte) ([]byte, error) {
+	aead, err := newPayloadAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("%v: payload too short", ErrPayload)
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", ErrPayload, err)
+	}
+	return plaintext, nil
+}
+
+func newPayloadAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayloadKey(t *testing.T) {
+	assert := assert.New(t)
+
+	key := PayloadKey("secret", "keyid")
+	assert.Len(key, 32)
+	assert.Equal(key, PayloadKey("secret", "keyid"))
+	// Every orchestrator-transcoder pair gets its own key
+	assert.NotEqual(key, PayloadKey("secret", "keyid2"))
+	assert.NotEqual(key, PayloadKey("secret2", "keyid"))
+}
+
+func TestPayloadEncryption(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	key := PayloadKey("secret", "keyid")
+	data := []byte("segment data")
+	enc, err := EncryptPayload(key, data, []byte("segment/1/0"))
+	require.Nil(err)
+	assert.NotContains(string(enc), string(data))
+
+	// Encrypting twice uses different nonces
+	enc2, err := EncryptPayload(key, data, []byte("segment/1/0"))
+	require.Nil(err)
+	assert.NotEqual(enc, enc2)
+
+	dec, err := DecryptPayload(key, enc, []byte("segment/1/0"))
+	require.Nil(err)
+	assert.Equal(data, dec)
+
+	// Fails with another key or additional data
+	_, err = DecryptPayload(PayloadKey("secret", "keyid2"), enc, []byte("segment/1/0"))
+	assert.EqualError(err, "ErrPayload: cipher: message authentication failed")
+	_, err = DecryptPayload(key, enc, []byte("segment/2/0"))
+	assert.EqualError(err, "ErrPayload: cipher: message authentication failed")
+
+	// Fails if the payload was tampered with
+	enc[len(enc)-1] ^= 1
+	_, err = DecryptPayload(key, enc, []byte("segment/1/0"))
+	assert.NotNil(err)
+
+	_, err = DecryptPayload(key, []byte("short"), nil)
+	assert.EqualError(err, "ErrPayload: payload too short")
+
+	_, err = EncryptPayload([]byte("badkey"), data, nil)
+	assert.NotNil(err)
+}
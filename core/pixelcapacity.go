@@ -0,0 +1,219 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/common"
+	ffmpeg "github.com/livepeer/lpms/ffmpeg"
+)
+
+// Framerate assumed for the profiles that keep the framerate of the source
+const pixelCapacityDefaultFramerate = 30
+
+var ErrPixelCapacityConfig = errors.New("ErrPixelCapacityConfig")
+
+// ProfilesPixelRate returns the number of pixels per second that transcoding a stream into
+// the profiles produces. Audio-only profiles produce none
+func ProfilesPixelRate(profiles []ffmpeg.VideoProfile) (float64, error) {
+	rate := 0.0
+	for _, p := range profiles {
+		if common.AudioOnlyProfile(p) {
+			continue
+		}
+		w, h, err := ffmpeg.VideoProfileResolution(p)
+		if err != nil {
+			return 0, fmt.Errorf("invalid resolution %q of profile %v: %v", p.Resolution, p.Name, err)
+		}
+		framerate := p.Framerate
+		if framerate == 0 {
+			framerate = pixelCapacityDefaultFramerate
+		}
+		rate += float64(w*h) * float64(framerate)
+	}
+	return rate, nil
+}
+
+// PixelCapacity admits streams as long as the pixels per second of their ladders fit the
+// pixels per second that the node can transcode. The budget is either set by the operator
+// or measured from the transcodes of the node
+type PixelCapacity struct {
+	// The budget is not measured if it is set by the operator
+	fixed bool
+
+	mu sync.RWMutex
+	// Pixels per second that can be transcoded in real time. 0 if not measured yet
+	budget float64
+	// Pixels per second of the ladders of the admitted streams
+	streams map[ManifestID]float64
+	load    float64
+}
+
+// NewPixelCapacity creates a PixelCapacity with a budget in pixels per second, or a
+// PixelCapacity that measures its budget if budget is 0
+func NewPixelCapacity(budget float64) (*PixelCapacity, error) {
+	if budget < 0 {
+		return nil, fmt.Errorf("%v: pixels per second must not be negative", ErrPixelCapacityConfig)
+	}
+	return &PixelCapacity{
+		fixed:   budget > 0,
+		budget:  budget,
+		streams: make(map[ManifestID]float64),
+	}, nil
+}
+
+// Budget returns the pixels per second that can be transcoded in real time. 0 if not measured yet
+func (c *PixelCapacity) Budget() float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.budget
+}
+
+// Load returns the pixels per second of the ladders of the admitted streams
+func (c *PixelCapacity) Load() float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.load
+}
+
+// Measured returns true if the budget is known, either set by the operator or measured
+func (c *PixelCapacity) Measured() bool {
+	return c.Budget() > 0
+}
+
+// Admits returns ErrOrchCap if a stream transcoded into profiles doesn't fit the remaining
+// budget. Admitted streams always fit. Without profiles, ErrOrchCap is only returned if the
+// budget is used up
+func (c *PixelCapacity) Admits(mid ManifestID, profiles []ffmpeg.VideoProfile) error {
+	rate, err := ProfilesPixelRate(profiles)
+	if err != nil {
+		return err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if _, ok := c.streams[mid]; ok {
+		return nil
+	}
+	if c.load >= c.budget || c.load+rate > c.budget {
+		return ErrOrchCap
+	}
+	return nil
+}
+
+// Reserve adds the pixels per second of a stream transcoded into profiles to the load, even
+// if it exceeds the budget
+func (c *PixelCapacity) Reserve(mid ManifestID, profiles []ffmpeg.VideoProfile) {
+	rate, err := ProfilesPixelRate(profiles)
+	if err != nil {
+		glog.Errorf("Cannot reserve pixel capacity manifestID=%s: %v", mid, err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.load += rate - c.streams[mid]
+	c.streams[mid] = rate
+}
+
+// Release removes the pixels per second of a stream from the load
+func (c *PixelCapacity) Release(mid ManifestID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rate, ok := c.streams[mid]
+	if !ok {
+		return
+	}
+	delete(c.streams, mid)
+	c.load -= rate
+	if len(c.streams) == 0 {
+		// Avoids drifting due to rounding errors
+		c.load = 0
+	}
+}
+
+// Record measures the budget from a segment of the given duration in seconds that took took
+// to transcode while the admitted streams were transcoded concurrently
+func (c *PixelCapacity) Record(duration float64, took time.Duration) {
+	if c.fixed || duration <= 0 || took <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	if c.load <= 0 {
+		c.mu.Unlock()
+		return
+	}
+	// Each of the concurrent streams receives duration seconds of content every took
+	c.record(c.load * duration / took.Seconds())
+	budget, load := c.budget, c.load
+	c.mu.Unlock()
+
+	glog.V(common.DEBUG).Infof("Measured pixel capacity budget=%.0f load=%.0f", budget, load)
+}
+
+// Benchmark measures the budget by transcoding a sample segment into the given profiles with
+// sessions concurrent transcodes
+func (c *PixelCapacity) Benchmark(transcoder Transcoder, fname string, profiles []ffmpeg.VideoProfile, sessions int) error {
+	if c.fixed {
+		return nil
+	}
+	if sessions <= 0 {
+		return fmt.Errorf("%v: benchmark sessions must be greater than 0", ErrPixelCapacityConfig)
+	}
+	rate, err := ProfilesPixelRate(profiles)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return err
+	}
+	info, err := common.InspectTS(data)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, sessions)
+	start := time.Now()
+	for i := 0; i < sessions; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := transcoder.Transcode(fname, profiles, nil); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	took := time.Since(start)
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+	if info.Duration <= 0 || took <= 0 {
+		return nil
+	}
+
+	c.mu.Lock()
+	c.record(float64(sessions) * rate * info.Duration / took.Seconds())
+	budget := c.budget
+	c.mu.Unlock()
+
+	glog.Infof("Benchmarked pixel capacity sessions=%v duration=%.3fs took=%v budget=%.0f", sessions, info.Duration, took, budget)
+	return nil
+}
+
+// record adds a measurement of the budget to its moving average. Must be called with mu held
+func (c *PixelCapacity) record(sample float64) {
+	if c.budget > 0 {
+		c.budget = throughputSmoothing*sample + (1-throughputSmoothing)*c.budget
+	} else {
+		c.budget = sample
+	}
+}
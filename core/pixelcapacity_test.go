@@ -0,0 +1,209 @@
+package core
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/drivers"
+	ffmpeg "github.com/livepeer/lpms/ffmpeg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfilesPixelRate(t *testing.T) {
+	assert := assert.New(t)
+
+	rate, err := ProfilesPixelRate(nil)
+	assert.Nil(err)
+	assert.Zero(rate)
+
+	rate, err = ProfilesPixelRate([]ffmpeg.VideoProfile{ffmpeg.P720p60fps16x9, ffmpeg.P360p30fps16x9})
+	assert.Nil(err)
+	assert.Equal(float64(1280*720*60+640*360*30), rate)
+
+	// Profiles without a framerate are assumed to keep the framerate of the source
+	rate, err = ProfilesPixelRate([]ffmpeg.VideoProfile{{Name: "src", Resolution: "640x360"}})
+	assert.Nil(err)
+	assert.Equal(float64(640*360*pixelCapacityDefaultFramerate), rate)
+
+	// Audio-only profiles produce no pixels
+	rate, err = ProfilesPixelRate([]ffmpeg.VideoProfile{ffmpeg.P360p30fps16x9, {Name: "audio", Bitrate: "64k"}})
+	assert.Nil(err)
+	assert.Equal(float64(640*360*30), rate)
+
+	_, err = ProfilesPixelRate([]ffmpeg.VideoProfile{{Name: "bad", Resolution: "640"}})
+	assert.Contains(err.Error(), `invalid resolution "640" of profile bad`)
+}
+
+func TestPixelCapacity_Admits(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewPixelCapacity(-1)
+	assert.EqualError(err, "ErrPixelCapacityConfig: pixels per second must not be negative")
+
+	p720 := []ffmpeg.VideoProfile{ffmpeg.P720p30fps16x9}
+	p360 := []ffmpeg.VideoProfile{ffmpeg.P360p30fps16x9}
+	rate720, _ := ProfilesPixelRate(p720)
+	rate360, _ := ProfilesPixelRate(p360)
+
+	c, err := NewPixelCapacity(rate720 + rate360)
+	require.Nil(t, err)
+	assert.True(c.Measured())
+	assert.Nil(c.Admits("a", p720))
+
+	c.Reserve("a", p720)
+	assert.Equal(rate720, c.Load())
+
+	// Only the ladders that fit the remaining budget are admitted
+	assert.Equal(ErrOrchCap, c.Admits("b", p720))
+	assert.Nil(c.Admits("b", p360))
+	assert.Nil(c.Admits("", nil))
+
+	// Admitted streams always fit
+	c.Reserve("b", p360)
+	assert.Nil(c.Admits("a", p720))
+	assert.Equal(ErrOrchCap, c.Admits("c", p360))
+	assert.Equal(ErrOrchCap, c.Admits("", nil))
+
+	// Reserving a stream again replaces its ladder
+	c.Reserve("b", p720)
+	assert.Equal(2*rate720, c.Load())
+
+	c.Release("b")
+	c.Release("b")
+	assert.Equal(rate720, c.Load())
+	assert.Nil(c.Admits("b", p360))
+
+	c.Release("a")
+	assert.Zero(c.Load())
+
+	// Ladders with invalid resolutions are not admitted
+	assert.NotNil(c.Admits("d", []ffmpeg.VideoProfile{{Name: "bad", Resolution: "x"}}))
+}
+
+func TestPixelCapacity_Record(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := NewPixelCapacity(0)
+	require.Nil(t, err)
+	assert.False(c.Measured())
+
+	// Nothing is measured without load
+	c.Record(2, time.Second)
+	assert.False(c.Measured())
+
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P360p30fps16x9}
+	rate, _ := ProfilesPixelRate(profiles)
+	c.Reserve("a", profiles)
+
+	// Invalid measurements are ignored
+	c.Record(0, time.Second)
+	c.Record(2, 0)
+	assert.False(c.Measured())
+
+	// The load transcoded 2s segments in 1s, so twice the load can be transcoded
+	c.Record(2, time.Second)
+	assert.Equal(2*rate, c.Budget())
+
+	// Later measurements are smoothed
+	c.Record(2, 500*time.Millisecond)
+	assert.InDelta(0.2*4*rate+0.8*2*rate, c.Budget(), 0.0001)
+
+	// A budget set by the operator is not measured
+	c, err = NewPixelCapacity(rate)
+	require.Nil(t, err)
+	c.Reserve("a", profiles)
+	c.Record(2, time.Second)
+	assert.Equal(rate, c.Budget())
+}
+
+// benchmarkTranscoder counts the segments that the concurrent sessions of a benchmark transcode
+type benchmarkTranscoder struct {
+	segCount      int32
+	failTranscode bool
+}
+
+func (t *benchmarkTranscoder) Transcode(fname string, profiles []ffmpeg.VideoProfile, encoders common.ProfileEncoders) (*TranscodeData, error) {
+	if t.failTranscode {
+		return nil, ErrTranscode
+	}
+	atomic.AddInt32(&t.segCount, 1)
+	return &TranscodeData{}, nil
+}
+
+func (t *benchmarkTranscoder) SegCount() int {
+	return int(atomic.LoadInt32(&t.segCount))
+}
+
+func TestPixelCapacity_Benchmark(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := NewPixelCapacity(0)
+	require.Nil(t, err)
+
+	tcoder := &benchmarkTranscoder{}
+	assert.EqualError(c.Benchmark(tcoder, "test.ts", videoProfiles, 0), "ErrPixelCapacityConfig: benchmark sessions must be greater than 0")
+
+	// Missing sample segment
+	assert.NotNil(c.Benchmark(tcoder, "dne.ts", videoProfiles, 1))
+	assert.Equal(0, tcoder.SegCount())
+
+	// Transcode error
+	tcoder.failTranscode = true
+	assert.Equal(ErrTranscode, c.Benchmark(tcoder, "test.ts", videoProfiles, 1))
+	assert.False(c.Measured())
+
+	// The stub transcodes the ~8.7s sample segment much faster than real time
+	tcoder.failTranscode = false
+	assert.Nil(c.Benchmark(tcoder, "test.ts", videoProfiles, 2))
+	assert.Equal(2, tcoder.SegCount())
+	rate, _ := ProfilesPixelRate(videoProfiles)
+	assert.True(c.Budget() > 2*rate)
+
+	// A budget set by the operator is not benchmarked
+	c, err = NewPixelCapacity(rate)
+	require.Nil(t, err)
+	assert.Nil(c.Benchmark(tcoder, "test.ts", videoProfiles, 1))
+	assert.Equal(2, tcoder.SegCount())
+	assert.Equal(rate, c.Budget())
+}
+
+func TestCheckCapacity_PixelCapacity(t *testing.T) {
+	assert := assert.New(t)
+
+	defer func(max int) { MaxSessions = max }(MaxSessions)
+	MaxSessions = 10
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	n, _ := NewLivepeerNode(nil, "", nil)
+	o := NewOrchestrator(n)
+	md := StubSegTranscodingMetadata()
+	md.Profiles = []ffmpeg.VideoProfile{ffmpeg.P720p30fps16x9}
+	p360 := []ffmpeg.VideoProfile{ffmpeg.P360p30fps16x9}
+	rate720, _ := ProfilesPixelRate(md.Profiles)
+	rate360, _ := ProfilesPixelRate(p360)
+
+	// Streams are counted against MaxSessions until the budget is measured
+	capacity, err := NewPixelCapacity(0)
+	require.Nil(t, err)
+	n.PixelCapacity = capacity
+	assert.Nil(o.CheckCapacity(md.ManifestID, md.Profiles))
+
+	n.PixelCapacity, err = NewPixelCapacity(rate720 + rate360)
+	require.Nil(t, err)
+	_, err = n.getSegmentChan(md)
+	assert.Nil(err)
+	assert.Equal(rate720, n.PixelCapacity.Load())
+
+	// The admitted stream passes while new streams need to fit the remaining budget
+	assert.Nil(o.CheckCapacity(md.ManifestID, md.Profiles))
+	assert.Equal(ErrOrchCap, o.CheckCapacity(ManifestID("foo"), md.Profiles))
+	assert.Nil(o.CheckCapacity(ManifestID("foo"), p360))
+	_, err = n.getSegmentChan(&SegTranscodingMetadata{ManifestID: ManifestID("foo"), Profiles: md.Profiles})
+	assert.Equal(ErrOrchCap, err)
+
+	// MaxSessions still caps the number of streams
+	MaxSessions = 1
+	assert.Equal(ErrOrchCap, o.CheckCapacity(ManifestID("foo"), p360))
+}
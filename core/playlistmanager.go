@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/drivers"
 	ffmpeg "github.com/livepeer/lpms/ffmpeg"
 	"github.com/livepeer/m3u8"
@@ -12,6 +13,23 @@ import (
 
 const LIVE_LIST_LENGTH uint = 6
 
+// HLSAudioGroup is the group of the audio renditions of streams with several audio tracks
+const HLSAudioGroup = "audio"
+
+// hlsAudioCodecs are the HLS codecs of audio-only renditions by their output codec
+var hlsAudioCodecs = map[string]string{
+	common.CodecAAC:  "mp4a.40.2",
+	common.CodecOpus: "opus",
+}
+
+// AudioTrack is an audio track of a stream with several audio tracks
+type AudioTrack struct {
+	// Name of the rendition of the track
+	Name string
+	// ISO 639 code of the language of the track, if known
+	Language string
+}
+
 //	PlaylistManager manages playlists and data for one video stream, backed by one object storage.
 type PlaylistManager interface {
 	ManifestID() ManifestID
@@ -19,10 +37,25 @@ type PlaylistManager interface {
 	// Inserts in media playlist given a link to a segment
 	InsertHLSSegment(profile *ffmpeg.VideoProfile, seqNo uint64, uri string, duration float64) error
 
+	// Inserts in the low latency media playlist a link to a part of a segment that is not complete yet
+	InsertHLSPart(profile *ffmpeg.VideoProfile, seqNo uint64, part *LLHLSPart) error
+
+	// Advertises the audio tracks of the stream as alternate audio renditions in the master playlist
+	SetAudioTracks(tracks []AudioTrack)
+
+	// Inserts in the media playlist of an alternate audio track a link to a segment
+	InsertHLSAudioSegment(rendition string, seqNo uint64, uri string, duration float64) error
+
+	// Sets the encoder options of the profiles of the stream, which determine the codecs
+	// that audio-only renditions are advertised with in the master playlist
+	SetEncoders(encoders common.ProfileEncoders)
+
 	GetHLSMasterPlaylist() *m3u8.MasterPlaylist
 
 	GetHLSMediaPlaylist(rendition string) *m3u8.MediaPlaylist
 
+	GetLLHLSMediaPlaylist(rendition string) *LLHLSPlaylist
+
 	GetOSSession() drivers.OSSession
 
 	Cleanup()
@@ -34,7 +67,17 @@ type BasicPlaylistManager struct {
 	// Live playlist used for broadcasting
 	masterPList *m3u8.MasterPlaylist
 	mediaLists  map[string]*m3u8.MediaPlaylist
-	mapSync     *sync.RWMutex
+	// Low latency playlists that are updated along with the media playlists
+	llLists map[string]*LLHLSPlaylist
+	mapSync *sync.RWMutex
+	// Every segment of the stream if it is recorded
+	recording *StreamRecording
+	// Audio tracks of the stream and their alternate renditions in the master playlist.
+	// Protected by mapSync
+	audioTracks []AudioTrack
+	audioAlts   []*m3u8.Alternative
+	// Encoder options of the profiles of the stream. Protected by mapSync
+	encoders common.ProfileEncoders
 }
 
 // NewBasicPlaylistManager create new BasicPlaylistManager struct
@@ -46,6 +89,7 @@ func NewBasicPlaylistManager(manifestID ManifestID,
 		manifestID:     manifestID,
 		masterPList:    m3u8.NewMasterPlaylist(),
 		mediaLists:     make(map[string]*m3u8.MediaPlaylist),
+		llLists:        make(map[string]*LLHLSPlaylist),
 		mapSync:        &sync.RWMutex{},
 	}
 	return bplm
@@ -55,7 +99,21 @@ func (mgr *BasicPlaylistManager) ManifestID() ManifestID {
 	return mgr.manifestID
 }
 
+// Record keeps track of every segment of the stream to write VOD playlists in the given formats
+// to the storage of the stream on Cleanup. It has to be called before any segment is inserted
+func (mgr *BasicPlaylistManager) Record(formats []string) *StreamRecording {
+	mgr.recording = NewStreamRecording(mgr.storageSession, formats)
+	return mgr.recording
+}
+
 func (mgr *BasicPlaylistManager) Cleanup() {
+	if mgr.recording != nil {
+		if err := mgr.recording.Finalize(); err != nil {
+			glog.Errorf("Error finalizing recording manifestID=%s: %v", mgr.manifestID, err)
+		} else {
+			glog.Infof("Finalized recording manifestID=%s", mgr.manifestID)
+		}
+	}
 	mgr.storageSession.EndSession()
 }
 
@@ -70,31 +128,143 @@ func (mgr *BasicPlaylistManager) getPL(rendition string) *m3u8.MediaPlaylist {
 	return mpl
 }
 
-func (mgr *BasicPlaylistManager) getOrCreatePL(profile *ffmpeg.VideoProfile) (*m3u8.MediaPlaylist, error) {
+func (mgr *BasicPlaylistManager) getLLPL(rendition string) *LLHLSPlaylist {
+	mgr.mapSync.RLock()
+	llpl := mgr.llLists[rendition]
+	mgr.mapSync.RUnlock()
+	return llpl
+}
+
+func (mgr *BasicPlaylistManager) getOrCreatePL(profile *ffmpeg.VideoProfile) (*m3u8.MediaPlaylist, *LLHLSPlaylist, error) {
 	mgr.mapSync.Lock()
 	defer mgr.mapSync.Unlock()
-	if pl, ok := mgr.mediaLists[profile.Name]; ok {
-		return pl, nil
+	mpl, llpl, created, err := mgr.getOrCreateMediaPL(profile.Name)
+	if err != nil || !created {
+		return mpl, llpl, err
+	}
+	vParams := ffmpeg.VideoProfileToVariantParams(*profile)
+	// Audio-only renditions have no resolution, and their codec tells players that they have no video
+	if common.AudioOnlyProfile(*profile) {
+		vParams.Codecs = hlsAudioCodecs[mgr.encoders[profile.Name].Codec]
+	}
+	setAudioAlternatives(&vParams, mgr.audioAlts)
+	mgr.masterPList.Append(mgr.playlistURL(profile.Name), mpl, vParams)
+	return mpl, llpl, nil
+}
+
+// getOrCreateMediaPL returns the media playlists of a rendition and whether they were created.
+// mapSync must be locked
+func (mgr *BasicPlaylistManager) getOrCreateMediaPL(rendition string) (*m3u8.MediaPlaylist, *LLHLSPlaylist, bool, error) {
+	if pl, ok := mgr.mediaLists[rendition]; ok {
+		return pl, mgr.llLists[rendition], false, nil
 	}
 	mpl, err := m3u8.NewMediaPlaylist(LIVE_LIST_LENGTH, LIVE_LIST_LENGTH)
 	if err != nil {
 		glog.Error(err)
-		return nil, err
+		return nil, nil, false, err
+	}
+	mgr.mediaLists[rendition] = mpl
+	llpl := NewLLHLSPlaylist(LIVE_LIST_LENGTH)
+	mgr.llLists[rendition] = llpl
+	return mpl, llpl, true, nil
+}
+
+func (mgr *BasicPlaylistManager) playlistURL(rendition string) string {
+	return fmt.Sprintf("%v/%v.m3u8", string(mgr.manifestID), rendition)
+}
+
+// SetEncoders sets the encoder options of the profiles of the stream. It applies to
+// the renditions that are added to the master playlist afterwards
+func (mgr *BasicPlaylistManager) SetEncoders(encoders common.ProfileEncoders) {
+	mgr.mapSync.Lock()
+	defer mgr.mapSync.Unlock()
+	mgr.encoders = encoders
+}
+
+// SetAudioTracks advertises the audio tracks of a stream with several audio tracks in the
+// master playlist. The first track is the one that is muxed with the video of every variant
+// and the others are alternate renditions with their own media playlists
+func (mgr *BasicPlaylistManager) SetAudioTracks(tracks []AudioTrack) {
+	mgr.mapSync.Lock()
+	defer mgr.mapSync.Unlock()
+	if audioTracksEqual(tracks, mgr.audioTracks) {
+		return
+	}
+	mgr.audioTracks = append([]AudioTrack{}, tracks...)
+
+	var alts []*m3u8.Alternative
+	if len(tracks) > 1 {
+		for i, track := range tracks {
+			alt := &m3u8.Alternative{
+				Type:       "AUDIO",
+				GroupId:    HLSAudioGroup,
+				Name:       track.Name,
+				Language:   track.Language,
+				Autoselect: "YES",
+			}
+			if i == 0 {
+				alt.Default = true
+			} else {
+				alt.URI = mgr.playlistURL(track.Name)
+			}
+			alts = append(alts, alt)
+		}
+	}
+	mgr.audioAlts = alts
+	for _, v := range mgr.masterPList.Variants {
+		setAudioAlternatives(&v.VariantParams, alts)
+	}
+}
+
+func audioTracksEqual(a, b []AudioTrack) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func setAudioAlternatives(params *m3u8.VariantParams, alts []*m3u8.Alternative) {
+	params.Alternatives = alts
+	params.Audio = ""
+	if len(alts) > 0 {
+		params.Audio = HLSAudioGroup
 	}
-	mgr.mediaLists[profile.Name] = mpl
-	vParams := ffmpeg.VideoProfileToVariantParams(*profile)
-	url := fmt.Sprintf("%v/%v.m3u8", mgr.manifestID, profile.Name)
-	mgr.masterPList.Append(url, mpl, vParams)
-	return mpl, nil
 }
 
 func (mgr *BasicPlaylistManager) InsertHLSSegment(profile *ffmpeg.VideoProfile, seqNo uint64, uri string,
 	duration float64) error {
 
-	mpl, err := mgr.getOrCreatePL(profile)
+	mpl, llpl, err := mgr.getOrCreatePL(profile)
 	if err != nil {
 		return err
 	}
+	// Segments that are too late for the live playlist are still recorded
+	if mgr.recording != nil {
+		if err := mgr.recording.InsertSegment(profile, seqNo, uri, duration); err != nil {
+			glog.Errorf("Error recording segment manifestID=%s seqNo=%d: %v", mgr.manifestID, seqNo, err)
+		}
+	}
+	return mgr.insertSegment(mpl, llpl, seqNo, uri, duration)
+}
+
+// InsertHLSAudioSegment inserts a segment of an alternate audio track in its media playlist.
+// Audio tracks are not recorded
+func (mgr *BasicPlaylistManager) InsertHLSAudioSegment(rendition string, seqNo uint64, uri string, duration float64) error {
+	mgr.mapSync.Lock()
+	mpl, llpl, _, err := mgr.getOrCreateMediaPL(rendition)
+	mgr.mapSync.Unlock()
+	if err != nil {
+		return err
+	}
+	return mgr.insertSegment(mpl, llpl, seqNo, uri, duration)
+}
+
+func (mgr *BasicPlaylistManager) insertSegment(mpl *m3u8.MediaPlaylist, llpl *LLHLSPlaylist, seqNo uint64, uri string, duration float64) error {
 	mseg := newMediaSegment(uri, duration)
 	if mpl.Count() >= mpl.WinSize() {
 		mpl.Remove()
@@ -103,7 +273,22 @@ func (mgr *BasicPlaylistManager) InsertHLSSegment(profile *ffmpeg.VideoProfile,
 		mpl.SeqNo = mseg.SeqId
 	}
 
-	return mpl.InsertSegment(seqNo, mseg)
+	if err := mpl.InsertSegment(seqNo, mseg); err != nil {
+		return err
+	}
+	if err := llpl.InsertSegment(seqNo, uri, duration); err != nil {
+		glog.V(common.DEBUG).Infof("Error inserting segment into low latency playlist manifestID=%s seqNo=%d: %v", mgr.manifestID, seqNo, err)
+	}
+	return nil
+}
+
+// InsertHLSPart advertises a part of a segment in the low latency media playlist before the segment is complete
+func (mgr *BasicPlaylistManager) InsertHLSPart(profile *ffmpeg.VideoProfile, seqNo uint64, part *LLHLSPart) error {
+	_, llpl, err := mgr.getOrCreatePL(profile)
+	if err != nil {
+		return err
+	}
+	return llpl.InsertPart(seqNo, part)
 }
 
 // GetHLSMasterPlaylist ..
@@ -116,6 +301,11 @@ func (mgr *BasicPlaylistManager) GetHLSMediaPlaylist(rendition string) *m3u8.Med
 	return mgr.getPL(rendition)
 }
 
+// GetLLHLSMediaPlaylist returns the low latency media playlist of a rendition
+func (mgr *BasicPlaylistManager) GetLLHLSMediaPlaylist(rendition string) *LLHLSPlaylist {
+	return mgr.getLLPL(rendition)
+}
+
 func newMediaSegment(uri string, duration float64) *m3u8.MediaSegment {
 	return &m3u8.MediaSegment{
 		URI:      uri,
@@ -5,9 +5,11 @@ import (
 	"net/url"
 	"testing"
 
+	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/drivers"
 	ffmpeg "github.com/livepeer/lpms/ffmpeg"
 	"github.com/livepeer/m3u8"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestGetMasterPlaylist(t *testing.T) {
@@ -50,7 +52,7 @@ func TestGetOrCreatePL(t *testing.T) {
 	}
 
 	// insert one
-	pl, err := c.getOrCreatePL(vProfile)
+	pl, _, err := c.getOrCreatePL(vProfile)
 	if err != nil {
 		t.Error("Unexpected error ", err)
 	}
@@ -64,7 +66,7 @@ func TestGetOrCreatePL(t *testing.T) {
 	// using the same profile name should return the original profile
 	orig := pl
 	vProfile = &ffmpeg.VideoProfile{Name: vProfile.Name}
-	pl, err = c.getOrCreatePL(vProfile)
+	pl, _, err = c.getOrCreatePL(vProfile)
 	if err != nil || orig != pl {
 		t.Error("Mismatched profile or error ", err)
 	}
@@ -75,7 +77,7 @@ func TestGetOrCreatePL(t *testing.T) {
 
 	// using a different profile name should return a different profile
 	vProfile = &ffmpeg.P240p30fps16x9
-	pl, err = c.getOrCreatePL(vProfile)
+	pl, _, err = c.getOrCreatePL(vProfile)
 	if err != nil || orig == pl {
 		t.Error("Matched profile or error ", err)
 	}
@@ -85,6 +87,29 @@ func TestGetOrCreatePL(t *testing.T) {
 	}
 }
 
+func TestGetOrCreatePL_AudioOnly(t *testing.T) {
+	assert := assert.New(t)
+
+	c := NewBasicPlaylistManager(RandomManifestID(), nil)
+	c.SetEncoders(common.ProfileEncoders{"aac": {Codec: common.CodecAAC}, "opus": {Codec: common.CodecOpus}})
+	for _, p := range []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, {Name: "aac", Bitrate: "64k"}, {Name: "opus", Bitrate: "96k"}} {
+		_, _, err := c.getOrCreatePL(&p)
+		assert.Nil(err)
+	}
+
+	// Audio-only variants have no resolution and advertise their codec
+	variants := c.GetHLSMasterPlaylist().Variants
+	assert.Len(variants, 3)
+	assert.Equal(ffmpeg.P144p30fps16x9.Resolution, variants[0].Resolution)
+	assert.Empty(variants[0].Codecs)
+	assert.Empty(variants[1].Resolution)
+	assert.Equal("mp4a.40.2", variants[1].Codecs)
+	assert.Equal(uint32(64000), variants[1].Bandwidth)
+	assert.Empty(variants[2].Resolution)
+	assert.Equal("opus", variants[2].Codecs)
+	assert.Contains(c.GetHLSMasterPlaylist().String(), `#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=64000,CODECS="mp4a.40.2"`)
+}
+
 func TestPlaylists(t *testing.T) {
 
 	c := NewBasicPlaylistManager(RandomManifestID(), nil)
@@ -186,3 +211,41 @@ func TestCleanup(t *testing.T) {
 		t.Fatal("Data should be cleaned up")
 	}
 }
+
+func TestAudioTracks(t *testing.T) {
+	assert := assert.New(t)
+	c := NewBasicPlaylistManager("mid", nil)
+	vProfile := ffmpeg.P144p30fps16x9
+
+	assert.Nil(c.InsertHLSSegment(&vProfile, 1, "P144p30fps16x9/1.ts", 2))
+	tracks := []AudioTrack{{Name: "audio_0", Language: "eng"}, {Name: "audio_1", Language: "spa"}}
+	c.SetAudioTracks(tracks)
+	assert.Nil(c.InsertHLSAudioSegment("audio_1", 1, "audio_1/1.ts", 2))
+	vProfile2 := ffmpeg.P240p30fps16x9
+	assert.Nil(c.InsertHLSSegment(&vProfile2, 1, "P240p30fps16x9/1.ts", 2))
+
+	// Alternate audio tracks have media playlists but no variants
+	master := c.GetHLSMasterPlaylist()
+	assert.Len(master.Variants, 2)
+	for _, v := range master.Variants {
+		assert.Equal(HLSAudioGroup, v.Audio)
+		assert.Len(v.Alternatives, 2)
+	}
+	encoded := master.String()
+	assert.Contains(encoded, `#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio",NAME="audio_0",DEFAULT=YES,AUTOSELECT=YES,LANGUAGE="eng"`)
+	assert.Contains(encoded, `#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio",NAME="audio_1",DEFAULT=NO,AUTOSELECT=YES,LANGUAGE="spa",URI="mid/audio_1.m3u8"`)
+	mpl := c.GetHLSMediaPlaylist("audio_1")
+	if assert.NotNil(mpl) {
+		assert.Equal("audio_1/1.ts", mpl.Segments[0].URI)
+	}
+
+	// Tracks are only updated when they change
+	alts := master.Variants[0].Alternatives
+	c.SetAudioTracks(append([]AudioTrack{}, tracks...))
+	assert.Equal(alts, master.Variants[0].Alternatives)
+	c.SetAudioTracks(tracks[:1])
+	for _, v := range master.Variants {
+		assert.Empty(v.Audio)
+		assert.Empty(v.Alternatives)
+	}
+}
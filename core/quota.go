@@ -0,0 +1,232 @@
+package core
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQuotaUnknownKey is returned for streams created without an API key that has a quota
+	ErrQuotaUnknownKey = errors.New("unknown API key")
+	// ErrQuotaStreams is returned for streams that exceed the concurrent streams of a quota
+	ErrQuotaStreams = errors.New("quota of concurrent streams exceeded")
+	// ErrQuotaMinutes is returned for streams whose API key used its minutes of the day
+	ErrQuotaMinutes = errors.New("quota of minutes per day exceeded")
+	// ErrQuotaSpend is returned for streams whose API key used its spend of the day
+	ErrQuotaSpend = errors.New("quota of spend per day exceeded")
+)
+
+// Quota limits the streams created with an API key. Limits that are 0 or nil are not enforced
+type Quota struct {
+	MaxStreams       int
+	MaxMinutesPerDay float64
+	// MaxSpendPerDay is the maximum EV of the tickets sent for the streams in a day, in wei
+	MaxSpendPerDay *big.Rat
+}
+
+// QuotaStatus is a quota and the usage of its API key. Minutes and spend are counted per UTC day
+type QuotaStatus struct {
+	APIKey  string
+	Quota   Quota
+	Streams int
+	Minutes float64
+	Spend   *big.Rat
+}
+
+type quotaUsage struct {
+	day     string
+	streams int
+	minutes float64
+	spend   *big.Rat
+}
+
+// StreamQuotas enforces the quotas of the API keys that streams are created with. Usage is kept
+// in memory, so the minutes and spend of the day are counted from zero after a restart
+type StreamQuotas struct {
+	mu      sync.Mutex
+	quotas  map[string]*Quota
+	usage   map[string]*quotaUsage
+	streams map[ManifestID]string
+	now     func() time.Time
+}
+
+// NewStreamQuotas creates a StreamQuotas with the given quotas by API key
+func NewStreamQuotas(quotas map[string]Quota) *StreamQuotas {
+	q := &StreamQuotas{
+		quotas:  make(map[string]*Quota),
+		usage:   make(map[string]*quotaUsage),
+		streams: make(map[ManifestID]string),
+		now:     time.Now,
+	}
+	for key, quota := range quotas {
+		q.SetQuota(key, quota)
+	}
+	return q
+}
+
+// SetQuota adds or replaces the quota of an API key. Streams that were started with the key
+// keep running if they exceed the new quota
+func (q *StreamQuotas) SetQuota(key string, quota Quota) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if quota.MaxSpendPerDay != nil {
+		quota.MaxSpendPerDay = new(big.Rat).Set(quota.MaxSpendPerDay)
+	}
+	q.quotas[key] = &quota
+}
+
+// RemoveQuota removes the quota of an API key, which can no longer start streams. Returns
+// whether the key had a quota
+func (q *StreamQuotas) RemoveQuota(key string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, ok := q.quotas[key]
+	delete(q.quotas, key)
+	return ok
+}
+
+// Quotas returns the quotas by API key
+func (q *StreamQuotas) Quotas() map[string]Quota {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	quotas := make(map[string]Quota, len(q.quotas))
+	for key, quota := range q.quotas {
+		quotas[key] = *quota
+	}
+	return quotas
+}
+
+// Status returns the quota and usage of an API key, or false if it has no quota
+func (q *StreamQuotas) Status(key string) (QuotaStatus, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.quotas[key]; !ok {
+		return QuotaStatus{}, false
+	}
+	return q.status(key), true
+}
+
+// Statuses returns the quota and usage of every API key, sorted by key
+func (q *StreamQuotas) Statuses() []QuotaStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	statuses := make([]QuotaStatus, 0, len(q.quotas))
+	for key := range q.quotas {
+		statuses = append(statuses, q.status(key))
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].APIKey < statuses[j].APIKey })
+	return statuses
+}
+
+// status must be called with the lock held
+func (q *StreamQuotas) status(key string) QuotaStatus {
+	u := q.usageOf(key)
+	return QuotaStatus{
+		APIKey:  key,
+		Quota:   *q.quotas[key],
+		Streams: u.streams,
+		Minutes: u.minutes,
+		Spend:   new(big.Rat).Set(u.spend),
+	}
+}
+
+// StartStream counts a stream created with an API key against its quota, or returns an error if
+// the key has no quota or reached one of its limits
+func (q *StreamQuotas) StartStream(key string, mid ManifestID) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	quota, ok := q.quotas[key]
+	if !ok {
+		return ErrQuotaUnknownKey
+	}
+	if _, ok := q.streams[mid]; ok {
+		return nil
+	}
+	u := q.usageOf(key)
+	if quota.MaxStreams > 0 && u.streams >= quota.MaxStreams {
+		return ErrQuotaStreams
+	}
+	if err := exhausted(quota, u); err != nil {
+		return err
+	}
+	u.streams++
+	q.streams[mid] = key
+	return nil
+}
+
+// EndStream stops counting a stream against the quota of its API key
+func (q *StreamQuotas) EndStream(mid ManifestID) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	key, ok := q.streams[mid]
+	if !ok {
+		return
+	}
+	delete(q.streams, mid)
+	if u := q.usage[key]; u != nil && u.streams > 0 {
+		u.streams--
+	}
+}
+
+// Segment counts a segment of a stream against the minutes of its API key, or returns an error
+// if the key already used its minutes or spend of the day. Segments of streams that are not
+// counted against a quota are always allowed
+func (q *StreamQuotas) Segment(mid ManifestID, duration time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	key, ok := q.streams[mid]
+	if !ok {
+		return nil
+	}
+	u := q.usageOf(key)
+	if quota, ok := q.quotas[key]; ok {
+		if err := exhausted(quota, u); err != nil {
+			return err
+		}
+	}
+	u.minutes += duration.Minutes()
+	return nil
+}
+
+// Spend counts the EV of the tickets sent for a stream against the spend of its API key
+func (q *StreamQuotas) Spend(mid ManifestID, ev *big.Rat) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	key, ok := q.streams[mid]
+	if !ok {
+		return
+	}
+	u := q.usageOf(key)
+	u.spend.Add(u.spend, ev)
+}
+
+// usageOf returns the usage of an API key for the current day. Must be called with the lock held
+func (q *StreamQuotas) usageOf(key string) *quotaUsage {
+	day := q.now().UTC().Format("2006-01-02")
+	u, ok := q.usage[key]
+	if !ok {
+		u = &quotaUsage{day: day, spend: new(big.Rat)}
+		q.usage[key] = u
+	}
+	if u.day != day {
+		u.day, u.minutes, u.spend = day, 0, new(big.Rat)
+	}
+	return u
+}
+
+func exhausted(quota *Quota, u *quotaUsage) error {
+	if quota.MaxMinutesPerDay > 0 && u.minutes >= quota.MaxMinutesPerDay {
+		return ErrQuotaMinutes
+	}
+	if quota.MaxSpendPerDay != nil && quota.MaxSpendPerDay.Sign() > 0 && u.spend.Cmp(quota.MaxSpendPerDay) >= 0 {
+		return ErrQuotaSpend
+	}
+	return nil
+}
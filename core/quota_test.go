@@ -0,0 +1,93 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamQuotas_Streams(t *testing.T) {
+	assert := assert.New(t)
+
+	q := NewStreamQuotas(map[string]Quota{"foo": {MaxStreams: 2}, "bar": {}})
+
+	assert.Equal(ErrQuotaUnknownKey, q.StartStream("", "s0"))
+	assert.Equal(ErrQuotaUnknownKey, q.StartStream("baz", "s0"))
+
+	assert.Nil(q.StartStream("foo", "s1"))
+	assert.Nil(q.StartStream("foo", "s2"))
+	assert.Equal(ErrQuotaStreams, q.StartStream("foo", "s3"))
+	// Streams that are already counted are not counted again
+	assert.Nil(q.StartStream("foo", "s2"))
+
+	// Streams are not limited without a limit
+	for i := 0; i < 10; i++ {
+		assert.Nil(q.StartStream("bar", ManifestID(string(rune('a'+i)))))
+	}
+
+	q.EndStream("s1")
+	q.EndStream("s1")
+	q.EndStream("unknown")
+	st, ok := q.Status("foo")
+	assert.True(ok)
+	assert.Equal(1, st.Streams)
+	assert.Nil(q.StartStream("foo", "s3"))
+	assert.Equal(ErrQuotaStreams, q.StartStream("foo", "s4"))
+
+	// Removed keys can no longer start streams
+	assert.True(q.RemoveQuota("foo"))
+	assert.False(q.RemoveQuota("foo"))
+	assert.Equal(ErrQuotaUnknownKey, q.StartStream("foo", "s4"))
+	_, ok = q.Status("foo")
+	assert.False(ok)
+}
+
+func TestStreamQuotas_MinutesAndSpend(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	now := time.Date(2020, 1, 1, 23, 0, 0, 0, time.UTC)
+	q := NewStreamQuotas(map[string]Quota{
+		"minutes": {MaxMinutesPerDay: 1},
+		"spend":   {MaxSpendPerDay: big.NewRat(100, 1)},
+	})
+	q.now = func() time.Time { return now }
+
+	require.Nil(q.StartStream("minutes", "m1"))
+	require.Nil(q.StartStream("spend", "s1"))
+
+	// Segments are allowed until the minutes are used
+	assert.Nil(q.Segment("m1", 30*time.Second))
+	assert.Nil(q.Segment("m1", 40*time.Second))
+	assert.Equal(ErrQuotaMinutes, q.Segment("m1", 2*time.Second))
+	assert.Equal(ErrQuotaMinutes, q.StartStream("minutes", "m2"))
+	st, _ := q.Status("minutes")
+	assert.InDelta(70.0/60, st.Minutes, 1e-9)
+
+	// Segments are allowed until the spend is used
+	q.Spend("s1", big.NewRat(60, 1))
+	assert.Nil(q.Segment("s1", 2*time.Second))
+	q.Spend("s1", big.NewRat(40, 1))
+	assert.Equal(ErrQuotaSpend, q.Segment("s1", 2*time.Second))
+	assert.Equal(ErrQuotaSpend, q.StartStream("spend", "s2"))
+
+	// Segments and spend of streams without a quota are not counted
+	assert.Nil(q.Segment("other", time.Hour))
+	q.Spend("other", big.NewRat(1000, 1))
+
+	// Minutes and spend are counted from zero the next day
+	now = now.Add(2 * time.Hour)
+	assert.Nil(q.Segment("m1", 2*time.Second))
+	assert.Nil(q.Segment("s1", 2*time.Second))
+	statuses := q.Statuses()
+	require.Len(statuses, 2)
+	assert.Equal("minutes", statuses[0].APIKey)
+	assert.InDelta(2.0/60, statuses[0].Minutes, 1e-9)
+	assert.Equal(1, statuses[0].Streams)
+	assert.Equal("spend", statuses[1].APIKey)
+	assert.Zero(statuses[1].Spend.Sign())
+	assert.Equal(big.NewRat(100, 1), statuses[1].Quota.MaxSpendPerDay)
+}
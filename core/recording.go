@@ -0,0 +1,255 @@
+package core
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/drivers"
+	ffmpeg "github.com/livepeer/lpms/ffmpeg"
+)
+
+// Formats of the VOD playlists that are written when a recording is finalized
+const (
+	RecordingFormatHLS  = "hls"
+	RecordingFormatDASH = "dash"
+)
+
+// Names of the VOD master playlist and manifest in the storage of a recording
+const (
+	RecordingHLSMaster    = "index.m3u8"
+	RecordingDASHManifest = "index.mpd"
+)
+
+var ErrRecording = errors.New("ErrRecording")
+
+// ParseRecordingFormats parses a comma separated list of recording formats
+func ParseRecordingFormats(formats string) ([]string, error) {
+	var res []string
+	for _, f := range strings.Split(formats, ",") {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f != RecordingFormatHLS && f != RecordingFormatDASH {
+			return nil, fmt.Errorf("%v: unknown format %q", ErrRecording, f)
+		}
+		res = append(res, f)
+	}
+	return res, nil
+}
+
+type recordedSegment struct {
+	seqNo    uint64
+	uri      string
+	duration float64
+}
+
+type recordedRendition struct {
+	profile  ffmpeg.VideoProfile
+	segments []recordedSegment
+}
+
+// StreamRecording keeps track of every segment of a stream, unlike the live playlists, and
+// writes VOD playlists that reference them to the storage of the stream when it ends
+type StreamRecording struct {
+	storage drivers.OSSession
+	formats []string
+
+	mu         sync.Mutex
+	renditions []*recordedRendition
+	finalized  bool
+	// URIs of the playlists written by Finalize
+	uris map[string]string
+}
+
+// NewStreamRecording creates a recording that writes playlists in the given formats to storage
+func NewStreamRecording(storage drivers.OSSession, formats []string) *StreamRecording {
+	return &StreamRecording{
+		storage: storage,
+		formats: formats,
+		uris:    make(map[string]string),
+	}
+}
+
+// InsertSegment adds a segment that was saved to the storage of the stream to the recording
+func (r *StreamRecording) InsertSegment(profile *ffmpeg.VideoProfile, seqNo uint64, uri string, duration float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.finalized {
+		return fmt.Errorf("%v: recording is already finalized", ErrRecording)
+	}
+	var rend *recordedRendition
+	for _, v := range r.renditions {
+		if v.profile.Name == profile.Name {
+			rend = v
+			break
+		}
+	}
+	if rend == nil {
+		rend = &recordedRendition{profile: *profile}
+		r.renditions = append(r.renditions, rend)
+	}
+	// Segments may be transcoded out of order or retried
+	i := sort.Search(len(rend.segments), func(i int) bool { return rend.segments[i].seqNo >= seqNo })
+	seg := recordedSegment{seqNo: seqNo, uri: uri, duration: duration}
+	if i < len(rend.segments) && rend.segments[i].seqNo == seqNo {
+		rend.segments[i] = seg
+		return nil
+	}
+	rend.segments = append(rend.segments, recordedSegment{})
+	copy(rend.segments[i+1:], rend.segments[i:])
+	rend.segments[i] = seg
+	return nil
+}
+
+// Finalize writes the VOD playlists of the recording to its storage. No segments can be
+// added to the recording afterwards
+func (r *StreamRecording) Finalize() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.finalized {
+		return fmt.Errorf("%v: recording is already finalized", ErrRecording)
+	}
+	r.finalized = true
+	if len(r.renditions) == 0 {
+		return nil
+	}
+	for _, f := range r.formats {
+		switch f {
+		case RecordingFormatHLS:
+			for _, rend := range r.renditions {
+				if err := r.save(rend.profile.Name+".m3u8", encodeVODMediaPlaylist(rend)); err != nil {
+					return err
+				}
+			}
+			if err := r.save(RecordingHLSMaster, r.encodeVODMasterPlaylist()); err != nil {
+				return err
+			}
+		case RecordingFormatDASH:
+			if err := r.save(RecordingDASHManifest, r.encodeVODManifest()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// URI returns the URI of a playlist written by Finalize, or an empty string if it wasn't written
+func (r *StreamRecording) URI(name string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.uris[name]
+}
+
+// Caller of this function should hold the mu lock
+func (r *StreamRecording) save(name string, buf *bytes.Buffer) error {
+	uri, err := r.storage.SaveData(name, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	r.uris[name] = uri
+	return nil
+}
+
+// Caller of this function should hold the mu lock
+func (r *StreamRecording) encodeVODMasterPlaylist() *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	buf.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, rend := range r.renditions {
+		buf.WriteString("#EXT-X-STREAM-INF:PROGRAM-ID=1,BANDWIDTH=" + strconv.Itoa(profileBandwidth(&rend.profile)))
+		if rend.profile.Resolution != "" {
+			buf.WriteString(",RESOLUTION=" + rend.profile.Resolution)
+		}
+		buf.WriteString("\n" + rend.profile.Name + ".m3u8\n")
+	}
+	return buf
+}
+
+func encodeVODMediaPlaylist(rend *recordedRendition) *bytes.Buffer {
+	var maxDuration float64
+	for _, seg := range rend.segments {
+		maxDuration = math.Max(maxDuration, seg.duration)
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-PLAYLIST-TYPE:VOD\n")
+	buf.WriteString("#EXT-X-TARGETDURATION:" + strconv.FormatUint(uint64(math.Ceil(maxDuration)), 10) + "\n")
+	buf.WriteString("#EXT-X-MEDIA-SEQUENCE:" + strconv.FormatUint(rend.segments[0].seqNo, 10) + "\n")
+	for i, seg := range rend.segments {
+		// Segments that failed to transcode leave gaps in the renditions
+		if i > 0 && seg.seqNo != rend.segments[i-1].seqNo+1 {
+			buf.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		buf.WriteString("#EXTINF:" + formatHLSDuration(seg.duration) + ",\n")
+		buf.WriteString(seg.uri + "\n")
+	}
+	buf.WriteString("#EXT-X-ENDLIST\n")
+	return buf
+}
+
+// Caller of this function should hold the mu lock
+func (r *StreamRecording) encodeVODManifest() *bytes.Buffer {
+	// Segments that failed to transcode leave gaps in the renditions so the start of every
+	// segment is derived from the durations of all the segments before it in any rendition.
+	// Durations are in milliseconds
+	durations := make(map[uint64]int64)
+	var seqNos []uint64
+	for _, rend := range r.renditions {
+		for _, seg := range rend.segments {
+			if _, ok := durations[seg.seqNo]; !ok {
+				seqNos = append(seqNos, seg.seqNo)
+				durations[seg.seqNo] = int64(math.Round(seg.duration * 1000))
+			}
+		}
+	}
+	sort.Slice(seqNos, func(i, j int) bool { return seqNos[i] < seqNos[j] })
+	starts := make(map[uint64]int64)
+	var total int64
+	for _, seqNo := range seqNos {
+		starts[seqNo] = total
+		total += durations[seqNo]
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	buf.WriteString(`<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:mp2t-simple:2011" type="static" minBufferTime="PT2S" mediaPresentationDuration="` + formatDASHDuration(float64(total)/1000) + `">` + "\n")
+	buf.WriteString("<Period>\n")
+	buf.WriteString(`<AdaptationSet mimeType="video/mp2t" segmentAlignment="true">` + "\n")
+	for _, rend := range r.renditions {
+		buf.WriteString(`<Representation id="` + rend.profile.Name + `" bandwidth="` + strconv.Itoa(profileBandwidth(&rend.profile)) + `"`)
+		if res := strings.Split(rend.profile.Resolution, "x"); len(res) == 2 {
+			buf.WriteString(` width="` + res[0] + `" height="` + res[1] + `"`)
+		}
+		buf.WriteString(">\n")
+		buf.WriteString(`<SegmentList timescale="1000">` + "\n<SegmentTimeline>\n")
+		for _, seg := range rend.segments {
+			buf.WriteString(`<S t="` + strconv.FormatInt(starts[seg.seqNo], 10) + `" d="` + strconv.FormatInt(int64(math.Round(seg.duration*1000)), 10) + `"/>` + "\n")
+		}
+		buf.WriteString("</SegmentTimeline>\n")
+		for _, seg := range rend.segments {
+			buf.WriteString(`<SegmentURL media="`)
+			xml.EscapeText(buf, []byte(seg.uri))
+			buf.WriteString(`"/>` + "\n")
+		}
+		buf.WriteString("</SegmentList>\n</Representation>\n")
+	}
+	buf.WriteString("</AdaptationSet>\n</Period>\n</MPD>\n")
+	return buf
+}
+
+func profileBandwidth(p *ffmpeg.VideoProfile) int {
+	bitrate, err := common.ParseBitrate(p.Bitrate)
+	if err != nil {
+		return 0
+	}
+	return bitrate
+}
+
+func formatDASHDuration(d float64) string {
+	return "PT" + strconv.FormatFloat(d, 'f', 3, 64) + "S"
+}
@@ -0,0 +1,162 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/livepeer/go-livepeer/net"
+	ffmpeg "github.com/livepeer/lpms/ffmpeg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubRecordingStorage keeps the data saved to it after the session ended
+type stubRecordingStorage struct {
+	data  map[string][]byte
+	ended bool
+}
+
+func newStubRecordingStorage() *stubRecordingStorage {
+	return &stubRecordingStorage{data: make(map[string][]byte)}
+}
+
+func (s *stubRecordingStorage) SaveData(name string, data []byte) (string, error) {
+	s.data[name] = data
+	return "https://os/mid/" + name, nil
+}
+func (s *stubRecordingStorage) EndSession()                { s.ended = true }
+func (s *stubRecordingStorage) GetInfo() *net.OSInfo       { return nil }
+func (s *stubRecordingStorage) IsExternal() bool           { return true }
+func (s *stubRecordingStorage) GetData(name string) []byte { return s.data[name] }
+
+var (
+	testRecordingSource = ffmpeg.VideoProfile{Name: "source", Bitrate: "4000k", Resolution: "1280x720"}
+	testRecordingP240p  = ffmpeg.VideoProfile{Name: "P240p", Bitrate: "600k", Resolution: "426x240"}
+)
+
+func TestParseRecordingFormats(t *testing.T) {
+	assert := assert.New(t)
+
+	formats, err := ParseRecordingFormats("hls")
+	assert.Nil(err)
+	assert.Equal([]string{RecordingFormatHLS}, formats)
+
+	formats, err = ParseRecordingFormats(" HLS, dash")
+	assert.Nil(err)
+	assert.Equal([]string{RecordingFormatHLS, RecordingFormatDASH}, formats)
+
+	_, err = ParseRecordingFormats("hls,mp4")
+	assert.EqualError(err, `ErrRecording: unknown format "mp4"`)
+	_, err = ParseRecordingFormats("")
+	assert.NotNil(err)
+}
+
+func TestStreamRecording_HLS(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	storage := newStubRecordingStorage()
+	r := NewStreamRecording(storage, []string{RecordingFormatHLS})
+
+	// Segments are sorted and retried segments replace the previous ones
+	require.Nil(r.InsertSegment(&testRecordingSource, 2, "https://os/mid/source/2.ts", 2.5))
+	require.Nil(r.InsertSegment(&testRecordingSource, 1, "https://os/mid/source/1.ts", 2))
+	require.Nil(r.InsertSegment(&testRecordingP240p, 1, "https://os/mid/a/P240p/1.ts", 2))
+	require.Nil(r.InsertSegment(&testRecordingSource, 3, "https://os/mid/source/3.ts", 1))
+	require.Nil(r.InsertSegment(&testRecordingP240p, 3, "https://os/mid/a/P240p/3.ts", 1))
+	require.Nil(r.InsertSegment(&testRecordingP240p, 3, "https://os/mid/b/P240p/3.ts", 1))
+
+	require.Nil(r.Finalize())
+	assert.Equal("#EXTM3U\n#EXT-X-VERSION:3\n"+
+		"#EXT-X-STREAM-INF:PROGRAM-ID=1,BANDWIDTH=4000000,RESOLUTION=1280x720\nsource.m3u8\n"+
+		"#EXT-X-STREAM-INF:PROGRAM-ID=1,BANDWIDTH=600000,RESOLUTION=426x240\nP240p.m3u8\n",
+		string(storage.GetData(RecordingHLSMaster)))
+	assert.Equal("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXT-X-TARGETDURATION:3\n#EXT-X-MEDIA-SEQUENCE:1\n"+
+		"#EXTINF:2.000,\nhttps://os/mid/source/1.ts\n"+
+		"#EXTINF:2.500,\nhttps://os/mid/source/2.ts\n"+
+		"#EXTINF:1.000,\nhttps://os/mid/source/3.ts\n"+
+		"#EXT-X-ENDLIST\n",
+		string(storage.GetData("source.m3u8")))
+	// Missing segments are marked as discontinuities
+	assert.Equal("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXT-X-TARGETDURATION:2\n#EXT-X-MEDIA-SEQUENCE:1\n"+
+		"#EXTINF:2.000,\nhttps://os/mid/a/P240p/1.ts\n"+
+		"#EXT-X-DISCONTINUITY\n"+
+		"#EXTINF:1.000,\nhttps://os/mid/b/P240p/3.ts\n"+
+		"#EXT-X-ENDLIST\n",
+		string(storage.GetData("P240p.m3u8")))
+	assert.Nil(storage.GetData(RecordingDASHManifest))
+	assert.Equal("https://os/mid/"+RecordingHLSMaster, r.URI(RecordingHLSMaster))
+	assert.Empty(r.URI(RecordingDASHManifest))
+
+	// Recordings are only finalized once
+	assert.EqualError(r.Finalize(), "ErrRecording: recording is already finalized")
+	assert.EqualError(r.InsertSegment(&testRecordingSource, 4, "https://os/mid/source/4.ts", 1), "ErrRecording: recording is already finalized")
+}
+
+func TestStreamRecording_DASH(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	storage := newStubRecordingStorage()
+	r := NewStreamRecording(storage, []string{RecordingFormatDASH})
+	require.Nil(r.InsertSegment(&testRecordingSource, 1, "https://os/mid/source/1.ts", 2))
+	require.Nil(r.InsertSegment(&testRecordingSource, 2, "https://os/mid/source/2.ts?a=1&b=2", 2.5))
+	require.Nil(r.InsertSegment(&testRecordingP240p, 2, "https://os/mid/P240p/2.ts", 2.5))
+
+	require.Nil(r.Finalize())
+	assert.Nil(storage.GetData(RecordingHLSMaster))
+	// Segments start at the same time in every rendition
+	assert.Equal(`<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:mp2t-simple:2011" type="static" minBufferTime="PT2S" mediaPresentationDuration="PT4.500S">
+<Period>
+<AdaptationSet mimeType="video/mp2t" segmentAlignment="true">
+<Representation id="source" bandwidth="4000000" width="1280" height="720">
+<SegmentList timescale="1000">
+<SegmentTimeline>
+<S t="0" d="2000"/>
+<S t="2000" d="2500"/>
+</SegmentTimeline>
+<SegmentURL media="https://os/mid/source/1.ts"/>
+<SegmentURL media="https://os/mid/source/2.ts?a=1&amp;b=2"/>
+</SegmentList>
+</Representation>
+<Representation id="P240p" bandwidth="600000" width="426" height="240">
+<SegmentList timescale="1000">
+<SegmentTimeline>
+<S t="2000" d="2500"/>
+</SegmentTimeline>
+<SegmentURL media="https://os/mid/P240p/2.ts"/>
+</SegmentList>
+</Representation>
+</AdaptationSet>
+</Period>
+</MPD>
+`, string(storage.GetData(RecordingDASHManifest)))
+}
+
+func TestStreamRecording_Empty(t *testing.T) {
+	assert := assert.New(t)
+
+	storage := newStubRecordingStorage()
+	r := NewStreamRecording(storage, []string{RecordingFormatHLS, RecordingFormatDASH})
+	assert.Nil(r.Finalize())
+	assert.Nil(storage.GetData(RecordingHLSMaster))
+}
+
+func TestPlaylistManager_Record(t *testing.T) {
+	assert := assert.New(t)
+
+	storage := newStubRecordingStorage()
+	c := NewBasicPlaylistManager("mid", storage)
+	c.Record([]string{RecordingFormatHLS})
+	for i := uint64(0); i < uint64(LIVE_LIST_LENGTH)+2; i++ {
+		assert.Nil(c.InsertHLSSegment(&testRecordingSource, i, "https://os/mid/source.ts", 1))
+	}
+	c.Cleanup()
+	assert.True(storage.ended)
+
+	// The recording has every segment, not only the ones of the live playlist
+	data := string(storage.GetData("source.m3u8"))
+	assert.Contains(data, "#EXT-X-MEDIA-SEQUENCE:0\n")
+	assert.Equal(int(LIVE_LIST_LENGTH+2), strings.Count(data, "#EXTINF:"))
+}
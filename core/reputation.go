@@ -0,0 +1,249 @@
+package core
+
+import (
+	"math"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/livepeer/go-livepeer/common"
+)
+
+// Number of recent latencies and prices kept for each orchestrator
+const (
+	maxReputationLatencies = 100
+	maxReputationPrices    = 20
+)
+
+// Weight of the rate of verification failures in the reputation score, as a single failure is
+// much more serious than a failed segment
+const verificationFailureWeight = 10
+
+// Lowest reputation score, so that orchestrators with a bad reputation can still be selected
+// once in a while and recover
+const minReputationScore = 0.01
+
+// OrchestratorReputationInfo summarizes the reputation of an orchestrator for operators
+type OrchestratorReputationInfo struct {
+	Orchestrator         string               `json:"orchestrator"`
+	Score                float64              `json:"score"`
+	Segments             int64                `json:"segments"`
+	Failures             int64                `json:"failures"`
+	VerificationFailures int64                `json:"verificationFailures"`
+	LatencyP50Ms         int64                `json:"latencyP50Ms"`
+	LatencyP90Ms         int64                `json:"latencyP90Ms"`
+	LatencyP99Ms         int64                `json:"latencyP99Ms"`
+	Prices               []common.DBOrchPrice `json:"prices"`
+}
+
+// OrchestratorReputation keeps the statistics of the segments that the broadcaster sent to
+// orchestrators in the node DB, so that they outlive restarts, and scores orchestrators with them.
+// The score is between 0 and 1: it drops with the share of failed segments and of segments that
+// failed the verification, and with a 90th percentile latency above the target latency
+type OrchestratorReputation struct {
+	db            *common.DB
+	targetLatency time.Duration
+
+	mu    sync.Mutex
+	stats map[string]*common.DBOrchStats
+	// Orchestrators whose stats changed since they were last stored
+	dirty map[string]bool
+	quit  chan struct{}
+}
+
+// NewOrchestratorReputation loads the statistics of the orchestrators from the DB. The latency of
+// orchestrators is not scored if targetLatency is 0
+func NewOrchestratorReputation(db *common.DB, targetLatency time.Duration) (*OrchestratorReputation, error) {
+	stats, err := db.OrchestratorStats()
+	if err != nil {
+		return nil, err
+	}
+	r := &OrchestratorReputation{
+		db:            db,
+		targetLatency: targetLatency,
+		stats:         make(map[string]*common.DBOrchStats),
+		dirty:         make(map[string]bool),
+		quit:          make(chan struct{}),
+	}
+	for _, s := range stats {
+		r.stats[s.Orchestrator] = s
+	}
+	return r, nil
+}
+
+// Success records a segment that the orchestrator at uri transcoded with the given latency
+func (r *OrchestratorReputation) Success(uri string, latency time.Duration) {
+	r.update(uri, func(s *common.DBOrchStats) {
+		s.Segments++
+		s.LatenciesMs = append(s.LatenciesMs, int64(latency/time.Millisecond))
+		if len(s.LatenciesMs) > maxReputationLatencies {
+			s.LatenciesMs = s.LatenciesMs[len(s.LatenciesMs)-maxReputationLatencies:]
+		}
+	})
+}
+
+// Failure records a segment that failed on the orchestrator at uri
+func (r *OrchestratorReputation) Failure(uri string) {
+	r.update(uri, func(s *common.DBOrchStats) { s.Failures++ })
+}
+
+// VerificationFailure records a segment of the orchestrator at uri that failed the verification
+func (r *OrchestratorReputation) VerificationFailure(uri string) {
+	r.update(uri, func(s *common.DBOrchStats) { s.VerificationFailures++ })
+}
+
+// ObservePrice records the price per pixel advertised by the orchestrator at uri if it changed
+func (r *OrchestratorReputation) ObservePrice(uri string, price *big.Rat) {
+	if price == nil {
+		return
+	}
+	p := price.RatString()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.get(uri)
+	if n := len(s.Prices); n > 0 && s.Prices[n-1].PricePerPixel == p {
+		return
+	}
+	s.Prices = append(s.Prices, common.DBOrchPrice{PricePerPixel: p, Time: time.Now().Unix()})
+	if len(s.Prices) > maxReputationPrices {
+		s.Prices = s.Prices[len(s.Prices)-maxReputationPrices:]
+	}
+	r.dirty[uri] = true
+}
+
+func (r *OrchestratorReputation) update(uri string, f func(s *common.DBOrchStats)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f(r.get(uri))
+	r.dirty[uri] = true
+}
+
+// get returns the stats of an orchestrator. Must be called with the lock held
+func (r *OrchestratorReputation) get(uri string) *common.DBOrchStats {
+	s, ok := r.stats[uri]
+	if !ok {
+		s = &common.DBOrchStats{Orchestrator: uri}
+		r.stats[uri] = s
+	}
+	return s
+}
+
+// Score returns the reputation score of the orchestrator at uri. Orchestrators that were not
+// sent any segment yet have a score of 1
+func (r *OrchestratorReputation) Score(uri string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.stats[uri]
+	if !ok {
+		return 1
+	}
+	return r.score(s)
+}
+
+func (r *OrchestratorReputation) score(s *common.DBOrchStats) float64 {
+	score := float64(s.Segments+1) / float64(s.Segments+s.Failures+1)
+	score /= 1 + verificationFailureWeight*float64(s.VerificationFailures)/float64(s.Segments+1)
+	if r.targetLatency > 0 {
+		if p90 := percentile(s.LatenciesMs, 0.9); p90 > int64(r.targetLatency/time.Millisecond) {
+			score *= float64(r.targetLatency/time.Millisecond) / float64(p90)
+		}
+	}
+	return math.Max(score, minReputationScore)
+}
+
+// Reputations returns the reputation of every known orchestrator, best first
+func (r *OrchestratorReputation) Reputations() []OrchestratorReputationInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	infos := make([]OrchestratorReputationInfo, 0, len(r.stats))
+	for _, s := range r.stats {
+		infos = append(infos, OrchestratorReputationInfo{
+			Orchestrator:         s.Orchestrator,
+			Score:                r.score(s),
+			Segments:             s.Segments,
+			Failures:             s.Failures,
+			VerificationFailures: s.VerificationFailures,
+			LatencyP50Ms:         percentile(s.LatenciesMs, 0.5),
+			LatencyP90Ms:         percentile(s.LatenciesMs, 0.9),
+			LatencyP99Ms:         percentile(s.LatenciesMs, 0.99),
+			Prices:               append([]common.DBOrchPrice(nil), s.Prices...),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Score != infos[j].Score {
+			return infos[i].Score > infos[j].Score
+		}
+		return infos[i].Orchestrator < infos[j].Orchestrator
+	})
+	return infos
+}
+
+// percentile returns the nearest-rank percentile p of the latencies, or 0 if there are none
+func percentile(latencies []int64, p float64) int64 {
+	if len(latencies) == 0 {
+		return 0
+	}
+	sorted := append([]int64(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// Flush stores the stats that changed since the last flush in the DB
+func (r *OrchestratorReputation) Flush() error {
+	r.mu.Lock()
+	var dirty []common.DBOrchStats
+	for uri := range r.dirty {
+		s := *r.stats[uri]
+		s.LatenciesMs = append([]int64(nil), s.LatenciesMs...)
+		s.Prices = append([]common.DBOrchPrice(nil), s.Prices...)
+		dirty = append(dirty, s)
+	}
+	r.dirty = make(map[string]bool)
+	r.mu.Unlock()
+
+	var err error
+	for i := range dirty {
+		if serr := r.db.StoreOrchestratorStats(&dirty[i]); serr != nil {
+			// Stored with the next flush
+			r.mu.Lock()
+			r.dirty[dirty[i].Orchestrator] = true
+			r.mu.Unlock()
+			err = serr
+		}
+	}
+	return err
+}
+
+// StartFlushing stores the changed stats in the DB every interval until StopFlushing is called
+func (r *OrchestratorReputation) StartFlushing(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.Flush(); err != nil {
+				glog.Errorf("Unable to store orchestrator stats: %v", err)
+			}
+		case <-r.quit:
+			return
+		}
+	}
+}
+
+// StopFlushing stops the periodic flushes and stores the stats that changed since the last one
+func (r *OrchestratorReputation) StopFlushing() {
+	close(r.quit)
+	if err := r.Flush(); err != nil {
+		glog.Errorf("Unable to store orchestrator stats: %v", err)
+	}
+}
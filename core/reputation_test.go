@@ -0,0 +1,169 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/common"
+)
+
+func TestPercentile(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(int64(0), percentile(nil, 0.5))
+	assert.Equal(int64(7), percentile([]int64{7}, 0.99))
+
+	latencies := []int64{10, 1, 9, 2, 8, 3, 7, 4, 6, 5}
+	assert.Equal(int64(5), percentile(latencies, 0.5))
+	assert.Equal(int64(9), percentile(latencies, 0.9))
+	assert.Equal(int64(10), percentile(latencies, 0.99))
+	assert.Equal(int64(1), percentile(latencies, 0))
+	// The latencies are not reordered
+	assert.Equal(int64(10), latencies[0])
+}
+
+func TestOrchestratorReputation_Score(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	db, dbraw, err := common.TempDB(t)
+	require.Nil(err)
+	defer db.Close()
+	defer dbraw.Close()
+
+	r, err := NewOrchestratorReputation(db, time.Second)
+	require.Nil(err)
+
+	// Unknown orchestrators are fully trusted
+	assert.Equal(1.0, r.Score("foo"))
+
+	for i := 0; i < 9; i++ {
+		r.Success("foo", 500*time.Millisecond)
+	}
+	assert.Equal(1.0, r.Score("foo"))
+
+	// Failures lower the score
+	r.Failure("foo")
+	assert.InDelta(10.0/11, r.Score("foo"), 1e-9)
+
+	// Verification failures lower the score more
+	r.VerificationFailure("foo")
+	assert.InDelta(10.0/11/2, r.Score("foo"), 1e-9)
+
+	// Latencies above the target lower the score
+	r.Success("bar", 4*time.Second)
+	assert.InDelta(0.25, r.Score("bar"), 1e-9)
+	noLatency, err := NewOrchestratorReputation(db, 0)
+	require.Nil(err)
+	noLatency.Success("bar", 4*time.Second)
+	assert.Equal(1.0, noLatency.Score("bar"))
+
+	// Scores don't drop to 0
+	for i := 0; i < 100; i++ {
+		r.VerificationFailure("baz")
+	}
+	assert.Equal(minReputationScore, r.Score("baz"))
+
+	// Only the most recent latencies are kept
+	for i := 0; i < maxReputationLatencies+10; i++ {
+		r.Success("qux", time.Duration(i)*time.Millisecond)
+	}
+	infos := r.Reputations()
+	require.Len(infos, 4)
+	assert.Equal("qux", infos[0].Orchestrator)
+	assert.Equal(int64(maxReputationLatencies+10), infos[0].Segments)
+	assert.Equal(int64(59), infos[0].LatencyP50Ms)
+	assert.Equal(int64(99), infos[0].LatencyP90Ms)
+	assert.Equal(int64(108), infos[0].LatencyP99Ms)
+	// Reputations are sorted by score
+	assert.Equal("baz", infos[3].Orchestrator)
+}
+
+func TestOrchestratorReputation_Prices(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	db, dbraw, err := common.TempDB(t)
+	require.Nil(err)
+	defer db.Close()
+	defer dbraw.Close()
+
+	r, err := NewOrchestratorReputation(db, 0)
+	require.Nil(err)
+
+	r.ObservePrice("foo", nil)
+	r.ObservePrice("foo", big.NewRat(1, 2))
+	r.ObservePrice("foo", big.NewRat(2, 4))
+	r.ObservePrice("foo", big.NewRat(1, 1))
+	infos := r.Reputations()
+	require.Len(infos, 1)
+	require.Len(infos[0].Prices, 2)
+	assert.Equal("1/2", infos[0].Prices[0].PricePerPixel)
+	assert.Equal("1", infos[0].Prices[1].PricePerPixel)
+
+	// Only the most recent prices are kept
+	for i := 0; i < maxReputationPrices+5; i++ {
+		r.ObservePrice("foo", big.NewRat(int64(i+2), 1))
+	}
+	prices := r.Reputations()[0].Prices
+	require.Len(prices, maxReputationPrices)
+	assert.Equal("7", prices[0].PricePerPixel)
+}
+
+func TestOrchestratorReputation_Flush(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	db, dbraw, err := common.TempDB(t)
+	require.Nil(err)
+	defer db.Close()
+	defer dbraw.Close()
+
+	r, err := NewOrchestratorReputation(db, time.Second)
+	require.Nil(err)
+	r.Success("foo", 100*time.Millisecond)
+	r.Failure("foo")
+	r.VerificationFailure("bar")
+	r.ObservePrice("bar", big.NewRat(3, 1))
+
+	// Stats are only stored once flushed
+	stats, err := db.OrchestratorStats()
+	require.Nil(err)
+	assert.Empty(stats)
+
+	require.Nil(r.Flush())
+	stats, err = db.OrchestratorStats()
+	require.Nil(err)
+	assert.Len(stats, 2)
+
+	// Stats are loaded on startup
+	loaded, err := NewOrchestratorReputation(db, time.Second)
+	require.Nil(err)
+	assert.Equal(r.Reputations(), loaded.Reputations())
+	assert.Equal(r.Score("foo"), loaded.Score("foo"))
+
+	// Only changed stats are stored with the next flush
+	loaded.Success("foo", 100*time.Millisecond)
+	assert.Len(loaded.dirty, 1)
+	require.Nil(loaded.Flush())
+	assert.Empty(loaded.dirty)
+	stats, err = db.OrchestratorStats()
+	require.Nil(err)
+	for _, s := range stats {
+		if s.Orchestrator == "foo" {
+			assert.Equal(int64(2), s.Segments)
+		}
+	}
+
+	// Pending stats are stored when the flushes stop
+	go loaded.StartFlushing(time.Hour)
+	loaded.Failure("bar")
+	loaded.StopFlushing()
+	reloaded, err := NewOrchestratorReputation(db, time.Second)
+	require.Nil(err)
+	assert.Equal(loaded.Reputations(), reloaded.Reputations())
+}
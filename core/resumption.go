@@ -0,0 +1,131 @@
+package core
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/livepeer/go-livepeer/common"
+)
+
+// StreamResumptionWindow is how long after the transcode loop of a stream ended the
+// broadcaster can resume the stream with its capacity slot and reclaimed credit
+var StreamResumptionWindow = 5 * time.Minute
+
+// ErrStreamResumption is returned for a resumed segment that does not follow the last
+// segment that the broadcaster sent before the interruption
+var ErrStreamResumption = errors.New("resumed segment precedes the interruption")
+
+// streamState tracks a stream transcoded by the orchestrator so that it can be resumed
+type streamState struct {
+	// Sequence number of the last segment transcoded. Accessed atomically
+	lastSeq int64
+	// When the transcode loop of the stream ended. Zero while it runs
+	ended time.Time
+}
+
+// trackStream starts tracking a stream whose transcode loop started. Resumed streams keep
+// their state. Must be called with segmentMutex held
+func (n *LivepeerNode) trackStream(mid ManifestID) {
+	if n.streamStates == nil {
+		n.streamStates = make(map[ManifestID]*streamState)
+	}
+	for id, st := range n.streamStates {
+		if !st.ended.IsZero() && time.Since(st.ended) > StreamResumptionWindow {
+			delete(n.streamStates, id)
+		}
+	}
+	if st, ok := n.streamStates[mid]; ok {
+		st.ended = time.Time{}
+		return
+	}
+	n.streamStates[mid] = &streamState{lastSeq: -1}
+}
+
+// untrackStream records that the transcode loop of a stream ended. Must be called with
+// segmentMutex held
+func (n *LivepeerNode) untrackStream(mid ManifestID) {
+	if st, ok := n.streamStates[mid]; ok {
+		st.ended = time.Now()
+	}
+}
+
+func (n *LivepeerNode) recordSeq(mid ManifestID, seq int64) {
+	n.segmentMutex.RLock()
+	defer n.segmentMutex.RUnlock()
+	if st, ok := n.streamStates[mid]; ok {
+		atomic.StoreInt64(&st.lastSeq, seq)
+	}
+}
+
+// resumeSegmentChan restarts the transcode loop of a stream that ended within
+// StreamResumptionWindow, even if the node is at capacity. Returns the sequence number
+// of the last segment transcoded for the stream and whether the stream was resumed
+func (n *LivepeerNode) resumeSegmentChan(md *SegTranscodingMetadata) (int64, bool, error) {
+	n.segmentMutex.Lock()
+	st, ok := n.streamStates[md.ManifestID]
+	if !ok {
+		n.segmentMutex.Unlock()
+		return 0, false, nil
+	}
+	lastSeq := atomic.LoadInt64(&st.lastSeq)
+	if _, active := n.SegmentChans[md.ManifestID]; active {
+		n.segmentMutex.Unlock()
+		return lastSeq, true, nil
+	}
+	if time.Since(st.ended) > StreamResumptionWindow {
+		delete(n.streamStates, md.ManifestID)
+		n.segmentMutex.Unlock()
+		return 0, false, nil
+	}
+	_, err := n.startSegmentChan(md)
+	sessions := len(n.SegmentChans)
+	n.segmentMutex.Unlock()
+	if err != nil {
+		return 0, false, err
+	}
+	if sessions > n.MaxSessions() {
+		glog.Infof("Resumed stream exceeds capacity manifestID=%s sessions=%d", md.ManifestID, sessions)
+	}
+
+	// The start hooks run synchronously, so they are invoked without holding segmentMutex
+	n.Sessions.Start(md.ManifestID, SessionSourceBroadcaster, md.Profiles)
+	return lastSeq, true, nil
+}
+
+// ResumeStream continues a stream that the broadcaster resumed after its publisher reconnected.
+// A stream that the orchestrator transcoded recently keeps its capacity slot and gets back the
+// credit reclaimed while it was interrupted. Other streams are handled like new streams
+func (orch *orchestrator) ResumeStream(md *SegTranscodingMetadata) error {
+	if md.Resumption == nil {
+		return nil
+	}
+	if md.Seq <= md.Resumption.LastSeq {
+		return ErrStreamResumption
+	}
+
+	lastSeq, resumed, err := orch.node.resumeSegmentChan(md)
+	if err != nil {
+		return err
+	}
+	if !resumed {
+		glog.V(common.DEBUG).Infof("Resumed stream was not transcoded recently manifestID=%s seqNo=%d", md.ManifestID, md.Seq)
+		return nil
+	}
+	// Segments between the last one transcoded here and the resumed one went to other
+	// orchestrators or were lost with the connection
+	var skipped int64
+	if lastSeq < md.Seq {
+		skipped = md.Seq - lastSeq - 1
+	}
+	glog.Infof("Resuming stream manifestID=%s seqNo=%d lastSeq=%d lastTranscodedSeq=%d skipped=%d", md.ManifestID, md.Seq, md.Resumption.LastSeq, lastSeq, skipped)
+
+	if orch.node.Balances != nil {
+		if restored := orch.node.Balances.RestoreReclaimed(md.ManifestID); restored != nil {
+			glog.V(common.DEBUG).Infof("Restored reclaimed credit of resumed stream manifestID=%s amount=%v", md.ManifestID, restored.FloatString(2))
+		}
+	}
+	return nil
+}
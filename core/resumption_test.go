@@ -0,0 +1,101 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+func TestResumeStream(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	n, _ := NewLivepeerNode(nil, "", nil)
+	o := NewOrchestrator(n)
+	md := StubSegTranscodingMetadata()
+	oldTimeout, oldCap := transcodeLoopTimeout, MaxSessions
+	transcodeLoopTimeout, MaxSessions = 100*time.Millisecond, 10
+	defer func() { transcodeLoopTimeout, MaxSessions = oldTimeout, oldCap }()
+
+	// Segments that aren't resumed are ignored
+	assert.Nil(o.ResumeStream(md))
+
+	// Resumed segments must follow the interruption
+	resumed := *md
+	resumed.Seq = 5
+	resumed.Resumption = &net.StreamResumption{LastSeq: 5}
+	assert.Equal(ErrStreamResumption, o.ResumeStream(&resumed))
+
+	// Streams that were not transcoded here are treated as new streams
+	resumed.Resumption.LastSeq = 4
+	assert.Nil(o.ResumeStream(&resumed))
+	assert.Nil(getSegChan(n, md.ManifestID))
+
+	// Transcode a segment and let the loop time out
+	_, err := n.getSegmentChan(md)
+	require.Nil(err)
+	n.recordSeq(md.ManifestID, 3)
+	waitForTranscoderLoopTimeout(n, md.ManifestID)
+	require.Nil(getSegChan(n, md.ManifestID))
+
+	// The node is at capacity for new streams
+	MaxSessions = 0
+	assert.Equal(ErrOrchCap, o.CheckCapacity(md.ManifestID, nil))
+
+	// The resumed stream gets its slot back
+	assert.Nil(o.ResumeStream(&resumed))
+	assert.NotNil(getSegChan(n, md.ManifestID))
+	assert.Nil(o.CheckCapacity(md.ManifestID, nil))
+	n.segmentMutex.RLock()
+	assert.Equal(int64(3), n.streamStates[md.ManifestID].lastSeq)
+	assert.True(n.streamStates[md.ManifestID].ended.IsZero())
+	n.segmentMutex.RUnlock()
+
+	// Streams that ended before the resumption window are treated as new streams
+	waitForTranscoderLoopTimeout(n, md.ManifestID)
+	oldWindow := StreamResumptionWindow
+	StreamResumptionWindow = 0
+	defer func() { StreamResumptionWindow = oldWindow }()
+	assert.Nil(o.ResumeStream(&resumed))
+	assert.Nil(getSegChan(n, md.ManifestID))
+	n.segmentMutex.RLock()
+	_, ok := n.streamStates[md.ManifestID]
+	n.segmentMutex.RUnlock()
+	assert.False(ok)
+}
+
+func TestResumeStream_RestoresReclaimedCredit(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	n, _ := NewLivepeerNode(nil, "", nil)
+	n.Balances = NewBalances(time.Hour)
+	o := NewOrchestrator(n)
+	md := StubSegTranscodingMetadata()
+	oldCap := MaxSessions
+	MaxSessions = 10
+	defer func() { MaxSessions = oldCap }()
+
+	_, err := n.getSegmentChan(md)
+	require.Nil(err)
+
+	n.Balances.Credit(md.ManifestID, big.NewRat(5, 1))
+	n.Balances.SetCreditExpiry(0, ReclaimCredit)
+	n.Balances.reclaimExpired()
+	assert.Zero(big.NewRat(0, 1).Cmp(n.Balances.Balance(md.ManifestID)))
+
+	resumed := *md
+	resumed.Seq = 5
+	resumed.Resumption = &net.StreamResumption{LastSeq: 4}
+	assert.Nil(o.ResumeStream(&resumed))
+	assert.Zero(big.NewRat(5, 1).Cmp(n.Balances.Balance(md.ManifestID)))
+	assert.Nil(o.ReclaimedCredit(md.ManifestID))
+}
@@ -0,0 +1,284 @@
+package core
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/common"
+	ffmpeg "github.com/livepeer/lpms/ffmpeg"
+)
+
+var ErrSessionExists = errors.New("ErrSessionExists")
+var ErrUnknownSession = errors.New("ErrUnknownSession")
+
+// DefaultSessionIdleTimeout is the time without activity after which a session is considered idle
+var DefaultSessionIdleTimeout = 30 * time.Second
+
+// SessionSource describes how a stream entered the node
+type SessionSource string
+
+const (
+	// SessionSourceRTMP is a stream ingested over RTMP
+	SessionSourceRTMP SessionSource = "rtmp"
+	// SessionSourceHTTPPush is a stream ingested with HTTP segment pushes
+	SessionSourceHTTPPush SessionSource = "http"
+	// SessionSourceBroadcaster is a stream received from a broadcaster for transcoding
+	SessionSourceBroadcaster SessionSource = "broadcaster"
+	// SessionSourceVOD is a file submitted as a VOD job
+	SessionSourceVOD SessionSource = "vod"
+	// SessionSourceUDP is an MPEG-TS stream ingested over UDP or RIST
+	SessionSourceUDP SessionSource = "udp"
+	// SessionSourcePull is a stream pulled by the node from a source URL
+	SessionSourcePull SessionSource = "pull"
+)
+
+// StreamSession is a snapshot of the state of an active stream
+type StreamSession struct {
+	ManifestID   ManifestID
+	Source       SessionSource
+	Profiles     []ffmpeg.VideoProfile
+	CreatedAt    time.Time
+	LastActivity time.Time
+	// Components that receive the output or the events of the stream, e.g. its recording
+	Consumers int
+	Idle      bool
+}
+
+// SessionHook is a callback invoked with a snapshot of a session on a lifecycle event
+type SessionHook func(sess StreamSession)
+
+// SessionRegistry tracks the active streams of a node and notifies
+// subscribers when streams start, stop or become idle
+type SessionRegistry struct {
+	mu       sync.RWMutex
+	sessions map[ManifestID]*StreamSession
+
+	hookMu  sync.RWMutex
+	onStart []SessionHook
+	onStop  []SessionHook
+	onIdle  []SessionHook
+
+	idleTimeout time.Duration
+	quit        chan struct{}
+}
+
+// NewSessionRegistry creates a SessionRegistry that considers sessions idle
+// when no activity has been recorded for idleTimeout
+func NewSessionRegistry(idleTimeout time.Duration) *SessionRegistry {
+	return &SessionRegistry{
+		sessions:    make(map[ManifestID]*StreamSession),
+		idleTimeout: idleTimeout,
+		quit:        make(chan struct{}),
+	}
+}
+
+// OnStart registers a hook that is invoked when a session starts
+func (r *SessionRegistry) OnStart(hook SessionHook) {
+	r.hookMu.Lock()
+	defer r.hookMu.Unlock()
+	r.onStart = append(r.onStart, hook)
+}
+
+// OnStop registers a hook that is invoked when a session stops
+func (r *SessionRegistry) OnStop(hook SessionHook) {
+	r.hookMu.Lock()
+	defer r.hookMu.Unlock()
+	r.onStop = append(r.onStop, hook)
+}
+
+// OnIdle registers a hook that is invoked when a session becomes idle
+func (r *SessionRegistry) OnIdle(hook SessionHook) {
+	r.hookMu.Lock()
+	defer r.hookMu.Unlock()
+	r.onIdle = append(r.onIdle, hook)
+}
+
+// Start registers a new session for a ManifestID
+func (r *SessionRegistry) Start(mid ManifestID, source SessionSource, profiles []ffmpeg.VideoProfile) error {
+	r.mu.Lock()
+	if _, ok := r.sessions[mid]; ok {
+		r.mu.Unlock()
+		return ErrSessionExists
+	}
+	now := time.Now()
+	sess := &StreamSession{
+		ManifestID:   mid,
+		Source:       source,
+		Profiles:     append([]ffmpeg.VideoProfile{}, profiles...),
+		CreatedAt:    now,
+		LastActivity: now,
+	}
+	r.sessions[mid] = sess
+	snapshot := sess.copy()
+	r.mu.Unlock()
+
+	glog.V(common.DEBUG).Infof("Started session manifestID=%v source=%v", mid, source)
+	r.runHooks(r.startHooks(), snapshot)
+	return nil
+}
+
+// Stop removes the session for a ManifestID
+func (r *SessionRegistry) Stop(mid ManifestID) error {
+	r.mu.Lock()
+	sess, ok := r.sessions[mid]
+	if !ok {
+		r.mu.Unlock()
+		return ErrUnknownSession
+	}
+	delete(r.sessions, mid)
+	snapshot := sess.copy()
+	r.mu.Unlock()
+
+	glog.V(common.DEBUG).Infof("Stopped session manifestID=%v source=%v", mid, sess.Source)
+	r.runHooks(r.stopHooks(), snapshot)
+	return nil
+}
+
+// Touch records activity for the session of a ManifestID
+func (r *SessionRegistry) Touch(mid ManifestID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if sess, ok := r.sessions[mid]; ok {
+		sess.LastActivity = time.Now()
+		sess.Idle = false
+	}
+}
+
+// SetProfiles updates the profiles of the session of a ManifestID
+func (r *SessionRegistry) SetProfiles(mid ManifestID, profiles []ffmpeg.VideoProfile) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sess, ok := r.sessions[mid]
+	if !ok {
+		return ErrUnknownSession
+	}
+	sess.Profiles = append([]ffmpeg.VideoProfile{}, profiles...)
+	return nil
+}
+
+// AddConsumer increments the number of consumers of the session of a ManifestID
+func (r *SessionRegistry) AddConsumer(mid ManifestID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sess, ok := r.sessions[mid]
+	if !ok {
+		return ErrUnknownSession
+	}
+	sess.Consumers++
+	return nil
+}
+
+// RemoveConsumer decrements the number of consumers of the session of a ManifestID
+func (r *SessionRegistry) RemoveConsumer(mid ManifestID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sess, ok := r.sessions[mid]
+	if !ok {
+		return ErrUnknownSession
+	}
+	if sess.Consumers > 0 {
+		sess.Consumers--
+	}
+	return nil
+}
+
+// Get returns a snapshot of the session of a ManifestID
+func (r *SessionRegistry) Get(mid ManifestID) (StreamSession, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	sess, ok := r.sessions[mid]
+	if !ok {
+		return StreamSession{}, false
+	}
+	return sess.copy(), true
+}
+
+// Sessions returns snapshots of all active sessions
+func (r *SessionRegistry) Sessions() []StreamSession {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	sessions := make([]StreamSession, 0, len(r.sessions))
+	for _, sess := range r.sessions {
+		sessions = append(sessions, sess.copy())
+	}
+	return sessions
+}
+
+// Count returns the number of active sessions
+func (r *SessionRegistry) Count() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.sessions)
+}
+
+// StartIdleCheck runs a loop that invokes the idle hooks for sessions without recent activity
+func (r *SessionRegistry) StartIdleCheck() {
+	ticker := time.NewTicker(r.idleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.checkIdle()
+		case <-r.quit:
+			return
+		}
+	}
+}
+
+// StopIdleCheck stops the idle check loop
+func (r *SessionRegistry) StopIdleCheck() {
+	close(r.quit)
+}
+
+func (r *SessionRegistry) checkIdle() {
+	var idle []StreamSession
+	r.mu.Lock()
+	for _, sess := range r.sessions {
+		if sess.Idle || time.Since(sess.LastActivity) <= r.idleTimeout {
+			continue
+		}
+		// Only notify once until there is new activity
+		sess.Idle = true
+		idle = append(idle, sess.copy())
+	}
+	r.mu.Unlock()
+
+	hooks := r.idleHooks()
+	for _, sess := range idle {
+		glog.V(common.DEBUG).Infof("Session idle manifestID=%v lastActivity=%v", sess.ManifestID, sess.LastActivity)
+		r.runHooks(hooks, sess)
+	}
+}
+
+func (r *SessionRegistry) startHooks() []SessionHook {
+	r.hookMu.RLock()
+	defer r.hookMu.RUnlock()
+	return r.onStart
+}
+
+func (r *SessionRegistry) stopHooks() []SessionHook {
+	r.hookMu.RLock()
+	defer r.hookMu.RUnlock()
+	return r.onStop
+}
+
+func (r *SessionRegistry) idleHooks() []SessionHook {
+	r.hookMu.RLock()
+	defer r.hookMu.RUnlock()
+	return r.onIdle
+}
+
+// Hooks are invoked without holding any registry lock so that they may call back into the registry
+func (r *SessionRegistry) runHooks(hooks []SessionHook, sess StreamSession) {
+	for _, hook := range hooks {
+		hook(sess)
+	}
+}
+
+func (s *StreamSession) copy() StreamSession {
+	c := *s
+	c.Profiles = append([]ffmpeg.VideoProfile{}, s.Profiles...)
+	return c
+}
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	ffmpeg "github.com/livepeer/lpms/ffmpeg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionRegistry_StartStop(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	r := NewSessionRegistry(time.Minute)
+	mid := ManifestID("some manifest id")
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}
+
+	var started, stopped []StreamSession
+	r.OnStart(func(sess StreamSession) { started = append(started, sess) })
+	r.OnStop(func(sess StreamSession) { stopped = append(stopped, sess) })
+
+	require.Nil(r.Start(mid, SessionSourceRTMP, profiles))
+	assert.Equal(ErrSessionExists, r.Start(mid, SessionSourceRTMP, profiles))
+	assert.Equal(1, r.Count())
+	require.Len(started, 1)
+	assert.Equal(mid, started[0].ManifestID)
+	assert.Equal(SessionSourceRTMP, started[0].Source)
+	assert.Equal(profiles, started[0].Profiles)
+
+	sess, ok := r.Get(mid)
+	assert.True(ok)
+	assert.Equal(mid, sess.ManifestID)
+	assert.Len(r.Sessions(), 1)
+
+	require.Nil(r.Stop(mid))
+	assert.Equal(ErrUnknownSession, r.Stop(mid))
+	assert.Equal(0, r.Count())
+	require.Len(stopped, 1)
+	assert.Equal(mid, stopped[0].ManifestID)
+
+	_, ok = r.Get(mid)
+	assert.False(ok)
+}
+
+func TestSessionRegistry_Consumers(t *testing.T) {
+	assert := assert.New(t)
+
+	r := NewSessionRegistry(time.Minute)
+	mid := ManifestID("some manifest id")
+
+	assert.Equal(ErrUnknownSession, r.AddConsumer(mid))
+	assert.Equal(ErrUnknownSession, r.RemoveConsumer(mid))
+
+	r.Start(mid, SessionSourceHTTPPush, nil)
+	assert.Nil(r.AddConsumer(mid))
+	assert.Nil(r.AddConsumer(mid))
+	sess, _ := r.Get(mid)
+	assert.Equal(2, sess.Consumers)
+
+	assert.Nil(r.RemoveConsumer(mid))
+	assert.Nil(r.RemoveConsumer(mid))
+	assert.Nil(r.RemoveConsumer(mid))
+	sess, _ = r.Get(mid)
+	assert.Equal(0, sess.Consumers)
+}
+
+func TestSessionRegistry_SetProfiles(t *testing.T) {
+	assert := assert.New(t)
+
+	r := NewSessionRegistry(time.Minute)
+	mid := ManifestID("some manifest id")
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9}
+
+	assert.Equal(ErrUnknownSession, r.SetProfiles(mid, profiles))
+
+	r.Start(mid, SessionSourceRTMP, nil)
+	assert.Nil(r.SetProfiles(mid, profiles))
+	sess, _ := r.Get(mid)
+	assert.Equal(profiles, sess.Profiles)
+
+	// Snapshots are not affected by later changes
+	profiles[0] = ffmpeg.P144p30fps16x9
+	sess, _ = r.Get(mid)
+	assert.Equal(ffmpeg.P240p30fps16x9, sess.Profiles[0])
+}
+
+func TestSessionRegistry_Idle(t *testing.T) {
+	assert := assert.New(t)
+
+	r := NewSessionRegistry(20 * time.Millisecond)
+	mid := ManifestID("some manifest id")
+
+	idle := make(chan StreamSession, 2)
+	r.OnIdle(func(sess StreamSession) { idle <- sess })
+
+	r.Start(mid, SessionSourceBroadcaster, nil)
+
+	// Active session is not idle
+	r.checkIdle()
+	assert.Len(idle, 0)
+
+	time.Sleep(30 * time.Millisecond)
+	r.checkIdle()
+	assert.Len(idle, 1)
+	sess := <-idle
+	assert.Equal(mid, sess.ManifestID)
+	assert.True(sess.Idle)
+
+	// Idle hooks only run once until there is new activity
+	r.checkIdle()
+	assert.Len(idle, 0)
+
+	r.Touch(mid)
+	sess, _ = r.Get(mid)
+	assert.False(sess.Idle)
+
+	time.Sleep(30 * time.Millisecond)
+	r.checkIdle()
+	assert.Len(idle, 1)
+}
+
+func TestSessionRegistry_IdleCheckLoop(t *testing.T) {
+	r := NewSessionRegistry(10 * time.Millisecond)
+	mid := ManifestID("some manifest id")
+
+	idle := make(chan StreamSession, 1)
+	r.OnIdle(func(sess StreamSession) { idle <- sess })
+	r.Start(mid, SessionSourceRTMP, nil)
+
+	go r.StartIdleCheck()
+	defer r.StopIdleCheck()
+
+	select {
+	case sess := <-idle:
+		assert.Equal(t, mid, sess.ManifestID)
+	case <-time.After(time.Second):
+		t.Error("timed out waiting for idle hook")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	ethcommon "github.com/ethereum/go-ethereum/common"
 	ethcrypto "github.com/ethereum/go-ethereum/crypto"
 	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/net"
 	"github.com/livepeer/lpms/ffmpeg"
 )
 
@@ -23,6 +24,17 @@ func TestSegmentFlatten(t *testing.T) {
 	if !bytes.Equal(ethcrypto.Keccak256(md.Flatten()), sHash) {
 		t.Error("Flattened segment + hash did not match expected hash")
 	}
+
+	// Full profiles are flattened in the order of their names
+	flat := md.Flatten()
+	md.FullProfiles = []*net.VideoProfile{
+		{Name: "b", Width: 1280, Height: 720, Bitrate: 3000000, Fps: 30, Gop: "2", Profile: "high", Level: "4.1"},
+		{Name: "a", Width: 320, Height: 180, Bitrate: 250000, Fps: 15, Codec: "H265"},
+	}
+	expected := append(flat, []byte("a:320x180:250000:15::::H265;b:1280x720:3000000:30:2:high:4.1:;")...)
+	if !bytes.Equal(md.Flatten(), expected) {
+		t.Errorf("Unexpected flattened full profiles %q", md.Flatten()[len(flat):])
+	}
 }
 
 func TestRandomIdGenerator(t *testing.T) {
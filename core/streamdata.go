@@ -1,14 +1,17 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/big"
+	"sort"
 	"strings"
 
 	ethcommon "github.com/ethereum/go-ethereum/common"
 
 	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/monitor"
 	"github.com/livepeer/go-livepeer/net"
 
 	"github.com/livepeer/lpms/ffmpeg"
@@ -26,6 +29,17 @@ type SegTranscodingMetadata struct {
 	Hash       ethcommon.Hash
 	Profiles   []ffmpeg.VideoProfile
 	OS         *net.OSInfo
+	// Complexity the bitrates of the profiles were adjusted for. 0 if they were not adjusted
+	Complexity float64
+	// Set if the broadcaster resumed the stream after its publisher reconnected
+	Resumption *net.StreamResumption
+	// Context of the span of the segment, if it is traced
+	TraceContext context.Context
+	// Encoder options of the profiles that have any
+	Encoders common.ProfileEncoders
+	// Full definitions of the profiles as they are sent with the segment. Only set if
+	// some of the profiles cannot be identified by name
+	FullProfiles []*net.VideoProfile
 }
 
 func (md *SegTranscodingMetadata) Flatten() []byte {
@@ -37,11 +51,31 @@ func (md *SegTranscodingMetadata) Flatten() []byte {
 	i += copy(buf[i:], md.Hash.Bytes())
 	i += copy(buf[i:], []byte(profiles))
 	// i += copy(buf[i:], []byte(s.OS))
+	// The name hashes do not identify custom profiles so their full definitions are signed too
+	return append(buf, flattenFullProfiles(md.FullProfiles)...)
+}
+
+// flattenFullProfiles serializes the definitions of profiles in the order of their names, which
+// is the order of their name hashes in the flattened metadata
+func flattenFullProfiles(fullProfiles []*net.VideoProfile) []byte {
+	sorted := append([]*net.VideoProfile(nil), fullProfiles...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	var buf []byte
+	for _, p := range sorted {
+		buf = append(buf, fmt.Sprintf("%s:%dx%d:%d:%d:%s:%s:%s:%s;",
+			p.Name, p.Width, p.Height, p.Bitrate, p.Fps, p.Gop, p.Profile, p.Level, p.Codec)...)
+	}
 	return buf
 }
 
 type ManifestID string
 
+// String returns the manifest ID as it may appear in logs, redacted according to the
+// telemetry redaction mode. Use a string conversion where the manifest ID itself is needed
+func (id ManifestID) String() string {
+	return monitor.Redact(string(id))
+}
+
 // The StreamID represents a particular variant of a stream.
 type StreamID struct {
 	// Base playback ID that related renditions are grouped under
@@ -75,7 +109,7 @@ func SplitStreamIDString(str string) StreamID {
 }
 
 func (id StreamID) String() string {
-	return fmt.Sprintf("%v/%v", id.ManifestID, id.Rendition)
+	return fmt.Sprintf("%v/%v", string(id.ManifestID), id.Rendition)
 }
 
 func RandomManifestID() ManifestID {
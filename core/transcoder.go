@@ -17,21 +17,26 @@ import (
 	"github.com/golang/glog"
 )
 
+// ErrTranscoderCodec is returned when a transcoder cannot encode into the output codec of a profile
+var ErrTranscoderCodec = errors.New("ErrTranscoderCodec")
+
 type Transcoder interface {
-	Transcode(fname string, profiles []ffmpeg.VideoProfile) (*TranscodeData, error)
+	// Transcode transcodes the segment in fname into each profile, with the encoder options of
+	// the profiles that have any
+	Transcode(fname string, profiles []ffmpeg.VideoProfile, encoders common.ProfileEncoders) (*TranscodeData, error)
 }
 
 type LocalTranscoder struct {
 	workDir string
 }
 
-func (lt *LocalTranscoder) Transcode(fname string, profiles []ffmpeg.VideoProfile) (*TranscodeData, error) {
+func (lt *LocalTranscoder) Transcode(fname string, profiles []ffmpeg.VideoProfile, encoders common.ProfileEncoders) (*TranscodeData, error) {
 	// Set up in / out config
 	in := &ffmpeg.TranscodeOptionsIn{
 		Fname: fname,
 		Accel: ffmpeg.Software,
 	}
-	opts := profilesToTranscodeOptions(lt.workDir, ffmpeg.Software, profiles)
+	opts := profilesToTranscodeOptions(lt.workDir, ffmpeg.Software, profiles, encoders)
 
 	_, seqNo, parseErr := parseURI(fname)
 	start := time.Now()
@@ -72,14 +77,18 @@ func (nv *NvidiaTranscoder) getDevice() string {
 	return nv.devices[nv.devIdx]
 }
 
-func (nv *NvidiaTranscoder) Transcode(fname string, profiles []ffmpeg.VideoProfile) (*TranscodeData, error) {
+func (nv *NvidiaTranscoder) Transcode(fname string, profiles []ffmpeg.VideoProfile, encoders common.ProfileEncoders) (*TranscodeData, error) {
+	// Codecs other than H.264 are only encoded in software
+	if codecs := encoders.Codecs(); len(codecs) > 0 {
+		return nil, fmt.Errorf("%v: codecs %v are not supported with Nvidia acceleration", ErrTranscoderCodec, codecs)
+	}
 	// Set up in / out config
 	in := &ffmpeg.TranscodeOptionsIn{
 		Fname:  fname,
 		Accel:  ffmpeg.Nvidia,
 		Device: nv.getDevice(),
 	}
-	opts := profilesToTranscodeOptions(nv.workDir, ffmpeg.Nvidia, profiles)
+	opts := profilesToTranscodeOptions(nv.workDir, ffmpeg.Nvidia, profiles, encoders)
 
 	// Do the Transcoding
 	res, err := ffmpeg.Transcode3(in, opts)
@@ -132,15 +141,28 @@ func resToTranscodeData(res *ffmpeg.TranscodeResults, opts []ffmpeg.TranscodeOpt
 	}, nil
 }
 
-func profilesToTranscodeOptions(workDir string, accel ffmpeg.Acceleration, profiles []ffmpeg.VideoProfile) []ffmpeg.TranscodeOptions {
+func profilesToTranscodeOptions(workDir string, accel ffmpeg.Acceleration, profiles []ffmpeg.VideoProfile, encoders common.ProfileEncoders) []ffmpeg.TranscodeOptions {
 	opts := make([]ffmpeg.TranscodeOptions, len(profiles), len(profiles))
 	for i := range profiles {
 		o := ffmpeg.TranscodeOptions{
-			Oname:        fmt.Sprintf("%s/out_%s.ts", workDir, common.RandName()),
+			Oname:        fmt.Sprintf("%s/out_%s%s", workDir, common.RandName(), encoders.SegmentExtension(profiles[i].Name)),
 			Profile:      profiles[i],
 			Accel:        accel,
 			AudioEncoder: ffmpeg.ComponentOptions{Name: "copy"},
 		}
+		// The H.264 encoder is selected for the acceleration
+		if enc, ok := encoders[profiles[i].Name]; ok && common.IsAudioCodec(enc.Codec) {
+			// Audio-only renditions drop the video and encode the audio at the bitrate of the profile
+			o.VideoEncoder.Name = "drop"
+			o.AudioEncoder = ffmpeg.ComponentOptions{Name: common.CodecEncoder(enc.Codec), Opts: map[string]string{"b": profiles[i].Bitrate}}
+		} else if ok {
+			o.VideoEncoder.Name = common.CodecEncoder(enc.Codec)
+			o.VideoEncoder.Opts = enc.VideoEncoderOpts(profiles[i].Framerate)
+			// VP9 segments are self-contained fragmented MP4
+			if enc.Codec == common.CodecVP9 {
+				o.Muxer = ffmpeg.ComponentOptions{Name: "mp4", Opts: map[string]string{"movflags": "frag_keyframe+empty_moov+default_base_moof"}}
+			}
+		}
 		opts[i] = o
 	}
 	return opts
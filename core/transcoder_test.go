@@ -18,7 +18,7 @@ func TestLocalTranscoder(t *testing.T) {
 	ffmpeg.InitFFmpeg()
 
 	profiles := []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, ffmpeg.P240p30fps16x9}
-	res, err := tc.Transcode("test.ts", profiles)
+	res, err := tc.Transcode("test.ts", profiles, nil)
 	if err != nil {
 		t.Error("Error transcoding ", err)
 	}
@@ -51,7 +51,7 @@ func TestNvidiaTranscoder(t *testing.T) {
 
 	// transcoding should fail due to invalid devices
 	profiles := []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, ffmpeg.P240p30fps16x9}
-	_, err := tc.Transcode(fname, profiles)
+	_, err := tc.Transcode(fname, profiles, nil)
 	if err == nil ||
 		(err.Error() != "Unknown error occurred" &&
 			err.Error() != "Cannot allocate memory") {
@@ -64,7 +64,7 @@ func TestNvidiaTranscoder(t *testing.T) {
 		return
 	}
 	tc = NewNvidiaTranscoder(dev, tmp)
-	res, err := tc.Transcode(fname, profiles)
+	res, err := tc.Transcode(fname, profiles, nil)
 	if err != nil {
 		t.Error(err)
 	}
@@ -163,12 +163,12 @@ func TestProfilesToTranscodeOptions(t *testing.T) {
 
 	// Test 0 profiles
 	profiles := []ffmpeg.VideoProfile{}
-	opts := profilesToTranscodeOptions(workDir, ffmpeg.Software, profiles)
+	opts := profilesToTranscodeOptions(workDir, ffmpeg.Software, profiles, nil)
 	assert.Equal(0, len(opts))
 
 	// Test 1 profile
 	profiles = []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}
-	opts = profilesToTranscodeOptions(workDir, ffmpeg.Software, profiles)
+	opts = profilesToTranscodeOptions(workDir, ffmpeg.Software, profiles, nil)
 	assert.Equal(1, len(opts))
 	assert.Equal("foo/out_bar.ts", opts[0].Oname)
 	assert.Equal(ffmpeg.Software, opts[0].Accel)
@@ -177,7 +177,7 @@ func TestProfilesToTranscodeOptions(t *testing.T) {
 
 	// Test > 1 profile
 	profiles = []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, ffmpeg.P240p30fps16x9}
-	opts = profilesToTranscodeOptions(workDir, ffmpeg.Software, profiles)
+	opts = profilesToTranscodeOptions(workDir, ffmpeg.Software, profiles, nil)
 	assert.Equal(2, len(opts))
 
 	for i, p := range profiles {
@@ -188,7 +188,7 @@ func TestProfilesToTranscodeOptions(t *testing.T) {
 	}
 
 	// Test different acceleration value
-	opts = profilesToTranscodeOptions(workDir, ffmpeg.Nvidia, profiles)
+	opts = profilesToTranscodeOptions(workDir, ffmpeg.Nvidia, profiles, nil)
 	assert.Equal(2, len(opts))
 
 	for i, p := range profiles {
@@ -197,6 +197,44 @@ func TestProfilesToTranscodeOptions(t *testing.T) {
 		assert.Equal(p, opts[i].Profile)
 		assert.Equal("copy", opts[i].AudioEncoder.Name)
 	}
+
+	// Test encoder options are only set for the profiles that have them
+	encoders := common.ProfileEncoders{ffmpeg.P240p30fps16x9.Name: {GOP: "2", Profile: "high", Level: "4.1"}}
+	opts = profilesToTranscodeOptions(workDir, ffmpeg.Software, profiles, encoders)
+	assert.Equal(2, len(opts))
+	assert.Nil(opts[0].VideoEncoder.Opts)
+	assert.Equal(map[string]string{"g": "60", "profile": "high", "level": "4.1"}, opts[1].VideoEncoder.Opts)
+	assert.Empty(opts[1].VideoEncoder.Name)
+
+	// Test other codecs select their encoder, and VP9 is muxed into fragmented MP4
+	encoders = common.ProfileEncoders{
+		ffmpeg.P144p30fps16x9.Name: {Codec: common.CodecH265},
+		ffmpeg.P240p30fps16x9.Name: {Codec: common.CodecVP9, GOP: "intra"},
+	}
+	opts = profilesToTranscodeOptions(workDir, ffmpeg.Software, profiles, encoders)
+	assert.Equal(2, len(opts))
+	assert.Equal("libx265", opts[0].VideoEncoder.Name)
+	assert.Equal("foo/out_bar.ts", opts[0].Oname)
+	assert.Empty(opts[0].Muxer.Name)
+	assert.Equal("libvpx-vp9", opts[1].VideoEncoder.Name)
+	assert.Equal(map[string]string{"g": "1"}, opts[1].VideoEncoder.Opts)
+	assert.Equal("foo/out_bar.mp4", opts[1].Oname)
+	assert.Equal("mp4", opts[1].Muxer.Name)
+
+	// Test audio-only renditions drop the video and encode the audio at the bitrate of the profile
+	audio := ffmpeg.VideoProfile{Name: "audio", Bitrate: "96k"}
+	encoders = common.ProfileEncoders{"audio": {Codec: common.CodecOpus}}
+	opts = profilesToTranscodeOptions(workDir, ffmpeg.Software, []ffmpeg.VideoProfile{audio}, encoders)
+	assert.Equal(1, len(opts))
+	assert.Equal("drop", opts[0].VideoEncoder.Name)
+	assert.Equal(ffmpeg.ComponentOptions{Name: "libopus", Opts: map[string]string{"b": "96k"}}, opts[0].AudioEncoder)
+	assert.Equal("foo/out_bar.ts", opts[0].Oname)
+
+	// Test Nvidia acceleration does not encode other codecs
+	_, err := NewNvidiaTranscoder("0", workDir).Transcode("test.ts", profiles, encoders)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), ErrTranscoderCodec.Error())
+	}
 }
 
 func TestAudioCopy(t *testing.T) {
@@ -220,7 +258,7 @@ func TestAudioCopy(t *testing.T) {
 	assert.Nil(err)
 
 	profs := []ffmpeg.VideoProfile{ffmpeg.P720p30fps16x9} // dummy
-	res, err := tc.Transcode(audioSample, profs)
+	res, err := tc.Transcode(audioSample, profs, nil)
 	assert.Nil(err)
 
 	o, err := ioutil.ReadFile(audioSample)
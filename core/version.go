@@ -0,0 +1,128 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/livepeer/go-livepeer/common"
+)
+
+// Capabilities that a transcoder reports when it registers to an orchestrator
+const (
+	CapabilityH264   = "h264"
+	CapabilityNvidia = "nvidia"
+	CapabilityH265   = "h265"
+	CapabilityVP9    = "vp9"
+	CapabilityAAC    = "aac"
+	CapabilityOpus   = "opus"
+)
+
+// codecCapabilities are the capabilities that transcoding into the output codecs other than H.264 requires
+var codecCapabilities = map[string]string{
+	common.CodecH265: CapabilityH265,
+	common.CodecVP9:  CapabilityVP9,
+	common.CodecAAC:  CapabilityAAC,
+	common.CodecOpus: CapabilityOpus,
+}
+
+var ErrVersion = errors.New("ErrVersion")
+var ErrTranscoderVersion = errors.New("ErrTranscoderVersion")
+
+// Version is the semantic version of a node, without the build metadata that is appended to LivepeerVersion
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// ParseVersion parses a version of the form [v]MAJOR.MINOR.PATCH, optionally followed by
+// a suffix starting with '-' or '+', such as the git description appended at build time
+func ParseVersion(v string) (Version, error) {
+	s := strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return Version{}, fmt.Errorf("%v: invalid version %q", ErrVersion, v)
+	}
+	var nums [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return Version{}, fmt.Errorf("%v: invalid version %q", ErrVersion, v)
+		}
+		nums[i] = n
+	}
+	return Version{Major: nums[0], Minor: nums[1], Patch: nums[2]}, nil
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Less returns true if v is an earlier version than o
+func (v Version) Less(o Version) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+	if v.Minor != o.Minor {
+		return v.Minor < o.Minor
+	}
+	return v.Patch < o.Patch
+}
+
+// Compatible returns true if v and o only differ by their patch version. Minor versions
+// may change the protocol between orchestrators and transcoders while the major version is 0
+func (v Version) Compatible(o Version) bool {
+	return v.Major == o.Major && v.Minor == o.Minor
+}
+
+// TranscoderCapabilities returns the capabilities of a transcoder. The capabilities of a pool of
+// remote transcoders are those of any of its live transcoders
+func TranscoderCapabilities(t Transcoder) []string {
+	switch t := t.(type) {
+	case *RemoteTranscoderManager:
+		return t.Capabilities()
+	case *NvidiaTranscoder:
+		return []string{CapabilityH264, CapabilityNvidia}
+	case *LocalTranscoder:
+		// The other codecs are only encoded in software, if FFmpeg was built with their encoders
+		caps := []string{CapabilityH264}
+		for _, codec := range []string{common.CodecH265, common.CodecVP9, common.CodecAAC, common.CodecOpus} {
+			if encoderAvailable(common.CodecEncoder(codec)) {
+				caps = append(caps, codecCapabilities[codec])
+			}
+		}
+		return caps
+	}
+	return []string{CapabilityH264}
+}
+
+// RequiredCapabilities returns the capabilities that transcoding into profiles with the given encoder options requires
+func RequiredCapabilities(encoders common.ProfileEncoders) []string {
+	var caps []string
+	for _, codec := range encoders.Codecs() {
+		caps = append(caps, codecCapabilities[codec])
+	}
+	return caps
+}
+
+// HasCapabilities returns whether caps includes all the required capabilities
+func HasCapabilities(caps []string, required []string) bool {
+	for _, r := range required {
+		found := false
+		for _, c := range caps {
+			if c == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
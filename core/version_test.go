@@ -0,0 +1,76 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	v, err := ParseVersion("0.5.2")
+	assert.Nil(err)
+	assert.Equal(Version{Major: 0, Minor: 5, Patch: 2}, v)
+	assert.Equal("0.5.2", v.String())
+
+	// Build metadata is ignored
+	v, err = ParseVersion("v0.5.2-0a1b2c3d-dirty")
+	assert.Nil(err)
+	assert.Equal(Version{Major: 0, Minor: 5, Patch: 2}, v)
+	v, err = ParseVersion("1.10.0+build")
+	assert.Nil(err)
+	assert.Equal(Version{Major: 1, Minor: 10, Patch: 0}, v)
+
+	for _, s := range []string{"", "undefined", "0.5", "0.5.2.1", "0.x.2", "0.-5.2"} {
+		_, err = ParseVersion(s)
+		assert.EqualError(err, `ErrVersion: invalid version "`+s+`"`)
+	}
+}
+
+func TestVersion_Compare(t *testing.T) {
+	assert := assert.New(t)
+
+	v := Version{Major: 0, Minor: 5, Patch: 2}
+	assert.False(v.Less(v))
+	assert.True(v.Less(Version{Major: 0, Minor: 5, Patch: 3}))
+	assert.True(v.Less(Version{Major: 0, Minor: 6, Patch: 0}))
+	assert.True(v.Less(Version{Major: 1, Minor: 0, Patch: 0}))
+	assert.False(v.Less(Version{Major: 0, Minor: 4, Patch: 9}))
+
+	assert.True(v.Compatible(Version{Major: 0, Minor: 5, Patch: 0}))
+	assert.False(v.Compatible(Version{Major: 0, Minor: 6, Patch: 2}))
+	assert.False(v.Compatible(Version{Major: 1, Minor: 5, Patch: 2}))
+}
+
+func TestTranscoderCapabilities(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]string{CapabilityH264}, TranscoderCapabilities(NewLocalTranscoder("")))
+	assert.Equal([]string{CapabilityH264, CapabilityNvidia}, TranscoderCapabilities(NewNvidiaTranscoder("0", "")))
+	assert.Equal([]string{CapabilityH264}, TranscoderCapabilities(nil))
+
+	// The software transcoder advertises the codecs that FFmpeg was built with encoders for
+	defer func(f func(string) bool) { encoderAvailable = f }(encoderAvailable)
+	encoderAvailable = func(name string) bool { return name == "libvpx-vp9" }
+	assert.Equal([]string{CapabilityH264, CapabilityVP9}, TranscoderCapabilities(NewLocalTranscoder("")))
+	encoderAvailable = func(string) bool { return true }
+	assert.Equal([]string{CapabilityH264, CapabilityH265, CapabilityVP9, CapabilityAAC, CapabilityOpus}, TranscoderCapabilities(NewLocalTranscoder("")))
+	assert.Equal([]string{CapabilityH264, CapabilityNvidia}, TranscoderCapabilities(NewNvidiaTranscoder("0", "")))
+}
+
+func TestRequiredCapabilities(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Empty(RequiredCapabilities(nil))
+	assert.Empty(RequiredCapabilities(common.ProfileEncoders{"a": {GOP: "2"}}))
+	required := RequiredCapabilities(common.ProfileEncoders{"a": {Codec: common.CodecVP9}, "b": {Codec: common.CodecH265}, "c": {Codec: common.CodecVP9}})
+	assert.Equal([]string{CapabilityH265, CapabilityVP9}, required)
+	assert.Equal([]string{CapabilityAAC, CapabilityOpus}, RequiredCapabilities(common.ProfileEncoders{"a": {Codec: common.CodecOpus}, "b": {Codec: common.CodecAAC}}))
+
+	assert.True(HasCapabilities([]string{CapabilityH264}, nil))
+	assert.True(HasCapabilities([]string{CapabilityH264, CapabilityH265, CapabilityVP9}, required))
+	assert.False(HasCapabilities([]string{CapabilityH264, CapabilityVP9}, required))
+	assert.False(HasCapabilities(nil, required))
+}
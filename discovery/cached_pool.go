@@ -0,0 +1,189 @@
+package discovery
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/go-livepeer/server"
+
+	"github.com/golang/glog"
+)
+
+// cachedPoolFetchTimeout is how long a refresh of the cached pool waits for an orchestrator to respond
+var cachedPoolFetchTimeout = server.GRPCConnectTimeout + server.GRPCTimeout
+
+type cachedOrchInfo struct {
+	uri  *url.URL
+	info *net.OrchestratorInfo
+}
+
+// cachedPool serves the orchestrators of a pool from the infos that it requests from all of them
+// in the background, so that sessions don't wait for every orchestrator to be requested when
+// streams start. The info of an orchestrator is dropped when a session with it fails, until the
+// next refresh. The pool itself is used while the cache is empty
+type cachedPool struct {
+	node  *core.LivepeerNode
+	bcast server.Broadcaster
+	pool  net.OrchestratorPool
+	pred  func(info *net.OrchestratorInfo) bool
+
+	mu    sync.RWMutex
+	infos []*cachedOrchInfo
+	// Time of the last refresh, and the age after which the cached infos are not used if set
+	refreshedAt time.Time
+	maxAge      time.Duration
+	quit        chan struct{}
+}
+
+// NewCachedPool creates a pool that serves the orchestrators of pool from cached infos. The infos
+// are requested once StartRefreshing is called
+func NewCachedPool(node *core.LivepeerNode, pool net.OrchestratorPool) *cachedPool {
+	c := &cachedPool{
+		node:  node,
+		bcast: core.NewBroadcaster(node),
+		pool:  pool,
+		quit:  make(chan struct{}),
+	}
+	// Ticket params and prices are only checked on chain
+	if node.Eth != nil {
+		c.pred = acceptableOrchInfo(node)
+	}
+	return c
+}
+
+// StartRefreshing requests the infos of the orchestrators of the pool every interval until
+// StopRefreshing is called. The first refresh is skipped if the pool was primed within interval
+func (c *cachedPool) StartRefreshing(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	c.mu.RLock()
+	primed := time.Since(c.refreshedAt) < interval
+	c.mu.RUnlock()
+	for {
+		if !primed {
+			c.refresh()
+		}
+		primed = false
+		select {
+		case <-ticker.C:
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// Prime requests the infos of the orchestrators of the pool once, so that the first streams after
+// the node starts don't wait for them. The infos are not used once they are older than maxAge,
+// unless maxAge is 0
+func (c *cachedPool) Prime(maxAge time.Duration) {
+	c.mu.Lock()
+	c.maxAge = maxAge
+	c.mu.Unlock()
+	c.refresh()
+}
+
+// StopRefreshing stops the refreshes of the infos
+func (c *cachedPool) StopRefreshing() {
+	close(c.quit)
+}
+
+// refresh requests the info of every orchestrator of the pool and replaces the cached infos with
+// the ones that were returned
+func (c *cachedPool) refresh() {
+	uris := c.pool.GetURLs()
+
+	results := make([]*cachedOrchInfo, len(uris))
+	var wg sync.WaitGroup
+	for i, uri := range uris {
+		wg.Add(1)
+		go func(i int, uri *url.URL) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), cachedPoolFetchTimeout)
+			defer cancel()
+			info, err := serverGetOrchInfo(ctx, c.bcast, uri)
+			if err != nil {
+				glog.V(common.DEBUG).Infof("Unable to refresh orchestrator info orch=%s: %v", uri, err)
+				return
+			}
+			results[i] = &cachedOrchInfo{uri: uri, info: info}
+		}(i, uri)
+	}
+	wg.Wait()
+
+	var infos []*cachedOrchInfo
+	for _, r := range results {
+		if r != nil {
+			infos = append(infos, r)
+		}
+	}
+	glog.V(common.DEBUG).Infof("Refreshed orchestrator infos orchestrators=%d responded=%d", len(uris), len(infos))
+
+	c.mu.Lock()
+	c.infos = infos
+	c.refreshedAt = time.Now()
+	c.mu.Unlock()
+}
+
+// Invalidate drops the cached info of the orchestrator with the transcoder URI until the next refresh
+func (c *cachedPool) Invalidate(transcoder string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	infos := make([]*cachedOrchInfo, 0, len(c.infos))
+	for _, ci := range c.infos {
+		if ci.info.Transcoder == transcoder {
+			glog.V(common.DEBUG).Infof("Invalidated cached orchestrator info orch=%s", transcoder)
+			continue
+		}
+		infos = append(infos, ci)
+	}
+	c.infos = infos
+}
+
+func (c *cachedPool) GetURLs() []*url.URL {
+	return c.pool.GetURLs()
+}
+
+func (c *cachedPool) Size() int {
+	return c.pool.Size()
+}
+
+func (c *cachedPool) GetOrchestrators(numOrchestrators int) ([]*net.OrchestratorInfo, error) {
+	c.mu.RLock()
+	cached := c.infos
+	if c.maxAge > 0 && time.Since(c.refreshedAt) > c.maxAge {
+		cached = nil
+	}
+	c.mu.RUnlock()
+
+	var infos []*net.OrchestratorInfo
+	var uris []*url.URL
+	for _, i := range perm(len(cached)) {
+		ci := cached[i]
+		if c.pred != nil && !c.pred(ci.info) {
+			continue
+		}
+		// Sessions update their info, which must not change the cached one
+		infos = append(infos, proto.Clone(ci.info).(*net.OrchestratorInfo))
+		uris = append(uris, ci.uri)
+	}
+	if len(infos) == 0 {
+		glog.V(common.DEBUG).Info("No cached orchestrator infos, requesting them from the orchestrators")
+		return c.pool.GetOrchestrators(numOrchestrators)
+	}
+
+	if rankingEnabled() {
+		infos = rankOrchestrators(infos, uris)
+	}
+	if len(infos) > numOrchestrators {
+		infos = infos[:numOrchestrators]
+	}
+	return infos, nil
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/core"
 	lpTypes "github.com/livepeer/go-livepeer/eth/types"
+	"github.com/livepeer/go-livepeer/eth/watchers"
 	"github.com/livepeer/go-livepeer/net"
 	"github.com/livepeer/go-livepeer/pm"
 	"github.com/livepeer/go-livepeer/server"
@@ -24,6 +25,10 @@ var getTicker = func() *time.Ticker {
 	return time.NewTicker(cacheRefreshInterval)
 }
 
+// cacheBondRefreshDelay is how long the cache refresh is delayed after a change of stake, so that the
+// changes of stake of the same period are cached at once
+var cacheBondRefreshDelay = 1 * time.Minute
+
 type DBOrchestratorPoolCache struct {
 	node *core.LivepeerNode
 }
@@ -36,9 +41,20 @@ func NewDBOrchestratorPoolCache(node *core.LivepeerNode) *DBOrchestratorPoolCach
 
 	_ = cacheRegisteredTranscoders(node)
 
+	// The cache is refreshed at every interval, and once the set of orchestrators or their stake
+	// changes if the node receives the protocol events
+	refresh := make(chan struct{}, 1)
+	if server.ProtocolEvents != nil {
+		go watchOrchestratorChanges(server.ProtocolEvents, refresh)
+	}
+
 	ticker := getTicker()
 	go func(node *core.LivepeerNode) {
-		for _ = range ticker.C {
+		for {
+			select {
+			case <-ticker.C:
+			case <-refresh:
+			}
 			err := cacheRegisteredTranscoders(node)
 			if err != nil {
 				continue
@@ -49,6 +65,41 @@ func NewDBOrchestratorPoolCache(node *core.LivepeerNode) *DBOrchestratorPoolCach
 	return &DBOrchestratorPoolCache{node: node}
 }
 
+// watchOrchestratorChanges signals refresh on every new round, and after cacheBondRefreshDelay on
+// changes of stake. Signals are not sent while a refresh is already pending, so that events are
+// always received without blocking the other subscribers
+func watchOrchestratorChanges(events watchers.ProtocolEventSubscriber, refresh chan struct{}) {
+	sink := make(chan *watchers.ProtocolEvent, 10)
+	sub := events.Subscribe(sink)
+	defer sub.Unsubscribe()
+
+	signal := func() {
+		select {
+		case refresh <- struct{}{}:
+		default:
+		}
+	}
+	var delayed <-chan time.Time
+	for {
+		select {
+		case ev := <-sink:
+			switch ev.Name {
+			case "NewRound":
+				signal()
+			case "Bond", "Unbond", "Rebond":
+				if delayed == nil {
+					delayed = time.After(cacheBondRefreshDelay)
+				}
+			}
+		case <-delayed:
+			delayed = nil
+			signal()
+		case <-sub.Err():
+			return
+		}
+	}
+}
+
 func (dbo *DBOrchestratorPoolCache) getURLs() ([]*url.URL, error) {
 	orchs, err := dbo.node.Database.SelectOrchs(&common.DBOrchFilter{MaxPrice: server.BroadcastCfg.MaxPrice()})
 	if err != nil || len(orchs) <= 0 {
@@ -75,21 +126,7 @@ func (dbo *DBOrchestratorPoolCache) GetOrchestrators(numOrchestrators int) ([]*n
 		return nil, err
 	}
 
-	pred := func(info *net.OrchestratorInfo) bool {
-		if dbo.node.Sender != nil {
-			if err := dbo.node.Sender.ValidateTicketParams(pmTicketParams(info.TicketParams)); err != nil {
-				return false
-			}
-		}
-
-		price := server.BroadcastCfg.MaxPrice()
-		if price != nil {
-			return big.NewRat(info.PriceInfo.PricePerUnit, info.PriceInfo.PixelsPerUnit).Cmp(price) <= 0
-		}
-		return true
-	}
-
-	orchPool := NewOrchestratorPoolWithPred(dbo.node, uris, pred)
+	orchPool := NewOrchestratorPoolWithPred(dbo.node, uris, acceptableOrchInfo(dbo.node))
 
 	orchInfos, err := orchPool.GetOrchestrators(numOrchestrators)
 	if err != nil || len(orchInfos) <= 0 {
@@ -103,6 +140,24 @@ func (dbo *DBOrchestratorPoolCache) Size() int {
 	return len(dbo.GetURLs())
 }
 
+// acceptableOrchInfo returns a predicate that accepts the orchestrators whose ticket params
+// are valid for the node's sender and whose price is within the max price of the broadcaster
+func acceptableOrchInfo(node *core.LivepeerNode) func(info *net.OrchestratorInfo) bool {
+	return func(info *net.OrchestratorInfo) bool {
+		if node.Sender != nil {
+			if err := node.Sender.ValidateTicketParams(pmTicketParams(info.TicketParams)); err != nil {
+				return false
+			}
+		}
+
+		price := server.BroadcastCfg.MaxPrice()
+		if price != nil {
+			return big.NewRat(info.PriceInfo.PricePerUnit, info.PriceInfo.PixelsPerUnit).Cmp(price) <= 0
+		}
+		return true
+	}
+}
+
 func cacheRegisteredTranscoders(node *core.LivepeerNode) error {
 	orchestrators, err := node.Eth.RegisteredTranscoders()
 	if err != nil {
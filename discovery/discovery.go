@@ -63,8 +63,15 @@ func (o *orchestratorPool) GetURLs() []*url.URL {
 func (o *orchestratorPool) GetOrchestrators(numOrchestrators int) ([]*net.OrchestratorInfo, error) {
 	numAvailableOrchs := len(o.uris)
 	numOrchestrators = int(math.Min(float64(numAvailableOrchs), float64(numOrchestrators)))
-	ctx, cancel := context.WithTimeout(context.Background(), getOrchestratorsTimeoutLoop)
+	// Orchestrators are ranked among all the ones that respond instead of taking the first ones
+	rank := rankingEnabled()
+	timeout := getOrchestratorsTimeoutLoop
+	if rank {
+		timeout = latencySelectionTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	orchInfos := []*net.OrchestratorInfo{}
+	orchURIs := []*url.URL{}
 	orchChan := make(chan struct{}, len(o.uris))
 	numResp := 0
 	numSuccessResp := 0
@@ -77,12 +84,13 @@ func (o *orchestratorPool) GetOrchestrators(numOrchestrators int) ([]*net.Orches
 		numResp++
 		if err == nil && (o.pred == nil || o.pred(info)) {
 			orchInfos = append(orchInfos, info)
+			orchURIs = append(orchURIs, uri)
 			numSuccessResp++
 		}
 		if err != nil && monitor.Enabled {
 			monitor.LogDiscoveryError(err.Error())
 		}
-		if numSuccessResp >= numOrchestrators || numResp >= len(o.uris) {
+		if (!rank && numSuccessResp >= numOrchestrators) || numResp >= len(o.uris) {
 			orchChan <- struct{}{}
 		}
 	}
@@ -94,27 +102,34 @@ func (o *orchestratorPool) GetOrchestrators(numOrchestrators int) ([]*net.Orches
 	select {
 	case <-ctx.Done():
 		respLock.Lock()
-		if len(orchInfos) < numOrchestrators {
-			numOrchestrators = len(orchInfos)
-		}
-		returnOrchs := orchInfos[:numOrchestrators]
+		infos, uris := orchInfos, orchURIs
 		respLock.Unlock()
+		returnOrchs := o.selectOrchestrators(infos, uris, numOrchestrators, rank)
 		glog.Info("Done fetching orch info for orchestrators, context timeout: ", returnOrchs)
 		cancel()
 		return returnOrchs, nil
 	case <-orchChan:
 		respLock.Lock()
-		if len(orchInfos) < numOrchestrators {
-			numOrchestrators = len(orchInfos)
-		}
-		returnOrchs := orchInfos[:numOrchestrators]
+		infos, uris := orchInfos, orchURIs
 		respLock.Unlock()
+		returnOrchs := o.selectOrchestrators(infos, uris, numOrchestrators, rank)
 		glog.Info("Done fetching orch info for orchestrators, numResponses fetched: ", returnOrchs)
 		cancel()
 		return returnOrchs, nil
 	}
 }
 
+// selectOrchestrators returns the first numOrchestrators infos, after ranking them if rank is set
+func (o *orchestratorPool) selectOrchestrators(infos []*net.OrchestratorInfo, uris []*url.URL, numOrchestrators int, rank bool) []*net.OrchestratorInfo {
+	if rank {
+		infos = rankOrchestrators(infos, uris)
+	}
+	if len(infos) < numOrchestrators {
+		numOrchestrators = len(infos)
+	}
+	return infos[:numOrchestrators]
+}
+
 func (o *orchestratorPool) Size() int {
 	return len(o.uris)
 }
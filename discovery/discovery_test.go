@@ -4,9 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"math/big"
 	"math/rand"
+	gonet "net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
 	"runtime"
 	"strconv"
 	"sync"
@@ -14,11 +19,13 @@ import (
 	"time"
 
 	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/golang/glog"
 	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/core"
 	"github.com/livepeer/go-livepeer/eth"
 	lpTypes "github.com/livepeer/go-livepeer/eth/types"
+	"github.com/livepeer/go-livepeer/eth/watchers"
 	"github.com/livepeer/go-livepeer/net"
 	"github.com/livepeer/go-livepeer/pm"
 	"github.com/livepeer/go-livepeer/server"
@@ -217,6 +224,57 @@ func TestCacheRegisteredTranscoders_GivenListOfOrchs_CreatesPoolCacheCorrectly(t
 	require.Nil(err)
 }
 
+type stubProtocolEvents struct {
+	feed event.Feed
+}
+
+func (s *stubProtocolEvents) Subscribe(sink chan<- *watchers.ProtocolEvent) event.Subscription {
+	return s.feed.Subscribe(sink)
+}
+
+func TestWatchOrchestratorChanges(t *testing.T) {
+	assert := assert.New(t)
+	oldDelay := cacheBondRefreshDelay
+	defer func() { cacheBondRefreshDelay = oldDelay }()
+	cacheBondRefreshDelay = 100 * time.Millisecond
+
+	events := &stubProtocolEvents{}
+	refresh := make(chan struct{}, 1)
+	go watchOrchestratorChanges(events, refresh)
+	send := func(name string) {
+		require.Eventually(t, func() bool { return events.feed.Send(&watchers.ProtocolEvent{Name: name}) > 0 }, time.Second, 10*time.Millisecond)
+	}
+	refreshed := func(timeout time.Duration) bool {
+		select {
+		case <-refresh:
+			return true
+		case <-time.After(timeout):
+			return false
+		}
+	}
+
+	// New rounds refresh the cache at once, and other events are ignored
+	send("NewRound")
+	assert.True(refreshed(time.Second))
+	send("ReserveFunded")
+	assert.False(refreshed(200 * time.Millisecond))
+
+	// Changes of stake refresh the cache once after the delay
+	send("Bond")
+	send("Unbond")
+	send("Rebond")
+	assert.False(refreshed(50 * time.Millisecond))
+	assert.True(refreshed(time.Second))
+	assert.False(refreshed(200 * time.Millisecond))
+
+	// Refreshes are not queued while one is pending
+	send("NewRound")
+	send("NewRound")
+	time.Sleep(50 * time.Millisecond)
+	assert.True(refreshed(time.Second))
+	assert.False(refreshed(100 * time.Millisecond))
+}
+
 func TestNewDBOrchestratorPoolCache_GivenListOfOrchs_CreatesPoolCacheCorrectly(t *testing.T) {
 	var mu sync.Mutex
 	first := true
@@ -879,3 +937,441 @@ func TestDeserializeWebhookJSON(t *testing.T) {
 	assert.Contains(err.Error(), "cannot unmarshal number")
 	assert.Empty(urls)
 }
+
+type stubURLSource struct {
+	uris []*url.URL
+}
+
+func (s *stubURLSource) GetURLs() []*url.URL {
+	return s.uris
+}
+
+func TestParseDiscoverySources(t *testing.T) {
+	assert := assert.New(t)
+
+	sources, err := ParseDiscoverySources("chain:0, webhook,srv:2")
+	assert.Nil(err)
+	assert.Equal([]*DiscoverySource{{Name: SourceChain, Priority: 0}, {Name: SourceWebhook, Priority: 1}, {Name: SourceSRV, Priority: 2}}, sources)
+
+	for _, spec := range []string{"", "dht", "static,static:2", "static:-1", "static:a"} {
+		_, err := ParseDiscoverySources(spec)
+		assert.NotNil(err, spec)
+	}
+}
+
+func TestSRVSource(t *testing.T) {
+	assert := assert.New(t)
+	oldLookup := lookupSRV
+	defer func() { lookupSRV = oldLookup }()
+
+	lookupSRV = func(name string) ([]*gonet.SRV, error) {
+		assert.Equal("_livepeer._tcp.example.com", name)
+		return []*gonet.SRV{{Target: "o1.example.com.", Port: 8935}, {Target: "o2.example.com.", Port: 443}}, nil
+	}
+	src := NewSRVSource("_livepeer._tcp.example.com")
+	assert.Equal(stringsToURIs([]string{"https://o1.example.com:8935", "https://o2.example.com:443"}), src.GetURLs())
+
+	lookupSRV = func(name string) ([]*gonet.SRV, error) { return nil, errors.New("no such host") }
+	assert.Empty(src.GetURLs())
+}
+
+func TestLayeredPool_Quorum(t *testing.T) {
+	assert := assert.New(t)
+	node, _ := core.NewLivepeerNode(nil, "", nil)
+
+	s1 := &stubURLSource{stringsToURIs([]string{"https://o1:8935", "https://o2:8935", "https://o2:8935"})}
+	s2 := &stubURLSource{stringsToURIs([]string{"https://o2:8935", "https://o3:8935"})}
+	s3 := &stubURLSource{stringsToURIs([]string{"https://o4:8935"})}
+	pool := NewLayeredPool(node, []*DiscoverySource{
+		{Name: SourceSRV, Priority: 2, Source: s3},
+		{Name: SourceChain, Priority: 1, Source: s1},
+		{Name: SourceWebhook, Priority: 1, Source: s2},
+	}, 2)
+
+	// Orchestrators of a level must be listed by quorum sources
+	assert.Equal(stringsToURIs([]string{"https://o2:8935", "https://o4:8935"}), pool.GetURLs())
+	assert.Equal(2, pool.Size())
+
+	// The last orchestrators of a failed source are used
+	s1.uris = nil
+	assert.Equal(stringsToURIs([]string{"https://o2:8935", "https://o4:8935"}), pool.GetURLs())
+
+	// The quorum is lowered to the number of sources that returned orchestrators
+	pool.lastURLs = make(map[string][]*url.URL)
+	assert.Equal(stringsToURIs([]string{"https://o2:8935", "https://o3:8935", "https://o4:8935"}), pool.GetURLs())
+
+	s2.uris, s3.uris = nil, nil
+	pool.lastURLs = make(map[string][]*url.URL)
+	assert.Empty(pool.GetURLs())
+}
+
+func TestLayeredPool_GetOrchestrators(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	oldGetOrchInfo, oldPerm := serverGetOrchInfo, perm
+	defer func() { serverGetOrchInfo, perm = oldGetOrchInfo, oldPerm }()
+	perm = func(len int) []int { return rand.Perm(len) }
+
+	serverGetOrchInfo = func(ctx context.Context, bcast server.Broadcaster, uri *url.URL) (*net.OrchestratorInfo, error) {
+		if uri.Host == "o2:8935" {
+			return nil, errors.New("unreachable")
+		}
+		return &net.OrchestratorInfo{Transcoder: uri.String(), PriceInfo: &net.PriceInfo{PricePerUnit: 1, PixelsPerUnit: 1}}, nil
+	}
+
+	node, _ := core.NewLivepeerNode(nil, "", nil)
+	pool := NewLayeredPool(node, []*DiscoverySource{
+		{Name: SourceStatic, Priority: 1, Source: &stubURLSource{stringsToURIs([]string{"https://o1:8935", "https://o2:8935"})}},
+		{Name: SourceSRV, Priority: 2, Source: &stubURLSource{stringsToURIs([]string{"https://o1:8935", "https://o3:8935", "https://o4:8935"})}},
+	}, 1)
+
+	// Lower priority levels are not used if the first level provides enough orchestrators
+	infos, err := pool.GetOrchestrators(1)
+	require.Nil(err)
+	require.Len(infos, 1)
+	assert.Equal("https://o1:8935", infos[0].Transcoder)
+
+	// Lower priority levels complete the orchestrators of the first level
+	infos, err = pool.GetOrchestrators(3)
+	require.Nil(err)
+	var transcoders []string
+	for _, info := range infos {
+		transcoders = append(transcoders, info.Transcoder)
+	}
+	assert.ElementsMatch([]string{"https://o1:8935", "https://o3:8935", "https://o4:8935"}, transcoders)
+}
+
+func TestParseOrchList(t *testing.T) {
+	assert := assert.New(t)
+
+	uris := parseOrchList([]byte("# orchestrators\n127.0.0.1:8935\n\n  https://o1:8935 , http://o2:8935\n%zz\n"))
+	var addrs []string
+	for _, uri := range uris {
+		addrs = append(addrs, uri.String())
+	}
+	assert.Equal([]string{"https://127.0.0.1:8935", "https://o1:8935", "http://o2:8935"}, addrs)
+	assert.Empty(parseOrchList(nil))
+}
+
+func TestStaticPool(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	oldGetOrchInfo, oldPerm := serverGetOrchInfo, perm
+	defer func() { serverGetOrchInfo, perm = oldGetOrchInfo, oldPerm }()
+	perm = func(len int) []int { return rand.Perm(len) }
+
+	var mu sync.Mutex
+	unhealthy := map[string]bool{"o2:8935": true}
+	serverGetOrchInfo = func(ctx context.Context, bcast server.Broadcaster, uri *url.URL) (*net.OrchestratorInfo, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if unhealthy[uri.Host] {
+			return nil, errors.New("unreachable")
+		}
+		return &net.OrchestratorInfo{Transcoder: uri.String()}, nil
+	}
+
+	f, err := ioutil.TempFile("", "TestStaticPool")
+	require.Nil(err)
+	defer os.Remove(f.Name())
+	require.Nil(ioutil.WriteFile(f.Name(), []byte("o1:8935\no2:8935\n"), 0644))
+
+	node, _ := core.NewLivepeerNode(nil, "", nil)
+	pool := NewStaticPool(node, f.Name())
+
+	// Nothing is used before the list is loaded
+	assert.Zero(pool.Size())
+	infos, err := pool.GetOrchestrators(2)
+	require.Nil(err)
+	assert.Empty(infos)
+
+	// Orchestrators that fail the probe are not used
+	pool.refresh()
+	assert.Equal(stringsToURIs([]string{"https://o1:8935"}), pool.GetURLs())
+	infos, err = pool.GetOrchestrators(2)
+	require.Nil(err)
+	require.Len(infos, 1)
+	assert.Equal("https://o1:8935", infos[0].Transcoder)
+
+	// Changes of the list and of the health of orchestrators are picked up by the next refresh
+	require.Nil(ioutil.WriteFile(f.Name(), []byte("o1:8935\no2:8935\no3:8935\n"), 0644))
+	mu.Lock()
+	unhealthy = map[string]bool{"o1:8935": true}
+	mu.Unlock()
+	pool.refresh()
+	assert.Equal(stringsToURIs([]string{"https://o2:8935", "https://o3:8935"}), pool.GetURLs())
+	assert.Equal(2, pool.Size())
+
+	// The previous list is kept if the list can't be loaded
+	require.Nil(os.Remove(f.Name()))
+	pool.refresh()
+	assert.Equal(stringsToURIs([]string{"https://o2:8935", "https://o3:8935"}), pool.GetURLs())
+}
+
+func TestStaticPool_URL(t *testing.T) {
+	assert := assert.New(t)
+	oldGetOrchInfo := serverGetOrchInfo
+	defer func() { serverGetOrchInfo = oldGetOrchInfo }()
+	serverGetOrchInfo = func(ctx context.Context, bcast server.Broadcaster, uri *url.URL) (*net.OrchestratorInfo, error) {
+		return &net.OrchestratorInfo{Transcoder: uri.String()}, nil
+	}
+
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte("https://o1:8935\n"))
+	}))
+	defer ts.Close()
+
+	node, _ := core.NewLivepeerNode(nil, "", nil)
+	pool := NewStaticPool(node, ts.URL)
+	pool.refresh()
+	assert.Equal(stringsToURIs([]string{"https://o1:8935"}), pool.GetURLs())
+
+	// Error responses don't replace the list
+	status = http.StatusInternalServerError
+	assert.NotNil(pool.reload())
+	assert.Equal(stringsToURIs([]string{"https://o1:8935"}), pool.GetURLs())
+}
+
+func TestHealthCheckedPool(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	oldGetOrchInfo, oldPing, oldPerm := serverGetOrchInfo, serverPingOrch, perm
+	defer func() { serverGetOrchInfo, serverPingOrch, perm = oldGetOrchInfo, oldPing, oldPerm }()
+	perm = func(len int) []int { return rand.Perm(len) }
+
+	serverGetOrchInfo = func(ctx context.Context, bcast server.Broadcaster, uri *url.URL) (*net.OrchestratorInfo, error) {
+		return &net.OrchestratorInfo{Transcoder: uri.String()}, nil
+	}
+	var mu sync.Mutex
+	unhealthy := map[string]bool{"o2:8935": true}
+	serverPingOrch = func(ctx context.Context, uri *url.URL) (time.Duration, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if unhealthy[uri.Host] {
+			return 0, errors.New("unreachable")
+		}
+		return time.Millisecond, nil
+	}
+
+	node, _ := core.NewLivepeerNode(nil, "", nil)
+	pool := NewHealthCheckedPool(node, stringsToURIs([]string{"https://o1:8935", "https://o2:8935"}))
+
+	// Nothing is used before the orchestrators are checked
+	assert.Zero(pool.Size())
+
+	// Orchestrators that don't answer pings are not used
+	pool.healthCheck()
+	assert.Equal(stringsToURIs([]string{"https://o1:8935"}), pool.GetURLs())
+	infos, err := pool.GetOrchestrators(2)
+	require.Nil(err)
+	require.Len(infos, 1)
+	assert.Equal("https://o1:8935", infos[0].Transcoder)
+
+	// Orchestrators are used again once they answer
+	mu.Lock()
+	unhealthy = map[string]bool{"o1:8935": true}
+	mu.Unlock()
+	pool.healthCheck()
+	assert.Equal(stringsToURIs([]string{"https://o2:8935"}), pool.GetURLs())
+
+	// The fixed list is not reloaded
+	pool.refresh()
+	assert.Equal(stringsToURIs([]string{"https://o1:8935", "https://o2:8935"}), pool.GetURLs())
+
+	// Health checks run until the pool is stopped
+	mu.Lock()
+	unhealthy = map[string]bool{}
+	mu.Unlock()
+	pool = NewHealthCheckedPool(node, stringsToURIs([]string{"https://o1:8935"}))
+	go pool.StartHealthChecks(time.Hour)
+	defer pool.StopRefreshing()
+	assert.Eventually(func() bool { return pool.Size() == 1 }, time.Second, 10*time.Millisecond)
+}
+
+func TestGetOrchestrators_LatencySelection(t *testing.T) {
+	assert := assert.New(t)
+	oldGetOrchInfo, oldPing, oldPerm := serverGetOrchInfo, serverPingOrch, perm
+	defer func() {
+		serverGetOrchInfo, serverPingOrch, perm = oldGetOrchInfo, oldPing, oldPerm
+		LatencySelection, Region, PreferSameRegion = false, "", false
+		orchRTTs.hosts = make(map[string]orchRTT)
+	}()
+	perm = func(len int) []int { return rand.Perm(len) }
+
+	regions := map[string]string{"o1:8935": "us", "o2:8935": "eu", "o3:8935": "eu", "o4:8935": "us"}
+	prices := map[string]int64{"o1:8935": 1, "o2:8935": 1, "o3:8935": 4, "o4:8935": 1}
+	rtts := map[string]time.Duration{"o1:8935": 200 * time.Millisecond, "o2:8935": 10 * time.Millisecond, "o3:8935": 10 * time.Millisecond}
+	serverGetOrchInfo = func(ctx context.Context, bcast server.Broadcaster, uri *url.URL) (*net.OrchestratorInfo, error) {
+		return &net.OrchestratorInfo{
+			Transcoder: uri.String(),
+			PriceInfo:  &net.PriceInfo{PricePerUnit: prices[uri.Host], PixelsPerUnit: 1},
+			Region:     regions[uri.Host],
+		}, nil
+	}
+	pings := 0
+	var mu sync.Mutex
+	serverPingOrch = func(ctx context.Context, uri *url.URL) (time.Duration, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		pings++
+		rtt, ok := rtts[uri.Host]
+		if !ok {
+			return 0, errors.New("unreachable")
+		}
+		return rtt, nil
+	}
+
+	node, _ := core.NewLivepeerNode(nil, "", nil)
+	pool := NewOrchestratorPool(node, stringsToURIs([]string{"https://o1:8935", "https://o2:8935", "https://o3:8935", "https://o4:8935"}))
+	transcoders := func(infos []*net.OrchestratorInfo) []string {
+		var res []string
+		for _, info := range infos {
+			res = append(res, info.Transcoder)
+		}
+		return res
+	}
+
+	// Cheap and near orchestrators first, and orchestrators that can't be pinged last
+	LatencySelection = true
+	infos, err := pool.GetOrchestrators(4)
+	assert.Nil(err)
+	assert.Equal([]string{"https://o2:8935", "https://o3:8935", "https://o1:8935", "https://o4:8935"}, transcoders(infos))
+	assert.Equal(4, pings)
+
+	infos, err = pool.GetOrchestrators(2)
+	assert.Nil(err)
+	assert.Equal([]string{"https://o2:8935", "https://o3:8935"}, transcoders(infos))
+	// Round trip times are reused
+	assert.Equal(4, pings)
+
+	// Orchestrators in the region of the broadcaster first
+	Region, PreferSameRegion = "us", true
+	infos, err = pool.GetOrchestrators(4)
+	assert.Nil(err)
+	assert.Equal([]string{"https://o1:8935", "https://o4:8935", "https://o2:8935", "https://o3:8935"}, transcoders(infos))
+
+	// Regions alone don't ping the orchestrators
+	LatencySelection = false
+	orchRTTs.hosts = make(map[string]orchRTT)
+	infos, err = pool.GetOrchestrators(2)
+	assert.Nil(err)
+	assert.ElementsMatch([]string{"https://o1:8935", "https://o4:8935"}, transcoders(infos))
+	assert.Equal(4, pings)
+}
+
+func TestCachedPool(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	oldGetOrchInfo, oldPerm := serverGetOrchInfo, perm
+	defer func() { serverGetOrchInfo, perm = oldGetOrchInfo, oldPerm }()
+	perm = func(len int) []int { return rand.Perm(len) }
+
+	var mu sync.Mutex
+	requests := 0
+	unhealthy := map[string]bool{"o3:8935": true}
+	serverGetOrchInfo = func(ctx context.Context, bcast server.Broadcaster, uri *url.URL) (*net.OrchestratorInfo, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if unhealthy[uri.Host] {
+			return nil, errors.New("unreachable")
+		}
+		return &net.OrchestratorInfo{Transcoder: uri.String()}, nil
+	}
+	transcoders := func(infos []*net.OrchestratorInfo) []string {
+		var res []string
+		for _, info := range infos {
+			res = append(res, info.Transcoder)
+		}
+		return res
+	}
+
+	node, _ := core.NewLivepeerNode(nil, "", nil)
+	uris := stringsToURIs([]string{"https://o1:8935", "https://o2:8935", "https://o3:8935"})
+	pool := NewCachedPool(node, NewOrchestratorPool(node, uris))
+	assert.Equal(3, pool.Size())
+	assert.ElementsMatch(uris, pool.GetURLs())
+
+	// The orchestrators are requested while nothing is cached
+	infos, err := pool.GetOrchestrators(3)
+	require.Nil(err)
+	assert.ElementsMatch([]string{"https://o1:8935", "https://o2:8935"}, transcoders(infos))
+	assert.Equal(3, requests)
+
+	// Selections are served from the cache after a refresh
+	pool.refresh()
+	assert.Equal(6, requests)
+	infos, err = pool.GetOrchestrators(3)
+	require.Nil(err)
+	assert.ElementsMatch([]string{"https://o1:8935", "https://o2:8935"}, transcoders(infos))
+	infos, err = pool.GetOrchestrators(1)
+	require.Nil(err)
+	assert.Len(infos, 1)
+	assert.Equal(6, requests)
+
+	// Returned infos are copies of the cached ones
+	infos[0].Transcoder = "https://changed:8935"
+	infos, err = pool.GetOrchestrators(3)
+	require.Nil(err)
+	assert.ElementsMatch([]string{"https://o1:8935", "https://o2:8935"}, transcoders(infos))
+
+	// Invalidated infos are not used until the next refresh
+	pool.Invalidate("https://o1:8935")
+	infos, err = pool.GetOrchestrators(3)
+	require.Nil(err)
+	assert.Equal([]string{"https://o2:8935"}, transcoders(infos))
+	mu.Lock()
+	unhealthy = map[string]bool{}
+	mu.Unlock()
+	pool.refresh()
+	infos, err = pool.GetOrchestrators(3)
+	require.Nil(err)
+	assert.ElementsMatch([]string{"https://o1:8935", "https://o2:8935", "https://o3:8935"}, transcoders(infos))
+}
+
+func TestCachedPool_Prime(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	oldGetOrchInfo, oldPerm := serverGetOrchInfo, perm
+	defer func() { serverGetOrchInfo, perm = oldGetOrchInfo, oldPerm }()
+	perm = func(len int) []int { return rand.Perm(len) }
+
+	var mu sync.Mutex
+	requests := 0
+	serverGetOrchInfo = func(ctx context.Context, bcast server.Broadcaster, uri *url.URL) (*net.OrchestratorInfo, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		return &net.OrchestratorInfo{Transcoder: uri.String()}, nil
+	}
+
+	node, _ := core.NewLivepeerNode(nil, "", nil)
+	pool := NewCachedPool(node, NewOrchestratorPool(node, stringsToURIs([]string{"https://o1:8935"})))
+	pool.Prime(time.Hour)
+	assert.Equal(1, requests)
+	infos, err := pool.GetOrchestrators(1)
+	require.Nil(err)
+	assert.Len(infos, 1)
+	assert.Equal(1, requests)
+
+	// Primed infos are not used once they are too old
+	pool.mu.Lock()
+	pool.refreshedAt = time.Now().Add(-2 * time.Hour)
+	pool.mu.Unlock()
+	infos, err = pool.GetOrchestrators(1)
+	require.Nil(err)
+	assert.Len(infos, 1)
+	assert.Equal(2, requests)
+
+	// Refreshes don't request the infos again right after the pool is primed
+	pool.Prime(0)
+	assert.Equal(3, requests)
+	go pool.StartRefreshing(time.Hour)
+	time.Sleep(20 * time.Millisecond)
+	pool.StopRefreshing()
+	mu.Lock()
+	assert.Equal(3, requests)
+	mu.Unlock()
+}
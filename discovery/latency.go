@@ -0,0 +1,150 @@
+package discovery
+
+import (
+	"context"
+	"math/big"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/go-livepeer/server"
+)
+
+// LatencySelection selects the orchestrators with the lowest round trip time and price among all
+// the orchestrators that respond during discovery instead of the first ones to respond
+var LatencySelection bool
+
+// Region is the region tag of the broadcaster, which is compared with the region tags that
+// orchestrators advertise in OrchestratorInfo
+var Region string
+
+// PreferSameRegion selects orchestrators in the same region as the broadcaster before the others
+var PreferSameRegion bool
+
+// latencySelectionTimeout is how long discovery waits for all the orchestrators to respond when
+// orchestrators are ranked
+var latencySelectionTimeout = server.GRPCConnectTimeout + server.GRPCTimeout
+
+// rttTTL is how long the measured round trip time of an orchestrator is reused
+const rttTTL = 10 * time.Minute
+
+// serverPingOrch measures the round trip time of an orchestrator. Replaced in tests
+var serverPingOrch = server.PingOrchestrator
+
+type orchRTT struct {
+	rtt     time.Duration
+	err     error
+	updated time.Time
+}
+
+var orchRTTs = struct {
+	mu    sync.Mutex
+	hosts map[string]orchRTT
+}{hosts: make(map[string]orchRTT)}
+
+// rankingEnabled returns whether discovery ranks all the orchestrators that respond
+func rankingEnabled() bool {
+	return LatencySelection || (PreferSameRegion && Region != "")
+}
+
+func cachedRTT(uri *url.URL) orchRTT {
+	orchRTTs.mu.Lock()
+	r, ok := orchRTTs.hosts[uri.Host]
+	orchRTTs.mu.Unlock()
+	if ok && time.Since(r.updated) < rttTTL {
+		return r
+	}
+
+	rtt, err := serverPingOrch(context.Background(), uri)
+	r = orchRTT{rtt: rtt, err: err, updated: time.Now()}
+	orchRTTs.mu.Lock()
+	orchRTTs.hosts[uri.Host] = r
+	orchRTTs.mu.Unlock()
+	return r
+}
+
+type rankedOrch struct {
+	info *net.OrchestratorInfo
+	uri  *url.URL
+	// Orchestrators that are not in the region of the broadcaster when it prefers its region
+	otherRegion bool
+	rtt         orchRTT
+	price       *big.Rat
+	cost        float64
+}
+
+// rankOrchestrators orders the infos of the orchestrators at uris, best first. Orchestrators in the
+// same region as the broadcaster come first with PreferSameRegion. With LatencySelection, the
+// orchestrators that can be pinged come next, ordered by the sum of their round trip time and
+// price relative to the highest ones, so that both weigh the same
+func rankOrchestrators(infos []*net.OrchestratorInfo, uris []*url.URL) []*net.OrchestratorInfo {
+	orchs := make([]*rankedOrch, len(infos))
+	for i, info := range infos {
+		orchs[i] = &rankedOrch{
+			info:        info,
+			uri:         uris[i],
+			otherRegion: PreferSameRegion && Region != "" && info.Region != Region,
+			price:       new(big.Rat),
+		}
+	}
+
+	if LatencySelection {
+		var wg sync.WaitGroup
+		for _, o := range orchs {
+			wg.Add(1)
+			go func(o *rankedOrch) {
+				defer wg.Done()
+				o.rtt = cachedRTT(o.uri)
+			}(o)
+		}
+		wg.Wait()
+
+		var maxRTT time.Duration
+		maxPrice := new(big.Rat)
+		for _, o := range orchs {
+			if pi := o.info.PriceInfo; pi != nil && pi.PixelsPerUnit > 0 {
+				o.price.SetFrac64(pi.PricePerUnit, pi.PixelsPerUnit)
+			}
+			if o.price.Cmp(maxPrice) > 0 {
+				maxPrice.Set(o.price)
+			}
+			if o.rtt.err == nil && o.rtt.rtt > maxRTT {
+				maxRTT = o.rtt.rtt
+			}
+		}
+		for _, o := range orchs {
+			if o.rtt.err != nil {
+				glog.V(4).Infof("Unable to ping orchestrator uri=%v err=%v", o.uri, o.rtt.err)
+				continue
+			}
+			if maxRTT > 0 {
+				o.cost += float64(o.rtt.rtt) / float64(maxRTT)
+			}
+			if maxPrice.Sign() > 0 {
+				rel, _ := new(big.Rat).Quo(o.price, maxPrice).Float64()
+				o.cost += rel
+			}
+		}
+	}
+
+	sort.SliceStable(orchs, func(i, j int) bool {
+		a, b := orchs[i], orchs[j]
+		if a.otherRegion != b.otherRegion {
+			return !a.otherRegion
+		}
+		if (a.rtt.err == nil) != (b.rtt.err == nil) {
+			return a.rtt.err == nil
+		}
+		return a.cost < b.cost
+	})
+
+	ranked := make([]*net.OrchestratorInfo, len(orchs))
+	for i, o := range orchs {
+		ranked[i] = o.info
+	}
+	return ranked
+}
@@ -0,0 +1,240 @@
+package discovery
+
+import (
+	"fmt"
+	gonet "net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/net"
+
+	"github.com/golang/glog"
+)
+
+// Names of the sources of orchestrators that can be layered
+const (
+	SourceChain   = "chain"
+	SourceStatic  = "static"
+	SourceWebhook = "webhook"
+	SourceSRV     = "srv"
+)
+
+// URLSource lists the URIs of orchestrators
+type URLSource interface {
+	GetURLs() []*url.URL
+}
+
+// DiscoverySource is a source of orchestrators of a layered pool. Sources with a lower
+// priority value are used first
+type DiscoverySource struct {
+	Name     string
+	Priority int
+	Source   URLSource
+}
+
+// ParseDiscoverySources parses a comma-separated list of source names, each optionally followed
+// by its priority, e.g. "chain:1,webhook:1,static:2". Sources have priority 1 by default
+func ParseDiscoverySources(spec string) ([]*DiscoverySource, error) {
+	var sources []*DiscoverySource
+	seen := make(map[string]bool)
+	for _, s := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(s), ":", 2)
+		src := &DiscoverySource{Name: parts[0], Priority: 1}
+		switch src.Name {
+		case SourceChain, SourceStatic, SourceWebhook, SourceSRV:
+		default:
+			return nil, fmt.Errorf("unknown discovery source %v", src.Name)
+		}
+		if seen[src.Name] {
+			return nil, fmt.Errorf("duplicate discovery source %v", src.Name)
+		}
+		seen[src.Name] = true
+		if len(parts) == 2 {
+			priority, err := strconv.Atoi(parts[1])
+			if err != nil || priority < 0 {
+				return nil, fmt.Errorf("invalid priority of discovery source %v: %v", src.Name, parts[1])
+			}
+			src.Priority = priority
+		}
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
+
+// lookupSRV resolves the SRV records of a name. Replaced in tests
+var lookupSRV = func(name string) ([]*gonet.SRV, error) {
+	_, addrs, err := gonet.LookupSRV("", "", name)
+	return addrs, err
+}
+
+type srvSource struct {
+	name string
+}
+
+// NewSRVSource creates a source of the orchestrators that are published as the SRV records
+// of name, e.g. _livepeer._tcp.example.com
+func NewSRVSource(name string) URLSource {
+	return &srvSource{name: name}
+}
+
+func (s *srvSource) GetURLs() []*url.URL {
+	addrs, err := lookupSRV(s.name)
+	if err != nil {
+		glog.Errorf("Unable to look up orchestrator SRV records name=%v: %v", s.name, err)
+		return nil
+	}
+	// Records are sorted by priority and randomized by weight
+	var uris []*url.URL
+	for _, addr := range addrs {
+		host := strings.TrimSuffix(addr.Target, ".")
+		uris = append(uris, &url.URL{Scheme: "https", Host: gonet.JoinHostPort(host, strconv.Itoa(int(addr.Port)))})
+	}
+	return uris
+}
+
+// layeredPool combines several sources of orchestrators. Sources are grouped in levels by
+// priority, and the orchestrators of a level are only used when the levels before it did
+// not provide enough of them. Within a level, an orchestrator is used if it is listed by at
+// least quorum of the sources that returned orchestrators, and sources that fail are replaced
+// by the orchestrators that they returned last, so that a failed source doesn't leave the
+// broadcaster without orchestrators
+type layeredPool struct {
+	node   *core.LivepeerNode
+	levels [][]*DiscoverySource
+	quorum int
+
+	mu sync.Mutex
+	// Last orchestrators returned by every source
+	lastURLs map[string][]*url.URL
+}
+
+// NewLayeredPool creates a pool of the orchestrators of sources that are listed by quorum sources of the same priority
+func NewLayeredPool(node *core.LivepeerNode, sources []*DiscoverySource, quorum int) *layeredPool {
+	sorted := append([]*DiscoverySource(nil), sources...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Priority < sorted[j].Priority })
+	var levels [][]*DiscoverySource
+	for i, src := range sorted {
+		if i == 0 || src.Priority != sorted[i-1].Priority {
+			levels = append(levels, nil)
+		}
+		levels[len(levels)-1] = append(levels[len(levels)-1], src)
+	}
+	return &layeredPool{node: node, levels: levels, quorum: quorum, lastURLs: make(map[string][]*url.URL)}
+}
+
+// sourceURLs returns the orchestrators of a source, or the ones that it returned last if it fails
+func (p *layeredPool) sourceURLs(src *DiscoverySource) []*url.URL {
+	uris := src.Source.GetURLs()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(uris) == 0 {
+		uris = p.lastURLs[src.Name]
+		if len(uris) > 0 {
+			glog.Warningf("Using the last known orchestrators of discovery source=%v", src.Name)
+		}
+		return uris
+	}
+	p.lastURLs[src.Name] = uris
+	return uris
+}
+
+// levelURLs returns the orchestrators of a level that are listed by enough of its sources
+func (p *layeredPool) levelURLs(level []*DiscoverySource) []*url.URL {
+	results := make([][]*url.URL, len(level))
+	var wg sync.WaitGroup
+	for i, src := range level {
+		wg.Add(1)
+		go func(i int, src *DiscoverySource) {
+			defer wg.Done()
+			results[i] = p.sourceURLs(src)
+		}(i, src)
+	}
+	wg.Wait()
+
+	var ordered []*url.URL
+	counts := make(map[string]int)
+	answered := 0
+	for _, uris := range results {
+		if len(uris) == 0 {
+			continue
+		}
+		answered++
+		listed := make(map[string]bool)
+		for _, uri := range uris {
+			key := uri.String()
+			if listed[key] {
+				continue
+			}
+			listed[key] = true
+			if counts[key] == 0 {
+				ordered = append(ordered, uri)
+			}
+			counts[key]++
+		}
+	}
+
+	// The quorum can't be reached with the sources that failed
+	quorum := p.quorum
+	if quorum > answered {
+		quorum = answered
+	}
+	var uris []*url.URL
+	for _, uri := range ordered {
+		if counts[uri.String()] >= quorum {
+			uris = append(uris, uri)
+		}
+	}
+	return uris
+}
+
+func (p *layeredPool) GetURLs() []*url.URL {
+	var uris []*url.URL
+	seen := make(map[string]bool)
+	for _, level := range p.levels {
+		for _, uri := range p.levelURLs(level) {
+			if !seen[uri.String()] {
+				seen[uri.String()] = true
+				uris = append(uris, uri)
+			}
+		}
+	}
+	return uris
+}
+
+func (p *layeredPool) GetOrchestrators(numOrchestrators int) ([]*net.OrchestratorInfo, error) {
+	var infos []*net.OrchestratorInfo
+	seen := make(map[string]bool)
+	for _, level := range p.levels {
+		var uris []*url.URL
+		for _, uri := range p.levelURLs(level) {
+			if !seen[uri.String()] {
+				seen[uri.String()] = true
+				uris = append(uris, uri)
+			}
+		}
+		if len(uris) == 0 {
+			continue
+		}
+
+		pool := NewOrchestratorPool(p.node, uris)
+		pool.pred = acceptableOrchInfo(p.node)
+		levelInfos, err := pool.GetOrchestrators(numOrchestrators - len(infos))
+		if err != nil {
+			glog.Errorf("Error getting orchestrators of discovery sources priority=%v: %v", level[0].Priority, err)
+			continue
+		}
+		infos = append(infos, levelInfos...)
+		if len(infos) >= numOrchestrators {
+			break
+		}
+	}
+	return infos, nil
+}
+
+func (p *layeredPool) Size() int {
+	return len(p.GetURLs())
+}
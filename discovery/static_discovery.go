@@ -0,0 +1,257 @@
+package discovery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/go-livepeer/server"
+
+	"github.com/golang/glog"
+)
+
+var staticProbeTimeout = 3 * time.Second
+
+// staticPool is a static list of orchestrators that is reloaded from a file or a URL, so that
+// the orchestrators can be changed without a restart, or that is fixed if there is no source.
+// Only the orchestrators that answered the latest probe or health check are used
+type staticPool struct {
+	node   *core.LivepeerNode
+	bcast  server.Broadcaster
+	source string
+
+	mu      sync.RWMutex
+	uris    []*url.URL
+	healthy map[string]bool
+	// Orchestrators that were checked at least once, whose changes of health are logged
+	checked map[string]struct{}
+	quit    chan struct{}
+}
+
+// NewStaticPool creates a pool of the orchestrators listed by source, which is either the path of
+// a file or an http(s) URL. The list is loaded once StartRefreshing is called
+func NewStaticPool(node *core.LivepeerNode, source string) *staticPool {
+	return &staticPool{
+		node:    node,
+		bcast:   core.NewBroadcaster(node),
+		source:  source,
+		healthy: make(map[string]bool),
+		quit:    make(chan struct{}),
+	}
+}
+
+// NewHealthCheckedPool creates a pool of a fixed list of orchestrators. The orchestrators are only
+// used once they answer a health check, so StartHealthChecks must be called
+func NewHealthCheckedPool(node *core.LivepeerNode, uris []*url.URL) *staticPool {
+	s := NewStaticPool(node, "")
+	s.uris = uris
+	return s
+}
+
+// StartRefreshing reloads the list and probes its orchestrators every interval until
+// StopRefreshing is called
+func (s *staticPool) StartRefreshing(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.refresh()
+		select {
+		case <-ticker.C:
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// StartHealthChecks pings the orchestrators of the list every interval until StopRefreshing is
+// called. Pings are cheaper than the probes of the reloads, so the health of the orchestrators can
+// be checked more often than the list is reloaded
+func (s *staticPool) StartHealthChecks(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.healthCheck()
+		select {
+		case <-ticker.C:
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// StopRefreshing stops the reloads, probes and health checks of the list
+func (s *staticPool) StopRefreshing() {
+	close(s.quit)
+}
+
+func (s *staticPool) refresh() {
+	// The previous list is kept if the list can't be loaded
+	if s.source != "" {
+		if err := s.reload(); err != nil {
+			glog.Errorf("Unable to reload orchestrator list source=%s: %v", s.source, err)
+		}
+	}
+	s.probe()
+}
+
+func (s *staticPool) reload() error {
+	body, err := loadOrchList(s.source)
+	if err != nil {
+		return err
+	}
+	uris := parseOrchList(body)
+	glog.V(common.DEBUG).Infof("Reloaded orchestrator list source=%s orchestrators=%d", s.source, len(uris))
+
+	s.mu.Lock()
+	s.uris = uris
+	s.mu.Unlock()
+	return nil
+}
+
+// loadOrchList reads the list of orchestrators from a file or an http(s) URL
+func loadOrchList(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return ioutil.ReadFile(source)
+	}
+	httpc := &http.Client{Timeout: 3 * time.Second}
+	resp, err := httpc.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("orchestrator list error code=%d", resp.StatusCode)
+	}
+	return body, nil
+}
+
+// probe requests the info of every orchestrator of the list to find out which of them are healthy
+func (s *staticPool) probe() {
+	s.check("probe", func(ctx context.Context, uri *url.URL) error {
+		_, err := serverGetOrchInfo(ctx, s.bcast, uri)
+		return err
+	})
+}
+
+// healthCheck pings every orchestrator of the list to find out which of them are healthy
+func (s *staticPool) healthCheck() {
+	s.check("health check", func(ctx context.Context, uri *url.URL) error {
+		_, err := serverPingOrch(ctx, uri)
+		return err
+	})
+}
+
+// check marks the orchestrators of the list that pass the check as healthy and the others as
+// unhealthy. Changes of the health of an orchestrator are logged
+func (s *staticPool) check(name string, pass func(ctx context.Context, uri *url.URL) error) {
+	s.mu.RLock()
+	uris := s.uris
+	s.mu.RUnlock()
+
+	healthy := make(map[string]bool)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, uri := range uris {
+		wg.Add(1)
+		go func(uri *url.URL) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), staticProbeTimeout)
+			defer cancel()
+			if err := pass(ctx, uri); err != nil {
+				glog.V(common.DEBUG).Infof("Orchestrator failed %s orch=%s: %v", name, uri, err)
+				return
+			}
+			mu.Lock()
+			healthy[uri.String()] = true
+			mu.Unlock()
+		}(uri)
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	for _, uri := range uris {
+		key := uri.String()
+		if _, checked := s.checked[key]; checked && s.healthy[key] != healthy[key] {
+			if healthy[key] {
+				glog.Infof("Orchestrator is healthy again orch=%s", key)
+			} else {
+				glog.Warningf("Orchestrator is unhealthy, failed %s orch=%s", name, key)
+			}
+		}
+	}
+	s.checked = make(map[string]struct{}, len(uris))
+	for _, uri := range uris {
+		s.checked[uri.String()] = struct{}{}
+	}
+	s.healthy = healthy
+	s.mu.Unlock()
+}
+
+// GetURLs returns the orchestrators of the list that answered the latest probe
+func (s *staticPool) GetURLs() []*url.URL {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var uris []*url.URL
+	for _, uri := range s.uris {
+		if s.healthy[uri.String()] {
+			uris = append(uris, uri)
+		}
+	}
+	return uris
+}
+
+func (s *staticPool) Size() int {
+	return len(s.GetURLs())
+}
+
+func (s *staticPool) GetOrchestrators(numOrchestrators int) ([]*net.OrchestratorInfo, error) {
+	uris := s.GetURLs()
+	if len(uris) == 0 {
+		return []*net.OrchestratorInfo{}, nil
+	}
+	return NewOrchestratorPool(s.node, uris).GetOrchestrators(numOrchestrators)
+}
+
+// parseOrchList parses a list of orchestrators, one or more per line separated by commas, in the
+// format of -orchAddr. Empty lines and lines starting with # are ignored
+func parseOrchList(body []byte) []*url.URL {
+	var uris []*url.URL
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, addr := range strings.Split(line, ",") {
+			addr = strings.TrimSpace(addr)
+			if addr == "" {
+				continue
+			}
+			if !strings.HasPrefix(addr, "http") {
+				addr = "https://" + addr
+			}
+			uri, err := url.ParseRequestURI(addr)
+			if err != nil {
+				glog.Error("Could not parse orchestrator URI: ", err)
+				continue
+			}
+			uris = append(uris, uri)
+		}
+	}
+	return uris
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/livepeer/go-livepeer/common"
@@ -31,6 +32,34 @@ type OSSession interface {
 	IsExternal() bool
 }
 
+// ObjectInfo describes data that was saved to an object storage
+type ObjectInfo struct {
+	Name         string
+	LastModified time.Time
+}
+
+// OSPruner is implemented by drivers that can list and delete the data saved to them,
+// e.g. to apply a retention policy
+type OSPruner interface {
+	ListData(prefix string) ([]ObjectInfo, error)
+	DeleteData(names []string) error
+}
+
+// OSReader is implemented by drivers that can read back the data saved to them
+type OSReader interface {
+	ReadData(name string) ([]byte, error)
+}
+
+// StoragePruner returns the OSPruner of a driver if it can delete data. The data saved to an
+// EncryptedOS is deleted from its underlying storage
+func StoragePruner(os OSDriver) (OSPruner, bool) {
+	if eos, ok := os.(*EncryptedOS); ok {
+		os = eos.os
+	}
+	pruner, ok := os.(OSPruner)
+	return pruner, ok
+}
+
 // NewSession returns new session based on OSInfo received from the network
 func NewSession(info *net.OSInfo) OSSession {
 	if info == nil {
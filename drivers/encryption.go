@@ -0,0 +1,266 @@
+package drivers
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+
+	"github.com/livepeer/go-livepeer/net"
+)
+
+// EncryptedDataPath is the path under which the node serves the decrypted data of an EncryptedOS
+const EncryptedDataPath = "/encrypted/"
+
+// Header of the data saved by encrypted sessions, followed by the length of the wrapped data key,
+// the wrapped data key, the nonce and the sealed data
+var encryptedMagic = []byte("LPE1")
+
+// getEncryptedData fetches the encrypted data from the underlying storage. Replaced in tests
+var getEncryptedData = GetSegmentData
+
+// Maximum number of unwrapped data keys that are cached for serving
+const maxCachedDataKeys = 1024
+
+var (
+	errEncryptedData    = errors.New("invalid encrypted data")
+	errNotOwnStorage    = errors.New("encrypted data is not in the node's storage")
+	errMasterKeyLength  = errors.New("master key must be 32 bytes")
+	errWrappedKeyLength = errors.New("wrapped data key too long")
+)
+
+// KeyWrapper wraps and unwraps the data keys of encrypted sessions, e.g. with a KMS or a master key
+type KeyWrapper interface {
+	WrapKey(key []byte) ([]byte, error)
+	UnwrapKey(wrapped []byte) ([]byte, error)
+}
+
+type masterKeyWrapper struct {
+	aead cipher.AEAD
+}
+
+// NewMasterKeyWrapper creates a KeyWrapper that seals data keys with AES-256-GCM under masterKey
+func NewMasterKeyWrapper(masterKey []byte) (KeyWrapper, error) {
+	if len(masterKey) != 32 {
+		return nil, errMasterKeyLength
+	}
+	aead, err := newGCM(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return &masterKeyWrapper{aead: aead}, nil
+}
+
+// ParseMasterKey decodes a hex encoded 32 byte master key
+func ParseMasterKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(s), "0x"))
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, errMasterKeyLength
+	}
+	return key, nil
+}
+
+func (w *masterKeyWrapper) WrapKey(key []byte) ([]byte, error) {
+	return seal(w.aead, key)
+}
+
+func (w *masterKeyWrapper) UnwrapKey(wrapped []byte) ([]byte, error) {
+	return open(w.aead, wrapped)
+}
+
+// EncryptedOS encrypts the data saved by the sessions of another driver with AES-256-GCM.
+// Each session encrypts its data with its own data key, which is wrapped by a KeyWrapper and
+// saved along with the data. The data is served decrypted by the node at EncryptedDataPath
+type EncryptedOS struct {
+	os      OSDriver
+	keys    KeyWrapper
+	baseURI *url.URL
+
+	dataKeys     map[string][]byte
+	dataKeysLock sync.Mutex
+}
+
+type encryptedSession struct {
+	os      *EncryptedOS
+	session OSSession
+	aead    cipher.AEAD
+	wrapped []byte
+	err     error
+}
+
+// NewEncryptedDriver creates a driver that encrypts the data saved to os. The URIs of the
+// saved data are relative to baseURI, which may be nil
+func NewEncryptedDriver(os OSDriver, keys KeyWrapper, baseURI *url.URL) *EncryptedOS {
+	return &EncryptedOS{
+		os:       os,
+		keys:     keys,
+		baseURI:  baseURI,
+		dataKeys: make(map[string][]byte),
+	}
+}
+
+func (eos *EncryptedOS) NewSession(path string) OSSession {
+	session := &encryptedSession{os: eos, session: eos.os.NewSession(path)}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		session.err = err
+	} else if session.wrapped, err = eos.keys.WrapKey(key); err != nil {
+		session.err = err
+	} else if len(session.wrapped) > 0xffff {
+		session.err = errWrappedKeyLength
+	} else {
+		session.aead, session.err = newGCM(key)
+	}
+	if session.err != nil {
+		glog.Errorf("Error creating data key for encrypted session path=%s: %v", path, session.err)
+	}
+	return session
+}
+
+// GetData returns the decrypted data saved by an encrypted session at the URI returned by
+// SaveData, without the base URI and EncryptedDataPath. Also returns the URI of the
+// encrypted data in the underlying storage
+func (eos *EncryptedOS) GetData(name string) ([]byte, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(name)
+	if err != nil {
+		return nil, "", err
+	}
+	uri := string(raw)
+	if !IsOwnExternal(uri) {
+		return nil, "", errNotOwnStorage
+	}
+	data, err := getEncryptedData(uri)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err = eos.decrypt(data)
+	return data, uri, err
+}
+
+// dataURI is the URI that the node serves the decrypted data saved at uri from
+func (eos *EncryptedOS) dataURI(uri string) string {
+	name := EncryptedDataPath + base64.RawURLEncoding.EncodeToString([]byte(uri))
+	if eos.baseURI != nil {
+		return eos.baseURI.String() + name
+	}
+	return name
+}
+
+func (eos *EncryptedOS) decrypt(data []byte) ([]byte, error) {
+	n := len(encryptedMagic)
+	if len(data) < n+2 || string(data[:n]) != string(encryptedMagic) {
+		return nil, errEncryptedData
+	}
+	keyLen := int(binary.BigEndian.Uint16(data[n:]))
+	if len(data) < n+2+keyLen {
+		return nil, errEncryptedData
+	}
+	wrapped, sealed := data[n+2:n+2+keyLen], data[n+2+keyLen:]
+
+	key, err := eos.dataKey(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, sealed)
+}
+
+func (eos *EncryptedOS) dataKey(wrapped []byte) ([]byte, error) {
+	eos.dataKeysLock.Lock()
+	key, ok := eos.dataKeys[string(wrapped)]
+	eos.dataKeysLock.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	key, err := eos.keys.UnwrapKey(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	eos.dataKeysLock.Lock()
+	if len(eos.dataKeys) >= maxCachedDataKeys {
+		eos.dataKeys = make(map[string][]byte)
+	}
+	eos.dataKeys[string(wrapped)] = key
+	eos.dataKeysLock.Unlock()
+	return key, nil
+}
+
+func (s *encryptedSession) SaveData(name string, data []byte) (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	sealed, err := seal(s.aead, data)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, 0, len(encryptedMagic)+2+len(s.wrapped)+len(sealed))
+	buf = append(buf, encryptedMagic...)
+	buf = append(buf, byte(len(s.wrapped)>>8), byte(len(s.wrapped)))
+	buf = append(buf, s.wrapped...)
+	buf = append(buf, sealed...)
+
+	uri, err := s.session.SaveData(name, buf)
+	if err != nil {
+		return "", err
+	}
+	return s.os.dataURI(uri), nil
+}
+
+func (s *encryptedSession) EndSession() {
+	s.session.EndSession()
+}
+
+// GetInfo returns nil so that other nodes don't save plaintext data to the session
+func (s *encryptedSession) GetInfo() *net.OSInfo {
+	return nil
+}
+
+// IsExternal returns false because the data can only be read through the node
+func (s *encryptedSession) IsExternal() bool {
+	return false
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts data with a random nonce that is prepended to the result
+func seal(aead cipher.AEAD, data []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, nil), nil
+}
+
+func open(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errEncryptedData
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", errEncryptedData, err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,176 @@
+package drivers
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/net"
+)
+
+// fakeBucket stores the data of its sessions in memory under S3 URIs
+type fakeBucket struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+type fakeBucketSession struct {
+	bucket *fakeBucket
+	path   string
+}
+
+func (b *fakeBucket) NewSession(path string) OSSession {
+	return &fakeBucketSession{bucket: b, path: path}
+}
+
+func (s *fakeBucketSession) SaveData(name string, data []byte) (string, error) {
+	uri := s3Host(S3BUCKET) + "/" + s.path + "/" + name
+	s.bucket.mu.Lock()
+	defer s.bucket.mu.Unlock()
+	s.bucket.data[uri] = data
+	return uri, nil
+}
+
+func (s *fakeBucketSession) EndSession()          {}
+func (s *fakeBucketSession) GetInfo() *net.OSInfo { return &net.OSInfo{} }
+func (s *fakeBucketSession) IsExternal() bool     { return true }
+
+func (b *fakeBucket) get(uri string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, ok := b.data[uri]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return data, nil
+}
+
+func newTestEncryptedDriver(t *testing.T) (*EncryptedOS, *fakeBucket, func()) {
+	oldBucket, oldGet := S3BUCKET, getEncryptedData
+	S3BUCKET = "testbucket"
+	bucket := &fakeBucket{data: make(map[string][]byte)}
+	getEncryptedData = bucket.get
+
+	keys, err := NewMasterKeyWrapper(bytes.Repeat([]byte{7}, 32))
+	require.Nil(t, err)
+	return NewEncryptedDriver(bucket, keys, nil), bucket, func() {
+		S3BUCKET, getEncryptedData = oldBucket, oldGet
+	}
+}
+
+func TestParseMasterKey(t *testing.T) {
+	assert := assert.New(t)
+
+	key, err := ParseMasterKey("0x" + strings.Repeat("ab", 32))
+	assert.Nil(err)
+	assert.Equal(bytes.Repeat([]byte{0xab}, 32), key)
+
+	_, err = ParseMasterKey(strings.Repeat("ab", 16))
+	assert.Equal(errMasterKeyLength, err)
+
+	_, err = ParseMasterKey("not hex")
+	assert.NotNil(err)
+
+	_, err = NewMasterKeyWrapper([]byte("short"))
+	assert.Equal(errMasterKeyLength, err)
+}
+
+func TestEncryptedOS(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	eos, bucket, cleanup := newTestEncryptedDriver(t)
+	defer cleanup()
+
+	sess := eos.NewSession("stream1")
+	assert.False(sess.IsExternal())
+	assert.Nil(sess.GetInfo())
+
+	uri, err := sess.SaveData("source/1.ts", []byte("segment data"))
+	require.Nil(err)
+	require.True(strings.HasPrefix(uri, EncryptedDataPath))
+
+	// The data is encrypted in the storage
+	stored, err := bucket.get(s3Host(S3BUCKET) + "/stream1/source/1.ts")
+	require.Nil(err)
+	assert.False(bytes.Contains(stored, []byte("segment data")))
+
+	data, storageURI, err := eos.GetData(strings.TrimPrefix(uri, EncryptedDataPath))
+	require.Nil(err)
+	assert.Equal("segment data", string(data))
+	assert.Equal(s3Host(S3BUCKET)+"/stream1/source/1.ts", storageURI)
+
+	// Sessions have their own data keys
+	other := eos.NewSession("stream2")
+	_, err = other.SaveData("source/1.ts", []byte("segment data"))
+	require.Nil(err)
+	otherStored, err := bucket.get(s3Host(S3BUCKET) + "/stream2/source/1.ts")
+	require.Nil(err)
+	n := len(encryptedMagic) + 2
+	assert.NotEqual(stored[n:n+60], otherStored[n:n+60])
+
+	// Data keys are unwrapped by a new driver with the same master key
+	keys, err := NewMasterKeyWrapper(bytes.Repeat([]byte{7}, 32))
+	require.Nil(err)
+	data, _, err = NewEncryptedDriver(bucket, keys, nil).GetData(strings.TrimPrefix(uri, EncryptedDataPath))
+	require.Nil(err)
+	assert.Equal("segment data", string(data))
+
+	// But not with another master key
+	keys, err = NewMasterKeyWrapper(bytes.Repeat([]byte{8}, 32))
+	require.Nil(err)
+	_, _, err = NewEncryptedDriver(bucket, keys, nil).GetData(strings.TrimPrefix(uri, EncryptedDataPath))
+	assert.NotNil(err)
+}
+
+func TestEncryptedOS_BaseURI(t *testing.T) {
+	eos, bucket, cleanup := newTestEncryptedDriver(t)
+	defer cleanup()
+	u, err := url.Parse("https://127.0.0.1:8935")
+	require.Nil(t, err)
+	eos = NewEncryptedDriver(bucket, eos.keys, u)
+
+	uri, err := eos.NewSession("stream1").SaveData("source/1.ts", []byte("segment data"))
+	require.Nil(t, err)
+	assert.True(t, strings.HasPrefix(uri, "https://127.0.0.1:8935"+EncryptedDataPath))
+}
+
+func TestEncryptedOS_InvalidData(t *testing.T) {
+	assert := assert.New(t)
+	eos, bucket, cleanup := newTestEncryptedDriver(t)
+	defer cleanup()
+
+	// Not base64
+	_, _, err := eos.GetData("!!")
+	assert.NotNil(err)
+
+	// Not in the node's storage
+	name := eos.dataURI("https://example.com/stream1/source/1.ts")
+	_, _, err = eos.GetData(strings.TrimPrefix(name, EncryptedDataPath))
+	assert.Equal(errNotOwnStorage, err)
+
+	// Not found
+	name = eos.dataURI(s3Host(S3BUCKET) + "/stream1/source/1.ts")
+	_, _, err = eos.GetData(strings.TrimPrefix(name, EncryptedDataPath))
+	assert.NotNil(err)
+
+	// Not encrypted
+	_, err = bucket.NewSession("stream1").SaveData("source/1.ts", []byte("segment data"))
+	require.Nil(t, err)
+	_, _, err = eos.GetData(strings.TrimPrefix(name, EncryptedDataPath))
+	assert.Equal(errEncryptedData, err)
+
+	// Tampered with
+	uri, err := eos.NewSession("stream1").SaveData("source/1.ts", []byte("segment data"))
+	require.Nil(t, err)
+	stored, err := bucket.get(s3Host(S3BUCKET) + "/stream1/source/1.ts")
+	require.Nil(t, err)
+	stored[len(stored)-1] ^= 0xff
+	_, _, err = eos.GetData(strings.TrimPrefix(uri, EncryptedDataPath))
+	assert.NotNil(err)
+}
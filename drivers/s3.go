@@ -6,8 +6,10 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"mime/multipart"
 	"net/http"
 	"path"
@@ -51,6 +53,11 @@ type s3Session struct {
 	fields      map[string]string
 }
 
+// Maximum number of objects that can be deleted by one S3 request
+const s3DeleteBatchSize = 1000
+
+var errS3Credentials = errors.New("S3 credentials required")
+
 // S3BUCKET s3 bucket owned by this node
 var S3BUCKET string
 
@@ -109,6 +116,67 @@ func (os *s3OS) NewSession(path string) OSSession {
 	return sess
 }
 
+// ListData lists the objects of the bucket whose names start with prefix
+func (os *s3OS) ListData(prefix string) ([]ObjectInfo, error) {
+	if os.s3svc == nil {
+		return nil, errS3Credentials
+	}
+	var objects []ObjectInfo
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(os.bucket),
+		Prefix: aws.String(prefix),
+	}
+	err := os.s3svc.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			objects = append(objects, ObjectInfo{Name: aws.StringValue(obj.Key), LastModified: aws.TimeValue(obj.LastModified)})
+		}
+		return true
+	})
+	return objects, err
+}
+
+// ReadData reads an object of the bucket
+func (os *s3OS) ReadData(name string) ([]byte, error) {
+	if os.s3svc == nil {
+		return nil, errS3Credentials
+	}
+	out, err := os.s3svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(os.bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return ioutil.ReadAll(out.Body)
+}
+
+// DeleteData deletes objects from the bucket
+func (os *s3OS) DeleteData(names []string) error {
+	if os.s3svc == nil {
+		return errS3Credentials
+	}
+	for len(names) > 0 {
+		n := len(names)
+		if n > s3DeleteBatchSize {
+			n = s3DeleteBatchSize
+		}
+		var objects []*s3.ObjectIdentifier
+		for _, name := range names[:n] {
+			objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(name)})
+		}
+		_, err := os.s3svc.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(os.bucket),
+			Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return err
+		}
+		names = names[n:]
+	}
+	return nil
+}
+
 func s3GetFields(sess *s3Session) map[string]string {
 	return map[string]string{
 		"x-amz-algorithm":  "AWS4-HMAC-SHA256",
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"sort"
 	"sync"
 	"time"
 
@@ -49,6 +50,10 @@ type Config struct {
 	WithLogs            bool
 	Topics              []common.Hash
 	Client              Client
+	// Confirmations is the number of blocks that must be mined on top of a block before its events
+	// are emitted. The events of blocks that are removed by a re-org before they are confirmed are
+	// never emitted, and Removed events are only emitted for blocks that were confirmed
+	Confirmations int
 }
 
 // Watcher maintains a consistent representation of the latest `blockRetentionLimit` blocks,
@@ -58,6 +63,9 @@ type Watcher struct {
 	blockRetentionLimit int
 	startBlockDepth     rpc.BlockNumber
 	stack               *Stack
+	store               MiniHeaderStore
+	confirmations       int
+	confirmed           *big.Int // Number of the last block whose Added event was emitted
 	client              Client
 	blockFeed           event.Feed
 	blockScope          event.SubscriptionScope // Subscription scope tracking current live listeners
@@ -78,6 +86,8 @@ func New(config Config) *Watcher {
 		blockRetentionLimit: config.BlockRetentionLimit,
 		startBlockDepth:     config.StartBlockDepth,
 		stack:               stack,
+		store:               config.Store,
+		confirmations:       config.Confirmations,
 		client:              config.Client,
 		withLogs:            config.WithLogs,
 		topics:              config.Topics,
@@ -152,6 +162,9 @@ func (w *Watcher) pollNextBlock() error {
 	if err != nil {
 		return err
 	}
+	if err := w.loadConfirmedBlock(latestHeader); err != nil {
+		return err
+	}
 	if latestHeader == nil {
 		if w.startBlockDepth == rpc.LatestBlockNumber {
 			nextBlockNumber = nil // Fetch latest block
@@ -172,6 +185,13 @@ func (w *Watcher) pollNextBlock() error {
 
 	events := []*Event{}
 	events, err = w.buildCanonicalChain(nextHeader, events)
+	if w.confirmations > 0 {
+		var confirmErr error
+		events, confirmErr = w.confirmEvents(events)
+		if err == nil {
+			err = confirmErr
+		}
+	}
 	// Even if an error occurred, we still want to emit the events gathered since we might have
 	// popped blocks off the Stack and they won't be re-added
 	if len(events) != 0 {
@@ -260,6 +280,68 @@ func (w *Watcher) buildCanonicalChain(nextHeader *MiniHeader, events []*Event) (
 	return events, nil
 }
 
+// loadConfirmedBlock loads the number of the last confirmed block from the store when the watcher
+// waits for confirmations. Without a stored number, the blocks of the stack are considered
+// confirmed, since their events were emitted by a watcher that didn't wait for confirmations
+func (w *Watcher) loadConfirmedBlock(latestHeader *MiniHeader) error {
+	if w.confirmations == 0 || w.confirmed != nil {
+		return nil
+	}
+	confirmed, err := w.store.FindConfirmedBlockNumber()
+	if err != nil {
+		return err
+	}
+	if confirmed == nil && latestHeader != nil {
+		confirmed = latestHeader.Number
+	}
+	w.confirmed = confirmed
+	return nil
+}
+
+// confirmEvents returns the events to emit for the blocks added to and removed from the stack: the
+// Removed events of the confirmed blocks that were removed by a re-org, followed by the Added events
+// of the blocks of the stack that are now confirmed
+func (w *Watcher) confirmEvents(events []*Event) ([]*Event, error) {
+	confirmed := w.confirmed
+	confirmedEvents := []*Event{}
+	for _, event := range events {
+		if confirmed == nil && event.Type == Added {
+			// The first block of the stack is the first block to confirm
+			confirmed = new(big.Int).Sub(event.BlockHeader.Number, big.NewInt(1))
+		}
+		if confirmed != nil && event.Type == Removed && event.BlockHeader.Number.Cmp(confirmed) <= 0 {
+			confirmedEvents = append(confirmedEvents, event)
+			confirmed = new(big.Int).Sub(event.BlockHeader.Number, big.NewInt(1))
+		}
+	}
+	if confirmed == nil {
+		return confirmedEvents, nil
+	}
+
+	headers, err := w.stack.Inspect()
+	if err == nil && len(headers) > 0 {
+		sort.Slice(headers, func(i, j int) bool { return headers[i].Number.Cmp(headers[j].Number) < 0 })
+		head := headers[len(headers)-1].Number.Int64()
+		for _, header := range headers {
+			if header.Number.Cmp(confirmed) > 0 && header.Number.Int64()+int64(w.confirmations) <= head {
+				confirmedEvents = append(confirmedEvents, &Event{
+					Type:        Added,
+					BlockHeader: header,
+				})
+				confirmed = header.Number
+			}
+		}
+	}
+
+	if w.confirmed == nil || confirmed.Cmp(w.confirmed) != 0 {
+		w.confirmed = confirmed
+		if storeErr := w.store.UpdateConfirmedBlockNumber(confirmed); storeErr != nil && err == nil {
+			err = storeErr
+		}
+	}
+	return confirmedEvents, err
+}
+
 func (w *Watcher) addLogs(header *MiniHeader) (*MiniHeader, error) {
 	if !w.withLogs {
 		return header, nil
@@ -290,20 +372,29 @@ func (w *Watcher) getMissedEventsToBackfill(ctx context.Context) ([]*Event, erro
 	if latestRetainedBlock == nil {
 		return events, nil
 	}
+	if err := w.loadConfirmedBlock(latestRetainedBlock); err != nil {
+		return events, err
+	}
 	latestBlock, err := w.client.HeaderByNumber(nil)
 	if err != nil {
 		return events, err
 	}
-	blocksElapsed := big.NewInt(0).Sub(latestBlock.Number, latestRetainedBlock.Number)
-	if blocksElapsed.Int64() == 0 {
+	// When the watcher waits for confirmations, the events are backfilled from the last confirmed
+	// block to the last block that is confirmed now
+	lastProcessedBlock := latestRetainedBlock.Number.Int64()
+	if w.confirmations > 0 && w.confirmed.Int64() < lastProcessedBlock {
+		lastProcessedBlock = w.confirmed.Int64()
+	}
+	blocksElapsed := latestBlock.Number.Int64() - int64(w.confirmations) - lastProcessedBlock
+	if blocksElapsed <= 0 {
 		return events, nil
 	}
 
-	glog.Infof("Some blocks have elapsed since last boot. Backfilling block events (this can take a while)... blocksElapsed=%v", blocksElapsed.Int64())
-	startBlockNum := int(latestRetainedBlock.Number.Int64() + 1)
-	endBlockNum := int(latestRetainedBlock.Number.Int64() + blocksElapsed.Int64())
+	glog.Infof("Some blocks have elapsed since last boot. Backfilling block events (this can take a while)... blocksElapsed=%v", blocksElapsed)
+	startBlockNum := int(lastProcessedBlock + 1)
+	endBlockNum := int(lastProcessedBlock + blocksElapsed)
 	logs, furthestBlockProcessed := w.getLogsInBlockRange(ctx, startBlockNum, endBlockNum)
-	if int64(furthestBlockProcessed) > latestRetainedBlock.Number.Int64() {
+	if int64(furthestBlockProcessed) > lastProcessedBlock {
 		// If we have processed blocks further then the latestRetainedBlock in the DB, we
 		// want to remove all blocks from the DB and insert the furthestBlockProcessed
 		// Doing so will cause the BlockWatcher to start from that furthestBlockProcessed.
@@ -326,6 +417,12 @@ func (w *Watcher) getMissedEventsToBackfill(ctx context.Context) ([]*Event, erro
 		if err != nil {
 			return events, err
 		}
+		if w.confirmations > 0 {
+			w.confirmed = latestHeader.Number
+			if err := w.store.UpdateConfirmedBlockNumber(w.confirmed); err != nil {
+				return events, err
+			}
+		}
 
 		// If no logs found, noop
 		if len(logs) == 0 {
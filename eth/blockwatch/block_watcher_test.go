@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/rpc"
@@ -246,6 +247,150 @@ func TestGetMissedEventsToBackfillNoneMissed(t *testing.T) {
 	assert.Equal(t, big.NewInt(5), headers[0].Number)
 }
 
+// stubChainClient serves the blocks of a chain whose last blocks can be replaced by a re-org
+type stubChainClient struct {
+	byNumber map[uint64]*MiniHeader
+	byHash   map[common.Hash]*MiniHeader
+	head     uint64
+	queries  []ethereum.FilterQuery
+}
+
+func newStubChainClient() *stubChainClient {
+	return &stubChainClient{byNumber: make(map[uint64]*MiniHeader), byHash: make(map[common.Hash]*MiniHeader)}
+}
+
+// mine adds the blocks from to to of a fork to the chain, replacing its blocks from from on
+func (c *stubChainClient) mine(fork string, from, to uint64) {
+	for n := from; n <= to; n++ {
+		header := &MiniHeader{
+			Number: new(big.Int).SetUint64(n),
+			Hash:   common.BytesToHash([]byte(fmt.Sprintf("%s%d", fork, n))),
+		}
+		if parent, ok := c.byNumber[n-1]; ok {
+			header.Parent = parent.Hash
+		}
+		c.byNumber[n] = header
+		c.byHash[header.Hash] = header
+	}
+	c.head = to
+}
+
+func (c *stubChainClient) HeaderByNumber(number *big.Int) (*MiniHeader, error) {
+	n := c.head
+	if number != nil {
+		n = number.Uint64()
+	}
+	header, ok := c.byNumber[n]
+	if !ok || n > c.head {
+		return nil, ethereum.NotFound
+	}
+	return header, nil
+}
+
+func (c *stubChainClient) HeaderByHash(hash common.Hash) (*MiniHeader, error) {
+	header, ok := c.byHash[hash]
+	if !ok {
+		return nil, ethereum.NotFound
+	}
+	return header, nil
+}
+
+func (c *stubChainClient) FilterLogs(q ethereum.FilterQuery) ([]types.Log, error) {
+	c.queries = append(c.queries, q)
+	return nil, nil
+}
+
+func TestWatcher_Confirmations(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	client := newStubChainClient()
+	client.mine("a", 1, 1)
+	store := &stubMiniHeaderStore{}
+	cfg := config
+	cfg.Store = store
+	cfg.Client = client
+	cfg.Confirmations = 2
+	watcher := New(cfg)
+
+	events := make(chan []*Event, 10)
+	sub := watcher.Subscribe(events)
+	defer sub.Unsubscribe()
+	poll := func() []*Event {
+		require.Nil(watcher.pollNextBlock())
+		select {
+		case evts := <-events:
+			return evts
+		default:
+			return nil
+		}
+	}
+	added := func(header *MiniHeader) *Event {
+		return &Event{Type: Added, BlockHeader: header}
+	}
+
+	// Blocks are emitted once 2 blocks are mined on top of them
+	assert.Empty(poll())
+	client.mine("a", 2, 3)
+	assert.Empty(poll())
+	assert.Equal([]*Event{added(client.byNumber[1])}, poll())
+	assert.Equal(big.NewInt(1), store.confirmed)
+
+	// Blocks that are removed before they are confirmed are never emitted
+	client.mine("b", 3, 4)
+	assert.Equal([]*Event{added(client.byNumber[2])}, poll())
+	assert.Equal(big.NewInt(2), store.confirmed)
+
+	// Confirmed blocks that are removed by a deeper re-org are removed
+	removed := client.byNumber[2]
+	client.mine("c", 2, 5)
+	assert.Equal([]*Event{
+		{Type: Removed, BlockHeader: removed},
+		added(client.byNumber[2]),
+		added(client.byNumber[3]),
+	}, poll())
+	assert.Equal(big.NewInt(3), store.confirmed)
+
+	// The last confirmed block is kept across restarts
+	watcher = New(cfg)
+	sub2 := watcher.Subscribe(events)
+	defer sub2.Unsubscribe()
+	client.mine("c", 6, 6)
+	assert.Equal([]*Event{added(client.byNumber[4])}, poll())
+}
+
+func TestGetMissedEventsToBackfill_Confirmations(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	client := newStubChainClient()
+	client.mine("a", 1, 10)
+	store := &stubMiniHeaderStore{confirmed: big.NewInt(3)}
+	for n := uint64(1); n <= 5; n++ {
+		require.Nil(store.InsertMiniHeader(client.byNumber[n]))
+	}
+	cfg := config
+	cfg.Store = store
+	cfg.Client = client
+	cfg.Confirmations = 2
+	watcher := New(cfg)
+
+	// The logs are backfilled from the last confirmed block to the last block that is confirmed
+	_, err := watcher.getMissedEventsToBackfill(context.Background())
+	require.Nil(err)
+	require.Len(client.queries, 1)
+	assert.Equal(big.NewInt(4), client.queries[0].FromBlock)
+	assert.Equal(big.NewInt(8), client.queries[0].ToBlock)
+	assert.Equal([]*MiniHeader{client.byNumber[8]}, store.headers)
+	assert.Equal(big.NewInt(8), store.confirmed)
+
+	// Nothing is backfilled until more blocks are confirmed
+	client.queries = nil
+	_, err = watcher.getMissedEventsToBackfill(context.Background())
+	require.Nil(err)
+	assert.Empty(client.queries)
+}
+
 var logStub = types.Log{
 	Address: common.HexToAddress("0x21ab6c9fac80c59d401b37cb43f81ea9dde7fe34"),
 	Topics: []common.Hash{
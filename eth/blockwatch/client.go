@@ -44,6 +44,12 @@ func NewRPCClient(rpcURL string, requestTimeout time.Duration) (*RPCClient, erro
 	return &RPCClient{rpcClient: rpcClient, client: ethClient, requestTimeout: requestTimeout}, nil
 }
 
+// NewRPCClientWithRPC returns a new Client for fetching Ethereum blocks using an existing
+// rpc.Client, e.g. one whose requests fail over between several endpoints.
+func NewRPCClientWithRPC(rpcClient *rpc.Client, requestTimeout time.Duration) *RPCClient {
+	return &RPCClient{rpcClient: rpcClient, client: ethclient.NewClient(rpcClient), requestTimeout: requestTimeout}
+}
+
 type getBlockByNumberResponse struct {
 	Hash       common.Hash `json:"hash"`
 	ParentHash common.Hash `json:"parentHash"`
@@ -22,6 +22,10 @@ type MiniHeaderStore interface {
 	FindAllMiniHeadersSortedByNumber() ([]*MiniHeader, error)
 	InsertMiniHeader(header *MiniHeader) error
 	DeleteMiniHeader(hash ethcommon.Hash) error
+	// FindConfirmedBlockNumber returns the number of the last block whose events were emitted after
+	// it was confirmed, or nil if no block was confirmed yet
+	FindConfirmedBlockNumber() (*big.Int, error)
+	UpdateConfirmedBlockNumber(number *big.Int) error
 }
 
 // Stack allows performing basic stack operations on a stack of MiniHeaders.
@@ -71,7 +75,13 @@ func (s *Stack) Push(header *MiniHeader) error {
 		return err
 	}
 	if len(miniHeaders) == s.limit {
+		// Stores don't agree on the order of the headers, so the oldest one is found by its number
 		oldestMiniHeader := miniHeaders[0]
+		for _, header := range miniHeaders {
+			if header.Number.Cmp(oldestMiniHeader.Number) < 0 {
+				oldestMiniHeader = header
+			}
+		}
 		if err := s.store.DeleteMiniHeader(oldestMiniHeader.Hash); err != nil {
 			return err
 		}
@@ -2,6 +2,7 @@ package blockwatch
 
 import (
 	"errors"
+	"math/big"
 	"sync"
 	"testing"
 
@@ -16,6 +17,7 @@ type stubMiniHeaderStore struct {
 	sortedByNumberErr error
 	insertErr         error
 	deleteErr         error
+	confirmed         *big.Int
 }
 
 func (s *stubMiniHeaderStore) FindLatestMiniHeader() (*MiniHeader, error) {
@@ -65,6 +67,15 @@ func (s *stubMiniHeaderStore) DeleteMiniHeader(hash ethcommon.Hash) error {
 	return errors.New("MiniHeader not found")
 }
 
+func (s *stubMiniHeaderStore) FindConfirmedBlockNumber() (*big.Int, error) {
+	return s.confirmed, nil
+}
+
+func (s *stubMiniHeaderStore) UpdateConfirmedBlockNumber(number *big.Int) error {
+	s.confirmed = number
+	return nil
+}
+
 func TestPop(t *testing.T) {
 	store := &stubMiniHeaderStore{}
 	stack := NewStack(store, 10)
@@ -170,16 +181,16 @@ func TestPush(t *testing.T) {
 
 	// Test when store.FindAllMiniHeadersSortedByNumber() returns error
 	store.sortedByNumberErr = errors.New("FindAllMiniHeadersSortedByNumber error")
-	h0 := &MiniHeader{Hash: ethcommon.BytesToHash([]byte("h0"))}
+	h0 := &MiniHeader{Hash: ethcommon.BytesToHash([]byte("h0")), Number: big.NewInt(0)}
 	err := stack.Push(h0)
 	assert.EqualError(err, store.sortedByNumberErr.Error())
 
 	// Test stack at limit and store.DeleteMiniHeader() returns error
-	h1 := &MiniHeader{Hash: ethcommon.BytesToHash([]byte("h1"))}
+	h1 := &MiniHeader{Hash: ethcommon.BytesToHash([]byte("h1")), Number: big.NewInt(1)}
 	require.Nil(store.InsertMiniHeader(h0))
 	require.Nil(store.InsertMiniHeader(h1))
 
-	h2 := &MiniHeader{Hash: ethcommon.BytesToHash([]byte("h2"))}
+	h2 := &MiniHeader{Hash: ethcommon.BytesToHash([]byte("h2")), Number: big.NewInt(2)}
 	store.sortedByNumberErr = nil
 	store.deleteErr = errors.New("DeleteMiniHeader error")
 	err = stack.Push(h2)
@@ -197,7 +208,7 @@ func TestPush(t *testing.T) {
 	store.insertErr = nil
 	require.Nil(store.InsertMiniHeader(h2))
 
-	h3 := &MiniHeader{Hash: ethcommon.BytesToHash([]byte("h3"))}
+	h3 := &MiniHeader{Hash: ethcommon.BytesToHash([]byte("h3")), Number: big.NewInt(3)}
 	err = stack.Push(h3)
 	assert.Nil(err)
 	assert.Equal(h3, store.headers[len(store.headers)-1])
@@ -207,7 +218,7 @@ func TestPush(t *testing.T) {
 	// Test stack not at limit and store.InsertMiniHeader() returns error
 	require.Nil(store.DeleteMiniHeader(h2.Hash))
 
-	h4 := &MiniHeader{Hash: ethcommon.BytesToHash([]byte("h4"))}
+	h4 := &MiniHeader{Hash: ethcommon.BytesToHash([]byte("h4")), Number: big.NewInt(4)}
 	store.insertErr = errors.New("InsertMiniHeader error")
 	err = stack.Push(h4)
 	assert.EqualError(err, store.insertErr.Error())
@@ -218,6 +229,13 @@ func TestPush(t *testing.T) {
 	assert.Nil(err)
 	assert.Equal(h4, store.headers[len(store.headers)-1])
 	assert.Equal(2, len(store.headers))
+
+	// Test stack at limit of a store that sorts the headers in descending order
+	store.headers = []*MiniHeader{h4, h3}
+	h5 := &MiniHeader{Hash: ethcommon.BytesToHash([]byte("h5")), Number: big.NewInt(5)}
+	err = stack.Push(h5)
+	assert.Nil(err)
+	assert.Equal([]*MiniHeader{h4, h5}, store.headers)
 }
 
 func TestPushConcurrent(t *testing.T) {
@@ -233,7 +251,7 @@ func TestPushConcurrent(t *testing.T) {
 
 	// Insert headers into store
 	for i := 0; i < 10; i++ {
-		require.Nil(store.InsertMiniHeader(&MiniHeader{Hash: headerHash(i)}))
+		require.Nil(store.InsertMiniHeader(&MiniHeader{Hash: headerHash(i), Number: big.NewInt(int64(i))}))
 	}
 
 	// Create headerMap with expected entries after all stack pushes are complete
@@ -246,7 +264,7 @@ func TestPushConcurrent(t *testing.T) {
 	wg.Add(10)
 	for i := 10; i < 20; i++ {
 		go func(i int) {
-			err := stack.Push(&MiniHeader{Hash: headerHash(i)})
+			err := stack.Push(&MiniHeader{Hash: headerHash(i), Number: big.NewInt(int64(i))})
 			require.Nil(err)
 
 			wg.Done()
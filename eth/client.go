@@ -111,6 +111,7 @@ type LivepeerEthClient interface {
 	ContractAddresses() map[string]ethcommon.Address
 	CheckTx(*types.Transaction) error
 	ReplaceTransaction(*types.Transaction, string, *big.Int) (*types.Transaction, error)
+	TxQueue() *TxQueue
 	Sign([]byte) ([]byte, error)
 	GetGasInfo() (uint64, *big.Int)
 	SetGasInfo(uint64, *big.Int) error
@@ -119,6 +120,10 @@ type LivepeerEthClient interface {
 type client struct {
 	accountManager AccountManager
 	backend        *ethclient.Client
+	// Prices the transactions of the node instead of the suggestions of the backend, if not nil
+	gpo GasPriceOracle
+	// All the transactions of the node are sent through the queue
+	txQueue *TxQueue
 
 	controllerAddr      ethcommon.Address
 	tokenAddr           ethcommon.Address
@@ -147,18 +152,24 @@ type client struct {
 	txTimeout time.Duration
 }
 
-func NewClient(accountAddr ethcommon.Address, keystoreDir string, backend *ethclient.Client, controllerAddr ethcommon.Address, txTimeout time.Duration) (LivepeerEthClient, error) {
+func NewClient(accountAddr ethcommon.Address, keystoreDir string, backend *ethclient.Client, controllerAddr ethcommon.Address, txTimeout time.Duration, gpo GasPriceOracle) (LivepeerEthClient, error) {
 	am, err := NewAccountManager(accountAddr, keystoreDir)
 	if err != nil {
 		return nil, err
 	}
 
-	return &client{
+	c := &client{
 		accountManager: am,
 		backend:        backend,
 		controllerAddr: controllerAddr,
 		txTimeout:      txTimeout,
-	}, nil
+		gpo:            gpo,
+	}
+	c.txQueue = NewTxQueue(backend, backend, func(tx *types.Transaction) (*types.Transaction, error) {
+		return c.ReplaceTransaction(tx, "stuck transaction", nil)
+	})
+
+	return c, nil
 }
 
 func (c *client) Setup(password string, gasLimit uint64, gasPrice *big.Int) error {
@@ -176,7 +187,7 @@ func (c *client) SetGasInfo(gasLimit uint64, gasPrice *big.Int) error {
 		return err
 	}
 
-	opts.NonceManager = NewNonceManager(c.backend)
+	opts.NonceManager = c.txQueue
 
 	if err := c.setContracts(opts); err != nil {
 		return err
@@ -191,8 +202,21 @@ func (c *client) GetGasInfo() (gasLimit uint64, gasPrice *big.Int) {
 	return c.gasLimit, c.gasPrice
 }
 
+// contractBackend returns the backend of the contract bindings, which prices the transactions
+// that don't have a gas price with the gas price oracle of the client, if any, and sends them
+// through the transaction queue of the client
+func (c *client) contractBackend() bind.ContractBackend {
+	var backend bind.ContractBackend = c.backend
+	if c.gpo != nil {
+		backend = &pricedBackend{Client: c.backend, gpo: c.gpo}
+	}
+	return &queuedBackend{ContractBackend: backend, q: c.txQueue}
+}
+
 func (c *client) setContracts(opts *bind.TransactOpts) error {
-	controller, err := contracts.NewController(c.controllerAddr, c.backend)
+	backend := c.contractBackend()
+
+	controller, err := contracts.NewController(c.controllerAddr, backend)
 	if err != nil {
 		glog.Errorf("Error creating Controller binding: %v", err)
 		return err
@@ -213,7 +237,7 @@ func (c *client) setContracts(opts *bind.TransactOpts) error {
 
 	c.tokenAddr = tokenAddr
 
-	token, err := contracts.NewLivepeerToken(tokenAddr, c.backend)
+	token, err := contracts.NewLivepeerToken(tokenAddr, backend)
 	if err != nil {
 		glog.Errorf("Error creating LivpeerToken binding: %v", err)
 		return err
@@ -234,7 +258,7 @@ func (c *client) setContracts(opts *bind.TransactOpts) error {
 
 	c.serviceRegistryAddr = serviceRegistryAddr
 
-	serviceRegistry, err := contracts.NewServiceRegistry(serviceRegistryAddr, c.backend)
+	serviceRegistry, err := contracts.NewServiceRegistry(serviceRegistryAddr, backend)
 	if err != nil {
 		glog.Errorf("Error creating ServiceRegistry binding: %v", err)
 		return err
@@ -255,7 +279,7 @@ func (c *client) setContracts(opts *bind.TransactOpts) error {
 
 	c.bondingManagerAddr = bondingManagerAddr
 
-	bondingManager, err := contracts.NewBondingManager(bondingManagerAddr, c.backend)
+	bondingManager, err := contracts.NewBondingManager(bondingManagerAddr, backend)
 	if err != nil {
 		glog.Errorf("Error creating BondingManager binding: %v", err)
 		return err
@@ -276,7 +300,7 @@ func (c *client) setContracts(opts *bind.TransactOpts) error {
 
 	c.ticketBrokerAddr = brokerAddr
 
-	broker, err := contracts.NewTicketBroker(brokerAddr, c.backend)
+	broker, err := contracts.NewTicketBroker(brokerAddr, backend)
 	if err != nil {
 		glog.Errorf("Error creating TicketBroker binding: %v", err)
 		return err
@@ -297,7 +321,7 @@ func (c *client) setContracts(opts *bind.TransactOpts) error {
 
 	c.roundsManagerAddr = roundsManagerAddr
 
-	roundsManager, err := contracts.NewRoundsManager(roundsManagerAddr, c.backend)
+	roundsManager, err := contracts.NewRoundsManager(roundsManagerAddr, backend)
 	if err != nil {
 		glog.Errorf("Error creating RoundsManager binding: %v", err)
 		return err
@@ -318,7 +342,7 @@ func (c *client) setContracts(opts *bind.TransactOpts) error {
 
 	c.minterAddr = minterAddr
 
-	minter, err := contracts.NewMinter(minterAddr, c.backend)
+	minter, err := contracts.NewMinter(minterAddr, backend)
 	if err != nil {
 		glog.Errorf("Error creating Minter binding: %v", err)
 		return err
@@ -339,7 +363,7 @@ func (c *client) setContracts(opts *bind.TransactOpts) error {
 
 	c.verifierAddr = verifierAddr
 
-	verifier, err := contracts.NewLivepeerVerifier(verifierAddr, c.backend)
+	verifier, err := contracts.NewLivepeerVerifier(verifierAddr, backend)
 	if err != nil {
 		glog.Errorf("Error creating LivepeerVerifier binding: %v", err)
 		return err
@@ -360,7 +384,7 @@ func (c *client) setContracts(opts *bind.TransactOpts) error {
 
 	c.faucetAddr = faucetAddr
 
-	faucet, err := contracts.NewLivepeerTokenFaucet(faucetAddr, c.backend)
+	faucet, err := contracts.NewLivepeerTokenFaucet(faucetAddr, backend)
 	if err != nil {
 		glog.Errorf("Error creating LivepeerTokenFaucet binding: %v", err)
 		return err
@@ -763,7 +787,8 @@ func (c *client) CheckTx(tx *types.Transaction) error {
 	ctx, cancel := context.WithTimeout(context.Background(), c.txTimeout)
 	defer cancel()
 
-	receipt, err := bind.WaitMined(ctx, c.backend, tx)
+	// The transaction might have been replaced by the queue if it got stuck
+	receipt, err := c.txQueue.WaitMined(ctx, tx)
 	if err != nil {
 		return err
 	}
@@ -775,6 +800,11 @@ func (c *client) CheckTx(tx *types.Transaction) error {
 	}
 }
 
+// TxQueue returns the queue that the transactions of the client are sent through
+func (c *client) TxQueue() *TxQueue {
+	return c.txQueue
+}
+
 func (c *client) Sign(msg []byte) ([]byte, error) {
 	return c.accountManager.Sign(msg)
 }
@@ -803,7 +833,11 @@ func (c *client) ReplaceTransaction(tx *types.Transaction, method string, gasPri
 	if gasPrice == nil {
 		gasPrice = minGasPrice
 
-		suggestedGasPrice, err := c.backend.SuggestGasPrice(context.Background())
+		var gpo GasPriceOracle = c.backend
+		if c.gpo != nil {
+			gpo = c.gpo
+		}
+		suggestedGasPrice, err := gpo.SuggestGasPrice(context.Background())
 		if err != nil {
 			return nil, err
 		}
@@ -832,7 +866,7 @@ func (c *client) ReplaceTransaction(tx *types.Transaction, method string, gasPri
 		return nil, err
 	}
 
-	err = c.backend.SendTransaction(context.Background(), newSignedTx)
+	err = c.txQueue.Resubmit(context.Background(), newSignedTx)
 	if err == nil {
 		glog.Infof("\n%vEth Transaction%v\n\nReplacement transaction: \"%v\".  Hash: \"%v\".  Gas Price: %v \n\n%v\n", strings.Repeat("*", 30), strings.Repeat("*", 30), method, newSignedTx.Hash().String(), newSignedTx.GasPrice().String(), strings.Repeat("*", 75))
 	} else {
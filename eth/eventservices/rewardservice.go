@@ -1,13 +1,22 @@
 package eventservices
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
+	"net/http"
 	"time"
 
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/eth"
+	"github.com/livepeer/go-livepeer/eth/watchers"
+	"github.com/livepeer/go-livepeer/monitor"
 )
 
 var (
@@ -15,18 +24,58 @@ var (
 	ErrRewardServiceStopped = fmt.Errorf("reward service already stopped")
 
 	TryRewardPollingInterval = time.Minute * 30 // Poll to try to call reward once 30 minutes
+
+	// Failed attempts to call reward are retried after TryRewardRetryInterval, doubled after every
+	// failure up to TryRewardPollingInterval
+	TryRewardRetryInterval = time.Minute
+	// RewardDeadlineCheckInterval is how often the service checks whether reward was called before the
+	// alert window of the round
+	RewardDeadlineCheckInterval = time.Minute * 5
 )
 
+var rewardAlertClient = &http.Client{Timeout: common.HTTPTimeout}
+
+// RewardServiceConfig are the alerting settings of a RewardService
+type RewardServiceConfig struct {
+	// BlockNums is the source of the last seen block, which is compared with the end of the round
+	BlockNums eth.BlockNumReader
+	// AlertWindow is the number of blocks before the end of a round from which an alert is raised if
+	// reward was not called in the round yet, or 0 to never raise alerts
+	AlertWindow int64
+	// AlertWebhookURL is posted a RewardAlert for every alert, if set
+	AlertWebhookURL string
+}
+
+// RewardAlert is posted to the alert webhook when reward was not called close to the end of a round
+type RewardAlert struct {
+	Orchestrator    string `json:"orchestrator"`
+	Round           int64  `json:"round"`
+	LastRewardRound int64  `json:"lastRewardRound"`
+	// BlocksLeft is the number of blocks until the end of the round
+	BlocksLeft int64 `json:"blocksLeft"`
+	Time       int64 `json:"time"`
+}
+
 type RewardService struct {
 	client       eth.LivepeerEthClient
+	events       watchers.ProtocolEventSubscriber
+	cfg          RewardServiceConfig
 	pendingTx    *types.Transaction
 	working      bool
 	cancelWorker context.CancelFunc
+
+	// alertedRound is the last round that an alert was raised for
+	alertedRound *big.Int
 }
 
-func NewRewardService(client eth.LivepeerEthClient) *RewardService {
+// NewRewardService creates a RewardService that tries to call reward when a NewRound event is received
+// from events, and at every polling interval in case an attempt failed. events can be nil, in which
+// case reward is only tried at every polling interval
+func NewRewardService(client eth.LivepeerEthClient, events watchers.ProtocolEventSubscriber, cfg RewardServiceConfig) *RewardService {
 	return &RewardService{
 		client: client,
+		events: events,
+		cfg:    cfg,
 	}
 }
 
@@ -40,14 +89,73 @@ func (s *RewardService) Start(ctx context.Context) error {
 
 	tickCh := time.NewTicker(TryRewardPollingInterval).C
 
+	var (
+		events chan *watchers.ProtocolEvent
+		sub    event.Subscription
+		subErr <-chan error
+	)
+	if s.events != nil {
+		events = make(chan *watchers.ProtocolEvent, 10)
+		sub = s.events.Subscribe(events)
+		subErr = sub.Err()
+	}
+
+	var deadlineTicker *time.Ticker
+	var deadlineCh <-chan time.Time
+	if s.cfg.AlertWindow > 0 && s.cfg.BlockNums != nil {
+		deadlineTicker = time.NewTicker(RewardDeadlineCheckInterval)
+		deadlineCh = deadlineTicker.C
+	}
+
+	minRetryInterval, maxRetryInterval := TryRewardRetryInterval, TryRewardPollingInterval
+
 	go func(ctx context.Context) {
+		if sub != nil {
+			defer sub.Unsubscribe()
+		}
+		if deadlineTicker != nil {
+			defer deadlineTicker.Stop()
+		}
+
+		// Failed attempts are retried with a backoff until an attempt succeeds
+		var retryCh <-chan time.Time
+		retryInterval := minRetryInterval
+		try := func() {
+			err := s.tryReward()
+			if err == nil {
+				retryCh, retryInterval = nil, minRetryInterval
+				return
+			}
+			glog.Errorf("Error trying to call reward, retrying in %v: %v", retryInterval, err)
+			if monitor.Enabled {
+				monitor.RewardCallError()
+			}
+			retryCh = time.After(retryInterval)
+			if retryInterval *= 2; retryInterval > maxRetryInterval {
+				retryInterval = maxRetryInterval
+			}
+		}
+
+		// Try at once, so that a restarted node doesn't wait for the next polling interval
+		try()
 		for {
 			select {
 			case <-tickCh:
-				err := s.tryReward()
-				if err != nil {
-					glog.Errorf("Error trying to call reward: %v", err)
+				try()
+			case <-retryCh:
+				try()
+			case ev := <-events:
+				if ev.Name != "NewRound" || ev.Removed {
+					continue
+				}
+				try()
+			case <-deadlineCh:
+				if err := s.checkRewardDeadline(); err != nil {
+					glog.Errorf("Error checking whether reward was called: %v", err)
 				}
+			case <-subErr:
+				// The event bus is stopped, fall back to polling
+				events, subErr = nil, nil
 			case <-ctx.Done():
 				glog.V(5).Infof("Reward service done")
 				return
@@ -96,7 +204,12 @@ func (s *RewardService) tryReward() error {
 		return err
 	}
 
-	if t.LastRewardRound.Cmp(currentRound) == -1 && initialized && active {
+	if !active {
+		glog.V(common.DEBUG).Infof("Not calling reward for round %v: not in the active set", currentRound)
+		return nil
+	}
+
+	if t.LastRewardRound.Cmp(currentRound) == -1 && initialized {
 		var (
 			tx  *types.Transaction
 			err error
@@ -145,8 +258,98 @@ func (s *RewardService) tryReward() error {
 
 		glog.Infof("Called reward for round %v - %v rewards minted", currentRound, eth.FormatUnits(tp.RewardPool, "LPTU"))
 
+		if monitor.Enabled {
+			monitor.RewardCalled()
+		}
+
+		return nil
+	}
+
+	return nil
+}
+
+// checkRewardDeadline raises an alert, once per round, if reward was not called in the current round
+// and the end of the round is less than the alert window away
+func (s *RewardService) checkRewardDeadline() error {
+	currentRound, err := s.client.CurrentRound()
+	if err != nil {
+		return err
+	}
+
+	if s.alertedRound != nil && s.alertedRound.Cmp(currentRound) == 0 {
+		return nil
+	}
+
+	t, err := s.client.GetTranscoder(s.client.Account().Address)
+	if err != nil {
+		return err
+	}
+	if t.LastRewardRound.Cmp(currentRound) >= 0 {
+		return nil
+	}
+
+	active, err := s.client.IsActiveTranscoder()
+	if err != nil {
+		return err
+	}
+	if !active {
+		return nil
+	}
+
+	startBlk, err := s.client.CurrentRoundStartBlock()
+	if err != nil {
+		return err
+	}
+	roundLength, err := s.client.RoundLength()
+	if err != nil {
+		return err
+	}
+	blk, err := s.cfg.BlockNums.LastSeenBlock()
+	if err != nil {
+		return err
+	}
+
+	blocksLeft := new(big.Int).Add(startBlk, roundLength)
+	blocksLeft.Sub(blocksLeft, blk)
+	if blocksLeft.Cmp(big.NewInt(s.cfg.AlertWindow)) > 0 {
 		return nil
 	}
 
+	s.alertedRound = currentRound
+	alert := &RewardAlert{
+		Orchestrator:    monitor.RedactAddress(s.client.Account().Address),
+		Round:           currentRound.Int64(),
+		LastRewardRound: t.LastRewardRound.Int64(),
+		BlocksLeft:      blocksLeft.Int64(),
+		Time:            time.Now().Unix(),
+	}
+	glog.Errorf("Reward was not called for round %v, which ends in %v blocks", alert.Round, alert.BlocksLeft)
+	if monitor.Enabled {
+		monitor.RewardAlert()
+	}
+	if s.cfg.AlertWebhookURL != "" {
+		go func() {
+			if err := s.postAlert(alert); err != nil {
+				glog.Errorf("Unable to notify reward alert webhook round=%v: %v", alert.Round, err)
+			}
+		}()
+	}
+
+	return nil
+}
+
+func (s *RewardService) postAlert(alert *RewardAlert) error {
+	jsonValue, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	resp, err := rewardAlertClient.Post(s.cfg.AlertWebhookURL, "application/json", bytes.NewBuffer(jsonValue))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
 	return nil
 }
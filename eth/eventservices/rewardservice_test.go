@@ -0,0 +1,150 @@
+package eventservices
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/livepeer/go-livepeer/eth"
+	lpTypes "github.com/livepeer/go-livepeer/eth/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubRewardClient is an orchestrator in round 10, which started at block 100 and lasts 50 blocks
+type stubRewardClient struct {
+	eth.StubClient
+
+	mu              sync.Mutex
+	lastRewardRound int64
+	active          bool
+	roundErr        error
+	roundCalls      int
+}
+
+func (c *stubRewardClient) Account() accounts.Account {
+	return accounts.Account{Address: ethcommon.HexToAddress("0x01")}
+}
+
+func (c *stubRewardClient) CurrentRound() (*big.Int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.roundCalls++
+	return big.NewInt(10), c.roundErr
+}
+
+func (c *stubRewardClient) CurrentRoundStartBlock() (*big.Int, error) { return big.NewInt(100), nil }
+func (c *stubRewardClient) RoundLength() (*big.Int, error)            { return big.NewInt(50), nil }
+
+func (c *stubRewardClient) GetTranscoder(addr ethcommon.Address) (*lpTypes.Transcoder, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &lpTypes.Transcoder{LastRewardRound: big.NewInt(c.lastRewardRound)}, nil
+}
+
+func (c *stubRewardClient) IsActiveTranscoder() (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.active, nil
+}
+
+type stubBlockNumReader struct {
+	blkNum *big.Int
+}
+
+func (r *stubBlockNumReader) LastSeenBlock() (*big.Int, error) {
+	return r.blkNum, nil
+}
+
+func TestRewardService_CheckRewardDeadline(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	alerts := make(chan *RewardAlert, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert RewardAlert
+		require.Nil(json.NewDecoder(r.Body).Decode(&alert))
+		alerts <- &alert
+	}))
+	defer ts.Close()
+
+	client := &stubRewardClient{lastRewardRound: 9, active: true}
+	blkNums := &stubBlockNumReader{blkNum: big.NewInt(130)}
+	s := NewRewardService(client, nil, RewardServiceConfig{BlockNums: blkNums, AlertWindow: 10, AlertWebhookURL: ts.URL})
+
+	// No alert before the alert window
+	require.Nil(s.checkRewardDeadline())
+	assert.Nil(s.alertedRound)
+
+	// No alert if reward was called, or if the orchestrator is not active
+	blkNums.blkNum = big.NewInt(145)
+	client.lastRewardRound = 10
+	require.Nil(s.checkRewardDeadline())
+	client.lastRewardRound, client.active = 9, false
+	require.Nil(s.checkRewardDeadline())
+	assert.Nil(s.alertedRound)
+
+	// Alerts are raised once per round
+	client.active = true
+	require.Nil(s.checkRewardDeadline())
+	require.Nil(s.checkRewardDeadline())
+	assert.Equal(big.NewInt(10), s.alertedRound)
+	select {
+	case alert := <-alerts:
+		assert.Equal(int64(10), alert.Round)
+		assert.Equal(int64(9), alert.LastRewardRound)
+		assert.Equal(int64(5), alert.BlocksLeft)
+		assert.Equal(ethcommon.HexToAddress("0x01").Hex(), alert.Orchestrator)
+	case <-time.After(time.Second):
+		t.Fatal("alert not posted")
+	}
+	select {
+	case <-alerts:
+		t.Fatal("alert posted twice")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Errors are returned
+	client.roundErr = errors.New("CurrentRound error")
+	s.alertedRound = nil
+	assert.EqualError(s.checkRewardDeadline(), "CurrentRound error")
+}
+
+func TestRewardService_Retry(t *testing.T) {
+	assert := assert.New(t)
+	oldRetry, oldPolling := TryRewardRetryInterval, TryRewardPollingInterval
+	defer func() { TryRewardRetryInterval, TryRewardPollingInterval = oldRetry, oldPolling }()
+	TryRewardRetryInterval = 10 * time.Millisecond
+	TryRewardPollingInterval = time.Hour
+
+	client := &stubRewardClient{roundErr: errors.New("CurrentRound error")}
+	s := NewRewardService(client, nil, RewardServiceConfig{})
+	require.Nil(t, s.Start(context.Background()))
+	defer s.Stop()
+
+	calls := func() int {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.roundCalls
+	}
+
+	// Reward is tried once the service starts, and failed attempts are retried before the next polling interval
+	assert.Eventually(func() bool { return calls() >= 3 }, time.Second, 5*time.Millisecond)
+
+	// Attempts are not retried once they succeed
+	client.mu.Lock()
+	client.roundErr = nil
+	client.mu.Unlock()
+	time.Sleep(200 * time.Millisecond)
+	n := calls()
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(n, calls())
+}
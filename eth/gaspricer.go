@@ -0,0 +1,227 @@
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// Sources of the gas price of the transactions of the node, besides the URL of an external oracle
+const (
+	// GasPriceSourceNode prices transactions with the suggestions of the ETH node
+	GasPriceSourceNode = "node"
+	// GasPriceSourceFixed prices transactions with a fixed gas price
+	GasPriceSourceFixed = "fixed"
+)
+
+// GasFees are the fees of transactions suggested by a source: a legacy gas price, the fees of
+// EIP-1559 dynamic fee transactions, or both
+type GasFees struct {
+	GasPrice             *big.Int
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+}
+
+// GasFeeSource suggests the fees of transactions
+type GasFeeSource interface {
+	SuggestGasFees(ctx context.Context) (*GasFees, error)
+}
+
+// rpcCaller calls the methods of the JSON-RPC API of an ETH node
+type rpcCaller interface {
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+}
+
+// nodeGasFees are the fees suggested by an ETH node: its gas price and, on chains with EIP-1559,
+// its priority fee
+type nodeGasFees struct {
+	rpc rpcCaller
+}
+
+func (s *nodeGasFees) SuggestGasFees(ctx context.Context) (*GasFees, error) {
+	var gasPrice hexutil.Big
+	if err := s.rpc.CallContext(ctx, &gasPrice, "eth_gasPrice"); err != nil {
+		return nil, err
+	}
+	fees := &GasFees{GasPrice: gasPrice.ToInt()}
+	// Nodes of chains without EIP-1559 don't support eth_maxPriorityFeePerGas
+	var tip hexutil.Big
+	if err := s.rpc.CallContext(ctx, &tip, "eth_maxPriorityFeePerGas"); err == nil {
+		fees.MaxPriorityFeePerGas = tip.ToInt()
+	}
+	return fees, nil
+}
+
+// fixedGasFees is a gas price that doesn't change
+type fixedGasFees struct {
+	gasPrice *big.Int
+}
+
+func (s *fixedGasFees) SuggestGasFees(ctx context.Context) (*GasFees, error) {
+	return &GasFees{GasPrice: s.gasPrice}, nil
+}
+
+var gasOracleClient = &http.Client{Timeout: 5 * time.Second}
+
+// urlGasFees are the fees returned by an external oracle. A GET request to the oracle returns the
+// fees in wei as decimal strings, e.g. {"gasPrice":"20000000000"} or
+// {"maxFeePerGas":"40000000000","maxPriorityFeePerGas":"2000000000"}
+type urlGasFees struct {
+	url string
+}
+
+func (s *urlGasFees) SuggestGasFees(ctx context.Context) (*GasFees, error) {
+	req, err := http.NewRequest("GET", s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := gasOracleClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("gas price oracle error code=%d", resp.StatusCode)
+	}
+	var res struct {
+		GasPrice             string `json:"gasPrice"`
+		MaxFeePerGas         string `json:"maxFeePerGas"`
+		MaxPriorityFeePerGas string `json:"maxPriorityFeePerGas"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, err
+	}
+	fees := &GasFees{}
+	for _, f := range []struct {
+		name  string
+		value string
+		fee   **big.Int
+	}{
+		{"gasPrice", res.GasPrice, &fees.GasPrice},
+		{"maxFeePerGas", res.MaxFeePerGas, &fees.MaxFeePerGas},
+		{"maxPriorityFeePerGas", res.MaxPriorityFeePerGas, &fees.MaxPriorityFeePerGas},
+	} {
+		if f.value == "" {
+			continue
+		}
+		fee, ok := new(big.Int).SetString(f.value, 10)
+		if !ok || fee.Sign() < 0 {
+			return nil, fmt.Errorf("invalid %s %q returned by the gas price oracle", f.name, f.value)
+		}
+		*f.fee = fee
+	}
+	if fees.GasPrice == nil && fees.MaxPriorityFeePerGas == nil {
+		return nil, errors.New("the gas price oracle returned neither gasPrice nor maxPriorityFeePerGas")
+	}
+	return fees, nil
+}
+
+// GasPricer is the GasPriceOracle of the transactions of the node. On chains with EIP-1559, the gas
+// price of the transactions is the base fee of the latest block plus the priority fee, up to the
+// max fee per gas, which is what a dynamic fee transaction with these fees would pay. Otherwise, or
+// if the source doesn't suggest a priority fee, the legacy gas price of the source is used up to
+// the max fee per gas
+type GasPricer struct {
+	source GasFeeSource
+	rpc    rpcCaller
+	// Fees that override the suggestions of the source, if not nil
+	maxFeePerGas         *big.Int
+	maxPriorityFeePerGas *big.Int
+}
+
+// NewGasPricer creates a GasPricer of the gas price source, which is GasPriceSourceNode,
+// GasPriceSourceFixed to use gasPrice, or the http(s) URL of an external oracle. The EIP-1559 fees
+// maxFeePerGas and maxPriorityFeePerGas override the suggestions of the source if they are not nil
+func NewGasPricer(source string, rpc rpcCaller, gasPrice, maxFeePerGas, maxPriorityFeePerGas *big.Int) (*GasPricer, error) {
+	p := &GasPricer{rpc: rpc, maxFeePerGas: maxFeePerGas, maxPriorityFeePerGas: maxPriorityFeePerGas}
+	switch source {
+	case "", GasPriceSourceNode:
+		p.source = &nodeGasFees{rpc: rpc}
+	case GasPriceSourceFixed:
+		if gasPrice == nil || gasPrice.Sign() <= 0 {
+			return nil, errors.New("a fixed gas price source requires a gas price")
+		}
+		if maxFeePerGas != nil || maxPriorityFeePerGas != nil {
+			return nil, errors.New("a fixed gas price can't be combined with EIP-1559 fees")
+		}
+		p.source = &fixedGasFees{gasPrice: gasPrice}
+	default:
+		u, err := url.ParseRequestURI(source)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("invalid gas price source %q: expected %s, %s or an http(s) URL", source, GasPriceSourceNode, GasPriceSourceFixed)
+		}
+		p.source = &urlGasFees{url: u.String()}
+	}
+	return p, nil
+}
+
+// SuggestGasPrice returns the gas price of the next transaction
+func (p *GasPricer) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	fees, err := p.source.SuggestGasFees(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tip := fees.MaxPriorityFeePerGas
+	if p.maxPriorityFeePerGas != nil {
+		tip = p.maxPriorityFeePerGas
+	}
+	gasPrice := fees.GasPrice
+	if _, fixed := p.source.(*fixedGasFees); !fixed && tip != nil {
+		baseFee, err := p.baseFee(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if baseFee != nil {
+			gasPrice = new(big.Int).Add(baseFee, tip)
+		}
+	}
+	if gasPrice == nil {
+		return nil, errors.New("no gas price on a chain without EIP-1559")
+	}
+	maxFee := fees.MaxFeePerGas
+	if p.maxFeePerGas != nil && (maxFee == nil || p.maxFeePerGas.Cmp(maxFee) < 0) {
+		maxFee = p.maxFeePerGas
+	}
+	if maxFee != nil && gasPrice.Cmp(maxFee) > 0 {
+		gasPrice = maxFee
+	}
+	return gasPrice, nil
+}
+
+// baseFee returns the base fee of the latest block, nil on chains without EIP-1559
+func (p *GasPricer) baseFee(ctx context.Context) (*big.Int, error) {
+	var head struct {
+		BaseFee *hexutil.Big `json:"baseFeePerGas"`
+	}
+	if err := p.rpc.CallContext(ctx, &head, "eth_getBlockByNumber", "latest", false); err != nil {
+		return nil, err
+	}
+	if head.BaseFee == nil {
+		return nil, nil
+	}
+	return head.BaseFee.ToInt(), nil
+}
+
+// pricedBackend is a backend whose transactions are priced by a GasPriceOracle instead of the
+// suggestions of the ETH node
+type pricedBackend struct {
+	*ethclient.Client
+	gpo GasPriceOracle
+}
+
+func (b *pricedBackend) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return b.gpo.SuggestGasPrice(ctx)
+}
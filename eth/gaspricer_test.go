@@ -0,0 +1,184 @@
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubRPC returns the JSON results of the methods of the ETH node, or an error for the others
+type stubRPC struct {
+	results map[string]string
+	calls   []string
+}
+
+func (s *stubRPC) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	s.calls = append(s.calls, method)
+	res, ok := s.results[method]
+	if !ok {
+		return fmt.Errorf("the method %s does not exist/is not available", method)
+	}
+	return json.Unmarshal([]byte(res), result)
+}
+
+func TestNewGasPricer(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &stubRPC{}
+	p, err := NewGasPricer("", rpc, nil, nil, nil)
+	assert.Nil(err)
+	assert.IsType(&nodeGasFees{}, p.source)
+	p, err = NewGasPricer(GasPriceSourceNode, rpc, nil, big.NewInt(100), nil)
+	assert.Nil(err)
+	assert.IsType(&nodeGasFees{}, p.source)
+
+	_, err = NewGasPricer(GasPriceSourceFixed, rpc, nil, nil, nil)
+	assert.EqualError(err, "a fixed gas price source requires a gas price")
+	_, err = NewGasPricer(GasPriceSourceFixed, rpc, big.NewInt(10), nil, big.NewInt(1))
+	assert.EqualError(err, "a fixed gas price can't be combined with EIP-1559 fees")
+	p, err = NewGasPricer(GasPriceSourceFixed, rpc, big.NewInt(10), nil, nil)
+	assert.Nil(err)
+	assert.IsType(&fixedGasFees{}, p.source)
+
+	p, err = NewGasPricer("https://gas.example.com/fees", rpc, nil, nil, nil)
+	assert.Nil(err)
+	assert.IsType(&urlGasFees{}, p.source)
+	_, err = NewGasPricer("foo", rpc, nil, nil, nil)
+	assert.EqualError(err, `invalid gas price source "foo": expected node, fixed or an http(s) URL`)
+	_, err = NewGasPricer("ftp://gas.example.com", rpc, nil, nil, nil)
+	assert.Error(err)
+}
+
+func TestGasPricer_Node(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Chains without EIP-1559 use the gas price of the node
+	rpc := &stubRPC{results: map[string]string{
+		"eth_gasPrice":         `"0x64"`,
+		"eth_getBlockByNumber": `{"number":"0x1"}`,
+	}}
+	p, err := NewGasPricer(GasPriceSourceNode, rpc, nil, nil, nil)
+	require.Nil(err)
+	gasPrice, err := p.SuggestGasPrice(context.Background())
+	require.Nil(err)
+	assert.Equal(big.NewInt(100), gasPrice)
+	assert.Equal([]string{"eth_gasPrice", "eth_maxPriorityFeePerGas"}, rpc.calls)
+
+	// The max fee per gas caps the gas price
+	p, err = NewGasPricer(GasPriceSourceNode, rpc, nil, big.NewInt(80), nil)
+	require.Nil(err)
+	gasPrice, err = p.SuggestGasPrice(context.Background())
+	require.Nil(err)
+	assert.Equal(big.NewInt(80), gasPrice)
+
+	// Chains with EIP-1559 pay the base fee plus the priority fee
+	rpc.results["eth_maxPriorityFeePerGas"] = `"0x2"`
+	rpc.results["eth_getBlockByNumber"] = `{"number":"0x1","baseFeePerGas":"0x32"}`
+	p, err = NewGasPricer(GasPriceSourceNode, rpc, nil, nil, nil)
+	require.Nil(err)
+	gasPrice, err = p.SuggestGasPrice(context.Background())
+	require.Nil(err)
+	assert.Equal(big.NewInt(52), gasPrice)
+
+	// The priority fee of the node can be overridden, and the gas price is still capped
+	p, err = NewGasPricer(GasPriceSourceNode, rpc, nil, big.NewInt(55), big.NewInt(10))
+	require.Nil(err)
+	gasPrice, err = p.SuggestGasPrice(context.Background())
+	require.Nil(err)
+	assert.Equal(big.NewInt(55), gasPrice)
+
+	// Errors of the node are returned
+	delete(rpc.results, "eth_getBlockByNumber")
+	_, err = p.SuggestGasPrice(context.Background())
+	assert.EqualError(err, "the method eth_getBlockByNumber does not exist/is not available")
+	delete(rpc.results, "eth_gasPrice")
+	_, err = p.SuggestGasPrice(context.Background())
+	assert.EqualError(err, "the method eth_gasPrice does not exist/is not available")
+}
+
+func TestGasPricer_Fixed(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	rpc := &stubRPC{}
+	p, err := NewGasPricer(GasPriceSourceFixed, rpc, big.NewInt(7), nil, nil)
+	require.Nil(err)
+	gasPrice, err := p.SuggestGasPrice(context.Background())
+	require.Nil(err)
+	assert.Equal(big.NewInt(7), gasPrice)
+	// The node is not queried
+	assert.Empty(rpc.calls)
+}
+
+func TestGasPricer_URL(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	status, body := http.StatusOK, `{"gasPrice":"100"}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("GET", r.Method)
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	rpc := &stubRPC{results: map[string]string{"eth_getBlockByNumber": `{"baseFeePerGas":"0x32"}`}}
+	p, err := NewGasPricer(ts.URL, rpc, nil, nil, nil)
+	require.Nil(err)
+
+	gasPrice, err := p.SuggestGasPrice(context.Background())
+	require.Nil(err)
+	assert.Equal(big.NewInt(100), gasPrice)
+
+	body = `{"maxFeePerGas":"60","maxPriorityFeePerGas":"20"}`
+	gasPrice, err = p.SuggestGasPrice(context.Background())
+	require.Nil(err)
+	assert.Equal(big.NewInt(60), gasPrice)
+
+	body = `{"maxFeePerGas":"100","maxPriorityFeePerGas":"5"}`
+	gasPrice, err = p.SuggestGasPrice(context.Background())
+	require.Nil(err)
+	assert.Equal(big.NewInt(55), gasPrice)
+
+	// Oracles must suggest a gas price or a priority fee
+	body = `{"maxFeePerGas":"100"}`
+	_, err = p.SuggestGasPrice(context.Background())
+	assert.EqualError(err, "the gas price oracle returned neither gasPrice nor maxPriorityFeePerGas")
+
+	// Oracles that only suggest a priority fee require EIP-1559
+	body = `{"maxPriorityFeePerGas":"5"}`
+	rpc.results["eth_getBlockByNumber"] = `{"number":"0x1"}`
+	_, err = p.SuggestGasPrice(context.Background())
+	assert.EqualError(err, "no gas price on a chain without EIP-1559")
+
+	body = `{"gasPrice":"-1"}`
+	_, err = p.SuggestGasPrice(context.Background())
+	assert.EqualError(err, `invalid gasPrice "-1" returned by the gas price oracle`)
+
+	status, body = http.StatusServiceUnavailable, ""
+	_, err = p.SuggestGasPrice(context.Background())
+	assert.EqualError(err, "gas price oracle error code=503")
+}
+
+func TestPricedBackend(t *testing.T) {
+	assert := assert.New(t)
+
+	gpo := newStubGasPriceOracle(big.NewInt(9))
+	b := &pricedBackend{gpo: gpo}
+	gasPrice, err := b.SuggestGasPrice(context.Background())
+	assert.Nil(err)
+	assert.Equal(big.NewInt(9), gasPrice)
+
+	gpo.SetErr(errors.New("foo"))
+	_, err = b.SuggestGasPrice(context.Background())
+	assert.EqualError(err, "foo")
+}
@@ -1,11 +1,15 @@
 package eth
 
 import (
+	"context"
 	"math/big"
+	"math/rand"
 	"time"
 
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/monitor"
 )
 
 // Number of blocks in an epoch which is the time period during which the caller should
@@ -22,6 +26,23 @@ type BlockHashReader interface {
 	LastInitializedBlockHash() [32]byte
 }
 
+// GasPriceReader describes methods for reading the current gas price
+type GasPriceReader interface {
+	GasPrice() *big.Int
+}
+
+// RoundInitializerConfig are the optional guards of a RoundInitializer
+type RoundInitializerConfig struct {
+	// GasPrices is the source of the gas price that is compared with MaxGasPrice
+	GasPrices GasPriceReader
+	// MaxGasPrice is the highest gas price at which the round is initialized, or nil to initialize
+	// the round at any gas price
+	MaxGasPrice *big.Int
+	// MaxDelay is the upper bound of the random delay before the round is initialized once the caller
+	// is selected, so that callers that select themselves at the same time don't all submit a transaction
+	MaxDelay time.Duration
+}
+
 // RoundInitializer is a service that automatically initializes the current round. Each round is split into epochs with a length of
 // epochBlocks. During each epoch a member of the upcoming active set is selected to initialize the round
 // This selection process is purely a client side implementation that attempts to minimize on-chain transaction collisions, but
@@ -31,17 +52,19 @@ type RoundInitializer struct {
 	blkNumRdr       BlockNumReader
 	blkHashRdr      BlockHashReader
 	pollingInterval time.Duration
+	cfg             RoundInitializerConfig
 
 	quit chan struct{}
 }
 
 // NewRoundInitializer creates a RoundInitializer instance
-func NewRoundInitializer(client LivepeerEthClient, blkNumRdr BlockNumReader, blkHashRdr BlockHashReader, pollingInterval time.Duration) *RoundInitializer {
+func NewRoundInitializer(client LivepeerEthClient, blkNumRdr BlockNumReader, blkHashRdr BlockHashReader, pollingInterval time.Duration, cfg RoundInitializerConfig) *RoundInitializer {
 	return &RoundInitializer{
 		client:          client,
 		blkNumRdr:       blkNumRdr,
 		blkHashRdr:      blkHashRdr,
 		pollingInterval: pollingInterval,
+		cfg:             cfg,
 		quit:            make(chan struct{}),
 	}
 }
@@ -69,40 +92,48 @@ func (r *RoundInitializer) Stop() {
 }
 
 func (r *RoundInitializer) tryInitialize() error {
-	initialized, err := r.client.CurrentRoundInitialized()
+	ok, err := r.selected()
 	if err != nil {
 		return err
 	}
 
-	// Noop if the current round is initialized
-	if initialized {
+	// Noop if the caller should not initialize the round
+	if !ok {
 		return nil
 	}
 
-	currentRoundStartBlk, err := r.client.CurrentRoundStartBlock()
-	if err != nil {
-		return err
-	}
+	if r.cfg.MaxDelay > 0 {
+		delay := time.Duration(rand.Int63n(int64(r.cfg.MaxDelay)))
+		select {
+		case <-time.After(delay):
+		case <-r.quit:
+			return nil
+		}
 
-	lastInitializedBlockHash := r.blkHashRdr.LastInitializedBlockHash()
-	epochSeed, err := r.currentEpochSeed(currentRoundStartBlk, lastInitializedBlockHash)
-	if err != nil {
-		return err
+		// The round might have been initialized, or the epoch might have ended, during the delay
+		ok, err := r.selected()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
 	}
 
-	ok, err := r.shouldInitialize(epochSeed)
+	currentRound, err := r.client.CurrentRound()
 	if err != nil {
 		return err
 	}
 
-	// Noop if the caller should not initialize the round
-	if !ok {
-		return nil
-	}
-
-	currentRound, err := r.client.CurrentRound()
-	if err != nil {
-		return err
+	if r.cfg.MaxGasPrice != nil && r.cfg.GasPrices != nil {
+		gasPrice := r.cfg.GasPrices.GasPrice()
+		if gasPrice == nil || gasPrice.Cmp(r.cfg.MaxGasPrice) > 0 {
+			glog.Infof("Not initializing round %d: gas price %v is above the max gas price %v", currentRound, gasPrice, r.cfg.MaxGasPrice)
+			if monitor.Enabled {
+				monitor.RoundInitializationSkipped()
+			}
+			return nil
+		}
 	}
 
 	glog.Infof("New round - preparing to initialize round to join active set, current round is %d", currentRound)
@@ -118,9 +149,56 @@ func (r *RoundInitializer) tryInitialize() error {
 
 	glog.Infof("Initialized round %d", currentRound)
 
+	if monitor.Enabled {
+		monitor.RoundInitialized(r.gasSpent(tx))
+	}
+
 	return nil
 }
 
+// selected returns whether the current round is not initialized and the caller is selected to
+// initialize it in the current epoch
+func (r *RoundInitializer) selected() (bool, error) {
+	initialized, err := r.client.CurrentRoundInitialized()
+	if err != nil {
+		return false, err
+	}
+
+	// Noop if the current round is initialized
+	if initialized {
+		return false, nil
+	}
+
+	currentRoundStartBlk, err := r.client.CurrentRoundStartBlock()
+	if err != nil {
+		return false, err
+	}
+
+	lastInitializedBlockHash := r.blkHashRdr.LastInitializedBlockHash()
+	epochSeed, err := r.currentEpochSeed(currentRoundStartBlk, lastInitializedBlockHash)
+	if err != nil {
+		return false, err
+	}
+
+	return r.shouldInitialize(epochSeed)
+}
+
+// gasSpent returns the fee paid for a mined transaction at its gas price, or nil if its receipt is not available
+func (r *RoundInitializer) gasSpent(tx *types.Transaction) *big.Int {
+	q := r.client.TxQueue()
+	if q == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	receipt, err := q.WaitMined(ctx, tx)
+	if err != nil {
+		glog.Errorf("Error getting receipt of round initialization tx hash=%v err=%v", tx.Hash().Hex(), err)
+		return nil
+	}
+	return new(big.Int).Mul(new(big.Int).SetUint64(receipt.GasUsed), tx.GasPrice())
+}
+
 func (r *RoundInitializer) shouldInitialize(epochSeed *big.Int) (bool, error) {
 	transcoders, err := r.client.RegisteredTranscoders()
 	if err != nil {
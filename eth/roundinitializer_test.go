@@ -39,7 +39,7 @@ func TestRoundInitializer_CurrentEpochSeed(t *testing.T) {
 	client := &MockClient{}
 	blkNumRdr := &stubBlockNumReader{}
 	blkHashRdr := &stubBlockHashReader{}
-	initializer := NewRoundInitializer(client, blkNumRdr, blkHashRdr, 1*time.Second)
+	initializer := NewRoundInitializer(client, blkNumRdr, blkHashRdr, 1*time.Second, RoundInitializerConfig{})
 
 	assert := assert.New(t)
 
@@ -82,7 +82,7 @@ func TestRoundInitializer_ShouldInitialize(t *testing.T) {
 	client := &MockClient{}
 	blkNumRdr := &stubBlockNumReader{}
 	blkHashRdr := &stubBlockHashReader{}
-	initializer := NewRoundInitializer(client, blkNumRdr, blkHashRdr, 1*time.Second)
+	initializer := NewRoundInitializer(client, blkNumRdr, blkHashRdr, 1*time.Second, RoundInitializerConfig{})
 
 	assert := assert.New(t)
 
@@ -165,7 +165,7 @@ func TestRoundInitializer_TryInitialize(t *testing.T) {
 	client := &MockClient{}
 	blkNumRdr := &stubBlockNumReader{}
 	blkHashRdr := &stubBlockHashReader{}
-	initializer := NewRoundInitializer(client, blkNumRdr, blkHashRdr, 1*time.Second)
+	initializer := NewRoundInitializer(client, blkNumRdr, blkHashRdr, 1*time.Second, RoundInitializerConfig{})
 
 	assert := assert.New(t)
 
@@ -255,3 +255,76 @@ func TestRoundInitializer_TryInitialize(t *testing.T) {
 	err = initializer.tryInitialize()
 	assert.Nil(err)
 }
+
+type stubGasPriceReader struct {
+	gasPrice *big.Int
+}
+
+func (r *stubGasPriceReader) GasPrice() *big.Int {
+	return r.gasPrice
+}
+
+// selectedClient returns a client of a caller that is selected to initialize the current round
+func selectedClient() (*MockClient, *stubBlockNumReader, *stubBlockHashReader) {
+	client := &MockClient{}
+	caller := ethcommon.BytesToAddress([]byte("foo"))
+	client.On("Account").Return(accounts.Account{Address: caller})
+	client.On("CurrentRoundStartBlock").Return(big.NewInt(5), nil)
+	client.On("RegisteredTranscoders").Return([]*lpTypes.Transcoder{
+		&lpTypes.Transcoder{Address: caller},
+		&lpTypes.Transcoder{Address: ethcommon.BytesToAddress([]byte("jar"))},
+	}, nil)
+	client.On("NumActiveTranscoders").Return(big.NewInt(2), nil)
+	client.On("CurrentRound").Return(big.NewInt(5), nil)
+	return client, &stubBlockNumReader{blkNum: big.NewInt(5)}, &stubBlockHashReader{blkHash: [32]byte{123}}
+}
+
+func TestRoundInitializer_TryInitialize_MaxGasPrice(t *testing.T) {
+	assert := assert.New(t)
+	client, blkNumRdr, blkHashRdr := selectedClient()
+	client.On("CurrentRoundInitialized").Return(false, nil)
+	gasPrices := &stubGasPriceReader{gasPrice: big.NewInt(11)}
+	initializer := NewRoundInitializer(client, blkNumRdr, blkHashRdr, 1*time.Second, RoundInitializerConfig{
+		GasPrices:   gasPrices,
+		MaxGasPrice: big.NewInt(10),
+	})
+
+	// The round is not initialized while the gas price is above the max gas price, or unknown
+	assert.Nil(initializer.tryInitialize())
+	gasPrices.gasPrice = nil
+	assert.Nil(initializer.tryInitialize())
+	client.AssertNotCalled(t, "InitializeRound")
+
+	gasPrices.gasPrice = big.NewInt(10)
+	client.On("InitializeRound").Return(&types.Transaction{}, nil)
+	client.On("CheckTx", mock.Anything).Return(nil)
+	assert.Nil(initializer.tryInitialize())
+	client.AssertNumberOfCalls(t, "InitializeRound", 1)
+}
+
+func TestRoundInitializer_TryInitialize_MaxDelay(t *testing.T) {
+	assert := assert.New(t)
+	client, blkNumRdr, blkHashRdr := selectedClient()
+	initializer := NewRoundInitializer(client, blkNumRdr, blkHashRdr, 1*time.Second, RoundInitializerConfig{MaxDelay: 50 * time.Millisecond})
+
+	// The round is not initialized if it is initialized by someone else during the delay
+	client.On("CurrentRoundInitialized").Return(false, nil).Once()
+	client.On("CurrentRoundInitialized").Return(true, nil).Once()
+	assert.Nil(initializer.tryInitialize())
+	client.AssertNotCalled(t, "InitializeRound")
+
+	// The caller must still be selected after the delay
+	client.On("CurrentRoundInitialized").Return(false, nil)
+	client.On("InitializeRound").Return(&types.Transaction{}, nil)
+	client.On("CheckTx", mock.Anything).Return(nil)
+	assert.Nil(initializer.tryInitialize())
+	client.AssertNumberOfCalls(t, "InitializeRound", 1)
+
+	// The delay ends when the initializer is stopped
+	initializer = NewRoundInitializer(client, blkNumRdr, blkHashRdr, 1*time.Second, RoundInitializerConfig{MaxDelay: time.Hour})
+	initializer.Stop()
+	start := time.Now()
+	assert.Nil(initializer.tryInitialize())
+	assert.True(time.Since(start) < time.Second)
+	client.AssertNumberOfCalls(t, "InitializeRound", 1)
+}
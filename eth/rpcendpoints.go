@@ -0,0 +1,290 @@
+package eth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/golang/glog"
+)
+
+// rpcEndpointMaxLag is the number of blocks that an endpoint can be behind the most recent block
+// seen on all the endpoints before it is considered unhealthy
+const rpcEndpointMaxLag = 5
+
+// rpcTxMethods are the methods that submit transactions, and that are never sent to the read
+// endpoints
+var rpcTxMethods = map[string]bool{
+	"eth_sendRawTransaction": true,
+	"eth_sendTransaction":    true,
+}
+
+// rpcEndpoint is an ETH JSON-RPC endpoint and its health
+type rpcEndpoint struct {
+	url *url.URL
+	// err is the error of the last request to the endpoint, or nil if it succeeded
+	err error
+	// head is the last block number returned by the endpoint to a health check
+	head uint64
+}
+
+// RPCEndpoints routes the JSON-RPC requests of the node over several ETH RPC endpoints. Requests
+// are sent to the first healthy endpoint, in the order of preference of the endpoints, and fail
+// over to the next endpoint on errors, timeouts and 5xx or 429 responses. Endpoints are unhealthy
+// after a failed request or health check, or when they lag behind the other endpoints. Read calls
+// are routed to the read endpoints first, while transactions are only submitted to the tx endpoints
+type RPCEndpoints struct {
+	txs []*rpcEndpoint
+	// reads are the read endpoints followed by the tx endpoints
+	reads     []*rpcEndpoint
+	timeout   time.Duration
+	transport http.RoundTripper
+
+	mu sync.Mutex
+}
+
+// NewRPCEndpoints creates the RPCEndpoints of http(s) tx and read endpoint URLs, in their order of
+// preference. Every attempt of a request to an endpoint times out after timeout
+func NewRPCEndpoints(txURLs, readURLs []string, timeout time.Duration) (*RPCEndpoints, error) {
+	if len(txURLs) == 0 {
+		return nil, errors.New("no ETH RPC endpoint")
+	}
+	parse := func(urls []string) ([]*rpcEndpoint, error) {
+		var endpoints []*rpcEndpoint
+		for _, u := range urls {
+			pu, err := url.Parse(u)
+			if err != nil {
+				return nil, err
+			}
+			if pu.Scheme != "http" && pu.Scheme != "https" {
+				return nil, fmt.Errorf("ETH RPC endpoint %v is not a http(s) URL", u)
+			}
+			endpoints = append(endpoints, &rpcEndpoint{url: pu})
+		}
+		return endpoints, nil
+	}
+	txs, err := parse(txURLs)
+	if err != nil {
+		return nil, err
+	}
+	reads, err := parse(readURLs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RPCEndpoints{
+		txs:       txs,
+		reads:     append(reads, txs...),
+		timeout:   timeout,
+		transport: http.DefaultTransport,
+	}, nil
+}
+
+// Dial returns a JSON-RPC client whose requests are routed over the endpoints
+func (e *RPCEndpoints) Dial() (*rpc.Client, error) {
+	// The URL of the client is replaced by the URL of an endpoint for every request
+	return rpc.DialHTTPWithClient("http://eth-rpc-endpoints", &http.Client{Transport: e})
+}
+
+// RoundTrip sends a JSON-RPC request to the first healthy endpoint that answers it. Unhealthy
+// endpoints are tried last, in case all the endpoints are unhealthy
+func (e *RPCEndpoints) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	endpoints := e.reads
+	if isTxRequest(body) {
+		endpoints = e.txs
+	}
+
+	var lastErr error
+	for _, ep := range e.ordered(endpoints) {
+		resp, err := e.send(req.Context(), ep, req.Header, body)
+		if err == nil {
+			e.setErr(ep, nil)
+			return resp, nil
+		}
+		glog.Warningf("ETH RPC request failed, failing over endpoint=%v err=%v", ep.url.Host, err)
+		e.setErr(ep, err)
+		lastErr = err
+		if req.Context().Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+func (e *RPCEndpoints) send(ctx context.Context, ep *rpcEndpoint, header http.Header, body []byte) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	epReq, err := http.NewRequest("POST", ep.url.String(), bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	epReq = epReq.WithContext(ctx)
+	for k, v := range header {
+		epReq.Header[k] = v
+	}
+
+	resp, err := e.transport.RoundTrip(epReq)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+		resp.Body.Close()
+		cancel()
+		return nil, errors.New(resp.Status)
+	}
+	// The timeout of the attempt applies until the response is read
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// ordered returns the healthy endpoints followed by the unhealthy ones
+func (e *RPCEndpoints) ordered(endpoints []*rpcEndpoint) []*rpcEndpoint {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var best uint64
+	for _, ep := range e.reads {
+		if ep.head > best {
+			best = ep.head
+		}
+	}
+	var healthy, unhealthy []*rpcEndpoint
+	for _, ep := range endpoints {
+		if ep.err == nil && ep.head+rpcEndpointMaxLag >= best {
+			healthy = append(healthy, ep)
+		} else {
+			unhealthy = append(unhealthy, ep)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+func (e *RPCEndpoints) setErr(ep *rpcEndpoint, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ep.err = err
+}
+
+// Watch checks the health of the endpoints at every polling interval until the context is done
+func (e *RPCEndpoints) Watch(ctx context.Context, pollingInterval time.Duration) {
+	ticker := time.NewTicker(pollingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.checkHealth(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkHealth requests the last block number of every endpoint
+func (e *RPCEndpoints) checkHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, ep := range e.reads {
+		wg.Add(1)
+		go func(ep *rpcEndpoint) {
+			defer wg.Done()
+			head, err := e.blockNumber(ctx, ep)
+
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			if err != nil && ep.err == nil {
+				glog.Errorf("ETH RPC endpoint is unhealthy endpoint=%v err=%v", ep.url.Host, err)
+			} else if err == nil && ep.err != nil {
+				glog.Infof("ETH RPC endpoint is healthy again endpoint=%v", ep.url.Host)
+			}
+			ep.err = err
+			if err == nil {
+				ep.head = head
+			}
+		}(ep)
+	}
+	wg.Wait()
+}
+
+func (e *RPCEndpoints) blockNumber(ctx context.Context, ep *rpcEndpoint) (uint64, error) {
+	header := http.Header{"Content-Type": {"application/json"}}
+	body := []byte(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`)
+	resp, err := e.send(ctx, ep, header, body)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, errors.New(resp.Status)
+	}
+
+	var res struct {
+		Result *hexutil.Uint64 `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return 0, err
+	}
+	if res.Error != nil {
+		return 0, errors.New(res.Error.Message)
+	}
+	if res.Result == nil {
+		return 0, errors.New("missing block number")
+	}
+	return uint64(*res.Result), nil
+}
+
+// isTxRequest returns whether a JSON-RPC request or batch of requests submits a transaction
+func isTxRequest(body []byte) bool {
+	type call struct {
+		Method string `json:"method"`
+	}
+	var calls []call
+	if err := json.Unmarshal(body, &calls); err != nil {
+		var c call
+		if err := json.Unmarshal(body, &c); err != nil {
+			return false
+		}
+		calls = []call{c}
+	}
+	for _, c := range calls {
+		if rpcTxMethods[c.Method] {
+			return true
+		}
+	}
+	return false
+}
+
+// cancelBody cancels the context of a request once its response is read
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
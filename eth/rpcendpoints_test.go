@@ -0,0 +1,189 @@
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubRPCEndpoint answers JSON-RPC calls with its block number, and records the methods of the calls
+type stubRPCEndpoint struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	methods []string
+	head    uint64
+	status  int
+	delay   time.Duration
+}
+
+func newStubRPCEndpoint(head uint64) *stubRPCEndpoint {
+	ep := &stubRPCEndpoint{head: head, status: http.StatusOK}
+	ep.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ep.mu.Lock()
+		ep.methods = append(ep.methods, req.Method)
+		status, head, delay := ep.status, ep.head, ep.delay
+		ep.mu.Unlock()
+
+		time.Sleep(delay)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":"0x%x"}`, req.ID, head)
+	}))
+	return ep
+}
+
+func (ep *stubRPCEndpoint) set(status int, delay time.Duration) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	ep.status, ep.delay = status, delay
+}
+
+func (ep *stubRPCEndpoint) calls() []string {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	methods := ep.methods
+	ep.methods = nil
+	return methods
+}
+
+func TestRPCEndpoints_URLs(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewRPCEndpoints(nil, nil, time.Second)
+	assert.EqualError(err, "no ETH RPC endpoint")
+	_, err = NewRPCEndpoints([]string{"http://localhost:8545", "wss://localhost:8546"}, nil, time.Second)
+	assert.EqualError(err, "ETH RPC endpoint wss://localhost:8546 is not a http(s) URL")
+	_, err = NewRPCEndpoints([]string{"http://localhost:8545"}, []string{"ws://localhost:8546"}, time.Second)
+	assert.EqualError(err, "ETH RPC endpoint ws://localhost:8546 is not a http(s) URL")
+}
+
+func TestRPCEndpoints_Failover(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	first := newStubRPCEndpoint(100)
+	defer first.Close()
+	second := newStubRPCEndpoint(100)
+	defer second.Close()
+
+	e, err := NewRPCEndpoints([]string{first.URL, second.URL}, nil, 100*time.Millisecond)
+	require.Nil(err)
+	client, err := e.Dial()
+	require.Nil(err)
+
+	var head string
+	require.Nil(client.CallContext(context.Background(), &head, "eth_blockNumber"))
+	assert.Equal([]string{"eth_blockNumber"}, first.calls())
+	assert.Empty(second.calls())
+
+	// Requests fail over on 5xx responses, and the failed endpoint is tried last afterwards
+	first.set(http.StatusServiceUnavailable, 0)
+	require.Nil(client.CallContext(context.Background(), &head, "eth_blockNumber"))
+	assert.Len(first.calls(), 1)
+	assert.Len(second.calls(), 1)
+	require.Nil(client.CallContext(context.Background(), &head, "eth_blockNumber"))
+	assert.Empty(first.calls())
+	assert.Len(second.calls(), 1)
+
+	// Requests fail over on timeouts
+	second.set(http.StatusOK, 500*time.Millisecond)
+	first.set(http.StatusOK, 0)
+	require.Nil(client.CallContext(context.Background(), &head, "eth_blockNumber"))
+	assert.Len(second.calls(), 1)
+	assert.Len(first.calls(), 1)
+	assert.Equal([]*rpcEndpoint{e.txs[0], e.txs[1]}, e.ordered(e.txs))
+
+	// The last error is returned if every endpoint fails
+	first.set(http.StatusTooManyRequests, 0)
+	second.set(http.StatusBadGateway, 0)
+	err = client.CallContext(context.Background(), &head, "eth_blockNumber")
+	require.NotNil(err)
+	assert.Contains(err.Error(), "502 Bad Gateway")
+}
+
+func TestRPCEndpoints_ReadRouting(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tx := newStubRPCEndpoint(100)
+	defer tx.Close()
+	read := newStubRPCEndpoint(100)
+	defer read.Close()
+
+	e, err := NewRPCEndpoints([]string{tx.URL}, []string{read.URL}, time.Second)
+	require.Nil(err)
+	client, err := e.Dial()
+	require.Nil(err)
+
+	var res string
+	require.Nil(client.CallContext(context.Background(), &res, "eth_getBalance"))
+	require.Nil(client.CallContext(context.Background(), &res, "eth_sendRawTransaction"))
+	assert.Equal([]string{"eth_getBalance"}, read.calls())
+	assert.Equal([]string{"eth_sendRawTransaction"}, tx.calls())
+
+	// Reads fail over to the tx endpoints, but transactions are never sent to the read endpoints
+	read.set(http.StatusInternalServerError, 0)
+	require.Nil(client.CallContext(context.Background(), &res, "eth_getBalance"))
+	assert.Equal([]string{"eth_getBalance"}, tx.calls())
+	assert.Len(read.calls(), 1)
+	read.set(http.StatusOK, 0)
+	tx.set(http.StatusInternalServerError, 0)
+	assert.NotNil(client.CallContext(context.Background(), &res, "eth_sendRawTransaction"))
+	assert.Empty(read.calls())
+}
+
+func TestRPCEndpoints_CheckHealth(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	first := newStubRPCEndpoint(100)
+	defer first.Close()
+	second := newStubRPCEndpoint(110)
+	defer second.Close()
+
+	e, err := NewRPCEndpoints([]string{first.URL, second.URL}, nil, time.Second)
+	require.Nil(err)
+
+	// Endpoints that lag behind the others are tried last
+	e.checkHealth(context.Background())
+	assert.Equal(uint64(100), e.txs[0].head)
+	assert.Equal(uint64(110), e.txs[1].head)
+	assert.Equal([]*rpcEndpoint{e.txs[1], e.txs[0]}, e.ordered(e.txs))
+
+	first.mu.Lock()
+	first.head = 110 - rpcEndpointMaxLag
+	first.mu.Unlock()
+	e.checkHealth(context.Background())
+	assert.Equal([]*rpcEndpoint{e.txs[0], e.txs[1]}, e.ordered(e.txs))
+
+	// Endpoints that fail the health check are unhealthy until they pass it again
+	first.set(http.StatusServiceUnavailable, 0)
+	e.checkHealth(context.Background())
+	assert.EqualError(e.txs[0].err, "503 Service Unavailable")
+	assert.Equal([]*rpcEndpoint{e.txs[1], e.txs[0]}, e.ordered(e.txs))
+
+	first.set(http.StatusOK, 0)
+	e.checkHealth(context.Background())
+	assert.Nil(e.txs[0].err)
+	assert.Equal([]*rpcEndpoint{e.txs[0], e.txs[1]}, e.ordered(e.txs))
+}
@@ -99,6 +99,11 @@ func (m *MockClient) FundDeposit(amount *big.Int) (*types.Transaction, error) {
 	return mockTransaction(args, 0), args.Error(1)
 }
 
+func (m *MockClient) FundReserve(amount *big.Int) (*types.Transaction, error) {
+	args := m.Called(amount)
+	return mockTransaction(args, 0), args.Error(1)
+}
+
 func (m *MockClient) Unlock() (*types.Transaction, error) {
 	args := m.Called()
 	return mockTransaction(args, 0), args.Error(1)
@@ -306,6 +311,7 @@ func (c *StubClient) CheckTx(tx *types.Transaction) error {
 func (c *StubClient) ReplaceTransaction(tx *types.Transaction, method string, gasPrice *big.Int) (*types.Transaction, error) {
 	return nil, nil
 }
+func (c *StubClient) TxQueue() *TxQueue                 { return nil }
 func (c *StubClient) Sign(msg []byte) ([]byte, error)   { return msg, nil }
 func (c *StubClient) GetGasInfo() (uint64, *big.Int)    { return 0, nil }
 func (c *StubClient) SetGasInfo(uint64, *big.Int) error { return nil }
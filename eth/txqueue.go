@@ -0,0 +1,326 @@
+package eth
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/common"
+)
+
+// txQueueWaitInterval is the interval at which the receipts of the transactions that are waited
+// for are requested
+var txQueueWaitInterval = time.Second
+
+// txQueueBackend is the backend that the transactions of a TxQueue are sent to
+type txQueueBackend interface {
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+	TransactionReceipt(ctx context.Context, txHash ethcommon.Hash) (*types.Receipt, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// QueuedTx is a transaction of the node that is not mined yet
+type QueuedTx struct {
+	Nonce    uint64         `json:"nonce"`
+	Hash     ethcommon.Hash `json:"hash"`
+	GasPrice *big.Int       `json:"gasPrice"`
+	// SubmittedBlock is the block that the transaction was last submitted at, or nil if no block
+	// was seen since then
+	SubmittedBlock *big.Int `json:"submittedBlock"`
+	// Replacements is the number of times that the transaction was resubmitted with bumped fees
+	Replacements int `json:"replacements"`
+
+	tx *types.Transaction
+	// hashes are the hashes of all the submissions of the transaction, any of which can be mined
+	hashes []ethcommon.Hash
+}
+
+// TxQueueStatus is the state of a TxQueue
+type TxQueueStatus struct {
+	// Head is the last block seen by the queue
+	Head *big.Int `json:"head"`
+	// StuckBlocks is the number of blocks after which pending transactions are resubmitted, or 0 if
+	// they are never resubmitted
+	StuckBlocks  uint64      `json:"stuckBlocks"`
+	Transactions []*QueuedTx `json:"transactions"`
+}
+
+// TxQueue is the queue that all the transactions of the node are sent through. Nonces are assigned
+// to transactions one at a time as they are submitted, and the nonce of a transaction that fails to
+// be submitted is reused by the next one. Transactions are tracked until they are mined, and the
+// ones that are pending for too many blocks are resubmitted with bumped fees
+type TxQueue struct {
+	nonces  *NonceManager
+	backend txQueueBackend
+	// replace resubmits a stuck transaction with bumped fees
+	replace func(tx *types.Transaction) (*types.Transaction, error)
+
+	mu          sync.Mutex
+	txs         map[uint64]*QueuedTx
+	sent        map[ethcommon.Address]bool
+	head        *big.Int
+	stuckBlocks uint64
+}
+
+// NewTxQueue creates a TxQueue that sends transactions to a backend, and resubmits stuck ones with
+// a replace function
+func NewTxQueue(backend txQueueBackend, nonceReader RemoteNonceReader, replace func(tx *types.Transaction) (*types.Transaction, error)) *TxQueue {
+	return &TxQueue{
+		nonces:  NewNonceManager(nonceReader),
+		backend: backend,
+		replace: replace,
+		txs:     make(map[uint64]*QueuedTx),
+		sent:    make(map[ethcommon.Address]bool),
+	}
+}
+
+// Lock locks the nonce of an address until the transaction that it is assigned to is submitted
+func (q *TxQueue) Lock(addr ethcommon.Address) {
+	q.nonces.Lock(addr)
+}
+
+// Unlock unlocks the nonce of an address
+func (q *TxQueue) Unlock(addr ethcommon.Address) {
+	q.nonces.Unlock(addr)
+}
+
+// Next returns the nonce of the next transaction of an address
+func (q *TxQueue) Next(addr ethcommon.Address) (uint64, error) {
+	q.mu.Lock()
+	q.sent[addr] = false
+	q.mu.Unlock()
+
+	return q.nonces.Next(addr)
+}
+
+// Update consumes the last nonce returned by Next, if its transaction was submitted
+func (q *TxQueue) Update(addr ethcommon.Address, lastNonce uint64) {
+	q.mu.Lock()
+	sent := q.sent[addr]
+	q.mu.Unlock()
+
+	if !sent {
+		return
+	}
+	q.nonces.Update(addr, lastNonce)
+}
+
+// SendTransaction submits a new transaction and queues it until it is mined
+func (q *TxQueue) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if err := q.backend.SendTransaction(ctx, tx); err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if from, err := types.Sender(types.HomesteadSigner{}, tx); err == nil {
+		q.sent[from] = true
+	}
+	qtx := &QueuedTx{Nonce: tx.Nonce()}
+	q.txs[tx.Nonce()] = qtx
+	q.submitted(qtx, tx)
+
+	return nil
+}
+
+// Resubmit submits a transaction that replaces a queued transaction with the same nonce
+func (q *TxQueue) Resubmit(ctx context.Context, tx *types.Transaction) error {
+	if err := q.backend.SendTransaction(ctx, tx); err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	qtx, ok := q.txs[tx.Nonce()]
+	if !ok {
+		// The replaced transaction was submitted before the node started
+		qtx = &QueuedTx{Nonce: tx.Nonce()}
+		q.txs[tx.Nonce()] = qtx
+	} else {
+		qtx.Replacements++
+	}
+	q.submitted(qtx, tx)
+
+	return nil
+}
+
+func (q *TxQueue) submitted(qtx *QueuedTx, tx *types.Transaction) {
+	qtx.tx = tx
+	qtx.Hash = tx.Hash()
+	qtx.GasPrice = tx.GasPrice()
+	qtx.SubmittedBlock = q.head
+	qtx.hashes = append(qtx.hashes, tx.Hash())
+}
+
+// WaitMined waits until a transaction, or a transaction that replaced it, is mined and returns
+// its receipt
+func (q *TxQueue) WaitMined(ctx context.Context, tx *types.Transaction) (*types.Receipt, error) {
+	q.mu.Lock()
+	qtx := q.txs[tx.Nonce()]
+	if qtx != nil && !qtx.submittedAs(tx.Hash()) {
+		qtx = nil
+	}
+	q.mu.Unlock()
+
+	ticker := time.NewTicker(txQueueWaitInterval)
+	defer ticker.Stop()
+
+	for {
+		hashes := []ethcommon.Hash{tx.Hash()}
+		if qtx != nil {
+			// The submissions of a transaction are still known once it is removed from the queue
+			q.mu.Lock()
+			hashes = append([]ethcommon.Hash(nil), qtx.hashes...)
+			q.mu.Unlock()
+		}
+
+		for _, hash := range hashes {
+			receipt, err := q.backend.TransactionReceipt(ctx, hash)
+			if receipt != nil {
+				return receipt, nil
+			}
+			if err != nil && err != ethereum.NotFound {
+				glog.V(common.DEBUG).Infof("Error getting receipt of tx hash=%v err=%v", hash.Hex(), err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (qtx *QueuedTx) submittedAs(hash ethcommon.Hash) bool {
+	for _, h := range qtx.hashes {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch checks the queued transactions at every polling interval until the context is done.
+// Transactions that are mined are removed from the queue, and transactions that are pending for
+// stuckBlocks blocks are resubmitted with bumped fees. Transactions are never resubmitted if
+// stuckBlocks is 0
+func (q *TxQueue) Watch(ctx context.Context, pollingInterval time.Duration, stuckBlocks uint64) {
+	q.mu.Lock()
+	q.stuckBlocks = stuckBlocks
+	q.mu.Unlock()
+
+	ticker := time.NewTicker(pollingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := q.checkTxs(ctx); err != nil {
+				glog.Errorf("Error checking queued transactions: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (q *TxQueue) checkTxs(ctx context.Context) error {
+	header, err := q.backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	q.head = header.Number
+	stuckBlocks := q.stuckBlocks
+	var txs []*QueuedTx
+	for _, qtx := range q.txs {
+		if qtx.SubmittedBlock == nil {
+			qtx.SubmittedBlock = header.Number
+		}
+		txs = append(txs, qtx)
+	}
+	q.mu.Unlock()
+
+	for _, qtx := range txs {
+		q.mu.Lock()
+		hashes := append([]ethcommon.Hash(nil), qtx.hashes...)
+		tx, submittedBlock := qtx.tx, qtx.SubmittedBlock
+		q.mu.Unlock()
+
+		if q.mined(ctx, hashes) {
+			q.mu.Lock()
+			if q.txs[qtx.Nonce] == qtx {
+				delete(q.txs, qtx.Nonce)
+			}
+			q.mu.Unlock()
+			continue
+		}
+
+		if stuckBlocks == 0 || new(big.Int).Sub(header.Number, submittedBlock).Cmp(new(big.Int).SetUint64(stuckBlocks)) < 0 {
+			continue
+		}
+
+		glog.Infof("Resubmitting tx stuck since block=%v nonce=%v hash=%v", submittedBlock, qtx.Nonce, tx.Hash().Hex())
+		if _, err := q.replace(tx); err != nil && err != ErrReplacingMinedTx {
+			glog.Errorf("Error resubmitting stuck tx nonce=%v hash=%v err=%v", qtx.Nonce, tx.Hash().Hex(), err)
+		}
+	}
+
+	return nil
+}
+
+// mined returns whether any of the submissions of a transaction is mined
+func (q *TxQueue) mined(ctx context.Context, hashes []ethcommon.Hash) bool {
+	for _, hash := range hashes {
+		receipt, err := q.backend.TransactionReceipt(ctx, hash)
+		if receipt != nil {
+			return true
+		}
+		if err != nil && err != ethereum.NotFound {
+			glog.V(common.DEBUG).Infof("Error getting receipt of tx hash=%v err=%v", hash.Hex(), err)
+		}
+	}
+	return false
+}
+
+// Status returns the state of the queue, with its transactions ordered by nonce
+func (q *TxQueue) Status() *TxQueueStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	status := &TxQueueStatus{
+		Head:         q.head,
+		StuckBlocks:  q.stuckBlocks,
+		Transactions: []*QueuedTx{},
+	}
+	for _, qtx := range q.txs {
+		tx := *qtx
+		tx.hashes = nil
+		status.Transactions = append(status.Transactions, &tx)
+	}
+	sort.Slice(status.Transactions, func(i, j int) bool {
+		return status.Transactions[i].Nonce < status.Transactions[j].Nonce
+	})
+	return status
+}
+
+// queuedBackend is a backend whose transactions are sent through a TxQueue
+type queuedBackend struct {
+	bind.ContractBackend
+	q *TxQueue
+}
+
+func (b *queuedBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	return b.q.SendTransaction(ctx, tx)
+}
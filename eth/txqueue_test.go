@@ -0,0 +1,220 @@
+package eth
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubTxBackend records the transactions sent to it, and returns the receipts of the mined ones
+type stubTxBackend struct {
+	mu       sync.Mutex
+	sent     []*types.Transaction
+	sendErr  error
+	mined    map[ethcommon.Hash]bool
+	head     int64
+	nonce    uint64
+	nonceErr error
+}
+
+func (b *stubTxBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.sendErr != nil {
+		return b.sendErr
+	}
+	b.sent = append(b.sent, tx)
+	return nil
+}
+
+func (b *stubTxBackend) TransactionReceipt(ctx context.Context, txHash ethcommon.Hash) (*types.Receipt, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.mined[txHash] {
+		return nil, ethereum.NotFound
+	}
+	return &types.Receipt{TxHash: txHash, Status: 1}, nil
+}
+
+func (b *stubTxBackend) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return &types.Header{Number: big.NewInt(b.head)}, nil
+}
+
+func (b *stubTxBackend) PendingNonceAt(ctx context.Context, addr ethcommon.Address) (uint64, error) {
+	return b.nonce, b.nonceErr
+}
+
+func (b *stubTxBackend) mine(hash ethcommon.Hash) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.mined[hash] = true
+}
+
+func signedTx(t *testing.T, nonce uint64, gasPrice int64) *types.Transaction {
+	key, err := crypto.HexToECDSA("289c2857d4598e37fb9647507e47a309d6133539bf21a8b9cb6df88fd5232032")
+	require.Nil(t, err)
+	tx := types.NewTransaction(nonce, ethcommon.Address{}, big.NewInt(0), 21000, big.NewInt(gasPrice), nil)
+	tx, err = types.SignTx(tx, types.HomesteadSigner{}, key)
+	require.Nil(t, err)
+	return tx
+}
+
+func TestTxQueue_Nonces(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	backend := &stubTxBackend{mined: make(map[ethcommon.Hash]bool), nonce: 5}
+	q := NewTxQueue(backend, backend, nil)
+	tx := signedTx(t, 5, 10)
+	from, err := types.Sender(types.HomesteadSigner{}, tx)
+	require.Nil(err)
+
+	// The nonce of a transaction that fails to be submitted is not consumed
+	backend.sendErr = errors.New("nonce too low")
+	q.Lock(from)
+	nonce, err := q.Next(from)
+	require.Nil(err)
+	assert.Equal(uint64(5), nonce)
+	assert.EqualError(q.SendTransaction(context.Background(), tx), "nonce too low")
+	q.Update(from, nonce)
+	q.Unlock(from)
+	assert.Empty(q.Status().Transactions)
+
+	backend.sendErr = nil
+	q.Lock(from)
+	nonce, err = q.Next(from)
+	require.Nil(err)
+	assert.Equal(uint64(5), nonce)
+	require.Nil(q.SendTransaction(context.Background(), tx))
+	q.Update(from, nonce)
+	q.Unlock(from)
+
+	q.Lock(from)
+	nonce, err = q.Next(from)
+	q.Unlock(from)
+	require.Nil(err)
+	assert.Equal(uint64(6), nonce)
+
+	status := q.Status()
+	require.Len(status.Transactions, 1)
+	assert.Equal(uint64(5), status.Transactions[0].Nonce)
+	assert.Equal(tx.Hash(), status.Transactions[0].Hash)
+	assert.Equal(big.NewInt(10), status.Transactions[0].GasPrice)
+	assert.Nil(status.Transactions[0].SubmittedBlock)
+
+	// Errors reading the remote nonce are returned
+	backend.nonceErr = errors.New("dial error")
+	q.Lock(from)
+	_, err = q.Next(from)
+	q.Unlock(from)
+	assert.EqualError(err, "dial error")
+}
+
+func TestTxQueue_CheckTxs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	backend := &stubTxBackend{mined: make(map[ethcommon.Hash]bool), head: 100}
+	var replaced []*types.Transaction
+	var q *TxQueue
+	q = NewTxQueue(backend, backend, func(tx *types.Transaction) (*types.Transaction, error) {
+		replaced = append(replaced, tx)
+		newTx := signedTx(t, tx.Nonce(), tx.GasPrice().Int64()*2)
+		return newTx, q.Resubmit(context.Background(), newTx)
+	})
+	q.stuckBlocks = 20
+
+	tx1 := signedTx(t, 1, 10)
+	tx2 := signedTx(t, 2, 10)
+	require.Nil(q.SendTransaction(context.Background(), tx1))
+	require.Nil(q.SendTransaction(context.Background(), tx2))
+
+	// The transactions are submitted at the first block seen by the queue
+	require.Nil(q.checkTxs(context.Background()))
+	status := q.Status()
+	assert.Equal(big.NewInt(100), status.Head)
+	assert.Equal(uint64(20), status.StuckBlocks)
+	require.Len(status.Transactions, 2)
+	for _, qtx := range status.Transactions {
+		assert.Equal(big.NewInt(100), qtx.SubmittedBlock)
+	}
+
+	// Mined transactions are removed from the queue
+	backend.mine(tx1.Hash())
+	backend.head = 119
+	require.Nil(q.checkTxs(context.Background()))
+	status = q.Status()
+	require.Len(status.Transactions, 1)
+	assert.Equal(uint64(2), status.Transactions[0].Nonce)
+	assert.Empty(replaced)
+
+	// Transactions pending for stuckBlocks blocks are resubmitted
+	backend.head = 120
+	require.Nil(q.checkTxs(context.Background()))
+	require.Len(replaced, 1)
+	assert.Equal(tx2.Hash(), replaced[0].Hash())
+	status = q.Status()
+	require.Len(status.Transactions, 1)
+	qtx := status.Transactions[0]
+	assert.Equal(1, qtx.Replacements)
+	assert.Equal(big.NewInt(20), qtx.GasPrice)
+	assert.Equal(big.NewInt(120), qtx.SubmittedBlock)
+	assert.NotEqual(tx2.Hash(), qtx.Hash)
+
+	// The replaced transaction can still be mined
+	backend.head = 125
+	backend.mine(tx2.Hash())
+	require.Nil(q.checkTxs(context.Background()))
+	assert.Empty(q.Status().Transactions)
+	assert.Len(replaced, 1)
+
+	// Transactions are never resubmitted if stuckBlocks is 0
+	q.stuckBlocks = 0
+	require.Nil(q.SendTransaction(context.Background(), signedTx(t, 3, 10)))
+	backend.head = 1000
+	require.Nil(q.checkTxs(context.Background()))
+	assert.Len(replaced, 1)
+}
+
+func TestTxQueue_WaitMined(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	oldInterval := txQueueWaitInterval
+	txQueueWaitInterval = 10 * time.Millisecond
+	defer func() { txQueueWaitInterval = oldInterval }()
+
+	backend := &stubTxBackend{mined: make(map[ethcommon.Hash]bool)}
+	q := NewTxQueue(backend, backend, nil)
+	tx := signedTx(t, 1, 10)
+	require.Nil(q.SendTransaction(context.Background(), tx))
+
+	// The receipt of the transaction that replaced a transaction is returned
+	replacement := signedTx(t, 1, 20)
+	require.Nil(q.Resubmit(context.Background(), replacement))
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		backend.mine(replacement.Hash())
+	}()
+	receipt, err := q.WaitMined(context.Background(), tx)
+	require.Nil(err)
+	assert.Equal(replacement.Hash(), receipt.TxHash)
+
+	// Transactions that are not queued are waited for by their hash
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = q.WaitMined(ctx, signedTx(t, 7, 10))
+	assert.Equal(context.DeadlineExceeded, err)
+}
@@ -0,0 +1,206 @@
+package watchers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/eth/blockwatch"
+	"github.com/livepeer/go-livepeer/eth/contracts"
+)
+
+// protocolEventTypes are the events of the protocol contracts that are sent by a ProtocolEventBus,
+// and the types that they are decoded to
+var protocolEventTypes = map[string]func() interface{}{
+	"Bond":                  func() interface{} { return new(contracts.BondingManagerBond) },
+	"Unbond":                func() interface{} { return new(contracts.BondingManagerUnbond) },
+	"Rebond":                func() interface{} { return new(contracts.BondingManagerRebond) },
+	"WithdrawStake":         func() interface{} { return new(contracts.BondingManagerWithdrawStake) },
+	"NewRound":              func() interface{} { return new(contracts.RoundsManagerNewRound) },
+	"DepositFunded":         func() interface{} { return new(contracts.TicketBrokerDepositFunded) },
+	"ReserveFunded":         func() interface{} { return new(contracts.TicketBrokerReserveFunded) },
+	"Withdrawal":            func() interface{} { return new(contracts.TicketBrokerWithdrawal) },
+	"WinningTicketRedeemed": func() interface{} { return new(contracts.TicketBrokerWinningTicketRedeemed) },
+	"WinningTicketTransfer": func() interface{} { return new(contracts.TicketBrokerWinningTicketTransfer) },
+	"ReserveFrozen":         func() interface{} { return new(contracts.TicketBrokerReserveFrozen) },
+	"Unlock":                func() interface{} { return new(contracts.TicketBrokerUnlock) },
+	"UnlockCancelled":       func() interface{} { return new(contracts.TicketBrokerUnlockCancelled) },
+}
+
+// IsProtocolEvent returns whether name is the name of an event sent by a ProtocolEventBus
+func IsProtocolEvent(name string) bool {
+	_, ok := protocolEventTypes[name]
+	return ok
+}
+
+// ProtocolEvent is a decoded event of the protocol contracts
+type ProtocolEvent struct {
+	Name        string
+	BlockNumber uint64
+	BlockHash   ethcommon.Hash
+	TxHash      ethcommon.Hash
+	// Removed is set when the event is sent again because its block was removed by a reorg
+	Removed bool
+	// Event is the decoded event, e.g. *contracts.RoundsManagerNewRound for a NewRound event
+	Event interface{}
+}
+
+// MarshalJSON encodes the event with the fields of the decoded event as its args
+func (e *ProtocolEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Name        string                 `json:"name"`
+		BlockNumber uint64                 `json:"blockNumber"`
+		BlockHash   ethcommon.Hash         `json:"blockHash"`
+		TxHash      ethcommon.Hash         `json:"txHash"`
+		Removed     bool                   `json:"removed"`
+		Args        map[string]interface{} `json:"args"`
+	}{e.Name, e.BlockNumber, e.BlockHash, e.TxHash, e.Removed, eventArgs(e.Event)})
+}
+
+// eventArgs returns the fields of a decoded event, without its raw log
+func eventArgs(ev interface{}) map[string]interface{} {
+	args := make(map[string]interface{})
+	v := reflect.Indirect(reflect.ValueOf(ev))
+	if v.Kind() != reflect.Struct {
+		return args
+	}
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Name == "Raw" {
+			continue
+		}
+		name := strings.ToLower(field.Name[:1]) + field.Name[1:]
+		switch value := v.Field(i).Interface().(type) {
+		case *big.Int:
+			args[name] = value.String()
+		case [32]byte:
+			args[name] = ethcommon.Hash(value)
+		case []byte:
+			args[name] = hexutil.Bytes(value)
+		default:
+			args[name] = value
+		}
+	}
+	return args
+}
+
+// ProtocolEventBus decodes the events of the BondingManager, RoundsManager and TicketBroker contracts
+// from the logs of the block watcher, and sends them to its subscribers in the order of the chain,
+// so that the services of the node consume a single stream of protocol events
+type ProtocolEventBus struct {
+	decoders []*EventDecoder
+	watcher  BlockWatcher
+	quit     chan struct{}
+
+	feed  event.Feed
+	scope event.SubscriptionScope
+}
+
+// NewProtocolEventBus creates a ProtocolEventBus for the protocol contracts at the given addresses
+func NewProtocolEventBus(bondingManagerAddr, roundsManagerAddr, ticketBrokerAddr ethcommon.Address, watcher BlockWatcher) (*ProtocolEventBus, error) {
+	var decoders []*EventDecoder
+	for _, c := range []struct {
+		addr ethcommon.Address
+		abi  string
+	}{
+		{bondingManagerAddr, contracts.BondingManagerABI},
+		{roundsManagerAddr, contracts.RoundsManagerABI},
+		{ticketBrokerAddr, contracts.TicketBrokerABI},
+	} {
+		dec, err := NewEventDecoder(c.addr, c.abi)
+		if err != nil {
+			return nil, fmt.Errorf("error creating decoder: %v", err)
+		}
+		decoders = append(decoders, dec)
+	}
+	return &ProtocolEventBus{
+		decoders: decoders,
+		watcher:  watcher,
+		quit:     make(chan struct{}),
+	}, nil
+}
+
+// Subscribe subscribes to the protocol events. The sink channel should have ample buffer space,
+// since slow subscribers hold up the other subscribers
+func (b *ProtocolEventBus) Subscribe(sink chan<- *ProtocolEvent) event.Subscription {
+	return b.scope.Track(b.feed.Subscribe(sink))
+}
+
+// Watch starts the event watching loop
+func (b *ProtocolEventBus) Watch() {
+	events := make(chan []*blockwatch.Event, 10)
+	sub := b.watcher.Subscribe(events)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case <-b.quit:
+			return
+		case err := <-sub.Err():
+			glog.Error(err)
+		case events := <-events:
+			b.handleBlockEvents(events)
+		}
+	}
+}
+
+// Stop watching for events, and end the subscriptions
+func (b *ProtocolEventBus) Stop() {
+	close(b.quit)
+	b.scope.Close()
+}
+
+func (b *ProtocolEventBus) handleBlockEvents(events []*blockwatch.Event) {
+	for _, event := range events {
+		for _, log := range event.BlockHeader.Logs {
+			if event.Type == blockwatch.Removed {
+				log.Removed = true
+			}
+			ev, err := b.decode(log)
+			if err != nil {
+				glog.Error(err)
+				continue
+			}
+			if ev != nil {
+				b.feed.Send(ev)
+			}
+		}
+	}
+}
+
+// decode returns the protocol event of a log, or nil if the log is not a protocol event
+func (b *ProtocolEventBus) decode(log types.Log) (*ProtocolEvent, error) {
+	if len(log.Topics) == 0 {
+		return nil, nil
+	}
+	for _, dec := range b.decoders {
+		name, err := dec.FindEventName(log)
+		if err != nil {
+			continue
+		}
+		newEvent, ok := protocolEventTypes[name]
+		if !ok {
+			return nil, nil
+		}
+		ev := newEvent()
+		if err := dec.Decode(name, log, ev); err != nil {
+			return nil, fmt.Errorf("failed to decode %v event: %v", name, err)
+		}
+		reflect.ValueOf(ev).Elem().FieldByName("Raw").Set(reflect.ValueOf(log))
+		return &ProtocolEvent{
+			Name:        name,
+			BlockNumber: log.BlockNumber,
+			BlockHash:   log.BlockHash,
+			TxHash:      log.TxHash,
+			Removed:     log.Removed,
+			Event:       ev,
+		}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,124 @@
+package watchers
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/eth/blockwatch"
+	"github.com/livepeer/go-livepeer/eth/contracts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtocolEventBus(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	watcher := &stubBlockWatcher{}
+	bus, err := NewProtocolEventBus(stubBondingManagerAddr, stubRoundsManagerAddr, stubTicketBrokerAddr, watcher)
+	require.Nil(err)
+
+	header := defaultMiniHeader()
+	header.Logs = append(header.Logs, newStubNewRoundLog(), newStubUnbondLog(), newStubWinningTicketLog(), newStubReserveFundedLog())
+	blockEvent := &blockwatch.Event{
+		Type:        blockwatch.Added,
+		BlockHeader: header,
+	}
+
+	sink := make(chan *ProtocolEvent, 10)
+	sub := bus.Subscribe(sink)
+	defer sub.Unsubscribe()
+
+	go bus.Watch()
+	time.Sleep(2 * time.Millisecond)
+
+	receive := func() *ProtocolEvent {
+		select {
+		case ev := <-sink:
+			return ev
+		case <-time.After(time.Second):
+			t.Fatal("protocol event not sent")
+		}
+		return nil
+	}
+
+	// Events are sent in the order of the logs, and logs of other contracts are skipped
+	watcher.sink <- []*blockwatch.Event{blockEvent}
+	ev := receive()
+	assert.Equal("NewRound", ev.Name)
+	assert.Equal(uint64(30), ev.BlockNumber)
+	assert.False(ev.Removed)
+	newRound, ok := ev.Event.(*contracts.RoundsManagerNewRound)
+	require.True(ok)
+	assert.Equal(big.NewInt(8), newRound.Round)
+	assert.Equal(header.Logs[1], newRound.Raw)
+
+	ev = receive()
+	assert.Equal("Unbond", ev.Name)
+	unbond, ok := ev.Event.(*contracts.BondingManagerUnbond)
+	require.True(ok)
+	assert.Equal(big.NewInt(1457), unbond.WithdrawRound)
+
+	ev = receive()
+	assert.Equal("WinningTicketTransfer", ev.Name)
+	transfer, ok := ev.Event.(*contracts.TicketBrokerWinningTicketTransfer)
+	require.True(ok)
+	assert.Equal(stubSender, transfer.Sender)
+	assert.Equal(big.NewInt(200000000000), transfer.Amount)
+
+	ev = receive()
+	assert.Equal("ReserveFunded", ev.Name)
+
+	// Events of removed blocks are sent again as removed
+	blockEvent.Type = blockwatch.Removed
+	watcher.sink <- []*blockwatch.Event{blockEvent}
+	ev = receive()
+	assert.Equal("NewRound", ev.Name)
+	assert.True(ev.Removed)
+	assert.True(ev.Event.(*contracts.RoundsManagerNewRound).Raw.Removed)
+	for i := 0; i < 3; i++ {
+		assert.True(receive().Removed)
+	}
+
+	// Subscriptions end when the bus is stopped
+	bus.Stop()
+	select {
+	case <-sub.Err():
+	case <-time.After(time.Second):
+		t.Fatal("subscription not ended")
+	}
+}
+
+func TestProtocolEvent_MarshalJSON(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	bus, err := NewProtocolEventBus(stubBondingManagerAddr, stubRoundsManagerAddr, stubTicketBrokerAddr, &stubBlockWatcher{})
+	require.Nil(err)
+
+	ev, err := bus.decode(newStubNewRoundLog())
+	require.Nil(err)
+	require.NotNil(ev)
+
+	b, err := json.Marshal(ev)
+	require.Nil(err)
+	var res map[string]interface{}
+	require.Nil(json.Unmarshal(b, &res))
+	assert.Equal("NewRound", res["name"])
+	assert.Equal(float64(30), res["blockNumber"])
+	assert.Equal(false, res["removed"])
+	assert.Equal(map[string]interface{}{
+		"round":     "8",
+		"blockHash": "0x15063b24c3dfd390370cd13eaf27fd0b079c60f31bf1414c574f865e906a8964",
+	}, res["args"])
+
+	// Logs of unknown contracts or events are not protocol events
+	log := newStubNewRoundLog()
+	log.Address = stubSender
+	ev, err = bus.decode(log)
+	assert.Nil(err)
+	assert.Nil(ev)
+	ev, err = bus.decode(defaultMiniHeader().Logs[0])
+	assert.Nil(err)
+	assert.Nil(ev)
+}
@@ -6,6 +6,7 @@ import (
 )
 
 var eventSignatures = []string{
+	"Bond(address,address,address,uint256,uint256)",
 	"Unbond(address,address,uint256,uint256,uint256)",
 	"Rebond(address,address,uint256,uint256)",
 	"WithdrawStake(address,uint256,uint256,uint256)",
@@ -14,6 +15,7 @@ var eventSignatures = []string{
 	"ReserveFunded(address,uint256)",
 	"Withdrawal(address,uint256,uint256)",
 	"WinningTicketTransfer(address,address,uint256,uint256)",
+	"WinningTicketRedeemed(address,address,uint256,uint256,uint256,uint256,bytes)",
 	"ReserveFrozen(address,address,uint256,uint256)",
 	"Unlock(address,uint256,uint256)",
 	"UnlockCancelled(address)",
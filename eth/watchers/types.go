@@ -8,3 +8,8 @@ import (
 type BlockWatcher interface {
 	Subscribe(sink chan<- []*blockwatch.Event) event.Subscription
 }
+
+// ProtocolEventSubscriber is a stream of the events of the protocol contracts
+type ProtocolEventSubscriber interface {
+	Subscribe(sink chan<- *ProtocolEvent) event.Subscription
+}
@@ -145,6 +145,9 @@ func (w *UnbondingWatcher) handleLog(log types.Log) error {
 		if err := w.store.UseUnbondingLock(withdrawStakeEvent.UnbondingLockId, withdrawStakeEvent.Delegator, usedBlock); err != nil {
 			return processEventError("WithdrawStake", log.Removed, err)
 		}
+	case "Bond":
+		// Noop since bonds don't change unbonding locks, but the event is watched for the protocol event bus
+		return nil
 	default:
 		return fmt.Errorf("could not process %v event", eventName)
 	}
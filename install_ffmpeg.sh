@@ -53,6 +53,47 @@ if [ ! -e "$HOME/x264" ]; then
   make install-lib-static
 fi
 
+if [ ! -e "$HOME/x265" ]; then
+  git clone https://bitbucket.org/multicoreware/x265_git.git "$HOME/x265"
+  cd "$HOME/x265"
+  git checkout 3.4
+  cd build/linux
+  cmake -G "Unix Makefiles" -DCMAKE_INSTALL_PREFIX="$HOME/compiled" -DENABLE_SHARED=off -DENABLE_CLI=off ../../source
+  make
+  make install
+fi
+
+if [ ! -e "$HOME/libvpx" ]; then
+  git clone https://chromium.googlesource.com/webm/libvpx.git "$HOME/libvpx"
+  cd "$HOME/libvpx"
+  git checkout v1.9.0
+  ./configure --prefix="$HOME/compiled" --enable-pic --enable-static --disable-shared \
+    --disable-examples --disable-tools --disable-docs --disable-unit-tests --disable-vp8
+  make
+  make install
+fi
+
+if [ ! -e "$HOME/opus" ]; then
+  git clone https://github.com/xiph/opus.git "$HOME/opus"
+  cd "$HOME/opus"
+  git checkout v1.3.1
+  ./autogen.sh
+  ./configure --prefix="$HOME/compiled" --enable-static --disable-shared ${HOST_OS:-} \
+    --disable-doc --disable-extra-programs
+  make
+  make install
+fi
+
+if [ ! -e "$HOME/libwebp" ]; then
+  git clone https://chromium.googlesource.com/webm/libwebp "$HOME/libwebp"
+  cd "$HOME/libwebp"
+  git checkout v1.1.0
+  ./autogen.sh
+  ./configure --prefix="$HOME/compiled" --enable-static --disable-shared ${HOST_OS:-}
+  make
+  make install
+fi
+
 EXTRA_FFMPEG_FLAGS=""
 # Only Linux supports CUDA... for now.
 if [ $(uname) == "Linux" ]; then
@@ -70,15 +111,16 @@ if [ ! -e "$HOME/ffmpeg/libavcodec/libavcodec.a" ]; then
     --disable-muxers --disable-demuxers --disable-parsers --disable-protocols \
     --disable-encoders --disable-decoders --disable-filters --disable-bsfs \
     --disable-postproc --disable-lzma \
-    --enable-gnutls --enable-libx264 --enable-gpl --enable-nonfree \
+    --enable-gnutls --enable-libx264 --enable-libx265 --enable-libvpx --enable-libopus --enable-libwebp --enable-gpl --enable-nonfree \
+    --pkg-config-flags=--static \
     --enable-protocol=https,rtmp,file \
-    --enable-muxer=mpegts,hls,segment --enable-demuxer=flv,mpegts \
-    --enable-bsf=h264_mp4toannexb,aac_adtstoasc,h264_metadata,h264_redundant_pps \
-    --enable-parser=aac,aac_latm,h264 \
+    --enable-muxer=mpegts,hls,segment,mp4,image2 --enable-demuxer=flv,mpegts,mov \
+    --enable-bsf=h264_mp4toannexb,aac_adtstoasc,h264_metadata,h264_redundant_pps,vp9_superframe \
+    --enable-parser=aac,aac_latm,h264,hevc,vp9 \
     --enable-filter=abuffer,buffer,abuffersink,buffersink,afifo,fifo,aformat \
     --enable-filter=aresample,asetnsamples,fps,scale \
-    --enable-encoder=aac,libx264 \
-    --enable-decoder=aac,h264 \
+    --enable-encoder=aac,libx264,libx265,libvpx_vp9,libopus,mjpeg,libwebp,png \
+    --enable-decoder=aac,h264,hevc,vp9 \
     --extra-cflags="-I${HOME}/compiled/include" \
     --extra-ldflags="-L${HOME}/compiled/lib" \
     --prefix="$HOME/compiled" \
@@ -0,0 +1,114 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// Backends that the metrics of the node can be sent to
+const (
+	// Metrics are pulled from the /metrics endpoint of the CLI webserver
+	BackendPrometheus = "prometheus"
+	// Metrics are pushed to a StatsD server over UDP
+	BackendStatsD = "statsd"
+	// Metrics are pushed to an OpenTelemetry collector over OTLP/HTTP
+	BackendOTLP = "otlp"
+)
+
+// MetricsBackend receives the data of every metric of the node at the end of every reporting period
+type MetricsBackend interface {
+	view.Exporter
+}
+
+// MetricsBackendConfig configures the backends that the metrics of the node are sent to
+type MetricsBackendConfig struct {
+	// Comma-separated list of the backends. Only Prometheus is used if empty
+	Backends string
+	// Address of the StatsD server, e.g. 127.0.0.1:8125
+	StatsDAddr string
+	// URL of the OTLP/HTTP metrics endpoint of the collector, e.g. http://127.0.0.1:4318/v1/metrics
+	OTLPEndpoint string
+	// How often metrics are pushed to the StatsD and OTLP backends. DefaultMetricsPushInterval if 0
+	PushInterval time.Duration
+}
+
+// DefaultMetricsPushInterval is how often metrics are pushed to the StatsD and OTLP backends by default
+const DefaultMetricsPushInterval = 10 * time.Second
+
+var (
+	prometheusEnabled = true
+	pushBackends      []MetricsBackend
+	pushInterval      time.Duration
+)
+
+// SetMetricsBackends sets the backends that the metrics of the node are sent to. Backends take
+// effect when the metrics are initialized
+func SetMetricsBackends(cfg MetricsBackendConfig) error {
+	if cfg.Backends == "" {
+		cfg.Backends = BackendPrometheus
+	}
+	if cfg.PushInterval < 0 {
+		return fmt.Errorf("the metrics push interval must not be negative")
+	}
+
+	prometheus := false
+	var backends []MetricsBackend
+	for _, name := range strings.Split(cfg.Backends, ",") {
+		switch strings.TrimSpace(name) {
+		case BackendPrometheus:
+			prometheus = true
+		case BackendStatsD:
+			if cfg.StatsDAddr == "" {
+				return fmt.Errorf("the StatsD backend requires the address of the StatsD server")
+			}
+			b, err := NewStatsDBackend(cfg.StatsDAddr)
+			if err != nil {
+				return err
+			}
+			backends = append(backends, b)
+		case BackendOTLP:
+			if cfg.OTLPEndpoint == "" {
+				return fmt.Errorf("the OTLP backend requires the URL of the metrics endpoint of the collector")
+			}
+			backends = append(backends, NewOTLPBackend(cfg.OTLPEndpoint))
+		default:
+			return fmt.Errorf("unknown metrics backend %q", name)
+		}
+	}
+	prometheusEnabled, pushBackends, pushInterval = prometheus, backends, cfg.PushInterval
+	return nil
+}
+
+// registerPushBackends registers the backends that metrics are pushed to as exporters of the views
+func registerPushBackends() {
+	if len(pushBackends) == 0 {
+		return
+	}
+	interval := pushInterval
+	if interval == 0 {
+		interval = DefaultMetricsPushInterval
+	}
+	view.SetReportingPeriod(interval)
+	for _, b := range pushBackends {
+		view.RegisterExporter(b)
+		if o, ok := b.(*OTLPBackend); ok {
+			go o.flushLoop(interval)
+		}
+	}
+}
+
+// rowKey identifies the values of the tags of a row of a metric
+func rowKey(name string, tags []tag.Tag) string {
+	parts := make([]string, 0, len(tags)+1)
+	parts = append(parts, name)
+	for _, t := range tags {
+		parts = append(parts, t.Key.Name()+"="+t.Value)
+	}
+	sort.Strings(parts[1:])
+	return strings.Join(parts, ",")
+}
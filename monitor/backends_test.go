@@ -0,0 +1,143 @@
+package monitor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+func TestSetMetricsBackends(t *testing.T) {
+	assert := assert.New(t)
+	defer SetMetricsBackends(MetricsBackendConfig{})
+
+	assert.Nil(SetMetricsBackends(MetricsBackendConfig{}))
+	assert.True(prometheusEnabled)
+	assert.Empty(pushBackends)
+
+	assert.NotNil(SetMetricsBackends(MetricsBackendConfig{Backends: "graphite"}))
+	assert.NotNil(SetMetricsBackends(MetricsBackendConfig{Backends: "statsd"}))
+	assert.NotNil(SetMetricsBackends(MetricsBackendConfig{Backends: "otlp"}))
+	assert.NotNil(SetMetricsBackends(MetricsBackendConfig{PushInterval: -time.Second}))
+	// Invalid backends leave the backends unchanged
+	assert.True(prometheusEnabled)
+
+	assert.Nil(SetMetricsBackends(MetricsBackendConfig{
+		Backends:     "statsd, otlp",
+		StatsDAddr:   "127.0.0.1:8125",
+		OTLPEndpoint: "http://127.0.0.1:4318/v1/metrics",
+	}))
+	assert.False(prometheusEnabled)
+	require.Len(t, pushBackends, 2)
+	assert.IsType(&StatsDBackend{}, pushBackends[0])
+	assert.IsType(&OTLPBackend{}, pushBackends[1])
+}
+
+func stubViewData(agg *view.Aggregation, tags []tag.Tag, data view.AggregationData) *view.Data {
+	return &view.Data{
+		View: &view.View{
+			Name:        "segments_total",
+			Description: "Segments",
+			Measure:     stats.Int64("segments_total", "Segments", "tot"),
+			Aggregation: agg,
+		},
+		Start: time.Unix(100, 0),
+		End:   time.Unix(110, 0),
+		Rows:  []*view.Row{{Tags: tags, Data: data}},
+	}
+}
+
+func TestStatsDBackend(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(err)
+	defer conn.Close()
+	b, err := NewStatsDBackend(conn.LocalAddr().String())
+	require.Nil(err)
+
+	read := func() string {
+		buf := make([]byte, statsDMaxPacketSize)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		require.Nil(err)
+		return string(buf[:n])
+	}
+	tags := []tag.Tag{{Key: tag.MustNewKey("node_id"), Value: "a,b"}}
+
+	// Counters are sent as their increase
+	b.ExportView(stubViewData(view.Count(), tags, &view.CountData{Value: 3}))
+	assert.Equal("livepeer.segments_total:3|c|#node_id:a_b", read())
+	b.ExportView(stubViewData(view.Count(), tags, &view.CountData{Value: 5}))
+	assert.Equal("livepeer.segments_total:2|c|#node_id:a_b", read())
+
+	b.ExportView(stubViewData(view.LastValue(), nil, &view.LastValueData{Value: 1.5}))
+	assert.Equal("livepeer.segments_total:1.5|g", read())
+
+	b.ExportView(stubViewData(view.Distribution(1, 2), nil, &view.DistributionData{Count: 4, Mean: 0.5}))
+	assert.Equal("livepeer.segments_total.count:4|c\nlivepeer.segments_total.sum:2|c", read())
+}
+
+func TestOTLPBackend(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var bodies []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("application/json", r.Header.Get("Content-Type"))
+		data, err := ioutil.ReadAll(r.Body)
+		require.Nil(err)
+		var body map[string]interface{}
+		require.Nil(json.Unmarshal(data, &body))
+		bodies = append(bodies, body)
+	}))
+	defer ts.Close()
+
+	b := NewOTLPBackend(ts.URL)
+	// Nothing is sent without metrics
+	assert.Nil(b.Flush())
+	assert.Empty(bodies)
+
+	tags := []tag.Tag{{Key: tag.MustNewKey("node_id"), Value: "o1"}}
+	b.ExportView(stubViewData(view.Count(), tags, &view.CountData{Value: 3}))
+	assert.Nil(b.Flush())
+	require.Len(bodies, 1)
+	data, err := json.Marshal(bodies[0])
+	require.Nil(err)
+	body := string(data)
+	assert.Contains(body, `"name":"livepeer_segments_total"`)
+	assert.Contains(body, `"asInt":"3"`)
+	assert.Contains(body, `"isMonotonic":true`)
+	assert.Contains(body, `"aggregationTemporality":2`)
+	assert.Contains(body, `{"key":"node_id","value":{"stringValue":"o1"}}`)
+	assert.Contains(body, `"startTimeUnixNano":"100000000000"`)
+
+	b.ExportView(stubViewData(view.Distribution(1, 2), nil, &view.DistributionData{Count: 4, Mean: 0.5, Min: 0.1, Max: 1.5, CountPerBucket: []int64{3, 1, 0}}))
+	assert.Nil(b.Flush())
+	require.Len(bodies, 2)
+	data, err = json.Marshal(bodies[1])
+	require.Nil(err)
+	body = string(data)
+	assert.Contains(body, `"histogram"`)
+	assert.Contains(body, `"bucketCounts":["3","1","0"]`)
+	assert.Contains(body, `"explicitBounds":[1,2]`)
+	assert.Contains(body, `"sum":2`)
+	assert.False(strings.Contains(body, "asInt"))
+
+	// Errors of the collector are returned
+	b = NewOTLPBackend(ts.URL + "/missing")
+	ts.Config.Handler = http.NotFoundHandler()
+	b.ExportView(stubViewData(view.LastValue(), nil, &view.LastValueData{Value: 1}))
+	assert.NotNil(b.Flush())
+}
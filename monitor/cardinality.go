@@ -0,0 +1,159 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.opencensus.io/tag"
+)
+
+// Labels of metrics whose number of values grows with the number of streams, senders, recipients
+// and transcoders of the node
+const (
+	LabelSender     = "sender"
+	LabelRecipient  = "recipient"
+	LabelManifestID = "manifestID"
+	LabelTranscoder = "transcoder"
+)
+
+// LabelOther is the value that metrics are recorded with for the values of a label beyond its limit
+const LabelOther = "other"
+
+// Maximum number of values of a label whose recordings are counted to find the top values
+const maxLabelCandidates = 10000
+
+type labelValueCount struct {
+	count int64
+	top   bool
+}
+
+var labelLimits struct {
+	mu        sync.Mutex
+	dropped   map[string]bool
+	allowed   map[string]map[string]bool
+	maxValues int
+	values    map[string]map[string]*labelValueCount
+	tops      map[string]int
+}
+
+func isLimitedLabel(label string) bool {
+	switch label {
+	case LabelSender, LabelRecipient, LabelManifestID, LabelTranscoder:
+		return true
+	}
+	return false
+}
+
+// SetLabelLimits sets the limits on the values of the labels of metrics. dropped is a comma-separated
+// list of labels that are removed from all metrics. If maxValues is greater than 0, only the maxValues
+// values of each label that were recorded the most, and the values of allowlist, are recorded and the
+// others are aggregated as LabelOther. allowlist is a comma-separated list of label=value pairs.
+// Dropped labels take effect when the metrics are initialized
+func SetLabelLimits(dropped, allowlist string, maxValues int) error {
+	if maxValues < 0 {
+		return fmt.Errorf("the maximum number of label values must not be negative")
+	}
+	drop := make(map[string]bool)
+	for _, label := range strings.Split(dropped, ",") {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			continue
+		}
+		if !isLimitedLabel(label) {
+			return fmt.Errorf("label %q can't be dropped", label)
+		}
+		drop[label] = true
+	}
+	allow := make(map[string]map[string]bool)
+	for _, entry := range strings.Split(allowlist, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 || kv[1] == "" || !isLimitedLabel(kv[0]) {
+			return fmt.Errorf("invalid label allowlist entry %q", entry)
+		}
+		if allow[kv[0]] == nil {
+			allow[kv[0]] = make(map[string]bool)
+		}
+		allow[kv[0]][strings.ToLower(kv[1])] = true
+	}
+
+	labelLimits.mu.Lock()
+	defer labelLimits.mu.Unlock()
+	labelLimits.dropped, labelLimits.allowed, labelLimits.maxValues = drop, allow, maxValues
+	labelLimits.values = make(map[string]map[string]*labelValueCount)
+	labelLimits.tops = make(map[string]int)
+	return nil
+}
+
+// withoutDroppedLabels returns the keys of the labels of a metric that are not dropped
+func withoutDroppedLabels(keys []tag.Key) []tag.Key {
+	labelLimits.mu.Lock()
+	defer labelLimits.mu.Unlock()
+
+	var kept []tag.Key
+	for _, k := range keys {
+		if !labelLimits.dropped[k.Name()] {
+			kept = append(kept, k)
+		}
+	}
+	return kept
+}
+
+// labelValue returns the value that a metric is recorded with for a value of label, redacted if
+// redact is set, and counts the recording to find the top values of the label
+func labelValue(label, value string, redact bool) string {
+	if value == "" || !isLimited(label, value) {
+		if redact {
+			return Redact(value)
+		}
+		return value
+	}
+	return LabelOther
+}
+
+func isLimited(label, value string) bool {
+	labelLimits.mu.Lock()
+	defer labelLimits.mu.Unlock()
+
+	if labelLimits.maxValues <= 0 || labelLimits.dropped[label] || labelLimits.allowed[label][strings.ToLower(value)] {
+		return false
+	}
+	values := labelLimits.values[label]
+	if values == nil {
+		values = make(map[string]*labelValueCount)
+		labelLimits.values[label] = values
+	}
+	v, ok := values[value]
+	if !ok {
+		if len(values) >= maxLabelCandidates {
+			return true
+		}
+		v = &labelValueCount{}
+		values[value] = v
+	}
+	v.count++
+	if v.top {
+		return false
+	}
+	if labelLimits.tops[label] < labelLimits.maxValues {
+		v.top = true
+		labelLimits.tops[label]++
+		return false
+	}
+	// Replace the top value that was recorded the least if this value was recorded more
+	var min *labelValueCount
+	for _, c := range values {
+		if c.top && (min == nil || c.count < min.count) {
+			min = c
+		}
+	}
+	if min != nil && v.count > min.count {
+		min.top, v.top = false, true
+		return false
+	}
+	return true
+}
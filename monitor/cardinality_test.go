@@ -0,0 +1,58 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/tag"
+)
+
+func TestLabelLimits(t *testing.T) {
+	assert := assert.New(t)
+	defer SetLabelLimits("", "", 0)
+
+	// Not limited by default
+	for _, v := range []string{"a", "b", "c"} {
+		assert.Equal(v, labelValue(LabelSender, v, true))
+	}
+
+	assert.NotNil(SetLabelLimits("", "", -1))
+	assert.NotNil(SetLabelLimits("node_id", "", 0))
+	assert.NotNil(SetLabelLimits("", "sender", 0))
+	assert.NotNil(SetLabelLimits("", "profile=P240p30fps16x9", 0))
+
+	assert.Nil(SetLabelLimits("", "sender=0xABC", 2))
+	assert.Equal("a", labelValue(LabelSender, "a", true))
+	assert.Equal("b", labelValue(LabelSender, "b", true))
+	assert.Equal(LabelOther, labelValue(LabelSender, "c", true))
+	// Allowlisted values are kept regardless of their case
+	assert.Equal("0xabc", labelValue(LabelSender, "0xabc", true))
+	// Labels are limited separately
+	assert.Equal("c", labelValue(LabelManifestID, "c", true))
+	assert.Equal("", labelValue(LabelSender, "", true))
+
+	// A value recorded more than a top value replaces it
+	assert.Equal("a", labelValue(LabelSender, "a", true))
+	assert.Equal("c", labelValue(LabelSender, "c", true))
+	assert.Equal(LabelOther, labelValue(LabelSender, "b", true))
+	assert.Equal("a", labelValue(LabelSender, "a", true))
+
+	// Kept values are redacted, and the aggregate isn't
+	defer SetRedaction(RedactionNone, "")
+	assert.Nil(SetRedaction(RedactionTruncate, ""))
+	assert.Equal("0x...", labelValue(LabelSender, "0xABC", true))
+	assert.Equal("a", labelValue(LabelSender, "a", false))
+	assert.Equal(LabelOther, labelValue(LabelSender, "d", true))
+}
+
+func TestDroppedLabels(t *testing.T) {
+	assert := assert.New(t)
+	defer SetLabelLimits("", "", 0)
+	sender, manifestID, nodeID := tag.MustNewKey("sender"), tag.MustNewKey("manifestID"), tag.MustNewKey("node_id")
+
+	keys := []tag.Key{sender, manifestID, nodeID}
+	assert.Equal(keys, withoutDroppedLabels(keys))
+
+	assert.Nil(SetLabelLimits("sender, manifestID", "", 0))
+	assert.Equal([]tag.Key{nodeID}, withoutDroppedLabels(keys))
+}
@@ -42,6 +42,9 @@ const (
 	SegmentTranscodeErrorSaveData           SegmentTranscodeError = "SaveData"
 	SegmentTranscodeErrorSessionEnded       SegmentTranscodeError = "SessionEnded"
 	SegmentTranscodeErrorPlaylist           SegmentTranscodeError = "Playlist"
+	SegmentTranscodeErrorSend               SegmentTranscodeError = "Send"
+	SegmentTranscodeErrorTimeout            SegmentTranscodeError = "Timeout"
+	SegmentTranscodeErrorSignature          SegmentTranscodeError = "Signature"
 
 	numberOfSegmentsToCalcAverage = 30
 	gweiConversionFactor          = 1000000000
@@ -67,6 +70,8 @@ type (
 		kSender                       tag.Key
 		kRecipient                    tag.Key
 		kManifestID                   tag.Key
+		kTranscoder                   tag.Key
+		kFeature                      tag.Key
 		mSegmentSourceAppeared        *stats.Int64Measure
 		mSegmentEmerged               *stats.Int64Measure
 		mSegmentEmergedUnprocessed    *stats.Int64Measure
@@ -84,11 +89,22 @@ type (
 		mStreamEnded                  *stats.Int64Measure
 		mMaxSessions                  *stats.Int64Measure
 		mCurrentSessions              *stats.Int64Measure
+		mSessionsRejected             *stats.Int64Measure
 		mDiscoveryError               *stats.Int64Measure
 		mTranscodeRetried             *stats.Int64Measure
 		mTranscodersNumber            *stats.Int64Measure
 		mTranscodersCapacity          *stats.Int64Measure
 		mTranscodersLoad              *stats.Int64Measure
+		mTranscoderRegistered         *stats.Int64Measure
+		mTranscoderDisconnected       *stats.Int64Measure
+		mTranscoderSegments           *stats.Int64Measure
+		mTranscoderRoundTrip          *stats.Float64Measure
+		mTranscoderRetried            *stats.Int64Measure
+		mTranscoderVersionDrift       *stats.Int64Measure
+		mTranscoderSteals             *stats.Int64Measure
+		mTranscoderStealsWon          *stats.Int64Measure
+		mProtocolDeprecations         *stats.Int64Measure
+		mOrchCertPinMismatches        *stats.Int64Measure
 		mSuccessRate                  *stats.Float64Measure
 		mTranscodeTime                *stats.Float64Measure
 		mTranscodeLatency             *stats.Float64Measure
@@ -111,6 +127,16 @@ type (
 		mSuggestedGasPrice            *stats.Float64Measure
 		mTranscodingPrice             *stats.Float64Measure
 
+		// Metrics for initializing rounds
+		mRoundsInitialized          *stats.Int64Measure
+		mRoundInitializationGas     *stats.Float64Measure
+		mRoundInitializationSkipped *stats.Int64Measure
+
+		// Metrics for calling reward
+		mRewardCalls      *stats.Int64Measure
+		mRewardCallErrors *stats.Int64Measure
+		mRewardAlerts     *stats.Int64Measure
+
 		lock        sync.Mutex
 		emergeTimes map[uint64]map[uint64]time.Time // nonce:seqNo
 		success     map[uint64]*segmentsAverager
@@ -139,7 +165,7 @@ type (
 	}
 )
 
-// Exporter Prometheus exporter that handles `/metrics` endpoint
+// Exporter Prometheus exporter that handles `/metrics` endpoint. nil if the Prometheus backend is disabled
 var Exporter *prometheus.Exporter
 
 var census censusMetricsCounter
@@ -148,6 +174,8 @@ var census censusMetricsCounter
 var unitTestMode bool
 
 func InitCensus(nodeType, nodeID, version string) {
+	// The ID of orchestrators and broadcasters is their ETH address
+	nodeID = Redact(nodeID)
 	census = censusMetricsCounter{
 		emergeTimes: make(map[uint64]map[uint64]time.Time),
 		nodeID:      nodeID,
@@ -163,7 +191,9 @@ func InitCensus(nodeType, nodeID, version string) {
 	census.kTry = tag.MustNewKey("try")
 	census.kSender = tag.MustNewKey("sender")
 	census.kRecipient = tag.MustNewKey("recipient")
+	census.kTranscoder = tag.MustNewKey("transcoder")
 	census.kManifestID = tag.MustNewKey("manifestID")
+	census.kFeature = tag.MustNewKey("feature")
 	census.ctx, err = tag.New(context.Background(), tag.Insert(census.kNodeType, nodeType), tag.Insert(census.kNodeID, nodeID))
 	if err != nil {
 		glog.Fatal("Error creating context", err)
@@ -185,11 +215,22 @@ func InitCensus(nodeType, nodeID, version string) {
 	census.mStreamEnded = stats.Int64("stream_ended_total", "StreamEnded", "tot")
 	census.mMaxSessions = stats.Int64("max_sessions_total", "MaxSessions", "tot")
 	census.mCurrentSessions = stats.Int64("current_sessions_total", "Number of currently transcded streams", "tot")
+	census.mSessionsRejected = stats.Int64("sessions_rejected_total", "Number of sessions rejected because the node is at capacity", "tot")
 	census.mDiscoveryError = stats.Int64("discovery_errors_total", "Number of discover errors", "tot")
 	census.mTranscodeRetried = stats.Int64("transcode_retried", "Number of times segment transcode was retried", "tot")
 	census.mTranscodersNumber = stats.Int64("transcoders_number", "Number of transcoders currently connected to orchestrator", "tot")
 	census.mTranscodersCapacity = stats.Int64("transcoders_capacity", "Total advertised capacity of transcoders currently connected to orchestrator", "tot")
 	census.mTranscodersLoad = stats.Int64("transcoders_load", "Total load of transcoders currently connected to orchestrator", "tot")
+	census.mTranscoderRegistered = stats.Int64("transcoder_registrations_total", "Number of times a remote transcoder registered with orchestrator", "tot")
+	census.mTranscoderDisconnected = stats.Int64("transcoder_disconnects_total", "Number of times a remote transcoder disconnected from orchestrator", "tot")
+	census.mTranscoderSegments = stats.Int64("transcoder_segments_total", "Number of segments transcoded by a remote transcoder", "tot")
+	census.mTranscoderRoundTrip = stats.Float64("transcoder_round_trip_seconds", "Time from sending a segment to a remote transcoder till receiving its results", "sec")
+	census.mTranscoderRetried = stats.Int64("transcoder_retries_total", "Number of segments retried with another remote transcoder after a fatal error", "tot")
+	census.mTranscoderSteals = stats.Int64("transcoder_steals_total", "Number of segments that exceeded the soft deadline on a remote transcoder and were also assigned to another one", "tot")
+	census.mTranscoderStealsWon = stats.Int64("transcoder_steals_won_total", "Number of stolen segments for which the second remote transcoder returned results first", "tot")
+	census.mTranscoderVersionDrift = stats.Int64("transcoder_version_drift_total", "Number of remote transcoders registered with a version incompatible with the rest of the pool", "tot")
+	census.mProtocolDeprecations = stats.Int64("protocol_deprecations_total", "Number of orchestrators that announced that they will drop a protocol feature", "tot")
+	census.mOrchCertPinMismatches = stats.Int64("orchestrator_cert_pin_mismatches_total", "Number of connections to orchestrators rejected because the certificate did not match the pinned one", "tot")
 	census.mSuccessRate = stats.Float64("success_rate", "Success rate", "per")
 	census.mTranscodeTime = stats.Float64("transcode_time_seconds", "Transcoding time", "sec")
 	census.mTranscodeLatency = stats.Float64("transcode_latency_seconds",
@@ -214,6 +255,16 @@ func InitCensus(nodeType, nodeID, version string) {
 	census.mSuggestedGasPrice = stats.Float64("suggested_gas_price", "SuggestedGasPrice", "gwei")
 	census.mTranscodingPrice = stats.Float64("transcoding_price", "TranscodingPrice", "wei")
 
+	// Metrics for initializing rounds
+	census.mRoundsInitialized = stats.Int64("rounds_initialized", "RoundsInitialized", "tot")
+	census.mRoundInitializationGas = stats.Float64("round_initialization_gas_spent", "RoundInitializationGasSpent", "gwei")
+	census.mRoundInitializationSkipped = stats.Int64("round_initializations_skipped", "RoundInitializationSkipped", "tot")
+
+	// Metrics for calling reward
+	census.mRewardCalls = stats.Int64("reward_calls", "RewardCalls", "tot")
+	census.mRewardCallErrors = stats.Int64("reward_call_errors", "RewardCallErrors", "tot")
+	census.mRewardAlerts = stats.Int64("reward_alerts", "RewardAlerts", "tot")
+
 	glog.Infof("Compiler: %s Arch %s OS %s Go version %s", runtime.Compiler, runtime.GOARCH, runtime.GOOS, runtime.Version())
 	glog.Infof("Livepeer version: %s", version)
 	glog.Infof("Node type %s node ID %s", nodeType, nodeID)
@@ -392,6 +443,13 @@ func InitCensus(nodeType, nodeID, version string) {
 			TagKeys:     baseTags,
 			Aggregation: view.LastValue(),
 		},
+		&view.View{
+			Name:        "sessions_rejected_total",
+			Measure:     census.mSessionsRejected,
+			Description: "Number of sessions rejected because the node is at capacity",
+			TagKeys:     baseTags,
+			Aggregation: view.Count(),
+		},
 		&view.View{
 			Name:        "discovery_errors_total",
 			Measure:     census.mDiscoveryError,
@@ -427,6 +485,76 @@ func InitCensus(nodeType, nodeID, version string) {
 			TagKeys:     baseTags,
 			Aggregation: view.LastValue(),
 		},
+		&view.View{
+			Name:        "transcoder_registrations_total",
+			Measure:     census.mTranscoderRegistered,
+			Description: "Number of times a remote transcoder registered with orchestrator",
+			TagKeys:     append([]tag.Key{census.kTranscoder}, baseTags...),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "transcoder_disconnects_total",
+			Measure:     census.mTranscoderDisconnected,
+			Description: "Number of times a remote transcoder disconnected from orchestrator",
+			TagKeys:     append([]tag.Key{census.kTranscoder}, baseTags...),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "transcoder_segments_total",
+			Measure:     census.mTranscoderSegments,
+			Description: "Number of segments transcoded by a remote transcoder",
+			TagKeys:     append([]tag.Key{census.kTranscoder, census.kErrorCode}, baseTags...),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "transcoder_round_trip_seconds",
+			Measure:     census.mTranscoderRoundTrip,
+			Description: "Time from sending a segment to a remote transcoder till receiving its results, seconds",
+			TagKeys:     append([]tag.Key{census.kTranscoder}, baseTags...),
+			Aggregation: view.Distribution(0, .250, .500, .750, 1.000, 1.500, 2.000, 3.000, 4.000, 6.000, 8.000),
+		},
+		&view.View{
+			Name:        "transcoder_retries_total",
+			Measure:     census.mTranscoderRetried,
+			Description: "Number of segments retried with another remote transcoder after a fatal error",
+			TagKeys:     append([]tag.Key{census.kTranscoder}, baseTags...),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "transcoder_steals_total",
+			Measure:     census.mTranscoderSteals,
+			Description: "Number of segments that exceeded the soft deadline on a remote transcoder and were also assigned to another one",
+			TagKeys:     append([]tag.Key{census.kTranscoder}, baseTags...),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "transcoder_steals_won_total",
+			Measure:     census.mTranscoderStealsWon,
+			Description: "Number of stolen segments for which the second remote transcoder returned results first",
+			TagKeys:     append([]tag.Key{census.kTranscoder}, baseTags...),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "transcoder_version_drift_total",
+			Measure:     census.mTranscoderVersionDrift,
+			Description: "Number of remote transcoders registered with a version incompatible with the rest of the pool",
+			TagKeys:     append([]tag.Key{census.kTranscoder}, baseTags...),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "protocol_deprecations_total",
+			Measure:     census.mProtocolDeprecations,
+			Description: "Number of orchestrators that announced that they will drop a protocol feature",
+			TagKeys:     append([]tag.Key{census.kFeature}, baseTags...),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "orchestrator_cert_pin_mismatches_total",
+			Measure:     census.mOrchCertPinMismatches,
+			Description: "Number of connections to orchestrators rejected because the certificate did not match the pinned one",
+			TagKeys:     baseTags,
+			Aggregation: view.Count(),
+		},
 
 		// Metrics for sending payments
 		&view.View{
@@ -515,25 +643,84 @@ func InitCensus(nodeType, nodeID, version string) {
 			TagKeys:     append([]tag.Key{census.kSender}, baseTags...),
 			Aggregation: view.LastValue(),
 		},
+
+		// Metrics for initializing rounds
+		&view.View{
+			Name:        "rounds_initialized",
+			Measure:     census.mRoundsInitialized,
+			Description: "Rounds initialized by the node",
+			TagKeys:     baseTags,
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "round_initialization_gas_spent",
+			Measure:     census.mRoundInitializationGas,
+			Description: "Gas spent initializing rounds",
+			TagKeys:     baseTags,
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "round_initializations_skipped",
+			Measure:     census.mRoundInitializationSkipped,
+			Description: "Round initializations skipped because the gas price was above the max gas price",
+			TagKeys:     baseTags,
+			Aggregation: view.Sum(),
+		},
+
+		// Metrics for calling reward
+		&view.View{
+			Name:        "reward_calls",
+			Measure:     census.mRewardCalls,
+			Description: "Rounds that the node called reward in",
+			TagKeys:     baseTags,
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "reward_call_errors",
+			Measure:     census.mRewardCallErrors,
+			Description: "Errors when calling reward",
+			TagKeys:     baseTags,
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "reward_alerts",
+			Measure:     census.mRewardAlerts,
+			Description: "Rounds that reward was not called in before the alert window before their end",
+			TagKeys:     baseTags,
+			Aggregation: view.Sum(),
+		},
 	}
 
+	var enabledViews []*view.View
+	for _, v := range views {
+		if isMetricEnabled(v.Name) {
+			v.TagKeys = withoutDroppedLabels(v.TagKeys)
+			enabledViews = append(enabledViews, v)
+		}
+	}
+	views = enabledViews
+
 	// Register the views
 	if err := view.Register(views...); err != nil {
 		glog.Fatalf("Failed to register views: %v", err)
 	}
-	registry := rprom.NewRegistry()
-	registry.MustRegister(rprom.NewProcessCollector(rprom.ProcessCollectorOpts{}))
-	registry.MustRegister(rprom.NewGoCollector())
-	pe, err := prometheus.NewExporter(prometheus.Options{
-		Namespace: "livepeer",
-		Registry:  registry,
-	})
-	if err != nil {
-		glog.Fatalf("Failed to create the Prometheus stats exporter: %v", err)
-	}
+	if prometheusEnabled {
+		registry := rprom.NewRegistry()
+		registry.MustRegister(rprom.NewProcessCollector(rprom.ProcessCollectorOpts{}))
+		registry.MustRegister(rprom.NewGoCollector())
+		pe, err := prometheus.NewExporter(prometheus.Options{
+			Namespace: "livepeer",
+			Registry:  registry,
+		})
+		if err != nil {
+			glog.Fatalf("Failed to create the Prometheus stats exporter: %v", err)
+		}
 
-	// Register the Prometheus exporters as a stats exporter.
-	view.RegisterExporter(pe)
+		// Register the Prometheus exporters as a stats exporter.
+		view.RegisterExporter(pe)
+		Exporter = pe
+	}
+	registerPushBackends()
 	stats.Record(ctx, mVersions.M(1))
 	ctx, err = tag.New(census.ctx, tag.Insert(census.kErrorCode, "LostSegment"))
 	if err != nil {
@@ -542,7 +729,6 @@ func InitCensus(nodeType, nodeID, version string) {
 	if !unitTestMode {
 		go census.timeoutWatcher(ctx)
 	}
-	Exporter = pe
 
 	// init metrics values
 	SetTranscodersNumberAndLoad(0, 0, 0)
@@ -726,6 +912,13 @@ func CurrentSessions(currentSessions int) {
 	stats.Record(census.ctx, census.mCurrentSessions.M(int64(currentSessions)))
 }
 
+// SessionRejected records a session that is rejected because the node is at capacity
+func SessionRejected() {
+	census.lock.Lock()
+	defer census.lock.Unlock()
+	stats.Record(census.ctx, census.mSessionsRejected.M(1))
+}
+
 func TranscodeTry(nonce, seqNo uint64) {
 	census.lock.Lock()
 	defer census.lock.Unlock()
@@ -763,6 +956,85 @@ func SetTranscodersNumberAndLoad(load, capacity, number int) {
 	stats.Record(census.ctx, census.mTranscodersNumber.M(int64(number)))
 }
 
+// TranscoderRegistered records a remote transcoder registering with the orchestrator
+func TranscoderRegistered(transcoder string) {
+	census.recordTranscoder(transcoder, census.mTranscoderRegistered.M(1))
+}
+
+// TranscoderDisconnected records a remote transcoder disconnecting from the orchestrator
+func TranscoderDisconnected(transcoder string) {
+	census.recordTranscoder(transcoder, census.mTranscoderDisconnected.M(1))
+}
+
+// TranscoderSegment records a segment sent to a remote transcoder and the round trip time until
+// its results were received. errCode is empty if the segment was transcoded successfully
+func TranscoderSegment(transcoder string, roundTrip time.Duration, errCode SegmentTranscodeError) {
+	census.lock.Lock()
+	defer census.lock.Unlock()
+
+	ctx, err := tag.New(census.ctx, tag.Insert(census.kTranscoder, labelValue(LabelTranscoder, transcoder, false)), tag.Insert(census.kErrorCode, string(errCode)))
+	if err != nil {
+		glog.Fatal(err)
+	}
+
+	stats.Record(ctx, census.mTranscoderSegments.M(1), census.mTranscoderRoundTrip.M(roundTrip.Seconds()))
+}
+
+// TranscoderRetried records a segment that is retried with another remote transcoder after a fatal error
+func TranscoderRetried(transcoder string) {
+	census.recordTranscoder(transcoder, census.mTranscoderRetried.M(1))
+}
+
+// TranscoderSegmentStolen records a segment that exceeded the soft deadline on a remote transcoder
+// and was also assigned to another one
+func TranscoderSegmentStolen(transcoder string) {
+	census.recordTranscoder(transcoder, census.mTranscoderSteals.M(1))
+}
+
+// TranscoderStealWon records a stolen segment for which the second remote transcoder returned results first
+func TranscoderStealWon(transcoder string) {
+	census.recordTranscoder(transcoder, census.mTranscoderStealsWon.M(1))
+}
+
+// TranscoderVersionDrift records a remote transcoder that registered with a version incompatible
+// with the rest of the pool
+func TranscoderVersionDrift(transcoder string) {
+	census.recordTranscoder(transcoder, census.mTranscoderVersionDrift.M(1))
+}
+
+// ProtocolDeprecation records an orchestrator that announced that it will drop a protocol feature
+func ProtocolDeprecation(feature string) {
+	census.lock.Lock()
+	defer census.lock.Unlock()
+
+	ctx, err := tag.New(census.ctx, tag.Insert(census.kFeature, feature))
+	if err != nil {
+		glog.Fatal(err)
+	}
+
+	stats.Record(ctx, census.mProtocolDeprecations.M(1))
+}
+
+// OrchCertPinMismatch records a connection to an orchestrator that was rejected because its
+// certificate did not match the pinned one
+func OrchCertPinMismatch() {
+	census.lock.Lock()
+	defer census.lock.Unlock()
+	stats.Record(census.ctx, census.mOrchCertPinMismatches.M(1))
+}
+
+func (cen *censusMetricsCounter) recordTranscoder(transcoder string, m stats.Measurement) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+
+	ctx, err := tag.New(cen.ctx, tag.Insert(cen.kTranscoder, labelValue(LabelTranscoder, transcoder, false)))
+	if err != nil {
+		glog.Fatal(err)
+	}
+
+	stats.Record(ctx, m)
+}
+
 func SegmentEmerged(nonce, seqNo uint64, profilesNum int) {
 	glog.Infof("Logging SegmentEmerged... nonce=%d seqNo=%d", nonce, seqNo)
 	census.segmentEmerged(nonce, seqNo, profilesNum)
@@ -783,7 +1055,7 @@ func (cen *censusMetricsCounter) segmentEmerged(nonce, seqNo uint64, profilesNum
 
 func SourceSegmentAppeared(nonce, seqNo uint64, manifestID, profile string) {
 	glog.Infof("Logging SourceSegmentAppeared... nonce=%d seqNo=%d manifestid=%s profile=%s", nonce,
-		seqNo, manifestID, profile)
+		seqNo, Redact(manifestID), profile)
 	census.segmentSourceAppeared(nonce, seqNo, profile)
 }
 
@@ -966,7 +1238,7 @@ func newAverager() *segmentsAverager {
 }
 
 func StreamCreated(hlsStrmID string, nonce uint64) {
-	glog.Infof("Logging StreamCreated... nonce=%d strid=%s", nonce, hlsStrmID)
+	glog.Infof("Logging StreamCreated... nonce=%d strid=%s", nonce, Redact(hlsStrmID))
 	census.streamCreated(nonce)
 }
 
@@ -1018,7 +1290,7 @@ func TicketValueSent(recipient string, manifestID string, value *big.Rat) {
 		return
 	}
 
-	ctx, err := tag.New(census.ctx, tag.Insert(census.kRecipient, recipient), tag.Insert(census.kManifestID, manifestID))
+	ctx, err := tag.New(census.ctx, tag.Insert(census.kRecipient, labelValue(LabelRecipient, recipient, true)), tag.Insert(census.kManifestID, labelValue(LabelManifestID, manifestID, true)))
 	if err != nil {
 		glog.Fatal(err)
 	}
@@ -1035,7 +1307,7 @@ func TicketsSent(recipient string, manifestID string, numTickets int) {
 		return
 	}
 
-	ctx, err := tag.New(census.ctx, tag.Insert(census.kRecipient, recipient), tag.Insert(census.kManifestID, manifestID))
+	ctx, err := tag.New(census.ctx, tag.Insert(census.kRecipient, labelValue(LabelRecipient, recipient, true)), tag.Insert(census.kManifestID, labelValue(LabelManifestID, manifestID, true)))
 	if err != nil {
 		glog.Fatal(err)
 	}
@@ -1048,7 +1320,7 @@ func PaymentCreateError(recipient string, manifestID string) {
 	census.lock.Lock()
 	defer census.lock.Unlock()
 
-	ctx, err := tag.New(census.ctx, tag.Insert(census.kRecipient, recipient), tag.Insert(census.kManifestID, manifestID))
+	ctx, err := tag.New(census.ctx, tag.Insert(census.kRecipient, labelValue(LabelRecipient, recipient, true)), tag.Insert(census.kManifestID, labelValue(LabelManifestID, manifestID, true)))
 	if err != nil {
 		glog.Fatal(err)
 	}
@@ -1065,7 +1337,7 @@ func TicketValueRecv(sender string, manifestID string, value *big.Rat) {
 		return
 	}
 
-	ctx, err := tag.New(census.ctx, tag.Insert(census.kSender, sender), tag.Insert(census.kManifestID, manifestID))
+	ctx, err := tag.New(census.ctx, tag.Insert(census.kSender, labelValue(LabelSender, sender, true)), tag.Insert(census.kManifestID, labelValue(LabelManifestID, manifestID, true)))
 	if err != nil {
 		glog.Fatal(err)
 	}
@@ -1082,7 +1354,7 @@ func TicketsRecv(sender string, manifestID string, numTickets int) {
 		return
 	}
 
-	ctx, err := tag.New(census.ctx, tag.Insert(census.kSender, sender), tag.Insert(census.kManifestID, manifestID))
+	ctx, err := tag.New(census.ctx, tag.Insert(census.kSender, labelValue(LabelSender, sender, true)), tag.Insert(census.kManifestID, labelValue(LabelManifestID, manifestID, true)))
 	if err != nil {
 		glog.Fatal(err)
 	}
@@ -1110,8 +1382,8 @@ func PaymentRecvError(sender string, manifestID string, errStr string, acceptabl
 
 	ctx, err := tag.New(
 		census.ctx,
-		tag.Insert(census.kSender, sender),
-		tag.Insert(census.kManifestID, manifestID),
+		tag.Insert(census.kSender, labelValue(LabelSender, sender, true)),
+		tag.Insert(census.kManifestID, labelValue(LabelManifestID, manifestID, true)),
 		tag.Insert(census.kErrorCode, errCode),
 	)
 	if err != nil {
@@ -1134,7 +1406,7 @@ func WinningTicketsRecv(sender string, numTickets int) {
 		return
 	}
 
-	ctx, err := tag.New(census.ctx, tag.Insert(census.kSender, sender))
+	ctx, err := tag.New(census.ctx, tag.Insert(census.kSender, labelValue(LabelSender, sender, true)))
 	if err != nil {
 		glog.Fatal(err)
 	}
@@ -1151,7 +1423,7 @@ func ValueRedeemed(sender string, value *big.Int) {
 		return
 	}
 
-	ctx, err := tag.New(census.ctx, tag.Insert(census.kSender, sender))
+	ctx, err := tag.New(census.ctx, tag.Insert(census.kSender, labelValue(LabelSender, sender, true)))
 	if err != nil {
 		glog.Fatal(err)
 	}
@@ -1164,7 +1436,7 @@ func TicketRedemptionError(sender string) {
 	census.lock.Lock()
 	defer census.lock.Unlock()
 
-	ctx, err := tag.New(census.ctx, tag.Insert(census.kSender, sender))
+	ctx, err := tag.New(census.ctx, tag.Insert(census.kSender, labelValue(LabelSender, sender, true)))
 	if err != nil {
 		glog.Fatal(err)
 	}
@@ -1180,6 +1452,49 @@ func SuggestedGasPrice(gasPrice *big.Int) {
 	stats.Record(census.ctx, census.mSuggestedGasPrice.M(wei2gwei(gasPrice)))
 }
 
+// RoundInitialized records a round initialized by the node, and the gas spent (in wei) initializing it
+func RoundInitialized(gasSpent *big.Int) {
+	census.lock.Lock()
+	defer census.lock.Unlock()
+
+	stats.Record(census.ctx, census.mRoundsInitialized.M(1))
+	if gasSpent != nil {
+		stats.Record(census.ctx, census.mRoundInitializationGas.M(wei2gwei(gasSpent)))
+	}
+}
+
+// RoundInitializationSkipped records a round initialization that was skipped because of the gas price
+func RoundInitializationSkipped() {
+	census.lock.Lock()
+	defer census.lock.Unlock()
+
+	stats.Record(census.ctx, census.mRoundInitializationSkipped.M(1))
+}
+
+// RewardCalled records a successful call of reward
+func RewardCalled() {
+	census.lock.Lock()
+	defer census.lock.Unlock()
+
+	stats.Record(census.ctx, census.mRewardCalls.M(1))
+}
+
+// RewardCallError records a failed attempt to call reward
+func RewardCallError() {
+	census.lock.Lock()
+	defer census.lock.Unlock()
+
+	stats.Record(census.ctx, census.mRewardCallErrors.M(1))
+}
+
+// RewardAlert records an alert that reward was not called close to the end of a round
+func RewardAlert() {
+	census.lock.Lock()
+	defer census.lock.Unlock()
+
+	stats.Record(census.ctx, census.mRewardAlerts.M(1))
+}
+
 // TranscodingPrice records the last transcoding price
 func TranscodingPrice(sender string, price *big.Rat) {
 	census.lock.Lock()
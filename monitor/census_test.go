@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"math/big"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/stats/view"
 )
 
 func TestAveragerCanBeRemoved(t *testing.T) {
@@ -44,10 +46,20 @@ func TestAveragerCanBeRemoved(t *testing.T) {
 	timeToWaitForError = old
 }
 
+var initCensusOnce sync.Once
+
+// initCensus initializes the census for the tests of the package. The views of the
+// census can only be registered once so the tests share the census
+func initCensus() {
+	initCensusOnce.Do(func() {
+		InitCensus("tst", "testid", "testversion")
+	})
+}
+
 func TestLastSegmentTimeout(t *testing.T) {
 	unitTestMode = true
 	defer func() { unitTestMode = false }()
-	InitCensus("tst", "testid", "testversion")
+	initCensus()
 	// defer func() {
 	// 	shutDown <- nil
 	// }()
@@ -172,3 +184,48 @@ func TestFracWei2Gwei(t *testing.T) {
 	wei = big.NewRat(gweiConversionFactor*2, 7)
 	assert.InDelta(.285714286, fracwei2gwei(wei), delta)
 }
+
+func TestTranscoderMetrics(t *testing.T) {
+	assert := assert.New(t)
+	unitTestMode = true
+	defer func() { unitTestMode = false }()
+	initCensus()
+
+	TranscoderRegistered("t1")
+	TranscoderSegment("t1", 500*time.Millisecond, "")
+	TranscoderSegment("t1", time.Second, SegmentTranscodeErrorTimeout)
+	TranscoderRetried("t1")
+	TranscoderDisconnected("t1")
+	TranscoderRegistered("t2")
+	TranscoderVersionDrift("t2")
+	TranscoderSegmentStolen("t1")
+	TranscoderStealWon("t2")
+
+	countByTranscoder := func(name string) map[string]int64 {
+		rows, err := view.RetrieveData(name)
+		assert.Nil(err)
+		counts := make(map[string]int64)
+		for _, row := range rows {
+			for _, t := range row.Tags {
+				if t.Key == census.kTranscoder {
+					switch data := row.Data.(type) {
+					case *view.CountData:
+						counts[t.Value] += data.Value
+					case *view.DistributionData:
+						counts[t.Value] += data.Count
+					}
+				}
+			}
+		}
+		return counts
+	}
+
+	assert.Equal(map[string]int64{"t1": 1, "t2": 1}, countByTranscoder("transcoder_registrations_total"))
+	assert.Equal(map[string]int64{"t1": 1}, countByTranscoder("transcoder_disconnects_total"))
+	assert.Equal(map[string]int64{"t1": 2}, countByTranscoder("transcoder_segments_total"))
+	assert.Equal(map[string]int64{"t1": 2}, countByTranscoder("transcoder_round_trip_seconds"))
+	assert.Equal(map[string]int64{"t1": 1}, countByTranscoder("transcoder_retries_total"))
+	assert.Equal(map[string]int64{"t2": 1}, countByTranscoder("transcoder_version_drift_total"))
+	assert.Equal(map[string]int64{"t1": 1}, countByTranscoder("transcoder_steals_total"))
+	assert.Equal(map[string]int64{"t2": 1}, countByTranscoder("transcoder_steals_won_total"))
+}
@@ -0,0 +1,69 @@
+package monitor
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+)
+
+var metricsFilter struct {
+	mu       sync.Mutex
+	enabled  []string
+	disabled []string
+}
+
+func parseMetricPatterns(patterns string) ([]string, error) {
+	var parsed []string
+	for _, p := range strings.Split(patterns, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid metric pattern %q", p)
+		}
+		parsed = append(parsed, p)
+	}
+	return parsed, nil
+}
+
+// SetMetricsFilter sets the metrics that are exported. enabled and disabled are comma-separated
+// lists of metric names or patterns in the syntax of path.Match, e.g. ticket_*. If enabled is not
+// empty, only the metrics that match it are exported, and the metrics that match disabled never are.
+// The filter takes effect when the metrics are initialized
+func SetMetricsFilter(enabled, disabled string) error {
+	e, err := parseMetricPatterns(enabled)
+	if err != nil {
+		return err
+	}
+	d, err := parseMetricPatterns(disabled)
+	if err != nil {
+		return err
+	}
+
+	metricsFilter.mu.Lock()
+	defer metricsFilter.mu.Unlock()
+	metricsFilter.enabled, metricsFilter.disabled = e, d
+	return nil
+}
+
+func matchesMetric(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isMetricEnabled returns whether the metric with the given name is exported
+func isMetricEnabled(name string) bool {
+	metricsFilter.mu.Lock()
+	defer metricsFilter.mu.Unlock()
+
+	if len(metricsFilter.enabled) > 0 && !matchesMetric(metricsFilter.enabled, name) {
+		return false
+	}
+	return !matchesMetric(metricsFilter.disabled, name)
+}
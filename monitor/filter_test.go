@@ -0,0 +1,33 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsFilter(t *testing.T) {
+	assert := assert.New(t)
+	defer SetMetricsFilter("", "")
+
+	// All metrics are enabled by default
+	assert.True(isMetricEnabled("tickets_sent"))
+	assert.True(isMetricEnabled("segment_transcoded_total"))
+
+	assert.Nil(SetMetricsFilter("", "ticket_*, tickets_sent"))
+	assert.False(isMetricEnabled("ticket_value_sent"))
+	assert.False(isMetricEnabled("tickets_sent"))
+	assert.True(isMetricEnabled("tickets_recv"))
+
+	// Disabled metrics are excluded from the enabled ones
+	assert.Nil(SetMetricsFilter("segment_*,current_sessions_total", "segment_source_*"))
+	assert.True(isMetricEnabled("segment_transcoded_total"))
+	assert.True(isMetricEnabled("current_sessions_total"))
+	assert.False(isMetricEnabled("segment_source_uploaded_total"))
+	assert.False(isMetricEnabled("tickets_sent"))
+
+	// Invalid patterns leave the filter unchanged
+	assert.NotNil(SetMetricsFilter("[", ""))
+	assert.NotNil(SetMetricsFilter("", "tickets_[sent"))
+	assert.True(isMetricEnabled("segment_transcoded_total"))
+}
@@ -0,0 +1,208 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// OTLP aggregation temporality of metrics whose values accumulate since the start of the node
+const otlpCumulative = 2
+
+// OTLPBackend pushes metrics to an OpenTelemetry collector over OTLP/HTTP with the JSON encoding.
+// The latest data of every metric is sent at every Flush
+type OTLPBackend struct {
+	endpoint string
+	client   *http.Client
+
+	mu      sync.Mutex
+	pending map[string]*otlpMetric
+}
+
+// NewOTLPBackend creates a backend that pushes metrics to the OTLP/HTTP metrics endpoint of a
+// collector, e.g. http://127.0.0.1:4318/v1/metrics
+func NewOTLPBackend(endpoint string) *OTLPBackend {
+	return &OTLPBackend{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		pending:  make(map[string]*otlpMetric),
+	}
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsInt             *string         `json:"asInt,omitempty"`
+	AsDouble          *float64        `json:"asDouble,omitempty"`
+	// Histograms
+	Count          string    `json:"count,omitempty"`
+	Sum            *float64  `json:"sum,omitempty"`
+	BucketCounts   []string  `json:"bucketCounts,omitempty"`
+	ExplicitBounds []float64 `json:"explicitBounds,omitempty"`
+	Min            *float64  `json:"min,omitempty"`
+	Max            *float64  `json:"max,omitempty"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpHistogram struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+}
+
+type otlpMetric struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Unit        string         `json:"unit,omitempty"`
+	Sum         *otlpSum       `json:"sum,omitempty"`
+	Gauge       *otlpGauge     `json:"gauge,omitempty"`
+	Histogram   *otlpHistogram `json:"histogram,omitempty"`
+}
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpScopeMetrics struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Metrics []*otlpMetric `json:"metrics"`
+}
+
+func otlpAttributes(tags []tag.Tag) []otlpAttribute {
+	attrs := make([]otlpAttribute, len(tags))
+	for i, t := range tags {
+		attrs[i] = otlpAttribute{Key: t.Key.Name(), Value: otlpValue{StringValue: t.Value}}
+	}
+	return attrs
+}
+
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// ExportView implements view.Exporter
+func (b *OTLPBackend) ExportView(vd *view.Data) {
+	m := &otlpMetric{
+		Name:        "livepeer_" + vd.View.Name,
+		Description: vd.View.Description,
+		Unit:        vd.View.Measure.Unit(),
+	}
+	start, end := otlpTime(vd.Start), otlpTime(vd.End)
+	var points []otlpDataPoint
+	for _, row := range vd.Rows {
+		p := otlpDataPoint{Attributes: otlpAttributes(row.Tags), StartTimeUnixNano: start, TimeUnixNano: end}
+		switch data := row.Data.(type) {
+		case *view.CountData:
+			v := strconv.FormatInt(data.Value, 10)
+			p.AsInt = &v
+		case *view.SumData:
+			v := data.Value
+			p.AsDouble = &v
+		case *view.LastValueData:
+			v := data.Value
+			p.AsDouble = &v
+		case *view.DistributionData:
+			sum, min, max := data.Mean*float64(data.Count), data.Min, data.Max
+			p.Count = strconv.FormatInt(data.Count, 10)
+			p.Sum, p.Min, p.Max = &sum, &min, &max
+			for _, c := range data.CountPerBucket {
+				p.BucketCounts = append(p.BucketCounts, strconv.FormatInt(c, 10))
+			}
+			p.ExplicitBounds = vd.View.Aggregation.Buckets
+		}
+		points = append(points, p)
+	}
+	switch vd.View.Aggregation.Type {
+	case view.AggTypeCount, view.AggTypeSum:
+		m.Sum = &otlpSum{DataPoints: points, AggregationTemporality: otlpCumulative, IsMonotonic: true}
+	case view.AggTypeLastValue:
+		m.Gauge = &otlpGauge{DataPoints: points}
+	case view.AggTypeDistribution:
+		m.Histogram = &otlpHistogram{DataPoints: points, AggregationTemporality: otlpCumulative}
+	default:
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending[m.Name] = m
+}
+
+// Flush sends the metrics exported since the previous flush to the collector
+func (b *OTLPBackend) Flush() error {
+	b.mu.Lock()
+	metrics := make([]*otlpMetric, 0, len(b.pending))
+	for _, m := range b.pending {
+		metrics = append(metrics, m)
+	}
+	b.pending = make(map[string]*otlpMetric)
+	b.mu.Unlock()
+
+	if len(metrics) == 0 {
+		return nil
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Name < metrics[j].Name })
+
+	rm := otlpResourceMetrics{ScopeMetrics: []otlpScopeMetrics{{Metrics: metrics}}}
+	rm.Resource.Attributes = []otlpAttribute{{Key: "service.name", Value: otlpValue{StringValue: "livepeer"}}}
+	rm.ScopeMetrics[0].Scope.Name = "github.com/livepeer/go-livepeer/monitor"
+	body, err := json.Marshal(otlpRequest{ResourceMetrics: []otlpResourceMetrics{rm}})
+	if err != nil {
+		return err
+	}
+	resp, err := b.client.Post(b.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector responded with status %v", resp.Status)
+	}
+	return nil
+}
+
+func (b *OTLPBackend) flushLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := b.Flush(); err != nil {
+			glog.Errorf("Unable to send metrics to the OTLP collector: %v", err)
+		}
+	}
+}
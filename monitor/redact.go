@@ -0,0 +1,86 @@
+package monitor
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+)
+
+// Modes of redaction of identifying data, such as ETH addresses and manifest IDs, in logs,
+// metrics and webhooks
+const (
+	RedactionNone = ""
+	// Identifiers are replaced with a keyed hash, so that they stay correlatable within the node
+	RedactionHash = "hash"
+	// Identifiers are shortened to their first and last few characters
+	RedactionTruncate = "truncate"
+)
+
+// Length in bytes of the hashes of redacted identifiers
+const redactionHashLen = 8
+
+var redaction struct {
+	mu   sync.RWMutex
+	mode string
+	key  []byte
+}
+
+// SetRedaction sets the mode of redaction of identifying data. In hash mode, identifiers are
+// hashed with key, or with a random key if it is empty, in which case the hashes of an
+// identifier differ across restarts of the node
+func SetRedaction(mode, key string) error {
+	var k []byte
+	switch mode {
+	case RedactionNone, RedactionTruncate:
+	case RedactionHash:
+		k = []byte(key)
+		if key == "" {
+			k = make([]byte, 32)
+			if _, err := rand.Read(k); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("invalid redaction mode %q", mode)
+	}
+
+	redaction.mu.Lock()
+	defer redaction.mu.Unlock()
+	redaction.mode, redaction.key = mode, k
+	return nil
+}
+
+// Redact returns an identifier as it may appear in logs, metrics and webhooks
+func Redact(id string) string {
+	if id == "" {
+		return id
+	}
+	redaction.mu.RLock()
+	defer redaction.mu.RUnlock()
+
+	switch redaction.mode {
+	case RedactionHash:
+		mac := hmac.New(sha256.New, redaction.key)
+		mac.Write([]byte(id))
+		return hex.EncodeToString(mac.Sum(nil)[:redactionHashLen])
+	case RedactionTruncate:
+		if len(id) == 2+2*ethcommon.AddressLength && id[:2] == "0x" {
+			return id[:6] + "..." + id[len(id)-4:]
+		}
+		if len(id) <= 8 {
+			return id[:len(id)/2] + "..."
+		}
+		return id[:4] + "..." + id[len(id)-4:]
+	}
+	return id
+}
+
+// RedactAddress returns an ETH address as it may appear in logs, metrics and webhooks
+func RedactAddress(addr ethcommon.Address) string {
+	return Redact(addr.Hex())
+}
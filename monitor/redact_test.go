@@ -0,0 +1,44 @@
+package monitor
+
+import (
+	"testing"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	assert := assert.New(t)
+	defer SetRedaction(RedactionNone, "")
+	addr := ethcommon.HexToAddress("0x1234567890abcdef1234567890abcdef12345678")
+
+	assert.Equal("movie1", Redact("movie1"))
+	assert.Equal(addr.Hex(), RedactAddress(addr))
+
+	assert.Nil(SetRedaction(RedactionTruncate, ""))
+	assert.Equal("0x1234...5678", RedactAddress(addr))
+	assert.Equal("mov...", Redact("movie1"))
+	assert.Equal("ns_a...ef01", Redact("ns_abcdef01"))
+	assert.Equal("", Redact(""))
+
+	// Hashes are stable for a key and differ across keys
+	assert.Nil(SetRedaction(RedactionHash, "secret"))
+	h := Redact("movie1")
+	assert.Len(h, 2*redactionHashLen)
+	assert.Equal(h, Redact("movie1"))
+	assert.NotEqual(h, Redact("movie2"))
+	assert.NotContains(RedactAddress(addr), "1234")
+	assert.Nil(SetRedaction(RedactionHash, "other"))
+	assert.NotEqual(h, Redact("movie1"))
+
+	// Random keys
+	assert.Nil(SetRedaction(RedactionHash, ""))
+	h = Redact("movie1")
+	assert.Nil(SetRedaction(RedactionHash, ""))
+	assert.NotEqual(h, Redact("movie1"))
+
+	// Invalid modes leave the mode unchanged
+	h = Redact("movie1")
+	assert.NotNil(SetRedaction("obfuscate", ""))
+	assert.Equal(h, Redact("movie1"))
+}
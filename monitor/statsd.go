@@ -0,0 +1,117 @@
+package monitor
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// Maximum size of the StatsD packets, to fit in the MTU of most networks
+const statsDMaxPacketSize = 1432
+
+// StatsDBackend pushes metrics to a StatsD server over UDP, with their labels as DogStatsD tags.
+// Counts and sums are sent as counters of their increase since the previous reporting period,
+// last values as gauges, and distributions as the counters <metric>.count and <metric>.sum
+type StatsDBackend struct {
+	conn net.Conn
+
+	mu   sync.Mutex
+	last map[string]float64
+}
+
+// NewStatsDBackend creates a backend that pushes metrics to the StatsD server at addr
+func NewStatsDBackend(addr string) (*StatsDBackend, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsDBackend{conn: conn, last: make(map[string]float64)}, nil
+}
+
+// ExportView implements view.Exporter
+func (b *StatsDBackend) ExportView(vd *view.Data) {
+	name := "livepeer." + vd.View.Name
+	var lines []string
+
+	b.mu.Lock()
+	for _, row := range vd.Rows {
+		tags := statsDTags(row.Tags)
+		counter := func(name string, value float64) {
+			if d := b.increase(rowKey(name, row.Tags), value); d > 0 {
+				lines = append(lines, fmt.Sprintf("%s:%s|c%s", name, formatStatsDValue(d), tags))
+			}
+		}
+		switch data := row.Data.(type) {
+		case *view.CountData:
+			counter(name, float64(data.Value))
+		case *view.SumData:
+			counter(name, data.Value)
+		case *view.LastValueData:
+			lines = append(lines, fmt.Sprintf("%s:%s|g%s", name, formatStatsDValue(data.Value), tags))
+		case *view.DistributionData:
+			counter(name+".count", float64(data.Count))
+			counter(name+".sum", data.Mean*float64(data.Count))
+		}
+	}
+	b.mu.Unlock()
+
+	b.send(lines)
+}
+
+// increase returns the increase of a cumulative value since it was last exported. Must be called
+// with mu held
+func (b *StatsDBackend) increase(key string, value float64) float64 {
+	last, ok := b.last[key]
+	b.last[key] = value
+	if !ok || value < last {
+		// The value was reset, e.g. because the view was registered again
+		return value
+	}
+	return value - last
+}
+
+// send writes lines to the server in as few packets as possible
+func (b *StatsDBackend) send(lines []string) {
+	var packet strings.Builder
+	flush := func() {
+		if packet.Len() == 0 {
+			return
+		}
+		if _, err := b.conn.Write([]byte(packet.String())); err != nil {
+			glog.Errorf("Unable to send metrics to StatsD: %v", err)
+		}
+		packet.Reset()
+	}
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsDMaxPacketSize {
+			flush()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	flush()
+}
+
+func statsDTags(tags []tag.Tag) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	sanitize := strings.NewReplacer(",", "_", "|", "_", ":", "_", "#", "_", "\n", "_")
+	parts := make([]string, len(tags))
+	for i, t := range tags {
+		parts[i] = t.Key.Name() + ":" + sanitize.Replace(t.Value)
+	}
+	return "|#" + strings.Join(parts, ",")
+}
+
+func formatStatsDValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,154 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opencensus.io/plugin/ochttp/propagation/tracecontext"
+	"go.opencensus.io/trace"
+)
+
+// TracingEnabled is set if segments are traced through the pipeline of the node
+var TracingEnabled bool
+
+// Trace context is propagated between nodes in the W3C traceparent header, which OpenTelemetry
+// and most tracing systems understand
+var tracePropagation = &tracecontext.HTTPFormat{}
+
+var traceSpans *spanBuffer
+
+// InitTracing enables tracing of the share sampleRate of segments, and of the segments whose
+// trace was sampled by the node that sent them. The spans of the last bufferSize ended spans
+// are kept and returned by RecentSpans
+func InitTracing(sampleRate float64, bufferSize int) error {
+	if sampleRate <= 0 || sampleRate > 1 {
+		return fmt.Errorf("the trace sample rate must be greater than 0 and at most 1")
+	}
+	if bufferSize <= 0 {
+		return fmt.Errorf("the number of kept spans must be greater than 0")
+	}
+	traceSpans = &spanBuffer{spans: make([]*trace.SpanData, bufferSize)}
+	trace.RegisterExporter(traceSpans)
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(sampleRate)})
+	TracingEnabled = true
+	return nil
+}
+
+// StartSpan starts a span as a child of the span in ctx, if any. The returned span is nil if
+// tracing is disabled, which the methods of spans accept
+func StartSpan(ctx context.Context, name string) (context.Context, *trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !TracingEnabled {
+		return ctx, nil
+	}
+	return trace.StartSpan(ctx, name)
+}
+
+// StartSpanFromRequest starts a span as a child of the span in the trace context headers of a
+// request sent by another node, if any
+func StartSpanFromRequest(r *http.Request, name string) (context.Context, *trace.Span) {
+	if !TracingEnabled {
+		return r.Context(), nil
+	}
+	if sc, ok := tracePropagation.SpanContextFromRequest(r); ok {
+		return trace.StartSpanWithRemoteParent(r.Context(), name, sc, trace.WithSpanKind(trace.SpanKindServer))
+	}
+	return trace.StartSpan(r.Context(), name, trace.WithSpanKind(trace.SpanKindServer))
+}
+
+// InjectSpan sets the trace context headers of a request to another node to the span in ctx
+func InjectSpan(ctx context.Context, r *http.Request) {
+	if ctx == nil {
+		return
+	}
+	if span := trace.FromContext(ctx); span != nil {
+		tracePropagation.SpanContextToRequest(span.SpanContext(), r)
+	}
+}
+
+// EndSpan ends a span with the error that its operation failed with, if any
+func EndSpan(span *trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+	}
+	span.End()
+}
+
+// SpanReport describes an ended span
+type SpanReport struct {
+	TraceID      string                 `json:"traceID"`
+	SpanID       string                 `json:"spanID"`
+	ParentSpanID string                 `json:"parentSpanID,omitempty"`
+	Name         string                 `json:"name"`
+	Start        time.Time              `json:"start"`
+	DurationMs   int64                  `json:"durationMs"`
+	Error        string                 `json:"error,omitempty"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// RecentSpans returns the kept spans of a trace, in the order they ended. The spans of all the
+// traces are returned if traceID is empty
+func RecentSpans(traceID string) []SpanReport {
+	if traceSpans == nil {
+		return []SpanReport{}
+	}
+	return traceSpans.reports(traceID)
+}
+
+// spanBuffer is a ring buffer of the most recent ended spans
+type spanBuffer struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+	next  int
+	full  bool
+}
+
+// ExportSpan implements trace.Exporter
+func (b *spanBuffer) ExportSpan(s *trace.SpanData) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.spans[b.next] = s
+	b.next = (b.next + 1) % len(b.spans)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+func (b *spanBuffer) reports(traceID string) []SpanReport {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	start, n := 0, b.next
+	if b.full {
+		start, n = b.next, len(b.spans)
+	}
+	reports := []SpanReport{}
+	for i := 0; i < n; i++ {
+		s := b.spans[(start+i)%len(b.spans)]
+		if traceID != "" && s.TraceID.String() != traceID {
+			continue
+		}
+		r := SpanReport{
+			TraceID:    s.TraceID.String(),
+			SpanID:     s.SpanID.String(),
+			Name:       s.Name,
+			Start:      s.StartTime,
+			DurationMs: int64(s.EndTime.Sub(s.StartTime) / time.Millisecond),
+			Attributes: s.Attributes,
+		}
+		if s.ParentSpanID != (trace.SpanID{}) {
+			r.ParentSpanID = s.ParentSpanID.String()
+		}
+		if s.Code != trace.StatusCodeOK {
+			r.Error = s.Message
+		}
+		reports = append(reports, r)
+	}
+	return reports
+}
@@ -0,0 +1,65 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracing(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	defer func() { TracingEnabled = false }()
+
+	// Spans are not started while tracing is disabled
+	ctx, span := StartSpan(nil, "foo")
+	assert.Nil(span)
+	assert.NotNil(ctx)
+	EndSpan(span, errors.New("error"))
+
+	assert.NotNil(InitTracing(0, 10))
+	assert.NotNil(InitTracing(1.5, 10))
+	assert.NotNil(InitTracing(1, 0))
+	assert.False(TracingEnabled)
+	require.Nil(InitTracing(1, 2))
+	assert.True(TracingEnabled)
+
+	ctx, parent := StartSpan(context.Background(), "parent")
+	require.NotNil(parent)
+	traceID := parent.SpanContext().TraceID.String()
+
+	// The trace context is propagated in the headers of requests
+	req, err := http.NewRequest("POST", "http://localhost/segment", nil)
+	require.Nil(err)
+	InjectSpan(ctx, req)
+	assert.NotEmpty(req.Header.Get("traceparent"))
+	_, child := StartSpanFromRequest(req, "child")
+	assert.Equal(traceID, child.SpanContext().TraceID.String())
+	EndSpan(child, errors.New("child error"))
+	EndSpan(parent, nil)
+
+	spans := RecentSpans(traceID)
+	require.Len(spans, 2)
+	assert.Equal("child", spans[0].Name)
+	assert.Equal(parent.SpanContext().SpanID.String(), spans[0].ParentSpanID)
+	assert.Equal("child error", spans[0].Error)
+	assert.Equal("parent", spans[1].Name)
+	assert.Empty(spans[1].ParentSpanID)
+	assert.Empty(spans[1].Error)
+
+	// Only the most recent spans are kept
+	_, span = StartSpan(context.Background(), "other")
+	span.End()
+	assert.Len(RecentSpans(traceID), 1)
+	assert.Len(RecentSpans(""), 2)
+
+	// Requests without a trace context start a new trace
+	req, err = http.NewRequest("POST", "http://localhost/segment", nil)
+	require.Nil(err)
+	_, span = StartSpanFromRequest(req, "root")
+	assert.NotEqual(traceID, span.SpanContext().TraceID.String())
+}
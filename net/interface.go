@@ -13,8 +13,11 @@ type OrchestratorPool interface {
 }
 
 type RemoteTranscoderInfo struct {
-	Address  string
-	Capacity int
+	Address      string
+	Identity     string
+	Capacity     int
+	Version      string
+	Capabilities []string
 }
 
 type NodeStatus struct {
@@ -27,5 +30,4 @@ type NodeStatus struct {
 	RegisteredTranscodersNumber int
 	RegisteredTranscoders       []RemoteTranscoderInfo
 	LocalTranscoding            bool // Indicates orchestrator that is also transcoder
-	// xxx add transcoder's version here
 }
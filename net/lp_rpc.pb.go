@@ -339,6 +339,22 @@ type OrchestratorInfo struct {
 	TicketParams *TicketParams `protobuf:"bytes,2,opt,name=ticket_params,json=ticketParams,proto3" json:"ticket_params,omitempty"`
 	// Price Info containing the price per pixel to transcode
 	PriceInfo *PriceInfo `protobuf:"bytes,3,opt,name=price_info,json=priceInfo,proto3" json:"price_info,omitempty"`
+	// Maximum number of tickets accepted with a single payment. 0 if there is no limit
+	MaxTicketsPerPayment uint32 `protobuf:"varint,4,opt,name=max_tickets_per_payment,json=maxTicketsPerPayment,proto3" json:"max_tickets_per_payment,omitempty"`
+	// Maximum total face value of the tickets accepted with a single payment. Empty if there is no limit
+	MaxBatchFaceValue []byte `protobuf:"bytes,5,opt,name=max_batch_face_value,json=maxBatchFaceValue,proto3" json:"max_batch_face_value,omitempty"`
+	// URIs of frontends of the orchestrator in other regions that segments can also be submitted to. Broadcasters submit segments to the nearest one
+	Frontends []string `protobuf:"bytes,7,rep,name=frontends,proto3" json:"frontends,omitempty"`
+	// Unix time in seconds until which the broadcaster may reuse this info instead of requesting it again. 0 if it should not be reused
+	Expiration int64 `protobuf:"varint,8,opt,name=expiration,proto3" json:"expiration,omitempty"`
+	// Region tag set by the operator, e.g. "us-east". Broadcasters can prefer orchestrators in their own region
+	Region string `protobuf:"bytes,9,opt,name=region,proto3" json:"region,omitempty"`
+	// Protocol features that the orchestrator will drop in a future version of its node software
+	Deprecations []*Deprecation `protobuf:"bytes,10,rep,name=deprecations,proto3" json:"deprecations,omitempty"`
+	// How long the orchestrator's tickets can be redeemed for. Not set by orchestrators that do not advertise it
+	TicketExpiration *TicketExpirationPolicy `protobuf:"bytes,11,opt,name=ticket_expiration,json=ticketExpiration,proto3" json:"ticket_expiration,omitempty"`
+	// Features of the orchestrator's transcoders, e.g. the output codecs other than H.264 that they support
+	Capabilities []string `protobuf:"bytes,12,rep,name=capabilities,proto3" json:"capabilities,omitempty"`
 	// Orchestrator returns info about own input object storage, if it wants it to be used.
 	Storage              []*OSInfo `protobuf:"bytes,32,rep,name=storage,proto3" json:"storage,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
@@ -392,6 +408,62 @@ func (m *OrchestratorInfo) GetPriceInfo() *PriceInfo {
 	return nil
 }
 
+func (m *OrchestratorInfo) GetMaxTicketsPerPayment() uint32 {
+	if m != nil {
+		return m.MaxTicketsPerPayment
+	}
+	return 0
+}
+
+func (m *OrchestratorInfo) GetMaxBatchFaceValue() []byte {
+	if m != nil {
+		return m.MaxBatchFaceValue
+	}
+	return nil
+}
+
+func (m *OrchestratorInfo) GetFrontends() []string {
+	if m != nil {
+		return m.Frontends
+	}
+	return nil
+}
+
+func (m *OrchestratorInfo) GetExpiration() int64 {
+	if m != nil {
+		return m.Expiration
+	}
+	return 0
+}
+
+func (m *OrchestratorInfo) GetRegion() string {
+	if m != nil {
+		return m.Region
+	}
+	return ""
+}
+
+func (m *OrchestratorInfo) GetDeprecations() []*Deprecation {
+	if m != nil {
+		return m.Deprecations
+	}
+	return nil
+}
+
+func (m *OrchestratorInfo) GetTicketExpiration() *TicketExpirationPolicy {
+	if m != nil {
+		return m.TicketExpiration
+	}
+	return nil
+}
+
+func (m *OrchestratorInfo) GetCapabilities() []string {
+	if m != nil {
+		return m.Capabilities
+	}
+	return nil
+}
+
 func (m *OrchestratorInfo) GetStorage() []*OSInfo {
 	if m != nil {
 		return m.Storage
@@ -410,14 +482,23 @@ type SegData struct {
 	// Transcoding profiles to use
 	Profiles []byte `protobuf:"bytes,4,opt,name=profiles,proto3" json:"profiles,omitempty"`
 	// Broadcaster signature for the segment. Corresponds to:
-	// broadcaster.sign(manifestId | seqNo | dataHash | profiles)
+	// broadcaster.sign(manifestId | seqNo | dataHash | profiles | fullProfiles)
 	Sig []byte `protobuf:"bytes,5,opt,name=sig,proto3" json:"sig,omitempty"`
 	// Broadcaster's preferred storage medium(s)
 	// XXX should we include this in a sig somewhere until certs are authenticated?
-	Storage              []*OSInfo `protobuf:"bytes,32,rep,name=storage,proto3" json:"storage,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
-	XXX_unrecognized     []byte    `json:"-"`
-	XXX_sizecache        int32     `json:"-"`
+	Storage []*OSInfo `protobuf:"bytes,32,rep,name=storage,proto3" json:"storage,omitempty"`
+	// Full definitions of the transcoding profiles to use
+	// Only set if some of the profiles are not builtin presets
+	FullProfiles []*VideoProfile `protobuf:"bytes,33,rep,name=fullProfiles,proto3" json:"fullProfiles,omitempty"`
+	// Estimated complexity of the segment relative to the preceding segments of the stream
+	// Only set if the bitrates of the profiles were adjusted for the complexity
+	Complexity float32 `protobuf:"fixed32,34,opt,name=complexity,proto3" json:"complexity,omitempty"`
+	// Set on the first segment sent to the orchestrator after the publisher of the
+	// stream reconnected and the broadcaster resumed the stream
+	Resumption           *StreamResumption `protobuf:"bytes,35,opt,name=resumption,proto3" json:"resumption,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
 }
 
 func (m *SegData) Reset()         { *m = SegData{} }
@@ -487,6 +568,182 @@ func (m *SegData) GetStorage() []*OSInfo {
 	return nil
 }
 
+func (m *SegData) GetFullProfiles() []*VideoProfile {
+	if m != nil {
+		return m.FullProfiles
+	}
+	return nil
+}
+
+func (m *SegData) GetComplexity() float32 {
+	if m != nil {
+		return m.Complexity
+	}
+	return 0
+}
+
+func (m *SegData) GetResumption() *StreamResumption {
+	if m != nil {
+		return m.Resumption
+	}
+	return nil
+}
+
+// Marks a segment of a stream that was resumed after its publisher reconnected
+type StreamResumption struct {
+	// Sequence number of the last segment of the stream that was sent before the
+	// publisher disconnected
+	LastSeq              int64    `protobuf:"varint,1,opt,name=lastSeq,proto3" json:"lastSeq,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *StreamResumption) Reset()         { *m = StreamResumption{} }
+func (m *StreamResumption) String() string { return proto.CompactTextString(m) }
+func (*StreamResumption) ProtoMessage()    {}
+func (*StreamResumption) Descriptor() ([]byte, []int) {
+	return fileDescriptor_034e29c79f9ba827, []int{7}
+}
+
+func (m *StreamResumption) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_StreamResumption.Unmarshal(m, b)
+}
+func (m *StreamResumption) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_StreamResumption.Marshal(b, m, deterministic)
+}
+func (m *StreamResumption) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StreamResumption.Merge(m, src)
+}
+func (m *StreamResumption) XXX_Size() int {
+	return xxx_messageInfo_StreamResumption.Size(m)
+}
+func (m *StreamResumption) XXX_DiscardUnknown() {
+	xxx_messageInfo_StreamResumption.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StreamResumption proto.InternalMessageInfo
+
+func (m *StreamResumption) GetLastSeq() int64 {
+	if m != nil {
+		return m.LastSeq
+	}
+	return 0
+}
+
+// Definition of a transcoding profile
+type VideoProfile struct {
+	// Name of the profile
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// Width of the output in pixels
+	Width int32 `protobuf:"varint,2,opt,name=width,proto3" json:"width,omitempty"`
+	// Height of the output in pixels
+	Height int32 `protobuf:"varint,3,opt,name=height,proto3" json:"height,omitempty"`
+	// Bitrate of the output in bits per second
+	Bitrate int32 `protobuf:"varint,4,opt,name=bitrate,proto3" json:"bitrate,omitempty"`
+	// Frame rate of the output
+	Fps uint32 `protobuf:"varint,5,opt,name=fps,proto3" json:"fps,omitempty"`
+	// Interval between keyframes in seconds, or "intra". Encoder default if empty
+	Gop string `protobuf:"bytes,6,opt,name=gop,proto3" json:"gop,omitempty"`
+	// Encoder profile, e.g. "high". Encoder default if empty
+	Profile string `protobuf:"bytes,7,opt,name=profile,proto3" json:"profile,omitempty"`
+	// Encoder level, e.g. "4.1". Encoder default if empty
+	Level string `protobuf:"bytes,8,opt,name=level,proto3" json:"level,omitempty"`
+	// Output codec, e.g. "H265". H.264 if empty
+	Codec                string   `protobuf:"bytes,9,opt,name=codec,proto3" json:"codec,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *VideoProfile) Reset()         { *m = VideoProfile{} }
+func (m *VideoProfile) String() string { return proto.CompactTextString(m) }
+func (*VideoProfile) ProtoMessage()    {}
+func (*VideoProfile) Descriptor() ([]byte, []int) {
+	return fileDescriptor_034e29c79f9ba827, []int{8}
+}
+
+func (m *VideoProfile) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_VideoProfile.Unmarshal(m, b)
+}
+func (m *VideoProfile) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_VideoProfile.Marshal(b, m, deterministic)
+}
+func (m *VideoProfile) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_VideoProfile.Merge(m, src)
+}
+func (m *VideoProfile) XXX_Size() int {
+	return xxx_messageInfo_VideoProfile.Size(m)
+}
+func (m *VideoProfile) XXX_DiscardUnknown() {
+	xxx_messageInfo_VideoProfile.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_VideoProfile proto.InternalMessageInfo
+
+func (m *VideoProfile) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *VideoProfile) GetWidth() int32 {
+	if m != nil {
+		return m.Width
+	}
+	return 0
+}
+
+func (m *VideoProfile) GetHeight() int32 {
+	if m != nil {
+		return m.Height
+	}
+	return 0
+}
+
+func (m *VideoProfile) GetBitrate() int32 {
+	if m != nil {
+		return m.Bitrate
+	}
+	return 0
+}
+
+func (m *VideoProfile) GetFps() uint32 {
+	if m != nil {
+		return m.Fps
+	}
+	return 0
+}
+
+func (m *VideoProfile) GetGop() string {
+	if m != nil {
+		return m.Gop
+	}
+	return ""
+}
+
+func (m *VideoProfile) GetProfile() string {
+	if m != nil {
+		return m.Profile
+	}
+	return ""
+}
+
+func (m *VideoProfile) GetLevel() string {
+	if m != nil {
+		return m.Level
+	}
+	return ""
+}
+
+func (m *VideoProfile) GetCodec() string {
+	if m != nil {
+		return m.Codec
+	}
+	return ""
+}
+
 // Individual transcoded segment data.
 type TranscodedSegmentData struct {
 	// URL where the transcoded data can be downloaded from.
@@ -502,7 +759,7 @@ func (m *TranscodedSegmentData) Reset()         { *m = TranscodedSegmentData{} }
 func (m *TranscodedSegmentData) String() string { return proto.CompactTextString(m) }
 func (*TranscodedSegmentData) ProtoMessage()    {}
 func (*TranscodedSegmentData) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{7}
+	return fileDescriptor_034e29c79f9ba827, []int{9}
 }
 
 func (m *TranscodedSegmentData) XXX_Unmarshal(b []byte) error {
@@ -552,7 +809,7 @@ func (m *TranscodeData) Reset()         { *m = TranscodeData{} }
 func (m *TranscodeData) String() string { return proto.CompactTextString(m) }
 func (*TranscodeData) ProtoMessage()    {}
 func (*TranscodeData) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{8}
+	return fileDescriptor_034e29c79f9ba827, []int{10}
 }
 
 func (m *TranscodeData) XXX_Unmarshal(b []byte) error {
@@ -608,7 +865,7 @@ func (m *TranscodeResult) Reset()         { *m = TranscodeResult{} }
 func (m *TranscodeResult) String() string { return proto.CompactTextString(m) }
 func (*TranscodeResult) ProtoMessage()    {}
 func (*TranscodeResult) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{9}
+	return fileDescriptor_034e29c79f9ba827, []int{11}
 }
 
 func (m *TranscodeResult) XXX_Unmarshal(b []byte) error {
@@ -693,7 +950,16 @@ type RegisterRequest struct {
 	// Shared secret for auth
 	Secret string `protobuf:"bytes,1,opt,name=secret,proto3" json:"secret,omitempty"`
 	// Transcoder capacity
-	Capacity             int64    `protobuf:"varint,2,opt,name=capacity,proto3" json:"capacity,omitempty"`
+	Capacity int64 `protobuf:"varint,2,opt,name=capacity,proto3" json:"capacity,omitempty"`
+	// Version of the transcoder's node software
+	Version string `protobuf:"bytes,3,opt,name=version,proto3" json:"version,omitempty"`
+	// Features supported by the transcoder
+	Capabilities []string `protobuf:"bytes,4,rep,name=capabilities,proto3" json:"capabilities,omitempty"`
+	// Identifies the key used to encrypt the segments exchanged with the transcoder.
+	// Empty if payload encryption is disabled
+	KeyId string `protobuf:"bytes,5,opt,name=keyId,proto3" json:"keyId,omitempty"`
+	// ETH address of the identity that the transcoder signs its results with
+	Address              []byte   `protobuf:"bytes,6,opt,name=address,proto3" json:"address,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -703,7 +969,7 @@ func (m *RegisterRequest) Reset()         { *m = RegisterRequest{} }
 func (m *RegisterRequest) String() string { return proto.CompactTextString(m) }
 func (*RegisterRequest) ProtoMessage()    {}
 func (*RegisterRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{10}
+	return fileDescriptor_034e29c79f9ba827, []int{12}
 }
 
 func (m *RegisterRequest) XXX_Unmarshal(b []byte) error {
@@ -738,21 +1004,52 @@ func (m *RegisterRequest) GetCapacity() int64 {
 	return 0
 }
 
+func (m *RegisterRequest) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+func (m *RegisterRequest) GetCapabilities() []string {
+	if m != nil {
+		return m.Capabilities
+	}
+	return nil
+}
+
+func (m *RegisterRequest) GetKeyId() string {
+	if m != nil {
+		return m.KeyId
+	}
+	return ""
+}
+
+func (m *RegisterRequest) GetAddress() []byte {
+	if m != nil {
+		return m.Address
+	}
+	return nil
+}
+
 // Sent by the orchestrator to the transcoder
 type NotifySegment struct {
-	Url                  string   `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
-	TaskId               int64    `protobuf:"varint,16,opt,name=taskId,proto3" json:"taskId,omitempty"`
-	Profiles             []byte   `protobuf:"bytes,17,opt,name=profiles,proto3" json:"profiles,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	Url      string `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	TaskId   int64  `protobuf:"varint,16,opt,name=taskId,proto3" json:"taskId,omitempty"`
+	Profiles []byte `protobuf:"bytes,17,opt,name=profiles,proto3" json:"profiles,omitempty"`
+	// Full definitions of the transcoding profiles to use
+	// Only set if some of the profiles are not builtin presets
+	FullProfiles         []*VideoProfile `protobuf:"bytes,18,rep,name=fullProfiles,proto3" json:"fullProfiles,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
 }
 
 func (m *NotifySegment) Reset()         { *m = NotifySegment{} }
 func (m *NotifySegment) String() string { return proto.CompactTextString(m) }
 func (*NotifySegment) ProtoMessage()    {}
 func (*NotifySegment) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{11}
+	return fileDescriptor_034e29c79f9ba827, []int{13}
 }
 
 func (m *NotifySegment) XXX_Unmarshal(b []byte) error {
@@ -794,6 +1091,13 @@ func (m *NotifySegment) GetProfiles() []byte {
 	return nil
 }
 
+func (m *NotifySegment) GetFullProfiles() []*VideoProfile {
+	if m != nil {
+		return m.FullProfiles
+	}
+	return nil
+}
+
 // Required parameters for probabilistic micropayment tickets
 type TicketParams struct {
 	// ETH address of the recipient
@@ -817,7 +1121,7 @@ func (m *TicketParams) Reset()         { *m = TicketParams{} }
 func (m *TicketParams) String() string { return proto.CompactTextString(m) }
 func (*TicketParams) ProtoMessage()    {}
 func (*TicketParams) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{12}
+	return fileDescriptor_034e29c79f9ba827, []int{14}
 }
 
 func (m *TicketParams) XXX_Unmarshal(b []byte) error {
@@ -889,7 +1193,7 @@ func (m *TicketSenderParams) Reset()         { *m = TicketSenderParams{} }
 func (m *TicketSenderParams) String() string { return proto.CompactTextString(m) }
 func (*TicketSenderParams) ProtoMessage()    {}
 func (*TicketSenderParams) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{13}
+	return fileDescriptor_034e29c79f9ba827, []int{15}
 }
 
 func (m *TicketSenderParams) XXX_Unmarshal(b []byte) error {
@@ -939,7 +1243,7 @@ func (m *TicketExpirationParams) Reset()         { *m = TicketExpirationParams{}
 func (m *TicketExpirationParams) String() string { return proto.CompactTextString(m) }
 func (*TicketExpirationParams) ProtoMessage()    {}
 func (*TicketExpirationParams) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{14}
+	return fileDescriptor_034e29c79f9ba827, []int{16}
 }
 
 func (m *TicketExpirationParams) XXX_Unmarshal(b []byte) error {
@@ -997,7 +1301,7 @@ func (m *Payment) Reset()         { *m = Payment{} }
 func (m *Payment) String() string { return proto.CompactTextString(m) }
 func (*Payment) ProtoMessage()    {}
 func (*Payment) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{15}
+	return fileDescriptor_034e29c79f9ba827, []int{17}
 }
 
 func (m *Payment) XXX_Unmarshal(b []byte) error {
@@ -1053,6 +1357,184 @@ func (m *Payment) GetExpectedPrice() *PriceInfo {
 	return nil
 }
 
+// Sent by the orchestrator to report which tickets of a payment were credited
+// A broadcaster can use this to replace the rejected tickets with a new payment
+type PaymentResult struct {
+	// Sender nonces of the tickets that were accepted and credited
+	AcceptedNonces []uint32 `protobuf:"varint,1,rep,packed,name=accepted_nonces,json=acceptedNonces,proto3" json:"accepted_nonces,omitempty"`
+	// Sender nonces of the tickets that were rejected
+	RejectedNonces []uint32 `protobuf:"varint,2,rep,packed,name=rejected_nonces,json=rejectedNonces,proto3" json:"rejected_nonces,omitempty"`
+	// Total expected value (in Wei) credited for the payment, as a rational number
+	Credit string `protobuf:"bytes,3,opt,name=credit,proto3" json:"credit,omitempty"`
+	// Total expected value (in Wei) of the rejected tickets, as a rational number
+	Shortfall            string   `protobuf:"bytes,4,opt,name=shortfall,proto3" json:"shortfall,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PaymentResult) Reset()         { *m = PaymentResult{} }
+func (m *PaymentResult) String() string { return proto.CompactTextString(m) }
+func (*PaymentResult) ProtoMessage()    {}
+func (*PaymentResult) Descriptor() ([]byte, []int) {
+	return fileDescriptor_034e29c79f9ba827, []int{18}
+}
+
+func (m *PaymentResult) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PaymentResult.Unmarshal(m, b)
+}
+func (m *PaymentResult) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PaymentResult.Marshal(b, m, deterministic)
+}
+func (m *PaymentResult) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PaymentResult.Merge(m, src)
+}
+func (m *PaymentResult) XXX_Size() int {
+	return xxx_messageInfo_PaymentResult.Size(m)
+}
+func (m *PaymentResult) XXX_DiscardUnknown() {
+	xxx_messageInfo_PaymentResult.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PaymentResult proto.InternalMessageInfo
+
+func (m *PaymentResult) GetAcceptedNonces() []uint32 {
+	if m != nil {
+		return m.AcceptedNonces
+	}
+	return nil
+}
+
+func (m *PaymentResult) GetRejectedNonces() []uint32 {
+	if m != nil {
+		return m.RejectedNonces
+	}
+	return nil
+}
+
+func (m *PaymentResult) GetCredit() string {
+	if m != nil {
+		return m.Credit
+	}
+	return ""
+}
+
+func (m *PaymentResult) GetShortfall() string {
+	if m != nil {
+		return m.Shortfall
+	}
+	return ""
+}
+
+// Notice that a protocol feature is deprecated and will be dropped by a future version of the node software
+type Deprecation struct {
+	// Name of the deprecated feature
+	Feature string `protobuf:"bytes,1,opt,name=feature,proto3" json:"feature,omitempty"`
+	// Version of the node software that drops the feature. Empty if not decided yet
+	RemovalVersion string `protobuf:"bytes,2,opt,name=removalVersion,proto3" json:"removalVersion,omitempty"`
+	// Details for operators, e.g. what to use instead of the feature
+	Details              string   `protobuf:"bytes,3,opt,name=details,proto3" json:"details,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Deprecation) Reset()         { *m = Deprecation{} }
+func (m *Deprecation) String() string { return proto.CompactTextString(m) }
+func (*Deprecation) ProtoMessage()    {}
+func (*Deprecation) Descriptor() ([]byte, []int) {
+	return fileDescriptor_034e29c79f9ba827, []int{19}
+}
+
+func (m *Deprecation) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Deprecation.Unmarshal(m, b)
+}
+func (m *Deprecation) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Deprecation.Marshal(b, m, deterministic)
+}
+func (m *Deprecation) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Deprecation.Merge(m, src)
+}
+func (m *Deprecation) XXX_Size() int {
+	return xxx_messageInfo_Deprecation.Size(m)
+}
+func (m *Deprecation) XXX_DiscardUnknown() {
+	xxx_messageInfo_Deprecation.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Deprecation proto.InternalMessageInfo
+
+func (m *Deprecation) GetFeature() string {
+	if m != nil {
+		return m.Feature
+	}
+	return ""
+}
+
+func (m *Deprecation) GetRemovalVersion() string {
+	if m != nil {
+		return m.RemovalVersion
+	}
+	return ""
+}
+
+func (m *Deprecation) GetDetails() string {
+	if m != nil {
+		return m.Details
+	}
+	return ""
+}
+
+// How long the tickets of a recipient can be redeemed for
+type TicketExpirationPolicy struct {
+	// Number of rounds, starting with its creation round, in which a ticket can be redeemed
+	ValidityPeriod int64 `protobuf:"varint,1,opt,name=validity_period,json=validityPeriod,proto3" json:"validity_period,omitempty"`
+	// Number of rounds before the end of the validity period of a ticket by which the recipient redeems it
+	RedemptionBuffer     int64    `protobuf:"varint,2,opt,name=redemption_buffer,json=redemptionBuffer,proto3" json:"redemption_buffer,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TicketExpirationPolicy) Reset()         { *m = TicketExpirationPolicy{} }
+func (m *TicketExpirationPolicy) String() string { return proto.CompactTextString(m) }
+func (*TicketExpirationPolicy) ProtoMessage()    {}
+func (*TicketExpirationPolicy) Descriptor() ([]byte, []int) {
+	return fileDescriptor_034e29c79f9ba827, []int{20}
+}
+
+func (m *TicketExpirationPolicy) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TicketExpirationPolicy.Unmarshal(m, b)
+}
+func (m *TicketExpirationPolicy) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TicketExpirationPolicy.Marshal(b, m, deterministic)
+}
+func (m *TicketExpirationPolicy) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TicketExpirationPolicy.Merge(m, src)
+}
+func (m *TicketExpirationPolicy) XXX_Size() int {
+	return xxx_messageInfo_TicketExpirationPolicy.Size(m)
+}
+func (m *TicketExpirationPolicy) XXX_DiscardUnknown() {
+	xxx_messageInfo_TicketExpirationPolicy.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TicketExpirationPolicy proto.InternalMessageInfo
+
+func (m *TicketExpirationPolicy) GetValidityPeriod() int64 {
+	if m != nil {
+		return m.ValidityPeriod
+	}
+	return 0
+}
+
+func (m *TicketExpirationPolicy) GetRedemptionBuffer() int64 {
+	if m != nil {
+		return m.RedemptionBuffer
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterEnum("net.OSInfo_StorageType", OSInfo_StorageType_name, OSInfo_StorageType_value)
 	proto.RegisterType((*PingPong)(nil), "net.PingPong")
@@ -1062,6 +1544,8 @@ func init() {
 	proto.RegisterType((*PriceInfo)(nil), "net.PriceInfo")
 	proto.RegisterType((*OrchestratorInfo)(nil), "net.OrchestratorInfo")
 	proto.RegisterType((*SegData)(nil), "net.SegData")
+	proto.RegisterType((*StreamResumption)(nil), "net.StreamResumption")
+	proto.RegisterType((*VideoProfile)(nil), "net.VideoProfile")
 	proto.RegisterType((*TranscodedSegmentData)(nil), "net.TranscodedSegmentData")
 	proto.RegisterType((*TranscodeData)(nil), "net.TranscodeData")
 	proto.RegisterType((*TranscodeResult)(nil), "net.TranscodeResult")
@@ -1071,76 +1555,112 @@ func init() {
 	proto.RegisterType((*TicketSenderParams)(nil), "net.TicketSenderParams")
 	proto.RegisterType((*TicketExpirationParams)(nil), "net.TicketExpirationParams")
 	proto.RegisterType((*Payment)(nil), "net.Payment")
+	proto.RegisterType((*PaymentResult)(nil), "net.PaymentResult")
+	proto.RegisterType((*Deprecation)(nil), "net.Deprecation")
+	proto.RegisterType((*TicketExpirationPolicy)(nil), "net.TicketExpirationPolicy")
 }
 
 func init() { proto.RegisterFile("net/lp_rpc.proto", fileDescriptor_034e29c79f9ba827) }
 
 var fileDescriptor_034e29c79f9ba827 = []byte{
-	// 1012 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x56, 0x5f, 0x4f, 0x1b, 0x47,
-	0x10, 0xe7, 0xb0, 0x31, 0xf6, 0xd8, 0x06, 0xb3, 0x21, 0xc4, 0xa1, 0x6d, 0x44, 0x4f, 0x41, 0xa2,
-	0x0f, 0xa1, 0x95, 0x51, 0x23, 0xe5, 0xad, 0x50, 0x10, 0x58, 0xaa, 0xc0, 0x5a, 0x43, 0xa5, 0x3e,
-	0x59, 0xcb, 0xdd, 0xd8, 0x9c, 0x30, 0x7b, 0x97, 0xdd, 0x75, 0x83, 0xf3, 0x4d, 0xda, 0xc7, 0xaa,
-	0x7d, 0xe9, 0xa7, 0xe8, 0x47, 0xab, 0x76, 0x76, 0xef, 0x38, 0x03, 0x0f, 0x79, 0xdb, 0xf9, 0xcd,
-	0xec, 0xec, 0xfc, 0xf9, 0xcd, 0xdc, 0x41, 0x47, 0xa2, 0xf9, 0x7e, 0x9a, 0x8d, 0x54, 0x16, 0xed,
-	0x67, 0x2a, 0x35, 0x29, 0xab, 0x48, 0x34, 0xe1, 0x0e, 0xd4, 0x07, 0x89, 0x9c, 0x0c, 0x52, 0x39,
-	0x61, 0x9b, 0xb0, 0xf2, 0xbb, 0x98, 0xce, 0xb0, 0x1b, 0xec, 0x04, 0x7b, 0x2d, 0xee, 0x84, 0xf0,
-	0x10, 0x5e, 0x5c, 0xa8, 0xe8, 0x06, 0xb5, 0x51, 0xc2, 0xa4, 0x8a, 0xe3, 0xc7, 0x19, 0x6a, 0xc3,
-	0xba, 0xb0, 0x2a, 0xe2, 0x58, 0xa1, 0xd6, 0xde, 0x3c, 0x17, 0x59, 0x07, 0x2a, 0x3a, 0x99, 0x74,
-	0x97, 0x09, 0xb5, 0xc7, 0xf0, 0x8f, 0x00, 0x6a, 0x17, 0xc3, 0xbe, 0x1c, 0xa7, 0xec, 0x03, 0x34,
-	0xb5, 0x49, 0x95, 0x98, 0xe0, 0xe5, 0x3c, 0x73, 0x2f, 0xad, 0xf5, 0x5e, 0xed, 0x4b, 0x34, 0xfb,
-	0xce, 0x62, 0x7f, 0xf8, 0xa0, 0xe6, 0x65, 0x5b, 0xb6, 0x0b, 0x35, 0x7d, 0x90, 0xc8, 0x71, 0xda,
-	0xed, 0xec, 0x04, 0x7b, 0xcd, 0x5e, 0x9b, 0x6e, 0x0d, 0x0f, 0xdc, 0x3d, 0xee, 0x95, 0xe1, 0x3b,
-	0x68, 0x96, 0x5c, 0x30, 0x80, 0xda, 0x71, 0x9f, 0x9f, 0xfc, 0x7c, 0xd9, 0x59, 0x62, 0x35, 0x58,
-	0x1e, 0x1e, 0x74, 0x02, 0x8b, 0x9d, 0x5e, 0x5c, 0x9c, 0xfe, 0x72, 0xd2, 0x59, 0x0e, 0xff, 0x0a,
-	0xa0, 0x9e, 0xfb, 0x60, 0x0c, 0xaa, 0x37, 0xa9, 0x36, 0x14, 0x56, 0x83, 0xd3, 0xd9, 0xa6, 0x73,
-	0x8b, 0x73, 0x4a, 0xa7, 0xc1, 0xed, 0x91, 0x6d, 0x41, 0x2d, 0x4b, 0xa7, 0x49, 0x34, 0xef, 0x56,
-	0x08, 0xf4, 0x12, 0xfb, 0x1a, 0x1a, 0x3a, 0x99, 0x48, 0x61, 0x66, 0x0a, 0xbb, 0x55, 0x52, 0x3d,
-	0x00, 0xec, 0x0d, 0x40, 0xa4, 0x30, 0x46, 0x69, 0x12, 0x31, 0xed, 0xae, 0x90, 0xba, 0x84, 0xb0,
-	0x6d, 0xa8, 0xdf, 0x1f, 0xde, 0x7d, 0x3e, 0x16, 0x06, 0xbb, 0x35, 0xd2, 0x16, 0x72, 0x78, 0x05,
-	0x8d, 0x81, 0x4a, 0x22, 0xa4, 0x20, 0x43, 0x68, 0x65, 0x56, 0x18, 0xa0, 0xba, 0x92, 0x89, 0x0b,
-	0xb6, 0xc2, 0x17, 0x30, 0xf6, 0x16, 0xda, 0x59, 0x72, 0x8f, 0x53, 0x9d, 0x1b, 0x2d, 0x93, 0xd1,
-	0x22, 0x18, 0xfe, 0x17, 0x40, 0xa7, 0xdc, 0x5b, 0x72, 0xff, 0x06, 0xc0, 0x28, 0x21, 0x75, 0x94,
-	0xc6, 0xa8, 0x7c, 0x25, 0x4a, 0x08, 0x7b, 0x0f, 0x6d, 0x93, 0x44, 0xb7, 0x68, 0x46, 0x99, 0x50,
-	0xe2, 0x4e, 0x93, 0xeb, 0x66, 0x6f, 0x83, 0xba, 0x71, 0x49, 0x9a, 0x01, 0x29, 0x78, 0xcb, 0x94,
-	0x24, 0xf6, 0x0e, 0x80, 0x42, 0x1c, 0x51, 0x0b, 0x2b, 0x74, 0x69, 0x8d, 0x2e, 0x15, 0xa9, 0xf1,
-	0x46, 0x56, 0x64, 0xb9, 0x0b, 0xab, 0xbe, 0xf9, 0xdd, 0x9d, 0x9d, 0xca, 0x5e, 0xb3, 0xd7, 0x2c,
-	0x91, 0x84, 0xe7, 0xba, 0xf0, 0xef, 0x00, 0x56, 0x87, 0x38, 0x39, 0x16, 0x46, 0xd8, 0xc8, 0xef,
-	0x84, 0x4c, 0xc6, 0xa8, 0x4d, 0x3f, 0xf6, 0xac, 0x2c, 0x21, 0x44, 0x4c, 0xfc, 0xe8, 0x4b, 0x61,
-	0x8f, 0xd4, 0x6f, 0xa1, 0x6f, 0x28, 0x9a, 0x16, 0xa7, 0xb3, 0xed, 0x43, 0xa6, 0xd2, 0x71, 0x32,
-	0x45, 0x4d, 0x4d, 0x6c, 0xf1, 0x42, 0xce, 0xa9, 0xbd, 0x52, 0x50, 0xfb, 0x4b, 0xc3, 0x3c, 0x84,
-	0x97, 0x97, 0x79, 0x09, 0xe3, 0x21, 0x4e, 0xee, 0x50, 0x1a, 0x8a, 0xb9, 0x03, 0x95, 0x99, 0x9a,
-	0xfa, 0x32, 0xdb, 0x23, 0xb1, 0x8b, 0xba, 0xe4, 0x03, 0xf5, 0x52, 0xf8, 0x1b, 0xb4, 0x0b, 0x17,
-	0x74, 0xf5, 0x3d, 0xd4, 0xb5, 0xf3, 0x64, 0x47, 0xd0, 0xbe, 0xbd, 0xed, 0x7a, 0xf0, 0xdc, 0x43,
-	0xbc, 0xb0, 0x7d, 0x66, 0x3e, 0xff, 0x0c, 0x60, 0xbd, 0xb8, 0xc5, 0x51, 0xcf, 0xa6, 0x26, 0x2f,
-	0x56, 0xf0, 0x50, 0xac, 0x2d, 0x58, 0x41, 0xa5, 0x52, 0xe5, 0x46, 0xe1, 0x6c, 0x89, 0x3b, 0x91,
-	0xed, 0x41, 0x35, 0x16, 0x46, 0xf8, 0x96, 0xb2, 0xc5, 0x18, 0xec, 0xdb, 0x67, 0x4b, 0x9c, 0x2c,
-	0xd8, 0x77, 0x50, 0x2d, 0xcd, 0xef, 0x4b, 0x57, 0xa9, 0x47, 0xfc, 0xe3, 0x64, 0x72, 0x54, 0x87,
-	0x9a, 0xa2, 0x40, 0xc2, 0x13, 0x58, 0xe7, 0x38, 0x49, 0xb4, 0xc1, 0x62, 0xf7, 0x6c, 0x41, 0x4d,
-	0x63, 0xa4, 0x30, 0x1f, 0x54, 0x2f, 0xd9, 0xd6, 0x45, 0x22, 0x13, 0x51, 0x62, 0xe6, 0xbe, 0x78,
-	0x85, 0x1c, 0x5e, 0x41, 0xfb, 0x3c, 0x35, 0xc9, 0x78, 0xee, 0x8b, 0xf2, 0x7c, 0xe5, 0x8d, 0xd0,
-	0xb7, 0xfd, 0x98, 0x02, 0xac, 0x70, 0x2f, 0x2d, 0x30, 0x62, 0x63, 0x91, 0x11, 0xe1, 0xbf, 0x01,
-	0xb4, 0xca, 0xa4, 0xb7, 0x4b, 0x40, 0x61, 0x94, 0x64, 0x09, 0x4a, 0xe3, 0x39, 0xf8, 0x00, 0xb0,
-	0x6f, 0x00, 0xc6, 0x22, 0xc2, 0x91, 0xdb, 0xb3, 0xae, 0x05, 0x0d, 0x8b, 0xfc, 0x6a, 0x01, 0xf6,
-	0x1a, 0xea, 0x9f, 0x12, 0x39, 0xca, 0x54, 0x7a, 0xed, 0x39, 0xb9, 0xfa, 0x29, 0x91, 0x03, 0x95,
-	0x5e, 0xb3, 0x7d, 0x78, 0x51, 0xb8, 0x19, 0x29, 0x21, 0xe3, 0x11, 0x31, 0xd7, 0x31, 0x74, 0xa3,
-	0x50, 0x71, 0x21, 0xe3, 0x33, 0x4b, 0x63, 0x06, 0x55, 0x8d, 0x18, 0x7b, 0xae, 0xd2, 0x39, 0xec,
-	0x03, 0x73, 0xb1, 0x0e, 0x51, 0xc6, 0xa8, 0x7c, 0xc4, 0xdf, 0x42, 0x4b, 0x93, 0x3c, 0x92, 0xa9,
-	0x8c, 0xdc, 0x4e, 0x6e, 0xf3, 0xa6, 0xc3, 0xce, 0x2d, 0xf4, 0x0c, 0x65, 0x3e, 0xc3, 0x96, 0x73,
-	0x75, 0x72, 0x9f, 0x25, 0x4a, 0x98, 0x24, 0x95, 0xde, 0xdd, 0x2e, 0xac, 0x45, 0x0a, 0x09, 0x19,
-	0xa9, 0x74, 0x26, 0x63, 0xcf, 0xa1, 0x76, 0x8e, 0x72, 0x0b, 0xb2, 0x0f, 0xf0, 0x7a, 0xd1, 0x6c,
-	0x74, 0x3d, 0x4d, 0xa3, 0x5b, 0x97, 0x95, 0x7b, 0x68, 0x6b, 0xe1, 0xc6, 0x91, 0x55, 0xdb, 0xd4,
-	0xc2, 0x7f, 0x96, 0x61, 0x75, 0x20, 0xe6, 0xd4, 0xc5, 0x27, 0xdb, 0x28, 0xf8, 0xb2, 0x6d, 0x44,
-	0x14, 0xb2, 0x09, 0xfa, 0xb7, 0xbc, 0xc4, 0xce, 0x60, 0x03, 0x8b, 0x8c, 0x72, 0x9f, 0x8e, 0xd9,
-	0x5f, 0x95, 0x7c, 0x3e, 0xce, 0x9a, 0x77, 0xf0, 0x71, 0x1d, 0xfa, 0xb0, 0xe9, 0x23, 0xf3, 0xd5,
-	0xf5, 0xce, 0xaa, 0x34, 0xaa, 0xaf, 0x4a, 0xce, 0xca, 0xdd, 0xe0, 0xcc, 0x3c, 0xed, 0xd0, 0x8f,
-	0xb0, 0x86, 0xf7, 0x19, 0x46, 0x06, 0xe3, 0x11, 0x6d, 0x48, 0xea, 0xea, 0xd3, 0xf5, 0xd9, 0xce,
-	0xad, 0x08, 0xea, 0xdd, 0x43, 0xab, 0x3c, 0x5d, 0xec, 0x08, 0xd6, 0x4f, 0xd1, 0x2c, 0x40, 0xdd,
-	0x27, 0x33, 0xe8, 0x67, 0x6c, 0xfb, 0xf9, 0xe9, 0x64, 0x6f, 0xa1, 0x6a, 0xff, 0x17, 0x98, 0xfb,
-	0xf8, 0xe6, 0xbf, 0x0e, 0xdb, 0x8b, 0x62, 0xef, 0x1c, 0xe0, 0xf2, 0xe1, 0x8b, 0xf1, 0x13, 0xb0,
-	0x7c, 0x82, 0x4b, 0xe8, 0x26, 0x5d, 0x79, 0x34, 0xda, 0xdb, 0x6e, 0x7d, 0x2c, 0x4c, 0xea, 0x0f,
-	0xc1, 0x75, 0x8d, 0xfe, 0x58, 0x0e, 0xfe, 0x0f, 0x00, 0x00, 0xff, 0xff, 0x9a, 0x79, 0x23, 0x42,
-	0xc5, 0x08, 0x00, 0x00,
+	// 1546 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x57, 0x5f, 0x6f, 0x1c, 0x49,
+	0x11, 0xcf, 0x78, 0xff, 0xd8, 0xae, 0xdd, 0xb5, 0xd7, 0x7d, 0x3e, 0x67, 0xce, 0xc0, 0xc9, 0x37,
+	0x5c, 0x38, 0x23, 0x38, 0x1f, 0x72, 0xc8, 0x49, 0xf7, 0x46, 0x4c, 0x42, 0x62, 0x84, 0x92, 0x55,
+	0xdb, 0x17, 0x89, 0xa7, 0x51, 0x7b, 0xa6, 0x76, 0xdd, 0x78, 0x76, 0x66, 0xd2, 0xd3, 0x76, 0xd6,
+	0xf7, 0x19, 0x78, 0x47, 0xf0, 0x88, 0x84, 0x84, 0x78, 0x84, 0xaf, 0xc2, 0x07, 0x42, 0x55, 0xdd,
+	0x33, 0x9e, 0x5d, 0x5b, 0x28, 0x6f, 0x5d, 0xbf, 0xaa, 0xa9, 0xee, 0xae, 0x3f, 0xbf, 0xea, 0x81,
+	0x71, 0x8e, 0xf6, 0x9b, 0xac, 0x8c, 0x4d, 0x99, 0x1c, 0x95, 0xa6, 0xb0, 0x85, 0xe8, 0xe4, 0x68,
+	0xa3, 0x03, 0xd8, 0x98, 0xe8, 0x7c, 0x36, 0x29, 0xf2, 0x99, 0xd8, 0x85, 0xde, 0x8d, 0xca, 0xae,
+	0x31, 0x0c, 0x0e, 0x82, 0xc3, 0xa1, 0x74, 0x42, 0xf4, 0x1c, 0x3e, 0x79, 0x6b, 0x92, 0x4b, 0xac,
+	0xac, 0x51, 0xb6, 0x30, 0x12, 0xdf, 0x5f, 0x63, 0x65, 0x45, 0x08, 0xeb, 0x2a, 0x4d, 0x0d, 0x56,
+	0x95, 0x37, 0xaf, 0x45, 0x31, 0x86, 0x4e, 0xa5, 0x67, 0xe1, 0x1a, 0xa3, 0xb4, 0x8c, 0xfe, 0x1a,
+	0x40, 0xff, 0xed, 0xd9, 0x69, 0x3e, 0x2d, 0xc4, 0x77, 0x30, 0xa8, 0x6c, 0x61, 0xd4, 0x0c, 0xcf,
+	0x6f, 0x4b, 0xb7, 0xd3, 0xd6, 0xf1, 0xe3, 0xa3, 0x1c, 0xed, 0x91, 0xb3, 0x38, 0x3a, 0xbb, 0x53,
+	0xcb, 0xb6, 0xad, 0x78, 0x02, 0xfd, 0xea, 0xa9, 0xce, 0xa7, 0x45, 0x38, 0x3e, 0x08, 0x0e, 0x07,
+	0xc7, 0x23, 0xfe, 0xea, 0xec, 0xa9, 0xfb, 0x4e, 0x7a, 0x65, 0xf4, 0x35, 0x0c, 0x5a, 0x2e, 0x04,
+	0x40, 0xff, 0xc5, 0xa9, 0x7c, 0xf9, 0xdb, 0xf3, 0xf1, 0x23, 0xd1, 0x87, 0xb5, 0xb3, 0xa7, 0xe3,
+	0x80, 0xb0, 0x57, 0x6f, 0xdf, 0xbe, 0xfa, 0xc3, 0xcb, 0xf1, 0x5a, 0xf4, 0xf7, 0x00, 0x36, 0x6a,
+	0x1f, 0x42, 0x40, 0xf7, 0xb2, 0xa8, 0x2c, 0x1f, 0x6b, 0x53, 0xf2, 0x9a, 0xae, 0x73, 0x85, 0xb7,
+	0x7c, 0x9d, 0x4d, 0x49, 0x4b, 0xb1, 0x07, 0xfd, 0xb2, 0xc8, 0x74, 0x72, 0x1b, 0x76, 0x18, 0xf4,
+	0x92, 0xf8, 0x31, 0x6c, 0x56, 0x7a, 0x96, 0x2b, 0x7b, 0x6d, 0x30, 0xec, 0xb2, 0xea, 0x0e, 0x10,
+	0x9f, 0x03, 0x24, 0x06, 0x53, 0xcc, 0xad, 0x56, 0x59, 0xd8, 0x63, 0x75, 0x0b, 0x11, 0xfb, 0xb0,
+	0xb1, 0x78, 0x3e, 0xff, 0xe1, 0x85, 0xb2, 0x18, 0xf6, 0x59, 0xdb, 0xc8, 0xd1, 0xf7, 0xb0, 0x39,
+	0x31, 0x3a, 0x41, 0x3e, 0x64, 0x04, 0xc3, 0x92, 0x84, 0x09, 0x9a, 0xef, 0x73, 0xed, 0x0e, 0xdb,
+	0x91, 0x4b, 0x98, 0xf8, 0x12, 0x46, 0xa5, 0x5e, 0x60, 0x56, 0xd5, 0x46, 0x6b, 0x6c, 0xb4, 0x0c,
+	0x46, 0xff, 0xec, 0xc2, 0xb8, 0x9d, 0x5b, 0x76, 0xff, 0x39, 0x80, 0x35, 0x2a, 0xaf, 0x92, 0x22,
+	0x45, 0xe3, 0x23, 0xd1, 0x42, 0xc4, 0xb7, 0x30, 0xb2, 0x3a, 0xb9, 0x42, 0x1b, 0x97, 0xca, 0xa8,
+	0x79, 0xc5, 0xae, 0x07, 0xc7, 0x3b, 0x9c, 0x8d, 0x73, 0xd6, 0x4c, 0x58, 0x21, 0x87, 0xb6, 0x25,
+	0x89, 0xaf, 0x01, 0xf8, 0x88, 0x31, 0xa7, 0xb0, 0xc3, 0x1f, 0x6d, 0xf1, 0x47, 0xcd, 0xd5, 0xe4,
+	0x66, 0xd9, 0xdc, 0xf2, 0x19, 0x3c, 0x9e, 0xab, 0x45, 0xec, 0x5c, 0x54, 0x71, 0x89, 0x26, 0x2e,
+	0xd5, 0xed, 0x1c, 0x73, 0xcb, 0xa1, 0x1d, 0xc9, 0xdd, 0xb9, 0x5a, 0xb8, 0xed, 0xe8, 0x3e, 0x13,
+	0xa7, 0x13, 0xdf, 0x00, 0xe1, 0xf1, 0x85, 0xb2, 0xc9, 0x65, 0x3c, 0x55, 0x09, 0xc6, 0xae, 0xa4,
+	0x7b, 0x5c, 0x8d, 0x3b, 0x73, 0xb5, 0x38, 0x21, 0xd5, 0xef, 0x54, 0x82, 0xef, 0x48, 0x41, 0x49,
+	0x9b, 0x9a, 0x22, 0xb7, 0x98, 0xa7, 0x55, 0xb8, 0x7e, 0xd0, 0xa1, 0xa4, 0x35, 0x00, 0x05, 0x03,
+	0x17, 0xa5, 0x36, 0xca, 0xea, 0x22, 0x0f, 0x37, 0x38, 0x88, 0x2d, 0x84, 0x4a, 0xc1, 0xe0, 0x8c,
+	0x74, 0x9b, 0xae, 0x14, 0x9c, 0x24, 0x7e, 0x0d, 0xc3, 0x14, 0x4b, 0x83, 0x09, 0x9b, 0x55, 0x21,
+	0x1c, 0x74, 0x0e, 0x07, 0xc7, 0x63, 0xbe, 0xee, 0x8b, 0x3b, 0x85, 0x5c, 0xb2, 0x12, 0xaf, 0x61,
+	0xc7, 0x87, 0xb6, 0xb5, 0xe9, 0x80, 0x23, 0xf5, 0xa3, 0x56, 0x78, 0x5f, 0x36, 0xca, 0x09, 0x17,
+	0x9e, 0x1c, 0xdb, 0x15, 0x9c, 0x6a, 0x24, 0x51, 0xa5, 0xba, 0xd0, 0x99, 0xb6, 0x1a, 0xab, 0x70,
+	0xc8, 0x17, 0x5b, 0xc2, 0xc4, 0x13, 0x58, 0xf7, 0xed, 0x15, 0x1e, 0xf0, 0xf1, 0x06, 0xad, 0x36,
+	0x94, 0xb5, 0xee, 0xf7, 0xdd, 0x8d, 0xfe, 0x78, 0x3d, 0xfa, 0xf7, 0x1a, 0xac, 0x9f, 0xe1, 0xec,
+	0x85, 0xb2, 0x8a, 0x82, 0x32, 0x57, 0xb9, 0x9e, 0x62, 0x65, 0x4f, 0x53, 0xdf, 0xfd, 0x2d, 0x84,
+	0x09, 0x00, 0xdf, 0xfb, 0x92, 0xa3, 0x25, 0xf7, 0x95, 0xaa, 0x2e, 0x39, 0xeb, 0x43, 0xc9, 0x6b,
+	0xaa, 0xf7, 0xd2, 0x14, 0x53, 0x9d, 0x61, 0xc5, 0x19, 0x1d, 0xca, 0x46, 0xae, 0x29, 0xa4, 0xd7,
+	0x50, 0xc8, 0x47, 0x1e, 0x56, 0x3c, 0x83, 0xe1, 0xf4, 0x3a, 0xcb, 0x26, 0xb5, 0xe3, 0x2f, 0xd8,
+	0xd6, 0xd5, 0xe6, 0x3b, 0x9d, 0x62, 0xe1, 0x35, 0x72, 0xc9, 0x8c, 0x7b, 0xb3, 0x98, 0x97, 0x19,
+	0x2e, 0xb4, 0xbd, 0x0d, 0xa3, 0x83, 0xe0, 0x70, 0x4d, 0xb6, 0x10, 0xf1, 0x0c, 0xc0, 0x60, 0x75,
+	0x3d, 0x2f, 0x39, 0x23, 0x3f, 0xe5, 0x8c, 0x7c, 0xea, 0xe8, 0xc7, 0x1a, 0x54, 0x73, 0xd9, 0x28,
+	0x65, 0xcb, 0x30, 0xfa, 0x25, 0x8c, 0x57, 0xf5, 0xc4, 0x9b, 0x99, 0xaa, 0xec, 0x19, 0xbe, 0xf7,
+	0x8d, 0x5b, 0x8b, 0xd1, 0x7f, 0x03, 0x18, 0xb6, 0xcf, 0x48, 0x51, 0xcb, 0xd5, 0x1c, 0x6b, 0x36,
+	0xa2, 0x35, 0x71, 0xf4, 0x07, 0x9d, 0xda, 0x4b, 0x8e, 0x6e, 0x4f, 0x3a, 0x81, 0xca, 0xf0, 0x12,
+	0xf5, 0xec, 0xd2, 0x72, 0x84, 0x7b, 0xd2, 0x4b, 0xb4, 0xd9, 0x85, 0xa6, 0xde, 0x76, 0x7c, 0xd4,
+	0x93, 0xb5, 0x48, 0x11, 0x9e, 0x96, 0x15, 0x47, 0x78, 0x24, 0x69, 0x49, 0xc8, 0xac, 0x28, 0x3d,
+	0xf5, 0xd0, 0x92, 0xbe, 0xf6, 0x19, 0x09, 0xd7, 0x19, 0xad, 0x45, 0x3a, 0x45, 0x86, 0x37, 0x98,
+	0x71, 0x47, 0x6c, 0x4a, 0x27, 0x10, 0x4a, 0x14, 0x91, 0xf8, 0x5e, 0x70, 0x42, 0xf4, 0x1c, 0x3e,
+	0x3d, 0xaf, 0xd9, 0x23, 0x3d, 0xc3, 0x19, 0xb5, 0x29, 0x97, 0xd1, 0x18, 0x3a, 0xd7, 0x26, 0xf3,
+	0xb7, 0xa3, 0x25, 0x13, 0x2b, 0x13, 0x94, 0xaf, 0x1d, 0x2f, 0x45, 0x7f, 0x84, 0x51, 0xe3, 0x82,
+	0x3f, 0xfd, 0x16, 0x36, 0x2a, 0xe7, 0x89, 0xa6, 0x0f, 0xa5, 0x78, 0xdf, 0xf5, 0xc7, 0x43, 0x1b,
+	0xc9, 0xc6, 0xf6, 0x81, 0xd1, 0xf4, 0xb7, 0x00, 0xb6, 0x9b, 0xaf, 0x28, 0x4d, 0x99, 0xad, 0xeb,
+	0x37, 0xb8, 0xab, 0xdf, 0x3d, 0xe8, 0xa1, 0x31, 0x85, 0x71, 0x53, 0xe0, 0xf5, 0x23, 0xe9, 0x44,
+	0x71, 0x08, 0xdd, 0x54, 0x59, 0xe5, 0xd9, 0x4c, 0x2c, 0x9f, 0x81, 0xf6, 0x7e, 0xfd, 0x48, 0xb2,
+	0x85, 0xf8, 0x39, 0x74, 0x5b, 0xa3, 0xcb, 0xd5, 0xce, 0x2a, 0xf5, 0x4a, 0x36, 0x39, 0xd9, 0x20,
+	0x4e, 0xa1, 0x83, 0x44, 0xff, 0x09, 0x60, 0x5b, 0xe2, 0x4c, 0x57, 0x16, 0x9b, 0xb9, 0xbb, 0x07,
+	0xfd, 0x0a, 0x13, 0x83, 0xf5, 0x90, 0xf2, 0x12, 0xb5, 0x13, 0x75, 0x77, 0x42, 0x05, 0xec, 0xa2,
+	0xd7, 0xc8, 0x94, 0xc8, 0x1b, 0x34, 0x15, 0xd5, 0xae, 0x9b, 0x58, 0xb5, 0x78, 0x8f, 0x27, 0xba,
+	0x0f, 0xf0, 0xc4, 0x2e, 0xf4, 0xae, 0xf0, 0xf6, 0x34, 0xf5, 0x33, 0xcb, 0x09, 0xed, 0xf9, 0xdf,
+	0x5f, 0x9a, 0xff, 0xd1, 0x9f, 0x03, 0x18, 0xbd, 0x29, 0xac, 0x9e, 0xde, 0xfa, 0x24, 0x3c, 0x9c,
+	0x69, 0xab, 0xaa, 0xab, 0xd3, 0x94, 0x03, 0xd2, 0x91, 0x5e, 0x5a, 0x22, 0x85, 0x9d, 0x15, 0x52,
+	0x58, 0xed, 0x6d, 0xf1, 0x51, 0xbd, 0x1d, 0xfd, 0x2b, 0x80, 0x61, 0x7b, 0x2c, 0x11, 0xe3, 0x1b,
+	0x4c, 0x74, 0xa9, 0x69, 0x96, 0x38, 0xf6, 0xba, 0x03, 0xc4, 0x4f, 0x00, 0x5a, 0x63, 0xc3, 0x55,
+	0xca, 0xe6, 0xb4, 0x19, 0x17, 0x9f, 0xc1, 0xc6, 0x07, 0x9d, 0xc7, 0xa5, 0x29, 0x2e, 0x3c, 0x9b,
+	0xad, 0x7f, 0xd0, 0xf9, 0xc4, 0x14, 0x17, 0xe2, 0x08, 0x3e, 0x69, 0xdc, 0xc4, 0x46, 0xe5, 0x69,
+	0xcc, 0x9c, 0xe7, 0xb8, 0x6d, 0xa7, 0x51, 0x49, 0x95, 0xa7, 0xaf, 0x89, 0x00, 0x05, 0x74, 0x2b,
+	0xc4, 0xd4, 0xb3, 0x1c, 0xaf, 0xa3, 0x53, 0x10, 0xee, 0xac, 0x67, 0x98, 0xa7, 0x34, 0xd5, 0xf8,
+	0xc4, 0x5f, 0xc0, 0xb0, 0x62, 0x39, 0xce, 0x8b, 0x3c, 0x71, 0x84, 0x30, 0x92, 0x03, 0x87, 0xbd,
+	0x21, 0xe8, 0x81, 0xca, 0xfe, 0x01, 0xf6, 0xee, 0x8d, 0x0b, 0xe7, 0xee, 0x09, 0x6c, 0x25, 0x06,
+	0x19, 0x89, 0x4d, 0x71, 0x9d, 0xa7, 0xbe, 0xd4, 0x47, 0x35, 0x2a, 0x09, 0x14, 0xdf, 0xc1, 0x67,
+	0xcb, 0x66, 0xf1, 0x45, 0x56, 0x24, 0x57, 0xee, 0x56, 0x6e, 0xa3, 0xbd, 0xa5, 0x2f, 0x4e, 0x48,
+	0x4d, 0x57, 0x8b, 0xfe, 0xb1, 0x06, 0xeb, 0xf5, 0x44, 0xbe, 0xf7, 0x5e, 0x08, 0x3e, 0xee, 0xbd,
+	0xc0, 0x85, 0x4e, 0x17, 0xf4, 0x7b, 0x79, 0x89, 0x86, 0xe4, 0xdd, 0x74, 0xac, 0x7d, 0x76, 0xfe,
+	0xdf, 0x90, 0x74, 0xde, 0xc7, 0xb8, 0x1a, 0x87, 0x53, 0xd8, 0xf5, 0x27, 0xf3, 0xd1, 0xf5, 0xce,
+	0xba, 0x5c, 0x58, 0x8f, 0x5b, 0xce, 0xda, 0xd9, 0x90, 0xc2, 0xde, 0xcf, 0xd0, 0x33, 0xd8, 0xc2,
+	0x45, 0x89, 0x89, 0xc5, 0x34, 0xe6, 0x37, 0x0c, 0x67, 0xf5, 0xfe, 0x03, 0x67, 0x54, 0x5b, 0x31,
+	0x14, 0xfd, 0x25, 0x80, 0x91, 0x8f, 0x93, 0xe7, 0x9e, 0xaf, 0x60, 0x5b, 0x25, 0x09, 0x96, 0xe4,
+	0x88, 0x93, 0xed, 0x08, 0x6e, 0x24, 0xb7, 0x6a, 0x98, 0xf3, 0x5d, 0x91, 0xa1, 0xc1, 0x3f, 0xb9,
+	0x1d, 0xbd, 0xe1, 0x9a, 0x33, 0xac, 0x61, 0x6f, 0xb8, 0x07, 0x7d, 0x7a, 0x65, 0x6a, 0x5b, 0xbf,
+	0x56, 0x9d, 0xc4, 0xaf, 0xd5, 0xcb, 0xc2, 0xd8, 0xa9, 0xca, 0xb2, 0xe6, 0xb5, 0x5a, 0x03, 0x91,
+	0x86, 0x41, 0xeb, 0x9d, 0x42, 0xdd, 0x3e, 0x45, 0xf7, 0xb0, 0x75, 0x5d, 0x5c, 0x8b, 0xe2, 0x67,
+	0xb0, 0x65, 0x70, 0x5e, 0xdc, 0xa8, 0xec, 0x9d, 0xa7, 0x18, 0xf7, 0x52, 0x5e, 0x41, 0xc9, 0x43,
+	0x8a, 0x56, 0xe9, 0xac, 0xaa, 0x39, 0xc8, 0x8b, 0x51, 0xfe, 0x40, 0xa1, 0xba, 0x07, 0xf5, 0x57,
+	0xb0, 0x7d, 0xa3, 0x32, 0x9d, 0x6a, 0x7b, 0x4b, 0x0f, 0x40, 0x5d, 0xd4, 0x95, 0xba, 0x55, 0xc3,
+	0x13, 0x46, 0xc5, 0x2f, 0x60, 0x87, 0x1e, 0xd2, 0x6e, 0xc4, 0xc6, 0x17, 0xd7, 0xd3, 0xa9, 0x2f,
+	0x9b, 0x8e, 0x1c, 0xdf, 0x29, 0x4e, 0x18, 0x3f, 0x5e, 0xc0, 0xb0, 0xcd, 0xbc, 0xe2, 0x04, 0xb6,
+	0x5f, 0xa1, 0x5d, 0x82, 0xc2, 0x7b, 0xfc, 0xec, 0xe9, 0x77, 0xff, 0x61, 0xe6, 0x16, 0x5f, 0x42,
+	0x97, 0x7e, 0xa3, 0x84, 0xfb, 0x27, 0xa9, 0xff, 0xa8, 0xf6, 0x97, 0xc5, 0xe3, 0x37, 0x00, 0xe7,
+	0x77, 0x0f, 0xe9, 0xdf, 0x80, 0xa8, 0xc9, 0xbd, 0x85, 0xee, 0xf2, 0x27, 0x2b, 0xac, 0xbf, 0xef,
+	0x46, 0xcb, 0x12, 0xab, 0xfe, 0x2a, 0xb8, 0xe8, 0xf3, 0x8f, 0xdc, 0xd3, 0xff, 0x05, 0x00, 0x00,
+	0xff, 0xff, 0x84, 0x7e, 0x07, 0x06, 0xdc, 0x0d, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -0,0 +1,46 @@
+package pm
+
+import "fmt"
+
+// TicketExpirationPolicy is how long tickets can be redeemed for and how much of that period is
+// kept as a safety buffer. A recipient redeems its winning tickets at the latest RedemptionBuffer
+// rounds before the end of their validity period. A sender requires recipients to redeem them at
+// the latest RedemptionBuffer rounds before the end of their validity period, e.g. so that the
+// deposit and reserve backing them are not withdrawn before they are redeemed
+type TicketExpirationPolicy struct {
+	// ValidityPeriod is the number of rounds, starting with its creation round,
+	// in which a ticket can be redeemed
+	ValidityPeriod int64
+
+	// RedemptionBuffer is the number of rounds at the end of the validity period of a ticket
+	// in which it is not redeemed
+	RedemptionBuffer int64
+}
+
+// Validate checks that tickets can be redeemed under the policy
+func (p TicketExpirationPolicy) Validate() error {
+	if p.ValidityPeriod <= 0 {
+		return fmt.Errorf("ticket validity period must be greater than 0")
+	}
+	if p.RedemptionBuffer < 0 || p.RedemptionBuffer >= p.ValidityPeriod {
+		return fmt.Errorf("ticket redemption buffer must be between 0 and %v rounds", p.ValidityPeriod-1)
+	}
+	return nil
+}
+
+// LastRedemptionRound returns the last round in which a ticket created in creationRound is redeemed
+func (p TicketExpirationPolicy) LastRedemptionRound(creationRound int64) int64 {
+	return creationRound + p.ValidityPeriod - 1 - p.RedemptionBuffer
+}
+
+// CheckRecipient checks that the tickets of a recipient with the expiration policy recipient are
+// redeemed before they expire for the sender with this policy
+func (p TicketExpirationPolicy) CheckRecipient(recipient TicketExpirationPolicy) error {
+	if recipient.ValidityPeriod != p.ValidityPeriod {
+		return fmt.Errorf("recipient ticket validity period of %v rounds does not match %v rounds", recipient.ValidityPeriod, p.ValidityPeriod)
+	}
+	if recipient.RedemptionBuffer < p.RedemptionBuffer {
+		return fmt.Errorf("recipient ticket redemption buffer of %v rounds is less than %v rounds", recipient.RedemptionBuffer, p.RedemptionBuffer)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package pm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTicketExpirationPolicy_Validate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.EqualError(TicketExpirationPolicy{}.Validate(), "ticket validity period must be greater than 0")
+	assert.EqualError(TicketExpirationPolicy{ValidityPeriod: 2, RedemptionBuffer: -1}.Validate(), "ticket redemption buffer must be between 0 and 1 rounds")
+	assert.EqualError(TicketExpirationPolicy{ValidityPeriod: 2, RedemptionBuffer: 2}.Validate(), "ticket redemption buffer must be between 0 and 1 rounds")
+	assert.Nil(TicketExpirationPolicy{ValidityPeriod: 2}.Validate())
+	assert.Nil(TicketExpirationPolicy{ValidityPeriod: 2, RedemptionBuffer: 1}.Validate())
+}
+
+func TestTicketExpirationPolicy_LastRedemptionRound(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(int64(11), TicketExpirationPolicy{ValidityPeriod: 2}.LastRedemptionRound(10))
+	assert.Equal(int64(10), TicketExpirationPolicy{ValidityPeriod: 2, RedemptionBuffer: 1}.LastRedemptionRound(10))
+}
+
+func TestTicketExpirationPolicy_CheckRecipient(t *testing.T) {
+	assert := assert.New(t)
+
+	sender := TicketExpirationPolicy{ValidityPeriod: 3, RedemptionBuffer: 1}
+	assert.EqualError(sender.CheckRecipient(TicketExpirationPolicy{ValidityPeriod: 4, RedemptionBuffer: 1}), "recipient ticket validity period of 4 rounds does not match 3 rounds")
+	assert.EqualError(sender.CheckRecipient(TicketExpirationPolicy{ValidityPeriod: 3}), "recipient ticket redemption buffer of 0 rounds is less than 1 rounds")
+	assert.Nil(sender.CheckRecipient(TicketExpirationPolicy{ValidityPeriod: 3, RedemptionBuffer: 1}))
+	assert.Nil(sender.CheckRecipient(TicketExpirationPolicy{ValidityPeriod: 3, RedemptionBuffer: 2}))
+}
@@ -0,0 +1,98 @@
+package pm
+
+import (
+	"math/big"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/livepeer/go-livepeer/clog"
+	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/pkg/errors"
+)
+
+var errForwardedRedemption = errors.New("winning tickets are redeemed by the redeemer")
+
+// TicketForwarder is an interface which describes an object capable of
+// forwarding winning tickets to the node that redeems them
+type TicketForwarder interface {
+	// ForwardWinningTicket submits a winning ticket for redemption
+	ForwardWinningTicket(ticket *Ticket, sig []byte, seed *big.Int) error
+}
+
+// MaxFloatReader is an interface which describes an object capable of reading
+// the max float of senders from the node that redeems their winning tickets
+type MaxFloatReader interface {
+	// MaxFloat returns a remote sender's max float
+	MaxFloat(addr ethcommon.Address) (*big.Int, error)
+}
+
+// forwardingRecipient is a Recipient that forwards its winning tickets instead of
+// redeeming them so that the tickets received by multiple recipients sharing an
+// identity are redeemed by a single node
+type forwardingRecipient struct {
+	Recipient
+
+	fwd TicketForwarder
+}
+
+// NewForwardingRecipient wraps a recipient so that its winning tickets are forwarded to fwd
+func NewForwardingRecipient(r Recipient, fwd TicketForwarder) Recipient {
+	return &forwardingRecipient{
+		Recipient: r,
+		fwd:       fwd,
+	}
+}
+
+// Start does not start redeeming the tickets that are queued for senders without
+// enough max float, since the winning tickets are queued and redeemed by the redeemer
+func (r *forwardingRecipient) Start() {}
+
+// RedeemWinningTicket forwards a winning ticket for redemption
+func (r *forwardingRecipient) RedeemWinningTicket(ticket *Ticket, sig []byte, seed *big.Int) error {
+	if err := r.fwd.ForwardWinningTicket(ticket, sig, seed); err != nil {
+		return err
+	}
+	ticketLogger(ticket).Infof("Forwarded ticket redemption")
+
+	return nil
+}
+
+// RedeemWinningTickets is not supported since the winning tickets are forwarded as they are received
+func (r *forwardingRecipient) RedeemWinningTickets(sessionIDs []string) error {
+	return errForwardedRedemption
+}
+
+// forwardingSenderMonitor is a SenderMonitor of a recipient that forwards its winning
+// tickets. The max float of senders is read from the node that redeems the tickets, so
+// that it accounts for the pending redemptions of every recipient sharing an identity
+type forwardingSenderMonitor struct {
+	MaxFloatReader
+}
+
+// NewForwardingSenderMonitor creates a SenderMonitor that reads the max float of senders with r
+func NewForwardingSenderMonitor(r MaxFloatReader) SenderMonitor {
+	return &forwardingSenderMonitor{MaxFloatReader: r}
+}
+
+// Start is a no-op since the senders are monitored by the redeemer
+func (sm *forwardingSenderMonitor) Start() {}
+
+// Stop is a no-op since the senders are monitored by the redeemer
+func (sm *forwardingSenderMonitor) Stop() {}
+
+// Redeemable returns a channel that never receives tickets, since no ticket is queued
+func (sm *forwardingSenderMonitor) Redeemable() chan *SignedTicket {
+	return nil
+}
+
+// QueueTicket drops the ticket since winning tickets are queued by the redeemer
+func (sm *forwardingSenderMonitor) QueueTicket(addr ethcommon.Address, ticket *SignedTicket) {
+	logger.With(clog.Sender, monitor.RedactAddress(addr)).Errorf("Dropping ticket queued by a forwarding recipient")
+}
+
+// AddFloat is a no-op since the pending redemptions are tracked by the redeemer
+func (sm *forwardingSenderMonitor) AddFloat(addr ethcommon.Address, amount *big.Int) error {
+	return nil
+}
+
+// SubFloat is a no-op since the pending redemptions are tracked by the redeemer
+func (sm *forwardingSenderMonitor) SubFloat(addr ethcommon.Address, amount *big.Int) {}
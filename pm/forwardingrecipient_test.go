@@ -0,0 +1,85 @@
+package pm
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubTicketForwarder struct {
+	tickets []*Ticket
+	err     error
+}
+
+func (f *stubTicketForwarder) ForwardWinningTicket(ticket *Ticket, sig []byte, seed *big.Int) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.tickets = append(f.tickets, ticket)
+	return nil
+}
+
+func TestForwardingRecipient_RedeemWinningTicket(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &MockRecipient{}
+	fwd := &stubTicketForwarder{}
+	fr := NewForwardingRecipient(r, fwd)
+
+	ticket := &Ticket{SenderNonce: 1}
+	assert.Nil(fr.RedeemWinningTicket(ticket, []byte("foo"), big.NewInt(7)))
+	assert.Equal([]*Ticket{ticket}, fwd.tickets)
+	r.AssertNotCalled(t, "RedeemWinningTicket", ticket, []byte("foo"), big.NewInt(7))
+
+	fwd.err = errors.New("forward error")
+	assert.EqualError(fr.RedeemWinningTicket(ticket, []byte("foo"), big.NewInt(7)), "forward error")
+
+	assert.Equal(errForwardedRedemption, fr.RedeemWinningTickets([]string{"foo"}))
+}
+
+type startedRecipient struct {
+	*MockRecipient
+	started bool
+}
+
+func (r *startedRecipient) Start() {
+	r.started = true
+}
+
+func TestForwardingRecipient_Start(t *testing.T) {
+	// The tickets queued for retries are redeemed by the redeemer
+	r := &startedRecipient{MockRecipient: &MockRecipient{}}
+	NewForwardingRecipient(r, &stubTicketForwarder{}).Start()
+	assert.False(t, r.started)
+}
+
+type stubMaxFloatReader struct {
+	maxFloat *big.Int
+}
+
+func (r *stubMaxFloatReader) MaxFloat(addr ethcommon.Address) (*big.Int, error) {
+	return r.maxFloat, nil
+}
+
+func TestForwardingSenderMonitor(t *testing.T) {
+	assert := assert.New(t)
+
+	sm := NewForwardingSenderMonitor(&stubMaxFloatReader{maxFloat: big.NewInt(100)})
+	sm.Start()
+	defer sm.Stop()
+	sender := RandAddress()
+
+	// Pending redemptions are tracked by the redeemer
+	sm.SubFloat(sender, big.NewInt(50))
+	maxFloat, err := sm.MaxFloat(sender)
+	assert.Nil(err)
+	assert.Equal(int64(100), maxFloat.Int64())
+	assert.Nil(sm.AddFloat(sender, big.NewInt(50)))
+
+	// No ticket is queued for redemption
+	sm.QueueTicket(sender, &SignedTicket{Ticket: &Ticket{Sender: sender}})
+	assert.Nil(sm.Redeemable())
+}
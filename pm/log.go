@@ -0,0 +1,17 @@
+package pm
+
+import (
+	"github.com/livepeer/go-livepeer/clog"
+	"github.com/livepeer/go-livepeer/monitor"
+)
+
+var logger = clog.New("pm")
+
+// ticketLogger returns a logger that logs the sender, recipientRandHash and senderNonce of a ticket
+func ticketLogger(ticket *Ticket) *clog.Logger {
+	return logger.With(
+		clog.Sender, monitor.RedactAddress(ticket.Sender),
+		"recipientRandHash", ticket.RecipientRandHash.Hex(),
+		"senderNonce", ticket.SenderNonce,
+	)
+}
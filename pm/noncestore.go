@@ -0,0 +1,54 @@
+package pm
+
+import (
+	"math/big"
+)
+
+// SenderNonceStore is an interface which describes an object capable
+// of persisting the highest senderNonce used for a session so that
+// senderNonces are never reused across restarts
+type SenderNonceStore interface {
+	// StoreSenderNonce persists the highest senderNonce used for a session ID.
+	// A senderNonce lower than the one already persisted is ignored
+	StoreSenderNonce(sessionID string, senderNonce uint32) error
+
+	// LoadSenderNonce fetches the highest senderNonce used for a session ID.
+	// Returns 0 if no senderNonce has been persisted for the session ID
+	LoadSenderNonce(sessionID string) (uint32, error)
+}
+
+// SenderSessionState is the persisted state of a sender's session with a recipient
+type SenderSessionState struct {
+	TicketParams TicketParams
+
+	// ExpirationParams are the expiration params used for the last ticket batch of the session.
+	// nil if no tickets have been created for the session
+	ExpirationParams *TicketExpirationParams
+
+	SenderNonce uint32
+
+	// TicketsSent is the total number of tickets created for the session
+	TicketsSent int64
+
+	// EVSent is the total EV of the tickets created for the session
+	EVSent *big.Rat
+}
+
+// SenderSessionStore is an interface which describes an object capable
+// of persisting the state of a sender's sessions so that they can be resumed
+// after a restart
+type SenderSessionStore interface {
+	// StoreSenderSession persists the state of a session
+	StoreSenderSession(sessionID string, state *SenderSessionState) error
+
+	// LoadSenderSession fetches the state of a session.
+	// Returns nil if no state has been persisted for the session ID
+	LoadSenderSession(sessionID string) (*SenderSessionState, error)
+}
+
+// SenderStore is an interface which describes an object capable of
+// persisting both the senderNonces and the state of a sender's sessions
+type SenderStore interface {
+	SenderNonceStore
+	SenderSessionStore
+}
@@ -5,11 +5,10 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"math/big"
-	"sync"
 
 	ethcommon "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/clog"
 	"github.com/livepeer/go-livepeer/monitor"
 	"github.com/pkg/errors"
 )
@@ -81,10 +80,8 @@ type recipient struct {
 	addr   ethcommon.Address
 	secret [32]byte
 
-	invalidRands sync.Map
-
-	senderNonces     map[string]uint32
-	senderNoncesLock sync.Mutex
+	// state tracks the revealed recipientRands and the highest senderNonce received for each of them
+	state RecipientStateStore
 
 	cfg TicketParamsConfig
 
@@ -109,18 +106,25 @@ func NewRecipient(addr ethcommon.Address, broker Broker, val Validator, store Ti
 // secret. In most cases, NewRecipient should be used instead which will
 // automatically generate a random secret
 func NewRecipientWithSecret(addr ethcommon.Address, broker Broker, val Validator, store TicketStore, gpm GasPriceMonitor, sm SenderMonitor, em ErrorMonitor, secret [32]byte, cfg TicketParamsConfig) Recipient {
+	return NewRecipientWithState(addr, broker, val, store, gpm, sm, em, secret, cfg, NewMemoryRecipientStateStore())
+}
+
+// NewRecipientWithState creates an instance of a recipient with a user provided
+// secret that tracks revealed recipientRands and received senderNonces in state.
+// Recipients that share a secret must also share their state
+func NewRecipientWithState(addr ethcommon.Address, broker Broker, val Validator, store TicketStore, gpm GasPriceMonitor, sm SenderMonitor, em ErrorMonitor, secret [32]byte, cfg TicketParamsConfig, state RecipientStateStore) Recipient {
 	return &recipient{
-		broker:       broker,
-		val:          val,
-		store:        store,
-		gpm:          gpm,
-		sm:           sm,
-		em:           em,
-		addr:         addr,
-		secret:       secret,
-		senderNonces: make(map[string]uint32),
-		cfg:          cfg,
-		quit:         make(chan struct{}),
+		broker: broker,
+		val:    val,
+		store:  store,
+		gpm:    gpm,
+		sm:     sm,
+		em:     em,
+		addr:   addr,
+		secret: secret,
+		state:  state,
+		cfg:    cfg,
+		quit:   make(chan struct{}),
 	}
 }
 
@@ -150,7 +154,7 @@ func (r *recipient) ReceiveTicket(ticket *Ticket, sig []byte, seed *big.Int) (st
 		sessionID = ticket.RecipientRandHash.Hex()
 		won = true
 		if err := r.store.StoreWinningTicket(sessionID, ticket, sig, recipientRand); err != nil {
-			glog.Errorf("error storing ticket sender=%x recipientRandHash=%x senderNonce=%v", ticket.Sender, ticket.RecipientRandHash, ticket.SenderNonce)
+			ticketLogger(ticket).Errorf("error storing ticket")
 		}
 	}
 
@@ -278,7 +282,11 @@ func (r *recipient) TxCostMultiplier(sender ethcommon.Address) (*big.Rat, error)
 }
 
 func (r *recipient) acceptTicket(ticket *Ticket, sig []byte, recipientRand *big.Int) error {
-	if !r.validRand(recipientRand) {
+	valid, err := r.state.IsValidRecipientRand(recipientRand)
+	if err != nil {
+		return err
+	}
+	if !valid {
 		// This might be an "acceptable" error.
 		// When a winning ticket is redeemed, the ticket's recipientRand is invalidated
 		// and the sender must send tickets with a new seed, but there could be a delay
@@ -338,7 +346,7 @@ func (r *recipient) redeemWinningTicket(ticket *Ticket, sig []byte, recipientRan
 	// the ticket to be retried later
 	if maxFloat.Cmp(ticket.FaceValue) < 0 {
 		r.sm.QueueTicket(ticket.Sender, &SignedTicket{ticket, sig, recipientRand})
-		glog.Infof("Queued ticket sender=%x recipientRandHash=%x senderNonce=%v", ticket.Sender, ticket.RecipientRandHash, ticket.SenderNonce)
+		ticketLogger(ticket).Infof("Queued ticket")
 		return nil
 	}
 
@@ -358,7 +366,7 @@ func (r *recipient) redeemWinningTicket(ticket *Ticket, sig []byte, recipientRan
 		// the case where the ticket was not redeemd for its full face value
 		// because the reserve was insufficient
 		if err := r.sm.AddFloat(ticket.Sender, ticket.FaceValue); err != nil {
-			glog.Errorf("error updating sender %x max float: %v", ticket.Sender, err)
+			logger.With(clog.Sender, monitor.RedactAddress(ticket.Sender)).Errorf("error updating sender max float: %v", err)
 		}
 	}()
 
@@ -374,12 +382,14 @@ func (r *recipient) redeemWinningTicket(ticket *Ticket, sig []byte, recipientRan
 	}
 
 	// If there is no error, the transaction has been submitted. As a result,
-	// we assume that recipientRand has been revealed so we should invalidate it locally
-	r.updateInvalidRands(recipientRand)
-
-	// After we invalidate recipientRand we can clear the memory used to track
-	// its latest senderNonce
-	r.clearSenderNonce(recipientRand)
+	// we assume that recipientRand has been revealed so we should invalidate it
+	if err := r.state.InvalidateRecipientRand(recipientRand); err != nil {
+		ticketLogger(ticket).Errorf("error invalidating recipientRand: %v", err)
+	} else if err := r.state.ClearRecipientNonce(recipientRand); err != nil {
+		// After we invalidate recipientRand we can clear the state used to track
+		// its latest senderNonce
+		ticketLogger(ticket).Errorf("error clearing senderNonce: %v", err)
+	}
 
 	// Wait for transaction to confirm
 	if err := r.broker.CheckTx(tx); err != nil {
@@ -406,44 +416,25 @@ func (r *recipient) rand(seed *big.Int, sender ethcommon.Address) *big.Int {
 	return new(big.Int).SetBytes(h.Sum(nil))
 }
 
-func (r *recipient) validRand(rand *big.Int) bool {
-	_, ok := r.invalidRands.Load(rand.String())
-	return !ok
-}
-
-func (r *recipient) updateInvalidRands(rand *big.Int) {
-	r.invalidRands.Store(rand.String(), true)
-}
-
 func (r *recipient) updateSenderNonce(rand *big.Int, senderNonce uint32) error {
-	r.senderNoncesLock.Lock()
-	defer r.senderNoncesLock.Unlock()
-
-	randStr := rand.String()
-	nonce, ok := r.senderNonces[randStr]
-	if ok && senderNonce <= nonce {
+	ok, nonce, err := r.state.UpdateRecipientNonce(rand, senderNonce)
+	if err != nil {
+		return err
+	}
+	if !ok {
 		return errors.Errorf("invalid ticket senderNonce %v - highest seen is %v", senderNonce, nonce)
 	}
 
-	r.senderNonces[randStr] = senderNonce
-
 	return nil
 }
 
-func (r *recipient) clearSenderNonce(rand *big.Int) {
-	r.senderNoncesLock.Lock()
-	defer r.senderNoncesLock.Unlock()
-
-	delete(r.senderNonces, rand.String())
-}
-
 func (r *recipient) redeemManager() {
 	// Listen for redeemable tickets that should be retried
 	for {
 		select {
 		case ticket := <-r.sm.Redeemable():
 			if err := r.redeemWinningTicket(ticket.Ticket, ticket.Sig, ticket.RecipientRand); err != nil {
-				glog.Errorf("error retrying ticket sender=%x recipientRandHash=%x senderNonce=%v: %v", ticket.Sender, ticket.RecipientRandHash, ticket.SenderNonce, err)
+				ticketLogger(ticket.Ticket).Errorf("error retrying ticket: %v", err)
 			}
 		case <-r.quit:
 			return
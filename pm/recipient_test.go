@@ -49,6 +49,11 @@ func newRecipientOrFatal(t *testing.T, addr ethcommon.Address, b Broker, v Valid
 	return r
 }
 
+// memState returns the in-memory state of a recipient created with NewRecipient
+func memState(r Recipient) *memoryRecipientState {
+	return r.(*recipient).state.(*memoryRecipientState)
+}
+
 func ticketParamsOrFatal(t *testing.T, r Recipient, sender ethcommon.Address) *TicketParams {
 	params, err := r.TicketParams(sender)
 	if err != nil {
@@ -304,7 +309,7 @@ func TestReceiveTicket_ValidNonWinningTicket(t *testing.T) {
 	}
 
 	recipientRand := genRecipientRand(sender, secret, params.Seed)
-	senderNonce := r.(*recipient).senderNonces[recipientRand.String()]
+	senderNonce := memState(r).senderNonces[recipientRand.String()]
 
 	if senderNonce != newSenderNonce {
 		t.Errorf("expected senderNonce to be %d, got %d", newSenderNonce, senderNonce)
@@ -337,7 +342,7 @@ func TestReceiveTicket_ValidWinningTicket(t *testing.T) {
 	}
 
 	recipientRand := genRecipientRand(sender, secret, params.Seed)
-	senderNonce := r.(*recipient).senderNonces[recipientRand.String()]
+	senderNonce := memState(r).senderNonces[recipientRand.String()]
 
 	if senderNonce != newSenderNonce {
 		t.Errorf("expected senderNonce to be %d, got %d", newSenderNonce, senderNonce)
@@ -398,7 +403,7 @@ func TestReceiveTicket_ValidWinningTicket_StoreError(t *testing.T) {
 	assert.Equal(int64(1), errorLogsAfter-errorLogsBefore)
 
 	recipientRand := genRecipientRand(sender, secret, params.Seed)
-	senderNonce := r.(*recipient).senderNonces[recipientRand.String()]
+	senderNonce := memState(r).senderNonces[recipientRand.String()]
 
 	if senderNonce != newSenderNonce {
 		t.Errorf("expected senderNonce to be %d, got %d", newSenderNonce, senderNonce)
@@ -666,11 +671,11 @@ func TestRedeemWinningTickets_SingleTicket_RedeemError(t *testing.T) {
 
 	recipientRand := genRecipientRand(sender, secret, params.Seed)
 
-	if _, ok := r.(*recipient).invalidRands.Load(recipientRand.String()); ok {
+	if _, ok := memState(r).invalidRands.Load(recipientRand.String()); ok {
 		t.Error("expected not to invalidate recipientRand")
 	}
 
-	if _, ok := r.(*recipient).senderNonces[recipientRand.String()]; !ok {
+	if _, ok := memState(r).senderNonces[recipientRand.String()]; !ok {
 		t.Error("expected not to clear senderNonce memory")
 	}
 }
@@ -737,11 +742,11 @@ func TestRedeemWinningTickets_SingleTicket(t *testing.T) {
 
 	recipientRand := genRecipientRand(sender, secret, params.Seed)
 
-	if _, ok := r.(*recipient).invalidRands.Load(recipientRand.String()); !ok {
+	if _, ok := memState(r).invalidRands.Load(recipientRand.String()); !ok {
 		t.Error("expected to invalidate recipientRand")
 	}
 
-	if _, ok := r.(*recipient).senderNonces[recipientRand.String()]; ok {
+	if _, ok := memState(r).senderNonces[recipientRand.String()]; ok {
 		t.Error("expected to clear senderNonce memory")
 	}
 }
@@ -802,11 +807,11 @@ func TestRedeemWinningTickets_MultipleTickets(t *testing.T) {
 
 	recipientRand := genRecipientRand(sender, secret, params.Seed)
 
-	if _, ok := r.(*recipient).invalidRands.Load(recipientRand.String()); !ok {
+	if _, ok := memState(r).invalidRands.Load(recipientRand.String()); !ok {
 		t.Error("expected to invalidate recipientRand")
 	}
 
-	if _, ok := r.(*recipient).senderNonces[recipientRand.String()]; ok {
+	if _, ok := memState(r).senderNonces[recipientRand.String()]; ok {
 		t.Error("expected to clear senderNonce memory")
 	}
 }
@@ -847,14 +852,14 @@ func TestRedeemWinningTickets_MultipleTicketsFromMultipleSessions(t *testing.T)
 	recipientRand0 := genRecipientRand(sender, secret, params0.Seed)
 	recipientRand1 := genRecipientRand(sender, secret, params1.Seed)
 
-	_, ok := r.(*recipient).invalidRands.Load(recipientRand0.String())
+	_, ok := memState(r).invalidRands.Load(recipientRand0.String())
 	assert.True(ok)
-	_, ok = r.(*recipient).invalidRands.Load(recipientRand1.String())
+	_, ok = memState(r).invalidRands.Load(recipientRand1.String())
 	assert.True(ok)
 
-	_, ok = r.(*recipient).senderNonces[recipientRand0.String()]
+	_, ok = memState(r).senderNonces[recipientRand0.String()]
 	assert.False(ok)
-	_, ok = r.(*recipient).senderNonces[recipientRand1.String()]
+	_, ok = memState(r).senderNonces[recipientRand1.String()]
 	assert.False(ok)
 }
 
@@ -923,10 +928,10 @@ func TestRedeemWinningTicket_AddFloatError(t *testing.T) {
 
 	recipientRand := genRecipientRand(sender, secret, params.Seed)
 
-	_, ok := r.(*recipient).invalidRands.Load(recipientRand.String())
+	_, ok := memState(r).invalidRands.Load(recipientRand.String())
 	assert.True(ok)
 
-	_, ok = r.(*recipient).senderNonces[recipientRand.String()]
+	_, ok = memState(r).senderNonces[recipientRand.String()]
 	assert.False(ok)
 }
 
@@ -960,10 +965,10 @@ func TestRedeemWinningTicket(t *testing.T) {
 
 	recipientRand := genRecipientRand(sender, secret, params.Seed)
 
-	_, ok := r.(*recipient).invalidRands.Load(recipientRand.String())
+	_, ok := memState(r).invalidRands.Load(recipientRand.String())
 	assert.True(ok)
 
-	_, ok = r.(*recipient).senderNonces[recipientRand.String()]
+	_, ok = memState(r).senderNonces[recipientRand.String()]
 	assert.False(ok)
 }
 
@@ -999,10 +1004,10 @@ func TestRedeemManager_Error(t *testing.T) {
 	require.Nil(err)
 	assert.False(used)
 
-	_, ok := r.(*recipient).invalidRands.Load(recipientRand.String())
+	_, ok := memState(r).invalidRands.Load(recipientRand.String())
 	assert.False(ok)
 
-	_, ok = r.(*recipient).senderNonces[recipientRand.String()]
+	_, ok = memState(r).senderNonces[recipientRand.String()]
 	assert.True(ok)
 }
 
@@ -1037,12 +1042,12 @@ func TestRedeemManager(t *testing.T) {
 	require.Nil(err)
 	assert.True(used)
 
-	_, ok := r.(*recipient).invalidRands.Load(recipientRand.String())
+	_, ok := memState(r).invalidRands.Load(recipientRand.String())
 	assert.True(ok)
 
-	r.(*recipient).senderNoncesLock.Lock()
-	_, ok = r.(*recipient).senderNonces[recipientRand.String()]
-	r.(*recipient).senderNoncesLock.Unlock()
+	memState(r).senderNoncesLock.Lock()
+	_, ok = memState(r).senderNonces[recipientRand.String()]
+	memState(r).senderNoncesLock.Unlock()
 	assert.False(ok)
 }
 
@@ -1226,3 +1231,36 @@ func TestTxCostMultiplier_InsufficientReserve_ReturnsError(t *testing.T) {
 	assert.Nil(t, mul)
 	assert.EqualError(t, err, errInsufficientSenderReserve.Error())
 }
+
+func TestReceiveTicket_SharedState(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	sender, b, v, ts, gm, sm, em, cfg, sig := newRecipientFixtureOrFatal(t)
+	addr := RandAddress()
+	secret := [32]byte{3}
+	state := NewMemoryRecipientStateStore()
+	r0 := NewRecipientWithState(addr, b, v, ts, gm, sm, em, secret, cfg, state)
+	r1 := NewRecipientWithState(addr, b, v, ts, gm, sm, em, secret, cfg, state)
+
+	// Ticket params of one recipient are accepted by the other
+	params, err := r0.TicketParams(sender)
+	require.Nil(err)
+	_, _, err = r1.ReceiveTicket(newTicket(sender, params, 1), sig, params.Seed)
+	assert.Nil(err)
+
+	// A senderNonce received by one recipient can't be reused with the other
+	_, _, err = r0.ReceiveTicket(newTicket(sender, params, 1), sig, params.Seed)
+	assert.EqualError(err, "invalid ticket senderNonce 1 - highest seen is 1")
+	_, _, err = r0.ReceiveTicket(newTicket(sender, params, 2), sig, params.Seed)
+	assert.Nil(err)
+
+	// A recipientRand revealed by one recipient is invalid for the other
+	v.SetIsWinningTicket(true)
+	ticket := newTicket(sender, params, 3)
+	_, _, err = r1.ReceiveTicket(ticket, sig, params.Seed)
+	require.Nil(err)
+	require.Nil(r1.RedeemWinningTicket(ticket, sig, params.Seed))
+	_, _, err = r0.ReceiveTicket(newTicket(sender, params, 4), sig, params.Seed)
+	assert.Contains(err.Error(), "invalid already revealed recipientRand")
+}
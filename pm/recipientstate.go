@@ -0,0 +1,73 @@
+package pm
+
+import (
+	"math/big"
+	"sync"
+)
+
+// RecipientStateStore is an interface which describes an object capable of
+// tracking the recipientRands revealed by a recipient and the highest senderNonce
+// received for each recipientRand. Recipients that share an identity and a secret,
+// such as orchestrator frontends in multiple regions, must share this state so that
+// a ticket can't be accepted by more than one of them
+type RecipientStateStore interface {
+	// UpdateRecipientNonce records senderNonce as the highest senderNonce received for recipientRand.
+	// If senderNonce is not higher than the highest one already received, nothing is recorded and
+	// false is returned along with the highest senderNonce
+	UpdateRecipientNonce(recipientRand *big.Int, senderNonce uint32) (bool, uint32, error)
+
+	// ClearRecipientNonce removes the senderNonce recorded for recipientRand
+	ClearRecipientNonce(recipientRand *big.Int) error
+
+	// InvalidateRecipientRand marks recipientRand as revealed
+	InvalidateRecipientRand(recipientRand *big.Int) error
+
+	// IsValidRecipientRand returns whether recipientRand has not been revealed
+	IsValidRecipientRand(recipientRand *big.Int) (bool, error)
+}
+
+// memoryRecipientState is a RecipientStateStore that keeps the state of a single recipient in memory
+type memoryRecipientState struct {
+	invalidRands sync.Map
+
+	senderNonces     map[string]uint32
+	senderNoncesLock sync.Mutex
+}
+
+// NewMemoryRecipientStateStore creates a RecipientStateStore that is only tracked in memory
+func NewMemoryRecipientStateStore() RecipientStateStore {
+	return &memoryRecipientState{senderNonces: make(map[string]uint32)}
+}
+
+func (s *memoryRecipientState) UpdateRecipientNonce(rand *big.Int, senderNonce uint32) (bool, uint32, error) {
+	s.senderNoncesLock.Lock()
+	defer s.senderNoncesLock.Unlock()
+
+	randStr := rand.String()
+	nonce, ok := s.senderNonces[randStr]
+	if ok && senderNonce <= nonce {
+		return false, nonce, nil
+	}
+
+	s.senderNonces[randStr] = senderNonce
+
+	return true, senderNonce, nil
+}
+
+func (s *memoryRecipientState) ClearRecipientNonce(rand *big.Int) error {
+	s.senderNoncesLock.Lock()
+	defer s.senderNoncesLock.Unlock()
+
+	delete(s.senderNonces, rand.String())
+	return nil
+}
+
+func (s *memoryRecipientState) InvalidateRecipientRand(rand *big.Int) error {
+	s.invalidRands.Store(rand.String(), true)
+	return nil
+}
+
+func (s *memoryRecipientState) IsValidRecipientRand(rand *big.Int) (bool, error) {
+	_, ok := s.invalidRands.Load(rand.String())
+	return !ok, nil
+}
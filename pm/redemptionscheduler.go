@@ -0,0 +1,237 @@
+package pm
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// DefaultTicketValidityPeriod is the number of rounds, starting with its creation round,
+// in which a ticket can be redeemed
+const DefaultTicketValidityPeriod = 2
+
+// DefaultRedemptionPollInterval is how often deferred redemptions are checked by default
+const DefaultRedemptionPollInterval = 1 * time.Minute
+
+// RedemptionPolicy determines when the winning tickets received by a recipient are redeemed
+type RedemptionPolicy int
+
+const (
+	// RedeemImmediately redeems winning tickets as soon as they are received
+	RedeemImmediately RedemptionPolicy = iota
+	// RedeemAtRoundBoundary defers the redemption of winning tickets until the round after
+	// their creation round is initialized so that they are redeemed together
+	RedeemAtRoundBoundary
+	// RedeemInGasWindow defers the redemption of winning tickets until the gas price
+	// is at or below the configured maximum
+	RedeemInGasWindow
+)
+
+// String returns the name of a RedemptionPolicy
+func (p RedemptionPolicy) String() string {
+	switch p {
+	case RedeemImmediately:
+		return "immediate"
+	case RedeemAtRoundBoundary:
+		return "roundBoundary"
+	case RedeemInGasWindow:
+		return "gasWindow"
+	}
+	return "unknown"
+}
+
+// ParseRedemptionPolicy returns the RedemptionPolicy for a name
+func ParseRedemptionPolicy(name string) (RedemptionPolicy, error) {
+	switch name {
+	case "immediate":
+		return RedeemImmediately, nil
+	case "roundBoundary":
+		return RedeemAtRoundBoundary, nil
+	case "gasWindow":
+		return RedeemInGasWindow, nil
+	}
+	return RedeemImmediately, fmt.Errorf("unknown redemption policy %v", name)
+}
+
+// RedemptionScheduleConfig contains config information for scheduling the redemption of winning tickets
+type RedemptionScheduleConfig struct {
+	Policy RedemptionPolicy
+
+	// MaxGasPrice is the highest gas price at which deferred tickets
+	// are redeemed under the RedeemInGasWindow policy
+	MaxGasPrice *big.Int
+
+	// ValidityPeriod is the number of rounds, starting with its creation round,
+	// in which a ticket can be redeemed. Deferred tickets are always redeemed
+	// in the last round of their validity period
+	ValidityPeriod int64
+
+	// RedemptionBuffer is the number of rounds before the last round of their validity period
+	// in which deferred tickets are redeemed at the latest
+	RedemptionBuffer int64
+
+	// PollInterval is how often deferred tickets are checked for redemption
+	PollInterval time.Duration
+}
+
+// Validate checks that the config can be used for scheduling redemptions
+func (cfg RedemptionScheduleConfig) Validate() error {
+	if cfg.Policy == RedeemImmediately {
+		return nil
+	}
+	if err := cfg.expiration().Validate(); err != nil {
+		return err
+	}
+	if cfg.PollInterval <= 0 {
+		return fmt.Errorf("redemption poll interval must be greater than 0")
+	}
+	if cfg.Policy == RedeemInGasWindow && (cfg.MaxGasPrice == nil || cfg.MaxGasPrice.Sign() <= 0) {
+		return fmt.Errorf("max gas price must be greater than 0 for the %v redemption policy", cfg.Policy)
+	}
+	return nil
+}
+
+// expiration returns the expiration policy that deferred tickets are redeemed with
+func (cfg RedemptionScheduleConfig) expiration() TicketExpirationPolicy {
+	return TicketExpirationPolicy{ValidityPeriod: cfg.ValidityPeriod, RedemptionBuffer: cfg.RedemptionBuffer}
+}
+
+// deferredTicket is a winning ticket with the parameters required to redeem it
+type deferredTicket struct {
+	*Ticket
+
+	sig  []byte
+	seed *big.Int
+}
+
+// schedulingRecipient is a Recipient that defers the redemption of winning tickets
+// according to a RedemptionScheduleConfig. Deferred tickets are only held in memory,
+// but winning tickets are persisted when they are received so that they can still be
+// redeemed with RedeemWinningTickets if the node stops before they are due
+type schedulingRecipient struct {
+	Recipient
+
+	rm  RoundsManager
+	gpm GasPriceMonitor
+	cfg RedemptionScheduleConfig
+
+	mu      sync.Mutex
+	pending []*deferredTicket
+
+	quit chan struct{}
+}
+
+// NewSchedulingRecipient wraps a recipient so that the redemption of its winning tickets
+// is deferred according to cfg
+func NewSchedulingRecipient(r Recipient, rm RoundsManager, gpm GasPriceMonitor, cfg RedemptionScheduleConfig) Recipient {
+	return &schedulingRecipient{
+		Recipient: r,
+		rm:        rm,
+		gpm:       gpm,
+		cfg:       cfg,
+		quit:      make(chan struct{}),
+	}
+}
+
+// Start initiates the helper goroutines for the recipient
+func (r *schedulingRecipient) Start() {
+	r.Recipient.Start()
+	if r.cfg.Policy != RedeemImmediately {
+		go r.scheduleLoop()
+	}
+}
+
+// Stop signals the recipient to exit gracefully
+func (r *schedulingRecipient) Stop() {
+	close(r.quit)
+
+	r.mu.Lock()
+	if len(r.pending) > 0 {
+		glog.Warningf("Stopping with %v deferred winning tickets that are not redeemed yet", len(r.pending))
+	}
+	r.mu.Unlock()
+
+	r.Recipient.Stop()
+}
+
+// RedeemWinningTicket defers the redemption of a winning ticket unless the policy is RedeemImmediately
+func (r *schedulingRecipient) RedeemWinningTicket(ticket *Ticket, sig []byte, seed *big.Int) error {
+	if r.cfg.Policy == RedeemImmediately {
+		return r.Recipient.RedeemWinningTicket(ticket, sig, seed)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending = append(r.pending, &deferredTicket{ticket, sig, seed})
+	ticketLogger(ticket).Infof("Deferred ticket redemption policy=%v", r.cfg.Policy)
+
+	return nil
+}
+
+func (r *schedulingRecipient) scheduleLoop() {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.redeemDue()
+		case <-r.quit:
+			return
+		}
+	}
+}
+
+// redeemDue redeems the deferred tickets that are due
+func (r *schedulingRecipient) redeemDue() {
+	for _, ticket := range r.takeDue() {
+		go func(ticket *deferredTicket) {
+			if err := r.Recipient.RedeemWinningTicket(ticket.Ticket, ticket.sig, ticket.seed); err != nil {
+				ticketLogger(ticket.Ticket).Errorf("error redeeming deferred ticket: %v", err)
+			}
+		}(ticket)
+	}
+}
+
+// takeDue removes the deferred tickets that are due from the pending tickets and returns them
+func (r *schedulingRecipient) takeDue() []*deferredTicket {
+	round := r.rm.LastInitializedRound()
+	if round == nil {
+		return nil
+	}
+	gasPrice := r.gpm.GasPrice()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var due, pending []*deferredTicket
+	for _, ticket := range r.pending {
+		if r.due(ticket.Ticket, round, gasPrice) {
+			due = append(due, ticket)
+		} else {
+			pending = append(pending, ticket)
+		}
+	}
+	r.pending = pending
+
+	return due
+}
+
+// due returns whether a deferred ticket should be redeemed given the last initialized round and the current gas price
+func (r *schedulingRecipient) due(ticket *Ticket, round *big.Int, gasPrice *big.Int) bool {
+	// Never defer a ticket beyond the last round of its validity period before the redemption buffer
+	lastRound := big.NewInt(r.cfg.expiration().LastRedemptionRound(ticket.CreationRound))
+	if round.Cmp(lastRound) >= 0 {
+		return true
+	}
+
+	switch r.cfg.Policy {
+	case RedeemAtRoundBoundary:
+		return round.Cmp(big.NewInt(ticket.CreationRound)) > 0
+	case RedeemInGasWindow:
+		return gasPrice != nil && gasPrice.Cmp(r.cfg.MaxGasPrice) <= 0
+	}
+	return true
+}
@@ -0,0 +1,192 @@
+package pm
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestParseRedemptionPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, p := range []RedemptionPolicy{RedeemImmediately, RedeemAtRoundBoundary, RedeemInGasWindow} {
+		policy, err := ParseRedemptionPolicy(p.String())
+		assert.Nil(err)
+		assert.Equal(p, policy)
+	}
+
+	_, err := ParseRedemptionPolicy("foo")
+	assert.EqualError(err, "unknown redemption policy foo")
+}
+
+func TestRedemptionScheduleConfig_Validate(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg := RedemptionScheduleConfig{Policy: RedeemImmediately}
+	assert.Nil(cfg.Validate())
+
+	cfg = RedemptionScheduleConfig{Policy: RedeemAtRoundBoundary, PollInterval: time.Minute}
+	assert.EqualError(cfg.Validate(), "ticket validity period must be greater than 0")
+
+	cfg.ValidityPeriod = DefaultTicketValidityPeriod
+	cfg.PollInterval = 0
+	assert.EqualError(cfg.Validate(), "redemption poll interval must be greater than 0")
+
+	cfg.PollInterval = time.Minute
+	assert.Nil(cfg.Validate())
+
+	cfg.RedemptionBuffer = DefaultTicketValidityPeriod
+	assert.EqualError(cfg.Validate(), "ticket redemption buffer must be between 0 and 1 rounds")
+
+	cfg.RedemptionBuffer = 1
+	assert.Nil(cfg.Validate())
+
+	cfg.Policy = RedeemInGasWindow
+	assert.EqualError(cfg.Validate(), "max gas price must be greater than 0 for the gasWindow redemption policy")
+
+	cfg.MaxGasPrice = big.NewInt(10)
+	assert.Nil(cfg.Validate())
+}
+
+func TestSchedulingRecipient_RedeemImmediately(t *testing.T) {
+	r := &MockRecipient{}
+	rm := &stubRoundsManager{round: big.NewInt(5)}
+	gpm := &stubGasPriceMonitor{gasPrice: big.NewInt(100)}
+	sr := NewSchedulingRecipient(r, rm, gpm, RedemptionScheduleConfig{Policy: RedeemImmediately})
+
+	ticket := &Ticket{CreationRound: 5}
+	sig := []byte("foo")
+	seed := big.NewInt(7)
+	r.On("RedeemWinningTicket", ticket, sig, seed).Return(nil)
+
+	assert.Nil(t, sr.RedeemWinningTicket(ticket, sig, seed))
+	r.AssertCalled(t, "RedeemWinningTicket", ticket, sig, seed)
+}
+
+func TestSchedulingRecipient_RoundBoundary(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &MockRecipient{}
+	rm := &stubRoundsManager{round: big.NewInt(5)}
+	gpm := &stubGasPriceMonitor{gasPrice: big.NewInt(100)}
+	cfg := RedemptionScheduleConfig{
+		Policy:         RedeemAtRoundBoundary,
+		ValidityPeriod: 3,
+		PollInterval:   time.Minute,
+	}
+	sr := NewSchedulingRecipient(r, rm, gpm, cfg).(*schedulingRecipient)
+
+	ticket := &Ticket{CreationRound: 5}
+	sig := []byte("foo")
+	seed := big.NewInt(7)
+
+	// The redemption is deferred
+	assert.Nil(sr.RedeemWinningTicket(ticket, sig, seed))
+	r.AssertNotCalled(t, "RedeemWinningTicket", mock.Anything, mock.Anything, mock.Anything)
+
+	// The ticket is not due until the next round is initialized
+	assert.Empty(sr.takeDue())
+
+	rm.round = big.NewInt(6)
+	due := sr.takeDue()
+	if assert.Len(due, 1) {
+		assert.Equal(ticket, due[0].Ticket)
+		assert.Equal(sig, due[0].sig)
+		assert.Equal(seed, due[0].seed)
+	}
+	assert.Empty(sr.takeDue())
+
+	// Tickets are not due without a last initialized round
+	assert.Nil(sr.RedeemWinningTicket(ticket, sig, seed))
+	rm.round = nil
+	assert.Empty(sr.takeDue())
+}
+
+func TestSchedulingRecipient_GasWindow(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &MockRecipient{}
+	rm := &stubRoundsManager{round: big.NewInt(5)}
+	gpm := &stubGasPriceMonitor{gasPrice: big.NewInt(100)}
+	cfg := RedemptionScheduleConfig{
+		Policy:         RedeemInGasWindow,
+		MaxGasPrice:    big.NewInt(50),
+		ValidityPeriod: 3,
+		PollInterval:   time.Minute,
+	}
+	sr := NewSchedulingRecipient(r, rm, gpm, cfg).(*schedulingRecipient)
+
+	assert.Nil(sr.RedeemWinningTicket(&Ticket{CreationRound: 5}, []byte("foo"), big.NewInt(7)))
+
+	// The ticket is not due while the gas price is too high
+	assert.Empty(sr.takeDue())
+	rm.round = big.NewInt(6)
+	assert.Empty(sr.takeDue())
+
+	// The ticket is due when the gas price is low enough
+	gpm.gasPrice = big.NewInt(50)
+	assert.Len(sr.takeDue(), 1)
+
+	// The ticket is due in the last round of its validity period regardless of the gas price
+	gpm.gasPrice = big.NewInt(100)
+	assert.Nil(sr.RedeemWinningTicket(&Ticket{CreationRound: 5}, []byte("foo"), big.NewInt(7)))
+	assert.Empty(sr.takeDue())
+	rm.round = big.NewInt(7)
+	assert.Len(sr.takeDue(), 1)
+}
+
+func TestSchedulingRecipient_RedemptionBuffer(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &MockRecipient{}
+	rm := &stubRoundsManager{round: big.NewInt(5)}
+	gpm := &stubGasPriceMonitor{gasPrice: big.NewInt(100)}
+	cfg := RedemptionScheduleConfig{
+		Policy:           RedeemInGasWindow,
+		MaxGasPrice:      big.NewInt(50),
+		ValidityPeriod:   3,
+		RedemptionBuffer: 1,
+		PollInterval:     time.Minute,
+	}
+	sr := NewSchedulingRecipient(r, rm, gpm, cfg).(*schedulingRecipient)
+
+	assert.Nil(sr.RedeemWinningTicket(&Ticket{CreationRound: 5}, []byte("foo"), big.NewInt(7)))
+	assert.Empty(sr.takeDue())
+
+	// The ticket is due a round before the last round of its validity period regardless of the gas price
+	rm.round = big.NewInt(6)
+	assert.Len(sr.takeDue(), 1)
+}
+
+func TestSchedulingRecipient_RedeemDue(t *testing.T) {
+	r := &MockRecipient{}
+	rm := &stubRoundsManager{round: big.NewInt(5)}
+	gpm := &stubGasPriceMonitor{gasPrice: big.NewInt(100)}
+	cfg := RedemptionScheduleConfig{
+		Policy:         RedeemAtRoundBoundary,
+		ValidityPeriod: DefaultTicketValidityPeriod,
+		PollInterval:   time.Minute,
+	}
+	sr := NewSchedulingRecipient(r, rm, gpm, cfg).(*schedulingRecipient)
+
+	ticket := &Ticket{CreationRound: 5}
+	sig := []byte("foo")
+	seed := big.NewInt(7)
+	redeemed := make(chan struct{})
+	r.On("RedeemWinningTicket", ticket, sig, seed).Return(nil).Run(func(args mock.Arguments) {
+		close(redeemed)
+	})
+
+	assert.Nil(t, sr.RedeemWinningTicket(ticket, sig, seed))
+	rm.round = big.NewInt(6)
+	sr.redeemDue()
+
+	select {
+	case <-redeemed:
+	case <-time.After(time.Second):
+		t.Fatal("deferred ticket was not redeemed")
+	}
+}
@@ -3,8 +3,8 @@ package pm
 import (
 	"math/big"
 	"sync"
-	"sync/atomic"
 
+	"github.com/golang/glog"
 	"github.com/pkg/errors"
 )
 
@@ -12,9 +12,14 @@ import (
 // and create tickets that adhere to each session's params and unique nonce requirements.
 type Sender interface {
 	// StartSession creates a session for a given set of ticket params which tracks information
-	// for creating new tickets
+	// for creating new tickets. If the session was previously started, either by this instance or
+	// before a restart, its senderNonce sequence is resumed
 	StartSession(ticketParams TicketParams) string
 
+	// ResumeSession restores a session from its persisted state so that tickets can be
+	// created for it without requesting new ticket params from the recipient
+	ResumeSession(sessionID string) error
+
 	// CreateTicketBatch returns a ticket batch of the specified size
 	CreateTicketBatch(sessionID string, size int) (*TicketBatch, error)
 
@@ -26,9 +31,20 @@ type Sender interface {
 }
 
 type session struct {
+	mu sync.Mutex
+
 	senderNonce uint32
 
 	ticketParams TicketParams
+
+	// Set once the persisted senderNonce of the session is loaded. No tickets are created for the
+	// session before, since the senderNonces that were used before a restart are unknown
+	nonceLoaded bool
+
+	// Cumulative state persisted for session resumption
+	expirationParams *TicketExpirationParams
+	ticketsSent      int64
+	evSent           *big.Rat
 }
 
 type sender struct {
@@ -39,31 +55,105 @@ type sender struct {
 	maxEV             *big.Rat
 	depositMultiplier int
 
+	// store persists used senderNonces and session state. If nil, sessions are only tracked in memory
+	store SenderStore
+
 	sessions sync.Map
 }
 
-// NewSender creates a new Sender instance.
-func NewSender(signer Signer, roundsManager RoundsManager, senderManager SenderManager, maxEV *big.Rat, depositMultiplier int) Sender {
+// NewSender creates a new Sender instance. store may be nil
+func NewSender(signer Signer, roundsManager RoundsManager, senderManager SenderManager, maxEV *big.Rat, depositMultiplier int, store SenderStore) Sender {
 	return &sender{
 		signer:            signer,
 		roundsManager:     roundsManager,
 		senderManager:     senderManager,
 		maxEV:             maxEV,
 		depositMultiplier: depositMultiplier,
+		store:             store,
 	}
 }
 
 func (s *sender) StartSession(ticketParams TicketParams) string {
 	sessionID := ticketParams.RecipientRandHash.Hex()
 
-	s.sessions.Store(sessionID, &session{
+	senderNonce, err := s.loadSenderNonce(sessionID)
+	if err != nil {
+		// The senderNonce is loaded again before tickets are created for the session
+		glog.Errorf("Error loading senderNonce for session %v: %v", sessionID, err)
+	}
+
+	newSession := &session{
 		ticketParams: ticketParams,
-		senderNonce:  0,
-	})
+		senderNonce:  senderNonce,
+		nonceLoaded:  err == nil,
+		evSent:       big.NewRat(0, 1),
+	}
+	sess := newSession
+	if existing, loaded := s.sessions.LoadOrStore(sessionID, newSession); loaded {
+		// Update the existing session in place so that its senderNonce sequence and cumulative
+		// state are resumed and the senderNonces reserved by concurrent ticket batches are never reused
+		sess = existing.(*session)
+		sess.mu.Lock()
+		sess.ticketParams = ticketParams
+		if err == nil {
+			if senderNonce > sess.senderNonce {
+				sess.senderNonce = senderNonce
+			}
+			sess.nonceLoaded = true
+		}
+		sess.mu.Unlock()
+	}
+
+	s.storeSession(sessionID, sess)
 
 	return sessionID
 }
 
+// ResumeSession restores a session from its persisted state
+func (s *sender) ResumeSession(sessionID string) error {
+	if _, ok := s.sessions.Load(sessionID); ok {
+		return nil
+	}
+
+	if s.store == nil {
+		return errors.Errorf("cannot resume session without a store: %v", sessionID)
+	}
+
+	state, err := s.store.LoadSenderSession(sessionID)
+	if err != nil {
+		return errors.Wrapf(err, "error loading state for session: %v", sessionID)
+	}
+	if state == nil {
+		return errors.Errorf("no persisted state for session: %v", sessionID)
+	}
+
+	senderNonce, err := s.loadSenderNonce(sessionID)
+	if err != nil {
+		return errors.Wrapf(err, "error loading senderNonce for session: %v", sessionID)
+	}
+	if state.SenderNonce > senderNonce {
+		senderNonce = state.SenderNonce
+	}
+
+	evSent := big.NewRat(0, 1)
+	if state.EVSent != nil {
+		evSent.Set(state.EVSent)
+	}
+
+	s.sessions.LoadOrStore(sessionID, &session{
+		ticketParams:     state.TicketParams,
+		senderNonce:      senderNonce,
+		nonceLoaded:      true,
+		expirationParams: state.ExpirationParams,
+		ticketsSent:      state.TicketsSent,
+		evSent:           evSent,
+	})
+
+	glog.Infof("Resumed PM session %v senderNonce=%v ticketsSent=%v", sessionID, senderNonce, state.TicketsSent)
+
+	return nil
+}
+
 // EV returns the ticket EV for a session
 func (s *sender) EV(sessionID string) (*big.Rat, error) {
 	session, err := s.loadSession(sessionID)
@@ -71,6 +161,9 @@ func (s *sender) EV(sessionID string) (*big.Rat, error) {
 		return nil, err
 	}
 
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
 	return ticketEV(session.ticketParams.FaceValue, session.ticketParams.WinProb), nil
 }
 
@@ -81,21 +174,22 @@ func (s *sender) CreateTicketBatch(sessionID string, size int) (*TicketBatch, er
 		return nil, err
 	}
 
-	if err := s.validateTicketParams(&session.ticketParams, size); err != nil {
+	lastNonce, ticketParams, err := s.reserveSenderNonces(sessionID, session, size)
+	if err != nil {
 		return nil, err
 	}
 
 	expirationParams := s.expirationParams()
 
 	batch := &TicketBatch{
-		TicketParams:           &session.ticketParams,
+		TicketParams:           ticketParams,
 		TicketExpirationParams: expirationParams,
 		Sender:                 s.signer.Account().Address,
 	}
 
 	for i := 0; i < size; i++ {
-		senderNonce := atomic.AddUint32(&session.senderNonce, 1)
-		ticket := NewTicket(&session.ticketParams, expirationParams, s.signer.Account().Address, senderNonce)
+		senderNonce := lastNonce - uint32(size) + uint32(i) + 1
+		ticket := NewTicket(ticketParams, expirationParams, s.signer.Account().Address, senderNonce)
 		sig, err := s.signer.Sign(ticket.Hash().Bytes())
 		if err != nil {
 			return nil, errors.Wrapf(err, "error signing ticket for session: %v", sessionID)
@@ -104,6 +198,15 @@ func (s *sender) CreateTicketBatch(sessionID string, size int) (*TicketBatch, er
 		batch.SenderParams = append(batch.SenderParams, &TicketSenderParams{SenderNonce: senderNonce, Sig: sig})
 	}
 
+	ev := ticketEV(ticketParams.FaceValue, ticketParams.WinProb)
+	session.mu.Lock()
+	session.expirationParams = expirationParams
+	session.ticketsSent += int64(size)
+	session.evSent.Add(session.evSent, ev.Mul(ev, new(big.Rat).SetInt64(int64(size))))
+	session.mu.Unlock()
+
+	s.storeSession(sessionID, session)
+
 	return batch, nil
 }
 
@@ -135,6 +238,48 @@ func (s *sender) validateTicketParams(ticketParams *TicketParams, numTickets int
 	return nil
 }
 
+// reserveSenderNonces reserves the senderNonces for a batch of tickets and returns the highest one
+// along with the ticket params of the session. The highest senderNonce is persisted before any
+// ticket is signed so that a restart can never reuse them
+func (s *sender) reserveSenderNonces(sessionID string, session *session, size int) (uint32, *TicketParams, error) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	ticketParams := session.ticketParams
+	if err := s.validateTicketParams(&ticketParams, size); err != nil {
+		return 0, nil, err
+	}
+
+	if !session.nonceLoaded {
+		nonce, err := s.loadSenderNonce(sessionID)
+		if err != nil {
+			return 0, nil, errors.Wrapf(err, "error loading senderNonce for session: %v", sessionID)
+		}
+		if nonce > session.senderNonce {
+			session.senderNonce = nonce
+		}
+		session.nonceLoaded = true
+	}
+
+	lastNonce := session.senderNonce + uint32(size)
+	if s.store != nil {
+		if err := s.store.StoreSenderNonce(sessionID, lastNonce); err != nil {
+			return 0, nil, errors.Wrapf(err, "error storing senderNonce for session: %v", sessionID)
+		}
+	}
+	session.senderNonce = lastNonce
+
+	return lastNonce, &ticketParams, nil
+}
+
+// loadSenderNonce returns the persisted senderNonce for a session or 0 if there is none
+func (s *sender) loadSenderNonce(sessionID string) (uint32, error) {
+	if s.store == nil {
+		return 0, nil
+	}
+	return s.store.LoadSenderNonce(sessionID)
+}
+
 func (s *sender) expirationParams() *TicketExpirationParams {
 	round := s.roundsManager.LastInitializedRound()
 	blkHash := s.roundsManager.LastInitializedBlockHash()
@@ -145,6 +290,28 @@ func (s *sender) expirationParams() *TicketExpirationParams {
 	}
 }
 
+// storeSession persists the state of a session. Errors are only logged because the
+// senderNonces of the session are persisted separately before tickets are created
+func (s *sender) storeSession(sessionID string, session *session) {
+	if s.store == nil {
+		return
+	}
+
+	session.mu.Lock()
+	state := &SenderSessionState{
+		TicketParams:     session.ticketParams,
+		ExpirationParams: session.expirationParams,
+		SenderNonce:      session.senderNonce,
+		TicketsSent:      session.ticketsSent,
+		EVSent:           new(big.Rat).Set(session.evSent),
+	}
+	session.mu.Unlock()
+
+	if err := s.store.StoreSenderSession(sessionID, state); err != nil {
+		glog.Errorf("Error storing state for session %v: %v", sessionID, err)
+	}
+}
+
 func (s *sender) loadSession(sessionID string) (*session, error) {
 	tempSession, ok := s.sessions.Load(sessionID)
 	if !ok {
@@ -409,6 +409,180 @@ func TestValidateTicketParams_AcceptableParams_NoError(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestStartSession_GivenExistingSession_ResumesSenderNonce(t *testing.T) {
+	sender := defaultSender(t)
+	ticketParams := defaultTicketParams(t, RandAddress())
+
+	sessionID := sender.StartSession(ticketParams)
+	_, err := sender.CreateTicketBatch(sessionID, 2)
+	require.Nil(t, err)
+
+	// Restarting the same session in memory should not reset the senderNonce
+	sessionID = sender.StartSession(ticketParams)
+	batch, err := sender.CreateTicketBatch(sessionID, 1)
+	require.Nil(t, err)
+	assert.Equal(t, uint32(3), batch.SenderParams[0].SenderNonce)
+}
+
+func TestStartSession_GivenConcurrentTicketBatches_DoesNotReuseSenderNonces(t *testing.T) {
+	sender := defaultSender(t)
+	ticketParams := defaultTicketParams(t, RandAddress())
+	sessionID := sender.StartSession(ticketParams)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	nonces := make(map[uint32]bool)
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			batch, err := sender.CreateTicketBatch(sessionID, 2)
+			require.Nil(t, err)
+			mu.Lock()
+			defer mu.Unlock()
+			for _, p := range batch.SenderParams {
+				assert.False(t, nonces[p.SenderNonce])
+				nonces[p.SenderNonce] = true
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			sender.StartSession(ticketParams)
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, nonces, 20)
+}
+
+func TestCreateTicketBatch_GivenNonceStore_ResumesAfterRestart(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ns := newStubSenderStore()
+	sender := defaultSender(t)
+	sender.store = ns
+	ticketParams := defaultTicketParams(t, RandAddress())
+
+	sessionID := sender.StartSession(ticketParams)
+	_, err := sender.CreateTicketBatch(sessionID, 3)
+	require.Nil(err)
+	assert.Equal(uint32(3), ns.nonces[sessionID])
+
+	// Simulate a restart with a fresh sender using the same store
+	restarted := defaultSender(t)
+	restarted.store = ns
+	sessionID = restarted.StartSession(ticketParams)
+	batch, err := restarted.CreateTicketBatch(sessionID, 2)
+	require.Nil(err)
+	assert.Equal(uint32(4), batch.SenderParams[0].SenderNonce)
+	assert.Equal(uint32(5), batch.SenderParams[1].SenderNonce)
+	assert.Equal(uint32(5), ns.nonces[sessionID])
+}
+
+func TestCreateTicketBatch_NonceLoadError_NoTicketsUntilLoaded(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ns := newStubSenderStore()
+	ticketParams := defaultTicketParams(t, RandAddress())
+	sessionID := ticketParams.RecipientRandHash.Hex()
+	ns.nonces[sessionID] = 3
+
+	// The senderNonces that were used before the restart are unknown
+	ns.loadShouldFail = true
+	sender := defaultSender(t)
+	sender.store = ns
+	sessionID = sender.StartSession(ticketParams)
+	_, err := sender.CreateTicketBatch(sessionID, 1)
+	assert.Contains(err.Error(), "stub sender store load error")
+	assert.Equal(uint32(3), ns.nonces[sessionID])
+
+	// Tickets are created once the senderNonce is loaded, without reusing the persisted ones
+	ns.loadShouldFail = false
+	batch, err := sender.CreateTicketBatch(sessionID, 1)
+	require.Nil(err)
+	assert.Equal(uint32(4), batch.SenderParams[0].SenderNonce)
+}
+
+func TestCreateTicketBatch_NonceStoreError_ReturnsError(t *testing.T) {
+	ns := newStubSenderStore()
+	ns.storeShouldFail = true
+	sender := defaultSender(t)
+	sender.store = ns
+
+	sessionID := sender.StartSession(defaultTicketParams(t, RandAddress()))
+	_, err := sender.CreateTicketBatch(sessionID, 1)
+	assert.Contains(t, err.Error(), "stub sender store store error")
+}
+
+func TestResumeSession(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ns := newStubSenderStore()
+	sender := defaultSender(t)
+	sender.store = ns
+	ticketParams := defaultTicketParams(t, RandAddress())
+	ticketParams.FaceValue = big.NewInt(100)
+	ticketParams.WinProb = new(big.Int).Div(maxWinProb, big.NewInt(2))
+
+	// The win probability is slightly below 1/2, so the EV of a ticket is slightly below 50
+	ev := ticketEV(ticketParams.FaceValue, ticketParams.WinProb)
+	evSent := func(tickets int64) *big.Rat {
+		return new(big.Rat).Mul(ev, new(big.Rat).SetInt64(tickets))
+	}
+
+	sessionID := sender.StartSession(ticketParams)
+	_, err := sender.CreateTicketBatch(sessionID, 2)
+	require.Nil(err)
+
+	state := ns.sessions[sessionID]
+	require.NotNil(state)
+	assert.Equal(ticketParams, state.TicketParams)
+	assert.Equal(uint32(2), state.SenderNonce)
+	assert.Equal(int64(2), state.TicketsSent)
+	assert.Zero(evSent(2).Cmp(state.EVSent))
+	assert.Equal(int64(5), state.ExpirationParams.CreationRound)
+
+	// Simulate a restart with a fresh sender using the same store
+	restarted := defaultSender(t)
+	restarted.store = ns
+	require.Nil(restarted.ResumeSession(sessionID))
+
+	batch, err := restarted.CreateTicketBatch(sessionID, 1)
+	require.Nil(err)
+	assert.Equal(ticketParams, *batch.TicketParams)
+	assert.Equal(uint32(3), batch.SenderParams[0].SenderNonce)
+
+	state = ns.sessions[sessionID]
+	assert.Equal(int64(3), state.TicketsSent)
+	assert.Zero(evSent(3).Cmp(state.EVSent))
+
+	// Resuming a session that is already in memory is a no-op
+	assert.Nil(restarted.ResumeSession(sessionID))
+}
+
+func TestResumeSession_Errors(t *testing.T) {
+	assert := assert.New(t)
+
+	// No store
+	sender := defaultSender(t)
+	err := sender.ResumeSession("foo")
+	assert.Contains(err.Error(), "cannot resume session without a store")
+
+	// No persisted state
+	ns := newStubSenderStore()
+	sender.store = ns
+	err = sender.ResumeSession("foo")
+	assert.Contains(err.Error(), "no persisted state for session")
+
+	// Store error
+	ns.loadShouldFail = true
+	err = sender.ResumeSession("foo")
+	assert.Contains(err.Error(), "stub sender store load error")
+}
+
 func defaultSender(t *testing.T) *sender {
 	account := accounts.Account{
 		Address: RandAddress(),
@@ -421,7 +595,7 @@ func defaultSender(t *testing.T) *sender {
 	sm.info[account.Address] = &SenderInfo{
 		Deposit: big.NewInt(100000),
 	}
-	s := NewSender(am, rm, sm, big.NewRat(100, 1), 2)
+	s := NewSender(am, rm, sm, big.NewRat(100, 1), 2, nil)
 	return s.(*sender)
 }
 
@@ -0,0 +1,214 @@
+package pm
+
+import (
+	"math/big"
+	"sync"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/pkg/errors"
+)
+
+// DefaultSpendDeviationThreshold is the default factor by which the realized spend with
+// a recipient can deviate from the EV of the tickets sent to it before an alert is raised
+const DefaultSpendDeviationThreshold = 2.0
+
+// DefaultMinExpectedWins is the default number of winning tickets that a recipient is expected
+// to have received before its realized spend is compared with the EV of its tickets
+const DefaultMinExpectedWins = 10.0
+
+// SpendTrackerConfig contains config information for a SpendTracker
+type SpendTrackerConfig struct {
+	// MaxStreamEV is the maximum cumulative EV of the tickets issued for a single stream.
+	// There is no limit if it is nil
+	MaxStreamEV *big.Rat
+
+	// DeviationThreshold is the factor by which the realized spend with a recipient can
+	// exceed or fall short of the EV of the tickets sent to it before an alert is raised
+	DeviationThreshold float64
+
+	// MinExpectedWins is the number of winning tickets that a recipient is expected to have
+	// received before its realized spend is compared with the EV of its tickets. The realized
+	// spend of fewer tickets is dominated by chance
+	MinExpectedWins float64
+}
+
+type recipientSpend struct {
+	ticketsSent  int64
+	evSent       *big.Rat
+	expectedWins float64
+
+	wins     int64
+	realized *big.Int
+
+	alerted bool
+}
+
+// SpendTracker tracks the cumulative EV of the tickets that a sender issues for each stream
+// and enforces the EV budget of streams. It also compares the spend that is realized when
+// recipients redeem winning tickets with the EV of the tickets that they were sent.
+// A significant deviation indicates a mis-set winProb or a dishonest recipient
+type SpendTracker struct {
+	cfg SpendTrackerConfig
+
+	mu         sync.Mutex
+	streams    map[string]*big.Rat
+	recipients map[ethcommon.Address]*recipientSpend
+}
+
+// NewSpendTracker creates a new SpendTracker instance
+func NewSpendTracker(cfg SpendTrackerConfig) *SpendTracker {
+	return &SpendTracker{
+		cfg:        cfg,
+		streams:    make(map[string]*big.Rat),
+		recipients: make(map[ethcommon.Address]*recipientSpend),
+	}
+}
+
+// CheckBudget returns an error if issuing tickets with a total EV of ev for a stream would exceed its EV budget
+func (t *SpendTracker) CheckBudget(streamID string, ev *big.Rat) error {
+	if t.cfg.MaxStreamEV == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	total := new(big.Rat).Set(ev)
+	if issued, ok := t.streams[streamID]; ok {
+		total.Add(total, issued)
+	}
+	if total.Cmp(t.cfg.MaxStreamEV) > 0 {
+		return errors.Errorf("ticket EV budget exceeded for stream %v: issued=%v budget=%v", streamID, t.streamEV(streamID).FloatString(3), t.cfg.MaxStreamEV.FloatString(3))
+	}
+
+	return nil
+}
+
+// TicketsIssued records numTickets tickets with the given params that were issued to a recipient for a stream
+func (t *SpendTracker) TicketsIssued(streamID string, params *TicketParams, numTickets int) {
+	if numTickets <= 0 {
+		return
+	}
+
+	ev := ticketEV(params.FaceValue, params.WinProb)
+	ev.Mul(ev, new(big.Rat).SetInt64(int64(numTickets)))
+	winProb, _ := new(big.Rat).SetFrac(params.WinProb, maxWinProb).Float64()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if issued, ok := t.streams[streamID]; ok {
+		issued.Add(issued, ev)
+	} else {
+		t.streams[streamID] = ev
+	}
+
+	spend := t.recipient(params.Recipient)
+	spend.ticketsSent += int64(numTickets)
+	spend.evSent.Add(spend.evSent, ev)
+	spend.expectedWins += winProb * float64(numTickets)
+	t.checkDeviation(params.Recipient, spend)
+}
+
+// TicketRedeemed records a winning ticket with a face value of amount that was redeemed by a recipient
+func (t *SpendTracker) TicketRedeemed(recipient ethcommon.Address, amount *big.Int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	spend := t.recipient(recipient)
+	spend.wins++
+	spend.realized.Add(spend.realized, amount)
+	t.checkDeviation(recipient, spend)
+}
+
+// TicketRedemptionReverted removes a winning ticket with a face value of amount that was redeemed by a
+// recipient, when its redemption is removed from the chain by a re-org
+func (t *SpendTracker) TicketRedemptionReverted(recipient ethcommon.Address, amount *big.Int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	spend := t.recipient(recipient)
+	if spend.wins == 0 {
+		return
+	}
+	spend.wins--
+	spend.realized.Sub(spend.realized, amount)
+	t.checkDeviation(recipient, spend)
+}
+
+// StreamEV returns the cumulative EV of the tickets issued for a stream
+func (t *SpendTracker) StreamEV(streamID string) *big.Rat {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.streamEV(streamID)
+}
+
+// RemoveStream stops tracking the EV of the tickets issued for a stream
+func (t *SpendTracker) RemoveStream(streamID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.streams, streamID)
+}
+
+// SpendRatio returns the ratio of the spend realized by a recipient to the EV of the tickets
+// sent to it. ok is false if the recipient has not been sent enough tickets for the ratio to be meaningful
+func (t *SpendTracker) SpendRatio(recipient ethcommon.Address) (ratio float64, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	spend, exists := t.recipients[recipient]
+	if !exists {
+		return 0, false
+	}
+	return t.spendRatio(spend)
+}
+
+func (t *SpendTracker) streamEV(streamID string) *big.Rat {
+	if issued, ok := t.streams[streamID]; ok {
+		return new(big.Rat).Set(issued)
+	}
+	return big.NewRat(0, 1)
+}
+
+func (t *SpendTracker) recipient(addr ethcommon.Address) *recipientSpend {
+	spend, ok := t.recipients[addr]
+	if !ok {
+		spend = &recipientSpend{
+			evSent:   big.NewRat(0, 1),
+			realized: big.NewInt(0),
+		}
+		t.recipients[addr] = spend
+	}
+	return spend
+}
+
+func (t *SpendTracker) spendRatio(spend *recipientSpend) (float64, bool) {
+	if spend.expectedWins < t.cfg.MinExpectedWins || spend.evSent.Sign() <= 0 {
+		return 0, false
+	}
+	ratio, _ := new(big.Rat).Quo(new(big.Rat).SetInt(spend.realized), spend.evSent).Float64()
+	return ratio, true
+}
+
+// checkDeviation logs an alert when the realized spend of a recipient deviates from the EV of its tickets
+// by more than the configured threshold. The alert is raised once until the spend is back within the threshold
+func (t *SpendTracker) checkDeviation(recipient ethcommon.Address, spend *recipientSpend) {
+	if t.cfg.DeviationThreshold <= 0 {
+		return
+	}
+	ratio, ok := t.spendRatio(spend)
+	if !ok {
+		return
+	}
+
+	deviates := ratio > t.cfg.DeviationThreshold || ratio < 1/t.cfg.DeviationThreshold
+	if deviates && !spend.alerted {
+		glog.Warningf("Realized spend deviates from ticket EV recipient=%v ratio=%.3f ticketsSent=%v evSent=%v expectedWins=%.1f wins=%v realized=%v",
+			monitor.RedactAddress(recipient), ratio, spend.ticketsSent, spend.evSent.FloatString(3), spend.expectedWins, spend.wins, spend.realized)
+	}
+	spend.alerted = deviates
+}
@@ -0,0 +1,104 @@
+package pm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpendTracker_Budget(t *testing.T) {
+	assert := assert.New(t)
+
+	params := &TicketParams{
+		Recipient: RandAddress(),
+		FaceValue: big.NewInt(10),
+		WinProb:   maxWinProb,
+	}
+
+	// No limit without a budget
+	tracker := NewSpendTracker(SpendTrackerConfig{})
+	assert.Nil(tracker.CheckBudget("foo", big.NewRat(1000000, 1)))
+
+	tracker = NewSpendTracker(SpendTrackerConfig{MaxStreamEV: big.NewRat(30, 1)})
+	assert.Nil(tracker.CheckBudget("foo", big.NewRat(30, 1)))
+	assert.EqualError(tracker.CheckBudget("foo", big.NewRat(31, 1)), "ticket EV budget exceeded for stream foo: issued=0.000 budget=30.000")
+
+	tracker.TicketsIssued("foo", params, 2)
+	assert.Zero(big.NewRat(20, 1).Cmp(tracker.StreamEV("foo")))
+	assert.Nil(tracker.CheckBudget("foo", big.NewRat(10, 1)))
+	assert.EqualError(tracker.CheckBudget("foo", big.NewRat(11, 1)), "ticket EV budget exceeded for stream foo: issued=20.000 budget=30.000")
+
+	// Budgets are per stream
+	assert.Nil(tracker.CheckBudget("bar", big.NewRat(30, 1)))
+
+	// Issuing 0 tickets is a noop
+	tracker.TicketsIssued("foo", params, 0)
+	assert.Zero(big.NewRat(20, 1).Cmp(tracker.StreamEV("foo")))
+
+	// The budget is reset when the stream is removed
+	tracker.RemoveStream("foo")
+	assert.Zero(tracker.StreamEV("foo").Sign())
+	assert.Nil(tracker.CheckBudget("foo", big.NewRat(30, 1)))
+}
+
+func TestSpendTracker_SpendRatio(t *testing.T) {
+	assert := assert.New(t)
+
+	recipient := RandAddress()
+	// winProb = 1/2 so the EV of a ticket is 50
+	params := &TicketParams{
+		Recipient: recipient,
+		FaceValue: big.NewInt(100),
+		WinProb:   new(big.Int).Rsh(maxWinProb, 1),
+	}
+	tracker := NewSpendTracker(SpendTrackerConfig{
+		DeviationThreshold: DefaultSpendDeviationThreshold,
+		MinExpectedWins:    2,
+	})
+
+	// Unknown recipient
+	_, ok := tracker.SpendRatio(recipient)
+	assert.False(ok)
+
+	// Too few tickets sent to compare the realized spend
+	tracker.TicketsIssued("foo", params, 2)
+	_, ok = tracker.SpendRatio(recipient)
+	assert.False(ok)
+
+	tracker.TicketsIssued("foo", params, 2)
+	ratio, ok := tracker.SpendRatio(recipient)
+	assert.True(ok)
+	assert.Zero(ratio)
+	assert.True(tracker.recipients[recipient].alerted)
+
+	// Realized spend matches the EV
+	tracker.TicketRedeemed(recipient, big.NewInt(100))
+	tracker.TicketRedeemed(recipient, big.NewInt(100))
+	ratio, ok = tracker.SpendRatio(recipient)
+	assert.True(ok)
+	assert.InDelta(1, ratio, 0.001)
+	assert.False(tracker.recipients[recipient].alerted)
+
+	// Realized spend exceeds the EV by more than the threshold
+	for i := 0; i < 3; i++ {
+		tracker.TicketRedeemed(recipient, big.NewInt(100))
+	}
+	ratio, ok = tracker.SpendRatio(recipient)
+	assert.True(ok)
+	assert.InDelta(2.5, ratio, 0.001)
+	assert.True(tracker.recipients[recipient].alerted)
+
+	// Reverted redemptions are not realized spend
+	tracker.TicketRedemptionReverted(recipient, big.NewInt(100))
+	ratio, ok = tracker.SpendRatio(recipient)
+	assert.True(ok)
+	assert.InDelta(2, ratio, 0.001)
+	assert.Equal(int64(4), tracker.recipients[recipient].wins)
+	assert.False(tracker.recipients[recipient].alerted)
+
+	// Recipient spend is not cleared with a stream
+	tracker.RemoveStream("foo")
+	_, ok = tracker.SpendRatio(recipient)
+	assert.True(ok)
+}
@@ -74,6 +74,71 @@ func (ts *stubTicketStore) LoadWinningTickets(sessionIDs []string) ([]*Ticket, [
 	return allTix, allSigs, allRecipientRands, nil
 }
 
+type stubSenderStore struct {
+	nonces          map[string]uint32
+	sessions        map[string]*SenderSessionState
+	storeShouldFail bool
+	loadShouldFail  bool
+	lock            sync.RWMutex
+}
+
+func newStubSenderStore() *stubSenderStore {
+	return &stubSenderStore{
+		nonces:   make(map[string]uint32),
+		sessions: make(map[string]*SenderSessionState),
+	}
+}
+
+func (ns *stubSenderStore) StoreSenderNonce(sessionID string, senderNonce uint32) error {
+	ns.lock.Lock()
+	defer ns.lock.Unlock()
+
+	if ns.storeShouldFail {
+		return fmt.Errorf("stub sender store store error")
+	}
+
+	if senderNonce > ns.nonces[sessionID] {
+		ns.nonces[sessionID] = senderNonce
+	}
+
+	return nil
+}
+
+func (ns *stubSenderStore) LoadSenderNonce(sessionID string) (uint32, error) {
+	ns.lock.RLock()
+	defer ns.lock.RUnlock()
+
+	if ns.loadShouldFail {
+		return 0, fmt.Errorf("stub sender store load error")
+	}
+
+	return ns.nonces[sessionID], nil
+}
+
+func (ns *stubSenderStore) StoreSenderSession(sessionID string, state *SenderSessionState) error {
+	ns.lock.Lock()
+	defer ns.lock.Unlock()
+
+	if ns.storeShouldFail {
+		return fmt.Errorf("stub sender store store error")
+	}
+
+	ns.sessions[sessionID] = state
+
+	return nil
+}
+
+func (ns *stubSenderStore) LoadSenderSession(sessionID string) (*SenderSessionState, error) {
+	ns.lock.RLock()
+	defer ns.lock.RUnlock()
+
+	if ns.loadShouldFail {
+		return nil, fmt.Errorf("stub sender store load error")
+	}
+
+	return ns.sessions[sessionID], nil
+}
+
 type stubSigVerifier struct {
 	verifyResult bool
 }
@@ -395,6 +460,12 @@ func (m *MockSender) StartSession(ticketParams TicketParams) string {
 	return args.String(0)
 }
 
+// ResumeSession restores a session from its persisted state
+func (m *MockSender) ResumeSession(sessionID string) error {
+	args := m.Called(sessionID)
+	return args.Error(0)
+}
+
 // EV returns the ticket EV for a session
 func (m *MockSender) EV(sessionID string) (*big.Rat, error) {
 	args := m.Called(sessionID)
@@ -0,0 +1,341 @@
+package server
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/big"
+	"math/rand"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+)
+
+// BroadcastABTest splits the streams of the broadcaster between two arms that select orchestrators
+// differently and compares their segments, if set
+var BroadcastABTest *ABTest
+
+// ABTestMode is how the segments of the streams are split between the arms of an A/B test
+type ABTestMode string
+
+const (
+	// ABTestStreams sends all the segments of a stream to the arm of the stream
+	ABTestStreams ABTestMode = "streams"
+	// ABTestSegments alternates the consecutive segments of every stream between the arms, so that
+	// the arms are compared on the same content
+	ABTestSegments ABTestMode = "segments"
+	// ABTestDuplicates sends the segments of a stream to the arm of the stream, and a sample of
+	// them to the other arm as well. The renditions of the duplicates are only measured and verified
+	ABTestDuplicates ABTestMode = "duplicates"
+)
+
+// abTestRand returns the random numbers that duplicated segments are sampled with. Replaced in tests
+var abTestRand = rand.Float64
+
+// ABTestArm is one of the policies that an A/B test compares
+type ABTestArm struct {
+	// Name of the arm in the report
+	Name string
+	// Selects the session of each segment of the streams of the arm. BroadcastSelection is used if nil
+	Selection SelectionAlgorithm
+	// Name of the selection algorithm in the report
+	SelectionName string
+	// Service URI patterns, in the syntax of path.Match, of the only orchestrators that the segments
+	// of the streams of the arm are sent to. Any orchestrator is used if empty
+	Orchestrators []string
+}
+
+// allows returns whether segments of the streams of the arm can be sent to the orchestrator at uri
+func (a *ABTestArm) allows(uri string) bool {
+	if len(a.Orchestrators) == 0 {
+		return true
+	}
+	for _, p := range a.Orchestrators {
+		if ok, _ := path.Match(p, uri); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type abTestStats struct {
+	streams              int
+	segments             int
+	duplicates           int
+	failures             int
+	verified             int
+	verificationFailures int
+	latency              time.Duration
+	duration             float64
+	fees                 *big.Rat
+	startedAt            time.Time
+}
+
+// ABTest assigns each stream to one of two arms by its manifest ID, so that a stream stays in the
+// same arm when it is resumed, and records the latency, cost, failures and verification results of
+// the segments of each arm
+type ABTest struct {
+	arms [2]*ABTestArm
+	// Share of the streams that are assigned to the first arm
+	split float64
+	mode  ABTestMode
+	// Share of the segments that are duplicated to the other arm with ABTestDuplicates
+	duplicateRate float64
+
+	mu    sync.Mutex
+	stats [2]*abTestStats
+}
+
+// ABTestReport is the comparison of an arm of an A/B test with the other
+type ABTestReport struct {
+	Arm           string     `json:"arm"`
+	Mode          ABTestMode `json:"mode"`
+	Selection     string     `json:"selection"`
+	Orchestrators []string   `json:"orchestrators,omitempty"`
+	Streams       int        `json:"streams"`
+	Segments      int        `json:"segments"`
+	// Segments of the arm that were duplicates of the segments of the other arm
+	Duplicates   int     `json:"duplicates,omitempty"`
+	Failures     int     `json:"failures"`
+	FailureRate  float64 `json:"failureRate"`
+	AvgLatencyMs int64   `json:"avgLatencyMs"`
+	// Segments whose renditions were verified, and the share of them that passed
+	Verified             int     `json:"verified"`
+	VerificationFailures int     `json:"verificationFailures"`
+	VerificationPassRate float64 `json:"verificationPassRate"`
+	// Seconds of source video transcoded
+	Transcoded float64 `json:"transcodedSeconds"`
+	// Wei, as an integer string
+	Fees string `json:"fees"`
+	// Wei per minute of source video transcoded, as an integer string
+	CostPerMinute string    `json:"costPerMinute"`
+	Since         time.Time `json:"since"`
+}
+
+// NewABTest creates an A/B test that assigns the share split of the streams to the arm a and the
+// others to the arm b
+func NewABTest(a, b *ABTestArm, split float64) *ABTest {
+	t := &ABTest{arms: [2]*ABTestArm{a, b}, split: split, mode: ABTestStreams}
+	t.reset()
+	return t
+}
+
+// ParseABTest creates an A/B test from a comma-separated pair of selection algorithm names, either
+// of which may be empty to use BroadcastSelection, comma-separated lists of the service URI
+// patterns of the orchestrators of each arm, and the mode that splits the segments between the
+// arms. duplicateRate is the share of the segments that are duplicated with ABTestDuplicates
+func ParseABTest(selections, orchsA, orchsB string, split float64, mode string, duplicateRate float64, node *core.LivepeerNode, webhookURL string) (*ABTest, error) {
+	if split <= 0 || split >= 1 {
+		return nil, fmt.Errorf("the split of the streams must be between 0 and 1")
+	}
+	switch ABTestMode(mode) {
+	case "", ABTestStreams, ABTestSegments:
+	case ABTestDuplicates:
+		if duplicateRate <= 0 || duplicateRate > 1 {
+			return nil, fmt.Errorf("the share of the duplicated segments must be between 0 and 1")
+		}
+	default:
+		return nil, fmt.Errorf("unknown A/B test mode %v", mode)
+	}
+	arms := [2]*ABTestArm{{Name: "A"}, {Name: "B"}}
+	if selections != "" {
+		names := strings.Split(selections, ",")
+		if len(names) != 2 {
+			return nil, fmt.Errorf("expected two selection algorithms, got %v", selections)
+		}
+		for i, name := range names {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			sel, err := NewSelectionAlgorithm(name, node, webhookURL)
+			if err != nil {
+				return nil, err
+			}
+			arms[i].Selection, arms[i].SelectionName = sel, name
+		}
+	}
+	for i, orchs := range []string{orchsA, orchsB} {
+		if orchs == "" {
+			continue
+		}
+		for _, p := range strings.Split(orchs, ",") {
+			p = strings.TrimSpace(p)
+			if _, err := path.Match(p, ""); err != nil || p == "" {
+				return nil, fmt.Errorf("invalid orchestrator pattern %v", p)
+			}
+			arms[i].Orchestrators = append(arms[i].Orchestrators, p)
+		}
+	}
+	t := NewABTest(arms[0], arms[1], split)
+	if mode != "" {
+		t.mode = ABTestMode(mode)
+	}
+	t.duplicateRate = duplicateRate
+	return t, nil
+}
+
+func (t *ABTest) reset() {
+	now := time.Now()
+	for i := range t.stats {
+		t.stats[i] = &abTestStats{fees: new(big.Rat), startedAt: now}
+	}
+}
+
+// Reset clears the statistics of both arms, e.g. after the arms were tuned
+func (t *ABTest) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.reset()
+}
+
+// index returns the index of the arm that a stream is assigned to
+func (t *ABTest) index(mid core.ManifestID) int {
+	h := fnv.New64a()
+	h.Write([]byte(mid))
+	if float64(h.Sum64()%10000)/10000 < t.split {
+		return 0
+	}
+	return 1
+}
+
+// Arm returns the arm that a stream is assigned to
+func (t *ABTest) Arm(mid core.ManifestID) *ABTestArm {
+	return t.arms[t.index(mid)]
+}
+
+// Mode returns how the segments of the streams are split between the arms
+func (t *ABTest) Mode() ABTestMode {
+	return t.mode
+}
+
+// segmentArm returns the index of the arm that a segment of a stream is sent to
+func (t *ABTest) segmentArm(mid core.ManifestID, seqNo uint64) int {
+	if t.mode == ABTestSegments {
+		return int(seqNo % 2)
+	}
+	return t.index(mid)
+}
+
+// allows returns whether the segments of a stream can be sent to the orchestrator at uri. The
+// streams have the orchestrators of both arms unless each stream is in a single arm
+func (t *ABTest) allows(mid core.ManifestID, uri string) bool {
+	if t.mode == ABTestStreams {
+		return t.Arm(mid).allows(uri)
+	}
+	return t.arms[0].allows(uri) || t.arms[1].allows(uri)
+}
+
+// duplicate returns the index of the arm that a segment of a stream is duplicated to, if it is sampled
+func (t *ABTest) duplicate(mid core.ManifestID) (int, bool) {
+	if t.mode != ABTestDuplicates || abTestRand() >= t.duplicateRate {
+		return 0, false
+	}
+	return 1 - t.index(mid), true
+}
+
+// Stream records that a stream started in its arm, or in both arms if its segments are split
+// between them
+func (t *ABTest) Stream(mid core.ManifestID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.mode == ABTestSegments {
+		t.stats[0].streams++
+		t.stats[1].streams++
+		return
+	}
+	t.stats[t.index(mid)].streams++
+}
+
+// Segment records that a segment of the given duration in seconds was transcoded by the arm
+func (t *ABTest) Segment(arm int, duration float64, latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.stats[arm]
+	s.segments++
+	s.duration += duration
+	s.latency += latency
+}
+
+// Duplicate records that a duplicate of a segment of the other arm was sent to the arm
+func (t *ABTest) Duplicate(arm int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stats[arm].duplicates++
+}
+
+// Failure records that the transcoding of a segment by the arm failed
+func (t *ABTest) Failure(arm int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stats[arm].failures++
+}
+
+// Verification records whether the renditions of a segment transcoded by the arm passed the verification
+func (t *ABTest) Verification(arm int, failed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.stats[arm]
+	s.verified++
+	if failed {
+		s.verificationFailures++
+	}
+}
+
+// Payment records the value in wei paid for a segment transcoded by the arm
+func (t *ABTest) Payment(arm int, value *big.Rat) {
+	if value == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.stats[arm]
+	s.fees.Add(s.fees, value)
+}
+
+// Report returns the statistics of both arms
+func (t *ABTest) Report() []ABTestReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	reports := make([]ABTestReport, len(t.arms))
+	for i, arm := range t.arms {
+		s := t.stats[i]
+		r := ABTestReport{
+			Arm:                  arm.Name,
+			Mode:                 t.mode,
+			Selection:            arm.SelectionName,
+			Orchestrators:        arm.Orchestrators,
+			Streams:              s.streams,
+			Segments:             s.segments,
+			Duplicates:           s.duplicates,
+			Failures:             s.failures,
+			Verified:             s.verified,
+			VerificationFailures: s.verificationFailures,
+			Transcoded:           s.duration,
+			Fees:                 s.fees.FloatString(0),
+			CostPerMinute:        "0",
+			Since:                s.startedAt,
+		}
+		if r.Selection == "" {
+			r.Selection = "default"
+		}
+		if attempts := s.segments + s.failures; attempts > 0 {
+			r.FailureRate = float64(s.failures) / float64(attempts)
+		}
+		if s.verified > 0 {
+			r.VerificationPassRate = float64(s.verified-s.verificationFailures) / float64(s.verified)
+		}
+		if s.segments > 0 {
+			r.AvgLatencyMs = int64(s.latency/time.Duration(s.segments)) / int64(time.Millisecond)
+		}
+		if s.duration > 0 {
+			minutes := new(big.Rat).SetFloat64(s.duration / 60)
+			r.CostPerMinute = new(big.Rat).Quo(s.fees, minutes).FloatString(0)
+		}
+		reports[i] = r
+	}
+	return reports
+}
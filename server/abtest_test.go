@@ -0,0 +1,281 @@
+package server
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseABTest(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	n, _ := core.NewLivepeerNode(nil, "", nil)
+
+	_, err := ParseABTest("latency,cheapest", "", "", 1, "", 0, n, "")
+	assert.EqualError(err, "the split of the streams must be between 0 and 1")
+	_, err = ParseABTest("latency", "", "", 0.5, "", 0, n, "")
+	assert.EqualError(err, "expected two selection algorithms, got latency")
+	_, err = ParseABTest("latency,foo", "", "", 0.5, "", 0, n, "")
+	assert.EqualError(err, "unknown selection algorithm foo")
+	_, err = ParseABTest("", "https://[o1", "", 0.5, "", 0, n, "")
+	assert.EqualError(err, "invalid orchestrator pattern https://[o1")
+
+	ab, err := ParseABTest("latency, ", "", "https://*.b.com:*, https://o3:8935", 0.5, "", 0, n, "")
+	require.Nil(err)
+	assert.IsType(&latencySelection{}, ab.arms[0].Selection)
+	assert.Nil(ab.arms[1].Selection)
+	assert.Empty(ab.arms[0].Orchestrators)
+	assert.Equal([]string{"https://*.b.com:*", "https://o3:8935"}, ab.arms[1].Orchestrators)
+
+	assert.True(ab.arms[0].allows("https://o1.a.com:8935"))
+	assert.True(ab.arms[1].allows("https://o1.b.com:8935"))
+	assert.True(ab.arms[1].allows("https://o3:8935"))
+	assert.False(ab.arms[1].allows("https://o1.a.com:8935"))
+	assert.Equal(ABTestStreams, ab.Mode())
+
+	_, err = ParseABTest("", "", "", 0.5, "foo", 0, n, "")
+	assert.EqualError(err, "unknown A/B test mode foo")
+	_, err = ParseABTest("", "", "", 0.5, "duplicates", 0, n, "")
+	assert.EqualError(err, "the share of the duplicated segments must be between 0 and 1")
+	ab, err = ParseABTest("", "", "", 0.5, "duplicates", 0.2, n, "")
+	require.Nil(err)
+	assert.Equal(ABTestDuplicates, ab.Mode())
+	assert.Equal(0.2, ab.duplicateRate)
+}
+
+func TestABTest_Split(t *testing.T) {
+	assert := assert.New(t)
+
+	a, b := &ABTestArm{Name: "A"}, &ABTestArm{Name: "B"}
+	ab := NewABTest(a, b, 0.25)
+
+	var numA int
+	for i := 0; i < 1000; i++ {
+		mid := core.ManifestID(fmt.Sprintf("stream%d", i))
+		arm := ab.Arm(mid)
+		// Streams stay in the same arm
+		assert.Equal(arm, ab.Arm(mid))
+		if arm == a {
+			numA++
+		}
+	}
+	assert.InDelta(250, numA, 50)
+}
+
+func TestABTest_Report(t *testing.T) {
+	assert := assert.New(t)
+
+	ab := NewABTest(&ABTestArm{Name: "A", SelectionName: "latency"}, &ABTestArm{Name: "B"}, 0.5)
+	var midA, midB core.ManifestID
+	for i := 0; midA == "" || midB == ""; i++ {
+		mid := core.ManifestID(fmt.Sprintf("stream%d", i))
+		if ab.Arm(mid).Name == "A" {
+			midA = mid
+		} else {
+			midB = mid
+		}
+	}
+
+	ab.Stream(midA)
+	ab.Segment(0, 2, 100*time.Millisecond)
+	ab.Segment(0, 2, 300*time.Millisecond)
+	ab.Payment(0, big.NewRat(1000, 1))
+	ab.Payment(0, nil)
+	ab.Verification(0, false)
+	ab.Verification(0, true)
+	ab.Stream(midB)
+	ab.Stream(midB)
+	ab.Segment(1, 6, time.Second)
+	ab.Duplicate(1)
+	ab.Failure(1)
+	ab.Payment(1, big.NewRat(500, 1))
+
+	reports := ab.Report()
+	assert.Len(reports, 2)
+	a, b := reports[0], reports[1]
+	assert.Equal("A", a.Arm)
+	assert.Equal(ABTestStreams, a.Mode)
+	assert.Equal("latency", a.Selection)
+	assert.Equal(1, a.Streams)
+	assert.Equal(2, a.Segments)
+	assert.Equal(0, a.Failures)
+	assert.Equal(0.0, a.FailureRate)
+	assert.Equal(int64(200), a.AvgLatencyMs)
+	assert.Equal(4.0, a.Transcoded)
+	assert.Equal("1000", a.Fees)
+	assert.Equal("15000", a.CostPerMinute)
+	assert.Equal(2, a.Verified)
+	assert.Equal(1, a.VerificationFailures)
+	assert.Equal(0.5, a.VerificationPassRate)
+	assert.Equal(0, a.Duplicates)
+
+	assert.Equal("B", b.Arm)
+	assert.Equal("default", b.Selection)
+	assert.Equal(2, b.Streams)
+	assert.Equal(1, b.Segments)
+	assert.Equal(1, b.Failures)
+	assert.Equal(0.5, b.FailureRate)
+	assert.Equal(int64(1000), b.AvgLatencyMs)
+	assert.Equal("500", b.Fees)
+	assert.Equal("5000", b.CostPerMinute)
+	assert.Equal(1, b.Duplicates)
+	assert.Equal(0, b.Verified)
+	assert.Equal(0.0, b.VerificationPassRate)
+
+	ab.Reset()
+	reports = ab.Report()
+	assert.Equal(0, reports[0].Segments)
+	assert.Equal("0", reports[0].Fees)
+	assert.Equal("0", reports[0].CostPerMinute)
+}
+
+func TestSelectOrchestrator_ABTest(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	defer func() { BroadcastABTest = nil }()
+	sel := cheapestSelection{}
+	BroadcastABTest = NewABTest(&ABTestArm{Name: "A", Selection: sel, Orchestrators: []string{"https://o1:*"}}, &ABTestArm{Name: "B"}, 0.5)
+	var mid core.ManifestID
+	for i := 0; mid == ""; i++ {
+		if m := core.ManifestID(fmt.Sprintf("stream%d", i)); BroadcastABTest.Arm(m).Name == "A" {
+			mid = m
+		}
+	}
+
+	n, _ := core.NewLivepeerNode(nil, "", nil)
+	sd := &stubDiscovery{}
+	sd.infos = []*net.OrchestratorInfo{{Transcoder: "https://o1:8935"}, {Transcoder: "https://o2:8935"}}
+	n.OrchestratorPool = sd
+	pl := core.NewBasicPlaylistManager(mid, drivers.NewMemoryDriver(nil).NewSession(string(mid)))
+	sessions, err := selectOrchestrator(n, &streamParameters{mid: mid}, pl, 2)
+	require.Nil(err)
+	require.Len(sessions, 1)
+	assert.Equal("https://o1:8935", sessions[0].OrchestratorInfo.Transcoder)
+
+	// The session manager of the stream uses the selection of its arm
+	bsm := NewSessionManager(n, &streamParameters{mid: mid}, pl)
+	assert.Equal(sel, bsm.selection)
+	assert.Equal(1, BroadcastABTest.Report()[0].Streams)
+
+	// Failed sessions are recorded
+	bsm.removeSession(bsm.selectSession())
+	assert.Equal(1, BroadcastABTest.Report()[0].Failures)
+}
+
+func TestSelectSegmentSession_ABTestSegments(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	defer func() { BroadcastABTest = nil }()
+	BroadcastABTest = NewABTest(&ABTestArm{Name: "A", Orchestrators: []string{"https://o1:*"}}, &ABTestArm{Name: "B", Selection: cheapestSelection{}, Orchestrators: []string{"https://o2:*", "https://o3:*"}}, 0.5)
+	BroadcastABTest.mode = ABTestSegments
+
+	n, _ := core.NewLivepeerNode(nil, "", nil)
+	sd := &stubDiscovery{}
+	sd.infos = []*net.OrchestratorInfo{
+		{Transcoder: "https://o1:8935"},
+		{Transcoder: "https://o2:8935", PriceInfo: &net.PriceInfo{PricePerUnit: 2, PixelsPerUnit: 1}},
+		{Transcoder: "https://o3:8935", PriceInfo: &net.PriceInfo{PricePerUnit: 1, PixelsPerUnit: 1}},
+		{Transcoder: "https://o4:8935"},
+	}
+	n.OrchestratorPool = sd
+	mid := core.ManifestID("mid")
+	pl := core.NewBasicPlaylistManager(mid, drivers.NewMemoryDriver(nil).NewSession(string(mid)))
+	bsm := NewSessionManager(n, &streamParameters{mid: mid}, pl)
+	// Refreshes of the sessions read BroadcastABTest, so they must be done before it is restored
+	defer func() {
+		bsm.cleanup()
+		assert.Eventually(func() bool {
+			bsm.sessLock.Lock()
+			defer bsm.sessLock.Unlock()
+			return !bsm.refreshing
+		}, time.Second, 5*time.Millisecond)
+	}()
+	// The stream has the sessions of both arms, and is selected with the selection of each arm
+	assert.Len(bsm.sessMap, 3)
+	assert.Nil(bsm.selection)
+
+	sess := bsm.selectSegmentSession(mid, 0)
+	require.NotNil(sess)
+	assert.Equal("https://o1:8935", sess.OrchestratorInfo.Transcoder)
+	assert.Equal(0, sess.ABTestArm)
+
+	sess = bsm.selectSegmentSession(mid, 1)
+	require.NotNil(sess)
+	assert.Equal("https://o3:8935", sess.OrchestratorInfo.Transcoder)
+	assert.Equal(1, sess.ABTestArm)
+
+	// Failures are recorded for the arm of the segment
+	bsm.removeSession(sess)
+	assert.Equal(0, BroadcastABTest.Report()[0].Failures)
+	assert.Equal(1, BroadcastABTest.Report()[1].Failures)
+
+	// No session is selected once an arm has none left, even if the other arm has some
+	assert.Nil(bsm.selectSegmentSession(mid, 2))
+}
+
+func TestABTest_Segments(t *testing.T) {
+	assert := assert.New(t)
+
+	ab := NewABTest(&ABTestArm{Name: "A", Orchestrators: []string{"https://o1:*"}}, &ABTestArm{Name: "B", Orchestrators: []string{"https://o2:*"}}, 0.5)
+	ab.mode = ABTestSegments
+
+	// Consecutive segments of a stream alternate between the arms
+	assert.Equal(0, ab.segmentArm("mid", 0))
+	assert.Equal(1, ab.segmentArm("mid", 1))
+	assert.Equal(0, ab.segmentArm("mid", 2))
+
+	// Streams have the orchestrators of both arms
+	assert.True(ab.allows("mid", "https://o1:8935"))
+	assert.True(ab.allows("mid", "https://o2:8935"))
+	assert.False(ab.allows("mid", "https://o3:8935"))
+
+	// Streams are in both arms
+	ab.Stream("mid")
+	reports := ab.Report()
+	assert.Equal(1, reports[0].Streams)
+	assert.Equal(1, reports[1].Streams)
+	assert.Equal(ABTestSegments, reports[0].Mode)
+
+	// Segments are not duplicated
+	_, ok := ab.duplicate("mid")
+	assert.False(ok)
+}
+
+func TestABTest_Duplicates(t *testing.T) {
+	assert := assert.New(t)
+
+	oldRand := abTestRand
+	defer func() { abTestRand = oldRand }()
+
+	ab := NewABTest(&ABTestArm{Name: "A", Orchestrators: []string{"https://o1:*"}}, &ABTestArm{Name: "B", Orchestrators: []string{"https://o2:*"}}, 0.5)
+	ab.mode, ab.duplicateRate = ABTestDuplicates, 0.1
+	var mid core.ManifestID
+	for i := 0; mid == ""; i++ {
+		if m := core.ManifestID(fmt.Sprintf("stream%d", i)); ab.Arm(m).Name == "A" {
+			mid = m
+		}
+	}
+
+	// Segments are sent to the arm of their stream
+	assert.Equal(0, ab.segmentArm(mid, 1))
+	assert.True(ab.allows(mid, "https://o2:8935"))
+
+	// A sample of the segments is duplicated to the other arm
+	abTestRand = func() float64 { return 0.05 }
+	arm, ok := ab.duplicate(mid)
+	assert.True(ok)
+	assert.Equal(1, arm)
+	abTestRand = func() float64 { return 0.5 }
+	_, ok = ab.duplicate(mid)
+	assert.False(ok)
+}
@@ -0,0 +1,429 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/go-livepeer/pm"
+)
+
+// ProtocolArchivePrefix is the path under which the payloads of the archived exchanges are saved
+const ProtocolArchivePrefix = "archive"
+
+// Roles of the node in an archived exchange
+const (
+	archiveRoleBroadcaster  = "broadcaster"
+	archiveRoleOrchestrator = "orchestrator"
+)
+
+var errExchangeNotFound = errors.New("exchange not found")
+
+// Archive is the archive of the exchanges of the node, if the node archives them
+var Archive *ProtocolArchive
+
+// ProtocolArchiveStorage is a storage that the payloads of the archive can be read and deleted from
+type ProtocolArchiveStorage interface {
+	drivers.OSPruner
+	drivers.OSReader
+}
+
+// ProtocolArchive archives the signed messages of the segments that the node exchanges with other
+// nodes for a window of time, so that the exchanges can be replayed and verified again when the
+// fees of the segments are disputed. The messages are saved to the DB, and the source segments
+// and renditions to the node's storage
+type ProtocolArchive struct {
+	db      *common.DB
+	os      drivers.OSDriver
+	storage ProtocolArchiveStorage
+	window  time.Duration
+	quit    chan struct{}
+}
+
+// ArchivedExchange is an exchange of the archive
+type ArchivedExchange struct {
+	ID         int64     `json:"id"`
+	Role       string    `json:"role"`
+	ManifestID string    `json:"manifestID"`
+	SeqNo      int64     `json:"seqNo"`
+	Sender     string    `json:"sender"`
+	Recipient  string    `json:"recipient"`
+	Time       time.Time `json:"time"`
+	// Names of the source segment and of the renditions in the storage
+	Payloads []string `json:"payloads"`
+}
+
+// ExchangeReplay is the result of the verification of an archived exchange. Errors lists the
+// checks that failed, and is empty if the whole exchange was verified
+type ExchangeReplay struct {
+	ID         int64     `json:"id"`
+	Role       string    `json:"role"`
+	ManifestID string    `json:"manifestID"`
+	SeqNo      int64     `json:"seqNo"`
+	Sender     string    `json:"sender"`
+	Recipient  string    `json:"recipient"`
+	Time       time.Time `json:"time"`
+	// Whether the segment credentials are signed by the sender
+	SegDataSigValid bool `json:"segDataSigValid"`
+	// Whether the archived source segment matches the hash of the segment credentials
+	SourceHashValid bool `json:"sourceHashValid"`
+	Tickets         int  `json:"tickets"`
+	// Number of tickets signed by the sender
+	ValidTickets int `json:"validTickets"`
+	// Expected value of the tickets in wei
+	EV string `json:"ev"`
+	// Price per pixel that the payment was sent for, in wei
+	PricePerPixel string `json:"pricePerPixel"`
+	// Error returned by the orchestrator instead of the renditions
+	ResultError string `json:"resultError,omitempty"`
+	Renditions  int    `json:"renditions"`
+	Pixels      int64  `json:"pixels"`
+	// Fee of the renditions at the price of the payment, in wei
+	Fee string `json:"fee"`
+	// Whether the renditions are signed by the recipient, or nil if the renditions are not available
+	ResultSigValid *bool    `json:"resultSigValid"`
+	Errors         []string `json:"errors"`
+}
+
+// NewProtocolArchive creates a ProtocolArchive that saves payloads to os and keeps the exchanges
+// for window
+func NewProtocolArchive(db *common.DB, os drivers.OSDriver, window time.Duration) (*ProtocolArchive, error) {
+	if window <= 0 {
+		return nil, errors.New("protocol archive window must be positive")
+	}
+	storage, ok := os.(ProtocolArchiveStorage)
+	if !ok {
+		return nil, errors.New("the protocol archive is not supported by the storage")
+	}
+	return &ProtocolArchive{
+		db:      db,
+		os:      os,
+		storage: storage,
+		window:  window,
+		quit:    make(chan struct{}),
+	}, nil
+}
+
+// archiveExchange archives an exchange and its payloads to the archive of the node in the
+// background
+func archiveExchange(ex *common.DBProtocolExchange, payloads [][]byte) {
+	go func() {
+		if _, err := Archive.Record(ex, payloads); err != nil {
+			glog.Errorf("Error archiving exchange manifestID=%s seqNo=%d err=%v", ex.ManifestID, ex.SeqNo, err)
+		}
+	}()
+}
+
+// Record saves the payloads of an exchange, the source segment followed by the renditions, and
+// the exchange. It returns the ID of the exchange
+func (a *ProtocolArchive) Record(ex *common.DBProtocolExchange, payloads [][]byte) (int64, error) {
+	dir := fmt.Sprintf("%s/%s/%d-%d-%s", ProtocolArchivePrefix, unsafeFileChars.ReplaceAllString(ex.ManifestID, "_"), ex.SeqNo, time.Now().UnixNano(), ex.Role)
+	sess := a.os.NewSession(dir)
+	defer sess.EndSession()
+
+	ex.Payloads = []string{}
+	for i, data := range payloads {
+		name := "source.ts"
+		if i > 0 {
+			name = fmt.Sprintf("%d.ts", i-1)
+		}
+		if _, err := sess.SaveData(name, data); err != nil {
+			return 0, err
+		}
+		ex.Payloads = append(ex.Payloads, dir+"/"+name)
+	}
+	return a.db.InsertProtocolExchange(ex)
+}
+
+// StartPruning deletes the exchanges that are older than the window every interval until
+// StopPruning is called
+func (a *ProtocolArchive) StartPruning(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := a.prune(time.Now()); err != nil {
+				glog.Errorf("Error pruning the protocol archive: %v", err)
+			}
+		case <-a.quit:
+			return
+		}
+	}
+}
+
+// StopPruning stops the pruning loop
+func (a *ProtocolArchive) StopPruning() {
+	close(a.quit)
+}
+
+// prune deletes the exchanges that are older than the window and their payloads, and returns the
+// number of exchanges that were deleted
+func (a *ProtocolArchive) prune(now time.Time) (int, error) {
+	cutoff := now.Add(-a.window).Unix()
+	expired, err := a.db.ProtocolExchanges(0, cutoff-1)
+	if err != nil {
+		return 0, err
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+	var names []string
+	for _, ex := range expired {
+		names = append(names, ex.Payloads...)
+	}
+	if len(names) > 0 {
+		if err := a.storage.DeleteData(names); err != nil {
+			return 0, err
+		}
+	}
+	if err := a.db.DeleteProtocolExchanges(cutoff); err != nil {
+		return 0, err
+	}
+	glog.Infof("Deleted expired protocol exchanges count=%d", len(expired))
+	return len(expired), nil
+}
+
+// Purge deletes the exchanges of the streams matched by match and their payloads. It returns the
+// number of exchanges and the names of the payloads that were deleted
+func (a *ProtocolArchive) Purge(match func(core.ManifestID) bool) (int, []string, error) {
+	mids, err := a.db.ProtocolExchangeManifestIDs()
+	if err != nil {
+		return 0, nil, err
+	}
+	purged := 0
+	var objects []string
+	for _, mid := range mids {
+		if !match(core.ManifestID(mid)) {
+			continue
+		}
+		exs, err := a.db.ManifestProtocolExchanges(mid)
+		if err != nil {
+			return purged, objects, err
+		}
+		var names []string
+		for _, ex := range exs {
+			names = append(names, ex.Payloads...)
+		}
+		if len(names) > 0 {
+			if err := a.storage.DeleteData(names); err != nil {
+				return purged, objects, err
+			}
+			objects = append(objects, names...)
+		}
+		if err := a.db.DeleteManifestProtocolExchanges(mid); err != nil {
+			return purged, objects, err
+		}
+		purged += len(exs)
+	}
+	return purged, objects, nil
+}
+
+// Exchanges returns the exchanges from since to until included, oldest first
+func (a *ProtocolArchive) Exchanges(since, until time.Time) ([]*ArchivedExchange, error) {
+	exs, err := a.db.ProtocolExchanges(since.Unix(), until.Unix())
+	if err != nil {
+		return nil, err
+	}
+	archived := []*ArchivedExchange{}
+	for _, ex := range exs {
+		archived = append(archived, &ArchivedExchange{
+			ID:         ex.ID,
+			Role:       ex.Role,
+			ManifestID: ex.ManifestID,
+			SeqNo:      ex.SeqNo,
+			Sender:     ex.Sender.Hex(),
+			Recipient:  ex.Recipient.Hex(),
+			Time:       time.Unix(ex.Time, 0),
+			Payloads:   ex.Payloads,
+		})
+	}
+	return archived, nil
+}
+
+// Replay verifies an archived exchange again: the signatures of the segment credentials, of the
+// tickets and of the renditions, the hash of the source segment and the fee of the renditions.
+// The renditions are read from the archive, or downloaded from the URLs of the result if they
+// were not archived
+func (a *ProtocolArchive) Replay(id int64) (*ExchangeReplay, error) {
+	ex, err := a.db.ProtocolExchange(id)
+	if err != nil {
+		return nil, err
+	}
+	if ex == nil {
+		return nil, errExchangeNotFound
+	}
+
+	r := &ExchangeReplay{
+		ID:         ex.ID,
+		Role:       ex.Role,
+		ManifestID: ex.ManifestID,
+		SeqNo:      ex.SeqNo,
+		Sender:     ex.Sender.Hex(),
+		Recipient:  ex.Recipient.Hex(),
+		Time:       time.Unix(ex.Time, 0),
+		EV:         "0",
+		Fee:        "0",
+		Errors:     []string{},
+	}
+	fail := func(format string, args ...interface{}) {
+		r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+	}
+
+	// The segment credentials and the source segment
+	var segHash ethcommon.Hash
+	var segData net.SegData
+	if buf, err := base64.StdEncoding.DecodeString(ex.SegData); err != nil {
+		fail("invalid segment credentials: %v", err)
+	} else if err := proto.Unmarshal(buf, &segData); err != nil {
+		fail("invalid segment credentials: %v", err)
+	} else if md, err := segDataToMetadata(&segData); err != nil {
+		fail("invalid segment credentials: %v", err)
+	} else {
+		segHash = md.Hash
+		r.SegDataSigValid = pm.VerifySig(ex.Sender, crypto.Keccak256(md.Flatten()), segData.Sig)
+		if !r.SegDataSigValid {
+			fail("segment credentials not signed by the sender")
+		}
+	}
+	if len(ex.Payloads) == 0 {
+		fail("source segment not archived")
+	} else if source, err := a.storage.ReadData(ex.Payloads[0]); err != nil {
+		fail("error reading source segment: %v", err)
+	} else {
+		r.SourceHashValid = bytes.Equal(crypto.Keccak256(source), segHash.Bytes())
+		if !r.SourceHashValid {
+			fail("source segment does not match the segment credentials")
+		}
+	}
+
+	// The payment
+	var price *big.Rat
+	payment, err := getPayment(ex.Payment)
+	if err != nil {
+		fail("invalid payment: %v", err)
+	} else {
+		if p := payment.GetExpectedPrice(); p != nil && p.PixelsPerUnit > 0 {
+			price = big.NewRat(p.PricePerUnit, p.PixelsPerUnit)
+			r.PricePerPixel = price.FloatString(3)
+		}
+		if payment.TicketParams != nil {
+			ev := new(big.Rat)
+			for _, ticket := range paymentTickets(payment) {
+				r.Tickets++
+				if pm.VerifySig(ex.Sender, ticket.ticket.Hash().Bytes(), ticket.sig) {
+					r.ValidTickets++
+					ev.Add(ev, ticket.ticket.EV())
+				}
+			}
+			r.EV = ev.FloatString(0)
+			if r.ValidTickets < r.Tickets {
+				fail("%d of %d tickets not signed by the sender", r.Tickets-r.ValidTickets, r.Tickets)
+			}
+		}
+	}
+
+	// The result
+	var tr net.TranscodeResult
+	if err := proto.Unmarshal(ex.Result, &tr); err != nil {
+		fail("invalid result: %v", err)
+		return r, nil
+	}
+	switch res := tr.Result.(type) {
+	case *net.TranscodeResult_Error:
+		r.ResultError = res.Error
+	case *net.TranscodeResult_Data:
+		r.Renditions = len(res.Data.Segments)
+		for _, seg := range res.Data.Segments {
+			r.Pixels += seg.Pixels
+		}
+		if price != nil {
+			r.Fee = new(big.Rat).Mul(new(big.Rat).SetInt64(r.Pixels), price).FloatString(0)
+		}
+		hashes, err := a.renditionHashes(ex, res.Data)
+		if err != nil {
+			glog.V(common.DEBUG).Infof("Renditions of exchange id=%d not available: %v", ex.ID, err)
+			break
+		}
+		valid := pm.VerifySig(ex.Recipient, crypto.Keccak256(hashes...), res.Data.Sig)
+		r.ResultSigValid = &valid
+		if !valid {
+			fail("renditions not signed by the recipient")
+		}
+	default:
+		fail("result without renditions or error")
+	}
+	return r, nil
+}
+
+// renditionHashes returns the hashes of the renditions of an exchange, read from the archive or
+// downloaded from the URLs of the result
+func (a *ProtocolArchive) renditionHashes(ex *common.DBProtocolExchange, td *net.TranscodeData) ([][]byte, error) {
+	var hashes [][]byte
+	for i, seg := range td.Segments {
+		var data []byte
+		var err error
+		if len(ex.Payloads) == len(td.Segments)+1 {
+			data, err = a.storage.ReadData(ex.Payloads[i+1])
+		} else {
+			data, err = drivers.GetSegmentData(seg.Url)
+		}
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, crypto.Keccak256(data))
+	}
+	return hashes, nil
+}
+
+// signedTicket is a ticket of a payment and the signature of its sender
+type signedTicket struct {
+	ticket *pm.Ticket
+	sig    []byte
+}
+
+// paymentTickets returns the tickets of a payment
+func paymentTickets(payment net.Payment) []signedTicket {
+	params := &pm.TicketParams{
+		Recipient:         ethcommon.BytesToAddress(payment.TicketParams.Recipient),
+		FaceValue:         new(big.Int).SetBytes(payment.TicketParams.FaceValue),
+		WinProb:           new(big.Int).SetBytes(payment.TicketParams.WinProb),
+		RecipientRandHash: ethcommon.BytesToHash(payment.TicketParams.RecipientRandHash),
+		Seed:              new(big.Int).SetBytes(payment.TicketParams.Seed),
+	}
+	expirationParams := &pm.TicketExpirationParams{
+		CreationRound:          payment.GetExpirationParams().GetCreationRound(),
+		CreationRoundBlockHash: ethcommon.BytesToHash(payment.GetExpirationParams().GetCreationRoundBlockHash()),
+	}
+	sender := ethcommon.BytesToAddress(payment.Sender)
+
+	var tickets []signedTicket
+	for _, tsp := range payment.TicketSenderParams {
+		tickets = append(tickets, signedTicket{
+			ticket: pm.NewTicket(params, expirationParams, sender, tsp.SenderNonce),
+			sig:    tsp.Sig,
+		})
+	}
+	return tickets
+}
+
+// sessionRecipient returns the address of the orchestrator of a session, or the zero address if
+// the orchestrator is not paid
+func sessionRecipient(sess *BroadcastSession) ethcommon.Address {
+	if params := sess.OrchestratorInfo.GetTicketParams(); params != nil {
+		return ethcommon.BytesToAddress(params.Recipient)
+	}
+	return ethcommon.Address{}
+}
@@ -0,0 +1,329 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/golang/protobuf/proto"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+// personalSign signs a 32 byte message like the ETH accounts of the nodes
+func personalSign(t *testing.T, priv *ecdsa.PrivateKey, msg []byte) []byte {
+	ethMsg := fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", 32, msg)
+	sig, err := ethcrypto.Sign(ethcrypto.Keccak256([]byte(ethMsg)), priv)
+	require.Nil(t, err)
+	return sig
+}
+
+func tempProtocolArchive(t *testing.T) (*ProtocolArchive, *stubBackupStorage, func()) {
+	dir, err := ioutil.TempDir("", "archive")
+	require.Nil(t, err)
+	dbh, err := common.InitDB(filepath.Join(dir, "lp.sqlite3"))
+	require.Nil(t, err)
+	storage := newStubBackupStorage()
+	a, err := NewProtocolArchive(dbh, storage, 24*time.Hour)
+	require.Nil(t, err)
+	return a, storage, func() {
+		dbh.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// signedExchange returns an exchange of a segment between a broadcaster and an orchestrator that
+// is signed by both, with its payloads
+func signedExchange(t *testing.T) (*common.DBProtocolExchange, [][]byte) {
+	require := require.New(t)
+
+	b := stubBroadcaster2()
+	o := newStubOrchestrator()
+	sess := &BroadcastSession{
+		Broadcaster: b,
+		ManifestID:  "foo",
+		Profiles:    []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, ffmpeg.P240p30fps16x9},
+	}
+	source := []byte("source")
+	segCreds, err := genSegCreds(sess, &stream.HLSSegment{SeqNo: 3, Data: source})
+	require.Nil(err)
+
+	payment := net.Payment{
+		Sender: b.Address().Bytes(),
+		TicketParams: &net.TicketParams{
+			Recipient:         o.Address().Bytes(),
+			FaceValue:         big.NewInt(1000).Bytes(),
+			WinProb:           new(big.Int).Lsh(big.NewInt(1), 255).Bytes(),
+			RecipientRandHash: ethcommon.HexToHash("0x1").Bytes(),
+			Seed:              big.NewInt(7).Bytes(),
+		},
+		ExpirationParams: &net.TicketExpirationParams{CreationRound: 1, CreationRoundBlockHash: ethcommon.HexToHash("0x2").Bytes()},
+		ExpectedPrice:    &net.PriceInfo{PricePerUnit: 1, PixelsPerUnit: 2},
+	}
+	for nonce := uint32(1); nonce <= 2; nonce++ {
+		payment.TicketSenderParams = append(payment.TicketSenderParams, &net.TicketSenderParams{SenderNonce: nonce})
+	}
+	for i, ticket := range paymentTickets(payment) {
+		payment.TicketSenderParams[i].Sig = personalSign(t, b.priv, ticket.ticket.Hash().Bytes())
+	}
+	paymentBuf, err := proto.Marshal(&payment)
+	require.Nil(err)
+
+	renditions := [][]byte{[]byte("144p"), []byte("240p")}
+	resultHash := ethcrypto.Keccak256(ethcrypto.Keccak256(renditions[0]), ethcrypto.Keccak256(renditions[1]))
+	result, err := proto.Marshal(&net.TranscodeResult{
+		Seq: 3,
+		Result: &net.TranscodeResult_Data{Data: &net.TranscodeData{
+			Segments: []*net.TranscodedSegmentData{{Pixels: 100}, {Pixels: 200}},
+			Sig:      personalSign(t, o.priv, resultHash),
+		}},
+	})
+	require.Nil(err)
+
+	ex := &common.DBProtocolExchange{
+		Role:       archiveRoleOrchestrator,
+		ManifestID: "foo",
+		SeqNo:      3,
+		Sender:     b.Address(),
+		Recipient:  o.Address(),
+		SegData:    segCreds,
+		Payment:    base64.StdEncoding.EncodeToString(paymentBuf),
+		Result:     result,
+		Time:       time.Now().Unix(),
+	}
+	return ex, append([][]byte{source}, renditions...)
+}
+
+func TestNewProtocolArchive(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewProtocolArchive(nil, newStubBackupStorage(), 0)
+	assert.EqualError(err, "protocol archive window must be positive")
+	_, err = NewProtocolArchive(nil, drivers.NewMemoryDriver(nil), time.Hour)
+	assert.EqualError(err, "the protocol archive is not supported by the storage")
+}
+
+func TestProtocolArchive_Replay(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	a, storage, cleanup := tempProtocolArchive(t)
+	defer cleanup()
+
+	_, err := a.Replay(1)
+	assert.Equal(errExchangeNotFound, err)
+
+	// The payloads are saved to the storage
+	ex, payloads := signedExchange(t)
+	id, err := a.Record(ex, payloads)
+	require.Nil(err)
+	require.Len(ex.Payloads, 3)
+	assert.Equal(payloads[0], storage.objects[ex.Payloads[0]])
+	assert.Equal(payloads[2], storage.objects[ex.Payloads[2]])
+
+	r, err := a.Replay(id)
+	require.Nil(err)
+	assert.Empty(r.Errors)
+	assert.True(r.SegDataSigValid)
+	assert.True(r.SourceHashValid)
+	assert.Equal(2, r.Tickets)
+	assert.Equal(2, r.ValidTickets)
+	// Each ticket is worth half of its face value
+	assert.Equal("1000", r.EV)
+	assert.Equal("0.500", r.PricePerPixel)
+	assert.Equal(2, r.Renditions)
+	assert.Equal(int64(300), r.Pixels)
+	assert.Equal("150", r.Fee)
+	require.NotNil(r.ResultSigValid)
+	assert.True(*r.ResultSigValid)
+
+	// Tampered payloads and messages fail their checks
+	ex, payloads = signedExchange(t)
+	payloads[0] = []byte("other source")
+	payloads[1] = []byte("other 144p")
+	payment, err := getPayment(ex.Payment)
+	require.Nil(err)
+	payment.TicketSenderParams[1].Sig = payment.TicketSenderParams[0].Sig
+	buf, err := proto.Marshal(&payment)
+	require.Nil(err)
+	ex.Payment = base64.StdEncoding.EncodeToString(buf)
+	id, err = a.Record(ex, payloads)
+	require.Nil(err)
+
+	r, err = a.Replay(id)
+	require.Nil(err)
+	assert.True(r.SegDataSigValid)
+	assert.False(r.SourceHashValid)
+	assert.Equal(1, r.ValidTickets)
+	assert.Equal("500", r.EV)
+	require.NotNil(r.ResultSigValid)
+	assert.False(*r.ResultSigValid)
+	assert.Equal([]string{
+		"source segment does not match the segment credentials",
+		"1 of 2 tickets not signed by the sender",
+		"renditions not signed by the recipient",
+	}, r.Errors)
+
+	// The signature of the renditions is not checked if they are not available
+	ex, payloads = signedExchange(t)
+	ex.Sender = ethcommon.HexToAddress("0x1")
+	id, err = a.Record(ex, payloads[:1])
+	require.Nil(err)
+	r, err = a.Replay(id)
+	require.Nil(err)
+	assert.False(r.SegDataSigValid)
+	assert.Nil(r.ResultSigValid)
+	assert.Contains(r.Errors, "segment credentials not signed by the sender")
+
+	// Errors returned instead of renditions are replayed
+	ex, payloads = signedExchange(t)
+	ex.Result, err = proto.Marshal(&net.TranscodeResult{Result: &net.TranscodeResult_Error{Error: "OrchestratorBusy"}})
+	require.Nil(err)
+	id, err = a.Record(ex, payloads[:1])
+	require.Nil(err)
+	r, err = a.Replay(id)
+	require.Nil(err)
+	assert.Equal("OrchestratorBusy", r.ResultError)
+	assert.Equal("0", r.Fee)
+	assert.Empty(r.Errors)
+}
+
+func TestProtocolArchive_Prune(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	a, storage, cleanup := tempProtocolArchive(t)
+	defer cleanup()
+
+	now := time.Now()
+	old, payloads := signedExchange(t)
+	old.Time = now.Add(-25 * time.Hour).Unix()
+	_, err := a.Record(old, payloads)
+	require.Nil(err)
+	recent, payloads := signedExchange(t)
+	_, err = a.Record(recent, payloads)
+	require.Nil(err)
+	assert.Len(storage.objects, 6)
+
+	// Exchanges older than the window are deleted with their payloads
+	n, err := a.prune(now)
+	require.Nil(err)
+	assert.Equal(1, n)
+	assert.Len(storage.objects, 3)
+	assert.NotContains(storage.objects, old.Payloads[0])
+	exs, err := a.Exchanges(now.Add(-48*time.Hour), now)
+	require.Nil(err)
+	require.Len(exs, 1)
+	assert.Equal(recent.Payloads, exs[0].Payloads)
+
+	n, err = a.prune(now)
+	require.Nil(err)
+	assert.Equal(0, n)
+}
+
+func TestProtocolArchiveHandlers(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := newMockServer()
+	defer srv.Close()
+	defer func() { Archive = nil }()
+
+	get := func(path string, v interface{}) int {
+		res, err := http.Get(srv.URL + path)
+		require.Nil(err)
+		defer res.Body.Close()
+		if res.StatusCode == http.StatusOK {
+			require.Nil(json.NewDecoder(res.Body).Decode(v))
+		}
+		return res.StatusCode
+	}
+
+	assert.Equal(http.StatusInternalServerError, get("/protocolExchanges", nil))
+	assert.Equal(http.StatusInternalServerError, get("/replayExchange?id=1", nil))
+
+	a, _, cleanup := tempProtocolArchive(t)
+	defer cleanup()
+	Archive = a
+	ex, payloads := signedExchange(t)
+	id, err := a.Record(ex, payloads)
+	require.Nil(err)
+
+	var exs []*ArchivedExchange
+	assert.Equal(http.StatusOK, get("/protocolExchanges", &exs))
+	require.Len(exs, 1)
+	assert.Equal(id, exs[0].ID)
+	assert.Equal("foo", exs[0].ManifestID)
+	assert.Equal(ex.Sender.Hex(), exs[0].Sender)
+	assert.Equal(http.StatusOK, get(fmt.Sprintf("/protocolExchanges?until=%d", ex.Time-1), &exs))
+	assert.Empty(exs)
+	assert.Equal(http.StatusBadRequest, get("/protocolExchanges?since=foo", nil))
+
+	var r ExchangeReplay
+	assert.Equal(http.StatusOK, get(fmt.Sprintf("/replayExchange?id=%d", id), &r))
+	assert.Equal(id, r.ID)
+	assert.Empty(r.Errors)
+	assert.Equal(http.StatusNotFound, get("/replayExchange?id=100", nil))
+	assert.Equal(http.StatusBadRequest, get("/replayExchange?id=foo", nil))
+}
+
+func TestSubmitSegment_Archive(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	a, storage, cleanup := tempProtocolArchive(t)
+	defer cleanup()
+	Archive = a
+	defer func() { Archive = nil }()
+
+	tr := &net.TranscodeResult{
+		Result: &net.TranscodeResult_Data{Data: &net.TranscodeData{Sig: []byte("bar")}},
+	}
+	buf, err := proto.Marshal(tr)
+	require.Nil(err)
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	mux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(buf)
+	})
+
+	sess := &BroadcastSession{
+		Broadcaster:      stubBroadcaster2(),
+		ManifestID:       core.RandomManifestID(),
+		Profiles:         []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9},
+		OrchestratorInfo: &net.OrchestratorInfo{Transcoder: ts.URL},
+	}
+	_, err = SubmitSegment(sess, &stream.HLSSegment{SeqNo: 2, Data: []byte("dummy")}, 0)
+	require.Nil(err)
+
+	// The exchange is archived in the background
+	var exs []*ArchivedExchange
+	for i := 0; i < 100 && len(exs) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		exs, err = a.Exchanges(time.Now().Add(-time.Minute), time.Now().Add(time.Minute))
+		require.Nil(err)
+	}
+	require.Len(exs, 1)
+	assert.Equal(archiveRoleBroadcaster, exs[0].Role)
+	assert.Equal(string(sess.ManifestID), exs[0].ManifestID)
+	assert.Equal(int64(2), exs[0].SeqNo)
+	require.Len(exs[0].Payloads, 1)
+	assert.Equal([]byte("dummy"), storage.objects[exs[0].Payloads[0]])
+}
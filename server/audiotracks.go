@@ -0,0 +1,62 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/lpms/stream"
+
+	"github.com/livepeer/go-livepeer/core"
+)
+
+// audioTrackRendition is the name of the rendition of the audio track with the given index
+// among the audio streams of a stream
+func audioTrackRendition(i int) string {
+	return fmt.Sprintf("audio_%d", i)
+}
+
+// passthroughAudioTracks passes the alternate audio tracks of a segment, i.e. its audio
+// streams after the first one, through to their own renditions without transcoding them.
+// Returns the data of the segment with its first audio stream only, which is the audio
+// that is transcoded along with the video
+func passthroughAudioTracks(cxn *rtmpConnection, seg *stream.HLSSegment) ([]byte, error) {
+	streams, err := tsProgramStreams(seg.Data)
+	if err != nil {
+		return nil, err
+	}
+	var audio []pmtStream
+	for _, st := range streams {
+		if tsAudioStreamTypes[st.streamType] {
+			audio = append(audio, st)
+		}
+	}
+	if len(audio) < 2 {
+		return seg.Data, nil
+	}
+
+	tracks := make([]core.AudioTrack, len(audio))
+	for i, st := range audio {
+		tracks[i] = core.AudioTrack{Name: audioTrackRendition(i), Language: st.language()}
+	}
+	cxn.pl.SetAudioTracks(tracks)
+	for i, st := range audio[1:] {
+		track, pid := tracks[i+1], st.pid
+		data, err := tsSelectStreams(seg.Data, func(st pmtStream) bool { return st.pid == pid })
+		if err != nil {
+			return nil, err
+		}
+		uri, err := cxn.pl.GetOSSession().SaveData(fmt.Sprintf("%s/%d.ts", track.Name, seg.SeqNo), data)
+		if err != nil {
+			glog.Errorf("Error saving audio track nonce=%d seqNo=%d track=%s: %v", cxn.nonce, seg.SeqNo, track.Name, err)
+			continue
+		}
+		if err := cxn.pl.InsertHLSAudioSegment(track.Name, seg.SeqNo, uri, seg.Duration); err != nil {
+			glog.Errorf("Error inserting audio track segment nonce=%d seqNo=%d track=%s: %v", cxn.nonce, seg.SeqNo, track.Name, err)
+		}
+	}
+
+	main := audio[0].pid
+	return tsSelectStreams(seg.Data, func(st pmtStream) bool {
+		return !tsAudioStreamTypes[st.streamType] || st.pid == main
+	})
+}
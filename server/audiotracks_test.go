@@ -0,0 +1,45 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+)
+
+func TestPassthroughAudioTracks(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	storage := drivers.NewMemoryDriver(nil).NewSession("mid")
+	pl := core.NewBasicPlaylistManager("mid", storage)
+	cxn := &rtmpConnection{mid: "mid", pl: pl}
+
+	data, err := passthroughAudioTracks(cxn, &stream.HLSSegment{Data: testMultiAudioTS(), SeqNo: 3, Duration: 2})
+	require.Nil(err)
+	// The transcoded segment has the first audio track only
+	pids := packetPIDs(data)
+	assert.Contains(pids, uint16(testAudioPID))
+	assert.NotContains(pids, uint16(testAudio2PID))
+	assert.Contains(pids, uint16(testDataPID))
+
+	mpl := pl.GetHLSMediaPlaylist(audioTrackRendition(1))
+	require.NotNil(mpl)
+	require.Equal(uint(1), mpl.Count())
+	assert.Equal(2.0, mpl.Segments[0].Duration)
+	audio := storage.(*drivers.MemorySession).GetData(mpl.Segments[0].URI)
+	assert.Equal([]uint16{0, testPMTPID, testAudio2PID}, packetPIDs(audio))
+
+	// Segments with a single audio track are unchanged
+	ts := testTS(2)
+	data, err = passthroughAudioTracks(cxn, &stream.HLSSegment{Data: ts, SeqNo: 4})
+	require.Nil(err)
+	assert.Equal(ts, data)
+	data, err = passthroughAudioTracks(cxn, &stream.HLSSegment{})
+	assert.Nil(err)
+	assert.Empty(data)
+}
@@ -6,19 +6,24 @@ import (
 	"io/ioutil"
 	"math"
 	"math/big"
+	"math/rand"
 	"net/url"
 	"os"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/golang/glog"
 
 	ethcommon "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 
+	"github.com/livepeer/go-livepeer/clog"
 	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/core"
 	"github.com/livepeer/go-livepeer/drivers"
 	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/go-livepeer/net"
 	"github.com/livepeer/go-livepeer/pm"
 
 	"github.com/livepeer/lpms/ffmpeg"
@@ -27,9 +32,18 @@ import (
 
 var BroadcastCfg = &BroadcastConfig{}
 
+var logger = clog.New("server")
+
+// BroadcastPixelsVerification is set if the pixel counts that orchestrators report for the renditions
+// of a segment are checked by decoding the renditions when paying with tickets
+var BroadcastPixelsVerification = true
+
 type BroadcastConfig struct {
-	maxPrice *big.Rat
-	mu       sync.RWMutex
+	maxPrice             *big.Rat
+	paymentPipelineDepth int
+	durationTolerance    time.Duration
+	conditionSegments    bool
+	mu                   sync.RWMutex
 }
 
 func (cfg *BroadcastConfig) MaxPrice() *big.Rat {
@@ -39,9 +53,61 @@ func (cfg *BroadcastConfig) MaxPrice() *big.Rat {
 }
 
 func (cfg *BroadcastConfig) SetMaxPrice(price *big.Rat) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.maxPrice = price
+}
+
+// PaymentPipelineDepth returns the number of segments that are paid for ahead of
+// their submission. 0 if payments are sent with each segment
+func (cfg *BroadcastConfig) PaymentPipelineDepth() int {
 	cfg.mu.RLock()
 	defer cfg.mu.RUnlock()
-	cfg.maxPrice = price
+	return cfg.paymentPipelineDepth
+}
+
+// SetPaymentPipelineDepth sets the number of segments that are paid for ahead of their submission
+func (cfg *BroadcastConfig) SetPaymentPipelineDepth(depth int) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.paymentPipelineDepth = depth
+}
+
+// SegmentDurationTolerance returns the maximum difference between the durations of
+// a transcoded segment and its source segment. 0 if durations are not verified
+func (cfg *BroadcastConfig) SegmentDurationTolerance() time.Duration {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.durationTolerance
+}
+
+// SetSegmentDurationTolerance sets the maximum difference between the durations of
+// a transcoded segment and its source segment
+func (cfg *BroadcastConfig) SetSegmentDurationTolerance(tolerance time.Duration) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.durationTolerance = tolerance
+}
+
+// ConditionSegments returns whether ingested segments are re-cut on closed GOP boundaries
+// before they are sent to orchestrators
+func (cfg *BroadcastConfig) ConditionSegments() bool {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.conditionSegments
+}
+
+// SetConditionSegments sets whether ingested segments are re-cut on closed GOP boundaries
+func (cfg *BroadcastConfig) SetConditionSegments(condition bool) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.conditionSegments = condition
+}
+
+// orchInfoInvalidator is implemented by orchestrator pools that cache the infos of orchestrators,
+// so that the info of an orchestrator is no longer used after a session with it failed
+type orchInfoInvalidator interface {
+	Invalidate(transcoder string)
 }
 
 type BroadcastSessionsManager struct {
@@ -55,10 +121,66 @@ type BroadcastSessionsManager struct {
 	refreshing bool // only allow one refresh in-flight
 	finished   bool // set at stream end
 
+	// Resumption marks for the sessions that were not sent a segment since the
+	// stream was resumed, by transcoder URI
+	resumptions map[string]*net.StreamResumption
+
+	// Health observations of the orchestrators, if they are shared with other broadcasters
+	health *core.OrchestratorHealth
+	// Reputation of the orchestrators, if they are weighted by it
+	reputation *core.OrchestratorReputation
+	// Allowlist and denylist of the orchestrators, if they are filtered
+	lists *core.OrchestratorLists
+	// Orchestrator pool that caches the infos of the orchestrators, if any
+	invalidator orchInfoInvalidator
+	// Selects the session of each segment, if the default selection is not used
+	selection SelectionAlgorithm
+
 	createSessions func() ([]*BroadcastSession, error)
 }
 
 func (bsm *BroadcastSessionsManager) selectSession() *BroadcastSession {
+	return bsm.selectArmSession(nil)
+}
+
+// selectSegmentSession selects the session of a segment of a stream. With an A/B test that splits the
+// segments of the streams between its arms, the session is of an orchestrator of the arm of the segment.
+// With an orchestrator diversity requirement, the sessions of the orchestrators that the stream must
+// spread its segments over are preferred
+func (bsm *BroadcastSessionsManager) selectSegmentSession(mid core.ManifestID, seqNo uint64) *BroadcastSession {
+	var prefer func(transcoder string) bool
+	if BroadcastDiversity != nil {
+		prefer = BroadcastDiversity.prefer(mid)
+	}
+	var sess *BroadcastSession
+	if BroadcastABTest == nil {
+		sess = bsm.selectPreferredSession(nil, prefer)
+	} else {
+		arm := BroadcastABTest.segmentArm(mid, seqNo)
+		if BroadcastABTest.Mode() == ABTestStreams {
+			sess = bsm.selectPreferredSession(nil, prefer)
+		} else {
+			sess = bsm.selectPreferredSession(BroadcastABTest.arms[arm], prefer)
+		}
+		if sess != nil {
+			sess.ABTestArm = arm
+		}
+	}
+	if sess != nil && BroadcastDiversity != nil {
+		BroadcastDiversity.use(mid, sess.OrchestratorInfo.Transcoder)
+	}
+	return sess
+}
+
+// selectArmSession selects a session of an orchestrator of an arm of the A/B test with the selection
+// of the arm, if it has one. Any session is selected if arm is nil
+func (bsm *BroadcastSessionsManager) selectArmSession(arm *ABTestArm) *BroadcastSession {
+	return bsm.selectPreferredSession(arm, nil)
+}
+
+// selectPreferredSession selects a session like selectArmSession, among the sessions of the
+// orchestrators that prefer returns true for if there are any
+func (bsm *BroadcastSessionsManager) selectPreferredSession(arm *ABTestArm, prefer func(transcoder string) bool) *BroadcastSession {
 	bsm.sessLock.Lock()
 	defer bsm.sessLock.Unlock()
 
@@ -69,13 +191,53 @@ func (bsm *BroadcastSessionsManager) selectSession() *BroadcastSession {
 		}
 		return numSess > 0
 	}
+	selection := bsm.selection
+	if arm != nil && arm.Selection != nil {
+		selection = arm.Selection
+	}
 	for checkSessions(bsm) {
-		last := len(bsm.sessList) - 1
-		sess, sessions := bsm.sessList[last], bsm.sessList[:last]
-		bsm.sessList = sessions
-		if _, ok := bsm.sessMap[sess.OrchestratorInfo.Transcoder]; ok {
-			return sess
+		candidates := bsm.sessList
+		// Indices in sessList of the candidates, if they are not all the sessions
+		var indices []int
+		if arm != nil {
+			candidates = nil
+			for i, sess := range bsm.sessList {
+				if arm.allows(sess.OrchestratorInfo.Transcoder) {
+					candidates = append(candidates, sess)
+					indices = append(indices, i)
+				}
+			}
+			if len(candidates) == 0 {
+				return nil
+			}
 		}
+		if prefer != nil {
+			var preferred []*BroadcastSession
+			var preferredIndices []int
+			for i, sess := range candidates {
+				if prefer(sess.OrchestratorInfo.Transcoder) {
+					preferred = append(preferred, sess)
+					if indices != nil {
+						preferredIndices = append(preferredIndices, indices[i])
+					} else {
+						preferredIndices = append(preferredIndices, i)
+					}
+				}
+			}
+			// Any candidate is selected if none is preferred
+			if len(preferred) > 0 {
+				candidates, indices = preferred, preferredIndices
+			}
+		}
+		i := len(candidates) - 1
+		if selection != nil {
+			i = selection.Select(candidates)
+		}
+		if indices != nil {
+			i = indices[i]
+		}
+		sess := bsm.sessList[i]
+		bsm.sessList = append(bsm.sessList[:i], bsm.sessList[i+1:]...)
 		/*
 		   Don't select sessions no longer in the map.
 
@@ -84,6 +246,19 @@ func (bsm *BroadcastSessionsManager) selectSession() *BroadcastSession {
 		   To avoid a runtime search of the session list under lock, simply
 		   fixup the session list at selection time by retrying the selection.
 		*/
+		if _, ok := bsm.sessMap[sess.OrchestratorInfo.Transcoder]; !ok {
+			continue
+		}
+		// The orchestrator may have been found unhealthy, suspended or denied since the session was created
+		if !usableOrchestrator(bsm.health, sess.OrchestratorInfo.Transcoder) || (bsm.lists != nil && !bsm.lists.Allowed(sess.OrchestratorInfo)) {
+			glog.V(common.DEBUG).Infof("Dropping session of unusable orchestrator orch=%s", sess.OrchestratorInfo.Transcoder)
+			if sess.Balance != nil {
+				sess.Balance.Clear()
+			}
+			delete(bsm.sessMap, sess.OrchestratorInfo.Transcoder)
+			continue
+		}
+		return sess
 	}
 	return nil
 }
@@ -96,9 +271,46 @@ func (bsm *BroadcastSessionsManager) removeSession(session *BroadcastSession) {
 		session.Balance.Clear()
 	}
 
+	// Sessions may be removed more than once for the same segment, so only the first removal counts as a failure
+	if _, ok := bsm.sessMap[session.OrchestratorInfo.Transcoder]; ok {
+		if bsm.health != nil {
+			bsm.health.Failure(session.OrchestratorInfo.Transcoder)
+		}
+		if bsm.reputation != nil {
+			bsm.reputation.Failure(session.OrchestratorInfo.Transcoder)
+		}
+		if bsm.invalidator != nil {
+			bsm.invalidator.Invalidate(session.OrchestratorInfo.Transcoder)
+		}
+		if BroadcastABTest != nil {
+			BroadcastABTest.Failure(session.ABTestArm)
+		}
+	}
 	delete(bsm.sessMap, session.OrchestratorInfo.Transcoder)
 }
 
+// usableOrchestrator returns whether segments can be sent to the orchestrator at uri, which
+// is not the case if it is unhealthy or suspended for failing the verification of its segments
+func usableOrchestrator(health *core.OrchestratorHealth, uri string) bool {
+	if health != nil && health.Unhealthy(uri) {
+		return false
+	}
+	return BroadcastVerification == nil || !BroadcastVerification.Suspended(uri)
+}
+
+// observeLatency records the latency of a segment that was transcoded by the orchestrator of a session
+func (bsm *BroadcastSessionsManager) observeLatency(sess *BroadcastSession, latency time.Duration) {
+	if bsm.health != nil {
+		bsm.health.Success(sess.OrchestratorInfo.Transcoder, latency)
+	}
+	if bsm.reputation != nil {
+		bsm.reputation.Success(sess.OrchestratorInfo.Transcoder, latency)
+	}
+	if obs, ok := bsm.selection.(latencyObserver); ok {
+		obs.ObserveLatency(sess.OrchestratorInfo.Transcoder, latency)
+	}
+}
+
 func (bsm *BroadcastSessionsManager) completeSession(sess *BroadcastSession) {
 	bsm.sessLock.Lock()
 	defer bsm.sessLock.Unlock()
@@ -108,6 +320,40 @@ func (bsm *BroadcastSessionsManager) completeSession(sess *BroadcastSession) {
 	}
 }
 
+// migrateSession removes a session whose orchestrator asked to move the stream to another
+// orchestrator. Unlike removeSession, it is not counted as a failure of the orchestrator
+func (bsm *BroadcastSessionsManager) migrateSession(sess *BroadcastSession) {
+	bsm.sessLock.Lock()
+	defer bsm.sessLock.Unlock()
+
+	if sess.Balance != nil {
+		sess.Balance.Clear()
+	}
+	delete(bsm.sessMap, sess.OrchestratorInfo.Transcoder)
+}
+
+// resume marks the existing sessions so that their orchestrators are told that the stream
+// was resumed after the segment lastSeq with the next segment that they are sent
+func (bsm *BroadcastSessionsManager) resume(lastSeq int64) {
+	bsm.sessLock.Lock()
+	defer bsm.sessLock.Unlock()
+
+	bsm.resumptions = make(map[string]*net.StreamResumption)
+	for uri := range bsm.sessMap {
+		bsm.resumptions[uri] = &net.StreamResumption{LastSeq: lastSeq}
+	}
+}
+
+// takeResumption returns the resumption mark of a session, if any, and clears it
+func (bsm *BroadcastSessionsManager) takeResumption(sess *BroadcastSession) *net.StreamResumption {
+	bsm.sessLock.Lock()
+	defer bsm.sessLock.Unlock()
+
+	r := bsm.resumptions[sess.OrchestratorInfo.Transcoder]
+	delete(bsm.resumptions, sess.OrchestratorInfo.Transcoder)
+	return r
+}
+
 func (bsm *BroadcastSessionsManager) refreshSessions() {
 
 	glog.V(common.DEBUG).Info("Starting session refresh")
@@ -175,6 +421,31 @@ func NewSessionManager(node *core.LivepeerNode, params *streamParameters, pl cor
 		createSessions: func() ([]*BroadcastSession, error) { return selectOrchestrator(node, params, pl, numOrchs) },
 		sessLock:       &sync.Mutex{},
 		numOrchs:       numOrchs,
+		health:         node.OrchHealth,
+		reputation:     node.OrchReputation,
+		lists:          node.OrchLists,
+		selection:      BroadcastSelection,
+	}
+	if inv, ok := node.OrchestratorPool.(orchInfoInvalidator); ok {
+		bsm.invalidator = inv
+	}
+	if BroadcastABTest != nil {
+		// Segments that are split between the arms are selected with the selection of their arm
+		if arm := BroadcastABTest.Arm(params.mid); arm.Selection != nil && BroadcastABTest.Mode() == ABTestStreams {
+			bsm.selection = arm.Selection
+		}
+		BroadcastABTest.Stream(params.mid)
+	}
+	if FirstSegmentFastPath {
+		// The first segment is sent to orchestrators while the sessions of the stream are created
+		if sessions := fastPathSessionList(node, params, pl); len(sessions) > 0 {
+			for _, sess := range sessions {
+				bsm.sessMap[sess.OrchestratorInfo.Transcoder] = sess
+			}
+			bsm.sessList = sessions
+			go bsm.refreshSessions()
+			return bsm
+		}
 	}
 	bsm.refreshSessions()
 	return bsm
@@ -197,14 +468,44 @@ func selectOrchestrator(n *core.LivepeerNode, params *streamParameters, cpl core
 		return nil, err
 	}
 
+	candidates := make([]*net.OrchestratorInfo, 0, len(tinfos))
+	for _, tinfo := range tinfos {
+		if !usableOrchestrator(n.OrchHealth, tinfo.Transcoder) {
+			glog.V(common.DEBUG).Infof("Skipping unusable orchestrator orch=%s", tinfo.Transcoder)
+			continue
+		}
+		if n.OrchLists != nil && !n.OrchLists.Allowed(tinfo) {
+			glog.V(common.DEBUG).Infof("Skipping orchestrator filtered by the orchestrator lists orch=%s", tinfo.Transcoder)
+			continue
+		}
+		if err := checkTicketExpiration(tinfo); err != nil {
+			glog.Warningf("Skipping orchestrator with incompatible ticket expiration orch=%s: %v", tinfo.Transcoder, err)
+			continue
+		}
+		if BroadcastABTest != nil && !BroadcastABTest.allows(params.mid, tinfo.Transcoder) {
+			glog.V(common.DEBUG).Infof("Skipping orchestrator outside of the A/B test arm of the stream manifestID=%s orch=%s", params.mid, tinfo.Transcoder)
+			continue
+		}
+		if required := core.RequiredCapabilities(params.encoders); !core.HasCapabilities(tinfo.Capabilities, required) {
+			glog.V(common.DEBUG).Infof("Skipping orchestrator without the capabilities of the stream's profiles manifestID=%s orch=%s capabilities=%v", params.mid, tinfo.Transcoder, required)
+			continue
+		}
+		candidates = append(candidates, tinfo)
+	}
+
+	var scores map[string]float64
+	if BroadcastScorer != nil {
+		candidates, scores = scoreOrchestrators(BroadcastScorer, n, params, candidates)
+	}
+
 	var sessions []*BroadcastSession
 
-	for _, tinfo := range tinfos {
+	for _, tinfo := range candidates {
 		var sessionID string
 		var balance Balance
 
 		if n.Sender != nil {
-			sessionID = n.Sender.StartSession(*pmTicketParams(tinfo.TicketParams))
+			sessionID = startPMSession(n, params.mid, tinfo)
 		}
 
 		if n.Balances != nil {
@@ -216,94 +517,319 @@ func selectOrchestrator(n *core.LivepeerNode, params *streamParameters, cpl core
 			orchOS = drivers.NewSession(tinfo.Storage[0])
 		}
 
-		bcastOS := cpl.GetOSSession()
-		if bcastOS.IsExternal() {
-			// Give each O its own OS session to prevent front running uploads
-			pfx := fmt.Sprintf("%v/%v", cpl.ManifestID(), core.RandomManifestID())
-			bcastOS = drivers.NodeStorage.NewSession(pfx)
-		}
-
 		session := &BroadcastSession{
 			Broadcaster:      rpcBcast,
 			ManifestID:       params.mid,
 			Profiles:         params.profiles,
+			Encoders:         params.encoders,
 			OrchestratorInfo: tinfo,
 			OrchestratorOS:   orchOS,
-			BroadcasterOS:    bcastOS,
+			BroadcasterOS:    broadcasterOS(cpl),
 			Sender:           n.Sender,
 			PMSessionID:      sessionID,
 			Balance:          balance,
 		}
+		if BroadcastABTest != nil {
+			session.ABTestArm = BroadcastABTest.index(params.mid)
+		}
 
 		sessions = append(sessions, session)
+
+		if n.OrchReputation != nil && tinfo.PriceInfo != nil && tinfo.PriceInfo.PixelsPerUnit > 0 {
+			n.OrchReputation.ObservePrice(tinfo.Transcoder, big.NewRat(tinfo.PriceInfo.PricePerUnit, tinfo.PriceInfo.PixelsPerUnit))
+		}
+	}
+	if scores != nil {
+		// Sessions are selected from the end of the list, so the orchestrators with the highest scores are used first
+		sort.SliceStable(sessions, func(i, j int) bool {
+			return scores[sessions[i].OrchestratorInfo.Transcoder] < scores[sessions[j].OrchestratorInfo.Transcoder]
+		})
+	} else if n.OrchReputation != nil {
+		orderByReputation(n.OrchReputation, sessions)
+	} else if BroadcastVerification != nil {
+		// Sessions are selected from the end of the list, so the most trusted orchestrators are used first
+		sort.SliceStable(sessions, func(i, j int) bool {
+			return BroadcastVerification.Trust(sessions[i].OrchestratorInfo.Transcoder) < BroadcastVerification.Trust(sessions[j].OrchestratorInfo.Transcoder)
+		})
 	}
 	return sessions, nil
 }
 
+// broadcasterOS returns the storage of the broadcaster for a session of a stream
+func broadcasterOS(cpl core.PlaylistManager) drivers.OSSession {
+	bcastOS := cpl.GetOSSession()
+	if bcastOS.IsExternal() {
+		// Give each O its own OS session to prevent front running uploads
+		pfx := fmt.Sprintf("%v/%v", streamStoragePath(cpl.ManifestID()), string(core.RandomManifestID()))
+		bcastOS = drivers.NodeStorage.NewSession(pfx)
+	}
+	return bcastOS
+}
+
+// selectionRand returns the random numbers that sessions are ordered with. Replaced in tests
+var selectionRand = rand.Float64
+
+// orderByReputation shuffles the sessions so that the orchestrators are selected with a probability
+// weighted by their reputation score, and by the trust in their segments if they are verified.
+// Sessions are selected from the end of the list
+func orderByReputation(reputation *core.OrchestratorReputation, sessions []*BroadcastSession) {
+	keys := make(map[*BroadcastSession]float64, len(sessions))
+	for _, sess := range sessions {
+		weight := reputation.Score(sess.OrchestratorInfo.Transcoder)
+		if BroadcastVerification != nil {
+			weight *= BroadcastVerification.Trust(sess.OrchestratorInfo.Transcoder)
+		}
+		// Sorting by u^(1/w) samples the sessions without replacement with weights w
+		keys[sess] = math.Pow(selectionRand(), 1/math.Max(weight, 1e-6))
+	}
+	sort.SliceStable(sessions, func(i, j int) bool { return keys[sessions[i]] < keys[sessions[j]] })
+}
+
+// resumedPMSessions holds the IDs of the persisted PM sessions that have been resumed by this process,
+// in a *sync.Map per manifest ID. The IDs of a stream are released when the stream ends
+var resumedPMSessions sync.Map
+
+// pmSessionsResumed returns the IDs of the PM sessions resumed for a stream by this process
+func pmSessionsResumed(mid core.ManifestID) *sync.Map {
+	ids, _ := resumedPMSessions.LoadOrStore(mid, &sync.Map{})
+	return ids.(*sync.Map)
+}
+
+// releaseResumedPMSessions releases the IDs of the PM sessions resumed for a stream when it ends
+func releaseResumedPMSessions(mid core.ManifestID) {
+	resumedPMSessions.Delete(mid)
+}
+
+// startPMSession starts a PM session to pay an orchestrator for a stream. If the broadcaster
+// paid the orchestrator for the stream before a restart, the persisted PM session is resumed
+// instead so that the stream continues with the same ticket params and senderNonce sequence.
+// A persisted PM session is resumed at most once so that a session rejected by the
+// orchestrator is replaced by one using fresh ticket params
+func startPMSession(n *core.LivepeerNode, mid core.ManifestID, tinfo *net.OrchestratorInfo) string {
+	log := logger.With(clog.ManifestID, mid, clog.Orchestrator, tinfo.Transcoder)
+	if n.Database != nil {
+		prevID, err := n.Database.BroadcastPMSession(string(mid), tinfo.Transcoder)
+		if err != nil {
+			log.Errorf("Error loading PM session: %v", err)
+		} else if prevID != "" {
+			if _, resumed := pmSessionsResumed(mid).LoadOrStore(prevID, true); !resumed {
+				if err := n.Sender.ResumeSession(prevID); err == nil {
+					log.Infof("Resumed PM session sessionID=%v", prevID)
+					return prevID
+				}
+				log.Errorf("Error resuming PM session sessionID=%v: %v", prevID, err)
+			}
+		}
+	}
+
+	sessionID := n.Sender.StartSession(*pmTicketParams(tinfo.TicketParams))
+	// A newly started session must not be replaced by an older persisted one within this process
+	pmSessionsResumed(mid).Store(sessionID, true)
+
+	if n.Database != nil {
+		if err := n.Database.StoreBroadcastPMSession(string(mid), tinfo.Transcoder, sessionID); err != nil {
+			log.Errorf("Error storing PM session: %v", err)
+		}
+	}
+
+	return sessionID
+}
+
+// WarmPMSessions starts PM sessions with the orchestrators of infos that the broadcaster sent the
+// most segments to, at most max of them, so that the first streams after a restart don't wait for
+// the senderNonces of the sessions to be loaded or for the deposit of the broadcaster to be fetched.
+// PM sessions are identified by their ticket params, so the streams that get the same ticket params
+// continue these sessions. Returns the number of sessions started
+func WarmPMSessions(n *core.LivepeerNode, infos []*net.OrchestratorInfo, max int) int {
+	if n.Sender == nil || n.Database == nil {
+		return 0
+	}
+	stats, err := n.Database.OrchestratorStats()
+	if err != nil {
+		glog.Errorf("Error loading orchestrator stats: %v", err)
+		return 0
+	}
+	segments := make(map[string]int64, len(stats))
+	for _, s := range stats {
+		segments[s.Orchestrator] = s.Segments
+	}
+	infos = append([]*net.OrchestratorInfo{}, infos...)
+	sort.SliceStable(infos, func(i, j int) bool { return segments[infos[i].Transcoder] > segments[infos[j].Transcoder] })
+
+	started := 0
+	for _, tinfo := range infos {
+		if started >= max || segments[tinfo.Transcoder] == 0 {
+			break
+		}
+		params := pmTicketParams(tinfo.TicketParams)
+		if params == nil {
+			continue
+		}
+		if err := n.Sender.ValidateTicketParams(params); err != nil {
+			glog.Warningf("Not starting PM session orch=%s: %v", tinfo.Transcoder, err)
+			continue
+		}
+		n.Sender.StartSession(*params)
+		started++
+	}
+	return started
+}
+
 func processSegment(cxn *rtmpConnection, seg *stream.HLSSegment) error {
 
 	nonce := cxn.nonce
 	cpl := cxn.pl
 	mid := cxn.mid
 	vProfile := cxn.profile
+	log := logger.With(clog.ManifestID, mid, clog.Nonce, nonce, clog.SeqNo, seg.SeqNo)
 
-	glog.V(common.DEBUG).Infof("Processing segment nonce=%d seqNo=%d", nonce, seg.SeqNo)
+	log.V(common.DEBUG).Infof("Processing segment")
 	if monitor.Enabled {
 		monitor.SegmentEmerged(nonce, seg.SeqNo, len(BroadcastJobVideoProfiles))
 	}
+	// The trace of the segment is kept once it is transcoded or given up on
+	trace := newSegmentTrace(mid, seg.SeqNo, seg.Duration)
+	defer trace.finish()
+
+	// Segments of streams whose API key used its minutes or spend of the day are not transcoded
+	if BroadcastQuotas != nil {
+		if err := BroadcastQuotas.Segment(mid, time.Duration(seg.Duration*float64(time.Second))); err != nil {
+			log.Errorf("Dropping segment over quota: %v", err)
+			trace.fail(err)
+			cxn.segmentFailed(seg.SeqNo, err)
+			return err
+		}
+	}
+
+	// Alternate audio tracks are passed through and the source keeps only the first one
+	if data, err := passthroughAudioTracks(cxn, seg); err != nil {
+		log.V(common.DEBUG).Infof("Unable to pass through audio tracks: %v", err)
+	} else {
+		seg.Data = data
+	}
+
+	// Renditions can only be cut on the same frames as the source if the source starts on a closed GOP.
+	// RTMP segments are re-cut on closed GOP boundaries if -conditionSegments is set
+	if info, err := common.InspectTS(seg.Data); err != nil {
+		log.V(common.DEBUG).Infof("Unable to inspect segment: %v", err)
+	} else if !info.StartsWithIDR {
+		log.Warningf("Segment does not start on a closed GOP boundary")
+	}
 
 	seg.Name = "" // hijack seg.Name to convey the uploaded URI
 	name := fmt.Sprintf("%s/%d.ts", vProfile.Name, seg.SeqNo)
+	_, ingestSpan := trace.startSpan("ingest")
 	uri, err := cpl.GetOSSession().SaveData(name, seg.Data)
 	if err != nil {
-		glog.Errorf("Error saving segment nonce=%d seqNo=%d: %v", nonce, seg.SeqNo, err)
+		log.Errorf("Error saving segment: %v", err)
 		if monitor.Enabled {
 			monitor.SegmentUploadFailed(nonce, seg.SeqNo, monitor.SegmentUploadErrorUnknown, err.Error(), true)
 		}
+		monitor.EndSpan(ingestSpan, err)
+		trace.fail(err)
+		cxn.segmentFailed(seg.SeqNo, err)
 		return err
 	}
 	if cpl.GetOSSession().IsExternal() {
 		seg.Name = uri // hijack seg.Name to convey the uploaded URI
 	}
 	err = cpl.InsertHLSSegment(vProfile, seg.SeqNo, uri, seg.Duration)
+	monitor.EndSpan(ingestSpan, err)
 	if monitor.Enabled {
 		monitor.SourceSegmentAppeared(nonce, seg.SeqNo, string(mid), vProfile.Name)
 	}
+	if cxn.thumbnails != nil {
+		cxn.thumbnails.schedule(seg.SeqNo, seg.Duration)
+		cxn.thumbnails.segment(vProfile.Name, seg.SeqNo, seg.Data)
+	}
 	if err != nil {
-		glog.Errorf("Error inserting segment nonce=%d seqNo=%d: %v", nonce, seg.SeqNo, err)
+		log.Errorf("Error inserting segment: %v", err)
 		if monitor.Enabled {
 			monitor.SegmentUploadFailed(nonce, seg.SeqNo, monitor.SegmentUploadErrorUnknown, err.Error(), true)
 		}
 	}
 
+	// A sample of the segments is also sent to the other arm of the A/B test, if it duplicates them
+	if BroadcastABTest != nil {
+		if arm, ok := BroadcastABTest.duplicate(mid); ok {
+			dup := *seg
+			go duplicateSegment(cxn, &dup, name, arm)
+		}
+	}
+
 	for {
 		// if fails, retry; rudimentary
-		if err := transcodeSegment(cxn, seg, name); err == nil {
+		err := transcodeSegment(cxn, seg, name, trace)
+		if err == nil {
 			return nil
 		}
+		// Retrying does not help without sessions. The segment is still served untranscoded
+		if err == errNoOrchs {
+			return err
+		}
+		cxn.segmentFailed(seg.SeqNo, err)
+		seqNo := seg.SeqNo
+		notifyStreamEvent(cxn, &StreamEvent{Event: StreamEventTranscodeError, SeqNo: &seqNo, Error: err.Error()})
 	}
 }
 
-func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string) error {
+func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string, trace *SegmentTrace) (err error) {
 
 	nonce := cxn.nonce
+	log := logger.With(clog.ManifestID, cxn.mid, clog.Nonce, nonce, clog.SeqNo, seg.SeqNo)
 	rtmpStrm := cxn.stream
 	cpl := cxn.pl
-	sess := cxn.sessManager.selectSession()
+	sess := cxn.sessManager.selectSegmentSession(cxn.mid, seg.SeqNo)
 	// Return early under a few circumstances:
 	// View-only (non-transcoded) streams or no sessions available
 	if sess == nil {
 		if monitor.Enabled {
 			monitor.SegmentTranscodeFailed(monitor.SegmentTranscodeErrorNoOrchestrators, nonce, seg.SeqNo, errNoOrchs, true)
 		}
-		glog.Infof("No sessions available for segment nonce=%d seqNo=%d", nonce, seg.SeqNo)
-		// We may want to introduce a "non-retryable" error type here
-		// would help error propagation for live ingest.
-		// similar to the orchestrator's RemoteTranscoderFatalError
-		return nil
+		log.Infof("No sessions available for segment")
+		cxn.segmentFailed(seg.SeqNo, errNoOrchs)
+		seqNo := seg.SeqNo
+		notifyStreamEvent(cxn, &StreamEvent{Event: StreamEventTranscodeError, SeqNo: &seqNo, Error: errNoOrchs.Error()})
+		return errNoOrchs
+	}
+	switchOrchestrator(cxn, sess.OrchestratorInfo.Transcoder)
+	attempt := trace.attempt(sess.OrchestratorInfo.Transcoder)
+	defer func() {
+		attempt.fail(err)
+		attempt.end()
+	}()
+	// The stream's profiles may have changed since the session was last used
+	if profiles := cxn.getProfiles(); profiles != nil {
+		sess.Profiles, sess.Encoders = profiles, cxn.getEncoders()
+	}
+	// Tell the orchestrator that the stream was resumed if this is the first segment it gets since
+	sess.Resumption = cxn.sessManager.takeResumption(sess)
+	// Capture the profiles so that the results are matched with the profiles they were requested for
+	// even if the session is used for another segment before the results are downloaded
+	profiles, encoders := sess.Profiles, sess.Encoders
+	// Adjust the bitrates, and resolutions if configured, of the profiles to the complexity of the segment.
+	// Playlists still use the unadjusted profiles so the advertised renditions do not change
+	if cxn.ladder != nil && profiles != nil {
+		// Segment creds sort the submitted profiles in place so sort the captured profiles
+		// to match the order of the results
+		sort.Sort(ffmpeg.ByName(profiles))
+		complexity := cxn.ladder.EstimateComplexity(seg.Data, seg.Duration)
+		sess.Profiles = cxn.ladder.Adjust(profiles, complexity)
+		sess.Complexity = complexity
+		log.V(common.DEBUG).Infof("Adjusted profiles for segment complexity=%v scale=%v", complexity, cxn.ladder.Scale(complexity))
+	}
+	// Inspect the source segment to verify the durations of the transcoded segments against it
+	tolerance := BroadcastCfg.SegmentDurationTolerance()
+	var source *common.TSInfo
+	if tolerance > 0 {
+		info, err := common.InspectTS(seg.Data)
+		if err != nil {
+			log.Errorf("Unable to inspect segment for duration verification: %v", err)
+		}
+		source = info
 	}
 	{
-		glog.Infof("Trying to transcode segment nonce=%d seqNo=%d", nonce, seg.SeqNo)
+		log.Infof("Trying to transcode segment")
 		if monitor.Enabled {
 			monitor.TranscodeTry(nonce, seg.SeqNo)
 		}
@@ -313,7 +839,7 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string)
 			// XXX handle case when orch expects direct upload
 			uri, err := ios.SaveData(name, seg.Data)
 			if err != nil {
-				glog.Errorf("Error saving segment to OS nonce=%d seqNo=%d: %v", nonce, seg.SeqNo, err)
+				log.Errorf("Error saving segment to OS: %v", err)
 				if monitor.Enabled {
 					monitor.SegmentUploadFailed(nonce, seg.SeqNo, monitor.SegmentUploadErrorOS, err.Error(), false)
 				}
@@ -324,16 +850,20 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string)
 		}
 
 		// send segment to the orchestrator
-		glog.V(common.DEBUG).Infof("Submitting segment nonce=%d seqNo=%d orch=%s", nonce, seg.SeqNo, sess.OrchestratorInfo.Transcoder)
+		log.With(clog.Orchestrator, sess.OrchestratorInfo.Transcoder).V(common.DEBUG).Infof("Submitting segment")
 
+		start := time.Now()
+		sess.Trace = attempt
 		res, err := SubmitSegment(sess, seg, nonce)
+		// Restore the unadjusted profiles before the session is reused
+		sess.Profiles, sess.Complexity, sess.Resumption, sess.Trace = profiles, 0, nil, nil
 		if err != nil || res == nil {
 			cxn.sessManager.removeSession(sess)
 			if res == nil && err == nil {
 				return errors.New("Empty response")
 			}
 			if shouldStopStream(err) {
-				glog.Warningf("Stopping current stream due to: %v", err)
+				log.Warningf("Stopping current stream due to: %v", err)
 				rtmpStrm.Close()
 				return err
 			}
@@ -342,13 +872,28 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string)
 			return err
 		}
 
-		cxn.sessManager.completeSession(sess)
+		latency := time.Since(start)
+		cxn.sessManager.observeLatency(sess, latency)
+		abTestArm := sess.ABTestArm
+		if BroadcastABTest != nil {
+			BroadcastABTest.Segment(abTestArm, seg.Duration, latency)
+		}
+
+		if sess.Migrate {
+			// The result is used, but the next segments are sent to other orchestrators
+			log.Infof("Orchestrator asked to migrate the stream")
+			cxn.sessManager.migrateSession(sess)
+		} else {
+			// Pay for the upcoming segments in the background
+			prefundSession(sess)
+			cxn.sessManager.completeSession(sess)
+		}
 
 		// download transcoded segments from the transcoder
 		gotErr := false // only send one error msg per segment list
 		var errCode monitor.SegmentTranscodeError
 		errFunc := func(subType monitor.SegmentTranscodeError, url string, err error) {
-			glog.Errorf("%v error with segment nonce=%d seqNo=%d: %v (URL: %v)", subType, nonce, seg.SeqNo, err, url)
+			log.Errorf("%v error with segment: %v (URL: %v)", subType, err, url)
 			if monitor.Enabled && !gotErr {
 				monitor.SegmentTranscodeFailed(subType, nonce, seg.SeqNo, err, false)
 				gotErr = true
@@ -361,6 +906,11 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string)
 		n := len(res.Segments)
 		segHashLock := &sync.Mutex{}
 		cond := sync.NewCond(segHashLock)
+		// Renditions of sampled segments, which are verified once they are all downloaded. Protected by segHashLock
+		var verified []*VerificationRendition
+		if BroadcastVerification != nil && BroadcastVerification.Sample(sess.OrchestratorInfo.Transcoder) {
+			verified = make([]*VerificationRendition, len(res.Segments))
+		}
 
 		dlFunc := func(url string, pixels int64, i int) {
 			defer func() {
@@ -372,8 +922,10 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string)
 				cond.L.Unlock()
 			}()
 
+			var data []byte
 			if bos := sess.BroadcasterOS; bos != nil && !drivers.IsOwnExternal(url) {
-				data, err := drivers.GetSegmentData(url)
+				var err error
+				data, err = drivers.GetSegmentData(url)
 				if err != nil {
 					errFunc(monitor.SegmentTranscodeErrorDownload, url, err)
 					segHashLock.Lock()
@@ -382,7 +934,7 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string)
 					cxn.sessManager.removeSession(sess)
 					return
 				}
-				name := fmt.Sprintf("%s/%d.ts", sess.Profiles[i].Name, seg.SeqNo)
+				name := fmt.Sprintf("%s/%d%s", profiles[i].Name, seg.SeqNo, encoders.SegmentExtension(profiles[i].Name))
 				newURL, err := bos.SaveData(name, data)
 				if err != nil {
 					segHashLock.Lock()
@@ -402,28 +954,48 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string)
 				segHashLock.Lock()
 				segHashes[i] = hash
 				segHashLock.Unlock()
+
+				if cxn.thumbnails != nil {
+					cxn.thumbnails.segment(profiles[i].Name, seg.SeqNo, data)
+				}
+
+				if source != nil {
+					if err := verifyDuration(source, profiles[i], data, tolerance); err != nil {
+						log.Errorf("Duration verification failed for segment profile=%v: %v", profiles[i].Name, err)
+						cxn.sessManager.removeSession(sess)
+					}
+				}
 			}
 
-			// If running in on-chain mode, run pixels verification asynchronously
-			if sess.Sender != nil {
+			// If running in on-chain mode, run pixels verification asynchronously.
+			// Audio-only renditions are charged for their duration, which is verified with the other durations
+			if sess.Sender != nil && BroadcastPixelsVerification && !common.AudioOnlyProfile(profiles[i]) {
 				go func() {
 					if err := verifyPixels(url, sess.BroadcasterOS, pixels); err != nil {
-						glog.Error(err)
+						log.Errorf("%v", err)
 						cxn.sessManager.removeSession(sess)
 					}
 				}()
 			}
 
+			if verified != nil {
+				segHashLock.Lock()
+				verified[i] = &VerificationRendition{Profile: profiles[i], URI: url, Data: data, Pixels: pixels}
+				segHashLock.Unlock()
+			}
+
 			if monitor.Enabled {
-				monitor.TranscodedSegmentAppeared(nonce, seg.SeqNo, sess.Profiles[i].Name)
+				monitor.TranscodedSegmentAppeared(nonce, seg.SeqNo, profiles[i].Name)
 			}
-			err = cpl.InsertHLSSegment(&sess.Profiles[i], seg.SeqNo, url, seg.Duration)
+			err = cpl.InsertHLSSegment(&profiles[i], seg.SeqNo, url, seg.Duration)
 			if err != nil {
 				errFunc(monitor.SegmentTranscodeErrorPlaylist, url, err)
 				return
 			}
 		}
 
+		dlStart := time.Now()
+		_, dlSpan := attempt.startSpan("download")
 		for i, v := range res.Segments {
 			go dlFunc(v.Url, v.Pixels, i)
 		}
@@ -433,6 +1005,12 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string)
 			cond.Wait()
 		}
 		cond.L.Unlock()
+		attempt.download(time.Since(dlStart))
+		if dlErr != nil {
+			monitor.EndSpan(dlSpan, dlErr)
+		} else {
+			monitor.EndSpan(dlSpan, saveErr)
+		}
 		if dlErr != nil {
 			return dlErr
 		}
@@ -443,20 +1021,81 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string)
 			// TODO: Consider downloading the results to generate seg hashes if results are directly uploaded to the broadcaster's OS
 			len(segHashes) != len(res.Segments) &&
 			!pm.VerifySig(ethcommon.BytesToAddress(ticketParams.Recipient), crypto.Keccak256(segHashes...), res.Sig) {
-			glog.Errorf("Sig check failed for segment nonce=%d seqNo=%d", nonce, seg.SeqNo)
+			log.Errorf("Sig check failed for segment")
 			cxn.sessManager.removeSession(sess)
 			return errPMCheckFailed
 		}
+		if verified != nil && saveErr == nil {
+			go verifySegment(cxn, sess, seg, verified, abTestArm)
+		}
 		if monitor.Enabled {
-			monitor.SegmentFullyTranscoded(nonce, seg.SeqNo, common.ProfilesNames(sess.Profiles), errCode)
+			monitor.SegmentFullyTranscoded(nonce, seg.SeqNo, common.ProfilesNames(profiles), errCode)
 		}
 
-		glog.V(common.DEBUG).Infof("Successfully validated segment nonce=%d seqNo=%d", nonce, seg.SeqNo)
+		cxn.segmentTranscoded(seg.SeqNo, sess.OrchestratorInfo.Transcoder, time.Since(start))
+		log.V(common.DEBUG).Infof("Successfully validated segment")
 		return nil
 	}
 }
 
-var sessionErrStrings = []string{"dial tcp", "unexpected EOF", core.ErrOrchBusy.Error(), core.ErrOrchCap.Error()}
+// duplicateSegment sends a copy of a segment to an orchestrator of an arm of the A/B test, to compare
+// the arm with the orchestrator that transcodes the segment. The renditions of the copy are verified
+// if segments are verified, but not inserted into the playlists
+func duplicateSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string, arm int) {
+	log := logger.With(clog.ManifestID, cxn.mid, clog.Nonce, cxn.nonce, clog.SeqNo, seg.SeqNo)
+	sess := cxn.sessManager.selectArmSession(BroadcastABTest.arms[arm])
+	if sess == nil {
+		log.V(common.DEBUG).Infof("No sessions available for duplicate segment arm=%v", BroadcastABTest.arms[arm].Name)
+		return
+	}
+	sess.ABTestArm = arm
+	BroadcastABTest.Duplicate(arm)
+	if profiles := cxn.getProfiles(); profiles != nil {
+		sess.Profiles, sess.Encoders = profiles, cxn.getEncoders()
+	}
+	profiles := sess.Profiles
+
+	if ios := sess.OrchestratorOS; ios != nil {
+		uri, err := ios.SaveData(name, seg.Data)
+		if err != nil {
+			log.Errorf("Error saving duplicate segment to OS: %v", err)
+			cxn.sessManager.removeSession(sess)
+			return
+		}
+		seg.Name = uri
+	}
+
+	log.With(clog.Orchestrator, sess.OrchestratorInfo.Transcoder).V(common.DEBUG).Infof("Submitting duplicate segment arm=%v", BroadcastABTest.arms[arm].Name)
+	sess.Resumption = cxn.sessManager.takeResumption(sess)
+	start := time.Now()
+	res, err := SubmitSegment(sess, seg, cxn.nonce)
+	sess.Resumption = nil
+	if err != nil || res == nil {
+		log.Errorf("Error submitting duplicate segment orch=%s: %v", sess.OrchestratorInfo.Transcoder, err)
+		cxn.sessManager.removeSession(sess)
+		return
+	}
+	latency := time.Since(start)
+	cxn.sessManager.observeLatency(sess, latency)
+	BroadcastABTest.Segment(arm, seg.Duration, latency)
+	if sess.Migrate {
+		cxn.sessManager.migrateSession(sess)
+	} else {
+		prefundSession(sess)
+		cxn.sessManager.completeSession(sess)
+	}
+
+	if BroadcastVerification == nil || len(res.Segments) != len(profiles) {
+		return
+	}
+	renditions := make([]*VerificationRendition, len(res.Segments))
+	for i, v := range res.Segments {
+		renditions[i] = &VerificationRendition{Profile: profiles[i], URI: v.Url, Pixels: v.Pixels}
+	}
+	verifySegment(cxn, sess, seg, renditions, arm)
+}
+
+var sessionErrStrings = []string{"dial tcp", "unexpected EOF", core.ErrOrchBusy.Error(), core.ErrOrchCap.Error(), core.ErrOrchDraining.Error()}
 
 var sessionErrRegex = common.GenErrRegex(sessionErrStrings)
 
@@ -464,6 +1103,32 @@ func shouldStopSession(err error) bool {
 	return sessionErrRegex.MatchString(err.Error())
 }
 
+// verifyDuration checks that the duration of a transcoded segment is within tolerance of the duration of its source segment.
+// The duration of the audio track is checked for audio-only renditions
+func verifyDuration(source *common.TSInfo, profile ffmpeg.VideoProfile, data []byte, tolerance time.Duration) error {
+	var duration float64
+	if common.AudioOnlyProfile(profile) {
+		d, err := common.TSAudioDuration(data)
+		if err != nil {
+			return err
+		}
+		duration = d
+	} else {
+		info, err := common.InspectTS(data)
+		if err != nil {
+			return err
+		}
+		duration = info.Duration
+	}
+
+	diff := time.Duration(math.Abs(duration-source.Duration) * float64(time.Second))
+	if diff > tolerance {
+		return fmt.Errorf("mismatch between source duration %.3fs and transcoded duration %.3fs", source.Duration, duration)
+	}
+
+	return nil
+}
+
 func verifyPixels(fname string, bos drivers.OSSession, reportedPixels int64) error {
 	uri, err := url.ParseRequestURI(fname)
 	memOS, ok := bos.(*drivers.MemorySession)
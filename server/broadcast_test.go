@@ -1,10 +1,13 @@
 package server
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -20,6 +23,7 @@ import (
 	"github.com/livepeer/m3u8"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -66,6 +70,18 @@ func (pm *stubPlaylistManager) InsertHLSSegment(profile *ffmpeg.VideoProfile, se
 	return nil
 }
 
+func (pm *stubPlaylistManager) InsertHLSPart(profile *ffmpeg.VideoProfile, seqNo uint64, part *core.LLHLSPart) error {
+	return nil
+}
+
+func (pm *stubPlaylistManager) SetAudioTracks(tracks []core.AudioTrack) {}
+
+func (pm *stubPlaylistManager) SetEncoders(encoders common.ProfileEncoders) {}
+
+func (pm *stubPlaylistManager) InsertHLSAudioSegment(rendition string, seqNo uint64, uri string, duration float64) error {
+	return nil
+}
+
 func (pm *stubPlaylistManager) GetHLSMasterPlaylist() *m3u8.MasterPlaylist {
 	return nil
 }
@@ -74,6 +90,10 @@ func (pm *stubPlaylistManager) GetHLSMediaPlaylist(rendition string) *m3u8.Media
 	return nil
 }
 
+func (pm *stubPlaylistManager) GetLLHLSMediaPlaylist(rendition string) *core.LLHLSPlaylist {
+	return nil
+}
+
 func (pm *stubPlaylistManager) GetOSSession() drivers.OSSession {
 	return nil
 }
@@ -88,6 +108,7 @@ func TestStopSessionErrors(t *testing.T) {
 		"Unable to submit segment 5 Post https://127.0.0.1:8936/segment: dial tcp 127.0.0.1:8936: getsockopt: connection refused",
 		core.ErrOrchBusy.Error(),
 		core.ErrOrchCap.Error(),
+		core.ErrOrchDraining.Error(),
 	}
 
 	// Sanity check that we're checking each failure case
@@ -249,6 +270,67 @@ func TestRemoveSession(t *testing.T) {
 	b.AssertCalled(t, "Clear")
 }
 
+type stubInvalidator struct {
+	invalidated []string
+}
+
+func (s *stubInvalidator) Invalidate(transcoder string) {
+	s.invalidated = append(s.invalidated, transcoder)
+}
+
+func TestRemoveSession_InvalidatesCachedInfo(t *testing.T) {
+	bsm := StubBroadcastSessionsManager()
+	inv := &stubInvalidator{}
+	bsm.invalidator = inv
+	sess1 := bsm.sessList[0]
+
+	// Only the first removal of a session invalidates the info of its orchestrator
+	bsm.removeSession(sess1)
+	bsm.removeSession(sess1)
+	assert.Equal(t, []string{sess1.OrchestratorInfo.Transcoder}, inv.invalidated)
+}
+
+func TestMigrateSession(t *testing.T) {
+	assert := assert.New(t)
+	bsm := StubBroadcastSessionsManager()
+	bsm.health = core.NewOrchestratorHealth(2, 0, time.Minute)
+	inv := &stubInvalidator{}
+	bsm.invalidator = inv
+	sess1 := bsm.sessMap["transcoder1"]
+	b := &mockBalance{}
+	b.On("Clear")
+	sess1.Balance = b
+
+	// Migrated sessions are removed without counting as failures of their orchestrators
+	bsm.migrateSession(sess1)
+	assert.Nil(bsm.sessMap["transcoder1"])
+	assert.Len(bsm.sessMap, 1)
+	assert.Empty(bsm.health.TakeObservations())
+	assert.Empty(inv.invalidated)
+	b.AssertCalled(t, "Clear")
+}
+
+func TestSessionHealth(t *testing.T) {
+	assert := assert.New(t)
+	bsm := StubBroadcastSessionsManager()
+	bsm.health = core.NewOrchestratorHealth(2, 0, time.Minute)
+	sess1, sess2 := bsm.sessMap["transcoder1"], bsm.sessMap["transcoder2"]
+
+	// Only the first removal of a session counts as a failure
+	bsm.removeSession(sess1)
+	bsm.removeSession(sess1)
+	assert.False(bsm.health.Unhealthy("transcoder1"))
+	assert.Equal([]core.HealthObservation{{Orchestrator: "transcoder1", Failures: 1}}, bsm.health.TakeObservations())
+
+	bsm.observeLatency(sess2, 100*time.Millisecond)
+	assert.Equal([]core.HealthObservation{{Orchestrator: "transcoder2", Segments: 1, LatencyMs: 100}}, bsm.health.TakeObservations())
+
+	// Sessions of orchestrators that were reported unhealthy by other broadcasters are dropped
+	assert.Nil(bsm.health.Merge([]core.HealthObservation{{Orchestrator: "transcoder2", Failures: 2}}))
+	assert.Nil(bsm.selectSession())
+	assert.Len(bsm.sessMap, 0)
+}
+
 func TestCompleteSessions(t *testing.T) {
 	bsm := StubBroadcastSessionsManager()
 	sess1 := bsm.selectSession()
@@ -277,6 +359,103 @@ func TestCompleteSessions(t *testing.T) {
 	assert.Len(bsm.sessMap, 2)
 }
 
+func TestStartPMSession_Resume(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	dir, err := ioutil.TempDir("", "livepeer-pm-session-test")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	dbh, err := common.InitDB(filepath.Join(dir, "lp.sqlite3"))
+	require.Nil(err)
+	defer dbh.Close()
+
+	mid := core.RandomManifestID()
+	tinfo := &net.OrchestratorInfo{Transcoder: "transcoder1", TicketParams: defaultTicketParams()}
+	require.Nil(dbh.StoreBroadcastPMSession(string(mid), tinfo.Transcoder, "prev"))
+	sender := &pm.MockSender{}
+	sender.On("ResumeSession", "prev").Return(nil)
+	sender.On("StartSession", mock.Anything).Return("new")
+	n := &core.LivepeerNode{Database: dbh, Sender: sender}
+
+	// The persisted session is resumed once per stream
+	assert.Equal("prev", startPMSession(n, mid, tinfo))
+	assert.Equal("new", startPMSession(n, mid, tinfo))
+	sessionID, err := dbh.BroadcastPMSession(string(mid), tinfo.Transcoder)
+	require.Nil(err)
+	assert.Equal("new", sessionID)
+	sender.AssertNumberOfCalls(t, "ResumeSession", 1)
+
+	// A session started by this process is not resumed
+	assert.Equal("new", startPMSession(n, mid, tinfo))
+	sender.AssertNumberOfCalls(t, "ResumeSession", 1)
+
+	// The resumed sessions of a stream are released when it ends
+	_, ok := resumedPMSessions.Load(mid)
+	assert.True(ok)
+	releaseResumedPMSessions(mid)
+	_, ok = resumedPMSessions.Load(mid)
+	assert.False(ok)
+}
+
+func TestWarmPMSessions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	dir, err := ioutil.TempDir("", "livepeer-pm-session-test")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	dbh, err := common.InitDB(filepath.Join(dir, "lp.sqlite3"))
+	require.Nil(err)
+	defer dbh.Close()
+
+	sender := &pm.MockSender{}
+	n := &core.LivepeerNode{Database: dbh, Sender: sender}
+	info := func(transcoder string, recipientRandHash byte) *net.OrchestratorInfo {
+		params := defaultTicketParams()
+		params.RecipientRandHash = []byte{recipientRandHash}
+		return &net.OrchestratorInfo{Transcoder: transcoder, TicketParams: params}
+	}
+	infos := []*net.OrchestratorInfo{info("o1", 1), info("o2", 2), info("o3", 3), info("o4", 4), {Transcoder: "o5"}}
+	sender.On("ValidateTicketParams", pmTicketParams(infos[0].TicketParams)).Return(errors.New("ticket EV higher than max EV"))
+	sender.On("ValidateTicketParams", mock.Anything).Return(nil)
+	sender.On("StartSession", mock.Anything).Return("")
+
+	// Orchestrators that were never used get no sessions
+	assert.Zero(WarmPMSessions(n, infos, 3))
+
+	for transcoder, segments := range map[string]int64{"o1": 30, "o2": 10, "o3": 20, "o5": 40} {
+		require.Nil(dbh.StoreOrchestratorStats(&common.DBOrchStats{Orchestrator: transcoder, Segments: segments}))
+	}
+	// Sessions are started with the most used orchestrators whose ticket params are acceptable
+	assert.Equal(1, WarmPMSessions(n, infos, 1))
+	sender.AssertCalled(t, "StartSession", *pmTicketParams(infos[2].TicketParams))
+	assert.Equal(2, WarmPMSessions(n, infos, 3))
+	sender.AssertCalled(t, "StartSession", *pmTicketParams(infos[1].TicketParams))
+	sender.AssertNotCalled(t, "StartSession", *pmTicketParams(infos[0].TicketParams))
+	sender.AssertNotCalled(t, "StartSession", *pmTicketParams(infos[3].TicketParams))
+
+	assert.Zero(WarmPMSessions(&core.LivepeerNode{Database: dbh}, infos, 3))
+}
+
+func TestResumeSessions(t *testing.T) {
+	assert := assert.New(t)
+	bsm := StubBroadcastSessionsManager()
+	sess1, sess2 := bsm.sessMap["transcoder1"], bsm.sessMap["transcoder2"]
+
+	// Sessions are not marked before the stream is resumed
+	assert.Nil(bsm.takeResumption(sess1))
+
+	bsm.resume(41)
+
+	// Each existing session is marked once
+	r := bsm.takeResumption(sess1)
+	assert.Equal(&net.StreamResumption{LastSeq: 41}, r)
+	assert.Nil(bsm.takeResumption(sess1))
+	assert.Equal(&net.StreamResumption{LastSeq: 41}, bsm.takeResumption(sess2))
+
+	// Sessions created after the resumption are not marked
+	assert.Nil(bsm.takeResumption(StubBroadcastSession("transcoder3")))
+}
+
 func TestRefreshSessions(t *testing.T) {
 	bsm := StubBroadcastSessionsManager()
 
@@ -379,6 +558,143 @@ func TestCleanupSessions(t *testing.T) {
 //     assert an error from transcoder removes sess from BroadcastSessionManager
 //     assert a success re-adds sess to BroadcastSessionManager
 
+func TestTranscodeSegment_UsesStreamProfiles(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	// Create stub server that records the profiles requested for the segment
+	// and returns a rendition for each of them
+	var requested []ffmpeg.VideoProfile
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	mux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+		creds, err := base64.StdEncoding.DecodeString(r.Header.Get(segmentHeader))
+		require.Nil(err)
+		var segData net.SegData
+		require.Nil(proto.Unmarshal(creds, &segData))
+		requested, err = common.BytesToVideoProfile(segData.Profiles)
+		require.Nil(err)
+
+		segments := make([]*net.TranscodedSegmentData, len(requested))
+		for i := range segments {
+			segments[i] = &net.TranscodedSegmentData{Url: "test.flv"}
+		}
+		buf, err := proto.Marshal(&net.TranscodeResult{
+			Result: &net.TranscodeResult_Data{
+				Data: &net.TranscodeData{Segments: segments, Sig: []byte("bar")},
+			},
+		})
+		require.Nil(err)
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf)
+	})
+
+	sess := StubBroadcastSession(ts.URL)
+	sess.Profiles = []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}
+	cxn := &rtmpConnection{
+		mid:         core.ManifestID("foo"),
+		nonce:       7,
+		pl:          &stubPlaylistManager{core.ManifestID("foo")},
+		profile:     &ffmpeg.P144p30fps16x9,
+		sessManager: bsmWithSessList([]*BroadcastSession{sess}),
+	}
+
+	// The session's profiles are used if the stream's profiles are not set
+	err := transcodeSegment(cxn, &stream.HLSSegment{Data: []byte("dummy")}, "dummy", nil)
+	assert.Nil(err)
+	assert.Equal([]ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}, requested)
+
+	// Updated stream profiles are used for subsequent segments
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9, ffmpeg.P360p30fps16x9}
+	cxn.setProfiles(profiles, nil)
+	cxn.sessManager = bsmWithSessList([]*BroadcastSession{sess})
+
+	err = transcodeSegment(cxn, &stream.HLSSegment{Data: []byte("dummy")}, "dummy", nil)
+	assert.Nil(err)
+	// The profiles are sent to the orchestrator sorted by name
+	assert.ElementsMatch(profiles, requested)
+	assert.ElementsMatch(profiles, sess.Profiles)
+}
+
+func TestTranscodeSegment_AdaptiveLadder(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	tr := &net.TranscodeResult{
+		Result: &net.TranscodeResult_Data{
+			Data: &net.TranscodeData{
+				Segments: []*net.TranscodedSegmentData{
+					&net.TranscodedSegmentData{Url: "test.flv"},
+					&net.TranscodedSegmentData{Url: "test.flv"},
+				},
+				Sig: []byte("bar"),
+			},
+		},
+	}
+	buf, err := proto.Marshal(tr)
+	require.Nil(err)
+
+	// Create stub server that records the segment creds
+	var segData net.SegData
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	mux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+		creds, err := base64.StdEncoding.DecodeString(r.Header.Get(segmentHeader))
+		require.Nil(err)
+		require.Nil(proto.Unmarshal(creds, &segData))
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf)
+	})
+
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9, ffmpeg.P360p30fps16x9}
+	sess := StubBroadcastSession(ts.URL)
+	cxn := &rtmpConnection{
+		mid:         core.ManifestID("foo"),
+		nonce:       7,
+		pl:          &stubPlaylistManager{core.ManifestID("foo")},
+		profile:     &ffmpeg.P144p30fps16x9,
+		sessManager: bsmWithSessList([]*BroadcastSession{sess}),
+		profiles:    profiles,
+		ladder:      core.NewAdaptiveLadder(core.AdaptiveLadderConfig{MinScale: 0.5, MaxScale: 1.5}),
+	}
+
+	// The first segment sets the baseline complexity so the presets are used as is
+	err = transcodeSegment(cxn, &stream.HLSSegment{Data: make([]byte, 1000), Duration: 1}, "dummy", nil)
+	assert.Nil(err)
+	assert.Equal(float32(1), segData.Complexity)
+	assert.Empty(segData.FullProfiles)
+
+	// A less complex segment is transcoded with lower bitrates
+	cxn.sessManager = bsmWithSessList([]*BroadcastSession{sess})
+	err = transcodeSegment(cxn, &stream.HLSSegment{Data: make([]byte, 250), Duration: 1}, "dummy", nil)
+	assert.Nil(err)
+	assert.Equal(float32(0.25), segData.Complexity)
+	requested, _, err := common.NetProfilesToFFmpegProfiles(segData.FullProfiles)
+	require.Nil(err)
+	require.Len(requested, len(profiles))
+	// The profiles are sent to the orchestrator sorted by name
+	nominals := map[string]ffmpeg.VideoProfile{}
+	for _, p := range profiles {
+		nominals[p.Name] = p
+	}
+	for _, p := range requested {
+		nominal, ok := nominals[p.Name]
+		require.True(ok)
+		nominalBitrate, err := common.ParseBitrate(nominal.Bitrate)
+		require.Nil(err)
+		bitrate, err := common.ParseBitrate(p.Bitrate)
+		require.Nil(err)
+		// Scaled by the min bound
+		assert.Equal(nominalBitrate/2, bitrate)
+		assert.Equal(nominal.Resolution, p.Resolution)
+	}
+
+	// The unadjusted profiles are restored on the session
+	assert.ElementsMatch(profiles, sess.Profiles)
+	assert.Zero(sess.Complexity)
+}
+
 func TestTranscodeSegment_VerifyPixels(t *testing.T) {
 	require := require.New(t)
 	assert := assert.New(t)
@@ -421,7 +737,7 @@ func TestTranscodeSegment_VerifyPixels(t *testing.T) {
 		sessManager: bsm,
 	}
 
-	err = transcodeSegment(cxn, &stream.HLSSegment{Data: []byte("dummy")}, "dummy")
+	err = transcodeSegment(cxn, &stream.HLSSegment{Data: []byte("dummy")}, "dummy", nil)
 	assert.Nil(err)
 
 	// Wait for async pixels verification to finish (or in this case we are just making sure that it did NOT run)
@@ -436,7 +752,7 @@ func TestTranscodeSegment_VerifyPixels(t *testing.T) {
 	bsm = bsmWithSessList([]*BroadcastSession{sess})
 	cxn.sessManager = bsm
 
-	err = transcodeSegment(cxn, &stream.HLSSegment{Data: []byte("dummy")}, "dummy")
+	err = transcodeSegment(cxn, &stream.HLSSegment{Data: []byte("dummy")}, "dummy", nil)
 	assert.Nil(err)
 
 	// Wait for async pixels verification to finish
@@ -459,7 +775,7 @@ func TestTranscodeSegment_VerifyPixels(t *testing.T) {
 	bsm = bsmWithSessList([]*BroadcastSession{sess})
 	cxn.sessManager = bsm
 
-	err = transcodeSegment(cxn, &stream.HLSSegment{Data: []byte("dummy")}, "dummy")
+	err = transcodeSegment(cxn, &stream.HLSSegment{Data: []byte("dummy")}, "dummy", nil)
 	assert.Nil(err)
 
 	// Wait for async pixels verification to finish
@@ -528,3 +844,160 @@ func TestVerifyPixels(t *testing.T) {
 	err = verifyPixels("test.flv", nil, p)
 	assert.Nil(err)
 }
+
+func TestVerifyDuration(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	data, err := ioutil.ReadFile("../core/test.ts")
+	require.Nil(err)
+	source, err := common.InspectTS(data)
+	require.Nil(err)
+
+	// Test identical durations
+	assert.Nil(verifyDuration(source, ffmpeg.P144p30fps16x9, data, time.Millisecond))
+
+	// Test durations within tolerance
+	longer := &common.TSInfo{Duration: source.Duration + 0.05}
+	assert.Nil(verifyDuration(longer, ffmpeg.P144p30fps16x9, data, 100*time.Millisecond))
+
+	// Test durations outside of tolerance
+	assert.Error(verifyDuration(longer, ffmpeg.P144p30fps16x9, data, 10*time.Millisecond))
+	shorter := &common.TSInfo{Duration: source.Duration - 0.05}
+	assert.Error(verifyDuration(shorter, ffmpeg.P144p30fps16x9, data, 10*time.Millisecond))
+
+	// Test invalid transcoded data
+	assert.EqualError(verifyDuration(source, ffmpeg.P144p30fps16x9, []byte("foo"), time.Second), "invalid MPEG-TS segment size 3")
+
+	// Test the audio track of audio-only renditions
+	audio := ffmpeg.VideoProfile{Name: "audio", Bitrate: "64k"}
+	assert.Nil(verifyDuration(source, audio, data, 100*time.Millisecond))
+	assert.Error(verifyDuration(&common.TSInfo{Duration: source.Duration + 1}, audio, data, 100*time.Millisecond))
+}
+
+func TestSelectOrchestrator_Reputation(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	db, dbraw, err := common.TempDB(t)
+	require.Nil(err)
+	defer db.Close()
+	defer dbraw.Close()
+
+	oldRand := selectionRand
+	defer func() { selectionRand = oldRand }()
+	selectionRand = func() float64 { return 0.5 }
+
+	n, _ := core.NewLivepeerNode(nil, "", db)
+	n.OrchReputation, err = core.NewOrchestratorReputation(db, time.Second)
+	require.Nil(err)
+	n.OrchReputation.Failure("https://o1:8935")
+	n.OrchReputation.Failure("https://o1:8935")
+	n.OrchReputation.Failure("https://o3:8935")
+
+	sd := &stubDiscovery{}
+	sd.infos = []*net.OrchestratorInfo{
+		{Transcoder: "https://o1:8935", PriceInfo: &net.PriceInfo{PricePerUnit: 1, PixelsPerUnit: 3}},
+		{Transcoder: "https://o2:8935"},
+		{Transcoder: "https://o3:8935"},
+	}
+	n.OrchestratorPool = sd
+	mid := core.RandomManifestID()
+	sessions, err := selectOrchestrator(n, &streamParameters{mid: mid}, core.NewBasicPlaylistManager(mid, drivers.NewMemoryDriver(nil).NewSession(string(mid))), 3)
+	require.Nil(err)
+
+	// With the same random number, the orchestrators with the best reputation are at the end of
+	// the list, which sessions are selected from
+	var transcoders []string
+	for _, sess := range sessions {
+		transcoders = append(transcoders, sess.OrchestratorInfo.Transcoder)
+	}
+	assert.Equal([]string{"https://o1:8935", "https://o3:8935", "https://o2:8935"}, transcoders)
+
+	// Prices are recorded
+	for _, info := range n.OrchReputation.Reputations() {
+		if info.Orchestrator == "https://o1:8935" {
+			require.Len(info.Prices, 1)
+			assert.Equal("1/3", info.Prices[0].PricePerPixel)
+		}
+	}
+
+	// Sessions record the segments of the orchestrators
+	bsm := NewSessionManager(n, &streamParameters{mid: mid}, core.NewBasicPlaylistManager(mid, drivers.NewMemoryDriver(nil).NewSession(string(mid))))
+	sess := bsm.selectSession()
+	require.NotNil(sess)
+	assert.Equal("https://o2:8935", sess.OrchestratorInfo.Transcoder)
+	bsm.observeLatency(sess, 3*time.Second)
+	assert.InDelta(1.0/3, n.OrchReputation.Score("https://o2:8935"), 1e-9)
+	bsm.removeSession(sess)
+	bsm.removeSession(sess)
+	assert.InDelta(2.0/3/3, n.OrchReputation.Score("https://o2:8935"), 1e-9)
+}
+
+func TestSelectOrchestrator_Lists(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	db, dbraw, err := common.TempDB(t)
+	require.Nil(err)
+	defer db.Close()
+	defer dbraw.Close()
+
+	n, _ := core.NewLivepeerNode(nil, "", db)
+	n.OrchLists, err = core.NewOrchestratorLists(db)
+	require.Nil(err)
+	require.Nil(n.OrchLists.Add(core.OrchDenylist, "https://o2:*"))
+
+	sd := &stubDiscovery{}
+	sd.infos = []*net.OrchestratorInfo{
+		{Transcoder: "https://o1:8935"},
+		{Transcoder: "https://o2:8935"},
+		{Transcoder: "https://o3:8935"},
+	}
+	n.OrchestratorPool = sd
+	mid := core.RandomManifestID()
+	pl := core.NewBasicPlaylistManager(mid, drivers.NewMemoryDriver(nil).NewSession(string(mid)))
+	sessions, err := selectOrchestrator(n, &streamParameters{mid: mid}, pl, 3)
+	require.Nil(err)
+
+	var transcoders []string
+	for _, sess := range sessions {
+		transcoders = append(transcoders, sess.OrchestratorInfo.Transcoder)
+	}
+	assert.ElementsMatch([]string{"https://o1:8935", "https://o3:8935"}, transcoders)
+
+	// Sessions of orchestrators denied after they were created are dropped
+	bsm := NewSessionManager(n, &streamParameters{mid: mid}, pl)
+	require.Nil(n.OrchLists.Add(core.OrchAllowlist, "https://o1:*"))
+	sess := bsm.selectSession()
+	require.NotNil(sess)
+	assert.Equal("https://o1:8935", sess.OrchestratorInfo.Transcoder)
+}
+
+func TestSelectOrchestrator_Capabilities(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	n, _ := core.NewLivepeerNode(nil, "", nil)
+	sd := &stubDiscovery{}
+	sd.infos = []*net.OrchestratorInfo{
+		{Transcoder: "https://o1:8935"},
+		{Transcoder: "https://o2:8935", Capabilities: []string{core.CapabilityH264, core.CapabilityVP9}},
+		{Transcoder: "https://o3:8935", Capabilities: []string{core.CapabilityH264, core.CapabilityH265}},
+	}
+	n.OrchestratorPool = sd
+	mid := core.RandomManifestID()
+	pl := core.NewBasicPlaylistManager(mid, drivers.NewMemoryDriver(nil).NewSession(string(mid)))
+
+	// Only the orchestrators that support the codecs of the profiles are used
+	params := &streamParameters{mid: mid, encoders: common.ProfileEncoders{"custom": {Codec: common.CodecVP9}}}
+	sessions, err := selectOrchestrator(n, params, pl, 3)
+	require.Nil(err)
+	require.Len(sessions, 1)
+	assert.Equal("https://o2:8935", sessions[0].OrchestratorInfo.Transcoder)
+	assert.Equal(params.encoders, sessions[0].Encoders)
+
+	sessions, err = selectOrchestrator(n, &streamParameters{mid: mid}, pl, 3)
+	require.Nil(err)
+	assert.Len(sessions, 3)
+}
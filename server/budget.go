@@ -0,0 +1,157 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/golang/glog"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/lpms/ffmpeg"
+)
+
+// budgetLadders are the rendition ladders that the budget planner recommends, from the most to the
+// least expensive
+var budgetLadders = [][]ffmpeg.VideoProfile{
+	{ffmpeg.P720p30fps16x9, ffmpeg.P576p30fps16x9, ffmpeg.P360p30fps16x9, ffmpeg.P240p30fps16x9},
+	{ffmpeg.P720p30fps16x9, ffmpeg.P360p30fps16x9, ffmpeg.P240p30fps16x9},
+	{ffmpeg.P576p30fps16x9, ffmpeg.P360p30fps16x9, ffmpeg.P240p30fps16x9},
+	{ffmpeg.P360p30fps16x9, ffmpeg.P240p30fps16x9},
+	{ffmpeg.P240p30fps16x9},
+	{ffmpeg.P144p30fps16x9},
+}
+
+// defaultBudgetOrchestrators is the number of orchestrators that a recommended price must afford
+const defaultBudgetOrchestrators = 3
+
+// BudgetPlan is the rendition ladder and maximum price recommended for a monthly budget
+type BudgetPlan struct {
+	Profiles []string `json:"profiles"`
+	// Highest price per pixel in wei, rounded to 3 decimals, that keeps the spend of the streamed
+	// hours within the budget
+	MaxPricePerPixel string `json:"maxPricePerPixel"`
+	// Orchestrators observed with a price up to MaxPricePerPixel, and all the observed orchestrators
+	Orchestrators         int `json:"orchestrators"`
+	ObservedOrchestrators int `json:"observedOrchestrators"`
+	// Monthly spend in wei at the median price of the orchestrators up to MaxPricePerPixel
+	EstimatedSpend string `json:"estimatedSpend"`
+	Applied        bool   `json:"applied"`
+
+	ladder   []ffmpeg.VideoProfile
+	maxPrice *big.Rat
+}
+
+// planBudget recommends the most expensive ladder whose maximum price, that spends budget wei over
+// hours of streaming, is affordable for at least minOrchs of the orchestrators observed with prices
+func planBudget(budget *big.Rat, hours float64, minOrchs int, prices []*big.Rat) (*BudgetPlan, error) {
+	if budget.Sign() <= 0 || hours <= 0 {
+		return nil, errors.New("budget and hours must be positive")
+	}
+	if len(prices) == 0 {
+		return nil, errors.New("no orchestrator prices observed")
+	}
+	if minOrchs > len(prices) {
+		minOrchs = len(prices)
+	}
+	if minOrchs < 1 {
+		minOrchs = 1
+	}
+	sorted := make([]*big.Rat, len(prices))
+	copy(sorted, prices)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Cmp(sorted[j]) < 0 })
+
+	seconds := new(big.Rat).SetFloat64(hours * 3600)
+	for _, ladder := range budgetLadders {
+		rate, err := core.ProfilesPixelRate(ladder)
+		if err != nil {
+			return nil, err
+		}
+		pixels := new(big.Rat).Mul(seconds, new(big.Rat).SetFloat64(rate))
+		maxPrice := new(big.Rat).Quo(budget, pixels)
+
+		affordable := sort.Search(len(sorted), func(i int) bool { return sorted[i].Cmp(maxPrice) > 0 })
+		if affordable < minOrchs {
+			continue
+		}
+		spend := new(big.Rat).Mul(sorted[(affordable-1)/2], pixels)
+		names := make([]string, len(ladder))
+		for i, p := range ladder {
+			names[i] = p.Name
+		}
+		return &BudgetPlan{
+			Profiles:              names,
+			MaxPricePerPixel:      maxPrice.FloatString(3),
+			Orchestrators:         affordable,
+			ObservedOrchestrators: len(sorted),
+			EstimatedSpend:        spend.FloatString(0),
+			ladder:                ladder,
+			maxPrice:              maxPrice,
+		}, nil
+	}
+	return nil, fmt.Errorf("budget is too low for %d orchestrators to transcode any ladder", minOrchs)
+}
+
+// observedPrices returns the prices per pixel of the orchestrators of the node's pool. Orchestrators
+// without a price are free
+func observedPrices(node *core.LivepeerNode) ([]*big.Rat, error) {
+	pool := node.OrchestratorPool
+	if pool == nil {
+		return nil, errors.New("no orchestrators specified")
+	}
+	infos, err := pool.GetOrchestrators(pool.Size())
+	if err != nil {
+		return nil, err
+	}
+	prices := make([]*big.Rat, 0, len(infos))
+	for _, info := range infos {
+		price := new(big.Rat)
+		if pi := info.PriceInfo; pi != nil && pi.PixelsPerUnit > 0 {
+			price.SetFrac64(pi.PricePerUnit, pi.PixelsPerUnit)
+		}
+		prices = append(prices, price)
+	}
+	return prices, nil
+}
+
+// planBudgetRequest recommends a ladder and maximum price from the form values of a CLI request, and
+// applies them to the broadcast config if apply is true
+func planBudgetRequest(node *core.LivepeerNode, r *http.Request) (*BudgetPlan, error) {
+	budget, ok := new(big.Rat).SetString(r.FormValue("budget"))
+	if !ok {
+		return nil, fmt.Errorf("invalid budget %v", r.FormValue("budget"))
+	}
+	hours, err := strconv.ParseFloat(r.FormValue("hours"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hours %v", r.FormValue("hours"))
+	}
+	minOrchs := defaultBudgetOrchestrators
+	if v := r.FormValue("minOrchestrators"); v != "" {
+		if minOrchs, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid minOrchestrators %v", v)
+		}
+	}
+
+	prices, err := observedPrices(node)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := planBudget(budget, hours, minOrchs, prices)
+	if err != nil {
+		return nil, err
+	}
+	if r.FormValue("apply") == "true" {
+		if r.Method != http.MethodPost {
+			return nil, errors.New("plans can only be applied with a POST request")
+		}
+		BroadcastCfg.SetMaxPrice(plan.maxPrice)
+		BroadcastJobVideoProfiles = append([]ffmpeg.VideoProfile(nil), plan.ladder...)
+		BroadcastJobEncoders = nil
+		plan.Applied = true
+		glog.Infof("Applied budget plan maxPricePerPixel=%s profiles=%v", plan.MaxPricePerPixel, plan.Profiles)
+	}
+	return plan, nil
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanBudget(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ladderPixels := func(ladder []ffmpeg.VideoProfile, hours int64) *big.Rat {
+		rate, err := core.ProfilesPixelRate(ladder)
+		require.Nil(err)
+		return new(big.Rat).SetInt64(int64(rate) * hours * 3600)
+	}
+
+	_, err := planBudget(big.NewRat(0, 1), 10, 1, []*big.Rat{big.NewRat(1, 1)})
+	assert.EqualError(err, "budget and hours must be positive")
+	_, err = planBudget(big.NewRat(1, 1), 10, 1, nil)
+	assert.EqualError(err, "no orchestrator prices observed")
+
+	// A budget that affords the full ladder at a price of 3 wei per pixel
+	full := ladderPixels(budgetLadders[0], 100)
+	budget := new(big.Rat).Mul(full, big.NewRat(3, 1))
+	prices := []*big.Rat{big.NewRat(3, 1), big.NewRat(1, 1), big.NewRat(2, 1), big.NewRat(5, 1)}
+	plan, err := planBudget(budget, 100, 3, prices)
+	require.Nil(err)
+	assert.Equal([]string{"P720p30fps16x9", "P576p30fps16x9", "P360p30fps16x9", "P240p30fps16x9"}, plan.Profiles)
+	assert.Equal("3.000", plan.MaxPricePerPixel)
+	assert.Equal(3, plan.Orchestrators)
+	assert.Equal(4, plan.ObservedOrchestrators)
+	// Spend at the median affordable price of 2 wei per pixel
+	assert.Equal(new(big.Rat).Mul(full, big.NewRat(2, 1)).FloatString(0), plan.EstimatedSpend)
+	assert.Equal(budgetLadders[0], plan.ladder)
+	assert.Zero(plan.maxPrice.Cmp(big.NewRat(3, 1)))
+	// The observed prices are not reordered
+	assert.Equal(big.NewRat(3, 1), prices[0])
+
+	// Smaller ladders are recommended when the cheapest orchestrators can't afford the full one
+	plan, err = planBudget(budget, 100, 4, prices)
+	require.Nil(err)
+	assert.Equal([]string{"P576p30fps16x9", "P360p30fps16x9", "P240p30fps16x9"}, plan.Profiles)
+	assert.Equal(4, plan.Orchestrators)
+
+	// Fewer orchestrators are required if fewer were observed
+	plan, err = planBudget(budget, 100, 10, prices[:2])
+	require.Nil(err)
+	assert.Equal(2, plan.Orchestrators)
+
+	_, err = planBudget(big.NewRat(1, 1), 100, 1, prices)
+	assert.EqualError(err, "budget is too low for 1 orchestrators to transcode any ladder")
+}
+
+func TestPlanBudgetRequest(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	oldProfiles, oldPrice := BroadcastJobVideoProfiles, BroadcastCfg.MaxPrice()
+	defer func() {
+		BroadcastJobVideoProfiles = oldProfiles
+		BroadcastCfg.SetMaxPrice(oldPrice)
+	}()
+
+	node, _ := core.NewLivepeerNode(nil, "", nil)
+	post := func(v url.Values) *http.Request {
+		r, _ := http.NewRequest("POST", "/planBudget", strings.NewReader(v.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+
+	_, err := planBudgetRequest(node, post(url.Values{"budget": {"x"}}))
+	assert.EqualError(err, "invalid budget x")
+	_, err = planBudgetRequest(node, post(url.Values{"budget": {"1"}, "hours": {"x"}}))
+	assert.EqualError(err, "invalid hours x")
+	_, err = planBudgetRequest(node, post(url.Values{"budget": {"1"}, "hours": {"1"}, "minOrchestrators": {"x"}}))
+	assert.EqualError(err, "invalid minOrchestrators x")
+	_, err = planBudgetRequest(node, post(url.Values{"budget": {"1"}, "hours": {"1"}}))
+	assert.EqualError(err, "no orchestrators specified")
+
+	node.OrchestratorPool = &stubDiscovery{infos: []*net.OrchestratorInfo{
+		{Transcoder: "o1", PriceInfo: &net.PriceInfo{PricePerUnit: 1, PixelsPerUnit: 1000}},
+		{Transcoder: "o2"},
+	}}
+	v := url.Values{"budget": {"1000000000000000000"}, "hours": {"720"}}
+	get, _ := http.NewRequest("GET", "/planBudget?"+v.Encode(), nil)
+	plan, err := planBudgetRequest(node, get)
+	require.Nil(err)
+	assert.Len(plan.Profiles, 4)
+	assert.Equal(2, plan.Orchestrators)
+	assert.False(plan.Applied)
+
+	// Plans are only applied with POST requests
+	v.Set("apply", "true")
+	get, _ = http.NewRequest("GET", "/planBudget?"+v.Encode(), nil)
+	_, err = planBudgetRequest(node, get)
+	assert.EqualError(err, "plans can only be applied with a POST request")
+	plan, err = planBudgetRequest(node, post(v))
+	require.Nil(err)
+	assert.True(plan.Applied)
+	assert.Equal(budgetLadders[0], BroadcastJobVideoProfiles)
+	assert.Zero(plan.maxPrice.Cmp(BroadcastCfg.MaxPrice()))
+}
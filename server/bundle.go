@@ -0,0 +1,59 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+)
+
+// NodeBundleSource is what the bundles downloaded from the /exportBundle CLI endpoint are created
+// from, next to the database. Nil if the node can't be exported
+var NodeBundleSource *BundleSource
+
+// BundleSource describes the setup of a node for the bundles that it exports
+type BundleSource struct {
+	Network       string
+	EthController string
+	KeystoreDir   string
+	// Effective configuration of the node as a YAML config file
+	Config []byte
+}
+
+// exportBundle responds with a bundle of the database, keystore and configuration of the node,
+// encrypted with the password form param
+func (s *LivepeerServer) exportBundle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	src := NodeBundleSource
+	if src == nil || s.LivepeerNode.Database == nil {
+		respondWith400(w, "node can't be exported")
+		return
+	}
+	m := common.BundleManifest{
+		NodeVersion:   core.LivepeerVersion,
+		Network:       src.Network,
+		EthController: src.EthController,
+	}
+	if s.LivepeerNode.Eth != nil {
+		m.EthAcctAddr = s.LivepeerNode.Eth.Account().Address.Hex()
+	}
+	var buf bytes.Buffer
+	if err := common.ExportBundle(&buf, r.FormValue("password"), m, s.LivepeerNode.Database, src.KeystoreDir, src.Config); err != nil {
+		glog.Errorf("Error exporting bundle: %v", err)
+		respondWith500(w, err.Error())
+		return
+	}
+	glog.Infof("Exported bundle of the node account=%v", m.EthAcctAddr)
+	name := fmt.Sprintf("livepeer-%v-%v.lpbundle", src.Network, time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Write(buf.Bytes())
+}
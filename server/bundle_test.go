@@ -0,0 +1,49 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+)
+
+func TestExportBundle(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	n, cleanup := newHealthTestNode(t, core.BroadcasterNode)
+	defer cleanup()
+	defer func() { NodeBundleSource = nil }()
+	mux := NewLivepeerServer("127.0.0.1:1938", n).cliWebServerHandlers("addr")
+
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/exportBundle", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	NodeBundleSource = nil
+	assert.Equal(http.StatusBadRequest, post(url.Values{"password": {"secret"}}).Code)
+
+	NodeBundleSource = &BundleSource{Network: "offchain", Config: []byte("network: offchain\n")}
+	assert.Equal(http.StatusInternalServerError, post(nil).Code)
+	w := post(url.Values{"password": {"secret"}})
+	require.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Header().Get("Content-Disposition"), "livepeer-offchain-")
+
+	dir := filepath.Join(n.WorkDir, "imported")
+	m, err := common.ImportBundle(bytes.NewReader(w.Body.Bytes()), "secret", common.BundleManifest{Network: "offchain"}, dir, filepath.Join(dir, "keystore"))
+	require.Nil(err)
+	assert.Equal(core.LivepeerVersion, m.NodeVersion)
+	assert.Empty(m.EthAcctAddr)
+}
@@ -4,12 +4,19 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"math/big"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
@@ -17,6 +24,8 @@ import (
 
 const certExpiry = 8765 * time.Hour // One year
 
+var ErrCertPin = errors.New("ErrCertPin")
+
 func genCert(host string, priv *ecdsa.PrivateKey) ([]byte, error) {
 	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
 	glog.Info("Generating cert for ", host)
@@ -56,6 +65,23 @@ func genKey() (*ecdsa.PrivateKey, []byte, error) {
 	return key, keyBytes, nil
 }
 
+// readKey loads a private key written by getCert
+func readKey(fname string) (*ecdsa.PrivateKey, []byte, error) {
+	contents, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, []byte{}, err
+	}
+	block, _ := pem.Decode(contents)
+	if block == nil || block.Type != "EC PRIVATE KEY" {
+		return nil, []byte{}, fmt.Errorf("no EC private key in %v", fname)
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, []byte{}, err
+	}
+	return key, block.Bytes, nil
+}
+
 func writeFile(fname string, desc string, contents []byte) error {
 	file, err := os.Create(fname)
 	defer file.Close()
@@ -80,10 +106,23 @@ func getCert(uri *url.URL, workDir string) (string, string, error) {
 	//if os.IsNotExist(certErr) || os.IsNotExist(keyErr) {
 	// XXX for now, just generate a new cert every time.
 	if true {
-		glog.Info("Private key and cert not found. Generating")
-		key, keyBytes, err := genKey()
-		if err != nil {
-			return "", "", err
+		// Keep the private key of an existing key and cert pair so that its fingerprint,
+		// which transcoders may pin, doesn't change across restarts
+		var key *ecdsa.PrivateKey
+		var keyBytes []byte
+		var err error
+		if certErr == nil && keyErr == nil {
+			key, keyBytes, err = readKey(keyFile)
+			if err != nil {
+				glog.Error("Unable to read existing private key ", err)
+			}
+		}
+		if key == nil {
+			glog.Info("Private key and cert not found. Generating")
+			key, keyBytes, err = genKey()
+			if err != nil {
+				return "", "", err
+			}
 		}
 		err = writeFile(keyFile, "EC PRIVATE KEY", keyBytes)
 		if err != nil {
@@ -107,3 +146,60 @@ func getCert(uri *url.URL, workDir string) (string, string, error) {
 	}
 	return certFile, keyFile, nil
 }
+
+// CertFingerprint returns the hex encoded SHA-256 hash of the public key of a certificate
+func CertFingerprint(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(hash[:])
+}
+
+// certFileFingerprint returns the fingerprint of a PEM encoded certificate file
+func certFileFingerprint(certFile string) (string, error) {
+	contents, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return "", fmt.Errorf("no certificate in %v", certFile)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	return CertFingerprint(cert), nil
+}
+
+// ParseCertPin normalizes a certificate fingerprint to pin. Colons between the bytes are allowed
+func ParseCertPin(pin string) (string, error) {
+	s := strings.ToLower(strings.Replace(pin, ":", "", -1))
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("%v: invalid certificate fingerprint %q", ErrCertPin, pin)
+	}
+	return s, nil
+}
+
+// pinnedTLSConfig returns the TLS config to connect to an orchestrator. The self-signed
+// certificate of the orchestrator is accepted as is unless pin is not empty, in which case
+// the fingerprint of the certificate has to match the pin
+func pinnedTLSConfig(pin string) *tls.Config {
+	cfg := &tls.Config{InsecureSkipVerify: true}
+	if pin == "" {
+		return cfg
+	}
+	cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("%v: no certificate presented", ErrCertPin)
+		}
+		cert, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return err
+		}
+		if fp := CertFingerprint(cert); fp != pin {
+			return fmt.Errorf("%v: certificate fingerprint %v does not match", ErrCertPin, fp)
+		}
+		return nil
+	}
+	return cfg
+}
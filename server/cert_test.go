@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"net/url"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -127,3 +128,64 @@ func TestRPCCert(t *testing.T) {
 		t.Error("Matched cert checksum")
 	}
 }
+
+func TestCertPin(t *testing.T) {
+	url, _ := url.Parse("https://livepeer.org")
+	wd, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal("Could not get tempdir ", err)
+	}
+	defer os.RemoveAll(wd)
+	cf, _, err := getCert(url, wd)
+	if err != nil {
+		t.Fatal("Could not get cert/key ", err)
+	}
+	fp, err := certFileFingerprint(cf)
+	if err != nil {
+		t.Fatal("Could not get fingerprint ", err)
+	}
+
+	// the fingerprint doesn't change when the cert is regenerated with the existing key
+	cf, kf, err := getCert(url, wd)
+	if err != nil {
+		t.Fatal("Could not get cert/key ", err)
+	}
+	fp1, err := certFileFingerprint(cf)
+	if err != nil || fp != fp1 {
+		t.Error("Mismatched fingerprint ", fp, fp1, err)
+	}
+
+	tlsCert, err := tls.LoadX509KeyPair(cf, kf)
+	if err != nil {
+		t.Fatal("Could not load cert/key pair", err)
+	}
+	verify := pinnedTLSConfig(fp).VerifyPeerCertificate
+	if err := verify(tlsCert.Certificate, nil); err != nil {
+		t.Error("Pinned cert was not accepted ", err)
+	}
+	otherFp := strings.Repeat("0", len(fp))
+	if err := pinnedTLSConfig(otherFp).VerifyPeerCertificate(tlsCert.Certificate, nil); err == nil {
+		t.Error("Cert with another fingerprint was accepted")
+	}
+	if err := verify(nil, nil); err == nil {
+		t.Error("Missing cert was accepted")
+	}
+	if pinnedTLSConfig("").VerifyPeerCertificate != nil {
+		t.Error("Unpinned config verifies certs")
+	}
+
+	// pins are normalized
+	colons := ""
+	for i := 0; i < len(fp); i += 2 {
+		if i > 0 {
+			colons += ":"
+		}
+		colons += strings.ToUpper(fp[i : i+2])
+	}
+	if pin, err := ParseCertPin(colons); err != nil || pin != fp {
+		t.Error("Could not parse pin ", pin, err)
+	}
+	if _, err := ParseCertPin("abcd"); err == nil {
+		t.Error("Short pin was accepted")
+	}
+}
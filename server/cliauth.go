@@ -0,0 +1,190 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// CliRole is the access that a token grants to the CLI webserver
+type CliRole int
+
+const (
+	// CliRoleReadOnly can only read the state of the node
+	CliRoleReadOnly CliRole = iota + 1
+	// CliRoleAdmin can use every endpoint, including the ones that change the node's settings or
+	// send transactions
+	CliRoleAdmin
+)
+
+func (r CliRole) String() string {
+	switch r {
+	case CliRoleReadOnly:
+		return "read-only"
+	case CliRoleAdmin:
+		return "admin"
+	}
+	return "none"
+}
+
+// CliAuth authenticates the requests of the CLI webserver. Requests are not authenticated if nil
+var CliAuth *CliAuthenticator
+
+// CliTLSCert and CliTLSKey are the files of the certificate and the key that the CLI webserver
+// serves HTTPS with. The CLI webserver serves plain HTTP if they are not set
+var CliTLSCert, CliTLSKey string
+
+// cliReadOnlyEndpoints are the endpoints of the CLI webserver that don't change the state of the
+// node when they are requested with GET
+var cliReadOnlyEndpoints = map[string]bool{
+	"/healthz":                          true,
+	"/readyz":                           true,
+	"/metrics":                          true,
+	"/status":                           true,
+	"/debug":                            true,
+	"/getMaxPrice":                      true,
+	"/getPricePerUnit":                  true,
+	"/getMaxSessions":                   true,
+	"/getSelectionStrategy":             true,
+	"/getBroadcastConfig":               true,
+	"/getAvailableTranscodingOptions":   true,
+	"/liveStats":                        true,
+	"/protocolEvents":                   true,
+	"/planBudget":                       true,
+	"/orchCertPins":                     true,
+	"/currentRound":                     true,
+	"/roundInitialized":                 true,
+	"/unbondingLocks":                   true,
+	"/delegatorInfo":                    true,
+	"/orchestratorEarningPoolsForRound": true,
+	"/streamID":                         true,
+	"/manifestID":                       true,
+	"/localStreams":                     true,
+	"/streams":                          true,
+	"/creditLedger":                     true,
+	"/orchestratorReputation":           true,
+	"/segmentTrace":                     true,
+	"/traceSpans":                       true,
+	"/logLevels":                        true,
+	"/debugCaptures":                    true,
+	"/quotas":                           true,
+	"/orchestratorLists":                true,
+	"/abTestReport":                     true,
+	"/spendReport":                      true,
+	"/protocolExchanges":                true,
+	"/replayExchange":                   true,
+	"/contractAddresses":                true,
+	"/protocolParameters":               true,
+	"/ethAddr":                          true,
+	"/tokenBalance":                     true,
+	"/ethBalance":                       true,
+	"/registeredOrchestrators":          true,
+	"/orchestratorInfo":                 true,
+	"/IsOrchestrator":                   true,
+	"/EthNetworkID":                     true,
+	"/gasPrice":                         true,
+	"/txQueue":                          true,
+	"/currentBlock":                     true,
+	"/senderInfo":                       true,
+	"/ticketBrokerParams":               true,
+}
+
+// cliReadOnlyPrefixes are the prefixes of the paths of the endpoints of the CLI webserver that
+// don't change the state of the node when they are requested with GET
+var cliReadOnlyPrefixes = []string{"/txStatus/", "/streams/"}
+
+// CliAuthenticator checks the tokens of the requests of the CLI webserver. A token is sent as a
+// bearer token, or as the password of basic auth with any user name
+type CliAuthenticator struct {
+	tokens map[string]CliRole
+}
+
+// NewCliAuthenticator creates a CliAuthenticator of the tokens of the admin and read-only roles
+func NewCliAuthenticator(adminTokens, readOnlyTokens []string) (*CliAuthenticator, error) {
+	a := &CliAuthenticator{tokens: make(map[string]CliRole)}
+	add := func(tokens []string, role CliRole) error {
+		for _, token := range tokens {
+			if token = strings.TrimSpace(token); token == "" {
+				continue
+			}
+			if _, ok := a.tokens[token]; ok {
+				return errors.New("CLI tokens must be unique")
+			}
+			a.tokens[token] = role
+		}
+		return nil
+	}
+	if err := add(adminTokens, CliRoleAdmin); err != nil {
+		return nil, err
+	}
+	if err := add(readOnlyTokens, CliRoleReadOnly); err != nil {
+		return nil, err
+	}
+	if len(a.tokens) == 0 {
+		return nil, errors.New("no CLI tokens")
+	}
+	return a, nil
+}
+
+// Role returns the role of the token of a request, or 0 if it has no valid token
+func (a *CliAuthenticator) Role(r *http.Request) CliRole {
+	token := ""
+	if _, password, ok := r.BasicAuth(); ok {
+		token = password
+	} else if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	if token == "" {
+		return 0
+	}
+	var role CliRole
+	// Every token is compared so that the time taken doesn't depend on which token matched
+	for t, tokenRole := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			role = tokenRole
+		}
+	}
+	return role
+}
+
+// Handler rejects the requests of next without a valid token, and the requests of read-only tokens
+// that could change the state of the node
+func (a *CliAuthenticator) Handler(next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role := a.Role(r)
+		switch {
+		case role == 0:
+			glog.Warningf("Unauthenticated CLI request path=%s remoteAddr=%s", r.URL.Path, r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Basic realm="livepeer"`)
+			respondWithError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		case role == CliRoleReadOnly && !cliReadOnlyRequest(r):
+			glog.Warningf("Forbidden CLI request of read-only token path=%s method=%s remoteAddr=%s", r.URL.Path, r.Method, r.RemoteAddr)
+			respondWithError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cliReadOnlyRequest returns true if a request of the CLI webserver doesn't change the state of the node
+func cliReadOnlyRequest(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if cliReadOnlyEndpoints[r.URL.Path] {
+		return true
+	}
+	for _, prefix := range cliReadOnlyPrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
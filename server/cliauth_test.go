@@ -0,0 +1,103 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/core"
+)
+
+func TestNewCliAuthenticator(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewCliAuthenticator([]string{""}, nil)
+	assert.EqualError(err, "no CLI tokens")
+	_, err = NewCliAuthenticator([]string{"a"}, []string{" a "})
+	assert.EqualError(err, "CLI tokens must be unique")
+
+	a, err := NewCliAuthenticator([]string{"admin"}, []string{"reader", ""})
+	require.Nil(t, err)
+	assert.Len(a.tokens, 2)
+}
+
+func TestCliAuthenticator_Role(t *testing.T) {
+	assert := assert.New(t)
+	a, err := NewCliAuthenticator([]string{"admin"}, []string{"reader"})
+	require.Nil(t, err)
+
+	role := func(set func(r *http.Request)) CliRole {
+		r := httptest.NewRequest("GET", "/status", nil)
+		set(r)
+		return a.Role(r)
+	}
+	assert.Equal(CliRole(0), role(func(r *http.Request) {}))
+	assert.Equal(CliRoleAdmin, role(func(r *http.Request) { r.Header.Set("Authorization", "Bearer admin") }))
+	assert.Equal(CliRoleReadOnly, role(func(r *http.Request) { r.Header.Set("Authorization", "Bearer reader") }))
+	assert.Equal(CliRole(0), role(func(r *http.Request) { r.Header.Set("Authorization", "Bearer other") }))
+	assert.Equal(CliRoleAdmin, role(func(r *http.Request) { r.SetBasicAuth("anyone", "admin") }))
+	assert.Equal(CliRole(0), role(func(r *http.Request) { r.SetBasicAuth("admin", "") }))
+}
+
+func TestCliAuthenticator_Handler(t *testing.T) {
+	assert := assert.New(t)
+	n, cleanup := newHealthTestNode(t, core.BroadcasterNode)
+	defer cleanup()
+	mux := NewLivepeerServer("127.0.0.1:1938", n).cliWebServerHandlers("addr")
+	oldMaxSessions := core.MaxSessions
+	defer func() { core.MaxSessions = oldMaxSessions }()
+
+	// Requests are not authenticated without tokens
+	var a *CliAuthenticator
+	w := httptest.NewRecorder()
+	a.Handler(mux).ServeHTTP(w, httptest.NewRequest("GET", "/getMaxSessions", nil))
+	assert.Equal(http.StatusOK, w.Code)
+
+	a, err := NewCliAuthenticator([]string{"admin"}, []string{"reader"})
+	require.Nil(t, err)
+	handler := a.Handler(mux)
+	serve := func(method, path, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w = serve("GET", "/getMaxSessions", "")
+	assert.Equal(http.StatusUnauthorized, w.Code)
+	assert.Equal(`Basic realm="livepeer"`, w.Header().Get("WWW-Authenticate"))
+	assert.Equal(http.StatusUnauthorized, serve("GET", "/getMaxSessions", "wrong").Code)
+
+	// Read-only tokens can only read the state of the node
+	assert.Equal(http.StatusOK, serve("GET", "/getMaxSessions", "reader").Code)
+	assert.Equal(http.StatusForbidden, serve("POST", "/logLevels", "reader").Code)
+	assert.Equal(http.StatusForbidden, serve("GET", "/setMaxSessions?maxSessions=5", "reader").Code)
+	assert.Equal(http.StatusForbidden, serve("POST", "/withdraw", "reader").Code)
+	// Transactions are unknown but can be polled by read-only tokens
+	assert.Equal(http.StatusNotFound, serve("GET", "/txStatus/0x"+strings.Repeat("ab", 32), "reader").Code)
+
+	assert.Equal(http.StatusOK, serve("POST", "/setMaxSessions?maxSessions=5", "admin").Code)
+	assert.Equal(5, core.MaxSessions)
+}
+
+func TestCliReadOnlyEndpoints_Registered(t *testing.T) {
+	n, cleanup := newHealthTestNode(t, core.BroadcasterNode)
+	defer cleanup()
+	mux := NewLivepeerServer("127.0.0.1:1938", n).cliWebServerHandlers("addr")
+
+	for path := range cliReadOnlyEndpoints {
+		if path == "/metrics" {
+			// Only registered when metrics are enabled
+			continue
+		}
+		_, pattern := mux.Handler(httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, path, pattern)
+	}
+}
@@ -1,14 +1,18 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"runtime"
 	"testing"
 	"time"
 
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/livepeer/go-livepeer/clog"
 	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/core"
 	"github.com/stretchr/testify/assert"
@@ -20,7 +24,7 @@ func newMockServer() *httptest.Server {
 	n.NodeType = core.TranscoderNode
 	n.TranscoderManager = core.NewRemoteTranscoderManager()
 	strm := &common.StubServerStream{}
-	go func() { n.TranscoderManager.Manage(strm, 5) }()
+	go func() { n.TranscoderManager.Manage(strm, 5, "", nil, ethcommon.Address{}) }()
 	time.Sleep(1 * time.Millisecond)
 	n.Transcoder = n.TranscoderManager
 	s := NewLivepeerServer("127.0.0.1:1938", n)
@@ -40,7 +44,7 @@ func TestGetStatus(t *testing.T) {
 	defer res.Body.Close()
 	body, err := ioutil.ReadAll(res.Body)
 	req.Nil(err)
-	expected := fmt.Sprintf(`{"Manifests":{},"OrchestratorPool":[],"Version":"undefined","GolangRuntimeVersion":"%s","GOArch":"%s","GOOS":"%s","RegisteredTranscodersNumber":1,"RegisteredTranscoders":[{"Address":"TestAddress","Capacity":5}],"LocalTranscoding":false}`,
+	expected := fmt.Sprintf(`{"Manifests":{},"OrchestratorPool":[],"Version":"undefined","GolangRuntimeVersion":"%s","GOArch":"%s","GOOS":"%s","RegisteredTranscodersNumber":1,"RegisteredTranscoders":[{"Address":"TestAddress","Identity":"","Capacity":5,"Version":"","Capabilities":null}],"LocalTranscoding":false}`,
 		runtime.Version(), runtime.GOARCH, runtime.GOOS)
 	assert.Equal(expected, string(body))
 }
@@ -56,6 +60,15 @@ func TestGetEthNetworkID(t *testing.T) {
 	defer res.Body.Close()
 	body, err := ioutil.ReadAll(res.Body)
 	req.Nil(err)
+	assert.JSONEq(`{"networkID":"offchain"}`, string(body))
+
+	LegacyCliResponses = true
+	defer func() { LegacyCliResponses = false }()
+	res, err = http.Get(fmt.Sprintf("%s/EthNetworkID", srv.URL))
+	req.Nil(err)
+	defer res.Body.Close()
+	body, err = ioutil.ReadAll(res.Body)
+	req.Nil(err)
 	assert.Equal("offchain", string(body))
 }
 
@@ -86,3 +99,105 @@ func TestGetDelegatorInfo(t *testing.T) {
 	req.Nil(err)
 	assert.Equal("{}", string(body))
 }
+
+func TestSetStreamProfiles_Errors(t *testing.T) {
+	srv := newMockServer()
+	defer srv.Close()
+	assert := assert.New(t)
+	req := require.New(t)
+
+	// Missing manifestID
+	res, err := http.PostForm(fmt.Sprintf("%s/setStreamProfiles", srv.URL), url.Values{"transcodingOptions": {"P240p30fps16x9"}})
+	req.Nil(err)
+	res.Body.Close()
+	assert.Equal(http.StatusBadRequest, res.StatusCode)
+
+	// Invalid transcoding options
+	res, err = http.PostForm(fmt.Sprintf("%s/setStreamProfiles", srv.URL), url.Values{"manifestID": {"foo"}, "transcodingOptions": {"bar"}})
+	req.Nil(err)
+	res.Body.Close()
+	assert.Equal(http.StatusBadRequest, res.StatusCode)
+
+	// Unknown stream
+	res, err = http.PostForm(fmt.Sprintf("%s/setStreamProfiles", srv.URL), url.Values{"manifestID": {"foo"}, "transcodingOptions": {"P240p30fps16x9"}})
+	req.Nil(err)
+	defer res.Body.Close()
+	assert.Equal(http.StatusNotFound, res.StatusCode)
+	body, err := ioutil.ReadAll(res.Body)
+	req.Nil(err)
+	assert.JSONEq(`{"error":{"code":"not_found","message":"`+errUnknownStream.Error()+`"}}`, string(body))
+}
+
+func TestLogLevels(t *testing.T) {
+	srv := newMockServer()
+	defer srv.Close()
+	defer clog.SetLevel("server", -1)
+	assert := assert.New(t)
+	req := require.New(t)
+
+	res, err := http.PostForm(fmt.Sprintf("%s/logLevels", srv.URL), url.Values{"module": {"server"}, "level": {"6"}})
+	req.Nil(err)
+	defer res.Body.Close()
+	assert.Equal(http.StatusOK, res.StatusCode)
+	var status clog.Status
+	req.Nil(json.NewDecoder(res.Body).Decode(&status))
+	assert.Equal(clog.FormatText, status.Format)
+	assert.Contains(status.Modules, "server")
+	assert.Equal(6, status.Levels["server"])
+
+	res, err = http.PostForm(fmt.Sprintf("%s/logLevels", srv.URL), url.Values{"module": {"nope"}, "level": {"6"}})
+	req.Nil(err)
+	assert.Equal(http.StatusBadRequest, res.StatusCode)
+
+	res, err = http.PostForm(fmt.Sprintf("%s/logLevels", srv.URL), url.Values{"module": {"server"}, "level": {"high"}})
+	req.Nil(err)
+	assert.Equal(http.StatusBadRequest, res.StatusCode)
+
+	// A negative level resets the module to the -v verbosity
+	res, err = http.PostForm(fmt.Sprintf("%s/logLevels", srv.URL), url.Values{"module": {"server"}, "level": {"-1"}})
+	req.Nil(err)
+	var reset clog.Status
+	req.Nil(json.NewDecoder(res.Body).Decode(&reset))
+	assert.NotContains(reset.Levels, "server")
+}
+
+func TestRuntimeConfigEndpoints(t *testing.T) {
+	srv := newMockServer()
+	defer srv.Close()
+	defer BroadcastCfg.SetMaxPrice(nil)
+	defer func(maxSessions int) { core.MaxSessions = maxSessions }(core.MaxSessions)
+	assert := assert.New(t)
+	req := require.New(t)
+
+	post := func(path string, form url.Values) (int, string) {
+		res, err := http.PostForm(srv.URL+path, form)
+		req.Nil(err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		req.Nil(err)
+		return res.StatusCode, string(body)
+	}
+
+	code, body := post("/setMaxPrice", url.Values{"maxPricePerUnit": {"1"}, "pixelsPerUnit": {"2"}})
+	assert.Equal(http.StatusOK, code)
+	assert.Equal(`{"maxPrice":"1/2"}`, body)
+	code, body = post("/getMaxPrice", nil)
+	assert.Equal(`{"maxPrice":"1/2"}`, body)
+	code, _ = post("/setMaxPrice", url.Values{"maxPricePerUnit": {"1"}})
+	assert.Equal(http.StatusBadRequest, code)
+
+	code, body = post("/setMaxSessions", url.Values{"maxSessions": {"4"}})
+	assert.Equal(http.StatusOK, code)
+	assert.Equal(`{"maxSessions":4}`, body)
+	code, _ = post("/setMaxSessions", url.Values{"maxSessions": {"none"}})
+	assert.Equal(http.StatusBadRequest, code)
+
+	code, body = post("/setPricePerUnit", url.Values{"pricePerUnit": {"3"}, "pixelsPerUnit": {"1"}})
+	assert.Equal(http.StatusOK, code)
+	assert.Equal(`{"pricePerPixel":"3"}`, body)
+
+	code, body = post("/setSelectionStrategy", url.Values{"strategy": {"nope"}})
+	assert.Equal(http.StatusBadRequest, code)
+	_, body = post("/getSelectionStrategy", nil)
+	assert.Equal(`{"strategy":""}`, body)
+}
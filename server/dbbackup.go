@@ -0,0 +1,235 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/drivers"
+)
+
+// DBBackupsPrefix is the path under which the backups of the node's DB are saved
+const DBBackupsPrefix = "dbbackups"
+
+// LatestDBBackup selects the most recent backup when restoring the DB
+const LatestDBBackup = "latest"
+
+// Header of the backups, followed by the version of their format
+const dbBackupMagic = "LPDBBACKUP"
+
+const dbBackupVersion = 1
+
+const dbBackupSuffix = ".sqlite3.gz.enc"
+
+// DBBackupStorage is a storage that the backups of the node's DB can be listed, read and deleted from.
+// Only the S3 driver implements it
+type DBBackupStorage interface {
+	drivers.OSPruner
+	drivers.OSReader
+}
+
+// DBBackup periodically saves encrypted backups of the node's DB to the node's storage and
+// deletes the backups that are older than the retention period. The most recent backup is kept
+// regardless of its age
+type DBBackup struct {
+	db        *common.DB
+	os        drivers.OSDriver
+	storage   DBBackupStorage
+	password  string
+	retention time.Duration
+	quit      chan struct{}
+}
+
+// NewDBBackup creates a DBBackup that saves backups of db to os encrypted with password
+func NewDBBackup(db *common.DB, os drivers.OSDriver, password string, retention time.Duration) (*DBBackup, error) {
+	if password == "" {
+		return nil, errors.New("DB backup password required")
+	}
+	storage, ok := os.(DBBackupStorage)
+	if !ok {
+		return nil, errors.New("DB backups require S3 storage")
+	}
+	return &DBBackup{
+		db:        db,
+		os:        os,
+		storage:   storage,
+		password:  password,
+		retention: retention,
+		quit:      make(chan struct{}),
+	}, nil
+}
+
+// StartBackups backs up the DB every interval until StopBackups is called
+func (b *DBBackup) StartBackups(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := b.Backup(time.Now()); err != nil {
+				glog.Errorf("Error backing up the DB: %v", err)
+			}
+		case <-b.quit:
+			return
+		}
+	}
+}
+
+// StopBackups stops the backup loop
+func (b *DBBackup) StopBackups() {
+	close(b.quit)
+}
+
+// Backup saves a backup of the DB and deletes the expired backups. It returns the name of the
+// object that the backup was saved to
+func (b *DBBackup) Backup(now time.Time) (string, error) {
+	tmpDir, err := ioutil.TempDir("", "lpdbbackup")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+	dbFile := filepath.Join(tmpDir, "lp.sqlite3")
+	if err := b.db.Backup(dbFile); err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(dbFile)
+	if err != nil {
+		return "", err
+	}
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write(data); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	sealed, err := common.SealWithPassword(dbBackupHeader(), b.password, compressed.Bytes())
+	if err != nil {
+		return "", err
+	}
+
+	name := "lp-" + now.UTC().Format("20060102T150405Z") + dbBackupSuffix
+	sess := b.os.NewSession(DBBackupsPrefix)
+	defer sess.EndSession()
+	if _, err := sess.SaveData(name, sealed); err != nil {
+		return "", err
+	}
+	name = DBBackupsPrefix + "/" + name
+	glog.Infof("Backed up the DB name=%s size=%d", name, len(sealed))
+
+	if b.retention > 0 {
+		if _, err := b.prune(now); err != nil {
+			return name, err
+		}
+	}
+	return name, nil
+}
+
+// prune deletes the backups that are older than the retention period, except the most recent
+// one, and returns the number of backups that were deleted
+func (b *DBBackup) prune(now time.Time) (int, error) {
+	backups, err := listDBBackups(b.storage)
+	if err != nil {
+		return 0, err
+	}
+	var expired []string
+	for _, obj := range backups[1:] {
+		if now.Sub(obj.LastModified) >= b.retention {
+			expired = append(expired, obj.Name)
+		}
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+	if err := b.storage.DeleteData(expired); err != nil {
+		return 0, err
+	}
+	glog.Infof("Deleted expired DB backups count=%d", len(expired))
+	return len(expired), nil
+}
+
+// listDBBackups lists the backups of the storage, most recent first
+func listDBBackups(storage DBBackupStorage) ([]drivers.ObjectInfo, error) {
+	objects, err := storage.ListData(DBBackupsPrefix + "/")
+	if err != nil {
+		return nil, err
+	}
+	var backups []drivers.ObjectInfo
+	for _, obj := range objects {
+		if strings.HasSuffix(obj.Name, dbBackupSuffix) {
+			backups = append(backups, obj)
+		}
+	}
+	if len(backups) == 0 {
+		return nil, errors.New("no DB backups found")
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].LastModified.After(backups[j].LastModified) })
+	return backups, nil
+}
+
+// RestoreDBBackup writes a backup of the storage to dbPath and returns the name of the backup. name
+// is the name of the object of the backup, or LatestDBBackup for the most recent backup. The
+// existing DB is kept next to dbPath with a .bak-<timestamp> suffix
+func RestoreDBBackup(storage DBBackupStorage, password, name, dbPath string) (string, error) {
+	if name == LatestDBBackup {
+		backups, err := listDBBackups(storage)
+		if err != nil {
+			return "", err
+		}
+		name = backups[0].Name
+	}
+	sealed, err := storage.ReadData(name)
+	if err != nil {
+		return "", fmt.Errorf("error reading DB backup %v: %v", name, err)
+	}
+	compressed, err := common.OpenWithPassword(dbBackupHeader(), password, sealed)
+	if err != nil {
+		return "", fmt.Errorf("error decrypting DB backup %v: %v", name, err)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadAll(gz)
+	if err != nil {
+		return "", err
+	}
+
+	// The backup must be a valid DB before it replaces the existing one
+	tmpPath := dbPath + ".restore"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpPath)
+	db, err := common.InitDB(tmpPath)
+	if err != nil {
+		return "", fmt.Errorf("invalid DB backup %v: %v", name, err)
+	}
+	db.Close()
+
+	if _, err := os.Stat(dbPath); err == nil {
+		if err := os.Rename(dbPath, dbPath+".bak-"+time.Now().UTC().Format("20060102T150405Z")); err != nil {
+			return "", err
+		}
+	}
+	if err := os.Rename(tmpPath, dbPath); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func dbBackupHeader() []byte {
+	return append([]byte(dbBackupMagic), dbBackupVersion)
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+// stubBackupStorage keeps the data saved to it in memory
+type stubBackupStorage struct {
+	objects map[string][]byte
+	times   map[string]time.Time
+	now     time.Time
+}
+
+type stubBackupSession struct {
+	os   *stubBackupStorage
+	path string
+}
+
+func newStubBackupStorage() *stubBackupStorage {
+	return &stubBackupStorage{objects: make(map[string][]byte), times: make(map[string]time.Time)}
+}
+
+func (s *stubBackupStorage) NewSession(path string) drivers.OSSession {
+	return &stubBackupSession{os: s, path: path}
+}
+
+func (s *stubBackupStorage) ListData(prefix string) ([]drivers.ObjectInfo, error) {
+	var objects []drivers.ObjectInfo
+	for name := range s.objects {
+		objects = append(objects, drivers.ObjectInfo{Name: name, LastModified: s.times[name]})
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+	return objects, nil
+}
+
+func (s *stubBackupStorage) ReadData(name string) ([]byte, error) {
+	data, ok := s.objects[name]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return data, nil
+}
+
+func (s *stubBackupStorage) DeleteData(names []string) error {
+	for _, name := range names {
+		delete(s.objects, name)
+	}
+	return nil
+}
+
+func (s *stubBackupSession) SaveData(name string, data []byte) (string, error) {
+	name = path.Join(s.path, name)
+	s.os.objects[name] = data
+	s.os.times[name] = s.os.now
+	return name, nil
+}
+
+func (s *stubBackupSession) EndSession()          {}
+func (s *stubBackupSession) GetInfo() *net.OSInfo { return nil }
+func (s *stubBackupSession) IsExternal() bool     { return false }
+
+func TestNewDBBackup(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewDBBackup(nil, newStubBackupStorage(), "", time.Hour)
+	assert.EqualError(err, "DB backup password required")
+	_, err = NewDBBackup(nil, drivers.NewMemoryDriver(nil), "secret", time.Hour)
+	assert.EqualError(err, "DB backups require S3 storage")
+}
+
+func TestDBBackup_BackupAndRestore(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	dir, err := ioutil.TempDir("", "dbbackup")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	dbPath := filepath.Join(dir, "lp.sqlite3")
+	dbh, err := common.InitDB(dbPath)
+	require.Nil(err)
+	defer dbh.Close()
+	require.Nil(dbh.CheckChainID(big.NewInt(1)))
+
+	storage := newStubBackupStorage()
+	backup, err := NewDBBackup(dbh, storage, "secret", 24*time.Hour)
+	require.Nil(err)
+
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	storage.now = start
+	first, err := backup.Backup(start)
+	require.Nil(err)
+	assert.Equal("dbbackups/lp-20210101T000000Z.sqlite3.gz.enc", first)
+
+	// Backups are encrypted
+	_, err = RestoreDBBackup(storage, "wrong", first, filepath.Join(dir, "restored.sqlite3"))
+	assert.Contains(err.Error(), "wrong password")
+
+	require.Nil(dbh.CheckChainID(big.NewInt(1)))
+	storage.now = start.Add(12 * time.Hour)
+	second, err := backup.Backup(storage.now)
+	require.Nil(err)
+	assert.Len(storage.objects, 2)
+
+	// Backups older than the retention period are deleted
+	storage.now = start.Add(30 * time.Hour)
+	third, err := backup.Backup(storage.now)
+	require.Nil(err)
+	assert.Len(storage.objects, 2)
+	assert.NotContains(storage.objects, first)
+	assert.Contains(storage.objects, second)
+
+	// The most recent backup is kept regardless of its age
+	n, err := backup.prune(start.Add(365 * 24 * time.Hour))
+	require.Nil(err)
+	assert.Equal(1, n)
+	assert.Contains(storage.objects, third)
+
+	// The latest backup replaces the existing DB, which is kept
+	restoredPath := filepath.Join(dir, "restored.sqlite3")
+	require.Nil(ioutil.WriteFile(restoredPath, []byte("old"), 0600))
+	name, err := RestoreDBBackup(storage, "secret", LatestDBBackup, restoredPath)
+	require.Nil(err)
+	assert.Equal(third, name)
+	restored, err := common.InitDB(restoredPath)
+	require.Nil(err)
+	chainID, err := restored.ChainID()
+	restored.Close()
+	require.Nil(err)
+	assert.Equal("1", chainID)
+	kept, err := filepath.Glob(restoredPath + ".bak-*")
+	require.Nil(err)
+	require.Len(kept, 1)
+	old, err := ioutil.ReadFile(kept[0])
+	require.Nil(err)
+	assert.Equal("old", string(old))
+
+	_, err = RestoreDBBackup(storage, "secret", first, restoredPath)
+	assert.Contains(err.Error(), "error reading DB backup")
+	_, err = RestoreDBBackup(newStubBackupStorage(), "secret", LatestDBBackup, restoredPath)
+	assert.EqualError(err, "no DB backups found")
+}
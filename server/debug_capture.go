@@ -0,0 +1,341 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+const (
+	defaultDebugCaptureDuration = 5 * time.Minute
+	maxDebugCaptureDuration     = time.Hour
+	defaultDebugCaptureSize     = 10 * 1024 * 1024
+	maxDebugCaptureSize         = 100 * 1024 * 1024
+)
+
+const redacted = "<redacted>"
+
+// Directory of the work directory that the debug captures are written to
+const debugCaptureDir = "debug"
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// debugCapture writes the details of the segments of a stream to a file until it expires or the
+// file reaches its maximum size
+type debugCapture struct {
+	mid     core.ManifestID
+	path    string
+	expires time.Time
+	maxSize int64
+
+	mu      sync.Mutex
+	file    *os.File
+	written int64
+	timer   *time.Timer
+}
+
+// DebugCaptureStatus describes a debug capture in progress
+type DebugCaptureStatus struct {
+	ManifestID core.ManifestID `json:"manifestID"`
+	Path       string          `json:"path"`
+	Expires    time.Time       `json:"expires"`
+	Written    int64           `json:"written"`
+	MaxSize    int64           `json:"maxSize"`
+}
+
+// debugCaptures are the debug captures in progress per stream
+var debugCaptures = struct {
+	mu       sync.Mutex
+	captures map[core.ManifestID]*debugCapture
+}{captures: make(map[core.ManifestID]*debugCapture)}
+
+// startDebugCapture starts capturing the segments of the stream to a file in dir for dur, replacing
+// the capture of the stream that is in progress if any
+func startDebugCapture(dir string, mid core.ManifestID, dur time.Duration, maxSize int64) (*DebugCaptureStatus, error) {
+	if mid == "" {
+		return nil, errors.New("missing manifestID")
+	}
+	if dur <= 0 || dur > maxDebugCaptureDuration {
+		return nil, fmt.Errorf("duration must be positive and at most %v", maxDebugCaptureDuration)
+	}
+	if maxSize <= 0 || maxSize > maxDebugCaptureSize {
+		return nil, fmt.Errorf("maxSize must be positive and at most %d", maxDebugCaptureSize)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%s-%d.log", unsafeFileChars.ReplaceAllString(string(mid), "_"), time.Now().Unix())
+	path := filepath.Join(dir, name)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &debugCapture{mid: mid, path: path, expires: time.Now().Add(dur), maxSize: maxSize, file: file}
+	debugCaptures.mu.Lock()
+	prev := debugCaptures.captures[mid]
+	debugCaptures.captures[mid] = c
+	debugCaptures.mu.Unlock()
+	if prev != nil {
+		prev.stop("replaced")
+	}
+	c.mu.Lock()
+	c.timer = time.AfterFunc(dur, func() { c.stop("expired") })
+	c.mu.Unlock()
+
+	glog.Infof("Started debug capture manifestID=%s path=%s duration=%v maxSize=%d", mid, path, dur, maxSize)
+	return c.status(), nil
+}
+
+// stopDebugCapture stops the capture of the stream. Returns false if it is not captured
+func stopDebugCapture(mid core.ManifestID) bool {
+	debugCaptures.mu.Lock()
+	c := debugCaptures.captures[mid]
+	debugCaptures.mu.Unlock()
+	if c == nil {
+		return false
+	}
+	c.stop("stopped")
+	return true
+}
+
+// listDebugCaptures returns the debug captures in progress
+func listDebugCaptures() []*DebugCaptureStatus {
+	debugCaptures.mu.Lock()
+	defer debugCaptures.mu.Unlock()
+
+	statuses := []*DebugCaptureStatus{}
+	for _, c := range debugCaptures.captures {
+		statuses = append(statuses, c.status())
+	}
+	return statuses
+}
+
+// captureDebug writes an event of the stream to its debug capture if the stream is captured
+func captureDebug(mid core.ManifestID, event string, data interface{}) {
+	debugCaptures.mu.Lock()
+	c := debugCaptures.captures[mid]
+	debugCaptures.mu.Unlock()
+	if c != nil {
+		c.write(event, data)
+	}
+}
+
+// debugCaptured returns whether the stream is captured, so that events that are expensive to
+// build are skipped otherwise
+func debugCaptured(mid core.ManifestID) bool {
+	debugCaptures.mu.Lock()
+	defer debugCaptures.mu.Unlock()
+	_, ok := debugCaptures.captures[mid]
+	return ok
+}
+
+func (c *debugCapture) write(event string, data interface{}) {
+	line, err := json.Marshal(struct {
+		Time  time.Time   `json:"time"`
+		Event string      `json:"event"`
+		Data  interface{} `json:"data"`
+	}{time.Now(), event, data})
+	if err != nil {
+		glog.Errorf("Unable to encode debug capture event manifestID=%s event=%s: %v", c.mid, event, err)
+		return
+	}
+	line = append(line, '\n')
+
+	c.mu.Lock()
+	if c.file == nil {
+		c.mu.Unlock()
+		return
+	}
+	full := c.written+int64(len(line)) > c.maxSize
+	if !full {
+		n, err := c.file.Write(line)
+		c.written += int64(n)
+		if err != nil {
+			glog.Errorf("Unable to write debug capture manifestID=%s path=%s: %v", c.mid, c.path, err)
+		}
+	}
+	c.mu.Unlock()
+
+	if full {
+		c.stop("reached maxSize")
+	}
+}
+
+// stop closes the file of the capture and removes it from the captures in progress
+func (c *debugCapture) stop(reason string) {
+	debugCaptures.mu.Lock()
+	if debugCaptures.captures[c.mid] == c {
+		delete(debugCaptures.captures, c.mid)
+	}
+	debugCaptures.mu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.file == nil {
+		return
+	}
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	if err := c.file.Close(); err != nil {
+		glog.Errorf("Unable to close debug capture manifestID=%s path=%s: %v", c.mid, c.path, err)
+	}
+	c.file = nil
+	glog.Infof("Stopped debug capture manifestID=%s path=%s written=%d reason=%s", c.mid, c.path, c.written, reason)
+}
+
+func (c *debugCapture) status() *DebugCaptureStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &DebugCaptureStatus{ManifestID: c.mid, Path: c.path, Expires: c.expires, Written: c.written, MaxSize: c.maxSize}
+}
+
+// captureHeaders copies the headers of a request or response without the segment and payment
+// headers, which are captured decoded with their signatures redacted
+func captureHeaders(h http.Header) http.Header {
+	headers := h.Clone()
+	for _, k := range []string{segmentHeader, paymentHeader} {
+		if headers.Get(k) != "" {
+			headers.Set(k, redacted)
+		}
+	}
+	return headers
+}
+
+// captureSegData decodes the segment credentials of a segment header with their signature and
+// storage credentials redacted
+func captureSegData(header string) interface{} {
+	buf, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		return err.Error()
+	}
+	var segData net.SegData
+	if err := proto.Unmarshal(buf, &segData); err != nil {
+		return err.Error()
+	}
+	segData.Sig = nil
+	redactStorage(segData.Storage)
+	return &segData
+}
+
+// capturePayment decodes the payment of a payment header with the signatures of its tickets redacted
+func capturePayment(header string) interface{} {
+	if header == "" {
+		return nil
+	}
+	payment, err := getPayment(header)
+	if err != nil {
+		return err.Error()
+	}
+	for _, p := range payment.TicketSenderParams {
+		p.Sig = nil
+	}
+	return &payment
+}
+
+// captureTranscodeResult copies a transcode result with its signature and storage credentials redacted
+func captureTranscodeResult(tr *net.TranscodeResult) interface{} {
+	res := proto.Clone(tr).(*net.TranscodeResult)
+	if data := res.GetData(); data != nil {
+		data.Sig = nil
+	}
+	if res.Info != nil {
+		redactStorage(res.Info.Storage)
+	}
+	return res
+}
+
+// redactStorage redacts the credentials of the S3 POST policies of storage
+func redactStorage(storage []*net.OSInfo) {
+	for _, s := range storage {
+		if s.S3Info != nil {
+			s.S3Info.Policy, s.S3Info.Signature, s.S3Info.Credential = redacted, redacted, redacted
+		}
+	}
+}
+
+// setDebugCapture starts or stops a debug capture from the form values of a CLI request. Captures
+// are written to the debug directory of dataDir
+func setDebugCapture(dataDir string, r *http.Request) (*DebugCaptureStatus, error) {
+	mid := core.ManifestID(r.FormValue("manifestID"))
+	if r.FormValue("stop") == "true" {
+		if !stopDebugCapture(mid) {
+			return nil, fmt.Errorf("manifestID %v is not captured", mid)
+		}
+		return nil, nil
+	}
+
+	dur := defaultDebugCaptureDuration
+	if v := r.FormValue("duration"); v != "" {
+		var err error
+		if dur, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("invalid duration %v", v)
+		}
+	}
+	maxSize := int64(defaultDebugCaptureSize)
+	if v := r.FormValue("maxSize"); v != "" {
+		var err error
+		if maxSize, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid maxSize %v", v)
+		}
+	}
+	return startDebugCapture(filepath.Join(dataDir, debugCaptureDir), mid, dur, maxSize)
+}
+
+// purgeDebugCaptures deletes the capture files in dir of the streams matched by purge, stopping
+// their captures in progress first. It returns the number of files that were deleted
+func purgeDebugCaptures(dir string, purge func(core.ManifestID) bool) (int, error) {
+	debugCaptures.mu.Lock()
+	var stopped []*debugCapture
+	for mid, c := range debugCaptures.captures {
+		if purge(mid) {
+			stopped = append(stopped, c)
+		}
+	}
+	debugCaptures.mu.Unlock()
+	for _, c := range stopped {
+		c.stop("purged")
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, f := range files {
+		// Captures are named <manifestID>-<unix time>.log
+		name := strings.TrimSuffix(f.Name(), ".log")
+		i := strings.LastIndex(name, "-")
+		if f.IsDir() || name == f.Name() || i < 0 {
+			continue
+		}
+		if _, err := strconv.ParseInt(name[i+1:], 10, 64); err != nil || !purge(core.ManifestID(name[:i])) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, f.Name())); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
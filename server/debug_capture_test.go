@@ -0,0 +1,227 @@
+package server
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type capturedEvent struct {
+	Event string                 `json:"event"`
+	Data  map[string]interface{} `json:"data"`
+}
+
+func readCapture(t *testing.T, path string) []capturedEvent {
+	f, err := os.Open(path)
+	require.Nil(t, err)
+	defer f.Close()
+
+	var events []capturedEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e capturedEvent
+		require.Nil(t, json.Unmarshal(scanner.Bytes(), &e))
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestDebugCapture(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "TestDebugCapture")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// Invalid captures
+	_, err = startDebugCapture(dir, "", time.Minute, 1000)
+	assert.EqualError(err, "missing manifestID")
+	_, err = startDebugCapture(dir, "foo", 2*time.Hour, 1000)
+	assert.NotNil(err)
+	_, err = startDebugCapture(dir, "foo", time.Minute, 0)
+	assert.NotNil(err)
+	assert.Empty(listDebugCaptures())
+
+	status, err := startDebugCapture(dir, "foo/bar", time.Minute, 1000)
+	require.Nil(err)
+	assert.Equal(core.ManifestID("foo/bar"), status.ManifestID)
+	assert.Equal(dir, filepath.Dir(status.Path))
+	assert.Len(listDebugCaptures(), 1)
+
+	// Only the events of the captured stream are written
+	assert.True(debugCaptured("foo/bar"))
+	assert.False(debugCaptured("baz"))
+	captureDebug("foo/bar", "first", map[string]interface{}{"seqNo": 1})
+	captureDebug("baz", "other", nil)
+	captureDebug("foo/bar", "second", map[string]interface{}{"seqNo": 2})
+	assert.True(stopDebugCapture("foo/bar"))
+	assert.False(stopDebugCapture("foo/bar"))
+	assert.False(debugCaptured("foo/bar"))
+	captureDebug("foo/bar", "third", nil)
+
+	events := readCapture(t, status.Path)
+	require.Len(events, 2)
+	assert.Equal("first", events[0].Event)
+	assert.Equal(1.0, events[0].Data["seqNo"])
+	assert.Equal("second", events[1].Event)
+
+	// The capture stops once the file would exceed its maximum size
+	status, err = startDebugCapture(dir, "size", time.Minute, 100)
+	require.Nil(err)
+	captureDebug("size", "first", nil)
+	captureDebug("size", "second", nil)
+	assert.False(debugCaptured("size"))
+	assert.Len(readCapture(t, status.Path), 1)
+
+	// The capture stops once it expires
+	_, err = startDebugCapture(dir, "expires", 10*time.Millisecond, 1000)
+	require.Nil(err)
+	assert.Eventually(func() bool { return !debugCaptured("expires") }, time.Second, 5*time.Millisecond)
+	assert.Empty(listDebugCaptures())
+}
+
+func TestDebugCapture_Redacts(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	segData := &net.SegData{
+		ManifestId: []byte("foo"),
+		Seq:        3,
+		Sig:        []byte("sig"),
+		Storage:    []*net.OSInfo{{S3Info: &net.S3OSInfo{Host: "host", Policy: "policy", Signature: "sig", Credential: "cred"}}},
+	}
+	buf, err := proto.Marshal(segData)
+	require.Nil(err)
+	captured := captureSegData(base64.StdEncoding.EncodeToString(buf)).(*net.SegData)
+	assert.Nil(captured.Sig)
+	assert.Equal(int64(3), captured.Seq)
+	assert.Equal(&net.S3OSInfo{Host: "host", Policy: redacted, Signature: redacted, Credential: redacted}, captured.Storage[0].S3Info)
+	assert.IsType("", captureSegData("%%%"))
+
+	payment := &net.Payment{
+		Sender:             []byte("sender"),
+		TicketSenderParams: []*net.TicketSenderParams{{SenderNonce: 1, Sig: []byte("sig")}},
+	}
+	buf, err = proto.Marshal(payment)
+	require.Nil(err)
+	capturedPayment := capturePayment(base64.StdEncoding.EncodeToString(buf)).(*net.Payment)
+	assert.Equal([]byte("sender"), capturedPayment.Sender)
+	assert.Equal(uint32(1), capturedPayment.TicketSenderParams[0].SenderNonce)
+	assert.Nil(capturedPayment.TicketSenderParams[0].Sig)
+	assert.Nil(capturePayment(""))
+
+	tr := &net.TranscodeResult{
+		Result: &net.TranscodeResult_Data{Data: &net.TranscodeData{Sig: []byte("sig")}},
+		Info:   &net.OrchestratorInfo{Storage: []*net.OSInfo{{S3Info: &net.S3OSInfo{Signature: "sig"}}}},
+	}
+	capturedResult := captureTranscodeResult(tr).(*net.TranscodeResult)
+	assert.Nil(capturedResult.GetData().Sig)
+	assert.Equal(redacted, capturedResult.Info.Storage[0].S3Info.Signature)
+	// The result itself is not changed
+	assert.Equal([]byte("sig"), tr.GetData().Sig)
+	assert.Equal("sig", tr.Info.Storage[0].S3Info.Signature)
+
+	headers := http.Header{}
+	headers.Set(segmentHeader, "creds")
+	headers.Set(paymentHeader, "payment")
+	headers.Set("Content-Type", "video/MP2T")
+	capturedHeaders := captureHeaders(headers)
+	assert.Equal(redacted, capturedHeaders.Get(segmentHeader))
+	assert.Equal(redacted, capturedHeaders.Get(paymentHeader))
+	assert.Equal("video/MP2T", capturedHeaders.Get("Content-Type"))
+	assert.Equal("creds", headers.Get(segmentHeader))
+}
+
+func TestSubmitSegment_DebugCapture(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "TestSubmitSegment_DebugCapture")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	buf, err := proto.Marshal(&net.TranscodeResult{
+		Result: &net.TranscodeResult_Data{
+			Data: &net.TranscodeData{Segments: []*net.TranscodedSegmentData{{Url: "foo"}}, Sig: []byte("bar")},
+		},
+	})
+	require.Nil(err)
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	mux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf)
+	})
+
+	sess := StubBroadcastSession(ts.URL)
+	status, err := startDebugCapture(dir, sess.ManifestID, time.Minute, 100000)
+	require.Nil(err)
+	defer stopDebugCapture(sess.ManifestID)
+
+	_, err = SubmitSegment(sess, &stream.HLSSegment{SeqNo: 4, Data: []byte("dummy")}, 0)
+	require.Nil(err)
+	require.True(stopDebugCapture(sess.ManifestID))
+
+	events := readCapture(t, status.Path)
+	require.Len(events, 3)
+	assert.Equal("submitSegment", events[0].Event)
+	assert.Equal(ts.URL, events[0].Data["orchestrator"])
+	assert.Equal(4.0, events[0].Data["seqNo"])
+	assert.Equal(redacted, events[0].Data["headers"].(map[string]interface{})[segmentHeader].([]interface{})[0])
+	assert.NotContains(events[0].Data["segData"], "sig")
+	assert.Equal("segmentResponse", events[1].Event)
+	assert.Equal(200.0, events[1].Data["status"])
+	assert.Equal("transcodeResult", events[2].Event)
+	data, err := ioutil.ReadFile(status.Path)
+	require.Nil(err)
+	assert.False(strings.Contains(string(data), base64.StdEncoding.EncodeToString([]byte("bar"))))
+}
+
+func TestSetDebugCapture(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "TestSetDebugCapture")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	form := func(v url.Values) *http.Request {
+		r, _ := http.NewRequest("POST", "/debugCapture", strings.NewReader(v.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+
+	_, err = setDebugCapture(dir, form(url.Values{"manifestID": {"foo"}, "duration": {"x"}}))
+	assert.EqualError(err, "invalid duration x")
+	_, err = setDebugCapture(dir, form(url.Values{"manifestID": {"foo"}, "maxSize": {"x"}}))
+	assert.EqualError(err, "invalid maxSize x")
+	_, err = setDebugCapture(dir, form(url.Values{"manifestID": {"foo"}, "stop": {"true"}}))
+	assert.EqualError(err, "manifestID foo is not captured")
+
+	status, err := setDebugCapture(dir, form(url.Values{"manifestID": {"foo"}}))
+	require.Nil(err)
+	assert.Equal(filepath.Join(dir, "debug"), filepath.Dir(status.Path))
+	assert.Equal(int64(defaultDebugCaptureSize), status.MaxSize)
+	assert.WithinDuration(time.Now().Add(defaultDebugCaptureDuration), status.Expires, time.Minute)
+
+	status, err = setDebugCapture(dir, form(url.Values{"manifestID": {"foo"}, "stop": {"true"}}))
+	assert.Nil(err)
+	assert.Nil(status)
+	assert.False(debugCaptured("foo"))
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/golang/glog"
+
+	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+// ProtocolDeprecations are the features of the broadcaster <-> orchestrator protocol that this node
+// will drop in a future version. Orchestrators advertise them to broadcasters in OrchestratorInfo so
+// that operators can upgrade before the features are removed
+var ProtocolDeprecations []*net.Deprecation
+
+// DeprecateFeature adds a protocol feature to the deprecations advertised by this node.
+// removalVersion is the version of the node software that drops the feature, empty if not decided yet
+func DeprecateFeature(feature, removalVersion, details string) {
+	ProtocolDeprecations = append(ProtocolDeprecations, &net.Deprecation{
+		Feature:        feature,
+		RemovalVersion: removalVersion,
+		Details:        details,
+	})
+}
+
+// seenDeprecations are the deprecations already reported per orchestrator, so that each
+// deprecation is only logged and counted once instead of on every OrchestratorInfo
+var seenDeprecations = struct {
+	mu    sync.Mutex
+	feats map[string]map[string]bool // orchestrator:feature
+}{feats: make(map[string]map[string]bool)}
+
+// reportDeprecations logs the protocol deprecations announced by an orchestrator and records them
+// in the metrics. Deprecations that were already reported for the orchestrator are skipped
+func reportDeprecations(orch string, deprecations []*net.Deprecation) {
+	if len(deprecations) == 0 {
+		return
+	}
+
+	seenDeprecations.mu.Lock()
+	defer seenDeprecations.mu.Unlock()
+
+	seen, ok := seenDeprecations.feats[orch]
+	if !ok {
+		seen = make(map[string]bool)
+		seenDeprecations.feats[orch] = seen
+	}
+	for _, d := range deprecations {
+		if d == nil || seen[d.Feature] {
+			continue
+		}
+		seen[d.Feature] = true
+
+		removal := d.RemovalVersion
+		if removal == "" {
+			removal = "a future version"
+		}
+		glog.Warningf("Orchestrator will drop protocol feature in %s, upgrade to stay compatible orch=%s feature=%s details=%q", removal, orch, d.Feature, d.Details)
+		if monitor.Enabled {
+			monitor.ProtocolDeprecation(d.Feature)
+		}
+	}
+}
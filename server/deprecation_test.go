@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+func TestGetOrchestrator_Deprecations(t *testing.T) {
+	orch := &mockOrchestrator{}
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	orch.On("VerifySig", mock.Anything, mock.Anything, mock.Anything).Return(true)
+	orch.On("ServiceURI").Return(url.Parse("http://someuri.com"))
+	orch.On("TicketParams", mock.Anything).Return(nil, nil)
+	orch.On("PriceInfo", mock.Anything).Return(nil, nil)
+	defer func() { ProtocolDeprecations = nil }()
+
+	assert := assert.New(t)
+
+	// No deprecations by default
+	oInfo, err := getOrchestrator(orch, &net.OrchestratorRequest{})
+	assert.Nil(err)
+	assert.Empty(oInfo.Deprecations)
+
+	DeprecateFeature("foo", "0.6.0", "use bar")
+	oInfo, err = getOrchestrator(orch, &net.OrchestratorRequest{})
+	assert.Nil(err)
+	assert.Len(oInfo.Deprecations, 1)
+	assert.Equal("foo", oInfo.Deprecations[0].Feature)
+	assert.Equal("0.6.0", oInfo.Deprecations[0].RemovalVersion)
+	assert.Equal("use bar", oInfo.Deprecations[0].Details)
+}
+
+func TestReportDeprecations(t *testing.T) {
+	defer func() { seenDeprecations.feats = make(map[string]map[string]bool) }()
+	assert := assert.New(t)
+
+	// Nothing to report
+	reportDeprecations("https://orch1", nil)
+	assert.Empty(seenDeprecations.feats)
+
+	reportDeprecations("https://orch1", []*net.Deprecation{{Feature: "foo"}, nil})
+	assert.Equal(map[string]bool{"foo": true}, seenDeprecations.feats["https://orch1"])
+
+	// Features are tracked per orchestrator
+	reportDeprecations("https://orch1", []*net.Deprecation{{Feature: "foo"}, {Feature: "bar"}})
+	reportDeprecations("https://orch2", []*net.Deprecation{{Feature: "foo"}})
+	assert.Equal(map[string]bool{"foo": true, "bar": true}, seenDeprecations.feats["https://orch1"])
+	assert.Equal(map[string]bool{"foo": true}, seenDeprecations.feats["https://orch2"])
+}
+
+func TestUpdateOrchestratorInfo_ReportsDeprecations(t *testing.T) {
+	defer func() { seenDeprecations.feats = make(map[string]map[string]bool) }()
+
+	sess := &BroadcastSession{}
+	oInfo := &net.OrchestratorInfo{
+		Transcoder:   "https://orch1",
+		Deprecations: []*net.Deprecation{{Feature: "foo"}},
+	}
+	updateOrchestratorInfo(sess, oInfo)
+
+	assert := assert.New(t)
+	assert.Equal(oInfo, sess.OrchestratorInfo)
+	assert.True(seenDeprecations.feats["https://orch1"]["foo"])
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+)
+
+// BroadcastDiversity requires the segments of the streams of the broadcaster to be spread over a
+// minimum number of orchestrators, if set
+var BroadcastDiversity *OrchDiversity
+
+// DiversityScope is the set of segments that are spread over the orchestrators
+type DiversityScope string
+
+const (
+	// DiversityStream spreads the segments of each stream over the orchestrators
+	DiversityStream DiversityScope = "stream"
+	// DiversityNamespace spreads the segments of the concurrent streams of each namespace, e.g. of a
+	// tenant, over the orchestrators. Streams without a namespace are spread on their own
+	DiversityNamespace DiversityScope = "namespace"
+)
+
+// OrchDiversity requires that the segments of each scope within a window are sent to at least a
+// minimum number of distinct orchestrators. Until they are, the sessions of the orchestrators that
+// were not sent a segment of the scope within the window are preferred. Scopes that don't have
+// sessions with enough orchestrators use the ones they have
+type OrchDiversity struct {
+	min    int
+	scope  DiversityScope
+	window time.Duration
+
+	mu sync.Mutex
+	// Last time that each orchestrator was sent a segment, by transcoder URI, of each scope
+	used map[string]map[string]time.Time
+}
+
+// NewOrchDiversity creates a requirement that the segments of each scope within window are sent to
+// at least min orchestrators
+func NewOrchDiversity(min int, scope DiversityScope, window time.Duration) (*OrchDiversity, error) {
+	if min < 2 {
+		return nil, fmt.Errorf("the minimum number of orchestrators must be at least 2, got %d", min)
+	}
+	if scope != DiversityStream && scope != DiversityNamespace {
+		return nil, fmt.Errorf("unknown orchestrator diversity scope %q", scope)
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("the orchestrator diversity window must be positive, got %v", window)
+	}
+	return &OrchDiversity{min: min, scope: scope, window: window, used: make(map[string]map[string]time.Time)}, nil
+}
+
+// key returns the key of the scope of the segments of a stream
+func (d *OrchDiversity) key(mid core.ManifestID) string {
+	if d.scope == DiversityNamespace {
+		if ns := mid.Namespace(); ns != "" {
+			return "namespace:" + ns
+		}
+	}
+	return "stream:" + string(mid)
+}
+
+// orchestrators returns the orchestrators that were sent a segment of a scope within the window.
+// Must be called with the lock held
+func (d *OrchDiversity) orchestrators(key string) map[string]time.Time {
+	used := d.used[key]
+	for transcoder, t := range used {
+		if time.Since(t) > d.window {
+			delete(used, transcoder)
+		}
+	}
+	if len(used) == 0 {
+		delete(d.used, key)
+	}
+	return used
+}
+
+// prefer returns whether the next segment of a stream should be sent to an orchestrator, or nil if
+// it can be sent to any orchestrator
+func (d *OrchDiversity) prefer(mid core.ManifestID) func(transcoder string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	used := d.orchestrators(d.key(mid))
+	if len(used) == 0 || len(used) >= d.min {
+		return nil
+	}
+	// The orchestrators are copied since they change once the lock is released
+	skip := make(map[string]bool, len(used))
+	for transcoder := range used {
+		skip[transcoder] = true
+	}
+	return func(transcoder string) bool { return !skip[transcoder] }
+}
+
+// use records that a segment of a stream was sent to an orchestrator
+func (d *OrchDiversity) use(mid core.ManifestID, transcoder string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	key := d.key(mid)
+	used := d.orchestrators(key)
+	if len(used) == 0 {
+		used = make(map[string]time.Time)
+		d.used[key] = used
+	}
+	used[transcoder] = time.Now()
+}
+
+// Orchestrators returns the number of distinct orchestrators that were sent a segment of the scope
+// of a stream within the window
+func (d *OrchDiversity) Orchestrators(mid core.ManifestID) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.orchestrators(d.key(mid)))
+}
+
+// endStream forgets the orchestrators of a stream once it ends, if the segments of each stream are spread
+func (d *OrchDiversity) endStream(mid core.ManifestID) {
+	if d.scope != DiversityStream {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.used, d.key(mid))
+}
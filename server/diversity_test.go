@@ -0,0 +1,112 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/core"
+)
+
+func TestNewOrchDiversity(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewOrchDiversity(1, DiversityStream, time.Minute)
+	assert.EqualError(err, "the minimum number of orchestrators must be at least 2, got 1")
+	_, err = NewOrchDiversity(2, "foo", time.Minute)
+	assert.EqualError(err, `unknown orchestrator diversity scope "foo"`)
+	_, err = NewOrchDiversity(2, DiversityNamespace, 0)
+	assert.EqualError(err, "the orchestrator diversity window must be positive, got 0s")
+
+	d, err := NewOrchDiversity(2, DiversityNamespace, time.Minute)
+	assert.Nil(err)
+	assert.NotNil(d)
+}
+
+func TestOrchDiversity(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	d, err := NewOrchDiversity(2, DiversityStream, time.Minute)
+	require.Nil(err)
+
+	// Any orchestrator can be used before the first segment
+	assert.Nil(d.prefer("foo"))
+	d.use("foo", "o1")
+	prefer := d.prefer("foo")
+	require.NotNil(prefer)
+	assert.False(prefer("o1"))
+	assert.True(prefer("o2"))
+	// Streams are spread on their own
+	assert.Nil(d.prefer("bar"))
+
+	d.use("foo", "o2")
+	assert.Nil(d.prefer("foo"))
+	assert.Equal(2, d.Orchestrators("foo"))
+
+	// Orchestrators that were not used within the window are forgotten
+	d.used["stream:foo"]["o1"] = time.Now().Add(-2 * time.Minute)
+	assert.Equal(1, d.Orchestrators("foo"))
+	prefer = d.prefer("foo")
+	require.NotNil(prefer)
+	assert.True(prefer("o1"))
+	assert.False(prefer("o2"))
+
+	// Orchestrators are recorded after the others expired
+	d.used["stream:foo"]["o2"] = time.Now().Add(-2 * time.Minute)
+	assert.Zero(d.Orchestrators("foo"))
+	d.use("foo", "o3")
+	assert.Equal(1, d.Orchestrators("foo"))
+
+	d.endStream("foo")
+	assert.Empty(d.used)
+
+	// The streams of a namespace share their orchestrators
+	d, err = NewOrchDiversity(2, DiversityNamespace, time.Minute)
+	require.Nil(err)
+	d.use(core.NamespacedManifestID("tenant", "foo"), "o1")
+	prefer = d.prefer(core.NamespacedManifestID("tenant", "bar"))
+	require.NotNil(prefer)
+	assert.False(prefer("o1"))
+	assert.Nil(d.prefer(core.NamespacedManifestID("other", "bar")))
+	d.endStream(core.NamespacedManifestID("tenant", "foo"))
+	assert.Equal(1, d.Orchestrators(core.NamespacedManifestID("tenant", "bar")))
+}
+
+func TestSelectSegmentSession_Diversity(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	oldDiversity := BroadcastDiversity
+	defer func() { BroadcastDiversity = oldDiversity }()
+	var err error
+	BroadcastDiversity, err = NewOrchDiversity(3, DiversityStream, time.Minute)
+	require.Nil(err)
+
+	// The most recently used session, at the end of the list, is selected by default
+	bsm := bsmWithSessList(selectionSessions("o1", "o2"))
+	sess := bsm.selectSegmentSession("foo", 0)
+	require.NotNil(sess)
+	assert.Equal("o2", sess.OrchestratorInfo.Transcoder)
+	bsm.completeSession(sess)
+
+	// The sessions of orchestrators that were not sent a segment are preferred
+	sess = bsm.selectSegmentSession("foo", 1)
+	require.NotNil(sess)
+	assert.Equal("o1", sess.OrchestratorInfo.Transcoder)
+	bsm.completeSession(sess)
+
+	// Without sessions of other orchestrators, any session is selected
+	sess = bsm.selectSegmentSession("foo", 2)
+	require.NotNil(sess)
+	assert.Equal("o1", sess.OrchestratorInfo.Transcoder)
+	bsm.completeSession(sess)
+	assert.Equal(2, BroadcastDiversity.Orchestrators("foo"))
+
+	// Other streams are selected by default
+	sess = bsm.selectSegmentSession("bar", 0)
+	require.NotNil(sess)
+	assert.Equal("o1", sess.OrchestratorInfo.Transcoder)
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/go-livepeer/pm"
+)
+
+// OrchestratorTicketExpiration is how long the tickets of the orchestrator can be redeemed for and
+// its redemption buffer, which are advertised to broadcasters if set
+var OrchestratorTicketExpiration *pm.TicketExpirationPolicy
+
+// BroadcastTicketExpiration is the ticket validity period and the minimum redemption buffer that
+// the broadcaster requires of orchestrators at session setup, if set
+var BroadcastTicketExpiration *pm.TicketExpirationPolicy
+
+// ticketExpirationInfo returns the ticket expiration policy that the orchestrator advertises, if any
+func ticketExpirationInfo() *net.TicketExpirationPolicy {
+	if OrchestratorTicketExpiration == nil {
+		return nil
+	}
+	return &net.TicketExpirationPolicy{
+		ValidityPeriod:   OrchestratorTicketExpiration.ValidityPeriod,
+		RedemptionBuffer: OrchestratorTicketExpiration.RedemptionBuffer,
+	}
+}
+
+// checkTicketExpiration checks that the tickets sent to an orchestrator are redeemed before they
+// expire for the broadcaster. Orchestrators that do not advertise their policy are not checked
+func checkTicketExpiration(info *net.OrchestratorInfo) error {
+	if BroadcastTicketExpiration == nil || info.TicketParams == nil || info.TicketExpiration == nil {
+		return nil
+	}
+	return BroadcastTicketExpiration.CheckRecipient(pm.TicketExpirationPolicy{
+		ValidityPeriod:   info.TicketExpiration.ValidityPeriod,
+		RedemptionBuffer: info.TicketExpiration.RedemptionBuffer,
+	})
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/go-livepeer/pm"
+)
+
+func TestGetOrchestrator_TicketExpiration(t *testing.T) {
+	orch := &mockOrchestrator{}
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	orch.On("VerifySig", mock.Anything, mock.Anything, mock.Anything).Return(true)
+	orch.On("ServiceURI").Return(url.Parse("http://someuri.com"))
+	orch.On("TicketParams", mock.Anything).Return(&net.TicketParams{}, nil)
+	orch.On("PriceInfo", mock.Anything).Return(nil, nil)
+	defer func() { OrchestratorTicketExpiration = nil }()
+
+	assert := assert.New(t)
+
+	// The policy is not advertised by default
+	oInfo, err := getOrchestrator(orch, &net.OrchestratorRequest{})
+	assert.Nil(err)
+	assert.Nil(oInfo.TicketExpiration)
+
+	OrchestratorTicketExpiration = &pm.TicketExpirationPolicy{ValidityPeriod: 2, RedemptionBuffer: 1}
+	oInfo, err = getOrchestrator(orch, &net.OrchestratorRequest{})
+	assert.Nil(err)
+	assert.Equal(&net.TicketExpirationPolicy{ValidityPeriod: 2, RedemptionBuffer: 1}, oInfo.TicketExpiration)
+}
+
+func TestCheckTicketExpiration(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { BroadcastTicketExpiration = nil }()
+
+	info := &net.OrchestratorInfo{TicketParams: &net.TicketParams{}, TicketExpiration: &net.TicketExpirationPolicy{ValidityPeriod: 2}}
+
+	// Not checked without a policy
+	assert.Nil(checkTicketExpiration(info))
+
+	BroadcastTicketExpiration = &pm.TicketExpirationPolicy{ValidityPeriod: 2, RedemptionBuffer: 1}
+	assert.EqualError(checkTicketExpiration(info), "recipient ticket redemption buffer of 0 rounds is less than 1 rounds")
+	info.TicketExpiration.RedemptionBuffer = 1
+	assert.Nil(checkTicketExpiration(info))
+
+	// Orchestrators that don't advertise their policy or aren't paid are not checked
+	assert.Nil(checkTicketExpiration(&net.OrchestratorInfo{TicketParams: &net.TicketParams{}}))
+	assert.Nil(checkTicketExpiration(&net.OrchestratorInfo{TicketExpiration: &net.TicketExpirationPolicy{ValidityPeriod: 3}}))
+}
+
+func TestSelectOrchestrator_TicketExpiration(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	defer func() { BroadcastTicketExpiration = nil }()
+	BroadcastTicketExpiration = &pm.TicketExpirationPolicy{ValidityPeriod: 2}
+
+	n, _ := core.NewLivepeerNode(nil, "", nil)
+	sd := &stubDiscovery{}
+	sd.infos = []*net.OrchestratorInfo{
+		{Transcoder: "https://o1:8935", TicketParams: &net.TicketParams{}, TicketExpiration: &net.TicketExpirationPolicy{ValidityPeriod: 2}},
+		{Transcoder: "https://o2:8935", TicketParams: &net.TicketParams{}, TicketExpiration: &net.TicketExpirationPolicy{ValidityPeriod: 3}},
+	}
+	n.OrchestratorPool = sd
+	mid := core.RandomManifestID()
+	sessions, err := selectOrchestrator(n, &streamParameters{mid: mid}, core.NewBasicPlaylistManager(mid, drivers.NewMemoryDriver(nil).NewSession(string(mid))), 2)
+	require.Nil(err)
+	require.Len(sessions, 1)
+	assert.Equal("https://o1:8935", sessions[0].OrchestratorInfo.Transcoder)
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"io"
+	"io/ioutil"
+	"math/rand"
+
+	"github.com/golang/glog"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+// FirstSegmentFastPath is set if broadcasters send the first segment of their streams before they
+// requested the info of any orchestrator, and if orchestrators transcode these segments before they
+// are paid for. The orchestrator info that establishes the session, and that the next segments are
+// paid with, is returned with the transcoded segment
+var FirstSegmentFastPath bool
+
+// firstSegmentHeader marks the first segment of a stream that is sent over the fast path
+const firstSegmentHeader = "Livepeer-First-Segment"
+
+// fastPathSessions is the number of orchestrators that the first segment of a stream can be sent to
+// over the fast path, so that it can be retried once while the sessions of the stream are created
+const fastPathSessions = 2
+
+// fastPathSessionList returns the sessions that the first segment of a stream is sent to over the
+// fast path, with orchestrators of the pool whose info was not requested yet. Orchestrators are
+// filtered by their health and transcoder URI only, since their info is not known. Streams with
+// profiles that require capabilities wait for the info, which advertises the capabilities
+func fastPathSessionList(n *core.LivepeerNode, params *streamParameters, cpl core.PlaylistManager) []*BroadcastSession {
+	if n.OrchestratorPool == nil || BroadcastABTest != nil || len(core.RequiredCapabilities(params.encoders)) > 0 {
+		return nil
+	}
+	uris := n.OrchestratorPool.GetURLs()
+	rpcBcast := core.NewBroadcaster(n)
+	var sessions []*BroadcastSession
+	for _, i := range rand.Perm(len(uris)) {
+		tinfo := &net.OrchestratorInfo{Transcoder: uris[i].String()}
+		if !usableOrchestrator(n.OrchHealth, tinfo.Transcoder) || (n.OrchLists != nil && !n.OrchLists.Allowed(tinfo)) {
+			continue
+		}
+		var balance Balance
+		if n.Balances != nil {
+			balance = core.NewBalance(params.mid, n.Balances)
+		}
+		sessions = append(sessions, &BroadcastSession{
+			Broadcaster:      rpcBcast,
+			ManifestID:       params.mid,
+			Profiles:         params.profiles,
+			Encoders:         params.encoders,
+			OrchestratorInfo: tinfo,
+			BroadcasterOS:    broadcasterOS(cpl),
+			Sender:           n.Sender,
+			Balance:          balance,
+			Establishing:     true,
+		})
+		if len(sessions) == fastPathSessions {
+			break
+		}
+	}
+	if len(sessions) > 0 {
+		glog.V(common.DEBUG).Infof("Sending the first segment over the fast path manifestID=%s orchs=%d", params.mid, len(sessions))
+	}
+	return sessions
+}
+
+// asyncBody is the body of a request that is read in the background
+type asyncBody struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+func readBodyAsync(r io.Reader) *asyncBody {
+	b := &asyncBody{done: make(chan struct{})}
+	go func() {
+		b.data, b.err = ioutil.ReadAll(r)
+		close(b.done)
+	}()
+	return b
+}
+
+// wait returns the body once it is read
+func (b *asyncBody) wait() ([]byte, error) {
+	<-b.done
+	return b.data, b.err
+}
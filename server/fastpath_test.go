@@ -0,0 +1,259 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/golang/protobuf/proto"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/go-livepeer/pm"
+)
+
+func TestNewSessionManager_FirstSegmentFastPath(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	oldFastPath := FirstSegmentFastPath
+	defer func() { FirstSegmentFastPath = oldFastPath }()
+	FirstSegmentFastPath = true
+
+	n, _ := core.NewLivepeerNode(nil, "", nil)
+	mid := core.RandomManifestID()
+	pl := core.NewBasicPlaylistManager(mid, drivers.NewMemoryDriver(nil).NewSession(string(mid)))
+	params := &streamParameters{mid: mid, profiles: []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}}
+
+	// Without orchestrator URLs the sessions are created before the first segment
+	sd := &stubDiscovery{infos: []*net.OrchestratorInfo{{Transcoder: "https://o1:8935"}}}
+	n.OrchestratorPool = sd
+	bsm := NewSessionManager(n, params, pl)
+	require.Len(bsm.sessList, 1)
+	assert.False(bsm.sessList[0].Establishing)
+
+	// The first segment is sent to orchestrators of the pool while the sessions are created
+	o1, _ := url.Parse("https://o1:8935")
+	o2, _ := url.Parse("https://o2:8935")
+	o3, _ := url.Parse("https://o3:8935")
+	sd.urls = []*url.URL{o1, o2, o3}
+	sd.infos = append(sd.infos, &net.OrchestratorInfo{Transcoder: "https://o4:8935"})
+	sd.waitGetOrch = make(chan struct{})
+	bsm = NewSessionManager(n, params, pl)
+	bsm.sessLock.Lock()
+	require.Len(bsm.sessList, fastPathSessions)
+	for _, sess := range bsm.sessList {
+		assert.True(sess.Establishing)
+		assert.Equal(mid, sess.ManifestID)
+		assert.Equal(params.profiles, sess.Profiles)
+		assert.Nil(sess.OrchestratorInfo.TicketParams)
+		assert.Contains(bsm.sessMap, sess.OrchestratorInfo.Transcoder)
+	}
+	bsm.sessLock.Unlock()
+
+	close(sd.waitGetOrch)
+	assert.Eventually(func() bool {
+		bsm.sessLock.Lock()
+		defer bsm.sessLock.Unlock()
+		// o1 is not duplicated if it was sent the first segment
+		return len(bsm.sessMap) == 3 || len(bsm.sessMap) == 4
+	}, time.Second, 10*time.Millisecond)
+	// The first segment is still sent over the fast path
+	sess := bsm.selectSession()
+	require.NotNil(sess)
+	assert.True(sess.Establishing)
+
+	// Unhealthy orchestrators are skipped
+	sd.waitGetOrch = nil
+	n.OrchHealth = core.NewOrchestratorHealth(1, time.Second, time.Minute)
+	n.OrchHealth.Failure(o1.String())
+	n.OrchHealth.Failure(o2.String())
+	bsm = NewSessionManager(n, params, pl)
+	bsm.sessLock.Lock()
+	defer bsm.sessLock.Unlock()
+	var transcoders []string
+	for _, sess := range bsm.sessList {
+		if sess.Establishing {
+			transcoders = append(transcoders, sess.OrchestratorInfo.Transcoder)
+		}
+	}
+	assert.Equal([]string{o3.String()}, transcoders)
+}
+
+func TestSubmitSegment_FirstSegmentFastPath(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	info := &net.OrchestratorInfo{
+		TicketParams: &net.TicketParams{
+			Recipient:         ethcommon.Address{}.Bytes(),
+			FaceValue:         big.NewInt(100).Bytes(),
+			WinProb:           big.NewInt(100).Bytes(),
+			RecipientRandHash: pm.RandHash().Bytes(),
+			Seed:              big.NewInt(100).Bytes(),
+		},
+		PriceInfo: &net.PriceInfo{PricePerUnit: 2, PixelsPerUnit: 1},
+	}
+	tr := &net.TranscodeResult{
+		Result: &net.TranscodeResult_Data{Data: &net.TranscodeData{
+			Segments: []*net.TranscodedSegmentData{{Url: "foo", Pixels: 5}},
+		}},
+	}
+
+	var sess *BroadcastSession
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	info.Transcoder = ts.URL
+	mux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("1", r.Header.Get(firstSegmentHeader))
+		payment, err := getPayment(r.Header.Get(paymentHeader))
+		require.Nil(err)
+		assert.Equal(sess.Broadcaster.Address().Bytes(), payment.Sender)
+		assert.Nil(payment.TicketParams)
+		assert.Nil(payment.ExpectedPrice)
+
+		buf, err := proto.Marshal(tr)
+		require.Nil(err)
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf)
+	})
+
+	sender := &pm.MockSender{}
+	sender.On("StartSession", mock.Anything).Return("foo")
+	balance := &mockBalance{}
+	// The fees of the segment are owed until the next segment
+	balance.On("Credit", big.NewRat(-10, 1))
+	sess = &BroadcastSession{
+		Broadcaster:      stubBroadcaster2(),
+		ManifestID:       core.RandomManifestID(),
+		OrchestratorInfo: &net.OrchestratorInfo{Transcoder: ts.URL},
+		Sender:           sender,
+		Balance:          balance,
+		Establishing:     true,
+	}
+
+	// Orchestrators must establish the session
+	_, err := SubmitSegment(sess, &stream.HLSSegment{Data: []byte("dummy")}, 0)
+	assert.EqualError(err, "session not established")
+	assert.True(sess.Establishing)
+	balance.AssertNotCalled(t, "StageUpdate", mock.Anything, mock.Anything)
+
+	tr.Info = info
+	tdata, err := SubmitSegment(sess, &stream.HLSSegment{Data: []byte("dummy")}, 0)
+	require.Nil(err)
+	assert.Equal("foo", tdata.Segments[0].Url)
+	assert.False(sess.Establishing)
+	assert.Equal(info.PriceInfo.PricePerUnit, sess.OrchestratorInfo.PriceInfo.PricePerUnit)
+	assert.Equal("foo", sess.PMSessionID)
+	balance.AssertCalled(t, "Credit", big.NewRat(-10, 1))
+}
+
+func TestServeSegment_FirstSegmentFastPath(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	oldFastPath, oldStorage := FirstSegmentFastPath, drivers.NodeStorage
+	defer func() { FirstSegmentFastPath, drivers.NodeStorage = oldFastPath, oldStorage }()
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+
+	orch := &mockOrchestrator{}
+	handler := serveSegmentHandler(orch)
+	orch.On("VerifySig", mock.Anything, mock.Anything, mock.Anything).Return(true)
+
+	s := &BroadcastSession{
+		Broadcaster: stubBroadcaster2(),
+		ManifestID:  core.RandomManifestID(),
+		Profiles:    []ffmpeg.VideoProfile{ffmpeg.P720p60fps16x9},
+	}
+	seg := &stream.HLSSegment{Data: []byte("foo")}
+	creds, err := genSegCreds(s, seg)
+	require.Nil(err)
+	md, err := verifySegCreds(orch, creds, ethcommon.Address{})
+	require.Nil(err)
+
+	sender := s.Broadcaster.Address()
+	data, err := proto.Marshal(&net.Payment{Sender: sender.Bytes()})
+	require.Nil(err)
+	payment := net.Payment{Sender: sender.Bytes()}
+	headers := map[string]string{
+		paymentHeader:      base64.StdEncoding.EncodeToString(data),
+		segmentHeader:      creds,
+		firstSegmentHeader: "1",
+	}
+
+	// Orchestrators without the fast path require the segment to be paid for
+	orch.On("ProcessPayment", payment, s.ManifestID).Return(nil)
+	orch.On("SufficientBalance", s.ManifestID).Return(false).Once()
+	resp := httpPostResp(handler, bytes.NewReader(seg.Data), headers)
+	resp.Body.Close()
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	orch.AssertNotCalled(t, "AcceptFirstSegment", mock.Anything, mock.Anything)
+
+	FirstSegmentFastPath = true
+	orch.On("AcceptFirstSegment", sender, s.ManifestID).Return(errors.New("the stream already has a balance")).Once()
+	resp = httpPostResp(handler, bytes.NewReader(seg.Data), headers)
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Nil(err)
+	assert.Equal(http.StatusPaymentRequired, resp.StatusCode)
+	assert.Equal("the stream already has a balance", strings.TrimSpace(string(body)))
+
+	// The segment is transcoded and returned with the info that establishes the session
+	params := defaultTicketParams()
+	price := &net.PriceInfo{PricePerUnit: 2, PixelsPerUnit: 3}
+	uri, err := url.Parse("https://127.0.0.1:8935")
+	require.Nil(err)
+	orch.On("AcceptFirstSegment", sender, s.ManifestID).Return(nil)
+	orch.On("TicketParams", sender).Return(params, nil)
+	orch.On("PriceInfo", sender).Return(price, nil)
+	orch.On("ServiceURI").Return(uri)
+	tRes := &core.TranscodeResult{
+		TranscodeData: &core.TranscodeData{Segments: []*core.TranscodedSegmentData{{Data: []byte("foo"), Pixels: 100}}},
+		Sig:           []byte("foo"),
+		OS:            drivers.NewMemoryDriver(nil).NewSession(""),
+	}
+	orch.On("TranscodeSeg", md, seg).Return(tRes, nil)
+	orch.On("DebitFees", s.ManifestID, mock.Anything, int64(100))
+
+	resp = httpPostResp(handler, bytes.NewReader(seg.Data), headers)
+	body, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Nil(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	var tr net.TranscodeResult
+	require.Nil(proto.Unmarshal(body, &tr))
+	require.NotNil(tr.Info)
+	assert.Equal(uri.String(), tr.Info.Transcoder)
+	assert.Equal(params.RecipientRandHash, tr.Info.TicketParams.RecipientRandHash)
+	assert.Equal(price.PricePerUnit, tr.Info.PriceInfo.PricePerUnit)
+	_, ok := tr.Result.(*net.TranscodeResult_Data)
+	assert.True(ok)
+	// The segment is charged at the price of the info
+	orch.AssertCalled(t, "DebitFees", s.ManifestID, mock.MatchedBy(func(p *net.PriceInfo) bool {
+		return p.PricePerUnit == price.PricePerUnit && p.PixelsPerUnit == price.PixelsPerUnit
+	}), int64(100))
+
+	// Segments with tickets are not sent over the fast path
+	orch.On("SufficientBalance", s.ManifestID).Return(false).Once()
+	data, err = proto.Marshal(&net.Payment{Sender: sender.Bytes(), TicketParams: params})
+	require.Nil(err)
+	headers[paymentHeader] = base64.StdEncoding.EncodeToString(data)
+	orch.On("ProcessPayment", mock.Anything, s.ManifestID).Return(nil)
+	resp = httpPostResp(handler, bytes.NewReader(seg.Data), headers)
+	resp.Body.Close()
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	ffmpeg "github.com/livepeer/lpms/ffmpeg"
+)
+
+// remuxFMP4 remuxes a self-contained fragmented MP4 segment into MPEG-TS. Replaced in tests
+var remuxFMP4 = ffmpegRemuxTS
+
+var errMP4Data = errors.New("data is not made of MP4 boxes")
+var errFMP4Init = errors.New("no initialization segment was pushed for the stream")
+
+// mp4Boxes returns the types of the top level boxes of MP4 data
+func mp4Boxes(data []byte) (map[string]bool, error) {
+	boxes := make(map[string]bool)
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, errMP4Data
+		}
+		size := uint64(binary.BigEndian.Uint32(data))
+		hdrLen := uint64(8)
+		switch size {
+		case 0:
+			// The box extends to the end of the data
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return nil, errMP4Data
+			}
+			size, hdrLen = binary.BigEndian.Uint64(data[8:]), 16
+		}
+		if size < hdrLen || size > uint64(len(data)) {
+			return nil, errMP4Data
+		}
+		boxes[string(data[4:8])] = true
+		data = data[size:]
+	}
+	return boxes, nil
+}
+
+// pushFMP4 turns a fragmented MP4 segment that was pushed for the stream into an MPEG-TS
+// segment. Initialization segments are kept for the fragments that follow them, in which
+// case no data is returned
+func (s *LivepeerServer) pushFMP4(cxn *rtmpConnection, data []byte) ([]byte, error) {
+	boxes, err := mp4Boxes(data)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case boxes["moov"] && !boxes["moof"]:
+		s.connectionLock.Lock()
+		cxn.fmp4Init = data
+		s.connectionLock.Unlock()
+		return nil, nil
+	case boxes["moof"] && !boxes["moov"]:
+		s.connectionLock.RLock()
+		init := cxn.fmp4Init
+		s.connectionLock.RUnlock()
+		if init == nil {
+			return nil, errFMP4Init
+		}
+		data = append(append(make([]byte, 0, len(init)+len(data)), init...), data...)
+	case !boxes["moov"]:
+		return nil, errMP4Data
+	}
+	return remuxFMP4(s.LivepeerNode.WorkDir, data)
+}
+
+// ffmpegRemuxTS copies the streams of an MP4 segment into MPEG-TS without transcoding them
+func ffmpegRemuxTS(workDir string, data []byte) ([]byte, error) {
+	dir, err := ioutil.TempDir(workDir, "push")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in, out := filepath.Join(dir, "in.mp4"), filepath.Join(dir, "out.ts")
+	if err := ioutil.WriteFile(in, data, 0644); err != nil {
+		return nil, err
+	}
+	opts := []ffmpeg.TranscodeOptions{{
+		Oname:        out,
+		Profile:      ffmpeg.VideoProfile{Name: "remux"},
+		Accel:        ffmpeg.Software,
+		Muxer:        ffmpeg.ComponentOptions{Name: "mpegts"},
+		VideoEncoder: ffmpeg.ComponentOptions{Name: "copy"},
+		AudioEncoder: ffmpeg.ComponentOptions{Name: "copy"},
+	}}
+	if _, err := ffmpeg.Transcode3(&ffmpeg.TranscodeOptionsIn{Fname: in, Accel: ffmpeg.Software}, opts); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(out)
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	gonet "net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// OrchestratorFrontends are the URIs of the frontends of the orchestrator in other regions,
+// that share its ETH identity, which are advertised to broadcasters in OrchestratorInfo
+var OrchestratorFrontends []string
+
+// OrchestratorRegion is the region tag of the orchestrator, e.g. "us-east", which is advertised
+// to broadcasters in OrchestratorInfo
+var OrchestratorRegion string
+
+// frontendProbeTimeout is how long a broadcaster waits to connect to an orchestrator frontend
+var frontendProbeTimeout = 2 * time.Second
+
+// frontendLatencyTTL is how long the measured latency of an orchestrator frontend is reused
+const frontendLatencyTTL = 10 * time.Minute
+
+// probeFrontend measures the latency of a frontend. Replaced in tests
+var probeFrontend = dialLatency
+
+type frontendLatency struct {
+	latency time.Duration
+	err     error
+	updated time.Time
+}
+
+var frontendLatencies = struct {
+	mu    sync.Mutex
+	hosts map[string]frontendLatency
+}{hosts: make(map[string]frontendLatency)}
+
+// nearestFrontend returns the URI among the transcoder URI of an orchestrator and the URIs
+// of its frontends that the broadcaster connects to the fastest
+func nearestFrontend(transcoder string, frontends []string) string {
+	candidates := append([]string{transcoder}, frontends...)
+	latencies := make([]frontendLatency, len(candidates))
+	var wg sync.WaitGroup
+	for i, uri := range candidates {
+		wg.Add(1)
+		go func(i int, uri string) {
+			defer wg.Done()
+			latencies[i] = cachedLatency(uri)
+		}(i, uri)
+	}
+	wg.Wait()
+
+	nearest := -1
+	for i, l := range latencies {
+		if l.err != nil {
+			glog.V(4).Infof("Skipping orchestrator frontend uri=%v err=%v", candidates[i], l.err)
+			continue
+		}
+		if nearest < 0 || l.latency < latencies[nearest].latency {
+			nearest = i
+		}
+	}
+	if nearest < 0 {
+		// The transcoder URI is used when none of the frontends can be reached
+		return transcoder
+	}
+	if nearest > 0 {
+		glog.Infof("Using orchestrator frontend uri=%v latency=%v instead of uri=%v", candidates[nearest], latencies[nearest].latency, transcoder)
+	}
+	return candidates[nearest]
+}
+
+func cachedLatency(uri string) frontendLatency {
+	u, err := url.ParseRequestURI(uri)
+	if err != nil {
+		return frontendLatency{err: err}
+	}
+
+	frontendLatencies.mu.Lock()
+	l, ok := frontendLatencies.hosts[u.Host]
+	frontendLatencies.mu.Unlock()
+	if ok && time.Since(l.updated) < frontendLatencyTTL {
+		return l
+	}
+
+	latency, err := probeFrontend(u.Host)
+	l = frontendLatency{latency: latency, err: err, updated: time.Now()}
+	frontendLatencies.mu.Lock()
+	frontendLatencies.hosts[u.Host] = l
+	frontendLatencies.mu.Unlock()
+	return l
+}
+
+// dialLatency returns how long it takes to open a TCP connection to host, which resolves
+// to the frontend that DNS routes the broadcaster to when the host is a GeoDNS name
+func dialLatency(host string) (time.Duration, error) {
+	start := time.Now()
+	conn, err := gonet.DialTimeout("tcp", host, frontendProbeTimeout)
+	if err != nil {
+		return 0, err
+	}
+	conn.Close()
+	return time.Since(start), nil
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNearestFrontend(t *testing.T) {
+	assert := assert.New(t)
+
+	oldProbe := probeFrontend
+	defer func() { probeFrontend = oldProbe }()
+
+	probes := make(map[string]int)
+	latencies := map[string]time.Duration{
+		"orch.example.com:8935": 80 * time.Millisecond,
+		"eu.example.com:8935":   20 * time.Millisecond,
+		"us.example.com:8935":   50 * time.Millisecond,
+	}
+	probeFrontend = func(host string) (time.Duration, error) {
+		probes[host]++
+		if l, ok := latencies[host]; ok {
+			return l, nil
+		}
+		return 0, errors.New("unreachable")
+	}
+	frontendLatencies.hosts = make(map[string]frontendLatency)
+
+	transcoder := "https://orch.example.com:8935"
+	assert.Equal("https://eu.example.com:8935", nearestFrontend(transcoder, []string{"https://us.example.com:8935", "https://eu.example.com:8935"}))
+	// Latencies are reused
+	assert.Equal("https://eu.example.com:8935", nearestFrontend(transcoder, []string{"https://eu.example.com:8935"}))
+	assert.Equal(1, probes["eu.example.com:8935"])
+
+	// Unreachable or invalid frontends are skipped
+	assert.Equal(transcoder, nearestFrontend(transcoder, []string{"https://down.example.com:8935", "foo"}))
+	assert.Equal("https://us.example.com:8935", nearestFrontend("https://down.example.com:8935", []string{"https://us.example.com:8935"}))
+	// The transcoder URI is used if nothing can be reached
+	assert.Equal("https://down.example.com:8935", nearestFrontend("https://down.example.com:8935", []string{"https://down2.example.com:8935"}))
+}
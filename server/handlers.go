@@ -5,13 +5,55 @@ import (
 	"fmt"
 	"math/big"
 	"net/http"
+	"strings"
 
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/golang/glog"
 	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
 	"github.com/livepeer/go-livepeer/eth"
 	"github.com/livepeer/go-livepeer/pm"
 )
 
+// LegacyCliResponses makes the CLI endpoints respond with the plain text bodies of the previous
+// versions of the node instead of JSON, for the tools that parse them
+var LegacyCliResponses bool
+
+// Machine readable codes of the errors of the CLI endpoints
+const (
+	CliErrBadRequest       = "bad_request"
+	CliErrMissingParam     = "missing_param"
+	CliErrInvalidParam     = "invalid_param"
+	CliErrNotSupported     = "not_supported"
+	CliErrTransaction      = "transaction_failed"
+	CliErrNotFound         = "not_found"
+	CliErrMethodNotAllowed = "method_not_allowed"
+	CliErrUnauthorized     = "unauthorized"
+	CliErrForbidden        = "forbidden"
+	CliErrUnavailable      = "unavailable"
+	CliErrInternal         = "internal_error"
+)
+
+// CliError is the body of the error responses of the CLI endpoints
+type CliError struct {
+	Error CliErrorDetails `json:"error"`
+}
+
+// CliErrorDetails describes the error of a CLI request
+type CliErrorDetails struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// CliStatus is the body of the responses of the CLI endpoints that change the node or send a
+// transaction. TxHash is the hash of the main transaction sent
+type CliStatus struct {
+	Status string `json:"status"`
+	TxHash string `json:"txHash,omitempty"`
+}
+
 func respondWith500(w http.ResponseWriter, errMsg string) {
 	respondWithError(w, errMsg, http.StatusInternalServerError)
 }
@@ -20,9 +62,88 @@ func respondWith400(w http.ResponseWriter, errMsg string) {
 	respondWithError(w, errMsg, http.StatusBadRequest)
 }
 
-func respondWithError(w http.ResponseWriter, errMsg string, code int) {
-	glog.Errorf("HTTP Response Error %v: %v", code, errMsg)
-	http.Error(w, errMsg, code)
+// respondWithError responds with an error with the default code of its HTTP status
+func respondWithError(w http.ResponseWriter, errMsg string, status int) {
+	respondWithCliError(w, status, cliErrorCode(status), errMsg)
+}
+
+func respondWithCliError(w http.ResponseWriter, status int, code, errMsg string) {
+	glog.Errorf("HTTP Response Error %v: %v", status, errMsg)
+	if LegacyCliResponses {
+		http.Error(w, errMsg, status)
+		return
+	}
+	data, err := json.Marshal(CliError{Error: CliErrorDetails{Code: code, Message: errMsg}})
+	if err != nil {
+		http.Error(w, errMsg, status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// cliErrorCode returns the code of the errors of an HTTP status
+func cliErrorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CliErrBadRequest
+	case http.StatusUnauthorized:
+		return CliErrUnauthorized
+	case http.StatusForbidden:
+		return CliErrForbidden
+	case http.StatusNotFound:
+		return CliErrNotFound
+	case http.StatusMethodNotAllowed:
+		return CliErrMethodNotAllowed
+	case http.StatusNotImplemented:
+		return CliErrNotSupported
+	case http.StatusServiceUnavailable:
+		return CliErrUnavailable
+	}
+	return CliErrInternal
+}
+
+// respondMissingEth responds to the requests that need the ETH client of a node without one
+func respondMissingEth(w http.ResponseWriter) {
+	respondWithCliError(w, http.StatusInternalServerError, CliErrNotSupported, "missing ETH client")
+}
+
+// respondWithJSON responds with value encoded as JSON
+func respondWithJSON(w http.ResponseWriter, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		respondWith500(w, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// respondWithValue responds with a single named value, or with legacy as plain text with
+// LegacyCliResponses
+func respondWithValue(w http.ResponseWriter, name string, value interface{}, legacy string) {
+	if LegacyCliResponses {
+		w.Write([]byte(legacy))
+		return
+	}
+	respondWithJSON(w, map[string]interface{}{name: value})
+}
+
+// respondWithStatus responds to a request that changed the node, with the hash of the main
+// transaction that it sent if any. legacy is the plain text body with LegacyCliResponses
+func respondWithStatus(w http.ResponseWriter, tx *types.Transaction, legacy string) {
+	if LegacyCliResponses {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(legacy))
+		return
+	}
+	status := CliStatus{Status: "success"}
+	if tx != nil {
+		status.TxHash = tx.Hash().Hex()
+	}
+	respondWithJSON(w, status)
 }
 
 func mustHaveFormParams(h http.Handler, params ...string) http.Handler {
@@ -34,7 +155,7 @@ func mustHaveFormParams(h http.Handler, params ...string) http.Handler {
 
 		for _, param := range params {
 			if r.FormValue(param) == "" {
-				respondWith400(w, fmt.Sprintf("missing form param: %s", param))
+				respondWithCliError(w, http.StatusBadRequest, CliErrMissingParam, fmt.Sprintf("missing form param: %s", param))
 				return
 			}
 		}
@@ -43,6 +164,27 @@ func mustHaveFormParams(h http.Handler, params ...string) http.Handler {
 	})
 }
 
+// endStreamHandler forcibly ends the stream of the manifestID form param
+func endStreamHandler(s *LivepeerServer) http.Handler {
+	return mustHaveFormParams(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondWithError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		mid := core.ManifestID(r.FormValue("manifestID"))
+		if err := s.EndStream(mid); err != nil {
+			if err == errUnknownStream {
+				respondWithCliError(w, http.StatusNotFound, CliErrNotFound, fmt.Sprintf("unknown stream %v", mid))
+				return
+			}
+			respondWith500(w, err.Error())
+			return
+		}
+		glog.Infof("Ended stream manifestID=%v", mid)
+		respondWithStatus(w, nil, "")
+	}), "manifestID")
+}
+
 // BlockGetter is an interface which describes an object capable
 // of getting blocks
 type BlockGetter interface {
@@ -53,7 +195,7 @@ type BlockGetter interface {
 func currentBlockHandler(getter BlockGetter) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if getter == nil {
-			respondWith500(w, "missing block getter")
+			respondWithCliError(w, http.StatusInternalServerError, CliErrNotSupported, "missing block getter")
 			return
 		}
 
@@ -63,153 +205,221 @@ func currentBlockHandler(getter BlockGetter) http.Handler {
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
-		w.Write(blk.Bytes())
+		respondWithValue(w, "blockNumber", blk, string(blk.Bytes()))
 	})
 }
 
-func fundDepositAndReserveHandler(client eth.LivepeerEthClient) http.Handler {
+// respondWithTx waits for a transaction submitted by a CLI request and responds with its result. With
+// the async=true form param, it responds with the hash of the transaction right away instead, and
+// the transaction is tracked by txs until it is mined
+func respondWithTx(w http.ResponseWriter, r *http.Request, client eth.LivepeerEthClient, txs *TxTracker, method string, tx *types.Transaction) {
+	if r.FormValue("async") == "true" {
+		if txs == nil || tx == nil {
+			respondWithCliError(w, http.StatusInternalServerError, CliErrNotSupported, fmt.Sprintf("could not track %v transaction", method))
+			return
+		}
+		status := txs.Track(method, tx, client.CheckTx)
+		if LegacyCliResponses {
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(status.TxHash))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(CliStatus{Status: status.Status, TxHash: status.TxHash})
+		return
+	}
+
+	if err := client.CheckTx(tx); err != nil {
+		respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, fmt.Sprintf("could not execute %v: %v", method, err))
+		return
+	}
+	respondWithStatus(w, tx, method+" success")
+}
+
+func fundDepositAndReserveHandler(client eth.LivepeerEthClient, txs *TxTracker) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if client == nil {
-			respondWith500(w, "missing ETH client")
+			respondMissingEth(w)
 			return
 		}
 
 		depositAmount, err := common.ParseBigInt(r.FormValue("depositAmount"))
 		if err != nil {
-			respondWith400(w, fmt.Sprintf("invalid depositAmount: %v", err))
+			respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, fmt.Sprintf("invalid depositAmount: %v", err))
 			return
 		}
 
 		reserveAmount, err := common.ParseBigInt(r.FormValue("reserveAmount"))
 		if err != nil {
-			respondWith400(w, fmt.Sprintf("invalid reserveAmount: %v", err))
+			respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, fmt.Sprintf("invalid reserveAmount: %v", err))
 			return
 		}
 
 		tx, err := client.FundDepositAndReserve(depositAmount, reserveAmount)
 		if err != nil {
-			respondWith500(w, fmt.Sprintf("could not execute fundDepositAndReserve: %v", err))
-			return
-		}
-
-		err = client.CheckTx(tx)
-		if err != nil {
-			respondWith500(w, fmt.Sprintf("could not execute fundDepositAndReserve: %v", err))
+			respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, fmt.Sprintf("could not execute fundDepositAndReserve: %v", err))
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("fundDepositAndReserve success"))
+		respondWithTx(w, r, client, txs, "fundDepositAndReserve", tx)
 	})
 }
 
-func fundDepositHandler(client eth.LivepeerEthClient) http.Handler {
+func fundDepositHandler(client eth.LivepeerEthClient, txs *TxTracker) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if client == nil {
-			respondWith500(w, "missing ETH client")
+			respondMissingEth(w)
 			return
 		}
 
 		amount, err := common.ParseBigInt(r.FormValue("amount"))
 		if err != nil {
-			respondWith400(w, fmt.Sprintf("invalid amount: %v", err))
+			respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, fmt.Sprintf("invalid amount: %v", err))
 			return
 		}
 
 		tx, err := client.FundDeposit(amount)
 		if err != nil {
-			respondWith500(w, fmt.Sprintf("could not execute fundDeposit: %v", err))
+			respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, fmt.Sprintf("could not execute fundDeposit: %v", err))
 			return
 		}
 
-		err = client.CheckTx(tx)
+		respondWithTx(w, r, client, txs, "fundDeposit", tx)
+	})
+}
+
+func fundReserveHandler(client eth.LivepeerEthClient, txs *TxTracker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if client == nil {
+			respondMissingEth(w)
+			return
+		}
+
+		amount, err := common.ParseBigInt(r.FormValue("amount"))
 		if err != nil {
-			respondWith500(w, fmt.Sprintf("could not execute fundDeposit: %v", err))
+			respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, fmt.Sprintf("invalid amount: %v", err))
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("fundDeposit success"))
+		tx, err := client.FundReserve(amount)
+		if err != nil {
+			respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, fmt.Sprintf("could not execute fundReserve: %v", err))
+			return
+		}
+
+		respondWithTx(w, r, client, txs, "fundReserve", tx)
 	})
 }
 
-func unlockHandler(client eth.LivepeerEthClient) http.Handler {
+// depositWithdrawer is implemented by the ETH clients of TicketBroker contracts that support
+// withdrawing a part of a sender's deposit without unlocking its deposit and reserve
+type depositWithdrawer interface {
+	WithdrawDeposit(amount *big.Int) (*types.Transaction, error)
+}
+
+func withdrawDepositHandler(client eth.LivepeerEthClient, txs *TxTracker) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if client == nil {
-			respondWith500(w, "missing ETH client")
+			respondMissingEth(w)
 			return
 		}
 
-		tx, err := client.Unlock()
+		amount, err := common.ParseBigInt(r.FormValue("amount"))
 		if err != nil {
-			respondWith500(w, fmt.Sprintf("could not execute unlock: %v", err))
+			respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, fmt.Sprintf("invalid amount: %v", err))
+			return
+		}
+		if amount.Sign() <= 0 {
+			respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, "invalid amount: must be greater than 0")
 			return
 		}
 
-		err = client.CheckTx(tx)
+		deposit := big.NewInt(0)
+		info, err := client.GetSenderInfo(client.Account().Address)
+		if err != nil && err.Error() != "ErrNoResult" {
+			respondWithCliError(w, http.StatusInternalServerError, CliErrInternal, fmt.Sprintf("could not get sender info: %v", err))
+			return
+		}
+		if err == nil {
+			deposit = info.Deposit
+		}
+		if amount.Cmp(deposit) > 0 {
+			respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, fmt.Sprintf("invalid amount: %v exceeds the deposit of %v", amount, deposit))
+			return
+		}
+
+		withdrawer, ok := client.(depositWithdrawer)
+		if !ok {
+			respondWithCliError(w, http.StatusNotImplemented, CliErrNotSupported, "partial deposit withdrawals are not supported by the TicketBroker contract, use /unlock and /withdraw to withdraw the whole deposit and reserve")
+			return
+		}
+
+		tx, err := withdrawer.WithdrawDeposit(amount)
 		if err != nil {
-			respondWith500(w, fmt.Sprintf("could not execute unlock: %v", err))
+			respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, fmt.Sprintf("could not execute withdrawDeposit: %v", err))
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("unlock success"))
+		respondWithTx(w, r, client, txs, "withdrawDeposit", tx)
 	})
 }
 
-func cancelUnlockHandler(client eth.LivepeerEthClient) http.Handler {
+func unlockHandler(client eth.LivepeerEthClient, txs *TxTracker) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if client == nil {
-			respondWith500(w, "missing ETH client")
+			respondMissingEth(w)
 			return
 		}
 
-		tx, err := client.CancelUnlock()
+		tx, err := client.Unlock()
 		if err != nil {
-			respondWith500(w, fmt.Sprintf("could not execute cancelUnlock: %v", err))
+			respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, fmt.Sprintf("could not execute unlock: %v", err))
 			return
 		}
 
-		err = client.CheckTx(tx)
+		respondWithTx(w, r, client, txs, "unlock", tx)
+	})
+}
+
+func cancelUnlockHandler(client eth.LivepeerEthClient, txs *TxTracker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if client == nil {
+			respondMissingEth(w)
+			return
+		}
+
+		tx, err := client.CancelUnlock()
 		if err != nil {
-			respondWith500(w, fmt.Sprintf("could not execute cancelUnlock: %v", err))
+			respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, fmt.Sprintf("could not execute cancelUnlock: %v", err))
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("cancelUnlock success"))
+		respondWithTx(w, r, client, txs, "cancelUnlock", tx)
 	})
 }
 
-func withdrawHandler(client eth.LivepeerEthClient) http.Handler {
+func withdrawHandler(client eth.LivepeerEthClient, txs *TxTracker) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if client == nil {
-			respondWith500(w, "missing ETH client")
+			respondMissingEth(w)
 			return
 		}
 
 		tx, err := client.Withdraw()
 		if err != nil {
-			respondWith500(w, fmt.Sprintf("could not execute withdraw: %v", err))
+			respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, fmt.Sprintf("could not execute withdraw: %v", err))
 			return
 		}
 
-		err = client.CheckTx(tx)
-		if err != nil {
-			respondWith500(w, fmt.Sprintf("could not execute withdraw: %v", err))
-			return
-		}
-
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("withdraw success"))
+		respondWithTx(w, r, client, txs, "withdraw", tx)
 	})
 }
 
 func senderInfoHandler(client eth.LivepeerEthClient) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if client == nil {
-			respondWith500(w, "missing ETH client")
+			respondMissingEth(w)
 			return
 		}
 
@@ -244,7 +454,7 @@ func senderInfoHandler(client eth.LivepeerEthClient) http.Handler {
 func ticketBrokerParamsHandler(client eth.LivepeerEthClient) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if client == nil {
-			respondWith500(w, "missing ETH client")
+			respondMissingEth(w)
 			return
 		}
 
@@ -271,3 +481,39 @@ func ticketBrokerParamsHandler(client eth.LivepeerEthClient) http.Handler {
 		w.Write(data)
 	})
 }
+
+// txStatusHandler responds with the status of a transaction submitted by an asynchronous request,
+// requested with /txStatus/<hash>
+func txStatusHandler(txs *TxTracker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hash := strings.TrimPrefix(r.URL.Path, "/txStatus/")
+		if b, err := hexutil.Decode(hash); err != nil || len(b) != ethcommon.HashLength {
+			respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, fmt.Sprintf("invalid transaction hash %q", hash))
+			return
+		}
+		status, ok := txs.Status(ethcommon.HexToHash(hash).Hex())
+		if !ok {
+			respondWithCliError(w, http.StatusNotFound, CliErrNotFound, fmt.Sprintf("unknown transaction %v", hash))
+			return
+		}
+		respondWithJSON(w, status)
+	})
+}
+
+// streamsHandler responds with the status of the active streams of the broadcaster with /streams,
+// or of a single stream with /streams/<manifestID>
+func streamsHandler(s *LivepeerServer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mid := strings.Trim(strings.TrimPrefix(r.URL.Path, "/streams"), "/")
+		if mid == "" {
+			respondWithJSON(w, s.StreamStatuses())
+			return
+		}
+		status, ok := s.StreamStatus(core.ManifestID(mid))
+		if !ok {
+			respondWithCliError(w, http.StatusNotFound, CliErrNotFound, fmt.Sprintf("unknown stream %v", mid))
+			return
+		}
+		respondWithJSON(w, status)
+	})
+}
@@ -11,9 +11,11 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
 	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/livepeer/go-livepeer/eth"
 	"github.com/livepeer/go-livepeer/pm"
 	"github.com/stretchr/testify/assert"
@@ -62,7 +64,7 @@ func TestMustHaveFormParams_SingleParamRequiredNotProvided(t *testing.T) {
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusBadRequest, resp.StatusCode)
-	assert.Equal("missing form param: a", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"error":{"code":"missing_param","message":"missing form param: a"}}`, string(body))
 }
 
 func TestMustHaveFormParams_SingleParamRequiredAndProvided(t *testing.T) {
@@ -90,7 +92,7 @@ func TestMustHaveFormParams_MultipleParamsRequiredOneNotProvided(t *testing.T) {
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusBadRequest, resp.StatusCode)
-	assert.Equal("missing form param: b", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"error":{"code":"missing_param","message":"missing form param: b"}}`, string(body))
 }
 func TestMustHaveFormParams_MultipleParamsRequiredAllProvided(t *testing.T) {
 	handler := mustHaveFormParams(dummyHandler(), "a", "b")
@@ -115,7 +117,7 @@ func TestCurrentBlockHandler_MissingBlockGetter(t *testing.T) {
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
-	assert.Equal("missing block getter", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"error":{"code":"not_supported","message":"missing block getter"}}`, string(body))
 }
 
 func TestCurrentBlockHandler_LastSeenBlockError(t *testing.T) {
@@ -129,7 +131,7 @@ func TestCurrentBlockHandler_LastSeenBlockError(t *testing.T) {
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
-	assert.Equal("could not query last seen block: LastSeenBlock error", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"error":{"code":"internal_error","message":"could not query last seen block: LastSeenBlock error"}}`, string(body))
 }
 
 func TestCurrentBlockHandler_Success(t *testing.T) {
@@ -141,25 +143,41 @@ func TestCurrentBlockHandler_Success(t *testing.T) {
 	resp := httpGetResp(handler)
 	body, _ := ioutil.ReadAll(resp.Body)
 
+	assert := assert.New(t)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.JSONEq(`{"blockNumber":50}`, string(body))
+}
+
+func TestCurrentBlockHandler_LegacyResponse(t *testing.T) {
+	LegacyCliResponses = true
+	defer func() { LegacyCliResponses = false }()
+	getter := &mockBlockGetter{}
+	handler := currentBlockHandler(getter)
+
+	getter.On("LastSeenBlock").Return(big.NewInt(50), nil)
+
+	resp := httpGetResp(handler)
+	body, _ := ioutil.ReadAll(resp.Body)
+
 	assert := assert.New(t)
 	assert.Equal(http.StatusOK, resp.StatusCode)
 	assert.Equal(big.NewInt(50), new(big.Int).SetBytes(body))
 }
 
 func TestFundDepositAndReserveHandler_MissingClient(t *testing.T) {
-	handler := fundDepositAndReserveHandler(nil)
+	handler := fundDepositAndReserveHandler(nil, nil)
 
 	resp := httpPostFormResp(handler, nil)
 	body, _ := ioutil.ReadAll(resp.Body)
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
-	assert.Equal("missing ETH client", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"error":{"code":"not_supported","message":"missing ETH client"}}`, string(body))
 }
 
 func TestFundDepositAndReserveHandler_InvalidDepositAmount(t *testing.T) {
 	client := &eth.MockClient{}
-	handler := fundDepositAndReserveHandler(client)
+	handler := fundDepositAndReserveHandler(client, nil)
 
 	form := url.Values{
 		"depositAmount": {"foo"},
@@ -174,7 +192,7 @@ func TestFundDepositAndReserveHandler_InvalidDepositAmount(t *testing.T) {
 
 func TestFundDepositAndReserveHandler_InvalidReserveAmount(t *testing.T) {
 	client := &eth.MockClient{}
-	handler := fundDepositAndReserveHandler(client)
+	handler := fundDepositAndReserveHandler(client, nil)
 
 	form := url.Values{
 		"depositAmount": {"100"},
@@ -190,7 +208,7 @@ func TestFundDepositAndReserveHandler_InvalidReserveAmount(t *testing.T) {
 
 func TestFundDepositAndReserveHandler_TransactionSubmissionError(t *testing.T) {
 	client := &eth.MockClient{}
-	handler := fundDepositAndReserveHandler(client)
+	handler := fundDepositAndReserveHandler(client, nil)
 
 	client.On("FundDepositAndReserve", big.NewInt(50), big.NewInt(50)).Return(nil, errors.New("FundDepositAndReserve error"))
 
@@ -203,12 +221,12 @@ func TestFundDepositAndReserveHandler_TransactionSubmissionError(t *testing.T) {
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
-	assert.Equal("could not execute fundDepositAndReserve: FundDepositAndReserve error", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"error":{"code":"transaction_failed","message":"could not execute fundDepositAndReserve: FundDepositAndReserve error"}}`, string(body))
 }
 
 func TestFundDepositAndReserveHandler_TransactionWaitError(t *testing.T) {
 	client := &eth.MockClient{}
-	handler := fundDepositAndReserveHandler(client)
+	handler := fundDepositAndReserveHandler(client, nil)
 
 	client.On("FundDepositAndReserve", big.NewInt(50), big.NewInt(50)).Return(nil, nil)
 	client.On("CheckTx").Return(errors.New("CheckTx error"))
@@ -222,12 +240,12 @@ func TestFundDepositAndReserveHandler_TransactionWaitError(t *testing.T) {
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
-	assert.Equal("could not execute fundDepositAndReserve: CheckTx error", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"error":{"code":"transaction_failed","message":"could not execute fundDepositAndReserve: CheckTx error"}}`, string(body))
 }
 
 func TestFundDepositAndReserveHandler_Success(t *testing.T) {
 	client := &eth.MockClient{}
-	handler := fundDepositAndReserveHandler(client)
+	handler := fundDepositAndReserveHandler(client, nil)
 
 	client.On("FundDepositAndReserve", big.NewInt(50), big.NewInt(50)).Return(nil, nil)
 	client.On("CheckTx", mock.Anything).Return(nil)
@@ -241,23 +259,23 @@ func TestFundDepositAndReserveHandler_Success(t *testing.T) {
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusOK, resp.StatusCode)
-	assert.Equal("fundDepositAndReserve success", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"status":"success"}`, string(body))
 }
 
 func TestFundDepositHandler_MissingClient(t *testing.T) {
-	handler := fundDepositHandler(nil)
+	handler := fundDepositHandler(nil, nil)
 
 	resp := httpPostFormResp(handler, nil)
 	body, _ := ioutil.ReadAll(resp.Body)
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
-	assert.Equal("missing ETH client", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"error":{"code":"not_supported","message":"missing ETH client"}}`, string(body))
 }
 
 func TestFundDepositHandler_InvalidAmount(t *testing.T) {
 	client := &eth.MockClient{}
-	handler := fundDepositHandler(client)
+	handler := fundDepositHandler(client, nil)
 
 	form := url.Values{
 		"amount": {"foo"},
@@ -272,7 +290,7 @@ func TestFundDepositHandler_InvalidAmount(t *testing.T) {
 
 func TestFundDepositHandler_TransactionSubmissionError(t *testing.T) {
 	client := &eth.MockClient{}
-	handler := fundDepositHandler(client)
+	handler := fundDepositHandler(client, nil)
 
 	client.On("FundDeposit", big.NewInt(100)).Return(nil, errors.New("FundDeposit error"))
 
@@ -284,12 +302,12 @@ func TestFundDepositHandler_TransactionSubmissionError(t *testing.T) {
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
-	assert.Equal("could not execute fundDeposit: FundDeposit error", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"error":{"code":"transaction_failed","message":"could not execute fundDeposit: FundDeposit error"}}`, string(body))
 }
 
 func TestFundDepositHandler_TransactionWaitError(t *testing.T) {
 	client := &eth.MockClient{}
-	handler := fundDepositHandler(client)
+	handler := fundDepositHandler(client, nil)
 
 	client.On("FundDeposit", big.NewInt(100)).Return(nil, nil)
 	client.On("CheckTx", mock.Anything).Return(errors.New("CheckTx error"))
@@ -302,12 +320,12 @@ func TestFundDepositHandler_TransactionWaitError(t *testing.T) {
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
-	assert.Equal("could not execute fundDeposit: CheckTx error", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"error":{"code":"transaction_failed","message":"could not execute fundDeposit: CheckTx error"}}`, string(body))
 }
 
 func TestFundDepositHandler_Success(t *testing.T) {
 	client := &eth.MockClient{}
-	handler := fundDepositHandler(client)
+	handler := fundDepositHandler(client, nil)
 
 	client.On("FundDeposit", big.NewInt(100)).Return(nil, nil)
 	client.On("CheckTx", mock.Anything).Return(nil)
@@ -320,23 +338,107 @@ func TestFundDepositHandler_Success(t *testing.T) {
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.JSONEq(`{"status":"success"}`, string(body))
+}
+
+func TestFundDepositHandler_SuccessWithTxHash(t *testing.T) {
+	client := &eth.MockClient{}
+	handler := fundDepositHandler(client, nil)
+
+	tx := types.NewTransaction(1, ethcommon.Address{}, big.NewInt(100), 21000, big.NewInt(1), nil)
+	client.On("FundDeposit", big.NewInt(100)).Return(tx, nil)
+	client.On("CheckTx", mock.Anything).Return(nil)
+
+	resp := httpPostFormResp(handler, strings.NewReader(url.Values{"amount": {"100"}}.Encode()))
+	var status CliStatus
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&status))
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("success", status.Status)
+	assert.Equal(tx.Hash().Hex(), status.TxHash)
+}
+
+func TestFundDepositHandler_Async(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	client := &eth.MockClient{}
+	txs := NewTxTracker()
+	handler := fundDepositHandler(client, txs)
+
+	tx := types.NewTransaction(1, ethcommon.Address{}, big.NewInt(100), 21000, big.NewInt(1), nil)
+	confirm := make(chan time.Time)
+	client.On("FundDeposit", big.NewInt(100)).Return(tx, nil)
+	client.On("CheckTx", mock.Anything).Return(nil).WaitUntil(confirm)
+
+	// The request returns before the transaction is mined
+	resp := httpPostFormResp(handler, strings.NewReader(url.Values{"amount": {"100"}, "async": {"true"}}.Encode()))
+	var status CliStatus
+	require.Nil(json.NewDecoder(resp.Body).Decode(&status))
+	assert.Equal(http.StatusAccepted, resp.StatusCode)
+	assert.Equal(TxPending, status.Status)
+	assert.Equal(tx.Hash().Hex(), status.TxHash)
+
+	// The status of the transaction is polled by its hash
+	txStatus := func(hash string) (int, TxStatus) {
+		w := httptest.NewRecorder()
+		txStatusHandler(txs).ServeHTTP(w, httptest.NewRequest("GET", "/txStatus/"+hash, nil))
+		var s TxStatus
+		json.Unmarshal(w.Body.Bytes(), &s)
+		return w.Code, s
+	}
+	code, s := txStatus(tx.Hash().Hex())
+	assert.Equal(http.StatusOK, code)
+	assert.Equal(TxPending, s.Status)
+	assert.Equal("fundDeposit", s.Method)
+
+	close(confirm)
+	for i := 0; i < 100 && s.Status == TxPending; i++ {
+		time.Sleep(10 * time.Millisecond)
+		_, s = txStatus(tx.Hash().Hex())
+	}
+	assert.Equal(TxConfirmed, s.Status)
+
+	code, _ = txStatus("0x1234")
+	assert.Equal(http.StatusBadRequest, code)
+	code, _ = txStatus("0x" + strings.Repeat("ab", 32))
+	assert.Equal(http.StatusNotFound, code)
+}
+
+func TestFundDepositHandler_LegacyResponses(t *testing.T) {
+	LegacyCliResponses = true
+	defer func() { LegacyCliResponses = false }()
+	assert := assert.New(t)
+
+	resp := httpPostFormResp(fundDepositHandler(nil, nil), nil)
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal("missing ETH client", strings.TrimSpace(string(body)))
+
+	client := &eth.MockClient{}
+	client.On("FundDeposit", big.NewInt(100)).Return(nil, nil)
+	client.On("CheckTx", mock.Anything).Return(nil)
+	resp = httpPostFormResp(fundDepositHandler(client, nil), strings.NewReader(url.Values{"amount": {"100"}}.Encode()))
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Equal(http.StatusOK, resp.StatusCode)
 	assert.Equal("fundDeposit success", strings.TrimSpace(string(body)))
 }
 
 func TestUnlockHandler_MissingClient(t *testing.T) {
-	handler := unlockHandler(nil)
+	handler := unlockHandler(nil, nil)
 
 	resp := httpPostFormResp(handler, nil)
 	body, _ := ioutil.ReadAll(resp.Body)
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
-	assert.Equal("missing ETH client", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"error":{"code":"not_supported","message":"missing ETH client"}}`, string(body))
 }
 
 func TestUnlockHandler_TransactionSubmissionError(t *testing.T) {
 	client := &eth.MockClient{}
-	handler := unlockHandler(client)
+	handler := unlockHandler(client, nil)
 
 	client.On("Unlock").Return(nil, errors.New("Unlock error"))
 
@@ -345,12 +447,12 @@ func TestUnlockHandler_TransactionSubmissionError(t *testing.T) {
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
-	assert.Equal("could not execute unlock: Unlock error", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"error":{"code":"transaction_failed","message":"could not execute unlock: Unlock error"}}`, string(body))
 }
 
 func TestUnlockHandler_TransactionWaitError(t *testing.T) {
 	client := &eth.MockClient{}
-	handler := unlockHandler(client)
+	handler := unlockHandler(client, nil)
 
 	client.On("Unlock").Return(nil, nil)
 	client.On("CheckTx", mock.Anything).Return(errors.New("CheckTx error"))
@@ -360,12 +462,12 @@ func TestUnlockHandler_TransactionWaitError(t *testing.T) {
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
-	assert.Equal("could not execute unlock: CheckTx error", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"error":{"code":"transaction_failed","message":"could not execute unlock: CheckTx error"}}`, string(body))
 }
 
 func TestUnlockHandler_Success(t *testing.T) {
 	client := &eth.MockClient{}
-	handler := unlockHandler(client)
+	handler := unlockHandler(client, nil)
 
 	client.On("Unlock").Return(nil, nil)
 	client.On("CheckTx", mock.Anything).Return(nil)
@@ -375,23 +477,23 @@ func TestUnlockHandler_Success(t *testing.T) {
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusOK, resp.StatusCode)
-	assert.Equal("unlock success", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"status":"success"}`, string(body))
 }
 
 func TestCancelUnlockHandler_MissingClient(t *testing.T) {
-	handler := cancelUnlockHandler(nil)
+	handler := cancelUnlockHandler(nil, nil)
 
 	resp := httpPostFormResp(handler, nil)
 	body, _ := ioutil.ReadAll(resp.Body)
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
-	assert.Equal("missing ETH client", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"error":{"code":"not_supported","message":"missing ETH client"}}`, string(body))
 }
 
 func TestCancelUnlockHandler_TransactionSubmissionError(t *testing.T) {
 	client := &eth.MockClient{}
-	handler := cancelUnlockHandler(client)
+	handler := cancelUnlockHandler(client, nil)
 
 	client.On("CancelUnlock").Return(nil, errors.New("CancelUnlock error"))
 
@@ -400,12 +502,12 @@ func TestCancelUnlockHandler_TransactionSubmissionError(t *testing.T) {
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
-	assert.Equal("could not execute cancelUnlock: CancelUnlock error", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"error":{"code":"transaction_failed","message":"could not execute cancelUnlock: CancelUnlock error"}}`, string(body))
 }
 
 func TestCancelUnlockHandler_TransactionWaitError(t *testing.T) {
 	client := &eth.MockClient{}
-	handler := cancelUnlockHandler(client)
+	handler := cancelUnlockHandler(client, nil)
 
 	client.On("CancelUnlock").Return(nil, nil)
 	client.On("CheckTx", mock.Anything).Return(errors.New("CheckTx error"))
@@ -415,12 +517,12 @@ func TestCancelUnlockHandler_TransactionWaitError(t *testing.T) {
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
-	assert.Equal("could not execute cancelUnlock: CheckTx error", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"error":{"code":"transaction_failed","message":"could not execute cancelUnlock: CheckTx error"}}`, string(body))
 }
 
 func TestCancelUnlockHandler_Success(t *testing.T) {
 	client := &eth.MockClient{}
-	handler := cancelUnlockHandler(client)
+	handler := cancelUnlockHandler(client, nil)
 
 	client.On("CancelUnlock").Return(nil, nil)
 	client.On("CheckTx", mock.Anything).Return(nil)
@@ -430,23 +532,23 @@ func TestCancelUnlockHandler_Success(t *testing.T) {
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusOK, resp.StatusCode)
-	assert.Equal("cancelUnlock success", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"status":"success"}`, string(body))
 }
 
 func TestWithdrawHandler_MissingClient(t *testing.T) {
-	handler := withdrawHandler(nil)
+	handler := withdrawHandler(nil, nil)
 
 	resp := httpPostFormResp(handler, nil)
 	body, _ := ioutil.ReadAll(resp.Body)
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
-	assert.Equal("missing ETH client", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"error":{"code":"not_supported","message":"missing ETH client"}}`, string(body))
 }
 
 func TestWithdrawHandler_TransactionSubmissionError(t *testing.T) {
 	client := &eth.MockClient{}
-	handler := withdrawHandler(client)
+	handler := withdrawHandler(client, nil)
 
 	client.On("Withdraw").Return(nil, errors.New("Withdraw error"))
 
@@ -455,11 +557,11 @@ func TestWithdrawHandler_TransactionSubmissionError(t *testing.T) {
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
-	assert.Equal("could not execute withdraw: Withdraw error", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"error":{"code":"transaction_failed","message":"could not execute withdraw: Withdraw error"}}`, string(body))
 }
 func TestWithdrawHandler_TransactionWaitError(t *testing.T) {
 	client := &eth.MockClient{}
-	handler := withdrawHandler(client)
+	handler := withdrawHandler(client, nil)
 
 	client.On("Withdraw").Return(nil, nil)
 	client.On("CheckTx", mock.Anything).Return(errors.New("CheckTx error"))
@@ -469,12 +571,12 @@ func TestWithdrawHandler_TransactionWaitError(t *testing.T) {
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
-	assert.Equal("could not execute withdraw: CheckTx error", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"error":{"code":"transaction_failed","message":"could not execute withdraw: CheckTx error"}}`, string(body))
 }
 
 func TestWithdrawHandler_Success(t *testing.T) {
 	client := &eth.MockClient{}
-	handler := withdrawHandler(client)
+	handler := withdrawHandler(client, nil)
 
 	client.On("Withdraw").Return(nil, nil)
 	client.On("CheckTx", mock.Anything).Return(nil)
@@ -484,7 +586,195 @@ func TestWithdrawHandler_Success(t *testing.T) {
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusOK, resp.StatusCode)
-	assert.Equal("withdraw success", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"status":"success"}`, string(body))
+}
+
+func TestFundReserveHandler_MissingClient(t *testing.T) {
+	handler := fundReserveHandler(nil, nil)
+
+	resp := httpPostFormResp(handler, nil)
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
+	assert.JSONEq(`{"error":{"code":"not_supported","message":"missing ETH client"}}`, string(body))
+}
+
+func TestFundReserveHandler_InvalidAmount(t *testing.T) {
+	client := &eth.MockClient{}
+	handler := fundReserveHandler(client, nil)
+
+	form := url.Values{
+		"amount": {"foo"},
+	}
+	resp := httpPostFormResp(handler, strings.NewReader(form.Encode()))
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(strings.TrimSpace(string(body)), "invalid amount")
+}
+
+func TestFundReserveHandler_TransactionSubmissionError(t *testing.T) {
+	client := &eth.MockClient{}
+	handler := fundReserveHandler(client, nil)
+
+	client.On("FundReserve", big.NewInt(100)).Return(nil, errors.New("FundReserve error"))
+
+	form := url.Values{
+		"amount": {"100"},
+	}
+	resp := httpPostFormResp(handler, strings.NewReader(form.Encode()))
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
+	assert.JSONEq(`{"error":{"code":"transaction_failed","message":"could not execute fundReserve: FundReserve error"}}`, string(body))
+}
+
+func TestFundReserveHandler_TransactionWaitError(t *testing.T) {
+	client := &eth.MockClient{}
+	handler := fundReserveHandler(client, nil)
+
+	client.On("FundReserve", big.NewInt(100)).Return(nil, nil)
+	client.On("CheckTx", mock.Anything).Return(errors.New("CheckTx error"))
+
+	form := url.Values{
+		"amount": {"100"},
+	}
+	resp := httpPostFormResp(handler, strings.NewReader(form.Encode()))
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
+	assert.JSONEq(`{"error":{"code":"transaction_failed","message":"could not execute fundReserve: CheckTx error"}}`, string(body))
+}
+
+func TestFundReserveHandler_Success(t *testing.T) {
+	client := &eth.MockClient{}
+	handler := fundReserveHandler(client, nil)
+
+	client.On("FundReserve", big.NewInt(100)).Return(nil, nil)
+	client.On("CheckTx", mock.Anything).Return(nil)
+
+	form := url.Values{
+		"amount": {"100"},
+	}
+	resp := httpPostFormResp(handler, strings.NewReader(form.Encode()))
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.JSONEq(`{"status":"success"}`, string(body))
+}
+
+// depositWithdrawerClient is a client of a TicketBroker contract that supports partial deposit withdrawals
+type depositWithdrawerClient struct {
+	*eth.MockClient
+}
+
+func (c *depositWithdrawerClient) WithdrawDeposit(amount *big.Int) (*types.Transaction, error) {
+	args := c.Called(amount)
+	return nil, args.Error(0)
+}
+
+func TestWithdrawDepositHandler_MissingClient(t *testing.T) {
+	handler := withdrawDepositHandler(nil, nil)
+
+	resp := httpPostFormResp(handler, nil)
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
+	assert.JSONEq(`{"error":{"code":"not_supported","message":"missing ETH client"}}`, string(body))
+}
+
+func TestWithdrawDepositHandler_InvalidAmount(t *testing.T) {
+	assert := assert.New(t)
+	client := &eth.MockClient{}
+	handler := withdrawDepositHandler(client, nil)
+	addr := ethcommon.Address{}
+	client.On("Account").Return(accounts.Account{Address: addr})
+
+	for _, amount := range []string{"foo", "0", "-1"} {
+		form := url.Values{
+			"amount": {amount},
+		}
+		resp := httpPostFormResp(handler, strings.NewReader(form.Encode()))
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		assert.Equal(http.StatusBadRequest, resp.StatusCode)
+		assert.Contains(string(body), `"code":"invalid_param"`)
+		assert.Contains(string(body), "invalid amount")
+	}
+
+	// The amount can't exceed the deposit
+	client.On("GetSenderInfo", addr).Return(&pm.SenderInfo{Deposit: big.NewInt(50)}, nil).Once()
+	form := url.Values{
+		"amount": {"100"},
+	}
+	resp := httpPostFormResp(handler, strings.NewReader(form.Encode()))
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	assert.JSONEq(`{"error":{"code":"invalid_param","message":"invalid amount: 100 exceeds the deposit of 50"}}`, string(body))
+
+	// Senders without a deposit can't withdraw
+	client.On("GetSenderInfo", addr).Return(nil, errors.New("ErrNoResult")).Once()
+	resp = httpPostFormResp(handler, strings.NewReader(form.Encode()))
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	assert.JSONEq(`{"error":{"code":"invalid_param","message":"invalid amount: 100 exceeds the deposit of 0"}}`, string(body))
+
+	client.On("GetSenderInfo", addr).Return(nil, errors.New("foo")).Once()
+	resp = httpPostFormResp(handler, strings.NewReader(form.Encode()))
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
+	assert.JSONEq(`{"error":{"code":"internal_error","message":"could not get sender info: foo"}}`, string(body))
+}
+
+func TestWithdrawDepositHandler_NotSupported(t *testing.T) {
+	client := &eth.MockClient{}
+	handler := withdrawDepositHandler(client, nil)
+	addr := ethcommon.Address{}
+	client.On("Account").Return(accounts.Account{Address: addr})
+	client.On("GetSenderInfo", addr).Return(&pm.SenderInfo{Deposit: big.NewInt(100)}, nil)
+
+	form := url.Values{
+		"amount": {"50"},
+	}
+	resp := httpPostFormResp(handler, strings.NewReader(form.Encode()))
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusNotImplemented, resp.StatusCode)
+	assert.Contains(string(body), `"code":"not_supported"`)
+}
+
+func TestWithdrawDepositHandler_Success(t *testing.T) {
+	assert := assert.New(t)
+	client := &depositWithdrawerClient{&eth.MockClient{}}
+	handler := withdrawDepositHandler(client, nil)
+	addr := ethcommon.Address{}
+	client.On("Account").Return(accounts.Account{Address: addr})
+	client.On("GetSenderInfo", addr).Return(&pm.SenderInfo{Deposit: big.NewInt(100)}, nil)
+	client.On("CheckTx", mock.Anything).Return(nil)
+
+	form := url.Values{
+		"amount": {"50"},
+	}
+	client.On("WithdrawDeposit", big.NewInt(50)).Return(errors.New("WithdrawDeposit error")).Once()
+	resp := httpPostFormResp(handler, strings.NewReader(form.Encode()))
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
+	assert.JSONEq(`{"error":{"code":"transaction_failed","message":"could not execute withdrawDeposit: WithdrawDeposit error"}}`, string(body))
+
+	// The whole deposit can be withdrawn
+	form.Set("amount", "100")
+	client.On("WithdrawDeposit", big.NewInt(100)).Return(nil)
+	resp = httpPostFormResp(handler, strings.NewReader(form.Encode()))
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.JSONEq(`{"status":"success"}`, string(body))
 }
 
 func TestSenderInfoHandler_MissingClient(t *testing.T) {
@@ -495,7 +785,7 @@ func TestSenderInfoHandler_MissingClient(t *testing.T) {
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
-	assert.Equal("missing ETH client", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"error":{"code":"not_supported","message":"missing ETH client"}}`, string(body))
 }
 
 func TestSenderInfoHandler_GetSenderInfoErrNoResult(t *testing.T) {
@@ -527,7 +817,7 @@ func TestSenderInfoHandler_GetSenderInfoOtherError(t *testing.T) {
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
-	assert.Equal("could not query sender info: foo", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"error":{"code":"internal_error","message":"could not query sender info: foo"}}`, string(body))
 }
 
 func TestSenderInfoHandler_Success(t *testing.T) {
@@ -570,7 +860,7 @@ func TestTicketBrokerParamsHandler_MissingClient(t *testing.T) {
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
-	assert.Equal("missing ETH client", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"error":{"code":"not_supported","message":"missing ETH client"}}`, string(body))
 }
 
 func TestTicketBrokerParamsHandler_UnlockPeriodError(t *testing.T) {
@@ -585,7 +875,7 @@ func TestTicketBrokerParamsHandler_UnlockPeriodError(t *testing.T) {
 
 	assert := assert.New(t)
 	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
-	assert.Equal("could not query TicketBroker unlockPeriod: UnlockPeriod error", strings.TrimSpace(string(body)))
+	assert.JSONEq(`{"error":{"code":"internal_error","message":"could not query TicketBroker unlockPeriod: UnlockPeriod error"}}`, string(body))
 }
 
 func TestTicketBrokerParamsHandler_Success(t *testing.T) {
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/golang/glog"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/pm"
+)
+
+const healthGossipPath = "/health/gossip"
+
+// Reports that are older than this, or as far in the future, are rejected
+const healthReportMaxAge = time.Minute
+
+const maxHealthReportSize = 1 << 20
+
+var errHealthReportSig = errors.New("invalid health report signature")
+var errHealthReportSender = errors.New("health report sender is not trusted")
+var errHealthReportStale = errors.New("stale health report")
+
+// healthReport is a batch of the health observations of orchestrators made by a broadcaster
+type healthReport struct {
+	Sender ethcommon.Address `json:"sender"`
+	// Timestamp of the report in nanoseconds. The reports of a sender must have increasing timestamps
+	Timestamp    int64                    `json:"timestamp"`
+	Observations []core.HealthObservation `json:"observations"`
+}
+
+// signedHealthReport is a health report along with the signature of its sender over its hash
+type signedHealthReport struct {
+	Report []byte `json:"report"`
+	Sig    []byte `json:"sig"`
+}
+
+// HealthSigner signs health reports in the same format as ETH accounts
+type HealthSigner interface {
+	Sign(msg []byte) ([]byte, error)
+}
+
+// HealthGossip exchanges the health observations of orchestrators with cooperating broadcasters,
+// so that each of them stops using a failing orchestrator as soon as any of them observes the
+// failures. Reports are signed by their sender and only accepted from trusted addresses
+type HealthGossip struct {
+	health  *core.OrchestratorHealth
+	signer  HealthSigner
+	sender  ethcommon.Address
+	peers   []*url.URL
+	trusted map[ethcommon.Address]bool
+	httpc   *http.Client
+
+	mu sync.Mutex
+	// Timestamp of the last report accepted from every sender, to reject replayed reports
+	lastReport map[ethcommon.Address]int64
+
+	quit chan struct{}
+}
+
+// NewHealthGossip creates a HealthGossip that sends the observations of health to peers, signed
+// by signer as sender, and merges into health the reports of the trusted addresses
+func NewHealthGossip(health *core.OrchestratorHealth, signer HealthSigner, sender ethcommon.Address, peers []*url.URL, trusted []ethcommon.Address) *HealthGossip {
+	g := &HealthGossip{
+		health:     health,
+		signer:     signer,
+		sender:     sender,
+		peers:      peers,
+		trusted:    make(map[ethcommon.Address]bool),
+		httpc:      &http.Client{Timeout: common.HTTPTimeout},
+		lastReport: make(map[ethcommon.Address]int64),
+		quit:       make(chan struct{}),
+	}
+	for _, addr := range trusted {
+		g.trusted[addr] = true
+	}
+	return g
+}
+
+// RegisterHandlers adds the endpoint that receives the reports of the peers to mux
+func (g *HealthGossip) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc(healthGossipPath, g.serveReport)
+}
+
+func (g *HealthGossip) serveReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var signed signedHealthReport
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxHealthReportSize)).Decode(&signed); err != nil {
+		http.Error(w, "Invalid report", http.StatusBadRequest)
+		return
+	}
+	report, err := g.verifyReport(&signed, time.Now())
+	if err != nil {
+		glog.Errorf("Rejected health report from %v: %v", r.RemoteAddr, err)
+		status := http.StatusBadRequest
+		if err == errHealthReportSig || err == errHealthReportSender {
+			status = http.StatusUnauthorized
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err := g.health.Merge(report.Observations); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	glog.V(common.DEBUG).Infof("Received health report sender=%v observations=%d", report.Sender.Hex(), len(report.Observations))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verifyReport checks that a report is signed by a trusted sender and was not received before
+func (g *HealthGossip) verifyReport(signed *signedHealthReport, now time.Time) (*healthReport, error) {
+	var report healthReport
+	if err := json.Unmarshal(signed.Report, &report); err != nil {
+		return nil, err
+	}
+	if !g.trusted[report.Sender] {
+		return nil, errHealthReportSender
+	}
+	if !pm.VerifySig(report.Sender, crypto.Keccak256(signed.Report), signed.Sig) {
+		return nil, errHealthReportSig
+	}
+	age := now.Sub(time.Unix(0, report.Timestamp))
+	if age > healthReportMaxAge || age < -healthReportMaxAge {
+		return nil, errHealthReportStale
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if report.Timestamp <= g.lastReport[report.Sender] {
+		return nil, errHealthReportStale
+	}
+	g.lastReport[report.Sender] = report.Timestamp
+	return &report, nil
+}
+
+// StartGossip sends the observations of the node to its peers every interval until StopGossip is called
+func (g *HealthGossip) StartGossip(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			g.gossip()
+		case <-g.quit:
+			return
+		}
+	}
+}
+
+// StopGossip stops the gossip loop
+func (g *HealthGossip) StopGossip() {
+	close(g.quit)
+}
+
+// gossip sends the observations made since the previous round to every peer
+func (g *HealthGossip) gossip() {
+	observations := g.health.TakeObservations()
+	if len(observations) == 0 {
+		return
+	}
+	signed, err := g.signReport(observations, time.Now())
+	if err != nil {
+		glog.Errorf("Error signing health report: %v", err)
+		return
+	}
+	var wg sync.WaitGroup
+	for _, peer := range g.peers {
+		wg.Add(1)
+		go func(peer *url.URL) {
+			defer wg.Done()
+			if err := g.post(peer, signed); err != nil {
+				glog.Errorf("Error sending health report to peer=%v: %v", peer, err)
+			}
+		}(peer)
+	}
+	wg.Wait()
+}
+
+func (g *HealthGossip) signReport(observations []core.HealthObservation, now time.Time) ([]byte, error) {
+	report, err := json.Marshal(&healthReport{Sender: g.sender, Timestamp: now.UnixNano(), Observations: observations})
+	if err != nil {
+		return nil, err
+	}
+	sig, err := g.signer.Sign(crypto.Keccak256(report))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&signedHealthReport{Report: report, Sig: sig})
+}
+
+func (g *HealthGossip) post(peer *url.URL, data []byte) error {
+	resp, err := g.httpc.Post(peer.String()+healthGossipPath, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("health gossip error code=%d error=%v", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
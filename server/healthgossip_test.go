@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/core"
+)
+
+func newTestIdentity(t *testing.T) *core.TranscoderIdentity {
+	key, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	return core.NewTranscoderIdentity(key)
+}
+
+func TestHealthGossip(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	id1, id2 := newTestIdentity(t), newTestIdentity(t)
+	health1 := core.NewOrchestratorHealth(2, 0, time.Minute)
+	health2 := core.NewOrchestratorHealth(2, 0, time.Minute)
+
+	mux := http.NewServeMux()
+	g2 := NewHealthGossip(health2, id2, id2.Address(), nil, []ethcommon.Address{id1.Address()})
+	g2.RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	peer, err := url.Parse(ts.URL)
+	require.Nil(err)
+	g1 := NewHealthGossip(health1, id1, id1.Address(), []*url.URL{peer}, nil)
+
+	// Nothing is sent without observations
+	g1.gossip()
+
+	health1.Failure("o1")
+	health1.Failure("o1")
+	assert.True(health1.Unhealthy("o1"))
+	assert.False(health2.Unhealthy("o1"))
+	g1.gossip()
+	assert.True(health2.Unhealthy("o1"))
+	assert.Empty(health1.TakeObservations())
+
+	// Reports of untrusted senders are rejected
+	id3 := newTestIdentity(t)
+	g3 := NewHealthGossip(core.NewOrchestratorHealth(2, 0, time.Minute), id3, id3.Address(), []*url.URL{peer}, nil)
+	signed, err := g3.signReport([]core.HealthObservation{{Orchestrator: "o2", Failures: 2}}, time.Now())
+	require.Nil(err)
+	err = g3.post(peer, signed)
+	require.NotNil(err)
+	assert.Contains(err.Error(), "code=401")
+	assert.False(health2.Unhealthy("o2"))
+}
+
+func TestHealthGossip_VerifyReport(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	id1, id2 := newTestIdentity(t), newTestIdentity(t)
+	g1 := NewHealthGossip(core.NewOrchestratorHealth(1, 0, time.Minute), id1, id1.Address(), nil, nil)
+	g2 := NewHealthGossip(core.NewOrchestratorHealth(1, 0, time.Minute), id2, id2.Address(), nil, []ethcommon.Address{id1.Address()})
+	observations := []core.HealthObservation{{Orchestrator: "o1", Failures: 1}}
+
+	sign := func(g *HealthGossip, now time.Time) *signedHealthReport {
+		data, err := g.signReport(observations, now)
+		require.Nil(err)
+		var signed signedHealthReport
+		require.Nil(json.Unmarshal(data, &signed))
+		return &signed
+	}
+
+	now := time.Now()
+	signed := sign(g1, now)
+	report, err := g2.verifyReport(signed, now)
+	assert.Nil(err)
+	assert.Equal(id1.Address(), report.Sender)
+	assert.Equal(observations, report.Observations)
+
+	// Replayed reports are rejected
+	_, err = g2.verifyReport(signed, now)
+	assert.Equal(errHealthReportStale, err)
+
+	// Old reports are rejected
+	_, err = g2.verifyReport(sign(g1, now.Add(-2*healthReportMaxAge)), now)
+	assert.Equal(errHealthReportStale, err)
+
+	// Reports that claim a trusted sender must be signed by it
+	forged := &HealthGossip{signer: id2, sender: id1.Address()}
+	_, err = g2.verifyReport(sign(forged, now.Add(time.Second)), now)
+	assert.Equal(errHealthReportSig, err)
+
+	_, err = g2.verifyReport(sign(g2, now.Add(time.Second)), now)
+	assert.Equal(errHealthReportSender, err)
+}
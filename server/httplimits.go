@@ -0,0 +1,270 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/livepeer/go-livepeer/drivers"
+)
+
+// HTTPLimits bound the time and the memory that the requests of a class of handlers can hold,
+// so that slow or oversized requests cannot exhaust the connections of the node
+type HTTPLimits struct {
+	// ReadTimeout is the time to read the headers and the body of a request
+	ReadTimeout time.Duration
+	// WriteTimeout is the time to handle a request and write its response
+	WriteTimeout time.Duration
+	// IdleTimeout is how long a keep-alive connection waits for its next request
+	IdleTimeout time.Duration
+	// MaxHeaderBytes is the maximum size of the request line and the headers of a request
+	MaxHeaderBytes int
+	// MaxBodyBytes is the maximum size of the body of a request. Not limited if 0
+	MaxBodyBytes int64
+
+	// streamed is true if the handlers flush their responses while they handle the request, so
+	// that the responses can't be buffered to answer 503 once WriteTimeout is over
+	streamed bool
+}
+
+var (
+	// SegmentHTTPLimits limit the requests that upload segments: segments pushed to broadcasters
+	// and uploaded VOD inputs, segments and payments sent to orchestrators, one-shot jobs, and the
+	// segments and results exchanged with standalone transcoders
+	SegmentHTTPLimits = HTTPLimits{
+		ReadTimeout:    30 * time.Second,
+		WriteTimeout:   time.Minute,
+		IdleTimeout:    2 * time.Minute,
+		MaxHeaderBytes: 256 << 10,
+		MaxBodyBytes:   128 << 20,
+		streamed:       true,
+	}
+
+	// ManagementHTTPLimits limit the requests of the CLI webserver and of the other endpoints
+	// that manage the node. Requests that send transactions wait for them to be mined
+	ManagementHTTPLimits = HTTPLimits{
+		ReadTimeout:    10 * time.Second,
+		WriteTimeout:   10 * time.Minute,
+		IdleTimeout:    2 * time.Minute,
+		MaxHeaderBytes: 64 << 10,
+		MaxBodyBytes:   1 << 20,
+	}
+
+	// PlaylistHTTPLimits limit the requests that play streams: playlists, including blocking
+	// Low-Latency HLS reloads, segments and thumbnails
+	PlaylistHTTPLimits = HTTPLimits{
+		ReadTimeout:    5 * time.Second,
+		WriteTimeout:   time.Minute,
+		IdleTimeout:    time.Minute,
+		MaxHeaderBytes: 16 << 10,
+		MaxBodyBytes:   64 << 10,
+	}
+)
+
+// segmentHTTPPaths and playlistHTTPPaths are the paths of the segment upload and the playlist
+// serving handlers, where paths ending with a slash match their subtrees. The other handlers
+// manage the node
+var (
+	segmentHTTPPaths  = []string{"/live/", "/vodjobs", "/vodjobs/", "/segment", "/payment", "/oneshot", "/transcodeResults", "/transcoderSegment"}
+	playlistHTTPPaths = []string{"/stream/", "/vod/", "/llhls/", "/thumbnail/", drivers.EncryptedDataPath}
+)
+
+// httpServerGrace is added to the timeouts of a server so that the handlers time out first and
+// can still respond
+const httpServerGrace = 5 * time.Second
+
+var errHTTPReadTimeout = errors.New("request body read timeout")
+
+// ParseHTTPLimits overrides the limits of defaults with a comma separated list of key=value
+// pairs, e.g. readTimeout=10s,maxBodyBytes=1048576
+func ParseHTTPLimits(s string, defaults HTTPLimits) (HTTPLimits, error) {
+	limits := defaults
+	for _, kv := range strings.Split(s, ",") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return defaults, fmt.Errorf("invalid HTTP limit %q: expected key=value", kv)
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		var err error
+		switch key {
+		case "readTimeout":
+			limits.ReadTimeout, err = parseHTTPLimitDuration(value)
+		case "writeTimeout":
+			limits.WriteTimeout, err = parseHTTPLimitDuration(value)
+		case "idleTimeout":
+			limits.IdleTimeout, err = parseHTTPLimitDuration(value)
+		case "maxHeaderBytes":
+			var n int64
+			n, err = parseHTTPLimitBytes(value)
+			limits.MaxHeaderBytes = int(n)
+		case "maxBodyBytes":
+			limits.MaxBodyBytes, err = parseHTTPLimitBytes(value)
+		default:
+			return defaults, fmt.Errorf("unknown HTTP limit %q", key)
+		}
+		if err != nil {
+			return defaults, fmt.Errorf("invalid HTTP limit %q: %v", kv, err)
+		}
+	}
+	return limits, nil
+}
+
+func parseHTTPLimitDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err == nil && d < 0 {
+		err = errors.New("must not be negative")
+	}
+	return d, err
+}
+
+func parseHTTPLimitBytes(s string) (int64, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err == nil && n < 0 {
+		err = errors.New("must not be negative")
+	}
+	return n, err
+}
+
+// httpLimitsOf returns the limits of the class of handlers that serves a path
+func httpLimitsOf(path string) *HTTPLimits {
+	match := func(paths []string) bool {
+		for _, p := range paths {
+			if path == p || strings.HasSuffix(p, "/") && strings.HasPrefix(path, p) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case match(segmentHTTPPaths):
+		return &SegmentHTTPLimits
+	case match(playlistHTTPPaths):
+		return &PlaylistHTTPLimits
+	}
+	return &ManagementHTTPLimits
+}
+
+// limitHTTPByPath applies the limits of the class of handlers of the path of each request
+func limitHTTPByPath(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpLimitsOf(r.URL.Path).Handler(next).ServeHTTP(w, r)
+	})
+}
+
+// Handler applies the limits to the requests of next. A server can only enforce one set of
+// limits per connection, so the handlers of the classes that share a server enforce their
+// tighter limits themselves
+func (l *HTTPLimits) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.MaxHeaderBytes > 0 && requestHeaderSize(r) > l.MaxHeaderBytes {
+			http.Error(w, "request headers too large", http.StatusRequestHeaderFieldsTooLarge)
+			return
+		}
+		if l.MaxBodyBytes > 0 {
+			if r.ContentLength > l.MaxBodyBytes {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, l.MaxBodyBytes)
+		}
+		if l.ReadTimeout > 0 && r.Body != nil {
+			r.Body = &deadlineBody{ReadCloser: r.Body, deadline: time.Now().Add(l.ReadTimeout)}
+		}
+		// Websocket connections are long lived and their handlers keep them alive themselves
+		if l.WriteTimeout <= 0 || websocket.IsWebSocketUpgrade(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !l.streamed {
+			http.TimeoutHandler(next, l.WriteTimeout, "request timeout").ServeHTTP(w, r)
+			return
+		}
+		// Streamed responses can't be replaced once the timeout is over, so their handlers are
+		// only told to give up
+		ctx, cancel := context.WithTimeout(r.Context(), l.WriteTimeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestHeaderSize returns the size of the request line and the headers of a request as sent
+// over HTTP/1.1
+func requestHeaderSize(r *http.Request) int {
+	size := len(r.Method) + len(r.RequestURI) + len(r.Proto) + 4
+	size += len("Host: ") + len(r.Host) + 2
+	for k, vs := range r.Header {
+		for _, v := range vs {
+			size += len(k) + len(v) + 4
+		}
+	}
+	return size
+}
+
+// deadlineBody fails the reads of a request body once its deadline is over, so that clients
+// that trickle the body cannot hold a handler
+type deadlineBody struct {
+	io.ReadCloser
+	deadline time.Time
+}
+
+func (b *deadlineBody) Read(p []byte) (int, error) {
+	if time.Now().After(b.deadline) {
+		return 0, errHTTPReadTimeout
+	}
+	return b.ReadCloser.Read(p)
+}
+
+// newHTTPServer creates a server of handler for the classes of handlers that it serves. The
+// connection limits of the server are the most permissive of the limits of the classes, plus a
+// grace period so that the handlers enforce their own limits first
+func newHTTPServer(addr string, handler http.Handler, classes ...*HTTPLimits) *http.Server {
+	srv := &http.Server{Addr: addr, Handler: handler}
+	for i, l := range classes {
+		readTimeout, writeTimeout := withHTTPServerGrace(l.ReadTimeout), withHTTPServerGrace(l.WriteTimeout)
+		if i == 0 {
+			srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout = readTimeout, writeTimeout, l.IdleTimeout
+			srv.ReadHeaderTimeout, srv.MaxHeaderBytes = readTimeout, l.MaxHeaderBytes
+			continue
+		}
+		srv.ReadTimeout = longestTimeout(srv.ReadTimeout, readTimeout)
+		srv.WriteTimeout = longestTimeout(srv.WriteTimeout, writeTimeout)
+		srv.IdleTimeout = longestTimeout(srv.IdleTimeout, l.IdleTimeout)
+		// Headers are read before the class of a request is known, so clients that trickle their
+		// headers are cut off by the shortest read timeout
+		if readTimeout > 0 && (srv.ReadHeaderTimeout == 0 || readTimeout < srv.ReadHeaderTimeout) {
+			srv.ReadHeaderTimeout = readTimeout
+		}
+		if srv.MaxHeaderBytes > 0 && (l.MaxHeaderBytes == 0 || l.MaxHeaderBytes > srv.MaxHeaderBytes) {
+			srv.MaxHeaderBytes = l.MaxHeaderBytes
+		}
+	}
+	return srv
+}
+
+func withHTTPServerGrace(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return 0
+	}
+	return timeout + httpServerGrace
+}
+
+// longestTimeout returns the most permissive of two timeouts, where 0 disables a timeout
+func longestTimeout(a, b time.Duration) time.Duration {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	if a > b {
+		return a
+	}
+	return b
+}
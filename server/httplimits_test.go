@@ -0,0 +1,142 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHTTPLimits(t *testing.T) {
+	assert := assert.New(t)
+
+	limits, err := ParseHTTPLimits("", SegmentHTTPLimits)
+	assert.Nil(err)
+	assert.Equal(SegmentHTTPLimits, limits)
+
+	limits, err = ParseHTTPLimits("readTimeout=10s, writeTimeout=1m,idleTimeout=0s,maxHeaderBytes=1024,maxBodyBytes=2048", SegmentHTTPLimits)
+	assert.Nil(err)
+	assert.Equal(10*time.Second, limits.ReadTimeout)
+	assert.Equal(time.Minute, limits.WriteTimeout)
+	assert.Zero(limits.IdleTimeout)
+	assert.Equal(1024, limits.MaxHeaderBytes)
+	assert.Equal(int64(2048), limits.MaxBodyBytes)
+	// Whether responses are streamed is a property of the class
+	assert.True(limits.streamed)
+
+	_, err = ParseHTTPLimits("readTimeout", SegmentHTTPLimits)
+	assert.EqualError(err, `invalid HTTP limit "readTimeout": expected key=value`)
+	_, err = ParseHTTPLimits("foo=1", SegmentHTTPLimits)
+	assert.EqualError(err, `unknown HTTP limit "foo"`)
+	_, err = ParseHTTPLimits("readTimeout=-1s", SegmentHTTPLimits)
+	assert.EqualError(err, `invalid HTTP limit "readTimeout=-1s": must not be negative`)
+	_, err = ParseHTTPLimits("maxBodyBytes=1MB", SegmentHTTPLimits)
+	assert.Contains(err.Error(), `invalid HTTP limit "maxBodyBytes=1MB"`)
+}
+
+func TestHTTPLimitsOf(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, path := range []string{"/live/movie/0.ts", "/vodjobs", "/vodjobs/foo", "/segment", "/payment", "/transcodeResults", "/transcoderSegment"} {
+		assert.Equal(&SegmentHTTPLimits, httpLimitsOf(path), path)
+	}
+	for _, path := range []string{"/stream/movie.m3u8", "/vod/movie.m3u8", "/llhls/movie.m3u8", "/thumbnail/movie.jpg", "/encrypted/foo"} {
+		assert.Equal(&PlaylistHTTPLimits, httpLimitsOf(path), path)
+	}
+	for _, path := range []string{"/status", "/segmentTrace", "/healthz", "/live", "/"} {
+		assert.Equal(&ManagementHTTPLimits, httpLimitsOf(path), path)
+	}
+}
+
+func TestHTTPLimits_Handler(t *testing.T) {
+	assert := assert.New(t)
+
+	var bodyErr error
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		_, bodyErr = ioutil.ReadAll(r.Body)
+		if bodyErr != nil {
+			http.Error(w, bodyErr.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	limits := &HTTPLimits{MaxHeaderBytes: 256, MaxBodyBytes: 8}
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		limits.Handler(handler).ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(httptest.NewRequest("POST", "/", strings.NewReader("1234")))
+	assert.Equal(http.StatusOK, w.Code)
+
+	// Oversized headers
+	req := httptest.NewRequest("POST", "/", strings.NewReader("1234"))
+	req.Header.Set("X-Foo", strings.Repeat("a", 256))
+	w = serve(req)
+	assert.Equal(http.StatusRequestHeaderFieldsTooLarge, w.Code)
+
+	// Oversized bodies are rejected up front if their length is known, or once they are read
+	w = serve(httptest.NewRequest("POST", "/", strings.NewReader("123456789")))
+	assert.Equal(http.StatusRequestEntityTooLarge, w.Code)
+	req = httptest.NewRequest("POST", "/", strings.NewReader("123456789"))
+	req.ContentLength = -1
+	w = serve(req)
+	assert.Equal(http.StatusBadRequest, w.Code)
+	assert.NotNil(bodyErr)
+
+	// Bodies that are still read after the read timeout fail
+	limits = &HTTPLimits{ReadTimeout: 10 * time.Millisecond}
+	w = serve(httptest.NewRequest("POST", "/slow", strings.NewReader("1234")))
+	assert.Equal(http.StatusBadRequest, w.Code)
+	assert.Equal(errHTTPReadTimeout, bodyErr)
+
+	// Buffered responses are replaced once the write timeout is over
+	limits = &HTTPLimits{WriteTimeout: 10 * time.Millisecond}
+	w = serve(httptest.NewRequest("GET", "/slow", nil))
+	assert.Equal(http.StatusServiceUnavailable, w.Code)
+	assert.Equal("request timeout", w.Body.String())
+
+	// Streamed responses are not buffered, their handlers are told to give up instead
+	var deadline time.Time
+	limits = &HTTPLimits{WriteTimeout: time.Minute, streamed: true}
+	w = httptest.NewRecorder()
+	limits.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, _ = r.Context().Deadline()
+		w.(http.Flusher).Flush()
+	})).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.True(w.Flushed)
+	assert.WithinDuration(time.Now().Add(time.Minute), deadline, time.Second)
+}
+
+func TestNewHTTPServer(t *testing.T) {
+	assert := assert.New(t)
+
+	srv := newHTTPServer(":0", http.NotFoundHandler(), &ManagementHTTPLimits)
+	assert.Equal(ManagementHTTPLimits.ReadTimeout+httpServerGrace, srv.ReadTimeout)
+	assert.Equal(ManagementHTTPLimits.ReadTimeout+httpServerGrace, srv.ReadHeaderTimeout)
+	assert.Equal(ManagementHTTPLimits.WriteTimeout+httpServerGrace, srv.WriteTimeout)
+	assert.Equal(ManagementHTTPLimits.IdleTimeout, srv.IdleTimeout)
+	assert.Equal(ManagementHTTPLimits.MaxHeaderBytes, srv.MaxHeaderBytes)
+
+	// Servers of several classes allow the most permissive limits, except for reading headers
+	a := &HTTPLimits{ReadTimeout: time.Second, WriteTimeout: time.Minute, IdleTimeout: time.Second, MaxHeaderBytes: 10}
+	b := &HTTPLimits{ReadTimeout: time.Minute, WriteTimeout: time.Second, MaxHeaderBytes: 20}
+	srv = newHTTPServer(":0", http.NotFoundHandler(), a, b)
+	assert.Equal(time.Minute+httpServerGrace, srv.ReadTimeout)
+	assert.Equal(time.Second+httpServerGrace, srv.ReadHeaderTimeout)
+	assert.Equal(time.Minute+httpServerGrace, srv.WriteTimeout)
+	assert.Zero(srv.IdleTimeout)
+	assert.Equal(20, srv.MaxHeaderBytes)
+
+	b.MaxHeaderBytes = 0
+	srv = newHTTPServer(":0", http.NotFoundHandler(), a, b)
+	assert.Zero(srv.MaxHeaderBytes)
+}
@@ -0,0 +1,287 @@
+package server
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/golang/glog"
+	"github.com/gorilla/websocket"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+)
+
+// LiveStats pushes the statistics of the broadcaster and of its streams to websocket clients, if set
+var LiveStats *LiveStatsHub
+
+// Types of the messages pushed to live stats clients
+const (
+	// LiveStatsSnapshot is the first message of a client, with the node statistics and the status of every stream
+	LiveStatsSnapshot = "snapshot"
+	// LiveStatsNode is the node statistics, pushed every liveStatsInterval
+	LiveStatsNode = "node"
+	// LiveStatsStream is a StreamEvent of a stream
+	LiveStatsStream = "stream"
+	// LiveStatsSegment is a segment that was transcoded or that failed
+	LiveStatsSegment = "segment"
+	// LiveStatsPayment is a batch of tickets sent to an orchestrator
+	LiveStatsPayment = "payment"
+)
+
+// liveStatsInterval is how often the node statistics are pushed
+var liveStatsInterval = 5 * time.Second
+
+// Clients are pinged every liveStatsPingInterval and disconnected if they don't answer within
+// liveStatsPongWait, or if a message can't be written within liveStatsWriteWait
+const (
+	liveStatsPingInterval = 30 * time.Second
+	liveStatsPongWait     = time.Minute
+	liveStatsWriteWait    = 10 * time.Second
+)
+
+// liveStatsQueueSize is the number of messages queued for a client. Clients that fall further behind
+// are disconnected, so that they reconnect and start over from a snapshot
+const liveStatsQueueSize = 256
+
+var liveStatsUpgrader = websocket.Upgrader{}
+
+// LiveStatsMessage is a message pushed to live stats clients
+type LiveStatsMessage struct {
+	Type string `json:"type"`
+	// Time of the message in milliseconds
+	Time int64       `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// LiveSnapshot is the state of the node when a client connects
+type LiveSnapshot struct {
+	Node    NodeStats       `json:"node"`
+	Streams []*StreamStatus `json:"streams"`
+}
+
+// NodeStats are the statistics of the streams of the node since it started
+type NodeStats struct {
+	Streams            int    `json:"streams"`
+	SegmentsTranscoded uint64 `json:"segmentsTranscoded"`
+	SegmentsFailed     uint64 `json:"segmentsFailed"`
+	TicketsSent        uint64 `json:"ticketsSent"`
+	// Expected value of the tickets sent, in wei
+	EVSent string `json:"evSent"`
+}
+
+// LiveSegment is a segment of a stream that was transcoded, or an attempt to process or to
+// transcode a segment that failed
+type LiveSegment struct {
+	ManifestID   string `json:"manifestID"`
+	SeqNo        uint64 `json:"seqNo"`
+	Orchestrator string `json:"orchestrator,omitempty"`
+	// Time from the submission of the segment to the reception of its renditions
+	LatencyMs int64  `json:"latencyMs,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// LivePayment is a batch of tickets sent to an orchestrator for a segment of a stream
+type LivePayment struct {
+	ManifestID   string `json:"manifestID"`
+	Orchestrator string `json:"orchestrator"`
+	Recipient    string `json:"recipient"`
+	Tickets      int    `json:"tickets"`
+	// Expected value of the tickets, in wei
+	EV string `json:"ev"`
+}
+
+// LiveStatsHub keeps the statistics of the node and pushes them, and the events of its streams,
+// to the connected clients
+type LiveStatsHub struct {
+	mu         sync.Mutex
+	clients    map[chan []byte]bool
+	transcoded uint64
+	failed     uint64
+	tickets    uint64
+	ev         *big.Rat
+}
+
+// NewLiveStatsHub creates a LiveStatsHub without clients
+func NewLiveStatsHub() *LiveStatsHub {
+	return &LiveStatsHub{clients: make(map[chan []byte]bool), ev: new(big.Rat)}
+}
+
+func (h *LiveStatsHub) subscribe() chan []byte {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch := make(chan []byte, liveStatsQueueSize)
+	h.clients[ch] = true
+	return ch
+}
+
+func (h *LiveStatsHub) unsubscribe(ch chan []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients[ch] {
+		delete(h.clients, ch)
+		close(ch)
+	}
+}
+
+// publish queues a message for every client without blocking. Must be called with the lock held
+func (h *LiveStatsHub) publish(typ string, data interface{}) {
+	if len(h.clients) == 0 {
+		return
+	}
+	msg, err := marshalLiveStats(typ, data)
+	if err != nil {
+		glog.Errorf("Unable to marshal live stats type=%v: %v", typ, err)
+		return
+	}
+	for ch := range h.clients {
+		select {
+		case ch <- msg:
+		default:
+			glog.Warningf("Disconnecting live stats client: too many pending messages")
+			delete(h.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+func marshalLiveStats(typ string, data interface{}) ([]byte, error) {
+	return json.Marshal(&LiveStatsMessage{Type: typ, Time: time.Now().UnixNano() / int64(time.Millisecond), Data: data})
+}
+
+// Segment records a segment that was transcoded, or that failed if err is not nil
+func (h *LiveStatsHub) Segment(mid core.ManifestID, seqNo uint64, orch string, latency time.Duration, err error) {
+	seg := &LiveSegment{ManifestID: string(mid), SeqNo: seqNo, Orchestrator: orch}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		h.failed++
+		seg.Error = err.Error()
+	} else {
+		h.transcoded++
+		seg.LatencyMs = int64(latency / time.Millisecond)
+	}
+	h.publish(LiveStatsSegment, seg)
+}
+
+// Payment records a batch of tickets with a total expected value of ev sent to an orchestrator
+func (h *LiveStatsHub) Payment(mid core.ManifestID, orch string, recipient ethcommon.Address, tickets int, ev *big.Rat) {
+	if ev == nil {
+		ev = new(big.Rat)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tickets += uint64(tickets)
+	h.ev.Add(h.ev, ev)
+	h.publish(LiveStatsPayment, &LivePayment{
+		ManifestID:   string(mid),
+		Orchestrator: orch,
+		Recipient:    recipient.Hex(),
+		Tickets:      tickets,
+		EV:           ev.FloatString(0),
+	})
+}
+
+// StreamEvent pushes an event of a stream
+func (h *LiveStatsHub) StreamEvent(ev *StreamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.publish(LiveStatsStream, ev)
+}
+
+// NodeStats returns the statistics of the node, which has the number of active streams
+func (h *LiveStatsHub) NodeStats(streams int) NodeStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return NodeStats{
+		Streams:            streams,
+		SegmentsTranscoded: h.transcoded,
+		SegmentsFailed:     h.failed,
+		TicketsSent:        h.tickets,
+		EVSent:             h.ev.FloatString(0),
+	}
+}
+
+// liveStatsHandler pushes the live stats of the node to the websocket clients of its requests
+func liveStatsHandler(s *LivepeerServer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if LiveStats == nil {
+			respondWithCliError(w, http.StatusBadRequest, CliErrNotSupported, "live stats are only available on broadcasters")
+			return
+		}
+		conn, err := liveStatsUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// The upgrader has responded with the error
+			glog.V(common.DEBUG).Infof("Unable to upgrade live stats request remoteAddr=%s: %v", r.RemoteAddr, err)
+			return
+		}
+		LiveStats.serve(s, conn)
+	})
+}
+
+// serve pushes a snapshot of the node to a client, then the messages of the hub and the node
+// statistics until the client disconnects
+func (h *LiveStatsHub) serve(s *LivepeerServer, conn *websocket.Conn) {
+	defer conn.Close()
+	// Subscribe before the snapshot so that no event is missed
+	ch := h.subscribe()
+	defer h.unsubscribe(ch)
+
+	// Control frames are only processed while reading, and clients are not expected to send anything else
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(liveStatsPongWait))
+	conn.SetPongHandler(func(string) error { return conn.SetReadDeadline(time.Now().Add(liveStatsPongWait)) })
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(typ string, data interface{}) error {
+		msg, err := marshalLiveStats(typ, data)
+		if err != nil {
+			return err
+		}
+		conn.SetWriteDeadline(time.Now().Add(liveStatsWriteWait))
+		return conn.WriteMessage(websocket.TextMessage, msg)
+	}
+	statuses := s.StreamStatuses()
+	if err := write(LiveStatsSnapshot, &LiveSnapshot{Node: h.NodeStats(len(statuses)), Streams: statuses}); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(liveStatsInterval)
+	defer ticker.Stop()
+	ping := time.NewTicker(liveStatsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"), time.Now().Add(liveStatsWriteWait))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(liveStatsWriteWait))
+			if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := write(LiveStatsNode, h.NodeStats(s.streamCount())); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(liveStatsWriteWait)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/gorilla/websocket"
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLiveStatsHub(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	h := NewLiveStatsHub()
+	// Messages are only marshalled for clients, but statistics are always kept
+	h.Segment("foo", 1, "o1", 200*time.Millisecond, nil)
+
+	ch := h.subscribe()
+	h.Segment("foo", 2, "", 0, errors.New("bar"))
+	h.Payment("foo", "o1", ethcommon.HexToAddress("0x01"), 2, big.NewRat(1000, 1))
+	h.Payment("foo", "o1", ethcommon.HexToAddress("0x01"), 1, nil)
+	h.StreamEvent(&StreamEvent{Event: StreamEventEnded, ManifestID: "foo"})
+	assert.Equal(NodeStats{Streams: 3, SegmentsTranscoded: 1, SegmentsFailed: 1, TicketsSent: 3, EVSent: "1000"}, h.NodeStats(3))
+
+	var msg struct {
+		Type string          `json:"type"`
+		Time int64           `json:"time"`
+		Data json.RawMessage `json:"data"`
+	}
+	require.Len(ch, 4)
+	require.Nil(json.Unmarshal(<-ch, &msg))
+	assert.Equal(LiveStatsSegment, msg.Type)
+	assert.WithinDuration(time.Now(), time.Unix(0, msg.Time*int64(time.Millisecond)), time.Second)
+	assert.JSONEq(`{"manifestID":"foo","seqNo":2,"error":"bar"}`, string(msg.Data))
+	require.Nil(json.Unmarshal(<-ch, &msg))
+	assert.Equal(LiveStatsPayment, msg.Type)
+	assert.JSONEq(`{"manifestID":"foo","orchestrator":"o1","recipient":"0x0000000000000000000000000000000000000001","tickets":2,"ev":"1000"}`, string(msg.Data))
+	<-ch
+	require.Nil(json.Unmarshal(<-ch, &msg))
+	assert.Equal(LiveStatsStream, msg.Type)
+	assert.JSONEq(`{"event":"streamEnded","manifestID":"foo","time":0}`, string(msg.Data))
+
+	// Clients that fall too far behind are disconnected
+	for i := 0; i <= liveStatsQueueSize; i++ {
+		h.Segment("foo", uint64(i), "o1", time.Second, nil)
+	}
+	for range ch {
+	}
+	h.mu.Lock()
+	assert.Empty(h.clients)
+	h.mu.Unlock()
+	// Disconnected clients can still unsubscribe
+	h.unsubscribe(ch)
+}
+
+func TestLiveStatsHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	s := setupServer()
+	oldStats, oldInterval := LiveStats, liveStatsInterval
+	defer func() { LiveStats, liveStatsInterval = oldStats, oldInterval }()
+
+	// Only broadcasters keep live stats
+	LiveStats = nil
+	w := httptest.NewRecorder()
+	liveStatsHandler(s).ServeHTTP(w, httptest.NewRequest("GET", "/liveStats", nil))
+	assert.Equal(http.StatusBadRequest, w.Code)
+	assert.Contains(w.Body.String(), "live stats are only available on broadcasters")
+
+	LiveStats = NewLiveStatsHub()
+	liveStatsInterval = 50 * time.Millisecond
+	// Websocket requests are not cut off by the timeouts of the other requests of the CLI webserver
+	ts := httptest.NewServer(ManagementHTTPLimits.Handler(liveStatsHandler(s)))
+	defer ts.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/liveStats", nil)
+	require.Nil(err)
+	defer conn.Close()
+
+	type message struct {
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data"`
+	}
+	// next returns the next message of a type, skipping the node statistics of other tests
+	next := func(typ string) message {
+		for {
+			require.Nil(conn.SetReadDeadline(time.Now().Add(5 * time.Second)))
+			var msg message
+			require.Nil(conn.ReadJSON(&msg))
+			if msg.Type == typ {
+				return msg
+			}
+		}
+	}
+	var snapshot LiveSnapshot
+	require.Nil(json.Unmarshal(next(LiveStatsSnapshot).Data, &snapshot))
+	assert.Empty(snapshot.Streams)
+	assert.Zero(snapshot.Node.Streams)
+
+	cxn, err := s.registerConnection(stream.NewBasicRTMPVideoStream(&streamParameters{mid: "foo", externalID: "bar"}))
+	require.Nil(err)
+	defer removeRTMPStream(s, "foo")
+	var ev StreamEvent
+	require.Nil(json.Unmarshal(next(LiveStatsStream).Data, &ev))
+	assert.Equal(StreamEventStarted, ev.Event)
+	assert.Equal("foo", ev.ManifestID)
+	assert.Equal("bar", ev.ExternalID)
+
+	cxn.segmentTranscoded(1, "https://127.0.0.1:8935", 250*time.Millisecond)
+	assert.JSONEq(`{"manifestID":"foo","seqNo":1,"orchestrator":"https://127.0.0.1:8935","latencyMs":250}`, string(next(LiveStatsSegment).Data))
+	assert.Equal(uint64(1), cxn.stats.transcoded)
+
+	var node NodeStats
+	require.Nil(json.Unmarshal(next(LiveStatsNode).Data, &node))
+	assert.Equal(1, node.Streams)
+	assert.Equal(uint64(1), node.SegmentsTranscoded)
+
+	// Clients are unsubscribed once they disconnect
+	conn.Close()
+	assert.Eventually(func() bool {
+		LiveStats.mu.Lock()
+		defer LiveStats.mu.Unlock()
+		return len(LiveStats.clients) == 0
+	}, time.Second, 10*time.Millisecond)
+}
@@ -12,6 +12,7 @@ import (
 	"io/ioutil"
 	"math/big"
 	"math/rand"
+	"mime"
 	"net/http"
 	"net/url"
 	"path"
@@ -20,11 +21,13 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/livepeer/go-livepeer/drivers"
 	"github.com/livepeer/go-livepeer/monitor"
 	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/go-livepeer/pm"
 
 	"github.com/golang/glog"
 	"github.com/livepeer/go-livepeer/common"
@@ -58,13 +61,37 @@ const RefreshIntervalHttpPush = 1 * time.Minute
 
 var BroadcastJobVideoProfiles = []ffmpeg.VideoProfile{ffmpeg.P240p30fps4x3, ffmpeg.P360p30fps16x9}
 
+// BroadcastJobEncoders are the encoder options of the custom profiles of BroadcastJobVideoProfiles
+var BroadcastJobEncoders common.ProfileEncoders
+
+// BroadcastAdaptiveLadder bounds the adjustment of the bitrate ladder of streams to the
+// complexity of their content. Adjustment is disabled if nil
+var BroadcastAdaptiveLadder *core.AdaptiveLadderConfig
+
 var AuthWebhookURL string
 
+// BroadcastManifestIDNamespace is the namespace of the ManifestIDs of streams
+// that are not assigned a namespace by the auth webhook. Not namespaced if empty
+var BroadcastManifestIDNamespace string
+
+// BroadcastSpendTracker tracks the EV of the tickets issued for each stream and enforces
+// the EV budget of streams. Spend is not tracked if nil
+var BroadcastSpendTracker *pm.SpendTracker
+
 type streamParameters struct {
 	mid        core.ManifestID
 	rtmpKey    string
 	profiles   []ffmpeg.VideoProfile
+	encoders   common.ProfileEncoders
 	resolution string
+	source     core.SessionSource
+	ladder     *core.AdaptiveLadderConfig
+	// External key that the ManifestID was derived from, if any
+	externalID string
+	// Formats of the VOD asset assembled by a VOD job. Not a VOD job if empty
+	vodFormats []string
+	// API key that the stream was created with, whose quota the stream counts against
+	apiKey string
 }
 
 func (s *streamParameters) StreamID() string {
@@ -80,6 +107,67 @@ type rtmpConnection struct {
 	params      *streamParameters
 	sessManager *BroadcastSessionsManager
 	lastUsed    time.Time
+	ladder      *core.AdaptiveLadder
+	// Writes the VOD playlists of the stream when it ends. Not recorded if nil
+	recording *core.StreamRecording
+	// Extracts the thumbnails of the stream. No thumbnails if nil
+	thumbnails *thumbnailer
+	// Sequence number of the next segment of the stream, where the segmenter of a reconnected
+	// publisher starts. Accessed atomically
+	nextSeq uint64
+	// Token that a reconnecting publisher must match to resume the stream. The stream
+	// can't be resumed if empty
+	stickiness string
+	// Ends the stream if its publisher does not reconnect. Protected by `connectionLock`
+	reconnect *time.Timer
+	// Stops pulling the source of a pulled stream. Protected by `connectionLock`
+	stopSource context.CancelFunc
+	// Whether the stream is being removed. Protected by `connectionLock`
+	removed bool
+	// Number of consumers of the session of the stream. Protected by `connectionLock`
+	consumers int
+	// Initialization segment of a stream that is pushed as fragmented MP4. Protected by `connectionLock`
+	fmp4Init []byte
+	// Orchestrator that the last segment of the stream was sent to. Protected by `orchLock`
+	orch     string
+	orchLock sync.Mutex
+	// Segments of the stream that were transcoded and that failed
+	stats streamStats
+
+	// Thread sensitive fields. All accesses to the
+	// following fields should be protected by `profilesLock`
+	profiles     []ffmpeg.VideoProfile
+	encoders     common.ProfileEncoders
+	profilesLock sync.RWMutex
+}
+
+// getProfiles returns the output profiles that the stream's segments are transcoded into
+func (cxn *rtmpConnection) getProfiles() []ffmpeg.VideoProfile {
+	cxn.profilesLock.RLock()
+	defer cxn.profilesLock.RUnlock()
+	if cxn.profiles == nil {
+		return nil
+	}
+	// Return a copy because profiles are sorted in place when segment credentials are generated
+	return append([]ffmpeg.VideoProfile{}, cxn.profiles...)
+}
+
+// getEncoders returns the encoder options of the output profiles of the stream
+func (cxn *rtmpConnection) getEncoders() common.ProfileEncoders {
+	cxn.profilesLock.RLock()
+	defer cxn.profilesLock.RUnlock()
+	return cxn.encoders
+}
+
+// setProfiles changes the output profiles, and their encoder options, for subsequent segments of the stream
+func (cxn *rtmpConnection) setProfiles(profiles []ffmpeg.VideoProfile, encoders common.ProfileEncoders) {
+	cxn.profilesLock.Lock()
+	defer cxn.profilesLock.Unlock()
+	cxn.profiles = append([]ffmpeg.VideoProfile{}, profiles...)
+	cxn.encoders = encoders
+	if cxn.pl != nil {
+		cxn.pl.SetEncoders(encoders)
+	}
 }
 
 type LivepeerServer struct {
@@ -95,12 +183,46 @@ type LivepeerServer struct {
 	lastHLSStreamID core.StreamID
 	lastManifestID  core.ManifestID
 	connectionLock  *sync.RWMutex
+
+	// ManifestIDs of the registered connections
+	manifestIDs *core.ManifestIDRegistry
+
+	// VOD jobs submitted to the node
+	vodJobs *vodJobRegistry
+
+	// Streams pulled by the node from source URLs
+	pullStreams *pullStreamRegistry
+
+	// Checks of the dependencies of the node served at /healthz and /readyz
+	health *NodeHealth
+}
+
+// Events that the auth webhook is called with
+const (
+	authWebhookEventPublish     = "publish"
+	authWebhookEventStreamEnded = "streamEnded"
+)
+
+type authWebhookRequest struct {
+	Event string `json:"event"`
+	URL   string `json:"url,omitempty"`
+	// ManifestID and stream key of the stream. On publish, the ones in the RTMP URL, if any
+	ManifestID string `json:"manifestID,omitempty"`
+	StreamKey  string `json:"streamKey,omitempty"`
+	ExternalID string `json:"externalID,omitempty"`
 }
 
 type authWebhookResponse struct {
-	ManifestID string   `json:"manifestID"`
-	StreamKey  string   `json:"streamKey"`
-	Presets    []string `json:"presets"`
+	ManifestID     string                     `json:"manifestID"`
+	StreamKey      string                     `json:"streamKey"`
+	Presets        []string                   `json:"presets"`
+	Profiles       []common.JSONProfile       `json:"profiles"`
+	AdaptiveLadder *core.AdaptiveLadderConfig `json:"adaptiveLadder"`
+	// Namespace of the ManifestID, e.g. a tenant ID. Overrides the node's default namespace
+	Namespace string `json:"namespace"`
+	// External key, e.g. a tenant's stream key, that the ManifestID is derived from
+	// if the ManifestID is not returned
+	ExternalID string `json:"externalID"`
 }
 
 func NewLivepeerServer(rtmpAddr string, lpNode *core.LivepeerNode) *LivepeerServer {
@@ -117,16 +239,35 @@ func NewLivepeerServer(rtmpAddr string, lpNode *core.LivepeerNode) *LivepeerServ
 	server := lpmscore.New(&opts)
 	ls := &LivepeerServer{RTMPSegmenter: server, LPMS: server, LivepeerNode: lpNode, HTTPMux: opts.HttpMux, connectionLock: &sync.RWMutex{},
 		rtmpConnections: make(map[core.ManifestID]*rtmpConnection),
+		manifestIDs:     core.NewManifestIDRegistry(),
+		vodJobs:         newVODJobRegistry(),
+		pullStreams:     newPullStreamRegistry(),
+		health:          NewNodeHealth(lpNode),
 	}
+	ls.registerSessionHooks()
+	ls.health.RegisterHandlers(opts.HttpMux, false)
 	if lpNode.NodeType == core.BroadcasterNode {
 		opts.HttpMux.HandleFunc("/live/", ls.HandlePush)
+		opts.HttpMux.HandleFunc("/llhls/", ls.HandleLLHLS)
+		opts.HttpMux.HandleFunc("/vodjobs", ls.HandleVOD)
+		opts.HttpMux.HandleFunc("/vodjobs/", ls.HandleVOD)
+		opts.HttpMux.HandleFunc("/oneshot", ls.HandleOneShot)
+		opts.HttpMux.HandleFunc("/pull", ls.HandlePull)
+		opts.HttpMux.HandleFunc("/pull/", ls.HandlePull)
+		opts.HttpMux.HandleFunc("/thumbnail/", ls.HandleThumbnail)
+		opts.HttpMux.HandleFunc(drivers.EncryptedDataPath, ls.HandleEncryptedData)
 	}
 	return ls
 }
 
 //StartMediaServer starts the LPMS server
 func (s *LivepeerServer) StartMediaServer(ctx context.Context, transcodingOptions string, httpAddr string) error {
-	BroadcastJobVideoProfiles = parsePresets(strings.Split(transcodingOptions, ","))
+	profiles, encoders, err := parseTranscodingOptions(transcodingOptions)
+	if err != nil {
+		glog.Errorf("Error parsing transcoding options: %v", err)
+		return err
+	}
+	BroadcastJobVideoProfiles, BroadcastJobEncoders = profiles, encoders
 
 	glog.V(common.SHORT).Infof("Transcode Job Type: %v", BroadcastJobVideoProfiles)
 
@@ -151,7 +292,8 @@ func (s *LivepeerServer) StartMediaServer(ctx context.Context, transcodingOption
 	if s.LivepeerNode.NodeType == core.BroadcasterNode {
 		go func() {
 			glog.V(4).Infof("HTTP Server listening on http://%v", httpAddr)
-			ec <- http.ListenAndServe(httpAddr, s.HTTPMux)
+			srv := newHTTPServer(httpAddr, limitHTTPByPath(s.HTTPMux), &SegmentHTTPLimits, &PlaylistHTTPLimits, &ManagementHTTPLimits)
+			ec <- srv.ListenAndServe()
 		}()
 	}
 
@@ -177,9 +319,11 @@ func createRTMPStreamIDHandler(s *LivepeerServer) func(url *url.URL) (strmID str
 		var resp *authWebhookResponse
 		var mid core.ManifestID
 		var err error
-		var key string
-		presets := BroadcastJobVideoProfiles
-		if resp, err = authenticateStream(url.String()); err != nil {
+		var key, externalID string
+		presets, encoders := BroadcastJobVideoProfiles, BroadcastJobEncoders
+		ladder := BroadcastAdaptiveLadder
+		namespace := BroadcastManifestIDNamespace
+		if resp, err = authenticateStream(url); err != nil {
 			glog.Error("Authentication denied for ", err)
 			return nil
 		}
@@ -187,7 +331,42 @@ func createRTMPStreamIDHandler(s *LivepeerServer) func(url *url.URL) (strmID str
 			mid, key = parseManifestID(resp.ManifestID), resp.StreamKey
 			// Process transcoding options presets
 			if len(resp.Presets) > 0 {
-				presets = parsePresets(resp.Presets)
+				presets, encoders = parsePresets(resp.Presets), nil
+			}
+			// Custom profiles are used in addition to any presets returned by the webhook
+			if len(resp.Profiles) > 0 {
+				profiles, custom, err := common.JSONProfilesToFFmpegProfiles(resp.Profiles)
+				if err != nil {
+					glog.Error("Invalid profiles from auth webhook: ", err)
+					return nil
+				}
+				if len(resp.Presets) > 0 {
+					presets = append(presets, profiles...)
+				} else {
+					presets = profiles
+				}
+				encoders = custom
+			}
+			// Bounds returned by the webhook take precedence over the node defaults
+			if resp.AdaptiveLadder != nil {
+				if err := resp.AdaptiveLadder.Validate(); err != nil {
+					glog.Error("Invalid adaptive ladder from auth webhook: ", err)
+					return nil
+				}
+				ladder = resp.AdaptiveLadder
+			}
+			if resp.Namespace != "" {
+				if err := core.ValidateNamespace(resp.Namespace); err != nil {
+					glog.Error("Invalid namespace from auth webhook: ", err)
+					return nil
+				}
+				namespace = resp.Namespace
+			}
+			if resp.ExternalID != "" {
+				externalID = resp.ExternalID
+				if mid == "" {
+					mid = core.DeterministicManifestID(namespace, externalID)
+				}
 			}
 		}
 
@@ -196,18 +375,27 @@ func createRTMPStreamIDHandler(s *LivepeerServer) func(url *url.URL) (strmID str
 			mid, key = sid.ManifestID, sid.Rendition
 		}
 		if mid == "" {
-			mid = core.RandomManifestID()
+			if mid, err = s.manifestIDs.Generate(namespace); err != nil {
+				glog.Error("Error generating manifest ID: ", err)
+				return nil
+			}
 		}
+		mid = core.NamespacedManifestID(namespace, string(mid))
 
 		// Ensure there's no concurrent StreamID with the same name
 		s.connectionLock.RLock()
 		defer s.connectionLock.RUnlock()
-		if core.MaxSessions > 0 && len(s.rtmpConnections) >= core.MaxSessions {
-			glog.Error("Too many connections")
+		if cxn, exists := s.rtmpConnections[mid]; exists {
+			// A publisher that reconnects with the same stream key within the grace period resumes its stream
+			if key != "" && cxn.resumable(&streamParameters{mid: mid, rtmpKey: key}) {
+				glog.Infof("Resuming stream manifestID=%s", mid)
+				return cxn.params
+			}
+			glog.Error("Manifest already exists ", mid)
 			return nil
 		}
-		if _, exists := s.rtmpConnections[mid]; exists {
-			glog.Error("Manifest already exists ", mid)
+		if core.MaxSessions > 0 && len(s.rtmpConnections) >= core.MaxSessions {
+			glog.Error("Too many connections")
 			return nil
 		}
 
@@ -216,33 +404,32 @@ func createRTMPStreamIDHandler(s *LivepeerServer) func(url *url.URL) (strmID str
 			key = common.RandomIDGenerator(StreamKeyBytes)
 		}
 		return &streamParameters{
-			mid:      mid,
-			rtmpKey:  key,
-			profiles: presets,
+			mid:        mid,
+			rtmpKey:    key,
+			profiles:   presets,
+			encoders:   encoders,
+			ladder:     ladder,
+			externalID: externalID,
+			apiKey:     url.Query().Get("apiKey"),
 		}
 	}
 }
 
-func authenticateStream(url string) (*authWebhookResponse, error) {
+func authenticateStream(u *url.URL) (*authWebhookResponse, error) {
 	if AuthWebhookURL == "" {
 		return nil, nil
 	}
 
-	values := map[string]string{"url": url}
-	jsonValue, err := json.Marshal(values)
+	sid := parseStreamID(u.Path)
+	rbody, err := postAuthWebhook(&authWebhookRequest{
+		Event:      authWebhookEventPublish,
+		URL:        u.String(),
+		ManifestID: string(sid.ManifestID),
+		StreamKey:  sid.Rendition,
+	})
 	if err != nil {
 		return nil, err
 	}
-	resp, err := http.Post(AuthWebhookURL, "application/json", bytes.NewBuffer(jsonValue))
-
-	if err != nil {
-		return nil, err
-	}
-	rbody, err := ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return nil, errors.New(resp.Status)
-	}
 	if len(rbody) == 0 {
 		return nil, nil
 	}
@@ -251,12 +438,44 @@ func authenticateStream(url string) (*authWebhookResponse, error) {
 	if err != nil {
 		return nil, err
 	}
-	if authResp.ManifestID == "" {
+	// The manifest ID is derived from the external ID if it is omitted
+	if authResp.ManifestID == "" && authResp.ExternalID == "" {
 		return nil, errors.New("Empty manifest id not allowed")
 	}
 	return &authResp, nil
 }
 
+// notifyStreamEnded calls the auth webhook when an RTMP stream ends. The response is ignored
+func notifyStreamEnded(params *streamParameters) {
+	_, err := postAuthWebhook(&authWebhookRequest{
+		Event:      authWebhookEventStreamEnded,
+		ManifestID: string(params.mid),
+		StreamKey:  params.rtmpKey,
+		ExternalID: params.externalID,
+	})
+	if err != nil {
+		glog.Errorf("Error notifying auth webhook of ended stream manifestID=%s: %v", params.mid, err)
+	}
+}
+
+func postAuthWebhook(req *authWebhookRequest) ([]byte, error) {
+	jsonValue, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.Post(AuthWebhookURL, "application/json", bytes.NewBuffer(jsonValue))
+
+	if err != nil {
+		return nil, err
+	}
+	rbody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, errors.New(resp.Status)
+	}
+	return rbody, err
+}
+
 func streamParams(rtmpStrm stream.RTMPVideoStream) *streamParameters {
 	d := rtmpStrm.AppData()
 	p, ok := d.(*streamParameters)
@@ -270,22 +489,37 @@ func streamParams(rtmpStrm stream.RTMPVideoStream) *streamParameters {
 func gotRTMPStreamHandler(s *LivepeerServer) func(url *url.URL, rtmpStrm stream.RTMPVideoStream) (err error) {
 	return func(url *url.URL, rtmpStrm stream.RTMPVideoStream) (err error) {
 
-		cxn, err := s.registerConnection(rtmpStrm)
-		if err != nil {
-			return err
+		cxn := s.resumeConnection(rtmpStrm)
+		resumed := cxn != nil
+		if !resumed {
+			cxn, err = s.registerConnection(rtmpStrm)
+			if err != nil {
+				return err
+			}
 		}
 
 		mid := cxn.mid
 		nonce := cxn.nonce
-		startSeq := 0
+		// The segments of a resumed stream follow the ones sent before the publisher reconnected
+		startSeq := int(atomic.LoadUint64(&cxn.nextSeq))
 
-		streamStarted := false
+		streamStarted := resumed
 		//Segment the stream, insert the segments into the broadcaster
 		go func(rtmpStrm stream.RTMPVideoStream) {
 			hid := string(core.RandomManifestID()) // ffmpeg m3u8 output name
 			hlsStrm := stream.NewBasicHLSVideoStream(hid, stream.DefaultHLSStreamWin)
+			// Segments are held by one segment to be re-cut on closed GOP boundaries, if enabled
+			var conditioner *segmentConditioner
+			if BroadcastCfg.ConditionSegments() {
+				conditioner = newSegmentConditioner(func(seg *stream.HLSSegment) {
+					go processSegment(cxn, seg)
+				})
+			}
 			hlsStrm.SetSubscriber(func(seg *stream.HLSSegment, eof bool) {
 				if eof {
+					if conditioner != nil {
+						conditioner.flush()
+					}
 					// XXX update HLS manifest
 					return
 				}
@@ -295,6 +529,12 @@ func gotRTMPStreamHandler(s *LivepeerServer) func(url *url.URL, rtmpStrm stream.
 						monitor.StreamStarted(nonce)
 					}
 				}
+				s.LivepeerNode.Sessions.Touch(mid)
+				atomic.StoreUint64(&cxn.nextSeq, seg.SeqNo+1)
+				if conditioner != nil {
+					conditioner.add(seg)
+					return
+				}
 				go processSegment(cxn, seg)
 			})
 
@@ -303,6 +543,9 @@ func gotRTMPStreamHandler(s *LivepeerServer) func(url *url.URL, rtmpStrm stream.
 				SegLength: SegLen,
 			}
 			err := s.RTMPSegmenter.SegmentRTMPToHLS(context.Background(), rtmpStrm, hlsStrm, segOptions)
+			if conditioner != nil {
+				conditioner.flush()
+			}
 			if err != nil {
 				// Stop the incoming RTMP connection.
 				// TODO retry segmentation if err != SegmenterTimeout; may be recoverable
@@ -311,6 +554,10 @@ func gotRTMPStreamHandler(s *LivepeerServer) func(url *url.URL, rtmpStrm stream.
 
 		}(rtmpStrm)
 
+		if resumed {
+			return nil
+		}
+
 		if monitor.Enabled {
 			monitor.StreamCreated(string(mid), nonce)
 		}
@@ -328,6 +575,11 @@ func endRTMPStreamHandler(s *LivepeerServer) func(url *url.URL, rtmpStrm stream.
 			return errMismatchedParams
 		}
 
+		// Give the publisher a chance to reconnect
+		if ReconnectGracePeriod > 0 && s.holdConnection(params.mid, rtmpStrm) {
+			return nil
+		}
+
 		//Remove RTMP stream
 		err := removeRTMPStream(s, params.mid)
 		if err != nil {
@@ -368,7 +620,12 @@ func (s *LivepeerServer) registerConnection(rtmpStrm stream.RTMPVideoStream) (*r
 		glog.Error("Missing node storage")
 		return nil, errStorage
 	}
-	storage := drivers.NodeStorage.NewSession(string(mid))
+	storagePath, formats := streamStoragePath(mid), RecordingFormats
+	if len(params.vodFormats) > 0 {
+		// VOD jobs are always recorded, separately from the recordings of live streams
+		storagePath, formats = vodStoragePath(mid), params.vodFormats
+	}
+	storage := drivers.NodeStorage.NewSession(storagePath)
 	// Build the source video profile from the RTMP stream.
 	if params.resolution == "" {
 		params.resolution = fmt.Sprintf("%vx%v", rtmpStrm.Width(), rtmpStrm.Height())
@@ -379,15 +636,18 @@ func (s *LivepeerServer) registerConnection(rtmpStrm stream.RTMPVideoStream) (*r
 		Bitrate:    "4000k", // Fix this
 	}
 	hlsStrmID := core.MakeStreamID(mid, &vProfile)
-	s.connectionLock.Lock()
-	_, exists := s.rtmpConnections[mid]
-	s.connectionLock.Unlock()
-	if exists {
-		// We can only have one concurrent stream per ManifestID
+	// We can only have one concurrent stream per ManifestID
+	if err := s.manifestIDs.Reserve(mid, params.externalID); err != nil {
+		glog.Error(err)
 		return nil, errAlreadyExists
 	}
 
 	playlist := core.NewBasicPlaylistManager(mid, storage)
+	playlist.SetEncoders(params.encoders)
+	var recording *core.StreamRecording
+	if len(formats) > 0 {
+		recording = playlist.Record(formats)
+	}
 	cxn := &rtmpConnection{
 		mid:         mid,
 		nonce:       nonce,
@@ -397,38 +657,98 @@ func (s *LivepeerServer) registerConnection(rtmpStrm stream.RTMPVideoStream) (*r
 		params:      params,
 		sessManager: NewSessionManager(s.LivepeerNode, params, playlist),
 		lastUsed:    time.Now(),
+		profiles:    params.profiles,
+		encoders:    params.encoders,
+		recording:   recording,
+	}
+	if ReconnectGracePeriod > 0 && params.source == "" {
+		cxn.stickiness = stickinessToken(mid, params.rtmpKey)
+	}
+	if params.ladder != nil {
+		cxn.ladder = core.NewAdaptiveLadder(*params.ladder)
+	}
+	if ThumbnailInterval > 0 {
+		cxn.thumbnails = newThumbnailer(mid, storage, s.LivepeerNode.WorkDir)
+	}
+
+	if BroadcastQuotas != nil {
+		if err := BroadcastQuotas.StartStream(params.apiKey, mid); err != nil {
+			glog.Errorf("Stream rejected by quota manifestID=%s: %v", mid, err)
+			cxn.sessManager.cleanup()
+			s.manifestIDs.Release(mid)
+			return nil, err
+		}
 	}
 
+	// The connection is registered before the session starts so that the start hooks can look it up
 	s.connectionLock.Lock()
 	s.rtmpConnections[mid] = cxn
+	s.connectionLock.Unlock()
+	source := params.source
+	if source == "" {
+		source = core.SessionSourceRTMP
+	}
+	if err := s.LivepeerNode.Sessions.Start(mid, source, params.profiles); err != nil {
+		s.connectionLock.Lock()
+		delete(s.rtmpConnections, mid)
+		s.connectionLock.Unlock()
+		cxn.sessManager.cleanup()
+		if BroadcastQuotas != nil {
+			BroadcastQuotas.EndStream(mid)
+		}
+		s.manifestIDs.Release(mid)
+		return nil, errAlreadyExists
+	}
+
+	s.connectionLock.Lock()
 	s.lastManifestID = mid
 	s.lastHLSStreamID = hlsStrmID
-	sessionsNumber := len(s.rtmpConnections)
 	s.connectionLock.Unlock()
 
-	if monitor.Enabled {
-		monitor.CurrentSessions(sessionsNumber)
-	}
-
 	return cxn, nil
 }
 
 func removeRTMPStream(s *LivepeerServer, mid core.ManifestID) error {
 	s.connectionLock.Lock()
-	defer s.connectionLock.Unlock()
 	cxn, ok := s.rtmpConnections[mid]
-	if !ok || cxn.pl == nil {
+	if !ok || cxn.pl == nil || cxn.removed {
+		s.connectionLock.Unlock()
 		glog.Error("Attempted to end unknown stream with manifest ID ", mid)
 		return errUnknownStream
 	}
+	cxn.removed = true
+	if cxn.reconnect != nil {
+		cxn.reconnect.Stop()
+	}
+	if cxn.stopSource != nil {
+		cxn.stopSource()
+	}
 	cxn.sessManager.cleanup()
 	cxn.pl.Cleanup()
 	glog.Infof("Ended stream with id=%s", mid)
-	delete(s.rtmpConnections, mid)
+	s.connectionLock.Unlock()
 
-	if monitor.Enabled {
-		monitor.StreamEnded(cxn.nonce)
-		monitor.CurrentSessions(len(s.rtmpConnections))
+	// The stop hooks run synchronously, so they are invoked without holding connectionLock, and
+	// before the connection is unregistered so that they can look it up. The manifest ID is only
+	// released afterwards so that a new stream with the same ID is not stopped
+	s.removeStreamConsumers(cxn)
+	s.LivepeerNode.Sessions.Stop(mid)
+	s.connectionLock.Lock()
+	delete(s.rtmpConnections, mid)
+	s.connectionLock.Unlock()
+	releaseResumedPMSessions(mid)
+	s.manifestIDs.Release(mid)
+	if BroadcastSpendTracker != nil {
+		BroadcastSpendTracker.RemoveStream(string(mid))
+	}
+	if BroadcastQuotas != nil {
+		BroadcastQuotas.EndStream(mid)
+	}
+	if BroadcastDiversity != nil {
+		BroadcastDiversity.endStream(mid)
+	}
+	if AuthWebhookURL != "" && cxn.params != nil && cxn.params.source == "" {
+		go notifyStreamEnded(cxn.params)
 	}
 
 	return nil
@@ -487,37 +807,153 @@ func getHLSMediaPlaylistHandler(s *LivepeerServer) func(url *url.URL) (*m3u8.Med
 }
 
 func getHLSSegmentHandler(s *LivepeerServer) func(url *url.URL) ([]byte, error) {
-	return func(url *url.URL) ([]byte, error) {
-		// Strip the /stream/ prefix
-		segName := cleanStreamPrefix(url.Path)
-		if segName == "" || drivers.NodeStorage == nil {
-			glog.Error("SegName not found or storage nil")
-			return nil, vidplayer.ErrNotFound
+	return getNodeStorageSegment
+}
+
+// getNodeStorageSegment fetches a segment from the node's memory storage
+func getNodeStorageSegment(url *url.URL) ([]byte, error) {
+	// Strip the /stream/ prefix
+	segName := cleanStreamPrefix(url.Path)
+	if segName == "" || drivers.NodeStorage == nil {
+		glog.Error("SegName not found or storage nil")
+		return nil, vidplayer.ErrNotFound
+	}
+	parts := strings.SplitN(segName, "/", 2)
+	if len(parts) <= 0 {
+		glog.Error("Unexpected path structure")
+		return nil, vidplayer.ErrNotFound
+	}
+	memoryOS, ok := drivers.NodeStorage.(*drivers.MemoryOS)
+	if !ok {
+		return nil, vidplayer.ErrNotFound
+	}
+	// We index the session by the first entry of the path, eg
+	// <session>/<more-path>/<data>
+	os := memoryOS.GetSession(parts[0])
+	if os == nil {
+		return nil, vidplayer.ErrNotFound
+	}
+	data := os.GetData(segName)
+	if len(data) > 0 {
+		return data, nil
+	}
+	return nil, vidplayer.ErrNotFound
+}
+
+// HandleEncryptedData serves the decrypted data that was saved to encrypted node storage
+func (s *LivepeerServer) HandleEncryptedData(w http.ResponseWriter, r *http.Request) {
+	encryptedOS, ok := drivers.NodeStorage.(*drivers.EncryptedOS)
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	data, uri, err := encryptedOS.GetData(strings.TrimPrefix(r.URL.Path, drivers.EncryptedDataPath))
+	if err != nil {
+		glog.Errorf("Error serving encrypted data path=%s: %v", r.URL.Path, err)
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", storageContentType(uri))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Write(data)
+}
+
+func storageContentType(uri string) string {
+	switch ext := path.Ext(uri); ext {
+	case ".ts":
+		return "video/mp2t"
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	default:
+		if ctype := mime.TypeByExtension(ext); ctype != "" {
+			return ctype
 		}
-		parts := strings.SplitN(segName, "/", 2)
-		if len(parts) <= 0 {
-			glog.Error("Unexpected path structure")
-			return nil, vidplayer.ErrNotFound
+	}
+	return "application/octet-stream"
+}
+
+//End HLS Play Handlers
+
+// LLHLSBlockingReloadTimeout is how long a blocking playlist reload waits for a playlist without
+// segments yet. Otherwise the reload waits for up to 3 target durations
+var LLHLSBlockingReloadTimeout = 6 * time.Second
+
+// HandleLLHLS serves the master playlists and the Low-Latency HLS media playlists of streams.
+// Media playlist requests with the _HLS_msn and _HLS_part parameters are blocked until the
+// requested segment or part is available
+func (s *LivepeerServer) HandleLLHLS(w http.ResponseWriter, r *http.Request) {
+	if path.Ext(r.URL.Path) != ".m3u8" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	strmID := parseStreamID(strings.TrimPrefix(r.URL.Path, "/llhls/"))
+	s.connectionLock.RLock()
+	cxn, ok := s.rtmpConnections[strmID.ManifestID]
+	s.connectionLock.RUnlock()
+	if !ok || cxn.pl == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if strmID.Rendition == "" {
+		master := cxn.pl.GetHLSMasterPlaylist()
+		if master == nil {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
 		}
-		memoryOS, ok := drivers.NodeStorage.(*drivers.MemoryOS)
-		if !ok {
-			return nil, vidplayer.ErrNotFound
+		w.Write(master.Encode().Bytes())
+		return
+	}
+
+	pl := cxn.pl.GetLLHLSMediaPlaylist(strmID.Rendition)
+	if pl == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("_HLS_msn") != "" {
+		msn, err := strconv.ParseUint(query.Get("_HLS_msn"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid _HLS_msn", http.StatusBadRequest)
+			return
 		}
-		// We index the session by the first entry of the path, eg
-		// <session>/<more-path>/<data>
-		os := memoryOS.GetSession(parts[0])
-		if os == nil {
-			return nil, vidplayer.ErrNotFound
+		part := -1
+		if query.Get("_HLS_part") != "" {
+			if part, err = strconv.Atoi(query.Get("_HLS_part")); err != nil || part < 0 {
+				http.Error(w, "invalid _HLS_part", http.StatusBadRequest)
+				return
+			}
 		}
-		data := os.GetData(segName)
-		if len(data) > 0 {
-			return data, nil
+		// Segments more than two segments ahead of the playlist are not expected to appear soon
+		if msn > pl.NextMSN()+1 {
+			http.Error(w, "_HLS_msn is too far ahead of the playlist", http.StatusBadRequest)
+			return
 		}
-		return nil, vidplayer.ErrNotFound
+
+		timeout := 3 * time.Duration(pl.TargetDuration()) * time.Second
+		if timeout == 0 {
+			timeout = LLHLSBlockingReloadTimeout
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		if err := pl.Wait(ctx, msn, part); err != nil {
+			http.Error(w, "timed out waiting for _HLS_msn", http.StatusServiceUnavailable)
+			return
+		}
+	} else if query.Get("_HLS_part") != "" {
+		http.Error(w, "_HLS_part requires _HLS_msn", http.StatusBadRequest)
+		return
 	}
-}
 
-//End HLS Play Handlers
+	w.Write(pl.Encode().Bytes())
+}
 
 //Start RTMP Play Handlers
 func getRTMPStreamHandler(s *LivepeerServer) func(url *url.URL) (stream.RTMPVideoStream, error) {
@@ -551,22 +987,22 @@ func (s *LivepeerServer) HandlePush(w http.ResponseWriter, r *http.Request) {
 	r.Body.Close()
 	r.URL = &url.URL{Scheme: "http", Host: r.Host, Path: r.URL.Path}
 
-	if ".ts" != path.Ext(r.URL.Path) {
+	format := pushFormat(r)
+	if format == "" {
 		// ffmpeg sends us a m3u8 as well, so ignore
-		// Alternatively, reject m3u8s explicitly and take any other type
-		// TODO also look at use content-type
 		http.Error(w, fmt.Sprintf(`ignoring file extension: %s`, path.Ext(r.URL.Path)), http.StatusBadRequest)
 		return
 	}
 
 	now := time.Now()
-	mid := parseManifestID(r.URL.Path)
+	mid := core.NamespacedManifestID(BroadcastManifestIDNamespace, string(parseManifestID(r.URL.Path)))
 	s.connectionLock.Lock()
 	cxn, exists := s.rtmpConnections[mid]
 	if exists && cxn != nil {
 		cxn.lastUsed = now
 	}
 	s.connectionLock.Unlock()
+	s.LivepeerNode.Sessions.Touch(mid)
 
 	// Check for presence and register if a fresh cxn
 	if !exists {
@@ -578,10 +1014,12 @@ func (s *LivepeerServer) HandlePush(w http.ResponseWriter, r *http.Request) {
 		st := stream.NewBasicRTMPVideoStream(appData)
 		params := streamParams(st)
 		params.resolution = r.Header.Get("Content-Resolution")
+		params.source = core.SessionSourceHTTPPush
 
 		cxn, err = s.registerConnection(st)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			setQuotaHeaders(w, r)
+			http.Error(w, err.Error(), streamErrorCode(err))
 			return
 		}
 
@@ -602,12 +1040,26 @@ func (s *LivepeerServer) HandlePush(w http.ResponseWriter, r *http.Request) {
 		}(s, mid)
 	}
 
-	fname := path.Base(r.URL.Path)
-	seq, err := strconv.ParseUint(strings.TrimSuffix(fname, path.Ext(fname)), 10, 64)
-	if err != nil {
-		seq = 0
+	if format == pushFormatFMP4 {
+		body, err = s.pushFMP4(cxn, body)
+		if err == errMP4Data || err == errFMP4Init {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			glog.Errorf("Error remuxing pushed segment manifestID=%s: %v", mid, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if body == nil {
+			// Initialization segment
+			w.WriteHeader(http.StatusOK)
+			return
+		}
 	}
 
+	fname := path.Base(r.URL.Path)
+	seq := pushSeqNo(fname)
+
 	duration, err := strconv.Atoi(r.Header.Get("Content-Duration"))
 	if err != nil {
 		duration = 2000
@@ -623,15 +1075,57 @@ func (s *LivepeerServer) HandlePush(w http.ResponseWriter, r *http.Request) {
 
 	// Do the transcoding!
 	err = processSegment(cxn, seg)
-	if err != nil {
+	setQuotaHeaders(w, r)
+	// Segments that could not be transcoded are still served as the source rendition
+	if err != nil && err != errNoOrchs {
 		// TODO return error
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), streamErrorCode(err))
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
+// Formats of segments pushed over HTTP
+const (
+	pushFormatTS   = "ts"
+	pushFormatFMP4 = "fmp4"
+)
+
+// pushFormat returns the format of a pushed segment from the extension of its name or else
+// from its content type. Empty if the format is not supported
+func pushFormat(r *http.Request) string {
+	switch path.Ext(r.URL.Path) {
+	case ".ts":
+		return pushFormatTS
+	case ".mp4", ".m4s":
+		return pushFormatFMP4
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "video/mp2t":
+		return pushFormatTS
+	case "video/mp4", "video/iso.segment":
+		return pushFormatFMP4
+	}
+	return ""
+}
+
+// pushSeqNo returns the sequence number of a pushed segment, from the digits at the end of
+// its name as in the segments of packagers, e.g. 12 for index12.ts
+func pushSeqNo(fname string) uint64 {
+	name := strings.TrimSuffix(fname, path.Ext(fname))
+	i := len(name)
+	for i > 0 && name[i-1] >= '0' && name[i-1] <= '9' {
+		i--
+	}
+	seq, err := strconv.ParseUint(name[i:], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return seq
+}
+
 //Helper Methods Begin
 
 // Match all leading spaces, slashes and optionally `stream/`
@@ -651,6 +1145,19 @@ func parseManifestID(reqPath string) core.ManifestID {
 	return parseStreamID(reqPath).ManifestID
 }
 
+// parseTranscodingOptions parses either a comma separated list of preset names
+// or the path to a JSON file that defines custom profiles
+func parseTranscodingOptions(transcodingOptions string) ([]ffmpeg.VideoProfile, common.ProfileEncoders, error) {
+	if strings.HasSuffix(transcodingOptions, ".json") {
+		data, err := ioutil.ReadFile(transcodingOptions)
+		if err != nil {
+			return nil, nil, err
+		}
+		return common.ParseProfiles(data)
+	}
+	return parsePresets(strings.Split(transcodingOptions, ",")), nil, nil
+}
+
 func parsePresets(presets []string) []ffmpeg.VideoProfile {
 	profs := make([]ffmpeg.VideoProfile, 0)
 	for _, v := range presets {
@@ -661,6 +1168,76 @@ func parsePresets(presets []string) []ffmpeg.VideoProfile {
 	return profs
 }
 
+// SetStreamProfiles changes the output profiles of a running stream, and their encoder options.
+// Segments that are submitted for transcoding after the change use the new profiles
+func (s *LivepeerServer) SetStreamProfiles(mid core.ManifestID, profiles []ffmpeg.VideoProfile, encoders common.ProfileEncoders) error {
+	if len(profiles) == 0 {
+		return errors.New("no transcoding profiles")
+	}
+
+	s.connectionLock.RLock()
+	cxn, exists := s.rtmpConnections[mid]
+	s.connectionLock.RUnlock()
+	if !exists {
+		return errUnknownStream
+	}
+	// The orchestrators of the stream were selected for the codecs of its initial profiles
+	if required := core.RequiredCapabilities(encoders); !core.HasCapabilities(core.RequiredCapabilities(cxn.params.encoders), required) {
+		return fmt.Errorf("the stream was not started with profiles that require capabilities %v", required)
+	}
+
+	cxn.setProfiles(profiles, encoders)
+	if err := s.LivepeerNode.Sessions.SetProfiles(mid, profiles); err != nil && err != core.ErrUnknownSession {
+		return err
+	}
+
+	glog.Infof("Updated transcoding profiles manifestID=%v profiles=%v", mid, common.ProfilesNames(profiles))
+
+	return nil
+}
+
+// EndNamespaceStreams ends the streams with ManifestIDs in a namespace and returns their ManifestIDs
+func (s *LivepeerServer) EndNamespaceStreams(namespace string) []core.ManifestID {
+	var ended []core.ManifestID
+	for _, mid := range s.manifestIDs.InNamespace(namespace) {
+		s.connectionLock.RLock()
+		cxn, ok := s.rtmpConnections[mid]
+		s.connectionLock.RUnlock()
+		if !ok {
+			continue
+		}
+		if err := removeRTMPStream(s, mid); err != nil {
+			continue
+		}
+		if cxn.stream != nil {
+			cxn.stream.Close()
+		}
+		ended = append(ended, mid)
+	}
+	return ended
+}
+
+// EndStream forcibly ends the stream of a ManifestID: the ingest of the stream is disconnected,
+// its sessions with orchestrators are ended and the credit of the stream is cleared
+func (s *LivepeerServer) EndStream(mid core.ManifestID) error {
+	s.connectionLock.RLock()
+	cxn, ok := s.rtmpConnections[mid]
+	s.connectionLock.RUnlock()
+	if !ok {
+		return errUnknownStream
+	}
+	if err := removeRTMPStream(s, mid); err != nil {
+		return err
+	}
+	if cxn.stream != nil {
+		cxn.stream.Close()
+	}
+	if s.LivepeerNode.Balances != nil {
+		core.NewBalance(mid, s.LivepeerNode.Balances).Clear()
+	}
+	return nil
+}
+
 func (s *LivepeerServer) LastManifestID() core.ManifestID {
 	s.connectionLock.RLock()
 	defer s.connectionLock.RUnlock()
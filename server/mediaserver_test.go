@@ -48,6 +48,7 @@ func setupServer() *LivepeerServer {
 
 type stubDiscovery struct {
 	infos       []*net.OrchestratorInfo
+	urls        []*url.URL
 	waitGetOrch chan struct{}
 
 	// typically the following fields have to be wrapped by `lock`
@@ -58,7 +59,7 @@ type stubDiscovery struct {
 }
 
 func (d *stubDiscovery) GetURLs() []*url.URL {
-	return nil
+	return d.urls
 }
 
 func (d *stubDiscovery) GetOrchestrators(num int) ([]*net.OrchestratorInfo, error) {
@@ -257,6 +258,7 @@ func TestCreateRTMPStreamHandlerCap(t *testing.T) {
 	s := &LivepeerServer{
 		connectionLock:  &sync.RWMutex{},
 		rtmpConnections: make(map[core.ManifestID]*rtmpConnection),
+		manifestIDs:     core.NewManifestIDRegistry(),
 	}
 	createSid := createRTMPStreamIDHandler(s)
 	u, _ := url.Parse("http://hot/id1/secret")
@@ -368,6 +370,109 @@ func TestCreateRTMPStreamHandlerWebhook(t *testing.T) {
 	defer ts7.Close()
 	params = createSid(u).(*streamParameters)
 	assert.Len(params.profiles, 0, "Unexpected value in presets")
+
+	// adaptive ladder defaults to the node config
+	BroadcastAdaptiveLadder = &core.AdaptiveLadderConfig{MinScale: 0.8, MaxScale: 1.2}
+	defer func() { BroadcastAdaptiveLadder = nil }()
+	params = createSid(u).(*streamParameters)
+	assert.Equal(BroadcastAdaptiveLadder, params.ladder)
+
+	// adaptive ladder from webhook overrides the node config
+	ts8 := makeServer(`{"manifestID":"a", "adaptiveLadder":{"minScale":0.5, "maxScale":1.5}}`)
+	defer ts8.Close()
+	params = createSid(u).(*streamParameters)
+	assert.Equal(&core.AdaptiveLadderConfig{MinScale: 0.5, MaxScale: 1.5}, params.ladder)
+
+	// invalid adaptive ladder
+	ts9 := makeServer(`{"manifestID":"a", "adaptiveLadder":{"minScale":2, "maxScale":1}}`)
+	defer ts9.Close()
+	sid = createSid(u)
+	assert.Nil(sid, "Should not pass if returned adaptive ladder is invalid")
+
+	// namespace from webhook is prefixed to the manifestID
+	ts10 := makeServer(`{"manifestID":"a", "namespace":"tenant"}`)
+	defer ts10.Close()
+	params = createSid(u).(*streamParameters)
+	assert.Equal(core.ManifestID("tenant_a"), params.mid)
+
+	// invalid namespace
+	ts11 := makeServer(`{"manifestID":"a", "namespace":"ten/ant"}`)
+	defer ts11.Close()
+	sid = createSid(u)
+	assert.Nil(sid, "Should not pass if returned namespace is invalid")
+
+	// manifestID is derived from the external ID
+	ts12 := makeServer(`{"namespace":"tenant", "externalID":"key"}`)
+	defer ts12.Close()
+	params = createSid(u).(*streamParameters)
+	assert.Equal(core.DeterministicManifestID("tenant", "key"), params.mid)
+	assert.Equal("key", params.externalID)
+
+	// node namespace is used if the webhook does not return one
+	BroadcastManifestIDNamespace = "node"
+	defer func() { BroadcastManifestIDNamespace = "" }()
+	ts13 := makeServer(`{"externalID":"key"}`)
+	defer ts13.Close()
+	params = createSid(u).(*streamParameters)
+	assert.Equal(core.DeterministicManifestID("node", "key"), params.mid)
+	ts14 := makeServer(`{"manifestID":"a"}`)
+	defer ts14.Close()
+	params = createSid(u).(*streamParameters)
+	assert.Equal(core.ManifestID("node_a"), params.mid)
+}
+
+func TestAuthWebhookEvents(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := setupServer()
+	s.RTMPSegmenter = &StubSegmenter{skip: true}
+	createSid := createRTMPStreamIDHandler(s)
+	handler := gotRTMPStreamHandler(s)
+	endHandler := endRTMPStreamHandler(s)
+
+	reqs := make(chan authWebhookRequest, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req authWebhookRequest
+		require.Nil(json.NewDecoder(r.Body).Decode(&req))
+		reqs <- req
+		if req.StreamKey == "badkey" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if req.Event == authWebhookEventPublish {
+			w.Write([]byte(`{"manifestID":"webhookmid", "externalID":"ext"}`))
+		}
+	}))
+	defer ts.Close()
+	AuthWebhookURL = ts.URL
+	defer func() { AuthWebhookURL = "" }()
+
+	// Stream key is rejected
+	u, _ := url.Parse("rtmps://localhost/movie/badkey")
+	assert.Nil(createSid(u))
+	req := <-reqs
+	assert.Equal(authWebhookRequest{Event: authWebhookEventPublish, URL: u.String(), ManifestID: "movie", StreamKey: "badkey"}, req)
+
+	// Stream key is accepted
+	u, _ = url.Parse("rtmps://localhost/movie/goodkey")
+	sid := createSid(u)
+	require.NotNil(sid)
+	req = <-reqs
+	assert.Equal(authWebhookEventPublish, req.Event)
+	assert.Equal("goodkey", req.StreamKey)
+	st := stream.NewBasicRTMPVideoStream(sid)
+	require.Nil(handler(u, st))
+	params := streamParams(st)
+	assert.Equal(core.ManifestID("webhookmid"), params.mid)
+
+	// Webhook is notified when the stream ends
+	require.Nil(endHandler(u, st))
+	select {
+	case req = <-reqs:
+	case <-time.After(time.Second):
+		t.Fatal("Webhook not notified of ended stream")
+	}
+	assert.Equal(authWebhookRequest{Event: authWebhookEventStreamEnded, ManifestID: "webhookmid", StreamKey: params.rtmpKey, ExternalID: "ext"}, req)
 }
 
 func TestCreateRTMPStreamHandler(t *testing.T) {
@@ -644,6 +749,41 @@ func TestGetHLSMasterPlaylistHandler(t *testing.T) {
 	}
 }
 
+func TestSetStreamProfiles(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := setupServer()
+	mid := core.SplitStreamIDString(t.Name()).ManifestID
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}
+	strm := stream.NewBasicRTMPVideoStream(&streamParameters{mid: mid, profiles: profiles})
+
+	newProfiles := []ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9, ffmpeg.P360p30fps16x9}
+
+	// Should return an error for an unknown stream
+	err := s.SetStreamProfiles(mid, newProfiles, nil)
+	assert.Equal(errUnknownStream, err)
+
+	cxn, err := s.registerConnection(strm)
+	require.Nil(err)
+	defer removeRTMPStream(s, mid)
+	assert.Equal(profiles, cxn.getProfiles())
+
+	// Should return an error if no profiles are provided
+	err = s.SetStreamProfiles(mid, nil, nil)
+	assert.EqualError(err, "no transcoding profiles")
+	assert.Equal(profiles, cxn.getProfiles())
+
+	encoders := common.ProfileEncoders{ffmpeg.P240p30fps16x9.Name: {GOP: "intra"}}
+	err = s.SetStreamProfiles(mid, newProfiles, encoders)
+	assert.Nil(err)
+	assert.Equal(newProfiles, cxn.getProfiles())
+	assert.Equal(encoders, cxn.getEncoders())
+
+	sess, ok := s.LivepeerNode.Sessions.Get(mid)
+	require.True(ok)
+	assert.Equal(newProfiles, sess.Profiles)
+}
+
 func TestRegisterConnection(t *testing.T) {
 	assert := assert.New(t)
 	s := setupServer()
@@ -727,6 +867,195 @@ func TestRegisterConnection(t *testing.T) {
 
 }
 
+func TestRegisterConnection_Namespace(t *testing.T) {
+	assert := assert.New(t)
+	s := setupServer()
+
+	register := func(mid core.ManifestID, externalID string) (*rtmpConnection, error) {
+		strm := stream.NewBasicRTMPVideoStream(&streamParameters{mid: mid, externalID: externalID})
+		return s.registerConnection(strm)
+	}
+
+	ns := "register-namespace"
+	mid1 := core.DeterministicManifestID(ns, "key1")
+	mid2 := core.NamespacedManifestID(ns, "abc")
+	other := core.NamespacedManifestID(ns+"-other", "abc")
+	_, err := register(mid1, "key1")
+	assert.Nil(err)
+	_, err = register(mid2, "")
+	assert.Nil(err)
+	_, err = register(other, "")
+	assert.Nil(err)
+	defer removeRTMPStream(s, other)
+
+	// A second stream with the same external key collides
+	_, err = register(mid1, "key1")
+	assert.Equal(errAlreadyExists, err)
+
+	ended := s.EndNamespaceStreams(ns)
+	assert.ElementsMatch([]core.ManifestID{mid1, mid2}, ended)
+	s.connectionLock.RLock()
+	_, ok1 := s.rtmpConnections[mid1]
+	_, ok2 := s.rtmpConnections[mid2]
+	_, ok3 := s.rtmpConnections[other]
+	s.connectionLock.RUnlock()
+	assert.False(ok1)
+	assert.False(ok2)
+	assert.True(ok3)
+	assert.Empty(s.EndNamespaceStreams(ns))
+
+	// The manifestID can be used again once its stream is ended
+	_, err = register(mid1, "key1")
+	assert.Nil(err)
+	removeRTMPStream(s, mid1)
+}
+
+func TestEndStream(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	s := setupServer()
+	balances := s.LivepeerNode.Balances
+	s.LivepeerNode.Balances = core.NewBalances(time.Minute)
+	defer func() { s.LivepeerNode.Balances = balances }()
+
+	assert.Equal(errUnknownStream, s.EndStream("foo"))
+
+	_, err := s.registerConnection(stream.NewBasicRTMPVideoStream(&streamParameters{mid: "foo"}))
+	require.Nil(err)
+	s.LivepeerNode.Balances.Credit("foo", big.NewRat(5, 1))
+	_, err = s.registerConnection(stream.NewBasicRTMPVideoStream(&streamParameters{mid: "bar"}))
+	require.Nil(err)
+	defer removeRTMPStream(s, "bar")
+	s.LivepeerNode.Balances.Credit("bar", big.NewRat(5, 1))
+
+	require.Nil(s.EndStream("foo"))
+	_, ok := s.StreamStatus("foo")
+	assert.False(ok)
+	_, ok = s.LivepeerNode.Sessions.Get("foo")
+	assert.False(ok)
+	assert.Nil(s.LivepeerNode.Balances.Balance("foo"))
+	assert.Equal(errUnknownStream, s.EndStream("foo"))
+
+	// The other streams are not affected
+	_, ok = s.StreamStatus("bar")
+	assert.True(ok)
+	assert.Equal(big.NewRat(5, 1), s.LivepeerNode.Balances.Balance("bar"))
+
+	// The manifestID can be used again once its stream is ended
+	_, err = s.registerConnection(stream.NewBasicRTMPVideoStream(&streamParameters{mid: "foo"}))
+	require.Nil(err)
+	removeRTMPStream(s, "foo")
+}
+
+func TestEndStreamHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	s := setupServer()
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		endStreamHandler(s).ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	w := serve("POST", "/endStream")
+	assert.Equal(http.StatusBadRequest, w.Code)
+	assert.Contains(w.Body.String(), "missing form param: manifestID")
+
+	w = serve("POST", "/endStream?manifestID=foo")
+	assert.Equal(http.StatusNotFound, w.Code)
+	assert.JSONEq(`{"error":{"code":"not_found","message":"unknown stream foo"}}`, w.Body.String())
+
+	_, err := s.registerConnection(stream.NewBasicRTMPVideoStream(&streamParameters{mid: "foo"}))
+	require.Nil(err)
+
+	w = serve("GET", "/endStream?manifestID=foo")
+	assert.Equal(http.StatusMethodNotAllowed, w.Code)
+	_, ok := s.StreamStatus("foo")
+	assert.True(ok)
+
+	w = serve("POST", "/endStream?manifestID=foo")
+	assert.Equal(http.StatusOK, w.Code)
+	_, ok = s.StreamStatus("foo")
+	assert.False(ok)
+}
+
+func TestHandleLLHLS(t *testing.T) {
+	assert := assert.New(t)
+	s := setupServer()
+
+	get := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		s.HandleLLHLS(w, httptest.NewRequest("GET", path, nil))
+		return w.Code, w.Body.String()
+	}
+
+	// Unknown stream
+	code, _ := get("/llhls/unknown/P240p30fps16x9.m3u8")
+	assert.Equal(http.StatusNotFound, code)
+
+	mid := core.ManifestID("llhls")
+	strm := stream.NewBasicRTMPVideoStream(&streamParameters{mid: mid})
+	cxn, err := s.registerConnection(strm)
+	require.Nil(t, err)
+	defer removeRTMPStream(s, mid)
+
+	code, _ = get("/llhls/llhls/seg.ts")
+	assert.Equal(http.StatusNotFound, code)
+	code, _ = get("/llhls/llhls/P240p30fps16x9.m3u8")
+	assert.Equal(http.StatusNotFound, code)
+
+	profile := ffmpeg.P240p30fps16x9
+	assert.Nil(cxn.pl.InsertHLSSegment(&profile, 1, "/stream/llhls/P240p30fps16x9/1.ts", 1.0))
+	assert.Nil(cxn.pl.InsertHLSPart(&profile, 2, &core.LLHLSPart{URI: "/stream/llhls/P240p30fps16x9/2.0.ts", Duration: 0.5, Independent: true}))
+
+	code, body := get("/llhls/llhls.m3u8")
+	assert.Equal(http.StatusOK, code)
+	assert.Contains(body, "llhls/P240p30fps16x9.m3u8")
+
+	code, body = get("/llhls/llhls/P240p30fps16x9.m3u8")
+	assert.Equal(http.StatusOK, code)
+	assert.Contains(body, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES")
+	assert.Contains(body, "/stream/llhls/P240p30fps16x9/1.ts")
+	assert.Contains(body, `#EXT-X-PART:DURATION=0.500,URI="/stream/llhls/P240p30fps16x9/2.0.ts",INDEPENDENT=YES`)
+
+	// Available segments and parts are returned right away
+	code, _ = get("/llhls/llhls/P240p30fps16x9.m3u8?_HLS_msn=1")
+	assert.Equal(http.StatusOK, code)
+	code, _ = get("/llhls/llhls/P240p30fps16x9.m3u8?_HLS_msn=2&_HLS_part=0")
+	assert.Equal(http.StatusOK, code)
+
+	// Invalid blocking reload parameters
+	code, _ = get("/llhls/llhls/P240p30fps16x9.m3u8?_HLS_part=0")
+	assert.Equal(http.StatusBadRequest, code)
+	code, _ = get("/llhls/llhls/P240p30fps16x9.m3u8?_HLS_msn=foo")
+	assert.Equal(http.StatusBadRequest, code)
+	code, _ = get("/llhls/llhls/P240p30fps16x9.m3u8?_HLS_msn=2&_HLS_part=-1")
+	assert.Equal(http.StatusBadRequest, code)
+	code, _ = get("/llhls/llhls/P240p30fps16x9.m3u8?_HLS_msn=5")
+	assert.Equal(http.StatusBadRequest, code)
+
+	// Blocks until the part is available
+	done := make(chan string)
+	go func() {
+		_, body := get("/llhls/llhls/P240p30fps16x9.m3u8?_HLS_msn=2&_HLS_part=1")
+		done <- body
+	}()
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(cxn.pl.InsertHLSPart(&profile, 2, &core.LLHLSPart{URI: "/stream/llhls/P240p30fps16x9/2.1.ts", Duration: 0.5}))
+	select {
+	case body := <-done:
+		assert.Contains(body, "/stream/llhls/P240p30fps16x9/2.1.ts")
+	case <-time.After(time.Second):
+		t.Error("Blocking reload did not return")
+	}
+
+	// Times out if the segment does not appear
+	code, _ = get("/llhls/llhls/P240p30fps16x9.m3u8?_HLS_msn=3")
+	assert.Equal(http.StatusServiceUnavailable, code)
+}
+
 func TestBroadcastSessionManagerWithStreamStartStop(t *testing.T) {
 	assert := assert.New(t)
 
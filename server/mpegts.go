@@ -0,0 +1,495 @@
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+	// Clock rate of PES timestamps
+	tsClockRate = 90000
+	// PES timestamps are 33 bits and wrap around
+	tsPTSMask = 1<<33 - 1
+	// Maximum amount of data buffered for a segment, e.g. if the stream has no keyframes
+	tsMaxSegmentSize = 32 << 20
+)
+
+// MPEG-TS stream types of the elementary streams that are kept by the segmenter
+var (
+	tsVideoStreamTypes = map[byte]bool{
+		0x02: true, // MPEG-2
+		0x1b: true, // H.264
+		0x24: true, // HEVC
+	}
+	tsAudioStreamTypes = map[byte]bool{
+		0x03: true, // MPEG-1 audio
+		0x04: true, // MPEG-2 audio
+		0x0f: true, // AAC
+		0x11: true, // AAC LATM
+		0x81: true, // AC-3
+	}
+)
+
+const tsStreamTypeH264 = 0x1b
+
+var errTSPacket = errors.New("data is not made of MPEG-TS packets")
+
+// tsSegmenter splits an MPEG-TS stream into segments of about the target duration that
+// start with a keyframe. Only the first program of the stream is kept, with one video
+// elementary stream and its audio elementary streams. Every segment starts with the PAT
+// and PMT of the program
+type tsSegmenter struct {
+	// Configured PIDs of the elementary streams, detected from the PMT if 0. Every audio
+	// stream is kept if the audio PID is not configured
+	videoPID, audioPID uint16
+	target             int64
+	emit               func(data []byte, seqNo uint64, duration float64)
+
+	pmtPID    uint16
+	video     uint16
+	audio     map[uint16]bool
+	videoType byte
+	// PAT and PMT packets rewritten for the kept program and streams
+	pat, pmt []byte
+
+	buf      []byte
+	started  bool
+	startPTS int64
+	lastPTS  int64
+	seqNo    uint64
+}
+
+func newTSSegmenter(videoPID, audioPID uint16, target time.Duration, emit func(data []byte, seqNo uint64, duration float64)) *tsSegmenter {
+	return &tsSegmenter{
+		videoPID: videoPID,
+		audioPID: audioPID,
+		target:   int64(target.Seconds() * tsClockRate),
+		emit:     emit,
+	}
+}
+
+// write segments data made of whole MPEG-TS packets
+func (t *tsSegmenter) write(data []byte) error {
+	if err := checkTSPackets(data); err != nil {
+		return err
+	}
+	for i := 0; i < len(data); i += tsPacketSize {
+		t.packet(data[i : i+tsPacketSize])
+	}
+	return nil
+}
+
+// flush emits the data of the current segment, e.g. when the stream ends
+func (t *tsSegmenter) flush() {
+	if t.started {
+		t.flushSegment(t.lastPTS)
+	}
+}
+
+// tsPacketPayload returns the PID of a packet, whether it starts a PES packet or PSI
+// section, whether it is a random access point and its payload
+func tsPacketPayload(pkt []byte) (pid uint16, pusi, randomAccess bool, payload []byte) {
+	pid = binary.BigEndian.Uint16(pkt[1:]) & 0x1fff
+	pusi = pkt[1]&0x40 != 0
+	afc := pkt[3] >> 4 & 0x3
+	offset := 4
+	if afc&0x2 != 0 {
+		afLen := int(pkt[4])
+		if afLen > 0 {
+			randomAccess = pkt[5]&0x40 != 0
+		}
+		offset += 1 + afLen
+	}
+	if afc&0x1 != 0 && offset < tsPacketSize {
+		payload = pkt[offset:]
+	}
+	return pid, pusi, randomAccess, payload
+}
+
+func (t *tsSegmenter) packet(pkt []byte) {
+	pid, pusi, randomAccess, payload := tsPacketPayload(pkt)
+	switch {
+	case pid == 0:
+		if pusi {
+			t.parsePAT(pkt, payload)
+		}
+		t.append(t.pat)
+	case pid == t.pmtPID && t.pmtPID != 0:
+		if pusi {
+			t.parsePMT(pkt, payload)
+		}
+		t.append(t.pmt)
+	case pid == t.video && t.video != 0:
+		if pusi {
+			if pts, ok := pesPTS(payload); ok {
+				if randomAccess || t.videoType == tsStreamTypeH264 && h264Keyframe(payload) {
+					t.keyframe(pts)
+				}
+				t.lastPTS = pts
+			}
+		}
+		t.append(pkt)
+	case t.audio[pid]:
+		t.append(pkt)
+	}
+}
+
+// keyframe starts a new segment at a keyframe once the current one reaches the target duration
+func (t *tsSegmenter) keyframe(pts int64) {
+	if t.pat == nil || t.pmt == nil {
+		return
+	}
+	if t.started {
+		if (pts-t.startPTS)&tsPTSMask < t.target {
+			return
+		}
+		t.flushSegment(pts)
+	}
+	t.started = true
+	t.startPTS = pts
+	t.buf = make([]byte, 0, 2*tsPacketSize)
+	t.buf = append(t.buf, t.pat...)
+	t.buf = append(t.buf, t.pmt...)
+}
+
+func (t *tsSegmenter) flushSegment(endPTS int64) {
+	duration := float64((endPTS-t.startPTS)&tsPTSMask) / tsClockRate
+	t.emit(t.buf, t.seqNo, duration)
+	t.seqNo++
+	t.buf = nil
+	t.started = false
+}
+
+func (t *tsSegmenter) append(pkt []byte) {
+	if !t.started || pkt == nil {
+		return
+	}
+	t.buf = append(t.buf, pkt...)
+	if len(t.buf) > tsMaxSegmentSize {
+		// Packets are dropped until the next keyframe
+		glog.Warningf("MPEG-TS segment exceeds the maximum size without a keyframe seqNo=%d", t.seqNo)
+		t.flushSegment(t.lastPTS)
+	}
+}
+
+// parsePAT keeps the first program of the PAT
+func (t *tsSegmenter) parsePAT(pkt, payload []byte) {
+	pat, pmtPID := firstProgram(psiSection(payload, 0x00))
+	if pat == nil {
+		return
+	}
+	if pmtPID != t.pmtPID {
+		t.pmtPID, t.pmt = pmtPID, nil
+	}
+	t.pat = tsPSIPacket(pkt, pat)
+}
+
+// parsePMT picks the video and audio streams of the program and keeps them in the PMT
+func (t *tsSegmenter) parsePMT(pkt, payload []byte) {
+	sec := psiSection(payload, 0x02)
+	streams, hdrLen, ok := pmtStreams(sec)
+	if !ok {
+		return
+	}
+	var video *pmtStream
+	var audio []pmtStream
+	for i, st := range streams {
+		if video == nil && (st.pid == t.videoPID || t.videoPID == 0 && tsVideoStreamTypes[st.streamType]) {
+			video = &streams[i]
+		} else if st.pid == t.audioPID || t.audioPID == 0 && tsAudioStreamTypes[st.streamType] {
+			audio = append(audio, st)
+		}
+	}
+	if video == nil {
+		return
+	}
+
+	section := append([]byte{}, sec[:hdrLen]...)
+	section = append(section, video.entry...)
+	t.audio = make(map[uint16]bool)
+	for _, st := range audio {
+		section = append(section, st.entry...)
+		t.audio[st.pid] = true
+	}
+	t.video, t.videoType = video.pid, video.streamType
+	t.pmt = tsPSIPacket(pkt, section)
+}
+
+// firstProgram returns a PAT section with only the first program of sec, and the PID of
+// the PMT of the program. The section is nil if sec has no program
+func firstProgram(sec []byte) ([]byte, uint16) {
+	for i := 8; i+4 <= len(sec); i += 4 {
+		program := binary.BigEndian.Uint16(sec[i:])
+		if program == 0 {
+			// Network information table
+			continue
+		}
+		pmtPID := binary.BigEndian.Uint16(sec[i+2:]) & 0x1fff
+		return append(append([]byte{}, sec[:8]...), sec[i:i+4]...), pmtPID
+	}
+	return nil, 0
+}
+
+// pmtStream is an elementary stream of a program
+type pmtStream struct {
+	streamType byte
+	pid        uint16
+	// Entry of the stream in the PMT, with its descriptors
+	entry []byte
+}
+
+// language returns the ISO 639 language code of the stream from its language descriptor,
+// if any
+func (s pmtStream) language() string {
+	desc := s.entry[5:]
+	for len(desc) >= 2 {
+		tag, n := desc[0], int(desc[1])
+		if 2+n > len(desc) {
+			break
+		}
+		if tag == 0x0a && n >= 3 {
+			for _, c := range desc[2:5] {
+				if c < 'A' || c > 'Z' && c < 'a' || c > 'z' {
+					return ""
+				}
+			}
+			return string(desc[2:5])
+		}
+		desc = desc[2+n:]
+	}
+	return ""
+}
+
+// pmtStreams returns the elementary streams of a PMT section and the length of the part
+// of the section before them. ok is false if the section is malformed
+func pmtStreams(sec []byte) (streams []pmtStream, hdrLen int, ok bool) {
+	if len(sec) < 12 {
+		return nil, 0, false
+	}
+	hdrLen = 12 + int(binary.BigEndian.Uint16(sec[10:])&0x0fff)
+	if hdrLen > len(sec) {
+		return nil, 0, false
+	}
+	for i := hdrLen; i+5 <= len(sec); {
+		esLen := int(binary.BigEndian.Uint16(sec[i+3:]) & 0x0fff)
+		if i+5+esLen > len(sec) {
+			break
+		}
+		streams = append(streams, pmtStream{
+			streamType: sec[i],
+			pid:        binary.BigEndian.Uint16(sec[i+1:]) & 0x1fff,
+			entry:      sec[i : i+5+esLen],
+		})
+		i += 5 + esLen
+	}
+	return streams, hdrLen, true
+}
+
+// tsProgramStreams returns the elementary streams of the first program of MPEG-TS data,
+// from its first PAT and PMT. No streams are returned if the data has no PMT
+func tsProgramStreams(data []byte) ([]pmtStream, error) {
+	if err := checkTSPackets(data); err != nil {
+		return nil, err
+	}
+	var pmtPID uint16
+	for i := 0; i < len(data); i += tsPacketSize {
+		pid, pusi, _, payload := tsPacketPayload(data[i : i+tsPacketSize])
+		if !pusi {
+			continue
+		}
+		if pid == 0 && pmtPID == 0 {
+			_, pmtPID = firstProgram(psiSection(payload, 0x00))
+		} else if pid == pmtPID && pmtPID != 0 {
+			if streams, _, ok := pmtStreams(psiSection(payload, 0x02)); ok {
+				return streams, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// tsSelectStreams keeps the first program of MPEG-TS data with only the elementary streams
+// that keep returns true for. If the PCR of the program is carried by a stream that is not
+// kept, the program is left without a PCR
+func tsSelectStreams(data []byte, keep func(st pmtStream) bool) ([]byte, error) {
+	if err := checkTSPackets(data); err != nil {
+		return nil, err
+	}
+	var pmtPID uint16
+	kept := make(map[uint16]bool)
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i += tsPacketSize {
+		pkt := data[i : i+tsPacketSize]
+		pid, pusi, _, payload := tsPacketPayload(pkt)
+		switch {
+		case pid == 0:
+			if !pusi {
+				continue
+			}
+			var pat []byte
+			if pat, pmtPID = firstProgram(psiSection(payload, 0x00)); pat != nil {
+				out = append(out, tsPSIPacket(pkt, pat)...)
+			}
+		case pid == pmtPID && pmtPID != 0:
+			if !pusi {
+				continue
+			}
+			sec := psiSection(payload, 0x02)
+			streams, hdrLen, ok := pmtStreams(sec)
+			if !ok {
+				continue
+			}
+			section := append([]byte{}, sec[:hdrLen]...)
+			kept = make(map[uint16]bool)
+			esPIDs := make(map[uint16]bool)
+			for _, st := range streams {
+				esPIDs[st.pid] = true
+				if keep(st) {
+					section = append(section, st.entry...)
+					kept[st.pid] = true
+				}
+			}
+			pcrPID := binary.BigEndian.Uint16(sec[8:]) & 0x1fff
+			if !esPIDs[pcrPID] && pcrPID != 0x1fff {
+				// The PCR has its own PID
+				kept[pcrPID] = true
+			} else if !kept[pcrPID] {
+				section[8], section[9] = section[8]|0x1f, 0xff
+			}
+			out = append(out, tsPSIPacket(pkt, section)...)
+		case kept[pid]:
+			out = append(out, pkt...)
+		}
+	}
+	return out, nil
+}
+
+// checkTSPackets returns an error if data is not made of whole MPEG-TS packets
+func checkTSPackets(data []byte) error {
+	if len(data)%tsPacketSize != 0 {
+		return errTSPacket
+	}
+	for i := 0; i < len(data); i += tsPacketSize {
+		if data[i] != tsSyncByte {
+			return errTSPacket
+		}
+	}
+	return nil
+}
+
+// psiSection returns the section of a table in the payload of a packet, without its CRC.
+// Returns nil if the section does not fit in the packet
+func psiSection(payload []byte, tableID byte) []byte {
+	if len(payload) == 0 {
+		return nil
+	}
+	start := 1 + int(payload[0])
+	if start+8 > len(payload) || payload[start] != tableID {
+		return nil
+	}
+	sec := payload[start:]
+	end := 3 + int(binary.BigEndian.Uint16(sec[1:])&0x0fff)
+	if end > len(sec) || end < 12 {
+		return nil
+	}
+	return sec[:end-4]
+}
+
+// tsPSIPacket builds a packet with the header of pkt that carries section, whose length
+// field and CRC are updated. The section must fit in the packet
+func tsPSIPacket(pkt, section []byte) []byte {
+	if 5+len(section)+4 > tsPacketSize {
+		return nil
+	}
+	out := make([]byte, tsPacketSize)
+	copy(out, pkt[:4])
+	// Payload only
+	out[3] = out[3]&0x0f | 0x10
+	out[4] = 0 // Pointer field
+	n := copy(out[5:], section)
+	length := len(section) - 3 + 4
+	out[6] = out[6]&0xf0 | byte(length>>8&0x0f)
+	out[7] = byte(length)
+	binary.BigEndian.PutUint32(out[5+n:], mpegCRC32(out[5:5+n]))
+	for i := 5 + n + 4; i < tsPacketSize; i++ {
+		out[i] = 0xff
+	}
+	return out
+}
+
+// pesPTS returns the presentation timestamp in the header of a PES packet
+func pesPTS(payload []byte) (int64, bool) {
+	if len(payload) < 14 || payload[0] != 0 || payload[1] != 0 || payload[2] != 1 || payload[7]&0x80 == 0 {
+		return 0, false
+	}
+	p := payload[9:14]
+	pts := int64(p[0]>>1&0x07)<<30 | int64(p[1])<<22 | int64(p[2]>>1)<<15 | int64(p[3])<<7 | int64(p[4]>>1)
+	return pts, true
+}
+
+// h264Keyframe returns whether the start of a PES packet of an H.264 stream has an SPS
+// or IDR NAL unit, for streams that do not signal random access points
+func h264Keyframe(payload []byte) bool {
+	if len(payload) < 9 {
+		return false
+	}
+	es := payload[9:]
+	if hdrLen := int(payload[8]); hdrLen < len(es) {
+		es = es[hdrLen:]
+	} else {
+		return false
+	}
+	for i := 0; i+3 < len(es); i++ {
+		if es[i] == 0 && es[i+1] == 0 && es[i+2] == 1 {
+			switch es[i+3] & 0x1f {
+			case 5, 7:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mpegCRC32 is the CRC of PSI sections
+func mpegCRC32(data []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// rtpPayload strips the RTP header of a datagram, e.g. of MPEG-TS over RTP or RIST
+func rtpPayload(d []byte) ([]byte, bool) {
+	if len(d) < 12 || d[0]>>6 != 2 {
+		return nil, false
+	}
+	n := 12 + 4*int(d[0]&0x0f)
+	if d[0]&0x10 != 0 {
+		// Header extension
+		if len(d) < n+4 {
+			return nil, false
+		}
+		n += 4 + 4*int(binary.BigEndian.Uint16(d[n+2:]))
+	}
+	end := len(d)
+	if d[0]&0x20 != 0 {
+		end -= int(d[len(d)-1])
+	}
+	if n > end {
+		return nil, false
+	}
+	return d[n:end], true
+}
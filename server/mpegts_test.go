@@ -0,0 +1,301 @@
+package server
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testPMTPID   = 0x1000
+	testVideoPID = 0x100
+	testAudioPID = 0x101
+	testDataPID  = 0x102
+)
+
+// testPSIPacket builds a packet with a PSI section. entries follow the fixed part of the section
+func testPSIPacket(pid uint16, tableID byte, fixed, entries []byte) []byte {
+	section := append([]byte{tableID, 0xb0, 0, 0, 1, 0xc1, 0, 0}, fixed...)
+	section = append(section, entries...)
+	return tsPSIPacket([]byte{tsSyncByte, byte(pid>>8) | 0x40, byte(pid), 0x10}, section)
+}
+
+func testPAT() []byte {
+	return testPSIPacket(0, 0x00, nil, []byte{0, 1, 0xe0 | testPMTPID>>8, testPMTPID & 0xff})
+}
+
+func testPMT() []byte {
+	return testPSIPacket(testPMTPID, 0x02, []byte{0xe0 | testVideoPID>>8, testVideoPID & 0xff, 0xf0, 0}, []byte{
+		0x1b, 0xe0 | testVideoPID>>8, testVideoPID & 0xff, 0xf0, 0,
+		0x0f, 0xe0 | testAudioPID>>8, testAudioPID & 0xff, 0xf0, 0,
+		0x06, 0xe0 | testDataPID>>8, testDataPID & 0xff, 0xf0, 0,
+	})
+}
+
+// testPESPacket builds the first packet of a PES packet with a PTS
+func testPESPacket(pid uint16, pts int64, randomAccess bool) []byte {
+	pkt := make([]byte, tsPacketSize)
+	pkt[0], pkt[1], pkt[2] = tsSyncByte, byte(pid>>8)|0x40, byte(pid)
+	// Adaptation field and payload
+	pkt[3] = 0x30
+	pkt[4] = 1
+	if randomAccess {
+		pkt[5] = 0x40
+	}
+	pes := pkt[6:]
+	copy(pes, []byte{0, 0, 1, 0xe0, 0, 0, 0x80, 0x80, 5})
+	pes[9] = 0x21 | byte(pts>>29&0x0e)
+	pes[10] = byte(pts >> 22)
+	pes[11] = byte(pts>>14) | 1
+	pes[12] = byte(pts >> 7)
+	pes[13] = byte(pts<<1) | 1
+	return pkt
+}
+
+func testDataPacket(pid uint16) []byte {
+	pkt := make([]byte, tsPacketSize)
+	pkt[0], pkt[1], pkt[2], pkt[3] = tsSyncByte, byte(pid>>8), byte(pid), 0x10
+	return pkt
+}
+
+type testSegment struct {
+	data     []byte
+	seqNo    uint64
+	duration float64
+}
+
+// testTS is a stream with a frame every 0.5s, a keyframe every second and the PAT and PMT
+// every keyframe, with audio and data packets
+func testTS(frames int) []byte {
+	var ts []byte
+	for i := 0; i < frames; i++ {
+		keyframe := i%2 == 0
+		if keyframe {
+			ts = append(ts, testPAT()...)
+			ts = append(ts, testPMT()...)
+		}
+		ts = append(ts, testPESPacket(testVideoPID, int64(i)*tsClockRate/2, keyframe)...)
+		ts = append(ts, testDataPacket(testVideoPID)...)
+		ts = append(ts, testDataPacket(testAudioPID)...)
+		ts = append(ts, testDataPacket(testDataPID)...)
+	}
+	return ts
+}
+
+func packetPIDs(data []byte) []uint16 {
+	var pids []uint16
+	for i := 0; i+tsPacketSize <= len(data); i += tsPacketSize {
+		pids = append(pids, binary.BigEndian.Uint16(data[i+1:])&0x1fff)
+	}
+	return pids
+}
+
+func TestTSSegmenter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var segs []testSegment
+	seg := newTSSegmenter(0, 0, 2*time.Second, func(data []byte, seqNo uint64, duration float64) {
+		segs = append(segs, testSegment{data, seqNo, duration})
+	})
+
+	// Data before the PAT and PMT is dropped
+	require.Nil(seg.write(testDataPacket(testVideoPID)))
+	require.Nil(seg.write(testTS(10)))
+	seg.flush()
+
+	// Segments are cut at the first keyframe after 2 seconds
+	require.Len(segs, 3)
+	for i, s := range segs {
+		assert.Equal(uint64(i), s.seqNo)
+		pids := packetPIDs(s.data)
+		assert.Equal([]uint16{0, testPMTPID, testVideoPID}, pids[:3])
+		// The data stream is dropped
+		assert.NotContains(pids, uint16(testDataPID))
+		assert.Contains(pids, uint16(testAudioPID))
+	}
+	assert.Equal(2.0, segs[0].duration)
+	assert.Equal(2.0, segs[1].duration)
+	// The last segment ends with the last frame that was received
+	assert.Equal(0.5, segs[2].duration)
+
+	// The PMT is rewritten with the video and audio streams only
+	pmt := segs[0].data[tsPacketSize : 2*tsPacketSize]
+	sec := psiSection(pmt[4:], 0x02)
+	require.NotNil(sec)
+	assert.Len(sec, 12+2*5)
+	assert.Equal(byte(0x1b), sec[12])
+	assert.Equal(byte(0x0f), sec[17])
+	secLen := 3 + int(binary.BigEndian.Uint16(pmt[6:])&0x0fff)
+	assert.Equal(binary.BigEndian.Uint32(pmt[5+secLen-4:]), mpegCRC32(pmt[5:5+secLen-4]))
+}
+
+func TestTSSegmenter_ConfiguredPIDs(t *testing.T) {
+	assert := assert.New(t)
+
+	var segs []testSegment
+	seg := newTSSegmenter(testVideoPID, testDataPID, time.Second, func(data []byte, seqNo uint64, duration float64) {
+		segs = append(segs, testSegment{data, seqNo, duration})
+	})
+	assert.Nil(seg.write(testTS(4)))
+	seg.flush()
+
+	assert.Len(segs, 2)
+	pids := packetPIDs(segs[0].data)
+	assert.Contains(pids, uint16(testDataPID))
+	assert.NotContains(pids, uint16(testAudioPID))
+}
+
+func TestTSSegmenter_InvalidData(t *testing.T) {
+	assert := assert.New(t)
+	seg := newTSSegmenter(0, 0, time.Second, func([]byte, uint64, float64) {})
+
+	assert.Equal(errTSPacket, seg.write(make([]byte, 100)))
+	assert.Equal(errTSPacket, seg.write(make([]byte, tsPacketSize)))
+	assert.Nil(seg.write(nil))
+}
+
+func TestPESPTS(t *testing.T) {
+	assert := assert.New(t)
+
+	pts, ok := pesPTS(testPESPacket(testVideoPID, 1<<32+12345, true)[6:])
+	assert.True(ok)
+	assert.Equal(int64(1<<32+12345), pts)
+
+	_, ok = pesPTS(make([]byte, 20))
+	assert.False(ok)
+}
+
+func TestH264Keyframe(t *testing.T) {
+	assert := assert.New(t)
+
+	pes := []byte{0, 0, 1, 0xe0, 0, 0, 0x80, 0x80, 5, 0, 0, 0, 0, 0}
+	assert.True(h264Keyframe(append(pes, 0, 0, 0, 1, 0x67)))
+	assert.True(h264Keyframe(append(pes, 0, 0, 1, 0x65)))
+	assert.False(h264Keyframe(append(pes, 0, 0, 1, 0x41)))
+	assert.False(h264Keyframe(pes[:5]))
+}
+
+func TestRTPPayload(t *testing.T) {
+	assert := assert.New(t)
+
+	header := []byte{0x80, 33, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1}
+	payload, ok := rtpPayload(append(header, testDataPacket(testVideoPID)...))
+	assert.True(ok)
+	assert.Equal(testDataPacket(testVideoPID), payload)
+
+	// With a CSRC, a header extension and padding
+	d := []byte{0xb1, 33, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 1, 0, 0, 0, 0}
+	d = append(d, testDataPacket(testVideoPID)...)
+	d = append(d, 0, 0, 3)
+	payload, ok = rtpPayload(d)
+	assert.True(ok)
+	assert.Equal(testDataPacket(testVideoPID), payload)
+
+	_, ok = rtpPayload([]byte{0x47, 0, 0})
+	assert.False(ok)
+	_, ok = rtpPayload(testDataPacket(testVideoPID))
+	assert.False(ok)
+}
+
+const testAudio2PID = 0x103
+
+// testLanguageDescriptor is an ISO 639 language descriptor
+func testLanguageDescriptor(lang string) []byte {
+	return append([]byte{0x0a, 4}, append([]byte(lang), 0)...)
+}
+
+// testMultiAudioPMT is a PMT with two audio streams in different languages and a data stream
+func testMultiAudioPMT() []byte {
+	entries := []byte{0x1b, 0xe0 | testVideoPID>>8, testVideoPID & 0xff, 0xf0, 0}
+	for _, audio := range []struct {
+		pid  uint16
+		lang string
+	}{{testAudioPID, "eng"}, {testAudio2PID, "spa"}} {
+		desc := testLanguageDescriptor(audio.lang)
+		entries = append(entries, 0x0f, 0xe0|byte(audio.pid>>8), byte(audio.pid), 0xf0, byte(len(desc)))
+		entries = append(entries, desc...)
+	}
+	entries = append(entries, 0x06, 0xe0|testDataPID>>8, testDataPID&0xff, 0xf0, 0)
+	return testPSIPacket(testPMTPID, 0x02, []byte{0xe0 | testVideoPID>>8, testVideoPID & 0xff, 0xf0, 0}, entries)
+}
+
+// testMultiAudioTS is a segment with two audio streams
+func testMultiAudioTS() []byte {
+	ts := append(testPAT(), testMultiAudioPMT()...)
+	ts = append(ts, testPESPacket(testVideoPID, 0, true)...)
+	for _, pid := range []uint16{testAudioPID, testAudio2PID, testDataPID, testVideoPID} {
+		ts = append(ts, testDataPacket(pid)...)
+	}
+	return ts
+}
+
+func TestTSSegmenter_MultipleAudioStreams(t *testing.T) {
+	assert := assert.New(t)
+
+	var segs []testSegment
+	seg := newTSSegmenter(0, 0, time.Second, func(data []byte, seqNo uint64, duration float64) {
+		segs = append(segs, testSegment{data, seqNo, duration})
+	})
+	assert.Nil(seg.write(testMultiAudioTS()))
+	seg.flush()
+
+	// Every audio stream is kept
+	assert.Len(segs, 1)
+	pids := packetPIDs(segs[0].data)
+	assert.Contains(pids, uint16(testAudioPID))
+	assert.Contains(pids, uint16(testAudio2PID))
+	assert.NotContains(pids, uint16(testDataPID))
+}
+
+func TestTSProgramStreams(t *testing.T) {
+	assert := assert.New(t)
+
+	streams, err := tsProgramStreams(testMultiAudioTS())
+	assert.Nil(err)
+	var pids []uint16
+	var langs []string
+	for _, st := range streams {
+		pids = append(pids, st.pid)
+		langs = append(langs, st.language())
+	}
+	assert.Equal([]uint16{testVideoPID, testAudioPID, testAudio2PID, testDataPID}, pids)
+	assert.Equal([]string{"", "eng", "spa", ""}, langs)
+
+	// No PMT
+	streams, err = tsProgramStreams(testDataPacket(testVideoPID))
+	assert.Nil(err)
+	assert.Empty(streams)
+
+	_, err = tsProgramStreams([]byte("not ts"))
+	assert.Equal(errTSPacket, err)
+}
+
+func TestTSSelectStreams(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Only the second audio stream, without the PCR of the video stream
+	data, err := tsSelectStreams(testMultiAudioTS(), func(st pmtStream) bool { return st.pid == testAudio2PID })
+	require.Nil(err)
+	assert.Equal([]uint16{0, testPMTPID, testAudio2PID}, packetPIDs(data))
+	streams, err := tsProgramStreams(data)
+	require.Nil(err)
+	require.Len(streams, 1)
+	assert.Equal("spa", streams[0].language())
+	pmt := data[tsPacketSize : 2*tsPacketSize]
+	assert.Equal(uint16(0x1fff), binary.BigEndian.Uint16(pmt[5+8:])&0x1fff)
+	secLen := 3 + int(binary.BigEndian.Uint16(pmt[6:])&0x0fff)
+	assert.Equal(binary.BigEndian.Uint32(pmt[5+secLen-4:]), mpegCRC32(pmt[5:5+secLen-4]))
+
+	// Everything but the second audio stream keeps the PCR
+	data, err = tsSelectStreams(testMultiAudioTS(), func(st pmtStream) bool { return st.pid != testAudio2PID })
+	require.Nil(err)
+	assert.NotContains(packetPIDs(data), uint16(testAudio2PID))
+	assert.Contains(packetPIDs(data), uint16(testAudioPID))
+	pmt = data[tsPacketSize : 2*tsPacketSize]
+	assert.Equal(uint16(testVideoPID), binary.BigEndian.Uint16(pmt[5+8:])&0x1fff)
+}
@@ -0,0 +1,278 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/golang/glog"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+)
+
+// HealthMaxBlockAge is the age of the last block seen by the block watcher above which the node is
+// not ready, as its view of the chain is stale
+var HealthMaxBlockAge = 5 * time.Minute
+
+// How long a check of a dependency of the node may take
+var healthCheckTimeout = 5 * time.Second
+
+// How long the result of the checks is reused, so that frequent probes don't load the dependencies
+var healthCheckCacheTTL = 2 * time.Second
+
+// Prefix of the objects that are listed to check that the object storage is reachable
+const healthStoragePrefix = "healthz/"
+
+// Statuses of the checks of the dependencies of the node
+const (
+	HealthStatusOK      = "ok"
+	HealthStatusFail    = "fail"
+	HealthStatusSkipped = "skipped"
+)
+
+// Names of the checks of the dependencies of the node
+const (
+	HealthCheckDatabase    = "database"
+	HealthCheckEthRPC      = "ethRPC"
+	HealthCheckBlockAge    = "blockAge"
+	HealthCheckStorage     = "storage"
+	HealthCheckTranscoders = "transcoders"
+)
+
+var errNoBlockSeen = errors.New("no block seen yet")
+var errNoTranscoders = errors.New("no transcoders registered")
+
+// HealthCheckResult is the result of the check of a dependency of the node
+type HealthCheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Details of the dependency, e.g. the number of the last seen block
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// HealthReport is the result of the checks of the dependencies of the node. Its status is ok if no
+// check failed
+type HealthReport struct {
+	Status string                        `json:"status"`
+	Checks map[string]*HealthCheckResult `json:"checks"`
+}
+
+// ethHeaderReader reads the headers of blocks from an ETH node
+type ethHeaderReader interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// NodeHealth checks the dependencies of a node for the /healthz and /readyz endpoints: the ETH RPC
+// connectivity, the age of the last block seen, the object storage, the transcoder pool and
+// the database
+type NodeHealth struct {
+	node *core.LivepeerNode
+	// Returns the ETH client that blocks are read with. Nil if the node is off-chain
+	ethBackend func() (ethHeaderReader, error)
+
+	mu        sync.Mutex
+	report    *HealthReport
+	checkedAt time.Time
+}
+
+// NewNodeHealth creates a NodeHealth that checks the dependencies of n
+func NewNodeHealth(n *core.LivepeerNode) *NodeHealth {
+	h := &NodeHealth{node: n}
+	h.ethBackend = func() (ethHeaderReader, error) {
+		if n.Eth == nil {
+			return nil, nil
+		}
+		backend, err := n.Eth.Backend()
+		if err != nil {
+			return nil, err
+		}
+		return backend, nil
+	}
+	return h
+}
+
+// RegisterHandlers adds the /healthz and /readyz endpoints to mux. The errors and details of the
+// checks are only served if detailed is set, so that they are not exposed on public ports
+func (h *NodeHealth) RegisterHandlers(mux *http.ServeMux, detailed bool) {
+	mux.HandleFunc("/healthz", h.handler(false, detailed))
+	mux.HandleFunc("/readyz", h.handler(true, detailed))
+}
+
+// handler serves the report of the checks. A node is live unless its database fails, as
+// restarting it doesn't fix its other dependencies, and ready if none of the checks fail
+func (h *NodeHealth) handler(ready, detailed bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := h.Check()
+
+		status := http.StatusOK
+		if ready && report.Status != HealthStatusOK || report.Checks[HealthCheckDatabase].Status == HealthStatusFail {
+			status = http.StatusServiceUnavailable
+		}
+
+		if !detailed {
+			summary := &HealthReport{Status: report.Status, Checks: make(map[string]*HealthCheckResult)}
+			for name, res := range report.Checks {
+				summary.Checks[name] = &HealthCheckResult{Status: res.Status}
+			}
+			report = summary
+		}
+
+		data, err := json.Marshal(report)
+		if err != nil {
+			glog.Error(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(data)
+	}
+}
+
+// Check checks the dependencies of the node concurrently. The report of the latest check is
+// returned if it was made within healthCheckCacheTTL
+func (h *NodeHealth) Check() *HealthReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.report != nil && time.Since(h.checkedAt) < healthCheckCacheTTL {
+		return h.report
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	checks := map[string]func(context.Context) *HealthCheckResult{
+		HealthCheckDatabase:    h.checkDatabase,
+		HealthCheckEthRPC:      h.checkEthRPC,
+		HealthCheckBlockAge:    h.checkBlockAge,
+		HealthCheckStorage:     h.checkStorage,
+		HealthCheckTranscoders: h.checkTranscoders,
+	}
+	report := &HealthReport{Status: HealthStatusOK, Checks: make(map[string]*HealthCheckResult)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(context.Context) *HealthCheckResult) {
+			defer wg.Done()
+			res := check(ctx)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = res
+			if res.Status == HealthStatusFail {
+				report.Status = HealthStatusFail
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	h.report = report
+	h.checkedAt = time.Now()
+	return report
+}
+
+func (h *NodeHealth) checkDatabase(ctx context.Context) *HealthCheckResult {
+	if h.node.Database == nil {
+		return &HealthCheckResult{Status: HealthStatusSkipped}
+	}
+	return healthResult(h.node.Database.Ping(), nil)
+}
+
+func (h *NodeHealth) checkEthRPC(ctx context.Context) *HealthCheckResult {
+	backend, err := h.ethBackend()
+	if backend == nil && err == nil {
+		return &HealthCheckResult{Status: HealthStatusSkipped}
+	}
+	if err != nil {
+		return healthResult(err, nil)
+	}
+	header, err := backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return healthResult(err, nil)
+	}
+	return healthResult(nil, map[string]interface{}{"latestBlock": header.Number.String()})
+}
+
+func (h *NodeHealth) checkBlockAge(ctx context.Context) *HealthCheckResult {
+	backend, err := h.ethBackend()
+	if backend == nil && err == nil || h.node.Database == nil {
+		return &HealthCheckResult{Status: HealthStatusSkipped}
+	}
+	if err != nil {
+		return healthResult(err, nil)
+	}
+	blk, err := h.node.Database.LastSeenBlock()
+	if err != nil {
+		return healthResult(err, nil)
+	}
+	if blk == nil {
+		return healthResult(errNoBlockSeen, nil)
+	}
+	header, err := backend.HeaderByNumber(ctx, blk)
+	if err != nil {
+		return healthResult(err, nil)
+	}
+	age := time.Since(time.Unix(int64(header.Time), 0)).Round(time.Second)
+	details := map[string]interface{}{"lastSeenBlock": blk.String(), "age": age.String()}
+	if age > HealthMaxBlockAge {
+		return healthResult(errors.New("last seen block is older than "+HealthMaxBlockAge.String()), details)
+	}
+	return healthResult(nil, details)
+}
+
+// checkStorage lists the objects of the object storage under healthStoragePrefix. Storages that
+// can't be listed are not checked
+func (h *NodeHealth) checkStorage(ctx context.Context) *HealthCheckResult {
+	if drivers.NodeStorage == nil {
+		return &HealthCheckResult{Status: HealthStatusSkipped}
+	}
+	if _, ok := drivers.NodeStorage.(*drivers.MemoryOS); ok {
+		return healthResult(nil, nil)
+	}
+	pruner, ok := drivers.StoragePruner(drivers.NodeStorage)
+	if !ok {
+		return &HealthCheckResult{Status: HealthStatusSkipped}
+	}
+	errc := make(chan error, 1)
+	go func() {
+		_, err := pruner.ListData(healthStoragePrefix)
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		return healthResult(err, nil)
+	case <-ctx.Done():
+		return healthResult(ctx.Err(), nil)
+	}
+}
+
+// checkTranscoders checks that an orchestrator that transcodes with remote transcoders has
+// registered transcoders
+func (h *NodeHealth) checkTranscoders(ctx context.Context) *HealthCheckResult {
+	if h.node.NodeType != core.OrchestratorNode || h.node.TranscoderManager == nil {
+		return &HealthCheckResult{Status: HealthStatusSkipped}
+	}
+	transcoders := h.node.TranscoderManager.RegisteredTranscodersInfo()
+	capacity := 0
+	for _, t := range transcoders {
+		capacity += t.Capacity
+	}
+	details := map[string]interface{}{"registered": len(transcoders), "capacity": capacity}
+	if len(transcoders) == 0 {
+		return healthResult(errNoTranscoders, details)
+	}
+	return healthResult(nil, details)
+}
+
+func healthResult(err error, details map[string]interface{}) *HealthCheckResult {
+	if err != nil {
+		return &HealthCheckResult{Status: HealthStatusFail, Error: err.Error(), Details: details}
+	}
+	return &HealthCheckResult{Status: HealthStatusOK, Details: details}
+}
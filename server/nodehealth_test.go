@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/eth/blockwatch"
+)
+
+type stubHeaderReader struct {
+	latest *big.Int
+	// Timestamps of the blocks by number
+	times map[int64]time.Time
+	err   error
+}
+
+func (r *stubHeaderReader) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if number == nil {
+		number = r.latest
+	}
+	return &types.Header{Number: number, Time: uint64(r.times[number.Int64()].Unix())}, nil
+}
+
+func newHealthTestNode(t *testing.T, nodeType core.NodeType) (*core.LivepeerNode, func()) {
+	dir, err := ioutil.TempDir("", "nodehealth")
+	require.Nil(t, err)
+	dbh, err := common.InitDB(filepath.Join(dir, "lp.sqlite3"))
+	require.Nil(t, err)
+	n, err := core.NewLivepeerNode(nil, dir, dbh)
+	require.Nil(t, err)
+	n.NodeType = nodeType
+	return n, func() {
+		dbh.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestNodeHealth_OffchainBroadcaster(t *testing.T) {
+	assert := assert.New(t)
+	n, cleanup := newHealthTestNode(t, core.BroadcasterNode)
+	defer cleanup()
+
+	report := NewNodeHealth(n).Check()
+	assert.Equal(HealthStatusOK, report.Status)
+	assert.Equal(HealthStatusOK, report.Checks[HealthCheckDatabase].Status)
+	assert.Equal(HealthStatusSkipped, report.Checks[HealthCheckEthRPC].Status)
+	assert.Equal(HealthStatusSkipped, report.Checks[HealthCheckBlockAge].Status)
+	assert.Equal(HealthStatusSkipped, report.Checks[HealthCheckTranscoders].Status)
+}
+
+func TestNodeHealth_Eth(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	n, cleanup := newHealthTestNode(t, core.BroadcasterNode)
+	defer cleanup()
+
+	now := time.Now()
+	reader := &stubHeaderReader{latest: big.NewInt(10), times: map[int64]time.Time{10: now, 5: now.Add(-time.Hour)}}
+	h := NewNodeHealth(n)
+	h.ethBackend = func() (ethHeaderReader, error) { return reader, nil }
+
+	// No block seen yet
+	report := h.Check()
+	assert.Equal(HealthStatusFail, report.Status)
+	assert.Equal(HealthStatusOK, report.Checks[HealthCheckEthRPC].Status)
+	assert.Equal("10", report.Checks[HealthCheckEthRPC].Details["latestBlock"])
+	assert.Equal(HealthStatusFail, report.Checks[HealthCheckBlockAge].Status)
+	assert.Equal(errNoBlockSeen.Error(), report.Checks[HealthCheckBlockAge].Error)
+
+	// The last seen block is stale
+	require.Nil(n.Database.InsertMiniHeader(&blockwatch.MiniHeader{Number: big.NewInt(5), Hash: ethcommon.HexToHash("0x05")}))
+	h.checkedAt = time.Time{}
+	report = h.Check()
+	assert.Equal(HealthStatusFail, report.Checks[HealthCheckBlockAge].Status)
+	assert.Equal("5", report.Checks[HealthCheckBlockAge].Details["lastSeenBlock"])
+
+	require.Nil(n.Database.InsertMiniHeader(&blockwatch.MiniHeader{Number: big.NewInt(10), Hash: ethcommon.HexToHash("0x10")}))
+	h.checkedAt = time.Time{}
+	report = h.Check()
+	assert.Equal(HealthStatusOK, report.Status)
+	assert.Equal(HealthStatusOK, report.Checks[HealthCheckBlockAge].Status)
+
+	// The report is cached
+	reader.err = errors.New("connection refused")
+	assert.Equal(HealthStatusOK, h.Check().Status)
+
+	h.checkedAt = time.Time{}
+	report = h.Check()
+	assert.Equal(HealthStatusFail, report.Checks[HealthCheckEthRPC].Status)
+	assert.Equal("connection refused", report.Checks[HealthCheckEthRPC].Error)
+}
+
+func TestNodeHealth_Transcoders(t *testing.T) {
+	assert := assert.New(t)
+	n, cleanup := newHealthTestNode(t, core.OrchestratorNode)
+	defer cleanup()
+	n.TranscoderManager = core.NewRemoteTranscoderManager()
+
+	h := NewNodeHealth(n)
+	report := h.Check()
+	assert.Equal(HealthStatusFail, report.Checks[HealthCheckTranscoders].Status)
+	assert.Equal(errNoTranscoders.Error(), report.Checks[HealthCheckTranscoders].Error)
+
+	strm := &common.StubServerStream{}
+	go n.TranscoderManager.Manage(strm, 5, "", nil, ethcommon.Address{})
+	time.Sleep(10 * time.Millisecond)
+	h.checkedAt = time.Time{}
+	report = h.Check()
+	assert.Equal(HealthStatusOK, report.Checks[HealthCheckTranscoders].Status)
+	assert.Equal(1, report.Checks[HealthCheckTranscoders].Details["registered"])
+	assert.Equal(5, report.Checks[HealthCheckTranscoders].Details["capacity"])
+}
+
+func TestNodeHealth_Handlers(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	n, cleanup := newHealthTestNode(t, core.OrchestratorNode)
+	defer cleanup()
+	n.TranscoderManager = core.NewRemoteTranscoderManager()
+
+	h := NewNodeHealth(n)
+	public, cli := http.NewServeMux(), http.NewServeMux()
+	h.RegisterHandlers(public, false)
+	h.RegisterHandlers(cli, true)
+
+	get := func(mux *http.ServeMux, path string) (int, *HealthReport) {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		var report HealthReport
+		require.Nil(json.Unmarshal(w.Body.Bytes(), &report))
+		return w.Code, &report
+	}
+
+	// A node without transcoders is live but not ready
+	code, report := get(cli, "/healthz")
+	assert.Equal(http.StatusOK, code)
+	assert.Equal(HealthStatusFail, report.Status)
+	code, report = get(cli, "/readyz")
+	assert.Equal(http.StatusServiceUnavailable, code)
+	assert.Equal(errNoTranscoders.Error(), report.Checks[HealthCheckTranscoders].Error)
+
+	// Errors and details are not served on public ports
+	code, report = get(public, "/readyz")
+	assert.Equal(http.StatusServiceUnavailable, code)
+	assert.Equal(HealthStatusFail, report.Checks[HealthCheckTranscoders].Status)
+	assert.Empty(report.Checks[HealthCheckTranscoders].Error)
+	assert.Nil(report.Checks[HealthCheckTranscoders].Details)
+
+	// A node whose database fails is not live
+	n.Database.Close()
+	h.checkedAt = time.Time{}
+	code, report = get(cli, "/healthz")
+	assert.Equal(http.StatusServiceUnavailable, code)
+	assert.Equal(HealthStatusFail, report.Checks[HealthCheckDatabase].Status)
+}
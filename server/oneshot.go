@@ -0,0 +1,383 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/golang/glog"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+)
+
+// oneShotOrchestrators is the number of orchestrators that a one-shot job is tried with
+const oneShotOrchestrators = 3
+
+// renditionHeader is the name of the profile of a rendition returned by a one-shot job
+const renditionHeader = "Rendition-Name"
+
+var errOneShotInput = errors.New("one-shot jobs require an http or https source URL or the source segment")
+
+// oneShotRequest is a one-shot job whose source is downloaded from a URL. Jobs that upload their
+// source segment pass the options in the query string instead
+type oneShotRequest struct {
+	URL      string               `json:"url"`
+	Presets  []string             `json:"presets"`
+	Profiles []common.JSONProfile `json:"profiles"`
+}
+
+// oneShotBalanceID is the balance that the one-shot jobs between a broadcaster and an orchestrator
+// are paid from, keyed by the sender on orchestrators and by the orchestrator on broadcasters. The
+// credit left by a job is used by the next one instead of being tied to a stream
+func oneShotBalanceID(key string) core.ManifestID {
+	return core.ManifestID("oneshot-" + key)
+}
+
+// ServeOneShot transcodes a single segment that is paid for with the request, and returns the
+// renditions in the response. Unlike segments of streams, no transcode loop or session is started
+// for the job
+func (h *lphttp) ServeOneShot(w http.ResponseWriter, r *http.Request) {
+	orch := h.orchestrator
+
+	payment, err := getPayment(r.Header.Get(paymentHeader))
+	if err != nil {
+		glog.Error("Could not parse payment")
+		http.Error(w, err.Error(), http.StatusPaymentRequired)
+		return
+	}
+	if err := validateStrictPayment(payment); err != nil {
+		glog.Error("Rejecting payment: ", err)
+		http.Error(w, err.Error(), http.StatusPaymentRequired)
+		return
+	}
+
+	sender := getPaymentSender(payment)
+	md, err := verifySegCreds(orch, r.Header.Get(segmentHeader), sender)
+	if err != nil {
+		glog.Error("Could not verify one-shot job creds")
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	balanceID := oneShotBalanceID(sender.Hex())
+	if _, ok := processPayment(orch, w, payment, balanceID); !ok {
+		return
+	}
+	if !orch.SufficientBalance(balanceID) {
+		glog.Errorf("Insufficient credit balance for one-shot job manifestID=%s sender=%s", md.ManifestID, sender.Hex())
+		http.Error(w, "Insufficient balance", http.StatusBadRequest)
+		return
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		glog.Error("Could not read request body: ", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !bytes.Equal(crypto.Keccak256(data), md.Hash.Bytes()) {
+		glog.Error("Mismatched hash for body; rejecting")
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	res, err := orch.TranscodeOneShot(md, &stream.HLSSegment{SeqNo: uint64(md.Seq), Data: data})
+	if err != nil {
+		glog.Errorf("Could not transcode one-shot job manifestID=%s err=%v", md.ManifestID, err)
+		code := http.StatusInternalServerError
+		if err == core.ErrOrchCap {
+			code = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	var pixels int64
+	for _, seg := range res.TranscodeData.Segments {
+		pixels += seg.Pixels
+	}
+	orch.DebitFees(balanceID, payment.GetExpectedPrice(), pixels)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for i, seg := range res.TranscodeData.Segments {
+		fw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":   {"video/MP2T"},
+			"Content-Length": {strconv.Itoa(len(seg.Data))},
+			"Pixels":         {strconv.FormatInt(seg.Pixels, 10)},
+			renditionHeader:  {md.Profiles[i].Name},
+		})
+		if err != nil {
+			glog.Error("Could not create multipart part ", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		fw.Write(seg.Data)
+	}
+	mw.Close()
+
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
+
+// SubmitOneShot sends a one-shot job to the orchestrator of a session and returns the renditions
+// of the segment
+func SubmitOneShot(sess *BroadcastSession, seg *stream.HLSSegment) (*core.TranscodeData, error) {
+	segCreds, err := genSegCreds(sess, seg)
+	if err != nil {
+		return nil, err
+	}
+
+	balUpdate, err := newBalanceUpdate(sess)
+	if err != nil {
+		return nil, err
+	}
+	defer completeBalanceUpdate(sess, balUpdate)
+
+	payment, err := genPayment(sess, balUpdate.NumTickets)
+	if err != nil {
+		glog.Errorf("Could not create payment: %v", err)
+		return nil, err
+	}
+
+	ti := sess.OrchestratorInfo
+	req, err := http.NewRequest("POST", ti.Transcoder+"/oneshot", bytes.NewReader(seg.Data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(segmentHeader, segCreds)
+	req.Header.Set(paymentHeader, payment)
+	req.Header.Set("Content-Type", "video/MP2T")
+
+	glog.V(common.DEBUG).Infof("Submitting one-shot job manifestID=%s orch=%s bytes=%d", sess.ManifestID, ti.Transcoder, len(seg.Data))
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// The payment was submitted with the job
+	balUpdate.Status = CreditSpent
+	if header := resp.Header.Get(paymentResultHeader); header != "" {
+		if err := applyPaymentResult(balUpdate, header, resp.StatusCode); err != nil {
+			glog.Errorf("Unable to apply payment result for one-shot job manifestID=%s: %v", sess.ManifestID, err)
+		}
+	}
+	if header := resp.Header.Get(reclaimedCreditHeader); header != "" {
+		if err := applyReclaimedCredit(balUpdate, header); err != nil {
+			glog.Errorf("Unable to apply reclaimed credit for one-shot job manifestID=%s: %v", sess.ManifestID, err)
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return nil, errors.New(strings.TrimSpace(string(data)))
+	}
+
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		return nil, fmt.Errorf("unexpected one-shot response content type %q", resp.Header.Get("Content-Type"))
+	}
+	tdata := &core.TranscodeData{}
+	var pixels int64
+	mr := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(p)
+		if err != nil {
+			return nil, err
+		}
+		segPixels, err := strconv.ParseInt(p.Header.Get("Pixels"), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		pixels += segPixels
+		tdata.Segments = append(tdata.Segments, &core.TranscodedSegmentData{Data: data, Pixels: segPixels})
+	}
+	if len(tdata.Segments) != len(sess.Profiles) {
+		return nil, fmt.Errorf("MismatchedSegments")
+	}
+
+	// The change of the update is the difference between its credit and the fees of the job
+	balUpdate.Status = ReceivedChange
+	if priceInfo := ti.PriceInfo; priceInfo != nil {
+		balUpdate.Debit.Mul(new(big.Rat).SetInt64(pixels), big.NewRat(priceInfo.PricePerUnit, priceInfo.PixelsPerUnit))
+	}
+
+	glog.Infof("Successfully transcoded one-shot job manifestID=%s orch=%s", sess.ManifestID, ti.Transcoder)
+	return tdata, nil
+}
+
+// oneShotSessions returns the sessions that a one-shot job can be sent to. The sessions are not
+// kept once the job is done, apart from the balance that they share with the next jobs sent to
+// the same orchestrators
+func oneShotSessions(n *core.LivepeerNode, mid core.ManifestID, profiles []ffmpeg.VideoProfile, encoders common.ProfileEncoders) ([]*BroadcastSession, error) {
+	if n.OrchestratorPool == nil {
+		return nil, errDiscovery
+	}
+	tinfos, err := n.OrchestratorPool.GetOrchestrators(oneShotOrchestrators)
+	if len(tinfos) == 0 {
+		if err == nil {
+			err = errNoOrchs
+		}
+		return nil, err
+	}
+
+	rpcBcast := core.NewBroadcaster(n)
+	var sessions []*BroadcastSession
+	for _, tinfo := range tinfos {
+		if !usableOrchestrator(n.OrchHealth, tinfo.Transcoder) || (n.OrchLists != nil && !n.OrchLists.Allowed(tinfo)) {
+			continue
+		}
+		if !core.HasCapabilities(tinfo.Capabilities, core.RequiredCapabilities(encoders)) {
+			continue
+		}
+		sess := &BroadcastSession{
+			Broadcaster:      rpcBcast,
+			ManifestID:       mid,
+			Profiles:         profiles,
+			Encoders:         encoders,
+			OrchestratorInfo: tinfo,
+			Sender:           n.Sender,
+		}
+		if n.Sender != nil && tinfo.TicketParams != nil {
+			// The PM session is not persisted since the job isn't resumed
+			sess.PMSessionID = n.Sender.StartSession(*pmTicketParams(tinfo.TicketParams))
+		}
+		if n.Balances != nil {
+			sess.Balance = core.NewBalance(oneShotBalanceID(tinfo.Transcoder), n.Balances)
+		}
+		sessions = append(sessions, sess)
+	}
+	if len(sessions) == 0 {
+		return nil, errNoOrchs
+	}
+	return sessions, nil
+}
+
+// HandleOneShot transcodes a single segment without a stream. The job is either the segment itself
+// with the options in the query string, or a JSON request with the URL of the segment. The
+// renditions are returned synchronously as the parts of a multipart/mixed response
+func (s *LivepeerServer) HandleOneShot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Jobs are authorized like the streams that are pushed to the node
+	if _, err := authenticateStream(r.URL); err != nil {
+		glog.Errorf("Authentication denied for one-shot job url=%s err=%v", r.URL, err)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req oneShotRequest
+	var data []byte
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid one-shot job: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := validateSourceURL(req.URL, "http", "https"); err == errSourceScheme {
+			http.Error(w, errOneShotInput.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if data, err = drivers.GetSegmentData(req.URL); err != nil {
+			http.Error(w, fmt.Sprintf("could not download source: %v", err), http.StatusBadRequest)
+			return
+		}
+	} else {
+		if presets := r.URL.Query().Get("presets"); presets != "" {
+			req.Presets = strings.Split(presets, ",")
+		}
+		if data, err = ioutil.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if len(data) == 0 {
+		http.Error(w, errOneShotInput.Error(), http.StatusBadRequest)
+		return
+	}
+
+	profiles, encoders := BroadcastJobVideoProfiles, BroadcastJobEncoders
+	if len(req.Presets) > 0 || len(req.Profiles) > 0 {
+		profiles, encoders = parsePresets(req.Presets), nil
+	}
+	if len(req.Profiles) > 0 {
+		custom, customEncoders, err := common.JSONProfilesToFFmpegProfiles(req.Profiles)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		profiles, encoders = append(profiles, custom...), customEncoders
+	}
+	if len(profiles) == 0 {
+		http.Error(w, "no transcoding profiles", http.StatusBadRequest)
+		return
+	}
+
+	// The ManifestID only identifies the job to the orchestrator
+	mid := core.RandomManifestID()
+	sessions, err := oneShotSessions(s.LivepeerNode, mid, profiles, encoders)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	seg := &stream.HLSSegment{Data: data}
+	var tdata *core.TranscodeData
+	for _, sess := range sessions {
+		if tdata, err = SubmitOneShot(sess, seg); err == nil {
+			break
+		}
+		glog.Errorf("Error submitting one-shot job manifestID=%s orch=%s: %v", mid, sess.OrchestratorInfo.Transcoder, err)
+	}
+	if tdata == nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	w.WriteHeader(http.StatusOK)
+	for i, seg := range tdata.Segments {
+		fw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":   {"video/MP2T"},
+			"Content-Length": {strconv.Itoa(len(seg.Data))},
+			renditionHeader:  {profiles[i].Name},
+		})
+		if err != nil {
+			glog.Errorf("Could not write rendition of one-shot job manifestID=%s: %v", mid, err)
+			return
+		}
+		fw.Write(seg.Data)
+	}
+	mw.Close()
+}
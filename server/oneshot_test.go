@@ -0,0 +1,252 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+// readRenditions returns the renditions of a one-shot response by their name
+func readRenditions(t *testing.T, resp *http.Response) map[string][]byte {
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	require.Nil(t, err)
+	require.Equal(t, "multipart/mixed", mediaType)
+	renditions := make(map[string][]byte)
+	mr := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		data, err := ioutil.ReadAll(p)
+		require.Nil(t, err)
+		renditions[p.Header.Get(renditionHeader)] = data
+	}
+	return renditions
+}
+
+func TestServeOneShot(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	orch := &mockOrchestrator{}
+	lp := lphttp{orchestrator: orch}
+	handler := http.HandlerFunc(lp.ServeOneShot)
+	orch.On("VerifySig", mock.Anything, mock.Anything, mock.Anything).Return(true)
+
+	s := &BroadcastSession{
+		Broadcaster: stubBroadcaster2(),
+		ManifestID:  core.RandomManifestID(),
+		Profiles:    []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, ffmpeg.P240p30fps16x9},
+	}
+	seg := &stream.HLSSegment{Data: []byte("foo")}
+	creds, err := genSegCreds(s, seg)
+	require.Nil(err)
+	md, err := verifySegCreds(orch, creds, s.Broadcaster.Address())
+	require.Nil(err)
+
+	price := &net.PriceInfo{PricePerUnit: 1, PixelsPerUnit: 1}
+	payment := net.Payment{Sender: s.Broadcaster.Address().Bytes(), ExpectedPrice: price}
+	data, err := proto.Marshal(&payment)
+	require.Nil(err)
+	headers := map[string]string{
+		paymentHeader: base64.StdEncoding.EncodeToString(data),
+		segmentHeader: creds,
+	}
+
+	// Jobs are paid from the balance of the sender instead of the balance of a stream
+	balanceID := oneShotBalanceID(s.Broadcaster.Address().Hex())
+	orch.On("ProcessPayment", mock.Anything, balanceID).Return(nil)
+	orch.On("SufficientBalance", balanceID).Return(false).Once()
+	resp := httpPostResp(handler, bytes.NewReader(seg.Data), headers)
+	resp.Body.Close()
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	orch.AssertNotCalled(t, "TranscodeOneShot", mock.Anything, mock.Anything)
+
+	// The source segment must match the creds
+	orch.On("SufficientBalance", balanceID).Return(true)
+	resp = httpPostResp(handler, strings.NewReader("bar"), headers)
+	resp.Body.Close()
+	assert.Equal(http.StatusForbidden, resp.StatusCode)
+
+	orch.On("TranscodeOneShot", md, seg).Return(nil, core.ErrOrchCap).Once()
+	resp = httpPostResp(handler, bytes.NewReader(seg.Data), headers)
+	resp.Body.Close()
+	assert.Equal(http.StatusServiceUnavailable, resp.StatusCode)
+
+	// The renditions are returned with the response
+	tRes := &core.TranscodeResult{
+		TranscodeData: &core.TranscodeData{Segments: []*core.TranscodedSegmentData{
+			{Data: []byte("foo"), Pixels: 100},
+			{Data: []byte("bar"), Pixels: 200},
+		}},
+	}
+	orch.On("TranscodeOneShot", md, seg).Return(tRes, nil)
+	orch.On("DebitFees", balanceID, mock.Anything, int64(300))
+	resp = httpPostResp(handler, bytes.NewReader(seg.Data), headers)
+	defer resp.Body.Close()
+	require.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal(map[string][]byte{
+		md.Profiles[0].Name: []byte("foo"),
+		md.Profiles[1].Name: []byte("bar"),
+	}, readRenditions(t, resp))
+	orch.AssertCalled(t, "DebitFees", balanceID, mock.Anything, int64(300))
+}
+
+func TestSubmitOneShot(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	var respond func(w http.ResponseWriter, r *http.Request)
+	mux.HandleFunc("/oneshot", func(w http.ResponseWriter, r *http.Request) {
+		assert.NotEmpty(r.Header.Get(segmentHeader))
+		respond(w, r)
+	})
+
+	sess := &BroadcastSession{
+		Broadcaster:      stubBroadcaster2(),
+		ManifestID:       core.RandomManifestID(),
+		Profiles:         []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9},
+		OrchestratorInfo: &net.OrchestratorInfo{Transcoder: ts.URL},
+	}
+	seg := &stream.HLSSegment{Data: []byte("foo")}
+
+	respond = func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Insufficient balance", http.StatusBadRequest)
+	}
+	_, err := SubmitOneShot(sess, seg)
+	assert.EqualError(err, "Insufficient balance")
+
+	var renditions int
+	respond = func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.Nil(err)
+		assert.Equal(seg.Data, body)
+		mw := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+		for i := 0; i < renditions; i++ {
+			fw, err := mw.CreatePart(map[string][]string{"Pixels": {"100"}})
+			require.Nil(err)
+			fw.Write([]byte("bar"))
+		}
+		mw.Close()
+	}
+	_, err = SubmitOneShot(sess, seg)
+	assert.EqualError(err, "MismatchedSegments")
+
+	renditions = 1
+	tdata, err := SubmitOneShot(sess, seg)
+	require.Nil(err)
+	require.Len(tdata.Segments, 1)
+	assert.Equal([]byte("bar"), tdata.Segments[0].Data)
+	assert.Equal(int64(100), tdata.Segments[0].Pixels)
+}
+
+func TestHandleOneShot(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	oldStorage := drivers.NodeStorage
+	defer func() { drivers.NodeStorage = oldStorage }()
+	s := setupServer()
+	oldPool := s.LivepeerNode.OrchestratorPool
+	defer func() { s.LivepeerNode.OrchestratorPool = oldPool }()
+	oldWebhook := AuthWebhookURL
+	defer func() { AuthWebhookURL = oldWebhook }()
+	AuthWebhookURL = ""
+
+	submit := func(url, contentType, body string) *http.Response {
+		req := httptest.NewRequest("POST", url, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		s.HandleOneShot(w, req)
+		return w.Result()
+	}
+
+	resp := submit("/oneshot", "video/mp2t", "")
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	// Local files are not read on behalf of the caller
+	resp = submit("/oneshot", "application/json", `{"url":"file:///etc/passwd"}`)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	resp = submit("/oneshot?presets=foo", "video/mp2t", "foo")
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	failing, failingMux := stubTLSServer()
+	defer failing.Close()
+	failingMux.HandleFunc("/oneshot", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "OrchestratorCapped", http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("/oneshot", func(w http.ResponseWriter, r *http.Request) {
+		orch := &mockOrchestrator{}
+		orch.On("VerifySig", mock.Anything, mock.Anything, mock.Anything).Return(true)
+		segData, err := verifySegCreds(orch, r.Header.Get(segmentHeader), core.NewBroadcaster(s.LivepeerNode).Address())
+		require.Nil(err)
+		mw := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+		for _, p := range segData.Profiles {
+			fw, err := mw.CreatePart(map[string][]string{"Pixels": {"100"}})
+			require.Nil(err)
+			fw.Write([]byte(p.Name))
+		}
+		mw.Close()
+	})
+
+	// No orchestrator
+	s.LivepeerNode.OrchestratorPool = &stubDiscovery{}
+	resp = submit("/oneshot?presets=P144p30fps16x9", "video/mp2t", "foo")
+	assert.Equal(http.StatusServiceUnavailable, resp.StatusCode)
+
+	// The job is sent to the next orchestrator when one fails
+	s.LivepeerNode.OrchestratorPool = &stubDiscovery{infos: []*net.OrchestratorInfo{{Transcoder: failing.URL}, {Transcoder: ts.URL}}}
+	resp = submit("/oneshot?presets=P144p30fps16x9,P240p30fps16x9", "video/mp2t", "foo")
+	defer resp.Body.Close()
+	require.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal(map[string][]byte{
+		"P144p30fps16x9": []byte("P144p30fps16x9"),
+		"P240p30fps16x9": []byte("P240p30fps16x9"),
+	}, readRenditions(t, resp))
+
+	s.LivepeerNode.OrchestratorPool = &stubDiscovery{infos: []*net.OrchestratorInfo{{Transcoder: failing.URL}}}
+	resp = submit("/oneshot?presets=P144p30fps16x9", "video/mp2t", "foo")
+	body, err := ioutil.ReadAll(resp.Body)
+	require.Nil(err)
+	assert.Equal(http.StatusBadGateway, resp.StatusCode)
+	assert.Equal("OrchestratorCapped", strings.TrimSpace(string(body)))
+}
+
+func TestTranscodeOneShot_Capacity(t *testing.T) {
+	assert := assert.New(t)
+
+	oldStorage := drivers.NodeStorage
+	defer func() { drivers.NodeStorage = oldStorage }()
+	drivers.NodeStorage = nil
+
+	n, _ := core.NewLivepeerNode(nil, "", nil)
+	orch := core.NewOrchestrator(n)
+	_, err := orch.TranscodeOneShot(&core.SegTranscodingMetadata{ManifestID: core.RandomManifestID()}, &stream.HLSSegment{})
+	assert.Equal(errors.New("Missing local storage"), err)
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	gonet "net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/monitor"
+)
+
+// Key of the kv table that the pins learned on first use are persisted under
+const orchCertPinsKey = "orchCertPins"
+
+// OrchCertPins are the certificate fingerprints that a broadcaster requires orchestrators to
+// present, so that the segments and payments sent to known orchestrators can't be intercepted.
+// Nil if the certificates of orchestrators are not pinned
+var OrchCertPins *OrchCertPinStore
+
+// OrchCertPin is the certificate fingerprint pinned for an orchestrator
+type OrchCertPin struct {
+	Addr        string `json:"addr"`
+	Fingerprint string `json:"fingerprint"`
+	// Set if the pin was learned on first use instead of configured
+	Learned bool `json:"learned"`
+}
+
+// OrchCertPinStore keeps the certificate fingerprints pinned for orchestrators by their host:port
+// address. The pins are either configured or, if trust on first use is enabled, learned from the
+// first connection to an orchestrator and persisted to the database
+type OrchCertPinStore struct {
+	db   *common.DB
+	tofu bool
+
+	mu         sync.Mutex
+	configured map[string]string
+	learned    map[string]string
+}
+
+// NewOrchCertPinStore creates an OrchCertPinStore with the pins in the format addr=fingerprint.
+// If tofu is set, the pins of the other orchestrators are learned on first use and the pins
+// learned before the node restarted are loaded from db
+func NewOrchCertPinStore(pins []string, tofu bool, db *common.DB) (*OrchCertPinStore, error) {
+	s := &OrchCertPinStore{
+		db:         db,
+		tofu:       tofu,
+		configured: make(map[string]string),
+		learned:    make(map[string]string),
+	}
+	for _, p := range pins {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%v: invalid orchestrator pin %q, expected addr=fingerprint", ErrCertPin, p)
+		}
+		fp, err := ParseCertPin(kv[1])
+		if err != nil {
+			return nil, err
+		}
+		s.configured[pinAddr(kv[0])] = fp
+	}
+	if tofu && db != nil {
+		data, err := db.KV(orchCertPinsKey)
+		if err != nil {
+			return nil, err
+		}
+		if data != "" {
+			if err := json.Unmarshal([]byte(data), &s.learned); err != nil {
+				return nil, fmt.Errorf("invalid %v: %v", orchCertPinsKey, err)
+			}
+		}
+	}
+	return s, nil
+}
+
+// pinAddr normalizes the address of an orchestrator to host:port
+func pinAddr(addr string) string {
+	addr = strings.TrimPrefix(strings.TrimPrefix(addr, "https://"), "http://")
+	addr = strings.TrimSuffix(addr, "/")
+	if _, _, err := gonet.SplitHostPort(addr); err != nil {
+		return gonet.JoinHostPort(addr, "443")
+	}
+	return addr
+}
+
+// Verify checks that the certificate presented by the orchestrator at addr matches its pin. If the
+// orchestrator has no pin and trust on first use is enabled, its certificate is pinned
+func (s *OrchCertPinStore) Verify(addr string, state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("%v: no certificate presented by orchestrator %v", ErrCertPin, addr)
+	}
+	addr = pinAddr(addr)
+	fp := CertFingerprint(state.PeerCertificates[0])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pin, ok := s.configured[addr]
+	if !ok {
+		pin, ok = s.learned[addr]
+	}
+	if !ok {
+		if !s.tofu {
+			return nil
+		}
+		s.learned[addr] = fp
+		if err := s.storeLearned(); err != nil {
+			glog.Errorf("Error persisting the certificate pin of orchestrator=%v err=%v", addr, err)
+		}
+		glog.Infof("Pinned the certificate of orchestrator=%v fingerprint=%v", addr, fp)
+		return nil
+	}
+	if fp != pin {
+		glog.Errorf("Certificate of orchestrator=%v changed, possible interception of its traffic fingerprint=%v pinned=%v", addr, fp, pin)
+		if monitor.Enabled {
+			monitor.OrchCertPinMismatch()
+		}
+		return fmt.Errorf("%v: certificate fingerprint %v of orchestrator %v does not match", ErrCertPin, fp, addr)
+	}
+	return nil
+}
+
+// Reset removes the pin learned for the orchestrator at addr, so that the certificate that it
+// presents next is pinned, e.g. after it rotated its key. Configured pins can't be reset
+func (s *OrchCertPinStore) Reset(addr string) error {
+	addr = pinAddr(addr)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.configured[addr]; ok {
+		return fmt.Errorf("the pin of orchestrator %v is configured with -orchCertPins", addr)
+	}
+	if _, ok := s.learned[addr]; !ok {
+		return fmt.Errorf("no pin learned for orchestrator %v", addr)
+	}
+	delete(s.learned, addr)
+	glog.Infof("Reset the certificate pin of orchestrator=%v", addr)
+	return s.storeLearned()
+}
+
+// Pins returns the pins of the orchestrators sorted by address
+func (s *OrchCertPinStore) Pins() []OrchCertPin {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pins := make([]OrchCertPin, 0, len(s.configured)+len(s.learned))
+	for addr, fp := range s.configured {
+		pins = append(pins, OrchCertPin{Addr: addr, Fingerprint: fp})
+	}
+	for addr, fp := range s.learned {
+		if _, ok := s.configured[addr]; !ok {
+			pins = append(pins, OrchCertPin{Addr: addr, Fingerprint: fp, Learned: true})
+		}
+	}
+	sort.Slice(pins, func(i, j int) bool { return pins[i].Addr < pins[j].Addr })
+	return pins
+}
+
+func (s *OrchCertPinStore) storeLearned() error {
+	if s.db == nil {
+		return nil
+	}
+	data, err := json.Marshal(s.learned)
+	if err != nil {
+		return err
+	}
+	return s.db.StoreKV(orchCertPinsKey, string(data))
+}
+
+// dialOrchTLS dials an orchestrator for the segment HTTP client and checks its certificate pin
+func dialOrchTLS(network, addr string, cfg *tls.Config) (gonet.Conn, error) {
+	conn, err := tls.Dial(network, addr, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if pins := OrchCertPins; pins != nil {
+		if err := pins.Verify(addr, conn.ConnectionState()); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// orchPinCredentials are the credentials of the gRPC connections to orchestrators, which check the
+// certificate pins of the orchestrators after the TLS handshake
+type orchPinCredentials struct {
+	credentials.TransportCredentials
+}
+
+func (c orchPinCredentials) ClientHandshake(ctx context.Context, authority string, rawConn gonet.Conn) (gonet.Conn, credentials.AuthInfo, error) {
+	conn, info, err := c.TransportCredentials.ClientHandshake(ctx, authority, rawConn)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pins := OrchCertPins; pins != nil {
+		tlsInfo, ok := info.(credentials.TLSInfo)
+		if !ok {
+			conn.Close()
+			return nil, nil, fmt.Errorf("%v: no TLS connection to orchestrator %v", ErrCertPin, authority)
+		}
+		if err := pins.Verify(authority, tlsInfo.State); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+	return conn, info, nil
+}
+
+func (c orchPinCredentials) Clone() credentials.TransportCredentials {
+	return orchPinCredentials{c.TransportCredentials.Clone()}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/common"
+)
+
+func newPinTestState(t *testing.T) tls.ConnectionState {
+	key, _, err := genKey()
+	require.Nil(t, err)
+	der, err := genCert("localhost", key)
+	require.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+	return tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+}
+
+func TestOrchCertPinStore_Configured(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	state := newPinTestState(t)
+	fp := CertFingerprint(state.PeerCertificates[0])
+	s, err := NewOrchCertPinStore([]string{"https://orch.example.com:8935=" + strings.ToUpper(fp)}, false, nil)
+	require.Nil(err)
+
+	assert.Nil(s.Verify("orch.example.com:8935", state))
+	err = s.Verify("orch.example.com:8935", newPinTestState(t))
+	assert.Contains(err.Error(), ErrCertPin.Error())
+	assert.Error(s.Verify("orch.example.com:8935", tls.ConnectionState{}))
+
+	// Orchestrators without pins are not checked without trust on first use
+	assert.Nil(s.Verify("other.example.com:8935", state))
+	assert.Equal([]OrchCertPin{{Addr: "orch.example.com:8935", Fingerprint: fp}}, s.Pins())
+	assert.Error(s.Reset("orch.example.com:8935"))
+
+	_, err = NewOrchCertPinStore([]string{"orch.example.com:8935"}, false, nil)
+	assert.Contains(err.Error(), "expected addr=fingerprint")
+	_, err = NewOrchCertPinStore([]string{"orch.example.com:8935=abcd"}, false, nil)
+	assert.Contains(err.Error(), "invalid certificate fingerprint")
+}
+
+func TestOrchCertPinStore_TOFU(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	dir, err := ioutil.TempDir("", t.Name())
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	dbh, err := common.InitDB(filepath.Join(dir, "lp.sqlite3"))
+	require.Nil(err)
+	defer dbh.Close()
+
+	state, rotated := newPinTestState(t), newPinTestState(t)
+	s, err := NewOrchCertPinStore(nil, true, dbh)
+	require.Nil(err)
+	assert.Nil(s.Verify("orch.example.com", state))
+	assert.Error(s.Verify("orch.example.com:443", rotated))
+	pins := []OrchCertPin{{Addr: "orch.example.com:443", Fingerprint: CertFingerprint(state.PeerCertificates[0]), Learned: true}}
+	assert.Equal(pins, s.Pins())
+
+	// Learned pins are restored
+	s, err = NewOrchCertPinStore(nil, true, dbh)
+	require.Nil(err)
+	assert.Equal(pins, s.Pins())
+	assert.Error(s.Verify("orch.example.com:443", rotated))
+
+	// The certificate presented after a reset is pinned
+	require.Nil(s.Reset("orch.example.com:443"))
+	assert.Error(s.Reset("orch.example.com:443"))
+	assert.Nil(s.Verify("orch.example.com:443", rotated))
+	assert.Error(s.Verify("orch.example.com:443", state))
+	s, err = NewOrchCertPinStore(nil, true, dbh)
+	require.Nil(err)
+	assert.Equal(CertFingerprint(rotated.PeerCertificates[0]), s.Pins()[0].Fingerprint)
+}
+
+func TestOrchCertPins_Dial(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	defer func() { OrchCertPins = nil }()
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	require.Nil(err)
+	fp := CertFingerprint(ts.Certificate())
+	cfg := &tls.Config{InsecureSkipVerify: true}
+
+	OrchCertPins, err = NewOrchCertPinStore([]string{u.Host + "=" + fp}, false, nil)
+	require.Nil(err)
+	conn, err := dialOrchTLS("tcp", u.Host, cfg)
+	require.Nil(err)
+	conn.Close()
+
+	OrchCertPins, err = NewOrchCertPinStore([]string{u.Host + "=" + strings.Repeat("0", len(fp))}, false, nil)
+	require.Nil(err)
+	_, err = dialOrchTLS("tcp", u.Host, cfg)
+	assert.Contains(err.Error(), "does not match")
+}
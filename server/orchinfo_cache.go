@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/livepeer/go-livepeer/net"
+)
+
+// OrchestratorInfoTTL is how long broadcasters may reuse the OrchestratorInfo returned by the
+// orchestrator instead of requesting it again. Not reused if 0
+var OrchestratorInfoTTL time.Duration
+
+// Maximum time that a broadcaster reuses an OrchestratorInfo for, whatever its expiration
+var orchInfoCacheMaxAge = 5 * time.Minute
+
+var orchInfoCache = newOrchestratorInfoCache()
+
+type orchInfoEntry struct {
+	info    *net.OrchestratorInfo
+	expires time.Time
+}
+
+// orchInfoCall is a request of an OrchestratorInfo that other requests of the same info wait for
+type orchInfoCall struct {
+	done chan struct{}
+	info *net.OrchestratorInfo
+	err  error
+}
+
+// orchestratorInfoCache keeps the OrchestratorInfo returned by orchestrators until it expires, so
+// that streams that start in a short window don't request the same info. Infos are keyed by the
+// address of the broadcaster as well, as the ticket params of an info are bound to the sender
+// that signed the request
+type orchestratorInfoCache struct {
+	mu       sync.Mutex
+	entries  map[string]*orchInfoEntry
+	inflight map[string]*orchInfoCall
+}
+
+func newOrchestratorInfoCache() *orchestratorInfoCache {
+	return &orchestratorInfoCache{
+		entries:  make(map[string]*orchInfoEntry),
+		inflight: make(map[string]*orchInfoCall),
+	}
+}
+
+// get returns the cached info of the orchestrator at uri, or requests it with fetch. Concurrent
+// requests of an info that isn't cached wait for the same fetch
+func (c *orchestratorInfoCache) get(ctx context.Context, bcast Broadcaster, uri *url.URL, fetch func() (*net.OrchestratorInfo, error)) (*net.OrchestratorInfo, error) {
+	key := bcast.Address().Hex() + " " + uri.String()
+
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok && time.Now().Before(e.expires) {
+		c.mu.Unlock()
+		return proto.Clone(e.info).(*net.OrchestratorInfo), nil
+	}
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if call.err != nil {
+			return nil, call.err
+		}
+		return proto.Clone(call.info).(*net.OrchestratorInfo), nil
+	}
+	call := &orchInfoCall{done: make(chan struct{})}
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	call.info, call.err = fetch()
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	now := time.Now()
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	if call.err == nil {
+		if expires := infoExpiration(call.info, now); now.Before(expires) {
+			c.entries[key] = &orchInfoEntry{info: call.info, expires: expires}
+		}
+	}
+	c.mu.Unlock()
+	close(call.done)
+
+	if call.err != nil {
+		return nil, call.err
+	}
+	return proto.Clone(call.info).(*net.OrchestratorInfo), nil
+}
+
+// infoExpiration returns the time until which an info can be reused, which is capped to
+// orchInfoCacheMaxAge so that a wrong expiration can't keep an info forever
+func infoExpiration(info *net.OrchestratorInfo, now time.Time) time.Time {
+	if info.Expiration <= 0 {
+		return time.Time{}
+	}
+	expires := time.Unix(info.Expiration, 0)
+	if max := now.Add(orchInfoCacheMaxAge); expires.After(max) {
+		return max
+	}
+	return expires
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/net"
+)
+
+func TestOrchestratorInfoCache(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c := newOrchestratorInfoCache()
+	b := stubBroadcaster2()
+	uri, _ := url.Parse("https://o1:8935")
+	var fetches int32
+	expiration := time.Now().Add(time.Minute).Unix()
+	fetch := func() (*net.OrchestratorInfo, error) {
+		atomic.AddInt32(&fetches, 1)
+		return &net.OrchestratorInfo{Transcoder: "https://o1:8935", Expiration: expiration}, nil
+	}
+
+	info, err := c.get(context.Background(), b, uri, fetch)
+	require.Nil(err)
+	assert.Equal("https://o1:8935", info.Transcoder)
+
+	// Infos are reused until they expire, and callers get their own copy
+	info.Transcoder = "https://changed:8935"
+	info, err = c.get(context.Background(), b, uri, fetch)
+	require.Nil(err)
+	assert.Equal("https://o1:8935", info.Transcoder)
+	assert.Equal(int32(1), atomic.LoadInt32(&fetches))
+
+	// Infos are bound to the broadcaster that requested them
+	_, err = c.get(context.Background(), newStubOrchestrator(), uri, fetch)
+	require.Nil(err)
+	assert.Equal(int32(2), atomic.LoadInt32(&fetches))
+
+	// Expired infos are requested again
+	c.entries[b.Address().Hex()+" "+uri.String()].expires = time.Now().Add(-time.Second)
+	_, err = c.get(context.Background(), b, uri, fetch)
+	require.Nil(err)
+	assert.Equal(int32(3), atomic.LoadInt32(&fetches))
+
+	// Infos without an expiration and errors are not cached
+	expiration = 0
+	uri2, _ := url.Parse("https://o2:8935")
+	_, err = c.get(context.Background(), b, uri2, fetch)
+	require.Nil(err)
+	_, err = c.get(context.Background(), b, uri2, fetch)
+	require.Nil(err)
+	assert.Equal(int32(5), atomic.LoadInt32(&fetches))
+
+	fetchErr := errors.New("unreachable")
+	uri3, _ := url.Parse("https://o3:8935")
+	_, err = c.get(context.Background(), b, uri3, func() (*net.OrchestratorInfo, error) { return nil, fetchErr })
+	assert.Equal(fetchErr, err)
+	_, ok := c.entries[b.Address().Hex()+" "+uri3.String()]
+	assert.False(ok)
+}
+
+func TestOrchestratorInfoCache_ConcurrentRequests(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newOrchestratorInfoCache()
+	b := stubBroadcaster2()
+	uri, _ := url.Parse("https://o1:8935")
+	var fetches int32
+	release := make(chan struct{})
+	fetch := func() (*net.OrchestratorInfo, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		return &net.OrchestratorInfo{Transcoder: "https://o1:8935"}, nil
+	}
+
+	// Requests of an info that is being fetched wait for the same fetch, even if it isn't cached
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			info, err := c.get(context.Background(), b, uri, fetch)
+			assert.Nil(err)
+			assert.Equal("https://o1:8935", info.Transcoder)
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// Waiting requests give up when their context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := c.get(ctx, b, uri, fetch)
+	assert.Equal(context.DeadlineExceeded, err)
+
+	close(release)
+	wg.Wait()
+	assert.Equal(int32(1), atomic.LoadInt32(&fetches))
+}
+
+func TestInfoExpiration(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	assert.True(infoExpiration(&net.OrchestratorInfo{}, now).IsZero())
+	expires := now.Add(time.Minute).Unix()
+	assert.Equal(time.Unix(expires, 0), infoExpiration(&net.OrchestratorInfo{Expiration: expires}, now))
+	// Expirations are capped
+	assert.Equal(now.Add(orchInfoCacheMaxAge), infoExpiration(&net.OrchestratorInfo{Expiration: now.Add(time.Hour).Unix()}, now))
+}
@@ -3,7 +3,6 @@ package server
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -13,14 +12,17 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/textproto"
+	"net/url"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/cenkalti/backoff"
+	ethcommon "github.com/ethereum/go-ethereum/common"
 	"github.com/golang/glog"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -30,6 +32,7 @@ import (
 	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/core"
 	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/lpms/ffmpeg"
 )
 
 const protoVerLPT = "Livepeer-Transcoder-1.0"
@@ -37,6 +40,12 @@ const transcodingErrorMimeType = "livepeer/transcoding-error"
 
 var errSecret = errors.New("Invalid secret")
 var errZeroCapacity = errors.New("Zero capacity")
+var errPayloadEncryption = errors.New("Mismatched payload encryption")
+var errTranscoderAddress = errors.New("Missing transcoder address")
+
+// OrchestratorCertPin is the fingerprint, as normalized by ParseCertPin, of the orchestrator certificate
+// that a standalone transcoder requires. Any certificate is accepted if empty
+var OrchestratorCertPin string
 
 // Standalone Transcoder
 
@@ -69,6 +78,15 @@ func checkTranscoderError(err error) error {
 		if s.Message() == errZeroCapacity.Error() { // consider this unrecoverable
 			return core.NewRemoteTranscoderFatalError(errZeroCapacity)
 		}
+		if s.Message() == errPayloadEncryption.Error() { // configuration mismatch
+			return core.NewRemoteTranscoderFatalError(errPayloadEncryption)
+		}
+		if s.Message() == errTranscoderAddress.Error() { // upgrade required
+			return core.NewRemoteTranscoderFatalError(errTranscoderAddress)
+		}
+		if strings.HasPrefix(s.Message(), core.ErrTranscoderVersion.Error()) { // upgrade required
+			return core.NewRemoteTranscoderFatalError(errors.New(s.Message()))
+		}
 		if status.Code(err) == codes.Canceled {
 			return core.NewRemoteTranscoderFatalError(fmt.Errorf("Execution interrupted"))
 		}
@@ -77,7 +95,7 @@ func checkTranscoderError(err error) error {
 }
 
 func runTranscoder(n *core.LivepeerNode, orchAddr string, capacity int) error {
-	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+	tlsConfig := pinnedTLSConfig(OrchestratorCertPin)
 	conn, err := grpc.Dial(orchAddr,
 		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
 	if err != nil {
@@ -91,7 +109,20 @@ func runTranscoder(n *core.LivepeerNode, orchAddr string, capacity int) error {
 	ctx, cancel := context.WithCancel(ctx)
 	// Silence linter
 	defer cancel()
-	r, err := c.RegisterTranscoder(ctx, &net.RegisterRequest{Secret: n.OrchSecret, Capacity: int64(capacity)})
+	// A new key is used for the segments of every registration
+	var keyID string
+	if core.RemoteTranscoderEncryption {
+		keyID = common.RandName()
+	}
+	req := &net.RegisterRequest{
+		Secret:       n.OrchSecret,
+		Capacity:     int64(capacity),
+		Version:      core.LivepeerVersion,
+		Capabilities: core.TranscoderCapabilities(n.Transcoder),
+		KeyId:        keyID,
+		Address:      n.TranscoderIdentity.Address().Bytes(),
+	}
+	r, err := c.RegisterTranscoder(ctx, req)
 	if err := checkTranscoderError(err); err != nil {
 		glog.Error("Could not register transcoder to orchestrator ", err)
 		return err
@@ -111,7 +142,7 @@ func runTranscoder(n *core.LivepeerNode, orchAddr string, capacity int) error {
 		}
 	}()
 
-	httpc := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	httpc := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
 	var wg sync.WaitGroup
 	for {
 		notify, err := r.Recv()
@@ -122,14 +153,29 @@ func runTranscoder(n *core.LivepeerNode, orchAddr string, capacity int) error {
 		}
 		wg.Add(1)
 		go func() {
-			runTranscode(n, orchAddr, httpc, notify)
+			runTranscode(n, orchAddr, httpc, notify, keyID)
 			wg.Done()
 		}()
 	}
 }
 
-func runTranscode(n *core.LivepeerNode, orchAddr string, httpc *http.Client, notify *net.NotifySegment) {
+// notifyProfiles decodes the profiles that the segment of a task is transcoded to, and their encoder options
+func notifyProfiles(notify *net.NotifySegment) ([]ffmpeg.VideoProfile, common.ProfileEncoders, error) {
+	if len(notify.FullProfiles) > 0 {
+		return common.NetProfilesToFFmpegProfiles(notify.FullProfiles)
+	}
 	profiles, err := common.TxDataToVideoProfile(hex.EncodeToString(notify.Profiles))
+	return profiles, nil, err
+}
+
+// payloadAD returns the additional data that binds an encrypted payload to its task. Each
+// transcoded segment of a task is bound to its position in the results
+func payloadAD(kind string, taskID int64, index int) []byte {
+	return []byte(fmt.Sprintf("%s/%d/%d", kind, taskID, index))
+}
+
+func runTranscode(n *core.LivepeerNode, orchAddr string, httpc *http.Client, notify *net.NotifySegment, keyID string) {
+	profiles, encoders, err := notifyProfiles(notify)
 	if err != nil {
 		glog.Info("Unable to deserialize profiles ", err)
 	}
@@ -137,8 +183,22 @@ func runTranscode(n *core.LivepeerNode, orchAddr string, httpc *http.Client, not
 	glog.Infof("Transcoding taskId=%d url=%s", notify.TaskId, notify.Url)
 	var contentType string
 	var body bytes.Buffer
+	var key []byte
+	if keyID != "" {
+		key = core.PayloadKey(n.OrchSecret, keyID)
+	}
 
-	tData, err := n.Transcoder.Transcode(notify.Url, profiles)
+	var tData *core.TranscodeData
+	fname := notify.Url
+	if key != nil {
+		fname, err = fetchEncryptedSegment(n, orchAddr, httpc, notify, keyID, key)
+		if err == nil {
+			defer os.Remove(fname)
+		}
+	}
+	if err == nil {
+		tData, err = n.Transcoder.Transcode(fname, profiles, encoders)
+	}
 	glog.V(common.VERBOSE).Infof("Transcoding done for taskId=%d url=%s err=%v", notify.TaskId, notify.Url, err)
 	if err != nil {
 		glog.Error("Unable to transcode ", err)
@@ -147,18 +207,25 @@ func runTranscode(n *core.LivepeerNode, orchAddr string, httpc *http.Client, not
 	} else {
 		boundary := common.RandName()
 		w := multipart.NewWriter(&body)
-		for _, v := range tData.Segments {
+		for i, v := range tData.Segments {
+			data := v.Data
+			if key != nil {
+				data, err = core.EncryptPayload(key, v.Data, payloadAD("result", notify.TaskId, i))
+				if err != nil {
+					glog.Error("Could not encrypt transcoded segment ", err)
+				}
+			}
 			w.SetBoundary(boundary)
 			hdrs := textproto.MIMEHeader{
 				"Content-Type":   {"video/MP2T"},
-				"Content-Length": {strconv.Itoa(len(v.Data))},
+				"Content-Length": {strconv.Itoa(len(data))},
 				"Pixels":         {strconv.FormatInt(v.Pixels, 10)},
 			}
 			fw, err := w.CreatePart(hdrs)
 			if err != nil {
 				glog.Error("Could not create multipart part ", err)
 			}
-			io.Copy(fw, bytes.NewBuffer(v.Data))
+			io.Copy(fw, bytes.NewBuffer(data))
 		}
 		w.Close()
 		contentType = "multipart/mixed; boundary=" + boundary
@@ -171,8 +238,17 @@ func runTranscode(n *core.LivepeerNode, orchAddr string, httpc *http.Client, not
 	req.Header.Set("Credentials", n.OrchSecret)
 	req.Header.Set("Content-Type", contentType)
 	req.Header.Set("TaskId", strconv.FormatInt(notify.TaskId, 10))
+	if keyID != "" {
+		req.Header.Set("Key-Id", keyID)
+	}
 	if tData != nil {
 		req.Header.Set("Pixels", strconv.FormatInt(tData.Pixels, 10))
+		// The signature covers the plaintext segments so that it doesn't depend on the encryption
+		sig, err := n.TranscoderIdentity.Sign(core.TranscodeResultsHash(notify.TaskId, tData))
+		if err != nil {
+			glog.Error("Could not sign results ", err)
+		}
+		req.Header.Set("Signature", hex.EncodeToString(sig))
 	}
 	resp, err := httpc.Do(req)
 	if err != nil {
@@ -184,11 +260,50 @@ func runTranscode(n *core.LivepeerNode, orchAddr string, httpc *http.Client, not
 	glog.V(common.VERBOSE).Infof("Transcoding done results sent for taskId=%d url=%s err=%v", notify.TaskId, notify.Url, err)
 }
 
+// fetchEncryptedSegment downloads the source segment of a task from the orchestrator,
+// decrypts it and writes it to a temporary file for the transcoder
+func fetchEncryptedSegment(n *core.LivepeerNode, orchAddr string, httpc *http.Client, notify *net.NotifySegment, keyID string, key []byte) (string, error) {
+	req, err := http.NewRequest("GET", "https://"+orchAddr+"/transcoderSegment?url="+url.QueryEscape(notify.Url), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", protoVerLPT)
+	req.Header.Set("Credentials", n.OrchSecret)
+	req.Header.Set("TaskId", strconv.FormatInt(notify.TaskId, 10))
+	req.Header.Set("Key-Id", keyID)
+	resp, err := httpc.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error fetching segment status=%d body=%s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	data, err = core.DecryptPayload(key, data, payloadAD("segment", notify.TaskId, 0))
+	if err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile(n.WorkDir, "segment")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
 // Orchestrator gRPC
 
 func (h *lphttp) RegisterTranscoder(req *net.RegisterRequest, stream net.Transcoder_RegisterTranscoderServer) error {
 	from := common.GetConnectionAddr(stream.Context())
-	glog.Infof("Got a RegisterTranscoder request from transcoder=%s capacity=%d", from, req.Capacity)
+	glog.Infof("Got a RegisterTranscoder request from transcoder=%s capacity=%d version=%s", from, req.Capacity, req.Version)
 
 	if req.Secret != h.orchestrator.TranscoderSecret() {
 		glog.Info(errSecret.Error())
@@ -198,10 +313,22 @@ func (h *lphttp) RegisterTranscoder(req *net.RegisterRequest, stream net.Transco
 		glog.Info(errZeroCapacity.Error())
 		return errZeroCapacity
 	}
+	if (req.KeyId != "") != core.RemoteTranscoderEncryption {
+		glog.Info(errPayloadEncryption.Error())
+		return errPayloadEncryption
+	}
+	// Results are only accepted if they are signed by the transcoder
+	if len(req.Address) != ethcommon.AddressLength {
+		glog.Info(errTranscoderAddress.Error())
+		return errTranscoderAddress
+	}
+	if err := validateStrictRegistration(req); err != nil {
+		glog.Info(err.Error())
+		return err
+	}
 
 	// blocks until stream is finished
-	h.orchestrator.ServeTranscoder(stream, int(req.Capacity))
-	return nil
+	return h.orchestrator.ServeTranscoder(stream, int(req.Capacity), req.Version, req.Capabilities, ethcommon.BytesToAddress(req.Address))
 }
 
 // Orchestrator HTTP
@@ -237,6 +364,17 @@ func (h *lphttp) TranscodeResults(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var key []byte
+	if core.RemoteTranscoderEncryption {
+		keyID := r.Header.Get("Key-Id")
+		if keyID == "" {
+			glog.Error("Missing key ID of encrypted results")
+			http.Error(w, "Missing Key-Id", http.StatusBadRequest)
+			return
+		}
+		key = core.PayloadKey(orch.TranscoderSecret(), keyID)
+	}
+
 	decodedPixels, err := strconv.ParseInt(r.Header.Get("Pixels"), 10, 64)
 	if err != nil {
 		glog.Error("Could not parse decoded pixels", err)
@@ -278,6 +416,14 @@ func (h *lphttp) TranscodeResults(w http.ResponseWriter, r *http.Request) {
 				res.Err = err
 				break
 			}
+			if key != nil {
+				body, err = core.DecryptPayload(key, body, payloadAD("result", tid, len(segments)))
+				if err != nil {
+					glog.Error("Error decrypting body ", err)
+					res.Err = err
+					break
+				}
+			}
 
 			encodedPixels, err := strconv.ParseInt(p.Header.Get("Pixels"), 10, 64)
 			if err != nil {
@@ -292,6 +438,12 @@ func (h *lphttp) TranscodeResults(w http.ResponseWriter, r *http.Request) {
 			Segments: segments,
 			Pixels:   decodedPixels,
 		}
+		// The signature is verified against the transcoder that the task was assigned to
+		res.Sig, err = hex.DecodeString(r.Header.Get("Signature"))
+		if err != nil && res.Err == nil {
+			glog.Error("Could not parse results signature ", err)
+			res.Err = err
+		}
 		orch.TranscoderResults(tid, &res)
 	}
 	if res.Err != nil {
@@ -300,3 +452,44 @@ func (h *lphttp) TranscodeResults(w http.ResponseWriter, r *http.Request) {
 	}
 	w.Write([]byte("OK"))
 }
+
+// TranscoderSegment serves the encrypted source segment of a task to a remote transcoder
+func (h *lphttp) TranscoderSegment(w http.ResponseWriter, r *http.Request) {
+	orch := h.orchestrator
+
+	if protoVerLPT != r.Header.Get("Authorization") || r.Header.Get("Credentials") != orch.TranscoderSecret() {
+		glog.Error("Invalid credentials for transcoder segment")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	keyID := r.Header.Get("Key-Id")
+	if !core.RemoteTranscoderEncryption || keyID == "" {
+		http.Error(w, errPayloadEncryption.Error(), http.StatusBadRequest)
+		return
+	}
+	tid, err := strconv.ParseInt(r.Header.Get("TaskId"), 10, 64)
+	if err != nil {
+		glog.Error("Could not parse task ID ", err)
+		http.Error(w, "Invalid Task ID", http.StatusBadRequest)
+		return
+	}
+	uri, err := url.Parse(r.URL.Query().Get("url"))
+	if err != nil {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+	data, err := getNodeStorageSegment(uri)
+	if err != nil {
+		glog.Errorf("Segment not found for taskId=%d url=%s", tid, uri)
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	data, err = core.EncryptPayload(core.PayloadKey(orch.TranscoderSecret(), keyID), data, payloadAD("segment", tid, 0))
+	if err != nil {
+		glog.Error("Could not encrypt segment ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(data)
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"bytes"
 	"crypto/tls"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -12,14 +13,23 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
 	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/go-livepeer/pm"
 	"github.com/livepeer/lpms/ffmpeg"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type stubTranscoder struct {
@@ -36,7 +46,13 @@ var testRemoteTranscoderResults = &core.TranscodeData{
 	Pixels: 999,
 }
 
-func (st *stubTranscoder) Transcode(fname string, profiles []ffmpeg.VideoProfile) (*core.TranscodeData, error) {
+func newStubTranscoderIdentity(t *testing.T) *core.TranscoderIdentity {
+	key, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	return core.NewTranscoderIdentity(key)
+}
+
+func (st *stubTranscoder) Transcode(fname string, profiles []ffmpeg.VideoProfile, encoders common.ProfileEncoders) (*core.TranscodeData, error) {
 	st.called++
 	st.fname = fname
 	if st.err != nil {
@@ -62,8 +78,9 @@ func TestRemoteTranscoder(t *testing.T) {
 	node, _ := core.NewLivepeerNode(nil, "/tmp/thisdirisnotactuallyusedinthistest", nil)
 	node.OrchSecret = "verbigsecret"
 	node.Transcoder = tr
+	node.TranscoderIdentity = newStubTranscoderIdentity(t)
 
-	runTranscode(node, "badaddress", httpc, notify)
+	runTranscode(node, "badaddress", httpc, notify, "")
 	assert.Equal(1, tr.called)
 	assert.Equal("linktomanifest", tr.fname)
 
@@ -79,7 +96,7 @@ func TestRemoteTranscoder(t *testing.T) {
 	defer ts.Close()
 	parsedURL, _ := url.Parse(ts.URL)
 	rand.Seed(123)
-	runTranscode(node, parsedURL.Host, httpc, notify)
+	runTranscode(node, parsedURL.Host, httpc, notify, "")
 	assert.Equal(2, tr.called)
 	assert.NotNil(body)
 	assert.Equal("742", headers.Get("TaskId"))
@@ -87,6 +104,10 @@ func TestRemoteTranscoder(t *testing.T) {
 	assert.Equal("multipart/mixed; boundary=17b336b6e6ae071e928f", headers.Get("Content-Type"))
 	assert.Equal(node.OrchSecret, headers.Get("Credentials"))
 	assert.Equal(protoVerLPT, headers.Get("Authorization"))
+	// Results are signed by the identity of the transcoder
+	sig, err := hex.DecodeString(headers.Get("Signature"))
+	assert.NoError(err)
+	assert.True(pm.VerifySig(node.TranscoderIdentity.Address(), core.TranscodeResultsHash(742, testRemoteTranscoderResults), sig))
 	mediaType, params, err := mime.ParseMediaType(headers.Get("Content-Type"))
 	assert.Equal("multipart/mixed", mediaType)
 	assert.NoError(err)
@@ -110,6 +131,31 @@ func TestRemoteTranscoder(t *testing.T) {
 	}
 }
 
+func TestNotifyProfiles(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Presets are identified by name
+	presets := []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, ffmpeg.P720p60fps16x9}
+	profiles, encoders, err := notifyProfiles(&net.NotifySegment{Profiles: common.ProfilesToTranscodeOpts(presets)})
+	require.Nil(err)
+	assert.Equal(presets, profiles)
+	assert.Nil(encoders)
+
+	// Custom profiles are decoded from their full definitions, along with their encoder options
+	custom := []ffmpeg.VideoProfile{{Name: "custom", Bitrate: "500k", Framerate: 24, Resolution: "640x360"}}
+	customEncoders := common.ProfileEncoders{"custom": {GOP: "2", Profile: "main"}}
+	fullProfiles, err := common.FFmpegProfilesToNetProfiles(custom, customEncoders)
+	require.Nil(err)
+	notify := &net.NotifySegment{Profiles: common.ProfilesToTranscodeOpts(custom), FullProfiles: fullProfiles}
+	_, err = common.TxDataToVideoProfile(hex.EncodeToString(notify.Profiles))
+	assert.Equal(common.ErrProfile, err)
+	profiles, encoders, err = notifyProfiles(notify)
+	require.Nil(err)
+	assert.Equal(custom, profiles)
+	assert.Equal(customEncoders, encoders)
+}
+
 func TestRemoteTranscoderError(t *testing.T) {
 	httpc := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
 	profiles := []ffmpeg.VideoProfile{ffmpeg.P720p60fps16x9, ffmpeg.P144p30fps16x9}
@@ -127,6 +173,7 @@ func TestRemoteTranscoderError(t *testing.T) {
 	node, _ := core.NewLivepeerNode(nil, "/tmp/thisdirisnotactuallyusedinthistest", nil)
 	node.OrchSecret = "verbigsecret"
 	node.Transcoder = tr
+	node.TranscoderIdentity = newStubTranscoderIdentity(t)
 
 	var headers http.Header
 	var body []byte
@@ -139,7 +186,7 @@ func TestRemoteTranscoderError(t *testing.T) {
 	}))
 	defer ts.Close()
 	parsedURL, _ := url.Parse(ts.URL)
-	runTranscode(node, parsedURL.Host, httpc, notify)
+	runTranscode(node, parsedURL.Host, httpc, notify, "")
 	assert.Equal(1, tr.called)
 	assert.NotNil(body)
 	assert.Equal("742", headers.Get("TaskId"))
@@ -148,3 +195,142 @@ func TestRemoteTranscoderError(t *testing.T) {
 	assert.Equal(protoVerLPT, headers.Get("Authorization"))
 	assert.Equal(errText, string(body))
 }
+
+func TestCheckTranscoderError(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(checkTranscoderError(nil))
+
+	err := checkTranscoderError(status.Error(codes.Unknown, errSecret.Error()))
+	assert.IsType(core.RemoteTranscoderFatalError{}, err)
+
+	// Transcoders below the minimum version of the orchestrator need to be upgraded
+	versionErr := fmt.Errorf("%v: version 0.5.0 is below the minimum version 0.5.1", core.ErrTranscoderVersion)
+	err = checkTranscoderError(status.Error(codes.Unknown, versionErr.Error()))
+	assert.IsType(core.RemoteTranscoderFatalError{}, err)
+	assert.Equal(versionErr.Error(), err.Error())
+
+	// Transcoders and orchestrators need to agree on payload encryption
+	err = checkTranscoderError(status.Error(codes.Unknown, errPayloadEncryption.Error()))
+	assert.IsType(core.RemoteTranscoderFatalError{}, err)
+
+	// Transcoders that don't sign their results need to be upgraded
+	err = checkTranscoderError(status.Error(codes.Unknown, errTranscoderAddress.Error()))
+	assert.IsType(core.RemoteTranscoderFatalError{}, err)
+
+	// Other errors are retried
+	err = checkTranscoderError(status.Error(codes.Unavailable, "connection refused"))
+	_, fatal := err.(core.RemoteTranscoderFatalError)
+	assert.False(fatal)
+}
+
+type fileTranscoder struct {
+	data []byte
+}
+
+func (ft *fileTranscoder) Transcode(fname string, profiles []ffmpeg.VideoProfile, encoders common.ProfileEncoders) (*core.TranscodeData, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	ft.data = data
+	return testRemoteTranscoderResults, nil
+}
+
+func TestRemoteTranscoder_Encryption(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	oldEncryption := core.RemoteTranscoderEncryption
+	core.RemoteTranscoderEncryption = true
+	defer func() { core.RemoteTranscoderEncryption = oldEncryption }()
+	oldStorage := drivers.NodeStorage
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	defer func() { drivers.NodeStorage = oldStorage }()
+
+	segURL, err := drivers.NodeStorage.NewSession("mid").SaveData("1.ts", []byte("source"))
+	require.Nil(err)
+
+	orch := &mockOrchestrator{}
+	orch.On("TranscoderSecret").Return()
+	var res *core.RemoteTranscoderResult
+	orch.On("TranscoderResults", int64(742), mock.Anything).Run(func(args mock.Arguments) {
+		res = args.Get(1).(*core.RemoteTranscoderResult)
+	})
+	lp := &lphttp{orchestrator: orch}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/transcoderSegment", lp.TranscoderSegment)
+	mux.HandleFunc("/transcodeResults", lp.TranscodeResults)
+	ts := httptest.NewTLSServer(mux)
+	defer ts.Close()
+	parsedURL, _ := url.Parse(ts.URL)
+
+	workDir, err := ioutil.TempDir("", t.Name())
+	require.Nil(err)
+	defer os.RemoveAll(workDir)
+	node, _ := core.NewLivepeerNode(nil, workDir, nil)
+	tr := &fileTranscoder{}
+	node.Transcoder = tr
+	node.TranscoderIdentity = newStubTranscoderIdentity(t)
+
+	httpc := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	notify := &net.NotifySegment{
+		TaskId:   742,
+		Profiles: common.ProfilesToTranscodeOpts([]ffmpeg.VideoProfile{ffmpeg.P720p60fps16x9, ffmpeg.P144p30fps16x9}),
+		Url:      segURL,
+	}
+	runTranscode(node, parsedURL.Host, httpc, notify, "keyid")
+
+	// The transcoder is given the decrypted source segment, which is removed afterwards
+	assert.Equal([]byte("source"), tr.data)
+	files, err := ioutil.ReadDir(workDir)
+	require.Nil(err)
+	assert.Empty(files)
+
+	// The orchestrator decrypts the results, which are signed in plaintext
+	require.NotNil(res)
+	assert.Nil(res.Err)
+	require.Len(res.TranscodeData.Segments, 2)
+	for i, seg := range res.TranscodeData.Segments {
+		assert.Equal(testRemoteTranscoderResults.Segments[i].Data, seg.Data)
+		assert.Equal(testRemoteTranscoderResults.Segments[i].Pixels, seg.Pixels)
+	}
+	assert.True(pm.VerifySig(node.TranscoderIdentity.Address(), core.TranscodeResultsHash(742, res.TranscodeData), res.Sig))
+
+	// Segments are not served without a key ID
+	req, err := http.NewRequest("GET", ts.URL+"/transcoderSegment?url="+url.QueryEscape(segURL), nil)
+	require.Nil(err)
+	req.Header.Set("Authorization", protoVerLPT)
+	req.Header.Set("TaskId", "742")
+	resp, err := httpc.Do(req)
+	require.Nil(err)
+	resp.Body.Close()
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	// Results without a key ID are rejected
+	req, err = http.NewRequest("POST", ts.URL+"/transcodeResults", strings.NewReader("results"))
+	require.Nil(err)
+	req.Header.Set("Authorization", protoVerLPT)
+	req.Header.Set("Content-Type", "multipart/mixed; boundary=abc")
+	req.Header.Set("TaskId", "742")
+	req.Header.Set("Pixels", "999")
+	resp, err = httpc.Do(req)
+	require.Nil(err)
+	resp.Body.Close()
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	// Results encrypted with another key are rejected
+	res = nil
+	mux = http.NewServeMux()
+	mux.HandleFunc("/transcoderSegment", lp.TranscoderSegment)
+	mux.HandleFunc("/transcodeResults", func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Set("Key-Id", "otherkeyid")
+		lp.TranscodeResults(w, r)
+	})
+	ts2 := httptest.NewTLSServer(mux)
+	defer ts2.Close()
+	parsedURL, _ = url.Parse(ts2.URL)
+	runTranscode(node, parsedURL.Host, httpc, notify, "keyid")
+	require.NotNil(res)
+	assert.Contains(res.Err.Error(), core.ErrPayload.Error())
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+const manifestIDHeader = "Livepeer-Manifest-ID"
+
+// ServePayment credits a payment that is sent ahead of the segments of a stream to the
+// stream's balance so that the segments themselves do not need to carry any tickets
+func (h *lphttp) ServePayment(w http.ResponseWriter, r *http.Request) {
+	orch := h.orchestrator
+
+	mid := core.ManifestID(r.Header.Get(manifestIDHeader))
+	if mid == "" {
+		glog.Error("Missing manifest ID for payment")
+		http.Error(w, "Missing manifest ID", http.StatusBadRequest)
+		return
+	}
+
+	payment, err := getPayment(r.Header.Get(paymentHeader))
+	if err != nil {
+		glog.Error("Could not parse payment")
+		http.Error(w, err.Error(), http.StatusPaymentRequired)
+		return
+	}
+	if err := validateStrictPayment(payment); err != nil {
+		glog.Error("Rejecting payment: ", err)
+		http.Error(w, err.Error(), http.StatusPaymentRequired)
+		return
+	}
+
+	if payment.TicketParams == nil || len(payment.TicketSenderParams) == 0 {
+		glog.Errorf("Payment without tickets for manifestID=%v", mid)
+		http.Error(w, "Missing tickets", http.StatusPaymentRequired)
+		return
+	}
+
+	oInfo, ok := processPayment(orch, w, payment, mid)
+	if !ok {
+		return
+	}
+
+	glog.V(common.DEBUG).Infof("Received prepayment manifestID=%v sender=%v tickets=%v", mid, monitor.RedactAddress(getPaymentSender(payment)), len(payment.TicketSenderParams))
+
+	// The response body is empty unless the broadcaster needs to update its OrchestratorInfo
+	if oInfo == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	buf, err := proto.Marshal(oInfo)
+	if err != nil {
+		glog.Error("Unable to marshal orchestrator info ", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf)
+}
+
+// SubmitPayment sends a payment to the orchestrator of a session ahead of segment submission.
+// If the session's credit does not cover the next segment the payment prefunds credit for
+// numSegments segments. Otherwise no payment is sent
+func SubmitPayment(sess *BroadcastSession, numSegments int) error {
+	if sess.Sender == nil || sess.Balance == nil || numSegments <= 0 {
+		return nil
+	}
+
+	ev, err := sess.Sender.EV(sess.PMSessionID)
+	if err != nil {
+		return err
+	}
+
+	balUpdate, err := stageBalanceUpdate(sess, numSegments)
+	if err != nil {
+		return err
+	}
+
+	// The balance update should be completed when this function returns
+	defer completeBalanceUpdate(sess, balUpdate)
+
+	// Wait until the existing credit runs low so that a single payment covers multiple segments
+	if balUpdate.NumTickets == 0 || balUpdate.ExistingCredit.Cmp(ev) >= 0 {
+		return nil
+	}
+
+	payment, err := genPayment(sess, balUpdate.NumTickets)
+	if err != nil {
+		glog.Errorf("Could not create payment: %v", err)
+		return err
+	}
+
+	ti := sess.OrchestratorInfo
+	req, err := http.NewRequest("POST", ti.Transcoder+"/payment", nil)
+	if err != nil {
+		glog.Error("Could not generate payment request to ", ti.Transcoder)
+		return err
+	}
+
+	req.Header.Set(manifestIDHeader, string(sess.ManifestID))
+	req.Header.Set(paymentHeader, payment)
+
+	glog.V(common.DEBUG).Infof("Submitting prepayment manifestID=%v orch=%v tickets=%v", sess.ManifestID, ti.Transcoder, balUpdate.NumTickets)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		glog.Errorf("Unable to submit payment manifestID=%v: %v", sess.ManifestID, err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	// If the payment was submitted then we assume that it was credited. There is no debit
+	// for a payment so the update's credit is returned to the balance as change
+	balUpdate.Status = CreditSpent
+
+	if header := resp.Header.Get(paymentResultHeader); header != "" {
+		if err := applyPaymentResult(balUpdate, header, resp.StatusCode); err != nil {
+			glog.Errorf("Unable to apply payment result manifestID=%v: %v", sess.ManifestID, err)
+		}
+	}
+	if header := resp.Header.Get(reclaimedCreditHeader); header != "" {
+		if err := applyReclaimedCredit(balUpdate, header); err != nil {
+			glog.Errorf("Unable to apply reclaimed credit manifestID=%v: %v", sess.ManifestID, err)
+		}
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		errorString := strings.TrimSpace(string(data))
+		glog.Errorf("Error submitting payment manifestID=%v code=%d error=%v", sess.ManifestID, resp.StatusCode, errorString)
+		// Without a payment result none of the tickets were credited
+		if balUpdate.Status != ReceivedChange {
+			balUpdate.NewCredit = big.NewRat(0, 1)
+			balUpdate.Status = ReceivedChange
+		}
+		return fmt.Errorf(errorString)
+	}
+	balUpdate.Status = ReceivedChange
+
+	if err != nil {
+		glog.Errorf("Unable to read payment response manifestID=%v: %v", sess.ManifestID, err)
+		return err
+	}
+
+	if len(data) > 0 {
+		var oInfo net.OrchestratorInfo
+		if err := proto.Unmarshal(data, &oInfo); err != nil {
+			glog.Errorf("Unable to parse payment response manifestID=%v: %v", sess.ManifestID, err)
+			return err
+		}
+		updateOrchestratorInfo(sess, &oInfo)
+	}
+
+	return nil
+}
+
+// prefunding holds the sessions that have a payment for their upcoming segments in flight
+var prefunding sync.Map
+
+// prefundSession sends a payment for the upcoming segments of a stream in the background if payment
+// pipelining is enabled. A session has at most one such payment in flight
+func prefundSession(sess *BroadcastSession) {
+	depth := BroadcastCfg.PaymentPipelineDepth()
+	if depth <= 0 {
+		return
+	}
+	if _, inFlight := prefunding.LoadOrStore(sess, true); inFlight {
+		return
+	}
+	// The session is returned to the pool and may be used by the next segment while the payment is
+	// in flight, so the payment is sent with a copy of it. An OrchestratorInfo in the payment response
+	// is not applied to the session; the next segment response updates it instead
+	paySess := *sess
+	go func() {
+		defer prefunding.Delete(sess)
+		if err := SubmitPayment(&paySess, depth); err != nil {
+			// Not fatal; the next segment carries its own payment if the credit is insufficient
+			glog.Errorf("Error prefunding session manifestID=%v orch=%v: %v", paySess.ManifestID, paySess.OrchestratorInfo.Transcoder, err)
+		}
+	}()
+}
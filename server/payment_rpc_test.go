@@ -0,0 +1,366 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/go-livepeer/pm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func servePaymentHandler(orch Orchestrator) http.Handler {
+	lp := lphttp{
+		orchestrator: orch,
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lp.ServePayment(w, r)
+	})
+}
+
+func encodedPayment(t *testing.T, payment *net.Payment) string {
+	data, err := proto.Marshal(payment)
+	require.Nil(t, err)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func TestServePayment_MissingManifestID(t *testing.T) {
+	handler := servePaymentHandler(&mockOrchestrator{})
+
+	headers := map[string]string{
+		paymentHeader: encodedPayment(t, defaultPayment(t)),
+	}
+	resp := httpPostResp(handler, nil, headers)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.Nil(t, err)
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	assert.Equal("Missing manifest ID", strings.TrimSpace(string(body)))
+}
+
+func TestServePayment_GetPaymentError(t *testing.T) {
+	handler := servePaymentHandler(&mockOrchestrator{})
+
+	headers := map[string]string{
+		manifestIDHeader: "foo",
+		paymentHeader:    "foo",
+	}
+	resp := httpPostResp(handler, nil, headers)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.Nil(t, err)
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusPaymentRequired, resp.StatusCode)
+	assert.Contains(strings.TrimSpace(string(body)), "base64")
+}
+
+func TestServePayment_MissingTickets(t *testing.T) {
+	handler := servePaymentHandler(&mockOrchestrator{})
+
+	payment := defaultPayment(t)
+	payment.TicketSenderParams = nil
+	headers := map[string]string{
+		manifestIDHeader: "foo",
+		paymentHeader:    encodedPayment(t, payment),
+	}
+	resp := httpPostResp(handler, nil, headers)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.Nil(t, err)
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusPaymentRequired, resp.StatusCode)
+	assert.Equal("Missing tickets", strings.TrimSpace(string(body)))
+}
+
+func TestServePayment_UnacceptableProcessPaymentError(t *testing.T) {
+	orch := &mockOrchestrator{}
+	handler := servePaymentHandler(orch)
+
+	mid := core.ManifestID("foo")
+	orch.On("ProcessPayment", mock.Anything, mid).Return(pm.NewMockReceiveError(errors.New("some error"), false))
+
+	headers := map[string]string{
+		manifestIDHeader: string(mid),
+		paymentHeader:    encodedPayment(t, defaultPayment(t)),
+	}
+	resp := httpPostResp(handler, nil, headers)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.Nil(t, err)
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	assert.Equal("some error", strings.TrimSpace(string(body)))
+}
+
+func TestServePayment_Success(t *testing.T) {
+	orch := &mockOrchestrator{}
+	handler := servePaymentHandler(orch)
+
+	require := require.New(t)
+	assert := assert.New(t)
+
+	mid := core.ManifestID("foo")
+	orch.On("ProcessPayment", mock.Anything, mid).Return(nil).Once()
+
+	headers := map[string]string{
+		manifestIDHeader: string(mid),
+		paymentHeader:    encodedPayment(t, defaultPayment(t)),
+	}
+	resp := httpPostResp(handler, nil, headers)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.Nil(err)
+	resp.Body.Close()
+
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Empty(body)
+	orch.AssertCalled(t, "ProcessPayment", mock.Anything, mid)
+
+	// An acceptable error returns an updated OrchestratorInfo
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	params := defaultTicketParams()
+	orch.On("ProcessPayment", mock.Anything, mid).Return(pm.NewMockReceiveError(errors.New("some error"), true)).Once()
+	orch.On("TicketParams", mock.Anything).Return(params, nil)
+	orch.On("PriceInfo", mock.Anything).Return(nil, nil)
+	orch.On("ServiceURI").Return(url.Parse("http://someuri.com"))
+
+	resp = httpPostResp(handler, nil, headers)
+	defer resp.Body.Close()
+	body, err = ioutil.ReadAll(resp.Body)
+	require.Nil(err)
+
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	var oInfo net.OrchestratorInfo
+	require.Nil(proto.Unmarshal(body, &oInfo))
+	assert.Equal("http://someuri.com", oInfo.Transcoder)
+	assert.Equal(params.Recipient, oInfo.TicketParams.Recipient)
+}
+
+func TestServePayment_ReclaimedCredit_SetsHeader(t *testing.T) {
+	orch := &mockOrchestrator{reclaimedCredit: big.NewRat(5, 2)}
+	handler := servePaymentHandler(orch)
+
+	mid := core.ManifestID("foo")
+	orch.On("ProcessPayment", mock.Anything, mid).Return(nil)
+
+	headers := map[string]string{
+		manifestIDHeader: string(mid),
+		paymentHeader:    encodedPayment(t, defaultPayment(t)),
+	}
+	resp := httpPostResp(handler, nil, headers)
+	resp.Body.Close()
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("5/2", resp.Header.Get(reclaimedCreditHeader))
+
+	// The sender is only notified once
+	resp = httpPostResp(handler, nil, headers)
+	resp.Body.Close()
+
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Empty(resp.Header.Get(reclaimedCreditHeader))
+}
+
+func TestSubmitPayment(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var received *net.Payment
+	var receivedMid string
+	status := http.StatusOK
+	var respBody []byte
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	mux.HandleFunc("/payment", func(w http.ResponseWriter, r *http.Request) {
+		receivedMid = r.Header.Get(manifestIDHeader)
+		payment, err := getPayment(r.Header.Get(paymentHeader))
+		require.Nil(err)
+		received = &payment
+		if status != http.StatusOK {
+			http.Error(w, "some error", status)
+			return
+		}
+		w.WriteHeader(status)
+		w.Write(respBody)
+	})
+
+	ev := big.NewRat(5, 1)
+	sender := &pm.MockSender{}
+	sender.On("EV", mock.Anything).Return(ev, nil)
+	batch := &pm.TicketBatch{
+		TicketParams: &pm.TicketParams{
+			Recipient: pm.RandAddress(),
+			FaceValue: big.NewInt(1234),
+			WinProb:   big.NewInt(5678),
+			Seed:      big.NewInt(7777),
+		},
+		TicketExpirationParams: &pm.TicketExpirationParams{},
+		Sender:                 pm.RandAddress(),
+		SenderParams: []*pm.TicketSenderParams{
+			&pm.TicketSenderParams{SenderNonce: 1, Sig: pm.RandBytes(42)},
+			&pm.TicketSenderParams{SenderNonce: 2, Sig: pm.RandBytes(42)},
+		},
+	}
+	sender.On("CreateTicketBatch", mock.Anything, 2).Return(batch, nil)
+
+	balance := &mockBalance{}
+	balance.On("Credit", mock.Anything)
+	s := &BroadcastSession{
+		Broadcaster: stubBroadcaster2(),
+		ManifestID:  core.RandomManifestID(),
+		OrchestratorInfo: &net.OrchestratorInfo{
+			Transcoder: ts.URL,
+			PriceInfo: &net.PriceInfo{
+				PricePerUnit:  1,
+				PixelsPerUnit: 1,
+			},
+		},
+		Balance: balance,
+		Sender:  sender,
+	}
+	creditedWith := func(amount *big.Rat) interface{} {
+		return mock.MatchedBy(func(credit *big.Rat) bool {
+			return credit.Cmp(amount) == 0
+		})
+	}
+
+	// No payment without a sender
+	assert.Nil(SubmitPayment(&BroadcastSession{}, 3))
+	assert.Nil(received)
+
+	// No payment if the existing credit covers the next segment
+	balance.On("StageUpdate", mock.Anything, ev).Return(1, big.NewRat(5, 1), big.NewRat(7, 1)).Once()
+	assert.Nil(SubmitPayment(s, 3))
+	assert.Nil(received)
+	balance.AssertCalled(t, "Credit", creditedWith(big.NewRat(7, 1)))
+
+	// The credit for the upcoming segments is prepaid
+	balance.On("StageUpdate", mock.MatchedBy(func(minCredit *big.Rat) bool {
+		return minCredit.Cmp(big.NewRat(15, 1)) == 0
+	}), ev).Return(2, big.NewRat(10, 1), big.NewRat(2, 1)).Once()
+	assert.Nil(SubmitPayment(s, 3))
+	require.NotNil(received)
+	assert.Equal(string(s.ManifestID), receivedMid)
+	assert.Len(received.TicketSenderParams, 2)
+	// The existing and the new credit are returned to the balance
+	balance.AssertCalled(t, "Credit", creditedWith(big.NewRat(12, 1)))
+
+	// The OrchestratorInfo is updated if the orchestrator returns one
+	respBody, _ = proto.Marshal(&net.OrchestratorInfo{Transcoder: ts.URL, PriceInfo: &net.PriceInfo{PricePerUnit: 1, PixelsPerUnit: 1}, MaxTicketsPerPayment: 4})
+	balance.On("StageUpdate", mock.Anything, ev).Return(2, big.NewRat(10, 1), big.NewRat(3, 1)).Once()
+	assert.Nil(SubmitPayment(s, 3))
+	assert.Equal(uint32(4), s.OrchestratorInfo.MaxTicketsPerPayment)
+	balance.AssertCalled(t, "Credit", creditedWith(big.NewRat(13, 1)))
+
+	// Credit reclaimed by the orchestrator is not returned to the balance
+	respBody = nil
+	mux.HandleFunc("/reclaimed/payment", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(reclaimedCreditHeader, "3")
+		w.WriteHeader(http.StatusOK)
+	})
+	s.OrchestratorInfo.Transcoder = ts.URL + "/reclaimed"
+	balance.On("StageUpdate", mock.Anything, ev).Return(2, big.NewRat(10, 1), big.NewRat(4, 1)).Once()
+	assert.Nil(SubmitPayment(s, 3))
+	balance.AssertCalled(t, "Credit", creditedWith(big.NewRat(11, 1)))
+	s.OrchestratorInfo.Transcoder = ts.URL
+
+	// Only the existing credit is returned to the balance if the payment is rejected
+	status = http.StatusBadRequest
+	balance.On("StageUpdate", mock.Anything, ev).Return(2, big.NewRat(10, 1), big.NewRat(4, 1)).Once()
+	assert.EqualError(SubmitPayment(s, 3), "some error")
+	balance.AssertCalled(t, "Credit", creditedWith(big.NewRat(4, 1)))
+}
+
+func TestPrefundSession(t *testing.T) {
+	assert := assert.New(t)
+
+	requests := make(chan struct{}, 2)
+	release := make(chan struct{})
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	mux.HandleFunc("/payment", func(w http.ResponseWriter, r *http.Request) {
+		requests <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+
+	ev := big.NewRat(5, 1)
+	sender := &pm.MockSender{}
+	sender.On("EV", mock.Anything).Return(ev, nil)
+	sender.On("CreateTicketBatch", mock.Anything, 2).Return(&pm.TicketBatch{
+		TicketParams: &pm.TicketParams{
+			Recipient: pm.RandAddress(),
+			FaceValue: big.NewInt(1234),
+			WinProb:   big.NewInt(5678),
+			Seed:      big.NewInt(7777),
+		},
+		TicketExpirationParams: &pm.TicketExpirationParams{},
+		Sender:                 pm.RandAddress(),
+		SenderParams: []*pm.TicketSenderParams{
+			&pm.TicketSenderParams{SenderNonce: 1, Sig: pm.RandBytes(42)},
+			&pm.TicketSenderParams{SenderNonce: 2, Sig: pm.RandBytes(42)},
+		},
+	}, nil)
+	balance := &mockBalance{}
+	balance.On("Credit", mock.Anything)
+	balance.On("StageUpdate", mock.Anything, ev).Return(2, big.NewRat(10, 1), big.NewRat(2, 1))
+	sess := &BroadcastSession{
+		Broadcaster: stubBroadcaster2(),
+		ManifestID:  core.RandomManifestID(),
+		OrchestratorInfo: &net.OrchestratorInfo{
+			Transcoder: ts.URL,
+			PriceInfo:  &net.PriceInfo{PricePerUnit: 1, PixelsPerUnit: 1},
+		},
+		Balance: balance,
+		Sender:  sender,
+	}
+
+	// No payment if payment pipelining is disabled
+	prefundSession(sess)
+	_, inFlight := prefunding.Load(sess)
+	assert.False(inFlight)
+
+	BroadcastCfg.SetPaymentPipelineDepth(3)
+	defer BroadcastCfg.SetPaymentPipelineDepth(0)
+
+	// The payment is sent in the background, once at a time per session
+	prefundSession(sess)
+	<-requests
+	prefundSession(sess)
+	close(release)
+	assert.Eventually(func() bool {
+		_, inFlight := prefunding.Load(sess)
+		return !inFlight
+	}, time.Second, 10*time.Millisecond)
+	assert.Len(requests, 0)
+
+	// Another payment is sent once the previous one completed
+	prefundSession(sess)
+	select {
+	case <-requests:
+	case <-time.After(time.Second):
+		assert.Fail("Payment was not sent")
+	}
+}
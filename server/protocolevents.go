@@ -0,0 +1,130 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/websocket"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/eth/watchers"
+)
+
+// ProtocolEvents is the stream of the events of the protocol contracts, if the node is on-chain
+var ProtocolEvents watchers.ProtocolEventSubscriber
+
+// protocolEventsQueueSize is the number of events queued for a client. Clients that fall further
+// behind are disconnected, so that they never hold up the other subscribers of the events
+const protocolEventsQueueSize = 256
+
+// protocolEventsHandler pushes the events of the protocol contracts to the websocket clients of its
+// requests. The events can be filtered by name with a comma separated events query parameter
+func protocolEventsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ProtocolEvents == nil {
+			respondWithCliError(w, http.StatusBadRequest, CliErrNotSupported, "protocol events are only available on on-chain nodes")
+			return
+		}
+		var names map[string]bool
+		if events := r.URL.Query().Get("events"); events != "" {
+			names = make(map[string]bool)
+			for _, name := range strings.Split(events, ",") {
+				name = strings.TrimSpace(name)
+				if !watchers.IsProtocolEvent(name) {
+					respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, fmt.Sprintf("unknown protocol event %v", name))
+					return
+				}
+				names[name] = true
+			}
+		}
+		conn, err := liveStatsUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// The upgrader has responded with the error
+			glog.V(common.DEBUG).Infof("Unable to upgrade protocol events request remoteAddr=%s: %v", r.RemoteAddr, err)
+			return
+		}
+		serveProtocolEvents(conn, names)
+	})
+}
+
+// serveProtocolEvents pushes the protocol events with the given names, or all of them if names is
+// nil, to a client until it disconnects
+func serveProtocolEvents(conn *websocket.Conn, names map[string]bool) {
+	defer conn.Close()
+	events := make(chan *watchers.ProtocolEvent, 10)
+	sub := ProtocolEvents.Subscribe(events)
+	defer sub.Unsubscribe()
+
+	// Control frames are only processed while reading, and clients are not expected to send anything else
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(liveStatsPongWait))
+	conn.SetPongHandler(func(string) error { return conn.SetReadDeadline(time.Now().Add(liveStatsPongWait)) })
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Events are queued without blocking and written by another goroutine, since the subscription
+	// holds up the other subscribers while its events are not received
+	queue := make(chan []byte, protocolEventsQueueSize)
+	done := make(chan struct{})
+	defer close(done)
+	writeErr := make(chan struct{})
+	go func() {
+		defer close(writeErr)
+		ping := time.NewTicker(liveStatsPingInterval)
+		defer ping.Stop()
+		for {
+			select {
+			case msg := <-queue:
+				conn.SetWriteDeadline(time.Now().Add(liveStatsWriteWait))
+				if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+					return
+				}
+			case <-ping.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(liveStatsWriteWait)); err != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case ev := <-events:
+			if names != nil && !names[ev.Name] {
+				continue
+			}
+			msg, err := json.Marshal(ev)
+			if err != nil {
+				glog.Errorf("Unable to marshal protocol event name=%v: %v", ev.Name, err)
+				continue
+			}
+			select {
+			case queue <- msg:
+			default:
+				glog.Warningf("Disconnecting protocol events client: too many pending events")
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"), time.Now().Add(liveStatsWriteWait))
+				return
+			}
+		case <-sub.Err():
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(liveStatsWriteWait))
+			return
+		case <-writeErr:
+			return
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/gorilla/websocket"
+	"github.com/livepeer/go-livepeer/eth/contracts"
+	"github.com/livepeer/go-livepeer/eth/watchers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubProtocolEvents struct {
+	feed event.Feed
+}
+
+func (s *stubProtocolEvents) Subscribe(sink chan<- *watchers.ProtocolEvent) event.Subscription {
+	return s.feed.Subscribe(sink)
+}
+
+func TestProtocolEventsHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	oldEvents := ProtocolEvents
+	defer func() { ProtocolEvents = oldEvents }()
+
+	// Only on-chain nodes have protocol events
+	ProtocolEvents = nil
+	w := httptest.NewRecorder()
+	protocolEventsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/protocolEvents", nil))
+	assert.Equal(http.StatusBadRequest, w.Code)
+	assert.Contains(w.Body.String(), "protocol events are only available on on-chain nodes")
+
+	events := &stubProtocolEvents{}
+	ProtocolEvents = events
+	w = httptest.NewRecorder()
+	protocolEventsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/protocolEvents?events=NewRound,Foo", nil))
+	assert.Equal(http.StatusBadRequest, w.Code)
+	assert.Contains(w.Body.String(), "unknown protocol event Foo")
+
+	ts := httptest.NewServer(ManagementHTTPLimits.Handler(protocolEventsHandler()))
+	defer ts.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/protocolEvents?events=NewRound,Bond", nil)
+	require.Nil(err)
+	defer conn.Close()
+
+	// Wait for the subscription of the client
+	send := func(ev *watchers.ProtocolEvent) {
+		require.Eventually(func() bool { return events.feed.Send(ev) > 0 }, time.Second, 10*time.Millisecond)
+	}
+	send(&watchers.ProtocolEvent{Name: "Unbond", Event: &contracts.BondingManagerUnbond{}})
+	send(&watchers.ProtocolEvent{Name: "NewRound", BlockNumber: 30, Removed: true, Event: &contracts.RoundsManagerNewRound{Round: big.NewInt(8)}})
+
+	// Events are filtered by name
+	require.Nil(conn.SetReadDeadline(time.Now().Add(5 * time.Second)))
+	_, msg, err := conn.ReadMessage()
+	require.Nil(err)
+	assert.JSONEq(`{
+		"name": "NewRound",
+		"blockNumber": 30,
+		"blockHash": "0x0000000000000000000000000000000000000000000000000000000000000000",
+		"txHash": "0x0000000000000000000000000000000000000000000000000000000000000000",
+		"removed": true,
+		"args": {"round": "8", "blockHash": "0x0000000000000000000000000000000000000000000000000000000000000000"}
+	}`, string(msg))
+
+	// Clients are unsubscribed once they disconnect
+	conn.Close()
+	assert.Eventually(func() bool {
+		return events.feed.Send(&watchers.ProtocolEvent{Name: "Bond"}) == 0
+	}, time.Second, 10*time.Millisecond)
+}
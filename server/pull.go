@@ -0,0 +1,371 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/segmenter"
+	"github.com/livepeer/lpms/stream"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/monitor"
+)
+
+// PullStreamStatus is the state of a stream pulled from a source URL
+type PullStreamStatus string
+
+const (
+	// PullStreamStarting is a stream whose source has not produced a segment yet
+	PullStreamStarting PullStreamStatus = "starting"
+	// PullStreamLive is a stream whose segments are being transcoded
+	PullStreamLive PullStreamStatus = "live"
+	// PullStreamEnded is a stream whose source ended or that was ended on the node
+	PullStreamEnded PullStreamStatus = "ended"
+	// PullStreamFailed is a stream that could not be started or whose source failed
+	PullStreamFailed PullStreamStatus = "failed"
+)
+
+// Maximum number of streams that can be started with a single request
+const maxPullStreams = 1000
+
+// How long the status of a pulled stream is kept once it ended
+var pullStreamRetention = time.Hour
+
+var errPullSource = errors.New("pulled streams require an rtmp, rtmps, http or https source URL")
+
+// pullSegmenter segments the live source of a pulled stream until it ends or ctx is done and
+// calls onSegment with every segment. Replaced in tests
+var pullSegmenter = segmentPull
+
+// PullSegmenterCommand is the first argument of the livepeer binary when it runs as the
+// child process that segments the source of a pulled stream
+const PullSegmenterCommand = "pullsegmenter"
+
+// processPullSegment sends the segments of pulled streams through the transcoding path. Replaced in tests
+var processPullSegment = processSegment
+
+// PullStreamInfo describes a stream pulled from a source URL
+type PullStreamInfo struct {
+	ManifestID core.ManifestID  `json:"manifestID,omitempty"`
+	Source     string           `json:"source"`
+	Status     PullStreamStatus `json:"status"`
+	Error      string           `json:"error,omitempty"`
+	// Number of segments pulled from the source
+	Segments int       `json:"segments"`
+	Created  time.Time `json:"created"`
+}
+
+type pullStream struct {
+	mu    sync.Mutex
+	info  PullStreamInfo
+	ended time.Time
+}
+
+func (p *pullStream) Info() PullStreamInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.info
+}
+
+func (p *pullStream) update(f func(info *PullStreamInfo)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f(&p.info)
+	if (p.info.Status == PullStreamEnded || p.info.Status == PullStreamFailed) && p.ended.IsZero() {
+		p.ended = time.Now()
+	}
+}
+
+// expired returns whether the stream ended long enough ago to be forgotten
+func (p *pullStream) expired() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !p.ended.IsZero() && time.Since(p.ended) > pullStreamRetention
+}
+
+type pullStreamRegistry struct {
+	mu      sync.RWMutex
+	streams map[core.ManifestID]*pullStream
+}
+
+func newPullStreamRegistry() *pullStreamRegistry {
+	return &pullStreamRegistry{streams: make(map[core.ManifestID]*pullStream)}
+}
+
+func (r *pullStreamRegistry) add(mid core.ManifestID, source string) *pullStream {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for m, p := range r.streams {
+		if p.expired() {
+			delete(r.streams, m)
+		}
+	}
+	p := &pullStream{info: PullStreamInfo{ManifestID: mid, Source: source, Status: PullStreamStarting, Created: time.Now()}}
+	r.streams[mid] = p
+	return p
+}
+
+func (r *pullStreamRegistry) get(mid core.ManifestID) *pullStream {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.streams[mid]
+}
+
+func (r *pullStreamRegistry) list() []PullStreamInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	infos := make([]PullStreamInfo, 0, len(r.streams))
+	for _, p := range r.streams {
+		infos = append(infos, p.Info())
+	}
+	return infos
+}
+
+type pullSource struct {
+	URL string `json:"url"`
+	// Manifest ID of the stream. Assigned like the manifest ID of an RTMP stream if empty
+	ManifestID string `json:"manifestID"`
+}
+
+// pullRequest starts streams from several sources with the same transcoding configuration
+type pullRequest struct {
+	Sources  []pullSource         `json:"sources"`
+	Presets  []string             `json:"presets"`
+	Profiles []common.JSONProfile `json:"profiles"`
+}
+
+// HandlePull starts streams pulled from source URLs with a POST to /pull, lists the pulled
+// streams with a GET to /pull and returns the status of a stream with a GET to /pull/<manifestID>
+func (s *LivepeerServer) HandlePull(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if mid := core.ManifestID(strings.TrimPrefix(r.URL.Path, "/pull/")); mid != "" && r.URL.Path != "/pull" {
+			p := s.pullStreams.get(mid)
+			if p == nil {
+				http.Error(w, "unknown pulled stream", http.StatusNotFound)
+				return
+			}
+			respondPull(w, http.StatusOK, p.Info())
+			return
+		}
+		respondPull(w, http.StatusOK, s.pullStreams.list())
+	case http.MethodPost:
+		s.startPullStreams(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// startPullStreams starts a stream for every source of the request and returns the status of each
+// of them in the order of the sources. Sources that fail to start don't prevent the others
+func (s *LivepeerServer) startPullStreams(w http.ResponseWriter, r *http.Request) {
+	var req pullRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid pull request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(req.Sources) == 0 || len(req.Sources) > maxPullStreams {
+		http.Error(w, fmt.Sprintf("pull requests must have between 1 and %d sources", maxPullStreams), http.StatusBadRequest)
+		return
+	}
+	var profiles []ffmpeg.VideoProfile
+	var encoders common.ProfileEncoders
+	if len(req.Presets) > 0 {
+		profiles = parsePresets(req.Presets)
+	}
+	if len(req.Profiles) > 0 {
+		custom, customEncoders, err := common.JSONProfilesToFFmpegProfiles(req.Profiles)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		profiles, encoders = append(profiles, custom...), customEncoders
+	}
+
+	infos := make([]PullStreamInfo, 0, len(req.Sources))
+	for _, src := range req.Sources {
+		p, err := s.startPullStream(r, src, profiles, encoders)
+		if err != nil {
+			glog.Errorf("Error starting pulled stream source=%s: %v", src.URL, err)
+			infos = append(infos, PullStreamInfo{Source: src.URL, Status: PullStreamFailed, Error: err.Error(), Created: time.Now()})
+			continue
+		}
+		infos = append(infos, p.Info())
+	}
+	setQuotaHeaders(w, r)
+	respondPull(w, http.StatusOK, infos)
+}
+
+func (s *LivepeerServer) startPullStream(r *http.Request, src pullSource, profiles []ffmpeg.VideoProfile, encoders common.ProfileEncoders) (*pullStream, error) {
+	if err := validateSourceURL(src.URL, "rtmp", "rtmps", "http", "https"); err == errSourceScheme {
+		return nil, errPullSource
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Pulled streams go through the same authentication and stream setup as RTMP streams
+	appData := (createRTMPStreamIDHandler(s))(streamURL(r, src.ManifestID))
+	if appData == nil {
+		return nil, errors.New("could not create stream ID")
+	}
+	st := stream.NewBasicRTMPVideoStream(appData)
+	params := streamParams(st)
+	params.source = core.SessionSourcePull
+	if len(profiles) > 0 {
+		params.profiles, params.encoders = profiles, encoders
+	}
+	cxn, err := s.registerConnection(st)
+	if err != nil {
+		return nil, err
+	}
+	if monitor.Enabled {
+		monitor.StreamCreated(string(cxn.mid), cxn.nonce)
+	}
+
+	// The source stops being pulled as soon as the stream is ended on the node
+	ctx, cancel := context.WithCancel(context.Background())
+	s.connectionLock.Lock()
+	cxn.stopSource = cancel
+	s.connectionLock.Unlock()
+
+	p := s.pullStreams.add(cxn.mid, src.URL)
+	glog.Infof("Started pulled stream manifestID=%s source=%s", cxn.mid, src.URL)
+	go s.runPullStream(ctx, p, cxn, src.URL)
+	return p, nil
+}
+
+// runPullStream sends the segments of the source of a pulled stream through the transcoding path
+// until the source ends or the stream is ended on the node
+func (s *LivepeerServer) runPullStream(ctx context.Context, p *pullStream, cxn *rtmpConnection, source string) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	dir, err := ioutil.TempDir(s.LivepeerNode.WorkDir, "pull")
+	if err == nil {
+		defer os.RemoveAll(dir)
+		err = pullSegmenter(ctx, source, dir, func(seg *stream.HLSSegment) {
+			// The stream may have been ended on the node, e.g. with /endNamespaceStreams
+			s.connectionLock.RLock()
+			current := s.rtmpConnections[cxn.mid]
+			s.connectionLock.RUnlock()
+			if current != cxn {
+				cancel()
+				return
+			}
+			if seg.SeqNo == 0 && monitor.Enabled {
+				monitor.StreamStarted(cxn.nonce)
+			}
+			p.update(func(info *PullStreamInfo) {
+				info.Status = PullStreamLive
+				info.Segments++
+			})
+			s.LivepeerNode.Sessions.Touch(cxn.mid)
+			atomic.StoreUint64(&cxn.nextSeq, seg.SeqNo+1)
+			go processPullSegment(cxn, seg)
+		})
+	}
+	if ctx.Err() != nil {
+		err = nil
+	}
+
+	removeRTMPStream(s, cxn.mid)
+	p.update(func(info *PullStreamInfo) {
+		if err != nil {
+			info.Status = PullStreamFailed
+			info.Error = err.Error()
+			return
+		}
+		info.Status = PullStreamEnded
+	})
+	glog.Infof("Ended pulled stream manifestID=%s source=%s err=%v", cxn.mid, source, err)
+}
+
+func respondPull(w http.ResponseWriter, code int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+// segmentPull segments the source with the same ffmpeg segmenter as RTMP streams. ffmpeg can't
+// be interrupted, so it runs in a child process of the node that is killed when ctx is done
+func segmentPull(ctx context.Context, source, dir string, onSegment func(seg *stream.HLSSegment)) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	name := string(core.RandomManifestID())
+	segLen := strconv.FormatFloat(SegLen.Seconds(), 'f', 6, 64)
+	ctx, cancel := context.WithCancel(ctx)
+	cmd := exec.CommandContext(ctx, exe, PullSegmenterCommand, source, dir, name, segLen)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return err
+	}
+	var werr error
+	done := make(chan struct{})
+	go func() {
+		werr = cmd.Wait()
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	opts := segmenter.SegmenterOptions{SegLength: SegLen}
+	seg := segmenter.NewFFMpegVideoSegmenter(dir, name, source, opts)
+	for {
+		vseg, err := seg.PollSegment(ctx)
+		if err != nil {
+			// The segmenter times out polling for segments once ffmpeg stops writing them
+			select {
+			case <-done:
+				if werr != nil && ctx.Err() == nil {
+					return fmt.Errorf("error segmenting source: %v", werr)
+				}
+			default:
+			}
+			if err == segmenter.ErrSegmenterTimeout {
+				return nil
+			}
+			return err
+		}
+		onSegment(&stream.HLSSegment{
+			SeqNo:    vseg.SeqNo,
+			Data:     vseg.Data,
+			Name:     vseg.Name,
+			Duration: vseg.Length.Seconds(),
+		})
+	}
+}
+
+// RunPullSegmenter segments the source of a pulled stream into dir until the source ends. It runs
+// in the child process started by segmentPull with the arguments that follow PullSegmenterCommand
+func RunPullSegmenter(args []string) error {
+	if len(args) != 4 {
+		return errors.New("usage: " + PullSegmenterCommand + " <source> <dir> <name> <segLen>")
+	}
+	source, dir, name, segLen := args[0], args[1], args[2], args[3]
+	return ffmpeg.RTMPToHLS(source, filepath.Join(dir, name+".m3u8"), filepath.Join(dir, name)+"_%d.ts", segLen, 0)
+}
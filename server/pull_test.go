@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func waitPullStream(s *LivepeerServer, mid core.ManifestID) PullStreamInfo {
+	var info PullStreamInfo
+	for i := 0; i < 100; i++ {
+		info = s.pullStreams.get(mid).Info()
+		if info.Status == PullStreamEnded || info.Status == PullStreamFailed {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return info
+}
+
+func TestHandlePull(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := setupServer()
+	workDir, err := ioutil.TempDir("", "TestHandlePull")
+	require.Nil(err)
+	defer os.RemoveAll(workDir)
+	oldWorkDir := s.LivepeerNode.WorkDir
+	s.LivepeerNode.WorkDir = workDir
+	defer func() { s.LivepeerNode.WorkDir = oldWorkDir }()
+
+	oldSegmenter, oldProcess := pullSegmenter, processPullSegment
+	defer func() { pullSegmenter, processPullSegment = oldSegmenter, oldProcess }()
+
+	pullSegmenter = func(ctx context.Context, source, dir string, onSegment func(seg *stream.HLSSegment)) error {
+		if strings.HasSuffix(source, "broken") {
+			return errors.New("source failed")
+		}
+		if strings.HasSuffix(source, "endless") {
+			onSegment(&stream.HLSSegment{SeqNo: 0, Data: []byte("seg"), Duration: 2})
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		for i := uint64(0); i < 3; i++ {
+			onSegment(&stream.HLSSegment{SeqNo: i, Data: []byte("seg"), Duration: 2})
+		}
+		return nil
+	}
+	var mu sync.Mutex
+	processed := make(map[core.ManifestID]int)
+	processPullSegment = func(cxn *rtmpConnection, seg *stream.HLSSegment) error {
+		mu.Lock()
+		defer mu.Unlock()
+		processed[cxn.mid]++
+		return nil
+	}
+
+	handle := func(method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.HandlePull(w, req)
+		return w
+	}
+
+	// invalid requests
+	assert.Equal(http.StatusBadRequest, handle("POST", "/pull", "{").Code)
+	assert.Equal(http.StatusBadRequest, handle("POST", "/pull", `{"sources":[]}`).Code)
+	assert.Equal(http.StatusBadRequest, handle("POST", "/pull", `{"sources":[{"url":"rtmp://a/b"}],"profiles":[{"width":100}]}`).Code)
+	assert.Equal(http.StatusMethodNotAllowed, handle("DELETE", "/pull", "").Code)
+	assert.Equal(http.StatusNotFound, handle("GET", "/pull/unknown", "").Code)
+
+	// sources that fail to start don't prevent the others
+	body := `{"sources":[{"url":"rtmp://origin/live/pull1","manifestID":"pull1"},{"url":"file:///etc/passwd","manifestID":"pullfile"},{"url":"https://origin/broken","manifestID":"pull2"}],"presets":["P240p30fps16x9"]}`
+	w := handle("POST", "/pull", body)
+	require.Equal(http.StatusOK, w.Code)
+	var infos []PullStreamInfo
+	require.Nil(json.Unmarshal(w.Body.Bytes(), &infos))
+	require.Len(infos, 3)
+	assert.Equal(core.ManifestID("pull1"), infos[0].ManifestID)
+	assert.Equal(PullStreamFailed, infos[1].Status)
+	assert.Equal(errPullSource.Error(), infos[1].Error)
+	assert.Empty(infos[1].ManifestID)
+	assert.Equal(core.ManifestID("pull2"), infos[2].ManifestID)
+
+	// sources on the network of the node are rejected
+	w = handle("POST", "/pull", `{"sources":[{"url":"http://169.254.169.254/latest/meta-data/"}]}`)
+	require.Equal(http.StatusOK, w.Code)
+	infos = nil
+	require.Nil(json.Unmarshal(w.Body.Bytes(), &infos))
+	require.Len(infos, 1)
+	assert.Equal(PullStreamFailed, infos[0].Status)
+	assert.Equal(errSourceHost.Error(), infos[0].Error)
+
+	info := waitPullStream(s, "pull1")
+	assert.Equal(PullStreamEnded, info.Status)
+	assert.Equal(3, info.Segments)
+	info = waitPullStream(s, "pull2")
+	assert.Equal(PullStreamFailed, info.Status)
+	assert.Equal("source failed", info.Error)
+
+	mu.Lock()
+	assert.Equal(3, processed["pull1"])
+	mu.Unlock()
+
+	// streams are removed once their source ended
+	s.connectionLock.RLock()
+	_, exists := s.rtmpConnections["pull1"]
+	s.connectionLock.RUnlock()
+	assert.False(exists)
+
+	// status of a single stream and list of streams
+	w = handle("GET", "/pull/pull1", "")
+	require.Equal(http.StatusOK, w.Code)
+	require.Nil(json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal("rtmp://origin/live/pull1", info.Source)
+	assert.Equal(PullStreamEnded, info.Status)
+
+	w = handle("GET", "/pull", "")
+	require.Equal(http.StatusOK, w.Code)
+	infos = nil
+	require.Nil(json.Unmarshal(w.Body.Bytes(), &infos))
+	assert.Len(infos, 2)
+
+	// sources stop being pulled once their stream is ended on the node
+	w = handle("POST", "/pull", `{"sources":[{"url":"rtmp://origin/live/endless","manifestID":"pull3"}]}`)
+	require.Equal(http.StatusOK, w.Code)
+	for i := 0; i < 100 && s.pullStreams.get("pull3").Info().Status != PullStreamLive; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Nil(removeRTMPStream(s, "pull3"))
+	info = waitPullStream(s, "pull3")
+	assert.Equal(PullStreamEnded, info.Status)
+	assert.Empty(info.Error)
+}
+
+func TestPullStreamRegistry_Retention(t *testing.T) {
+	assert := assert.New(t)
+
+	oldRetention := pullStreamRetention
+	defer func() { pullStreamRetention = oldRetention }()
+	pullStreamRetention = 0
+
+	r := newPullStreamRegistry()
+	ended := r.add("a", "rtmp://a")
+	live := r.add("b", "rtmp://b")
+	live.update(func(info *PullStreamInfo) { info.Status = PullStreamLive })
+	ended.update(func(info *PullStreamInfo) { info.Status = PullStreamEnded })
+	time.Sleep(time.Millisecond)
+
+	// ended streams are forgotten once the retention elapsed
+	r.add("c", "rtmp://c")
+	assert.Nil(r.get("a"))
+	assert.NotNil(r.get("b"))
+	assert.NotNil(r.get("c"))
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+)
+
+var errPurgeTarget = errors.New("purge requires either a manifestID or a namespace")
+
+// PurgeReport lists the artifacts of the streams that were purged
+type PurgeReport struct {
+	ManifestID string `json:"manifestID,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+	// Names of the objects deleted from the node's storage
+	Objects []string `json:"objects"`
+	// Number of entries removed from the credit ledger
+	LedgerEntries int `json:"ledgerEntries"`
+	// Number of VOD jobs removed
+	VODJobs int `json:"vodJobs"`
+	// Number of exchanges removed from the protocol archive. Their payloads are listed in Objects
+	ArchivedExchanges int `json:"archivedExchanges"`
+	// Number of debug capture files deleted
+	DebugCaptures int `json:"debugCaptures"`
+	// Streams and VOD jobs that are running and were not purged
+	Active []string `json:"active,omitempty"`
+	// Artifacts that were not purged, with the reason
+	NotPurged map[string]string `json:"notPurged,omitempty"`
+	Errors    []string          `json:"errors,omitempty"`
+}
+
+// Purge deletes the artifacts that the node persisted for a stream or for all the streams in
+// a namespace, e.g. a tenant: the stream's segments, recordings, thumbnails and VOD assets in
+// the node's storage, its credit ledger entries, its VOD jobs, its exchanges in the protocol
+// archive and its debug captures. Running streams are skipped
+func (s *LivepeerServer) Purge(mid core.ManifestID, namespace string) (*PurgeReport, error) {
+	var match func(core.ManifestID) bool
+	var prefix string
+	switch {
+	case mid != "" && namespace == "":
+		if strings.Contains(string(mid), "/") || mid == RecordingsPrefix || mid == VODPrefix {
+			return nil, errPurgeTarget
+		}
+		match = func(m core.ManifestID) bool { return m == mid }
+		prefix = string(mid) + "/"
+	case mid == "" && namespace != "":
+		if err := core.ValidateNamespace(namespace); err != nil {
+			return nil, err
+		}
+		match = func(m core.ManifestID) bool { return m.Namespace() == namespace }
+		prefix = namespace + core.ManifestIDNamespaceSeparator
+	default:
+		return nil, errPurgeTarget
+	}
+
+	report := &PurgeReport{
+		ManifestID: string(mid),
+		Namespace:  namespace,
+		Objects:    []string{},
+		NotPurged:  make(map[string]string),
+	}
+	active := s.activeStreams(match)
+	for m := range active {
+		report.Active = append(report.Active, string(m))
+	}
+	sort.Strings(report.Active)
+	purge := func(m core.ManifestID) bool { return match(m) && !active[m] }
+
+	s.purgeStorage(prefix, purge, report)
+	if s.LivepeerNode.Balances != nil {
+		report.LedgerEntries = s.LivepeerNode.Balances.PurgeLedger(purge)
+	}
+	report.VODJobs = s.vodJobs.remove(purge)
+	if Archive != nil {
+		exchanges, objects, err := Archive.Purge(purge)
+		report.ArchivedExchanges = exchanges
+		report.Objects = append(report.Objects, objects...)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+	}
+	captures, err := purgeDebugCaptures(filepath.Join(s.LivepeerNode.WorkDir, debugCaptureDir), purge)
+	report.DebugCaptures = captures
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	}
+	report.NotPurged["logs"] = "logs are not indexed by stream"
+
+	glog.Infof("Purged manifestID=%s namespace=%s objects=%d ledgerEntries=%d vodJobs=%d archivedExchanges=%d debugCaptures=%d active=%d errors=%d",
+		mid, namespace, len(report.Objects), report.LedgerEntries, report.VODJobs, report.ArchivedExchanges, report.DebugCaptures, len(report.Active), len(report.Errors))
+	return report, nil
+}
+
+// activeStreams returns the streams and VOD jobs matched by match that are running
+func (s *LivepeerServer) activeStreams(match func(core.ManifestID) bool) map[core.ManifestID]bool {
+	active := make(map[core.ManifestID]bool)
+	s.connectionLock.RLock()
+	for m := range s.rtmpConnections {
+		if match(m) {
+			active[m] = true
+		}
+	}
+	s.connectionLock.RUnlock()
+
+	s.vodJobs.mu.RLock()
+	for m, job := range s.vodJobs.jobs {
+		if match(m) && !job.Info().done() {
+			active[m] = true
+		}
+	}
+	s.vodJobs.mu.RUnlock()
+	return active
+}
+
+// purgeStorage deletes the objects of the purged streams from the node's storage. Streams are
+// saved under their manifest ID at the root of the storage, under RecordingsPrefix if they
+// are recorded and under VODPrefix for VOD jobs
+func (s *LivepeerServer) purgeStorage(prefix string, purge func(core.ManifestID) bool, report *PurgeReport) {
+	if _, ok := drivers.NodeStorage.(*drivers.MemoryOS); ok || drivers.NodeStorage == nil {
+		report.NotPurged["storage"] = "segments in memory are deleted when their stream ends"
+		return
+	}
+	pruner, ok := drivers.StoragePruner(drivers.NodeStorage)
+	if !ok {
+		report.NotPurged["storage"] = "the storage does not support deleting data"
+		return
+	}
+
+	for _, dir := range []string{"", RecordingsPrefix, VODPrefix} {
+		listPrefix := prefix
+		if dir != "" {
+			listPrefix = dir + "/" + prefix
+		}
+		objects, err := pruner.ListData(listPrefix)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			continue
+		}
+		var names []string
+		for _, obj := range objects {
+			if !strings.HasPrefix(obj.Name, listPrefix) {
+				continue
+			}
+			name := obj.Name
+			if dir != "" {
+				name = strings.TrimPrefix(name, dir+"/")
+			}
+			parts := strings.SplitN(name, "/", 2)
+			if len(parts) != 2 || !purge(core.ManifestID(parts[0])) {
+				continue
+			}
+			names = append(names, obj.Name)
+		}
+		if len(names) == 0 {
+			continue
+		}
+		if err := pruner.DeleteData(names); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			continue
+		}
+		report.Objects = append(report.Objects, names...)
+	}
+}
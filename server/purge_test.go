@@ -0,0 +1,203 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+)
+
+// pruningOS is a storage that can list and delete its data
+type pruningOS struct {
+	drivers.OSDriver
+	*stubPruner
+}
+
+func newPurgeTestServer() *LivepeerServer {
+	n, _ := core.NewLivepeerNode(nil, "", nil)
+	return &LivepeerServer{
+		LivepeerNode:    n,
+		connectionLock:  &sync.RWMutex{},
+		rtmpConnections: make(map[core.ManifestID]*rtmpConnection),
+		vodJobs:         newVODJobRegistry(),
+	}
+}
+
+func TestPurge_Target(t *testing.T) {
+	assert := assert.New(t)
+	s := newPurgeTestServer()
+
+	for _, target := range [][2]string{{"", ""}, {"mid", "ns"}, {"a/b", ""}, {RecordingsPrefix, ""}, {VODPrefix, ""}} {
+		_, err := s.Purge(core.ManifestID(target[0]), target[1])
+		assert.Equal(errPurgeTarget, err)
+	}
+	_, err := s.Purge("", "not/a namespace")
+	assert.NotNil(err)
+}
+
+func TestPurge_Storage(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	oldStorage := drivers.NodeStorage
+	defer func() { drivers.NodeStorage = oldStorage }()
+	pruner := &stubPruner{}
+	for _, name := range []string{
+		"ns_1/source/1.ts",
+		"ns_1/thumbnail.jpg",
+		"ns_2/source/1.ts",
+		"ns_10/source/1.ts",
+		"other_1/source/1.ts",
+		"recordings/ns_1/source/1.ts",
+		"recordings/ns_1/index.m3u8",
+		"recordings/ns_2/source/1.ts",
+		"vod/ns_1/source/1.ts",
+	} {
+		pruner.objects = append(pruner.objects, drivers.ObjectInfo{Name: name})
+	}
+	drivers.NodeStorage = &pruningOS{OSDriver: drivers.NewMemoryDriver(nil), stubPruner: pruner}
+
+	s := newPurgeTestServer()
+	s.vodJobs.add("ns_1").update(func(info *VODJobInfo) { info.Status = VODJobComplete })
+
+	report, err := s.Purge("ns_1", "")
+	require.Nil(err)
+	assert.Equal("ns_1", report.ManifestID)
+	expected := []string{
+		"ns_1/source/1.ts",
+		"ns_1/thumbnail.jpg",
+		"recordings/ns_1/source/1.ts",
+		"recordings/ns_1/index.m3u8",
+		"vod/ns_1/source/1.ts",
+	}
+	assert.Equal(expected, report.Objects)
+	assert.Equal(expected, pruner.deleted)
+	assert.Equal(1, report.VODJobs)
+	assert.Nil(s.vodJobs.get("ns_1"))
+	assert.Empty(report.Active)
+	assert.Empty(report.Errors)
+	assert.Contains(report.NotPurged, "logs")
+
+	// Running streams of the namespace are skipped
+	var remaining []drivers.ObjectInfo
+	for _, obj := range pruner.objects {
+		if !strings.HasPrefix(obj.Name, "ns_1/") && !strings.Contains(obj.Name, "/ns_1/") {
+			remaining = append(remaining, obj)
+		}
+	}
+	pruner.objects, pruner.deleted = remaining, nil
+	s.rtmpConnections["ns_2"] = &rtmpConnection{}
+	s.vodJobs.add("ns_10")
+	report, err = s.Purge("", "ns")
+	require.Nil(err)
+	assert.Equal([]string{"ns_10", "ns_2"}, report.Active)
+	assert.Empty(report.Objects)
+	assert.Zero(report.VODJobs)
+
+	delete(s.rtmpConnections, "ns_2")
+	report, err = s.Purge("", "ns")
+	require.Nil(err)
+	sort.Strings(report.Objects)
+	assert.Equal([]string{"ns_2/source/1.ts", "recordings/ns_2/source/1.ts"}, report.Objects)
+	assert.Equal([]string{"ns_10"}, report.Active)
+}
+
+func TestPurge_MemoryStorage(t *testing.T) {
+	oldStorage := drivers.NodeStorage
+	defer func() { drivers.NodeStorage = oldStorage }()
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+
+	report, err := newPurgeTestServer().Purge("mid", "")
+	require.Nil(t, err)
+	assert.Empty(t, report.Objects)
+	assert.Contains(t, report.NotPurged, "storage")
+}
+
+func TestPurge_Archive(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	oldStorage, oldArchive := drivers.NodeStorage, Archive
+	defer func() { drivers.NodeStorage, Archive = oldStorage, oldArchive }()
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	a, storage, cleanup := tempProtocolArchive(t)
+	defer cleanup()
+	Archive = a
+
+	purged, payloads := signedExchange(t)
+	purged.ManifestID = "ns_1"
+	_, err := a.Record(purged, payloads)
+	require.Nil(err)
+	kept, payloads := signedExchange(t)
+	kept.ManifestID = "other_1"
+	_, err = a.Record(kept, payloads)
+	require.Nil(err)
+
+	// The exchanges of the purged streams are deleted with their payloads
+	report, err := newPurgeTestServer().Purge("", "ns")
+	require.Nil(err)
+	assert.Equal(1, report.ArchivedExchanges)
+	assert.Equal(purged.Payloads, report.Objects)
+	assert.Empty(report.Errors)
+	assert.Len(storage.objects, len(kept.Payloads))
+	exs, err := a.Exchanges(time.Unix(0, 0), time.Now())
+	require.Nil(err)
+	require.Len(exs, 1)
+	assert.Equal("other_1", exs[0].ManifestID)
+}
+
+func TestPurge_DebugCaptures(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	oldStorage := drivers.NodeStorage
+	defer func() { drivers.NodeStorage = oldStorage }()
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	workDir, err := ioutil.TempDir("", "TestPurge_DebugCaptures")
+	require.Nil(err)
+	defer os.RemoveAll(workDir)
+	dir := filepath.Join(workDir, debugCaptureDir)
+
+	s := newPurgeTestServer()
+	s.LivepeerNode.WorkDir = workDir
+
+	// Nothing was captured
+	report, err := s.Purge("", "ns")
+	require.Nil(err)
+	assert.Zero(report.DebugCaptures)
+
+	// Captures in progress of purged streams are stopped and deleted
+	_, err = startDebugCapture(dir, "ns_1", time.Minute, 1000)
+	require.Nil(err)
+	_, err = startDebugCapture(dir, "other_1", time.Minute, 1000)
+	require.Nil(err)
+	defer stopDebugCapture("other_1")
+	require.Nil(ioutil.WriteFile(filepath.Join(dir, "ns_2-100.log"), []byte("{}"), 0600))
+	require.Nil(ioutil.WriteFile(filepath.Join(dir, "ns_2.txt"), []byte("{}"), 0600))
+
+	report, err = s.Purge("", "ns")
+	require.Nil(err)
+	assert.Equal(2, report.DebugCaptures)
+	assert.Empty(report.Errors)
+	assert.False(debugCaptured("ns_1"))
+	assert.True(debugCaptured("other_1"))
+	files, err := ioutil.ReadDir(dir)
+	require.Nil(err)
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	require.Len(names, 2)
+	assert.Contains(names, "ns_2.txt")
+	assert.True(strings.HasPrefix(names[0], "other_1-") || strings.HasPrefix(names[1], "other_1-"))
+}
@@ -1,6 +1,8 @@
 package server
 
 import (
+	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
@@ -26,6 +28,15 @@ func requestSetup(s *LivepeerServer) (http.Handler, *strings.Reader, *httptest.R
 	return handler, reader, writer
 }
 
+// resetStreams forgets the streams of the server along with their sessions and manifest IDs
+func resetStreams(s *LivepeerServer) {
+	for mid := range s.rtmpConnections {
+		s.LivepeerNode.Sessions.Stop(mid)
+		s.manifestIDs.Release(mid)
+	}
+	s.rtmpConnections = map[core.ManifestID]*rtmpConnection{}
+}
+
 func TestNoErrors(t *testing.T) {
 	assert := assert.New(t)
 	handler, reader, w := requestSetup(setupServer())
@@ -124,7 +135,7 @@ func TestForAuthWebhookFailure(t *testing.T) {
 func TestResolutionWithoutContentResolutionHeader(t *testing.T) {
 	assert := assert.New(t)
 	server := setupServer()
-	server.rtmpConnections = map[core.ManifestID]*rtmpConnection{}
+	resetStreams(server)
 	handler, reader, w := requestSetup(server)
 	req := httptest.NewRequest("POST", "/live/seg.ts", reader)
 	defaultRes := "0x0"
@@ -137,13 +148,13 @@ func TestResolutionWithoutContentResolutionHeader(t *testing.T) {
 		assert.Equal(cxn.profile.Resolution, defaultRes)
 	}
 
-	server.rtmpConnections = map[core.ManifestID]*rtmpConnection{}
+	resetStreams(server)
 }
 
 func TestResolutionWithContentResolutionHeader(t *testing.T) {
 	assert := assert.New(t)
 	server := setupServer()
-	server.rtmpConnections = map[core.ManifestID]*rtmpConnection{}
+	resetStreams(server)
 	handler, reader, w := requestSetup(server)
 	req := httptest.NewRequest("POST", "/live/seg.ts", reader)
 	resolution := "123x456"
@@ -157,7 +168,7 @@ func TestResolutionWithContentResolutionHeader(t *testing.T) {
 		assert.Equal(resolution, cxn.profile.Resolution)
 	}
 
-	server.rtmpConnections = map[core.ManifestID]*rtmpConnection{}
+	resetStreams(server)
 }
 
 func TestWebhookRequestURL(t *testing.T) {
@@ -180,6 +191,7 @@ func TestWebhookRequestURL(t *testing.T) {
 	defer ts.Close()
 
 	AuthWebhookURL = ts.URL
+	defer func() { AuthWebhookURL = "" }()
 	handler, reader, w := requestSetup(s)
 	req := httptest.NewRequest("POST", "/live/seg.ts", reader)
 	handler.ServeHTTP(w, req)
@@ -188,3 +200,100 @@ func TestWebhookRequestURL(t *testing.T) {
 
 	assert.Equal(200, resp.StatusCode)
 }
+
+// testMP4Box builds an MP4 box with a payload of n bytes
+func testMP4Box(boxType string, n int) []byte {
+	box := make([]byte, 8+n)
+	binary.BigEndian.PutUint32(box, uint32(len(box)))
+	copy(box[4:], boxType)
+	return box
+}
+
+func TestPushFMP4(t *testing.T) {
+	assert := assert.New(t)
+	s := setupServer()
+	defer func() { s.rtmpConnections = map[core.ManifestID]*rtmpConnection{} }()
+
+	oldRemux := remuxFMP4
+	defer func() { remuxFMP4 = oldRemux }()
+	var remuxed [][]byte
+	remuxFMP4 = func(workDir string, data []byte) ([]byte, error) {
+		remuxed = append(remuxed, data)
+		return []byte("ts"), nil
+	}
+
+	push := func(name, contentType string, data []byte) int {
+		req := httptest.NewRequest("POST", "/live/"+name, bytes.NewReader(data))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		w := httptest.NewRecorder()
+		s.HandlePush(w, req)
+		return w.Result().StatusCode
+	}
+
+	init := append(testMP4Box("ftyp", 8), testMP4Box("moov", 16)...)
+	fragment := append(testMP4Box("moof", 16), testMP4Box("mdat", 32)...)
+
+	// Fragments need the initialization segment of their stream
+	assert.Equal(http.StatusBadRequest, push("fmp4/1.m4s", "", fragment))
+	assert.Equal(http.StatusBadRequest, push("fmp4/init.mp4", "", []byte("not mp4")))
+	assert.Empty(remuxed)
+
+	assert.Equal(http.StatusOK, push("fmp4/init.mp4", "", init))
+	assert.Empty(remuxed)
+	assert.Equal(http.StatusOK, push("fmp4/2", "video/iso.segment", fragment))
+	assert.Equal([][]byte{append(append([]byte{}, init...), fragment...)}, remuxed)
+
+	// Self-contained segments are remuxed as they are
+	assert.Equal(http.StatusOK, push("fmp4whole/1.mp4", "", append(init, fragment...)))
+	assert.Len(remuxed, 2)
+	assert.Equal(append(init, fragment...), remuxed[1])
+}
+
+func TestMP4Boxes(t *testing.T) {
+	assert := assert.New(t)
+
+	boxes, err := mp4Boxes(append(testMP4Box("moof", 0), testMP4Box("mdat", 10)...))
+	assert.Nil(err)
+	assert.Equal(map[string]bool{"moof": true, "mdat": true}, boxes)
+
+	// 64 bit sizes and boxes that extend to the end of the data
+	large := make([]byte, 20)
+	binary.BigEndian.PutUint32(large, 1)
+	copy(large[4:], "mdat")
+	binary.BigEndian.PutUint64(large[8:], 20)
+	last := testMP4Box("free", 4)
+	binary.BigEndian.PutUint32(last, 0)
+	boxes, err = mp4Boxes(append(large, last...))
+	assert.Nil(err)
+	assert.Equal(map[string]bool{"mdat": true, "free": true}, boxes)
+
+	for _, data := range [][]byte{[]byte("not mp4"), testMP4Box("moof", 8)[:12], {0, 0, 0, 4, 'm', 'o', 'o', 'f'}} {
+		_, err := mp4Boxes(data)
+		assert.Equal(errMP4Data, err)
+	}
+}
+
+func TestPushFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	for name, format := range map[string]string{"1.ts": pushFormatTS, "1.m4s": pushFormatFMP4, "init.mp4": pushFormatFMP4, "index.m3u8": ""} {
+		assert.Equal(format, pushFormat(httptest.NewRequest("POST", "/live/movie/"+name, nil)), name)
+	}
+	req := httptest.NewRequest("POST", "/live/movie/1", nil)
+	assert.Equal("", pushFormat(req))
+	req.Header.Set("Content-Type", "video/MP2T")
+	assert.Equal(pushFormatTS, pushFormat(req))
+	req.Header.Set("Content-Type", "video/mp4; codecs=\"avc1.64001f\"")
+	assert.Equal(pushFormatFMP4, pushFormat(req))
+}
+
+func TestPushSeqNo(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(uint64(12), pushSeqNo("index12.ts"))
+	assert.Equal(uint64(3), pushSeqNo("3.m4s"))
+	assert.Equal(uint64(0), pushSeqNo("seg.ts"))
+	assert.Equal(uint64(0), pushSeqNo("99999999999999999999999.ts"))
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/livepeer/go-livepeer/core"
+)
+
+// BroadcastQuotas enforces the quotas of the API keys that streams are created with, which
+// streams must then be created with. Quotas are not enforced if nil
+var BroadcastQuotas *core.StreamQuotas
+
+// BroadcastQuotasFile is the file that the quotas are loaded from and saved to when they are managed
+var BroadcastQuotasFile string
+
+// jsonQuota is a quota as it is stored in the quotas file
+type jsonQuota struct {
+	MaxStreams       int     `json:"maxStreams,omitempty"`
+	MaxMinutesPerDay float64 `json:"maxMinutesPerDay,omitempty"`
+	// Wei, as an integer string
+	MaxSpendPerDay string `json:"maxSpendPerDay,omitempty"`
+}
+
+type jsonQuotaStatus struct {
+	APIKey  string    `json:"apiKey"`
+	Quota   jsonQuota `json:"quota"`
+	Streams int       `json:"streams"`
+	Minutes float64   `json:"minutes"`
+	Spend   string    `json:"spend"`
+}
+
+func toJSONQuota(q core.Quota) jsonQuota {
+	jq := jsonQuota{MaxStreams: q.MaxStreams, MaxMinutesPerDay: q.MaxMinutesPerDay}
+	if q.MaxSpendPerDay != nil {
+		jq.MaxSpendPerDay = q.MaxSpendPerDay.FloatString(0)
+	}
+	return jq
+}
+
+func fromJSONQuota(jq jsonQuota) (core.Quota, error) {
+	q := core.Quota{MaxStreams: jq.MaxStreams, MaxMinutesPerDay: jq.MaxMinutesPerDay}
+	if q.MaxStreams < 0 || q.MaxMinutesPerDay < 0 {
+		return q, fmt.Errorf("quota limits must not be negative")
+	}
+	if jq.MaxSpendPerDay != "" {
+		spend, ok := new(big.Int).SetString(jq.MaxSpendPerDay, 10)
+		if !ok || spend.Sign() < 0 {
+			return q, fmt.Errorf("invalid maxSpendPerDay %v", jq.MaxSpendPerDay)
+		}
+		q.MaxSpendPerDay = new(big.Rat).SetInt(spend)
+	}
+	return q, nil
+}
+
+// LoadQuotas reads the quotas by API key from a JSON file, e.g.
+// {"key1": {"maxStreams": 10, "maxMinutesPerDay": 1440, "maxSpendPerDay": "1000000000000000"}}.
+// No quotas are loaded if the file doesn't exist
+func LoadQuotas(path string) (map[string]core.Quota, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]core.Quota{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var jquotas map[string]jsonQuota
+	if err := json.Unmarshal(data, &jquotas); err != nil {
+		return nil, fmt.Errorf("unable to parse quotas: %v", err)
+	}
+	quotas := make(map[string]core.Quota, len(jquotas))
+	for key, jq := range jquotas {
+		if key == "" {
+			return nil, fmt.Errorf("quotas require an API key")
+		}
+		q, err := fromJSONQuota(jq)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quota of API key %v: %v", key, err)
+		}
+		quotas[key] = q
+	}
+	return quotas, nil
+}
+
+// saveQuotas writes the quotas to the quotas file, through a temporary file so that a failed
+// write doesn't lose the quotas
+func saveQuotas(path string, quotas map[string]core.Quota) error {
+	if path == "" {
+		return nil
+	}
+	jquotas := make(map[string]jsonQuota, len(quotas))
+	for key, q := range quotas {
+		jquotas[key] = toJSONQuota(q)
+	}
+	data, err := json.MarshalIndent(jquotas, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "quotas")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// quotaStatuses returns the statuses of the quotas for the CLI
+func quotaStatuses(quotas *core.StreamQuotas) []jsonQuotaStatus {
+	statuses := quotas.Statuses()
+	res := make([]jsonQuotaStatus, len(statuses))
+	for i, st := range statuses {
+		res[i] = jsonQuotaStatus{
+			APIKey:  st.APIKey,
+			Quota:   toJSONQuota(st.Quota),
+			Streams: st.Streams,
+			Minutes: st.Minutes,
+			Spend:   st.Spend.FloatString(0),
+		}
+	}
+	return res
+}
+
+// setQuota adds or replaces the quota of an API key from the form values of a CLI request
+func setQuota(quotas *core.StreamQuotas, r *http.Request) error {
+	key := r.FormValue("apiKey")
+	if key == "" {
+		return fmt.Errorf("missing apiKey")
+	}
+	var jq jsonQuota
+	var err error
+	if v := r.FormValue("maxStreams"); v != "" {
+		if jq.MaxStreams, err = strconv.Atoi(v); err != nil {
+			return fmt.Errorf("invalid maxStreams %v", v)
+		}
+	}
+	if v := r.FormValue("maxMinutesPerDay"); v != "" {
+		if jq.MaxMinutesPerDay, err = strconv.ParseFloat(v, 64); err != nil {
+			return fmt.Errorf("invalid maxMinutesPerDay %v", v)
+		}
+	}
+	jq.MaxSpendPerDay = r.FormValue("maxSpendPerDay")
+	q, err := fromJSONQuota(jq)
+	if err != nil {
+		return err
+	}
+	quotas.SetQuota(key, q)
+	return saveQuotas(BroadcastQuotasFile, quotas.Quotas())
+}
+
+// removeQuota removes the quota of an API key from the form values of a CLI request
+func removeQuota(quotas *core.StreamQuotas, r *http.Request) error {
+	key := r.FormValue("apiKey")
+	if !quotas.RemoveQuota(key) {
+		return fmt.Errorf("unknown API key %v", key)
+	}
+	return saveQuotas(BroadcastQuotasFile, quotas.Quotas())
+}
+
+// streamURL is the URL that streams created by an HTTP API are authenticated with, which keeps
+// the API key of the request
+func streamURL(r *http.Request, mid string) *url.URL {
+	u := &url.URL{Scheme: "http", Host: r.Host, Path: "/" + mid}
+	if key := r.URL.Query().Get("apiKey"); key != "" {
+		u.RawQuery = url.Values{"apiKey": {key}}.Encode()
+	}
+	return u
+}
+
+// setQuotaHeaders surfaces the status of the quota of the API key of a request in its response,
+// as used/limit for each limit or only used if there is no limit
+func setQuotaHeaders(w http.ResponseWriter, r *http.Request) {
+	if BroadcastQuotas == nil {
+		return
+	}
+	st, ok := BroadcastQuotas.Status(r.URL.Query().Get("apiKey"))
+	if !ok {
+		return
+	}
+	streams := strconv.Itoa(st.Streams)
+	if st.Quota.MaxStreams > 0 {
+		streams += "/" + strconv.Itoa(st.Quota.MaxStreams)
+	}
+	minutes := strconv.FormatFloat(st.Minutes, 'f', 2, 64)
+	if st.Quota.MaxMinutesPerDay > 0 {
+		minutes += "/" + strconv.FormatFloat(st.Quota.MaxMinutesPerDay, 'f', 2, 64)
+	}
+	spend := st.Spend.FloatString(0)
+	if st.Quota.MaxSpendPerDay != nil && st.Quota.MaxSpendPerDay.Sign() > 0 {
+		spend += "/" + st.Quota.MaxSpendPerDay.FloatString(0)
+	}
+	w.Header().Set("Livepeer-Quota-Streams", streams)
+	w.Header().Set("Livepeer-Quota-Minutes", minutes)
+	w.Header().Set("Livepeer-Quota-Spend", spend)
+}
+
+// streamErrorCode returns the HTTP status code of an error creating or transcoding a stream
+func streamErrorCode(err error) int {
+	switch err {
+	case core.ErrQuotaUnknownKey:
+		return http.StatusForbidden
+	case core.ErrQuotaStreams, core.ErrQuotaMinutes, core.ErrQuotaSpend:
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadQuotas(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "TestLoadQuotas")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "quotas.json")
+
+	// A missing file has no quotas
+	quotas, err := LoadQuotas(path)
+	require.Nil(err)
+	assert.Empty(quotas)
+
+	expected := map[string]core.Quota{
+		"foo": {MaxStreams: 10, MaxMinutesPerDay: 60, MaxSpendPerDay: big.NewRat(1000, 1)},
+		"bar": {MaxStreams: 1},
+	}
+	require.Nil(saveQuotas(path, expected))
+	quotas, err = LoadQuotas(path)
+	require.Nil(err)
+	assert.Equal(expected, quotas)
+
+	for _, data := range []string{"{", `{"": {}}`, `{"foo": {"maxStreams": -1}}`, `{"foo": {"maxSpendPerDay": "x"}}`, `{"foo": {"maxSpendPerDay": "-1"}}`} {
+		require.Nil(ioutil.WriteFile(path, []byte(data), 0644))
+		_, err := LoadQuotas(path)
+		assert.NotNil(err, data)
+	}
+}
+
+func TestSetRemoveQuota(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "TestSetRemoveQuota")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	defer func() { BroadcastQuotasFile = "" }()
+	BroadcastQuotasFile = filepath.Join(dir, "quotas.json")
+
+	form := func(values url.Values) *http.Request {
+		req := httptest.NewRequest("POST", "/setQuota", strings.NewReader(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req
+	}
+
+	quotas := core.NewStreamQuotas(nil)
+	assert.NotNil(setQuota(quotas, form(url.Values{})))
+	assert.NotNil(setQuota(quotas, form(url.Values{"apiKey": {"foo"}, "maxStreams": {"x"}})))
+	assert.NotNil(setQuota(quotas, form(url.Values{"apiKey": {"foo"}, "maxMinutesPerDay": {"x"}})))
+	assert.NotNil(setQuota(quotas, form(url.Values{"apiKey": {"foo"}, "maxSpendPerDay": {"1.5"}})))
+	assert.Empty(quotas.Quotas())
+
+	require.Nil(setQuota(quotas, form(url.Values{"apiKey": {"foo"}, "maxStreams": {"2"}, "maxMinutesPerDay": {"90"}, "maxSpendPerDay": {"500"}})))
+	expected := map[string]core.Quota{"foo": {MaxStreams: 2, MaxMinutesPerDay: 90, MaxSpendPerDay: big.NewRat(500, 1)}}
+	assert.Equal(expected, quotas.Quotas())
+
+	// Quotas are saved to the quotas file
+	saved, err := LoadQuotas(BroadcastQuotasFile)
+	require.Nil(err)
+	assert.Equal(expected, saved)
+
+	statuses := quotaStatuses(quotas)
+	require.Len(statuses, 1)
+	assert.Equal(jsonQuotaStatus{APIKey: "foo", Quota: jsonQuota{MaxStreams: 2, MaxMinutesPerDay: 90, MaxSpendPerDay: "500"}, Spend: "0"}, statuses[0])
+
+	assert.NotNil(removeQuota(quotas, form(url.Values{"apiKey": {"bar"}})))
+	require.Nil(removeQuota(quotas, form(url.Values{"apiKey": {"foo"}})))
+	assert.Empty(quotas.Quotas())
+	saved, err = LoadQuotas(BroadcastQuotasFile)
+	require.Nil(err)
+	assert.Empty(saved)
+}
+
+func TestStreamQuotas(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := setupServer()
+
+	defer func() { BroadcastQuotas = nil }()
+	BroadcastQuotas = core.NewStreamQuotas(map[string]core.Quota{"foo": {MaxStreams: 1, MaxMinutesPerDay: 0.05}})
+
+	register := func(rawurl string) (*rtmpConnection, error) {
+		u, err := url.Parse(rawurl)
+		require.Nil(err)
+		params := createRTMPStreamIDHandler(s)(u)
+		require.NotNil(params)
+		return s.registerConnection(stream.NewBasicRTMPVideoStream(params))
+	}
+
+	// Streams require an API key with a quota
+	_, err := register("rtmp://localhost/quota1")
+	assert.Equal(core.ErrQuotaUnknownKey, err)
+	_, err = register("rtmp://localhost/quota1?apiKey=bar")
+	assert.Equal(core.ErrQuotaUnknownKey, err)
+
+	cxn, err := register("rtmp://localhost/quota1?apiKey=foo")
+	require.Nil(err)
+	assert.Equal("foo", cxn.params.apiKey)
+	_, err = register("rtmp://localhost/quota2?apiKey=foo")
+	assert.Equal(core.ErrQuotaStreams, err)
+	// Rejected streams are not registered
+	s.connectionLock.RLock()
+	_, exists := s.rtmpConnections["quota2"]
+	s.connectionLock.RUnlock()
+	assert.False(exists)
+
+	// Segments are not transcoded once the minutes are used
+	assert.Nil(BroadcastQuotas.Segment(cxn.mid, 0))
+	assert.Nil(BroadcastQuotas.Segment(cxn.mid, 3*time.Second))
+	assert.Equal(core.ErrQuotaMinutes, processSegment(cxn, &stream.HLSSegment{SeqNo: 1, Duration: 2}))
+
+	// The quota status is surfaced in responses
+	w := httptest.NewRecorder()
+	setQuotaHeaders(w, httptest.NewRequest("POST", "/live/quota1/1.ts?apiKey=foo", nil))
+	assert.Equal("1/1", w.Header().Get("Livepeer-Quota-Streams"))
+	assert.Equal("0.05/0.05", w.Header().Get("Livepeer-Quota-Minutes"))
+	assert.Equal("0", w.Header().Get("Livepeer-Quota-Spend"))
+
+	// Ended streams no longer count against the quota
+	require.Nil(removeRTMPStream(s, cxn.mid))
+	st, _ := BroadcastQuotas.Status("foo")
+	assert.Equal(0, st.Streams)
+
+	assert.Equal(http.StatusForbidden, streamErrorCode(core.ErrQuotaUnknownKey))
+	assert.Equal(http.StatusTooManyRequests, streamErrorCode(core.ErrQuotaMinutes))
+	assert.Equal(http.StatusInternalServerError, streamErrorCode(errStorage))
+}
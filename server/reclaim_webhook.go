@@ -0,0 +1,96 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/golang/glog"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/monitor"
+)
+
+// CreditReclaimWebhookURL is notified whenever the unused credit of a stream is reclaimed.
+// The manifest ID and sender in notifications are redacted according to the telemetry redaction mode
+var CreditReclaimWebhookURL string
+
+type creditReclaimNotification struct {
+	ManifestID string `json:"manifestID"`
+	Sender     string `json:"sender"`
+	Amount     string `json:"amount"`
+	Reason     string `json:"reason"`
+	Time       int64  `json:"time"`
+}
+
+// creditReclaimQueueSize is the number of notifications that are queued while the webhook is slow
+const creditReclaimQueueSize = 100
+
+var creditReclaimClient = &http.Client{Timeout: common.HTTPTimeout}
+
+// StartCreditReclaimNotifier posts every entry recorded in the credit ledger of balances
+// to CreditReclaimWebhookURL. It returns when the cleanup loop of balances is stopped
+func StartCreditReclaimNotifier(balances *core.Balances) {
+	if CreditReclaimWebhookURL == "" {
+		return
+	}
+
+	entries := make(chan *core.CreditLedgerEntry, 10)
+	sub := balances.SubscribeReclaim(entries)
+	defer sub.Unsubscribe()
+
+	notifyCreditReclaims(entries, sub.Err(), notifyCreditReclaim)
+}
+
+// notifyCreditReclaims passes the entries received until done is closed to notify from a separate worker,
+// so that a slow webhook does not block the balances that send the entries. Entries are dropped while
+// creditReclaimQueueSize notifications are pending
+func notifyCreditReclaims(entries <-chan *core.CreditLedgerEntry, done <-chan error, notify func(*core.CreditLedgerEntry) error) {
+	queue := make(chan *core.CreditLedgerEntry, creditReclaimQueueSize)
+	defer close(queue)
+
+	go func() {
+		for entry := range queue {
+			if err := notify(entry); err != nil {
+				glog.Errorf("Unable to notify credit reclaim webhook manifestID=%v: %v", entry.ManifestID, err)
+			}
+		}
+	}()
+
+	for {
+		select {
+		case entry := <-entries:
+			select {
+			case queue <- entry:
+			default:
+				glog.Warningf("Dropping credit reclaim notification manifestID=%v: too many pending notifications", entry.ManifestID)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+func notifyCreditReclaim(entry *core.CreditLedgerEntry) error {
+	jsonValue, err := json.Marshal(creditReclaimNotification{
+		ManifestID: monitor.Redact(string(entry.ManifestID)),
+		Sender:     monitor.RedactAddress(entry.Sender),
+		Amount:     entry.Amount.RatString(),
+		Reason:     entry.Reason,
+		Time:       entry.Time.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := creditReclaimClient.Post(CreditReclaimWebhookURL, "application/json", bytes.NewBuffer(jsonValue))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifyCreditReclaims_SlowWebhook(t *testing.T) {
+	assert := assert.New(t)
+
+	var notified int32
+	release := make(chan struct{})
+	notify := func(entry *core.CreditLedgerEntry) error {
+		<-release
+		atomic.AddInt32(&notified, 1)
+		return nil
+	}
+
+	entries := make(chan *core.CreditLedgerEntry)
+	done := make(chan error)
+	stopped := make(chan struct{})
+	go func() {
+		notifyCreditReclaims(entries, done, notify)
+		close(stopped)
+	}()
+
+	// Entries are received while the webhook is blocked, and dropped once the queue is full
+	for i := 0; i < creditReclaimQueueSize+10; i++ {
+		select {
+		case entries <- &core.CreditLedgerEntry{ManifestID: core.RandomManifestID(), Amount: big.NewRat(1, 1)}:
+		case <-time.After(time.Second):
+			assert.FailNow("Entry was not received")
+		}
+	}
+
+	close(release)
+	close(done)
+	<-stopped
+	assert.Eventually(func() bool {
+		n := atomic.LoadInt32(&notified)
+		return n >= creditReclaimQueueSize && n <= creditReclaimQueueSize+1
+	}, time.Second, 10*time.Millisecond)
+}
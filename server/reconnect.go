@@ -0,0 +1,93 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/lpms/stream"
+
+	"github.com/livepeer/go-livepeer/core"
+)
+
+// ReconnectGracePeriod is how long the stream of a publisher whose RTMP connection dropped is
+// kept before it ends. A publisher that reconnects with the same stream key within the grace
+// period resumes the same stream, with its sessions and balances. Streams end right away if 0
+var ReconnectGracePeriod time.Duration
+
+// stickinessToken identifies the publisher of a stream across reconnections. It is derived
+// from the stream key so that only a publisher that knows the key can resume the stream
+func stickinessToken(mid core.ManifestID, rtmpKey string) string {
+	h := sha256.Sum256([]byte(string(mid) + "/" + rtmpKey))
+	return hex.EncodeToString(h[:])
+}
+
+// resumable returns whether a publisher with the stream parameters params can resume the
+// existing stream cxn. Must be called with connectionLock held
+func (cxn *rtmpConnection) resumable(params *streamParameters) bool {
+	if cxn == nil || cxn.reconnect == nil || cxn.stickiness == "" {
+		return false
+	}
+	return hmac.Equal([]byte(cxn.stickiness), []byte(stickinessToken(params.mid, params.rtmpKey)))
+}
+
+// holdConnection keeps the stream of a dropped RTMP connection for ReconnectGracePeriod
+// and returns whether the stream was kept
+func (s *LivepeerServer) holdConnection(mid core.ManifestID, rtmpStrm stream.RTMPVideoStream) bool {
+	s.connectionLock.Lock()
+	defer s.connectionLock.Unlock()
+	cxn, ok := s.rtmpConnections[mid]
+	if !ok {
+		return false
+	}
+	if cxn.stream != rtmpStrm {
+		// The stream has already been resumed by another connection
+		return true
+	}
+	if cxn.stickiness == "" {
+		return false
+	}
+	cxn.reconnect = time.AfterFunc(ReconnectGracePeriod, func() {
+		s.connectionLock.Lock()
+		if s.rtmpConnections[mid] != cxn || cxn.stream != rtmpStrm || cxn.reconnect == nil {
+			s.connectionLock.Unlock()
+			return
+		}
+		// The stream can no longer be resumed once the grace period is over
+		cxn.reconnect = nil
+		s.connectionLock.Unlock()
+		glog.Infof("Publisher did not reconnect within the grace period manifestID=%s", mid)
+		removeRTMPStream(s, mid)
+	})
+	glog.Infof("Holding stream for the publisher to reconnect manifestID=%s gracePeriod=%v", mid, ReconnectGracePeriod)
+	return true
+}
+
+// resumeConnection attaches the RTMP stream of a reconnected publisher to its existing stream.
+// Returns nil if the RTMP stream does not resume a stream
+func (s *LivepeerServer) resumeConnection(rtmpStrm stream.RTMPVideoStream) *rtmpConnection {
+	params := streamParams(rtmpStrm)
+	if params == nil {
+		return nil
+	}
+
+	s.connectionLock.Lock()
+	defer s.connectionLock.Unlock()
+	cxn, ok := s.rtmpConnections[params.mid]
+	// Resumed streams are given the parameters of the existing stream
+	if !ok || cxn.params != params || !cxn.resumable(params) {
+		return nil
+	}
+	cxn.reconnect.Stop()
+	cxn.reconnect = nil
+	cxn.stream = rtmpStrm
+	// Orchestrators keep serving the stream if they are told that it was resumed
+	if nextSeq := atomic.LoadUint64(&cxn.nextSeq); nextSeq > 0 {
+		cxn.sessManager.resume(int64(nextSeq) - 1)
+	}
+	glog.Infof("Publisher reconnected manifestID=%s nextSeqNo=%d", cxn.mid, atomic.LoadUint64(&cxn.nextSeq))
+	return cxn
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/core"
+)
+
+func TestStickinessToken(t *testing.T) {
+	assert := assert.New(t)
+
+	tok := stickinessToken(core.ManifestID("mid"), "key")
+	assert.Len(tok, 64)
+	assert.Equal(tok, stickinessToken(core.ManifestID("mid"), "key"))
+	assert.NotEqual(tok, stickinessToken(core.ManifestID("mid"), "otherkey"))
+	assert.NotEqual(tok, stickinessToken(core.ManifestID("othermid"), "key"))
+
+	cxn := &rtmpConnection{stickiness: tok}
+	params := &streamParameters{mid: core.ManifestID("mid"), rtmpKey: "key"}
+	// Not resumable while the publisher is connected
+	assert.False(cxn.resumable(params))
+
+	cxn.reconnect = time.NewTimer(time.Hour)
+	defer cxn.reconnect.Stop()
+	assert.True(cxn.resumable(params))
+	assert.False(cxn.resumable(&streamParameters{mid: core.ManifestID("mid"), rtmpKey: "otherkey"}))
+
+	cxn.stickiness = ""
+	assert.False(cxn.resumable(params))
+}
+
+func TestReconnect_Resume(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	oldGrace := ReconnectGracePeriod
+	ReconnectGracePeriod = time.Hour
+	defer func() { ReconnectGracePeriod = oldGrace }()
+
+	s := setupServer()
+	s.RTMPSegmenter = &StubSegmenter{skip: true}
+	createSid := createRTMPStreamIDHandler(s)
+	handler := gotRTMPStreamHandler(s)
+	endHandler := endRTMPStreamHandler(s)
+
+	u, _ := url.Parse("rtmp://localhost/resumable/secretkey")
+	sid := createSid(u)
+	require.NotNil(sid)
+	st := stream.NewBasicRTMPVideoStream(sid)
+	require.Nil(handler(u, st))
+	mid := streamParams(st).mid
+
+	s.connectionLock.RLock()
+	cxn := s.rtmpConnections[mid]
+	s.connectionLock.RUnlock()
+	require.NotNil(cxn)
+	assert.NotEmpty(cxn.stickiness)
+	atomic.StoreUint64(&cxn.nextSeq, 5)
+
+	// The stream can't be taken over while the publisher is connected
+	assert.Nil(createSid(u))
+
+	// Stream is kept after the connection drops
+	require.Nil(endHandler(u, st))
+	s.connectionLock.RLock()
+	_, ok := s.rtmpConnections[mid]
+	s.connectionLock.RUnlock()
+	assert.True(ok)
+
+	// A different key can't resume the stream
+	wrongKey, _ := url.Parse("rtmp://localhost/resumable/wrongkey")
+	assert.Nil(createSid(wrongKey))
+
+	// Reconnecting with the same key resumes the stream
+	resumedSid := createSid(u)
+	require.NotNil(resumedSid)
+	assert.Equal(sid, resumedSid)
+	resumed := stream.NewBasicRTMPVideoStream(resumedSid)
+	require.Nil(handler(u, resumed))
+
+	s.connectionLock.RLock()
+	assert.Equal(cxn, s.rtmpConnections[mid])
+	assert.Equal(resumed, cxn.stream)
+	assert.Nil(cxn.reconnect)
+	s.connectionLock.RUnlock()
+	assert.Equal(uint64(5), atomic.LoadUint64(&cxn.nextSeq))
+
+	// The old connection can't end the resumed stream
+	require.Nil(endHandler(u, st))
+	s.connectionLock.RLock()
+	assert.Nil(cxn.reconnect)
+	s.connectionLock.RUnlock()
+
+	// Ending the stream directly cleans it up
+	require.Nil(removeRTMPStream(s, mid))
+	s.connectionLock.RLock()
+	_, ok = s.rtmpConnections[mid]
+	s.connectionLock.RUnlock()
+	assert.False(ok)
+}
+
+func TestReconnect_GracePeriodExpires(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	oldGrace := ReconnectGracePeriod
+	ReconnectGracePeriod = 50 * time.Millisecond
+	defer func() { ReconnectGracePeriod = oldGrace }()
+
+	s := setupServer()
+	s.RTMPSegmenter = &StubSegmenter{skip: true}
+	createSid := createRTMPStreamIDHandler(s)
+	handler := gotRTMPStreamHandler(s)
+	endHandler := endRTMPStreamHandler(s)
+
+	u, _ := url.Parse("rtmp://localhost/expiring/secretkey")
+	st := stream.NewBasicRTMPVideoStream(createSid(u))
+	require.Nil(handler(u, st))
+	mid := streamParams(st).mid
+	require.Nil(endHandler(u, st))
+
+	exists := func() bool {
+		s.connectionLock.RLock()
+		defer s.connectionLock.RUnlock()
+		_, ok := s.rtmpConnections[mid]
+		return ok
+	}
+	assert.True(exists())
+	start := time.Now()
+	for exists() && time.Since(start) < time.Second {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.False(exists())
+
+	// The stream is no longer resumable, but its name can be reused
+	sid := createSid(u)
+	require.NotNil(sid)
+	assert.NotEqual(streamParams(st), sid)
+}
+
+func TestReconnect_NoGracePeriod(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	s := setupServer()
+	s.RTMPSegmenter = &StubSegmenter{skip: true}
+	createSid := createRTMPStreamIDHandler(s)
+	handler := gotRTMPStreamHandler(s)
+	endHandler := endRTMPStreamHandler(s)
+
+	u, _ := url.Parse("rtmp://localhost/ungraceful/secretkey")
+	st := stream.NewBasicRTMPVideoStream(createSid(u))
+	require.Nil(handler(u, st))
+	mid := streamParams(st).mid
+
+	s.connectionLock.RLock()
+	assert.Empty(s.rtmpConnections[mid].stickiness)
+	s.connectionLock.RUnlock()
+
+	// Stream ends as soon as the connection drops
+	require.Nil(endHandler(u, st))
+	s.connectionLock.RLock()
+	_, ok := s.rtmpConnections[mid]
+	s.connectionLock.RUnlock()
+	assert.False(ok)
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/monitor"
+)
+
+// RecordingsPrefix is the path under which the segments and VOD playlists of recorded streams are saved
+const RecordingsPrefix = "recordings"
+
+// RecordingFormats are the formats of the VOD playlists written for every stream when it ends.
+// Streams are not recorded if empty
+var RecordingFormats []string
+
+// streamStoragePath returns the path under which the segments of a stream are saved to the node's storage
+func streamStoragePath(mid core.ManifestID) string {
+	if len(RecordingFormats) > 0 {
+		return path.Join(RecordingsPrefix, string(mid))
+	}
+	return string(mid)
+}
+
+// RecordingRetention deletes recordings from the node's storage once they have not been
+// modified for the retention period, i.e. some time after their stream ended
+type RecordingRetention struct {
+	pruner    drivers.OSPruner
+	retention time.Duration
+	quit      chan struct{}
+}
+
+// NewRecordingRetention creates a RecordingRetention that deletes recordings through pruner
+func NewRecordingRetention(pruner drivers.OSPruner, retention time.Duration) *RecordingRetention {
+	return &RecordingRetention{
+		pruner:    pruner,
+		retention: retention,
+		quit:      make(chan struct{}),
+	}
+}
+
+// StartPruning deletes expired recordings every interval until StopPruning is called
+func (r *RecordingRetention) StartPruning(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := r.prune(time.Now()); err != nil {
+				glog.Errorf("Error pruning recordings: %v", err)
+			}
+		case <-r.quit:
+			return
+		}
+	}
+}
+
+// StopPruning stops the pruning loop
+func (r *RecordingRetention) StopPruning() {
+	close(r.quit)
+}
+
+// prune deletes the recordings whose most recent data is older than the retention period
+// and returns the number of recordings that were deleted
+func (r *RecordingRetention) prune(now time.Time) (int, error) {
+	objects, err := r.pruner.ListData(RecordingsPrefix + "/")
+	if err != nil {
+		return 0, err
+	}
+	// Group the data of every recording by the manifest ID following the prefix
+	lastModified := make(map[string]time.Time)
+	names := make(map[string][]string)
+	for _, obj := range objects {
+		parts := strings.SplitN(strings.TrimPrefix(obj.Name, RecordingsPrefix+"/"), "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		mid := parts[0]
+		if obj.LastModified.After(lastModified[mid]) {
+			lastModified[mid] = obj.LastModified
+		}
+		names[mid] = append(names[mid], obj.Name)
+	}
+	deleted := 0
+	for mid, t := range lastModified {
+		if now.Sub(t) < r.retention {
+			continue
+		}
+		if err := r.pruner.DeleteData(names[mid]); err != nil {
+			return deleted, err
+		}
+		glog.Infof("Deleted expired recording manifestID=%s objects=%d lastModified=%v", monitor.Redact(mid), len(names[mid]), t)
+		deleted++
+	}
+	return deleted, nil
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubPruner struct {
+	objects []drivers.ObjectInfo
+	deleted []string
+	listErr error
+}
+
+func (p *stubPruner) ListData(prefix string) ([]drivers.ObjectInfo, error) {
+	return p.objects, p.listErr
+}
+
+func (p *stubPruner) DeleteData(names []string) error {
+	p.deleted = append(p.deleted, names...)
+	return nil
+}
+
+func TestStreamStoragePath(t *testing.T) {
+	assert := assert.New(t)
+
+	oldFormats := RecordingFormats
+	defer func() { RecordingFormats = oldFormats }()
+
+	RecordingFormats = nil
+	assert.Equal("mid", streamStoragePath("mid"))
+	RecordingFormats = []string{"hls"}
+	assert.Equal("recordings/mid", streamStoragePath("mid"))
+}
+
+func TestRegisterConnection_RecordingConsumer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := setupServer()
+
+	oldFormats := RecordingFormats
+	defer func() { RecordingFormats = oldFormats }()
+
+	// Streams that are not recorded have no consumer
+	RecordingFormats = nil
+	mid := core.ManifestID("notrecorded")
+	_, err := s.registerConnection(stream.NewBasicRTMPVideoStream(&streamParameters{mid: mid}))
+	require.Nil(err)
+	defer removeRTMPStream(s, mid)
+	sess, ok := s.LivepeerNode.Sessions.Get(mid)
+	require.True(ok)
+	assert.Equal(0, sess.Consumers)
+
+	// The recording consumes the stream
+	RecordingFormats = []string{"hls"}
+	mid = core.ManifestID("recorded")
+	_, err = s.registerConnection(stream.NewBasicRTMPVideoStream(&streamParameters{mid: mid}))
+	require.Nil(err)
+	defer removeRTMPStream(s, mid)
+	sess, ok = s.LivepeerNode.Sessions.Get(mid)
+	require.True(ok)
+	assert.Equal(1, sess.Consumers)
+}
+
+func TestRecordingRetention_Prune(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	pruner := &stubPruner{objects: []drivers.ObjectInfo{
+		{Name: "recordings/old/source/1.ts", LastModified: now.Add(-3 * time.Hour)},
+		{Name: "recordings/old/index.m3u8", LastModified: now.Add(-2 * time.Hour)},
+		// Recordings are kept while any of their data is recent
+		{Name: "recordings/live/source/1.ts", LastModified: now.Add(-3 * time.Hour)},
+		{Name: "recordings/live/source/2.ts", LastModified: now.Add(-time.Minute)},
+		// Data that doesn't belong to a recording is ignored
+		{Name: "recordings/stray", LastModified: now.Add(-3 * time.Hour)},
+	}}
+	r := NewRecordingRetention(pruner, time.Hour)
+
+	deleted, err := r.prune(now)
+	assert.Nil(err)
+	assert.Equal(1, deleted)
+	sort.Strings(pruner.deleted)
+	assert.Equal([]string{"recordings/old/index.m3u8", "recordings/old/source/1.ts"}, pruner.deleted)
+
+	pruner.listErr = errors.New("list error")
+	_, err = r.prune(now)
+	assert.EqualError(err, "list error")
+}
@@ -0,0 +1,278 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/golang/glog"
+
+	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/go-livepeer/pm"
+)
+
+const protoVerRedeemer = "Livepeer-Redeemer-1.0"
+
+const redeemerStatePath = "/redeemer/state"
+const redeemerTicketPath = "/redeemer/ticket"
+const redeemerMaxFloatPath = "/redeemer/maxFloat"
+
+// Operations on the recipient state that is shared by orchestrator frontends
+const (
+	redeemerOpUpdateNonce    = "updateNonce"
+	redeemerOpClearNonce     = "clearNonce"
+	redeemerOpInvalidateRand = "invalidateRand"
+	redeemerOpIsValidRand    = "isValidRand"
+)
+
+var errRedeemerOp = errors.New("Unknown redeemer operation")
+
+type redeemerStateRequest struct {
+	Op            string   `json:"op"`
+	RecipientRand *big.Int `json:"recipientRand"`
+	SenderNonce   uint32   `json:"senderNonce,omitempty"`
+}
+
+type redeemerStateResponse struct {
+	OK          bool   `json:"ok"`
+	SenderNonce uint32 `json:"senderNonce,omitempty"`
+}
+
+type redeemerMaxFloatRequest struct {
+	Sender ethcommon.Address `json:"sender"`
+}
+
+type redeemerMaxFloatResponse struct {
+	MaxFloat *big.Int `json:"maxFloat"`
+}
+
+type redeemerTicket struct {
+	Ticket *pm.Ticket `json:"ticket"`
+	Sig    []byte     `json:"sig"`
+	Seed   *big.Int   `json:"seed"`
+}
+
+// Redeemer serves the recipient state shared by the orchestrator frontends of an
+// ETH identity and redeems the winning tickets that they forward to it, so that
+// the frontends in every region accept each ticket at most once and the redemptions
+// of the identity are submitted by a single node. The max float of senders is also
+// served by the redeemer, so that the frontends don't accept more than the reserve
+// of a sender covers together
+type Redeemer struct {
+	recipient pm.Recipient
+	state     pm.RecipientStateStore
+	sm        pm.SenderMonitor
+	secret    string
+}
+
+// NewRedeemer creates a Redeemer that redeems tickets with recipient and serves state
+// and the max float of senders from sm to the frontends that authenticate with secret
+func NewRedeemer(recipient pm.Recipient, state pm.RecipientStateStore, sm pm.SenderMonitor, secret string) *Redeemer {
+	return &Redeemer{recipient: recipient, state: state, sm: sm, secret: secret}
+}
+
+// RegisterHandlers adds the endpoints of the redeemer to mux
+func (rd *Redeemer) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc(redeemerStatePath, rd.authenticated(rd.serveState))
+	mux.HandleFunc(redeemerTicketPath, rd.authenticated(rd.serveTicket))
+	mux.HandleFunc(redeemerMaxFloatPath, rd.authenticated(rd.serveMaxFloat))
+}
+
+func (rd *Redeemer) authenticated(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Header.Get("Authorization") != protoVerRedeemer || r.Header.Get("Credentials") != rd.secret {
+			glog.Error("Invalid redeemer credentials from ", r.RemoteAddr)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (rd *Redeemer) serveState(w http.ResponseWriter, r *http.Request) {
+	var req redeemerStateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RecipientRand == nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	var res redeemerStateResponse
+	var err error
+	switch req.Op {
+	case redeemerOpUpdateNonce:
+		res.OK, res.SenderNonce, err = rd.state.UpdateRecipientNonce(req.RecipientRand, req.SenderNonce)
+	case redeemerOpClearNonce:
+		err = rd.state.ClearRecipientNonce(req.RecipientRand)
+		res.OK = err == nil
+	case redeemerOpInvalidateRand:
+		err = rd.state.InvalidateRecipientRand(req.RecipientRand)
+		res.OK = err == nil
+	case redeemerOpIsValidRand:
+		res.OK, err = rd.state.IsValidRecipientRand(req.RecipientRand)
+	default:
+		http.Error(w, errRedeemerOp.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		glog.Errorf("Error serving redeemer state op=%v err=%v", req.Op, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func (rd *Redeemer) serveMaxFloat(w http.ResponseWriter, r *http.Request) {
+	var req redeemerMaxFloatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	maxFloat, err := rd.sm.MaxFloat(req.Sender)
+	if err != nil {
+		glog.Errorf("Error serving max float sender=%v err=%v", monitor.RedactAddress(req.Sender), err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&redeemerMaxFloatResponse{MaxFloat: maxFloat})
+}
+
+func (rd *Redeemer) serveTicket(w http.ResponseWriter, r *http.Request) {
+	var req redeemerTicket
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Ticket == nil || req.Seed == nil {
+		http.Error(w, "Invalid ticket", http.StatusBadRequest)
+		return
+	}
+
+	ticket := req.Ticket
+	glog.Infof("Received forwarded ticket sender=%v recipientRandHash=%x senderNonce=%v from %v", monitor.RedactAddress(ticket.Sender), ticket.RecipientRandHash, ticket.SenderNonce, r.RemoteAddr)
+	// Redemptions wait for their transaction to confirm, so the frontend isn't kept waiting
+	go func() {
+		if err := rd.recipient.RedeemWinningTicket(ticket, req.Sig, req.Seed); err != nil {
+			glog.Errorf("error redeeming forwarded ticket sender=%v recipientRandHash=%x senderNonce=%v: %v", monitor.RedactAddress(ticket.Sender), ticket.RecipientRandHash, ticket.SenderNonce, err)
+		}
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// RedeemerClient is used by orchestrator frontends to share the recipient state of
+// their ETH identity through a Redeemer and to forward their winning tickets to it
+type RedeemerClient struct {
+	uri    *url.URL
+	secret string
+	httpc  *http.Client
+}
+
+// NewRedeemerClient creates a client of the redeemer at uri
+func NewRedeemerClient(uri *url.URL, secret string) *RedeemerClient {
+	return &RedeemerClient{uri: uri, secret: secret, httpc: httpClient}
+}
+
+func (c *RedeemerClient) post(path string, req interface{}) ([]byte, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequest("POST", c.uri.String()+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", protoVerRedeemer)
+	httpReq.Header.Set("Credentials", c.secret)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpc.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return nil, fmt.Errorf("redeemer error code=%d error=%v", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+func (c *RedeemerClient) state(op string, rand *big.Int, senderNonce uint32) (*redeemerStateResponse, error) {
+	body, err := c.post(redeemerStatePath, &redeemerStateRequest{Op: op, RecipientRand: rand, SenderNonce: senderNonce})
+	if err != nil {
+		return nil, err
+	}
+	var res redeemerStateResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// UpdateRecipientNonce records the highest senderNonce received for recipientRand with the redeemer
+func (c *RedeemerClient) UpdateRecipientNonce(rand *big.Int, senderNonce uint32) (bool, uint32, error) {
+	res, err := c.state(redeemerOpUpdateNonce, rand, senderNonce)
+	if err != nil {
+		return false, 0, err
+	}
+	return res.OK, res.SenderNonce, nil
+}
+
+// ClearRecipientNonce removes the senderNonce recorded for recipientRand by the redeemer
+func (c *RedeemerClient) ClearRecipientNonce(rand *big.Int) error {
+	_, err := c.state(redeemerOpClearNonce, rand, 0)
+	return err
+}
+
+// InvalidateRecipientRand marks recipientRand as revealed with the redeemer
+func (c *RedeemerClient) InvalidateRecipientRand(rand *big.Int) error {
+	_, err := c.state(redeemerOpInvalidateRand, rand, 0)
+	return err
+}
+
+// IsValidRecipientRand returns whether recipientRand has not been revealed according to the redeemer
+func (c *RedeemerClient) IsValidRecipientRand(rand *big.Int) (bool, error) {
+	res, err := c.state(redeemerOpIsValidRand, rand, 0)
+	if err != nil {
+		return false, err
+	}
+	return res.OK, nil
+}
+
+// MaxFloat returns the max float of a sender according to the redeemer, which accounts for
+// the pending redemptions of the winning tickets of every frontend
+func (c *RedeemerClient) MaxFloat(addr ethcommon.Address) (*big.Int, error) {
+	body, err := c.post(redeemerMaxFloatPath, &redeemerMaxFloatRequest{Sender: addr})
+	if err != nil {
+		return nil, err
+	}
+	var res redeemerMaxFloatResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, err
+	}
+	if res.MaxFloat == nil {
+		return nil, errors.New("missing max float")
+	}
+	return res.MaxFloat, nil
+}
+
+// ForwardWinningTicket submits a winning ticket for redemption by the redeemer
+func (c *RedeemerClient) ForwardWinningTicket(ticket *pm.Ticket, sig []byte, seed *big.Int) error {
+	_, err := c.post(redeemerTicketPath, &redeemerTicket{Ticket: ticket, Sig: sig, Seed: seed})
+	return err
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/livepeer/go-livepeer/pm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type forwardedTicket struct {
+	ticket *pm.Ticket
+	sig    []byte
+	seed   *big.Int
+}
+
+// stubRedeemingRecipient reports the tickets that it is asked to redeem
+type stubRedeemingRecipient struct {
+	pm.Recipient
+	redeemed chan forwardedTicket
+}
+
+func (r *stubRedeemingRecipient) RedeemWinningTicket(ticket *pm.Ticket, sig []byte, seed *big.Int) error {
+	r.redeemed <- forwardedTicket{ticket, sig, seed}
+	return nil
+}
+
+// stubMaxFloatMonitor returns the max float of its senders
+type stubMaxFloatMonitor struct {
+	pm.SenderMonitor
+	maxFloat map[ethcommon.Address]*big.Int
+}
+
+func (sm *stubMaxFloatMonitor) MaxFloat(addr ethcommon.Address) (*big.Int, error) {
+	maxFloat, ok := sm.maxFloat[addr]
+	if !ok {
+		return nil, errors.New("unknown sender")
+	}
+	return maxFloat, nil
+}
+
+func TestRedeemer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	recipient := &stubRedeemingRecipient{redeemed: make(chan forwardedTicket, 1)}
+	state := pm.NewMemoryRecipientStateStore()
+	mux := http.NewServeMux()
+	sender := pm.RandAddress()
+	sm := &stubMaxFloatMonitor{maxFloat: map[ethcommon.Address]*big.Int{sender: big.NewInt(5000)}}
+	NewRedeemer(recipient, state, sm, "secret").RegisterHandlers(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	uri, _ := url.Parse(ts.URL)
+
+	// Frontends need the shared secret
+	bad := NewRedeemerClient(uri, "foo")
+	bad.httpc = ts.Client()
+	_, err := bad.IsValidRecipientRand(big.NewInt(1))
+	assert.EqualError(err, "redeemer error code=401 error=Unauthorized")
+	resp, err := ts.Client().Get(ts.URL + redeemerStatePath)
+	require.Nil(err)
+	resp.Body.Close()
+	assert.Equal(http.StatusMethodNotAllowed, resp.StatusCode)
+
+	c := NewRedeemerClient(uri, "secret")
+	c.httpc = ts.Client()
+	rand := big.NewInt(1234)
+	ok, _, err := c.UpdateRecipientNonce(rand, 2)
+	assert.Nil(err)
+	assert.True(ok)
+	// The state is shared with the redeemer
+	ok, nonce, err := state.UpdateRecipientNonce(rand, 1)
+	assert.Nil(err)
+	assert.False(ok)
+	assert.Equal(uint32(2), nonce)
+	ok, nonce, err = c.UpdateRecipientNonce(rand, 2)
+	assert.Nil(err)
+	assert.False(ok)
+	assert.Equal(uint32(2), nonce)
+	assert.Nil(c.ClearRecipientNonce(rand))
+	ok, _, err = c.UpdateRecipientNonce(rand, 1)
+	assert.Nil(err)
+	assert.True(ok)
+
+	valid, err := c.IsValidRecipientRand(rand)
+	assert.Nil(err)
+	assert.True(valid)
+	assert.Nil(c.InvalidateRecipientRand(rand))
+	valid, err = c.IsValidRecipientRand(rand)
+	assert.Nil(err)
+	assert.False(valid)
+
+	_, err = c.state("foo", rand, 0)
+	assert.True(strings.HasPrefix(err.Error(), "redeemer error code=400"))
+
+	// The max float of senders is read from the redeemer's sender monitor
+	maxFloat, err := c.MaxFloat(sender)
+	assert.Nil(err)
+	assert.Equal(int64(5000), maxFloat.Int64())
+	_, err = c.MaxFloat(pm.RandAddress())
+	assert.EqualError(err, "redeemer error code=500 error=unknown sender")
+
+	// Forwarded tickets are redeemed by the redeemer's recipient
+	ticket := &pm.Ticket{
+		Recipient:         pm.RandAddress(),
+		Sender:            pm.RandAddress(),
+		FaceValue:         big.NewInt(1000),
+		WinProb:           big.NewInt(500),
+		SenderNonce:       3,
+		RecipientRandHash: ethcommon.BytesToHash([]byte("hash")),
+		CreationRound:     10,
+	}
+	require.Nil(c.ForwardWinningTicket(ticket, []byte("sig"), big.NewInt(7)))
+	select {
+	case fwd := <-recipient.redeemed:
+		assert.Equal(ticket.Sender, fwd.ticket.Sender)
+		assert.Equal(ticket.RecipientRandHash, fwd.ticket.RecipientRandHash)
+		assert.Equal(0, ticket.FaceValue.Cmp(fwd.ticket.FaceValue))
+		assert.Equal(uint32(3), fwd.ticket.SenderNonce)
+		assert.Equal([]byte("sig"), fwd.sig)
+		assert.Equal(int64(7), fwd.seed.Int64())
+	case <-time.After(time.Second):
+		t.Fatal("ticket was not redeemed")
+	}
+}
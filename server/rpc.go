@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"crypto/rand"
 	"fmt"
 	"math/big"
 	"net/http"
@@ -12,6 +13,7 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 
+	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/core"
 	"github.com/livepeer/go-livepeer/drivers"
 	"github.com/livepeer/go-livepeer/net"
@@ -36,15 +38,22 @@ type Orchestrator interface {
 	Sign([]byte) ([]byte, error)
 	VerifySig(ethcommon.Address, string, []byte) bool
 	CurrentBlock() *big.Int
-	CheckCapacity(core.ManifestID) error
+	CheckCapacity(core.ManifestID, []ffmpeg.VideoProfile) error
+	Draining(core.ManifestID) bool
 	TranscodeSeg(*core.SegTranscodingMetadata, *stream.HLSSegment) (*core.TranscodeResult, error)
-	ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int)
+	TranscodeOneShot(*core.SegTranscodingMetadata, *stream.HLSSegment) (*core.TranscodeResult, error)
+	ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int, version string, capabilities []string, identity ethcommon.Address) error
 	TranscoderResults(job int64, res *core.RemoteTranscoderResult)
 	ProcessPayment(payment net.Payment, manifestID core.ManifestID) error
 	TicketParams(sender ethcommon.Address) (*net.TicketParams, error)
 	PriceInfo(sender ethcommon.Address) (*net.PriceInfo, error)
+	TicketBatchLimits() (int, *big.Int)
 	SufficientBalance(manifestID core.ManifestID) bool
+	AcceptFirstSegment(sender ethcommon.Address, manifestID core.ManifestID) error
 	DebitFees(manifestID core.ManifestID, price *net.PriceInfo, pixels int64)
+	ReclaimedCredit(manifestID core.ManifestID) *big.Rat
+	ResumeStream(md *core.SegTranscodingMetadata) error
+	Capabilities() []string
 }
 
 type Broadcaster interface {
@@ -103,6 +112,22 @@ type BroadcastSession struct {
 	Sender           pm.Sender
 	PMSessionID      string
 	Balance          Balance
+	// Encoder options of the profiles that have any
+	Encoders common.ProfileEncoders
+	// Complexity of the segment that Profiles were adjusted for. 0 if they were not adjusted
+	Complexity float64
+	// Set for the segment that resumes the stream with the orchestrator after the publisher reconnected
+	Resumption *net.StreamResumption
+	// Set while a segment whose trace is kept is submitted with the session
+	Trace *SegmentAttempt
+	// Index of the arm of the A/B test of the segment that the session was last selected for
+	ABTestArm int
+	// Set when the orchestrator asked to move the stream to another orchestrator in its
+	// response to the last segment
+	Migrate bool
+	// Set until the session is established with the orchestrator info returned with the first
+	// segment of a stream that was sent over the fast path, before any info was requested
+	Establishing bool
 }
 
 type lphttp struct {
@@ -117,7 +142,7 @@ func (h *lphttp) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.ProtoMajor == 2 && strings.HasPrefix(ct, "application/grpc") {
 		h.orchRPC.ServeHTTP(w, r)
 	} else {
-		h.transRPC.ServeHTTP(w, r)
+		limitHTTPByPath(h.transRPC).ServeHTTP(w, r)
 	}
 }
 
@@ -139,24 +164,27 @@ func StartTranscodeServer(orch Orchestrator, bind string, mux *http.ServeMux, wo
 	}
 	net.RegisterOrchestratorServer(s, &lp)
 	lp.transRPC.HandleFunc("/segment", lp.ServeSegment)
+	lp.transRPC.HandleFunc("/payment", lp.ServePayment)
+	lp.transRPC.HandleFunc("/oneshot", lp.ServeOneShot)
 	if acceptRemoteTranscoders {
 		net.RegisterTranscoderServer(s, &lp)
 		lp.transRPC.HandleFunc("/transcodeResults", lp.TranscodeResults)
+		lp.transRPC.HandleFunc("/transcoderSegment", lp.TranscoderSegment)
 	}
 
 	cert, key, err := getCert(orch.ServiceURI(), workDir)
 	if err != nil {
 		return // XXX return error
 	}
+	if fp, err := certFileFingerprint(cert); err == nil {
+		glog.Info("Certificate fingerprint for -orchCertPin: ", fp)
+	}
 
 	glog.Info("Listening for RPC on ", bind)
-	srv := http.Server{
-		Addr:    bind,
-		Handler: &lp,
-		// XXX doesn't handle streaming RPC well; split remote transcoder RPC?
-		//ReadTimeout:  HTTPTimeout,
-		//WriteTimeout: HTTPTimeout,
-	}
+	srv := newHTTPServer(bind, &lp, &SegmentHTTPLimits, &ManagementHTTPLimits)
+	// The gRPC streams of standalone transcoders last as long as the transcoders are connected,
+	// so the HTTP handlers enforce their read and write timeouts themselves
+	srv.ReadTimeout, srv.WriteTimeout = 0, 0
 	srv.ListenAndServeTLS(cert, key)
 }
 
@@ -188,6 +216,29 @@ func CheckOrchestratorAvailability(orch Orchestrator) bool {
 	return orch.VerifySig(orch.Address(), string(ping), pong.Value)
 }
 
+// PingOrchestrator returns the round trip time of a Ping RPC to the orchestrator at uri. The time
+// to connect to the orchestrator is not included
+func PingOrchestrator(ctx context.Context, uri *url.URL) (time.Duration, error) {
+	orchClient, conn, err := startOrchestratorClient(uri)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	value := make([]byte, 32)
+	if _, err := rand.Read(value); err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, GRPCTimeout)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := orchClient.Ping(ctx, &net.PingPong{Value: value}); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
 func ping(context context.Context, req *net.PingPong, orch Orchestrator) (*net.PingPong, error) {
 	glog.Info("Received Ping request")
 	value, err := orch.Sign(req.Value)
@@ -198,8 +249,15 @@ func ping(context context.Context, req *net.PingPong, orch Orchestrator) (*net.P
 	return &net.PingPong{Value: value}, nil
 }
 
-// GetOrchestratorInfo - the broadcaster calls GetOrchestratorInfo which invokes GetOrchestrator on the orchestrator
+// GetOrchestratorInfo - the broadcaster calls GetOrchestratorInfo which invokes GetOrchestrator on the orchestrator.
+// Infos are reused until the expiration set by the orchestrator
 func GetOrchestratorInfo(ctx context.Context, bcast Broadcaster, orchestratorServer *url.URL) (*net.OrchestratorInfo, error) {
+	return orchInfoCache.get(ctx, bcast, orchestratorServer, func() (*net.OrchestratorInfo, error) {
+		return getOrchestratorInfo(ctx, bcast, orchestratorServer)
+	})
+}
+
+func getOrchestratorInfo(ctx context.Context, bcast Broadcaster, orchestratorServer *url.URL) (*net.OrchestratorInfo, error) {
 	c, conn, err := startOrchestratorClient(orchestratorServer)
 	if err != nil {
 		return nil, err
@@ -213,13 +271,20 @@ func GetOrchestratorInfo(ctx context.Context, bcast Broadcaster, orchestratorSer
 		return nil, errors.New("Could not get orchestrator: " + err.Error())
 	}
 
+	reportDeprecations(r.Transcoder, r.Deprecations)
+
+	// Submit segments to the nearest frontend of the orchestrator
+	if len(r.Frontends) > 0 {
+		r.Transcoder = nearestFrontend(r.Transcoder, r.Frontends)
+	}
+
 	return r, nil
 }
 
 func startOrchestratorClient(uri *url.URL) (net.OrchestratorClient, *grpc.ClientConn, error) {
 	glog.Infof("Connecting RPC to %v", uri)
 	conn, err := grpc.Dial(uri.Host,
-		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+		grpc.WithTransportCredentials(orchPinCredentials{credentials.NewTLS(tlsConfig)}),
 		grpc.WithBlock(),
 		grpc.WithTimeout(GRPCConnectTimeout))
 	if err != nil {
@@ -264,6 +329,24 @@ func orchestratorInfo(orch Orchestrator, addr ethcommon.Address, serviceURI stri
 		Transcoder:   serviceURI,
 		TicketParams: params,
 		PriceInfo:    priceInfo,
+		Frontends:    OrchestratorFrontends,
+		Region:       OrchestratorRegion,
+		Deprecations: ProtocolDeprecations,
+		Capabilities: orch.Capabilities(),
+	}
+	if OrchestratorInfoTTL > 0 {
+		tr.Expiration = time.Now().Add(OrchestratorInfoTTL).Unix()
+	}
+	if params != nil {
+		tr.TicketExpiration = ticketExpirationInfo()
+	}
+
+	maxTickets, maxFaceValue := orch.TicketBatchLimits()
+	if maxTickets > 0 {
+		tr.MaxTicketsPerPayment = uint32(maxTickets)
+	}
+	if maxFaceValue != nil && maxFaceValue.Sign() > 0 {
+		tr.MaxBatchFaceValue = maxFaceValue.Bytes()
 	}
 
 	os := drivers.NodeStorage.NewSession(string(core.RandomManifestID()))
@@ -280,7 +363,7 @@ func verifyOrchestratorReq(orch Orchestrator, addr ethcommon.Address, sig []byte
 		glog.Error("orchestrator req sig check failed")
 		return fmt.Errorf("orchestrator req sig check failed")
 	}
-	return orch.CheckCapacity("")
+	return orch.CheckCapacity("", nil)
 }
 
 func pmTicketParams(params *net.TicketParams) *pm.TicketParams {
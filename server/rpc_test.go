@@ -25,6 +25,7 @@ import (
 	"github.com/livepeer/go-livepeer/drivers"
 	"github.com/livepeer/go-livepeer/net"
 	"github.com/livepeer/go-livepeer/pm"
+	"github.com/livepeer/lpms/ffmpeg"
 	"github.com/livepeer/lpms/stream"
 )
 
@@ -57,10 +58,13 @@ func (m *mockBalance) Clear() {
 }
 
 type stubOrchestrator struct {
-	priv       *ecdsa.PrivateKey
-	block      *big.Int
-	signErr    error
-	sessCapErr error
+	priv            *ecdsa.PrivateKey
+	block           *big.Int
+	signErr         error
+	sessCapErr      error
+	resumeErr       error
+	firstSegmentErr error
+	capabilities    []string
 }
 
 func (r *stubOrchestrator) ServiceURI() *url.URL {
@@ -91,6 +95,9 @@ func (r *stubOrchestrator) Address() ethcommon.Address {
 func (r *stubOrchestrator) TranscodeSeg(md *core.SegTranscodingMetadata, seg *stream.HLSSegment) (*core.TranscodeResult, error) {
 	return nil, nil
 }
+func (r *stubOrchestrator) TranscodeOneShot(md *core.SegTranscodingMetadata, seg *stream.HLSSegment) (*core.TranscodeResult, error) {
+	return nil, nil
+}
 func (r *stubOrchestrator) StreamIDs(jobID string) ([]core.StreamID, error) {
 	return []core.StreamID{}, nil
 }
@@ -107,12 +114,32 @@ func (r *stubOrchestrator) PriceInfo(sender ethcommon.Address) (*net.PriceInfo,
 	return nil, nil
 }
 
+func (r *stubOrchestrator) TicketBatchLimits() (int, *big.Int) {
+	return 0, nil
+}
+
 func (r *stubOrchestrator) SufficientBalance(manifestID core.ManifestID) bool {
 	return false
 }
 
+func (r *stubOrchestrator) AcceptFirstSegment(sender ethcommon.Address, manifestID core.ManifestID) error {
+	return r.firstSegmentErr
+}
+
 func (r *stubOrchestrator) DebitFees(manifestID core.ManifestID, price *net.PriceInfo, pixels int64) {}
 
+func (r *stubOrchestrator) ReclaimedCredit(manifestID core.ManifestID) *big.Rat {
+	return nil
+}
+
+func (r *stubOrchestrator) ResumeStream(md *core.SegTranscodingMetadata) error {
+	return r.resumeErr
+}
+
+func (r *stubOrchestrator) Capabilities() []string {
+	return r.capabilities
+}
+
 func newStubOrchestrator() *stubOrchestrator {
 	pk, err := ethcrypto.GenerateKey()
 	if err != nil {
@@ -121,10 +148,14 @@ func newStubOrchestrator() *stubOrchestrator {
 	return &stubOrchestrator{priv: pk, block: big.NewInt(5)}
 }
 
-func (r *stubOrchestrator) CheckCapacity(mid core.ManifestID) error {
+func (r *stubOrchestrator) CheckCapacity(mid core.ManifestID, profiles []ffmpeg.VideoProfile) error {
 	return r.sessCapErr
 }
-func (r *stubOrchestrator) ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int) {
+func (r *stubOrchestrator) Draining(mid core.ManifestID) bool {
+	return false
+}
+func (r *stubOrchestrator) ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int, version string, capabilities []string, identity ethcommon.Address) error {
+	return nil
 }
 func (r *stubOrchestrator) TranscoderResults(job int64, res *core.RemoteTranscoderResult) {
 }
@@ -254,6 +285,127 @@ func TestRPCSeg(t *testing.T) {
 	o.sessCapErr = nil
 }
 
+func TestRPCSeg_CustomProfiles(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := stubBroadcaster2()
+	o := newStubOrchestrator()
+	custom := ffmpeg.VideoProfile{Name: "custom", Bitrate: "1500k", Framerate: 24, Resolution: "854x480"}
+	s := &BroadcastSession{
+		Broadcaster: b,
+		ManifestID:  core.RandomManifestID(),
+		Profiles:    []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, custom},
+	}
+	baddr := ethcrypto.PubkeyToAddress(b.priv.PublicKey)
+
+	creds, err := genSegCreds(s, &stream.HLSSegment{})
+	require.Nil(err)
+
+	buf, err := base64.StdEncoding.DecodeString(creds)
+	require.Nil(err)
+	var segData net.SegData
+	require.Nil(proto.Unmarshal(buf, &segData))
+	assert.Len(segData.FullProfiles, 2)
+
+	md, err := verifySegCreds(o, creds, baddr)
+	require.Nil(err)
+	assert.ElementsMatch(s.Profiles, md.Profiles)
+
+	// The full profiles are covered by the signature
+	for _, p := range segData.FullProfiles {
+		if p.Name == custom.Name {
+			p.Bitrate *= 10
+		}
+	}
+	data, err := proto.Marshal(&segData)
+	require.Nil(err)
+	_, err = verifySegCreds(o, base64.StdEncoding.EncodeToString(data), baddr)
+	assert.Equal(errSegSig, err)
+
+	// Full profiles are not sent if all profiles are presets
+	s.Profiles = []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}
+	creds, err = genSegCreds(s, &stream.HLSSegment{})
+	require.Nil(err)
+	buf, err = base64.StdEncoding.DecodeString(creds)
+	require.Nil(err)
+	require.Nil(proto.Unmarshal(buf, &segData))
+	assert.Len(segData.FullProfiles, 0)
+
+	// Invalid full profiles
+	segData.FullProfiles = []*net.VideoProfile{&net.VideoProfile{Name: "foo"}}
+	data, err = proto.Marshal(&segData)
+	require.Nil(err)
+	_, err = verifySegCreds(o, base64.StdEncoding.EncodeToString(data), baddr)
+	assert.Equal(common.ErrProfile, err)
+}
+
+func TestRPCSeg_Capabilities(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := stubBroadcaster2()
+	o := newStubOrchestrator()
+	baddr := ethcrypto.PubkeyToAddress(b.priv.PublicKey)
+	s := &BroadcastSession{
+		Broadcaster: b,
+		ManifestID:  core.RandomManifestID(),
+		Profiles:    []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9},
+		Encoders:    common.ProfileEncoders{ffmpeg.P144p30fps16x9.Name: {Codec: common.CodecVP9}},
+	}
+	creds, err := genSegCreds(s, &stream.HLSSegment{})
+	require.Nil(err)
+
+	// Orchestrators that cannot encode the codec of a profile reject the segment
+	o.capabilities = []string{core.CapabilityH264, core.CapabilityH265}
+	_, err = verifySegCreds(o, creds, baddr)
+	assert.Equal(errSegCapabilities, err)
+
+	o.capabilities = []string{core.CapabilityH264, core.CapabilityVP9}
+	md, err := verifySegCreds(o, creds, baddr)
+	require.Nil(err)
+	assert.Equal(s.Encoders, md.Encoders)
+
+	// The capabilities are advertised to broadcasters
+	info, err := orchestratorInfo(o, baddr, "http://foo")
+	require.Nil(err)
+	assert.Equal(o.capabilities, info.Capabilities)
+}
+
+func TestRPCSeg_Resumption(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := stubBroadcaster2()
+	o := newStubOrchestrator()
+	s := &BroadcastSession{
+		Broadcaster: b,
+		ManifestID:  core.RandomManifestID(),
+	}
+	baddr := ethcrypto.PubkeyToAddress(b.priv.PublicKey)
+
+	// Segments are not marked by default
+	creds, err := genSegCreds(s, &stream.HLSSegment{SeqNo: 5})
+	require.Nil(err)
+	md, err := verifySegCreds(o, creds, baddr)
+	require.Nil(err)
+	assert.Nil(md.Resumption)
+
+	// The resumption mark of the session is sent with the segment
+	s.Resumption = &net.StreamResumption{LastSeq: 4}
+	creds, err = genSegCreds(s, &stream.HLSSegment{SeqNo: 5})
+	require.Nil(err)
+	md, err = verifySegCreds(o, creds, baddr)
+	require.Nil(err)
+	require.NotNil(md.Resumption)
+	assert.Equal(int64(4), md.Resumption.LastSeq)
+
+	// Segments that can't be resumed are rejected
+	o.resumeErr = core.ErrStreamResumption
+	_, err = verifySegCreds(o, creds, baddr)
+	assert.Equal(core.ErrStreamResumption, err)
+}
+
 func TestNewBalanceUpdate(t *testing.T) {
 	mid := core.RandomManifestID()
 	s := &BroadcastSession{
@@ -310,6 +462,50 @@ func TestNewBalanceUpdate(t *testing.T) {
 	assert.Equal(Staged, int(update.Status))
 }
 
+func TestNewBalanceUpdate_ExceedsBatchLimits_SplitsPayment(t *testing.T) {
+	assert := assert.New(t)
+
+	sender := &pm.MockSender{}
+	balance := &mockBalance{}
+	s := &BroadcastSession{
+		ManifestID:  core.RandomManifestID(),
+		PMSessionID: "foo",
+		Sender:      sender,
+		Balance:     balance,
+		OrchestratorInfo: &net.OrchestratorInfo{
+			TicketParams:         &net.TicketParams{FaceValue: big.NewInt(100).Bytes()},
+			MaxTicketsPerPayment: 3,
+		},
+	}
+
+	ev := big.NewRat(5, 1)
+	existingCredit := big.NewRat(-30, 1)
+	sender.On("EV", s.PMSessionID).Return(ev, nil)
+	balance.On("StageUpdate", ev, ev).Return(7, big.NewRat(35, 1), existingCredit)
+
+	// Capped by the max number of tickets
+	update, err := newBalanceUpdate(s)
+	assert.Nil(err)
+	assert.Equal(3, update.NumTickets)
+	assert.Zero(big.NewRat(15, 1).Cmp(update.NewCredit))
+	assert.Zero(existingCredit.Cmp(update.ExistingCredit))
+
+	// Capped by the max face value of a batch
+	s.OrchestratorInfo.MaxBatchFaceValue = big.NewInt(250).Bytes()
+	update, err = newBalanceUpdate(s)
+	assert.Nil(err)
+	assert.Equal(2, update.NumTickets)
+	assert.Zero(big.NewRat(10, 1).Cmp(update.NewCredit))
+
+	// Not capped when within the limits
+	s.OrchestratorInfo.MaxTicketsPerPayment = 10
+	s.OrchestratorInfo.MaxBatchFaceValue = nil
+	update, err = newBalanceUpdate(s)
+	assert.Nil(err)
+	assert.Equal(7, update.NumTickets)
+	assert.Zero(big.NewRat(35, 1).Cmp(update.NewCredit))
+}
+
 func TestGenPayment(t *testing.T) {
 	mid := core.RandomManifestID()
 	b := stubBroadcaster2()
@@ -431,6 +627,60 @@ func TestGenPayment(t *testing.T) {
 	sender.AssertNotCalled(t, "CreateTicketBatch", s.PMSessionID, 0)
 }
 
+func TestGenPayment_SpendTracker(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	defer func() { BroadcastSpendTracker = nil }()
+	BroadcastSpendTracker = pm.NewSpendTracker(pm.SpendTrackerConfig{MaxStreamEV: big.NewRat(25, 1)})
+
+	sender := &pm.MockSender{}
+	s := &BroadcastSession{
+		Broadcaster: stubBroadcaster2(),
+		ManifestID:  core.RandomManifestID(),
+		OrchestratorInfo: &net.OrchestratorInfo{
+			PriceInfo: &net.PriceInfo{
+				PricePerUnit:  1,
+				PixelsPerUnit: 3,
+			},
+		},
+		Sender:      sender,
+		PMSessionID: "foo",
+	}
+	mid := string(s.ManifestID)
+
+	// Tickets that always win have an EV equal to their face value
+	maxWinProb := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+	batch := &pm.TicketBatch{
+		TicketParams: &pm.TicketParams{
+			Recipient: pm.RandAddress(),
+			FaceValue: big.NewInt(10),
+			WinProb:   maxWinProb,
+			Seed:      big.NewInt(7777),
+		},
+		TicketExpirationParams: &pm.TicketExpirationParams{},
+		Sender:                 pm.RandAddress(),
+	}
+	sender.On("EV", s.PMSessionID).Return(big.NewRat(10, 1), nil)
+	sender.On("CreateTicketBatch", s.PMSessionID, 2).Return(batch, nil)
+
+	// Test issuing tickets within the budget
+	_, err := genPayment(s, 2)
+	require.Nil(err)
+	assert.Zero(big.NewRat(20, 1).Cmp(BroadcastSpendTracker.StreamEV(mid)))
+
+	// Test issuing tickets that exceed the budget
+	_, err = genPayment(s, 2)
+	assert.Contains(err.Error(), "ticket EV budget exceeded for stream")
+	sender.AssertNumberOfCalls(t, "CreateTicketBatch", 1)
+
+	// Test EV error
+	s.PMSessionID = "bar"
+	sender.On("EV", "bar").Return(nil, errors.New("EV error"))
+	_, err = genPayment(s, 2)
+	assert.EqualError(err, "EV error")
+}
+
 func TestPing(t *testing.T) {
 	o := newStubOrchestrator()
 
@@ -663,6 +913,52 @@ func TestGetOrchestrator_GivenValidSig_ReturnsOrchPriceInfo(t *testing.T) {
 	assert.Equal(expectedPrice, oInfo.PriceInfo)
 }
 
+func TestGetOrchestrator_GivenValidSig_ReturnsTicketBatchLimits(t *testing.T) {
+	orch := &mockOrchestrator{}
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	orch.On("VerifySig", mock.Anything, mock.Anything, mock.Anything).Return(true)
+	orch.On("ServiceURI").Return(url.Parse("http://someuri.com"))
+	orch.On("TicketParams", mock.Anything).Return(nil, nil)
+	orch.On("PriceInfo", mock.Anything).Return(nil, nil)
+
+	assert := assert.New(t)
+
+	// No limits
+	oInfo, err := getOrchestrator(orch, &net.OrchestratorRequest{})
+	assert.Nil(err)
+	assert.Zero(oInfo.MaxTicketsPerPayment)
+	assert.Nil(oInfo.MaxBatchFaceValue)
+
+	orch.maxTicketsPerPayment = 5
+	orch.maxBatchFaceValue = big.NewInt(1000)
+	oInfo, err = getOrchestrator(orch, &net.OrchestratorRequest{})
+	assert.Nil(err)
+	assert.Equal(uint32(5), oInfo.MaxTicketsPerPayment)
+	assert.Equal(big.NewInt(1000).Bytes(), oInfo.MaxBatchFaceValue)
+}
+
+func TestGetOrchestrator_Expiration(t *testing.T) {
+	orch := &mockOrchestrator{}
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	orch.On("VerifySig", mock.Anything, mock.Anything, mock.Anything).Return(true)
+	orch.On("ServiceURI").Return(url.Parse("http://someuri.com"))
+	orch.On("TicketParams", mock.Anything).Return(nil, nil)
+	orch.On("PriceInfo", mock.Anything).Return(nil, nil)
+	defer func() { OrchestratorInfoTTL = 0 }()
+
+	assert := assert.New(t)
+
+	// Infos are not reused by default
+	oInfo, err := getOrchestrator(orch, &net.OrchestratorRequest{})
+	assert.Nil(err)
+	assert.Zero(oInfo.Expiration)
+
+	OrchestratorInfoTTL = time.Minute
+	oInfo, err = getOrchestrator(orch, &net.OrchestratorRequest{})
+	assert.Nil(err)
+	assert.InDelta(time.Now().Add(time.Minute).Unix(), oInfo.Expiration, 1)
+}
+
 func TestGetOrchestrator_PriceInfoError(t *testing.T) {
 	orch := &mockOrchestrator{}
 	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
@@ -707,6 +1003,11 @@ func (s *mockOSSession) IsExternal() bool {
 
 type mockOrchestrator struct {
 	mock.Mock
+
+	maxTicketsPerPayment int
+	maxBatchFaceValue    *big.Int
+	reclaimedCredit      *big.Rat
+	draining             bool
 }
 
 func (o *mockOrchestrator) ServiceURI() *url.URL {
@@ -746,8 +1047,20 @@ func (o *mockOrchestrator) TranscodeSeg(md *core.SegTranscodingMetadata, seg *st
 
 	return res, args.Error(1)
 }
-func (o *mockOrchestrator) ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int) {
-	o.Called(stream)
+
+func (o *mockOrchestrator) TranscodeOneShot(md *core.SegTranscodingMetadata, seg *stream.HLSSegment) (*core.TranscodeResult, error) {
+	args := o.Called(md, seg)
+
+	var res *core.TranscodeResult
+	if args.Get(0) != nil {
+		res = args.Get(0).(*core.TranscodeResult)
+	}
+
+	return res, args.Error(1)
+}
+func (o *mockOrchestrator) ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int, version string, capabilities []string, identity ethcommon.Address) error {
+	args := o.Called(stream, capacity, version, capabilities)
+	return args.Error(0)
 }
 func (o *mockOrchestrator) TranscoderResults(job int64, res *core.RemoteTranscoderResult) {
 	o.Called(job, res)
@@ -773,19 +1086,46 @@ func (o *mockOrchestrator) PriceInfo(sender ethcommon.Address) (*net.PriceInfo,
 	return nil, args.Error(1)
 }
 
-func (o *mockOrchestrator) CheckCapacity(mid core.ManifestID) error {
+func (o *mockOrchestrator) CheckCapacity(mid core.ManifestID, profiles []ffmpeg.VideoProfile) error {
 	return nil
 }
 
+func (o *mockOrchestrator) Draining(mid core.ManifestID) bool {
+	return o.draining
+}
+
+func (o *mockOrchestrator) TicketBatchLimits() (int, *big.Int) {
+	return o.maxTicketsPerPayment, o.maxBatchFaceValue
+}
+
 func (o *mockOrchestrator) SufficientBalance(manifestID core.ManifestID) bool {
 	args := o.Called(manifestID)
 	return args.Bool(0)
 }
 
+func (o *mockOrchestrator) AcceptFirstSegment(sender ethcommon.Address, manifestID core.ManifestID) error {
+	args := o.Called(sender, manifestID)
+	return args.Error(0)
+}
+
 func (o *mockOrchestrator) DebitFees(manifestID core.ManifestID, price *net.PriceInfo, pixels int64) {
 	o.Called(manifestID, price, pixels)
 }
 
+func (o *mockOrchestrator) ReclaimedCredit(manifestID core.ManifestID) *big.Rat {
+	reclaimed := o.reclaimedCredit
+	o.reclaimedCredit = nil
+	return reclaimed
+}
+
+func (o *mockOrchestrator) ResumeStream(md *core.SegTranscodingMetadata) error {
+	return nil
+}
+
+func (o *mockOrchestrator) Capabilities() []string {
+	return nil
+}
+
 func defaultTicketParams() *net.TicketParams {
 	return &net.TicketParams{
 		Recipient:         pm.RandBytes(123),
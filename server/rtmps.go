@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	gonet "net"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// rtmpsDialTimeout is how long an RTMPS connection waits to connect to the RTMP server
+const rtmpsDialTimeout = 5 * time.Second
+
+// ServeRTMPS accepts RTMP connections over TLS on addr and forwards them to the RTMP
+// server at rtmpAddr, so that publishers can ingest with rtmps:// URLs
+func ServeRTMPS(ctx context.Context, addr, rtmpAddr string, cert tls.Certificate) error {
+	ln, err := tls.Listen("tcp", addr, &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		return err
+	}
+	return serveRTMPS(ctx, ln, rtmpAddr)
+}
+
+func serveRTMPS(ctx context.Context, ln gonet.Listener, rtmpAddr string) error {
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	glog.Infof("RTMPS server listening on rtmps://%v", ln.Addr())
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if ne, ok := err.(gonet.Error); ok && ne.Temporary() {
+				glog.Error("Error accepting RTMPS connection ", err)
+				continue
+			}
+			return err
+		}
+		go proxyRTMPS(conn, rtmpAddr)
+	}
+}
+
+// proxyRTMPS copies the decrypted data of an RTMPS connection to and from the RTMP server
+func proxyRTMPS(conn gonet.Conn, rtmpAddr string) {
+	defer conn.Close()
+	// Complete the handshake first so that TLS errors are not reported as RTMP server errors
+	if tc, ok := conn.(*tls.Conn); ok {
+		if err := tc.Handshake(); err != nil {
+			glog.Errorf("Error in TLS handshake of RTMPS client=%v: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+	upstream, err := gonet.DialTimeout("tcp", rtmpAddr, rtmpsDialTimeout)
+	if err != nil {
+		glog.Errorf("Error connecting RTMPS client=%v to RTMP server: %v", conn.RemoteAddr(), err)
+		return
+	}
+	defer upstream.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, upstream)
+		done <- struct{}{}
+	}()
+	// Either side closing ends the connection
+	<-done
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	gonet "net"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeRTMPS(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	wd, err := ioutil.TempDir("", t.Name())
+	require.Nil(err)
+	defer os.RemoveAll(wd)
+	u, _ := url.Parse("rtmps://127.0.0.1")
+	cf, kf, err := getCert(u, wd)
+	require.Nil(err)
+	cert, err := tls.LoadX509KeyPair(cf, kf)
+	require.Nil(err)
+
+	// Stand in for the RTMP server that echoes what it receives
+	rtmp, err := gonet.Listen("tcp", "127.0.0.1:0")
+	require.Nil(err)
+	defer rtmp.Close()
+	go func() {
+		for {
+			conn, err := rtmp.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	require.Nil(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- serveRTMPS(ctx, ln, rtmp.Addr().String()) }()
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	require.Nil(err)
+	_, err = conn.Write([]byte("handshake"))
+	require.Nil(err)
+	buf := make([]byte, len("handshake"))
+	_, err = io.ReadFull(conn, buf)
+	require.Nil(err)
+	assert.Equal("handshake", string(buf))
+	conn.Close()
+
+	// Plain RTMP connections are rejected by the TLS listener
+	plain, err := gonet.Dial("tcp", ln.Addr().String())
+	require.Nil(err)
+	plain.Write([]byte("not a tls handshake"))
+	_, err = io.ReadFull(plain, buf)
+	assert.NotNil(err)
+	plain.Close()
+
+	cancel()
+	assert.Equal(context.Canceled, <-errCh)
+}
+
+func TestServeRTMPS_UnreachableRTMPServer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	wd, err := ioutil.TempDir("", t.Name())
+	require.Nil(err)
+	defer os.RemoveAll(wd)
+	u, _ := url.Parse("rtmps://127.0.0.1")
+	cf, kf, err := getCert(u, wd)
+	require.Nil(err)
+	cert, err := tls.LoadX509KeyPair(cf, kf)
+	require.Nil(err)
+
+	// Reserve an address that nothing listens on
+	unused, err := gonet.Listen("tcp", "127.0.0.1:0")
+	require.Nil(err)
+	rtmpAddr := unused.Addr().String()
+	unused.Close()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	require.Nil(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go serveRTMPS(ctx, ln, rtmpAddr)
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	require.Nil(err)
+	defer conn.Close()
+	// The connection is closed once the RTMP server can't be reached
+	_, err = conn.Read(make([]byte, 1))
+	assert.NotNil(err)
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"sync"
+
+	"github.com/golang/glog"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/monitor"
+)
+
+// Keys of the kv table that the settings adjusted with the CLI webserver are persisted under, so
+// that they are restored when the node restarts
+const (
+	runtimeKeyMaxPrice          = "runtime.maxPrice"
+	runtimeKeyPricePerPixel     = "runtime.pricePerPixel"
+	runtimeKeyMaxSessions       = "runtime.maxSessions"
+	runtimeKeySelectionStrategy = "runtime.selectionStrategy"
+)
+
+// Value that an unset selection strategy is persisted as, since an empty value is not persisted
+const selectionStrategyDefault = "default"
+
+var errAutoSessions = errors.New("max sessions are adjusted to the transcoding throughput with -autoSessions")
+
+// SelectionWebhookURL is the URL of the webhook that ranks orchestrators when the selection
+// strategy is set to webhook
+var SelectionWebhookURL string
+
+// Name of the selection strategy of BroadcastSelection. Empty if BroadcastSelection is not set
+var selectionStrategy struct {
+	mu   sync.Mutex
+	name string
+}
+
+// SetSelectionStrategy sets BroadcastSelection to the selection algorithm with the name, or unsets
+// it if the name is empty. The strategy is used by the streams that start afterwards
+func SetSelectionStrategy(name string, n *core.LivepeerNode) error {
+	var sel SelectionAlgorithm
+	if name != "" {
+		var err error
+		if sel, err = NewSelectionAlgorithm(name, n, SelectionWebhookURL); err != nil {
+			return err
+		}
+	}
+	selectionStrategy.mu.Lock()
+	defer selectionStrategy.mu.Unlock()
+	BroadcastSelection = sel
+	selectionStrategy.name = name
+	return nil
+}
+
+// SelectionStrategy returns the name of the selection strategy set by SetSelectionStrategy
+func SelectionStrategy() string {
+	selectionStrategy.mu.Lock()
+	defer selectionStrategy.mu.Unlock()
+	return selectionStrategy.name
+}
+
+// setMaxPrice sets the maximum price per pixel that a broadcaster pays. Any price is accepted
+// if pricePerUnit is 0
+func setMaxPrice(n *core.LivepeerNode, pricePerUnitStr, pixelsPerUnitStr string) error {
+	pricePerUnit, err := strconv.ParseInt(pricePerUnitStr, 10, 64)
+	if err != nil || pricePerUnit < 0 {
+		return fmt.Errorf("invalid maxPricePerUnit %q", pricePerUnitStr)
+	}
+	pixelsPerUnit, err := strconv.ParseInt(pixelsPerUnitStr, 10, 64)
+	if err != nil || pixelsPerUnit <= 0 {
+		return fmt.Errorf("invalid pixelsPerUnit %q", pixelsPerUnitStr)
+	}
+	price := big.NewRat(pricePerUnit, pixelsPerUnit)
+	if err := storeRuntimeConfig(n, runtimeKeyMaxPrice, price.RatString()); err != nil {
+		return err
+	}
+	applyMaxPrice(price)
+	return nil
+}
+
+func applyMaxPrice(price *big.Rat) {
+	if price.Sign() == 0 {
+		BroadcastCfg.SetMaxPrice(nil)
+		glog.Info("Maximum transcoding price per pixel not set, broadcaster is currently set to accept ANY price")
+		return
+	}
+	BroadcastCfg.SetMaxPrice(price)
+	glog.Infof("Maximum transcoding price per pixel set to %v", price.RatString())
+}
+
+// setPricePerUnit sets the price per pixel of an orchestrator
+func (s *LivepeerServer) setPricePerUnit(pricePerUnit, pixelsPerUnit string) error {
+	if err := s.setOrchestratorPriceInfo(pricePerUnit, pixelsPerUnit); err != nil {
+		return err
+	}
+	return storeRuntimeConfig(s.LivepeerNode, runtimeKeyPricePerPixel, s.LivepeerNode.GetBasePrice().RatString())
+}
+
+// setMaxSessions sets the number of sessions that the node accepts
+func setMaxSessions(n *core.LivepeerNode, maxSessionsStr string) error {
+	if n.CapacityTuner != nil {
+		return errAutoSessions
+	}
+	maxSessions, err := strconv.Atoi(maxSessionsStr)
+	if err != nil || maxSessions <= 0 {
+		return fmt.Errorf("invalid maxSessions %q", maxSessionsStr)
+	}
+	if err := storeRuntimeConfig(n, runtimeKeyMaxSessions, maxSessionsStr); err != nil {
+		return err
+	}
+	applyMaxSessions(maxSessions)
+	return nil
+}
+
+func applyMaxSessions(maxSessions int) {
+	core.MaxSessions = maxSessions
+	if monitor.Enabled {
+		monitor.MaxSessions(maxSessions)
+	}
+	glog.Infof("Max sessions set to %v", maxSessions)
+}
+
+// setSelectionStrategy sets the selection strategy of the streams that a broadcaster starts
+func setSelectionStrategy(n *core.LivepeerNode, name string) error {
+	if err := SetSelectionStrategy(name, n); err != nil {
+		return err
+	}
+	glog.Infof("Selecting orchestrators with the %q strategy", name)
+	if name == "" {
+		name = selectionStrategyDefault
+	}
+	return storeRuntimeConfig(n, runtimeKeySelectionStrategy, name)
+}
+
+func storeRuntimeConfig(n *core.LivepeerNode, key, value string) error {
+	if n.Database == nil {
+		return nil
+	}
+	return n.Database.StoreKV(key, value)
+}
+
+// LoadRuntimeConfig applies the settings that were adjusted with the CLI webserver before the node
+// restarted. They take precedence over the flags that the node was started with
+func LoadRuntimeConfig(n *core.LivepeerNode) error {
+	if n.Database == nil {
+		return nil
+	}
+	load := func(key string, apply func(string) error) error {
+		value, err := n.Database.KV(key)
+		if err != nil || value == "" {
+			return err
+		}
+		if err := apply(value); err != nil {
+			return fmt.Errorf("invalid %v %q: %v", key, value, err)
+		}
+		glog.Infof("Restored the %v set at runtime value=%v", key, value)
+		return nil
+	}
+	parseRat := func(value string) (*big.Rat, error) {
+		price, ok := new(big.Rat).SetString(value)
+		if !ok || price.Sign() < 0 {
+			return nil, errors.New("not a price")
+		}
+		return price, nil
+	}
+
+	switch n.NodeType {
+	case core.BroadcasterNode:
+		if err := load(runtimeKeyMaxPrice, func(value string) error {
+			price, err := parseRat(value)
+			if err == nil {
+				applyMaxPrice(price)
+			}
+			return err
+		}); err != nil {
+			return err
+		}
+		if err := load(runtimeKeySelectionStrategy, func(value string) error {
+			if value == selectionStrategyDefault {
+				value = ""
+			}
+			return SetSelectionStrategy(value, n)
+		}); err != nil {
+			return err
+		}
+	case core.OrchestratorNode:
+		if err := load(runtimeKeyPricePerPixel, func(value string) error {
+			price, err := parseRat(value)
+			if err == nil {
+				n.SetBasePrice(price)
+			}
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+
+	if n.CapacityTuner == nil {
+		return load(runtimeKeyMaxSessions, func(value string) error {
+			maxSessions, err := strconv.Atoi(value)
+			if err == nil {
+				applyMaxSessions(maxSessions)
+			}
+			return err
+		})
+	}
+	return nil
+}
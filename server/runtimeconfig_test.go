@@ -0,0 +1,81 @@
+package server
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/core"
+)
+
+func TestRuntimeConfig_Broadcaster(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	n, cleanup := newHealthTestNode(t, core.BroadcasterNode)
+	defer cleanup()
+	defer BroadcastCfg.SetMaxPrice(nil)
+	defer SetSelectionStrategy("", n)
+	defer func(maxSessions int) { core.MaxSessions = maxSessions }(core.MaxSessions)
+
+	assert.Error(setMaxPrice(n, "-1", "1"))
+	assert.Error(setMaxPrice(n, "1", "0"))
+	require.Nil(setMaxPrice(n, "1", "3"))
+	assert.Zero(BroadcastCfg.MaxPrice().Cmp(big.NewRat(1, 3)))
+
+	assert.Error(setSelectionStrategy(n, "nope"))
+	require.Nil(setSelectionStrategy(n, SelectionRoundRobin))
+	assert.Equal(SelectionRoundRobin, SelectionStrategy())
+	assert.IsType(roundRobinSelection{}, BroadcastSelection)
+
+	assert.Error(setMaxSessions(n, "0"))
+	require.Nil(setMaxSessions(n, "3"))
+	assert.Equal(3, n.MaxSessions())
+
+	// The settings are restored over the flags when the node restarts
+	BroadcastCfg.SetMaxPrice(big.NewRat(5, 1))
+	require.Nil(SetSelectionStrategy(SelectionRandom, n))
+	core.MaxSessions = 10
+	require.Nil(LoadRuntimeConfig(n))
+	assert.Zero(BroadcastCfg.MaxPrice().Cmp(big.NewRat(1, 3)))
+	assert.Equal(SelectionRoundRobin, SelectionStrategy())
+	assert.Equal(3, core.MaxSessions)
+
+	// A max price of 0 accepts any price and an empty strategy unsets the strategy
+	require.Nil(setMaxPrice(n, "0", "1"))
+	require.Nil(setSelectionStrategy(n, ""))
+	BroadcastCfg.SetMaxPrice(big.NewRat(5, 1))
+	require.Nil(SetSelectionStrategy(SelectionRandom, n))
+	require.Nil(LoadRuntimeConfig(n))
+	assert.Nil(BroadcastCfg.MaxPrice())
+	assert.Equal("", SelectionStrategy())
+	assert.Nil(BroadcastSelection)
+}
+
+func TestRuntimeConfig_Orchestrator(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	n, cleanup := newHealthTestNode(t, core.OrchestratorNode)
+	defer cleanup()
+	s := &LivepeerServer{LivepeerNode: n}
+
+	// Nothing is restored if nothing was set at runtime
+	n.SetBasePrice(big.NewRat(7, 1))
+	require.Nil(LoadRuntimeConfig(n))
+	assert.Zero(n.GetBasePrice().Cmp(big.NewRat(7, 1)))
+
+	assert.Error(s.setPricePerUnit("0", "1"))
+	require.Nil(s.setPricePerUnit("2", "3"))
+	assert.Zero(n.GetBasePrice().Cmp(big.NewRat(2, 3)))
+
+	n.SetBasePrice(big.NewRat(7, 1))
+	require.Nil(LoadRuntimeConfig(n))
+	assert.Zero(n.GetBasePrice().Cmp(big.NewRat(2, 3)))
+
+	// Max sessions can't be set when they are tuned automatically
+	tuner, err := core.NewCapacityTuner(1, 10)
+	require.Nil(err)
+	n.CapacityTuner = tuner
+	assert.Equal(errAutoSessions, setMaxSessions(n, "3"))
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/lpms/stream"
+)
+
+// segmentConditioner re-cuts the segments of a stream so that they start on closed GOP boundaries.
+// The frames that precede the first IDR frame of a segment belong to the GOP of the previous segment,
+// so they are moved to the end of the previous segment. Otherwise orchestrators cannot decode them
+// and the renditions drift from the source. Each segment is held until the next one arrives, which
+// delays segments by one segment
+type segmentConditioner struct {
+	mu      sync.Mutex
+	pending *stream.HLSSegment
+	emit    func(seg *stream.HLSSegment)
+}
+
+func newSegmentConditioner(emit func(seg *stream.HLSSegment)) *segmentConditioner {
+	return &segmentConditioner{emit: emit}
+}
+
+// add conditions a segment and emits the segment that precedes it
+func (c *segmentConditioner) add(seg *stream.HLSSegment) {
+	c.mu.Lock()
+	prev := c.pending
+	c.pending = seg
+	if prev != nil {
+		recutSegments(prev, seg)
+	}
+	c.mu.Unlock()
+
+	if prev != nil {
+		c.emit(prev)
+	}
+}
+
+// flush emits the held segment, e.g. when the stream ends
+func (c *segmentConditioner) flush() {
+	c.mu.Lock()
+	prev := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+
+	if prev != nil {
+		c.emit(prev)
+	}
+}
+
+// recutSegments moves the frames of seg that precede its first IDR frame to the end of prev,
+// and moves their duration along with them. The segments are left unchanged if seg cannot be re-cut
+func recutSegments(prev, seg *stream.HLSSegment) {
+	head, tail, err := common.SplitTSAtIDR(seg.Data)
+	if err != nil {
+		glog.V(common.DEBUG).Infof("Unable to re-cut segment seqNo=%d on a closed GOP boundary: %v", seg.SeqNo, err)
+		return
+	}
+	if head == nil {
+		return
+	}
+	before, err := common.InspectTS(seg.Data)
+	if err != nil {
+		return
+	}
+	after, err := common.InspectTS(tail)
+	if err != nil {
+		return
+	}
+	moved := before.Duration - after.Duration
+	if moved <= 0 || moved >= seg.Duration {
+		return
+	}
+
+	prev.Data = append(append(make([]byte, 0, len(prev.Data)+len(head)), prev.Data...), head...)
+	prev.Duration += moved
+	seg.Data = tail
+	seg.Duration -= moved
+	glog.V(common.DEBUG).Infof("Moved %d frames (%.3fs) of segment seqNo=%d to segment seqNo=%d", before.Frames-after.Frames, moved, seg.SeqNo, prev.SeqNo)
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testConditionerPacket builds an MPEG-TS packet that starts a payload, padded with an adaptation field
+func testConditionerPacket(pid int, payload []byte, randomAccess bool) []byte {
+	pkt := make([]byte, 188)
+	pkt[0], pkt[1], pkt[2], pkt[3] = 0x47, byte(pid>>8&0x1f)|0x40, byte(pid), 0x30
+	pad := 188 - 4 - len(payload)
+	pkt[4] = byte(pad - 1)
+	if randomAccess {
+		pkt[5] = 0x40
+	}
+	for i := 6; i < 4+pad; i++ {
+		pkt[i] = 0xff
+	}
+	copy(pkt[4+pad:], payload)
+	return pkt
+}
+
+// testConditionerTS is a segment with a frame every 0.5s from the given frame number.
+// The stream type is MPEG-2 video so that keyframes are signaled by the random access indicator
+func testConditionerTS(first int, keyframes ...bool) []byte {
+	pat := []byte{0, 0x00, 0xb0, 0x0d, 0, 1, 0xc1, 0, 0, 0, 1, 0xf0, 0x00, 0, 0, 0, 0}
+	pmt := []byte{0, 0x02, 0xb0, 0x12, 0, 1, 0xc1, 0, 0, 0xe1, 0x00, 0xf0, 0x00,
+		0x02, 0xe1, 0x00, 0xf0, 0x00,
+		0, 0, 0, 0}
+	ts := append(testConditionerPacket(0, pat, false), testConditionerPacket(0x1000, pmt, false)...)
+	for i, keyframe := range keyframes {
+		pts := int64(first+i) * 90000 / 2
+		pes := []byte{0, 0, 1, 0xe0, 0, 0, 0x80, 0x80, 5,
+			byte(0x21 | pts>>29&0x0e), byte(pts >> 22), byte(pts>>14&0xfe | 1), byte(pts >> 7), byte(pts<<1&0xfe | 1)}
+		ts = append(ts, testConditionerPacket(0x100, pes, keyframe)...)
+	}
+	return ts
+}
+
+func TestSegmentConditioner(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var emitted []*stream.HLSSegment
+	c := newSegmentConditioner(func(seg *stream.HLSSegment) {
+		emitted = append(emitted, seg)
+	})
+
+	// Segments are held until the next segment arrives
+	seg0 := &stream.HLSSegment{SeqNo: 0, Data: testConditionerTS(0, true, false), Duration: 1.0}
+	c.add(seg0)
+	assert.Empty(emitted)
+
+	// The frames before the first keyframe are moved to the previous segment
+	seg1 := &stream.HLSSegment{SeqNo: 1, Data: testConditionerTS(2, false, true, false), Duration: 1.5}
+	c.add(seg1)
+	require.Len(emitted, 1)
+	assert.Equal(seg0, emitted[0])
+	assert.Equal(1.5, seg0.Duration)
+	assert.Equal(1.0, seg1.Duration)
+
+	info, err := common.InspectTS(seg0.Data)
+	require.Nil(err)
+	assert.True(info.StartsWithIDR)
+	assert.Equal(3, info.Frames)
+	assert.Equal(1.5, info.Duration)
+
+	info, err = common.InspectTS(seg1.Data)
+	require.Nil(err)
+	assert.True(info.StartsWithIDR)
+	assert.Equal(2, info.Frames)
+	assert.Equal(1.0, info.Duration)
+
+	// Segments without a keyframe are left unchanged
+	data := testConditionerTS(5, false, false)
+	seg2 := &stream.HLSSegment{SeqNo: 2, Data: data, Duration: 1.0}
+	c.add(seg2)
+	require.Len(emitted, 2)
+	assert.Equal(seg1, emitted[1])
+	assert.Equal(1.0, seg1.Duration)
+	assert.Equal(data, seg2.Data)
+	assert.Equal(1.0, seg2.Duration)
+
+	// The held segment is emitted on flush, once
+	c.flush()
+	c.flush()
+	require.Len(emitted, 3)
+	assert.Equal(seg2, emitted[2])
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/livepeer/go-livepeer/drivers"
 	"github.com/livepeer/go-livepeer/monitor"
 	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/lpms/ffmpeg"
 	"github.com/livepeer/lpms/stream"
 	"golang.org/x/net/http2"
 
@@ -25,29 +26,45 @@ import (
 	"github.com/golang/glog"
 	"github.com/golang/protobuf/proto"
 	"github.com/pkg/errors"
+	octrace "go.opencensus.io/trace"
 )
 
 const paymentHeader = "Livepeer-Payment"
 const segmentHeader = "Livepeer-Segment"
+const paymentResultHeader = "Livepeer-Payment-Result"
+const reclaimedCreditHeader = "Livepeer-Reclaimed-Credit"
+const migrateHeader = "Livepeer-Migrate"
 
 var errSegEncoding = errors.New("ErrorSegEncoding")
 var errSegSig = errors.New("ErrSegSig")
+var errSegCapabilities = errors.New("ErrSegCapabilities")
 
 var tlsConfig = &tls.Config{InsecureSkipVerify: true}
 var httpClient = &http.Client{
-	Transport: &http2.Transport{TLSClientConfig: tlsConfig},
+	Transport: &http2.Transport{TLSClientConfig: tlsConfig, DialTLS: dialOrchTLS},
 	Timeout:   common.HTTPTimeout,
 }
 
 func (h *lphttp) ServeSegment(w http.ResponseWriter, r *http.Request) {
 	orch := h.orchestrator
 
+	// Continue the trace of the segment from the broadcaster, if any
+	ctx, span := monitor.StartSpanFromRequest(r, "serveSegment")
+	defer span.End()
+
 	payment, err := getPayment(r.Header.Get(paymentHeader))
 	if err != nil {
 		glog.Error("Could not parse payment")
 		http.Error(w, err.Error(), http.StatusPaymentRequired)
 		return
 	}
+	// The first segment of a stream can be sent before the broadcaster got the info to pay with
+	fastPath := FirstSegmentFastPath && r.Header.Get(firstSegmentHeader) != "" && payment.TicketParams == nil
+	if err := validateStrictPayment(payment); err != nil && !fastPath {
+		glog.Error("Rejecting payment: ", err)
+		http.Error(w, err.Error(), http.StatusPaymentRequired)
+		return
+	}
 
 	// check the segment sig from the broadcaster
 	seg := r.Header.Get(segmentHeader)
@@ -59,35 +76,77 @@ func (h *lphttp) ServeSegment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// oInfo will be non-nil if we need to send an updated net.OrchestratorInfo to the broadcaster
-	var oInfo *net.OrchestratorInfo
+	if debugCaptured(segData.ManifestID) {
+		captureDebug(segData.ManifestID, "serveSegment", map[string]interface{}{
+			"remoteAddr": r.RemoteAddr,
+			"headers":    captureHeaders(r.Header),
+			"segData":    captureSegData(seg),
+			"payment":    capturePayment(r.Header.Get(paymentHeader)),
+		})
+	}
 
-	if paymentError := orch.ProcessPayment(payment, segData.ManifestID); paymentError != nil {
+	if span != nil {
+		segData.TraceContext = ctx
+		span.AddAttributes(
+			octrace.StringAttribute("manifestID", monitor.Redact(string(segData.ManifestID))),
+			octrace.Int64Attribute("seqNo", segData.Seq),
+		)
+	}
 
-		acceptableErr, ok := paymentError.(core.AcceptableError)
-		if !ok || !acceptableErr.Acceptable() {
-			glog.Errorf("Unacceptable error occured processing payment: %v", paymentError)
-			http.Error(w, paymentError.Error(), http.StatusBadRequest)
-			return
-		}
-		oInfo, err = orchestratorInfo(orch, getPaymentSender(payment), orch.ServiceURI().String())
-		if err != nil {
-			glog.Errorf("Error updating orchestrator info: %v", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
+	// Ask the broadcaster to move a drained stream to another orchestrator
+	if orch.Draining(segData.ManifestID) {
+		glog.V(common.DEBUG).Infof("Asking broadcaster to migrate drained stream manifestID=%s seqNo=%d", segData.ManifestID, segData.Seq)
+		w.Header().Set(migrateHeader, "1")
+	}
+
+	// The first segment over the fast path is downloaded while it is validated
+	var body *asyncBody
+	if fastPath {
+		body = readBodyAsync(r.Body)
+		// The body must not be read once the request is responded to
+		defer body.wait()
+	}
 
-		glog.Errorf("Acceptable error occured when processing payment: %v", paymentError)
+	// oInfo will be non-nil if we need to send an updated net.OrchestratorInfo to the broadcaster
+	_, paymentSpan := monitor.StartSpan(ctx, "payment")
+	oInfo, ok := processPayment(orch, w, payment, segData.ManifestID)
+	paymentSpan.End()
+	if !ok {
+		return
 	}
 
-	if !orch.SufficientBalance(segData.ManifestID) {
+	// The fees of the first segment over the fast path are paid with the next segment
+	price := payment.GetExpectedPrice()
+	if fastPath {
+		sender := getPaymentSender(payment)
+		if err := orch.AcceptFirstSegment(sender, segData.ManifestID); err != nil {
+			glog.Errorf("Rejecting first segment over the fast path manifestID=%s: %v", segData.ManifestID, err)
+			http.Error(w, err.Error(), http.StatusPaymentRequired)
+			return
+		}
+		// The session of the broadcaster is established with the info returned with the segment
+		if oInfo == nil {
+			if oInfo, err = orchestratorInfo(orch, sender, orch.ServiceURI().String()); err != nil {
+				glog.Errorf("Error getting orchestrator info: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+		price = oInfo.PriceInfo
+		glog.V(common.DEBUG).Infof("Accepted first segment over the fast path manifestID=%s seqNo=%d", segData.ManifestID, segData.Seq)
+	} else if !orch.SufficientBalance(segData.ManifestID) {
 		glog.Errorf("Insufficient credit balance for stream with manifestID %v\n", segData.ManifestID)
 		http.Error(w, "Insufficient balance", http.StatusBadRequest)
 		return
 	}
 
 	// download the segment and check the hash
-	data, err := ioutil.ReadAll(r.Body)
+	var data []byte
+	if body != nil {
+		data, err = body.wait()
+	} else {
+		data, err = ioutil.ReadAll(r.Body)
+	}
 	if err != nil {
 		glog.Error("Could not read request body: ", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -139,8 +198,9 @@ func (h *lphttp) ServeSegment(w http.ResponseWriter, r *http.Request) {
 	// Upload to OS and construct segment result set
 	var segments []*net.TranscodedSegmentData
 	var pixels int64
+	_, uploadSpan := monitor.StartSpan(ctx, "upload")
 	for i := 0; err == nil && i < len(res.TranscodeData.Segments); i++ {
-		name := fmt.Sprintf("%s/%d.ts", segData.Profiles[i].Name, segData.Seq) // ANGIE - NEED TO EDIT OUT JOB PROFILES
+		name := fmt.Sprintf("%s/%d%s", segData.Profiles[i].Name, segData.Seq, segData.Encoders.SegmentExtension(segData.Profiles[i].Name)) // ANGIE - NEED TO EDIT OUT JOB PROFILES
 		uri, err := res.OS.SaveData(name, res.TranscodeData.Segments[i].Data)
 		if err != nil {
 			glog.Error("Could not upload segment ", segData.Seq)
@@ -153,13 +213,15 @@ func (h *lphttp) ServeSegment(w http.ResponseWriter, r *http.Request) {
 		}
 		segments = append(segments, d)
 	}
+	monitor.EndSpan(uploadSpan, err)
 
 	// Debit the fee for the total pixel count
-	orch.DebitFees(segData.ManifestID, payment.GetExpectedPrice(), pixels)
+	orch.DebitFees(segData.ManifestID, price, pixels)
 
 	// construct the response
 	var result net.TranscodeResult
 	if err != nil {
+		span.SetStatus(octrace.Status{Code: octrace.StatusCodeUnknown, Message: err.Error()})
 		glog.Errorf("Could not transcode seqNo=%d mid=%s err=%v", segData.Seq, segData.ManifestID, err)
 		result = net.TranscodeResult{Result: &net.TranscodeResult_Error{Error: err.Error()}}
 	} else {
@@ -176,12 +238,78 @@ func (h *lphttp) ServeSegment(w http.ResponseWriter, r *http.Request) {
 		Result: result.Result,
 		Info:   oInfo, // oInfo will be non-nil if we need to send an update to the broadcaster
 	}
+	if debugCaptured(segData.ManifestID) {
+		captureDebug(segData.ManifestID, "transcodeResult", captureTranscodeResult(tr))
+	}
 	buf, err := proto.Marshal(tr)
 	if err != nil {
 		glog.Error("Unable to marshal transcode result ", err)
 		return
 	}
 	w.Write(buf)
+
+	if Archive != nil {
+		// The renditions are archived with the source segment if they were all returned
+		payloads := [][]byte{data}
+		if tr.GetData() != nil && len(segments) == len(res.TranscodeData.Segments) {
+			for _, rendition := range res.TranscodeData.Segments {
+				payloads = append(payloads, rendition.Data)
+			}
+		}
+		archiveExchange(&common.DBProtocolExchange{
+			Role:       archiveRoleOrchestrator,
+			ManifestID: string(segData.ManifestID),
+			SeqNo:      segData.Seq,
+			Sender:     getPaymentSender(payment),
+			Recipient:  orch.Address(),
+			SegData:    seg,
+			Payment:    r.Header.Get(paymentHeader),
+			Result:     buf,
+			Time:       time.Now().Unix(),
+		}, payloads)
+	}
+}
+
+// processPayment processes a payment for a stream. If the payment is unacceptable an error response is
+// written and false is returned. The returned OrchestratorInfo is non-nil if the broadcaster needs to be
+// sent an update after an acceptable payment error
+func processPayment(orch Orchestrator, w http.ResponseWriter, payment net.Payment, manifestID core.ManifestID) (*net.OrchestratorInfo, bool) {
+	// Let the broadcaster know if its unused credit expired so that it does not count on it anymore
+	if reclaimed := orch.ReclaimedCredit(manifestID); reclaimed != nil {
+		glog.V(common.DEBUG).Infof("Notifying sender of reclaimed credit manifestID=%v amount=%v", manifestID, reclaimed.FloatString(2))
+		w.Header().Set(reclaimedCreditHeader, reclaimed.RatString())
+	}
+
+	paymentError := orch.ProcessPayment(payment, manifestID)
+	if paymentError == nil {
+		return nil, true
+	}
+
+	// Let the broadcaster know which tickets were rejected so it can replace them
+	if paymentErr, ok := paymentError.(*core.PaymentError); ok && paymentErr.Result != nil {
+		if header, err := encodePaymentResult(paymentErr.Result); err != nil {
+			glog.Errorf("Unable to encode payment result: %v", err)
+		} else {
+			w.Header().Set(paymentResultHeader, header)
+		}
+	}
+
+	acceptableErr, ok := paymentError.(core.AcceptableError)
+	if !ok || !acceptableErr.Acceptable() {
+		glog.Errorf("Unacceptable error occured processing payment: %v", paymentError)
+		http.Error(w, paymentError.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	oInfo, err := orchestratorInfo(orch, getPaymentSender(payment), orch.ServiceURI().String())
+	if err != nil {
+		glog.Errorf("Error updating orchestrator info: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	glog.Errorf("Acceptable error occured when processing payment: %v", paymentError)
+
+	return oInfo, true
 }
 
 func getPayment(header string) (net.Payment, error) {
@@ -216,40 +344,78 @@ func verifySegCreds(orch Orchestrator, segCreds string, broadcaster ethcommon.Ad
 		glog.Error("Unable to unmarshal ", err)
 		return nil, err
 	}
-	profiles, err := common.BytesToVideoProfile(segData.Profiles)
-	if err != nil {
-		glog.Error("Unable to deserialize profiles ", err)
+	if err := validateStrictSegData(&segData); err != nil {
+		glog.Error("Rejecting segment: ", err)
 		return nil, err
 	}
-	mid := core.ManifestID(segData.ManifestId)
-
-	var os *net.OSInfo
-	if len(segData.Storage) > 0 {
-		os = segData.Storage[0]
-	}
-
-	md := &core.SegTranscodingMetadata{
-		ManifestID: mid,
-		Seq:        segData.Seq,
-		Hash:       ethcommon.BytesToHash(segData.Hash),
-		Profiles:   profiles,
-		OS:         os,
+	md, err := segDataToMetadata(&segData)
+	if err != nil {
+		return nil, err
 	}
+	mid := md.ManifestID
 
 	if !orch.VerifySig(broadcaster, string(md.Flatten()), segData.Sig) {
 		glog.Error("Sig check failed")
 		return nil, errSegSig
 	}
 
-	if err := orch.CheckCapacity(mid); err != nil {
+	// A resumed stream keeps the capacity slot it had before the interruption
+	if err := orch.ResumeStream(md); err != nil {
+		glog.Errorf("Cannot resume manifest=%s seqNo=%d: %v", mid, md.Seq, err)
+		return nil, err
+	}
+
+	if err := orch.CheckCapacity(mid, md.Profiles); err != nil {
 		glog.Error("Cannot process manifest: ", err)
 		return nil, err
 	}
 
+	if required := core.RequiredCapabilities(md.Encoders); !core.HasCapabilities(orch.Capabilities(), required) {
+		glog.Errorf("Cannot transcode manifest=%s without capabilities=%v", mid, required)
+		return nil, errSegCapabilities
+	}
+
+	if md.Complexity > 0 {
+		glog.V(common.DEBUG).Infof("Received profiles adjusted for content complexity manifestID=%v seqNo=%v complexity=%v", mid, md.Seq, md.Complexity)
+	}
+
 	return md, nil
 }
 
-func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64) (*net.TranscodeData, error) {
+// segDataToMetadata returns the transcoding metadata of the segment credentials of a segment
+func segDataToMetadata(segData *net.SegData) (*core.SegTranscodingMetadata, error) {
+	var profiles []ffmpeg.VideoProfile
+	var encoders common.ProfileEncoders
+	var err error
+	if len(segData.FullProfiles) > 0 {
+		profiles, encoders, err = common.NetProfilesToFFmpegProfiles(segData.FullProfiles)
+	} else {
+		profiles, err = common.BytesToVideoProfile(segData.Profiles)
+	}
+	if err != nil {
+		glog.Error("Unable to deserialize profiles ", err)
+		return nil, err
+	}
+
+	var os *net.OSInfo
+	if len(segData.Storage) > 0 {
+		os = segData.Storage[0]
+	}
+
+	return &core.SegTranscodingMetadata{
+		ManifestID:   core.ManifestID(segData.ManifestId),
+		Seq:          segData.Seq,
+		Hash:         ethcommon.BytesToHash(segData.Hash),
+		Profiles:     profiles,
+		Encoders:     encoders,
+		FullProfiles: segData.FullProfiles,
+		OS:           os,
+		Complexity:   float64(segData.Complexity),
+		Resumption:   segData.Resumption,
+	}, nil
+}
+
+func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64) (_ *net.TranscodeData, err error) {
 	uploaded := seg.Name != "" // hijack seg.Name to convey the uploaded URI
 
 	segCreds, err := genSegCreds(sess, seg)
@@ -275,7 +441,10 @@ func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64)
 	// at the time of completion
 	defer completeBalanceUpdate(sess, balUpdate)
 
+	_, paymentSpan := sess.Trace.startSpan("payment")
 	payment, err := genPayment(sess, balUpdate.NumTickets)
+	paymentSpan.AddAttributes(octrace.Int64Attribute("tickets", int64(balUpdate.NumTickets)))
+	monitor.EndSpan(paymentSpan, err)
 	if err != nil {
 		glog.Errorf("Could not create payment: %v", err)
 
@@ -299,17 +468,38 @@ func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64)
 
 	req.Header.Set(segmentHeader, segCreds)
 	req.Header.Set(paymentHeader, payment)
+	if sess.Establishing {
+		req.Header.Set(firstSegmentHeader, "1")
+	}
 	if uploaded {
 		req.Header.Set("Content-Type", "application/vnd+livepeer.uri")
 	} else {
 		req.Header.Set("Content-Type", "video/MP2T")
 	}
 
+	if debugCaptured(sess.ManifestID) {
+		captureDebug(sess.ManifestID, "submitSegment", map[string]interface{}{
+			"orchestrator": ti.Transcoder,
+			"nonce":        nonce,
+			"seqNo":        seg.SeqNo,
+			"bytes":        len(data),
+			"headers":      captureHeaders(req.Header),
+			"segData":      captureSegData(segCreds),
+			"payment":      capturePayment(payment),
+		})
+	}
+
+	// The orchestrator continues the trace of the segment from the span of the request
+	submitCtx, submitSpan := sess.Trace.startSpan("submit")
+	defer func() { monitor.EndSpan(submitSpan, err) }()
+	monitor.InjectSpan(submitCtx, req)
+
 	glog.Infof("Submitting segment nonce=%d seqNo=%d : %v bytes", nonce, seg.SeqNo, len(data))
 	start := time.Now()
 	resp, err := httpClient.Do(req)
 	uploadDur := time.Since(start)
 	if err != nil {
+		captureDebug(sess.ManifestID, "submitError", map[string]interface{}{"seqNo": seg.SeqNo, "error": err.Error()})
 		glog.Errorf("Unable to submit segment nonce=%d seqNo=%d: %v", nonce, seg.SeqNo, err)
 		if monitor.Enabled {
 			monitor.SegmentUploadFailed(nonce, seg.SeqNo, monitor.SegmentUploadErrorUnknown, err.Error(), false)
@@ -317,10 +507,34 @@ func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64)
 		return nil, err
 	}
 	defer resp.Body.Close()
+	captureDebug(sess.ManifestID, "segmentResponse", map[string]interface{}{
+		"seqNo":    seg.SeqNo,
+		"status":   resp.StatusCode,
+		"headers":  captureHeaders(resp.Header),
+		"uploadMs": int64(uploadDur / time.Millisecond),
+	})
 
 	// If the segment was submitted then we assume that any payment included was
 	// submitted as well so we consider the update's credit as spent
 	balUpdate.Status = CreditSpent
+
+	// If some of the tickets were rejected then the orchestrator did not credit their value
+	// so we exclude it from the update's credit. The shortfall will be covered by the next payment
+	if header := resp.Header.Get(paymentResultHeader); header != "" {
+		if err := applyPaymentResult(balUpdate, header, resp.StatusCode); err != nil {
+			glog.Errorf("Unable to apply payment result for segment nonce=%d seqNo=%d: %v", nonce, seg.SeqNo, err)
+		}
+	}
+	if header := resp.Header.Get(reclaimedCreditHeader); header != "" {
+		if err := applyReclaimedCredit(balUpdate, header); err != nil {
+			glog.Errorf("Unable to apply reclaimed credit for segment nonce=%d seqNo=%d: %v", nonce, seg.SeqNo, err)
+		}
+	}
+	sess.Migrate = resp.Header.Get(migrateHeader) != ""
+	sess.Trace.payment(balUpdate.NumTickets, balUpdate.NewCredit)
+	if BroadcastABTest != nil {
+		BroadcastABTest.Payment(sess.ABTestArm, balUpdate.NewCredit)
+	}
 	if monitor.Enabled && sess.OrchestratorInfo.TicketParams != nil {
 		recipient := ethcommon.BytesToAddress(sess.OrchestratorInfo.TicketParams.Recipient).String()
 		mid := string(sess.ManifestID)
@@ -355,6 +569,7 @@ func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64)
 		return nil, err
 	}
 	transcodeDur := tookAllDur - uploadDur
+	sess.Trace.timings(uploadDur, transcodeDur)
 
 	var tr net.TranscodeResult
 	err = proto.Unmarshal(data, &tr)
@@ -365,10 +580,29 @@ func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64)
 		}
 		return nil, err
 	}
+	if debugCaptured(sess.ManifestID) {
+		captureDebug(sess.ManifestID, "transcodeResult", captureTranscodeResult(&tr))
+	}
+	if Archive != nil {
+		archiveExchange(&common.DBProtocolExchange{
+			Role:       archiveRoleBroadcaster,
+			ManifestID: string(sess.ManifestID),
+			SeqNo:      int64(seg.SeqNo),
+			Sender:     sess.Broadcaster.Address(),
+			Recipient:  sessionRecipient(sess),
+			SegData:    segCreds,
+			Payment:    payment,
+			Result:     data,
+			Time:       time.Now().Unix(),
+		}, [][]byte{seg.Data})
+	}
 
 	// update OrchestratorInfo if necessary
 	if tr.Info != nil {
 		defer updateOrchestratorInfo(sess, tr.Info)
+	} else if sess.Establishing {
+		glog.Errorf("Orchestrator did not establish the session of the first segment nonce=%d seqNo=%d orch=%s", nonce, seg.SeqNo, ti.Transcoder)
+		return nil, errors.New("session not established")
 	}
 
 	// check for errors and exit early if there's anything unusual
@@ -406,6 +640,10 @@ func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64)
 	// We treat a response as "receiving change" where the change is the difference between the credit and debit for the update
 	balUpdate.Status = ReceivedChange
 	priceInfo := sess.OrchestratorInfo.PriceInfo
+	if sess.Establishing {
+		// The first segment over the fast path is charged at the price of the info returned with it
+		priceInfo = tr.Info.PriceInfo
+	}
 	if priceInfo != nil {
 		// The update's debit is the transcoding fee which is computed as the total number of pixels processed
 		// for all results returned multiplied by the orchestrator's price
@@ -422,13 +660,15 @@ func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64)
 		monitor.SegmentTranscoded(nonce, seg.SeqNo, transcodeDur, common.ProfilesNames(sess.Profiles))
 	}
 
-	glog.Infof("Successfully transcoded segment nonce=%d manifestID=%s segName=%s seqNo=%d", nonce, string(sess.ManifestID), seg.Name, seg.SeqNo)
+	glog.Infof("Successfully transcoded segment nonce=%d manifestID=%s segName=%s seqNo=%d", nonce, sess.ManifestID, seg.Name, seg.SeqNo)
 
 	return tdata, nil
 }
 
 func updateOrchestratorInfo(sess *BroadcastSession, oInfo *net.OrchestratorInfo) {
 	sess.OrchestratorInfo = oInfo
+	sess.Establishing = false
+	reportDeprecations(oInfo.Transcoder, oInfo.Deprecations)
 
 	if len(oInfo.Storage) > 0 {
 		sess.OrchestratorOS = drivers.NewSession(oInfo.Storage[0])
@@ -454,6 +694,15 @@ func genSegCreds(sess *BroadcastSession, seg *stream.HLSSegment) (string, error)
 		Hash:       ethcommon.BytesToHash(hash),
 		Profiles:   sess.Profiles,
 	}
+	// Custom profiles cannot be identified by name so send their full definitions
+	if common.NeedsFullProfiles(sess.Profiles, sess.Encoders) {
+		fullProfiles, err := common.FFmpegProfilesToNetProfiles(sess.Profiles, sess.Encoders)
+		if err != nil {
+			glog.Error("Unable to serialize profiles ", err)
+			return "", err
+		}
+		md.FullProfiles = fullProfiles
+	}
 	sig, err := sess.Broadcaster.Sign(md.Flatten())
 	if err != nil {
 		return "", err
@@ -467,13 +716,17 @@ func genSegCreds(sess *BroadcastSession, seg *stream.HLSSegment) (string, error)
 
 	// Generate serialized segment info
 	segData := &net.SegData{
-		ManifestId: []byte(md.ManifestID),
-		Seq:        md.Seq,
-		Hash:       hash,
-		Profiles:   common.ProfilesToTranscodeOpts(sess.Profiles),
-		Sig:        sig,
-		Storage:    storage,
+		ManifestId:   []byte(md.ManifestID),
+		Seq:          md.Seq,
+		Hash:         hash,
+		Profiles:     common.ProfilesToTranscodeOpts(sess.Profiles),
+		Sig:          sig,
+		Storage:      storage,
+		FullProfiles: md.FullProfiles,
+		Complexity:   float32(sess.Complexity),
+		Resumption:   sess.Resumption,
 	}
+
 	data, err := proto.Marshal(segData)
 	if err != nil {
 		glog.Error("Unable to marshal ", err)
@@ -483,6 +736,11 @@ func genSegCreds(sess *BroadcastSession, seg *stream.HLSSegment) (string, error)
 }
 
 func newBalanceUpdate(sess *BroadcastSession) (*BalanceUpdate, error) {
+	return stageBalanceUpdate(sess, 1)
+}
+
+// stageBalanceUpdate creates a BalanceUpdate with enough credit to pay for numSegments segments
+func stageBalanceUpdate(sess *BroadcastSession, numSegments int) (*BalanceUpdate, error) {
 	update := &BalanceUpdate{
 		ExistingCredit: big.NewRat(0, 1),
 		NewCredit:      big.NewRat(0, 1),
@@ -490,7 +748,8 @@ func newBalanceUpdate(sess *BroadcastSession) (*BalanceUpdate, error) {
 		Status:         Staged,
 	}
 
-	if sess.Sender == nil || sess.Balance == nil {
+	// The first segment over the fast path is paid for with the next segment
+	if sess.Sender == nil || sess.Balance == nil || sess.Establishing {
 		return update, nil
 	}
 
@@ -499,11 +758,43 @@ func newBalanceUpdate(sess *BroadcastSession) (*BalanceUpdate, error) {
 		return nil, err
 	}
 
-	update.NumTickets, update.NewCredit, update.ExistingCredit = sess.Balance.StageUpdate(ev, ev)
+	// The credit required for a segment is estimated as the EV of a single ticket
+	minCredit := ev
+	if numSegments > 1 {
+		minCredit = new(big.Rat).Mul(ev, new(big.Rat).SetInt64(int64(numSegments)))
+	}
+	update.NumTickets, update.NewCredit, update.ExistingCredit = sess.Balance.StageUpdate(minCredit, ev)
+
+	// Split payments that exceed the orchestrator's batch limits across multiple segments.
+	// The remaining credit gap is covered by the tickets sent with subsequent segments
+	if maxTickets := maxTicketsPerPayment(sess.OrchestratorInfo); maxTickets > 0 && update.NumTickets > maxTickets {
+		glog.V(common.DEBUG).Infof("Capping payment at orchestrator batch limit orch=%v numTickets=%v maxTickets=%v", sess.OrchestratorInfo.Transcoder, update.NumTickets, maxTickets)
+
+		update.NumTickets = maxTickets
+		update.NewCredit = new(big.Rat).Mul(new(big.Rat).SetInt64(int64(maxTickets)), ev)
+	}
 
 	return update, nil
 }
 
+// maxTicketsPerPayment returns the maximum number of tickets that an orchestrator accepts
+// with a single payment. 0 means there is no limit
+func maxTicketsPerPayment(info *net.OrchestratorInfo) int {
+	if info == nil {
+		return 0
+	}
+
+	var maxFaceValue, faceValue *big.Int
+	if len(info.MaxBatchFaceValue) > 0 {
+		maxFaceValue = new(big.Int).SetBytes(info.MaxBatchFaceValue)
+	}
+	if info.TicketParams != nil {
+		faceValue = new(big.Int).SetBytes(info.TicketParams.FaceValue)
+	}
+
+	return core.MaxTicketsPerBatch(int(info.MaxTicketsPerPayment), maxFaceValue, faceValue)
+}
+
 func completeBalanceUpdate(sess *BroadcastSession, update *BalanceUpdate) {
 	if sess.Balance == nil {
 		return
@@ -530,11 +821,86 @@ func completeBalanceUpdate(sess *BroadcastSession, update *BalanceUpdate) {
 	sess.Balance.Credit(change)
 }
 
+func encodePaymentResult(result *net.PaymentResult) (string, error) {
+	data, err := proto.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+func getPaymentResult(header string) (*net.PaymentResult, error) {
+	buf, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		return nil, errors.Wrap(err, "base64 decode error")
+	}
+	var result net.PaymentResult
+	if err := proto.Unmarshal(buf, &result); err != nil {
+		return nil, errors.Wrap(err, "protobuf unmarshal error")
+	}
+
+	return &result, nil
+}
+
+func applyPaymentResult(update *BalanceUpdate, header string, statusCode int) error {
+	result, err := getPaymentResult(header)
+	if err != nil {
+		return err
+	}
+
+	shortfall, ok := new(big.Rat).SetString(result.Shortfall)
+	if !ok {
+		return fmt.Errorf("invalid payment shortfall %v", result.Shortfall)
+	}
+
+	glog.Errorf("Orchestrator rejected tickets accepted=%v rejected=%v shortfall=%v", len(result.AcceptedNonces), len(result.RejectedNonces), shortfall.FloatString(2))
+
+	update.NewCredit.Sub(update.NewCredit, shortfall)
+	if update.NewCredit.Sign() < 0 {
+		update.NewCredit.SetInt64(0)
+	}
+
+	// If the segment was rejected then the orchestrator did not debit anything
+	// so all of the credit that it accepted is returned as change
+	if statusCode != http.StatusOK {
+		update.Status = ReceivedChange
+	}
+
+	return nil
+}
+
+// applyReclaimedCredit excludes credit that the orchestrator reclaimed after it expired from the existing credit of an update
+func applyReclaimedCredit(update *BalanceUpdate, header string) error {
+	reclaimed, ok := new(big.Rat).SetString(header)
+	if !ok {
+		return fmt.Errorf("invalid reclaimed credit %v", header)
+	}
+
+	glog.Errorf("Orchestrator reclaimed expired credit amount=%v", reclaimed.FloatString(2))
+
+	update.ExistingCredit = new(big.Rat).Sub(update.ExistingCredit, reclaimed)
+	if update.ExistingCredit.Sign() < 0 {
+		update.ExistingCredit.SetInt64(0)
+	}
+
+	return nil
+}
+
 func genPayment(sess *BroadcastSession, numTickets int) (string, error) {
 	if sess.Sender == nil {
 		return "", nil
 	}
 
+	// The first segment over the fast path is sent before the price is known and without tickets
+	if sess.Establishing {
+		data, err := proto.Marshal(&net.Payment{Sender: sess.Broadcaster.Address().Bytes()})
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(data), nil
+	}
+
 	// Compare Orchestrator Price against BroadcastConfig.MaxPrice
 	if err := validatePrice(sess); err != nil {
 		return "", err
@@ -546,11 +912,39 @@ func genPayment(sess *BroadcastSession, numTickets int) (string, error) {
 	}
 
 	if numTickets > 0 {
+		tracker := BroadcastSpendTracker
+		var totalEV *big.Rat
+		if tracker != nil || BroadcastQuotas != nil || BroadcastSpendReporter != nil || LiveStats != nil {
+			ev, err := sess.Sender.EV(sess.PMSessionID)
+			if err != nil {
+				return "", err
+			}
+			totalEV = new(big.Rat).Mul(ev, new(big.Rat).SetInt64(int64(numTickets)))
+		}
+		if tracker != nil {
+			if err := tracker.CheckBudget(string(sess.ManifestID), totalEV); err != nil {
+				return "", err
+			}
+		}
+
 		batch, err := sess.Sender.CreateTicketBatch(sess.PMSessionID, numTickets)
 		if err != nil {
 			return "", err
 		}
 
+		if tracker != nil {
+			tracker.TicketsIssued(string(sess.ManifestID), batch.TicketParams, numTickets)
+		}
+		if BroadcastQuotas != nil {
+			BroadcastQuotas.Spend(sess.ManifestID, totalEV)
+		}
+		if BroadcastSpendReporter != nil {
+			BroadcastSpendReporter.PaymentSent(sess.ManifestID, batch.Recipient, numTickets, totalEV, sessionPrice(sess))
+		}
+		if LiveStats != nil {
+			LiveStats.Payment(sess.ManifestID, sess.OrchestratorInfo.Transcoder, batch.Recipient, numTickets, totalEV)
+		}
+
 		protoPayment.TicketParams = &net.TicketParams{
 			Recipient:         batch.Recipient.Bytes(),
 			FaceValue:         batch.FaceValue.Bytes(),
@@ -527,6 +527,89 @@ func TestServeSegment_InsufficientBalanceError(t *testing.T) {
 	assert.Equal("Insufficient balance", strings.TrimSpace(string(body)))
 }
 
+func TestServeSegment_Draining_SetsMigrateHeader(t *testing.T) {
+	orch := &mockOrchestrator{}
+	handler := serveSegmentHandler(orch)
+
+	require := require.New(t)
+	assert := assert.New(t)
+	orch.On("VerifySig", mock.Anything, mock.Anything, mock.Anything).Return(true)
+
+	s := &BroadcastSession{
+		Broadcaster: stubBroadcaster2(),
+		ManifestID:  core.RandomManifestID(),
+	}
+	seg := &stream.HLSSegment{Data: []byte("foo")}
+	creds, err := genSegCreds(s, seg)
+	require.Nil(err)
+
+	orch.On("ProcessPayment", net.Payment{}, s.ManifestID).Return(nil)
+	orch.On("SufficientBalance", s.ManifestID).Return(false)
+
+	headers := map[string]string{
+		paymentHeader: "",
+		segmentHeader: creds,
+	}
+	resp := httpPostResp(handler, bytes.NewReader(seg.Data), headers)
+	resp.Body.Close()
+	assert.Empty(resp.Header.Get(migrateHeader))
+
+	// Broadcasters are asked to move drained streams
+	orch.draining = true
+	resp = httpPostResp(handler, bytes.NewReader(seg.Data), headers)
+	resp.Body.Close()
+	assert.Equal("1", resp.Header.Get(migrateHeader))
+}
+
+func TestServeSegment_PaymentError_SetsPaymentResultHeader(t *testing.T) {
+	orch := &mockOrchestrator{}
+	handler := serveSegmentHandler(orch)
+
+	require := require.New(t)
+	assert := assert.New(t)
+	orch.On("VerifySig", mock.Anything, mock.Anything, mock.Anything).Return(true)
+
+	s := &BroadcastSession{
+		Broadcaster: stubBroadcaster2(),
+		ManifestID:  core.RandomManifestID(),
+	}
+	seg := &stream.HLSSegment{Data: []byte("foo")}
+	creds, err := genSegCreds(s, seg)
+	require.Nil(err)
+
+	result := &net.PaymentResult{
+		AcceptedNonces: []uint32{1},
+		RejectedNonces: []uint32{2, 3},
+		Credit:         "1/2",
+		Shortfall:      "1",
+	}
+	paymentErr := &core.PaymentError{
+		AcceptableError: pm.NewMockReceiveError(errors.New("some error"), false),
+		Result:          result,
+	}
+	orch.On("ProcessPayment", net.Payment{}, s.ManifestID).Return(paymentErr).Once()
+
+	headers := map[string]string{
+		paymentHeader: "",
+		segmentHeader: creds,
+	}
+	resp := httpPostResp(handler, bytes.NewReader(seg.Data), headers)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.Nil(err)
+
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	assert.Equal("some error", strings.TrimSpace(string(body)))
+
+	res, err := getPaymentResult(resp.Header.Get(paymentResultHeader))
+	require.Nil(err)
+	assert.Equal(result.AcceptedNonces, res.AcceptedNonces)
+	assert.Equal(result.RejectedNonces, res.RejectedNonces)
+	assert.Equal(result.Credit, res.Credit)
+	assert.Equal(result.Shortfall, res.Shortfall)
+}
+
 func TestServeSegment_DebitFees_SingleRendition(t *testing.T) {
 	orch := &mockOrchestrator{}
 	handler := serveSegmentHandler(orch)
@@ -949,6 +1032,96 @@ func TestSubmitSegment_Non200StatusCode(t *testing.T) {
 	balance.AssertNotCalled(t, "Credit", mock.Anything)
 }
 
+func TestSubmitSegment_PaymentResult_ExcludesShortfall(t *testing.T) {
+	header, err := encodePaymentResult(&net.PaymentResult{
+		AcceptedNonces: []uint32{1},
+		RejectedNonces: []uint32{2, 3},
+		Credit:         "3",
+		Shortfall:      "4",
+	})
+	require.Nil(t, err)
+
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	mux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(paymentResultHeader, header)
+		http.Error(w, "Insufficient balance", http.StatusBadRequest)
+	})
+
+	newCredit := big.NewRat(7, 1)
+	existingCredit := big.NewRat(5, 1)
+	balance := &mockBalance{}
+	balance.On("StageUpdate", mock.Anything, mock.Anything).Return(3, newCredit, existingCredit)
+	balance.On("Credit", mock.Anything)
+	sender := &pm.MockSender{}
+	sender.On("EV", mock.Anything).Return(nil, nil)
+	batch := &pm.TicketBatch{
+		TicketParams: &pm.TicketParams{
+			Recipient: pm.RandAddress(),
+			FaceValue: big.NewInt(1234),
+			WinProb:   big.NewInt(5678),
+			Seed:      big.NewInt(7777),
+		},
+		TicketExpirationParams: &pm.TicketExpirationParams{},
+		Sender:                 pm.RandAddress(),
+		SenderParams: []*pm.TicketSenderParams{
+			&pm.TicketSenderParams{SenderNonce: 1, Sig: pm.RandBytes(42)},
+			&pm.TicketSenderParams{SenderNonce: 2, Sig: pm.RandBytes(42)},
+			&pm.TicketSenderParams{SenderNonce: 3, Sig: pm.RandBytes(42)},
+		},
+	}
+	sender.On("CreateTicketBatch", mock.Anything, 3).Return(batch, nil)
+
+	s := &BroadcastSession{
+		Broadcaster: stubBroadcaster2(),
+		ManifestID:  core.RandomManifestID(),
+		OrchestratorInfo: &net.OrchestratorInfo{
+			Transcoder: ts.URL,
+			PriceInfo: &net.PriceInfo{
+				PricePerUnit:  1,
+				PixelsPerUnit: 1,
+			},
+		},
+		Balance: balance,
+		Sender:  sender,
+	}
+
+	_, err = SubmitSegment(s, &stream.HLSSegment{}, 0)
+
+	assert := assert.New(t)
+	assert.EqualError(err, "Insufficient balance")
+	// The existing credit and the credit for the accepted tickets are returned to the balance
+	balance.AssertCalled(t, "Credit", mock.MatchedBy(func(amount *big.Rat) bool {
+		return amount.Cmp(big.NewRat(8, 1)) == 0
+	}))
+
+	// Invalid payment results are ignored
+	update := &BalanceUpdate{NewCredit: big.NewRat(7, 1), Status: CreditSpent}
+	err = applyPaymentResult(update, "foo", http.StatusBadRequest)
+	assert.Contains(err.Error(), "base64 decode error")
+	assert.Equal(BalanceUpdateStatus(CreditSpent), update.Status)
+	assert.Zero(update.NewCredit.Cmp(big.NewRat(7, 1)))
+}
+
+func TestApplyReclaimedCredit(t *testing.T) {
+	assert := assert.New(t)
+
+	// The reclaimed credit is excluded from the existing credit
+	update := &BalanceUpdate{ExistingCredit: big.NewRat(5, 1), NewCredit: big.NewRat(7, 1)}
+	assert.Nil(applyReclaimedCredit(update, "3"))
+	assert.Zero(update.ExistingCredit.Cmp(big.NewRat(2, 1)))
+	assert.Zero(update.NewCredit.Cmp(big.NewRat(7, 1)))
+
+	// The existing credit does not become negative
+	assert.Nil(applyReclaimedCredit(update, "5/2"))
+	assert.Zero(update.ExistingCredit.Cmp(big.NewRat(0, 1)))
+
+	// Invalid amounts are ignored
+	update.ExistingCredit = big.NewRat(5, 1)
+	assert.EqualError(applyReclaimedCredit(update, "foo"), "invalid reclaimed credit foo")
+	assert.Zero(update.ExistingCredit.Cmp(big.NewRat(5, 1)))
+}
+
 func TestSubmitSegment_ProtoUnmarshalError(t *testing.T) {
 	ts, mux := stubTLSServer()
 	defer ts.Close()
@@ -1035,6 +1208,47 @@ func TestSubmitSegment_TranscodeResultError(t *testing.T) {
 	balance.AssertNotCalled(t, "Credit", mock.Anything)
 }
 
+func TestSubmitSegment_MigrateHeader(t *testing.T) {
+	tr := &net.TranscodeResult{
+		Result: &net.TranscodeResult_Data{Data: &net.TranscodeData{Sig: []byte("bar")}},
+	}
+	buf, err := proto.Marshal(tr)
+	require.Nil(t, err)
+
+	migrate := true
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	mux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+		if migrate {
+			w.Header().Set(migrateHeader, "1")
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf)
+	})
+
+	s := &BroadcastSession{
+		Broadcaster: stubBroadcaster2(),
+		ManifestID:  core.RandomManifestID(),
+		OrchestratorInfo: &net.OrchestratorInfo{
+			Transcoder: ts.URL,
+			PriceInfo: &net.PriceInfo{
+				PricePerUnit:  1,
+				PixelsPerUnit: 1,
+			},
+		},
+	}
+
+	// The result of the segment is returned along with the request to migrate
+	_, err = SubmitSegment(s, &stream.HLSSegment{}, 0)
+	assert.Nil(t, err)
+	assert.True(t, s.Migrate)
+
+	migrate = false
+	_, err = SubmitSegment(s, &stream.HLSSegment{}, 0)
+	assert.Nil(t, err)
+	assert.False(t, s.Migrate)
+}
+
 func TestSubmitSegment_Success(t *testing.T) {
 	require := require.New(t)
 
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/monitor"
+	octrace "go.opencensus.io/trace"
+)
+
+// SegmentTraces keeps the traces of the most recent segments of the broadcaster, if enabled
+var SegmentTraces *SegmentTraceBuffer
+
+// SegmentTrace describes how a segment of a stream was transcoded
+type SegmentTrace struct {
+	ManifestID core.ManifestID `json:"manifestID"`
+	SeqNo      uint64          `json:"seqNo"`
+	// Duration of the segment in seconds
+	Duration float64   `json:"duration"`
+	Start    time.Time `json:"start"`
+	// Time from the segment being received till it was transcoded or given up on
+	TotalMs int64 `json:"totalMs"`
+	// Error that the segment was dropped with before it was sent to an orchestrator
+	Error string `json:"error,omitempty"`
+	// Every try to transcode the segment with an orchestrator, in order
+	Attempts []*SegmentAttempt `json:"attempts"`
+
+	// Span of the segment if it is traced across nodes
+	ctx  context.Context
+	span *octrace.Span
+}
+
+// SegmentAttempt describes a try to transcode a segment with an orchestrator
+type SegmentAttempt struct {
+	Orchestrator string `json:"orchestrator"`
+	// Time to submit the segment to the orchestrator
+	UploadMs int64 `json:"uploadMs"`
+	// Time from the segment being submitted till the orchestrator responded
+	TranscodeMs int64 `json:"transcodeMs"`
+	// Time to download the transcoded segments
+	DownloadMs int64 `json:"downloadMs"`
+	// Number of tickets sent with the segment and their expected value in wei
+	Tickets      int    `json:"tickets"`
+	PaymentValue string `json:"paymentValue,omitempty"`
+	Error        string `json:"error,omitempty"`
+
+	ctx  context.Context
+	span *octrace.Span
+}
+
+func newSegmentTrace(mid core.ManifestID, seqNo uint64, duration float64) *SegmentTrace {
+	if SegmentTraces == nil && !monitor.TracingEnabled {
+		return nil
+	}
+	t := &SegmentTrace{ManifestID: mid, SeqNo: seqNo, Duration: duration, Start: time.Now()}
+	if monitor.TracingEnabled {
+		t.ctx, t.span = monitor.StartSpan(context.Background(), "segment")
+		t.span.AddAttributes(
+			octrace.StringAttribute("manifestID", monitor.Redact(string(mid))),
+			octrace.Int64Attribute("seqNo", int64(seqNo)),
+			octrace.Float64Attribute("duration", duration),
+		)
+	}
+	return t
+}
+
+// startSpan starts a span of the segment as a child of the span of the trace. Returns a nil
+// span if the segment is not traced
+func (t *SegmentTrace) startSpan(name string) (context.Context, *octrace.Span) {
+	if t == nil {
+		return context.Background(), nil
+	}
+	return monitor.StartSpan(t.ctx, name)
+}
+
+// attempt adds a try with the orchestrator to the trace. Returns nil if the segment is not traced
+func (t *SegmentTrace) attempt(orch string) *SegmentAttempt {
+	if t == nil {
+		return nil
+	}
+	a := &SegmentAttempt{Orchestrator: orch}
+	if t.span != nil {
+		a.ctx, a.span = monitor.StartSpan(t.ctx, "attempt")
+		a.span.AddAttributes(octrace.StringAttribute("orchestrator", orch))
+	}
+	t.Attempts = append(t.Attempts, a)
+	return a
+}
+
+// fail records the error that the segment was dropped with
+func (t *SegmentTrace) fail(err error) {
+	if t != nil && err != nil {
+		t.Error = err.Error()
+	}
+}
+
+// finish records the total time spent on the segment and keeps the trace
+func (t *SegmentTrace) finish() {
+	if t == nil {
+		return
+	}
+	monitor.EndSpan(t.span, traceError(t.Error))
+	if SegmentTraces == nil {
+		return
+	}
+	t.TotalMs = int64(time.Since(t.Start) / time.Millisecond)
+	SegmentTraces.Add(t)
+}
+
+func (a *SegmentAttempt) timings(upload, transcode time.Duration) {
+	if a == nil {
+		return
+	}
+	a.UploadMs = int64(upload / time.Millisecond)
+	a.TranscodeMs = int64(transcode / time.Millisecond)
+}
+
+func (a *SegmentAttempt) download(dur time.Duration) {
+	if a != nil {
+		a.DownloadMs = int64(dur / time.Millisecond)
+	}
+}
+
+func (a *SegmentAttempt) payment(tickets int, value *big.Rat) {
+	if a == nil {
+		return
+	}
+	a.Tickets = tickets
+	if value != nil {
+		a.PaymentValue = value.RatString()
+	}
+}
+
+func (a *SegmentAttempt) fail(err error) {
+	if a != nil && err != nil {
+		a.Error = err.Error()
+	}
+}
+
+// end ends the span of the try
+func (a *SegmentAttempt) end() {
+	if a != nil {
+		monitor.EndSpan(a.span, traceError(a.Error))
+	}
+}
+
+// startSpan starts a span of the try as a child of its span. Returns a nil span if the segment
+// is not traced
+func (a *SegmentAttempt) startSpan(name string) (context.Context, *octrace.Span) {
+	if a == nil {
+		return context.Background(), nil
+	}
+	return monitor.StartSpan(a.ctx, name)
+}
+
+func traceError(msg string) error {
+	if msg == "" {
+		return nil
+	}
+	return errors.New(msg)
+}
+
+// SegmentTraceBuffer is a ring buffer of the traces of the most recent segments
+type SegmentTraceBuffer struct {
+	mu     sync.Mutex
+	traces []*SegmentTrace
+	next   int
+	full   bool
+}
+
+// NewSegmentTraceBuffer creates a buffer of the traces of the last size segments
+func NewSegmentTraceBuffer(size int) *SegmentTraceBuffer {
+	return &SegmentTraceBuffer{traces: make([]*SegmentTrace, size)}
+}
+
+// Add keeps a trace, replacing the oldest one if the buffer is full
+func (b *SegmentTraceBuffer) Add(t *SegmentTrace) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.traces) == 0 {
+		return
+	}
+	b.traces[b.next] = t
+	b.next = (b.next + 1) % len(b.traces)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Traces returns the kept traces of the segments of a stream, oldest first. The traces of all
+// the streams are returned if mid is empty
+func (b *SegmentTraceBuffer) Traces(mid core.ManifestID) []*SegmentTrace {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	start, n := 0, b.next
+	if b.full {
+		start, n = b.next, len(b.traces)
+	}
+	traces := []*SegmentTrace{}
+	for i := 0; i < n; i++ {
+		t := b.traces[(start+i)%len(b.traces)]
+		if mid == "" || t.ManifestID == mid {
+			traces = append(traces, t)
+		}
+	}
+	return traces
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSegmentTraceBuffer(t *testing.T) {
+	assert := assert.New(t)
+
+	b := NewSegmentTraceBuffer(3)
+	assert.NotNil(b.Traces(""))
+	assert.Empty(b.Traces(""))
+
+	b.Add(&SegmentTrace{ManifestID: "foo", SeqNo: 1})
+	b.Add(&SegmentTrace{ManifestID: "bar", SeqNo: 1})
+	seqNos := func(traces []*SegmentTrace) []uint64 {
+		var s []uint64
+		for _, t := range traces {
+			s = append(s, t.SeqNo)
+		}
+		return s
+	}
+	assert.Len(b.Traces(""), 2)
+	assert.Equal([]uint64{1}, seqNos(b.Traces("foo")))
+	assert.Empty(b.Traces("baz"))
+
+	// The oldest traces are replaced once the buffer is full
+	b.Add(&SegmentTrace{ManifestID: "foo", SeqNo: 2})
+	b.Add(&SegmentTrace{ManifestID: "foo", SeqNo: 3})
+	b.Add(&SegmentTrace{ManifestID: "foo", SeqNo: 4})
+	assert.Equal([]uint64{2, 3, 4}, seqNos(b.Traces("foo")))
+	assert.Empty(b.Traces("bar"))
+
+	// A buffer without room keeps nothing
+	b = NewSegmentTraceBuffer(0)
+	b.Add(&SegmentTrace{ManifestID: "foo"})
+	assert.Empty(b.Traces(""))
+}
+
+func TestSegmentTrace_Disabled(t *testing.T) {
+	assert := assert.New(t)
+
+	SegmentTraces = nil
+	trace := newSegmentTrace("foo", 1, 2)
+	assert.Nil(trace)
+
+	// Nothing is recorded without a trace
+	attempt := trace.attempt("orch")
+	assert.Nil(attempt)
+	trace.fail(errors.New("error"))
+	trace.finish()
+	attempt.timings(time.Second, time.Second)
+	attempt.download(time.Second)
+	attempt.payment(1, big.NewRat(1, 1))
+	attempt.fail(errors.New("error"))
+}
+
+func TestSegmentTrace_Records(t *testing.T) {
+	assert := assert.New(t)
+
+	SegmentTraces = NewSegmentTraceBuffer(10)
+	defer func() { SegmentTraces = nil }()
+
+	trace := newSegmentTrace("foo", 7, 2)
+	a1 := trace.attempt("orch1")
+	a1.timings(100*time.Millisecond, 2*time.Second)
+	a1.payment(2, big.NewRat(300, 1))
+	a1.fail(errors.New("download error"))
+	a2 := trace.attempt("orch2")
+	a2.download(50 * time.Millisecond)
+	trace.finish()
+
+	traces := SegmentTraces.Traces("foo")
+	assert.Len(traces, 1)
+	assert.Equal(uint64(7), traces[0].SeqNo)
+	assert.Equal(2.0, traces[0].Duration)
+	assert.Empty(traces[0].Error)
+	assert.Len(traces[0].Attempts, 2)
+	assert.Equal(&SegmentAttempt{Orchestrator: "orch1", UploadMs: 100, TranscodeMs: 2000, Tickets: 2, PaymentValue: "300", Error: "download error"}, traces[0].Attempts[0])
+	assert.Equal(&SegmentAttempt{Orchestrator: "orch2", DownloadMs: 50}, traces[0].Attempts[1])
+}
+
+func TestTranscodeSegment_Trace(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	SegmentTraces = NewSegmentTraceBuffer(10)
+	defer func() { SegmentTraces = nil }()
+
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	mux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+		buf, err := proto.Marshal(&net.TranscodeResult{
+			Result: &net.TranscodeResult_Data{
+				Data: &net.TranscodeData{
+					Segments: []*net.TranscodedSegmentData{{Url: "test.flv"}},
+					Sig:      []byte("bar"),
+				},
+			},
+		})
+		require.Nil(err)
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf)
+	})
+
+	sess := StubBroadcastSession(ts.URL)
+	sess.Profiles = []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}
+	cxn := &rtmpConnection{
+		mid:         core.ManifestID("foo"),
+		nonce:       7,
+		pl:          &stubPlaylistManager{core.ManifestID("foo")},
+		profile:     &ffmpeg.P144p30fps16x9,
+		sessManager: bsmWithSessList([]*BroadcastSession{sess}),
+	}
+
+	trace := newSegmentTrace(cxn.mid, 3, 1)
+	err := transcodeSegment(cxn, &stream.HLSSegment{SeqNo: 3, Data: []byte("dummy")}, "dummy", trace)
+	assert.Nil(err)
+	assert.Nil(sess.Trace)
+	require.Len(trace.Attempts, 1)
+	assert.Equal(ts.URL, trace.Attempts[0].Orchestrator)
+	assert.Empty(trace.Attempts[0].Error)
+
+	// Failures are recorded in the attempt
+	trace = newSegmentTrace(cxn.mid, 4, 1)
+	cxn.sessManager = bsmWithSessList([]*BroadcastSession{StubBroadcastSession("https://127.0.0.1:1")})
+	err = transcodeSegment(cxn, &stream.HLSSegment{SeqNo: 4, Data: []byte("dummy")}, "dummy", trace)
+	assert.NotNil(err)
+	require.Len(trace.Attempts, 1)
+	assert.Equal(err.Error(), trace.Attempts[0].Error)
+}
+
+func TestGetSegmentTrace(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := newMockServer()
+	defer srv.Close()
+
+	// Traces are not kept by default
+	SegmentTraces = nil
+	res, err := http.Get(fmt.Sprintf("%s/segmentTrace?manifest=foo", srv.URL))
+	require.Nil(err)
+	res.Body.Close()
+	assert.Equal(http.StatusInternalServerError, res.StatusCode)
+
+	SegmentTraces = NewSegmentTraceBuffer(10)
+	defer func() { SegmentTraces = nil }()
+	SegmentTraces.Add(&SegmentTrace{ManifestID: "foo", SeqNo: 1, Attempts: []*SegmentAttempt{{Orchestrator: "orch"}}})
+	SegmentTraces.Add(&SegmentTrace{ManifestID: "bar", SeqNo: 2})
+
+	get := func(query string) []*SegmentTrace {
+		res, err := http.Get(fmt.Sprintf("%s/segmentTrace%s", srv.URL, query))
+		require.Nil(err)
+		defer res.Body.Close()
+		require.Equal(http.StatusOK, res.StatusCode)
+		assert.Equal("application/json", res.Header.Get("Content-Type"))
+		body, err := ioutil.ReadAll(res.Body)
+		require.Nil(err)
+		var traces []*SegmentTrace
+		require.Nil(json.Unmarshal(body, &traces))
+		return traces
+	}
+
+	traces := get("?manifest=foo")
+	require.Len(traces, 1)
+	assert.Equal(uint64(1), traces[0].SeqNo)
+	assert.Equal("orch", traces[0].Attempts[0].Orchestrator)
+	assert.Len(get(""), 2)
+	assert.Empty(get("?manifest=baz"))
+}
+
+func TestSegmentTrace_Spans(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	require.Nil(monitor.InitTracing(1, 100))
+	defer func() { monitor.TracingEnabled = false }()
+
+	buf, err := proto.Marshal(&net.TranscodeResult{
+		Result: &net.TranscodeResult_Data{
+			Data: &net.TranscodeData{Segments: []*net.TranscodedSegmentData{{Url: "foo"}}},
+		},
+	})
+	require.Nil(err)
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	var orchTraceID string
+	mux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+		_, span := monitor.StartSpanFromRequest(r, "serveSegment")
+		orchTraceID = span.SpanContext().TraceID.String()
+		span.End()
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf)
+	})
+
+	// Segments are traced without keeping their traces
+	SegmentTraces = nil
+	trace := newSegmentTrace("foo", 1, 2)
+	require.NotNil(trace)
+	traceID := trace.span.SpanContext().TraceID.String()
+
+	sess := StubBroadcastSession(ts.URL)
+	sess.Trace = trace.attempt(ts.URL)
+	_, err = SubmitSegment(sess, &stream.HLSSegment{SeqNo: 1, Data: []byte("dummy")}, 0)
+	require.Nil(err)
+	sess.Trace.fail(errors.New("download error"))
+	sess.Trace.end()
+	trace.finish()
+
+	// The orchestrator continues the trace of the broadcaster
+	assert.Equal(traceID, orchTraceID)
+
+	spans := make(map[string]monitor.SpanReport)
+	for _, s := range monitor.RecentSpans(traceID) {
+		spans[s.Name] = s
+	}
+	require.Len(spans, 5)
+	assert.Empty(spans["segment"].ParentSpanID)
+	assert.Equal(spans["segment"].SpanID, spans["attempt"].ParentSpanID)
+	assert.Equal(spans["attempt"].SpanID, spans["payment"].ParentSpanID)
+	assert.Equal(spans["attempt"].SpanID, spans["submit"].ParentSpanID)
+	assert.Equal(spans["submit"].SpanID, spans["serveSegment"].ParentSpanID)
+	assert.Equal("download error", spans["attempt"].Error)
+	assert.Empty(spans["submit"].Error)
+	assert.Equal(ts.URL, spans["attempt"].Attributes["orchestrator"])
+	assert.Empty(monitor.RecentSpans("other"))
+}
@@ -0,0 +1,347 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/golang/glog"
+
+	"github.com/livepeer/go-livepeer/core"
+)
+
+// BroadcastSelection selects the orchestrators that the segments of streams are sent to, if set.
+// Otherwise the session that most recently transcoded a segment is selected
+var BroadcastSelection SelectionAlgorithm
+
+// SelectionAlgorithm selects the session that the next segment of a stream is sent to. Nodes that
+// need their own policy can set BroadcastSelection to their own implementation
+type SelectionAlgorithm interface {
+	// Select returns the index of the session to use among the sessions of the stream that are not
+	// transcoding a segment. There is at least one session. New sessions are at the beginning of the
+	// list, and sessions are appended to it once they transcoded a segment
+	Select(sessions []*BroadcastSession) int
+}
+
+// latencyObserver is implemented by selection algorithms that select orchestrators by the latency
+// of the segments that they transcoded
+type latencyObserver interface {
+	ObserveLatency(transcoder string, latency time.Duration)
+}
+
+// Names of the selection algorithms of NewSelectionAlgorithm
+const (
+	SelectionRandom     = "random"
+	SelectionCheapest   = "cheapest"
+	SelectionLatency    = "latency"
+	SelectionStake      = "stake"
+	SelectionRoundRobin = "roundrobin"
+	SelectionWebhook    = "webhook"
+)
+
+// NewSelectionAlgorithm creates the selection algorithm with the name. The stake algorithm requires
+// the node to be on chain and the webhook algorithm requires webhookURL
+func NewSelectionAlgorithm(name string, node *core.LivepeerNode, webhookURL string) (SelectionAlgorithm, error) {
+	switch name {
+	case SelectionRandom:
+		return randomSelection{}, nil
+	case SelectionCheapest:
+		return cheapestSelection{}, nil
+	case SelectionLatency:
+		return newLatencySelection(), nil
+	case SelectionStake:
+		if node.Eth == nil {
+			return nil, fmt.Errorf("the %s selection requires an on-chain network", name)
+		}
+		return newStakeSelection(func(addr ethcommon.Address) (*big.Int, error) {
+			t, err := node.Eth.GetTranscoder(addr)
+			if err != nil {
+				return nil, err
+			}
+			return t.DelegatedStake, nil
+		}), nil
+	case SelectionRoundRobin:
+		return roundRobinSelection{}, nil
+	case SelectionWebhook:
+		u, err := url.ParseRequestURI(webhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("the %s selection requires an http(s) webhook URL", name)
+		}
+		return newWebhookSelection(u), nil
+	}
+	return nil, fmt.Errorf("unknown selection algorithm %v", name)
+}
+
+// selectionIntn returns the random indexes of the sessions that are selected. Replaced in tests
+var selectionIntn = rand.Intn
+
+// randomSelection selects any of the sessions with the same probability
+type randomSelection struct{}
+
+func (randomSelection) Select(sessions []*BroadcastSession) int {
+	return selectionIntn(len(sessions))
+}
+
+// roundRobinSelection selects the session that has been waiting for a segment for the longest time
+type roundRobinSelection struct{}
+
+func (roundRobinSelection) Select(sessions []*BroadcastSession) int {
+	return 0
+}
+
+// cheapestSelection selects the session of the orchestrator with the lowest price. The session that
+// most recently transcoded a segment is selected among the cheapest ones
+type cheapestSelection struct{}
+
+func (cheapestSelection) Select(sessions []*BroadcastSession) int {
+	best := len(sessions) - 1
+	bestPrice := sessionPrice(sessions[best])
+	for i := best - 1; i >= 0; i-- {
+		if price := sessionPrice(sessions[i]); price.Cmp(bestPrice) < 0 {
+			best, bestPrice = i, price
+		}
+	}
+	return best
+}
+
+// sessionPrice returns the price per pixel of the orchestrator of a session, 0 if it is not set
+func sessionPrice(sess *BroadcastSession) *big.Rat {
+	pi := sess.OrchestratorInfo.PriceInfo
+	if pi == nil || pi.PixelsPerUnit <= 0 {
+		return new(big.Rat)
+	}
+	return big.NewRat(pi.PricePerUnit, pi.PixelsPerUnit)
+}
+
+// latencyWeight is the weight of the latest segment in the average latency of an orchestrator
+const latencyWeight = 0.2
+
+// latencySelection selects the session of the orchestrator with the lowest average latency of the
+// segments it transcoded. Orchestrators that did not transcode any segment yet are selected first,
+// so that their latency is measured
+type latencySelection struct {
+	mu        sync.Mutex
+	latencies map[string]float64
+}
+
+func newLatencySelection() *latencySelection {
+	return &latencySelection{latencies: make(map[string]float64)}
+}
+
+func (s *latencySelection) Select(sessions []*BroadcastSession) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	best := len(sessions) - 1
+	bestLatency, measured := s.latencies[sessions[best].OrchestratorInfo.Transcoder]
+	for i := best - 1; i >= 0 && measured; i-- {
+		latency, ok := s.latencies[sessions[i].OrchestratorInfo.Transcoder]
+		if !ok || latency < bestLatency {
+			best, bestLatency, measured = i, latency, ok
+		}
+	}
+	return best
+}
+
+func (s *latencySelection) ObserveLatency(transcoder string, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	avg, ok := s.latencies[transcoder]
+	if !ok {
+		s.latencies[transcoder] = float64(latency)
+		return
+	}
+	s.latencies[transcoder] = latencyWeight*float64(latency) + (1-latencyWeight)*avg
+}
+
+// stakeTTL is how long the stake of an orchestrator is reused
+const stakeTTL = time.Hour
+
+type cachedStake struct {
+	stake   float64
+	updated time.Time
+}
+
+// stakeSelection selects the sessions with a probability weighted by the stake delegated to their
+// orchestrator. Stakes are requested in the background, so orchestrators whose stake is not known
+// yet are only selected if no other orchestrator has stake, in which case the session that most
+// recently transcoded a segment is selected
+type stakeSelection struct {
+	getStake func(addr ethcommon.Address) (*big.Int, error)
+
+	mu       sync.Mutex
+	stakes   map[ethcommon.Address]cachedStake
+	fetching map[ethcommon.Address]bool
+}
+
+func newStakeSelection(getStake func(addr ethcommon.Address) (*big.Int, error)) *stakeSelection {
+	return &stakeSelection{
+		getStake: getStake,
+		stakes:   make(map[ethcommon.Address]cachedStake),
+		fetching: make(map[ethcommon.Address]bool),
+	}
+}
+
+func (s *stakeSelection) Select(sessions []*BroadcastSession) int {
+	var total float64
+	stakes := make([]float64, len(sessions))
+	for i, sess := range sessions {
+		stakes[i] = s.stake(sess)
+		total += stakes[i]
+	}
+	if total <= 0 {
+		return len(sessions) - 1
+	}
+
+	r := selectionRand() * total
+	for i, stake := range stakes {
+		if r < stake {
+			return i
+		}
+		r -= stake
+	}
+	return len(sessions) - 1
+}
+
+// stake returns the stake of the orchestrator of a session, 0 if it is not known yet
+func (s *stakeSelection) stake(sess *BroadcastSession) float64 {
+	tp := sess.OrchestratorInfo.TicketParams
+	if tp == nil {
+		return 0
+	}
+	addr := ethcommon.BytesToAddress(tp.Recipient)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cached, ok := s.stakes[addr]
+	if (!ok || time.Since(cached.updated) >= stakeTTL) && !s.fetching[addr] {
+		s.fetching[addr] = true
+		go s.fetch(sess.OrchestratorInfo.Transcoder, addr)
+	}
+	return cached.stake
+}
+
+func (s *stakeSelection) fetch(transcoder string, addr ethcommon.Address) {
+	var stake float64
+	st, err := s.getStake(addr)
+	if err != nil || st == nil {
+		glog.Errorf("Unable to get stake of orchestrator orch=%s addr=%s: %v", transcoder, addr.Hex(), err)
+	} else {
+		stake, _ = new(big.Float).SetInt(st).Float64()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.fetching, addr)
+	s.stakes[addr] = cachedStake{stake: stake, updated: time.Now()}
+}
+
+// webhookSelectionTTL is how long the ranking of the orchestrators returned by the webhook is used
+var webhookSelectionTTL = time.Minute
+
+var webhookSelectionClient = &http.Client{Timeout: 3 * time.Second}
+
+// webhookSelection selects the sessions in the order of the orchestrators returned by a webhook. The
+// webhook is POSTed the transcoder URIs and prices of the orchestrators of the sessions, and responds
+// with the transcoder URIs of the orchestrators, best first. The ranking is requested in the background, so that segments don't wait for the webhook. Until
+// it responds, and for orchestrators that it did not rank, the session that most recently
+// transcoded a segment is selected
+type webhookSelection struct {
+	callback *url.URL
+
+	mu         sync.Mutex
+	ranks      map[string]int
+	updated    time.Time
+	refreshing bool
+}
+
+type webhookSelectionOrch struct {
+	Transcoder    string `json:"transcoder"`
+	PricePerPixel string `json:"pricePerPixel"`
+}
+
+func newWebhookSelection(callback *url.URL) *webhookSelection {
+	return &webhookSelection{callback: callback, ranks: make(map[string]int)}
+}
+
+func (s *webhookSelection) Select(sessions []*BroadcastSession) int {
+	s.mu.Lock()
+	if !s.refreshing && time.Since(s.updated) >= webhookSelectionTTL {
+		s.refreshing = true
+		orchs := make([]webhookSelectionOrch, len(sessions))
+		for i, sess := range sessions {
+			orchs[i] = webhookSelectionOrch{Transcoder: sess.OrchestratorInfo.Transcoder, PricePerPixel: sessionPrice(sess).RatString()}
+		}
+		go s.refresh(orchs)
+	}
+	ranks := s.ranks
+	s.mu.Unlock()
+
+	best := len(sessions) - 1
+	bestRank, ranked := ranks[sessions[best].OrchestratorInfo.Transcoder]
+	for i := best - 1; i >= 0; i-- {
+		rank, ok := ranks[sessions[i].OrchestratorInfo.Transcoder]
+		if ok && (!ranked || rank < bestRank) {
+			best, bestRank, ranked = i, rank, true
+		}
+	}
+	return best
+}
+
+// refresh requests the ranking of the orchestrators from the webhook. The previous ranking is kept
+// if the request fails
+func (s *webhookSelection) refresh(orchs []webhookSelectionOrch) {
+	ranks, err := s.requestRanks(orchs)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshing = false
+	s.updated = time.Now()
+	if err != nil {
+		glog.Errorf("Unable to get orchestrator selection from webhook url=%s: %v", s.callback, err)
+		return
+	}
+	s.ranks = ranks
+}
+
+func (s *webhookSelection) requestRanks(orchs []webhookSelectionOrch) (map[string]int, error) {
+	body, err := json.Marshal(struct {
+		Orchestrators []webhookSelectionOrch `json:"orchestrators"`
+	}{orchs})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := webhookSelectionClient.Post(s.callback.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("webhook error code=%d", resp.StatusCode)
+	}
+	var res struct {
+		Orchestrators []string `json:"orchestrators"`
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	ranks := make(map[string]int, len(res.Orchestrators))
+	for i, transcoder := range res.Orchestrators {
+		if _, ok := ranks[transcoder]; !ok {
+			ranks[transcoder] = i
+		}
+	}
+	return ranks, nil
+}
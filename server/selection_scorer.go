@@ -0,0 +1,141 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/golang/glog"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+// BroadcastScorer scores and filters the orchestrators that sessions of streams are created with, if
+// set. Nodes that need their own policy can set it to their own implementation
+var BroadcastScorer OrchestratorScorer
+
+// OrchestratorScorer scores the candidate orchestrators of a stream, after they were filtered by the
+// health checks, the orchestrator lists and the A/B test of the broadcaster
+type OrchestratorScorer interface {
+	// Score returns the scores of the candidates by transcoder URI. Candidates without a score are not
+	// used, and the orchestrators with the highest scores are used first
+	Score(stream ScoredStream, candidates []OrchestratorCandidate) (map[string]float64, error)
+}
+
+// ScoredStream is the stream that candidate orchestrators are scored for
+type ScoredStream struct {
+	ManifestID string   `json:"manifestID"`
+	ExternalID string   `json:"externalID,omitempty"`
+	Profiles   []string `json:"profiles"`
+}
+
+// OrchestratorCandidate is an orchestrator that a session of a stream can be created with
+type OrchestratorCandidate struct {
+	Transcoder    string `json:"transcoder"`
+	Address       string `json:"address,omitempty"`
+	PricePerPixel string `json:"pricePerPixel"`
+	Region        string `json:"region,omitempty"`
+	// Reputation score of the orchestrator, if the broadcaster keeps reputations
+	Reputation float64 `json:"reputation,omitempty"`
+}
+
+// scoreOrchestrators returns the candidates that were scored by scorer, with their scores. All the
+// candidates are returned without scores if scorer fails, so that streams are still transcoded
+func scoreOrchestrators(scorer OrchestratorScorer, n *core.LivepeerNode, params *streamParameters, tinfos []*net.OrchestratorInfo) ([]*net.OrchestratorInfo, map[string]float64) {
+	if len(tinfos) == 0 {
+		return tinfos, nil
+	}
+	stream := ScoredStream{ManifestID: string(params.mid), ExternalID: params.externalID, Profiles: make([]string, len(params.profiles))}
+	for i, p := range params.profiles {
+		stream.Profiles[i] = p.Name
+	}
+	candidates := make([]OrchestratorCandidate, len(tinfos))
+	for i, tinfo := range tinfos {
+		candidates[i] = OrchestratorCandidate{
+			Transcoder:    tinfo.Transcoder,
+			PricePerPixel: sessionPrice(&BroadcastSession{OrchestratorInfo: tinfo}).RatString(),
+			Region:        tinfo.Region,
+		}
+		if tinfo.TicketParams != nil {
+			candidates[i].Address = ethcommon.BytesToAddress(tinfo.TicketParams.Recipient).Hex()
+		}
+		if n.OrchReputation != nil {
+			candidates[i].Reputation = n.OrchReputation.Score(tinfo.Transcoder)
+		}
+	}
+
+	scores, err := scorer.Score(stream, candidates)
+	if err != nil {
+		glog.Errorf("Unable to score orchestrators manifestID=%s: %v", params.mid, err)
+		return tinfos, nil
+	}
+	scored := make([]*net.OrchestratorInfo, 0, len(tinfos))
+	for _, tinfo := range tinfos {
+		if _, ok := scores[tinfo.Transcoder]; !ok {
+			glog.V(common.DEBUG).Infof("Skipping orchestrator filtered by the scorer manifestID=%s orch=%s", params.mid, tinfo.Transcoder)
+			continue
+		}
+		scored = append(scored, tinfo)
+	}
+	return scored, scores
+}
+
+var webhookScorerClient = &http.Client{Timeout: 2 * time.Second}
+
+// webhookScorer scores the orchestrators with a webhook. The webhook is POSTed the stream and its
+// candidates, and responds with the scores of the candidates to use
+type webhookScorer struct {
+	callback *url.URL
+}
+
+// NewWebhookScorer creates a scorer that scores the orchestrators with the webhook at callback
+func NewWebhookScorer(callback string) (OrchestratorScorer, error) {
+	u, err := url.ParseRequestURI(callback)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid orchestrator scorer webhook URL %q", callback)
+	}
+	return &webhookScorer{callback: u}, nil
+}
+
+func (s *webhookScorer) Score(stream ScoredStream, candidates []OrchestratorCandidate) (map[string]float64, error) {
+	body, err := json.Marshal(struct {
+		Stream        ScoredStream            `json:"stream"`
+		Orchestrators []OrchestratorCandidate `json:"orchestrators"`
+	}{stream, candidates})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := webhookScorerClient.Post(s.callback.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("webhook error code=%d", resp.StatusCode)
+	}
+	var res struct {
+		Orchestrators []struct {
+			Transcoder string  `json:"transcoder"`
+			Score      float64 `json:"score"`
+		} `json:"orchestrators"`
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	scores := make(map[string]float64, len(res.Orchestrators))
+	for _, o := range res.Orchestrators {
+		scores[o.Transcoder] = o.Score
+	}
+	return scores, nil
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubScorer struct {
+	stream     ScoredStream
+	candidates []OrchestratorCandidate
+	scores     map[string]float64
+	err        error
+}
+
+func (s *stubScorer) Score(stream ScoredStream, candidates []OrchestratorCandidate) (map[string]float64, error) {
+	s.stream, s.candidates = stream, candidates
+	return s.scores, s.err
+}
+
+func TestSelectOrchestrator_Scorer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	scorer := &stubScorer{scores: map[string]float64{"https://o1:8935": 2, "https://o3:8935": 5}}
+	oldScorer := BroadcastScorer
+	defer func() { BroadcastScorer = oldScorer }()
+	BroadcastScorer = scorer
+
+	n, _ := core.NewLivepeerNode(nil, "", nil)
+	sd := &stubDiscovery{}
+	sd.infos = []*net.OrchestratorInfo{
+		{Transcoder: "https://o1:8935", PriceInfo: &net.PriceInfo{PricePerUnit: 1, PixelsPerUnit: 3}, Region: "eu"},
+		{Transcoder: "https://o2:8935", TicketParams: &net.TicketParams{Recipient: ethcommon.HexToAddress("0x01").Bytes()}},
+		{Transcoder: "https://o3:8935"},
+	}
+	n.OrchestratorPool = sd
+	mid := core.RandomManifestID()
+	pl := core.NewBasicPlaylistManager(mid, drivers.NewMemoryDriver(nil).NewSession(string(mid)))
+	params := &streamParameters{mid: mid, externalID: "foo", profiles: []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}}
+	transcoders := func() []string {
+		sessions, err := selectOrchestrator(n, params, pl, 3)
+		require.Nil(err)
+		var transcoders []string
+		for _, sess := range sessions {
+			transcoders = append(transcoders, sess.OrchestratorInfo.Transcoder)
+		}
+		return transcoders
+	}
+
+	// Orchestrators without a score are filtered, and the highest scores are at the end of the
+	// list, which sessions are selected from
+	assert.Equal([]string{"https://o1:8935", "https://o3:8935"}, transcoders())
+	assert.Equal(ScoredStream{ManifestID: string(mid), ExternalID: "foo", Profiles: []string{"P144p30fps16x9"}}, scorer.stream)
+	assert.Equal([]OrchestratorCandidate{
+		{Transcoder: "https://o1:8935", PricePerPixel: "1/3", Region: "eu"},
+		{Transcoder: "https://o2:8935", PricePerPixel: "0", Address: "0x0000000000000000000000000000000000000001"},
+		{Transcoder: "https://o3:8935", PricePerPixel: "0"},
+	}, scorer.candidates)
+
+	// Every orchestrator can be filtered
+	scorer.scores = map[string]float64{}
+	assert.Empty(transcoders())
+
+	// All the orchestrators are used if the scorer fails
+	scorer.err = errors.New("scorer error")
+	assert.Len(transcoders(), 3)
+}
+
+func TestNewWebhookScorer(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, u := range []string{"", "foo", "ftp://example.com"} {
+		_, err := NewWebhookScorer(u)
+		assert.Contains(err.Error(), "invalid orchestrator scorer webhook URL", u)
+	}
+	scorer, err := NewWebhookScorer("https://example.com/score")
+	assert.Nil(err)
+	assert.NotNil(scorer)
+}
+
+func TestWebhookScorer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var req struct {
+		Stream        ScoredStream            `json:"stream"`
+		Orchestrators []OrchestratorCandidate `json:"orchestrators"`
+	}
+	status := http.StatusOK
+	resp := `{"orchestrators":[{"transcoder":"o2","score":1.5},{"transcoder":"o1","score":0}]}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.Nil(err)
+		require.Nil(json.Unmarshal(body, &req))
+		w.WriteHeader(status)
+		w.Write([]byte(resp))
+	}))
+	defer ts.Close()
+
+	scorer, err := NewWebhookScorer(ts.URL)
+	require.Nil(err)
+	stream := ScoredStream{ManifestID: "foo", Profiles: []string{"P144p30fps16x9"}}
+	candidates := []OrchestratorCandidate{{Transcoder: "o1", PricePerPixel: "1/3"}, {Transcoder: "o2", PricePerPixel: "0", Reputation: 0.5}}
+	scores, err := scorer.Score(stream, candidates)
+	require.Nil(err)
+	assert.Equal(map[string]float64{"o1": 0, "o2": 1.5}, scores)
+	assert.Equal(stream, req.Stream)
+	assert.Equal(candidates, req.Orchestrators)
+
+	resp = "not json"
+	_, err = scorer.Score(stream, candidates)
+	assert.NotNil(err)
+
+	status = http.StatusInternalServerError
+	_, err = scorer.Score(stream, candidates)
+	assert.EqualError(err, "webhook error code=500")
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/eth"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+func selectionSessions(transcoders ...string) []*BroadcastSession {
+	sessions := make([]*BroadcastSession, len(transcoders))
+	for i, transcoder := range transcoders {
+		sessions[i] = StubBroadcastSession(transcoder)
+	}
+	return sessions
+}
+
+func TestNewSelectionAlgorithm(t *testing.T) {
+	assert := assert.New(t)
+	node, _ := core.NewLivepeerNode(nil, "", nil)
+
+	for _, name := range []string{SelectionRandom, SelectionCheapest, SelectionLatency, SelectionRoundRobin} {
+		sel, err := NewSelectionAlgorithm(name, node, "")
+		assert.Nil(err)
+		assert.NotNil(sel)
+	}
+
+	_, err := NewSelectionAlgorithm("foo", node, "")
+	assert.EqualError(err, "unknown selection algorithm foo")
+	_, err = NewSelectionAlgorithm(SelectionStake, node, "")
+	assert.NotNil(err)
+	_, err = NewSelectionAlgorithm(SelectionWebhook, node, "")
+	assert.NotNil(err)
+	_, err = NewSelectionAlgorithm(SelectionWebhook, node, "ftp://foo")
+	assert.NotNil(err)
+
+	sel, err := NewSelectionAlgorithm(SelectionWebhook, node, "http://localhost:8888/select")
+	assert.Nil(err)
+	assert.IsType(&webhookSelection{}, sel)
+
+	node.Eth = &eth.StubClient{}
+	sel, err = NewSelectionAlgorithm(SelectionStake, node, "")
+	assert.Nil(err)
+	assert.IsType(&stakeSelection{}, sel)
+}
+
+func TestSelectSession_SelectionAlgorithm(t *testing.T) {
+	assert := assert.New(t)
+
+	sessions := selectionSessions("o1", "o2", "o3")
+	bsm := bsmWithSessList(sessions)
+	bsm.selection = roundRobinSelection{}
+
+	// The selected session is taken out of the list until it completes
+	sess := bsm.selectSession()
+	assert.Equal("o1", sess.OrchestratorInfo.Transcoder)
+	assert.Len(bsm.sessList, 2)
+	bsm.completeSession(sess)
+	assert.Equal("o2", bsm.selectSession().OrchestratorInfo.Transcoder)
+	assert.Equal("o3", bsm.selectSession().OrchestratorInfo.Transcoder)
+	assert.Equal("o1", bsm.selectSession().OrchestratorInfo.Transcoder)
+	assert.Empty(bsm.sessList)
+}
+
+func TestRandomSelection(t *testing.T) {
+	oldIntn := selectionIntn
+	defer func() { selectionIntn = oldIntn }()
+	selectionIntn = func(n int) int { return n - 2 }
+
+	assert.Equal(t, 1, randomSelection{}.Select(selectionSessions("o1", "o2", "o3")))
+}
+
+func TestCheapestSelection(t *testing.T) {
+	assert := assert.New(t)
+
+	sessions := selectionSessions("o1", "o2", "o3", "o4")
+	sessions[0].OrchestratorInfo.PriceInfo = &net.PriceInfo{PricePerUnit: 1, PixelsPerUnit: 2}
+	sessions[1].OrchestratorInfo.PriceInfo = &net.PriceInfo{PricePerUnit: 1, PixelsPerUnit: 3}
+	sessions[2].OrchestratorInfo.PriceInfo = &net.PriceInfo{PricePerUnit: 2, PixelsPerUnit: 6}
+	sessions[3].OrchestratorInfo.PriceInfo = &net.PriceInfo{PricePerUnit: 1, PixelsPerUnit: 1}
+
+	// The most recently used of the cheapest sessions is selected
+	assert.Equal(2, cheapestSelection{}.Select(sessions))
+
+	// Orchestrators without a price are free
+	sessions[0].OrchestratorInfo.PriceInfo = nil
+	assert.Equal(0, cheapestSelection{}.Select(sessions))
+}
+
+func TestLatencySelection(t *testing.T) {
+	assert := assert.New(t)
+
+	sel := newLatencySelection()
+	sessions := selectionSessions("o1", "o2", "o3")
+
+	// Orchestrators without latencies are selected first, most recently used first
+	assert.Equal(2, sel.Select(sessions))
+	sel.ObserveLatency("o3", time.Second)
+	assert.Equal(1, sel.Select(sessions))
+	sel.ObserveLatency("o2", 2*time.Second)
+	sel.ObserveLatency("o1", 500*time.Millisecond)
+	assert.Equal(0, sel.Select(sessions))
+
+	// Latencies are averaged
+	sel.ObserveLatency("o1", 5*time.Second)
+	assert.Equal(float64(1400*time.Millisecond), sel.latencies["o1"])
+	assert.Equal(2, sel.Select(sessions))
+
+	// Latencies of segments are observed through the session manager
+	bsm := bsmWithSessList(sessions)
+	bsm.selection = sel
+	bsm.observeLatency(sessions[1], 0)
+	assert.Equal(float64(1600*time.Millisecond), sel.latencies["o2"])
+}
+
+func TestStakeSelection(t *testing.T) {
+	assert := assert.New(t)
+	oldRand := selectionRand
+	defer func() { selectionRand = oldRand }()
+
+	addrs := []ethcommon.Address{{1}, {2}, {3}}
+	stakes := map[ethcommon.Address]*big.Int{addrs[0]: big.NewInt(100), addrs[1]: big.NewInt(300)}
+	var mu sync.Mutex
+	var requests int
+	sel := newStakeSelection(func(addr ethcommon.Address) (*big.Int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		stake, ok := stakes[addr]
+		if !ok {
+			return nil, errors.New("unknown transcoder")
+		}
+		return stake, nil
+	})
+
+	sessions := selectionSessions("o1", "o2", "o3", "o4")
+	for i, addr := range addrs {
+		sessions[i].OrchestratorInfo.TicketParams = &net.TicketParams{Recipient: addr.Bytes()}
+	}
+
+	// The most recently used session is selected until stakes are known
+	assert.Equal(3, sel.Select(sessions))
+	assert.Eventually(func() bool {
+		sel.mu.Lock()
+		defer sel.mu.Unlock()
+		return len(sel.stakes) == 3
+	}, time.Second, 5*time.Millisecond)
+
+	// Sessions are weighted by their stake
+	selectionRand = func() float64 { return 0.2 }
+	assert.Equal(0, sel.Select(sessions))
+	selectionRand = func() float64 { return 0.3 }
+	assert.Equal(1, sel.Select(sessions))
+	selectionRand = func() float64 { return 0.99 }
+	assert.Equal(1, sel.Select(sessions))
+
+	// Stakes are cached
+	mu.Lock()
+	assert.Equal(3, requests)
+	mu.Unlock()
+}
+
+func TestWebhookSelection(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	oldTTL := webhookSelectionTTL
+	defer func() { webhookSelectionTTL = oldTTL }()
+
+	var mu sync.Mutex
+	var requested []webhookSelectionOrch
+	ranking := []string{"o2", "o1"}
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.Nil(err)
+		var req struct {
+			Orchestrators []webhookSelectionOrch `json:"orchestrators"`
+		}
+		require.Nil(json.Unmarshal(body, &req))
+
+		mu.Lock()
+		defer mu.Unlock()
+		requested = req.Orchestrators
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string][]string{"orchestrators": ranking})
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	sel := newWebhookSelection(u)
+
+	sessions := selectionSessions("o1", "o2", "o3")
+	sessions[0].OrchestratorInfo.PriceInfo = &net.PriceInfo{PricePerUnit: 1, PixelsPerUnit: 1000}
+
+	// The most recently used session is selected until the webhook responds
+	assert.Equal(2, sel.Select(sessions))
+	waitRefresh := func() {
+		assert.Eventually(func() bool {
+			sel.mu.Lock()
+			defer sel.mu.Unlock()
+			return !sel.refreshing
+		}, time.Second, 5*time.Millisecond)
+	}
+	waitRefresh()
+	mu.Lock()
+	assert.Equal([]webhookSelectionOrch{{"o1", "1/1000"}, {"o2", "0"}, {"o3", "0"}}, requested)
+	mu.Unlock()
+
+	// Sessions are selected in the order of the ranking
+	assert.Equal(1, sel.Select(sessions))
+	assert.Equal(0, sel.Select(sessions[:1]))
+	assert.Equal(1, sel.Select([]*BroadcastSession{sessions[2], sessions[0]}))
+
+	// The ranking is kept if the webhook fails
+	webhookSelectionTTL = 0
+	mu.Lock()
+	status = http.StatusInternalServerError
+	mu.Unlock()
+	sel.Select(sessions)
+	waitRefresh()
+	assert.Equal(1, sel.Select(sessions))
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/monitor"
+)
+
+// registerSessionHooks subscribes the recording, the stream events and the metrics of the streams
+// of the broadcaster to the lifecycle of their sessions
+func (s *LivepeerServer) registerSessionHooks() {
+	s.LivepeerNode.Sessions.OnStart(s.sessionStarted)
+	s.LivepeerNode.Sessions.OnStop(s.sessionStopped)
+	s.LivepeerNode.Sessions.OnIdle(s.sessionIdle)
+}
+
+// sessionConnection returns the connection of the stream of a session, or nil if the session is
+// not a stream of the broadcaster, e.g. a stream that an orchestrator transcodes
+func (s *LivepeerServer) sessionConnection(sess core.StreamSession) *rtmpConnection {
+	s.connectionLock.RLock()
+	defer s.connectionLock.RUnlock()
+	return s.rtmpConnections[sess.ManifestID]
+}
+
+func (s *LivepeerServer) sessionStarted(sess core.StreamSession) {
+	cxn := s.sessionConnection(sess)
+	if cxn == nil {
+		return
+	}
+	// The recording and the stream event webhook consume the stream until it ends
+	consumers := 0
+	if cxn.recording != nil {
+		consumers++
+	}
+	if StreamEvents != nil {
+		consumers++
+	}
+	s.connectionLock.Lock()
+	cxn.consumers = consumers
+	s.connectionLock.Unlock()
+	for i := 0; i < consumers; i++ {
+		s.LivepeerNode.Sessions.AddConsumer(sess.ManifestID)
+	}
+	if monitor.Enabled {
+		monitor.CurrentSessions(s.streamCount())
+	}
+	notifyStreamEvent(cxn, &StreamEvent{Event: StreamEventStarted})
+}
+
+func (s *LivepeerServer) sessionStopped(sess core.StreamSession) {
+	cxn := s.sessionConnection(sess)
+	if cxn == nil {
+		return
+	}
+	notifyStreamEvent(cxn, &StreamEvent{Event: StreamEventEnded})
+	if monitor.Enabled {
+		monitor.StreamEnded(cxn.nonce)
+		// The connection is only unregistered once the stop hooks ran
+		monitor.CurrentSessions(s.streamCount() - 1)
+	}
+}
+
+func (s *LivepeerServer) sessionIdle(sess core.StreamSession) {
+	cxn := s.sessionConnection(sess)
+	if cxn == nil {
+		return
+	}
+	notifyStreamEvent(cxn, &StreamEvent{Event: StreamEventIdle})
+}
+
+// removeStreamConsumers releases the consumers that were added when the stream started
+func (s *LivepeerServer) removeStreamConsumers(cxn *rtmpConnection) {
+	s.connectionLock.RLock()
+	consumers := cxn.consumers
+	s.connectionLock.RUnlock()
+	for i := 0; i < consumers; i++ {
+		s.LivepeerNode.Sessions.RemoveConsumer(cxn.mid)
+	}
+}
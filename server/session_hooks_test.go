@@ -0,0 +1,74 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionHooks(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	defer func() { StreamEvents = nil }()
+
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	n, _ := core.NewLivepeerNode(nil, "./tmp", nil)
+	n.Sessions = core.NewSessionRegistry(20 * time.Millisecond)
+	s := NewLivepeerServer("127.0.0.1:1938", n)
+
+	events := make(chan *StreamEvent, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev StreamEvent
+		assert.Nil(json.NewDecoder(r.Body).Decode(&ev))
+		events <- &ev
+	}))
+	defer ts.Close()
+	StreamEvents = NewStreamEventDispatcher(ts.URL, "")
+	go StreamEvents.StartDispatching()
+	defer StreamEvents.StopDispatching()
+	next := func() *StreamEvent {
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(time.Second):
+			require.Fail("missing event")
+		}
+		return nil
+	}
+
+	var stopped core.StreamSession
+	n.Sessions.OnStop(func(sess core.StreamSession) { stopped = sess })
+
+	// The stream event webhook consumes the stream once it started
+	_, err := s.registerConnection(stream.NewBasicRTMPVideoStream(&streamParameters{mid: "hooks", externalID: "ext"}))
+	require.Nil(err)
+	sess, ok := n.Sessions.Get("hooks")
+	require.True(ok)
+	assert.Equal(1, sess.Consumers)
+	ev := next()
+	assert.Equal(StreamEventStarted, ev.Event)
+	assert.Equal("hooks", ev.ManifestID)
+	assert.Equal("ext", ev.ExternalID)
+
+	// Streams without segments become idle
+	go n.Sessions.StartIdleCheck()
+	ev = next()
+	n.Sessions.StopIdleCheck()
+	assert.Equal(StreamEventIdle, ev.Event)
+	assert.Equal("ext", ev.ExternalID)
+
+	// The consumers are released before the session stops
+	require.Nil(removeRTMPStream(s, "hooks"))
+	assert.Equal(StreamEventEnded, next().Event)
+	assert.Equal(core.ManifestID("hooks"), stopped.ManifestID)
+	assert.Equal(0, stopped.Consumers)
+	assert.Equal(errUnknownStream, removeRTMPStream(s, "hooks"))
+}
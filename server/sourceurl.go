@@ -0,0 +1,75 @@
+package server
+
+import (
+	"errors"
+	gonet "net"
+	"net/url"
+	"strings"
+)
+
+var errSourceScheme = errors.New("unsupported source URL scheme")
+var errSourceHost = errors.New("source URLs can't point to private, loopback or link-local hosts")
+
+// lookupSourceHost resolves the host of a source URL. Replaced in tests
+var lookupSourceHost = gonet.LookupIP
+
+// Networks that sources are not read from, besides the loopback, link-local and unspecified
+// addresses, so that callers can't make the node read from its own network, e.g. the metadata
+// service of a cloud provider at 169.254.169.254
+var privateNetworks = func() []*gonet.IPNet {
+	var networks []*gonet.IPNet
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7"} {
+		_, network, _ := gonet.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// validateSourceURL checks that a URL that the node reads a source from on behalf of a caller has
+// one of schemes, and that its host is not a private, loopback or link-local address. Local files
+// are never allowed. Hosts that can't be resolved are allowed since the node can't read from them
+// either
+func validateSourceURL(rawURL string, schemes ...string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errSourceScheme
+	}
+	supported := false
+	for _, scheme := range schemes {
+		if strings.EqualFold(u.Scheme, scheme) {
+			supported = true
+		}
+	}
+	if !supported || u.Hostname() == "" {
+		return errSourceScheme
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errSourceHost
+	}
+	ips := []gonet.IP{gonet.ParseIP(host)}
+	if ips[0] == nil {
+		if ips, err = lookupSourceHost(host); err != nil {
+			return nil
+		}
+	}
+	for _, ip := range ips {
+		if privateIP(ip) {
+			return errSourceHost
+		}
+	}
+	return nil
+}
+
+func privateIP(ip gonet.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
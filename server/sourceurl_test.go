@@ -0,0 +1,59 @@
+package server
+
+import (
+	"errors"
+	gonet "net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSourceURL(t *testing.T) {
+	assert := assert.New(t)
+
+	oldLookup := lookupSourceHost
+	defer func() { lookupSourceHost = oldLookup }()
+	lookupSourceHost = func(host string) ([]gonet.IP, error) {
+		switch host {
+		case "public.example.com":
+			return []gonet.IP{gonet.ParseIP("93.184.216.34")}, nil
+		case "internal.example.com":
+			return []gonet.IP{gonet.ParseIP("93.184.216.34"), gonet.ParseIP("10.1.2.3")}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	for _, u := range []string{
+		"https://public.example.com/movie.mp4",
+		"http://93.184.216.34:8080/movie.mp4",
+		"https://[2606:2800:220:1::1]/movie.mp4",
+		"https://unresolved.example.com/movie.mp4",
+	} {
+		assert.Nil(validateSourceURL(u, "http", "https"), u)
+	}
+	assert.Nil(validateSourceURL("rtmp://public.example.com/live/movie", "rtmp", "http"))
+
+	for _, u := range []string{"file:///etc/passwd", "ftp://public.example.com/movie.mp4", "https:///movie.mp4", "://"} {
+		assert.Equal(errSourceScheme, validateSourceURL(u, "http", "https"), u)
+	}
+	assert.Equal(errSourceScheme, validateSourceURL("rtmp://public.example.com/live/movie", "http", "https"))
+
+	for _, u := range []string{
+		"http://169.254.169.254/latest/meta-data/",
+		"http://127.0.0.1:7935/status",
+		"http://localhost:7935/status",
+		"http://api.localhost/status",
+		"http://0.0.0.0/",
+		"http://10.0.0.1/movie.mp4",
+		"http://172.16.5.4/movie.mp4",
+		"http://192.168.1.1/movie.mp4",
+		"http://100.64.0.1/movie.mp4",
+		"http://[::1]/movie.mp4",
+		"http://[fe80::1]/movie.mp4",
+		"http://[fd00::1]/movie.mp4",
+		"http://[::ffff:127.0.0.1]/movie.mp4",
+		"https://internal.example.com/movie.mp4",
+	} {
+		assert.Equal(errSourceHost, validateSourceURL(u, "http", "https"), u)
+	}
+}
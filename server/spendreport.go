@@ -0,0 +1,209 @@
+package server
+
+import (
+	"math/big"
+	"sort"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+)
+
+// BroadcastSpendReporter persists the payments of the broadcaster and reports its spend, if set
+var BroadcastSpendReporter *SpendReporter
+
+// defaultSpendReportWindow is the time window of spend reports that don't set one
+const defaultSpendReportWindow = 24 * time.Hour
+
+// spendStore persists the payments that spend reports are computed from
+type spendStore interface {
+	InsertBroadcastPayment(payment *common.DBBroadcastPayment) error
+	BroadcastPayments(since, until int64) ([]*common.DBBroadcastPayment, error)
+	InsertTicketRedemption(redemption *common.DBTicketRedemption) error
+	TicketRedemptions(since, until int64) ([]*common.DBTicketRedemption, error)
+	DeleteTicketRedemption(recipient ethcommon.Address, amount *big.Int) error
+}
+
+// SpendReporter records the tickets that the broadcaster sends and the winning tickets that
+// orchestrators redeem, and reports the spend of each stream and each orchestrator over a time window
+type SpendReporter struct {
+	store spendStore
+}
+
+// NewSpendReporter creates a SpendReporter that persists payments to store
+func NewSpendReporter(store spendStore) *SpendReporter {
+	return &SpendReporter{store: store}
+}
+
+// PaymentSent records a batch of tickets with a total EV of ev that was sent to the recipient
+// for a segment of a stream, at the price per pixel of the recipient
+func (r *SpendReporter) PaymentSent(mid core.ManifestID, recipient ethcommon.Address, tickets int, ev, pricePerPixel *big.Rat) {
+	err := r.store.InsertBroadcastPayment(&common.DBBroadcastPayment{
+		ManifestID:    string(mid),
+		Recipient:     recipient,
+		Tickets:       int64(tickets),
+		EV:            ev,
+		PricePerPixel: pricePerPixel,
+		Time:          time.Now().Unix(),
+	})
+	if err != nil {
+		glog.Errorf("Error recording payment manifestID=%s err=%v", mid, err)
+	}
+}
+
+// TicketRedeemed records a winning ticket with a face value of amount that the recipient redeemed
+func (r *SpendReporter) TicketRedeemed(recipient ethcommon.Address, amount *big.Int) {
+	err := r.store.InsertTicketRedemption(&common.DBTicketRedemption{
+		Recipient: recipient,
+		Amount:    amount,
+		Time:      time.Now().Unix(),
+	})
+	if err != nil {
+		glog.Errorf("Error recording ticket redemption err=%v", err)
+	}
+}
+
+// TicketRedemptionReverted removes a winning ticket with a face value of amount that the recipient
+// redeemed, when its redemption is removed from the chain by a re-org
+func (r *SpendReporter) TicketRedemptionReverted(recipient ethcommon.Address, amount *big.Int) {
+	if err := r.store.DeleteTicketRedemption(recipient, amount); err != nil {
+		glog.Errorf("Error reverting ticket redemption err=%v", err)
+	}
+}
+
+// SpendReport is the spend of the broadcaster from Since to Until included, in unix time
+type SpendReport struct {
+	Since         int64                `json:"since"`
+	Until         int64                `json:"until"`
+	Total         *Spend               `json:"total"`
+	Streams       []*StreamSpend       `json:"streams"`
+	Orchestrators []*OrchestratorSpend `json:"orchestrators"`
+}
+
+// Spend is what the broadcaster paid for some segments. Amounts are in wei
+type Spend struct {
+	TicketsSent int64 `json:"ticketsSent"`
+	// Expected value of the tickets that were sent
+	EV string `json:"ev"`
+	// Pixels that the EV pays for at the prices of the orchestrators
+	PixelsPaid int64 `json:"pixelsPaid"`
+	// Average price paid per pixel
+	PricePerPixel string `json:"pricePerPixel"`
+	// Winning tickets that orchestrators redeemed and their total face value. Winning tickets
+	// can't be attributed to streams, so they are only reported for orchestrators
+	WinningTickets int64  `json:"winningTickets"`
+	Redeemed       string `json:"redeemed"`
+
+	ev         *big.Rat
+	pixelsPaid *big.Rat
+	redeemed   *big.Int
+}
+
+// StreamSpend is what the broadcaster paid for the segments of a stream
+type StreamSpend struct {
+	ManifestID string `json:"manifestID"`
+	*Spend
+}
+
+// OrchestratorSpend is what the broadcaster paid an orchestrator
+type OrchestratorSpend struct {
+	Address string `json:"address"`
+	*Spend
+}
+
+func newSpend() *Spend {
+	return &Spend{ev: new(big.Rat), pixelsPaid: new(big.Rat), redeemed: new(big.Int)}
+}
+
+func (s *Spend) addPayment(p *common.DBBroadcastPayment) {
+	s.TicketsSent += p.Tickets
+	s.ev.Add(s.ev, p.EV)
+	if p.PricePerPixel.Sign() > 0 {
+		s.pixelsPaid.Add(s.pixelsPaid, new(big.Rat).Quo(p.EV, p.PricePerPixel))
+	}
+}
+
+func (s *Spend) addRedemption(r *common.DBTicketRedemption) {
+	s.WinningTickets++
+	s.redeemed.Add(s.redeemed, r.Amount)
+}
+
+// finish sets the fields of the spend that are reported from its totals
+func (s *Spend) finish() {
+	s.EV = s.ev.FloatString(3)
+	pixels := new(big.Int).Quo(s.pixelsPaid.Num(), s.pixelsPaid.Denom())
+	s.PixelsPaid = pixels.Int64()
+	price := new(big.Rat)
+	if s.pixelsPaid.Sign() > 0 {
+		price.Quo(s.ev, s.pixelsPaid)
+	}
+	s.PricePerPixel = price.FloatString(6)
+	s.Redeemed = s.redeemed.String()
+}
+
+// Report returns the spend of the broadcaster from since to until included. Streams and orchestrators are
+// sorted by decreasing EV
+func (r *SpendReporter) Report(since, until time.Time) (*SpendReport, error) {
+	payments, err := r.store.BroadcastPayments(since.Unix(), until.Unix())
+	if err != nil {
+		return nil, err
+	}
+	redemptions, err := r.store.TicketRedemptions(since.Unix(), until.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	total := newSpend()
+	streams := make(map[string]*Spend)
+	orchs := make(map[ethcommon.Address]*Spend)
+	orch := func(addr ethcommon.Address) *Spend {
+		if _, ok := orchs[addr]; !ok {
+			orchs[addr] = newSpend()
+		}
+		return orchs[addr]
+	}
+	for _, p := range payments {
+		if _, ok := streams[p.ManifestID]; !ok {
+			streams[p.ManifestID] = newSpend()
+		}
+		streams[p.ManifestID].addPayment(p)
+		orch(p.Recipient).addPayment(p)
+		total.addPayment(p)
+	}
+	for _, redemption := range redemptions {
+		orch(redemption.Recipient).addRedemption(redemption)
+		total.addRedemption(redemption)
+	}
+
+	report := &SpendReport{
+		Since:         since.Unix(),
+		Until:         until.Unix(),
+		Total:         total,
+		Streams:       []*StreamSpend{},
+		Orchestrators: []*OrchestratorSpend{},
+	}
+	total.finish()
+	for mid, spend := range streams {
+		spend.finish()
+		report.Streams = append(report.Streams, &StreamSpend{ManifestID: mid, Spend: spend})
+	}
+	for addr, spend := range orchs {
+		spend.finish()
+		report.Orchestrators = append(report.Orchestrators, &OrchestratorSpend{Address: addr.Hex(), Spend: spend})
+	}
+	sort.Slice(report.Streams, func(i, j int) bool {
+		if c := report.Streams[i].ev.Cmp(report.Streams[j].ev); c != 0 {
+			return c > 0
+		}
+		return report.Streams[i].ManifestID < report.Streams[j].ManifestID
+	})
+	sort.Slice(report.Orchestrators, func(i, j int) bool {
+		if c := report.Orchestrators[i].ev.Cmp(report.Orchestrators[j].ev); c != 0 {
+			return c > 0
+		}
+		return report.Orchestrators[i].Address < report.Orchestrators[j].Address
+	})
+	return report, nil
+}
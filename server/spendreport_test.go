@@ -0,0 +1,196 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/go-livepeer/pm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tempSpendReporter(t *testing.T) (*SpendReporter, *common.DB, func()) {
+	dir, err := ioutil.TempDir("", "livepeer-spend-report-test")
+	require.Nil(t, err)
+	dbh, err := common.InitDB(filepath.Join(dir, "lp.sqlite3"))
+	require.Nil(t, err)
+	return NewSpendReporter(dbh), dbh, func() {
+		dbh.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSpendReporter_Report(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	r, dbh, cleanup := tempSpendReporter(t)
+	defer cleanup()
+	foo := ethcommon.HexToAddress("0x0000000000000000000000000000000000000001")
+	bar := ethcommon.HexToAddress("0x0000000000000000000000000000000000000002")
+
+	report, err := r.Report(time.Unix(0, 0), time.Now())
+	require.Nil(err)
+	assert.Empty(report.Streams)
+	assert.Empty(report.Orchestrators)
+	assert.Equal("0.000", report.Total.EV)
+
+	r.PaymentSent("a", foo, 2, big.NewRat(20, 1), big.NewRat(1, 10))
+	r.PaymentSent("a", bar, 1, big.NewRat(30, 1), big.NewRat(1, 5))
+	r.PaymentSent("b", foo, 1, big.NewRat(5, 1), big.NewRat(1, 10))
+	// Tickets of free orchestrators don't pay for pixels
+	r.PaymentSent("c", bar, 1, big.NewRat(0, 1), big.NewRat(0, 1))
+	r.TicketRedeemed(foo, big.NewInt(100))
+	r.TicketRedeemed(foo, big.NewInt(50))
+	// Redemptions that are reverted by a re-org are not reported
+	r.TicketRedeemed(bar, big.NewInt(70))
+	r.TicketRedemptionReverted(bar, big.NewInt(70))
+	// Payments before the window are not reported
+	require.Nil(dbh.InsertBroadcastPayment(&common.DBBroadcastPayment{ManifestID: "b", Recipient: foo, Tickets: 1, EV: big.NewRat(1, 1), PricePerPixel: big.NewRat(1, 1), Time: 100}))
+
+	report, err = r.Report(time.Now().Add(-time.Hour), time.Now().Add(time.Second))
+	require.Nil(err)
+	assert.Equal(&Spend{
+		TicketsSent:    5,
+		EV:             "55.000",
+		PixelsPaid:     400,
+		PricePerPixel:  "0.137500",
+		WinningTickets: 2,
+		Redeemed:       "150",
+		ev:             big.NewRat(55, 1),
+		pixelsPaid:     big.NewRat(400, 1),
+		redeemed:       big.NewInt(150),
+	}, report.Total)
+
+	// Streams and orchestrators are sorted by decreasing EV
+	require.Len(report.Streams, 3)
+	assert.Equal("a", report.Streams[0].ManifestID)
+	assert.Equal(int64(3), report.Streams[0].TicketsSent)
+	assert.Equal("50.000", report.Streams[0].EV)
+	assert.Equal(int64(350), report.Streams[0].PixelsPaid)
+	assert.Equal("0.142857", report.Streams[0].PricePerPixel)
+	assert.Zero(report.Streams[0].WinningTickets)
+	assert.Equal("b", report.Streams[1].ManifestID)
+	assert.Equal("0.100000", report.Streams[1].PricePerPixel)
+	assert.Equal("c", report.Streams[2].ManifestID)
+	assert.Equal("0.000000", report.Streams[2].PricePerPixel)
+
+	require.Len(report.Orchestrators, 2)
+	assert.Equal(bar.Hex(), report.Orchestrators[0].Address)
+	assert.Equal("30.000", report.Orchestrators[0].EV)
+	assert.Zero(report.Orchestrators[0].WinningTickets)
+	assert.Equal(foo.Hex(), report.Orchestrators[1].Address)
+	assert.Equal(int64(3), report.Orchestrators[1].TicketsSent)
+	assert.Equal(int64(250), report.Orchestrators[1].PixelsPaid)
+	assert.Equal(int64(2), report.Orchestrators[1].WinningTickets)
+	assert.Equal("150", report.Orchestrators[1].Redeemed)
+
+	data, err := json.Marshal(report.Orchestrators[1])
+	require.Nil(err)
+	assert.JSONEq(fmt.Sprintf(`{"address":"%v","ticketsSent":3,"ev":"25.000","pixelsPaid":250,"pricePerPixel":"0.100000","winningTickets":2,"redeemed":"150"}`, foo.Hex()), string(data))
+}
+
+func TestGenPayment_SpendReporter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	r, _, cleanup := tempSpendReporter(t)
+	defer cleanup()
+	defer func() { BroadcastSpendReporter = nil }()
+	BroadcastSpendReporter = r
+
+	sender := &pm.MockSender{}
+	s := &BroadcastSession{
+		Broadcaster: stubBroadcaster2(),
+		ManifestID:  core.RandomManifestID(),
+		OrchestratorInfo: &net.OrchestratorInfo{
+			PriceInfo: &net.PriceInfo{PricePerUnit: 1, PixelsPerUnit: 4},
+		},
+		Sender:      sender,
+		PMSessionID: "foo",
+	}
+	batch := &pm.TicketBatch{
+		TicketParams: &pm.TicketParams{
+			Recipient: pm.RandAddress(),
+			FaceValue: big.NewInt(10),
+			WinProb:   big.NewInt(1),
+			Seed:      big.NewInt(7777),
+		},
+		TicketExpirationParams: &pm.TicketExpirationParams{},
+		Sender:                 pm.RandAddress(),
+	}
+	sender.On("EV", s.PMSessionID).Return(big.NewRat(3, 1), nil)
+	sender.On("CreateTicketBatch", s.PMSessionID, 2).Return(batch, nil)
+
+	_, err := genPayment(s, 2)
+	require.Nil(err)
+
+	report, err := r.Report(time.Now().Add(-time.Minute), time.Now().Add(time.Second))
+	require.Nil(err)
+	require.Len(report.Streams, 1)
+	assert.Equal(string(s.ManifestID), report.Streams[0].ManifestID)
+	assert.Equal(int64(2), report.Streams[0].TicketsSent)
+	assert.Equal("6.000", report.Streams[0].EV)
+	assert.Equal("0.250000", report.Streams[0].PricePerPixel)
+	require.Len(report.Orchestrators, 1)
+	assert.Equal(batch.Recipient.Hex(), report.Orchestrators[0].Address)
+}
+
+func TestSpendReportHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := newMockServer()
+	defer srv.Close()
+	defer func() { BroadcastSpendReporter = nil }()
+
+	res, err := http.Get(srv.URL + "/spendReport")
+	require.Nil(err)
+	res.Body.Close()
+	assert.Equal(http.StatusInternalServerError, res.StatusCode)
+
+	r, _, cleanup := tempSpendReporter(t)
+	defer cleanup()
+	BroadcastSpendReporter = r
+	BroadcastSpendReporter.PaymentSent("a", pm.RandAddress(), 1, big.NewRat(1, 1), big.NewRat(1, 1))
+
+	var report SpendReport
+	get := func(query string) int {
+		res, err := http.Get(srv.URL + "/spendReport" + query)
+		require.Nil(err)
+		defer res.Body.Close()
+		if res.StatusCode == http.StatusOK {
+			require.Nil(json.NewDecoder(res.Body).Decode(&report))
+		}
+		return res.StatusCode
+	}
+
+	assert.Equal(http.StatusOK, get(""))
+	assert.Equal(int64(24*60*60), report.Until-report.Since)
+	assert.Len(report.Streams, 1)
+
+	until := time.Now().Add(-time.Hour).Unix()
+	assert.Equal(http.StatusOK, get(fmt.Sprintf("?window=1h&until=%v", until)))
+	assert.Equal(until-60*60, report.Since)
+	assert.Empty(report.Streams)
+
+	assert.Equal(http.StatusOK, get(fmt.Sprintf("?since=%v&until=%v", until, time.Now().Add(time.Second).Unix())))
+	assert.Equal(until, report.Since)
+	assert.Len(report.Streams, 1)
+
+	assert.Equal(http.StatusBadRequest, get("?window=foo"))
+	assert.Equal(http.StatusBadRequest, get("?window=-1h"))
+	assert.Equal(http.StatusBadRequest, get("?until=foo"))
+	assert.Equal(http.StatusBadRequest, get(fmt.Sprintf("?since=%v&until=%v", until, until)))
+}
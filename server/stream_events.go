@@ -0,0 +1,209 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/livepeer/go-livepeer/common"
+)
+
+// Events of the streams of a broadcaster that are posted to the stream event webhook
+const (
+	StreamEventStarted              = "streamStarted"
+	StreamEventEnded                = "streamEnded"
+	StreamEventIdle                 = "streamIdle"
+	StreamEventTranscodeError       = "transcodeError"
+	StreamEventOrchestratorSwitched = "orchestratorSwitched"
+)
+
+// Header of the hex encoded HMAC-SHA256 of the body of a stream event, keyed with the webhook secret
+const streamEventSignatureHeader = "Livepeer-Signature"
+
+// Number of times that the delivery of an event is retried, and the delay before the first retry,
+// which doubles with every retry
+var streamEventRetries = 5
+var streamEventBackoff = time.Second
+
+const streamEventQueueSize = 100
+
+// StreamEvent is the JSON body of a stream event
+type StreamEvent struct {
+	Event      string `json:"event"`
+	ManifestID string `json:"manifestID"`
+	ExternalID string `json:"externalID,omitempty"`
+	// Time of the event in milliseconds
+	Time int64 `json:"time"`
+	// Sequence number of the segment that failed to be transcoded
+	SeqNo *uint64 `json:"seqNo,omitempty"`
+	// Orchestrator that the stream switched to, and the one that it was using before
+	Orchestrator         string `json:"orchestrator,omitempty"`
+	PreviousOrchestrator string `json:"previousOrchestrator,omitempty"`
+	Error                string `json:"error,omitempty"`
+}
+
+// StreamEvents posts the events of the streams of the broadcaster. Events are not sent if nil
+var StreamEvents *StreamEventDispatcher
+
+// StreamEventDispatcher posts stream events to a webhook in the order that they happen.
+// Deliveries that fail are retried with an exponential backoff, and events are dropped
+// if the webhook falls too far behind
+type StreamEventDispatcher struct {
+	mu     sync.RWMutex
+	url    string
+	secret []byte
+	events chan *StreamEvent
+	httpc  *http.Client
+	quit   chan struct{}
+}
+
+// NewStreamEventDispatcher creates a dispatcher of the events posted to url. Events are signed
+// with secret unless it is empty
+func NewStreamEventDispatcher(url, secret string) *StreamEventDispatcher {
+	d := &StreamEventDispatcher{
+		url:    url,
+		events: make(chan *StreamEvent, streamEventQueueSize),
+		httpc:  &http.Client{Timeout: 5 * time.Second},
+		quit:   make(chan struct{}),
+	}
+	if secret != "" {
+		d.secret = []byte(secret)
+	}
+	return d
+}
+
+// SetWebhook changes the URL that events are posted to and the secret that they are signed with.
+// The events that are being delivered are posted with the previous URL
+func (d *StreamEventDispatcher) SetWebhook(url, secret string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.url = url
+	d.secret = nil
+	if secret != "" {
+		d.secret = []byte(secret)
+	}
+}
+
+// Dispatch queues an event for delivery without blocking
+func (d *StreamEventDispatcher) Dispatch(ev *StreamEvent) {
+	select {
+	case d.events <- ev:
+	default:
+		glog.Errorf("Dropped stream event event=%v manifestID=%v: too many pending events", ev.Event, ev.ManifestID)
+	}
+}
+
+// StartDispatching delivers the queued events until StopDispatching is called
+func (d *StreamEventDispatcher) StartDispatching() {
+	for {
+		select {
+		case ev := <-d.events:
+			if err := d.deliver(ev); err != nil {
+				glog.Errorf("Unable to deliver stream event event=%v manifestID=%v: %v", ev.Event, ev.ManifestID, err)
+			}
+		case <-d.quit:
+			return
+		}
+	}
+}
+
+// StopDispatching stops the delivery of events
+func (d *StreamEventDispatcher) StopDispatching() {
+	close(d.quit)
+}
+
+// deliver posts an event, retrying with an exponential backoff until it is accepted
+func (d *StreamEventDispatcher) deliver(ev *StreamEvent) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	backoff := streamEventBackoff
+	for retry := 0; ; retry++ {
+		retryable, err := d.post(body)
+		if err == nil || !retryable || retry >= streamEventRetries {
+			return err
+		}
+		glog.V(common.DEBUG).Infof("Retrying stream event event=%v manifestID=%v in %v: %v", ev.Event, ev.ManifestID, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-d.quit:
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// post sends the body of an event and returns whether a failed delivery can be retried
+func (d *StreamEventDispatcher) post(body []byte) (bool, error) {
+	d.mu.RLock()
+	url, secret := d.url, d.secret
+	d.mu.RUnlock()
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != nil {
+		req.Header.Set(streamEventSignatureHeader, signStreamEvent(secret, body))
+	}
+	resp, err := d.httpc.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	rbody, _ := ioutil.ReadAll(resp.Body)
+	err = fmt.Errorf("stream event webhook error code=%d error=%v", resp.StatusCode, strings.TrimSpace(string(rbody)))
+	// Other client errors won't succeed by retrying
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+}
+
+// signStreamEvent returns the hex encoded HMAC-SHA256 of the body of an event
+func signStreamEvent(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// notifyStreamEvent sends an event of the stream of a connection if stream events or live stats are enabled
+func notifyStreamEvent(cxn *rtmpConnection, ev *StreamEvent) {
+	if StreamEvents == nil && LiveStats == nil {
+		return
+	}
+	ev.ManifestID = string(cxn.mid)
+	if cxn.params != nil {
+		ev.ExternalID = cxn.params.externalID
+	}
+	ev.Time = time.Now().UnixNano() / int64(time.Millisecond)
+	if StreamEvents != nil {
+		StreamEvents.Dispatch(ev)
+	}
+	if LiveStats != nil {
+		LiveStats.StreamEvent(ev)
+	}
+}
+
+// switchOrchestrator records the orchestrator that a segment of the stream of a connection is
+// sent to and notifies the switch if the previous segment was sent to another orchestrator
+func switchOrchestrator(cxn *rtmpConnection, orch string) {
+	cxn.orchLock.Lock()
+	prev := cxn.orch
+	cxn.orch = orch
+	cxn.orchLock.Unlock()
+	if prev != "" && prev != orch {
+		notifyStreamEvent(cxn, &StreamEvent{Event: StreamEventOrchestratorSwitched, Orchestrator: orch, PreviousOrchestrator: prev})
+	}
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/core"
+)
+
+func TestStreamEventDispatcher_Deliver(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	oldBackoff := streamEventBackoff
+	defer func() { streamEventBackoff = oldBackoff }()
+	streamEventBackoff = time.Millisecond
+
+	var attempts int32
+	var mu sync.Mutex
+	statuses := []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}
+	setStatuses := func(s ...int) {
+		mu.Lock()
+		defer mu.Unlock()
+		atomic.StoreInt32(&attempts, 0)
+		statuses = s
+	}
+	bodies := make(chan []byte, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(signStreamEvent([]byte("secret"), body), r.Header.Get(streamEventSignatureHeader))
+		assert.Equal("application/json", r.Header.Get("Content-Type"))
+		bodies <- body
+		mu.Lock()
+		defer mu.Unlock()
+		w.WriteHeader(statuses[atomic.AddInt32(&attempts, 1)-1])
+	}))
+	defer ts.Close()
+
+	// Server errors are retried until the event is accepted
+	d := NewStreamEventDispatcher(ts.URL, "secret")
+	seqNo := uint64(3)
+	require.Nil(d.deliver(&StreamEvent{Event: StreamEventTranscodeError, ManifestID: "mid", Time: 1000, SeqNo: &seqNo, Error: "boom"}))
+	assert.Equal(int32(3), atomic.LoadInt32(&attempts))
+	body := <-bodies
+	assert.JSONEq(`{"event":"transcodeError","manifestID":"mid","time":1000,"seqNo":3,"error":"boom"}`, string(body))
+
+	// Client errors are not retried
+	setStatuses(http.StatusBadRequest, http.StatusOK)
+	err := d.deliver(&StreamEvent{Event: StreamEventStarted, ManifestID: "mid"})
+	require.NotNil(err)
+	assert.Contains(err.Error(), "code=400")
+	assert.Equal(int32(1), atomic.LoadInt32(&attempts))
+
+	// Deliveries give up after the last retry
+	oldRetries := streamEventRetries
+	defer func() { streamEventRetries = oldRetries }()
+	streamEventRetries = 1
+	setStatuses(http.StatusInternalServerError, http.StatusInternalServerError, http.StatusOK)
+	assert.NotNil(d.deliver(&StreamEvent{Event: StreamEventStarted, ManifestID: "mid"}))
+	assert.Equal(int32(2), atomic.LoadInt32(&attempts))
+}
+
+func TestStreamEventDispatcher_Unsigned(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(r.Header.Get(streamEventSignatureHeader))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	d := NewStreamEventDispatcher(ts.URL, "")
+	assert.Nil(d.deliver(&StreamEvent{Event: StreamEventEnded, ManifestID: "mid"}))
+}
+
+func TestStreamEventDispatcher_SetWebhook(t *testing.T) {
+	assert := assert.New(t)
+
+	signatures := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signatures <- r.Header.Get(streamEventSignatureHeader)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	d := NewStreamEventDispatcher("http://localhost:0", "")
+	d.SetWebhook(ts.URL, "secret")
+	assert.Nil(d.deliver(&StreamEvent{Event: StreamEventEnded, ManifestID: "mid"}))
+	assert.NotEmpty(<-signatures)
+
+	d.SetWebhook(ts.URL, "")
+	assert.Nil(d.deliver(&StreamEvent{Event: StreamEventEnded, ManifestID: "mid"}))
+	assert.Empty(<-signatures)
+}
+
+func TestNotifyStreamEvent(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	defer func() { StreamEvents = nil }()
+
+	events := make(chan *StreamEvent, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev StreamEvent
+		assert.Nil(json.NewDecoder(r.Body).Decode(&ev))
+		events <- &ev
+	}))
+	defer ts.Close()
+
+	cxn := &rtmpConnection{mid: core.ManifestID("mid"), params: &streamParameters{externalID: "ext"}}
+
+	// No events are sent when stream events are disabled
+	notifyStreamEvent(cxn, &StreamEvent{Event: StreamEventStarted})
+
+	StreamEvents = NewStreamEventDispatcher(ts.URL, "")
+	go StreamEvents.StartDispatching()
+	defer StreamEvents.StopDispatching()
+
+	notifyStreamEvent(cxn, &StreamEvent{Event: StreamEventStarted})
+	switchOrchestrator(cxn, "https://o1:8935")
+	switchOrchestrator(cxn, "https://o1:8935")
+	switchOrchestrator(cxn, "https://o2:8935")
+
+	next := func() *StreamEvent {
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(time.Second):
+			require.Fail("missing event")
+		}
+		return nil
+	}
+	ev := next()
+	assert.Equal(StreamEventStarted, ev.Event)
+	assert.Equal("mid", ev.ManifestID)
+	assert.Equal("ext", ev.ExternalID)
+	assert.NotZero(ev.Time)
+
+	// Only switches to another orchestrator are notified
+	ev = next()
+	assert.Equal(StreamEventOrchestratorSwitched, ev.Event)
+	assert.Equal("https://o2:8935", ev.Orchestrator)
+	assert.Equal("https://o1:8935", ev.PreviousOrchestrator)
+	select {
+	case ev := <-events:
+		assert.Fail("unexpected event", ev.Event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRegisterConnection_StreamEventsConsumer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := setupServer()
+	defer func() { StreamEvents = nil }()
+
+	// Streams have no consumer when stream events are disabled
+	StreamEvents = nil
+	mid := core.ManifestID("noevents")
+	_, err := s.registerConnection(stream.NewBasicRTMPVideoStream(&streamParameters{mid: mid}))
+	require.Nil(err)
+	defer removeRTMPStream(s, mid)
+	sess, ok := s.LivepeerNode.Sessions.Get(mid)
+	require.True(ok)
+	assert.Equal(0, sess.Consumers)
+
+	// The stream event webhook consumes the stream
+	StreamEvents = NewStreamEventDispatcher("http://localhost:0", "")
+	mid = core.ManifestID("events")
+	_, err = s.registerConnection(stream.NewBasicRTMPVideoStream(&streamParameters{mid: mid}))
+	require.Nil(err)
+	defer removeRTMPStream(s, mid)
+	sess, ok = s.LivepeerNode.Sessions.Get(mid)
+	require.True(ok)
+	assert.Equal(1, sess.Consumers)
+}
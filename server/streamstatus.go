@@ -0,0 +1,170 @@
+package server
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+)
+
+// streamStats count the segments of a stream that were transcoded and that failed, and keep
+// the last error of the stream
+type streamStats struct {
+	mu         sync.Mutex
+	transcoded uint64
+	failed     uint64
+	// Total time to transcode the transcoded segments
+	latency time.Duration
+	lastErr *StreamError
+}
+
+// segmentTranscoded records a segment whose renditions were received latency after it was submitted
+func (s *streamStats) segmentTranscoded(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transcoded++
+	s.latency += latency
+}
+
+// segmentFailed records an attempt to process or to transcode a segment that failed
+func (s *streamStats) segmentFailed(seqNo uint64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed++
+	s.lastErr = &StreamError{SeqNo: seqNo, Error: err.Error(), Time: time.Now().Unix()}
+}
+
+// segmentTranscoded records a segment of the stream of a connection that was transcoded by orch
+func (cxn *rtmpConnection) segmentTranscoded(seqNo uint64, orch string, latency time.Duration) {
+	cxn.stats.segmentTranscoded(latency)
+	if LiveStats != nil {
+		LiveStats.Segment(cxn.mid, seqNo, orch, latency, nil)
+	}
+}
+
+// segmentFailed records an attempt to process or to transcode a segment of the stream of a connection that failed
+func (cxn *rtmpConnection) segmentFailed(seqNo uint64, err error) {
+	cxn.stats.segmentFailed(seqNo, err)
+	if LiveStats != nil {
+		LiveStats.Segment(cxn.mid, seqNo, "", 0, err)
+	}
+}
+
+// StreamError is the last error of a stream
+type StreamError struct {
+	SeqNo uint64 `json:"seqNo"`
+	Error string `json:"error"`
+	Time  int64  `json:"time"`
+}
+
+// StreamStatus is the state of an active stream of the broadcaster
+type StreamStatus struct {
+	ManifestID string          `json:"manifestID"`
+	ExternalID string          `json:"externalID,omitempty"`
+	Source     StreamSource    `json:"source"`
+	Profiles   []StreamProfile `json:"profiles"`
+	// Orchestrator that the last segment was sent to
+	Orchestrator string `json:"orchestrator,omitempty"`
+	StartedAt    int64  `json:"startedAt"`
+	LastActivity int64  `json:"lastActivity"`
+	Idle         bool   `json:"idle"`
+	// Segments whose renditions were received, and attempts to process or transcode a segment that failed
+	SegmentsTranscoded uint64 `json:"segmentsTranscoded"`
+	SegmentsFailed     uint64 `json:"segmentsFailed"`
+	// Average time from the submission of a segment to the reception of its renditions
+	AvgLatencyMs int64        `json:"avgLatencyMs"`
+	LastError    *StreamError `json:"lastError,omitempty"`
+}
+
+// StreamSource is how a stream entered the node and the resolution of its source
+type StreamSource struct {
+	Type       string `json:"type"`
+	Resolution string `json:"resolution,omitempty"`
+}
+
+// StreamProfile is a rendition that a stream is transcoded into
+type StreamProfile struct {
+	Name       string `json:"name"`
+	Resolution string `json:"resolution"`
+	Bitrate    string `json:"bitrate"`
+	Framerate  uint   `json:"fps"`
+}
+
+// StreamStatuses returns the status of the active streams, sorted by ManifestID
+func (s *LivepeerServer) StreamStatuses() []*StreamStatus {
+	s.connectionLock.RLock()
+	cxns := make([]*rtmpConnection, 0, len(s.rtmpConnections))
+	for _, cxn := range s.rtmpConnections {
+		cxns = append(cxns, cxn)
+	}
+	s.connectionLock.RUnlock()
+
+	statuses := make([]*StreamStatus, 0, len(cxns))
+	for _, cxn := range cxns {
+		statuses = append(statuses, s.streamStatus(cxn))
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].ManifestID < statuses[j].ManifestID })
+	return statuses
+}
+
+// streamCount returns the number of active streams
+func (s *LivepeerServer) streamCount() int {
+	s.connectionLock.RLock()
+	defer s.connectionLock.RUnlock()
+	return len(s.rtmpConnections)
+}
+
+// StreamStatus returns the status of the active stream of a ManifestID
+func (s *LivepeerServer) StreamStatus(mid core.ManifestID) (*StreamStatus, bool) {
+	s.connectionLock.RLock()
+	cxn, ok := s.rtmpConnections[mid]
+	s.connectionLock.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return s.streamStatus(cxn), true
+}
+
+func (s *LivepeerServer) streamStatus(cxn *rtmpConnection) *StreamStatus {
+	status := &StreamStatus{
+		ManifestID: string(cxn.mid),
+		Source:     StreamSource{Type: string(core.SessionSourceRTMP)},
+		Profiles:   []StreamProfile{},
+	}
+	if cxn.params != nil {
+		status.ExternalID = cxn.params.externalID
+		if cxn.params.source != "" {
+			status.Source.Type = string(cxn.params.source)
+		}
+	}
+	// The resolution of streams that don't report it is unknown
+	if cxn.profile != nil && cxn.profile.Resolution != "0x0" {
+		status.Source.Resolution = cxn.profile.Resolution
+	}
+	for _, p := range cxn.getProfiles() {
+		status.Profiles = append(status.Profiles, StreamProfile{Name: p.Name, Resolution: p.Resolution, Bitrate: p.Bitrate, Framerate: p.Framerate})
+	}
+	if sess, ok := s.LivepeerNode.Sessions.Get(cxn.mid); ok {
+		status.StartedAt = sess.CreatedAt.Unix()
+		status.LastActivity = sess.LastActivity.Unix()
+		status.Idle = sess.Idle
+	}
+
+	cxn.orchLock.Lock()
+	status.Orchestrator = cxn.orch
+	cxn.orchLock.Unlock()
+
+	cxn.stats.mu.Lock()
+	defer cxn.stats.mu.Unlock()
+	status.SegmentsTranscoded = cxn.stats.transcoded
+	status.SegmentsFailed = cxn.stats.failed
+	if cxn.stats.transcoded > 0 {
+		status.AvgLatencyMs = int64(cxn.stats.latency/time.Duration(cxn.stats.transcoded)) / int64(time.Millisecond)
+	}
+	if cxn.stats.lastErr != nil {
+		lastErr := *cxn.stats.lastErr
+		status.LastError = &lastErr
+	}
+	return status
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamStats(t *testing.T) {
+	assert := assert.New(t)
+
+	var stats streamStats
+	stats.segmentTranscoded(100 * time.Millisecond)
+	stats.segmentTranscoded(300 * time.Millisecond)
+	stats.segmentFailed(2, errors.New("foo"))
+	stats.segmentFailed(3, errNoOrchs)
+
+	assert.Equal(uint64(2), stats.transcoded)
+	assert.Equal(uint64(2), stats.failed)
+	assert.Equal(400*time.Millisecond, stats.latency)
+	assert.Equal(uint64(3), stats.lastErr.SeqNo)
+	assert.Equal(errNoOrchs.Error(), stats.lastErr.Error)
+	assert.WithinDuration(time.Now(), time.Unix(stats.lastErr.Time, 0), time.Second)
+}
+
+func TestStreamStatus(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	s := setupServer()
+	assert.Empty(s.StreamStatuses())
+	_, ok := s.StreamStatus("foo")
+	assert.False(ok)
+
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}
+	cxn, err := s.registerConnection(stream.NewBasicRTMPVideoStream(&streamParameters{mid: "b", profiles: profiles, externalID: "bar", resolution: "1280x720"}))
+	require.Nil(err)
+	defer removeRTMPStream(s, "b")
+	_, err = s.registerConnection(stream.NewBasicRTMPVideoStream(&streamParameters{mid: "a", profiles: profiles, source: core.SessionSourceHTTPPush}))
+	require.Nil(err)
+	defer removeRTMPStream(s, "a")
+
+	switchOrchestrator(cxn, "https://127.0.0.1:8935")
+	cxn.stats.segmentTranscoded(200 * time.Millisecond)
+	cxn.stats.segmentTranscoded(400 * time.Millisecond)
+	cxn.stats.segmentFailed(3, errors.New("foo"))
+
+	status, ok := s.StreamStatus("b")
+	require.True(ok)
+	assert.Equal("b", status.ManifestID)
+	assert.Equal("bar", status.ExternalID)
+	assert.Equal(StreamSource{Type: "rtmp", Resolution: "1280x720"}, status.Source)
+	assert.Equal([]StreamProfile{{Name: "P144p30fps16x9", Resolution: "256x144", Bitrate: "400k", Framerate: 30}}, status.Profiles)
+	assert.Equal("https://127.0.0.1:8935", status.Orchestrator)
+	assert.WithinDuration(time.Now(), time.Unix(status.StartedAt, 0), time.Second)
+	assert.Equal(uint64(2), status.SegmentsTranscoded)
+	assert.Equal(uint64(1), status.SegmentsFailed)
+	assert.Equal(int64(300), status.AvgLatencyMs)
+	assert.Equal("foo", status.LastError.Error)
+	assert.Equal(uint64(3), status.LastError.SeqNo)
+
+	// Streams are sorted by ManifestID
+	statuses := s.StreamStatuses()
+	require.Len(statuses, 2)
+	assert.Equal("a", statuses[0].ManifestID)
+	assert.Equal(StreamSource{Type: "http"}, statuses[0].Source)
+	assert.Empty(statuses[0].Orchestrator)
+	assert.Zero(statuses[0].AvgLatencyMs)
+	assert.Nil(statuses[0].LastError)
+	assert.Equal("b", statuses[1].ManifestID)
+}
+
+func TestStreamsHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	s := setupServer()
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		streamsHandler(s).ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w := serve("/streams")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.JSONEq(`[]`, w.Body.String())
+
+	_, err := s.registerConnection(stream.NewBasicRTMPVideoStream(&streamParameters{mid: "foo", profiles: []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}}))
+	require.Nil(err)
+	defer removeRTMPStream(s, "foo")
+
+	var statuses []*StreamStatus
+	w = serve("/streams")
+	assert.Equal(http.StatusOK, w.Code)
+	require.Nil(json.Unmarshal(w.Body.Bytes(), &statuses))
+	require.Len(statuses, 1)
+	assert.Equal("foo", statuses[0].ManifestID)
+
+	var status StreamStatus
+	for _, path := range []string{"/streams/foo", "/streams/foo/"} {
+		w = serve(path)
+		assert.Equal(http.StatusOK, w.Code, path)
+		require.Nil(json.Unmarshal(w.Body.Bytes(), &status))
+		assert.Equal("foo", status.ManifestID)
+	}
+
+	w = serve("/streams/bar")
+	assert.Equal(http.StatusNotFound, w.Code)
+	assert.JSONEq(`{"error":{"code":"not_found","message":"unknown stream bar"}}`, w.Body.String())
+}
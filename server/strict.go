@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+
+	"github.com/livepeer/go-livepeer/net"
+)
+
+// StrictProtocol is set if an orchestrator rejects the requests that miss protocol fields that are
+// optional for compatibility with older nodes, so that closed networks can require every node to
+// use the full protocol
+var StrictProtocol bool
+
+// errStrictProtocol is the error of a request that misses a field required by the strict protocol
+type errStrictProtocol struct {
+	field string
+}
+
+func (e errStrictProtocol) Error() string {
+	return fmt.Sprintf("strict protocol requires %v", e.field)
+}
+
+// validateStrictPayment checks that a payment has the expected price of the orchestrator and,
+// if it has tickets, their expiration params and the signatures of the tickets
+func validateStrictPayment(payment net.Payment) error {
+	if !StrictProtocol || (len(payment.Sender) == 0 && payment.TicketParams == nil) {
+		// Payments are not sent to off-chain orchestrators
+		return nil
+	}
+	if len(payment.Sender) != ethcommon.AddressLength {
+		return errStrictProtocol{"the sender of payments"}
+	}
+	if payment.ExpectedPrice == nil || payment.ExpectedPrice.PixelsPerUnit <= 0 {
+		return errStrictProtocol{"the expected price of payments"}
+	}
+	if payment.TicketParams == nil {
+		return nil
+	}
+	params := payment.TicketParams
+	if len(params.Recipient) != ethcommon.AddressLength || len(params.FaceValue) == 0 || len(params.WinProb) == 0 ||
+		len(params.RecipientRandHash) != ethcommon.HashLength || len(params.Seed) == 0 {
+		return errStrictProtocol{"the ticket params of payments"}
+	}
+	exp := payment.ExpirationParams
+	if exp == nil || exp.CreationRound <= 0 || len(exp.CreationRoundBlockHash) != ethcommon.HashLength {
+		return errStrictProtocol{"the creation round and block hash of tickets"}
+	}
+	for _, tsp := range payment.TicketSenderParams {
+		if len(tsp.Sig) == 0 {
+			return errStrictProtocol{"the signature of tickets"}
+		}
+	}
+	return nil
+}
+
+// validateStrictSegData checks that the credentials of a segment have the hash of the segment
+func validateStrictSegData(segData *net.SegData) error {
+	if !StrictProtocol {
+		return nil
+	}
+	if len(segData.Hash) != ethcommon.HashLength {
+		return errStrictProtocol{"the hash of segments"}
+	}
+	return nil
+}
+
+// validateStrictRegistration checks that a transcoder registers with its version and capabilities
+func validateStrictRegistration(req *net.RegisterRequest) error {
+	if !StrictProtocol {
+		return nil
+	}
+	if req.Version == "" {
+		return errStrictProtocol{"the version of transcoders"}
+	}
+	if len(req.Capabilities) == 0 {
+		return errStrictProtocol{"the capabilities of transcoders"}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/net"
+)
+
+func strictTestPayment() net.Payment {
+	return net.Payment{
+		Sender:        make([]byte, 20),
+		ExpectedPrice: &net.PriceInfo{PricePerUnit: 1, PixelsPerUnit: 1},
+		TicketParams: &net.TicketParams{
+			Recipient:         make([]byte, 20),
+			FaceValue:         []byte{1},
+			WinProb:           []byte{1},
+			RecipientRandHash: make([]byte, 32),
+			Seed:              []byte{1},
+		},
+		ExpirationParams: &net.TicketExpirationParams{
+			CreationRound:          1,
+			CreationRoundBlockHash: make([]byte, 32),
+		},
+		TicketSenderParams: []*net.TicketSenderParams{{SenderNonce: 1, Sig: []byte("sig")}},
+	}
+}
+
+func TestValidateStrictPayment(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { StrictProtocol = false }()
+
+	partial := strictTestPayment()
+	partial.ExpectedPrice = nil
+	partial.ExpirationParams = nil
+
+	// Partial payments are accepted by default
+	assert.Nil(validateStrictPayment(partial))
+
+	StrictProtocol = true
+	assert.Nil(validateStrictPayment(strictTestPayment()))
+	// Off-chain requests have no payment
+	assert.Nil(validateStrictPayment(net.Payment{}))
+
+	tests := []struct {
+		field  string
+		modify func(p *net.Payment)
+	}{
+		{"the sender of payments", func(p *net.Payment) { p.Sender = []byte{1} }},
+		{"the expected price of payments", func(p *net.Payment) { p.ExpectedPrice = nil }},
+		{"the expected price of payments", func(p *net.Payment) { p.ExpectedPrice.PixelsPerUnit = 0 }},
+		{"the ticket params of payments", func(p *net.Payment) { p.TicketParams.RecipientRandHash = nil }},
+		{"the ticket params of payments", func(p *net.Payment) { p.TicketParams.Seed = nil }},
+		{"the creation round and block hash of tickets", func(p *net.Payment) { p.ExpirationParams = nil }},
+		{"the creation round and block hash of tickets", func(p *net.Payment) { p.ExpirationParams.CreationRound = 0 }},
+		{"the creation round and block hash of tickets", func(p *net.Payment) { p.ExpirationParams.CreationRoundBlockHash = nil }},
+		{"the signature of tickets", func(p *net.Payment) { p.TicketSenderParams[0].Sig = nil }},
+	}
+	for _, tt := range tests {
+		p := strictTestPayment()
+		tt.modify(&p)
+		assert.Equal(errStrictProtocol{tt.field}, validateStrictPayment(p))
+	}
+
+	// Payments without tickets only need the expected price
+	p := strictTestPayment()
+	p.TicketParams, p.ExpirationParams, p.TicketSenderParams = nil, nil, nil
+	assert.Nil(validateStrictPayment(p))
+}
+
+func TestValidateStrictSegData(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { StrictProtocol = false }()
+
+	assert.Nil(validateStrictSegData(&net.SegData{}))
+	StrictProtocol = true
+	assert.Equal(errStrictProtocol{"the hash of segments"}, validateStrictSegData(&net.SegData{}))
+	assert.Nil(validateStrictSegData(&net.SegData{Hash: make([]byte, 32)}))
+}
+
+func TestValidateStrictRegistration(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { StrictProtocol = false }()
+
+	assert.Nil(validateStrictRegistration(&net.RegisterRequest{}))
+	StrictProtocol = true
+	assert.Equal(errStrictProtocol{"the version of transcoders"}, validateStrictRegistration(&net.RegisterRequest{Capabilities: []string{"h264"}}))
+	assert.Equal(errStrictProtocol{"the capabilities of transcoders"}, validateStrictRegistration(&net.RegisterRequest{Version: "0.5.0"}))
+	assert.Nil(validateStrictRegistration(&net.RegisterRequest{Version: "0.5.0", Capabilities: []string{"h264"}}))
+}
+
+func TestServeSegment_StrictPayment(t *testing.T) {
+	StrictProtocol = true
+	defer func() { StrictProtocol = false }()
+
+	payment := strictTestPayment()
+	payment.ExpectedPrice = nil
+	data, err := proto.Marshal(&payment)
+	require.Nil(t, err)
+
+	handler := serveSegmentHandler(&mockOrchestrator{})
+	resp := httpPostResp(handler, nil, map[string]string{paymentHeader: base64.StdEncoding.EncodeToString(data)})
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.Nil(t, err)
+
+	assert.Equal(t, http.StatusPaymentRequired, resp.StatusCode)
+	assert.Contains(t, string(body), "strict protocol requires the expected price of payments")
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/lpms/ffmpeg"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+)
+
+// Formats of the thumbnails of streams
+const (
+	ThumbnailFormatJPEG = "jpg"
+	ThumbnailFormatWebP = "webp"
+)
+
+// ThumbnailInterval is how often, in stream time, a thumbnail is extracted from the
+// segments of a stream. Thumbnails are disabled if 0
+var ThumbnailInterval time.Duration
+
+// ThumbnailFormat is the image format of the thumbnails
+var ThumbnailFormat = ThumbnailFormatJPEG
+
+// ThumbnailRendition is the name of the rendition that thumbnails are extracted from
+var ThumbnailRendition = "source"
+
+// ThumbnailResolution is the size of the thumbnails
+var ThumbnailResolution = "320x180"
+
+// thumbnailPendingSegments is how many segments the thumbnail of a transcoded rendition
+// waits for before it is skipped, e.g. because the segment failed to transcode
+const thumbnailPendingSegments = 8
+
+var errThumbnailFormat = errors.New("thumbnail format must be one of jpg or webp")
+
+// extractThumbnail writes a thumbnail of the segment in the file in to out. Replaced in tests
+var extractThumbnail = ffmpegThumbnail
+
+// ParseThumbnailFormat validates the image format of thumbnails
+func ParseThumbnailFormat(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "jpg", "jpeg":
+		return ThumbnailFormatJPEG, nil
+	case "webp":
+		return ThumbnailFormatWebP, nil
+	}
+	return "", errThumbnailFormat
+}
+
+func thumbnailContentType(format string) string {
+	if format == ThumbnailFormatWebP {
+		return "image/webp"
+	}
+	return "image/jpeg"
+}
+
+// thumbnailer extracts a thumbnail from the segments of a stream every ThumbnailInterval
+// and saves the latest one to the stream's storage
+type thumbnailer struct {
+	mid       core.ManifestID
+	storage   drivers.OSSession
+	workDir   string
+	rendition string
+	format    string
+	interval  time.Duration
+
+	mu sync.Mutex
+	// Stream time of the source segments seen so far and of the next thumbnail
+	elapsed time.Duration
+	next    time.Duration
+	// Segments that the next thumbnail is extracted from once their rendition is available
+	pending map[uint64]bool
+	busy    bool
+
+	data    []byte
+	updated time.Time
+}
+
+func newThumbnailer(mid core.ManifestID, storage drivers.OSSession, workDir string) *thumbnailer {
+	return &thumbnailer{
+		mid:       mid,
+		storage:   storage,
+		workDir:   workDir,
+		rendition: ThumbnailRendition,
+		format:    ThumbnailFormat,
+		interval:  ThumbnailInterval,
+		pending:   make(map[uint64]bool),
+	}
+}
+
+// schedule is called with every source segment of the stream and picks the segments
+// that thumbnails are extracted from
+func (t *thumbnailer) schedule(seqNo uint64, duration float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.elapsed >= t.next {
+		t.pending[seqNo] = true
+		t.next = t.elapsed + t.interval
+	}
+	t.elapsed += time.Duration(duration * float64(time.Second))
+
+	for s := range t.pending {
+		if s+thumbnailPendingSegments < seqNo {
+			delete(t.pending, s)
+		}
+	}
+}
+
+// segment is called with the data of every rendition of a segment and extracts a
+// thumbnail in the background if the segment was picked by schedule
+func (t *thumbnailer) segment(rendition string, seqNo uint64, data []byte) {
+	if rendition != t.rendition || len(data) == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.pending[seqNo] || t.busy {
+		return
+	}
+	delete(t.pending, seqNo)
+	t.busy = true
+
+	go func() {
+		defer func() {
+			t.mu.Lock()
+			t.busy = false
+			t.mu.Unlock()
+		}()
+		if err := t.extract(data); err != nil {
+			glog.Errorf("Error extracting thumbnail manifestID=%s seqNo=%d: %v", t.mid, seqNo, err)
+		}
+	}()
+}
+
+func (t *thumbnailer) extract(data []byte) error {
+	dir, err := ioutil.TempDir(t.workDir, "thumbnail")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	in, out := filepath.Join(dir, "in.ts"), filepath.Join(dir, "out."+t.format)
+	if err := ioutil.WriteFile(in, data, 0644); err != nil {
+		return err
+	}
+	if err := extractThumbnail(in, out, t.format); err != nil {
+		return err
+	}
+	thumb, err := ioutil.ReadFile(out)
+	if err != nil {
+		return err
+	}
+	// The thumbnail keeps the same name so that its URI in the storage is stable
+	if _, err := t.storage.SaveData("thumbnail."+t.format, thumb); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.data, t.updated = thumb, time.Now()
+	t.mu.Unlock()
+	return nil
+}
+
+// latest returns the last thumbnail of the stream and when it was extracted
+func (t *thumbnailer) latest() ([]byte, time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.data, t.updated
+}
+
+// ffmpegThumbnail scales the last frame of the segment to ThumbnailResolution
+func ffmpegThumbnail(in, out, format string) error {
+	encoder := "mjpeg"
+	if format == ThumbnailFormatWebP {
+		encoder = "libwebp"
+	}
+	return ffmpegLastFrame(in, out, ThumbnailResolution, encoder)
+}
+
+// ffmpegLastFrame scales the last frame of the segment in the file in to a resolution and
+// writes it to out as an image with the encoder
+func ffmpegLastFrame(in, out, resolution, encoder string) error {
+	opts := []ffmpeg.TranscodeOptions{{
+		Oname: out,
+		Profile: ffmpeg.VideoProfile{
+			Name:       "frame",
+			Resolution: resolution,
+			Framerate:  1,
+		},
+		Accel: ffmpeg.Software,
+		// Every frame overwrites the image so that it ends up with the last one
+		Muxer:        ffmpeg.ComponentOptions{Name: "image2", Opts: map[string]string{"update": "1"}},
+		VideoEncoder: ffmpeg.ComponentOptions{Name: encoder},
+		AudioEncoder: ffmpeg.ComponentOptions{Name: "drop"},
+	}}
+	_, err := ffmpeg.Transcode3(&ffmpeg.TranscodeOptionsIn{Fname: in, Accel: ffmpeg.Software}, opts)
+	return err
+}
+
+// HandleThumbnail serves the latest thumbnail of a stream at /thumbnail/<manifestID>.<format>
+func (s *LivepeerServer) HandleThumbnail(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/thumbnail/")
+	ext := path.Ext(name)
+	mid := core.ManifestID(strings.TrimSuffix(name, ext))
+
+	s.connectionLock.RLock()
+	cxn, ok := s.rtmpConnections[mid]
+	s.connectionLock.RUnlock()
+	if !ok || cxn.thumbnails == nil || ext != "."+cxn.thumbnails.format {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	data, updated := cxn.thumbnails.latest()
+	if data == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", thumbnailContentType(cxn.thumbnails.format))
+	w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+	w.Header().Set("Last-Modified", updated.UTC().Format(http.TimeFormat))
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(data)
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseThumbnailFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	for in, expected := range map[string]string{"jpg": ThumbnailFormatJPEG, "JPEG": ThumbnailFormatJPEG, "webp": ThumbnailFormatWebP} {
+		format, err := ParseThumbnailFormat(in)
+		assert.Nil(err)
+		assert.Equal(expected, format)
+	}
+	_, err := ParseThumbnailFormat("png")
+	assert.Equal(errThumbnailFormat, err)
+}
+
+func waitThumbnail(th *thumbnailer, data string) bool {
+	for i := 0; i < 100; i++ {
+		if d, _ := th.latest(); string(d) == data {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestThumbnailer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	oldExtract, oldInterval := extractThumbnail, ThumbnailInterval
+	defer func() { extractThumbnail, ThumbnailInterval = oldExtract, oldInterval }()
+	extractThumbnail = func(in, out, format string) error {
+		data, err := ioutil.ReadFile(in)
+		if err != nil {
+			return err
+		}
+		if string(data) == "bad" {
+			return errors.New("bad segment")
+		}
+		return ioutil.WriteFile(out, append([]byte("thumb:"), data...), 0644)
+	}
+	ThumbnailInterval = 5 * time.Second
+
+	storage := &stubVODStorage{data: make(map[string][]byte)}
+	th := newThumbnailer("mid", storage.NewSession("mid"), "")
+	th.rendition = "P240p30fps16x9"
+
+	// Segments are picked every ThumbnailInterval of stream time
+	for i := uint64(0); i < 6; i++ {
+		th.schedule(i, 2)
+	}
+	assert.Equal(map[uint64]bool{0: true, 3: true}, th.pending)
+
+	// Thumbnails are only extracted from the configured rendition
+	th.segment("source", 0, []byte("seg0"))
+	th.segment("P240p30fps16x9", 1, []byte("seg1"))
+	data, _ := th.latest()
+	assert.Nil(data)
+	th.segment("P240p30fps16x9", 0, []byte("seg0"))
+	require.True(waitThumbnail(th, "thumb:seg0"))
+	assert.Equal([]byte("thumb:seg0"), storage.get("mid/thumbnail.jpg"))
+
+	// The last thumbnail is kept if the extraction fails
+	th.segment("P240p30fps16x9", 3, []byte("bad"))
+	time.Sleep(50 * time.Millisecond)
+	data, _ = th.latest()
+	assert.Equal([]byte("thumb:seg0"), data)
+
+	// Segments that never got their rendition are dropped
+	th.schedule(6, 2)
+	for i := uint64(7); i < 20; i++ {
+		th.schedule(i, 2)
+	}
+	assert.NotContains(th.pending, uint64(6))
+}
+
+func TestHandleThumbnail(t *testing.T) {
+	assert := assert.New(t)
+
+	s := setupServer()
+	th := newThumbnailer("mid", drivers.NewMemoryDriver(nil).NewSession("mid"), "")
+	s.connectionLock.Lock()
+	s.rtmpConnections["mid"] = &rtmpConnection{mid: "mid", thumbnails: th}
+	s.rtmpConnections["nothumb"] = &rtmpConnection{mid: "nothumb"}
+	s.connectionLock.Unlock()
+	defer func() {
+		s.connectionLock.Lock()
+		delete(s.rtmpConnections, "mid")
+		delete(s.rtmpConnections, "nothumb")
+		s.connectionLock.Unlock()
+	}()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.HandleThumbnail(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	// No thumbnail yet
+	assert.Equal(http.StatusNotFound, get("/thumbnail/mid.jpg").Code)
+	assert.Equal(http.StatusNotFound, get("/thumbnail/nothumb.jpg").Code)
+	assert.Equal(http.StatusNotFound, get("/thumbnail/unknown.jpg").Code)
+
+	th.data, th.updated = []byte("image"), time.Now()
+	w := get("/thumbnail/mid.jpg")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("image/jpeg", w.Header().Get("Content-Type"))
+	assert.Equal(strconv.Itoa(len("image")), w.Header().Get("Content-Length"))
+	assert.Equal("image", w.Body.String())
+	// Only the configured format is served
+	assert.Equal(http.StatusNotFound, get("/thumbnail/mid.webp").Code)
+}
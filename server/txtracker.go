@@ -0,0 +1,92 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/golang/glog"
+)
+
+// States of the transactions tracked by a TxTracker
+const (
+	TxPending   = "pending"
+	TxConfirmed = "confirmed"
+	TxFailed    = "failed"
+)
+
+// txStatusTTL is how long the status of a confirmed or failed transaction is kept
+var txStatusTTL = 24 * time.Hour
+
+// TxStatus is the state of a transaction submitted by an asynchronous CLI request
+type TxStatus struct {
+	TxHash string `json:"txHash"`
+	// Name of the request that submitted the transaction, e.g. fundDeposit
+	Method      string     `json:"method"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	SubmittedAt time.Time  `json:"submittedAt"`
+	DoneAt      *time.Time `json:"doneAt,omitempty"`
+}
+
+// TxTracker waits for the transactions submitted by asynchronous CLI requests in the background
+// and keeps their status, so that the requests don't block until the transactions are mined
+type TxTracker struct {
+	mu  sync.Mutex
+	txs map[string]*TxStatus
+}
+
+// NewTxTracker creates a TxTracker
+func NewTxTracker() *TxTracker {
+	return &TxTracker{txs: make(map[string]*TxStatus)}
+}
+
+// Track waits for tx with check in the background and returns its pending status
+func (t *TxTracker) Track(method string, tx *types.Transaction, check func(*types.Transaction) error) TxStatus {
+	now := time.Now()
+	status := &TxStatus{TxHash: tx.Hash().Hex(), Method: method, Status: TxPending, SubmittedAt: now}
+
+	t.mu.Lock()
+	t.prune(now)
+	t.txs[status.TxHash] = status
+	pending := *status
+	t.mu.Unlock()
+
+	go func() {
+		err := check(tx)
+		done := time.Now()
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		status.DoneAt = &done
+		if err != nil {
+			glog.Errorf("Transaction failed method=%v txHash=%v: %v", method, status.TxHash, err)
+			status.Status, status.Error = TxFailed, err.Error()
+			return
+		}
+		glog.Infof("Transaction confirmed method=%v txHash=%v", method, status.TxHash)
+		status.Status = TxConfirmed
+	}()
+
+	return pending
+}
+
+// Status returns the status of the transaction with the hash, if it is tracked
+func (t *TxTracker) Status(hash string) (TxStatus, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status, ok := t.txs[hash]
+	if !ok {
+		return TxStatus{}, false
+	}
+	return *status, true
+}
+
+// prune drops the confirmed and failed transactions that are older than txStatusTTL
+func (t *TxTracker) prune(now time.Time) {
+	for hash, status := range t.txs {
+		if status.DoneAt != nil && now.Sub(*status.DoneAt) > txStatusTTL {
+			delete(t.txs, hash)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxTracker(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	txs := NewTxTracker()
+	waitStatus := func(hash string) TxStatus {
+		for i := 0; i < 100; i++ {
+			if status, ok := txs.Status(hash); ok && status.Status != TxPending {
+				return status
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		require.Fail("transaction still pending")
+		return TxStatus{}
+	}
+
+	// Transactions are pending until they are checked
+	confirm := make(chan error)
+	tx1 := types.NewTransaction(1, ethcommon.Address{}, big.NewInt(1), 21000, big.NewInt(1), nil)
+	status := txs.Track("fundDeposit", tx1, func(*types.Transaction) error { return <-confirm })
+	assert.Equal(tx1.Hash().Hex(), status.TxHash)
+	assert.Equal("fundDeposit", status.Method)
+	assert.Equal(TxPending, status.Status)
+	assert.Nil(status.DoneAt)
+	status, ok := txs.Status(tx1.Hash().Hex())
+	assert.True(ok)
+	assert.Equal(TxPending, status.Status)
+
+	confirm <- nil
+	status = waitStatus(tx1.Hash().Hex())
+	assert.Equal(TxConfirmed, status.Status)
+	assert.Empty(status.Error)
+	assert.NotNil(status.DoneAt)
+
+	tx2 := types.NewTransaction(2, ethcommon.Address{}, big.NewInt(1), 21000, big.NewInt(1), nil)
+	txs.Track("unlock", tx2, func(*types.Transaction) error { return errors.New("reverted") })
+	status = waitStatus(tx2.Hash().Hex())
+	assert.Equal(TxFailed, status.Status)
+	assert.Equal("reverted", status.Error)
+
+	_, ok = txs.Status("0x1234")
+	assert.False(ok)
+
+	// Finished transactions are dropped once they expire
+	oldTTL := txStatusTTL
+	defer func() { txStatusTTL = oldTTL }()
+	txStatusTTL = 0
+	tx3 := types.NewTransaction(3, ethcommon.Address{}, big.NewInt(1), 21000, big.NewInt(1), nil)
+	txs.Track("withdraw", tx3, func(*types.Transaction) error { return <-confirm })
+	_, ok = txs.Status(tx1.Hash().Hex())
+	assert.False(ok)
+	_, ok = txs.Status(tx3.Hash().Hex())
+	assert.True(ok)
+	confirm <- nil
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	gonet "net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/lpms/stream"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/monitor"
+)
+
+// udpIngestTimeout is how long a UDP ingest waits for data before it ends its stream
+var udpIngestTimeout = 10 * time.Second
+
+// Size of the socket receive buffer of UDP ingests, to absorb bursts of datagrams
+const udpReadBufferSize = 4 << 20
+
+// processUDPSegment sends the segments of UDP ingests through the transcoding path. Replaced in tests
+var processUDPSegment = processSegment
+
+var errUDPIngestSpec = errors.New("UDP ingest must be of the form udp://<addr>:<port>/<manifestID>[/<streamKey>]")
+var errUDPIngestStream = errors.New("could not create stream ID for UDP ingest")
+
+// UDPIngest configures a listener for an MPEG-TS contribution feed over UDP or RIST
+type UDPIngest struct {
+	Addr string
+	// Path of the stream, as in an RTMP ingest URL: the manifest ID followed by an optional stream key
+	Path string
+	// PIDs of the video and audio elementary streams of the feed. Detected from the PMT if 0
+	VideoPID uint16
+	AudioPID uint16
+	// Resolution of the feed, e.g. 1920x1080
+	Resolution string
+}
+
+// ParseUDPIngest parses the configuration of a UDP ingest from a URL such as
+// udp://0.0.0.0:5000/movie1?video=0x100&audio=0x101&resolution=1920x1080. The rtp and
+// rist schemes are accepted for feeds that are encapsulated in RTP
+func ParseUDPIngest(spec string) (*UDPIngest, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "udp", "rtp", "rist":
+	default:
+		return nil, errUDPIngestSpec
+	}
+	path := strings.Trim(u.Path, "/")
+	if u.Port() == "" || path == "" {
+		return nil, errUDPIngestSpec
+	}
+
+	cfg := &UDPIngest{
+		Addr:       u.Host,
+		Path:       path,
+		Resolution: u.Query().Get("resolution"),
+	}
+	for name, pid := range map[string]*uint16{"video": &cfg.VideoPID, "audio": &cfg.AudioPID} {
+		v := u.Query().Get(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(v, 0, 16)
+		if err != nil || n == 0 || n > 0x1ffe {
+			return nil, fmt.Errorf("invalid %s PID %q for UDP ingest", name, v)
+		}
+		*pid = uint16(n)
+	}
+	return cfg, nil
+}
+
+// ServeUDPIngest receives an MPEG-TS feed over UDP, either raw or in RTP packets, and sends it
+// through the same segmenting and transcoding path as RTMP streams. The stream starts with
+// the first datagram and ends when no data is received for a while. Multicast addresses are joined
+func (s *LivepeerServer) ServeUDPIngest(ctx context.Context, cfg *UDPIngest) error {
+	addr, err := gonet.ResolveUDPAddr("udp", cfg.Addr)
+	if err != nil {
+		return err
+	}
+	var conn *gonet.UDPConn
+	if addr.IP.IsMulticast() {
+		conn, err = gonet.ListenMulticastUDP("udp", nil, addr)
+	} else {
+		conn, err = gonet.ListenUDP("udp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if err := conn.SetReadBuffer(udpReadBufferSize); err != nil {
+		glog.Warningf("Error setting the receive buffer of UDP ingest addr=%s: %v", cfg.Addr, err)
+	}
+	return s.serveUDPIngest(ctx, conn, cfg)
+}
+
+func (s *LivepeerServer) serveUDPIngest(ctx context.Context, conn gonet.PacketConn, cfg *UDPIngest) error {
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	glog.Infof("UDP ingest listening on %v", conn.LocalAddr())
+	feed := &udpFeed{s: s, cfg: cfg}
+	defer feed.end()
+	buf := make([]byte, 65536)
+	for {
+		conn.SetReadDeadline(time.Now().Add(udpIngestTimeout))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if ne, ok := err.(gonet.Error); ok && ne.Timeout() {
+				feed.end()
+				continue
+			}
+			return err
+		}
+		feed.datagram(buf[:n])
+	}
+}
+
+// udpFeed tracks the stream of a UDP ingest
+type udpFeed struct {
+	s   *LivepeerServer
+	cfg *UDPIngest
+
+	cxn   *rtmpConnection
+	seg   *tsSegmenter
+	retry time.Time
+}
+
+func (f *udpFeed) datagram(d []byte) {
+	if f.cxn == nil {
+		if time.Now().Before(f.retry) {
+			return
+		}
+		if err := f.start(); err != nil {
+			glog.Errorf("Error starting UDP ingest stream addr=%s: %v", f.cfg.Addr, err)
+			f.retry = time.Now().Add(udpIngestTimeout)
+			return
+		}
+	}
+
+	if len(d) > 0 && d[0] != tsSyncByte {
+		if payload, ok := rtpPayload(d); ok {
+			d = payload
+		}
+	}
+	if err := f.seg.write(d); err != nil {
+		glog.V(common.DEBUG).Infof("Dropping UDP ingest datagram manifestID=%s len=%d: %v", f.cxn.mid, len(d), err)
+	}
+}
+
+// start sets up the stream of the feed like the stream of an RTMP publisher
+func (f *udpFeed) start() error {
+	u := &url.URL{Scheme: "udp", Host: f.cfg.Addr, Path: "/" + f.cfg.Path}
+	appData := createRTMPStreamIDHandler(f.s)(u)
+	if appData == nil {
+		return errUDPIngestStream
+	}
+	st := stream.NewBasicRTMPVideoStream(appData)
+	params := streamParams(st)
+	params.source = core.SessionSourceUDP
+	params.resolution = f.cfg.Resolution
+	cxn, err := f.s.registerConnection(st)
+	if err != nil {
+		return err
+	}
+
+	f.cxn = cxn
+	f.seg = newTSSegmenter(f.cfg.VideoPID, f.cfg.AudioPID, SegLen, func(data []byte, seqNo uint64, duration float64) {
+		if seqNo == 0 && monitor.Enabled {
+			monitor.StreamStarted(cxn.nonce)
+		}
+		f.s.LivepeerNode.Sessions.Touch(cxn.mid)
+		atomic.StoreUint64(&cxn.nextSeq, seqNo+1)
+		go processUDPSegment(cxn, &stream.HLSSegment{
+			Data:     data,
+			Name:     fmt.Sprintf("%d.ts", seqNo),
+			SeqNo:    seqNo,
+			Duration: duration,
+		})
+	})
+	if monitor.Enabled {
+		monitor.StreamCreated(string(cxn.mid), cxn.nonce)
+	}
+	glog.Infof("UDP ingest started manifestID=%s addr=%s", cxn.mid, f.cfg.Addr)
+	return nil
+}
+
+// end ends the stream of the feed, if any, after its last segment
+func (f *udpFeed) end() {
+	if f.cxn == nil {
+		return
+	}
+	f.seg.flush()
+	glog.Infof("UDP ingest ended manifestID=%s addr=%s", f.cxn.mid, f.cfg.Addr)
+	removeRTMPStream(f.s, f.cxn.mid)
+	f.cxn, f.seg = nil, nil
+}
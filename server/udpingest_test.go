@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	gonet "net"
+	"testing"
+	"time"
+
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/core"
+)
+
+func TestParseUDPIngest(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg, err := ParseUDPIngest("udp://0.0.0.0:5000/movie1/key?video=0x100&audio=257&resolution=1920x1080")
+	assert.Nil(err)
+	assert.Equal(&UDPIngest{Addr: "0.0.0.0:5000", Path: "movie1/key", VideoPID: 0x100, AudioPID: 257, Resolution: "1920x1080"}, cfg)
+
+	cfg, err = ParseUDPIngest("rist://239.0.0.1:5000/movie1")
+	assert.Nil(err)
+	assert.Equal(&UDPIngest{Addr: "239.0.0.1:5000", Path: "movie1"}, cfg)
+
+	for _, spec := range []string{
+		"rtmp://0.0.0.0:5000/movie1",
+		"udp://0.0.0.0/movie1",
+		"udp://0.0.0.0:5000",
+		"udp://0.0.0.0:5000/movie1?video=0",
+		"udp://0.0.0.0:5000/movie1?audio=0x2000",
+		"udp://0.0.0.0:5000/movie1?audio=abc",
+	} {
+		_, err := ParseUDPIngest(spec)
+		assert.NotNil(err, spec)
+	}
+}
+
+func TestServeUDPIngest(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := setupServer()
+
+	oldProcess, oldTimeout := processUDPSegment, udpIngestTimeout
+	defer func() { processUDPSegment, udpIngestTimeout = oldProcess, oldTimeout }()
+	udpIngestTimeout = 200 * time.Millisecond
+	type udpSegment struct {
+		mid core.ManifestID
+		seg *stream.HLSSegment
+	}
+	segs := make(chan udpSegment, 10)
+	processUDPSegment = func(cxn *rtmpConnection, seg *stream.HLSSegment) error {
+		segs <- udpSegment{cxn.mid, seg}
+		return nil
+	}
+
+	conn, err := gonet.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.serveUDPIngest(ctx, conn, &UDPIngest{Path: "udpingest", Resolution: "1280x720"}) }()
+
+	sender, err := gonet.Dial("udp", conn.LocalAddr().String())
+	require.Nil(err)
+	defer sender.Close()
+	ts := testTS(10)
+	for i := 0; i < len(ts); i += 7 * tsPacketSize {
+		end := i + 7*tsPacketSize
+		if end > len(ts) {
+			end = len(ts)
+		}
+		_, err := sender.Write(ts[i:end])
+		require.Nil(err)
+		// Gives the listener time to read the datagram
+		time.Sleep(time.Millisecond)
+	}
+
+	// The last segment is sent when the feed times out
+	seqNos := make(map[uint64]bool)
+	for i := 0; i < 3; i++ {
+		select {
+		case got := <-segs:
+			seqNos[got.seg.SeqNo] = true
+			assert.Equal(core.ManifestID("udpingest"), got.mid)
+		case <-time.After(time.Second):
+			require.Fail("missing segment", i)
+		}
+	}
+	assert.Equal(map[uint64]bool{0: true, 1: true, 2: true}, seqNos)
+	time.Sleep(50 * time.Millisecond)
+	s.connectionLock.RLock()
+	_, exists := s.rtmpConnections["udpingest"]
+	s.connectionLock.RUnlock()
+	assert.False(exists)
+
+	cancel()
+	assert.Equal(context.Canceled, <-errCh)
+}
@@ -0,0 +1,559 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/png"
+	"io/ioutil"
+	"math"
+	"math/bits"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+)
+
+// Verifiers of segments that can be configured
+const (
+	VerifierHTTP      = "http"
+	VerifierPixelHash = "pixelhash"
+	VerifierTranscode = "transcode"
+)
+
+// Hamming distance between the hashes of the frames of a source segment and a rendition
+// above which the rendition fails the pixel hash verification, out of 64 bits
+const defaultPixelHashDistance = 12
+
+// Hamming distance between the hashes of the frames of a local rendition and the rendition of
+// the orchestrator above which the rendition fails the transcode verification. Lower than the
+// pixel hash distance since both frames are scaled to the same resolution
+const defaultTranscodeDistance = 8
+
+// Relative difference between the pixels of a local rendition and the pixels reported by the
+// orchestrator above which the rendition fails the transcode verification. Encoders may drop
+// a few frames differently
+const transcodePixelTolerance = 0.05
+
+var errVerifierBusy = errors.New("verifier busy")
+
+// extractFrame writes the last frame of the segment in the file in to out as a small PNG. Replaced in tests
+var extractFrame = ffmpegFrame
+
+// localTranscode transcodes the segment in the file in to a file in outs for each profile and
+// returns the pixels encoded for each of them. Replaced in tests
+var localTranscode = ffmpegLocalTranscode
+
+// BroadcastVerification verifies the renditions that orchestrators return to the broadcaster.
+// Renditions are not verified if nil
+var BroadcastVerification *SegmentVerification
+
+// VerificationRendition is a rendition of a segment along with the pixels that the orchestrator reported for it
+type VerificationRendition struct {
+	Profile ffmpeg.VideoProfile
+	URI     string
+	Data    []byte
+	Pixels  int64
+}
+
+// VerificationSegment is a source segment and the renditions that an orchestrator returned for it
+type VerificationSegment struct {
+	ManifestID   core.ManifestID
+	SeqNo        uint64
+	Orchestrator string
+	Source       []byte
+	Renditions   []*VerificationRendition
+}
+
+// VerificationFailure is returned by verifiers when renditions don't match their source segment.
+// Other errors mean that the verification could not be done
+type VerificationFailure struct {
+	Reason string
+}
+
+func (f *VerificationFailure) Error() string {
+	return "verification failed: " + f.Reason
+}
+
+// SegmentVerifier checks the renditions that an orchestrator returned for a source segment
+type SegmentVerifier interface {
+	Verify(seg *VerificationSegment) error
+}
+
+// ParseSegmentVerifiers parses a comma-separated list of verifiers, e.g.
+// "pixelhash:10,transcode,http:https://verifier.example.com/verify", that renditions must all pass
+func ParseSegmentVerifiers(spec, workDir string) (SegmentVerifier, error) {
+	var verifiers verifierChain
+	for _, s := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(s), ":", 2)
+		switch parts[0] {
+		case VerifierPixelHash, VerifierTranscode:
+			distance := defaultPixelHashDistance
+			if parts[0] == VerifierTranscode {
+				distance = defaultTranscodeDistance
+			}
+			if len(parts) == 2 {
+				d, err := strconv.Atoi(parts[1])
+				if err != nil || d < 0 || d > 64 {
+					return nil, fmt.Errorf("invalid %v distance %v", parts[0], parts[1])
+				}
+				distance = d
+			}
+			if parts[0] == VerifierTranscode {
+				verifiers = append(verifiers, newTranscodeVerifier(workDir, distance))
+				break
+			}
+			verifiers = append(verifiers, &pixelHashVerifier{workDir: workDir, maxDistance: distance})
+		case VerifierHTTP:
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("missing URL of the http verifier")
+			}
+			u, err := url.ParseRequestURI(parts[1])
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return nil, fmt.Errorf("invalid URL of the http verifier %v", parts[1])
+			}
+			verifiers = append(verifiers, newHTTPVerifier(parts[1]))
+		default:
+			return nil, fmt.Errorf("unknown segment verifier %v", parts[0])
+		}
+	}
+	return verifiers, nil
+}
+
+// verifierChain requires renditions to pass every verifier in order
+type verifierChain []SegmentVerifier
+
+func (c verifierChain) Verify(seg *VerificationSegment) error {
+	for _, v := range c {
+		if err := v.Verify(seg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type httpVerificationRendition struct {
+	Name       string `json:"name"`
+	Resolution string `json:"resolution"`
+	Bitrate    string `json:"bitrate"`
+	URI        string `json:"uri"`
+	Pixels     int64  `json:"pixels"`
+	Data       []byte `json:"data"`
+}
+
+type httpVerificationRequest struct {
+	ManifestID   string                      `json:"manifestID"`
+	SeqNo        uint64                      `json:"seqNo"`
+	Orchestrator string                      `json:"orchestrator"`
+	Source       []byte                      `json:"source"`
+	Renditions   []httpVerificationRendition `json:"renditions"`
+}
+
+type httpVerificationResponse struct {
+	Verified bool   `json:"verified"`
+	Reason   string `json:"reason"`
+}
+
+// httpVerifier posts segments to an external verifier, e.g. a classifier of tampered renditions
+type httpVerifier struct {
+	url   string
+	httpc *http.Client
+}
+
+func newHTTPVerifier(url string) *httpVerifier {
+	return &httpVerifier{url: url, httpc: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (v *httpVerifier) Verify(seg *VerificationSegment) error {
+	req := httpVerificationRequest{
+		ManifestID:   string(seg.ManifestID),
+		SeqNo:        seg.SeqNo,
+		Orchestrator: seg.Orchestrator,
+		Source:       seg.Source,
+	}
+	for _, r := range seg.Renditions {
+		req.Renditions = append(req.Renditions, httpVerificationRendition{
+			Name:       r.Profile.Name,
+			Resolution: r.Profile.Resolution,
+			Bitrate:    r.Profile.Bitrate,
+			URI:        r.URI,
+			Pixels:     r.Pixels,
+			Data:       r.Data,
+		})
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := v.httpc.Post(v.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	rbody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("verifier error code=%d error=%v", resp.StatusCode, strings.TrimSpace(string(rbody)))
+	}
+	var res httpVerificationResponse
+	if err := json.Unmarshal(rbody, &res); err != nil {
+		return err
+	}
+	if !res.Verified {
+		return &VerificationFailure{Reason: res.Reason}
+	}
+	return nil
+}
+
+// pixelHashVerifier compares the average hashes of the last frames of the source segment and
+// of its renditions, which only differ slightly unless the content of a rendition was altered
+type pixelHashVerifier struct {
+	workDir     string
+	maxDistance int
+}
+
+func (v *pixelHashVerifier) Verify(seg *VerificationSegment) error {
+	source, err := frameHash(v.workDir, seg.Source)
+	if err != nil {
+		return err
+	}
+	for _, r := range seg.Renditions {
+		hash, err := frameHash(v.workDir, r.Data)
+		if err != nil {
+			return err
+		}
+		if d := bits.OnesCount64(source ^ hash); d > v.maxDistance {
+			return &VerificationFailure{Reason: fmt.Sprintf("rendition %v differs from the source by %d bits", r.Profile.Name, d)}
+		}
+	}
+	return nil
+}
+
+// transcodeVerifier transcodes the source segment locally with the profiles of its renditions
+// and compares the local renditions with the renditions of the orchestrator, which doesn't need
+// an external verification service. Segments are transcoded one at a time with spare CPU, so
+// segments that are sampled while another segment is transcoded are not checked
+type transcodeVerifier struct {
+	workDir     string
+	maxDistance int
+	busy        chan struct{}
+}
+
+func newTranscodeVerifier(workDir string, maxDistance int) *transcodeVerifier {
+	return &transcodeVerifier{workDir: workDir, maxDistance: maxDistance, busy: make(chan struct{}, 1)}
+}
+
+func (v *transcodeVerifier) Verify(seg *VerificationSegment) error {
+	select {
+	case v.busy <- struct{}{}:
+		defer func() { <-v.busy }()
+	default:
+		return errVerifierBusy
+	}
+
+	dir, err := ioutil.TempDir(v.workDir, "verify")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "in.ts")
+	if err := ioutil.WriteFile(in, seg.Source, 0644); err != nil {
+		return err
+	}
+	profiles := make([]ffmpeg.VideoProfile, len(seg.Renditions))
+	outs := make([]string, len(seg.Renditions))
+	for i, r := range seg.Renditions {
+		profiles[i] = r.Profile
+		outs[i] = filepath.Join(dir, fmt.Sprintf("out%d.ts", i))
+	}
+	pixels, err := localTranscode(in, profiles, outs)
+	if err != nil {
+		return err
+	}
+
+	for i, r := range seg.Renditions {
+		if r.Pixels > 0 && pixels[i] > 0 {
+			if diff := math.Abs(float64(r.Pixels-pixels[i])) / float64(pixels[i]); diff > transcodePixelTolerance {
+				return &VerificationFailure{Reason: fmt.Sprintf("rendition %v has %d pixels instead of %d", r.Profile.Name, r.Pixels, pixels[i])}
+			}
+		}
+		local, err := ioutil.ReadFile(outs[i])
+		if err != nil {
+			return err
+		}
+		expected, err := frameHash(v.workDir, local)
+		if err != nil {
+			return err
+		}
+		hash, err := frameHash(v.workDir, r.Data)
+		if err != nil {
+			return err
+		}
+		if d := bits.OnesCount64(expected ^ hash); d > v.maxDistance {
+			return &VerificationFailure{Reason: fmt.Sprintf("rendition %v differs from the local rendition by %d bits", r.Profile.Name, d)}
+		}
+	}
+	return nil
+}
+
+// frameHash returns the average hash of the last frame of a segment
+func frameHash(workDir string, data []byte) (uint64, error) {
+	dir, err := ioutil.TempDir(workDir, "verify")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dir)
+
+	in, out := filepath.Join(dir, "in.ts"), filepath.Join(dir, "out.png")
+	if err := ioutil.WriteFile(in, data, 0644); err != nil {
+		return 0, err
+	}
+	if err := extractFrame(in, out); err != nil {
+		return 0, err
+	}
+	f, err := os.Open(out)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return 0, err
+	}
+	return averageHash(img), nil
+}
+
+// averageHash sets a bit for each cell of an 8x8 grid over the image whose luminance is above
+// the average luminance of the grid
+func averageHash(img image.Image) uint64 {
+	b := img.Bounds()
+	var cells [64]uint64
+	var counts [64]uint64
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			i := (y-b.Min.Y)*8/b.Dy()*8 + (x-b.Min.X)*8/b.Dx()
+			cells[i] += (299*uint64(r) + 587*uint64(g) + 114*uint64(bl)) / 1000
+			counts[i]++
+		}
+	}
+	var total uint64
+	for i := range cells {
+		if counts[i] > 0 {
+			cells[i] /= counts[i]
+		}
+		total += cells[i]
+	}
+	avg := total / 64
+	var hash uint64
+	for i, c := range cells {
+		if c > avg {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// ffmpegFrame scales the last frame of the segment to a 32x32 PNG
+func ffmpegFrame(in, out string) error {
+	return ffmpegLastFrame(in, out, "32x32", "png")
+}
+
+// ffmpegLocalTranscode transcodes the segment in software, which leaves the GPUs to the streams
+func ffmpegLocalTranscode(in string, profiles []ffmpeg.VideoProfile, outs []string) ([]int64, error) {
+	opts := make([]ffmpeg.TranscodeOptions, len(profiles))
+	for i, p := range profiles {
+		opts[i] = ffmpeg.TranscodeOptions{
+			Oname:   outs[i],
+			Profile: p,
+			Accel:   ffmpeg.Software,
+		}
+	}
+	res, err := ffmpeg.Transcode3(&ffmpeg.TranscodeOptionsIn{Fname: in, Accel: ffmpeg.Software}, opts)
+	if err != nil {
+		return nil, err
+	}
+	pixels := make([]int64, len(profiles))
+	for i := range pixels {
+		if i < len(res.Encoded) {
+			pixels[i] = res.Encoded[i].Pixels
+		}
+	}
+	return pixels, nil
+}
+
+// verifySegment verifies the renditions of a segment and drops the session of the orchestrator
+// that returned them if they fail the verification. The result is recorded for the arm of the A/B
+// test that the segment was sent to, if any
+func verifySegment(cxn *rtmpConnection, sess *BroadcastSession, seg *stream.HLSSegment, renditions []*VerificationRendition, abTestArm int) {
+	// Renditions that were uploaded by the orchestrator to the broadcaster's storage were not downloaded
+	for _, r := range renditions {
+		if r.Data != nil {
+			continue
+		}
+		data, err := drivers.GetSegmentData(r.URI)
+		if err != nil {
+			glog.Errorf("Unable to download rendition for verification nonce=%d seqNo=%d profile=%v: %v", cxn.nonce, seg.SeqNo, r.Profile.Name, err)
+			return
+		}
+		r.Data = data
+	}
+	failed := BroadcastVerification.verify(&VerificationSegment{
+		ManifestID:   cxn.mid,
+		SeqNo:        seg.SeqNo,
+		Orchestrator: sess.OrchestratorInfo.Transcoder,
+		Source:       seg.Data,
+		Renditions:   renditions,
+	})
+	if BroadcastABTest != nil {
+		BroadcastABTest.Verification(abTestArm, failed)
+	}
+	if failed {
+		if cxn.sessManager.reputation != nil {
+			cxn.sessManager.reputation.VerificationFailure(sess.OrchestratorInfo.Transcoder)
+		}
+		cxn.sessManager.removeSession(sess)
+	}
+}
+
+// SegmentVerification spot-checks the renditions returned by orchestrators with a verifier and
+// suspends the orchestrators whose renditions fail the verification too many times. Segments are
+// sampled at a base rate that ramps up as the trust in an orchestrator drops after failures
+type SegmentVerification struct {
+	verifier    SegmentVerifier
+	sampleRate  float64
+	maxFailures int
+	suspension  time.Duration
+
+	mu        sync.Mutex
+	trust     map[string]float64
+	failures  map[string]int
+	suspended map[string]time.Time
+}
+
+// Share of the distrust in an orchestrator that is recovered when one of its segments passes
+// the verification. The trust is halved when a segment fails
+const trustRecovery = 0.1
+
+// verificationRand returns the random numbers that segments are sampled with. Replaced in tests
+var verificationRand = rand.Float64
+
+// NewSegmentVerification creates a SegmentVerification that verifies sampleRate of the segments of
+// trusted orchestrators and suspends an orchestrator for suspension once maxFailures of its
+// segments failed the verification
+func NewSegmentVerification(verifier SegmentVerifier, sampleRate float64, maxFailures int, suspension time.Duration) *SegmentVerification {
+	return &SegmentVerification{
+		verifier:    verifier,
+		sampleRate:  sampleRate,
+		maxFailures: maxFailures,
+		suspension:  suspension,
+		trust:       make(map[string]float64),
+		failures:    make(map[string]int),
+		suspended:   make(map[string]time.Time),
+	}
+}
+
+// Sample returns whether a segment transcoded by the orchestrator at uri should be verified.
+// Segments of orchestrators that are not fully trusted are sampled more often, up to every
+// segment of an orchestrator that is not trusted at all
+func (v *SegmentVerification) Sample(uri string) bool {
+	trust := v.Trust(uri)
+	return verificationRand() < v.sampleRate+(1-v.sampleRate)*(1-trust)
+}
+
+// Trust returns the trust score of the orchestrator at uri, between 0 and 1. Orchestrators are
+// fully trusted until their segments fail the verification
+func (v *SegmentVerification) Trust(uri string) float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if trust, ok := v.trust[uri]; ok {
+		return trust
+	}
+	return 1
+}
+
+// verify checks the renditions of a segment and returns whether they failed the verification,
+// in which case the orchestrator that returned them is penalized
+func (v *SegmentVerification) verify(seg *VerificationSegment) bool {
+	err := v.verifier.Verify(seg)
+	if err == nil {
+		v.reward(seg.Orchestrator)
+		return false
+	}
+	if _, ok := err.(*VerificationFailure); !ok {
+		glog.Errorf("Unable to verify segment manifestID=%s seqNo=%d orch=%s: %v", seg.ManifestID, seg.SeqNo, seg.Orchestrator, err)
+		return false
+	}
+	glog.Errorf("Segment failed verification manifestID=%s seqNo=%d orch=%s: %v", seg.ManifestID, seg.SeqNo, seg.Orchestrator, err)
+	v.penalize(seg.Orchestrator)
+	return true
+}
+
+func (v *SegmentVerification) reward(orch string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	trust, ok := v.trust[orch]
+	if !ok {
+		return
+	}
+	trust += (1 - trust) * trustRecovery
+	// Forget orchestrators that are trusted again
+	if trust > 0.99 {
+		delete(v.trust, orch)
+		return
+	}
+	v.trust[orch] = trust
+}
+
+func (v *SegmentVerification) penalize(orch string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	trust, ok := v.trust[orch]
+	if !ok {
+		trust = 1
+	}
+	v.trust[orch] = trust / 2
+
+	v.failures[orch]++
+	if v.failures[orch] >= v.maxFailures {
+		glog.Warningf("Suspending orchestrator after failed verifications orch=%s failures=%d suspension=%v", orch, v.failures[orch], v.suspension)
+		v.suspended[orch] = time.Now().Add(v.suspension)
+		delete(v.failures, orch)
+	}
+}
+
+// Suspended returns whether the orchestrator at uri is suspended for failing verifications
+func (v *SegmentVerification) Suspended(uri string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	until, ok := v.suspended[uri]
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(v.suspended, uri)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,452 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/lpms/ffmpeg"
+)
+
+type stubSegmentVerifier struct {
+	err   error
+	calls int
+}
+
+func (v *stubSegmentVerifier) Verify(seg *VerificationSegment) error {
+	v.calls++
+	return v.err
+}
+
+func TestParseSegmentVerifiers(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	v, err := ParseSegmentVerifiers("pixelhash", "/tmp")
+	require.Nil(err)
+	require.Len(v, 1)
+	assert.Equal(&pixelHashVerifier{workDir: "/tmp", maxDistance: defaultPixelHashDistance}, v.(verifierChain)[0])
+
+	v, err = ParseSegmentVerifiers("pixelhash:10, http:https://verifier.example.com/verify", "/tmp")
+	require.Nil(err)
+	chain := v.(verifierChain)
+	require.Len(chain, 2)
+	assert.Equal(10, chain[0].(*pixelHashVerifier).maxDistance)
+	assert.Equal("https://verifier.example.com/verify", chain[1].(*httpVerifier).url)
+
+	v, err = ParseSegmentVerifiers("transcode,transcode:4", "/tmp")
+	require.Nil(err)
+	chain = v.(verifierChain)
+	require.Len(chain, 2)
+	assert.Equal(defaultTranscodeDistance, chain[0].(*transcodeVerifier).maxDistance)
+	assert.Equal(4, chain[1].(*transcodeVerifier).maxDistance)
+	assert.Equal("/tmp", chain[1].(*transcodeVerifier).workDir)
+
+	for _, spec := range []string{"", "foo", "pixelhash:x", "pixelhash:65", "pixelhash:-1", "transcode:x", "transcode:65", "http", "http:foo", "http:ftp://example.com"} {
+		_, err := ParseSegmentVerifiers(spec, "/tmp")
+		assert.NotNil(err, spec)
+	}
+}
+
+func TestVerifierChain(t *testing.T) {
+	assert := assert.New(t)
+
+	failure := &VerificationFailure{Reason: "bad"}
+	v1, v2 := &stubSegmentVerifier{err: failure}, &stubSegmentVerifier{}
+	assert.Equal(failure, verifierChain{v1, v2}.Verify(&VerificationSegment{}))
+	// Verification stops at the first verifier that fails
+	assert.Equal(0, v2.calls)
+
+	v1.err = nil
+	assert.Nil(verifierChain{v1, v2}.Verify(&VerificationSegment{}))
+	assert.Equal(1, v2.calls)
+}
+
+func TestHTTPVerifier(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var req httpVerificationRequest
+	resp := `{"verified":true}`
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("application/json", r.Header.Get("Content-Type"))
+		assert.Nil(json.NewDecoder(r.Body).Decode(&req))
+		w.WriteHeader(status)
+		w.Write([]byte(resp))
+	}))
+	defer ts.Close()
+
+	v := newHTTPVerifier(ts.URL)
+	seg := &VerificationSegment{
+		ManifestID:   core.ManifestID("mid"),
+		SeqNo:        5,
+		Orchestrator: "https://o1:8935",
+		Source:       []byte("source"),
+		Renditions: []*VerificationRendition{{
+			Profile: ffmpeg.P240p30fps16x9,
+			URI:     "https://o1:8935/stream/mid/5.ts",
+			Data:    []byte("rendition"),
+			Pixels:  100,
+		}},
+	}
+	require.Nil(v.Verify(seg))
+	assert.Equal("mid", req.ManifestID)
+	assert.Equal(uint64(5), req.SeqNo)
+	assert.Equal("https://o1:8935", req.Orchestrator)
+	assert.Equal([]byte("source"), req.Source)
+	require.Len(req.Renditions, 1)
+	assert.Equal(httpVerificationRendition{
+		Name:       ffmpeg.P240p30fps16x9.Name,
+		Resolution: ffmpeg.P240p30fps16x9.Resolution,
+		Bitrate:    ffmpeg.P240p30fps16x9.Bitrate,
+		URI:        "https://o1:8935/stream/mid/5.ts",
+		Pixels:     100,
+		Data:       []byte("rendition"),
+	}, req.Renditions[0])
+
+	// Renditions that are not verified fail
+	resp = `{"verified":false,"reason":"tampered"}`
+	err := v.Verify(seg)
+	require.IsType(&VerificationFailure{}, err)
+	assert.Equal("tampered", err.(*VerificationFailure).Reason)
+
+	// Errors of the verifier are not failures
+	status, resp = http.StatusInternalServerError, "boom"
+	err = v.Verify(seg)
+	require.NotNil(err)
+	_, ok := err.(*VerificationFailure)
+	assert.False(ok)
+	assert.Contains(err.Error(), "code=500")
+
+	status, resp = http.StatusOK, "{"
+	err = v.Verify(seg)
+	require.NotNil(err)
+	_, ok = err.(*VerificationFailure)
+	assert.False(ok)
+}
+
+func solidImage(c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// halfImage is white on its left half and black on its right half, or the other way around
+func halfImage(whiteLeft bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			if (x < 16) == whiteLeft {
+				img.Set(x, y, color.White)
+			} else {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+	return img
+}
+
+func TestAverageHash(t *testing.T) {
+	assert := assert.New(t)
+
+	// Uniform images have no cell above the average
+	assert.Equal(uint64(0), averageHash(solidImage(color.White)))
+	assert.Equal(uint64(0), averageHash(solidImage(color.Black)))
+
+	left, right := averageHash(halfImage(true)), averageHash(halfImage(false))
+	assert.Equal(uint64(0x0f0f0f0f0f0f0f0f), left)
+	assert.Equal(uint64(0xf0f0f0f0f0f0f0f0), right)
+}
+
+func TestPixelHashVerifier(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	oldExtractFrame := extractFrame
+	defer func() { extractFrame = oldExtractFrame }()
+
+	// The content of the segments stands for whether their frame is white on the left
+	extractFrame = func(in, out string) error {
+		data, err := ioutil.ReadFile(in)
+		if err != nil {
+			return err
+		}
+		f, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return png.Encode(f, halfImage(string(data) == "left"))
+	}
+
+	dir, err := ioutil.TempDir("", "TestPixelHashVerifier")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	v := &pixelHashVerifier{workDir: dir, maxDistance: defaultPixelHashDistance}
+	seg := &VerificationSegment{
+		Source: []byte("left"),
+		Renditions: []*VerificationRendition{
+			{Profile: ffmpeg.P144p30fps16x9, Data: []byte("left")},
+			{Profile: ffmpeg.P240p30fps16x9, Data: []byte("left")},
+		},
+	}
+	assert.Nil(v.Verify(seg))
+
+	seg.Renditions[1].Data = []byte("right")
+	err = v.Verify(seg)
+	require.IsType(&VerificationFailure{}, err)
+	assert.Contains(err.Error(), ffmpeg.P240p30fps16x9.Name)
+
+	// Every bit differs, which passes if the distance allows it
+	v.maxDistance = 64
+	assert.Nil(v.Verify(seg))
+
+	// Temporary files are removed
+	files, err := ioutil.ReadDir(dir)
+	require.Nil(err)
+	assert.Empty(files)
+}
+
+func TestTranscodeVerifier(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	oldExtractFrame, oldTranscode := extractFrame, localTranscode
+	defer func() { extractFrame, localTranscode = oldExtractFrame, oldTranscode }()
+
+	// The content of the segments stands for whether their frame is white on the left
+	extractFrame = func(in, out string) error {
+		data, err := ioutil.ReadFile(in)
+		if err != nil {
+			return err
+		}
+		f, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return png.Encode(f, halfImage(string(data) == "left"))
+	}
+	// Local renditions have the content of the source and 1000 pixels
+	var transcoded []ffmpeg.VideoProfile
+	var transcodeErr error
+	localTranscode = func(in string, profiles []ffmpeg.VideoProfile, outs []string) ([]int64, error) {
+		transcoded = profiles
+		if transcodeErr != nil {
+			return nil, transcodeErr
+		}
+		data, err := ioutil.ReadFile(in)
+		if err != nil {
+			return nil, err
+		}
+		pixels := make([]int64, len(outs))
+		for i, out := range outs {
+			if err := ioutil.WriteFile(out, data, 0644); err != nil {
+				return nil, err
+			}
+			pixels[i] = 1000
+		}
+		return pixels, nil
+	}
+
+	dir, err := ioutil.TempDir("", "TestTranscodeVerifier")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	v := newTranscodeVerifier(dir, defaultTranscodeDistance)
+	seg := &VerificationSegment{
+		Source: []byte("left"),
+		Renditions: []*VerificationRendition{
+			{Profile: ffmpeg.P144p30fps16x9, Data: []byte("left"), Pixels: 1000},
+			{Profile: ffmpeg.P240p30fps16x9, Data: []byte("left"), Pixels: 1020},
+		},
+	}
+	assert.Nil(v.Verify(seg))
+	assert.Equal([]ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, ffmpeg.P240p30fps16x9}, transcoded)
+
+	// Renditions whose content differs from the local rendition fail
+	seg.Renditions[1].Data = []byte("right")
+	err = v.Verify(seg)
+	require.IsType(&VerificationFailure{}, err)
+	assert.Contains(err.Error(), ffmpeg.P240p30fps16x9.Name)
+
+	// Renditions whose reported pixels differ from the local rendition fail
+	seg.Renditions[1].Data = []byte("left")
+	seg.Renditions[0].Pixels = 500
+	err = v.Verify(seg)
+	require.IsType(&VerificationFailure{}, err)
+	assert.Contains(err.Error(), "500 pixels")
+
+	// Pixels are not checked if they were not reported
+	seg.Renditions[0].Pixels = 0
+	assert.Nil(v.Verify(seg))
+
+	// Local transcoding errors are not failures
+	transcodeErr = errors.New("transcode error")
+	assert.Equal(transcodeErr, v.Verify(seg))
+	transcodeErr = nil
+
+	// Segments are not checked while another one is transcoded
+	v.busy <- struct{}{}
+	assert.Equal(errVerifierBusy, v.Verify(seg))
+	<-v.busy
+	assert.Nil(v.Verify(seg))
+
+	// Temporary files are removed
+	files, err := ioutil.ReadDir(dir)
+	require.Nil(err)
+	assert.Empty(files)
+}
+
+func TestSegmentVerification(t *testing.T) {
+	assert := assert.New(t)
+
+	stub := &stubSegmentVerifier{}
+	v := NewSegmentVerification(stub, 1, 2, time.Hour)
+	seg := &VerificationSegment{Orchestrator: "https://o1:8935"}
+
+	assert.False(v.verify(seg))
+
+	// Errors of the verifier are not penalized
+	stub.err = errors.New("unavailable")
+	assert.False(v.verify(seg))
+	assert.False(v.verify(seg))
+	assert.False(v.Suspended("https://o1:8935"))
+
+	stub.err = &VerificationFailure{Reason: "bad"}
+	assert.True(v.verify(seg))
+	assert.False(v.Suspended("https://o1:8935"))
+	assert.True(v.verify(seg))
+	assert.True(v.Suspended("https://o1:8935"))
+	assert.False(v.Suspended("https://o2:8935"))
+
+	// Suspensions expire
+	v.suspended["https://o1:8935"] = time.Now().Add(-time.Second)
+	assert.False(v.Suspended("https://o1:8935"))
+	// Failures are counted again from zero after a suspension
+	assert.True(v.verify(seg))
+	assert.False(v.Suspended("https://o1:8935"))
+}
+
+func TestSegmentVerification_Sampling(t *testing.T) {
+	assert := assert.New(t)
+	oldRand := verificationRand
+	defer func() { verificationRand = oldRand }()
+	var random float64
+	verificationRand = func() float64 { return random }
+
+	stub := &stubSegmentVerifier{}
+	v := NewSegmentVerification(stub, 0.05, 10, time.Hour)
+	seg := &VerificationSegment{Orchestrator: "https://o1:8935"}
+
+	// Trusted orchestrators are sampled at the base rate
+	assert.Equal(1.0, v.Trust("https://o1:8935"))
+	random = 0.04
+	assert.True(v.Sample("https://o1:8935"))
+	random = 0.06
+	assert.False(v.Sample("https://o1:8935"))
+
+	// Sampling ramps up after failures
+	stub.err = &VerificationFailure{Reason: "bad"}
+	v.verify(seg)
+	assert.Equal(0.5, v.Trust("https://o1:8935"))
+	random = 0.5
+	assert.True(v.Sample("https://o1:8935"))
+	random = 0.6
+	assert.False(v.Sample("https://o1:8935"))
+	v.verify(seg)
+	assert.Equal(0.25, v.Trust("https://o1:8935"))
+	assert.True(v.Sample("https://o1:8935"))
+	assert.False(v.Sample("https://o2:8935"))
+
+	// Errors of the verifier don't change the trust
+	stub.err = errors.New("unavailable")
+	v.verify(seg)
+	assert.Equal(0.25, v.Trust("https://o1:8935"))
+
+	// Trust is recovered by passing verifications
+	stub.err = nil
+	v.verify(seg)
+	assert.InDelta(0.325, v.Trust("https://o1:8935"), 1e-9)
+	for i := 0; i < 100; i++ {
+		v.verify(seg)
+	}
+	assert.Equal(1.0, v.Trust("https://o1:8935"))
+	assert.Empty(v.trust)
+}
+
+func TestSelectOrchestrator_Trust(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { BroadcastVerification = nil }()
+
+	BroadcastVerification = NewSegmentVerification(&stubSegmentVerifier{err: &VerificationFailure{}}, 1, 10, time.Hour)
+	BroadcastVerification.verify(&VerificationSegment{Orchestrator: "https://o2:8935"})
+	BroadcastVerification.verify(&VerificationSegment{Orchestrator: "https://o1:8935"})
+	BroadcastVerification.verify(&VerificationSegment{Orchestrator: "https://o1:8935"})
+
+	sd := &stubDiscovery{}
+	sd.infos = []*net.OrchestratorInfo{
+		{Transcoder: "https://o1:8935"},
+		{Transcoder: "https://o2:8935"},
+		{Transcoder: "https://o3:8935"},
+		{Transcoder: "https://o4:8935"},
+	}
+	n, _ := core.NewLivepeerNode(nil, "", nil)
+	n.OrchestratorPool = sd
+	mid := core.RandomManifestID()
+	sessions, err := selectOrchestrator(n, &streamParameters{mid: mid}, core.NewBasicPlaylistManager(mid, drivers.NewMemoryDriver(nil).NewSession(string(mid))), 4)
+	assert.Nil(err)
+
+	// The most trusted orchestrators are at the end of the list, which sessions are selected from
+	var transcoders []string
+	for _, sess := range sessions {
+		transcoders = append(transcoders, sess.OrchestratorInfo.Transcoder)
+	}
+	assert.Equal([]string{"https://o1:8935", "https://o2:8935", "https://o3:8935", "https://o4:8935"}, transcoders)
+
+	BroadcastVerification.verify(&VerificationSegment{Orchestrator: "https://o4:8935"})
+	BroadcastVerification.verify(&VerificationSegment{Orchestrator: "https://o4:8935"})
+	BroadcastVerification.verify(&VerificationSegment{Orchestrator: "https://o4:8935"})
+	sessions, err = selectOrchestrator(n, &streamParameters{mid: mid}, core.NewBasicPlaylistManager(mid, drivers.NewMemoryDriver(nil).NewSession(string(mid))), 4)
+	assert.Nil(err)
+	transcoders = nil
+	for _, sess := range sessions {
+		transcoders = append(transcoders, sess.OrchestratorInfo.Transcoder)
+	}
+	assert.Equal([]string{"https://o4:8935", "https://o1:8935", "https://o2:8935", "https://o3:8935"}, transcoders)
+}
+
+func TestUsableOrchestrator(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { BroadcastVerification = nil }()
+
+	assert.True(usableOrchestrator(nil, "https://o1:8935"))
+
+	health := core.NewOrchestratorHealth(1, 0, time.Minute)
+	health.Failure("https://o1:8935")
+	assert.False(usableOrchestrator(health, "https://o1:8935"))
+	assert.True(usableOrchestrator(health, "https://o2:8935"))
+
+	BroadcastVerification = NewSegmentVerification(&stubSegmentVerifier{err: &VerificationFailure{}}, 1, 1, time.Hour)
+	BroadcastVerification.verify(&VerificationSegment{Orchestrator: "https://o2:8935"})
+	assert.False(usableOrchestrator(health, "https://o2:8935"))
+	assert.True(usableOrchestrator(health, "https://o3:8935"))
+}
@@ -0,0 +1,391 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
+	"github.com/livepeer/m3u8"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+)
+
+// VODPrefix is the path under which the segments and playlists of VOD jobs are saved
+const VODPrefix = "vod"
+
+// VODJobStatus is the state of a VOD job
+type VODJobStatus string
+
+const (
+	// VODJobSegmenting is a job whose input is being split into segments
+	VODJobSegmenting VODJobStatus = "segmenting"
+	// VODJobTranscoding is a job whose segments are being transcoded
+	VODJobTranscoding VODJobStatus = "transcoding"
+	// VODJobComplete is a job whose VOD asset has been written to the node's storage
+	VODJobComplete VODJobStatus = "complete"
+	// VODJobFailed is a job that stopped because of an error
+	VODJobFailed VODJobStatus = "failed"
+)
+
+var errVODStorage = errors.New("VOD jobs require object storage")
+var errVODInput = errors.New("VOD jobs require an http or https input URL or an uploaded file")
+
+// vodSegmenter splits the input of a VOD job into MPEG-TS segments in dir and
+// returns the playlist of the segments. Replaced in tests
+var vodSegmenter = segmentVOD
+
+// processVODSegment sends the segments of VOD jobs through the transcoding path. Replaced in tests
+var processVODSegment = processSegment
+
+// VODJobInfo describes a VOD job and, once complete, the playlists of its VOD asset
+type VODJobInfo struct {
+	ManifestID core.ManifestID `json:"manifestID"`
+	Status     VODJobStatus    `json:"status"`
+	Error      string          `json:"error,omitempty"`
+	// Number of segments that the input was split into
+	Segments int `json:"segments"`
+	// Number of segments that went through the transcoding path
+	Processed int `json:"processed"`
+	// URIs of the VOD playlists by format
+	Playlists map[string]string `json:"playlists,omitempty"`
+	Created   time.Time         `json:"created"`
+}
+
+type vodJob struct {
+	mu   sync.Mutex
+	info VODJobInfo
+}
+
+func (j *vodJob) Info() VODJobInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.info
+}
+
+func (j *vodJob) update(f func(info *VODJobInfo)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f(&j.info)
+}
+
+type vodJobRegistry struct {
+	mu   sync.RWMutex
+	jobs map[core.ManifestID]*vodJob
+}
+
+func newVODJobRegistry() *vodJobRegistry {
+	return &vodJobRegistry{jobs: make(map[core.ManifestID]*vodJob)}
+}
+
+func (r *vodJobRegistry) add(mid core.ManifestID) *vodJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job := &vodJob{info: VODJobInfo{ManifestID: mid, Status: VODJobSegmenting, Created: time.Now()}}
+	r.jobs[mid] = job
+	return job
+}
+
+func (r *vodJobRegistry) get(mid core.ManifestID) *vodJob {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.jobs[mid]
+}
+
+// remove deletes the jobs matched by match that are no longer running and returns
+// the number of jobs deleted
+func (r *vodJobRegistry) remove(match func(core.ManifestID) bool) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	removed := 0
+	for mid, job := range r.jobs {
+		if !match(mid) || !job.Info().done() {
+			continue
+		}
+		delete(r.jobs, mid)
+		removed++
+	}
+	return removed
+}
+
+// done returns whether the job is no longer running
+func (info VODJobInfo) done() bool {
+	return info.Status == VODJobComplete || info.Status == VODJobFailed
+}
+
+type vodJobRequest struct {
+	// http or https URL of the input, e.g. a presigned object storage URL
+	URL        string               `json:"url"`
+	ManifestID string               `json:"manifestID"`
+	Presets    []string             `json:"presets"`
+	Profiles   []common.JSONProfile `json:"profiles"`
+	// Formats of the VOD asset, HLS if empty
+	Formats []string `json:"formats"`
+}
+
+// vodStoragePath returns the path under which the segments and playlists of a VOD job are saved
+func vodStoragePath(mid core.ManifestID) string {
+	return path.Join(VODPrefix, string(mid))
+}
+
+// HandleVOD submits VOD jobs with a POST to /vodjobs and returns their status with a GET to /vodjobs/<manifestID>
+func (s *LivepeerServer) HandleVOD(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		mid := core.ManifestID(strings.TrimPrefix(r.URL.Path, "/vodjobs/"))
+		job := s.vodJobs.get(mid)
+		if job == nil {
+			http.Error(w, "unknown VOD job", http.StatusNotFound)
+			return
+		}
+		respondVODJob(w, http.StatusOK, job.Info())
+	case http.MethodPost:
+		s.submitVODJob(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// submitVODJob accepts either a JSON job request with the URL of the input, or the input
+// file itself with the options of the job in the query string
+func (s *LivepeerServer) submitVODJob(w http.ResponseWriter, r *http.Request) {
+	if _, ok := drivers.NodeStorage.(*drivers.MemoryOS); ok || drivers.NodeStorage == nil {
+		// The VOD asset has to outlive the stream
+		http.Error(w, errVODStorage.Error(), http.StatusNotImplemented)
+		return
+	}
+
+	var req vodJobRequest
+	var input string
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid VOD job: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := validateSourceURL(req.URL, "http", "https"); err == errSourceScheme {
+			http.Error(w, errVODInput.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		input = req.URL
+	} else {
+		q := r.URL.Query()
+		req.ManifestID = q.Get("manifestID")
+		if presets := q.Get("presets"); presets != "" {
+			req.Presets = strings.Split(presets, ",")
+		}
+		if formats := q.Get("formats"); formats != "" {
+			req.Formats = strings.Split(formats, ",")
+		}
+	}
+
+	formats := []string{core.RecordingFormatHLS}
+	if len(req.Formats) > 0 {
+		var err error
+		if formats, err = core.ParseRecordingFormats(strings.Join(req.Formats, ",")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	var profiles []ffmpeg.VideoProfile
+	var encoders common.ProfileEncoders
+	if len(req.Presets) > 0 {
+		profiles = parsePresets(req.Presets)
+	}
+	if len(req.Profiles) > 0 {
+		custom, customEncoders, err := common.JSONProfilesToFFmpegProfiles(req.Profiles)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		profiles, encoders = append(profiles, custom...), customEncoders
+	}
+
+	if input == "" {
+		// Uploaded files are saved for the segmenter and removed once the job ends
+		f, err := ioutil.TempFile(s.LivepeerNode.WorkDir, "vodinput")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, err = io.Copy(f, r.Body)
+		f.Close()
+		if err != nil {
+			os.Remove(f.Name())
+			http.Error(w, fmt.Sprintf("error reading VOD input: %v", err), http.StatusBadRequest)
+			return
+		}
+		input = f.Name()
+	}
+
+	// VOD jobs go through the same authentication and stream setup as live streams
+	appData := (createRTMPStreamIDHandler(s))(streamURL(r, req.ManifestID))
+	if appData == nil {
+		removeVODInput(input, req.URL)
+		http.Error(w, "Could not create stream ID", http.StatusInternalServerError)
+		return
+	}
+	st := stream.NewBasicRTMPVideoStream(appData)
+	params := streamParams(st)
+	params.source = core.SessionSourceVOD
+	params.vodFormats = formats
+	if len(profiles) > 0 {
+		params.profiles, params.encoders = profiles, encoders
+	}
+	cxn, err := s.registerConnection(st)
+	setQuotaHeaders(w, r)
+	if err != nil {
+		removeVODInput(input, req.URL)
+		http.Error(w, err.Error(), streamErrorCode(err))
+		return
+	}
+
+	job := s.vodJobs.add(cxn.mid)
+	glog.Infof("Submitted VOD job manifestID=%s url=%s formats=%v", cxn.mid, req.URL, formats)
+	go func() {
+		defer removeVODInput(input, req.URL)
+		s.runVODJob(job, cxn, input)
+	}()
+
+	respondVODJob(w, http.StatusCreated, job.Info())
+}
+
+func respondVODJob(w http.ResponseWriter, code int, info VODJobInfo) {
+	data, err := json.Marshal(info)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+// removeVODInput removes the uploaded input of a VOD job. Inputs given by URL are left alone
+func removeVODInput(input, inputURL string) {
+	if inputURL == "" {
+		os.Remove(input)
+	}
+}
+
+// runVODJob segments the input of a job, sends its segments through the transcoding path of
+// the broadcaster and writes the VOD playlists of the job when all of them are processed
+func (s *LivepeerServer) runVODJob(job *vodJob, cxn *rtmpConnection, input string) {
+	fail := func(err error) {
+		glog.Errorf("VOD job failed manifestID=%s err=%v", cxn.mid, err)
+		removeRTMPStream(s, cxn.mid)
+		job.update(func(info *VODJobInfo) {
+			info.Status = VODJobFailed
+			info.Error = err.Error()
+		})
+	}
+
+	dir, err := ioutil.TempDir(s.LivepeerNode.WorkDir, "vod")
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	pl, err := vodSegmenter(input, dir)
+	if err != nil {
+		fail(fmt.Errorf("error segmenting input: %v", err))
+		return
+	}
+	var segs []*m3u8.MediaSegment
+	for _, seg := range pl.Segments {
+		if seg != nil {
+			segs = append(segs, seg)
+		}
+	}
+	if len(segs) == 0 {
+		fail(errors.New("input has no segments"))
+		return
+	}
+	job.update(func(info *VODJobInfo) {
+		info.Status = VODJobTranscoding
+		info.Segments = len(segs)
+	})
+
+	for i, seg := range segs {
+		data, err := ioutil.ReadFile(filepath.Join(dir, seg.URI))
+		if err != nil {
+			fail(err)
+			return
+		}
+		s.LivepeerNode.Sessions.Touch(cxn.mid)
+		// Segments that can't be transcoded, e.g. because no orchestrators are
+		// available, fail the job rather than leave renditions out of the asset
+		err = processVODSegment(cxn, &stream.HLSSegment{
+			Data:     data,
+			Name:     strconv.Itoa(i) + ".ts",
+			SeqNo:    uint64(i),
+			Duration: seg.Duration,
+		})
+		if err != nil {
+			fail(err)
+			return
+		}
+		job.update(func(info *VODJobInfo) { info.Processed++ })
+	}
+
+	// Ending the stream writes the VOD playlists
+	removeRTMPStream(s, cxn.mid)
+	playlists := make(map[string]string)
+	for _, f := range cxn.params.vodFormats {
+		name := core.RecordingHLSMaster
+		if f == core.RecordingFormatDASH {
+			name = core.RecordingDASHManifest
+		}
+		if uri := cxn.recording.URI(name); uri != "" {
+			playlists[f] = uri
+		}
+	}
+	job.update(func(info *VODJobInfo) {
+		if len(playlists) < len(cxn.params.vodFormats) {
+			info.Status = VODJobFailed
+			info.Error = "error writing playlists"
+			return
+		}
+		info.Status = VODJobComplete
+		info.Playlists = playlists
+	})
+	glog.Infof("Completed VOD job manifestID=%s segments=%d playlists=%v", cxn.mid, len(segs), playlists)
+}
+
+// segmentVOD segments the input with the same segment length as live streams
+func segmentVOD(input, dir string) (*m3u8.MediaPlaylist, error) {
+	out := filepath.Join(dir, "source.m3u8")
+	segLen := strconv.FormatFloat(SegLen.Seconds(), 'f', -1, 64)
+	if err := ffmpeg.RTMPToHLS(input, out, filepath.Join(dir, "source_%d.ts"), segLen, 0); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(out)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p, listType, err := m3u8.DecodeFrom(f, true)
+	if err != nil {
+		return nil, err
+	}
+	if listType != m3u8.MEDIA {
+		return nil, errors.New("unexpected master playlist")
+	}
+	return p.(*m3u8.MediaPlaylist), nil
+}
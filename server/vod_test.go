@@ -0,0 +1,195 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/lpms/stream"
+	"github.com/livepeer/m3u8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubVODStorage keeps the data saved to it after the sessions ended
+type stubVODStorage struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (d *stubVODStorage) NewSession(p string) drivers.OSSession {
+	return &stubVODSession{storage: d, path: p}
+}
+
+func (d *stubVODStorage) get(name string) []byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.data[name]
+}
+
+type stubVODSession struct {
+	storage *stubVODStorage
+	path    string
+}
+
+func (s *stubVODSession) SaveData(name string, data []byte) (string, error) {
+	key := path.Join(s.path, name)
+	s.storage.mu.Lock()
+	defer s.storage.mu.Unlock()
+	s.storage.data[key] = data
+	return "https://os/" + key, nil
+}
+func (s *stubVODSession) EndSession()          {}
+func (s *stubVODSession) GetInfo() *net.OSInfo { return nil }
+func (s *stubVODSession) IsExternal() bool     { return true }
+
+func waitVODJob(s *LivepeerServer, mid core.ManifestID) VODJobInfo {
+	var info VODJobInfo
+	for i := 0; i < 100; i++ {
+		info = s.vodJobs.get(mid).Info()
+		if info.Status == VODJobComplete || info.Status == VODJobFailed {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return info
+}
+
+func TestHandleVOD(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := setupServer()
+
+	oldStorage, oldSegmenter, oldProcess := drivers.NodeStorage, vodSegmenter, processVODSegment
+	defer func() { drivers.NodeStorage, vodSegmenter, processVODSegment = oldStorage, oldSegmenter, oldProcess }()
+	oldWebhook := AuthWebhookURL
+	defer func() { AuthWebhookURL = oldWebhook }()
+	AuthWebhookURL = ""
+
+	// Uploaded files are saved to the work directory
+	workDir, err := ioutil.TempDir("", "TestHandleVOD")
+	require.Nil(err)
+	defer os.RemoveAll(workDir)
+	oldWorkDir := s.LivepeerNode.WorkDir
+	s.LivepeerNode.WorkDir = workDir
+	defer func() { s.LivepeerNode.WorkDir = oldWorkDir }()
+
+	submit := func(url, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", url, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		s.HandleVOD(w, req)
+		return w
+	}
+
+	// The VOD asset can't be kept in memory
+	w := submit("/vodjobs", "application/json", `{"url":"https://example.com/movie.mp4"}`)
+	assert.Equal(http.StatusNotImplemented, w.Code)
+
+	storage := &stubVODStorage{data: make(map[string][]byte)}
+	drivers.NodeStorage = storage
+
+	// Local files can't be read on behalf of the caller
+	w = submit("/vodjobs", "application/json", `{"url":"file:///etc/passwd"}`)
+	assert.Equal(http.StatusBadRequest, w.Code)
+	w = submit("/vodjobs", "application/json", `{"url":"https://example.com/movie.mp4","formats":["mp4"]}`)
+	assert.Equal(http.StatusBadRequest, w.Code)
+
+	// Uploaded files are segmented and every segment is recorded. There are no
+	// orchestrators so the segments are only recorded
+	processVODSegment = func(cxn *rtmpConnection, seg *stream.HLSSegment) error {
+		if err := processSegment(cxn, seg); err != errNoOrchs {
+			return err
+		}
+		return nil
+	}
+	var input string
+	vodSegmenter = func(in, dir string) (*m3u8.MediaPlaylist, error) {
+		data, err := ioutil.ReadFile(in)
+		if err != nil {
+			return nil, err
+		}
+		input = in
+		assert.Equal("movie", string(data))
+		pl, _ := m3u8.NewMediaPlaylist(0, 2)
+		for _, name := range []string{"source_0.ts", "source_1.ts"} {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+				return nil, err
+			}
+			pl.Append(name, 2, "")
+		}
+		return pl, nil
+	}
+	w = submit("/vodjobs?manifestID=vodjob&formats=hls,dash", "video/mp4", "movie")
+	require.Equal(http.StatusCreated, w.Code)
+	var info VODJobInfo
+	require.Nil(json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(core.ManifestID("vodjob"), info.ManifestID)
+
+	info = waitVODJob(s, "vodjob")
+	require.Equal(VODJobComplete, info.Status, info.Error)
+	assert.Equal(2, info.Segments)
+	assert.Equal(2, info.Processed)
+	assert.Equal(map[string]string{
+		core.RecordingFormatHLS:  "https://os/vod/vodjob/index.m3u8",
+		core.RecordingFormatDASH: "https://os/vod/vodjob/index.mpd",
+	}, info.Playlists)
+	assert.Equal([]byte("source_1.ts"), storage.get("vod/vodjob/source/1.ts"))
+	assert.Contains(string(storage.get("vod/vodjob/source.m3u8")), "https://os/vod/vodjob/source/1.ts")
+	// The job ended its stream and removed the uploaded file
+	_, ok := s.LivepeerNode.Sessions.Get("vodjob")
+	assert.False(ok)
+	_, err = os.Stat(input)
+	assert.True(os.IsNotExist(err))
+
+	req := httptest.NewRequest("GET", "/vodjobs/vodjob", nil)
+	w = httptest.NewRecorder()
+	s.HandleVOD(w, req)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), `"status":"complete"`)
+
+	req = httptest.NewRequest("GET", "/vodjobs/unknown", nil)
+	w = httptest.NewRecorder()
+	s.HandleVOD(w, req)
+	assert.Equal(http.StatusNotFound, w.Code)
+
+	// Inputs that can't be segmented fail the job
+	vodSegmenter = func(in, dir string) (*m3u8.MediaPlaylist, error) {
+		return nil, errors.New("invalid input")
+	}
+	w = submit("/vodjobs", "application/json", `{"url":"https://example.com/movie.mp4","manifestID":"badjob"}`)
+	require.Equal(http.StatusCreated, w.Code)
+	info = waitVODJob(s, "badjob")
+	assert.Equal(VODJobFailed, info.Status)
+	assert.Equal("error segmenting input: invalid input", info.Error)
+
+	// Segments that can't be transcoded fail the job
+	processVODSegment = processSegment
+	vodSegmenter = func(in, dir string) (*m3u8.MediaPlaylist, error) {
+		pl, _ := m3u8.NewMediaPlaylist(0, 1)
+		if err := ioutil.WriteFile(filepath.Join(dir, "source_0.ts"), []byte("source_0.ts"), 0644); err != nil {
+			return nil, err
+		}
+		pl.Append("source_0.ts", 2, "")
+		return pl, nil
+	}
+	w = submit("/vodjobs", "application/json", `{"url":"https://example.com/movie.mp4","manifestID":"noorchs"}`)
+	require.Equal(http.StatusCreated, w.Code)
+	info = waitVODJob(s, "noorchs")
+	assert.Equal(VODJobFailed, info.Status)
+	assert.Equal(errNoOrchs.Error(), info.Error)
+	assert.Equal(0, info.Processed)
+	assert.Empty(info.Playlists)
+}
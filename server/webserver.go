@@ -16,6 +16,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/clog"
 	lpcommon "github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/core"
 	"github.com/livepeer/go-livepeer/eth"
@@ -57,11 +58,15 @@ func (s *LivepeerServer) setServiceURI(serviceURI string) error {
 // blocks until exit
 func (s *LivepeerServer) StartCliWebserver(bindAddr string) {
 	mux := s.cliWebServerHandlers(bindAddr)
-	srv := &http.Server{
-		Addr:    bindAddr,
-		Handler: mux,
-	}
+	srv := newHTTPServer(bindAddr, ManagementHTTPLimits.Handler(CliAuth.Handler(mux)), &ManagementHTTPLimits)
 
+	if CliTLSCert != "" {
+		glog.Info("CLI server listening with TLS on ", bindAddr)
+		if err := srv.ListenAndServeTLS(CliTLSCert, CliTLSKey); err != nil {
+			glog.Error("CLI server error: ", err)
+		}
+		return
+	}
 	glog.Info("CLI server listening on ", bindAddr)
 	srv.ListenAndServe()
 }
@@ -69,28 +74,30 @@ func (s *LivepeerServer) StartCliWebserver(bindAddr string) {
 func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 	mux := http.NewServeMux()
 
+	s.health.RegisterHandlers(mux, true)
+
 	//Set the broadcast config for creating onchain jobs.
 	mux.HandleFunc("/setBroadcastConfig", func(w http.ResponseWriter, r *http.Request) {
 		if err := r.ParseForm(); err != nil {
-			glog.Errorf("Parse Form Error: %v", err)
+			respondWith400(w, fmt.Sprintf("parse form error: %v", err))
 			return
 		}
 
 		pricePerUnit := r.FormValue("maxPricePerUnit")
 		pr, err := strconv.ParseInt(pricePerUnit, 10, 64)
 		if err != nil {
-			glog.Errorf("Error converting string to int64: %v\n", err)
+			respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, fmt.Sprintf("invalid maxPricePerUnit: %v", err))
 			return
 		}
 
 		pixelsPerUnit := r.FormValue("pixelsPerUnit")
 		px, err := strconv.ParseInt(pixelsPerUnit, 10, 64)
 		if err != nil {
-			glog.Errorf("Error converting string to int64: %v\n", err)
+			respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, fmt.Sprintf("invalid pixelsPerUnit: %v", err))
 			return
 		}
 		if px <= 0 {
-			glog.Errorf("pixels per unit must be greater than 0, provided %d\n", px)
+			respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, fmt.Sprintf("pixels per unit must be greater than 0, provided %d", px))
 			return
 		}
 
@@ -100,30 +107,130 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 		}
 
 		transcodingOptions := r.FormValue("transcodingOptions")
-		if transcodingOptions == "" {
-			glog.Errorf("Need to provide transcoding options")
+		customProfiles := r.FormValue("profiles")
+		if transcodingOptions == "" && customProfiles == "" {
+			respondWithCliError(w, http.StatusBadRequest, CliErrMissingParam, "Need to provide transcoding options")
 			return
 		}
 
 		profiles := []ffmpeg.VideoProfile{}
-		for _, pName := range strings.Split(transcodingOptions, ",") {
-			p, ok := ffmpeg.VideoProfileLookup[pName]
-			if ok {
-				profiles = append(profiles, p)
+		var encoders lpcommon.ProfileEncoders
+		if customProfiles != "" {
+			// Custom profiles are defined as JSON
+			profiles, encoders, err = lpcommon.ParseProfiles([]byte(customProfiles))
+			if err != nil {
+				respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, fmt.Sprintf("Invalid profiles: %v", err))
+				return
+			}
+		} else {
+			for _, pName := range strings.Split(transcodingOptions, ",") {
+				p, ok := ffmpeg.VideoProfileLookup[pName]
+				if ok {
+					profiles = append(profiles, p)
+				}
 			}
 		}
 		if len(profiles) == 0 {
-			glog.Errorf("Invalid transcoding options: %v", transcodingOptions)
+			respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, fmt.Sprintf("Invalid transcoding options: %v", transcodingOptions))
 			return
 		}
 		BroadcastCfg.SetMaxPrice(price)
-		BroadcastJobVideoProfiles = profiles
+		BroadcastJobVideoProfiles, BroadcastJobEncoders = profiles, encoders
 		if price != nil {
 			glog.Infof("Maximum transcoding price: %d per %q pixels\n", pr, px)
 		} else {
 			glog.Info("Maximum transcoding price per pixel not set, broadcaster is currently set to accept ANY price.\n")
 		}
 		glog.Infof("Transcode Job Type: %v", BroadcastJobVideoProfiles)
+		respondWithStatus(w, nil, "")
+	})
+
+	// Settings that take effect immediately and are persisted across restarts
+	mux.Handle("/setMaxPrice", mustHaveFormParams(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := setMaxPrice(s.LivepeerNode, r.FormValue("maxPricePerUnit"), r.FormValue("pixelsPerUnit")); err != nil {
+			respondWith400(w, err.Error())
+			return
+		}
+		respondRuntimeConfig(w, "maxPrice", BroadcastCfg.MaxPrice())
+	}), "maxPricePerUnit", "pixelsPerUnit"))
+
+	mux.HandleFunc("/getMaxPrice", func(w http.ResponseWriter, r *http.Request) {
+		respondRuntimeConfig(w, "maxPrice", BroadcastCfg.MaxPrice())
+	})
+
+	mux.Handle("/setPricePerUnit", mustHaveFormParams(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := s.setPricePerUnit(r.FormValue("pricePerUnit"), r.FormValue("pixelsPerUnit")); err != nil {
+			respondWith400(w, err.Error())
+			return
+		}
+		respondRuntimeConfig(w, "pricePerPixel", s.LivepeerNode.GetBasePrice())
+	}), "pricePerUnit", "pixelsPerUnit"))
+
+	mux.HandleFunc("/getPricePerUnit", func(w http.ResponseWriter, r *http.Request) {
+		respondRuntimeConfig(w, "pricePerPixel", s.LivepeerNode.GetBasePrice())
+	})
+
+	mux.Handle("/setMaxSessions", mustHaveFormParams(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := setMaxSessions(s.LivepeerNode, r.FormValue("maxSessions")); err != nil {
+			respondWith400(w, err.Error())
+			return
+		}
+		respondRuntimeConfig(w, "maxSessions", s.LivepeerNode.MaxSessions())
+	}), "maxSessions"))
+
+	mux.HandleFunc("/getMaxSessions", func(w http.ResponseWriter, r *http.Request) {
+		respondRuntimeConfig(w, "maxSessions", s.LivepeerNode.MaxSessions())
+	})
+
+	mux.HandleFunc("/setSelectionStrategy", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondWithError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := setSelectionStrategy(s.LivepeerNode, r.FormValue("strategy")); err != nil {
+			respondWith400(w, err.Error())
+			return
+		}
+		respondRuntimeConfig(w, "strategy", SelectionStrategy())
+	})
+
+	mux.HandleFunc("/getSelectionStrategy", func(w http.ResponseWriter, r *http.Request) {
+		respondRuntimeConfig(w, "strategy", SelectionStrategy())
+	})
+
+	// Download the keys, database and configuration of the node to migrate it to another machine
+	mux.HandleFunc("/exportBundle", s.exportBundle)
+
+	// Certificate pins of orchestrators
+	mux.HandleFunc("/orchCertPins", func(w http.ResponseWriter, r *http.Request) {
+		pins := []OrchCertPin{}
+		if OrchCertPins != nil {
+			pins = OrchCertPins.Pins()
+		}
+		respondWithJSON(w, pins)
+	})
+
+	mux.Handle("/resetOrchCertPin", mustHaveFormParams(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if OrchCertPins == nil {
+			respondWithCliError(w, http.StatusBadRequest, CliErrNotSupported, "orchestrator certificates are not pinned")
+			return
+		}
+		if err := OrchCertPins.Reset(r.FormValue("addr")); err != nil {
+			respondWith400(w, err.Error())
+			return
+		}
+		respondWithStatus(w, nil, "")
+	}), "addr"))
+
+	// Recommend a ladder and maximum price for a monthly budget, and apply them if requested
+	mux.HandleFunc("/planBudget", func(w http.ResponseWriter, r *http.Request) {
+		plan, err := planBudgetRequest(s.LivepeerNode, r)
+		if err != nil {
+			glog.Error("Error planning budget: ", err)
+			respondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		respondWithJSON(w, plan)
 	})
 
 	mux.HandleFunc("/getBroadcastConfig", func(w http.ResponseWriter, r *http.Request) {
@@ -139,39 +246,101 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 			strings.Join(pNames, ","),
 		}
 
-		data, err := json.Marshal(config)
-		if err != nil {
-			glog.Errorf("Error marshalling broadcaster config: %v", err)
+		respondWithJSON(w, config)
+	})
+
+	// Change the transcoding profiles of a running stream
+	mux.HandleFunc("/setStreamProfiles", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			glog.Errorf("Parse Form Error: %v", err)
+			respondWithError(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		w.Write(data)
+		mid := core.ManifestID(r.FormValue("manifestID"))
+		if mid == "" {
+			respondWithCliError(w, http.StatusBadRequest, CliErrMissingParam, "Need to provide a manifestID")
+			return
+		}
+
+		var profiles []ffmpeg.VideoProfile
+		var encoders lpcommon.ProfileEncoders
+		transcodingOptions := r.FormValue("transcodingOptions")
+		if customProfiles := r.FormValue("profiles"); customProfiles != "" {
+			// Custom profiles are defined as JSON
+			var err error
+			profiles, encoders, err = lpcommon.ParseProfiles([]byte(customProfiles))
+			if err != nil {
+				respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, err.Error())
+				return
+			}
+		} else {
+			profiles = parsePresets(strings.Split(transcodingOptions, ","))
+		}
+		if len(profiles) == 0 {
+			respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, fmt.Sprintf("Invalid transcoding options: %v", transcodingOptions))
+			return
+		}
+
+		if err := s.SetStreamProfiles(mid, profiles, encoders); err != nil {
+			glog.Errorf("Error setting profiles for manifestID=%v: %v", mid, err)
+			status := http.StatusInternalServerError
+			if err == errUnknownStream {
+				status = http.StatusNotFound
+			}
+			respondWithError(w, err.Error(), status)
+			return
+		}
+		respondWithStatus(w, nil, "")
 	})
 
+	mux.HandleFunc("/endNamespaceStreams", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			glog.Errorf("Parse Form Error: %v", err)
+			respondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		namespace := r.FormValue("namespace")
+		if err := core.ValidateNamespace(namespace); err != nil {
+			respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, err.Error())
+			return
+		}
+
+		mids := s.EndNamespaceStreams(namespace)
+		glog.Infof("Ended streams in namespace=%v count=%v", namespace, len(mids))
+
+		respondWithJSON(w, mids)
+	})
+
+	mux.Handle("/endStream", endStreamHandler(s))
+
+	// Push the statistics of the node and of its streams to websocket clients
+	mux.Handle("/liveStats", liveStatsHandler(s))
+
+	// Push the events of the protocol contracts to websocket clients
+	mux.Handle("/protocolEvents", protocolEventsHandler())
+
 	mux.HandleFunc("/getAvailableTranscodingOptions", func(w http.ResponseWriter, r *http.Request) {
 		transcodingOptions := make([]string, 0, len(ffmpeg.VideoProfileLookup))
 		for opt := range ffmpeg.VideoProfileLookup {
 			transcodingOptions = append(transcodingOptions, opt)
 		}
 
-		data, err := json.Marshal(transcodingOptions)
-		if err != nil {
-			glog.Errorf("Error marshalling all transcoding options: %v", err)
-			return
-		}
-
-		w.Write(data)
+		respondWithJSON(w, transcodingOptions)
 	})
 
 	mux.HandleFunc("/currentRound", func(w http.ResponseWriter, r *http.Request) {
 		if s.LivepeerNode.Eth != nil {
 			currentRound, err := s.LivepeerNode.Eth.CurrentRound()
 			if err != nil {
-				glog.Error(err)
+				respondWith500(w, err.Error())
 				return
 			}
 
-			w.Write([]byte(currentRound.String()))
+			respondWithValue(w, "round", currentRound, currentRound.String())
+		} else {
+			respondMissingEth(w)
 		}
 	})
 
@@ -179,15 +348,18 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 		if s.LivepeerNode.Eth != nil {
 			tx, err := s.LivepeerNode.Eth.InitializeRound()
 			if err != nil {
-				glog.Error(err)
+				respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
 				return
 			}
 
 			err = s.LivepeerNode.Eth.CheckTx(tx)
 			if err != nil {
-				glog.Error(err)
+				respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
 				return
 			}
+			respondWithStatus(w, tx, "")
+		} else {
+			respondMissingEth(w)
 		}
 	})
 
@@ -195,10 +367,12 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 		if s.LivepeerNode.Eth != nil {
 			initialized, err := s.LivepeerNode.Eth.CurrentRoundInitialized()
 			if err != nil {
-				glog.Error(err)
+				respondWith500(w, err.Error())
 				return
 			}
-			w.Write([]byte(fmt.Sprintf("%v", initialized)))
+			respondWithValue(w, "initialized", initialized, fmt.Sprintf("%v", initialized))
+		} else {
+			respondMissingEth(w)
 		}
 	})
 
@@ -206,54 +380,54 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 	mux.HandleFunc("/activateOrchestrator", func(w http.ResponseWriter, r *http.Request) {
 		t, err := s.LivepeerNode.Eth.GetTranscoder(s.LivepeerNode.Eth.Account().Address)
 		if err != nil {
-			glog.Error(err)
+			respondWith500(w, err.Error())
 			return
 		}
 
 		if t.Status == "Registered" {
-			glog.Error("Orchestrator is already registered")
+			respondWith400(w, "Orchestrator is already registered")
 			return
 		}
 
 		if err := r.ParseForm(); err != nil {
-			glog.Errorf("Parse Form Error: %v", err)
+			respondWith400(w, fmt.Sprintf("parse form error: %v", err))
 			return
 		}
 
 		blockRewardCutStr := r.FormValue("blockRewardCut")
 		if blockRewardCutStr == "" {
-			glog.Errorf("Need to provide block reward cut")
+			respondWithCliError(w, http.StatusBadRequest, CliErrMissingParam, "Need to provide block reward cut")
 			return
 		}
 		blockRewardCut, err := strconv.ParseFloat(blockRewardCutStr, 64)
 		if err != nil {
-			glog.Error(err)
+			respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, err.Error())
 			return
 		}
 
 		feeShareStr := r.FormValue("feeShare")
 		if feeShareStr == "" {
-			glog.Errorf("Need to provide fee share")
+			respondWithCliError(w, http.StatusBadRequest, CliErrMissingParam, "Need to provide fee share")
 			return
 		}
 		feeShare, err := strconv.ParseFloat(feeShareStr, 64)
 		if err != nil {
-			glog.Error(err)
+			respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, err.Error())
 			return
 		}
 
 		if err := s.setOrchestratorPriceInfo(r.FormValue("pricePerUnit"), r.FormValue("pixelsPerUnit")); err != nil {
-			glog.Error(err)
+			respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, err.Error())
 			return
 		}
 
 		serviceURI := r.FormValue("serviceURI")
 		if serviceURI == "" {
-			glog.Errorf("Need to provide a service URI")
+			respondWithCliError(w, http.StatusBadRequest, CliErrMissingParam, "Need to provide a service URI")
 			return
 		}
 		if _, err := url.ParseRequestURI(serviceURI); err != nil {
-			glog.Error(err)
+			respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, err.Error())
 			return
 		}
 
@@ -261,7 +435,7 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 		if unbondingLockIDStr != "" {
 			unbondingLockID, err := lpcommon.ParseBigInt(unbondingLockIDStr)
 			if err != nil {
-				glog.Error(err)
+				respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, err.Error())
 				return
 			}
 
@@ -269,13 +443,13 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 
 			tx, err := s.LivepeerNode.Eth.RebondFromUnbonded(s.LivepeerNode.Eth.Account().Address, unbondingLockID)
 			if err != nil {
-				glog.Error(err)
+				respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
 				return
 			}
 
 			err = s.LivepeerNode.Eth.CheckTx(tx)
 			if err != nil {
-				glog.Error(err)
+				respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
 				return
 			}
 		}
@@ -284,7 +458,7 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 		if amountStr != "" {
 			amount, err := lpcommon.ParseBigInt(amountStr)
 			if err != nil {
-				glog.Error(err)
+				respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, err.Error())
 				return
 			}
 
@@ -293,13 +467,13 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 
 				tx, err := s.LivepeerNode.Eth.Bond(amount, s.LivepeerNode.Eth.Account().Address)
 				if err != nil {
-					glog.Error(err)
+					respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
 					return
 				}
 
 				err = s.LivepeerNode.Eth.CheckTx(tx)
 				if err != nil {
-					glog.Error(err)
+					respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
 					return
 				}
 			}
@@ -309,152 +483,160 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 
 		tx, err := s.LivepeerNode.Eth.Transcoder(eth.FromPerc(blockRewardCut), eth.FromPerc(feeShare), big.NewInt(0))
 		if err != nil {
-			glog.Error(err)
+			respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
 			return
 		}
 
 		err = s.LivepeerNode.Eth.CheckTx(tx)
 		if err != nil {
-			glog.Error(err)
+			respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
 			return
 		}
 
 		currentServiceURI, err := s.LivepeerNode.Eth.GetServiceURI(s.LivepeerNode.Eth.Account().Address)
 		if err != nil {
-			glog.Error(err)
+			respondWith500(w, err.Error())
 			return
 		}
 
 		if currentServiceURI != serviceURI {
 			if err := s.setServiceURI(serviceURI); err != nil {
+				respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
 				return
 			}
 		}
+		respondWithStatus(w, tx, "")
 	})
 
 	//Set transcoder config on-chain.
 	mux.HandleFunc("/setOrchestratorConfig", func(w http.ResponseWriter, r *http.Request) {
 		if err := r.ParseForm(); err != nil {
-			glog.Errorf("Parse Form Error: %v", err)
+			respondWith400(w, fmt.Sprintf("parse form error: %v", err))
 			return
 		}
 
 		blockRewardCutStr := r.FormValue("blockRewardCut")
 		if blockRewardCutStr == "" {
-			glog.Errorf("Need to provide block reward cut")
+			respondWithCliError(w, http.StatusBadRequest, CliErrMissingParam, "Need to provide block reward cut")
 			return
 		}
 		blockRewardCut, err := strconv.ParseFloat(blockRewardCutStr, 64)
 		if err != nil {
-			glog.Errorf("Cannot convert block reward cut: %v", err)
+			respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, fmt.Sprintf("Cannot convert block reward cut: %v", err))
 			return
 		}
 
 		feeShareStr := r.FormValue("feeShare")
 		if feeShareStr == "" {
-			glog.Errorf("Need to provide fee share")
+			respondWithCliError(w, http.StatusBadRequest, CliErrMissingParam, "Need to provide fee share")
 			return
 		}
 		feeShare, err := strconv.ParseFloat(feeShareStr, 64)
 		if err != nil {
-			glog.Errorf("Cannot convert fee share: %v", err)
+			respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, fmt.Sprintf("Cannot convert fee share: %v", err))
 			return
 		}
 
 		if err := s.setOrchestratorPriceInfo(r.FormValue("pricePerUnit"), r.FormValue("pixelsPerUnit")); err != nil {
-			glog.Error(err)
+			respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, err.Error())
 			return
 		}
 
 		serviceURI := r.FormValue("serviceURI")
 		if _, err := url.ParseRequestURI(serviceURI); err != nil {
-			glog.Error(err)
+			respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, err.Error())
 			return
 		}
 
 		t, err := s.LivepeerNode.Eth.GetTranscoder(s.LivepeerNode.Eth.Account().Address)
 		if err != nil {
-			glog.Error(err)
+			respondWith500(w, err.Error())
 			return
 		}
 
+		var tx *types.Transaction
 		if t.PendingRewardCut.Cmp(eth.FromPerc(blockRewardCut)) != 0 || t.PendingFeeShare.Cmp(eth.FromPerc(feeShare)) != 0 {
 			glog.Infof("Setting orchestrator config - Reward Cut: %v Fee Share: %v Price: %v", eth.FromPerc(blockRewardCut), eth.FromPerc(feeShare), big.NewInt(0))
 
-			tx, err := s.LivepeerNode.Eth.Transcoder(eth.FromPerc(blockRewardCut), eth.FromPerc(feeShare), big.NewInt(0))
+			tx, err = s.LivepeerNode.Eth.Transcoder(eth.FromPerc(blockRewardCut), eth.FromPerc(feeShare), big.NewInt(0))
 			if err != nil {
-				glog.Error(err)
+				respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
 				return
 			}
 
 			err = s.LivepeerNode.Eth.CheckTx(tx)
 			if err != nil {
-				glog.Error(err)
+				respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
 				return
 			}
 		}
 
 		if t.ServiceURI != serviceURI {
 			if err := s.setServiceURI(serviceURI); err != nil {
+				respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
 				return
 			}
 		}
+		respondWithStatus(w, tx, "")
 	})
 
 	//Bond some amount of tokens to an orchestrator.
 	mux.HandleFunc("/bond", func(w http.ResponseWriter, r *http.Request) {
 		if s.LivepeerNode.Eth != nil {
 			if err := r.ParseForm(); err != nil {
-				glog.Errorf("Parse Form Error: %v", err)
+				respondWith400(w, fmt.Sprintf("parse form error: %v", err))
 				return
 			}
 
 			amountStr := r.FormValue("amount")
 			if amountStr == "" {
-				glog.Errorf("Need to provide amount")
+				respondWithCliError(w, http.StatusBadRequest, CliErrMissingParam, "Need to provide amount")
 				return
 			}
 			amount, err := lpcommon.ParseBigInt(amountStr)
 			if err != nil {
-				glog.Errorf("Cannot convert amount: %v", err)
+				respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, fmt.Sprintf("Cannot convert amount: %v", err))
 				return
 			}
 
 			toAddr := r.FormValue("toAddr")
 			if toAddr == "" {
-				glog.Errorf("Need to provide to addr")
+				respondWithCliError(w, http.StatusBadRequest, CliErrMissingParam, "Need to provide to addr")
 				return
 			}
 
 			tx, err := s.LivepeerNode.Eth.Bond(amount, common.HexToAddress(toAddr))
 			if err != nil {
-				glog.Error(err)
+				respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
 				return
 			}
 
 			err = s.LivepeerNode.Eth.CheckTx(tx)
 			if err != nil {
-				glog.Error(err)
+				respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
 				return
 			}
+			respondWithStatus(w, tx, "")
+		} else {
+			respondMissingEth(w)
 		}
 	})
 
 	mux.HandleFunc("/rebond", func(w http.ResponseWriter, r *http.Request) {
 		if s.LivepeerNode.Eth != nil {
 			if err := r.ParseForm(); err != nil {
-				glog.Errorf("Parse Form Error: %v", err)
+				respondWith400(w, fmt.Sprintf("parse form error: %v", err))
 				return
 			}
 
 			unbondingLockIDStr := r.FormValue("unbondingLockId")
 			if unbondingLockIDStr == "" {
-				glog.Errorf("Need to provide unbondingLockId")
+				respondWithCliError(w, http.StatusBadRequest, CliErrMissingParam, "Need to provide unbondingLockId")
 				return
 			}
 			unbondingLockID, err := lpcommon.ParseBigInt(unbondingLockIDStr)
 			if err != nil {
-				glog.Errorf("Cannot convert unbondingLockId: %v", err)
+				respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, fmt.Sprintf("Cannot convert unbondingLockId: %v", err))
 				return
 			}
 
@@ -468,82 +650,95 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 				// toAddr not provided - invoke rebond()
 				tx, err = s.LivepeerNode.Eth.Rebond(unbondingLockID)
 			}
+			if err != nil {
+				respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
+				return
+			}
 
 			err = s.LivepeerNode.Eth.CheckTx(tx)
 			if err != nil {
-				glog.Error(err)
+				respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
 				return
 			}
+			respondWithStatus(w, tx, "")
+		} else {
+			respondMissingEth(w)
 		}
 	})
 
 	mux.HandleFunc("/unbond", func(w http.ResponseWriter, r *http.Request) {
 		if s.LivepeerNode.Eth != nil {
 			if err := r.ParseForm(); err != nil {
-				glog.Errorf("Parse Form Error: %v", err)
+				respondWith400(w, fmt.Sprintf("parse form error: %v", err))
 				return
 			}
 
 			amountStr := r.FormValue("amount")
 			if amountStr == "" {
-				glog.Errorf("Need to provide amount")
+				respondWithCliError(w, http.StatusBadRequest, CliErrMissingParam, "Need to provide amount")
 				return
 			}
 			amount, err := lpcommon.ParseBigInt(amountStr)
 			if err != nil {
-				glog.Errorf("Cannot convert amount: %v", err)
+				respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, fmt.Sprintf("Cannot convert amount: %v", err))
 				return
 			}
 
 			tx, err := s.LivepeerNode.Eth.Unbond(amount)
 			if err != nil {
-				glog.Error(err)
+				respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
 				return
 			}
 
 			err = s.LivepeerNode.Eth.CheckTx(tx)
 			if err != nil {
-				glog.Error(err)
+				respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
 				return
 			}
+			respondWithStatus(w, tx, "")
+		} else {
+			respondMissingEth(w)
 		}
 	})
 
 	mux.HandleFunc("/withdrawStake", func(w http.ResponseWriter, r *http.Request) {
 		if s.LivepeerNode.Eth != nil {
 			if err := r.ParseForm(); err != nil {
-				glog.Errorf("Parse Form Error: %v", err)
+				respondWith400(w, fmt.Sprintf("parse form error: %v", err))
 				return
 			}
 
 			unbondingLockIDStr := r.FormValue("unbondingLockId")
 			if unbondingLockIDStr == "" {
-				glog.Errorf("Need to provide unbondingLockID")
+				respondWithCliError(w, http.StatusBadRequest, CliErrMissingParam, "Need to provide unbondingLockID")
 				return
 			}
 			unbondingLockID, err := lpcommon.ParseBigInt(unbondingLockIDStr)
 			if err != nil {
-				glog.Errorf("Cannot convert unbondingLockId: %v", err)
+				respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, fmt.Sprintf("Cannot convert unbondingLockId: %v", err))
 				return
 			}
 			tx, err := s.LivepeerNode.Eth.WithdrawStake(unbondingLockID)
 			if err != nil {
-				glog.Error(err)
+				respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
 				return
 			}
 
 			err = s.LivepeerNode.Eth.CheckTx(tx)
 			if err != nil {
-				glog.Error(err)
+				respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
 				return
 			}
+			respondWithStatus(w, tx, "")
+		} else {
+			respondMissingEth(w)
 		}
 	})
 
 	mux.HandleFunc("/unbondingLocks", func(w http.ResponseWriter, r *http.Request) {
 		if s.LivepeerNode.Database != nil {
 			if err := r.ParseForm(); err != nil {
-				glog.Errorf("Parse Form Error: %v", err)
+				respondWith400(w, fmt.Sprintf("parse form error: %v", err))
 				return
 			}
 
@@ -551,14 +746,14 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 
 			d, err := s.LivepeerNode.Eth.GetDelegator(dAddr)
 			if err != nil {
-				glog.Error(err)
+				respondWith500(w, err.Error())
 				return
 			}
 
 			// Query for local IDs
 			unbondingLockIDs, err := s.LivepeerNode.Database.UnbondingLockIDs()
 			if err != nil {
-				glog.Error(err)
+				respondWith500(w, err.Error())
 				return
 			}
 
@@ -599,25 +794,20 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 			if withdrawable, err := strconv.ParseBool(withdrawableStr); withdrawable {
 				currentRound, err = s.LivepeerNode.Eth.CurrentRound()
 				if err != nil {
-					glog.Error(err)
+					respondWith500(w, err.Error())
 					return
 				}
 			}
 
 			unbondingLocks, err := s.LivepeerNode.Database.UnbondingLocks(currentRound)
 			if err != nil {
-				glog.Error(err)
-				return
-			}
-
-			data, err := json.Marshal(unbondingLocks)
-			if err != nil {
-				glog.Error(err)
+				respondWith500(w, err.Error())
 				return
 			}
 
-			w.Header().Set("Content-Type", "application/json")
-			w.Write(data)
+			respondWithJSON(w, unbondingLocks)
+		} else {
+			respondWithCliError(w, http.StatusInternalServerError, CliErrNotSupported, "missing database")
 		}
 	})
 
@@ -625,33 +815,36 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 		if s.LivepeerNode.Eth != nil {
 			tx, err := s.LivepeerNode.Eth.WithdrawFees()
 			if err != nil {
-				glog.Error(err)
+				respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
 				return
 			}
 
 			err = s.LivepeerNode.Eth.CheckTx(tx)
 			if err != nil {
-				glog.Error(err)
+				respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
 				return
 			}
+			respondWithStatus(w, tx, "")
+		} else {
+			respondMissingEth(w)
 		}
 	})
 
 	mux.HandleFunc("/claimEarnings", func(w http.ResponseWriter, r *http.Request) {
 		if s.LivepeerNode.Eth != nil {
 			if err := r.ParseForm(); err != nil {
-				glog.Errorf("Parse Form Error: %v", err)
+				respondWith400(w, fmt.Sprintf("parse form error: %v", err))
 				return
 			}
 
 			endRoundStr := r.FormValue("endRound")
 			if endRoundStr == "" {
-				glog.Errorf("Need to provide amount")
+				respondWithCliError(w, http.StatusBadRequest, CliErrMissingParam, "Need to provide endRound")
 				return
 			}
 			endRound, err := lpcommon.ParseBigInt(endRoundStr)
 			if err != nil {
-				glog.Error(err)
+				respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, err.Error())
 				return
 			}
 
@@ -672,8 +865,12 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 			}
 
 			if err := backoff.Retry(claim, backoff.WithMaxRetries(backoff.NewConstantBackOff(time.Second*15), 5)); err != nil {
-				glog.Errorf("Error claiming earnings: %v", err)
+				respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, fmt.Sprintf("Error claiming earnings: %v", err))
+				return
 			}
+			respondWithStatus(w, nil, "")
+		} else {
+			respondMissingEth(w)
 		}
 	})
 
@@ -681,18 +878,11 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 		if s.LivepeerNode.Eth != nil {
 			d, err := s.LivepeerNode.Eth.GetDelegator(s.LivepeerNode.Eth.Account().Address)
 			if err != nil {
-				glog.Error(err)
+				respondWith500(w, err.Error())
 				return
 			}
 
-			data, err := json.Marshal(d)
-			if err != nil {
-				glog.Error(err)
-				return
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.Write(data)
+			respondWithJSON(w, d)
 		} else {
 			w.Header().Set("Content-Type", "application/json")
 			w.Write([]byte("{}"))
@@ -704,42 +894,41 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 			roundStr := r.URL.Query().Get("round")
 			round, err := lpcommon.ParseBigInt(roundStr)
 			if err != nil {
-				glog.Error(err)
+				respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, err.Error())
 				return
 			}
 
 			tp, err := s.LivepeerNode.Eth.GetTranscoderEarningsPoolForRound(s.LivepeerNode.Eth.Account().Address, round)
 			if err != nil {
-				glog.Error(err)
-				return
-			}
-
-			data, err := json.Marshal(tp)
-			if err != nil {
-				glog.Error(err)
+				respondWith500(w, err.Error())
 				return
 			}
 
-			w.Header().Set("Content-Type", "application/json")
-			w.Write(data)
+			respondWithJSON(w, tp)
+		} else {
+			respondMissingEth(w)
 		}
 	})
 
 	//Print the current broadcast HLS streamID
 	mux.HandleFunc("/streamID", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(s.LastHLSStreamID().String()))
+		respondWithValue(w, "streamID", s.LastHLSStreamID().String(), s.LastHLSStreamID().String())
 	})
 
 	mux.HandleFunc("/manifestID", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(s.LastManifestID()))
+		respondWithValue(w, "manifestID", s.LastManifestID(), string(s.LastManifestID()))
 	})
 
+	streams := streamsHandler(s)
+	mux.Handle("/streams", streams)
+	mux.Handle("/streams/", streams)
+
 	mux.HandleFunc("/localStreams", func(w http.ResponseWriter, r *http.Request) {
 		// XXX fetch local streams?
 		ret := make([]map[string]string, 0)
 		js, err := json.Marshal(ret)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			respondWithError(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
@@ -748,7 +937,8 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 	})
 
 	mux.HandleFunc("/debug", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(fmt.Sprintf("\n\nLatestPlaylist: %v", s.LatestPlaylist())))
+		playlist := fmt.Sprintf("%v", s.LatestPlaylist())
+		respondWithValue(w, "latestPlaylist", playlist, "\n\nLatestPlaylist: "+playlist)
 	})
 
 	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
@@ -760,22 +950,386 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 				return
 			}
 		}
-		http.Error(w, "Error getting status", http.StatusInternalServerError)
+		respondWith500(w, "Error getting status")
 	})
 
-	mux.HandleFunc("/contractAddresses", func(w http.ResponseWriter, r *http.Request) {
-		if s.LivepeerNode.Eth != nil {
-			addrMap := s.LivepeerNode.Eth.ContractAddresses()
+	mux.HandleFunc("/creditLedger", func(w http.ResponseWriter, r *http.Request) {
+		if s.LivepeerNode.Balances == nil {
+			respondWithError(w, "Node does not hold credit balances", http.StatusInternalServerError)
+			return
+		}
+
+		type ledgerEntry struct {
+			ManifestID string `json:"manifestID"`
+			Sender     string `json:"sender"`
+			Amount     string `json:"amount"`
+			Reason     string `json:"reason"`
+			Time       int64  `json:"time"`
+		}
+		ledger := s.LivepeerNode.Balances.Ledger()
+		entries := make([]ledgerEntry, len(ledger))
+		for i, e := range ledger {
+			entries[i] = ledgerEntry{
+				ManifestID: string(e.ManifestID),
+				Sender:     e.Sender.Hex(),
+				Amount:     e.Amount.RatString(),
+				Reason:     e.Reason,
+				Time:       e.Time.Unix(),
+			}
+		}
+
+		respondWithJSON(w, entries)
+	})
+
+	mux.HandleFunc("/orchestratorReputation", func(w http.ResponseWriter, r *http.Request) {
+		if s.LivepeerNode.OrchReputation == nil {
+			respondWithError(w, "Node does not track orchestrator reputation", http.StatusInternalServerError)
+			return
+		}
+
+		data, err := json.Marshal(s.LivepeerNode.OrchReputation.Reputations())
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+
+	mux.HandleFunc("/segmentTrace", func(w http.ResponseWriter, r *http.Request) {
+		if SegmentTraces == nil {
+			respondWithError(w, "Node does not keep segment traces", http.StatusInternalServerError)
+			return
+		}
+
+		data, err := json.Marshal(SegmentTraces.Traces(core.ManifestID(r.URL.Query().Get("manifest"))))
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+
+	mux.HandleFunc("/traceSpans", func(w http.ResponseWriter, r *http.Request) {
+		if !monitor.TracingEnabled {
+			respondWithError(w, "Node does not trace segments", http.StatusInternalServerError)
+			return
+		}
+
+		data, err := json.Marshal(monitor.RecentSpans(r.URL.Query().Get("traceID")))
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+
+	// Sets the log verbosity of a module with POST module=<module>&level=<level>. A negative level
+	// resets the module to the -v verbosity. Returns the log format and the levels of the modules
+	mux.HandleFunc("/logLevels", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			if err := setLogLevel(r.FormValue("module"), r.FormValue("level")); err != nil {
+				respondWithError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		data, err := json.Marshal(clog.GetStatus())
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+
+	mux.HandleFunc("/debugCapture", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondWithError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		status, err := setDebugCapture(s.LivepeerNode.WorkDir, r)
+		if err != nil {
+			glog.Error("Error setting debug capture: ", err)
+			respondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if status == nil {
+			respondWithStatus(w, nil, "")
+			return
+		}
+		respondWithJSON(w, status)
+	})
+
+	mux.HandleFunc("/debugCaptures", func(w http.ResponseWriter, r *http.Request) {
+		data, err := json.Marshal(listDebugCaptures())
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
 
-			data, err := json.Marshal(addrMap)
+	mux.HandleFunc("/quotas", func(w http.ResponseWriter, r *http.Request) {
+		if BroadcastQuotas == nil {
+			respondWithError(w, "Node does not enforce stream quotas", http.StatusInternalServerError)
+			return
+		}
+
+		data, err := json.Marshal(quotaStatuses(BroadcastQuotas))
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+
+	mux.HandleFunc("/setQuota", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondWithError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if BroadcastQuotas == nil {
+			respondWithError(w, "Node does not enforce stream quotas", http.StatusInternalServerError)
+			return
+		}
+		if err := setQuota(BroadcastQuotas, r); err != nil {
+			glog.Error("Error setting quota: ", err)
+			respondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		respondWithStatus(w, nil, "")
+	})
+
+	mux.HandleFunc("/removeQuota", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondWithError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if BroadcastQuotas == nil {
+			respondWithError(w, "Node does not enforce stream quotas", http.StatusInternalServerError)
+			return
+		}
+		if err := removeQuota(BroadcastQuotas, r); err != nil {
+			glog.Error("Error removing quota: ", err)
+			respondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		respondWithStatus(w, nil, "")
+	})
+
+	mux.HandleFunc("/orchestratorLists", func(w http.ResponseWriter, r *http.Request) {
+		if s.LivepeerNode.OrchLists == nil {
+			respondWithError(w, "Node does not filter orchestrators", http.StatusInternalServerError)
+			return
+		}
+
+		data, err := json.Marshal(s.LivepeerNode.OrchLists.Lists())
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+
+	mux.HandleFunc("/addOrchestratorListEntry", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondWithError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if s.LivepeerNode.OrchLists == nil {
+			respondWithError(w, "Node does not filter orchestrators", http.StatusInternalServerError)
+			return
+		}
+		if err := s.LivepeerNode.OrchLists.Add(r.FormValue("list"), r.FormValue("pattern")); err != nil {
+			glog.Error("Error adding orchestrator list entry: ", err)
+			respondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		respondWithStatus(w, nil, "")
+	})
+
+	mux.HandleFunc("/removeOrchestratorListEntry", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondWithError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if s.LivepeerNode.OrchLists == nil {
+			respondWithError(w, "Node does not filter orchestrators", http.StatusInternalServerError)
+			return
+		}
+		list, pattern := r.FormValue("list"), r.FormValue("pattern")
+		removed, err := s.LivepeerNode.OrchLists.Remove(list, pattern)
+		if err != nil {
+			glog.Error("Error removing orchestrator list entry: ", err)
+			respondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !removed {
+			respondWithError(w, fmt.Sprintf("pattern %v is not in the %vlist", pattern, list), http.StatusNotFound)
+			return
+		}
+		respondWithStatus(w, nil, "")
+	})
+
+	mux.HandleFunc("/abTestReport", func(w http.ResponseWriter, r *http.Request) {
+		if BroadcastABTest == nil {
+			respondWithError(w, "Node is not running an A/B test", http.StatusInternalServerError)
+			return
+		}
+
+		data, err := json.Marshal(BroadcastABTest.Report())
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+
+	mux.HandleFunc("/spendReport", func(w http.ResponseWriter, r *http.Request) {
+		if BroadcastSpendReporter == nil {
+			respondWithError(w, "Node does not record payments", http.StatusInternalServerError)
+			return
+		}
+
+		until := time.Now()
+		if v := r.FormValue("until"); v != "" {
+			ts, err := strconv.ParseInt(v, 10, 64)
 			if err != nil {
-				glog.Error(err)
-				w.WriteHeader(http.StatusInternalServerError)
+				respondWith400(w, fmt.Sprintf("invalid until: %v", v))
 				return
 			}
+			until = time.Unix(ts, 0)
+		}
+		window := defaultSpendReportWindow
+		if v := r.FormValue("window"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				respondWith400(w, fmt.Sprintf("invalid window: %v", v))
+				return
+			}
+			window = d
+		}
+		since := until.Add(-window)
+		if v := r.FormValue("since"); v != "" {
+			ts, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || ts >= until.Unix() {
+				respondWith400(w, fmt.Sprintf("invalid since: %v", v))
+				return
+			}
+			since = time.Unix(ts, 0)
+		}
 
-			w.Header().Set("Content-Type", "application/json")
-			w.Write(data)
+		report, err := BroadcastSpendReporter.Report(since, until)
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		respondWithJSON(w, report)
+	})
+
+	mux.HandleFunc("/protocolExchanges", func(w http.ResponseWriter, r *http.Request) {
+		if Archive == nil {
+			respondWithError(w, "Node does not archive exchanges", http.StatusInternalServerError)
+			return
+		}
+
+		until := time.Now()
+		if v := r.FormValue("until"); v != "" {
+			ts, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				respondWith400(w, fmt.Sprintf("invalid until: %v", v))
+				return
+			}
+			until = time.Unix(ts, 0)
+		}
+		since := until.Add(-time.Hour)
+		if v := r.FormValue("since"); v != "" {
+			ts, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || ts > until.Unix() {
+				respondWith400(w, fmt.Sprintf("invalid since: %v", v))
+				return
+			}
+			since = time.Unix(ts, 0)
+		}
+
+		exchanges, err := Archive.Exchanges(since, until)
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		respondWithJSON(w, exchanges)
+	})
+
+	mux.HandleFunc("/replayExchange", func(w http.ResponseWriter, r *http.Request) {
+		if Archive == nil {
+			respondWithError(w, "Node does not archive exchanges", http.StatusInternalServerError)
+			return
+		}
+		id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+		if err != nil {
+			respondWith400(w, fmt.Sprintf("invalid id: %v", r.FormValue("id")))
+			return
+		}
+		replay, err := Archive.Replay(id)
+		if err == errExchangeNotFound {
+			respondWithError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		respondWithJSON(w, replay)
+	})
+
+	mux.HandleFunc("/resetABTest", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondWithError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if BroadcastABTest == nil {
+			respondWithError(w, "Node is not running an A/B test", http.StatusInternalServerError)
+			return
+		}
+		BroadcastABTest.Reset()
+		respondWithStatus(w, nil, "")
+	})
+
+	mux.HandleFunc("/purge", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondWithError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		report, err := s.Purge(core.ManifestID(r.FormValue("manifestID")), r.FormValue("namespace"))
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		data, err := json.Marshal(report)
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if len(report.Errors) > 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write(data)
+	})
+
+	mux.HandleFunc("/contractAddresses", func(w http.ResponseWriter, r *http.Request) {
+		if s.LivepeerNode.Eth != nil {
+			addrMap := s.LivepeerNode.Eth.ContractAddresses()
+
+			respondWithJSON(w, addrMap)
 		} else {
 			w.Header().Set("Content-Type", "application/json")
 			w.Write([]byte("{}"))
@@ -788,61 +1342,61 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 
 			numActiveOrchestrators, err := lp.NumActiveTranscoders()
 			if err != nil {
-				glog.Error(err)
+				respondWith500(w, err.Error())
 				return
 			}
 
 			roundLength, err := lp.RoundLength()
 			if err != nil {
-				glog.Error(err)
+				respondWith500(w, err.Error())
 				return
 			}
 
 			roundLockAmount, err := lp.RoundLockAmount()
 			if err != nil {
-				glog.Error(err)
+				respondWith500(w, err.Error())
 				return
 			}
 
 			unbondingPeriod, err := lp.UnbondingPeriod()
 			if err != nil {
-				glog.Error(err)
+				respondWith500(w, err.Error())
 				return
 			}
 
 			inflation, err := lp.Inflation()
 			if err != nil {
-				glog.Error(err)
+				respondWith500(w, err.Error())
 				return
 			}
 
 			inflationChange, err := lp.InflationChange()
 			if err != nil {
-				glog.Error(err)
+				respondWith500(w, err.Error())
 				return
 			}
 
 			targetBondingRate, err := lp.TargetBondingRate()
 			if err != nil {
-				glog.Error(err)
+				respondWith500(w, err.Error())
 				return
 			}
 
 			totalBonded, err := lp.GetTotalBonded()
 			if err != nil {
-				glog.Error(err)
+				respondWith500(w, err.Error())
 				return
 			}
 
 			totalSupply, err := lp.TotalSupply()
 			if err != nil {
-				glog.Error(err)
+				respondWith500(w, err.Error())
 				return
 			}
 
 			paused, err := lp.Paused()
 			if err != nil {
-				glog.Error(err)
+				respondWith500(w, err.Error())
 				return
 			}
 
@@ -859,20 +1413,18 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 				Paused:               paused,
 			}
 
-			data, err := json.Marshal(params)
-			if err != nil {
-				glog.Error(err)
-				return
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.Write(data)
+			respondWithJSON(w, params)
+		} else {
+			respondMissingEth(w)
 		}
 	})
 
 	mux.HandleFunc("/ethAddr", func(w http.ResponseWriter, r *http.Request) {
 		if s.LivepeerNode.Eth != nil {
-			w.Write([]byte(s.LivepeerNode.Eth.Account().Address.Hex()))
+			addr := s.LivepeerNode.Eth.Account().Address.Hex()
+			respondWithValue(w, "address", addr, addr)
+		} else {
+			respondMissingEth(w)
 		}
 	})
 
@@ -881,10 +1433,16 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 			b, err := s.LivepeerNode.Eth.BalanceOf(s.LivepeerNode.Eth.Account().Address)
 			if err != nil {
 				glog.Error(err)
-				w.Write([]byte(""))
-			} else {
-				w.Write([]byte(b.String()))
+				if LegacyCliResponses {
+					w.Write([]byte(""))
+				} else {
+					respondWith500(w, err.Error())
+				}
+				return
 			}
+			respondWithValue(w, "balance", b.String(), b.String())
+		} else {
+			respondMissingEth(w)
 		}
 	})
 
@@ -892,17 +1450,23 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 		if s.LivepeerNode.Eth != nil {
 			b, err := s.LivepeerNode.Eth.Backend()
 			if err != nil {
-				glog.Error(err)
+				respondWith500(w, err.Error())
 				return
 			}
 
 			balance, err := b.BalanceAt(context.Background(), s.LivepeerNode.Eth.Account().Address, nil)
 			if err != nil {
 				glog.Error(err)
-				w.Write([]byte(""))
-			} else {
-				w.Write([]byte(balance.String()))
+				if LegacyCliResponses {
+					w.Write([]byte(""))
+				} else {
+					respondWith500(w, err.Error())
+				}
+				return
 			}
+			respondWithValue(w, "balance", balance.String(), balance.String())
+		} else {
+			respondMissingEth(w)
 		}
 	})
 
@@ -910,18 +1474,13 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 		if s.LivepeerNode.Eth != nil {
 			orchestrators, err := s.LivepeerNode.Eth.RegisteredTranscoders()
 			if err != nil {
-				glog.Error(err)
+				respondWith500(w, err.Error())
 				return
 			}
 
-			data, err := json.Marshal(orchestrators)
-			if err != nil {
-				glog.Error(err)
-				return
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.Write(data)
+			respondWithJSON(w, orchestrators)
+		} else {
+			respondMissingEth(w)
 		}
 	})
 
@@ -929,7 +1488,7 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 		if s.LivepeerNode.Eth != nil {
 			t, err := s.LivepeerNode.Eth.GetTranscoder(s.LivepeerNode.Eth.Account().Address)
 			if err != nil {
-				glog.Error(err)
+				respondWith500(w, err.Error())
 				return
 			}
 
@@ -941,14 +1500,9 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 				PriceInfo:  s.LivepeerNode.GetBasePrice(),
 			}
 
-			data, err := json.Marshal(config)
-			if err != nil {
-				glog.Error(err)
-				return
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.Write(data)
+			respondWithJSON(w, config)
+		} else {
+			respondMissingEth(w)
 		}
 	})
 
@@ -956,34 +1510,37 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 		if s.LivepeerNode.Eth != nil {
 			to := r.FormValue("to")
 			if to == "" {
-				glog.Errorf("Need to provide to address")
+				respondWithCliError(w, http.StatusBadRequest, CliErrMissingParam, "Need to provide to address")
 				return
 			}
 
 			amountStr := r.FormValue("amount")
 			if amountStr == "" {
-				glog.Errorf("Need to provide amount")
+				respondWithCliError(w, http.StatusBadRequest, CliErrMissingParam, "Need to provide amount")
 				return
 			}
 			amount, err := lpcommon.ParseBigInt(amountStr)
 			if err != nil {
-				glog.Error(err)
+				respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, err.Error())
 				return
 			}
 
 			tx, err := s.LivepeerNode.Eth.Transfer(common.HexToAddress(to), amount)
 			if err != nil {
-				glog.Error(err)
+				respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
 				return
 			}
 
 			err = s.LivepeerNode.Eth.CheckTx(tx)
 			if err != nil {
-				glog.Error(err)
+				respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, err.Error())
 				return
 			}
 
 			glog.Infof("Transferred %v to %v", eth.FormatUnits(amount, "LPT"), to)
+			respondWithStatus(w, tx, "")
+		} else {
+			respondMissingEth(w)
 		}
 	})
 
@@ -993,73 +1550,109 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 
 			tx, err := s.LivepeerNode.Eth.Request()
 			if err != nil {
-				glog.Errorf("Error requesting tokens from faucet: %v", err)
+				respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, fmt.Sprintf("Error requesting tokens from faucet: %v", err))
 				return
 			}
 
 			err = s.LivepeerNode.Eth.CheckTx(tx)
 			if err != nil {
-				glog.Errorf("Error requesting tokens from faucet: %v", err)
+				respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, fmt.Sprintf("Error requesting tokens from faucet: %v", err))
 				return
 			}
+			respondWithStatus(w, tx, "")
+		} else {
+			respondMissingEth(w)
 		}
 	})
 
 	mux.HandleFunc("/IsOrchestrator", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(fmt.Sprintf("%v", s.LivepeerNode.NodeType == core.OrchestratorNode)))
+		isOrch := s.LivepeerNode.NodeType == core.OrchestratorNode
+		respondWithValue(w, "orchestrator", isOrch, fmt.Sprintf("%v", isOrch))
 	})
 
 	mux.HandleFunc("/EthNetworkID", func(w http.ResponseWriter, r *http.Request) {
 		if s.LivepeerNode.Eth == nil {
-			w.Write([]byte("offchain"))
+			respondWithValue(w, "networkID", "offchain", "offchain")
 			return
 		}
 		be, err := s.LivepeerNode.Eth.Backend()
 		if err != nil {
-			glog.Errorf("Error getting eth backend: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			respondWith500(w, fmt.Sprintf("Error getting eth backend: %v", err))
 			return
 		}
 		networkID, err := be.NetworkID(context.Background())
 		if err != nil {
-			glog.Errorf("Error getting eth network ID: %v", err)
+			respondWith500(w, fmt.Sprintf("Error getting eth network ID: %v", err))
+			return
 		}
-		w.Write([]byte(networkID.String()))
+		respondWithValue(w, "networkID", networkID.String(), networkID.String())
 	})
 
 	mux.HandleFunc("/reward", func(w http.ResponseWriter, r *http.Request) {
+		if s.LivepeerNode.Eth == nil {
+			respondMissingEth(w)
+			return
+		}
 		glog.Infof("Calling reward")
 		tx, err := s.LivepeerNode.Eth.Reward()
 		if err != nil {
-			glog.Errorf("Error calling reward: %v", err)
+			respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, fmt.Sprintf("Error calling reward: %v", err))
 			return
 		}
 		if err := s.LivepeerNode.Eth.CheckTx(tx); err != nil {
-			glog.Errorf("Error calling reward: %v", err)
+			respondWithCliError(w, http.StatusInternalServerError, CliErrTransaction, fmt.Sprintf("Error calling reward: %v", err))
 			return
 		}
 		glog.Infof("Call to reward successful")
+		respondWithStatus(w, tx, "")
 	})
 
 	mux.HandleFunc("/gasPrice", func(w http.ResponseWriter, r *http.Request) {
-		_, gprice := s.LivepeerNode.Eth.GetGasInfo()
-		if gprice == nil {
-			w.Write([]byte("0"))
-		} else {
-			w.Write([]byte(gprice.String()))
+		if s.LivepeerNode.Eth == nil {
+			respondMissingEth(w)
+			return
 		}
+		price := "0"
+		if _, gprice := s.LivepeerNode.Eth.GetGasInfo(); gprice != nil {
+			price = gprice.String()
+		}
+		respondWithValue(w, "gasPrice", price, price)
+	})
+
+	mux.HandleFunc("/txQueue", func(w http.ResponseWriter, r *http.Request) {
+		if s.LivepeerNode.Eth == nil {
+			respondMissingEth(w)
+			return
+		}
+		txQueue := s.LivepeerNode.Eth.TxQueue()
+		if txQueue == nil {
+			respondWithError(w, "Node does not queue transactions", http.StatusInternalServerError)
+			return
+		}
+
+		data, err := json.Marshal(txQueue.Status())
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
 	})
 
 	mux.HandleFunc("/setGasPrice", func(w http.ResponseWriter, r *http.Request) {
+		if s.LivepeerNode.Eth == nil {
+			respondMissingEth(w)
+			return
+		}
 		amount := r.FormValue("amount")
 		if amount == "" {
-			glog.Errorf("Need to set amount")
+			respondWithCliError(w, http.StatusBadRequest, CliErrMissingParam, "Need to set amount")
 			return
 		}
 
 		gprice, err := lpcommon.ParseBigInt(amount)
 		if err != nil {
-			glog.Errorf("Parsing failed for price: %v", err)
+			respondWithCliError(w, http.StatusBadRequest, CliErrInvalidParam, fmt.Sprintf("Parsing failed for price: %v", err))
 			return
 		}
 		if amount == "0" {
@@ -1068,24 +1661,31 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 
 		glimit, _ := s.LivepeerNode.Eth.GetGasInfo()
 		if err := s.LivepeerNode.Eth.SetGasInfo(glimit, gprice); err != nil {
-			glog.Errorf("Error setting price info: %v", err)
+			respondWith500(w, fmt.Sprintf("Error setting price info: %v", err))
+			return
 		}
+		respondWithStatus(w, nil, "")
 	})
 
 	mux.Handle("/currentBlock", currentBlockHandler(s.LivepeerNode.Database))
 
 	// TicketBroker
 
-	mux.Handle("/fundDepositAndReserve", mustHaveFormParams(fundDepositAndReserveHandler(s.LivepeerNode.Eth), "depositAmount", "reserveAmount"))
-	mux.Handle("/fundDeposit", mustHaveFormParams(fundDepositHandler(s.LivepeerNode.Eth), "amount"))
-	mux.Handle("/unlock", unlockHandler(s.LivepeerNode.Eth))
-	mux.Handle("/cancelUnlock", cancelUnlockHandler(s.LivepeerNode.Eth))
-	mux.Handle("/withdraw", withdrawHandler(s.LivepeerNode.Eth))
+	// Transactions submitted by asynchronous requests
+	txs := NewTxTracker()
+	mux.Handle("/fundDepositAndReserve", mustHaveFormParams(fundDepositAndReserveHandler(s.LivepeerNode.Eth, txs), "depositAmount", "reserveAmount"))
+	mux.Handle("/fundDeposit", mustHaveFormParams(fundDepositHandler(s.LivepeerNode.Eth, txs), "amount"))
+	mux.Handle("/fundReserve", mustHaveFormParams(fundReserveHandler(s.LivepeerNode.Eth, txs), "amount"))
+	mux.Handle("/unlock", unlockHandler(s.LivepeerNode.Eth, txs))
+	mux.Handle("/cancelUnlock", cancelUnlockHandler(s.LivepeerNode.Eth, txs))
+	mux.Handle("/withdraw", withdrawHandler(s.LivepeerNode.Eth, txs))
+	mux.Handle("/withdrawDeposit", mustHaveFormParams(withdrawDepositHandler(s.LivepeerNode.Eth, txs), "amount"))
 	mux.Handle("/senderInfo", senderInfoHandler(s.LivepeerNode.Eth))
+	mux.Handle("/txStatus/", txStatusHandler(txs))
 	mux.Handle("/ticketBrokerParams", ticketBrokerParamsHandler(s.LivepeerNode.Eth))
 
 	// Metrics
-	if monitor.Enabled {
+	if monitor.Enabled && monitor.Exporter != nil {
 		mux.Handle("/metrics", monitor.Exporter)
 
 	}
@@ -1113,3 +1713,25 @@ func (s *LivepeerServer) setOrchestratorPriceInfo(pricePerUnitStr, pixelsPerUnit
 	glog.Infof("Price per pixel set to %d wei for %d pixels\n", pricePerUnit, pixelsPerUnit)
 	return nil
 }
+
+// respondRuntimeConfig responds with the value of a setting of the node as a JSON object
+func respondRuntimeConfig(w http.ResponseWriter, name string, value interface{}) {
+	respondWithJSON(w, map[string]interface{}{name: value})
+}
+
+// setLogLevel sets the log verbosity of a module of the node
+func setLogLevel(module, level string) error {
+	known := false
+	for _, m := range clog.Modules() {
+		known = known || m == module
+	}
+	if !known {
+		return fmt.Errorf("unknown module %q. Modules are %v", module, strings.Join(clog.Modules(), ","))
+	}
+	l, err := strconv.Atoi(level)
+	if err != nil {
+		return fmt.Errorf("invalid level %q", level)
+	}
+	clog.SetLevel(module, l)
+	return nil
+}
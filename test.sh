@@ -50,7 +50,10 @@ cd ..
 ./test_args.sh
 t_args=$?
 
-if (($t1!=0||$t2!=0||$t3!=0||$t4!=0||$t5!=0||$t6!=0||$t7!=0||$t8!=0||$t9!=0||$t_args!=0))
+go run ./cmd/e2e
+t_e2e=$?
+
+if (($t1!=0||$t2!=0||$t3!=0||$t4!=0||$t5!=0||$t6!=0||$t7!=0||$t8!=0||$t9!=0||$t_args!=0||$t_e2e!=0))
 then
     printf "\n\nSome Tests Failed\n\n"
     exit -1
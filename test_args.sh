@@ -73,7 +73,7 @@ run_lp -broadcaster -datadir "$CUSTOM_DATADIR" -network rinkeby $ETH_ARGS
 kill $pid
 
 # check invalid service address via inserting control character
-./livepeer -orchestrator -orchSecret asdf -serviceAddr "hibye" 2>&1 | grep "Error getting service URI"
+./livepeer -orchestrator -orchSecret asdf -serviceAddr "hibye" 2>&1 | grep "Preflight check failed: service address"
 [ ${PIPESTATUS[0]} -ne 0 ]
 
 # check missing service address via failed availability check